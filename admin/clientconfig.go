@@ -3,6 +3,8 @@ package admin
 import (
 	"fmt"
 	"maps"
+	"net"
+	"net/url"
 	"slices"
 
 	"github.com/mjl-/mox/config"
@@ -25,13 +27,30 @@ type ProtocolConfig struct {
 	EnabledOnHTTPS bool
 }
 
+// DAVConfig is the location of the CalDAV/CardDAV service, always with TLS.
+type DAVConfig struct {
+	Host dns.Domain
+	Port int
+	Path string // With trailing slash, e.g. "/dav/".
+}
+
+// URL returns the https URL of the DAV service.
+func (c DAVConfig) URL() string {
+	u := url.URL{Scheme: "https", Host: c.Host.ASCII, Path: c.Path}
+	if c.Port != 443 {
+		u.Host = net.JoinHostPort(u.Host, fmt.Sprintf("%d", c.Port))
+	}
+	return u.String()
+}
+
 type ClientConfig struct {
 	IMAP       ProtocolConfig
 	Submission ProtocolConfig
+	DAV        *DAVConfig // Nil if no CalDAV/CardDAV with HTTPS is configured.
 }
 
 // ClientConfigDomain returns a single IMAP and Submission client configuration for
-// a domain.
+// a domain, and CalDAV/CardDAV configuration if available.
 func ClientConfigDomain(d dns.Domain) (rconfig ClientConfig, rerr error) {
 	var haveIMAP, haveSubmission bool
 
@@ -80,7 +99,14 @@ func ClientConfigDomain(d dns.Domain) (rconfig ClientConfig, rerr error) {
 			}
 			haveSubmission = true
 		}
-		return haveIMAP && haveSubmission
+		if rconfig.DAV == nil && l.DAVHTTPS.Enabled {
+			path := l.DAVHTTPS.Path
+			if path == "" {
+				path = "/dav/"
+			}
+			rconfig.DAV = &DAVConfig{host, config.Port(l.DAVHTTPS.Port, 443), path}
+		}
+		return haveIMAP && haveSubmission && rconfig.DAV != nil
 	}
 
 	// Look at the public listener first. Most likely the intended configuration.
@@ -96,11 +122,14 @@ func ClientConfigDomain(d dns.Domain) (rconfig ClientConfig, rerr error) {
 			return
 		}
 	}
+	if haveIMAP && haveSubmission {
+		return
+	}
 	return ClientConfig{}, fmt.Errorf("%w: no listeners found for imap and/or submission", ErrRequest)
 }
 
-// ClientConfigs holds the client configuration for IMAP/Submission for a
-// domain.
+// ClientConfigs holds the client configuration for IMAP/Submission and
+// CalDAV/CardDAV for a domain.
 type ClientConfigs struct {
 	Entries []ClientConfigsEntry
 }
@@ -113,8 +142,8 @@ type ClientConfigsEntry struct {
 	Note     string
 }
 
-// ClientConfigsDomain returns the client configs for IMAP/Submission for a
-// domain.
+// ClientConfigsDomain returns the client configs for IMAP/Submission and
+// CalDAV/CardDAV for a domain.
 func ClientConfigsDomain(d dns.Domain) (ClientConfigs, error) {
 	domConf, ok := mox.Conf.Domain(d)
 	if !ok {
@@ -169,7 +198,34 @@ func ClientConfigsDomain(d dns.Domain) (ClientConfigs, error) {
 		if l.IMAP.Enabled {
 			c.Entries = append(c.Entries, ClientConfigsEntry{"IMAP", host, config.Port(l.IMAPS.Port, 143), name, note(l.TLS != nil, !l.IMAP.NoRequireSTARTTLS)})
 		}
+		if l.DAVHTTPS.Enabled {
+			path := l.DAVHTTPS.Path
+			if path == "" {
+				path = "/dav/"
+			}
+			c.Entries = append(c.Entries, ClientConfigsEntry{"CalDAV/CardDAV", host, config.Port(l.DAVHTTPS.Port, 443), name, "with TLS, path " + path})
+		}
 	}
 
 	return c, nil
 }
+
+// davHTTPS returns the port and path of the first CalDAV/CardDAV service with
+// HTTPS, looking at the public listener first.
+func davHTTPS() (port int, path string, ok bool) {
+	names := slices.Sorted(maps.Keys(mox.Conf.Static.Listeners))
+	if _, ok := mox.Conf.Static.Listeners["public"]; ok {
+		names = append([]string{"public"}, names...)
+	}
+	for _, name := range names {
+		l := mox.Conf.Static.Listeners[name]
+		if l.DAVHTTPS.Enabled {
+			path := l.DAVHTTPS.Path
+			if path == "" {
+				path = "/dav/"
+			}
+			return config.Port(l.DAVHTTPS.Port, 443), path, true
+		}
+	}
+	return 0, "", false
+}
@@ -1,17 +1,20 @@
 package admin
 
 import (
+	"context"
 	"crypto"
 	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
 	"fmt"
+	"log/slog"
 	"net/url"
 	"strings"
 
 	"github.com/mjl-/adns"
 
+	"github.com/mjl-/mox/bimi"
 	"github.com/mjl-/mox/config"
 	"github.com/mjl-/mox/dkim"
 	"github.com/mjl-/mox/dmarc"
@@ -242,6 +245,16 @@ func DomainRecords(domConf config.Domain, domain dns.Domain, hasDNSSEC bool, cer
 		)
 	}
 
+	if domConf.BIMI != nil {
+		selector, bimir := BIMIRecord(*domConf.BIMI)
+		records = append(records,
+			"; Mail clients can show the logo for messages from this domain that pass DMARC",
+			"; (with policy quarantine or reject) with BIMI.",
+			fmt.Sprintf(`%s._bimi.%s.     TXT %s`, selector, d, mox.TXTStrings(bimir.String())),
+			"",
+		)
+	}
+
 	if csd != h {
 		records = append(records,
 			"; Client settings will reference a subdomain of the hosted domain, making it",
@@ -278,6 +291,18 @@ func DomainRecords(domConf config.Domain, domain dns.Domain, hasDNSSEC bool, cer
 		fmt.Sprintf(`_pop3s._tcp.%s.        SRV 0 0 0 .`, d),
 	)
 
+	if port, path, ok := davHTTPS(); ok {
+		// RFC 6764 section 3 and 4.
+		records = append(records,
+			"",
+			"; For CalDAV and CardDAV autoconfig, point to mail host and path of the DAV service.",
+			fmt.Sprintf(`_caldavs._tcp.%s.      SRV 0 1 %d %s.`, d, port, csd),
+			fmt.Sprintf(`_caldavs._tcp.%s.      TXT "path=%s"`, d, path),
+			fmt.Sprintf(`_carddavs._tcp.%s.     SRV 0 1 %d %s.`, d, port, csd),
+			fmt.Sprintf(`_carddavs._tcp.%s.     TXT "path=%s"`, d, path),
+		)
+	}
+
 	if certIssuerDomainName != "" {
 		// ../rfc/8659:18 for CAA records.
 		records = append(records,
@@ -325,3 +350,45 @@ func DomainRecords(domConf config.Domain, domain dns.Domain, hasDNSSEC bool, cer
 	}
 	return records, nil
 }
+
+// BIMIRecord returns the selector and the BIMI DNS record for the BIMI
+// configuration of a domain.
+func BIMIRecord(c config.BIMI) (selector string, record bimi.Record) {
+	selector = c.Selector
+	if selector == "" {
+		selector = bimi.DefaultSelector
+	}
+	return selector, bimi.Record{Version: "BIMI1", Location: c.LogoURL, Authority: c.AuthorityURL}
+}
+
+// CheckBIMI looks up the BIMI record of a domain for its configured selector, and
+// checks that it matches the configuration, that the logo is valid SVG Tiny PS,
+// and that a referenced mark certificate verifies. The DNS TXT record is
+// returned, along with the problems found.
+func CheckBIMI(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, c config.BIMI, domain dns.Domain) (txt string, errs []error) {
+	selector, exp := BIMIRecord(c)
+	rdom, record, txt, err := bimi.Lookup(ctx, elog, resolver, selector, domain)
+	if err != nil {
+		return "", []error{fmt.Errorf("looking up bimi record: %w", err)}
+	}
+	if rdom != domain {
+		errs = append(errs, fmt.Errorf("bimi record found at organizational domain %s, not at domain itself", rdom))
+	}
+	if *record != exp {
+		errs = append(errs, fmt.Errorf("bimi record %q does not match configuration %q", record.String(), exp.String()))
+	}
+	if record.Declined() {
+		return txt, append(errs, fmt.Errorf("bimi record declines participation, it has no logo or certificate"))
+	}
+	if record.Location != "" {
+		if _, err := bimi.FetchLogo(ctx, elog, record.Location); err != nil {
+			errs = append(errs, fmt.Errorf("fetching logo: %w", err))
+		}
+	}
+	if record.Authority != "" {
+		if _, _, err := bimi.FetchCertificate(ctx, elog, record.Authority, []dns.Domain{domain}); err != nil {
+			errs = append(errs, fmt.Errorf("fetching mark certificate: %w", err))
+		}
+	}
+	return txt, errs
+}
@@ -0,0 +1,454 @@
+// Package attachpolicy evaluates attachment rules against messages, for blocking
+// dangerous attachments like executables, Office documents with macros and
+// encrypted archives.
+//
+// A message is inspected once, with Inspect, gathering the declared and detected
+// content type, file name and size of each part, and the names of files inside
+// zip archives. Archives that cannot be inspected, like rar and 7z archives, are
+// marked as such. The inspection can then be evaluated against the rules of each
+// account and domain involved in a delivery. Matching parts can be removed from
+// a message with Strip, replacing them with a text part with a notice.
+package attachpolicy
+
+import (
+	"archive/zip"
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/quotedprintable"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/message"
+	"github.com/mjl-/mox/mlog"
+)
+
+// Action to take for a message with matching parts. Values are those of
+// config.AttachmentRule.Action.
+type Action string
+
+const (
+	ActionNone       Action = ""
+	ActionStrip      Action = "strip"
+	ActionQuarantine Action = "quarantine"
+	ActionReject     Action = "reject"
+)
+
+// Direction of a message, rules can apply to incoming and/or outgoing messages.
+type Direction string
+
+const (
+	Incoming Direction = "incoming"
+	Outgoing Direction = "outgoing"
+)
+
+// Maximum decoded size of zip archives we read into memory to list the files
+// inside. Larger archives are not inspected, and marked uninspectable.
+const maxArchiveSize = 32 * 1024 * 1024
+
+// Attachment is a non-multipart part of a message, possibly inside an embedded
+// message.
+type Attachment struct {
+	Filename      string   // From Content-Disposition or Content-Type "name" parameter, may be empty.
+	Attached      bool     // Content-Disposition "attachment", or with a file name. Otherwise a body part.
+	DeclaredType  string   // Lower-case, e.g. "application/octet-stream". Empty if absent.
+	DetectedType  string   // Lower-case, based on the data. Empty if unknown.
+	Size          int64    // Decoded size.
+	ArchiveNames  []string // Names of files inside a zip archive.
+	Encrypted     bool     // Zip archive with encrypted files.
+	Uninspectable bool     // Archive we cannot look into: rar/7z, or zip that is too large or malformed.
+
+	// Byte range in the message to replace when stripping this attachment: the header
+	// and body of the part, or of the top-level embedded message this part is in. If
+	// Start is -1, the attachment is the message itself and cannot be stripped.
+	Start, End int64
+}
+
+// Inspection holds the attachments of a message.
+type Inspection struct {
+	Attachments []Attachment
+}
+
+// Match is an attachment matching a rule.
+type Match struct {
+	Rule       config.AttachmentRule
+	Attachment Attachment
+	Reason     string // Human-readable, e.g. `extension ".exe"`.
+}
+
+// Verdict is the result of evaluating rules against an inspection.
+type Verdict struct {
+	Action  Action  // Most severe action of the matches. Empty if nothing matched.
+	Matches []Match // Matches for Action.
+}
+
+// Inspect parses the message in r and gathers information about each part.
+// Parsing errors are logged, attachments found until the error are still
+// returned.
+func Inspect(elog *slog.Logger, r io.ReaderAt, size int64) *Inspection {
+	log := mlog.New("attachpolicy", elog)
+
+	p, err := message.EnsurePart(log.Logger, false, r, size)
+	if err != nil {
+		log.Debugx("parsing message for attachment inspection, continuing with fallback part", err)
+	}
+	if err := p.Walk(log.Logger, nil); err != nil {
+		log.Debugx("walking message parts for attachment inspection, continuing with parts parsed so far", err)
+	}
+
+	in := &Inspection{}
+	in.inspect(log, p, false, -1, -1)
+	return in
+}
+
+// inspect adds the attachments of p, recursively. If embedded is set, p is
+// (inside) an embedded message, and start/end is the range of the part in the
+// top-level message that embeds it, or -1 if the top-level message itself is an
+// embedded message.
+func (in *Inspection) inspect(log mlog.Log, p message.Part, embedded bool, start, end int64) {
+	if !embedded {
+		start, end = -1, -1
+		if p.BoundaryOffset >= 0 {
+			start, end = p.HeaderOffset, p.EndOffset
+		}
+	}
+
+	if p.MediaType == "MULTIPART" {
+		for _, pp := range p.Parts {
+			in.inspect(log, pp, embedded, start, end)
+		}
+		return
+	}
+
+	a := Attachment{
+		Size:  p.DecodedSize,
+		Start: start,
+		End:   end,
+	}
+	if p.MediaType != "" {
+		a.DeclaredType = strings.ToLower(p.MediaType + "/" + p.MediaSubType)
+	}
+	if disp, filename, err := p.DispositionFilename(); err != nil {
+		log.Debugx("parsing attachment file name", err)
+		// Be conservative, a part with unparsable disposition is treated as attachment.
+		a.Attached = true
+	} else {
+		a.Filename = filename
+		a.Attached = strings.EqualFold(disp, "attachment") || filename != ""
+	}
+
+	if p.Message != nil {
+		a.DetectedType = "message/rfc822"
+		in.Attachments = append(in.Attachments, a)
+		in.inspect(log, *p.Message, true, start, end)
+		return
+	}
+	if p.EndOffset >= 0 {
+		a.DetectedType, a.ArchiveNames, a.Encrypted, a.Uninspectable = detect(log, p)
+	}
+	in.Attachments = append(in.Attachments, a)
+}
+
+// detect determines the content type of the part from its data. For zip
+// archives, the names of files inside are returned, and whether any are
+// encrypted. Archives we cannot list the files of are returned as uninspectable.
+func detect(log mlog.Log, p message.Part) (detected string, names []string, encrypted, uninspectable bool) {
+	r := p.Reader()
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		log.Debugx("reading part for content type detection", err)
+		return "", nil, false, false
+	}
+	buf = buf[:n]
+	if n == 0 {
+		return "", nil, false, false
+	}
+
+	detected = sniff(buf)
+	switch detected {
+	case "application/x-rar-compressed", "application/x-7z-compressed":
+		return detected, nil, false, true
+	case "application/zip":
+	default:
+		return detected, nil, false, false
+	}
+
+	if p.DecodedSize > maxArchiveSize {
+		log.Debug("zip archive too large for inspection", slog.Int64("size", p.DecodedSize))
+		return detected, nil, false, true
+	}
+	rest, err := io.ReadAll(io.LimitReader(r, maxArchiveSize))
+	if err != nil {
+		log.Debugx("reading zip archive", err)
+		return detected, nil, false, true
+	}
+	data := append(buf, rest...)
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		log.Debugx("parsing zip archive", err)
+		return detected, nil, false, true
+	}
+	var contentTypes, macros bool
+	var docType string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		// Bit 0 of the general purpose flags indicates encryption.
+		if f.Flags&0x1 != 0 {
+			encrypted = true
+		}
+		switch {
+		case f.Name == "[Content_Types].xml":
+			contentTypes = true
+		case strings.HasPrefix(f.Name, "word/"):
+			docType = "word.document"
+		case strings.HasPrefix(f.Name, "xl/"):
+			docType = "excel.sheet"
+		case strings.HasPrefix(f.Name, "ppt/"):
+			docType = "powerpoint.presentation"
+		}
+		if path.Base(f.Name) == "vbaProject.bin" {
+			macros = true
+		}
+	}
+	// Office Open XML documents are zip files. Documents with macros have a
+	// vbaProject.bin file.
+	if contentTypes && docType != "" {
+		if macros {
+			detected = "application/vnd.ms-" + docType + ".macroenabled.12"
+		} else {
+			detected = "application/vnd.openxmlformats-officedocument"
+		}
+	}
+	return detected, names, encrypted, false
+}
+
+// sniff returns the content type for the data, recognizing executables and
+// archives that http.DetectContentType does not know about.
+func sniff(buf []byte) string {
+	switch {
+	case bytes.HasPrefix(buf, []byte("MZ")):
+		return "application/x-msdownload"
+	case bytes.HasPrefix(buf, []byte("\x7fELF")):
+		return "application/x-executable"
+	case bytes.HasPrefix(buf, []byte("\xfe\xed\xfa")), bytes.HasPrefix(buf, []byte("\xcf\xfa\xed\xfe")), bytes.HasPrefix(buf, []byte("\xce\xfa\xed\xfe")):
+		return "application/x-mach-binary"
+	case bytes.HasPrefix(buf, []byte("PK\x03\x04")):
+		return "application/zip"
+	case bytes.HasPrefix(buf, []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1")):
+		// Legacy Office documents (.doc/.xls/.ppt), may contain macros.
+		return "application/x-ole-storage"
+	case bytes.HasPrefix(buf, []byte("Rar!\x1a\x07")):
+		return "application/x-rar-compressed"
+	case bytes.HasPrefix(buf, []byte("7z\xbc\xaf\x27\x1c")):
+		return "application/x-7z-compressed"
+	}
+	ct := http.DetectContentType(buf)
+	ct, _, _ = strings.Cut(ct, ";")
+	return ct
+}
+
+// extension returns the lower-case extension of a file name, with leading dot.
+// Trailing dots and spaces are ignored, like Windows does.
+func extension(name string) string {
+	name = strings.TrimRight(name, ". ")
+	if i := strings.LastIndexAny(name, "/\\"); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.LastIndex(name, "."); i > 0 {
+		return strings.ToLower(name[i:])
+	}
+	return ""
+}
+
+// Evaluate matches the attachments against the rules for the direction. The
+// verdict has the most severe action. If parts must be stripped but one is the
+// message itself, the message is rejected instead.
+func (in *Inspection) Evaluate(rules []config.AttachmentRule, direction Direction) Verdict {
+	var v Verdict
+	severity := map[Action]int{ActionNone: 0, ActionStrip: 1, ActionQuarantine: 2, ActionReject: 3}
+	for _, rule := range rules {
+		if rule.Direction != "" && rule.Direction != string(direction) {
+			continue
+		}
+		for _, a := range in.Attachments {
+			reason, ok := match(rule, a)
+			if !ok {
+				continue
+			}
+			action := Action(rule.Action)
+			if severity[action] > severity[v.Action] {
+				v = Verdict{Action: action}
+			}
+			if action == v.Action {
+				v.Matches = append(v.Matches, Match{rule, a, reason})
+			}
+		}
+	}
+	if v.Action == ActionStrip && slices.ContainsFunc(v.Matches, func(m Match) bool { return m.Attachment.Start < 0 }) {
+		v.Action = ActionReject
+	}
+	return v
+}
+
+// match returns whether the attachment matches the rule, and if so a reason.
+func match(rule config.AttachmentRule, a Attachment) (string, bool) {
+	if rule.MinSize > 0 && a.Size < rule.MinSize {
+		return "", false
+	}
+
+	var reason string
+	for _, pat := range rule.ContentTypes {
+		for _, ct := range []string{a.DeclaredType, a.DetectedType} {
+			if ok, _ := path.Match(pat, ct); ct != "" && ok {
+				reason = fmt.Sprintf("content type %q", ct)
+				break
+			}
+		}
+		if reason != "" {
+			break
+		}
+	}
+	if reason == "" && len(rule.Extensions) > 0 {
+		if ext := extension(a.Filename); ext != "" && slices.Contains(rule.Extensions, ext) {
+			reason = fmt.Sprintf("extension %q", ext)
+		} else {
+			for _, name := range a.ArchiveNames {
+				if ext := extension(name); ext != "" && slices.Contains(rule.Extensions, ext) {
+					reason = fmt.Sprintf("file %q with extension %q in archive", name, ext)
+					break
+				}
+			}
+		}
+	}
+	if reason == "" && rule.EncryptedArchive && a.Encrypted {
+		reason = "encrypted archive"
+	}
+	if reason == "" && rule.UninspectableArchive && a.Uninspectable {
+		reason = "archive that cannot be inspected"
+	}
+
+	if reason == "" {
+		if len(rule.ContentTypes) > 0 || len(rule.Extensions) > 0 || rule.EncryptedArchive || rule.UninspectableArchive {
+			return "", false
+		}
+		// Size-only rules are for attachments, not for large message text.
+		if !a.Attached {
+			return "", false
+		}
+		reason = fmt.Sprintf("size %d bytes", a.Size)
+	} else if rule.MinSize > 0 {
+		reason += fmt.Sprintf(" and size %d bytes", a.Size)
+	}
+	return reason, true
+}
+
+// Reason returns a human-readable explanation for the verdict, based on its
+// first match, for use in SMTP responses and logging.
+func (v Verdict) Reason() string {
+	if len(v.Matches) == 0 {
+		return ""
+	}
+	m := v.Matches[0]
+	s := "attachment"
+	if m.Attachment.Filename != "" {
+		s += fmt.Sprintf(" %q", m.Attachment.Filename)
+	}
+	s += " not allowed by policy: " + m.Reason
+	if len(v.Matches) > 1 {
+		s += fmt.Sprintf(" (and %d more)", len(v.Matches)-1)
+	}
+	return s
+}
+
+// Strip writes the message from r to w, with the parts of the verdict's matches
+// replaced by a text part with a notice. It returns the number of bytes written.
+func Strip(w io.Writer, r io.ReaderAt, size int64, v Verdict) (int64, error) {
+	type strip struct {
+		start, end int64
+		names      []string
+	}
+	var l []strip
+	for _, m := range v.Matches {
+		a := m.Attachment
+		if a.Start < 0 || a.End < a.Start || a.End > size {
+			return 0, errors.New("attachment cannot be stripped")
+		}
+		i := slices.IndexFunc(l, func(s strip) bool { return s.start == a.Start })
+		if i < 0 {
+			l = append(l, strip{start: a.Start, end: a.End})
+			i = len(l) - 1
+		}
+		name := a.Filename
+		if name == "" {
+			name = "(unnamed, " + a.DeclaredType + ")"
+		}
+		if !slices.Contains(l[i].names, name) {
+			l[i].names = append(l[i].names, name)
+		}
+	}
+	slices.SortFunc(l, func(a, b strip) int { return cmp.Compare(a.start, b.start) })
+
+	var n int64
+	var offset int64
+	for _, s := range l {
+		if s.start < offset {
+			// Nested inside a range that was already stripped.
+			continue
+		}
+		nn, err := io.Copy(w, io.NewSectionReader(r, offset, s.start-offset))
+		n += nn
+		if err != nil {
+			return n, fmt.Errorf("copying message: %w", err)
+		}
+		notice, err := noticePart(s.names)
+		if err != nil {
+			return n, err
+		}
+		nw, err := w.Write(notice)
+		n += int64(nw)
+		if err != nil {
+			return n, fmt.Errorf("writing notice: %w", err)
+		}
+		offset = s.end
+	}
+	nn, err := io.Copy(w, io.NewSectionReader(r, offset, size-offset))
+	n += nn
+	if err != nil {
+		return n, fmt.Errorf("copying message: %w", err)
+	}
+	return n, nil
+}
+
+// noticePart returns a text/plain part, with header, replacing the removed
+// attachments. The body does not end with a CRLF, the CRLF before the next
+// boundary is still in the message.
+func noticePart(names []string) ([]byte, error) {
+	var body bytes.Buffer
+	qpw := quotedprintable.NewWriter(&body)
+	text := "The following attachment was removed because it is not allowed by policy:\r\n"
+	if len(names) > 1 {
+		text = "The following attachments were removed because they are not allowed by policy:\r\n"
+	}
+	for _, name := range names {
+		text += "\r\n- " + name
+	}
+	if _, err := qpw.Write([]byte(text)); err != nil {
+		return nil, fmt.Errorf("writing notice: %w", err)
+	}
+	if err := qpw.Close(); err != nil {
+		return nil, fmt.Errorf("writing notice: %w", err)
+	}
+	s := "Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"Content-Disposition: inline\r\n" +
+		"\r\n" +
+		body.String()
+	return []byte(s), nil
+}
@@ -0,0 +1,187 @@
+package attachpolicy
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/message"
+	"github.com/mjl-/mox/mlog"
+)
+
+var pkglog = mlog.New("attachpolicy", nil)
+
+func tcheck(t *testing.T, err error, msg string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %s", msg, err)
+	}
+}
+
+func makeZip(t *testing.T, files map[string]uint16) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for name, flags := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Flags: flags, Method: zip.Store})
+		tcheck(t, err, "create zip file")
+		_, err = w.Write([]byte("data"))
+		tcheck(t, err, "write zip file")
+	}
+	tcheck(t, zw.Close(), "close zip")
+	return b.Bytes()
+}
+
+func attachment(ct, filename string, data []byte) string {
+	s := "Content-Type: " + ct + "\r\n"
+	if filename != "" {
+		s += `Content-Disposition: attachment; filename="` + filename + `"` + "\r\n"
+	}
+	s += "Content-Transfer-Encoding: base64\r\n\r\n"
+	s += base64.StdEncoding.EncodeToString(data) + "\r\n"
+	return s
+}
+
+func multipartBound(bound string, parts ...string) string {
+	s := "From: <mjl@mox.example>\r\nTo: <remote@example.org>\r\nSubject: test\r\nMIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=" + bound + "\r\n\r\n"
+	for _, p := range parts {
+		s += "--" + bound + "\r\n" + p
+	}
+	s += "--" + bound + "--\r\n"
+	return s
+}
+
+func multipart(parts ...string) string {
+	return multipartBound("x", parts...)
+}
+
+const textPart = "Content-Type: text/plain\r\n\r\nhi\r\n"
+
+func TestEvaluate(t *testing.T) {
+	exe := append([]byte("MZ\x90\x00"), make([]byte, 100)...)
+	zipExe := makeZip(t, map[string]uint16{"readme.txt": 0, "dir/invoice.pdf.exe": 0})
+	zipEncrypted := makeZip(t, map[string]uint16{"secret.pdf": 0x1})
+	docm := makeZip(t, map[string]uint16{"[Content_Types].xml": 0, "word/document.xml": 0, "word/vbaProject.bin": 0})
+	docx := makeZip(t, map[string]uint16{"[Content_Types].xml": 0, "word/document.xml": 0})
+
+	rules := []config.AttachmentRule{
+		{ContentTypes: []string{"application/x-msdownload"}, Action: "reject"},
+		{Extensions: []string{".exe", ".js"}, Action: "strip"},
+		{ContentTypes: []string{"application/vnd.ms-*.macroenabled.*"}, Action: "quarantine"},
+		{EncryptedArchive: true, Direction: "incoming", Action: "quarantine"},
+		{UninspectableArchive: true, Direction: "incoming", Action: "strip"},
+		{MinSize: 1000, Direction: "outgoing", Action: "strip"},
+	}
+
+	test := func(msg string, direction Direction, expAction Action, expReason string) {
+		t.Helper()
+		in := Inspect(pkglog.Logger, strings.NewReader(msg), int64(len(msg)))
+		v := in.Evaluate(rules, direction)
+		if v.Action != expAction {
+			t.Fatalf("got action %q, expected %q, verdict %#v", v.Action, expAction, v)
+		}
+		if reason := v.Reason(); !strings.Contains(reason, expReason) {
+			t.Fatalf("got reason %q, expected %q", reason, expReason)
+		}
+	}
+
+	test(multipart(textPart), Incoming, ActionNone, "")
+	// Detected as executable, regardless of declared type and name.
+	test(multipart(textPart, attachment("application/octet-stream", "report.pdf", exe)), Incoming, ActionReject, `content type "application/x-msdownload"`)
+	test(multipart(textPart, attachment("text/javascript", "x.JS", []byte("alert(1)"))), Incoming, ActionStrip, `extension ".js"`)
+	// Trailing dot is ignored.
+	test(multipart(textPart, attachment("application/octet-stream", "x.js.", []byte("alert(1)"))), Incoming, ActionStrip, `extension ".js"`)
+	test(multipart(textPart, attachment("application/zip", "invoice.zip", zipExe)), Incoming, ActionStrip, `file "dir/invoice.pdf.exe" with extension ".exe" in archive`)
+	test(multipart(textPart, attachment("application/zip", "secret.zip", zipEncrypted)), Incoming, ActionQuarantine, "encrypted archive")
+	test(multipart(textPart, attachment("application/zip", "secret.zip", zipEncrypted)), Outgoing, ActionNone, "")
+	// Rar archive cannot be inspected, it is not marked as encrypted.
+	rar := []byte("Rar!\x1a\x07\x01\x00")
+	test(multipart(textPart, attachment("application/octet-stream", "files.rar", rar)), Incoming, ActionStrip, "archive that cannot be inspected")
+	// Malformed zip file cannot be inspected.
+	test(multipart(textPart, attachment("application/zip", "bad.zip", []byte("PK\x03\x04bogus"))), Incoming, ActionStrip, "archive that cannot be inspected")
+	test(multipart(textPart, attachment("application/octet-stream", "letter.docm", docm)), Incoming, ActionQuarantine, `content type "application/vnd.ms-word.document.macroenabled.12"`)
+	test(multipart(textPart, attachment("application/octet-stream", "letter.docx", docx)), Incoming, ActionNone, "")
+	// Size only for outgoing.
+	big := make([]byte, 2000)
+	test(multipart(textPart, attachment("application/octet-stream", "big.bin", big)), Incoming, ActionNone, "")
+	test(multipart(textPart, attachment("application/octet-stream", "big.bin", big)), Outgoing, ActionStrip, "size 2000 bytes")
+	// Size-only rules don't match message text, only attachments.
+	bigText := "Content-Type: text/plain\r\n\r\n" + strings.Repeat("long text\r\n", 200)
+	test(multipart(bigText), Outgoing, ActionNone, "")
+	test(multipart(textPart, "Content-Type: text/plain\r\nContent-Disposition: inline\r\n\r\n"+strings.Repeat("long text\r\n", 200)), Outgoing, ActionNone, "")
+	test(multipart(textPart, "Content-Type: text/plain; name=notes.txt\r\n\r\n"+strings.Repeat("long text\r\n", 200)), Outgoing, ActionStrip, `"notes.txt"`)
+	// Reject has precedence.
+	test(multipart(attachment("application/octet-stream", "x.js", []byte("alert(1)")), attachment("application/octet-stream", "x.exe", exe)), Incoming, ActionReject, `"x.exe"`)
+	// Attachment inside embedded message.
+	embedded := "Content-Type: message/rfc822\r\n\r\n" + multipartBound("y", textPart, attachment("application/octet-stream", "x.js", []byte("alert(1)")))
+	test(multipart(textPart, embedded), Incoming, ActionStrip, `extension ".js"`)
+	// Message that is only an attachment cannot be stripped, is rejected.
+	single := "Subject: test\r\nContent-Type: application/octet-stream\r\nContent-Disposition: attachment; filename=x.js\r\n\r\nalert(1)\r\n"
+	test(single, Incoming, ActionReject, `extension ".js"`)
+}
+
+func TestStrip(t *testing.T) {
+	rules := []config.AttachmentRule{
+		{Extensions: []string{".js"}, Action: "strip"},
+	}
+
+	embedded := "Content-Type: message/rfc822\r\n\r\n" + multipartBound("y", textPart, attachment("application/octet-stream", "b.js", []byte("alert(2)")))
+	msg := multipart(textPart, attachment("application/octet-stream", "a.js", []byte("alert(1)")), embedded, attachment("application/pdf", "c.pdf", []byte("%PDF-1.4")))
+
+	in := Inspect(pkglog.Logger, strings.NewReader(msg), int64(len(msg)))
+	v := in.Evaluate(rules, Incoming)
+	if v.Action != ActionStrip || len(v.Matches) != 2 {
+		t.Fatalf("got verdict %#v, expected strip with 2 matches", v)
+	}
+
+	var b bytes.Buffer
+	n, err := Strip(&b, strings.NewReader(msg), int64(len(msg)), v)
+	tcheck(t, err, "strip")
+	if n != int64(b.Len()) {
+		t.Fatalf("strip returned size %d, wrote %d", n, b.Len())
+	}
+	stripped := b.String()
+	if strings.Contains(stripped, base64.StdEncoding.EncodeToString([]byte("alert(1)"))) || strings.Contains(stripped, base64.StdEncoding.EncodeToString([]byte("alert(2)"))) {
+		t.Fatalf("stripped message still contains attachments:\n%s", stripped)
+	}
+
+	// Stripped message must be valid, with the notices and remaining parts.
+	p, err := message.EnsurePart(pkglog.Logger, true, strings.NewReader(stripped), int64(len(stripped)))
+	tcheck(t, err, "parse stripped message")
+	tcheck(t, p.Walk(pkglog.Logger, nil), "walk stripped message")
+	if len(p.Parts) != 4 {
+		t.Fatalf("got %d parts, expected 4", len(p.Parts))
+	}
+	for i, exp := range []string{"a.js", "b.js"} {
+		pp := p.Parts[i+1]
+		if pp.MediaType != "TEXT" || pp.MediaSubType != "PLAIN" {
+			t.Fatalf("notice part has content-type %s/%s", pp.MediaType, pp.MediaSubType)
+		}
+		buf, err := io.ReadAll(pp.Reader())
+		tcheck(t, err, "read notice")
+		if !strings.Contains(string(buf), "removed") || !strings.Contains(string(buf), exp) {
+			t.Fatalf("unexpected notice %q, expected mention of %q", buf, exp)
+		}
+	}
+	if _, filename, _ := p.Parts[3].DispositionFilename(); filename != "c.pdf" {
+		t.Fatalf("last part has filename %q, expected c.pdf", filename)
+	}
+
+	// Nothing to strip leaves the message as is.
+	b.Reset()
+	_, err = Strip(&b, strings.NewReader(msg), int64(len(msg)), Verdict{})
+	tcheck(t, err, "strip without matches")
+	if b.String() != msg {
+		t.Fatalf("message changed without matches")
+	}
+
+	// Message itself cannot be stripped.
+	_, err = Strip(io.Discard, strings.NewReader(msg), int64(len(msg)), Verdict{ActionStrip, []Match{{Attachment: Attachment{Start: -1, End: -1}}}})
+	if err == nil {
+		t.Fatalf("expected error stripping message itself")
+	}
+}
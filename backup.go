@@ -19,6 +19,7 @@ import (
 	"github.com/mjl-/bstore"
 
 	"github.com/mjl-/mox/dmarcdb"
+	"github.com/mjl-/mox/greylist"
 	"github.com/mjl-/mox/mox-"
 	"github.com/mjl-/mox/moxvar"
 	"github.com/mjl-/mox/mtastsdb"
@@ -383,6 +384,7 @@ func xbackupctl(ctx context.Context, xctl *ctl) {
 	backupDB(mtastsdb.DB, "mtasts.db")
 	backupDB(tlsrptdb.ReportDB, "tlsrpt.db")
 	backupDB(tlsrptdb.ResultDB, "tlsrptresult.db")
+	backupDB(greylist.DB, "greylist.db")
 	backupFile("receivedid.key")
 
 	// Acme directory is optional.
@@ -670,10 +672,10 @@ func xbackupctl(ctx context.Context, xctl *ctl) {
 		}
 
 		switch p {
-		case "auth.db", "dmarcrpt.db", "dmarceval.db", "mtasts.db", "tlsrpt.db", "tlsrptresult.db", "receivedid.key", "ctl":
+		case "auth.db", "dmarcrpt.db", "dmarceval.db", "mtasts.db", "tlsrpt.db", "tlsrptresult.db", "greylist.db", "receivedid.key", "ctl":
 			// Already handled.
 			return nil
-		case "lastknownversion": // Optional file, not yet handled.
+		case "lastknownversion", "dnssec-trust-anchors.json": // Optional files, not yet handled.
 		default:
 			xwarnx("backing up unrecognized file", nil, slog.String("path", p))
 		}
@@ -0,0 +1,473 @@
+// Package bimi implements BIMI (Brand Indicators for Message Identification)
+// verification.
+//
+// With BIMI, a domain publishes a logo in SVG Tiny PS format, referenced by a DNS
+// TXT record at "<selector>._bimi.<domain>". Mail clients can show the logo with
+// messages from the domain. Logos are only used for messages that pass DMARC with
+// an enforcing policy (quarantine or reject). A domain can also reference a
+// Verified Mark Certificate (VMC) or Common Mark Certificate (CMC), in which a
+// certificate authority attests to the use of the logo by the domain, and which
+// includes the logo.
+package bimi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"runtime/debug"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mjl-/mox/dmarc"
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/moxio"
+	"github.com/mjl-/mox/publicsuffix"
+	"github.com/mjl-/mox/stub"
+)
+
+var (
+	MetricVerify      stub.HistogramVec                                                                                           = stub.HistogramVecIgnore{}
+	HTTPClientObserve func(ctx context.Context, log *slog.Logger, pkg, method string, statusCode int, err error, start time.Time) = stub.HTTPClientObserveIgnore
+)
+
+// Errors for lookups, fetches and validation.
+var (
+	ErrNoRecord        = errors.New("bimi: no bimi dns record")
+	ErrMultipleRecords = errors.New("bimi: multiple bimi dns records")
+	ErrDNS             = errors.New("bimi: dns lookup")
+	ErrSyntax          = errors.New("bimi: malformed bimi dns record")
+	ErrFetch           = errors.New("bimi: fetching logo or certificate")
+	ErrLogo            = errors.New("bimi: invalid logo")
+	ErrCertificate     = errors.New("bimi: invalid certificate")
+)
+
+// Status is the result of BIMI verification, for use in an
+// Authentication-Results header.
+type Status string
+
+const (
+	StatusPass      Status = "pass"      // Valid record, with valid logo and/or certificate.
+	StatusNone      Status = "none"      // No BIMI record.
+	StatusFail      Status = "fail"      // Invalid record, logo or certificate.
+	StatusTemperror Status = "temperror" // DNS or fetch error, a later attempt may succeed.
+	StatusDeclined  Status = "declined"  // Domain explicitly declined BIMI with an empty record.
+	StatusSkipped   Status = "skipped"   // Not evaluated, e.g. because the DMARC policy is not enforcing, or a certificate is required but not present.
+)
+
+// Result of BIMI verification.
+type Result struct {
+	Status   Status
+	Domain   dns.Domain // Domain where the BIMI record was found, may be the organizational domain.
+	Selector string
+	Record   *Record
+	Evidence string // "vmc" or "cmc" if the logo was verified with a mark certificate, empty otherwise.
+	Logo     []byte // SVG Tiny PS logo, only for StatusPass.
+	Err      error
+}
+
+// DefaultSelector is used when a message does not specify a selector.
+const DefaultSelector = "default"
+
+// Lookup looks up the BIMI TXT record at "<selector>._bimi.<domain>". If no record
+// is found, the record at the organizational domain is looked up, as determined
+// through the public suffix list. The returned domain is the domain with the BIMI
+// record.
+func Lookup(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, selector string, domain dns.Domain) (rdomain dns.Domain, record *Record, txt string, rerr error) {
+	log := mlog.New("bimi", elog)
+	start := time.Now()
+	defer func() {
+		log.Debugx("bimi lookup result", rerr,
+			slog.String("selector", selector),
+			slog.Any("domain", domain),
+			slog.Any("recorddomain", rdomain),
+			slog.Any("record", record),
+			slog.Duration("duration", time.Since(start)))
+	}()
+
+	record, txt, err := lookupRecord(ctx, resolver, selector, domain)
+	if !errors.Is(err, ErrNoRecord) {
+		return domain, record, txt, err
+	}
+	orgDom := publicsuffix.Lookup(ctx, log.Logger, domain)
+	if orgDom == domain {
+		return domain, nil, "", err
+	}
+	record, txt, err = lookupRecord(ctx, resolver, selector, orgDom)
+	return orgDom, record, txt, err
+}
+
+func lookupRecord(ctx context.Context, resolver dns.Resolver, selector string, domain dns.Domain) (*Record, string, error) {
+	name := selector + "._bimi." + domain.ASCII + "."
+	txts, _, err := dns.WithPackage(resolver, "bimi").LookupTXT(ctx, name)
+	if dns.IsNotFound(err) {
+		return nil, "", ErrNoRecord
+	} else if err != nil {
+		return nil, "", fmt.Errorf("%w: %s", ErrDNS, err)
+	}
+	var record *Record
+	var text string
+	var rerr error = ErrNoRecord
+	for _, txt := range txts {
+		r, isbimi, err := ParseRecord(txt)
+		if !isbimi {
+			continue
+		} else if err != nil {
+			rerr = err
+			continue
+		}
+		if record != nil {
+			return nil, "", ErrMultipleRecords
+		}
+		record = r
+		text = txt
+		rerr = nil
+	}
+	return record, text, rerr
+}
+
+// Verify evaluates BIMI for a message with msgFrom as domain in the "From"-header,
+// with the DMARC result for the message.
+//
+// BIMI is only evaluated if DMARC passed with policy quarantine (at 100%) or
+// reject. For DMARCbis, with discovery dmarc.DiscoveryTreeWalk, "pct" is ignored
+// and policies in testing mode ("t=y") are not enforcing. The selector is typically DefaultSelector, or the selector from a
+// BIMI-Selector header that was signed with an aligned DKIM signature.
+//
+// If the record references a certificate, it is fetched and verified, and the
+// logo is taken from the certificate. Otherwise the logo is fetched from the
+// location in the record. If requireCertificate is set, records without
+// certificate result in StatusSkipped.
+func Verify(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, msgFrom dns.Domain, selector string, dmarcResult dmarc.Result, discovery dmarc.Discovery, requireCertificate bool) (result Result) {
+	log := mlog.New("bimi", elog)
+	start := time.Now()
+	defer func() {
+		MetricVerify.ObserveLabels(float64(time.Since(start))/float64(time.Second), string(result.Status), result.Evidence)
+		log.Debugx("bimi verify result", result.Err,
+			slog.Any("fromdomain", msgFrom),
+			slog.String("selector", selector),
+			slog.Any("status", result.Status),
+			slog.String("evidence", result.Evidence),
+			slog.Duration("duration", time.Since(start)))
+	}()
+
+	if selector == "" {
+		selector = DefaultSelector
+	}
+	result = Result{Status: StatusSkipped, Selector: selector}
+
+	if dmarcResult.Status != dmarc.StatusPass || dmarcResult.Record == nil {
+		result.Err = errors.New("bimi: dmarc did not pass")
+		return result
+	}
+	if !enforcing(msgFrom, dmarcResult, discovery) {
+		result.Err = errors.New("bimi: dmarc policy not enforcing")
+		return result
+	}
+
+	rdom, record, _, err := Lookup(ctx, log.Logger, resolver, selector, msgFrom)
+	result.Domain = rdom
+	result.Record = record
+	if err != nil {
+		result.Err = err
+		switch {
+		case errors.Is(err, ErrNoRecord):
+			result.Status = StatusNone
+		case errors.Is(err, ErrDNS):
+			result.Status = StatusTemperror
+		default:
+			result.Status = StatusFail
+		}
+		return result
+	}
+	if record.Declined() {
+		result.Status = StatusDeclined
+		return result
+	}
+
+	if record.Authority == "" {
+		if requireCertificate {
+			result.Err = errors.New("bimi: no certificate in record while required")
+			return result
+		}
+		logo, err := FetchLogo(ctx, log.Logger, record.Location)
+		if err != nil {
+			result.Status = fetchStatus(err)
+			result.Err = err
+			return result
+		}
+		result.Status = StatusPass
+		result.Logo = logo
+		return result
+	}
+
+	evidence, logo, err := FetchCertificate(ctx, log.Logger, record.Authority, []dns.Domain{msgFrom, rdom})
+	if err != nil {
+		result.Status = fetchStatus(err)
+		result.Err = err
+		return result
+	}
+	result.Status = StatusPass
+	result.Evidence = evidence
+	result.Logo = logo
+	return result
+}
+
+// enforcing returns whether the DMARC policy that applies to msgFrom is
+// quarantine or reject, applied to all messages.
+func enforcing(msgFrom dns.Domain, dmarcResult dmarc.Result, discovery dmarc.Discovery) bool {
+	dr := dmarcResult.Record
+	isEnforcing := func(p dmarc.Policy) bool {
+		return p == dmarc.PolicyReject || p == dmarc.PolicyQuarantine
+	}
+	policy := dr.Policy
+	if msgFrom != dmarcResult.Domain && dr.SubdomainPolicy != dmarc.PolicyEmpty {
+		policy = dr.SubdomainPolicy
+	}
+	if discovery != dmarc.DiscoveryTreeWalk {
+		return policy == dmarc.PolicyReject || policy == dmarc.PolicyQuarantine && dr.Percentage == 100
+	}
+	// DMARCbis replaces "pct" with "t". We don't know whether the "np" policy for
+	// nonexistent subdomains was applied, so it must be enforcing too.
+	if dr.Testing || !isEnforcing(policy) {
+		return false
+	}
+	return msgFrom == dmarcResult.Domain || dr.NonexistentSubdomainPolicy == dmarc.PolicyEmpty || isEnforcing(dr.NonexistentSubdomainPolicy)
+}
+
+// FetchLogo fetches the logo at url, as referenced by the "l=" tag of a BIMI
+// record, and validates it as SVG Tiny PS.
+func FetchLogo(ctx context.Context, elog *slog.Logger, url string) ([]byte, error) {
+	log := mlog.New("bimi", elog)
+	logo, err := fetch(ctx, log, url, maxLogoSize)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateLogo(logo); err != nil {
+		return nil, err
+	}
+	return logo, nil
+}
+
+// FetchCertificate fetches the PEM file with a mark certificate chain at url, as
+// referenced by the "a=" tag of a BIMI record, and verifies it for one of domains
+// with VerifyCertificate.
+func FetchCertificate(ctx context.Context, elog *slog.Logger, url string, domains []dns.Domain) (evidence string, logo []byte, rerr error) {
+	log := mlog.New("bimi", elog)
+	pemBuf, err := fetch(ctx, log, url, maxCertificateSize)
+	if err != nil {
+		return "", nil, err
+	}
+	return VerifyCertificate(pemBuf, domains, time.Now())
+}
+
+func fetchStatus(err error) Status {
+	if errors.Is(err, ErrFetch) {
+		return StatusTemperror
+	}
+	return StatusFail
+}
+
+const (
+	maxLogoSize        = 32 * 1024
+	maxCertificateSize = 64 * 1024
+)
+
+// HTTPClient is used for fetching logos and certificates. Only HTTPS is allowed,
+// including for redirects. Connections to IPs that are not globally reachable,
+// like loopback, private and link-local addresses, are refused, so BIMI records
+// cannot be used to make requests to internal services. The check happens when
+// connecting, so it also applies to redirects and to DNS names resolving to
+// internal IPs.
+var HTTPClient = &http.Client{
+	Transport: fetchTransport(),
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if req.URL.Scheme != "https" {
+			return fmt.Errorf("redirect to non-https url not allowed")
+		} else if len(via) >= 5 {
+			return fmt.Errorf("too many redirects")
+		}
+		return nil
+	},
+}
+
+func fetchTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   dialControl,
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would be connected to instead of the destination, making the IP check
+	// meaningless.
+	t.Proxy = nil
+	t.DialContext = dialer.DialContext
+	return t
+}
+
+// dialControl refuses connections to IPs that are not globally reachable.
+func dialControl(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("parsing address %q: %v", address, err)
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return fmt.Errorf("parsing ip %q: %v", host, err)
+	}
+	if !publicIP(ip) {
+		return fmt.Errorf("connection to non-public ip %s not allowed", ip)
+	}
+	return nil
+}
+
+// publicIP returns whether ip is a globally reachable unicast address, i.e. not
+// loopback, private (RFC 1918, IPv6 unique local), link-local, shared address
+// space (RFC 6598), unspecified or multicast.
+func publicIP(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
+
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// Fetched logos and certificates are cached for an hour, many messages from the
+// same domain reference the same URLs. The cache is limited in size, expired
+// entries are removed periodically and when the cache is full.
+//
+// Fetches happen in the background. If the context of a caller is done before a
+// fetch completes, the fetch continues and its result is cached for the next
+// message. Callers can use a short timeout, e.g. during SMTP delivery.
+var fetchCache = struct {
+	sync.Mutex
+	m       map[string]fetchEntry
+	purged  time.Time                // Last removal of expired entries.
+	pending map[string]*fetchPending // Fetches in progress, by URL.
+}{m: map[string]fetchEntry{}, pending: map[string]*fetchPending{}}
+
+type fetchPending struct {
+	done chan struct{} // Closed when buf and err are set.
+	buf  []byte
+	err  error
+}
+
+type fetchEntry struct {
+	buf     []byte
+	expires time.Time
+}
+
+const (
+	fetchCacheDuration = time.Hour
+	fetchCacheMax      = 1000 // Max 64MB with certificates of max size.
+	fetchCachePurge    = 10 * time.Minute
+)
+
+// fetchCacheAdd adds an entry to the cache, first removing expired entries if it
+// is time to, or if the cache is full. If the cache is still full, it is cleared.
+func fetchCacheAdd(url string, e fetchEntry, now time.Time) {
+	fetchCache.Lock()
+	defer fetchCache.Unlock()
+	if len(fetchCache.m) >= fetchCacheMax || now.Sub(fetchCache.purged) >= fetchCachePurge {
+		for k, v := range fetchCache.m {
+			if now.After(v.expires) {
+				delete(fetchCache.m, k)
+			}
+		}
+		fetchCache.purged = now
+		if len(fetchCache.m) >= fetchCacheMax {
+			clear(fetchCache.m)
+		}
+	}
+	fetchCache.m[url] = e
+}
+
+func fetch(ctx context.Context, log mlog.Log, url string, limit int64) ([]byte, error) {
+	now := time.Now()
+	fetchCache.Lock()
+	e, ok := fetchCache.m[url]
+	if ok && now.After(e.expires) {
+		delete(fetchCache.m, url)
+		ok = false
+	}
+	fetchCache.Unlock()
+	if ok {
+		return e.buf, nil
+	}
+
+	if err := checkURL(url); err != nil || url == "" {
+		return nil, fmt.Errorf("bimi: invalid url %q", url)
+	}
+
+	fetchCache.Lock()
+	p, ok := fetchCache.pending[url]
+	if !ok {
+		p = &fetchPending{done: make(chan struct{})}
+		fetchCache.pending[url] = p
+		go func() {
+			defer func() {
+				x := recover()
+				if x != nil {
+					// Should not happen, but make sure errors don't take down the application.
+					log.Error("bimi fetch", slog.Any("panic", x))
+					debug.PrintStack()
+					p.err = fmt.Errorf("%w: panic during fetch", ErrFetch)
+				}
+
+				fetchCache.Lock()
+				delete(fetchCache.pending, url)
+				fetchCache.Unlock()
+				if p.err == nil {
+					t := time.Now()
+					fetchCacheAdd(url, fetchEntry{p.buf, t.Add(fetchCacheDuration)}, t)
+				}
+				close(p.done)
+			}()
+
+			p.buf, p.err = fetchHTTP(log, url, limit)
+		}()
+	}
+	fetchCache.Unlock()
+
+	select {
+	case <-p.done:
+		return p.buf, p.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%w: %w", ErrFetch, ctx.Err())
+	}
+}
+
+// fetchHTTP does the HTTP request for fetch, with its own timeout.
+func fetchHTTP(log mlog.Log, url string, limit int64) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: http request: %s", ErrFetch, err)
+	}
+	req.Close = true
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: http get: %w", ErrFetch, err)
+	}
+	HTTPClientObserve(ctx, log.Logger, "bimi", req.Method, resp.StatusCode, err, start)
+	defer func() {
+		err := resp.Body.Close()
+		log.Check(err, "close body response")
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: http status %s while status 200 is required", ErrFetch, resp.Status)
+	}
+	buf, err := io.ReadAll(&moxio.LimitReader{R: resp.Body, Limit: limit})
+	if err != nil {
+		return nil, fmt.Errorf("bimi: reading response: %w", err)
+	}
+	return buf, nil
+}
@@ -0,0 +1,286 @@
+package bimi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	cryptorand "crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mjl-/mox/dmarc"
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mlog"
+)
+
+// fakeMarkCertificate returns a PEM file with a mark certificate for domain with
+// the logo, and the pool with its issuing CA certificate.
+func fakeMarkCertificate(t *testing.T, domain, markType string, bimiUsage bool) ([]byte, *x509.CertPool) {
+	t.Helper()
+
+	caPub, caPriv, err := ed25519.GenerateKey(cryptorand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	caTempl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test mark ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caBuf, err := x509.CreateCertificate(cryptorand.Reader, caTempl, caTempl, caPub, caPriv)
+	if err != nil {
+		t.Fatalf("create ca certificate: %v", err)
+	}
+	caCert, err := x509.ParseCertificate(caBuf)
+	if err != nil {
+		t.Fatalf("parse ca certificate: %v", err)
+	}
+
+	var gzbuf bytes.Buffer
+	gzw := gzip.NewWriter(&gzbuf)
+	gzw.Write([]byte(testLogo))
+	gzw.Close()
+	// Not the full logotype structure, but the data URI is what we look for.
+	logotype, err := asn1.Marshal("data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString(gzbuf.Bytes()))
+	if err != nil {
+		t.Fatalf("marshal logotype: %v", err)
+	}
+
+	pub, _, err := ed25519.GenerateKey(cryptorand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	templ := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject: pkix.Name{
+			CommonName: domain,
+			ExtraNames: []pkix.AttributeTypeAndValue{{Type: oidMarkType, Value: markType}},
+		},
+		DNSNames:        []string{domain},
+		NotBefore:       time.Now().Add(-time.Hour),
+		NotAfter:        time.Now().Add(time.Hour),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtraExtensions: []pkix.Extension{{Id: oidExtLogotype, Value: logotype}},
+	}
+	if bimiUsage {
+		templ.UnknownExtKeyUsage = []asn1.ObjectIdentifier{oidExtKeyUsageBIMI}
+	} else {
+		templ.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+	buf, err := x509.CreateCertificate(cryptorand.Reader, templ, caCert, pub, caPriv)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: buf}), pool
+}
+
+func TestVerify(t *testing.T) {
+	log := mlog.New("bimi", nil)
+
+	vmcPEM, pool := fakeMarkCertificate(t, "vmc.example", "Registered Mark", true)
+	cmcPEM, cmcPool := fakeMarkCertificate(t, "cmc.example", "Prior Use Mark", true)
+	noUsagePEM, noUsagePool := fakeMarkCertificate(t, "nousage.example", "Registered Mark", false)
+
+	mux := &http.ServeMux{}
+	serve := func(path string, buf []byte) {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			w.Write(buf)
+		})
+	}
+	serve("/logo.svg", []byte(testLogo))
+	serve("/bad.svg", []byte(`<svg/>`))
+	serve("/vmc.pem", vmcPEM)
+	serve("/cmc.pem", cmcPEM)
+	serve("/nousage.pem", noUsagePEM)
+	slow := make(chan struct{})
+	mux.HandleFunc("/slow.svg", func(w http.ResponseWriter, r *http.Request) {
+		<-slow
+		w.Write([]byte(testLogo))
+	})
+	ts := httptest.NewTLSServer(mux)
+	defer ts.Close()
+
+	// The test server listens on a loopback IP, which the default transport refuses
+	// to connect to. URLs have host name example.com, which is in the certificate of
+	// the test server, and we connect to the test server directly.
+	_, port, err := net.SplitHostPort(ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("split host port: %v", err)
+	}
+	baseURL := "https://example.com:" + port
+	transport := ts.Client().Transport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, ts.Listener.Addr().String())
+	}
+	HTTPClient.Transport = transport
+	defer func() {
+		HTTPClient.Transport = fetchTransport()
+		Roots = nil
+	}()
+
+	resolver := dns.MockResolver{
+		TXT: map[string][]string{
+			"default._bimi.example.com.":       {"v=BIMI1; l=" + baseURL + "/logo.svg"},
+			"brand._bimi.example.com.":         {"v=BIMI1; l=" + baseURL + "/bad.svg"},
+			"default._bimi.declined.example.":  {"v=BIMI1; l=; a="},
+			"default._bimi.multiple.example.":  {"v=BIMI1; l=" + baseURL + "/logo.svg", "v=BIMI1; l="},
+			"default._bimi.vmc.example.":       {"v=BIMI1; l=" + baseURL + "/logo.svg; a=" + baseURL + "/vmc.pem"},
+			"default._bimi.cmc.example.":       {"v=BIMI1; a=" + baseURL + "/cmc.pem"},
+			"default._bimi.nousage.example.":   {"v=BIMI1; a=" + baseURL + "/nousage.pem"},
+			"default._bimi.missing.example.":   {"v=BIMI1; l=" + baseURL + "/missing.svg"},
+			"default._bimi.othercert.example.": {"v=BIMI1; a=" + baseURL + "/vmc.pem"},
+		},
+		Fail: []string{
+			"txt default._bimi.temperror.example.",
+		},
+	}
+
+	dmarcRecord := func(s string) *dmarc.Record {
+		r, _, err := dmarc.ParseRecord(s)
+		if err != nil {
+			t.Fatalf("parse dmarc record: %v", err)
+		}
+		return r
+	}
+	reject := dmarc.Result{Status: dmarc.StatusPass, Record: dmarcRecord("v=DMARC1; p=reject")}
+
+	test := func(domain, selector string, dr dmarc.Result, requireCert bool, roots *x509.CertPool, expStatus Status, expEvidence string, expErr error) {
+		t.Helper()
+
+		Roots = roots
+		dr.Domain = dns.Domain{ASCII: domain}
+		r := Verify(context.Background(), log.Logger, resolver, dns.Domain{ASCII: domain}, selector, dr, dmarc.DiscoveryPublicSuffix, requireCert)
+		if r.Status != expStatus || r.Evidence != expEvidence {
+			t.Fatalf("%s: got status %s, evidence %q, err %v, expected %s, %q", domain, r.Status, r.Evidence, r.Err, expStatus, expEvidence)
+		}
+		if expErr != nil && !errors.Is(r.Err, expErr) {
+			t.Fatalf("%s: got err %v, expected %v", domain, r.Err, expErr)
+		}
+		if (r.Status == StatusPass) != (string(r.Logo) == testLogo) {
+			t.Fatalf("%s: unexpected logo %q", domain, r.Logo)
+		}
+	}
+
+	test("example.com", "", reject, false, nil, StatusPass, "", nil)
+	test("example.com", "brand", reject, false, nil, StatusFail, "", ErrLogo)
+	test("example.com", "absent", reject, false, nil, StatusNone, "", ErrNoRecord)
+	test("example.com", "", reject, true, nil, StatusSkipped, "", nil)
+	test("declined.example", "", reject, false, nil, StatusDeclined, "", nil)
+	test("multiple.example", "", reject, false, nil, StatusFail, "", ErrMultipleRecords)
+	test("temperror.example", "", reject, false, nil, StatusTemperror, "", ErrDNS)
+	test("missing.example", "", reject, false, nil, StatusTemperror, "", ErrFetch)
+
+	// DMARC must pass with an enforcing policy.
+	test("example.com", "", dmarc.Result{Status: dmarc.StatusFail, Record: dmarcRecord("v=DMARC1; p=reject")}, false, nil, StatusSkipped, "", nil)
+	test("example.com", "", dmarc.Result{Status: dmarc.StatusPass, Record: dmarcRecord("v=DMARC1; p=none")}, false, nil, StatusSkipped, "", nil)
+	test("example.com", "", dmarc.Result{Status: dmarc.StatusPass, Record: dmarcRecord("v=DMARC1; p=quarantine; pct=50")}, false, nil, StatusSkipped, "", nil)
+	test("example.com", "", dmarc.Result{Status: dmarc.StatusPass, Record: dmarcRecord("v=DMARC1; p=quarantine")}, false, nil, StatusPass, "", nil)
+
+	// Mark certificates.
+	test("vmc.example", "", reject, true, pool, StatusPass, "vmc", nil)
+	test("vmc.example", "", reject, false, nil, StatusFail, "", ErrCertificate) // Untrusted.
+	test("cmc.example", "", reject, false, cmcPool, StatusPass, "cmc", nil)
+	test("nousage.example", "", reject, false, noUsagePool, StatusFail, "", ErrCertificate)
+	test("othercert.example", "", reject, false, pool, StatusFail, "", ErrCertificate) // Domain mismatch.
+
+	// A fetch continues in the background after the context of the caller is done, and
+	// its result is cached for later callers.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	_, err = FetchLogo(ctx, log.Logger, baseURL+"/slow.svg")
+	cancel()
+	if !errors.Is(err, ErrFetch) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got err %v, expected fetch error with deadline exceeded", err)
+	}
+	close(slow)
+	logo, err := FetchLogo(context.Background(), log.Logger, baseURL+"/slow.svg")
+	if err != nil || string(logo) != testLogo {
+		t.Fatalf("got logo %q, err %v, expected logo", logo, err)
+	}
+	fetchCache.Lock()
+	_, cached := fetchCache.m[baseURL+"/slow.svg"]
+	fetchCache.Unlock()
+	if !cached {
+		t.Fatalf("logo not cached after background fetch")
+	}
+
+	// The default transport refuses connections to non-public IPs, also for host
+	// names and redirects.
+	HTTPClient.Transport = fetchTransport()
+	_, err = FetchLogo(context.Background(), log.Logger, "https://localhost:"+port+"/logo.svg")
+	if err == nil || !strings.Contains(err.Error(), "non-public ip") {
+		t.Fatalf("got err %v, expected error for non-public ip", err)
+	}
+}
+
+func TestEnforcing(t *testing.T) {
+	test := func(from, record string, discovery dmarc.Discovery, exp bool) {
+		t.Helper()
+		r, _, err := dmarc.ParseRecord(record)
+		if err != nil {
+			t.Fatalf("parse dmarc record: %v", err)
+		}
+		dr := dmarc.Result{Status: dmarc.StatusPass, Domain: dns.Domain{ASCII: "example.com"}, Record: r}
+		if got := enforcing(dns.Domain{ASCII: from}, dr, discovery); got != exp {
+			t.Fatalf("%s, %q, discovery %q: got %v, expected %v", from, record, discovery, got, exp)
+		}
+	}
+
+	test("example.com", "v=DMARC1; p=reject", dmarc.DiscoveryPublicSuffix, true)
+	test("example.com", "v=DMARC1; p=quarantine; pct=99", dmarc.DiscoveryPublicSuffix, false)
+	test("sub.example.com", "v=DMARC1; p=reject; sp=none", dmarc.DiscoveryPublicSuffix, false)
+
+	// DMARCbis ignores pct, and a policy in testing mode is not enforcing.
+	test("example.com", "v=DMARC1; p=quarantine; pct=50", dmarc.DiscoveryTreeWalk, true)
+	test("example.com", "v=DMARC1; p=reject; t=y", dmarc.DiscoveryTreeWalk, false)
+	test("example.com", "v=DMARC1; p=reject; t=y", dmarc.DiscoveryPublicSuffix, true)
+	test("sub.example.com", "v=DMARC1; p=reject; np=none", dmarc.DiscoveryTreeWalk, false)
+	test("sub.example.com", "v=DMARC1; p=reject; np=quarantine", dmarc.DiscoveryTreeWalk, true)
+	test("example.com", "v=DMARC1; p=reject; np=none", dmarc.DiscoveryTreeWalk, true)
+}
+
+func TestFetchCache(t *testing.T) {
+	clear(fetchCache.m)
+	defer clear(fetchCache.m)
+
+	now := time.Now()
+	fetchCache.purged = now
+	fetchCacheAdd("https://example.com/expired.svg", fetchEntry{nil, now.Add(-time.Minute)}, now)
+	fetchCacheAdd("https://example.com/logo.svg", fetchEntry{nil, now.Add(time.Hour)}, now)
+	if len(fetchCache.m) != 2 {
+		t.Fatalf("got %d cache entries, expected 2", len(fetchCache.m))
+	}
+
+	// Expired entries are removed periodically.
+	now = now.Add(fetchCachePurge)
+	fetchCacheAdd("https://example.com/other.svg", fetchEntry{nil, now.Add(time.Hour)}, now)
+	if _, ok := fetchCache.m["https://example.com/expired.svg"]; ok || len(fetchCache.m) != 2 {
+		t.Fatalf("expired entry not removed, %d entries", len(fetchCache.m))
+	}
+
+	// The cache does not grow beyond its maximum size.
+	for i := range fetchCacheMax + 10 {
+		fetchCacheAdd(fmt.Sprintf("https://example.com/%d.svg", i), fetchEntry{nil, now.Add(time.Hour)}, now)
+	}
+	if len(fetchCache.m) > fetchCacheMax {
+		t.Fatalf("got %d cache entries, expected at most %d", len(fetchCache.m), fetchCacheMax)
+	}
+}
@@ -0,0 +1,152 @@
+package bimi
+
+import (
+	"fmt"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// Record is a BIMI DNS record, served under "<selector>._bimi.<domain>" as a TXT
+// record.
+//
+// Example:
+//
+//	v=BIMI1; l=https://example.com/logo.svg; a=https://example.com/vmc.pem
+//
+// A record with both l= and a= empty declines participation in BIMI.
+type Record struct {
+	Version   string // "BIMI1", for "v=". Required.
+	Location  string // HTTPS URL of logo in SVG Tiny PS format, for "l=". Optional.
+	Authority string // HTTPS URL of PEM file with VMC or CMC certificate chain, for "a=". Optional.
+}
+
+// String returns a textual version of the BIMI record for use as DNS TXT record.
+func (r Record) String() string {
+	s := "v=" + r.Version + "; l=" + r.Location
+	if r.Authority != "" {
+		s += "; a=" + r.Authority
+	}
+	return s
+}
+
+// Declined returns whether the record indicates the domain does not participate
+// in BIMI.
+func (r Record) Declined() bool {
+	return r.Location == "" && r.Authority == ""
+}
+
+// ParseRecord parses a BIMI DNS TXT record.
+//
+// isbimi indicates if the record starts with tag "v" and value "BIMI1", and
+// should be treated as a BIMI record. Used to detect multiple BIMI records for a
+// name.
+//
+// Tags are case-insensitive, values are case-sensitive. Unknown tags are ignored.
+// URLs must use https.
+func ParseRecord(s string) (record *Record, isbimi bool, err error) {
+	tags := strings.Split(s, ";")
+	r := &Record{}
+	seen := map[string]bool{}
+	for i, t := range tags {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			if i == len(tags)-1 && i > 0 {
+				// Trailing semicolon.
+				continue
+			}
+			return nil, isbimi, fmt.Errorf("%w: empty tag", ErrSyntax)
+		}
+		k, v, ok := strings.Cut(t, "=")
+		if !ok {
+			return nil, isbimi, fmt.Errorf("%w: missing = in tag %q", ErrSyntax, t)
+		}
+		k = strings.ToLower(strings.TrimSpace(k))
+		v = strings.TrimSpace(v)
+		if i == 0 {
+			if k != "v" || v != "BIMI1" {
+				return nil, false, fmt.Errorf("%w: record must start with v=BIMI1", ErrSyntax)
+			}
+			isbimi = true
+			r.Version = v
+			continue
+		}
+		if seen[k] {
+			return nil, isbimi, fmt.Errorf("%w: duplicate tag %q", ErrSyntax, k)
+		}
+		seen[k] = true
+		switch k {
+		case "v":
+			return nil, isbimi, fmt.Errorf("%w: v= must be first tag", ErrSyntax)
+		case "l":
+			if err := checkURL(v); err != nil {
+				return nil, isbimi, fmt.Errorf("%w: l=: %v", ErrSyntax, err)
+			}
+			r.Location = v
+		case "a":
+			if err := checkURL(v); err != nil {
+				return nil, isbimi, fmt.Errorf("%w: a=: %v", ErrSyntax, err)
+			}
+			r.Authority = v
+		}
+	}
+	if !isbimi {
+		return nil, false, fmt.Errorf("%w: empty record", ErrSyntax)
+	}
+	return r, true, nil
+}
+
+// checkURL checks that s is empty or an absolute https URL with a host name. IP
+// addresses that are not globally reachable are refused. Host names resolving to
+// such IPs are refused when connecting.
+func checkURL(s string) error {
+	if s == "" {
+		return nil
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("url must have scheme https")
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("url must have host")
+	}
+	if ip, err := netip.ParseAddr(u.Hostname()); err == nil && !publicIP(ip) {
+		return fmt.Errorf("url must not have non-public ip address")
+	}
+	return nil
+}
+
+// ParseSelectorHeader parses the value of a BIMI-Selector message header, e.g.
+// "v=BIMI1; s=brand", and returns the selector.
+func ParseSelectorHeader(s string) (selector string, err error) {
+	tags := strings.Split(s, ";")
+	var version bool
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(t, "=")
+		if !ok {
+			return "", fmt.Errorf("%w: missing = in tag %q", ErrSyntax, t)
+		}
+		switch strings.ToLower(strings.TrimSpace(k)) {
+		case "v":
+			version = strings.TrimSpace(v) == "BIMI1"
+		case "s":
+			selector = strings.ToLower(strings.TrimSpace(v))
+		}
+	}
+	if !version {
+		return "", fmt.Errorf("%w: missing v=BIMI1", ErrSyntax)
+	}
+	if selector == "" || strings.ContainsFunc(selector, func(c rune) bool {
+		return !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '.')
+	}) {
+		return "", fmt.Errorf("%w: invalid selector %q", ErrSyntax, selector)
+	}
+	return selector, nil
+}
@@ -0,0 +1,76 @@
+package bimi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRecord(t *testing.T) {
+	good := func(txt string, want Record) {
+		t.Helper()
+		r, _, err := ParseRecord(txt)
+		if err != nil {
+			t.Fatalf("parse %q: %s", txt, err)
+		}
+		if !reflect.DeepEqual(r, &want) {
+			t.Fatalf("want %#v, got %#v", want, *r)
+		}
+	}
+
+	bad := func(txt string, expIsBIMI bool) {
+		t.Helper()
+		r, isbimi, err := ParseRecord(txt)
+		if err == nil {
+			t.Fatalf("parse %q, expected error, got record %v", txt, r)
+		}
+		if isbimi != expIsBIMI {
+			t.Fatalf("parse %q, got isbimi %v, expected %v", txt, isbimi, expIsBIMI)
+		}
+	}
+
+	good("v=BIMI1; l=https://example.com/logo.svg", Record{Version: "BIMI1", Location: "https://example.com/logo.svg"})
+	good("v=BIMI1;l=https://example.com/logo.svg;a=https://example.com/vmc.pem;", Record{Version: "BIMI1", Location: "https://example.com/logo.svg", Authority: "https://example.com/vmc.pem"})
+	good("v=BIMI1; L=https://example.com/logo.svg; other=1", Record{Version: "BIMI1", Location: "https://example.com/logo.svg"})
+	good("v=BIMI1; l=; a=", Record{Version: "BIMI1"})
+	good("v=BIMI1;", Record{Version: "BIMI1"})
+
+	bad("", false)
+	bad("v=BIMI2; l=https://example.com/logo.svg", false)
+	bad("l=https://example.com/logo.svg; v=BIMI1", false)
+	bad("v=BIMI1; l=http://example.com/logo.svg", true)
+	bad("v=BIMI1; a=https:///vmc.pem", true)
+	bad("v=BIMI1; l=https://example.com/a.svg; l=https://example.com/b.svg", true)
+	bad("v=BIMI1; ; l=https://example.com/logo.svg", true)
+	bad("v=BIMI1; l", true)
+	bad("v=BIMI1; l=https://127.0.0.1/logo.svg", true)
+	bad("v=BIMI1; l=https://10.1.2.3/logo.svg", true)
+	bad("v=BIMI1; l=https://169.254.169.254/logo.svg", true)
+	bad("v=BIMI1; a=https://[::1]/vmc.pem", true)
+	bad("v=BIMI1; a=https://[fd00::1]/vmc.pem", true)
+	bad("v=BIMI1; a=https://[::ffff:192.168.1.1]/vmc.pem", true)
+	good("v=BIMI1; l=https://192.0.2.1/logo.svg", Record{Version: "BIMI1", Location: "https://192.0.2.1/logo.svg"})
+
+	r := Record{Version: "BIMI1", Location: "https://example.com/logo.svg", Authority: "https://example.com/vmc.pem"}
+	if s := r.String(); s != "v=BIMI1; l=https://example.com/logo.svg; a=https://example.com/vmc.pem" {
+		t.Fatalf("got record string %q", s)
+	}
+	if (Record{Version: "BIMI1"}).String() != "v=BIMI1; l=" || !(Record{Version: "BIMI1"}).Declined() {
+		t.Fatalf("bad declined record")
+	}
+}
+
+func TestSelectorHeader(t *testing.T) {
+	test := func(s, exp string, expErr bool) {
+		t.Helper()
+		sel, err := ParseSelectorHeader(s)
+		if (err != nil) != expErr || sel != exp {
+			t.Fatalf("parse %q: got %q, %v, expected %q, error %v", s, sel, err, exp, expErr)
+		}
+	}
+
+	test("v=BIMI1; s=brand", "brand", false)
+	test("v=BIMI1; S=Brand.2023;", "brand.2023", false)
+	test("s=brand", "", true)
+	test("v=BIMI1", "", true)
+	test("v=BIMI1; s=bad_selector", "", true)
+}
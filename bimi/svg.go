@@ -0,0 +1,120 @@
+package bimi
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const svgNamespace = "http://www.w3.org/2000/svg"
+
+// Elements not allowed in SVG Tiny PS: scripting, external content, animation and
+// links.
+var svgForbiddenElements = map[string]bool{
+	"script":           true,
+	"foreignobject":    true,
+	"image":            true,
+	"a":                true,
+	"animate":          true,
+	"animatecolor":     true,
+	"animatemotion":    true,
+	"animatetransform": true,
+	"set":              true,
+	"audio":            true,
+	"video":            true,
+	"iframe":           true,
+}
+
+// ValidateLogo checks that data is an SVG Tiny PS document as required for BIMI
+// logos: The root element must be "svg" in the SVG namespace with
+// baseProfile="tiny-ps" and version="1.2", without x or y attributes, and must
+// have a "title" element. Scripts, event handler attributes, external
+// references, animations and entity declarations are not allowed.
+func ValidateLogo(data []byte) error {
+	if len(data) > maxLogoSize {
+		return fmt.Errorf("%w: logo larger than %d bytes", ErrLogo, maxLogoSize)
+	}
+
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = true
+	var depth int
+	var root, title bool
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("%w: parsing xml: %v", ErrLogo, err)
+		}
+		switch t := t.(type) {
+		case xml.Directive:
+			if bytes.Contains(bytes.ToUpper(t), []byte("ENTITY")) {
+				return fmt.Errorf("%w: entity declarations not allowed", ErrLogo)
+			}
+		case xml.StartElement:
+			depth++
+			name := strings.ToLower(t.Name.Local)
+			if depth == 1 {
+				if err := checkSVGRoot(t); err != nil {
+					return err
+				}
+				root = true
+			} else if depth == 2 && name == "title" {
+				title = true
+			}
+			if svgForbiddenElements[name] {
+				return fmt.Errorf("%w: element %q not allowed", ErrLogo, t.Name.Local)
+			}
+			for _, a := range t.Attr {
+				k := strings.ToLower(a.Name.Local)
+				if strings.HasPrefix(k, "on") {
+					return fmt.Errorf("%w: event handler attribute %q not allowed", ErrLogo, a.Name.Local)
+				}
+				if k == "href" && !strings.HasPrefix(a.Value, "#") {
+					return fmt.Errorf("%w: external reference %q not allowed", ErrLogo, a.Value)
+				}
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+	if !root {
+		return fmt.Errorf("%w: missing svg element", ErrLogo)
+	}
+	if !title {
+		return fmt.Errorf("%w: missing title element", ErrLogo)
+	}
+	return nil
+}
+
+func checkSVGRoot(t xml.StartElement) error {
+	if t.Name.Local != "svg" || t.Name.Space != svgNamespace {
+		return fmt.Errorf("%w: root element must be svg in namespace %s", ErrLogo, svgNamespace)
+	}
+	attrs := map[string]string{}
+	for _, a := range t.Attr {
+		if a.Name.Space == "" {
+			attrs[a.Name.Local] = a.Value
+		}
+	}
+	var errs []error
+	if v := attrs["baseProfile"]; v != "tiny-ps" {
+		errs = append(errs, fmt.Errorf("baseProfile must be tiny-ps, got %q", v))
+	}
+	if v := attrs["version"]; v != "1.2" {
+		errs = append(errs, fmt.Errorf("version must be 1.2, got %q", v))
+	}
+	if _, ok := attrs["x"]; ok {
+		errs = append(errs, errors.New("x attribute not allowed on svg element"))
+	}
+	if _, ok := attrs["y"]; ok {
+		errs = append(errs, errors.New("y attribute not allowed on svg element"))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrLogo, errors.Join(errs...))
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package bimi
+
+import (
+	"errors"
+	"testing"
+)
+
+const testLogo = `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" version="1.2" baseProfile="tiny-ps" viewBox="0 0 100 100">
+	<title>Example</title>
+	<circle cx="50" cy="50" r="40" fill="#336699"/>
+</svg>
+`
+
+func TestValidateLogo(t *testing.T) {
+	test := func(svg string, expErr bool) {
+		t.Helper()
+		err := ValidateLogo([]byte(svg))
+		if (err != nil) != expErr || err != nil && !errors.Is(err, ErrLogo) {
+			t.Fatalf("validate logo %q: got err %v, expected error %v", svg, err, expErr)
+		}
+	}
+
+	test(testLogo, false)
+	test(`<svg xmlns="http://www.w3.org/2000/svg" version="1.2" baseProfile="tiny-ps"><title>x</title><use href="#a"/></svg>`, false)
+
+	test(`not xml`, true)
+	test(`<svg version="1.2" baseProfile="tiny-ps"><title>x</title></svg>`, true)                                                 // No namespace.
+	test(`<svg xmlns="http://www.w3.org/2000/svg" version="1.1" baseProfile="tiny-ps"><title>x</title></svg>`, true)              // Wrong version.
+	test(`<svg xmlns="http://www.w3.org/2000/svg" version="1.2" baseProfile="tiny"><title>x</title></svg>`, true)                 // Wrong profile.
+	test(`<svg xmlns="http://www.w3.org/2000/svg" version="1.2" baseProfile="tiny-ps" x="0"><title>x</title></svg>`, true)        // x attribute.
+	test(`<svg xmlns="http://www.w3.org/2000/svg" version="1.2" baseProfile="tiny-ps"></svg>`, true)                              // No title.
+	test(`<svg xmlns="http://www.w3.org/2000/svg" version="1.2" baseProfile="tiny-ps"><title>x</title><script/></svg>`, true)     // Script.
+	test(`<svg xmlns="http://www.w3.org/2000/svg" version="1.2" baseProfile="tiny-ps" onload="x()"><title>x</title></svg>`, true) // Event handler.
+	test(`<svg xmlns="http://www.w3.org/2000/svg" version="1.2" baseProfile="tiny-ps"><title>x</title><use href="https://example.com/x.svg#a"/></svg>`, true)
+	test(`<!DOCTYPE svg [<!ENTITY x "y">]><svg xmlns="http://www.w3.org/2000/svg" version="1.2" baseProfile="tiny-ps"><title>x</title></svg>`, true)
+}
@@ -0,0 +1,163 @@
+package bimi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mjl-/mox/dns"
+)
+
+// Roots is used to verify mark certificates. If nil, the system roots are used.
+// Mark certificates are issued under dedicated roots, which are typically not in
+// the system roots, so this is usually set.
+var Roots *x509.CertPool
+
+var (
+	// Extended key usage for BIMI mark certificates.
+	oidExtKeyUsageBIMI = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 31}
+	// Logotype extension, RFC 3709, holding the logo as data URI.
+	oidExtLogotype = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 12}
+	// Subject attribute with the type of mark.
+	oidMarkType = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 53087, 1, 13}
+)
+
+// Mark types that make a certificate a Common Mark Certificate (CMC). Other
+// marks, such as "Registered Mark" and "Government Mark", are for a Verified Mark
+// Certificate (VMC).
+var cmcMarkTypes = map[string]bool{
+	"Prior Use Mark":           true,
+	"Modified Registered Mark": true,
+}
+
+// VerifyCertificate verifies a PEM-encoded mark certificate chain, with the leaf
+// certificate first, as referenced by the "a=" tag of a BIMI record. The chain
+// must verify against Roots at time now, the leaf certificate must have the BIMI
+// extended key usage, and one of its DNS names must match one of domains. The
+// logo is taken from the logotype extension and validated as SVG Tiny PS.
+//
+// Evidence is "cmc" for Common Mark Certificates and "vmc" for Verified Mark
+// Certificates.
+func VerifyCertificate(pemBuf []byte, domains []dns.Domain, now time.Time) (evidence string, logo []byte, rerr error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, pemBuf = pem.Decode(pemBuf)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return "", nil, fmt.Errorf("%w: parsing certificate: %v", ErrCertificate, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return "", nil, fmt.Errorf("%w: no certificates in pem file", ErrCertificate)
+	}
+
+	leaf := certs[0]
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	opts := x509.VerifyOptions{
+		Roots:         Roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	if _, err := leaf.Verify(opts); err != nil {
+		return "", nil, fmt.Errorf("%w: verifying certificate chain: %v", ErrCertificate, err)
+	}
+
+	var bimiUsage bool
+	for _, oid := range leaf.UnknownExtKeyUsage {
+		if oid.Equal(oidExtKeyUsageBIMI) {
+			bimiUsage = true
+			break
+		}
+	}
+	if !bimiUsage {
+		return "", nil, fmt.Errorf("%w: certificate does not have bimi extended key usage", ErrCertificate)
+	}
+
+	if !certificateMatches(leaf, domains) {
+		return "", nil, fmt.Errorf("%w: certificate not valid for domain", ErrCertificate)
+	}
+
+	logo, err := certificateLogo(leaf)
+	if err != nil {
+		return "", nil, err
+	}
+
+	evidence = "vmc"
+	for _, n := range leaf.Subject.Names {
+		if s, ok := n.Value.(string); ok && n.Type.Equal(oidMarkType) && cmcMarkTypes[s] {
+			evidence = "cmc"
+		}
+	}
+	return evidence, logo, nil
+}
+
+func certificateMatches(cert *x509.Certificate, domains []dns.Domain) bool {
+	for _, name := range cert.DNSNames {
+		for _, d := range domains {
+			if strings.EqualFold(name, d.ASCII) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// certificateLogo returns the SVG logo from the logotype extension. The logo is
+// a "data:" URI with base64-encoded, possibly gzipped, SVG.
+func certificateLogo(cert *x509.Certificate) ([]byte, error) {
+	const prefix = "data:image/svg+xml;base64,"
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidExtLogotype) {
+			continue
+		}
+		i := bytes.Index(ext.Value, []byte(prefix))
+		if i < 0 {
+			return nil, fmt.Errorf("%w: no svg data uri in logotype extension", ErrCertificate)
+		}
+		data := ext.Value[i+len(prefix):]
+		n := bytes.IndexFunc(data, func(c rune) bool {
+			return !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '+' || c == '/' || c == '=')
+		})
+		if n >= 0 {
+			data = data[:n]
+		}
+		buf, err := base64.StdEncoding.DecodeString(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: decoding base64 logo: %v", ErrCertificate, err)
+		}
+		if bytes.HasPrefix(buf, []byte{0x1f, 0x8b}) {
+			gzr, err := gzip.NewReader(bytes.NewReader(buf))
+			if err != nil {
+				return nil, fmt.Errorf("%w: gunzip logo: %v", ErrCertificate, err)
+			}
+			buf, err = io.ReadAll(io.LimitReader(gzr, maxLogoSize+1))
+			if err != nil {
+				return nil, fmt.Errorf("%w: gunzip logo: %v", ErrCertificate, err)
+			}
+		}
+		if err := ValidateLogo(buf); err != nil {
+			return nil, err
+		}
+		return buf, nil
+	}
+	return nil, fmt.Errorf("%w: missing logotype extension", ErrCertificate)
+}
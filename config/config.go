@@ -39,6 +39,7 @@ type Static struct {
 	LogLevel         string            `sconf-doc:"Default log level, one of: error, info, debug, trace, traceauth, tracedata. Trace logs SMTP and IMAP protocol transcripts, with traceauth also messages with passwords, and tracedata on top of that also the full data exchanges (full messages), which can be a large amount of data."`
 	PackageLogLevels map[string]string `sconf:"optional" sconf-doc:"Overrides of log level per package (e.g. queue, smtpclient, smtpserver, imapserver, spf, dkim, dmarc, dmarcdb, autotls, junk, mtasts, tlsrpt)."`
 	User             string            `sconf:"optional" sconf-doc:"User to switch to after binding to all sockets as root. Default: mox. If the value is not a known user, it is parsed as integer and used as uid and gid."`
+	PreauthUser      string            `sconf:"optional" sconf-doc:"If set, unauthenticated IMAP connections are handled by a separate process running as this user, instead of by the main mox process. The user should not have access to the config and data directories. The separate process accepts IMAP connections and passes them to the main process, which does the TLS handshake and relays the data to the separate process. The separate process handles IMAP commands until authentication, and asks the main process over a local socket to verify credentials, so it does not need access to private keys or accounts. After successful authentication, the main process serves the connection itself, data of authenticated sessions does not pass through the separate process. Only IMAP is separated: SMTP, HTTP and the other protocols, and message delivery, are still handled by the main process, separating those is not yet implemented. The process runs with the group of User, for access to the mox binary. TLS client certificate authentication is not available for IMAP when set. If the value is not a known user, it is parsed as integer and used as uid."`
 	NoFixPermissions bool              `sconf:"optional" sconf-doc:"If true, do not automatically fix file permissions when starting up. By default, mox will ensure reasonable owner/permissions on the working, data and config directories (and files), and mox binary (if present)."`
 	Hostname         string            `sconf-doc:"Full hostname of system, e.g. mail.<domain>"`
 	HostnameDomain   dns.Domain        `sconf:"-" json:"-"` // Parsed form of hostname.
@@ -51,8 +52,10 @@ type Static struct {
 		} `sconf:"optional"`
 		CertPool *x509.CertPool `sconf:"-" json:"-"`
 	} `sconf:"optional" sconf-doc:"Global TLS configuration, e.g. for additional Certificate Authorities. Used for outgoing SMTP connections, HTTPS requests."`
+	RecursiveResolver *RecursiveResolver  `sconf:"optional" sconf-doc:"Use a built-in recursive DNS resolver with DNSSEC validation for DNS lookups, instead of the system resolver from /etc/resolv.conf. Lookups are done directly with the authoritative name servers, starting at the root name servers. DNSSEC results are used for DANE, MTA-STS and other checks that need authentic DNS responses. Without this option, the system resolver must be a DNSSEC-validating resolver (e.g. unbound) that sets the authentic data (AD) bit, and it must be trusted, e.g. by running on the same machine."`
 	ACME              map[string]ACME     `sconf:"optional" sconf-doc:"Automatic TLS configuration with ACME, e.g. through Let's Encrypt. The key is a name referenced in TLS configs, e.g. letsencrypt."`
 	AdminPasswordFile string              `sconf:"optional" sconf-doc:"File containing hash of admin password, for authentication in the web admin pages (if enabled)."`
+	AdminTOTPFile     string              `sconf:"optional" sconf-doc:"File containing a TOTP secret, as second factor for authentication in the web admin pages, in addition to the admin password. Set with \"mox setadmintotp\"."`
 	Listeners         map[string]Listener `sconf-doc:"Listeners are groups of IP addresses and services enabled on those IP addresses, such as SMTP/IMAP or internal endpoints for administration or Prometheus metrics. All listeners with SMTP/IMAP services enabled will serve all configured domains. If the listener is named 'public', it will get a few helpful additional configuration checks, for acme automatic tls certificates and monitoring of ips in dnsbls if those are configured."`
 	Postmaster        struct {
 		Account string
@@ -65,14 +68,23 @@ type Static struct {
 
 		ParsedLocalpart smtp.Localpart `sconf:"-"`
 	} `sconf:"optional" sconf-doc:"Destination for per-host TLS reports (TLSRPT). TLS reports can be per recipient domain (for MTA-STS), or per MX host (for DANE). The per-domain TLS reporting configuration is in domains.conf. This is the TLS reporting configuration for this host. If absent, no host-based TLSRPT address is configured, and no host TLSRPT DNS record is suggested."`
-	InitialMailboxes InitialMailboxes     `sconf:"optional" sconf-doc:"Mailboxes to create for new accounts. Inbox is always created. Mailboxes can be given a 'special-use' role, which are understood by most mail clients. If absent/empty, the following additional mailboxes are created: Sent, Archive, Trash, Drafts and Junk."`
-	DefaultMailboxes []string             `sconf:"optional" sconf-doc:"Deprecated in favor of InitialMailboxes. Mailboxes to create when adding an account. Inbox is always created. If no mailboxes are specified, the following are automatically created: Sent, Archive, Trash, Drafts and Junk."`
-	Transports       map[string]Transport `sconf:"optional" sconf-doc:"Transport are mechanisms for delivering messages. Transports can be referenced from Routes in accounts, domains and the global configuration. There is always an implicit/fallback delivery transport doing direct delivery with SMTP from the outgoing message queue. Transports are typically only configured when using smarthosts, i.e. when delivering through another SMTP server. Zero or one transport methods must be set in a transport, never multiple. When using an external party to send email for a domain, keep in mind you may have to add their IP address to your domain's SPF record, and possibly additional DKIM records."`
+	InitialMailboxes     InitialMailboxes               `sconf:"optional" sconf-doc:"Mailboxes to create for new accounts. Inbox is always created. Mailboxes can be given a 'special-use' role, which are understood by most mail clients. If absent/empty, the following additional mailboxes are created: Sent, Archive, Trash, Drafts and Junk."`
+	DefaultMailboxes     []string                       `sconf:"optional" sconf-doc:"Deprecated in favor of InitialMailboxes. Mailboxes to create when adding an account. Inbox is always created. If no mailboxes are specified, the following are automatically created: Sent, Archive, Trash, Drafts and Junk."`
+	Transports           map[string]Transport           `sconf:"optional" sconf-doc:"Transport are mechanisms for delivering messages. Transports can be referenced from Routes in accounts, domains and the global configuration. There is always an implicit/fallback delivery transport doing direct delivery with SMTP from the outgoing message queue. Transports are typically only configured when using smarthosts, i.e. when delivering through another SMTP server. Zero or one transport methods must be set in a transport, never multiple. When using an external party to send email for a domain, keep in mind you may have to add their IP address to your domain's SPF record, and possibly additional DKIM records."`
+	IPPools              map[string]IPPool              `sconf:"optional" sconf-doc:"IP pools are named sets of local IPs to make outgoing SMTP connections from, each IP with its own hostname for SMTP EHLO. A pool is used for deliveries through a Direct transport that references it, and routes select the transport, e.g. one transport with a pool for transactional messages and another for bulk messages. Each IP should have a reverse DNS (PTR) record with its hostname, and be included in the SPF records of sending domains. IPs that the DNSBL monitor finds listed (see MonitorDNSBLs in domains.conf and DNSBLs for SMTP listeners) are not used while listed, unless all IPs of an address family in a pool are listed."`
+	DestinationThrottles map[string]DestinationThrottle `sconf:"optional" sconf-doc:"Limits on deliveries from the queue to destinations, e.g. large mail providers that defer or block deliveries sent at high rates from IPs without reputation. Key is a name for the throttle, used in metrics and the admin web interface. Deliveries to a single recipient domain are never concurrent, regardless of throttles. Independent of throttles, when a remote SMTP server responds with a temporary error that looks like rate limiting (e.g. code 421, or a 4xx response mentioning rates or too many messages), no new deliveries are attempted to its throttle, or recipient domain if no throttle matches, for a period starting at 1 minute, doubling for each next rate limiting response up to 1 hour, and reset by a successful delivery."`
+	DMARCbis             bool                           `sconf:"optional" sconf-doc:"Use DMARCbis instead of RFC 7489 for DMARC evaluation of incoming messages. The DMARC record is found with a DNS tree walk from the From-domain up to the top-level domain, instead of looking at the From-domain and its organizational domain from the public suffix list. Organizational domains for relaxed alignment are determined from the psd= tags of DMARC records found in a DNS tree walk. The np= tag is applied for non-existent subdomains, a record with t=y (testing) is not applied, and pct= is ignored."`
 	// Awkward naming of fields to get intended default behaviour for zero values.
-	NoOutgoingDMARCReports          bool  `sconf:"optional" sconf-doc:"Do not send DMARC reports (aggregate only). By default, aggregate reports on DMARC evaluations are sent to domains if their DMARC policy requests them. Reports are sent at whole hours, with a minimum of 1 hour and maximum of 24 hours, rounded up so a whole number of intervals cover 24 hours, aligned at whole days in UTC. Reports are sent from the postmaster@<mailhostname> address."`
-	NoOutgoingTLSReports            bool  `sconf:"optional" sconf-doc:"Do not send TLS reports. By default, reports about failed SMTP STARTTLS connections and related MTA-STS/DANE policies are sent to domains if their TLSRPT DNS record requests them. Reports covering a 24 hour UTC interval are sent daily. Reports are sent from the postmaster address of the configured domain the mailhostname is in. If there is no such domain, or it does not have DKIM configured, no reports are sent."`
-	OutgoingTLSReportsForAllSuccess bool  `sconf:"optional" sconf-doc:"Also send TLS reports if there were no SMTP STARTTLS connection failures. By default, reports are only sent when at least one failure occurred. If a report is sent, it does always include the successful connection counts as well."`
-	QuotaMessageSize                int64 `sconf:"optional" sconf-doc:"Default maximum total message size in bytes for each individual account, only applicable if greater than zero. Can be overridden per account. Attempting to add new messages to an account beyond its maximum total size will result in an error. Useful to prevent a single account from filling storage. The quota only applies to the email message files, not to any file system overhead and also not the message index database file (account for approximately 15% overhead)."`
+	NoOutgoingDMARCReports          bool                 `sconf:"optional" sconf-doc:"Do not send DMARC reports (aggregate only). By default, aggregate reports on DMARC evaluations are sent to domains if their DMARC policy requests them. Reports are sent at whole hours, with a minimum of 1 hour and maximum of 24 hours, rounded up so a whole number of intervals cover 24 hours, aligned at whole days in UTC. Reports are sent from the postmaster@<mailhostname> address."`
+	NoOutgoingTLSReports            bool                 `sconf:"optional" sconf-doc:"Do not send TLS reports. By default, reports about failed SMTP STARTTLS connections and related MTA-STS/DANE policies are sent to domains if their TLSRPT DNS record requests them. Reports covering a 24 hour UTC interval are sent daily. Reports are sent from the postmaster address of the configured domain the mailhostname is in. If there is no such domain, or it does not have DKIM configured, no reports are sent."`
+	OutgoingTLSReportsForAllSuccess bool                 `sconf:"optional" sconf-doc:"Also send TLS reports if there were no SMTP STARTTLS connection failures. By default, reports are only sent when at least one failure occurred. If a report is sent, it does always include the successful connection counts as well."`
+	DMARCFailureReports             *DMARCFailureReports `sconf:"optional" sconf-doc:"Send DMARC failure reports (also called forensic reports) in AFRF format about incoming messages that fail DMARC, to domains that request them with ruf= in their DMARC record. Which failures are reported is determined by the fo= option of the DMARC record. Failure reports contain (parts of) messages, so they are only sent for explicitly configured domains. Reports are sent from the postmaster@<mailhostname> address, DKIM-signed if possible. Reporting addresses in another organizational domain must opt in with a DNS record, as for aggregate reports. Reporting addresses on the DMARC reporting suppression list do not receive failure reports."`
+	IncomingBIMI                    *IncomingBIMI        `sconf:"optional" sconf-doc:"Verify BIMI (Brand Indicators for Message Identification) for incoming messages, and show the logo of the sender domain in the message list of the webmail interface. BIMI is only evaluated for messages that pass DMARC with a quarantine or reject policy. Logos and certificates are fetched over HTTPS from locations in the DNS records of sender domains at delivery time. Delivery waits at most 5 seconds, slower fetches complete in the background and are used for later messages from the domain."`
+	ContentScanner                  *ContentScanner      `sconf:"optional" sconf-doc:"Scan incoming and submitted messages for viruses and other malware with an external scanner, e.g. ClamAV's clamd, or an ICAP server. Clean messages get an X-Mox-Content-Scan header with the result."`
+	QuotaMessageSize                int64                `sconf:"optional" sconf-doc:"Default maximum total message size in bytes for each individual account, only applicable if greater than zero. Can be overridden per account. Attempting to add new messages to an account beyond its maximum total size will result in an error. Useful to prevent a single account from filling storage. Calendar and contact objects also count towards the quota. The quota only applies to the email message files and calendar and contact data, not to any file system overhead and also not the message index database file (account for approximately 15% overhead)."`
+	FailedAuthRateLimits            []RateLimit          `sconf:"optional" sconf-doc:"Limits on failed authentication attempts from an IP and its networks, for all protocols and listeners. While a limit is reached, connections for authentication are refused. If empty, the defaults are used: per minute 10 for an IP, 30 for its network and 90 for its larger network, and per day 50, 150 and 450. Counts are kept across restarts."`
+	RateLimitAllowlist              []string             `sconf:"optional" sconf-doc:"IP addresses and networks in CIDR notation, e.g. 192.0.2.10 or 2001:db8::/64, that are never rate limited, for connections and for failed authentication attempts. For example for monitoring hosts."`
+	IPBans                          IPBans               `sconf:"optional" sconf-doc:"Automatic temporary bans of IPs after repeated failed authentication attempts. Banned IPs are refused at connection time on all listeners, and for HTTP on each request, except on web server ports with RateLimitDisabled. Bans can also be added manually, and IPs can be allowlisted against bans, through the admin web interface and the mox ipban subcommands. IPs in RateLimitAllowlist are never banned either."`
 
 	// All IPs that were explicitly listened on for external SMTP. Only set when there
 	// are no unspecified external SMTP listeners and there is at most one for IPv4 and
@@ -86,6 +98,11 @@ type Static struct {
 	// To switch to after initialization as root.
 	UID uint32 `sconf:"-" json:"-"`
 	GID uint32 `sconf:"-" json:"-"`
+
+	// For the process handling unauthenticated IMAP connections, if PreauthUser is set.
+	PreauthUID uint32 `sconf:"-" json:"-"`
+
+	RateLimitAllowlistNets []net.IPNet `sconf:"-" json:"-"` // Parsed form of RateLimitAllowlist.
 }
 
 // InitialMailboxes are mailboxes created for a new account.
@@ -156,11 +173,20 @@ type Listener struct {
 
 		DNSBLs []string `sconf:"optional" sconf-doc:"Addresses of DNS block lists for incoming messages. Block lists are only consulted for connections/messages without enough reputation to make an accept/reject decision. This prevents sending IPs of all communications to the block list provider. If any of the listed DNSBLs contains a requested IP address, the message is rejected as spam. The DNSBLs are checked for healthiness before use, at most once per 4 hours. IPs we can send from are periodically checked for being in the configured DNSBLs. See MonitorDNSBLs in domains.conf to only monitor IPs we send from, without using those DNSBLs for incoming messages. Example DNSBLs: sbl.spamhaus.org, bl.spamcop.net. See https://www.spamhaus.org/sbl/ and https://www.spamcop.net/ for more information and terms of use."`
 
+		URIBLs          []string `sconf:"optional" sconf-doc:"Addresses of domain-based DNS block lists (URIBLs/DBLs) to check the domains of links in incoming messages against. Like DNSBLs, they are only consulted for messages without enough reputation to make an accept/reject decision. Domains are extracted from URLs in text and HTML parts. Both the host names and their organizational domains are looked up. Domains of this mail server are not looked up. Results are cached for an hour. If a domain is listed, the junk filter is applied with a stricter threshold, or the message is rejected if URIBLReject is set. The URIBLs are checked for healthiness before use, at most once per 4 hours. Example: dbl.spamhaus.org. See https://www.spamhaus.org/dbl/ for more information and terms of use."`
+		URIBLReject     bool     `sconf:"optional" sconf-doc:"Reject messages with a link to a domain listed in a URIBL, like for DNSBL listings, instead of only applying a stricter junk filter threshold."`
+		URIBLMaxLookups int      `sconf:"optional" sconf-doc:"Maximum number of domains to look up per URIBL for a message. Domains are looked up in order of appearance in the message. Default 20."`
+
+		LocalLists []LocalList `sconf:"optional" sconf-doc:"Local IP and domain lists in files, used as block or allow lists for incoming messages, checked in the same place as DNSBLs. Lists are reloaded when their file changes. Lists with a Zone can also be served over DNS by listeners with DNSLists enabled."`
+
 		FirstTimeSenderDelay *time.Duration `sconf:"optional" sconf-doc:"Delay before accepting a message from a first-time sender for the destination account. Default: 15s."`
 
+		Greylisting *Greylisting `sconf:"optional" sconf-doc:"Greylisting of incoming deliveries from senders without reputation. The first delivery attempt for a combination of remote IP network, MAIL FROM and RCPT TO address is temporarily rejected, a retry after a delay is accepted. Messages from senders with a good reputation at the destination account are not greylisted."`
+
 		TLSSessionTicketsDisabled *bool `sconf:"optional" sconf-doc:"Override default setting for enabling TLS session tickets. Disabling session tickets may work around TLS interoperability issues."`
 
 		DNSBLZones []dns.Domain `sconf:"-"`
+		URIBLZones []dns.Domain `sconf:"-"`
 	} `sconf:"optional"`
 	Submission struct {
 		Enabled           bool
@@ -190,6 +216,8 @@ type Listener struct {
 	WebmailHTTPS WebService `sconf:"optional" sconf-doc:"Webmail client, like WebmailHTTP, but for HTTPS. Requires a TLS config."`
 	WebAPIHTTP   WebService `sconf:"optional" sconf-doc:"Like WebAPIHTTPS, but with plain HTTP, without TLS."`
 	WebAPIHTTPS  WebService `sconf:"optional" sconf-doc:"WebAPI, a simple HTTP/JSON-based API for email, with HTTPS (requires a TLS config). Default path is /webapi/."`
+	DAVHTTP      WebService `sconf:"optional" sconf-doc:"Like DAVHTTPS, but with plain HTTP, without TLS."`
+	DAVHTTPS     WebService `sconf:"optional" sconf-doc:"CalDAV and CardDAV, for calendars and address books of accounts, with HTTPS (requires a TLS config). Clients authenticate with an email address and the account password, or an app password for protocol dav. Default path is /dav/. Requests for /.well-known/caldav and /.well-known/carddav are redirected to this path."`
 	MetricsHTTP  struct {
 		Enabled bool
 		Port    int `sconf:"optional" sconf-doc:"Default 8010."`
@@ -213,13 +241,72 @@ type Listener struct {
 	WebserverHTTP struct {
 		Enabled           bool
 		Port              int  `sconf:"optional" sconf-doc:"Port for plain HTTP (non-TLS) webserver."`
-		RateLimitDisabled bool `sconf:"optional" sconf-doc:"Disable rate limiting for all requests to this port."`
+		RateLimitDisabled bool `sconf:"optional" sconf-doc:"Disable rate limiting, and refusing requests from banned IPs, for all requests to this port."`
 	} `sconf:"optional" sconf-doc:"All configured WebHandlers will serve on an enabled listener."`
 	WebserverHTTPS struct {
 		Enabled           bool
 		Port              int  `sconf:"optional" sconf-doc:"Port for HTTPS webserver."`
-		RateLimitDisabled bool `sconf:"optional" sconf-doc:"Disable rate limiting for all requests to this port."`
+		RateLimitDisabled bool `sconf:"optional" sconf-doc:"Disable rate limiting, and refusing requests from banned IPs, for all requests to this port."`
 	} `sconf:"optional" sconf-doc:"All configured WebHandlers will serve on an enabled listener. Either ACME must be configured, or for each WebHandler domain a TLS certificate must be configured."`
+	DNSLists struct {
+		Enabled         bool
+		Port            int         `sconf:"optional" sconf-doc:"Default 53."`
+		AllowedNetworks []string    `sconf:"optional" sconf-doc:"IPs and networks (in CIDR notation) of clients allowed to query the lists, e.g. the other mail servers. Queries from other IPs are ignored. Required when enabled, mox refuses to start if empty."`
+		AllowedNets     []net.IPNet `sconf:"-" json:"-"` // Parsed form of AllowedNetworks.
+	} `sconf:"optional" sconf-doc:"Serve the LocalLists with a Zone, of all SMTP listeners, over DNS on UDP and TCP, for use as DNS block or allow lists by other mail servers. Listed IPs and domains have an A record (127.0.0.2 by default) and a TXT record with the text for the entry. For DNSBL health checks, 127.0.0.2 is always listed. You should not enable this on a public IP."`
+	RateLimits ListenerRateLimits `sconf:"optional" sconf-doc:"Limits on connections to this listener, per protocol. Limits apply to the remote IP, and to the networks it is in: /26 and /21 for IPv4, /48 and /32 for IPv6, where a single IPv6 \"IP\" is its /64. Protocols without configured limits share the default limits with the same protocol on other listeners. Counts for connection rates are kept across restarts."`
+}
+
+// ListenerRateLimits holds the limits on connections to a listener.
+type ListenerRateLimits struct {
+	SMTP       *ConnectionLimits `sconf:"optional" sconf-doc:"For SMTP, for incoming deliveries. Default rate per minute: 300 for an IP, 900 and 2700 for its networks. Default open connections: 30, 90 and 270."`
+	Submission *ConnectionLimits `sconf:"optional" sconf-doc:"For Submission and Submissions, including submission over HTTPS. Defaults are the same as for SMTP, but counted separately."`
+	IMAP       *ConnectionLimits `sconf:"optional" sconf-doc:"For IMAP and IMAPS, including IMAP over HTTPS. Defaults are the same as for SMTP."`
+	HTTP       *ConnectionLimits `sconf:"optional" sconf-doc:"For HTTP and HTTPS. For HTTP, rate limits apply to requests instead of connections, and Open is not used. Default rate per minute 1000 for an IP, 3000 and 9000 for its networks, and per hour 5000, 15000 and 45000. Ports with RateLimitDisabled are not limited."`
+}
+
+// ConnectionLimits holds the limits on connections for a protocol of a listener.
+type ConnectionLimits struct {
+	Rate []RateLimit `sconf:"optional" sconf-doc:"Limits on new connections in time windows. If empty, the default is used."`
+	Open *RateLimit  `sconf:"optional" sconf-doc:"Limit on open connections. Window must not be set. If absent, the default is used."`
+}
+
+// RateLimit is a limit on counts for an IP and the networks it is in, e.g. of
+// connections or failed authentication attempts.
+type RateLimit struct {
+	Window  time.Duration `sconf:"optional" sconf-doc:"Duration of the time window, e.g. 1m or 24h. Counts reset at the start of each window. Required for rate limits."`
+	IP      int64         `sconf-doc:"Limit for a single IP, or an IPv6 /64 network."`
+	Subnet  int64         `sconf-doc:"Limit for the IPv4 /26 or IPv6 /48 network."`
+	Network int64         `sconf-doc:"Limit for the IPv4 /21 or IPv6 /32 network."`
+}
+
+// IPBans configures automatic banning of IPs with repeated failed authentication
+// attempts.
+type IPBans struct {
+	Disabled    bool          `sconf:"optional" sconf-doc:"Don't ban IPs automatically. Bans added manually are still enforced."`
+	Failures    int           `sconf:"optional" sconf-doc:"Number of failed authentication attempts from an IP, or IPv6 /64 network, within Window, for all protocols combined, after which the IP is banned. Default 20."`
+	Window      time.Duration `sconf:"optional" sconf-doc:"Time window for counting failed authentication attempts. Default 1h."`
+	Duration    time.Duration `sconf:"optional" sconf-doc:"Duration of the first automatic ban for an IP. Each next ban, within 30 days after the previous ban expired, lasts twice as long as the previous, up to MaxDuration. Default 1h."`
+	MaxDuration time.Duration `sconf:"optional" sconf-doc:"Maximum duration of an automatic ban. Default 720h, 30 days."`
+}
+
+// LocalList is an IP and domain list in a local file, in a format similar to
+// rbldnsd.
+type LocalList struct {
+	File  string `sconf-doc:"File with the list, relative to the directory of mox.conf. Each line has an IP address, a CIDR network (e.g. 192.0.2.0/24 or 2001:db8::/32) or a domain, optionally followed by whitespace and a text for the entry. A domain matches only itself, \".example.com\" matches the domain and its subdomains, and \"*.example.com\" only its subdomains. Entries starting with \"!\" exclude IPs or domains from a less specific matching entry. A line \":127.0.0.2:text\" sets the address returned over DNS and the text for entries without text. In texts, \"$\" is replaced with the IP or domain. Empty lines and lines starting with \"#\" are ignored."`
+	Allow bool   `sconf:"optional" sconf-doc:"If set, the list is an allowlist: messages from listed IPs, or with a listed verified domain (SPF-verified MAIL FROM, DKIM-signature, DMARC-verified message From, or verified EHLO), are accepted without reputation, DNSBL and junk content checks. Otherwise the list is a blocklist: messages from listed IPs, or with a listed EHLO, MAIL FROM, DKIM or message From domain, are rejected, like for DNSBL listings."`
+	Zone  string `sconf:"optional" sconf-doc:"DNS zone to serve the list under by listeners with DNSLists enabled, e.g. bl.example.internal. IPs are queried as for DNSBLs, e.g. 1.2.0.192.bl.example.internal for 192.0.2.1, and domains like example.com.bl.example.internal. If empty, the list is not served."`
+
+	Path       string     `sconf:"-" json:"-"` // Absolute path of File, set when parsing config.
+	ZoneDomain dns.Domain `sconf:"-" json:"-"` // Set when parsing config.
+}
+
+// Greylisting configures greylisting for incoming deliveries on an SMTP listener.
+type Greylisting struct {
+	Enabled       bool
+	Delay         time.Duration `sconf:"optional" sconf-doc:"Minimum time after a first delivery attempt before a retry is accepted. Default 5m."`
+	RetryWindow   time.Duration `sconf:"optional" sconf-doc:"Time after a first delivery attempt within which a retry is accepted. A later retry is treated as a first attempt. Default 24h."`
+	AllowDuration time.Duration `sconf:"optional" sconf-doc:"After a successful retry, the remote IP network (IPv4 /24 or IPv6 /64), or the SPF-verified MAIL FROM domain, is allowlisted, as are the DKIM- and SPF-verified domains of the message. Allowlisting is extended on each delivery, and expires after this period without deliveries. Default 840h (35 days)."`
 }
 
 // WebService is an internal web interface: webmail, webaccount, webadmin, webapi.
@@ -277,12 +364,79 @@ type TransportSocks struct {
 }
 
 type TransportDirect struct {
-	DisableIPv4 bool `sconf:"optional" sconf-doc:"If set, outgoing SMTP connections will *NOT* use IPv4 addresses to connect to remote SMTP servers."`
-	DisableIPv6 bool `sconf:"optional" sconf-doc:"If set, outgoing SMTP connections will *NOT* use IPv6 addresses to connect to remote SMTP servers."`
+	DisableIPv4 bool   `sconf:"optional" sconf-doc:"If set, outgoing SMTP connections will *NOT* use IPv4 addresses to connect to remote SMTP servers."`
+	DisableIPv6 bool   `sconf:"optional" sconf-doc:"If set, outgoing SMTP connections will *NOT* use IPv6 addresses to connect to remote SMTP servers."`
+	IPPool      string `sconf:"optional" sconf-doc:"Name of IP pool, see IPPools, to select the local IP and EHLO hostname for outgoing connections from. If the pool has no IPs of an address family, remote SMTP servers are not connected to over that address family. If empty, the IPs of SMTP listeners are used."`
 
 	IPFamily string `sconf:"-" json:"-"`
 }
 
+// IPPool is a set of local IPs for outgoing SMTP connections.
+type IPPool struct {
+	IPs       []IPPoolIP `sconf-doc:"IPs in the pool."`
+	Selection string     `sconf:"optional" sconf-doc:"How an IP is selected for a connection: \"roundrobin\" (default) uses each next IP in turn, \"sticky\" always uses the same IP for a recipient domain (while usable), based on a hash of the domain name, for consistent reputation with a destination and for greylisting."`
+	Warmup    []int      `sconf:"optional" sconf-doc:"Warm-up schedule for new IPs, see WarmupStart of the IPs. Each value is the maximum number of messages to deliver from an IP per day (UTC), for each day since its warm-up started, e.g. 50, 100, 250, 500, 1000, 2500, 5000, 10000. After the last day, the IP has no daily limit. IPs that reached their limit for the day are not used. If all IPs in the pool reached their limit, delivery attempts through the pool are postponed until the next day, without counting as an attempt."`
+}
+
+type IPPoolIP struct {
+	IP          string `sconf-doc:"IP address to connect from, must be configured on a network interface of this machine."`
+	Hostname    string `sconf:"optional" sconf-doc:"Hostname for SMTP EHLO for connections from this IP. Should be the name in the reverse DNS (PTR) record for the IP. If empty, the hostname of this mox instance is used."`
+	WarmupStart string `sconf:"optional" sconf-doc:"Date, in form 2006-01-02, on which the IP started sending. The Warmup schedule of the pool applies to the IP from this date. If empty, the IP is considered warmed up and has no daily limit."`
+
+	ParsedIP        net.IP     `sconf:"-" json:"-"`
+	HostnameDomain  dns.Domain `sconf:"-" json:"-"`
+	WarmupStartTime time.Time  `sconf:"-" json:"-"`
+}
+
+// DMARCFailureReports configures sending DMARC failure reports.
+type DMARCFailureReports struct {
+	Domains         []string `sconf-doc:"Domains of message From headers to send failure reports for, typically partner domains that asked for them. Subdomains of listed domains are included."`
+	MaxPerHour      int      `sconf:"optional" sconf-doc:"Maximum number of failure reports to send per hour to the domain of a reporting address, regardless of the DMARC policy domain the failures are for. Failures beyond the limit are not reported to that domain. Default 10."`
+	IncludeBody     bool     `sconf:"optional" sconf-doc:"Include the full message in reports instead of only its header. Messages larger than 256KiB are always reported with only their header."`
+	RedactHeaders   []string `sconf:"optional" sconf-doc:"Header fields to leave out of the message in reports, e.g. Received to hide details about the infrastructure of the recipient. Case-insensitive."`
+	RedactAddresses bool     `sconf:"optional" sconf-doc:"Replace localparts of email addresses in the message header and the envelope fields of reports with \"redacted\", as described in RFC 6590. Domains of addresses remain visible. Addresses in a message body included in a report are not redacted."`
+
+	ParsedDomains []dns.Domain `sconf:"-" json:"-"`
+}
+
+// RecursiveResolver configures the built-in DNSSEC-validating recursive resolver.
+type RecursiveResolver struct {
+	Enabled              bool     `sconf-doc:"Whether to use the built-in recursive resolver."`
+	TrustAnchors         []string `sconf:"optional" sconf-doc:"DNSSEC trust anchors for the root zone, as DS or DNSKEY records in DNS presentation format, e.g. \". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D\". If absent, the current root zone key signing keys published by IANA are used."`
+	NoTrustAnchorUpdates bool     `sconf:"optional" sconf-doc:"Do not automatically update trust anchors. By default, new root zone key signing keys are trusted after they have been signed by a trusted key for 30 days, and keys are no longer trusted when they are revoked, according to RFC 5011. The state is kept in the data directory, in dnssec-trust-anchors.json."`
+	CacheSize            int      `sconf:"optional" sconf-doc:"Maximum number of cached responses and NSEC records. Default 10000."`
+}
+
+// IncomingBIMI configures BIMI verification of incoming messages.
+type IncomingBIMI struct {
+	Enabled            bool `sconf-doc:"Whether to verify BIMI for incoming messages."`
+	RequireCertificate bool `sconf:"optional" sconf-doc:"Only accept logos from domains that reference a Verified Mark Certificate (VMC) or Common Mark Certificate (CMC). Mark certificates are issued under their own root certificates, not the system roots. Without this option, logos referenced without certificate are used as well."`
+}
+
+// ContentScanner configures scanning of messages by an external virus/malware
+// scanner.
+type ContentScanner struct {
+	Protocol   string        `sconf-doc:"Protocol to talk to the scanner: clamd for the INSTREAM command of ClamAV's clamd, or icap for an ICAP server (RFC 3507) with RESPMOD."`
+	Address    string        `sconf-doc:"For clamd, host:port for a TCP connection, e.g. localhost:3310, or the path to a unix domain socket, e.g. /run/clamav/clamd.ctl. For icap, a URL with host, optional port (default 1344) and service, e.g. icap://localhost:1344/avscan."`
+	Timeout    time.Duration `sconf:"optional" sconf-doc:"Timeout for scanning a message, including connecting. Default 30s."`
+	MaxSize    int64         `sconf:"optional" sconf-doc:"Messages larger than this size in bytes are not scanned. With FailOpen, they are accepted without scan result. By default (fail-closed), they are rejected with a permanent error. Default 25MB. Scanners typically have their own limit, e.g. StreamMaxLength in clamd.conf, which should not be smaller."`
+	FailOpen   bool          `sconf:"optional" sconf-doc:"If the scanner cannot be reached, or returns an error, or the message is larger than MaxSize, accept the message without scan result. By default (fail-closed), the message is rejected with a temporary error, and the sender will retry later."`
+	Quarantine bool          `sconf:"optional" sconf-doc:"For incoming deliveries, store infected messages in the Rejects mailbox of the recipient accounts, instead of only rejecting them. The SMTP transaction is rejected in both cases. Infected messages from submission are always rejected."`
+}
+
+// DestinationThrottle limits deliveries to a group of recipient domains.
+type DestinationThrottle struct {
+	Domains           []string `sconf:"optional" sconf-doc:"Recipient domains the throttle applies to. A domain starting with a dot, e.g. .example.com, matches its subdomains."`
+	MXHosts           []string `sconf:"optional" sconf-doc:"MX hosts of recipient domains the throttle applies to, e.g. .google.com for domains hosted by Google. A host starting with a dot matches its subdomains. The MX records of a recipient domain are looked up during delivery attempts, so the throttle applies to a recipient domain from its second delivery attempt after startup."`
+	MaxConcurrent     int      `sconf:"optional" sconf-doc:"Maximum number of concurrent deliveries to recipient domains of the throttle. Zero means no limit."`
+	MessagesPerMinute int      `sconf:"optional" sconf-doc:"Maximum number of messages (recipients) to deliver to recipient domains of the throttle per minute. Zero means no limit."`
+	MessagesPerHour   int      `sconf:"optional" sconf-doc:"Maximum number of messages (recipients) to deliver to recipient domains of the throttle per hour. Zero means no limit."`
+
+	// Lower-case ASCII names, with leading dot for subdomain matches.
+	DomainsASCII []string `sconf:"-" json:"-"`
+	MXHostsASCII []string `sconf:"-" json:"-"`
+}
+
 // TransportFail is a transport that fails all delivery attempts.
 type TransportFail struct {
 	SMTPCode    int    `sconf:"optional" sconf-doc:"SMTP error code and optional enhanced error code to use for the failure. If empty, 554 is used (transaction failed)."`
@@ -304,8 +458,11 @@ type Domain struct {
 	DMARC                       *DMARC           `sconf:"optional" sconf-doc:"With DMARC, a domain publishes, in DNS, a policy on how other mail servers should handle incoming messages with the From-header matching this domain and/or subdomain (depending on the configured alignment). Receiving mail servers use this to build up a reputation of this domain, which can help with mail delivery. A domain can also publish an email address to which reports about DMARC verification results can be sent by verifying mail servers, useful for monitoring. Incoming DMARC reports are automatically parsed, validated, added to metrics and stored in the reporting database for later display in the admin web pages."`
 	MTASTS                      *MTASTS          `sconf:"optional" sconf-doc:"MTA-STS is a mechanism that allows publishing a policy with requirements for WebPKI-verified SMTP STARTTLS connections for email delivered to a domain. Existence of a policy is announced in a DNS TXT record (often unprotected/unverified, MTA-STS's weak spot). If a policy exists, it is fetched with a WebPKI-verified HTTPS request. The policy can indicate that WebPKI-verified SMTP STARTTLS is required, and which MX hosts (optionally with a wildcard pattern) are allowd. MX hosts to deliver to are still taken from DNS (again, not necessarily protected/verified), but messages will only be delivered to domains matching the MX hosts from the published policy. Mail servers look up the MTA-STS policy when first delivering to a domain, then keep a cached copy, periodically checking the DNS record if a new policy is available, and fetching and caching it if so. To update a policy, first serve a new policy with an updated policy ID, then update the DNS record (not the other way around). To remove an enforced policy, publish an updated policy with mode \"none\" for a long enough period so all cached policies have been refreshed (taking DNS TTL and policy max age into account), then remove the policy from DNS, wait for TTL to expire, and stop serving the policy."`
 	TLSRPT                      *TLSRPT          `sconf:"optional" sconf-doc:"With TLSRPT a domain specifies in DNS where reports about encountered SMTP TLS behaviour should be sent. Useful for monitoring. Incoming TLS reports are automatically parsed, validated, added to metrics and stored in the reporting database for later display in the admin web pages."`
+	BIMI                        *BIMI            `sconf:"optional" sconf-doc:"With BIMI (Brand Indicators for Message Identification), a domain publishes a logo in DNS, which mail clients can show with messages that pass DMARC. The logo is only used if the DMARC policy of the domain is quarantine or reject. The DNS records page in the admin web interface includes the BIMI record, and the domain check verifies it."`
 	Routes                      []Route          `sconf:"optional" sconf-doc:"Routes for delivering outgoing messages through the queue. Each delivery attempt evaluates account routes, these domain routes and finally global routes. The transport of the first matching route is used in the delivery attempt. If no routes match, which is the default with no configured routes, messages are delivered directly from the queue."`
+	SendLimits                  *SendLimits      `sconf:"optional" sconf-doc:"Limits on outgoing messages with a message From address in this domain, for all accounts combined, per hour, day and month, with a policy for when a limit is reached. Account limits apply as well."`
 	Aliases                     map[string]Alias `sconf:"optional" sconf-doc:"Aliases that cause messages to be delivered to one or more locally configured addresses. Keys are localparts (encoded, as they appear in email addresses)."`
+	AttachmentRules             []AttachmentRule `sconf:"optional" sconf-doc:"Rules for attachments in incoming messages for this domain, and in outgoing messages with a message From address in this domain. Evaluated in addition to account attachment rules."`
 
 	Domain                  dns.Domain `sconf:"-"`
 	ClientSettingsDNSDomain dns.Domain `sconf:"-" json:"-"`
@@ -317,6 +474,38 @@ type Domain struct {
 	LocalpartCatchallSeparatorsEffective []string `sconf:"-"` // Either LocalpartCatchallSeparators, the value of LocalpartCatchallSeparator, or empty.
 }
 
+// SendLimits are limits on outgoing messages for an account or domain.
+type SendLimits struct {
+	All        SendLimitCounts `sconf:"optional" sconf-doc:"Limits for all outgoing messages. Hourly limits apply to the current hour, daily limits to the past 24 hours in whole hours, and monthly limits to the past 30 days in whole days (UTC)."`
+	Submission SendLimitCounts `sconf:"optional" sconf-doc:"Limits for messages submitted over SMTP and through webmail."`
+	WebAPI     SendLimitCounts `sconf:"optional" sconf-doc:"Limits for messages submitted through the webapi."`
+	Policy     string          `sconf:"optional" sconf-doc:"What to do when sending a message would exceed a limit: \"reject\" (default) refuses the message, for SMTP with a temporary error for hourly limits and a permanent error for daily and monthly limits, \"hold\" accepts the message but adds a hold rule to the queue for the account or domain, so this and later messages are not delivered until the admin removes the hold rule and releases the messages, \"notify\" accepts and delivers the message. For \"hold\" and \"notify\", the postmaster is sent a message about the limit. For all policies, an outgoing webhook with event \"limitreached\" is sent, if configured for the account. Notifications are sent at most once per limit per period."`
+}
+
+// SendLimitCounts are maximum numbers of messages and recipients in outgoing
+// messages in the current hour, the past day (24 hours, in whole hours) and the
+// past month (30 days, in whole days, UTC). Zero means no limit.
+type SendLimitCounts struct {
+	MessagesPerHour    int `sconf:"optional"`
+	MessagesPerDay     int `sconf:"optional"`
+	MessagesPerMonth   int `sconf:"optional"`
+	RecipientsPerHour  int `sconf:"optional"`
+	RecipientsPerDay   int `sconf:"optional"`
+	RecipientsPerMonth int `sconf:"optional"`
+}
+
+// AttachmentRule is a policy for attachments in incoming and/or outgoing messages,
+// evaluated on each part of a message, including parts of embedded messages.
+type AttachmentRule struct {
+	Direction            string   `sconf:"optional" sconf-doc:"Apply rule to \"incoming\" or \"outgoing\" messages only. If empty, the rule applies to both. Incoming messages are deliveries over SMTP to the domain or account, outgoing messages are submitted over SMTP by the account or with a message From address in the domain."`
+	ContentTypes         []string `sconf:"optional" sconf-doc:"Content types (lower-case) to match, with optional wildcards in the style of shell file name patterns, e.g. \"application/x-msdownload\" or \"application/vnd.ms-*.macroenabled.*\". Both the content type declared in the message and the content type detected from the data are matched. Detected types include application/x-msdownload for Windows executables, application/x-executable for ELF executables, application/zip, application/x-rar-compressed, application/x-7z-compressed, application/x-ole-storage for legacy Office documents, and application/vnd.ms-word.document.macroenabled.12 (and similar for excel and powerpoint) for Office documents containing macros."`
+	Extensions           []string `sconf:"optional" sconf-doc:"File name extensions (lower-case, with leading dot), e.g. \".exe\". Matched against the file name of the part and against names of files inside zip archives."`
+	EncryptedArchive     bool     `sconf:"optional" sconf-doc:"If set, match zip archives containing encrypted (password-protected) files."`
+	UninspectableArchive bool     `sconf:"optional" sconf-doc:"If set, match archives of which the files cannot be listed, so Extensions cannot be matched: rar and 7z archives, and zip archives that are too large (over 32MB) or malformed."`
+	MinSize              int64    `sconf:"optional" sconf-doc:"If non-zero, only match parts with a decoded size of at least this many bytes. If no content types, extensions, encrypted or uninspectable archive match is configured, all attachments of at least this size match, e.g. to block large attachments. Attachments are parts with a Content-Disposition of \"attachment\" or with a file name, so message text is not matched."`
+	Action               string   `sconf-doc:"What to do with a message with a matching part: \"reject\" refuses the message with a permanent error, \"strip\" replaces the part with a text part explaining it was removed, \"quarantine\" refuses incoming messages but stores a copy in the rejects mailbox of the account (if configured), and refuses outgoing messages. If a message has parts matching multiple rules, reject has precedence over quarantine, which has precedence over strip. Messages that consist of only a matching part are rejected instead of stripped."`
+}
+
 // todo: allow external addresses as members of aliases. we would add messages for them to the queue for outgoing delivery. we should require an admin addresses to which delivery failures will be delivered (locally, and to use in smtp mail from, so dsns go there). also take care to evaluate smtputf8 (if external address requires utf8 and incoming transaction didn't).
 // todo: as alternative to PostPublic, allow specifying a list of addresses (dmarc-like verified) that are (the only addresses) allowed to post to the list. if msgfrom is an external address, require a valid dkim signature to prevent dmarc-policy-related issues when delivering to remote members.
 // todo: add option to require messages sent to an alias have that alias as From or Reply-To address?
@@ -356,6 +545,13 @@ type MTASTS struct {
 	// todo: parse mx as valid mtasts.Policy.MX, with dns.ParseDomain but taking wildcard into account
 }
 
+// BIMI is the configuration for the BIMI DNS record of a domain.
+type BIMI struct {
+	Selector     string `sconf:"optional" sconf-doc:"Selector for the BIMI record, the record is published at <selector>._bimi.<domain>. Messages can specify a different selector than \"default\" with a BIMI-Selector header, signed with an aligned DKIM signature. Default \"default\"."`
+	LogoURL      string `sconf-doc:"HTTPS URL of the logo in SVG Tiny PS format, for the l= tag of the BIMI record."`
+	AuthorityURL string `sconf:"optional" sconf-doc:"HTTPS URL of a PEM file with a Verified Mark Certificate (VMC) or Common Mark Certificate (CMC) and its intermediate certificates, for the a= tag of the BIMI record. Some mail providers only show logos for domains with a mark certificate."`
+}
+
 type TLSRPT struct {
 	Localpart string `sconf-doc:"Address-part before the @ that accepts TLSRPT reports. Recommended value: tlsreports."`
 	Domain    string `sconf:"optional" sconf-doc:"Alternative domain for reporting address, for incoming reports. Typically empty, causing the domain wherein this config exists to be used. Can be used to receive reports for domains that aren't fully hosted on this server. Configure such a domain as a hosted domain without making all the DNS changes, and configure this field with a domain that is fully hosted on this server, so the localpart and the domain of this field form a reporting address. Then only update the TLSRPT DNS record for the not fully hosted domain, ensuring the reporting address is specified in its \"rua\" field as shown in the suggested DNS settings. Unicode name."`
@@ -410,14 +606,16 @@ type Route struct {
 // note: outgoing hook events are in ../queue/hooks.go, ../mox-/config.go, ../queue.go and ../webapi/gendoc.sh. keep in sync.
 
 type OutgoingWebhook struct {
-	URL           string   `sconf-doc:"URL to POST webhooks."`
-	Authorization string   `sconf:"optional" sconf-doc:"If not empty, value of Authorization header to add to HTTP requests."`
-	Events        []string `sconf:"optional" sconf-doc:"Events to send outgoing delivery notifications for. If absent, all events are sent. Valid values: delivered, suppressed, delayed, failed, relayed, expanded, canceled, unrecognized."`
+	URL             string   `sconf:"optional" sconf-doc:"URL to POST webhooks. Required unless EventStreamOnly is set."`
+	Authorization   string   `sconf:"optional" sconf-doc:"If not empty, value of Authorization header to add to HTTP requests."`
+	EventStreamOnly bool     `sconf:"optional" sconf-doc:"If set, webhooks are not POSTed to a URL, but only made available through the webapi event stream at /webapi/v0/events, and must be acknowledged by the client. URL must be empty."`
+	Events          []string `sconf:"optional" sconf-doc:"Events to send outgoing delivery notifications for. If absent, all events are sent. Valid values: delivered, suppressed, delayed, failed, relayed, expanded, canceled, unrecognized, limitreached."`
 }
 
 type IncomingWebhook struct {
-	URL           string `sconf-doc:"URL to POST webhooks to for incoming deliveries over SMTP."`
-	Authorization string `sconf:"optional" sconf-doc:"If not empty, value of Authorization header to add to HTTP requests."`
+	URL             string `sconf:"optional" sconf-doc:"URL to POST webhooks to for incoming deliveries over SMTP. Required unless EventStreamOnly is set."`
+	Authorization   string `sconf:"optional" sconf-doc:"If not empty, value of Authorization header to add to HTTP requests."`
+	EventStreamOnly bool   `sconf:"optional" sconf-doc:"If set, webhooks are not POSTed to a URL, but only made available through the webapi event stream at /webapi/v0/events, and must be acknowledged by the client. URL must be empty."`
 }
 
 type SubjectPass struct {
@@ -439,21 +637,24 @@ type Account struct {
 	KeepRetiredWebhookPeriod time.Duration    `sconf:"optional" sconf-doc:"Period to keep webhooks retired from the queue (delivered or failed) around. Useful for debugging. The time at which to clean up (remove) is calculated at retire time. E.g. 168h (1 week)."`
 
 	LoginDisabled                string                 `sconf:"optional" sconf-doc:"If non-empty, login attempts on all protocols (e.g. SMTP/IMAP, web interfaces) is rejected with this error message. Useful during migrations. Incoming deliveries for addresses of this account are still accepted as normal."`
+	RequireSecondFactor          bool                   `sconf:"optional" sconf-doc:"If set, logins to the webmail interface require a second factor (TOTP code or security key) in addition to the password. Logins to the account web interface remain possible without second factor until one has been configured, so one can be set up. Does not apply to IMAP, SMTP and the webapi, which can use app passwords."`
 	Domain                       string                 `sconf-doc:"Default domain for account. Deprecated behaviour: If a destination is not a full address but only a localpart, this domain is added to form a full address."`
 	Description                  string                 `sconf:"optional" sconf-doc:"Free form description, e.g. full name or alternative contact info."`
 	FullName                     string                 `sconf:"optional" sconf-doc:"Full name, to use in message From header when composing messages in webmail. Can be overridden per destination."`
 	Destinations                 map[string]Destination `sconf:"optional" sconf-doc:"Destinations, keys are email addresses (with IDNA domains). All destinations are allowed for logging in with IMAP/SMTP/webmail. If no destinations are configured, the account can not login. If the address is of the form '@domain', i.e. with localpart missing, it serves as a catchall for the domain, matching all messages that are not explicitly configured. Deprecated behaviour: If the address is not a full address but a localpart, it is combined with Domain to form a full address."`
 	SubjectPass                  SubjectPass            `sconf:"optional" sconf-doc:"If configured, messages classified as weakly spam are rejected with instructions to retry delivery, but this time with a signed token added to the subject. During the next delivery attempt, the signed token will bypass the spam filter. Messages with a clear spam signal, such as a known bad reputation, are rejected/delayed without a signed token."`
-	QuotaMessageSize             int64                  `sconf:"optional" sconf-doc:"Default maximum total message size in bytes for the account, overriding any globally configured default maximum size if non-zero. A negative value can be used to have no limit in case there is a limit by default. Attempting to add new messages to an account beyond its maximum total size will result in an error. Useful to prevent a single account from filling storage."`
+	QuotaMessageSize             int64                  `sconf:"optional" sconf-doc:"Default maximum total message size in bytes for the account, overriding any globally configured default maximum size if non-zero. A negative value can be used to have no limit in case there is a limit by default. Attempting to add new messages to an account beyond its maximum total size will result in an error. Calendar and contact objects also count towards the quota. Useful to prevent a single account from filling storage."`
 	RejectsMailbox               string                 `sconf:"optional" sconf-doc:"Mail that looks like spam will be rejected, but a copy can be stored temporarily in a mailbox, e.g. Rejects. If mail isn't coming in when you expect, you can look there. The mail still isn't accepted, so the remote mail server may retry (hopefully, if legitimate), or give up (hopefully, if indeed a spammer). Messages are automatically removed from this mailbox, so do not set it to a mailbox that has messages you want to keep."`
 	KeepRejects                  bool                   `sconf:"optional" sconf-doc:"Don't automatically delete mail in the RejectsMailbox listed above. This can be useful, e.g. for future spam training. It can also cause storage to fill up."`
 	AutomaticJunkFlags           AutomaticJunkFlags     `sconf:"optional" sconf-doc:"Automatically set $Junk and $NotJunk flags based on mailbox messages are delivered/moved/copied to. Email clients typically have too limited functionality to conveniently set these flags, especially $NonJunk, but they can all move messages to a different mailbox, so this helps them."`
 	JunkFilter                   *JunkFilter            `sconf:"optional" sconf-doc:"Content-based filtering, using the junk-status of individual messages to rank words in such messages as spam or ham. It is recommended you always set the applicable (non)-junk status on messages, and that you do not empty your Trash because those messages contain valuable ham/spam training information."` // todo: sane defaults for junkfilter
 	MaxOutgoingMessagesPerDay    int                    `sconf:"optional" sconf-doc:"Maximum number of outgoing messages for this account in a 24 hour window. This limits the damage to recipients and the reputation of this mail server in case of account compromise. Default 1000."`
 	MaxFirstTimeRecipientsPerDay int                    `sconf:"optional" sconf-doc:"Maximum number of first-time recipients in outgoing messages for this account in a 24 hour window. This limits the damage to recipients and the reputation of this mail server in case of account compromise. Default 200."`
+	SendLimits                   *SendLimits            `sconf:"optional" sconf-doc:"Limits on outgoing messages for this account, per hour, day and month, in addition to MaxOutgoingMessagesPerDay and MaxFirstTimeRecipientsPerDay, with a policy for when a limit is reached."`
 	NoFirstTimeSenderDelay       bool                   `sconf:"optional" sconf-doc:"Do not apply a delay to SMTP connections before accepting an incoming message from a first-time sender. Can be useful for accounts that sends automated responses and want instant replies."`
 	NoCustomPassword             bool                   `sconf:"optional" sconf-doc:"If set, this account cannot set a password of their own choice, but can only set a new randomly generated password, preventing password reuse across services and use of weak passwords. Custom account passwords can be set by the admin."`
 	IMAPCapabilitiesDisabled     []string               `sconf:"optional" sconf-doc:"IMAP capabilities (upper-case) to disable on the connection after authentication. Useful if the account uses an email client with an incompatible implementation for a capability/extension."`
+	AttachmentRules              []AttachmentRule       `sconf:"optional" sconf-doc:"Rules for attachments in incoming messages for this account, and in outgoing messages submitted by this account. Evaluated in addition to domain attachment rules. Useful to block dangerous attachments like executables, Office documents with macros and encrypted archives."`
 	// We will not work around client incompatibilities based on client software. ../rfc/2971:93
 
 	Routes []Route `sconf:"optional" sconf-doc:"Routes for delivering outgoing messages through the queue. Each delivery attempt evaluates these account routes, domain routes and finally global routes. The transport of the first matching route is used in the delivery attempt. If no routes match, which is the default with no configured routes, messages are delivered directly from the queue."`
@@ -569,7 +770,7 @@ type WebHandler struct {
 	WebStatic             *WebStatic   `sconf:"optional" sconf-doc:"Serve static files."`
 	WebRedirect           *WebRedirect `sconf:"optional" sconf-doc:"Redirect requests to configured URL."`
 	WebForward            *WebForward  `sconf:"optional" sconf-doc:"Forward requests to another webserver, i.e. reverse proxy."`
-	WebInternal           *WebInternal `sconf:"optional" sconf-doc:"Pass request to internal service, like webmail, webapi, etc."`
+	WebInternal           *WebInternal `sconf:"optional" sconf-doc:"Pass request to internal service, like webmail, webapi, dav, etc."`
 
 	Name      string         `sconf:"-"` // Either LogName, or numeric index if LogName was empty. Used instead of LogName in logging/metrics.
 	DNSDomain dns.Domain     `sconf:"-"`
@@ -653,7 +854,7 @@ func (wf WebForward) equal(o WebForward) bool {
 
 type WebInternal struct {
 	BasePath string `sconf-doc:"Path to use as root of internal service, e.g. /webmail/."`
-	Service  string `sconf-doc:"Name of the service, values: admin, account, webmail, webapi."`
+	Service  string `sconf-doc:"Name of the service, values: admin, account, webmail, webapi, dav."`
 
 	Handler http.Handler `sconf:"-" json:"-"`
 }
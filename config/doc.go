@@ -61,6 +61,23 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 	# (optional)
 	User:
 
+	# If set, unauthenticated IMAP connections are handled by a separate process
+	# running as this user, instead of by the main mox process. The user should not
+	# have access to the config and data directories. The separate process accepts
+	# IMAP connections and passes them to the main process, which does the TLS
+	# handshake and relays the data to the separate process. The separate process
+	# handles IMAP commands until authentication, and asks the main process over a
+	# local socket to verify credentials, so it does not need access to private keys
+	# or accounts. After successful authentication, the main process serves the
+	# connection itself, data of authenticated sessions does not pass through the
+	# separate process. Only IMAP is separated: SMTP, HTTP and the other protocols,
+	# and message delivery, are still handled by the main process, separating those is
+	# not yet implemented. The process runs with the group of User, for access to the
+	# mox binary. TLS client certificate authentication is not available for IMAP when
+	# set. If the value is not a known user, it is parsed as integer and used as uid.
+	# (optional)
+	PreauthUser:
+
 	# If true, do not automatically fix file permissions when starting up. By default,
 	# mox will ensure reasonable owner/permissions on the working, data and config
 	# directories (and files), and mox binary (if present). (optional)
@@ -93,6 +110,34 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 			CertFiles:
 				-
 
+	# Use a built-in recursive DNS resolver with DNSSEC validation for DNS lookups,
+	# instead of the system resolver from /etc/resolv.conf. Lookups are done directly
+	# with the authoritative name servers, starting at the root name servers. DNSSEC
+	# results are used for DANE, MTA-STS and other checks that need authentic DNS
+	# responses. Without this option, the system resolver must be a DNSSEC-validating
+	# resolver (e.g. unbound) that sets the authentic data (AD) bit, and it must be
+	# trusted, e.g. by running on the same machine. (optional)
+	RecursiveResolver:
+
+		# Whether to use the built-in recursive resolver.
+		Enabled: false
+
+		# DNSSEC trust anchors for the root zone, as DS or DNSKEY records in DNS
+		# presentation format, e.g. ". IN DS 20326 8 2
+		# E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D". If absent,
+		# the current root zone key signing keys published by IANA are used. (optional)
+		TrustAnchors:
+			-
+
+		# Do not automatically update trust anchors. By default, new root zone key signing
+		# keys are trusted after they have been signed by a trusted key for 30 days, and
+		# keys are no longer trusted when they are revoked, according to RFC 5011. The
+		# state is kept in the data directory, in dnssec-trust-anchors.json. (optional)
+		NoTrustAnchorUpdates: false
+
+		# Maximum number of cached responses and NSEC records. Default 10000. (optional)
+		CacheSize: 0
+
 	# Automatic TLS configuration with ACME, e.g. through Let's Encrypt. The key is a
 	# name referenced in TLS configs, e.g. letsencrypt. (optional)
 	ACME:
@@ -145,6 +190,11 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 	# pages (if enabled). (optional)
 	AdminPasswordFile:
 
+	# File containing a TOTP secret, as second factor for authentication in the web
+	# admin pages, in addition to the admin password. Set with "mox setadmintotp".
+	# (optional)
+	AdminTOTPFile:
+
 	# Listeners are groups of IP addresses and services enabled on those IP addresses,
 	# such as SMTP/IMAP or internal endpoints for administration or Prometheus
 	# metrics. All listeners with SMTP/IMAP services enabled will serve all configured
@@ -263,10 +313,85 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 				DNSBLs:
 					-
 
+				# Addresses of domain-based DNS block lists (URIBLs/DBLs) to check the domains of
+				# links in incoming messages against. Like DNSBLs, they are only consulted for
+				# messages without enough reputation to make an accept/reject decision. Domains
+				# are extracted from URLs in text and HTML parts. Both the host names and their
+				# organizational domains are looked up. Domains of this mail server are not looked
+				# up. Results are cached for an hour. If a domain is listed, the junk filter is
+				# applied with a stricter threshold, or the message is rejected if URIBLReject is
+				# set. The URIBLs are checked for healthiness before use, at most once per 4
+				# hours. Example: dbl.spamhaus.org. See https://www.spamhaus.org/dbl/ for more
+				# information and terms of use. (optional)
+				URIBLs:
+					-
+
+				# Reject messages with a link to a domain listed in a URIBL, like for DNSBL
+				# listings, instead of only applying a stricter junk filter threshold. (optional)
+				URIBLReject: false
+
+				# Maximum number of domains to look up per URIBL for a message. Domains are looked
+				# up in order of appearance in the message. Default 20. (optional)
+				URIBLMaxLookups: 0
+
+				# Local IP and domain lists in files, used as block or allow lists for incoming
+				# messages, checked in the same place as DNSBLs. Lists are reloaded when their
+				# file changes. Lists with a Zone can also be served over DNS by listeners with
+				# DNSLists enabled. (optional)
+				LocalLists:
+					-
+
+						# File with the list, relative to the directory of mox.conf. Each line has an IP
+						# address, a CIDR network (e.g. 192.0.2.0/24 or 2001:db8::/32) or a domain,
+						# optionally followed by whitespace and a text for the entry. A domain matches
+						# only itself, ".example.com" matches the domain and its subdomains, and
+						# "*.example.com" only its subdomains. Entries starting with "!" exclude IPs or
+						# domains from a less specific matching entry. A line ":127.0.0.2:text" sets the
+						# address returned over DNS and the text for entries without text. In texts, "$"
+						# is replaced with the IP or domain. Empty lines and lines starting with "#" are
+						# ignored.
+						File:
+
+						# If set, the list is an allowlist: messages from listed IPs, or with a listed
+						# verified domain (SPF-verified MAIL FROM, DKIM-signature, DMARC-verified message
+						# From, or verified EHLO), are accepted without reputation, DNSBL and junk content
+						# checks. Otherwise the list is a blocklist: messages from listed IPs, or with a
+						# listed EHLO, MAIL FROM, DKIM or message From domain, are rejected, like for
+						# DNSBL listings. (optional)
+						Allow: false
+
+						# DNS zone to serve the list under by listeners with DNSLists enabled, e.g.
+						# bl.example.internal. IPs are queried as for DNSBLs, e.g.
+						# 1.2.0.192.bl.example.internal for 192.0.2.1, and domains like
+						# example.com.bl.example.internal. If empty, the list is not served. (optional)
+						Zone:
+
 				# Delay before accepting a message from a first-time sender for the destination
 				# account. Default: 15s. (optional)
 				FirstTimeSenderDelay: 0s
 
+				# Greylisting of incoming deliveries from senders without reputation. The first
+				# delivery attempt for a combination of remote IP network, MAIL FROM and RCPT TO
+				# address is temporarily rejected, a retry after a delay is accepted. Messages
+				# from senders with a good reputation at the destination account are not
+				# greylisted. (optional)
+				Greylisting:
+					Enabled: false
+
+					# Minimum time after a first delivery attempt before a retry is accepted. Default
+					# 5m. (optional)
+					Delay: 0s
+
+					# Time after a first delivery attempt within which a retry is accepted. A later
+					# retry is treated as a first attempt. Default 24h. (optional)
+					RetryWindow: 0s
+
+					# After a successful retry, the remote IP network (IPv4 /24 or IPv6 /64), or the
+					# SPF-verified MAIL FROM domain, is allowlisted, as are the DKIM- and SPF-verified
+					# domains of the message. Allowlisting is extended on each delivery, and expires
+					# after this period without deliveries. Default 840h (35 days). (optional)
+					AllowDuration: 0s
+
 				# Override default setting for enabling TLS session tickets. Disabling session
 				# tickets may work around TLS interoperability issues. (optional)
 				TLSSessionTicketsDisabled: false
@@ -466,6 +591,42 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 				# limiting and for the "secure" status of cookies. (optional)
 				Forwarded: false
 
+			# Like DAVHTTPS, but with plain HTTP, without TLS. (optional)
+			DAVHTTP:
+				Enabled: false
+
+				# Default 80 for HTTP and 443 for HTTPS. See Hostname at Listener for hostname
+				# matching behaviour. (optional)
+				Port: 0
+
+				# Path to serve requests on. Should end with a slash, related to cookie paths.
+				# (optional)
+				Path:
+
+				# If set, X-Forwarded-* headers are used for the remote IP address for rate
+				# limiting and for the "secure" status of cookies. (optional)
+				Forwarded: false
+
+			# CalDAV and CardDAV, for calendars and address books of accounts, with HTTPS
+			# (requires a TLS config). Clients authenticate with an email address and the
+			# account password, or an app password for protocol dav. Default path is /dav/.
+			# Requests for /.well-known/caldav and /.well-known/carddav are redirected to this
+			# path. (optional)
+			DAVHTTPS:
+				Enabled: false
+
+				# Default 80 for HTTP and 443 for HTTPS. See Hostname at Listener for hostname
+				# matching behaviour. (optional)
+				Port: 0
+
+				# Path to serve requests on. Should end with a slash, related to cookie paths.
+				# (optional)
+				Path:
+
+				# If set, X-Forwarded-* headers are used for the remote IP address for rate
+				# limiting and for the "secure" status of cookies. (optional)
+				Forwarded: false
+
 			# Serve prometheus metrics, for monitoring. You should not enable this on a public
 			# IP. (optional)
 			MetricsHTTP:
@@ -527,7 +688,8 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 				# Port for plain HTTP (non-TLS) webserver. (optional)
 				Port: 0
 
-				# Disable rate limiting for all requests to this port. (optional)
+				# Disable rate limiting, and refusing requests from banned IPs, for all requests
+				# to this port. (optional)
 				RateLimitDisabled: false
 
 			# All configured WebHandlers will serve on an enabled listener. Either ACME must
@@ -539,9 +701,192 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 				# Port for HTTPS webserver. (optional)
 				Port: 0
 
-				# Disable rate limiting for all requests to this port. (optional)
+				# Disable rate limiting, and refusing requests from banned IPs, for all requests
+				# to this port. (optional)
 				RateLimitDisabled: false
 
+			# Serve the LocalLists with a Zone, of all SMTP listeners, over DNS on UDP and
+			# TCP, for use as DNS block or allow lists by other mail servers. Listed IPs and
+			# domains have an A record (127.0.0.2 by default) and a TXT record with the text
+			# for the entry. For DNSBL health checks, 127.0.0.2 is always listed. You should
+			# not enable this on a public IP. (optional)
+			DNSLists:
+				Enabled: false
+
+				# Default 53. (optional)
+				Port: 0
+
+				# IPs and networks (in CIDR notation) of clients allowed to query the lists, e.g.
+				# the other mail servers. Queries from other IPs are ignored. Required when
+				# enabled, mox refuses to start if empty. (optional)
+				AllowedNetworks:
+					-
+
+			# Limits on connections to this listener, per protocol. Limits apply to the remote
+			# IP, and to the networks it is in: /26 and /21 for IPv4, /48 and /32 for IPv6,
+			# where a single IPv6 "IP" is its /64. Protocols without configured limits share
+			# the default limits with the same protocol on other listeners. Counts for
+			# connection rates are kept across restarts. (optional)
+			RateLimits:
+
+				# For SMTP, for incoming deliveries. Default rate per minute: 300 for an IP, 900
+				# and 2700 for its networks. Default open connections: 30, 90 and 270. (optional)
+				SMTP:
+
+					# Limits on new connections in time windows. If empty, the default is used.
+					# (optional)
+					Rate:
+						-
+
+							# Duration of the time window, e.g. 1m or 24h. Counts reset at the start of each
+							# window. Required for rate limits. (optional)
+							Window: 0s
+
+							# Limit for a single IP, or an IPv6 /64 network.
+							IP: 0
+
+							# Limit for the IPv4 /26 or IPv6 /48 network.
+							Subnet: 0
+
+							# Limit for the IPv4 /21 or IPv6 /32 network.
+							Network: 0
+
+					# Limit on open connections. Window must not be set. If absent, the default is
+					# used. (optional)
+					Open:
+
+						# Duration of the time window, e.g. 1m or 24h. Counts reset at the start of each
+						# window. Required for rate limits. (optional)
+						Window: 0s
+
+						# Limit for a single IP, or an IPv6 /64 network.
+						IP: 0
+
+						# Limit for the IPv4 /26 or IPv6 /48 network.
+						Subnet: 0
+
+						# Limit for the IPv4 /21 or IPv6 /32 network.
+						Network: 0
+
+				# For Submission and Submissions, including submission over HTTPS. Defaults are
+				# the same as for SMTP, but counted separately. (optional)
+				Submission:
+
+					# Limits on new connections in time windows. If empty, the default is used.
+					# (optional)
+					Rate:
+						-
+
+							# Duration of the time window, e.g. 1m or 24h. Counts reset at the start of each
+							# window. Required for rate limits. (optional)
+							Window: 0s
+
+							# Limit for a single IP, or an IPv6 /64 network.
+							IP: 0
+
+							# Limit for the IPv4 /26 or IPv6 /48 network.
+							Subnet: 0
+
+							# Limit for the IPv4 /21 or IPv6 /32 network.
+							Network: 0
+
+					# Limit on open connections. Window must not be set. If absent, the default is
+					# used. (optional)
+					Open:
+
+						# Duration of the time window, e.g. 1m or 24h. Counts reset at the start of each
+						# window. Required for rate limits. (optional)
+						Window: 0s
+
+						# Limit for a single IP, or an IPv6 /64 network.
+						IP: 0
+
+						# Limit for the IPv4 /26 or IPv6 /48 network.
+						Subnet: 0
+
+						# Limit for the IPv4 /21 or IPv6 /32 network.
+						Network: 0
+
+				# For IMAP and IMAPS, including IMAP over HTTPS. Defaults are the same as for
+				# SMTP. (optional)
+				IMAP:
+
+					# Limits on new connections in time windows. If empty, the default is used.
+					# (optional)
+					Rate:
+						-
+
+							# Duration of the time window, e.g. 1m or 24h. Counts reset at the start of each
+							# window. Required for rate limits. (optional)
+							Window: 0s
+
+							# Limit for a single IP, or an IPv6 /64 network.
+							IP: 0
+
+							# Limit for the IPv4 /26 or IPv6 /48 network.
+							Subnet: 0
+
+							# Limit for the IPv4 /21 or IPv6 /32 network.
+							Network: 0
+
+					# Limit on open connections. Window must not be set. If absent, the default is
+					# used. (optional)
+					Open:
+
+						# Duration of the time window, e.g. 1m or 24h. Counts reset at the start of each
+						# window. Required for rate limits. (optional)
+						Window: 0s
+
+						# Limit for a single IP, or an IPv6 /64 network.
+						IP: 0
+
+						# Limit for the IPv4 /26 or IPv6 /48 network.
+						Subnet: 0
+
+						# Limit for the IPv4 /21 or IPv6 /32 network.
+						Network: 0
+
+				# For HTTP and HTTPS. For HTTP, rate limits apply to requests instead of
+				# connections, and Open is not used. Default rate per minute 1000 for an IP, 3000
+				# and 9000 for its networks, and per hour 5000, 15000 and 45000. Ports with
+				# RateLimitDisabled are not limited. (optional)
+				HTTP:
+
+					# Limits on new connections in time windows. If empty, the default is used.
+					# (optional)
+					Rate:
+						-
+
+							# Duration of the time window, e.g. 1m or 24h. Counts reset at the start of each
+							# window. Required for rate limits. (optional)
+							Window: 0s
+
+							# Limit for a single IP, or an IPv6 /64 network.
+							IP: 0
+
+							# Limit for the IPv4 /26 or IPv6 /48 network.
+							Subnet: 0
+
+							# Limit for the IPv4 /21 or IPv6 /32 network.
+							Network: 0
+
+					# Limit on open connections. Window must not be set. If absent, the default is
+					# used. (optional)
+					Open:
+
+						# Duration of the time window, e.g. 1m or 24h. Counts reset at the start of each
+						# window. Required for rate limits. (optional)
+						Window: 0s
+
+						# Limit for a single IP, or an IPv6 /64 network.
+						IP: 0
+
+						# Limit for the IPv4 /26 or IPv6 /48 network.
+						Subnet: 0
+
+						# Limit for the IPv4 /21 or IPv6 /32 network.
+						Network: 0
+
 	# Destination for emails delivered to postmaster addresses: a plain 'postmaster'
 	# without domain, 'postmaster@<hostname>' (also for each listener with SMTP
 	# enabled), and as fallback for each domain without explicitly configured
@@ -744,6 +1089,12 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 				# remote SMTP servers. (optional)
 				DisableIPv6: false
 
+				# Name of IP pool, see IPPools, to select the local IP and EHLO hostname for
+				# outgoing connections from. If the pool has no IPs of an address family, remote
+				# SMTP servers are not connected to over that address family. If empty, the IPs of
+				# SMTP listeners are used. (optional)
+				IPPool:
+
 			# Immediately fails the delivery attempt. (optional)
 			Fail:
 
@@ -754,6 +1105,99 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 				# Message to include for the rejection. It will be shown in the DSN. (optional)
 				SMTPMessage:
 
+	# IP pools are named sets of local IPs to make outgoing SMTP connections from,
+	# each IP with its own hostname for SMTP EHLO. A pool is used for deliveries
+	# through a Direct transport that references it, and routes select the transport,
+	# e.g. one transport with a pool for transactional messages and another for bulk
+	# messages. Each IP should have a reverse DNS (PTR) record with its hostname, and
+	# be included in the SPF records of sending domains. IPs that the DNSBL monitor
+	# finds listed (see MonitorDNSBLs in domains.conf and DNSBLs for SMTP listeners)
+	# are not used while listed, unless all IPs of an address family in a pool are
+	# listed. (optional)
+	IPPools:
+		x:
+
+			# IPs in the pool.
+			IPs:
+				-
+
+					# IP address to connect from, must be configured on a network interface of this
+					# machine.
+					IP:
+
+					# Hostname for SMTP EHLO for connections from this IP. Should be the name in the
+					# reverse DNS (PTR) record for the IP. If empty, the hostname of this mox instance
+					# is used. (optional)
+					Hostname:
+
+					# Date, in form 2006-01-02, on which the IP started sending. The Warmup schedule
+					# of the pool applies to the IP from this date. If empty, the IP is considered
+					# warmed up and has no daily limit. (optional)
+					WarmupStart:
+
+			# How an IP is selected for a connection: "roundrobin" (default) uses each next IP
+			# in turn, "sticky" always uses the same IP for a recipient domain (while usable),
+			# based on a hash of the domain name, for consistent reputation with a destination
+			# and for greylisting. (optional)
+			Selection:
+
+			# Warm-up schedule for new IPs, see WarmupStart of the IPs. Each value is the
+			# maximum number of messages to deliver from an IP per day (UTC), for each day
+			# since its warm-up started, e.g. 50, 100, 250, 500, 1000, 2500, 5000, 10000.
+			# After the last day, the IP has no daily limit. IPs that reached their limit for
+			# the day are not used. If all IPs in the pool reached their limit, delivery
+			# attempts through the pool are postponed until the next day, without counting as
+			# an attempt. (optional)
+			Warmup:
+				- 0
+
+	# Limits on deliveries from the queue to destinations, e.g. large mail providers
+	# that defer or block deliveries sent at high rates from IPs without reputation.
+	# Key is a name for the throttle, used in metrics and the admin web interface.
+	# Deliveries to a single recipient domain are never concurrent, regardless of
+	# throttles. Independent of throttles, when a remote SMTP server responds with a
+	# temporary error that looks like rate limiting (e.g. code 421, or a 4xx response
+	# mentioning rates or too many messages), no new deliveries are attempted to its
+	# throttle, or recipient domain if no throttle matches, for a period starting at 1
+	# minute, doubling for each next rate limiting response up to 1 hour, and reset by
+	# a successful delivery. (optional)
+	DestinationThrottles:
+		x:
+
+			# Recipient domains the throttle applies to. A domain starting with a dot, e.g.
+			# .example.com, matches its subdomains. (optional)
+			Domains:
+				-
+
+			# MX hosts of recipient domains the throttle applies to, e.g. .google.com for
+			# domains hosted by Google. A host starting with a dot matches its subdomains. The
+			# MX records of a recipient domain are looked up during delivery attempts, so the
+			# throttle applies to a recipient domain from its second delivery attempt after
+			# startup. (optional)
+			MXHosts:
+				-
+
+			# Maximum number of concurrent deliveries to recipient domains of the throttle.
+			# Zero means no limit. (optional)
+			MaxConcurrent: 0
+
+			# Maximum number of messages (recipients) to deliver to recipient domains of the
+			# throttle per minute. Zero means no limit. (optional)
+			MessagesPerMinute: 0
+
+			# Maximum number of messages (recipients) to deliver to recipient domains of the
+			# throttle per hour. Zero means no limit. (optional)
+			MessagesPerHour: 0
+
+	# Use DMARCbis instead of RFC 7489 for DMARC evaluation of incoming messages. The
+	# DMARC record is found with a DNS tree walk from the From-domain up to the
+	# top-level domain, instead of looking at the From-domain and its organizational
+	# domain from the public suffix list. Organizational domains for relaxed alignment
+	# are determined from the psd= tags of DMARC records found in a DNS tree walk. The
+	# np= tag is applied for non-existent subdomains, a record with t=y (testing) is
+	# not applied, and pct= is ignored. (optional)
+	DMARCbis: false
+
 	# Do not send DMARC reports (aggregate only). By default, aggregate reports on
 	# DMARC evaluations are sent to domains if their DMARC policy requests them.
 	# Reports are sent at whole hours, with a minimum of 1 hour and maximum of 24
@@ -776,15 +1220,159 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 	# (optional)
 	OutgoingTLSReportsForAllSuccess: false
 
+	# Send DMARC failure reports (also called forensic reports) in AFRF format about
+	# incoming messages that fail DMARC, to domains that request them with ruf= in
+	# their DMARC record. Which failures are reported is determined by the fo= option
+	# of the DMARC record. Failure reports contain (parts of) messages, so they are
+	# only sent for explicitly configured domains. Reports are sent from the
+	# postmaster@<mailhostname> address, DKIM-signed if possible. Reporting addresses
+	# in another organizational domain must opt in with a DNS record, as for aggregate
+	# reports. Reporting addresses on the DMARC reporting suppression list do not
+	# receive failure reports. (optional)
+	DMARCFailureReports:
+
+		# Domains of message From headers to send failure reports for, typically partner
+		# domains that asked for them. Subdomains of listed domains are included.
+		Domains:
+			-
+
+		# Maximum number of failure reports to send per hour to the domain of a reporting
+		# address, regardless of the DMARC policy domain the failures are for. Failures
+		# beyond the limit are not reported to that domain. Default 10. (optional)
+		MaxPerHour: 0
+
+		# Include the full message in reports instead of only its header. Messages larger
+		# than 256KiB are always reported with only their header. (optional)
+		IncludeBody: false
+
+		# Header fields to leave out of the message in reports, e.g. Received to hide
+		# details about the infrastructure of the recipient. Case-insensitive. (optional)
+		RedactHeaders:
+			-
+
+		# Replace localparts of email addresses in the message header and the envelope
+		# fields of reports with "redacted", as described in RFC 6590. Domains of
+		# addresses remain visible. Addresses in a message body included in a report are
+		# not redacted. (optional)
+		RedactAddresses: false
+
+	# Verify BIMI (Brand Indicators for Message Identification) for incoming messages,
+	# and show the logo of the sender domain in the message list of the webmail
+	# interface. BIMI is only evaluated for messages that pass DMARC with a quarantine
+	# or reject policy. Logos and certificates are fetched over HTTPS from locations
+	# in the DNS records of sender domains at delivery time. Delivery waits at most 5
+	# seconds, slower fetches complete in the background and are used for later
+	# messages from the domain. (optional)
+	IncomingBIMI:
+
+		# Whether to verify BIMI for incoming messages.
+		Enabled: false
+
+		# Only accept logos from domains that reference a Verified Mark Certificate (VMC)
+		# or Common Mark Certificate (CMC). Mark certificates are issued under their own
+		# root certificates, not the system roots. Without this option, logos referenced
+		# without certificate are used as well. (optional)
+		RequireCertificate: false
+
+	# Scan incoming and submitted messages for viruses and other malware with an
+	# external scanner, e.g. ClamAV's clamd, or an ICAP server. Clean messages get an
+	# X-Mox-Content-Scan header with the result. (optional)
+	ContentScanner:
+
+		# Protocol to talk to the scanner: clamd for the INSTREAM command of ClamAV's
+		# clamd, or icap for an ICAP server (RFC 3507) with RESPMOD.
+		Protocol:
+
+		# For clamd, host:port for a TCP connection, e.g. localhost:3310, or the path to a
+		# unix domain socket, e.g. /run/clamav/clamd.ctl. For icap, a URL with host,
+		# optional port (default 1344) and service, e.g. icap://localhost:1344/avscan.
+		Address:
+
+		# Timeout for scanning a message, including connecting. Default 30s. (optional)
+		Timeout: 0s
+
+		# Messages larger than this size in bytes are not scanned. With FailOpen, they are
+		# accepted without scan result. By default (fail-closed), they are rejected with a
+		# permanent error. Default 25MB. Scanners typically have their own limit, e.g.
+		# StreamMaxLength in clamd.conf, which should not be smaller. (optional)
+		MaxSize: 0
+
+		# If the scanner cannot be reached, or returns an error, or the message is larger
+		# than MaxSize, accept the message without scan result. By default (fail-closed),
+		# the message is rejected with a temporary error, and the sender will retry later.
+		# (optional)
+		FailOpen: false
+
+		# For incoming deliveries, store infected messages in the Rejects mailbox of the
+		# recipient accounts, instead of only rejecting them. The SMTP transaction is
+		# rejected in both cases. Infected messages from submission are always rejected.
+		# (optional)
+		Quarantine: false
+
 	# Default maximum total message size in bytes for each individual account, only
 	# applicable if greater than zero. Can be overridden per account. Attempting to
 	# add new messages to an account beyond its maximum total size will result in an
-	# error. Useful to prevent a single account from filling storage. The quota only
-	# applies to the email message files, not to any file system overhead and also not
-	# the message index database file (account for approximately 15% overhead).
-	# (optional)
+	# error. Useful to prevent a single account from filling storage. Calendar and
+	# contact objects also count towards the quota. The quota only applies to the
+	# email message files and calendar and contact data, not to any file system
+	# overhead and also not the message index database file (account for approximately
+	# 15% overhead). (optional)
 	QuotaMessageSize: 0
 
+	# Limits on failed authentication attempts from an IP and its networks, for all
+	# protocols and listeners. While a limit is reached, connections for
+	# authentication are refused. If empty, the defaults are used: per minute 10 for
+	# an IP, 30 for its network and 90 for its larger network, and per day 50, 150 and
+	# 450. Counts are kept across restarts. (optional)
+	FailedAuthRateLimits:
+		-
+
+			# Duration of the time window, e.g. 1m or 24h. Counts reset at the start of each
+			# window. Required for rate limits. (optional)
+			Window: 0s
+
+			# Limit for a single IP, or an IPv6 /64 network.
+			IP: 0
+
+			# Limit for the IPv4 /26 or IPv6 /48 network.
+			Subnet: 0
+
+			# Limit for the IPv4 /21 or IPv6 /32 network.
+			Network: 0
+
+	# IP addresses and networks in CIDR notation, e.g. 192.0.2.10 or 2001:db8::/64,
+	# that are never rate limited, for connections and for failed authentication
+	# attempts. For example for monitoring hosts. (optional)
+	RateLimitAllowlist:
+		-
+
+	# Automatic temporary bans of IPs after repeated failed authentication attempts.
+	# Banned IPs are refused at connection time on all listeners, and for HTTP on each
+	# request, except on web server ports with RateLimitDisabled. Bans can also be
+	# added manually, and IPs can be allowlisted against bans, through the admin web
+	# interface and the mox ipban subcommands. IPs in RateLimitAllowlist are never
+	# banned either. (optional)
+	IPBans:
+
+		# Don't ban IPs automatically. Bans added manually are still enforced. (optional)
+		Disabled: false
+
+		# Number of failed authentication attempts from an IP, or IPv6 /64 network, within
+		# Window, for all protocols combined, after which the IP is banned. Default 20.
+		# (optional)
+		Failures: 0
+
+		# Time window for counting failed authentication attempts. Default 1h. (optional)
+		Window: 0s
+
+		# Duration of the first automatic ban for an IP. Each next ban, within 30 days
+		# after the previous ban expired, lasts twice as long as the previous, up to
+		# MaxDuration. Default 1h. (optional)
+		Duration: 0s
+
+		# Maximum duration of an automatic ban. Default 720h, 30 days. (optional)
+		MaxDuration: 0s
+
 # domains.conf
 
 	# NOTE: This config file is in 'sconf' format. Indent with tabs. Comments must be
@@ -981,6 +1569,28 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 				# Mailbox to deliver to, e.g. TLSRPT.
 				Mailbox:
 
+			# With BIMI (Brand Indicators for Message Identification), a domain publishes a
+			# logo in DNS, which mail clients can show with messages that pass DMARC. The logo
+			# is only used if the DMARC policy of the domain is quarantine or reject. The DNS
+			# records page in the admin web interface includes the BIMI record, and the domain
+			# check verifies it. (optional)
+			BIMI:
+
+				# Selector for the BIMI record, the record is published at
+				# <selector>._bimi.<domain>. Messages can specify a different selector than
+				# "default" with a BIMI-Selector header, signed with an aligned DKIM signature.
+				# Default "default". (optional)
+				Selector:
+
+				# HTTPS URL of the logo in SVG Tiny PS format, for the l= tag of the BIMI record.
+				LogoURL:
+
+				# HTTPS URL of a PEM file with a Verified Mark Certificate (VMC) or Common Mark
+				# Certificate (CMC) and its intermediate certificates, for the a= tag of the BIMI
+				# record. Some mail providers only show logos for domains with a mark certificate.
+				# (optional)
+				AuthorityURL:
+
 			# Routes for delivering outgoing messages through the queue. Each delivery attempt
 			# evaluates account routes, these domain routes and finally global routes. The
 			# transport of the first matching route is used in the delivery attempt. If no
@@ -1005,6 +1615,87 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 					MinimumAttempts: 0
 					Transport:
 
+			# Limits on outgoing messages with a message From address in this domain, for all
+			# accounts combined, per hour, day and month, with a policy for when a limit is
+			# reached. Account limits apply as well. (optional)
+			SendLimits:
+
+				# Limits for all outgoing messages. Hourly limits apply to the current hour, daily
+				# limits to the past 24 hours in whole hours, and monthly limits to the past 30
+				# days in whole days (UTC). (optional)
+				All:
+
+					# (optional)
+					MessagesPerHour: 0
+
+					# (optional)
+					MessagesPerDay: 0
+
+					# (optional)
+					MessagesPerMonth: 0
+
+					# (optional)
+					RecipientsPerHour: 0
+
+					# (optional)
+					RecipientsPerDay: 0
+
+					# (optional)
+					RecipientsPerMonth: 0
+
+				# Limits for messages submitted over SMTP and through webmail. (optional)
+				Submission:
+
+					# (optional)
+					MessagesPerHour: 0
+
+					# (optional)
+					MessagesPerDay: 0
+
+					# (optional)
+					MessagesPerMonth: 0
+
+					# (optional)
+					RecipientsPerHour: 0
+
+					# (optional)
+					RecipientsPerDay: 0
+
+					# (optional)
+					RecipientsPerMonth: 0
+
+				# Limits for messages submitted through the webapi. (optional)
+				WebAPI:
+
+					# (optional)
+					MessagesPerHour: 0
+
+					# (optional)
+					MessagesPerDay: 0
+
+					# (optional)
+					MessagesPerMonth: 0
+
+					# (optional)
+					RecipientsPerHour: 0
+
+					# (optional)
+					RecipientsPerDay: 0
+
+					# (optional)
+					RecipientsPerMonth: 0
+
+				# What to do when sending a message would exceed a limit: "reject" (default)
+				# refuses the message, for SMTP with a temporary error for hourly limits and a
+				# permanent error for daily and monthly limits, "hold" accepts the message but
+				# adds a hold rule to the queue for the account or domain, so this and later
+				# messages are not delivered until the admin removes the hold rule and releases
+				# the messages, "notify" accepts and delivers the message. For "hold" and
+				# "notify", the postmaster is sent a message about the limit. For all policies, an
+				# outgoing webhook with event "limitreached" is sent, if configured for the
+				# account. Notifications are sent at most once per limit per period. (optional)
+				Policy:
+
 			# Aliases that cause messages to be delivered to one or more locally configured
 			# addresses. Keys are localparts (encoded, as they appear in email addresses).
 			# (optional)
@@ -1030,6 +1721,62 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 					# message From header. (optional)
 					AllowMsgFrom: false
 
+			# Rules for attachments in incoming messages for this domain, and in outgoing
+			# messages with a message From address in this domain. Evaluated in addition to
+			# account attachment rules. (optional)
+			AttachmentRules:
+				-
+
+					# Apply rule to "incoming" or "outgoing" messages only. If empty, the rule applies
+					# to both. Incoming messages are deliveries over SMTP to the domain or account,
+					# outgoing messages are submitted over SMTP by the account or with a message From
+					# address in the domain. (optional)
+					Direction:
+
+					# Content types (lower-case) to match, with optional wildcards in the style of
+					# shell file name patterns, e.g. "application/x-msdownload" or
+					# "application/vnd.ms-*.macroenabled.*". Both the content type declared in the
+					# message and the content type detected from the data are matched. Detected types
+					# include application/x-msdownload for Windows executables,
+					# application/x-executable for ELF executables, application/zip,
+					# application/x-rar-compressed, application/x-7z-compressed,
+					# application/x-ole-storage for legacy Office documents, and
+					# application/vnd.ms-word.document.macroenabled.12 (and similar for excel and
+					# powerpoint) for Office documents containing macros. (optional)
+					ContentTypes:
+						-
+
+					# File name extensions (lower-case, with leading dot), e.g. ".exe". Matched
+					# against the file name of the part and against names of files inside zip
+					# archives. (optional)
+					Extensions:
+						-
+
+					# If set, match zip archives containing encrypted (password-protected) files.
+					# (optional)
+					EncryptedArchive: false
+
+					# If set, match archives of which the files cannot be listed, so Extensions cannot
+					# be matched: rar and 7z archives, and zip archives that are too large (over 32MB)
+					# or malformed. (optional)
+					UninspectableArchive: false
+
+					# If non-zero, only match parts with a decoded size of at least this many bytes.
+					# If no content types, extensions, encrypted or uninspectable archive match is
+					# configured, all attachments of at least this size match, e.g. to block large
+					# attachments. Attachments are parts with a Content-Disposition of "attachment" or
+					# with a file name, so message text is not matched. (optional)
+					MinSize: 0
+
+					# What to do with a message with a matching part: "reject" refuses the message
+					# with a permanent error, "strip" replaces the part with a text part explaining it
+					# was removed, "quarantine" refuses incoming messages but stores a copy in the
+					# rejects mailbox of the account (if configured), and refuses outgoing messages.
+					# If a message has parts matching multiple rules, reject has precedence over
+					# quarantine, which has precedence over strip. Messages that consist of only a
+					# matching part are rejected instead of stripped.
+					Action:
+
 	# Accounts represent mox users, each with a password and email address(es) to
 	# which email can be delivered (possibly at different domains). Each account has
 	# its own on-disk directory holding its messages and index database. An account
@@ -1040,27 +1787,38 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 			# Webhooks for events about outgoing deliveries. (optional)
 			OutgoingWebhook:
 
-				# URL to POST webhooks.
+				# URL to POST webhooks. Required unless EventStreamOnly is set. (optional)
 				URL:
 
 				# If not empty, value of Authorization header to add to HTTP requests. (optional)
 				Authorization:
 
+				# If set, webhooks are not POSTed to a URL, but only made available through the
+				# webapi event stream at /webapi/v0/events, and must be acknowledged by the
+				# client. URL must be empty. (optional)
+				EventStreamOnly: false
+
 				# Events to send outgoing delivery notifications for. If absent, all events are
 				# sent. Valid values: delivered, suppressed, delayed, failed, relayed, expanded,
-				# canceled, unrecognized. (optional)
+				# canceled, unrecognized, limitreached. (optional)
 				Events:
 					-
 
 			# Webhooks for events about incoming deliveries over SMTP. (optional)
 			IncomingWebhook:
 
-				# URL to POST webhooks to for incoming deliveries over SMTP.
+				# URL to POST webhooks to for incoming deliveries over SMTP. Required unless
+				# EventStreamOnly is set. (optional)
 				URL:
 
 				# If not empty, value of Authorization header to add to HTTP requests. (optional)
 				Authorization:
 
+				# If set, webhooks are not POSTed to a URL, but only made available through the
+				# webapi event stream at /webapi/v0/events, and must be acknowledged by the
+				# client. URL must be empty. (optional)
+				EventStreamOnly: false
+
 			# Login addresses that cause outgoing email to be sent with SMTP MAIL FROM
 			# addresses with a unique id after the localpart catchall separator (which must be
 			# enabled when addresses are specified here). Any delivery status notifications
@@ -1092,6 +1850,13 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 			# (optional)
 			LoginDisabled:
 
+			# If set, logins to the webmail interface require a second factor (TOTP code or
+			# security key) in addition to the password. Logins to the account web interface
+			# remain possible without second factor until one has been configured, so one can
+			# be set up. Does not apply to IMAP, SMTP and the webapi, which can use app
+			# passwords. (optional)
+			RequireSecondFactor: false
+
 			# Default domain for account. Deprecated behaviour: If a destination is not a full
 			# address but only a localpart, this domain is added to form a full address.
 			Domain:
@@ -1224,7 +1989,8 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 			# globally configured default maximum size if non-zero. A negative value can be
 			# used to have no limit in case there is a limit by default. Attempting to add new
 			# messages to an account beyond its maximum total size will result in an error.
-			# Useful to prevent a single account from filling storage. (optional)
+			# Calendar and contact objects also count towards the quota. Useful to prevent a
+			# single account from filling storage. (optional)
 			QuotaMessageSize: 0
 
 			# Mail that looks like spam will be rejected, but a copy can be stored temporarily
@@ -1301,6 +2067,14 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 					# in calculating probability reduced. E.g. 1 or 2. (optional)
 					RareWords: 0
 
+					# Also train and classify with tokens describing the structure of messages: header
+					# properties, domains of links, attachment types, HTML structure (e.g. many
+					# images, hidden text) and authentication results. Enabling or disabling changes
+					# the tokens used for classification, making the token counts in the database
+					# inconsistent with how messages are classified, so the junk filter must be
+					# retrained after changing this setting, e.g. with "mox retrain". (optional)
+					Features: false
+
 			# Maximum number of outgoing messages for this account in a 24 hour window. This
 			# limits the damage to recipients and the reputation of this mail server in case
 			# of account compromise. Default 1000. (optional)
@@ -1311,6 +2085,87 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 			# this mail server in case of account compromise. Default 200. (optional)
 			MaxFirstTimeRecipientsPerDay: 0
 
+			# Limits on outgoing messages for this account, per hour, day and month, in
+			# addition to MaxOutgoingMessagesPerDay and MaxFirstTimeRecipientsPerDay, with a
+			# policy for when a limit is reached. (optional)
+			SendLimits:
+
+				# Limits for all outgoing messages. Hourly limits apply to the current hour, daily
+				# limits to the past 24 hours in whole hours, and monthly limits to the past 30
+				# days in whole days (UTC). (optional)
+				All:
+
+					# (optional)
+					MessagesPerHour: 0
+
+					# (optional)
+					MessagesPerDay: 0
+
+					# (optional)
+					MessagesPerMonth: 0
+
+					# (optional)
+					RecipientsPerHour: 0
+
+					# (optional)
+					RecipientsPerDay: 0
+
+					# (optional)
+					RecipientsPerMonth: 0
+
+				# Limits for messages submitted over SMTP and through webmail. (optional)
+				Submission:
+
+					# (optional)
+					MessagesPerHour: 0
+
+					# (optional)
+					MessagesPerDay: 0
+
+					# (optional)
+					MessagesPerMonth: 0
+
+					# (optional)
+					RecipientsPerHour: 0
+
+					# (optional)
+					RecipientsPerDay: 0
+
+					# (optional)
+					RecipientsPerMonth: 0
+
+				# Limits for messages submitted through the webapi. (optional)
+				WebAPI:
+
+					# (optional)
+					MessagesPerHour: 0
+
+					# (optional)
+					MessagesPerDay: 0
+
+					# (optional)
+					MessagesPerMonth: 0
+
+					# (optional)
+					RecipientsPerHour: 0
+
+					# (optional)
+					RecipientsPerDay: 0
+
+					# (optional)
+					RecipientsPerMonth: 0
+
+				# What to do when sending a message would exceed a limit: "reject" (default)
+				# refuses the message, for SMTP with a temporary error for hourly limits and a
+				# permanent error for daily and monthly limits, "hold" accepts the message but
+				# adds a hold rule to the queue for the account or domain, so this and later
+				# messages are not delivered until the admin removes the hold rule and releases
+				# the messages, "notify" accepts and delivers the message. For "hold" and
+				# "notify", the postmaster is sent a message about the limit. For all policies, an
+				# outgoing webhook with event "limitreached" is sent, if configured for the
+				# account. Notifications are sent at most once per limit per period. (optional)
+				Policy:
+
 			# Do not apply a delay to SMTP connections before accepting an incoming message
 			# from a first-time sender. Can be useful for accounts that sends automated
 			# responses and want instant replies. (optional)
@@ -1328,6 +2183,63 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 			IMAPCapabilitiesDisabled:
 				-
 
+			# Rules for attachments in incoming messages for this account, and in outgoing
+			# messages submitted by this account. Evaluated in addition to domain attachment
+			# rules. Useful to block dangerous attachments like executables, Office documents
+			# with macros and encrypted archives. (optional)
+			AttachmentRules:
+				-
+
+					# Apply rule to "incoming" or "outgoing" messages only. If empty, the rule applies
+					# to both. Incoming messages are deliveries over SMTP to the domain or account,
+					# outgoing messages are submitted over SMTP by the account or with a message From
+					# address in the domain. (optional)
+					Direction:
+
+					# Content types (lower-case) to match, with optional wildcards in the style of
+					# shell file name patterns, e.g. "application/x-msdownload" or
+					# "application/vnd.ms-*.macroenabled.*". Both the content type declared in the
+					# message and the content type detected from the data are matched. Detected types
+					# include application/x-msdownload for Windows executables,
+					# application/x-executable for ELF executables, application/zip,
+					# application/x-rar-compressed, application/x-7z-compressed,
+					# application/x-ole-storage for legacy Office documents, and
+					# application/vnd.ms-word.document.macroenabled.12 (and similar for excel and
+					# powerpoint) for Office documents containing macros. (optional)
+					ContentTypes:
+						-
+
+					# File name extensions (lower-case, with leading dot), e.g. ".exe". Matched
+					# against the file name of the part and against names of files inside zip
+					# archives. (optional)
+					Extensions:
+						-
+
+					# If set, match zip archives containing encrypted (password-protected) files.
+					# (optional)
+					EncryptedArchive: false
+
+					# If set, match archives of which the files cannot be listed, so Extensions cannot
+					# be matched: rar and 7z archives, and zip archives that are too large (over 32MB)
+					# or malformed. (optional)
+					UninspectableArchive: false
+
+					# If non-zero, only match parts with a decoded size of at least this many bytes.
+					# If no content types, extensions, encrypted or uninspectable archive match is
+					# configured, all attachments of at least this size match, e.g. to block large
+					# attachments. Attachments are parts with a Content-Disposition of "attachment" or
+					# with a file name, so message text is not matched. (optional)
+					MinSize: 0
+
+					# What to do with a message with a matching part: "reject" refuses the message
+					# with a permanent error, "strip" replaces the part with a text part explaining it
+					# was removed, "quarantine" refuses incoming messages but stores a copy in the
+					# rejects mailbox of the account (if configured), and refuses outgoing messages.
+					# If a message has parts matching multiple rules, reject has precedence over
+					# quarantine, which has precedence over strip. Messages that consist of only a
+					# matching part are rejected instead of stripped.
+					Action:
+
 			# Routes for delivering outgoing messages through the queue. Each delivery attempt
 			# evaluates these account routes, domain routes and finally global routes. The
 			# transport of the first matching route is used in the delivery attempt. If no
@@ -1480,13 +2392,13 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 				ResponseHeaders:
 					x:
 
-			# Pass request to internal service, like webmail, webapi, etc. (optional)
+			# Pass request to internal service, like webmail, webapi, dav, etc. (optional)
 			WebInternal:
 
 				# Path to use as root of internal service, e.g. /webmail/.
 				BasePath:
 
-				# Name of the service, values: admin, account, webmail, webapi.
+				# Name of the service, values: admin, account, webmail, webapi, dav.
 				Service:
 
 	# Routes for delivering outgoing messages through the queue. Each delivery attempt
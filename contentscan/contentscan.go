@@ -0,0 +1,279 @@
+// Package contentscan scans messages for viruses and other malware with an
+// external scanner.
+//
+// Two protocols are supported. The clamd protocol, as implemented by ClamAV's
+// clamd, with its INSTREAM command: The message is sent in chunks, each prefixed
+// by its size, and clamd responds with a single line. And ICAP (RFC 3507), which
+// is implemented by many commercial scanners: The message is sent as body of an
+// HTTP response in a RESPMOD request. A "204 No Content" response means the
+// message is clean, otherwise the response headers indicate what was found.
+package contentscan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/stub"
+)
+
+var (
+	MetricScan stub.HistogramVec = stub.HistogramVecIgnore{}
+)
+
+var (
+	ErrProtocol = errors.New("contentscan: unknown protocol")
+	ErrScanner  = errors.New("contentscan: scanner error") // Scanner responded with an error, or unexpected response.
+)
+
+// Status is the result of a scan.
+type Status string
+
+const (
+	StatusClean    Status = "clean"
+	StatusInfected Status = "infected"
+)
+
+// Result of a successful scan.
+type Result struct {
+	Status Status
+	Threat string // Name of virus/malware, if infected and known.
+}
+
+// Size of chunks sent to the scanner. Clamd has a maximum (StreamMaxLength) for the
+// total stream, not for chunks.
+const chunkSize = 64 * 1024
+
+// Scan scans the message from r with the scanner at address, talking protocol
+// "clamd" or "icap". For clamd, address is either host:port for TCP, or a path to
+// a unix domain socket. For icap, address is a URL like
+// icap://localhost:1344/avscan. The timeout applies to the entire scan, including
+// connecting.
+func Scan(ctx context.Context, elog *slog.Logger, protocol, address string, timeout time.Duration, r io.Reader) (rresult Result, rerr error) {
+	log := mlog.New("contentscan", elog)
+	start := time.Now()
+	defer func() {
+		result := string(rresult.Status)
+		if rerr != nil {
+			result = "error"
+		}
+		MetricScan.ObserveLabels(float64(time.Since(start))/float64(time.Second), protocol, result)
+		log.Debugx("content scan result", rerr,
+			slog.String("protocol", protocol),
+			slog.String("address", address),
+			slog.Any("status", rresult.Status),
+			slog.String("threat", rresult.Threat),
+			slog.Duration("duration", time.Since(start)))
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	switch protocol {
+	case "clamd":
+		return scanClamd(ctx, log, address, r)
+	case "icap":
+		return scanICAP(ctx, log, address, r)
+	}
+	return Result{}, fmt.Errorf("%w: %q", ErrProtocol, protocol)
+}
+
+// dial connects to address and sets the deadline of ctx on the connection.
+func dial(ctx context.Context, network, address string) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func scanClamd(ctx context.Context, log mlog.Log, address string, r io.Reader) (Result, error) {
+	network := "tcp"
+	if strings.HasPrefix(address, "/") {
+		network = "unix"
+	}
+	conn, err := dial(ctx, network, address)
+	if err != nil {
+		return Result{}, fmt.Errorf("connecting to clamd: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		log.Check(err, "closing connection to clamd")
+	}()
+
+	// The "z" prefix indicates commands and responses are terminated by a NUL byte.
+	bw := bufio.NewWriter(conn)
+	if _, err := bw.WriteString("zINSTREAM\x00"); err != nil {
+		return Result{}, fmt.Errorf("writing command: %w", err)
+	}
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if err := binary.Write(bw, binary.BigEndian, uint32(n)); err != nil {
+				return Result{}, fmt.Errorf("writing chunk size: %w", err)
+			}
+			if _, err := bw.Write(buf[:n]); err != nil {
+				return Result{}, fmt.Errorf("writing chunk: %w", err)
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return Result{}, fmt.Errorf("reading message: %w", err)
+		}
+	}
+	// Zero-length chunk marks the end of the stream.
+	if err := binary.Write(bw, binary.BigEndian, uint32(0)); err != nil {
+		return Result{}, fmt.Errorf("writing end of stream: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return Result{}, fmt.Errorf("writing to clamd: %w", err)
+	}
+
+	// Clamd may close the connection while we are writing, e.g. when the maximum
+	// stream size is exceeded. We still try to read its response.
+	line, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && (err != io.EOF || line == "") {
+		return Result{}, fmt.Errorf("reading clamd response: %w", err)
+	}
+	return parseClamdResponse(strings.TrimRight(line, "\x00\r\n"))
+}
+
+// parseClamdResponse parses responses like "stream: OK", "stream: Eicar-Signature
+// FOUND" or "INSTREAM size limit exceeded. ERROR".
+func parseClamdResponse(s string) (Result, error) {
+	s = strings.TrimPrefix(s, "stream: ")
+	switch {
+	case s == "OK":
+		return Result{Status: StatusClean}, nil
+	case strings.HasSuffix(s, " FOUND"):
+		return Result{Status: StatusInfected, Threat: strings.TrimSuffix(s, " FOUND")}, nil
+	}
+	return Result{}, fmt.Errorf("%w: clamd response %q", ErrScanner, s)
+}
+
+func scanICAP(ctx context.Context, log mlog.Log, address string, r io.Reader) (Result, error) {
+	u, err := url.Parse(address)
+	if err != nil || u.Scheme != "icap" || u.Host == "" {
+		return Result{}, fmt.Errorf("parsing icap url: must be of the form icap://host[:port]/service")
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "1344")
+	}
+
+	conn, err := dial(ctx, "tcp", host)
+	if err != nil {
+		return Result{}, fmt.Errorf("connecting to icap server: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		log.Check(err, "closing connection to icap server")
+	}()
+
+	// We send the message as the body of an HTTP response, and allow a "204 No
+	// Content" response, meaning the message does not have to be modified.
+	httpHdr := "HTTP/1.1 200 OK\r\nContent-Type: message/rfc822\r\n\r\n"
+	bw := bufio.NewWriter(conn)
+	fmt.Fprintf(bw, "RESPMOD %s ICAP/1.0\r\n", u.String())
+	fmt.Fprintf(bw, "Host: %s\r\n", u.Host)
+	fmt.Fprintf(bw, "Allow: 204\r\n")
+	fmt.Fprintf(bw, "Encapsulated: res-hdr=0, res-body=%d\r\n", len(httpHdr))
+	fmt.Fprintf(bw, "\r\n")
+	bw.WriteString(httpHdr)
+
+	// Body is sent with chunked encoding, as in HTTP.
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			fmt.Fprintf(bw, "%x\r\n", n)
+			bw.Write(buf[:n])
+			bw.WriteString("\r\n")
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return Result{}, fmt.Errorf("reading message: %w", err)
+		}
+	}
+	bw.WriteString("0\r\n\r\n")
+	if err := bw.Flush(); err != nil {
+		return Result{}, fmt.Errorf("writing to icap server: %w", err)
+	}
+
+	tr := textproto.NewReader(bufio.NewReader(conn))
+	line, err := tr.ReadLine()
+	if err != nil {
+		return Result{}, fmt.Errorf("reading icap response: %w", err)
+	}
+	hdrs, err := tr.ReadMIMEHeader()
+	if err != nil {
+		return Result{}, fmt.Errorf("reading icap response header: %w", err)
+	}
+	var httpStatus string
+	if strings.HasPrefix(hdrs.Get("Encapsulated"), "res-hdr=0") {
+		httpStatus, err = tr.ReadLine()
+		if err != nil {
+			return Result{}, fmt.Errorf("reading encapsulated http response: %w", err)
+		}
+	}
+	return parseICAPResponse(line, hdrs, httpStatus)
+}
+
+// parseICAPResponse interprets an ICAP response status line, headers and optional
+// encapsulated HTTP status line.
+func parseICAPResponse(statusLine string, hdrs textproto.MIMEHeader, httpStatus string) (Result, error) {
+	t := strings.SplitN(statusLine, " ", 3)
+	if len(t) < 2 || !strings.HasPrefix(t[0], "ICAP/") {
+		return Result{}, fmt.Errorf("%w: malformed icap response %q", ErrScanner, statusLine)
+	}
+	switch t[1] {
+	case "204":
+		return Result{Status: StatusClean}, nil
+	case "200":
+	default:
+		return Result{}, fmt.Errorf("%w: icap response %q", ErrScanner, statusLine)
+	}
+
+	// There is no standard for reporting viruses, these headers are commonly used.
+	// E.g. "X-Infection-Found: Type=0; Resolution=2; Threat=Eicar-Test-Signature;".
+	if v := hdrs.Get("X-Infection-Found"); v != "" {
+		threat := v
+		for s := range strings.SplitSeq(v, ";") {
+			if k, tv, ok := strings.Cut(strings.TrimSpace(s), "="); ok && strings.EqualFold(k, "Threat") {
+				threat = tv
+			}
+		}
+		return Result{Status: StatusInfected, Threat: threat}, nil
+	}
+	for _, k := range []string{"X-Virus-Id", "X-Violations-Found"} {
+		if v := hdrs.Get(k); v != "" {
+			return Result{Status: StatusInfected, Threat: v}, nil
+		}
+	}
+
+	// Some servers replace the response with an error page for infected messages.
+	if t := strings.SplitN(httpStatus, " ", 3); len(t) >= 2 && !strings.HasPrefix(t[1], "2") {
+		return Result{Status: StatusInfected}, nil
+	}
+	return Result{Status: StatusClean}, nil
+}
@@ -0,0 +1,191 @@
+package contentscan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mjl-/mox/mlog"
+)
+
+var ctxbg = context.Background()
+var pkglog = mlog.New("contentscan", nil)
+
+// Marker the fake scanners treat as virus. Not the EICAR test string, to prevent
+// real scanners from flagging this file.
+const virus = "contentscan-test-virus"
+
+func tcheck(t *testing.T, err error, msg string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %s", msg, err)
+	}
+}
+
+// serve accepts a single connection on a new listener and handles it with fn.
+func serve(t *testing.T, fn func(conn net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	tcheck(t, err, "listen")
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fn(conn)
+	}()
+	return ln.Addr().String()
+}
+
+// fakeClamd reads an INSTREAM request and responds like clamd.
+func fakeClamd(conn net.Conn) {
+	br := bufio.NewReader(conn)
+	cmd, err := br.ReadString(0)
+	if err != nil || cmd != "zINSTREAM\x00" {
+		fmt.Fprintf(conn, "UNKNOWN COMMAND\x00")
+		return
+	}
+	var data []byte
+	for {
+		var n uint32
+		if err := binary.Read(br, binary.BigEndian, &n); err != nil {
+			return
+		}
+		if n == 0 {
+			break
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return
+		}
+		data = append(data, buf...)
+	}
+	if strings.Contains(string(data), virus) {
+		fmt.Fprintf(conn, "stream: Eicar-Test-Signature FOUND\x00")
+	} else if strings.Contains(string(data), "toolarge") {
+		fmt.Fprintf(conn, "INSTREAM size limit exceeded. ERROR\x00")
+	} else {
+		fmt.Fprintf(conn, "stream: OK\x00")
+	}
+}
+
+// fakeICAP reads a RESPMOD request and responds like an ICAP virus scanner.
+func fakeICAP(conn net.Conn) {
+	tr := textproto.NewReader(bufio.NewReader(conn))
+	line, err := tr.ReadLine()
+	if err != nil || !strings.HasPrefix(line, "RESPMOD icap://") {
+		fmt.Fprintf(conn, "ICAP/1.0 400 Bad Request\r\n\r\n")
+		return
+	}
+	if _, err := tr.ReadMIMEHeader(); err != nil {
+		return
+	}
+	// Encapsulated HTTP response header.
+	if _, err := tr.ReadLine(); err != nil {
+		return
+	}
+	if _, err := tr.ReadMIMEHeader(); err != nil {
+		return
+	}
+	var data []byte
+	for {
+		line, err := tr.ReadLine()
+		if err != nil {
+			return
+		}
+		var n int
+		if _, err := fmt.Sscanf(line, "%x", &n); err != nil {
+			return
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(tr.R, buf); err != nil {
+			return
+		}
+		if n == 0 {
+			break
+		}
+		data = append(data, buf[:n]...)
+	}
+	if strings.Contains(string(data), virus) {
+		fmt.Fprintf(conn, "ICAP/1.0 200 OK\r\nX-Infection-Found: Type=0; Resolution=2; Threat=Eicar-Test-Signature;\r\nEncapsulated: res-hdr=0, res-body=45\r\n\r\nHTTP/1.1 403 Forbidden\r\nContent-Type: text/html\r\n\r\n0\r\n\r\n")
+	} else {
+		fmt.Fprintf(conn, "ICAP/1.0 204 No Content\r\nEncapsulated: null-body=0\r\n\r\n")
+	}
+}
+
+func TestScan(t *testing.T) {
+	const msg = "Subject: test\r\n\r\ntest\r\n"
+	infectedMsg := "Subject: test\r\n\r\n" + virus + "\r\n"
+
+	test := func(protocol string, fn func(conn net.Conn), address func(addr string) string, message string, expStatus Status, expThreat string, expErr error) {
+		t.Helper()
+		addr := serve(t, fn)
+		result, err := Scan(ctxbg, pkglog.Logger, protocol, address(addr), time.Second, strings.NewReader(message))
+		if (err == nil) != (expErr == nil) || err != nil && !errors.Is(err, expErr) {
+			t.Fatalf("got err %v, expected %v", err, expErr)
+		}
+		if result.Status != expStatus || result.Threat != expThreat {
+			t.Fatalf("got result %#v, expected status %q, threat %q", result, expStatus, expThreat)
+		}
+	}
+
+	clamdAddr := func(addr string) string { return addr }
+	test("clamd", fakeClamd, clamdAddr, msg, StatusClean, "", nil)
+	test("clamd", fakeClamd, clamdAddr, infectedMsg, StatusInfected, "Eicar-Test-Signature", nil)
+	test("clamd", fakeClamd, clamdAddr, "toolarge", "", "", ErrScanner)
+	// Large message, multiple chunks.
+	test("clamd", fakeClamd, clamdAddr, strings.Repeat("a", 3*chunkSize+1)+virus, StatusInfected, "Eicar-Test-Signature", nil)
+
+	icapAddr := func(addr string) string { return "icap://" + addr + "/avscan" }
+	test("icap", fakeICAP, icapAddr, msg, StatusClean, "", nil)
+	test("icap", fakeICAP, icapAddr, infectedMsg, StatusInfected, "Eicar-Test-Signature", nil)
+	test("icap", fakeICAP, icapAddr, strings.Repeat("a", 3*chunkSize+1)+virus, StatusInfected, "Eicar-Test-Signature", nil)
+
+	// Unknown protocol.
+	_, err := Scan(ctxbg, pkglog.Logger, "bogus", "localhost:1", time.Second, strings.NewReader(msg))
+	if !errors.Is(err, ErrProtocol) {
+		t.Fatalf("got err %v, expected ErrProtocol", err)
+	}
+
+	// Scanner that does not respond, times out.
+	addr := serve(t, func(conn net.Conn) { io.Copy(io.Discard, conn) })
+	_, err = Scan(ctxbg, pkglog.Logger, "clamd", addr, 100*time.Millisecond, strings.NewReader(msg))
+	if err == nil {
+		t.Fatalf("expected timeout error")
+	}
+}
+
+func TestParseICAPResponse(t *testing.T) {
+	test := func(statusLine string, hdrs map[string]string, httpStatus string, expStatus Status, expThreat string, expErr error) {
+		t.Helper()
+		h := textproto.MIMEHeader{}
+		for k, v := range hdrs {
+			h.Set(k, v)
+		}
+		result, err := parseICAPResponse(statusLine, h, httpStatus)
+		if (err == nil) != (expErr == nil) || err != nil && !errors.Is(err, expErr) {
+			t.Fatalf("got err %v, expected %v", err, expErr)
+		}
+		if result.Status != expStatus || result.Threat != expThreat {
+			t.Fatalf("got result %#v, expected status %q, threat %q", result, expStatus, expThreat)
+		}
+	}
+
+	test("ICAP/1.0 204 No Content", nil, "", StatusClean, "", nil)
+	test("ICAP/1.0 200 OK", nil, "HTTP/1.1 200 OK", StatusClean, "", nil)
+	test("ICAP/1.0 200 OK", map[string]string{"X-Virus-ID": "Trojan.X"}, "", StatusInfected, "Trojan.X", nil)
+	test("ICAP/1.0 200 OK", map[string]string{"X-Violations-Found": "1"}, "", StatusInfected, "1", nil)
+	test("ICAP/1.0 200 OK", nil, "HTTP/1.1 403 Forbidden", StatusInfected, "", nil)
+	test("ICAP/1.0 500 Server Error", nil, "", "", "", ErrScanner)
+	test("bogus", nil, "", "", "", ErrScanner)
+}
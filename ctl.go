@@ -963,6 +963,105 @@ func servectlcmd(ctx context.Context, xctl *ctl, cid int64, shutdown func()) {
 		}
 		xw.xclose()
 
+	case "ipbanlist":
+		/* protocol:
+		> "ipbanlist"
+		< "ok"
+		< stream
+		*/
+		l, err := store.IPBanList(ctx)
+		xctl.xcheck(err, "listing ip bans")
+		xctl.xwriteok()
+		xw := xctl.writer()
+		for _, b := range l {
+			expires := "never"
+			if !b.Expires.IsZero() {
+				expires = b.Expires.Round(time.Second).String()
+			}
+			kind := "manual"
+			if b.Automatic {
+				kind = fmt.Sprintf("automatic, count %d", b.Count)
+			}
+			fmt.Fprintf(xw, "%s: expires %s, %s, reason %q\n", b.Net, expires, kind, b.Reason)
+		}
+		if len(l) == 0 {
+			fmt.Fprint(xw, "(none)\n")
+		}
+		xw.xclose()
+
+	case "ipbanadd":
+		/* protocol:
+		> "ipbanadd"
+		> ip or network
+		> duration
+		> reason
+		< "ok" or error
+		*/
+		ipnet, err := mox.ParseIPNet(xctl.xread())
+		xctl.xcheck(err, "parsing ip or network")
+		duration, err := time.ParseDuration(xctl.xread())
+		xctl.xcheck(err, "parsing duration")
+		reason := xctl.xread()
+		err = store.IPBanAdd(ctx, ipnet, duration, reason)
+		xctl.xcheck(err, "adding ip ban")
+		xctl.xwriteok()
+
+	case "ipbanremove":
+		/* protocol:
+		> "ipbanremove"
+		> ip or network
+		< "ok" or error
+		*/
+		ipnet, err := mox.ParseIPNet(xctl.xread())
+		xctl.xcheck(err, "parsing ip or network")
+		err = store.IPBanRemove(ctx, ipnet)
+		xctl.xcheck(err, "removing ip ban")
+		xctl.xwriteok()
+
+	case "ipbanallowlistlist":
+		/* protocol:
+		> "ipbanallowlistlist"
+		< "ok"
+		< stream
+		*/
+		l, err := store.IPAllowList(ctx)
+		xctl.xcheck(err, "listing ip allowlist")
+		xctl.xwriteok()
+		xw := xctl.writer()
+		for _, a := range l {
+			fmt.Fprintf(xw, "%s: added %s, comment %q\n", a.Net, a.Created.Round(time.Second), a.Comment)
+		}
+		if len(l) == 0 {
+			fmt.Fprint(xw, "(none)\n")
+		}
+		xw.xclose()
+
+	case "ipbanallowlistadd":
+		/* protocol:
+		> "ipbanallowlistadd"
+		> ip or network
+		> comment
+		< "ok" or error
+		*/
+		ipnet, err := mox.ParseIPNet(xctl.xread())
+		xctl.xcheck(err, "parsing ip or network")
+		comment := xctl.xread()
+		err = store.IPAllowAdd(ctx, ipnet, comment)
+		xctl.xcheck(err, "adding to ip allowlist")
+		xctl.xwriteok()
+
+	case "ipbanallowlistremove":
+		/* protocol:
+		> "ipbanallowlistremove"
+		> ip or network
+		< "ok" or error
+		*/
+		ipnet, err := mox.ParseIPNet(xctl.xread())
+		xctl.xcheck(err, "parsing ip or network")
+		err = store.IPAllowRemove(ctx, ipnet)
+		xctl.xcheck(err, "removing from ip allowlist")
+		xctl.xwriteok()
+
 	case "importmaildir", "importmbox":
 		mbox := cmd == "importmbox"
 		ximportctl(ctx, xctl, mbox)
@@ -1203,6 +1302,95 @@ func servectlcmd(ctx context.Context, xctl *ctl, cid int64, shutdown func()) {
 		xctl.xcheck(err, "removing tls public key")
 		xctl.xwriteok()
 
+	case "apikeylist":
+		/* protocol:
+		> "apikeylist"
+		> account
+		< "ok" or error
+		< stream
+		*/
+		account := xctl.xread()
+		acc, err := store.OpenAccount(xctl.log, account, false)
+		xctl.xcheck(err, "open account")
+		defer func() {
+			err := acc.Close()
+			xctl.log.Check(err, "close account")
+		}()
+		keys, err := acc.APIKeyList(ctx)
+		xctl.xcheck(err, "list api keys")
+		xctl.xwriteok()
+		xw := xctl.writer()
+		fmt.Fprintf(xw, "# id, prefix, name, scopes, expires, ip ranges, last used, last used ip (%d)\n", len(keys))
+		for _, k := range keys {
+			var expires, lastUsed string
+			if k.Expires != nil {
+				expires = k.Expires.Format(time.RFC3339)
+			}
+			if k.LastUsed != nil {
+				lastUsed = k.LastUsed.Format(time.RFC3339)
+			}
+			fmt.Fprintf(xw, "%d\t%s\t%q\t%s\t%s\t%s\t%s\t%s\n", k.ID, k.Prefix, k.Name, strings.Join(k.Scopes, ","), expires, strings.Join(k.IPRanges, ","), lastUsed, k.LastUsedIP)
+		}
+		xw.xclose()
+
+	case "apikeyadd":
+		/* protocol:
+		> "apikeyadd"
+		> account
+		> name
+		> scopes (comma-separated)
+		> expires (rfc3339, or empty)
+		> ipranges (comma-separated, or empty)
+		< "ok" or error
+		< key
+		*/
+		account := xctl.xread()
+		name := xctl.xread()
+		scopes := xctl.xread()
+		expires := xctl.xread()
+		ipranges := xctl.xread()
+		var k store.APIKey
+		k.Name = name
+		k.Scopes = strings.Split(scopes, ",")
+		if expires != "" {
+			t, err := time.Parse(time.RFC3339, expires)
+			xctl.xcheck(err, "parsing expiration time")
+			k.Expires = &t
+		}
+		if ipranges != "" {
+			k.IPRanges = strings.Split(ipranges, ",")
+		}
+		acc, err := store.OpenAccount(xctl.log, account, false)
+		xctl.xcheck(err, "open account")
+		defer func() {
+			err := acc.Close()
+			xctl.log.Check(err, "close account")
+		}()
+		_, key, err := acc.APIKeyAdd(ctx, k)
+		xctl.xcheck(err, "adding api key")
+		xctl.xwriteok()
+		xctl.xwrite(key)
+
+	case "apikeyrm":
+		/* protocol:
+		> "apikeyrm"
+		> account
+		> id
+		< "ok" or error
+		*/
+		account := xctl.xread()
+		id, err := strconv.ParseInt(xctl.xread(), 10, 64)
+		xctl.xcheck(err, "parsing id")
+		acc, err := store.OpenAccount(xctl.log, account, false)
+		xctl.xcheck(err, "open account")
+		defer func() {
+			err := acc.Close()
+			xctl.log.Check(err, "close account")
+		}()
+		err = acc.APIKeyRemove(ctx, id)
+		xctl.xcheck(err, "removing api key")
+		xctl.xwriteok()
+
 	case "addressadd":
 		/* protocol:
 		> "addressadd"
@@ -1517,6 +1705,137 @@ func servectlcmd(ctx context.Context, xctl *ctl, cid int64, shutdown func()) {
 		}
 		xctl.xwriteok()
 
+	case "junkevaluate":
+		/* protocol:
+		> "junkevaluate"
+		> account
+		> ham mailbox or empty
+		> spam mailbox or empty
+		< "ok" or error
+		< stream
+		*/
+		account := xctl.xread()
+		hamMailbox := xctl.xread()
+		spamMailbox := xctl.xread()
+
+		acc, err := store.OpenAccount(log, account, false)
+		xctl.xcheck(err, "open account")
+		defer func() {
+			err := acc.Close()
+			log.Check(err, "closing account after evaluating junk filter")
+		}()
+
+		jf, conf, err := acc.OpenJunkFilter(ctx, log)
+		xctl.xcheck(err, "open junk filter")
+		defer func() {
+			// Untraining/training for evaluation must not be saved.
+			err := jf.CloseDiscard()
+			log.Check(err, "closing junk filter after evaluation")
+		}()
+
+		// Each message is classified without its own training, by untraining it first
+		// and training it again after classifying.
+		var tp, fp, tn, fn, insignificant int
+		acc.WithRLock(func() {
+			err = acc.DB.Read(ctx, func(tx *bstore.Tx) error {
+				var hamMailboxID, spamMailboxID int64
+				if hamMailbox != "" || spamMailbox != "" {
+					hmb, err := acc.MailboxFind(tx, hamMailbox)
+					if err != nil {
+						return err
+					} else if hmb == nil {
+						return fmt.Errorf("mailbox %q not found", hamMailbox)
+					}
+					smb, err := acc.MailboxFind(tx, spamMailbox)
+					if err != nil {
+						return err
+					} else if smb == nil {
+						return fmt.Errorf("mailbox %q not found", spamMailbox)
+					}
+					hamMailboxID, spamMailboxID = hmb.ID, smb.ID
+				}
+
+				q := bstore.QueryTx[store.Message](tx)
+				q.FilterEqual("Expunged", false)
+				return q.ForEach(func(m store.Message) error {
+					var spam bool
+					if hamMailboxID != 0 {
+						if m.MailboxID != hamMailboxID && m.MailboxID != spamMailboxID {
+							return nil
+						}
+						spam = m.MailboxID == spamMailboxID
+					} else {
+						if m.Junk == m.Notjunk {
+							return nil
+						}
+						spam = m.Junk
+					}
+
+					mr := acc.MessageReader(m)
+					defer func() {
+						err := mr.Close()
+						log.Check(err, "closing message reader after evaluation")
+					}()
+					p, err := m.LoadPart(mr)
+					if err != nil {
+						log.Infox("loading part for message, skipping", err, slog.Int64("msgid", m.ID))
+						return nil
+					}
+					words, err := jf.ParseMessage(p)
+					if err != nil {
+						log.Infox("parsing message, skipping", err, slog.Int64("msgid", m.ID))
+						return nil
+					}
+
+					if m.TrainedJunk != nil {
+						if err := jf.Untrain(ctx, !*m.TrainedJunk, words); err != nil {
+							return fmt.Errorf("untraining message: %v", err)
+						}
+					}
+					result, err := jf.ClassifyWords(ctx, words)
+					if err != nil {
+						return fmt.Errorf("classifying message: %v", err)
+					}
+					if m.TrainedJunk != nil {
+						if err := jf.Train(ctx, !*m.TrainedJunk, words); err != nil {
+							return fmt.Errorf("training message: %v", err)
+						}
+					}
+
+					if !result.Significant {
+						insignificant++
+					}
+					predictSpam := result.Probability > conf.Threshold
+					switch {
+					case spam && predictSpam:
+						tp++
+					case spam:
+						fn++
+					case predictSpam:
+						fp++
+					default:
+						tn++
+					}
+					return nil
+				})
+			})
+		})
+		xctl.xcheck(err, "evaluating messages")
+		xctl.xwriteok()
+
+		xw := xctl.writer()
+		ratio := func(a, b int) float64 {
+			if b == 0 {
+				return 0
+			}
+			return float64(a) / float64(b)
+		}
+		fmt.Fprintf(xw, "threshold %.2f, %d spam, %d ham\n", conf.Threshold, tp+fn, tn+fp)
+		fmt.Fprintf(xw, "true positives %d, false positives %d, true negatives %d, false negatives %d\n", tp, fp, tn, fn)
+		fmt.Fprintf(xw, "precision %.3f, recall %.3f, accuracy %.3f\n", ratio(tp, tp+fp), ratio(tp, tp+fn), ratio(tp+tn, tp+tn+fp+fn))
+		fmt.Fprintf(xw, "not significant %d\n", insignificant)
+		xw.xclose()
+
 	case "recalculatemailboxcounts":
 		/* protocol:
 		> "recalculatemailboxcounts"
@@ -1567,9 +1886,18 @@ func servectlcmd(ctx context.Context, xctl *ctl, cid int64, shutdown func()) {
 				if err := tx.Get(&du); err != nil {
 					return fmt.Errorf("get disk usage: %v", err)
 				}
-				if du.MessageSize != totalSize {
-					fmt.Fprintf(xw, "setting new total message size %d (was %d)\n", totalSize, du.MessageSize)
+				var davSize int64
+				err = bstore.QueryTx[store.DAVObject](tx).ForEach(func(o store.DAVObject) error {
+					davSize += int64(len(o.Data))
+					return nil
+				})
+				if err != nil {
+					return fmt.Errorf("calculating calendar and contact object size: %v", err)
+				}
+				if du.MessageSize != totalSize || du.DAVSize != davSize {
+					fmt.Fprintf(xw, "setting new total message size %d (was %d), calendar and contact object size %d (was %d)\n", totalSize, du.MessageSize, davSize, du.DAVSize)
 					du.MessageSize = totalSize
+					du.DAVSize = davSize
 					if err := tx.Update(&du); err != nil {
 						return fmt.Errorf("update disk usage: %v", err)
 					}
@@ -1754,6 +2082,47 @@ func servectlcmd(ctx context.Context, xctl *ctl, cid int64, shutdown func()) {
 		}
 		xw.xclose()
 
+	case "rebuildsearchindex":
+		/* protocol:
+		> "rebuildsearchindex"
+		> account or empty
+		< "ok" or error
+		< stream
+		*/
+
+		accountOpt := xctl.xread()
+		xctl.xwriteok()
+		xw := xctl.writer()
+
+		xrebuildAccount := func(accName string) {
+			acc, err := store.OpenAccount(log, accName, false)
+			xctl.xcheck(err, "open account")
+			defer func() {
+				err := acc.Close()
+				log.Check(err, "closing account after rebuilding search index")
+			}()
+
+			start := time.Now()
+			total, err := acc.SearchIndexRebuild(ctx, log)
+			xctl.xcheck(err, "rebuild search index")
+
+			fmt.Fprintf(xw, "%d message(s) indexed for account %s in %dms\n", total, accName, time.Since(start)/time.Millisecond)
+		}
+
+		if accountOpt != "" {
+			xrebuildAccount(accountOpt)
+		} else {
+			for i, accName := range mox.Conf.Accounts() {
+				var line string
+				if i > 0 {
+					line = "\n"
+				}
+				fmt.Fprintf(xw, "%sRebuilding search index for account %s...\n", line, accName)
+				xrebuildAccount(accName)
+			}
+		}
+		xw.xclose()
+
 	case "reassignthreads":
 		/* protocol:
 		> "reassignthreads"
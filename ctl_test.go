@@ -20,6 +20,7 @@ import (
 	"github.com/mjl-/mox/config"
 	"github.com/mjl-/mox/dmarcdb"
 	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/greylist"
 	"github.com/mjl-/mox/imapclient"
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/mox-"
@@ -222,6 +223,51 @@ func TestCtl(t *testing.T) {
 		ctlcmdQueueSuppressList(xctl, "mjl")
 	})
 
+	// "ipbanadd"
+	testctl(func(xctl *ctl) {
+		ctlcmdIPBanAdd(xctl, "192.0.2.1", time.Hour, "test")
+	})
+	testctl(func(xctl *ctl) {
+		ctlcmdIPBanAdd(xctl, "2001:db8::/64", 0, "")
+	})
+	if !store.IPBanned(net.ParseIP("192.0.2.1")) || !store.IPBanned(net.ParseIP("2001:db8::1")) {
+		t.Fatalf("ip not banned after ipbanadd")
+	}
+
+	// "ipbanlist"
+	testctl(func(xctl *ctl) {
+		ctlcmdIPBanList(xctl)
+	})
+
+	// "ipbanallowlistadd"
+	testctl(func(xctl *ctl) {
+		ctlcmdIPBanAllowlistAdd(xctl, "192.0.2.0/24", "monitoring")
+	})
+	if store.IPBanned(net.ParseIP("192.0.2.1")) {
+		t.Fatalf("allowlisted ip still banned")
+	}
+
+	// "ipbanallowlistlist"
+	testctl(func(xctl *ctl) {
+		ctlcmdIPBanAllowlistList(xctl)
+	})
+
+	// "ipbanallowlistremove"
+	testctl(func(xctl *ctl) {
+		ctlcmdIPBanAllowlistRemove(xctl, "192.0.2.0/24")
+	})
+
+	// "ipbanremove"
+	testctl(func(xctl *ctl) {
+		ctlcmdIPBanRemove(xctl, "192.0.2.1")
+	})
+	testctl(func(xctl *ctl) {
+		ctlcmdIPBanRemove(xctl, "2001:db8::/64")
+	})
+	if store.IPBanned(net.ParseIP("192.0.2.1")) || store.IPBanned(net.ParseIP("2001:db8::1")) {
+		t.Fatalf("ip still banned after ipbanremove")
+	}
+
 	// "queueretiredlist"
 	testctl(func(xctl *ctl) {
 		ctlcmdQueueRetiredList(xctl, queue.RetiredFilter{}, queue.RetiredSort{})
@@ -296,6 +342,14 @@ func TestCtl(t *testing.T) {
 		ctlcmdRetrain(xctl, "mjl2")
 	})
 
+	// "junkevaluate", on flagged messages and on mailboxes.
+	testctl(func(xctl *ctl) {
+		ctlcmdJunkEvaluate(xctl, "mjl2", "", "")
+	})
+	testctl(func(xctl *ctl) {
+		ctlcmdJunkEvaluate(xctl, "mjl2", "Inbox", "Junk")
+	})
+
 	// "addressrm"
 	testctl(func(xctl *ctl) {
 		ctlcmdConfigAddressRemove(xctl, "mjl3@mox2.example")
@@ -405,6 +459,38 @@ func TestCtl(t *testing.T) {
 		t.Fatalf("got %d tls public keys, expected 0", len(tpkl))
 	}
 
+	// "apikeyadd"
+	testctl(func(xctl *ctl) {
+		ctlcmdConfigAPIKeyAdd(xctl, "mjl", "testkey", "send,read", time.Now().Add(time.Hour).Format(time.RFC3339), []string{"127.0.0.0/8"})
+	})
+	testctl(func(xctl *ctl) {
+		ctlcmdConfigAPIKeyAdd(xctl, "mjl", "testkey2", "read", "", nil)
+	})
+
+	// "apikeylist"
+	testctl(func(xctl *ctl) {
+		ctlcmdConfigAPIKeyList(xctl, "mjl")
+	})
+
+	// "apikeyrm"
+	testctl(func(xctl *ctl) {
+		ctlcmdConfigAPIKeyRemove(xctl, "mjl", "1")
+	})
+
+	func() {
+		acc, err := store.OpenAccount(pkglog, "mjl", false)
+		tcheck(t, err, "open account")
+		defer func() {
+			err := acc.Close()
+			tcheck(t, err, "close account")
+		}()
+		keys, err := acc.APIKeyList(ctxbg)
+		tcheck(t, err, "list api keys")
+		if len(keys) != 1 || keys[0].Name != "testkey2" {
+			t.Fatalf("got api keys %v, expected single key testkey2", keys)
+		}
+	}()
+
 	// "loglevels"
 	testctl(func(xctl *ctl) {
 		ctlcmdLoglevels(xctl)
@@ -495,6 +581,14 @@ func TestCtl(t *testing.T) {
 		ctlcmdReparse(xctl, "")
 	})
 
+	// "rebuildsearchindex"
+	testctl(func(xctl *ctl) {
+		ctlcmdRebuildSearchIndex(xctl, "mjl")
+	})
+	testctl(func(xctl *ctl) {
+		ctlcmdRebuildSearchIndex(xctl, "")
+	})
+
 	// "reassignthreads"
 	testctl(func(xctl *ctl) {
 		ctlcmdReassignthreads(xctl, "mjl")
@@ -513,6 +607,9 @@ func TestCtl(t *testing.T) {
 	err = tlsrptdb.Init()
 	tcheck(t, err, "tlsrptdb init")
 	defer tlsrptdb.Close()
+	err = greylist.Init(false)
+	tcheck(t, err, "greylist init")
+	defer greylist.Close()
 	testctl(func(xctl *ctl) {
 		os.RemoveAll("testdata/ctl/data/tmp/backup")
 		err := os.WriteFile("testdata/ctl/data/receivedid.key", make([]byte, 16), 0600)
@@ -0,0 +1,350 @@
+package davserver
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mjl-/mox/ical"
+)
+
+// Validating of iCalendar (RFC 5545) and vCard (RFC 6350) objects that are
+// stored, and evaluating query filters. Data is stored as received.
+
+// calendarObject checks data is a valid calendar object resource (RFC 4791
+// section 4.1), and returns its main component type and UID.
+func calendarObject(data string) (compName, uid string, err error) {
+	c, err := ical.Parse(data)
+	if err != nil {
+		return "", "", err
+	}
+	if c.Name != "VCALENDAR" {
+		return "", "", fmt.Errorf("top-level component must be VCALENDAR, not %s", c.Name)
+	}
+	if c.Prop("METHOD") != nil {
+		return "", "", errors.New("calendar object must not have METHOD property")
+	}
+	for _, sc := range c.Comps {
+		if sc.Name == "VTIMEZONE" {
+			continue
+		}
+		if compName == "" {
+			compName = sc.Name
+		} else if sc.Name != compName {
+			return "", "", fmt.Errorf("calendar object with multiple component types %s and %s", compName, sc.Name)
+		}
+		p := sc.Prop("UID")
+		if p == nil || p.Value == "" {
+			return "", "", fmt.Errorf("component %s without UID", sc.Name)
+		} else if uid == "" {
+			uid = p.Value
+		} else if p.Value != uid {
+			return "", "", errors.New("calendar object with multiple UIDs")
+		}
+	}
+	if compName == "" {
+		return "", "", errors.New("calendar object without component")
+	}
+	return compName, uid, nil
+}
+
+// addressObject checks data is a valid address object resource (RFC 6352
+// section 5.1), and returns its UID, which can be empty.
+func addressObject(data string) (uid string, err error) {
+	c, err := ical.Parse(data)
+	if err != nil {
+		return "", err
+	}
+	if c.Name != "VCARD" {
+		return "", fmt.Errorf("top-level component must be VCARD, not %s", c.Name)
+	}
+	if p := c.Prop("UID"); p != nil {
+		uid = p.Value
+	}
+	return uid, nil
+}
+
+// timeRange is a time range from a query, RFC 4791 section 9.9. Zero times are
+// unbounded.
+type timeRange struct {
+	Start, End time.Time
+}
+
+func parseTimeRange(e *element) (tr timeRange, err error) {
+	if s := e.attr("start"); s != "" {
+		tr.Start, err = time.Parse("20060102T150405Z", s)
+		if err != nil {
+			return tr, fmt.Errorf("parsing start of time-range: %v", err)
+		}
+	}
+	if s := e.attr("end"); s != "" {
+		tr.End, err = time.Parse("20060102T150405Z", s)
+		if err != nil {
+			return tr, fmt.Errorf("parsing end of time-range: %v", err)
+		}
+	}
+	if tr.Start.IsZero() && tr.End.IsZero() {
+		return tr, errors.New("time-range without start and end")
+	}
+	return tr, nil
+}
+
+// overlaps returns whether the period from start to end overlaps with the range.
+// If end is equal to start, the period is a point in time.
+func (tr timeRange) overlaps(start, end time.Time) bool {
+	if end.After(start) {
+		return (tr.Start.IsZero() || tr.Start.Before(end)) && (tr.End.IsZero() || start.Before(tr.End))
+	}
+	return (tr.Start.IsZero() || !start.Before(tr.Start)) && (tr.End.IsZero() || start.Before(tr.End))
+}
+
+// matchTimeRange returns whether component c overlaps the time range, RFC 4791
+// section 9.9. Recurring components are matched when they start before the end of
+// the range, recurrence rules are not expanded.
+func matchTimeRange(c *ical.Component, tr timeRange) bool {
+	var start, end time.Time
+	var isDate bool
+	if p := c.Prop("DTSTART"); p != nil {
+		var err error
+		start, isDate, err = ical.ParseDateTime(p)
+		if err != nil {
+			return true
+		}
+	}
+	recurring := c.Prop("RRULE") != nil || c.Prop("RDATE") != nil
+
+	switch c.Name {
+	case "VEVENT", "VTODO", "VJOURNAL":
+	default:
+		// E.g. VALARM, VFREEBUSY. We don't evaluate those, and include them.
+		return true
+	}
+
+	if start.IsZero() {
+		if c.Name == "VJOURNAL" {
+			return false
+		}
+		if c.Name == "VTODO" {
+			if p := c.Prop("DUE"); p != nil {
+				due, _, err := ical.ParseDateTime(p)
+				if err != nil {
+					return true
+				}
+				return tr.overlaps(due, due)
+			}
+		}
+		return true
+	}
+	if recurring {
+		return tr.End.IsZero() || start.Before(tr.End)
+	}
+
+	endProp := "DTEND"
+	if c.Name == "VTODO" {
+		endProp = "DUE"
+	}
+	if p := c.Prop(endProp); p != nil {
+		var err error
+		end, _, err = ical.ParseDateTime(p)
+		if err != nil {
+			return true
+		}
+	} else if p := c.Prop("DURATION"); p != nil {
+		d, err := ical.ParseDuration(p.Value)
+		if err != nil {
+			return true
+		}
+		end = start.Add(d)
+	} else if isDate {
+		end = start.Add(24 * time.Hour)
+	} else {
+		end = start
+	}
+	return tr.overlaps(start, end)
+}
+
+// textMatch is a text-match from a query filter.
+type textMatch struct {
+	Text      string
+	Negate    bool
+	MatchType string // "equals", "contains", "starts-with", "ends-with".
+	Fold      bool   // Case-insensitive.
+}
+
+func parseTextMatch(e *element) textMatch {
+	tm := textMatch{
+		Text:      e.Text,
+		Negate:    e.attr("negate-condition") == "yes",
+		MatchType: e.attr("match-type"),
+		Fold:      e.attr("collation") != "i;octet",
+	}
+	if tm.MatchType == "" {
+		tm.MatchType = "contains"
+	}
+	return tm
+}
+
+func (tm textMatch) match(s string) bool {
+	text := tm.Text
+	if tm.Fold {
+		s = strings.ToLower(s)
+		text = strings.ToLower(text)
+	}
+	var r bool
+	switch tm.MatchType {
+	case "equals":
+		r = s == text
+	case "starts-with":
+		r = strings.HasPrefix(s, text)
+	case "ends-with":
+		r = strings.HasSuffix(s, text)
+	default:
+		r = strings.Contains(s, text)
+	}
+	return r != tm.Negate
+}
+
+// matchCompFilter evaluates a CalDAV comp-filter element (RFC 4791 section
+// 9.7.1) against the components with the name of the filter in comps.
+func matchCompFilter(comps []*ical.Component, f *element) (bool, error) {
+	name := strings.ToUpper(f.attr("name"))
+	var l []*ical.Component
+	for _, c := range comps {
+		if c.Name == name {
+			l = append(l, c)
+		}
+	}
+	if f.child(nsCalDAV, "is-not-defined") != nil {
+		return len(l) == 0, nil
+	}
+	var tr *timeRange
+	if e := f.child(nsCalDAV, "time-range"); e != nil {
+		xtr, err := parseTimeRange(e)
+		if err != nil {
+			return false, err
+		}
+		tr = &xtr
+	}
+Components:
+	for _, c := range l {
+		if tr != nil && !matchTimeRange(c, *tr) {
+			continue
+		}
+		for _, cf := range f.children(nsCalDAV, "comp-filter") {
+			if ok, err := matchCompFilter(c.Comps, cf); err != nil {
+				return false, err
+			} else if !ok {
+				continue Components
+			}
+		}
+		for _, pf := range f.children(nsCalDAV, "prop-filter") {
+			if ok, err := matchPropFilter(c, pf, false); err != nil {
+				return false, err
+			} else if !ok {
+				continue Components
+			}
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// matchPropFilter evaluates a CalDAV prop-filter (RFC 4791 section 9.7.2) or
+// CardDAV prop-filter (RFC 6352 section 10.5.1) against the properties of c.
+func matchPropFilter(c *ical.Component, f *element, card bool) (bool, error) {
+	name := strings.ToUpper(f.attr("name"))
+	var l []ical.ContentLine
+	for _, p := range c.Props {
+		if p.Name == name {
+			l = append(l, p)
+		}
+	}
+	ns := nsCalDAV
+	if card {
+		ns = nsCardDAV
+	}
+	if f.child(ns, "is-not-defined") != nil {
+		return len(l) == 0, nil
+	}
+	var tr *timeRange
+	if e := f.child(ns, "time-range"); e != nil && !card {
+		xtr, err := parseTimeRange(e)
+		if err != nil {
+			return false, err
+		}
+		tr = &xtr
+	}
+	var textMatches []textMatch
+	for _, e := range f.children(ns, "text-match") {
+		textMatches = append(textMatches, parseTextMatch(e))
+	}
+	paramFilters := f.children(ns, "param-filter")
+	allOf := card && f.attr("test") == "allof"
+
+	// For CardDAV, the text-matches and param-filters are combined with "anyof" by
+	// default. For CalDAV, all must match.
+	matchProp := func(p ical.ContentLine) bool {
+		var results []bool
+		if tr != nil {
+			t, _, err := ical.ParseDateTime(&p)
+			results = append(results, err != nil || tr.overlaps(t, t))
+		}
+		for _, tm := range textMatches {
+			results = append(results, tm.match(p.Value))
+		}
+		for _, pf := range paramFilters {
+			pname := strings.ToUpper(pf.attr("name"))
+			v, ok := p.Params[pname]
+			var r bool
+			if pf.child(ns, "is-not-defined") != nil {
+				r = !ok
+			} else if e := pf.child(ns, "text-match"); e != nil {
+				r = ok && parseTextMatch(e).match(v)
+			} else {
+				r = ok
+			}
+			results = append(results, r)
+		}
+		if len(results) == 0 {
+			return true
+		}
+		anyOf := card && !allOf
+		for _, r := range results {
+			if r && anyOf {
+				return true
+			} else if !r && !anyOf {
+				return false
+			}
+		}
+		return !anyOf
+	}
+	for _, p := range l {
+		if matchProp(p) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// matchAddressFilter evaluates a CardDAV filter (RFC 6352 section 10.5) against
+// a vCard.
+func matchAddressFilter(c *ical.Component, f *element) (bool, error) {
+	pfs := f.children(nsCardDAV, "prop-filter")
+	if len(pfs) == 0 {
+		return true, nil
+	}
+	allOf := f.attr("test") == "allof"
+	for _, pf := range pfs {
+		ok, err := matchPropFilter(c, pf, true)
+		if err != nil {
+			return false, err
+		}
+		if ok && !allOf {
+			return true, nil
+		} else if !ok && allOf {
+			return false, nil
+		}
+	}
+	return allOf, nil
+}
@@ -0,0 +1,26 @@
+package davserver
+
+import (
+	"testing"
+)
+
+func TestCalendarObject(t *testing.T) {
+	test := func(data, expComp, expUID string, expErr bool) {
+		t.Helper()
+		comp, uid, err := calendarObject(data)
+		if (err != nil) != expErr {
+			t.Fatalf("calendar object: got err %v, expected error %v", err, expErr)
+		}
+		tcompare(t, comp, expComp)
+		tcompare(t, uid, expUID)
+	}
+	test(event1, "VEVENT", "event1", false)
+	// Folded UID, and recurrence instance with the same UID.
+	test("BEGIN:VCALENDAR\r\nBEGIN:VTIMEZONE\r\nTZID:x\r\nEND:VTIMEZONE\r\nBEGIN:VEVENT\r\nUID:a\r\n b\r\nRRULE:FREQ=DAILY\r\nEND:VEVENT\r\nBEGIN:VEVENT\r\nUID:ab\r\nRECURRENCE-ID:20240101T000000Z\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n", "VEVENT", "ab", false)
+	test("BEGIN:VCALENDAR\r\nMETHOD:REQUEST\r\nBEGIN:VEVENT\r\nUID:a\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n", "", "", true)
+	test("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:a\r\nEND:VEVENT\r\nBEGIN:VEVENT\r\nUID:b\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n", "", "", true)
+	test("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:a\r\nEND:VEVENT\r\nBEGIN:VTODO\r\nUID:a\r\nEND:VTODO\r\nEND:VCALENDAR\r\n", "", "", true)
+	test("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:x\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n", "", "", true)
+	test("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:a\r\nEND:VCALENDAR\r\n", "", "", true)
+	test(card1, "", "", true)
+}
@@ -0,0 +1,1309 @@
+// Package davserver implements CalDAV and CardDAV, for calendars and address
+// books of accounts.
+//
+// Each account has a principal, and homes with calendars and address books:
+//
+//	<path>principals/<account>/
+//	<path>calendars/<account>/<calendar>/<object>
+//	<path>addressbooks/<account>/<addressbook>/<object>
+//
+// Clients authenticate with HTTP basic authentication, with an email address
+// of the account and its password, or an app password for the "dav" protocol.
+// Accounts can only access their own collections. A default calendar and address
+// book are created for accounts that have none.
+//
+// Supported are WebDAV (RFC 4918) without locking, CalDAV (RFC 4791) and CardDAV
+// (RFC 6352) without scheduling, extended MKCOL (RFC 5689) and collection
+// synchronization (RFC 6578). Recurrence rules are not expanded for time-range
+// queries, recurring events are assumed to match if they start before the end of
+// the range.
+package davserver
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"mime"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/ical"
+	"github.com/mjl-/mox/metrics"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/store"
+	"github.com/mjl-/mox/webauth"
+)
+
+var pkglog = mlog.New("dav", nil)
+
+var metricRequests = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "mox_dav_requests_total",
+		Help: "DAV requests by method and HTTP response status code.",
+	},
+	[]string{"method", "code"},
+)
+
+func init() {
+	mox.NewDAVHandler = func(basePath string, isForwarded bool) http.Handler {
+		return NewServer(basePath, isForwarded)
+	}
+}
+
+// Limits on sizes of requests and data stored.
+const (
+	maxRequestSize = 1024 * 1024 // XML request bodies.
+	maxObjectSize  = 1024 * 1024 // Calendar and address objects.
+	maxCollections = 100         // Per kind, per account.
+)
+
+// Path segments for the homes of accounts.
+var homeKinds = map[string]string{
+	"calendars":    store.DAVCalendar,
+	"addressbooks": store.DAVAddressBook,
+}
+
+func homeSegment(kind string) string {
+	if kind == store.DAVCalendar {
+		return "calendars"
+	}
+	return "addressbooks"
+}
+
+// NewServer returns an http.Handler serving CalDAV and CardDAV at path.
+func NewServer(path string, isForwarded bool) http.Handler {
+	return server{path, isForwarded}
+}
+
+type server struct {
+	path        string // Path the server is configured under, typically /dav/.
+	isForwarded bool   // Whether incoming requests are reverse-proxied. Used for getting remote IPs for rate limiting.
+}
+
+// davError is raised through panics while handling a request, and written as
+// response.
+type davError struct {
+	code      int
+	condition string // Raw XML for a precondition/postcondition element, RFC 4918 section 16.
+	msg       string
+}
+
+func (e davError) Error() string {
+	return e.msg
+}
+
+func xerrorf(code int, format string, args ...any) {
+	panic(davError{code: code, msg: fmt.Sprintf(format, args...)})
+}
+
+// xconditionf raises an error with a precondition or postcondition element.
+func xconditionf(code int, condition string, format string, args ...any) {
+	panic(davError{code, condition, fmt.Sprintf(format, args...)})
+}
+
+func xcheckf(err error, format string, args ...any) {
+	if err != nil {
+		msg := fmt.Sprintf(format, args...)
+		panic(davError{code: http.StatusInternalServerError, msg: fmt.Sprintf("%s: %s", msg, err)})
+	}
+}
+
+// responseWriter keeps track of the status code for metrics.
+type responseWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(buf []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.ResponseWriter.Write(buf)
+}
+
+// ServeHTTP implements http.Handler.
+func (s server) ServeHTTP(xw http.ResponseWriter, r *http.Request) {
+	log := pkglog.WithContext(r.Context()) // Take cid from webserver.
+
+	w := &responseWriter{ResponseWriter: xw}
+	defer func() {
+		metricRequests.WithLabelValues(r.Method, strconv.Itoa(w.code)).Inc()
+	}()
+
+	if r.Method == "OPTIONS" {
+		s.options(w)
+		return
+	}
+
+	acc, la := s.authenticate(log, w, r)
+	if la != nil {
+		defer store.LoginAttemptAdd(context.Background(), log, *la)
+	}
+	if acc == nil {
+		return
+	}
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+	log = log.With(slog.String("account", acc.Name))
+
+	defer func() {
+		x := recover()
+		if x == nil {
+			return
+		}
+		err, ok := x.(davError)
+		if !ok {
+			log.Error("unhandled panic in dav request", slog.Any("x", x))
+			metrics.PanicInc(metrics.Davserver)
+			debug.PrintStack()
+			err = davError{code: http.StatusInternalServerError, msg: "unhandled error"}
+		} else if err.code/100 == 5 {
+			log.Errorx("dav request", err)
+		} else {
+			log.Debugx("dav request", err, slog.Int("code", err.code))
+		}
+		writeError(w, err)
+	}()
+
+	err := store.DAVCollectionsEnsure(r.Context(), acc)
+	xcheckf(err, "ensuring default collections")
+
+	res := s.xresource(acc, r.URL.Path)
+	h := handler{s, log, acc, r, w}
+	switch r.Method {
+	case "PROPFIND":
+		h.propfind(res)
+	case "PROPPATCH":
+		h.proppatch(res)
+	case "REPORT":
+		h.report(res)
+	case "GET", "HEAD":
+		h.get(res)
+	case "PUT":
+		h.put(res)
+	case "DELETE":
+		h.delete(res)
+	case "MKCOL", "MKCALENDAR":
+		h.mkcol(res)
+	default:
+		w.Header().Set("Allow", allowMethods)
+		xerrorf(http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func writeError(w http.ResponseWriter, err davError) {
+	if err.condition == "" {
+		text := strings.ToLower(http.StatusText(err.code))
+		http.Error(w, fmt.Sprintf("%d - %s - %s", err.code, text, err.msg), err.code)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(err.code)
+	fmt.Fprintf(w, `%s<d:error xmlns:d="DAV:" xmlns:c="%s" xmlns:cr="%s">%s</d:error>`+"\n", xml.Header, nsCalDAV, nsCardDAV, err.condition)
+}
+
+const allowMethods = "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, PROPPATCH, REPORT, MKCOL, MKCALENDAR"
+
+func (s server) options(w http.ResponseWriter) {
+	h := w.Header()
+	h.Set("DAV", "1, 3, extended-mkcol, calendar-access, addressbook")
+	h.Set("Allow", allowMethods)
+	w.WriteHeader(http.StatusOK)
+}
+
+// authenticate checks the HTTP basic authentication credentials, with rate
+// limiting. If acc is nil, a response has been written. If la is not nil, the
+// caller must add it to the store after handling the request.
+func (s server) authenticate(log mlog.Log, w http.ResponseWriter, r *http.Request) (acc *store.Account, la *store.LoginAttempt) {
+	unauthorized := func(msg string) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="mox dav", charset="UTF-8"`)
+		http.Error(w, "401 - unauthorized - "+msg, http.StatusUnauthorized)
+	}
+
+	email, password, aok := r.BasicAuth()
+	if !aok {
+		log.Debug("missing http basic authentication credentials")
+		unauthorized("use http basic auth with email address as username")
+		return nil, nil
+	}
+	log = log.With(slog.String("username", email))
+
+	t0 := time.Now()
+
+	// If client IP/network resulted in too many authentication failures, refuse to serve.
+	clientIP := webauth.ClientIP(log, s.isForwarded, r)
+	if clientIP == nil {
+		log.Debug("cannot find remote ip for rate limiter")
+		http.Error(w, "500 - internal server error - cannot find remote ip", http.StatusInternalServerError)
+		return nil, nil
+	}
+	if !mox.LimiterFailedAuth.CanAdd(clientIP, t0, 1) {
+		metrics.AuthenticationRatelimitedInc("dav")
+		log.Debug("refusing connection due to many auth failures", slog.Any("clientip", clientIP))
+		http.Error(w, "429 - too many auth attempts", http.StatusTooManyRequests)
+		return nil, nil
+	}
+
+	la = &store.LoginAttempt{
+		RemoteIP:     clientIP.String(),
+		TLS:          store.LoginAttemptTLS(r.TLS),
+		Protocol:     "dav",
+		AuthMech:     "httpbasic",
+		UserAgent:    r.UserAgent(),
+		LoginAddress: email,
+		Result:       store.AuthError,
+	}
+
+	var err error
+	acc, la.AccountName, la.AppPasswordName, err = store.OpenEmailAuthProtocol(log, email, password, store.AppPasswordDAV, clientIP, true)
+	if err != nil {
+		mox.LimiterFailedAuth.Add(clientIP, t0, 1)
+		if errors.Is(err, mox.ErrDomainNotFound) || errors.Is(err, mox.ErrAddressNotFound) || errors.Is(err, store.ErrUnknownCredentials) || errors.Is(err, store.ErrLoginDisabled) {
+			log.Debugx("bad http basic authentication credentials", err)
+			la.Result = store.AuthBadCredentials
+			msg := "use http basic auth with email address as username"
+			if errors.Is(err, store.ErrLoginDisabled) {
+				la.Result = store.AuthLoginDisabled
+				msg = "login is disabled for this account"
+			}
+			unauthorized(msg)
+			return nil, la
+		}
+		log.Errorx("verifying credentials", err)
+		http.Error(w, "500 - internal server error - error verifying credentials", http.StatusInternalServerError)
+		return nil, la
+	}
+	la.AccountName = acc.Name
+	la.Result = store.AuthSuccess
+	mox.LimiterFailedAuth.Reset(clientIP, t0)
+	return acc, la
+}
+
+type resourceKind int
+
+const (
+	resRoot resourceKind = iota
+	resPrincipal
+	resHome
+	resCollection
+	resObject
+)
+
+// resource is the target of a request, or a resource in a multistatus response.
+type resource struct {
+	kind     resourceKind
+	collKind string // store.DAVCalendar or store.DAVAddressBook, for homes, collections and objects.
+	collName string
+	objName  string
+}
+
+// xresource parses the request path, with the base path stripped, into a
+// resource. Resources of other accounts result in an error.
+func (s server) xresource(acc *store.Account, path string) resource {
+	path = strings.TrimPrefix(path, "/")
+	path = strings.TrimSuffix(path, "/")
+	if path == "" {
+		return resource{kind: resRoot}
+	}
+	t := strings.Split(path, "/")
+	if len(t) < 2 {
+		xerrorf(http.StatusNotFound, "not found")
+	}
+	if t[1] != acc.Name {
+		xerrorf(http.StatusForbidden, "no access to resources of other accounts")
+	}
+	if t[0] == "principals" {
+		if len(t) != 2 {
+			xerrorf(http.StatusNotFound, "not found")
+		}
+		return resource{kind: resPrincipal}
+	}
+	kind, ok := homeKinds[t[0]]
+	if !ok || len(t) > 4 {
+		xerrorf(http.StatusNotFound, "not found")
+	}
+	res := resource{kind: resHome, collKind: kind}
+	if len(t) >= 3 {
+		res.kind = resCollection
+		res.collName = t[2]
+		if !validCollectionName(res.collName) {
+			xerrorf(http.StatusNotFound, "not found")
+		}
+	}
+	if len(t) == 4 {
+		res.kind = resObject
+		res.objName = t[3]
+		if !validObjectName(res.objName) {
+			xerrorf(http.StatusNotFound, "not found")
+		}
+	}
+	return res
+}
+
+// xresourceHref parses a href from a request body, as used in multiget reports.
+func (s server) xresourceHref(acc *store.Account, href string) (resource, bool) {
+	u, err := url.Parse(href)
+	if err != nil || !strings.HasPrefix(u.Path, s.path) {
+		return resource{}, false
+	}
+	var res resource
+	var ok bool
+	func() {
+		defer func() {
+			if x := recover(); x != nil {
+				if _, isErr := x.(davError); !isErr {
+					panic(x)
+				}
+			}
+		}()
+		res = s.xresource(acc, strings.TrimPrefix(u.Path, s.path))
+		ok = true
+	}()
+	return res, ok
+}
+
+func validCollectionName(s string) bool {
+	if s == "" || len(s) > 64 || s == "." || s == ".." {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func validObjectName(s string) bool {
+	if s == "" || len(s) > 255 || s == "." || s == ".." {
+		return false
+	}
+	for _, c := range s {
+		if c < 0x20 || c == 0x7f || c == '/' || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+func (s server) href(acc *store.Account, res resource) string {
+	switch res.kind {
+	case resRoot:
+		return s.path
+	case resPrincipal:
+		return s.path + "principals/" + url.PathEscape(acc.Name) + "/"
+	}
+	href := s.path + homeSegment(res.collKind) + "/" + url.PathEscape(acc.Name) + "/"
+	if res.kind == resHome {
+		return href
+	}
+	href += url.PathEscape(res.collName) + "/"
+	if res.kind == resCollection {
+		return href
+	}
+	return href + url.PathEscape(res.objName)
+}
+
+func etag(o store.DAVObject) string {
+	return `"` + strconv.FormatInt(o.ModSeq, 10) + `"`
+}
+
+func syncToken(c store.DAVCollection) string {
+	return fmt.Sprintf("data:,%d-%d", c.ID, c.ModSeq)
+}
+
+func contentType(kind string) string {
+	if kind == store.DAVCalendar {
+		return "text/calendar; charset=utf-8"
+	}
+	return "text/vcard; charset=utf-8"
+}
+
+// handler handles a single authenticated request.
+type handler struct {
+	s   server
+	log mlog.Log
+	acc *store.Account
+	r   *http.Request
+	w   http.ResponseWriter
+}
+
+// xread runs fn in a read-only transaction.
+func (h handler) xread(fn func(tx *bstore.Tx)) {
+	err := h.acc.DB.Read(h.r.Context(), func(tx *bstore.Tx) error {
+		fn(tx)
+		return nil
+	})
+	xcheckf(err, "transaction")
+}
+
+// xwrite runs fn in a read-write transaction.
+func (h handler) xwrite(fn func(tx *bstore.Tx)) {
+	err := h.acc.DB.Write(h.r.Context(), func(tx *bstore.Tx) error {
+		fn(tx)
+		return nil
+	})
+	xcheckf(err, "transaction")
+}
+
+// xcollection returns the collection of the resource. If absent, a not found
+// error is raised.
+func xcollection(tx *bstore.Tx, res resource) store.DAVCollection {
+	c, err := bstore.QueryTx[store.DAVCollection](tx).FilterNonzero(store.DAVCollection{Kind: res.collKind, Name: res.collName}).Get()
+	if err == bstore.ErrAbsent {
+		xerrorf(http.StatusNotFound, "collection not found")
+	}
+	xcheckf(err, "get collection")
+	return c
+}
+
+// object returns the object in the collection, and whether it exists.
+// Expunged objects are returned, but do not exist.
+func object(tx *bstore.Tx, c store.DAVCollection, name string) (store.DAVObject, bool) {
+	o, err := bstore.QueryTx[store.DAVObject](tx).FilterNonzero(store.DAVObject{CollectionID: c.ID, Name: name}).Get()
+	if err == bstore.ErrAbsent {
+		return store.DAVObject{}, false
+	}
+	xcheckf(err, "get object")
+	return o, !o.Expunged
+}
+
+// xbody parses the XML request body. If the body is empty, nil is returned.
+func (h handler) xbody() *element {
+	buf, err := io.ReadAll(http.MaxBytesReader(h.w, h.r.Body, maxRequestSize))
+	if err != nil {
+		xerrorf(http.StatusRequestEntityTooLarge, "reading request body: %v", err)
+	}
+	if strings.TrimSpace(string(buf)) == "" {
+		return nil
+	}
+	e, err := parseXML(strings.NewReader(string(buf)))
+	if err != nil {
+		xerrorf(http.StatusBadRequest, "parsing xml request body: %v", err)
+	}
+	return e
+}
+
+// entry is a resource with its collection and object, if any, for listing
+// properties.
+type entry struct {
+	res  resource
+	coll store.DAVCollection
+	obj  store.DAVObject
+}
+
+// Names of properties with the data of calendar and address objects. Only
+// returned when explicitly requested.
+var (
+	propCalendarData = caldav("calendar-data")
+	propAddressData  = carddav("address-data")
+)
+
+// props returns the properties of a resource. If withData is set, the data of
+// objects is included.
+func (h handler) props(e entry, withData bool) []property {
+	principal := hrefElem(h.s.href(h.acc, resource{kind: resPrincipal}))
+	readPrivileges := elem(dav("privilege"), elem(dav("read"), "")) + elem(dav("privilege"), elem(dav("read-current-user-privilege-set"), ""))
+	writePrivileges := readPrivileges
+	for _, p := range []string{"write", "write-properties", "write-content", "bind", "unbind"} {
+		writePrivileges += elem(dav("privilege"), elem(dav(p), ""))
+	}
+
+	l := []property{
+		{dav("current-user-principal"), principal},
+	}
+	add := func(name xml.Name, value string) {
+		l = append(l, property{name, value})
+	}
+	supportedReports := func(reports ...xml.Name) {
+		var v string
+		for _, r := range reports {
+			v += elem(dav("supported-report"), elem(dav("report"), elem(r, "")))
+		}
+		add(dav("supported-report-set"), v)
+	}
+
+	switch e.res.kind {
+	case resRoot:
+		add(dav("resourcetype"), elem(dav("collection"), ""))
+		add(dav("current-user-privilege-set"), readPrivileges)
+
+	case resPrincipal:
+		conf, _ := h.acc.Conf()
+		name := conf.FullName
+		if name == "" {
+			name = h.acc.Name
+		}
+		var addrs string
+		for _, addr := range slices.Sorted(maps.Keys(conf.Destinations)) {
+			if strings.Contains(addr, "@") && !strings.HasPrefix(addr, "@") {
+				addrs += hrefElem("mailto:" + addr)
+			}
+		}
+		add(dav("resourcetype"), elem(dav("principal"), ""))
+		add(dav("displayname"), xmlEscape(name))
+		add(dav("principal-URL"), principal)
+		add(caldav("calendar-home-set"), hrefElem(h.s.href(h.acc, resource{kind: resHome, collKind: store.DAVCalendar})))
+		add(carddav("addressbook-home-set"), hrefElem(h.s.href(h.acc, resource{kind: resHome, collKind: store.DAVAddressBook})))
+		add(caldav("calendar-user-address-set"), addrs)
+		add(dav("current-user-privilege-set"), readPrivileges)
+
+	case resHome:
+		add(dav("resourcetype"), elem(dav("collection"), ""))
+		add(dav("owner"), principal)
+		add(dav("current-user-privilege-set"), writePrivileges)
+
+	case resCollection:
+		c := e.coll
+		add(dav("displayname"), xmlEscape(c.DisplayName))
+		add(dav("owner"), principal)
+		add(dav("current-user-privilege-set"), writePrivileges)
+		add(dav("sync-token"), xmlEscape(syncToken(c)))
+		add(xml.Name{Space: nsCS, Local: "getctag"}, xmlEscape(syncToken(c)))
+		if c.Kind == store.DAVCalendar {
+			add(dav("resourcetype"), elem(dav("collection"), "")+elem(caldav("calendar"), ""))
+			add(caldav("calendar-description"), xmlEscape(c.Description))
+			comps := c.Components
+			if len(comps) == 0 {
+				comps = []string{"VEVENT", "VTODO", "VJOURNAL"}
+			}
+			var v string
+			for _, comp := range comps {
+				v += `<c:comp name="` + xmlEscape(comp) + `"/>`
+			}
+			add(caldav("supported-calendar-component-set"), v)
+			add(caldav("supported-calendar-data"), `<c:calendar-data content-type="text/calendar" version="2.0"/>`)
+			add(caldav("max-resource-size"), strconv.Itoa(maxObjectSize))
+			if c.Color != "" {
+				add(xml.Name{Space: nsApple, Local: "calendar-color"}, xmlEscape(c.Color))
+			}
+			supportedReports(caldav("calendar-multiget"), caldav("calendar-query"), dav("sync-collection"))
+		} else {
+			add(dav("resourcetype"), elem(dav("collection"), "")+elem(carddav("addressbook"), ""))
+			add(carddav("addressbook-description"), xmlEscape(c.Description))
+			add(carddav("supported-address-data"), `<cr:address-data-type content-type="text/vcard" version="3.0"/><cr:address-data-type content-type="text/vcard" version="4.0"/>`)
+			add(carddav("max-resource-size"), strconv.Itoa(maxObjectSize))
+			supportedReports(carddav("addressbook-multiget"), carddav("addressbook-query"), dav("sync-collection"))
+		}
+
+	case resObject:
+		o := e.obj
+		add(dav("resourcetype"), "")
+		add(dav("getetag"), xmlEscape(etag(o)))
+		add(dav("getcontenttype"), xmlEscape(contentType(e.res.collKind)))
+		add(dav("getcontentlength"), strconv.Itoa(len(o.Data)))
+		add(dav("getlastmodified"), o.Updated.UTC().Format(http.TimeFormat))
+		add(dav("owner"), principal)
+		add(dav("current-user-privilege-set"), writePrivileges)
+		if withData {
+			if e.res.collKind == store.DAVCalendar {
+				add(propCalendarData, xmlEscape(o.Data))
+			} else {
+				add(propAddressData, xmlEscape(o.Data))
+			}
+		}
+	}
+	return l
+}
+
+// propRequest is the set of properties requested in a PROPFIND or REPORT.
+type propRequest struct {
+	all      bool       // allprop
+	nameOnly bool       // propname
+	names    []xml.Name // prop
+}
+
+// parsePropRequest parses the prop, allprop or propname children of e.
+func parsePropRequest(e *element) propRequest {
+	if e == nil {
+		return propRequest{all: true}
+	}
+	if p := e.child(nsDAV, "prop"); p != nil {
+		var pr propRequest
+		for _, c := range p.Children {
+			pr.names = append(pr.names, c.Name)
+		}
+		return pr
+	}
+	if e.child(nsDAV, "propname") != nil {
+		return propRequest{nameOnly: true}
+	}
+	return propRequest{all: true}
+}
+
+// respond adds a response for e to the multistatus with the requested properties.
+func (h handler) respond(ms *multistatus, e entry, pr propRequest) {
+	href := h.s.href(h.acc, e.res)
+	withData := slices.Contains(pr.names, propCalendarData) || slices.Contains(pr.names, propAddressData)
+	props := h.props(e, withData)
+	if pr.all {
+		ms.response(href, props, nil)
+		return
+	} else if pr.nameOnly {
+		for i := range props {
+			props[i].Value = ""
+		}
+		ms.response(href, props, nil)
+		return
+	}
+	var found []property
+	var missing []xml.Name
+	for _, n := range pr.names {
+		i := slices.IndexFunc(props, func(p property) bool { return p.Name == n })
+		if i >= 0 {
+			found = append(found, props[i])
+		} else {
+			missing = append(missing, n)
+		}
+	}
+	ms.response(href, found, missing)
+}
+
+func (h handler) propfind(res resource) {
+	body := h.xbody()
+	if body != nil && !body.is(nsDAV, "propfind") {
+		xerrorf(http.StatusBadRequest, "expected propfind element")
+	}
+	pr := parsePropRequest(body)
+	// We treat depth infinity like 1, the hierarchy is shallow.
+	depth0 := h.r.Header.Get("Depth") == "0"
+
+	var entries []entry
+	h.xread(func(tx *bstore.Tx) {
+		switch res.kind {
+		case resRoot:
+			entries = append(entries, entry{res: res})
+			if !depth0 {
+				entries = append(entries,
+					entry{res: resource{kind: resPrincipal}},
+					entry{res: resource{kind: resHome, collKind: store.DAVCalendar}},
+					entry{res: resource{kind: resHome, collKind: store.DAVAddressBook}},
+				)
+			}
+
+		case resPrincipal:
+			entries = append(entries, entry{res: res})
+
+		case resHome:
+			entries = append(entries, entry{res: res})
+			if !depth0 {
+				q := bstore.QueryTx[store.DAVCollection](tx)
+				q.FilterNonzero(store.DAVCollection{Kind: res.collKind})
+				q.SortAsc("Name")
+				err := q.ForEach(func(c store.DAVCollection) error {
+					entries = append(entries, entry{res: resource{kind: resCollection, collKind: c.Kind, collName: c.Name}, coll: c})
+					return nil
+				})
+				xcheckf(err, "listing collections")
+			}
+
+		case resCollection:
+			c := xcollection(tx, res)
+			entries = append(entries, entry{res: res, coll: c})
+			if !depth0 {
+				q := bstore.QueryTx[store.DAVObject](tx)
+				q.FilterNonzero(store.DAVObject{CollectionID: c.ID})
+				q.FilterEqual("Expunged", false)
+				q.SortAsc("Name")
+				err := q.ForEach(func(o store.DAVObject) error {
+					r := res
+					r.kind = resObject
+					r.objName = o.Name
+					entries = append(entries, entry{res: r, coll: c, obj: o})
+					return nil
+				})
+				xcheckf(err, "listing objects")
+			}
+
+		case resObject:
+			c := xcollection(tx, res)
+			o, ok := object(tx, c, res.objName)
+			if !ok {
+				xerrorf(http.StatusNotFound, "object not found")
+			}
+			entries = append(entries, entry{res: res, coll: c, obj: o})
+		}
+	})
+
+	ms := newMultistatus()
+	for _, e := range entries {
+		h.respond(ms, e, pr)
+	}
+	ms.write(h.w)
+}
+
+// Properties that can be changed with PROPPATCH, per collection kind.
+var (
+	propDisplayName   = dav("displayname")
+	propCalendarDesc  = caldav("calendar-description")
+	propAddressDesc   = carddav("addressbook-description")
+	propCalendarColor = xml.Name{Space: nsApple, Local: "calendar-color"}
+	propCalendarComps = caldav("supported-calendar-component-set")
+)
+
+// xapplyProps sets (or with remove, clears) properties on collection c. Names of
+// properties that cannot be set are returned.
+func xapplyProps(c *store.DAVCollection, props []*element, remove, creating bool) (failed []xml.Name) {
+	for _, p := range props {
+		v := strings.TrimSpace(p.Text)
+		if remove {
+			v = ""
+		}
+		switch {
+		case p.Name == propDisplayName:
+			c.DisplayName = v
+		case p.Name == propCalendarDesc && c.Kind == store.DAVCalendar:
+			c.Description = v
+		case p.Name == propAddressDesc && c.Kind == store.DAVAddressBook:
+			c.Description = v
+		case p.Name == propCalendarColor && c.Kind == store.DAVCalendar:
+			c.Color = v
+		case p.Name == propCalendarComps && c.Kind == store.DAVCalendar && creating && !remove:
+			c.Components = nil
+			for _, comp := range p.children(nsCalDAV, "comp") {
+				name := strings.ToUpper(comp.attr("name"))
+				if name != "" && !slices.Contains(c.Components, name) {
+					c.Components = append(c.Components, name)
+				}
+			}
+		case p.Name == dav("resourcetype") && creating:
+			// Checked by caller.
+		default:
+			failed = append(failed, p.Name)
+		}
+	}
+	return failed
+}
+
+func (h handler) proppatch(res resource) {
+	if res.kind != resCollection {
+		xerrorf(http.StatusForbidden, "properties can only be changed on collections")
+	}
+	body := h.xbody()
+	if !body.is(nsDAV, "propertyupdate") {
+		xerrorf(http.StatusBadRequest, "expected propertyupdate element")
+	}
+
+	var all []xml.Name
+	var failed []xml.Name
+	h.xwrite(func(tx *bstore.Tx) {
+		c := xcollection(tx, res)
+		for _, e := range body.Children {
+			remove := e.is(nsDAV, "remove")
+			if !remove && !e.is(nsDAV, "set") {
+				continue
+			}
+			props := e.child(nsDAV, "prop")
+			if props == nil {
+				continue
+			}
+			for _, p := range props.Children {
+				all = append(all, p.Name)
+			}
+			failed = append(failed, xapplyProps(&c, props.Children, remove, false)...)
+		}
+		if len(failed) == 0 {
+			err := tx.Update(&c)
+			xcheckf(err, "updating collection")
+		}
+	})
+
+	// Changes are all-or-nothing. If any property failed, the others failed with
+	// status "424 failed dependency", RFC 4918 section 9.2.
+	codes := []int{http.StatusOK}
+	props := map[int][]property{}
+	if len(failed) > 0 {
+		codes = []int{http.StatusForbidden, http.StatusFailedDependency}
+	}
+	for _, n := range all {
+		code := http.StatusOK
+		if slices.Contains(failed, n) {
+			code = http.StatusForbidden
+		} else if len(failed) > 0 {
+			code = http.StatusFailedDependency
+		}
+		props[code] = append(props[code], property{Name: n})
+	}
+	codes = slices.DeleteFunc(codes, func(code int) bool { return len(props[code]) == 0 })
+	ms := newMultistatus()
+	ms.responsePropstats(h.s.href(h.acc, res), codes, props)
+	ms.write(h.w)
+}
+
+func (h handler) mkcol(res resource) {
+	if res.kind != resCollection {
+		xerrorf(http.StatusForbidden, "collections can only be created in a calendar or address book home")
+	}
+	body := h.xbody()
+	var props []*element
+	if body != nil {
+		if h.r.Method == "MKCALENDAR" && !body.is(nsCalDAV, "mkcalendar") || h.r.Method == "MKCOL" && !body.is(nsDAV, "mkcol") {
+			xerrorf(http.StatusBadRequest, "unexpected element %s in request body", body.Name.Local)
+		}
+		for _, set := range body.children(nsDAV, "set") {
+			if p := set.child(nsDAV, "prop"); p != nil {
+				props = append(props, p.Children...)
+			}
+		}
+	}
+	if h.r.Method == "MKCALENDAR" && res.collKind != store.DAVCalendar {
+		xerrorf(http.StatusForbidden, "calendars can only be created in the calendar home")
+	}
+	// Only calendars and address books can be created, their kind is determined by
+	// the home. An explicit resourcetype must match.
+	for _, p := range props {
+		if p.Name != dav("resourcetype") {
+			continue
+		}
+		var calendar, addressBook bool
+		for _, rt := range p.Children {
+			switch {
+			case rt.is(nsCalDAV, "calendar"):
+				calendar = true
+			case rt.is(nsCardDAV, "addressbook"):
+				addressBook = true
+			case rt.is(nsDAV, "collection"):
+			default:
+				xconditionf(http.StatusForbidden, elem(dav("valid-resourcetype"), ""), "unsupported resource type %s", rt.Name.Local)
+			}
+		}
+		if calendar && res.collKind != store.DAVCalendar || addressBook && res.collKind != store.DAVAddressBook {
+			xconditionf(http.StatusForbidden, elem(dav("valid-resourcetype"), ""), "resource type does not match home")
+		}
+	}
+
+	h.xwrite(func(tx *bstore.Tx) {
+		q := bstore.QueryTx[store.DAVCollection](tx)
+		q.FilterNonzero(store.DAVCollection{Kind: res.collKind})
+		n, err := q.Count()
+		xcheckf(err, "counting collections")
+		if n >= maxCollections {
+			xerrorf(http.StatusInsufficientStorage, "too many collections")
+		}
+		exists, err := bstore.QueryTx[store.DAVCollection](tx).FilterNonzero(store.DAVCollection{Kind: res.collKind, Name: res.collName}).Exists()
+		xcheckf(err, "checking if collection exists")
+		if exists {
+			xerrorf(http.StatusMethodNotAllowed, "collection already exists")
+		}
+
+		c := store.DAVCollection{
+			Kind:        res.collKind,
+			Name:        res.collName,
+			DisplayName: res.collName,
+		}
+		if c.Kind == store.DAVCalendar {
+			c.Components = []string{"VEVENT", "VTODO"}
+		}
+		if failed := xapplyProps(&c, props, false, true); len(failed) > 0 {
+			xerrorf(http.StatusForbidden, "cannot set property %s", failed[0].Local)
+		}
+		err = tx.Insert(&c)
+		xcheckf(err, "inserting collection")
+	})
+	h.log.Debug("dav collection created", slog.String("kind", res.collKind), slog.String("name", res.collName))
+	h.w.Header().Set("Cache-Control", "no-cache")
+	h.w.WriteHeader(http.StatusCreated)
+}
+
+func (h handler) delete(res resource) {
+	switch res.kind {
+	case resCollection:
+		h.xwrite(func(tx *bstore.Tx) {
+			c := xcollection(tx, res)
+			var size int64
+			q := bstore.QueryTx[store.DAVObject](tx)
+			q.FilterNonzero(store.DAVObject{CollectionID: c.ID})
+			err := q.ForEach(func(o store.DAVObject) error {
+				size += int64(len(o.Data))
+				return nil
+			})
+			xcheckf(err, "gathering object sizes")
+			_, err = bstore.QueryTx[store.DAVObject](tx).FilterNonzero(store.DAVObject{CollectionID: c.ID}).Delete()
+			xcheckf(err, "removing objects")
+			err = store.DAVSizeAdd(tx, -size)
+			xcheckf(err, "updating disk usage")
+			err = tx.Delete(&c)
+			xcheckf(err, "removing collection")
+		})
+
+	case resObject:
+		h.xwrite(func(tx *bstore.Tx) {
+			c := xcollection(tx, res)
+			o, ok := object(tx, c, res.objName)
+			if !ok {
+				xerrorf(http.StatusNotFound, "object not found")
+			}
+			if m := h.r.Header.Get("If-Match"); m != "" && m != "*" && m != etag(o) {
+				xerrorf(http.StatusPreconditionFailed, "etag does not match")
+			}
+			// Keep a tombstone, for synchronization.
+			c.ModSeq++
+			err := tx.Update(&c)
+			xcheckf(err, "updating collection")
+			err = store.DAVSizeAdd(tx, -int64(len(o.Data)))
+			xcheckf(err, "updating disk usage")
+			o.ModSeq = c.ModSeq
+			o.Updated = time.Now()
+			o.Expunged = true
+			o.UID = ""
+			o.Data = ""
+			err = tx.Update(&o)
+			xcheckf(err, "marking object as removed")
+		})
+
+	default:
+		xerrorf(http.StatusForbidden, "resource cannot be removed")
+	}
+	h.w.WriteHeader(http.StatusNoContent)
+}
+
+func (h handler) get(res resource) {
+	if res.kind != resObject {
+		h.w.Header().Set("Allow", "OPTIONS, PROPFIND, PROPPATCH, REPORT, DELETE")
+		xerrorf(http.StatusMethodNotAllowed, "only objects can be retrieved")
+	}
+	var o store.DAVObject
+	h.xread(func(tx *bstore.Tx) {
+		c := xcollection(tx, res)
+		var ok bool
+		o, ok = object(tx, c, res.objName)
+		if !ok {
+			xerrorf(http.StatusNotFound, "object not found")
+		}
+	})
+	hdr := h.w.Header()
+	hdr.Set("ETag", etag(o))
+	hdr.Set("Last-Modified", o.Updated.UTC().Format(http.TimeFormat))
+	hdr.Set("Content-Type", contentType(res.collKind))
+	hdr.Set("Cache-Control", "no-cache, max-age=0")
+	if m := h.r.Header.Get("If-None-Match"); m != "" && (m == "*" || m == etag(o)) {
+		h.w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	hdr.Set("Content-Length", strconv.Itoa(len(o.Data)))
+	h.w.WriteHeader(http.StatusOK)
+	if h.r.Method != "HEAD" {
+		_, err := h.w.Write([]byte(o.Data))
+		h.log.Check(err, "writing object")
+	}
+}
+
+func (h handler) put(res resource) {
+	if res.kind != resObject {
+		xerrorf(http.StatusMethodNotAllowed, "only objects can be stored")
+	}
+
+	cond := func(name xml.Name) string {
+		return elem(name, "")
+	}
+	buf, err := io.ReadAll(io.LimitReader(h.r.Body, maxObjectSize+1))
+	xcheckf(err, "reading request body")
+	if len(buf) > maxObjectSize {
+		if res.collKind == store.DAVCalendar {
+			xconditionf(http.StatusForbidden, cond(caldav("max-resource-size")), "object too large")
+		}
+		xconditionf(http.StatusForbidden, cond(carddav("max-resource-size")), "object too large")
+	}
+	data := string(buf)
+
+	// Check the content type, if any.
+	mt, _, _ := mime.ParseMediaType(h.r.Header.Get("Content-Type"))
+	var compName, uid string
+	if res.collKind == store.DAVCalendar {
+		if mt != "" && mt != "text/calendar" {
+			xconditionf(http.StatusForbidden, cond(caldav("supported-calendar-data")), "content-type must be text/calendar")
+		}
+		compName, uid, err = calendarObject(data)
+		if err != nil {
+			xconditionf(http.StatusForbidden, cond(caldav("valid-calendar-object-resource")), "invalid calendar object: %v", err)
+		}
+	} else {
+		if mt != "" && mt != "text/vcard" && mt != "text/x-vcard" && mt != "text/directory" {
+			xconditionf(http.StatusForbidden, cond(carddav("supported-address-data")), "content-type must be text/vcard")
+		}
+		compName = "VCARD"
+		uid, err = addressObject(data)
+		if err != nil {
+			xconditionf(http.StatusForbidden, cond(carddav("valid-address-data")), "invalid address object: %v", err)
+		}
+	}
+
+	var o store.DAVObject
+	var created bool
+	h.xwrite(func(tx *bstore.Tx) {
+		c := xcollection(tx, res)
+		if c.Kind == store.DAVCalendar && len(c.Components) > 0 && !slices.Contains(c.Components, compName) {
+			xconditionf(http.StatusForbidden, cond(caldav("supported-calendar-component")), "calendar does not support %s components", compName)
+		}
+
+		var exists bool
+		o, exists = object(tx, c, res.objName)
+		if m := h.r.Header.Get("If-None-Match"); m == "*" && exists {
+			xerrorf(http.StatusPreconditionFailed, "object already exists")
+		}
+		if m := h.r.Header.Get("If-Match"); m != "" && (!exists || m != "*" && m != etag(o)) {
+			xerrorf(http.StatusPreconditionFailed, "etag does not match")
+		}
+
+		// UIDs must be unique within a collection, RFC 4791 section 5.3.2.1 and RFC 6352
+		// section 6.3.2.1.
+		if uid != "" {
+			q := bstore.QueryTx[store.DAVObject](tx)
+			q.FilterNonzero(store.DAVObject{CollectionID: c.ID, UID: uid})
+			q.FilterNotEqual("Name", res.objName)
+			other, err := q.Get()
+			if err == nil {
+				r := res
+				r.objName = other.Name
+				condName := caldav("no-uid-conflict")
+				if c.Kind == store.DAVAddressBook {
+					condName = carddav("no-uid-conflict")
+				}
+				xconditionf(http.StatusForbidden, elem(condName, hrefElem(h.s.href(h.acc, r))), "object with same uid already exists")
+			} else if err != bstore.ErrAbsent {
+				xcheckf(err, "checking for uid conflict")
+			}
+		}
+
+		// Like messages, object data counts towards the quota, RFC 4331 section 6.
+		size := int64(len(data) - len(o.Data))
+		if size > 0 {
+			ok, maxSize, err := h.acc.CanAddMessageSize(tx, size)
+			xcheckf(err, "checking quota")
+			if !ok {
+				xconditionf(http.StatusInsufficientStorage, cond(dav("quota-not-exceeded")), "account over quota, max size %d bytes", maxSize)
+			}
+		}
+		err := store.DAVSizeAdd(tx, size)
+		xcheckf(err, "updating disk usage")
+
+		c.ModSeq++
+		err = tx.Update(&c)
+		xcheckf(err, "updating collection")
+
+		created = !exists
+		if o.ID == 0 {
+			o = store.DAVObject{CollectionID: c.ID, Name: res.objName}
+		}
+		o.UID = uid
+		o.Component = compName
+		o.ModSeq = c.ModSeq
+		o.Updated = time.Now()
+		o.Expunged = false
+		o.Data = data
+		if o.ID == 0 {
+			err = tx.Insert(&o)
+		} else {
+			err = tx.Update(&o)
+		}
+		xcheckf(err, "storing object")
+	})
+
+	h.w.Header().Set("ETag", etag(o))
+	if created {
+		h.w.WriteHeader(http.StatusCreated)
+	} else {
+		h.w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (h handler) report(res resource) {
+	body := h.xbody()
+	if body == nil {
+		xerrorf(http.StatusBadRequest, "missing report request")
+	}
+	switch {
+	case body.is(nsCalDAV, "calendar-multiget") && res.collKind == store.DAVCalendar,
+		body.is(nsCardDAV, "addressbook-multiget") && res.collKind == store.DAVAddressBook:
+		h.reportMultiget(res, body)
+	case body.is(nsCalDAV, "calendar-query") && res.collKind == store.DAVCalendar,
+		body.is(nsCardDAV, "addressbook-query") && res.collKind == store.DAVAddressBook:
+		h.reportQuery(res, body)
+	case body.is(nsDAV, "sync-collection"):
+		h.reportSync(res, body)
+	default:
+		xconditionf(http.StatusForbidden, elem(dav("supported-report"), ""), "unsupported report %s", body.Name.Local)
+	}
+}
+
+func (h handler) reportMultiget(res resource, body *element) {
+	if res.kind != resCollection && res.kind != resObject {
+		xerrorf(http.StatusForbidden, "multiget report only on collections")
+	}
+	pr := parsePropRequest(body)
+	ms := newMultistatus()
+	h.xread(func(tx *bstore.Tx) {
+		c := xcollection(tx, res)
+		for _, he := range body.children(nsDAV, "href") {
+			href := strings.TrimSpace(he.Text)
+			r, ok := h.s.xresourceHref(h.acc, href)
+			if !ok || r.kind != resObject || r.collKind != res.collKind || r.collName != res.collName {
+				ms.responseStatus(href, http.StatusNotFound)
+				continue
+			}
+			o, ok := object(tx, c, r.objName)
+			if !ok {
+				ms.responseStatus(href, http.StatusNotFound)
+				continue
+			}
+			h.respond(ms, entry{r, c, o}, pr)
+		}
+	})
+	ms.write(h.w)
+}
+
+func (h handler) reportQuery(res resource, body *element) {
+	if res.kind != resCollection && res.kind != resObject {
+		xerrorf(http.StatusForbidden, "query report only on collections and objects")
+	}
+	pr := parsePropRequest(body)
+
+	var filter *element
+	var limit int
+	if res.collKind == store.DAVCalendar {
+		filter = body.child(nsCalDAV, "filter")
+		if filter == nil || len(filter.children(nsCalDAV, "comp-filter")) != 1 {
+			xconditionf(http.StatusForbidden, elem(caldav("valid-filter"), ""), "filter must have a single comp-filter")
+		}
+	} else {
+		filter = body.child(nsCardDAV, "filter")
+		if filter == nil {
+			xconditionf(http.StatusForbidden, elem(carddav("valid-filter"), ""), "missing filter")
+		}
+		if l := body.child(nsCardDAV, "limit"); l != nil {
+			if n := l.child(nsCardDAV, "nresults"); n != nil {
+				v, err := strconv.ParseInt(strings.TrimSpace(n.Text), 10, 32)
+				if err != nil || v < 0 {
+					xerrorf(http.StatusBadRequest, "invalid nresults")
+				}
+				limit = int(v)
+			}
+		}
+	}
+
+	ms := newMultistatus()
+	var truncated bool
+	h.xread(func(tx *bstore.Tx) {
+		c := xcollection(tx, res)
+		q := bstore.QueryTx[store.DAVObject](tx)
+		q.FilterNonzero(store.DAVObject{CollectionID: c.ID})
+		q.FilterEqual("Expunged", false)
+		if res.kind == resObject {
+			q.FilterNonzero(store.DAVObject{Name: res.objName})
+		}
+		q.SortAsc("Name")
+		var n int
+		err := q.ForEach(func(o store.DAVObject) error {
+			comp, err := ical.Parse(o.Data)
+			if err != nil {
+				h.log.Debugx("parsing stored object, skipping", err, slog.Int64("id", o.ID))
+				return nil
+			}
+			var match bool
+			if res.collKind == store.DAVCalendar {
+				match, err = matchCompFilter([]*ical.Component{comp}, filter.child(nsCalDAV, "comp-filter"))
+			} else {
+				match, err = matchAddressFilter(comp, filter)
+			}
+			if err != nil {
+				xconditionf(http.StatusForbidden, elem(caldav("valid-filter"), ""), "evaluating filter: %v", err)
+			}
+			if !match {
+				return nil
+			}
+			if limit > 0 && n >= limit {
+				truncated = true
+				return bstore.StopForEach
+			}
+			n++
+			r := res
+			r.kind = resObject
+			r.objName = o.Name
+			h.respond(ms, entry{r, c, o}, pr)
+			return nil
+		})
+		xcheckf(err, "querying objects")
+	})
+	if truncated {
+		// RFC 6352 section 8.6.1.
+		ms.b.WriteString("<d:response>" + hrefElem(h.s.href(h.acc, res)) + elem(dav("status"), statusLine(http.StatusInsufficientStorage)) + elem(dav("error"), elem(dav("number-of-matches-within-limits"), "")) + "</d:response>\n")
+	}
+	ms.write(h.w)
+}
+
+func (h handler) reportSync(res resource, body *element) {
+	if res.kind != resCollection {
+		xerrorf(http.StatusForbidden, "sync-collection report only on collections")
+	}
+	if h.r.Header.Get("Depth") != "" && h.r.Header.Get("Depth") != "0" {
+		xerrorf(http.StatusBadRequest, "depth must be 0 for sync-collection")
+	}
+	if l := body.child(nsDAV, "sync-level"); l != nil && strings.TrimSpace(l.Text) != "1" {
+		xerrorf(http.StatusForbidden, "only sync-level 1 is supported")
+	}
+	pr := parsePropRequest(body)
+	var token string
+	if e := body.child(nsDAV, "sync-token"); e != nil {
+		token = strings.TrimSpace(e.Text)
+	}
+
+	ms := newMultistatus()
+	h.xread(func(tx *bstore.Tx) {
+		c := xcollection(tx, res)
+
+		var since int64
+		if token != "" {
+			var collID int64
+			_, err := fmt.Sscanf(token, "data:,%d-%d", &collID, &since)
+			if err != nil || collID != c.ID || since > c.ModSeq || syncToken(store.DAVCollection{ID: collID, ModSeq: since}) != token {
+				xconditionf(http.StatusForbidden, elem(dav("valid-sync-token"), ""), "invalid sync token")
+			}
+		}
+
+		q := bstore.QueryTx[store.DAVObject](tx)
+		q.FilterNonzero(store.DAVObject{CollectionID: c.ID})
+		q.FilterGreater("ModSeq", since)
+		if token == "" {
+			q.FilterEqual("Expunged", false)
+		}
+		q.SortAsc("ModSeq")
+		err := q.ForEach(func(o store.DAVObject) error {
+			r := res
+			r.kind = resObject
+			r.objName = o.Name
+			if o.Expunged {
+				ms.responseStatus(h.s.href(h.acc, r), http.StatusNotFound)
+			} else {
+				h.respond(ms, entry{r, c, o}, pr)
+			}
+			return nil
+		})
+		xcheckf(err, "listing changes")
+		ms.syncToken(syncToken(c))
+	})
+	ms.write(h.w)
+}
@@ -0,0 +1,333 @@
+package davserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/store"
+)
+
+var ctxbg = context.Background()
+
+func tcheckf(t *testing.T, err error, format string, args ...any) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %s", fmt.Sprintf(format, args...), err)
+	}
+}
+
+func tcompare(t *testing.T, got, expect any) {
+	t.Helper()
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("got:\n%#v\nexpected:\n%#v", got, expect)
+	}
+}
+
+const event1 = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:test\r\nBEGIN:VEVENT\r\nUID:event1\r\nDTSTAMP:20240101T000000Z\r\nDTSTART:20240110T100000Z\r\nDTEND:20240110T110000Z\r\nSUMMARY:Team\r\n meeting\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+const event2 = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:test\r\nBEGIN:VEVENT\r\nUID:event2\r\nDTSTAMP:20240101T000000Z\r\nDTSTART;VALUE=DATE:20240301\r\nDURATION:P1D\r\nSUMMARY:Holiday\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+const card1 = "BEGIN:VCARD\r\nVERSION:4.0\r\nUID:card1\r\nFN:Alice Example\r\nitem1.EMAIL;TYPE=work:alice@example.org\r\nEND:VCARD\r\n"
+const card2 = "BEGIN:VCARD\r\nVERSION:3.0\r\nUID:card2\r\nFN:Bob Example\r\nEMAIL:bob@example.org\r\nEND:VCARD\r\n"
+
+func TestServer(t *testing.T) {
+	mox.LimitersInit()
+	os.RemoveAll("../testdata/davserver/data")
+	mox.Context = ctxbg
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/davserver/mox.conf")
+	mox.MustLoadConfig(true, false)
+	err := store.Init(ctxbg)
+	tcheckf(t, err, "store init")
+	defer func() {
+		err := store.Close()
+		tcheckf(t, err, "store close")
+	}()
+	defer store.Switchboard()()
+
+	log := mlog.New("davserver", nil)
+	acc, err := store.OpenAccount(log, "mjl", false)
+	tcheckf(t, err, "open account")
+	const password = "test1234"
+	err = acc.SetPassword(log, password)
+	tcheckf(t, err, "set password")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+		acc.WaitClosed()
+	}()
+
+	s := NewServer("/dav/", false)
+
+	// do makes a request and checks the response status code.
+	do := func(method, path string, headers map[string]string, body string, expCode int) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.SetBasicAuth("mjl@mox.example", password)
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		if w.Code != expCode {
+			t.Fatalf("%s %s: got status %d, expected %d, body %q", method, path, w.Code, expCode, w.Body.String())
+		}
+		return w
+	}
+	doBody := func(method, path string, headers map[string]string, body string, expCode int) string {
+		t.Helper()
+		return do(method, path, headers, body, expCode).Body.String()
+	}
+	contains := func(body string, l ...string) {
+		t.Helper()
+		for _, s := range l {
+			if !strings.Contains(body, s) {
+				t.Fatalf("body does not contain %q:\n%s", s, body)
+			}
+		}
+	}
+	notContains := func(body string, l ...string) {
+		t.Helper()
+		for _, s := range l {
+			if strings.Contains(body, s) {
+				t.Fatalf("body unexpectedly contains %q:\n%s", s, body)
+			}
+		}
+	}
+
+	// OPTIONS does not require authentication.
+	r := httptest.NewRequest("OPTIONS", "/", nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	tcompare(t, w.Code, http.StatusOK)
+	contains(w.Header().Get("DAV"), "calendar-access", "addressbook")
+
+	// Bad credentials.
+	r = httptest.NewRequest("PROPFIND", "/", nil)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	tcompare(t, w.Code, http.StatusUnauthorized)
+	r = httptest.NewRequest("PROPFIND", "/", nil)
+	r.SetBasicAuth("mjl@mox.example", "bad")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	tcompare(t, w.Code, http.StatusUnauthorized)
+	mox.LimitersInit()
+
+	// Discovery, through current-user-principal and the homes.
+	const propfindPrincipal = `<?xml version="1.0"?><d:propfind xmlns:d="DAV:"><d:prop><d:current-user-principal/></d:prop></d:propfind>`
+	body := doBody("PROPFIND", "/", map[string]string{"Depth": "0"}, propfindPrincipal, http.StatusMultiStatus)
+	contains(body, "<d:href>/dav/principals/mjl/</d:href>")
+
+	const propfindHomes = `<?xml version="1.0"?><d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav" xmlns:cr="urn:ietf:params:xml:ns:carddav"><d:prop><c:calendar-home-set/><cr:addressbook-home-set/><d:displayname/><d:unknown/></d:prop></d:propfind>`
+	body = doBody("PROPFIND", "/principals/mjl/", map[string]string{"Depth": "0"}, propfindHomes, http.StatusMultiStatus)
+	contains(body, "/dav/calendars/mjl/", "/dav/addressbooks/mjl/", "Mox Jl", "HTTP/1.1 404 Not Found", "<d:unknown/>")
+
+	// Other accounts are not accessible.
+	do("PROPFIND", "/principals/other/", nil, "", http.StatusForbidden)
+	do("PROPFIND", "/calendars/other/default/", nil, "", http.StatusForbidden)
+
+	// Default collections exist.
+	body = doBody("PROPFIND", "/calendars/mjl/", map[string]string{"Depth": "1"}, "", http.StatusMultiStatus)
+	contains(body, "/dav/calendars/mjl/default/", "<c:calendar/>", `<c:comp name="VEVENT"/>`)
+	body = doBody("PROPFIND", "/addressbooks/mjl/", map[string]string{"Depth": "1"}, "", http.StatusMultiStatus)
+	contains(body, "/dav/addressbooks/mjl/default/", "<cr:addressbook/>")
+
+	// Create a calendar with properties.
+	const mkcalendar = `<?xml version="1.0"?><c:mkcalendar xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:set><d:prop><d:displayname>Work</d:displayname><c:supported-calendar-component-set><c:comp name="VEVENT"/></c:supported-calendar-component-set></d:prop></d:set></c:mkcalendar>`
+	do("MKCALENDAR", "/calendars/mjl/work/", nil, mkcalendar, http.StatusCreated)
+	do("MKCALENDAR", "/calendars/mjl/work/", nil, "", http.StatusMethodNotAllowed)
+	do("MKCALENDAR", "/addressbooks/mjl/work/", nil, "", http.StatusForbidden)
+	body = doBody("PROPFIND", "/calendars/mjl/work/", map[string]string{"Depth": "0"}, "", http.StatusMultiStatus)
+	contains(body, "<d:displayname>Work</d:displayname>")
+	notContains(body, `<c:comp name="VTODO"/>`)
+
+	// Create an address book with extended mkcol, resource type must match home.
+	const mkcolAddressBook = `<?xml version="1.0"?><d:mkcol xmlns:d="DAV:" xmlns:cr="urn:ietf:params:xml:ns:carddav"><d:set><d:prop><d:resourcetype><d:collection/><cr:addressbook/></d:resourcetype><d:displayname>Family</d:displayname></d:prop></d:set></d:mkcol>`
+	do("MKCOL", "/addressbooks/mjl/family/", nil, mkcolAddressBook, http.StatusCreated)
+	do("MKCOL", "/calendars/mjl/family/", nil, mkcolAddressBook, http.StatusForbidden)
+
+	// Sync token of empty calendar, for later.
+	const syncInitial = `<?xml version="1.0"?><d:sync-collection xmlns:d="DAV:"><d:sync-token/><d:sync-level>1</d:sync-level><d:prop><d:getetag/></d:prop></d:sync-collection>`
+	body = doBody("REPORT", "/calendars/mjl/work/", nil, syncInitial, http.StatusMultiStatus)
+	token0 := between(body, "<d:sync-token>", "</d:sync-token>")
+
+	// Store events.
+	calHdrs := map[string]string{"Content-Type": "text/calendar; charset=utf-8", "If-None-Match": "*"}
+	resp := do("PUT", "/calendars/mjl/work/event1.ics", calHdrs, event1, http.StatusCreated)
+	etag1 := resp.Header().Get("ETag")
+	do("PUT", "/calendars/mjl/work/event1.ics", calHdrs, event1, http.StatusPreconditionFailed)
+	do("PUT", "/calendars/mjl/work/event2.ics", calHdrs, event2, http.StatusCreated)
+
+	// Same UID under other name is refused.
+	body = doBody("PUT", "/calendars/mjl/work/other.ics", calHdrs, event1, http.StatusForbidden)
+	contains(body, "no-uid-conflict", "/dav/calendars/mjl/work/event1.ics")
+
+	// Invalid data, wrong component type and content-type are refused.
+	do("PUT", "/calendars/mjl/work/bad.ics", calHdrs, "BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n", http.StatusForbidden)
+	todo := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nBEGIN:VTODO\r\nUID:todo1\r\nEND:VTODO\r\nEND:VCALENDAR\r\n"
+	body = doBody("PUT", "/calendars/mjl/work/todo.ics", calHdrs, todo, http.StatusForbidden)
+	contains(body, "supported-calendar-component")
+	do("PUT", "/calendars/mjl/default/todo.ics", calHdrs, todo, http.StatusCreated)
+	do("PUT", "/calendars/mjl/work/x.ics", map[string]string{"Content-Type": "text/plain"}, event1, http.StatusForbidden)
+
+	// Get, with etag.
+	resp = do("GET", "/calendars/mjl/work/event1.ics", nil, "", http.StatusOK)
+	tcompare(t, resp.Header().Get("ETag"), etag1)
+	tcompare(t, resp.Header().Get("Content-Type"), "text/calendar; charset=utf-8")
+	do("GET", "/calendars/mjl/work/event1.ics", map[string]string{"If-None-Match": etag1}, "", http.StatusNotModified)
+	do("GET", "/calendars/mjl/work/absent.ics", nil, "", http.StatusNotFound)
+	do("GET", "/calendars/mjl/absent/event1.ics", nil, "", http.StatusNotFound)
+
+	// Update with If-Match.
+	updated := strings.ReplaceAll(event1, "Team", "All hands")
+	do("PUT", "/calendars/mjl/work/event1.ics", map[string]string{"If-Match": `"bogus"`}, updated, http.StatusPreconditionFailed)
+	resp = do("PUT", "/calendars/mjl/work/event1.ics", map[string]string{"If-Match": etag1}, updated, http.StatusNoContent)
+	if resp.Header().Get("ETag") == etag1 {
+		t.Fatalf("etag not changed after update")
+	}
+
+	// Calendar query with time range.
+	query := func(start, end string) string {
+		return `<?xml version="1.0"?><c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:prop><d:getetag/></d:prop><c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VEVENT"><c:time-range start="` + start + `" end="` + end + `"/></c:comp-filter></c:comp-filter></c:filter></c:calendar-query>`
+	}
+	body = doBody("REPORT", "/calendars/mjl/work/", map[string]string{"Depth": "1"}, query("20240110T000000Z", "20240111T000000Z"), http.StatusMultiStatus)
+	contains(body, "event1.ics")
+	notContains(body, "event2.ics")
+	body = doBody("REPORT", "/calendars/mjl/work/", map[string]string{"Depth": "1"}, query("20240301T120000Z", "20240302T000000Z"), http.StatusMultiStatus)
+	contains(body, "event2.ics")
+	notContains(body, "event1.ics")
+	body = doBody("REPORT", "/calendars/mjl/work/", map[string]string{"Depth": "1"}, query("20240201T000000Z", "20240202T000000Z"), http.StatusMultiStatus)
+	notContains(body, "event1.ics", "event2.ics")
+
+	// Text match on a property.
+	const textQuery = `<?xml version="1.0"?><c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:prop><c:calendar-data/></d:prop><c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VEVENT"><c:prop-filter name="SUMMARY"><c:text-match>hands</c:text-match></c:prop-filter></c:comp-filter></c:comp-filter></c:filter></c:calendar-query>`
+	body = doBody("REPORT", "/calendars/mjl/work/", map[string]string{"Depth": "1"}, textQuery, http.StatusMultiStatus)
+	contains(body, "event1.ics", "BEGIN:VCALENDAR")
+	notContains(body, "event2.ics")
+
+	// Multiget.
+	const multiget = `<?xml version="1.0"?><c:calendar-multiget xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:prop><d:getetag/><c:calendar-data/></d:prop><d:href>/dav/calendars/mjl/work/event2.ics</d:href><d:href>/dav/calendars/mjl/work/absent.ics</d:href></c:calendar-multiget>`
+	body = doBody("REPORT", "/calendars/mjl/work/", nil, multiget, http.StatusMultiStatus)
+	contains(body, "UID:event2", "HTTP/1.1 404 Not Found")
+
+	// Remove an event, and check it is reported by sync.
+	do("DELETE", "/calendars/mjl/work/event2.ics", nil, "", http.StatusNoContent)
+	do("GET", "/calendars/mjl/work/event2.ics", nil, "", http.StatusNotFound)
+	do("DELETE", "/calendars/mjl/work/event2.ics", nil, "", http.StatusNotFound)
+
+	syncSince := func(token string) string {
+		return `<?xml version="1.0"?><d:sync-collection xmlns:d="DAV:"><d:sync-token>` + token + `</d:sync-token><d:sync-level>1</d:sync-level><d:prop><d:getetag/></d:prop></d:sync-collection>`
+	}
+	body = doBody("REPORT", "/calendars/mjl/work/", nil, syncSince(token0), http.StatusMultiStatus)
+	contains(body, "event1.ics", "event2.ics", "HTTP/1.1 404 Not Found")
+	token1 := between(body, "<d:sync-token>", "</d:sync-token>")
+	body = doBody("REPORT", "/calendars/mjl/work/", nil, syncSince(token1), http.StatusMultiStatus)
+	notContains(body, "event1.ics", "event2.ics")
+	// Initial sync does not include removed objects.
+	body = doBody("REPORT", "/calendars/mjl/work/", nil, syncInitial, http.StatusMultiStatus)
+	contains(body, "event1.ics")
+	notContains(body, "event2.ics")
+	body = doBody("REPORT", "/calendars/mjl/work/", nil, syncSince("data:,999-1"), http.StatusForbidden)
+	contains(body, "valid-sync-token")
+
+	// Storing an object again after removal.
+	do("PUT", "/calendars/mjl/work/event2.ics", calHdrs, event2, http.StatusCreated)
+
+	// Change collection properties.
+	const proppatch = `<?xml version="1.0"?><d:propertyupdate xmlns:d="DAV:" xmlns:a="http://apple.com/ns/ical/"><d:set><d:prop><d:displayname>Work stuff</d:displayname><a:calendar-color>#ff0000ff</a:calendar-color></d:prop></d:set></d:propertyupdate>`
+	body = doBody("PROPPATCH", "/calendars/mjl/work/", nil, proppatch, http.StatusMultiStatus)
+	contains(body, "HTTP/1.1 200 OK")
+	const proppatchBad = `<?xml version="1.0"?><d:propertyupdate xmlns:d="DAV:"><d:set><d:prop><d:displayname>Other</d:displayname><d:getetag>x</d:getetag></d:prop></d:set></d:propertyupdate>`
+	body = doBody("PROPPATCH", "/calendars/mjl/work/", nil, proppatchBad, http.StatusMultiStatus)
+	contains(body, "HTTP/1.1 403 Forbidden", "HTTP/1.1 424 Failed Dependency")
+	body = doBody("PROPFIND", "/calendars/mjl/work/", map[string]string{"Depth": "0"}, "", http.StatusMultiStatus)
+	contains(body, "Work stuff", "#ff0000ff")
+
+	// Address books.
+	cardHdrs := map[string]string{"Content-Type": "text/vcard"}
+	do("PUT", "/addressbooks/mjl/family/card1.vcf", cardHdrs, card1, http.StatusCreated)
+	do("PUT", "/addressbooks/mjl/family/card2.vcf", cardHdrs, card2, http.StatusCreated)
+	do("PUT", "/addressbooks/mjl/family/bad.vcf", cardHdrs, event1, http.StatusForbidden)
+	resp = do("GET", "/addressbooks/mjl/family/card1.vcf", nil, "", http.StatusOK)
+	tcompare(t, resp.Header().Get("Content-Type"), "text/vcard; charset=utf-8")
+
+	const addressQuery = `<?xml version="1.0"?><cr:addressbook-query xmlns:d="DAV:" xmlns:cr="urn:ietf:params:xml:ns:carddav"><d:prop><d:getetag/><cr:address-data/></d:prop><cr:filter><cr:prop-filter name="EMAIL"><cr:text-match match-type="ends-with">@example.org</cr:text-match></cr:prop-filter></cr:filter></cr:addressbook-query>`
+	body = doBody("REPORT", "/addressbooks/mjl/family/", map[string]string{"Depth": "1"}, addressQuery, http.StatusMultiStatus)
+	contains(body, "card1.vcf", "card2.vcf", "FN:Alice Example")
+
+	const addressQueryName = `<?xml version="1.0"?><cr:addressbook-query xmlns:d="DAV:" xmlns:cr="urn:ietf:params:xml:ns:carddav"><d:prop><d:getetag/></d:prop><cr:filter><cr:prop-filter name="FN"><cr:text-match>bob</cr:text-match></cr:prop-filter></cr:filter></cr:addressbook-query>`
+	body = doBody("REPORT", "/addressbooks/mjl/family/", map[string]string{"Depth": "1"}, addressQueryName, http.StatusMultiStatus)
+	contains(body, "card2.vcf")
+	notContains(body, "card1.vcf")
+
+	const addressQueryLimit = `<?xml version="1.0"?><cr:addressbook-query xmlns:d="DAV:" xmlns:cr="urn:ietf:params:xml:ns:carddav"><d:prop><d:getetag/></d:prop><cr:filter/><cr:limit><cr:nresults>1</cr:nresults></cr:limit></cr:addressbook-query>`
+	body = doBody("REPORT", "/addressbooks/mjl/family/", map[string]string{"Depth": "1"}, addressQueryLimit, http.StatusMultiStatus)
+	contains(body, "card1.vcf", "507", "number-of-matches-within-limits")
+	notContains(body, "card2.vcf")
+
+	// Remove collection.
+	do("DELETE", "/addressbooks/mjl/family/", nil, "", http.StatusNoContent)
+	do("GET", "/addressbooks/mjl/family/card1.vcf", nil, "", http.StatusNotFound)
+
+	// Unknown paths and methods.
+	do("PROPFIND", "/bogus/mjl/", nil, "", http.StatusNotFound)
+	do("POST", "/calendars/mjl/work/", nil, "", http.StatusMethodNotAllowed)
+
+	// Objects count towards the quota.
+	accLimit, err := store.OpenAccount(log, "limit", false)
+	tcheckf(t, err, "open account")
+	err = accLimit.SetPassword(log, password)
+	tcheckf(t, err, "set password")
+	defer func() {
+		err := accLimit.Close()
+		log.Check(err, "closing account")
+		accLimit.WaitClosed()
+	}()
+	doLimit := func(method, path, body string, expCode int) string {
+		t.Helper()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.SetBasicAuth("limit@mox.example", password)
+		r.Header.Set("Content-Type", "text/calendar")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		if w.Code != expCode {
+			t.Fatalf("%s %s: got status %d, expected %d, body %q", method, path, w.Code, expCode, w.Body.String())
+		}
+		return w.Body.String()
+	}
+	davSize := func(exp int) {
+		t.Helper()
+		du := store.DiskUsage{ID: 1}
+		err := accLimit.DB.Get(ctxbg, &du)
+		tcheckf(t, err, "get disk usage")
+		tcompare(t, du.DAVSize, int64(exp))
+	}
+	doLimit("PUT", "/calendars/limit/default/event1.ics", event1, http.StatusCreated)
+	davSize(len(event1))
+	body = doLimit("PUT", "/calendars/limit/default/event2.ics", event2, http.StatusInsufficientStorage)
+	contains(body, "quota-not-exceeded")
+	davSize(len(event1))
+	// Replacing with data of the same size is fine.
+	doLimit("PUT", "/calendars/limit/default/event1.ics", event1, http.StatusNoContent)
+	davSize(len(event1))
+	doLimit("DELETE", "/calendars/limit/default/event1.ics", "", http.StatusNoContent)
+	davSize(0)
+	doLimit("PUT", "/calendars/limit/default/event2.ics", event2, http.StatusCreated)
+	davSize(len(event2))
+	doLimit("DELETE", "/calendars/limit/default/", "", http.StatusNoContent)
+	davSize(0)
+}
+
+// between returns the text between start and end in s.
+func between(s, start, end string) string {
+	_, s, _ = strings.Cut(s, start)
+	s, _, _ = strings.Cut(s, end)
+	return s
+}
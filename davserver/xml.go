@@ -0,0 +1,248 @@
+package davserver
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// XML namespaces used in WebDAV, CalDAV and CardDAV requests and responses.
+const (
+	nsDAV     = "DAV:"
+	nsCalDAV  = "urn:ietf:params:xml:ns:caldav"
+	nsCardDAV = "urn:ietf:params:xml:ns:carddav"
+	nsCS      = "http://calendarserver.org/ns/"
+	nsApple   = "http://apple.com/ns/ical/"
+)
+
+// Prefixes for the namespaces in responses.
+var nsPrefixes = map[string]string{
+	nsDAV:     "d",
+	nsCalDAV:  "c",
+	nsCardDAV: "cr",
+	nsCS:      "cs",
+	nsApple:   "a",
+}
+
+// Maximum depth of nested elements in request bodies.
+const maxXMLDepth = 32
+
+// element is a parsed XML element from a request body.
+type element struct {
+	Name     xml.Name
+	Attr     []xml.Attr
+	Children []*element
+	Text     string // Concatenated character data directly in the element.
+}
+
+// parseXML parses a request body into an element tree.
+func parseXML(r io.Reader) (*element, error) {
+	d := xml.NewDecoder(r)
+	var stack []*element
+	var root *element
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			if root != nil && len(stack) == 0 {
+				return nil, errors.New("multiple root elements")
+			}
+			if len(stack) >= maxXMLDepth {
+				return nil, errors.New("xml too deeply nested")
+			}
+			e := &element{Name: t.Name, Attr: t.Attr}
+			if len(stack) > 0 {
+				p := stack[len(stack)-1]
+				p.Children = append(p.Children, e)
+			} else {
+				root = e
+			}
+			stack = append(stack, e)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].Text += string(t)
+			}
+		}
+	}
+	if root == nil {
+		return nil, errors.New("no xml element")
+	}
+	return root, nil
+}
+
+func (e *element) is(space, local string) bool {
+	return e != nil && e.Name.Space == space && e.Name.Local == local
+}
+
+// child returns the first child element with the name, or nil.
+func (e *element) child(space, local string) *element {
+	if e == nil {
+		return nil
+	}
+	for _, c := range e.Children {
+		if c.is(space, local) {
+			return c
+		}
+	}
+	return nil
+}
+
+// children returns all child elements with the name.
+func (e *element) children(space, local string) []*element {
+	var l []*element
+	if e == nil {
+		return nil
+	}
+	for _, c := range e.Children {
+		if c.is(space, local) {
+			l = append(l, c)
+		}
+	}
+	return l
+}
+
+// attr returns the value of the (unqualified) attribute, or the empty string.
+func (e *element) attr(name string) string {
+	for _, a := range e.Attr {
+		if a.Name.Space == "" && a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// xmlEscape returns s with XML special characters escaped.
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// elem returns an XML element with name and raw inner XML. Names in namespaces
+// without known prefix get a local namespace declaration.
+func elem(name xml.Name, inner string) string {
+	tag, decl := qname(name)
+	if inner == "" {
+		return "<" + tag + decl + "/>"
+	}
+	return "<" + tag + decl + ">" + inner + "</" + tag + ">"
+}
+
+func qname(name xml.Name) (tag, decl string) {
+	if p, ok := nsPrefixes[name.Space]; ok {
+		return p + ":" + name.Local, ""
+	} else if name.Space == "" {
+		return name.Local, ""
+	}
+	return "x:" + name.Local, ` xmlns:x="` + xmlEscape(name.Space) + `"`
+}
+
+func dav(local string) xml.Name {
+	return xml.Name{Space: nsDAV, Local: local}
+}
+
+func caldav(local string) xml.Name {
+	return xml.Name{Space: nsCalDAV, Local: local}
+}
+
+func carddav(local string) xml.Name {
+	return xml.Name{Space: nsCardDAV, Local: local}
+}
+
+// hrefElem returns a DAV:href element with the escaped URL path.
+func hrefElem(href string) string {
+	return elem(dav("href"), xmlEscape(href))
+}
+
+// property is a property name with its raw XML value, for responses.
+type property struct {
+	Name  xml.Name
+	Value string
+}
+
+// multistatus is a response with status for multiple resources, RFC 4918
+// section 13.
+type multistatus struct {
+	b strings.Builder
+}
+
+func newMultistatus() *multistatus {
+	m := &multistatus{}
+	m.b.WriteString(xml.Header)
+	m.b.WriteString(`<d:multistatus xmlns:d="DAV:" xmlns:c="` + nsCalDAV + `" xmlns:cr="` + nsCardDAV + `" xmlns:cs="` + nsCS + `" xmlns:a="` + nsApple + `">`)
+	m.b.WriteString("\n")
+	return m
+}
+
+func statusLine(code int) string {
+	return fmt.Sprintf("HTTP/1.1 %d %s", code, http.StatusText(code))
+}
+
+// response adds a response for href with properties that were found, and names
+// of properties that were not.
+func (m *multistatus) response(href string, found []property, missing []xml.Name) {
+	m.b.WriteString("<d:response>")
+	m.b.WriteString(hrefElem(href))
+	if len(found) > 0 {
+		m.propstat(http.StatusOK, found)
+	}
+	if len(missing) > 0 {
+		l := make([]property, len(missing))
+		for i, n := range missing {
+			l[i] = property{Name: n}
+		}
+		m.propstat(http.StatusNotFound, l)
+	}
+	m.b.WriteString("</d:response>\n")
+}
+
+// responseStatus adds a response with only a status for href.
+func (m *multistatus) responseStatus(href string, code int) {
+	m.b.WriteString("<d:response>")
+	m.b.WriteString(hrefElem(href))
+	m.b.WriteString(elem(dav("status"), statusLine(code)))
+	m.b.WriteString("</d:response>\n")
+}
+
+// responsePropstats adds a response for href with properties grouped by status.
+func (m *multistatus) responsePropstats(href string, codes []int, props map[int][]property) {
+	m.b.WriteString("<d:response>")
+	m.b.WriteString(hrefElem(href))
+	for _, code := range codes {
+		m.propstat(code, props[code])
+	}
+	m.b.WriteString("</d:response>\n")
+}
+
+func (m *multistatus) propstat(code int, props []property) {
+	m.b.WriteString("<d:propstat><d:prop>")
+	for _, p := range props {
+		m.b.WriteString(elem(p.Name, p.Value))
+	}
+	m.b.WriteString("</d:prop>")
+	m.b.WriteString(elem(dav("status"), statusLine(code)))
+	m.b.WriteString("</d:propstat>")
+}
+
+// syncToken adds the sync-token element, for sync-collection reports.
+func (m *multistatus) syncToken(token string) {
+	m.b.WriteString(elem(dav("sync-token"), xmlEscape(token)))
+	m.b.WriteString("\n")
+}
+
+func (m *multistatus) write(w http.ResponseWriter) {
+	m.b.WriteString("</d:multistatus>\n")
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	w.Write([]byte(m.b.String()))
+}
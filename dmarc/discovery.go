@@ -0,0 +1,145 @@
+package dmarc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/publicsuffix"
+)
+
+// Discovery is the method for finding the DMARC policy record and the
+// organizational domain of a domain.
+type Discovery string
+
+const (
+	// Organizational domain through the public suffix list, as in RFC 7489. If no
+	// DMARC record exists for the domain, the record at the organizational domain is
+	// used.
+	DiscoveryPublicSuffix Discovery = ""
+
+	// DNS tree walk, as in DMARCbis. DMARC records are looked up at the domain and
+	// its parent domains, with at most 8 lookups. The organizational domain is
+	// determined by the "psd=" tags of records found in the tree walk. The "np=" and
+	// "t=" tags are used in policy evaluation, and "pct=" is ignored.
+	DiscoveryTreeWalk Discovery = "treewalk"
+)
+
+// treeWalkDomains returns the domains to look up DMARC records for, for the
+// DMARCbis DNS tree walk, starting with domain itself. For domains with 8 or more
+// labels, the walk continues at the domain with 7 labels, limiting the number of
+// lookups. The last domain has a single label, the top-level domain.
+func treeWalkDomains(domain dns.Domain) []dns.Domain {
+	l := []dns.Domain{domain}
+	n := labelCount(domain)
+	if n >= 8 {
+		n = 8
+	}
+	for n--; n >= 1; n-- {
+		l = append(l, lastLabels(domain, n))
+	}
+	return l
+}
+
+func labelCount(d dns.Domain) int {
+	return strings.Count(d.ASCII, ".") + 1
+}
+
+// lastLabels returns the domain consisting of the last n labels of d.
+func lastLabels(d dns.Domain, n int) dns.Domain {
+	cut := func(s string) string {
+		if s == "" {
+			return ""
+		}
+		t := strings.Split(s, ".")
+		if n >= len(t) {
+			return s
+		}
+		return strings.Join(t[len(t)-n:], ".")
+	}
+	return dns.Domain{ASCII: cut(d.ASCII), Unicode: cut(d.Unicode)}
+}
+
+// DiscoveryPath returns the domains at which DMARC records are looked up for the
+// "From"-domain, in order. For DiscoveryPublicSuffix, that is the domain itself
+// and its organizational domain if different. For DiscoveryTreeWalk, the domains
+// of the DNS tree walk. Lookups stop at the first domain with a DMARC record.
+func DiscoveryPath(ctx context.Context, elog *slog.Logger, msgFrom dns.Domain, discovery Discovery) []dns.Domain {
+	if discovery == DiscoveryTreeWalk {
+		return treeWalkDomains(msgFrom)
+	}
+	orgDom := publicsuffix.Lookup(ctx, elog, msgFrom)
+	if orgDom == msgFrom {
+		return []dns.Domain{msgFrom}
+	}
+	return []dns.Domain{msgFrom, orgDom}
+}
+
+// OrganizationalDomain returns the organizational domain for domain, used for
+// relaxed alignment checks.
+//
+// For DiscoveryPublicSuffix, the public suffix list is used, without DNS lookups.
+//
+// For DiscoveryTreeWalk, DMARC records are looked up in a DNS tree walk. The first
+// record with "psd=n" indicates the organizational domain. A record with "psd=y"
+// indicates a public suffix domain, and the organizational domain is the domain
+// with one more label. Otherwise, the domain with the fewest labels that has a
+// DMARC record is the organizational domain. If no DMARC records are found, the
+// domain itself is the organizational domain. If a DNS lookup fails, the domain
+// itself is returned along with an error.
+func OrganizationalDomain(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, domain dns.Domain, discovery Discovery) (orgDomain dns.Domain, rerr error) {
+	if discovery != DiscoveryTreeWalk {
+		return publicsuffix.Lookup(ctx, elog, domain), nil
+	}
+
+	log := mlog.New("dmarc", elog)
+	defer func() {
+		log.Debugx("dmarc organizational domain result", rerr,
+			slog.Any("domain", domain),
+			slog.Any("orgdomain", orgDomain))
+	}()
+
+	orgDomain = domain
+	for _, d := range treeWalkDomains(domain) {
+		_, record, _, _, err := lookupRecord(ctx, resolver, d)
+		if err != nil && errors.Is(err, ErrDNS) {
+			return domain, err
+		} else if record == nil {
+			continue
+		}
+		switch record.PublicSuffixDomain {
+		case PSDNo:
+			return d, nil
+		case PSDYes:
+			if d == domain {
+				return domain, nil
+			}
+			return lastLabels(domain, labelCount(d)+1), nil
+		}
+		// The walk goes up the tree, so this domain has the fewest labels so far.
+		orgDomain = d
+	}
+	return orgDomain, nil
+}
+
+// domainExists returns whether domain exists for purposes of the DMARCbis "np="
+// policy: A domain exists if it has an A, AAAA or MX record.
+func domainExists(ctx context.Context, resolver dns.Resolver, domain dns.Domain) (bool, error) {
+	r := dns.WithPackage(resolver, "dmarc")
+	name := domain.ASCII + "."
+	if _, _, err := r.LookupIP(ctx, "ip", name); err == nil {
+		return true, nil
+	} else if !dns.IsNotFound(err) {
+		return true, fmt.Errorf("%w: looking up ip addresses: %s", ErrDNS, err)
+	}
+	if _, _, err := r.LookupMX(ctx, name); err == nil {
+		return true, nil
+	} else if !dns.IsNotFound(err) {
+		return true, fmt.Errorf("%w: looking up mx records: %s", ErrDNS, err)
+	}
+	return false, nil
+}
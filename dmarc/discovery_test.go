@@ -0,0 +1,206 @@
+package dmarc
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/mjl-/mox/dkim"
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/spf"
+)
+
+func TestTreeWalkDomains(t *testing.T) {
+	test := func(d string, exp []string) {
+		t.Helper()
+		var l []string
+		for _, d := range treeWalkDomains(dns.Domain{ASCII: d}) {
+			l = append(l, d.ASCII)
+		}
+		if !reflect.DeepEqual(l, exp) {
+			t.Fatalf("tree walk for %s: got %v, expected %v", d, l, exp)
+		}
+	}
+
+	test("com", []string{"com"})
+	test("example.com", []string{"example.com", "com"})
+	test("mail.example.com", []string{"mail.example.com", "example.com", "com"})
+	test("a.b.c.d.e.f.g.h", []string{"a.b.c.d.e.f.g.h", "b.c.d.e.f.g.h", "c.d.e.f.g.h", "d.e.f.g.h", "e.f.g.h", "f.g.h", "g.h", "h"})
+	// At most 8 lookups, skipping to 7 labels after the first lookup.
+	test("a.b.c.d.e.f.g.h.i.j.mail.example.com", []string{"a.b.c.d.e.f.g.h.i.j.mail.example.com", "g.h.i.j.mail.example.com", "h.i.j.mail.example.com", "i.j.mail.example.com", "j.mail.example.com", "mail.example.com", "example.com", "com"})
+
+	// Unicode names are shortened too.
+	d, err := dns.ParseDomain("ü.mail.example.com")
+	if err != nil {
+		t.Fatalf("parse domain: %v", err)
+	}
+	l := treeWalkDomains(d)
+	if len(l) != 4 || l[1] != (dns.Domain{ASCII: "mail.example.com", Unicode: "mail.example.com"}) {
+		t.Fatalf("tree walk for unicode domain: got %v", l)
+	}
+}
+
+var discoveryResolver = dns.MockResolver{
+	TXT: map[string][]string{
+		"_dmarc.example.com.":          {"v=DMARC1; p=reject"},
+		"_dmarc.mail.example.org.":     {"v=DMARC1; p=quarantine"},
+		"_dmarc.sub.example.net.":      {"v=DMARC1; p=reject; psd=n"},
+		"_dmarc.example.net.":          {"v=DMARC1; p=none"},
+		"_dmarc.psd.example.":          {"v=DMARC1; p=reject; psd=y"},
+		"_dmarc.bank.":                 {"v=DMARC1; p=reject; psd=y"},
+		"_dmarc.example.bank.":         {"v=DMARC1; p=none"},
+		"_dmarc.np.example.":           {"v=DMARC1; p=none; np=reject"},
+		"_dmarc.testing.example.":      {"v=DMARC1; p=reject; t=y"},
+		"_dmarc.pct.example.":          {"v=DMARC1; p=reject; pct=0"},
+		"_dmarc.multiple.example.":     {"v=DMARC1; p=none", "v=DMARC1; p=reject"},
+		"_dmarc.sub.multiple.example.": {"other"},
+	},
+	A: map[string][]string{
+		"exists.np.example.": {"10.0.0.1"},
+	},
+	Fail: []string{
+		"txt _dmarc.temperror.example.",
+	},
+}
+
+func TestLookupTreeWalk(t *testing.T) {
+	test := func(d string, discovery Discovery, expStatus Status, expDomain string, expPolicy Policy, expErr error) {
+		t.Helper()
+
+		status, dom, record, _, _, err := Lookup(context.Background(), pkglog.Logger, discoveryResolver, dns.Domain{ASCII: d}, discovery)
+		if (err == nil) != (expErr == nil) || err != nil && !errors.Is(err, expErr) {
+			t.Fatalf("%s: got err %#v, expected %#v", d, err, expErr)
+		}
+		var policy Policy
+		if record != nil {
+			policy = record.Policy
+		}
+		if status != expStatus || dom.ASCII != expDomain || policy != expPolicy {
+			t.Fatalf("%s: got status %v, dom %v, policy %q, expected %v %v %q", d, status, dom, policy, expStatus, expDomain, expPolicy)
+		}
+	}
+
+	// Record at domain itself.
+	test("example.com", DiscoveryTreeWalk, StatusNone, "example.com", PolicyReject, nil)
+	// Record at parent domain, same as organizational domain through public suffix list.
+	test("a.b.example.com", DiscoveryTreeWalk, StatusNone, "example.com", PolicyReject, nil)
+	test("a.b.example.com", DiscoveryPublicSuffix, StatusNone, "example.com", PolicyReject, nil)
+	// Record at intermediate domain, only found with tree walk.
+	test("a.b.mail.example.org", DiscoveryTreeWalk, StatusNone, "mail.example.org", PolicyQuarantine, nil)
+	test("a.b.mail.example.org", DiscoveryPublicSuffix, StatusNone, "example.org", "", ErrNoRecord)
+	// Record at public suffix domain, only found with tree walk.
+	test("other.bank", DiscoveryTreeWalk, StatusNone, "bank", PolicyReject, nil)
+	// Many labels, with record at intermediate domain after skipping labels.
+	test("a.b.c.d.e.f.g.h.i.mail.example.org", DiscoveryTreeWalk, StatusNone, "mail.example.org", PolicyQuarantine, nil)
+	// Multiple records are ignored, and the walk continues.
+	test("sub.multiple.example", DiscoveryTreeWalk, StatusNone, "example", "", ErrNoRecord)
+	// Temporary error stops the walk.
+	test("sub.temperror.example", DiscoveryTreeWalk, StatusTemperror, "temperror.example", "", ErrDNS)
+	// No record at all.
+	test("a.absent.example", DiscoveryTreeWalk, StatusNone, "example", "", ErrNoRecord)
+}
+
+func TestOrganizationalDomain(t *testing.T) {
+	test := func(d string, discovery Discovery, exp string, expErr error) {
+		t.Helper()
+
+		od, err := OrganizationalDomain(context.Background(), pkglog.Logger, discoveryResolver, dns.Domain{ASCII: d}, discovery)
+		if (err == nil) != (expErr == nil) || err != nil && !errors.Is(err, expErr) {
+			t.Fatalf("%s: got err %#v, expected %#v", d, err, expErr)
+		}
+		if od.ASCII != exp {
+			t.Fatalf("%s: got organizational domain %s, expected %s", d, od, exp)
+		}
+	}
+
+	// Domain with fewest labels that has a record.
+	test("a.mail.example.com", DiscoveryTreeWalk, "example.com", nil)
+	test("a.mail.example.org", DiscoveryTreeWalk, "mail.example.org", nil)
+	// Record with psd=n is the organizational domain, even with records higher up.
+	test("a.sub.example.net", DiscoveryTreeWalk, "sub.example.net", nil)
+	test("example.net", DiscoveryTreeWalk, "example.net", nil)
+	// Record with psd=y is public suffix, organizational domain is one label below.
+	test("mail.x.psd.example", DiscoveryTreeWalk, "x.psd.example", nil)
+	test("x.psd.example", DiscoveryTreeWalk, "x.psd.example", nil)
+	test("psd.example", DiscoveryTreeWalk, "psd.example", nil)
+	test("a.b.example.bank", DiscoveryTreeWalk, "example.bank", nil)
+	test("a.b.c.d.e.f.g.h.i.example.bank", DiscoveryTreeWalk, "example.bank", nil)
+	// No records, the domain itself.
+	test("a.absent.test", DiscoveryTreeWalk, "a.absent.test", nil)
+	// DNS failure.
+	test("sub.temperror.example", DiscoveryTreeWalk, "sub.temperror.example", ErrDNS)
+
+	// With public suffix list, no DNS lookups.
+	test("mail.x.psd.example", DiscoveryPublicSuffix, "psd.example", nil)
+	test("a.mail.example.org", DiscoveryPublicSuffix, "example.org", nil)
+}
+
+func TestVerifyTreeWalk(t *testing.T) {
+	test := func(fromDom string, dkimDomain string, spfIdentity string, expUseResult, expReject bool, expStatus Status) {
+		t.Helper()
+
+		var dkimResults []dkim.Result
+		if dkimDomain != "" {
+			dkimResults = []dkim.Result{{Status: dkim.StatusPass, Sig: &dkim.Sig{Domain: dns.Domain{ASCII: dkimDomain}}}}
+		}
+		spfResult := spf.StatusNone
+		var spfDomain *dns.Domain
+		if spfIdentity != "" {
+			spfResult = spf.StatusPass
+			spfDomain = &dns.Domain{ASCII: spfIdentity}
+		}
+		useResult, result := Verify(context.Background(), pkglog.Logger, discoveryResolver, dns.Domain{ASCII: fromDom}, dkimResults, spfResult, spfDomain, true, DiscoveryTreeWalk)
+		if useResult != expUseResult || result.Reject != expReject || result.Status != expStatus {
+			t.Fatalf("%s: got useResult %v, reject %v, status %s, expected %v %v %s", fromDom, useResult, result.Reject, result.Status, expUseResult, expReject, expStatus)
+		}
+	}
+
+	// Relaxed alignment with organizational domains from tree walk.
+	test("mail.x.psd.example", "x.psd.example", "", true, false, StatusPass)
+	test("mail.x.psd.example", "", "other.x.psd.example", true, false, StatusPass)
+	// Not aligned with tree walk, while they would be aligned with the public suffix list.
+	test("mail.x.psd.example", "y.psd.example", "", true, true, StatusFail)
+
+	// Non-existent subdomain gets np policy.
+	test("absent.np.example", "", "", true, true, StatusFail)
+	// Existing subdomain and domain itself get p policy.
+	test("exists.np.example", "", "", true, false, StatusFail)
+	test("np.example", "", "", true, false, StatusFail)
+
+	// Testing mode, policy not applied.
+	test("testing.example", "", "", false, true, StatusFail)
+	// Percentage is ignored.
+	test("pct.example", "", "", true, true, StatusFail)
+
+	// Temporary error during organizational domain lookup for alignment.
+	test("example.com", "sub.temperror.example", "", true, false, StatusTemperror)
+}
+
+func TestParseDMARCbis(t *testing.T) {
+	r, _, err := ParseRecord("v=DMARC1; p=reject; np=quarantine; psd=n; t=y")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	exp := DefaultRecord
+	exp.Policy = PolicyReject
+	exp.NonexistentSubdomainPolicy = PolicyQuarantine
+	exp.PublicSuffixDomain = PSDNo
+	exp.Testing = true
+	if !reflect.DeepEqual(r, &exp) {
+		t.Fatalf("got %#v, expected %#v", r, &exp)
+	}
+	if s := r.String(); s != "v=DMARC1;p=reject;np=quarantine;psd=n;t=y" {
+		t.Fatalf("got record string %q", s)
+	}
+
+	for _, s := range []string{
+		"v=DMARC1; p=reject; np=bogus",
+		"v=DMARC1; p=reject; psd=x",
+		"v=DMARC1; p=reject; t=1",
+	} {
+		if _, _, err := ParseRecord(s); err == nil {
+			t.Fatalf("parse %q: expected error", s)
+		}
+	}
+}
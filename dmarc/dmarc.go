@@ -1,5 +1,6 @@
 // Package dmarc implements DMARC (Domain-based Message Authentication,
-// Reporting, and Conformance; RFC 7489) verification.
+// Reporting, and Conformance; RFC 7489) verification, with optional policy
+// discovery and evaluation as in DMARCbis.
 //
 // DMARC is a mechanism for verifying ("authenticating") the address in the "From"
 // message header, since users will look at that header to identify the sender of a
@@ -79,19 +80,22 @@ type Result struct {
 // Lookup looks up the DMARC TXT record at "_dmarc.<domain>" for the domain in the
 // "From"-header of a message.
 //
-// If no DMARC record is found for the "From"-domain, another lookup is done at
-// the organizational domain of the domain (if different). The organizational
-// domain is determined using the public suffix list. E.g. for
-// "sub.example.com", the organizational domain is "example.com". The returned
-// domain is the domain with the DMARC record.
+// If no DMARC record is found for the "From"-domain, further lookups are done
+// depending on discovery. For DiscoveryPublicSuffix, another lookup is done at the
+// organizational domain of the domain (if different). The organizational domain is
+// determined using the public suffix list. E.g. for "sub.example.com", the
+// organizational domain is "example.com". For DiscoveryTreeWalk, lookups are done
+// at parent domains in a DNS tree walk, see DiscoveryPath. The returned domain is
+// the domain with the DMARC record.
 //
 // rauthentic indicates if the DNS results were DNSSEC-verified.
-func Lookup(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, msgFrom dns.Domain) (status Status, domain dns.Domain, record *Record, txt string, rauthentic bool, rerr error) {
+func Lookup(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, msgFrom dns.Domain, discovery Discovery) (status Status, domain dns.Domain, record *Record, txt string, rauthentic bool, rerr error) {
 	log := mlog.New("dmarc", elog)
 	start := time.Now()
 	defer func() {
 		log.Debugx("dmarc lookup result", rerr,
 			slog.Any("fromdomain", msgFrom),
+			slog.Any("discovery", discovery),
 			slog.Any("status", status),
 			slog.Any("domain", domain),
 			slog.Any("record", record),
@@ -104,7 +108,18 @@ func Lookup(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, msgFr
 	if status != StatusNone {
 		return status, domain, record, txt, authentic, err
 	}
-	if record == nil {
+	if record == nil && discovery == DiscoveryTreeWalk {
+		// Continue with parent domains until we find a record or encounter an error.
+		for _, d := range treeWalkDomains(msgFrom)[1:] {
+			domain = d
+			var xauth bool
+			status, record, txt, xauth, err = lookupRecord(ctx, resolver, domain)
+			authentic = authentic && xauth
+			if status != StatusNone || record != nil {
+				break
+			}
+		}
+	} else if record == nil {
 		// ../rfc/7489:761 ../rfc/7489:1377
 		domain = publicsuffix.Lookup(ctx, log.Logger, msgFrom)
 		if domain == msgFrom {
@@ -223,8 +238,13 @@ func LookupExternalReportsAccepted(ctx context.Context, elog *slog.Logger, resol
 // against the message (for inclusion in Authentication-Result headers).
 //
 // useResult indicates if the result should be applied in a policy decision,
-// based on the "pct" field in the DMARC record.
-func Verify(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, msgFrom dns.Domain, dkimResults []dkim.Result, spfResult spf.Status, spfIdentity *dns.Domain, applyRandomPercentage bool) (useResult bool, result Result) {
+// based on the "pct" field in the DMARC record. For DiscoveryTreeWalk, the "pct"
+// field is ignored, and useResult is false if the record has "t=y" (testing) and
+// applyRandomPercentage is set.
+//
+// discovery determines how the DMARC record and organizational domains for
+// relaxed alignment are found.
+func Verify(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, msgFrom dns.Domain, dkimResults []dkim.Result, spfResult spf.Status, spfIdentity *dns.Domain, applyRandomPercentage bool, discovery Discovery) (useResult bool, result Result) {
 	log := mlog.New("dmarc", elog)
 	start := time.Now()
 	defer func() {
@@ -247,7 +267,7 @@ func Verify(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, msgFr
 			slog.Duration("duration", time.Since(start)))
 	}()
 
-	status, recordDomain, record, _, authentic, err := Lookup(ctx, log.Logger, resolver, msgFrom)
+	status, recordDomain, record, _, authentic, err := Lookup(ctx, log.Logger, resolver, msgFrom, discovery)
 	if record == nil {
 		return false, Result{false, status, false, false, recordDomain, record, authentic, err}
 	}
@@ -257,16 +277,31 @@ func Verify(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, msgFr
 
 	// Record can request sampling of messages to apply policy.
 	// See ../rfc/7489:1432
-	useResult = !applyRandomPercentage || record.Percentage == 100 || mathrand2.IntN(100) < record.Percentage
+	// DMARCbis replaces "pct" with "t" for testing policies, which we treat like pct=0.
+	if discovery == DiscoveryTreeWalk {
+		useResult = !applyRandomPercentage || !record.Testing
+	} else {
+		useResult = !applyRandomPercentage || record.Percentage == 100 || mathrand2.IntN(100) < record.Percentage
+	}
 
 	// We treat "quarantine" and "reject" the same. Thus, we also don't "downgrade"
 	// from reject to quarantine if this message was sampled out.
 	// ../rfc/7489:1446 ../rfc/7489:1024
-	if recordDomain != msgFrom && record.SubdomainPolicy != PolicyEmpty {
-		result.Reject = record.SubdomainPolicy != PolicyNone
-	} else {
-		result.Reject = record.Policy != PolicyNone
+	policy := record.Policy
+	if recordDomain != msgFrom {
+		if record.SubdomainPolicy != PolicyEmpty {
+			policy = record.SubdomainPolicy
+		}
+		// With DMARCbis, subdomains that don't exist can have a separate policy.
+		if discovery == DiscoveryTreeWalk && record.NonexistentSubdomainPolicy != PolicyEmpty {
+			if exists, err := domainExists(ctx, resolver, msgFrom); err != nil {
+				log.Debugx("checking if from domain exists, for np policy", err, slog.Any("fromdomain", msgFrom))
+			} else if !exists {
+				policy = record.NonexistentSubdomainPolicy
+			}
+		}
 	}
+	result.Reject = policy != PolicyNone
 
 	// ../rfc/7489:1338
 	result.Status = StatusFail
@@ -275,21 +310,27 @@ func Verify(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, msgFr
 		result.Reject = false
 	}
 
-	// Below we can do a bunch of publicsuffix lookups. Cache the results, mostly to
-	// reduce log pollution.
-	pubsuffixes := map[dns.Domain]dns.Domain{}
-	pubsuffix := func(name dns.Domain) dns.Domain {
-		if r, ok := pubsuffixes[name]; ok {
+	// Below we can do a bunch of organizational domain lookups. Cache the results,
+	// mostly to reduce log pollution, and DNS lookups for the tree walk.
+	orgDomains := map[dns.Domain]dns.Domain{}
+	orgDomain := func(name dns.Domain) dns.Domain {
+		if r, ok := orgDomains[name]; ok {
 			return r
 		}
-		r := publicsuffix.Lookup(ctx, log.Logger, name)
-		pubsuffixes[name] = r
+		r, err := OrganizationalDomain(ctx, log.Logger, resolver, name, discovery)
+		if err != nil {
+			// We can't properly check for relaxed alignment.
+			result.Status = StatusTemperror
+			result.Reject = false
+			result.Err = err
+		}
+		orgDomains[name] = r
 		return r
 	}
 
 	// ../rfc/7489:1319
 	// ../rfc/7489:544
-	if spfResult == spf.StatusPass && spfIdentity != nil && (*spfIdentity == msgFrom || result.Record.ASPF == "r" && pubsuffix(msgFrom) == pubsuffix(*spfIdentity)) {
+	if spfResult == spf.StatusPass && spfIdentity != nil && (*spfIdentity == msgFrom || result.Record.ASPF == "r" && orgDomain(msgFrom) == orgDomain(*spfIdentity)) {
 		result.AlignedSPFPass = true
 	}
 
@@ -300,7 +341,7 @@ func Verify(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, msgFr
 			continue
 		}
 		// ../rfc/7489:511
-		if dkimResult.Status == dkim.StatusPass && dkimResult.Sig != nil && (dkimResult.Sig.Domain == msgFrom || result.Record.ADKIM == "r" && pubsuffix(msgFrom) == pubsuffix(dkimResult.Sig.Domain)) {
+		if dkimResult.Status == dkim.StatusPass && dkimResult.Sig != nil && (dkimResult.Sig.Domain == msgFrom || result.Record.ADKIM == "r" && orgDomain(msgFrom) == orgDomain(dkimResult.Sig.Domain)) {
 			// ../rfc/7489:535
 			result.AlignedDKIMPass = true
 			break
@@ -23,7 +23,7 @@ func ExampleLookup() {
 	}
 
 	// Lookup DMARC DNS record for domain.
-	status, domain, record, txt, authentic, err := dmarc.Lookup(ctx, slog.Default(), resolver, msgFrom)
+	status, domain, record, txt, authentic, err := dmarc.Lookup(ctx, slog.Default(), resolver, msgFrom, dmarc.DiscoveryPublicSuffix)
 	if err != nil {
 		log.Fatalf("dmarc lookup: %v", err)
 	}
@@ -62,7 +62,7 @@ func ExampleVerify() {
 
 	// Verify DMARC, based on DKIM and SPF results.
 	applyRandomPercentage := true
-	useResult, result := dmarc.Verify(ctx, slog.Default(), resolver, msgFrom.Domain, dkimResults, spfReceived.Result, &spfDomain, applyRandomPercentage)
+	useResult, result := dmarc.Verify(ctx, slog.Default(), resolver, msgFrom.Domain, dkimResults, spfReceived.Result, &spfDomain, applyRandomPercentage, dmarc.DiscoveryPublicSuffix)
 
 	// Print results.
 	log.Printf("dmarc status: %s", result.Status)
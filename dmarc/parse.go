@@ -134,6 +134,12 @@ func parseRecord(s string, checkRequired bool) (record *Record, isdmarc bool, re
 				r.ReportingFormat = append(r.ReportingFormat, p.xkeyword())
 				p.wsp()
 			}
+		case "np":
+			r.NonexistentSubdomainPolicy = Policy(p.xtakelist("none", "quarantine", "reject"))
+		case "psd":
+			r.PublicSuffixDomain = PSD(p.xtakelist("y", "n", "u"))
+		case "t":
+			r.Testing = p.xtakelist("y", "n") == "y"
 		case "pct":
 			r.Percentage = p.xnumber()
 			if r.Percentage > 100 {
@@ -47,6 +47,17 @@ const (
 	AlignRelaxed Align = "r" // Relaxed requires either an exact or subdomain name match.
 )
 
+// PSD indicates if a DMARC record is for a public suffix domain, for "psd=" in
+// DMARCbis.
+type PSD string
+
+const (
+	PSDEmpty   PSD = ""  // Absent, treated as "u".
+	PSDUnknown PSD = "u" // Default.
+	PSDYes     PSD = "y" // Public suffix domain, its direct subdomains are organizational domains.
+	PSDNo      PSD = "n" // Organizational domain.
+)
+
 // Record is a DNS policy or reporting record.
 //
 // Example:
@@ -64,6 +75,13 @@ type Record struct {
 	FailureReportingOptions    []string // "0" (default), "1", "d", "s". For "fo=".
 	ReportingFormat            []string // "afrf" (default). For "rf=".
 	Percentage                 int      // Between 0 and 100, default 100. For "pct=". Policy applies randomly to this percentage of messages.
+
+	// Fields below were added in DMARCbis. Fields "ri", "rf" and "pct" were removed in
+	// DMARCbis, but are still parsed.
+
+	NonexistentSubdomainPolicy Policy // Like SubdomainPolicy but for subdomains that don't exist. Optional, for "np=".
+	PublicSuffixDomain         PSD    // "y", "n", "u" or empty for "u". For "psd=".
+	Testing                    bool   // Policy is being tested, should not be applied. For "t=", "y" means true.
 }
 
 // DefaultRecord holds the defaults for a DMARC record.
@@ -117,6 +135,9 @@ func (r Record) String() string {
 		write(true, "rf", strings.Join(r.FailureReportingOptions, ":"))
 	}
 	write(r.Percentage != 100, "pct", fmt.Sprintf("%d", r.Percentage))
+	write(r.NonexistentSubdomainPolicy != "", "np", string(r.NonexistentSubdomainPolicy))
+	write(r.PublicSuffixDomain != "" && r.PublicSuffixDomain != PSDUnknown, "psd", string(r.PublicSuffixDomain))
+	write(r.Testing, "t", "y")
 
 	if !wrote {
 		b.WriteString(";")
@@ -59,7 +59,7 @@ var (
 )
 
 var (
-	EvalDBTypes = []any{Evaluation{}, SuppressAddress{}} // Types stored in DB.
+	EvalDBTypes = []any{Evaluation{}, SuppressAddress{}, FailureReport{}} // Types stored in DB.
 	// Exported for backups. For incoming deliveries the SMTP server adds evaluations
 	// to the database. Every hour, a goroutine wakes up that gathers evaluations from
 	// the last hour(s), sends a report, and removes the evaluations from the database.
@@ -97,7 +97,7 @@ type Evaluation struct {
 	Addresses []string
 
 	// Policy used for evaluation. We don't store the "fo" field for failure reporting
-	// options, since we don't send failure reports for individual messages.
+	// options, failure reports for individual messages are sent at delivery time.
 	PolicyPublished dmarcrpt.PolicyPublished
 
 	// For "row" in a report record.
@@ -468,6 +468,97 @@ func parseRecipient(log mlog.Log, uri dmarc.URI) (r recipient, ok bool) {
 	return r, true
 }
 
+// reportRecipients returns the recipients for reports about policy domain dom,
+// from uris (of kind "rua" or "ruf") of its DMARC record. Addresses in another
+// organizational domain are only used if that domain opts in to receiving reports
+// through a _report._dmarc DNS record, and can be replaced by addresses from that
+// record, selected by externalURIs. Errors are suitable for inclusion in a report.
+// If tempError is set, a temporary error was encountered checking an external
+// domain.
+func reportRecipients(ctx context.Context, log mlog.Log, resolver dns.Resolver, dom dns.Domain, kind string, uris []dmarc.URI, externalURIs func(*dmarc.Record) []dmarc.URI) (recipients []recipient, errors []string, tempError bool) {
+	for _, uri := range uris {
+		r, ok := parseRecipient(log, uri)
+		if !ok {
+			continue
+		}
+
+		// Check if domain of recipient has the same organizational domain as for the
+		// evaluations. If not, we need to verify we are allowed to send.
+		rcptOrgDom := publicsuffix.Lookup(ctx, log.Logger, r.address.Domain)
+		evalOrgDom := publicsuffix.Lookup(ctx, log.Logger, dom)
+
+		if rcptOrgDom == evalOrgDom {
+			recipients = append(recipients, r)
+			continue
+		}
+
+		// Verify and follow addresses in other organizational domain through
+		// <policydomain>._report._dmarc.<host> lookup.
+		// ../rfc/7489:1556
+		accepts, status, records, _, _, err := dmarc.LookupExternalReportsAccepted(ctx, log.Logger, resolver, evalOrgDom, r.address.Domain)
+		log.Debugx("checking if "+kind+" address with different organization domain has opted into receiving dmarc reports", err,
+			slog.Any("policydomain", evalOrgDom),
+			slog.Any("destinationdomain", r.address.Domain),
+			slog.Bool("accepts", accepts),
+			slog.Any("status", status))
+		if status == dmarc.StatusTemperror {
+			// With a temporary error, we'll try to get the report the delivered anyway,
+			// perhaps there are multiple recipients.
+			// ../rfc/7489:1578
+			tempError = true
+			errors = append(errors, "temporary error checking authorization for report delegation to external address")
+		}
+		if !accepts {
+			errors = append(errors, fmt.Sprintf("%s %s is external domain that does not opt-in to receiving dmarc records through _report dmarc record", kind, r.address))
+			continue
+		}
+
+		// We can follow a _report DMARC DNS record once. In that record, a domain may
+		// specify alternative addresses that we should send reports to instead. Such
+		// alternative address(es) must have the same host. If not, we ignore the new
+		// value. Behaviour for multiple records and/or multiple new addresses is
+		// underspecified. We'll replace an address with one or more new addresses, and
+		// keep the original if there was no candidate (which covers the case of invalid
+		// alternative addresses and no new address specified).
+		// ../rfc/7489:1600
+		foundReplacement := false
+		rlog := log.With(slog.Any("followedaddress", uri.Address))
+		for _, record := range records {
+			for _, exturi := range externalURIs(record) {
+				extr, ok := parseRecipient(rlog, exturi)
+				if !ok {
+					continue
+				}
+				if extr.address.Domain != r.address.Domain {
+					rlog.Debug(kind+" address in external _report dmarc record has different host than initial dmarc record, ignoring new name", slog.Any("externaladdress", extr.address))
+					errors = append(errors, fmt.Sprintf("%s %s is external domain with a replacement address %s with different host", kind, r.address, extr.address))
+				} else {
+					rlog.Debug("using replacement "+kind+" address from external _report dmarc record", slog.Any("externaladdress", extr.address))
+					foundReplacement = true
+					recipients = append(recipients, extr)
+				}
+			}
+		}
+		if !foundReplacement {
+			recipients = append(recipients, r)
+		}
+	}
+	return
+}
+
+// suppressed returns whether outgoing reports to address are currently
+// suppressed.
+func suppressed(ctx context.Context, db *bstore.DB, address smtp.Address) (bool, error) {
+	q := bstore.QueryDB[SuppressAddress](ctx, db)
+	q.FilterNonzero(SuppressAddress{ReportingAddress: address.Path().String()})
+	q.FilterGreater("Until", time.Now())
+	exists, err := q.Exists()
+	if err != nil {
+		return false, fmt.Errorf("querying suppress list: %v", err)
+	}
+	return exists, nil
+}
+
 func removeEvaluations(ctx context.Context, log mlog.Log, db *bstore.DB, endTime time.Time, domain string) {
 	q := bstore.QueryDB[Evaluation](ctx, db)
 	q.FilterLess("Evaluated", endTime)
@@ -518,7 +609,7 @@ func sendReportDomain(ctx context.Context, log mlog.Log, resolver dns.Resolver,
 	// evaluations regardless. We always use the latest DMARC record when sending, but
 	// we'll lump all policies of the last interval into one report.
 	// ../rfc/7489:1714
-	status, _, record, _, _, err := dmarc.Lookup(ctx, log.Logger, resolver, dom)
+	status, _, record, _, _, err := dmarc.Lookup(ctx, log.Logger, resolver, dom, mox.Conf.DMARCDiscovery())
 	if err != nil {
 		// todo future: we could perhaps still send this report, assuming the values we know. in case of temporary error, we could also schedule again regardless of next interval hour (we would now only retry a 24h-interval report after 24h passed).
 		// Remove records unless it was a temporary error. We'll try again next round.
@@ -526,78 +617,12 @@ func sendReportDomain(ctx context.Context, log mlog.Log, resolver dns.Resolver,
 		return cleanup, fmt.Errorf("looking up current dmarc record for reporting address: %v", err)
 	}
 
-	var recipients []recipient
-
 	// Gather all aggregate reporting addresses to try to send to. We'll start with
 	// those in the initial DMARC record, but will follow external reporting addresses
 	// and possibly update the list.
-	for _, uri := range record.AggregateReportAddresses {
-		r, ok := parseRecipient(log, uri)
-		if !ok {
-			continue
-		}
-
-		// Check if domain of rua recipient has the same organizational domain as for the
-		// evaluations. If not, we need to verify we are allowed to send.
-		ruaOrgDom := publicsuffix.Lookup(ctx, log.Logger, r.address.Domain)
-		evalOrgDom := publicsuffix.Lookup(ctx, log.Logger, dom)
-
-		if ruaOrgDom == evalOrgDom {
-			recipients = append(recipients, r)
-			continue
-		}
-
-		// Verify and follow addresses in other organizational domain through
-		// <policydomain>._report._dmarc.<host> lookup.
-		// ../rfc/7489:1556
-		accepts, status, records, _, _, err := dmarc.LookupExternalReportsAccepted(ctx, log.Logger, resolver, evalOrgDom, r.address.Domain)
-		log.Debugx("checking if rua address with different organization domain has opted into receiving dmarc reports", err,
-			slog.Any("policydomain", evalOrgDom),
-			slog.Any("destinationdomain", r.address.Domain),
-			slog.Bool("accepts", accepts),
-			slog.Any("status", status))
-		if status == dmarc.StatusTemperror {
-			// With a temporary error, we'll try to get the report the delivered anyway,
-			// perhaps there are multiple recipients.
-			// ../rfc/7489:1578
-			tempError = true
-			errors = append(errors, "temporary error checking authorization for report delegation to external address")
-		}
-		if !accepts {
-			errors = append(errors, fmt.Sprintf("rua %s is external domain that does not opt-in to receiving dmarc records through _report dmarc record", r.address))
-			continue
-		}
-
-		// We can follow a _report DMARC DNS record once. In that record, a domain may
-		// specify alternative addresses that we should send reports to instead. Such
-		// alternative address(es) must have the same host. If not, we ignore the new
-		// value. Behaviour for multiple records and/or multiple new addresses is
-		// underspecified. We'll replace an address with one or more new addresses, and
-		// keep the original if there was no candidate (which covers the case of invalid
-		// alternative addresses and no new address specified).
-		// ../rfc/7489:1600
-		foundReplacement := false
-		rlog := log.With(slog.Any("followedaddress", uri.Address))
-		for _, record := range records {
-			for _, exturi := range record.AggregateReportAddresses {
-				extr, ok := parseRecipient(rlog, exturi)
-				if !ok {
-					continue
-				}
-				if extr.address.Domain != r.address.Domain {
-					rlog.Debug("rua address in external _report dmarc record has different host than initial dmarc record, ignoring new name", slog.Any("externaladdress", extr.address))
-					errors = append(errors, fmt.Sprintf("rua %s is external domain with a replacement address %s with different host", r.address, extr.address))
-				} else {
-					rlog.Debug("using replacement rua address from external _report dmarc record", slog.Any("externaladdress", extr.address))
-					foundReplacement = true
-					recipients = append(recipients, extr)
-				}
-			}
-		}
-		if !foundReplacement {
-			recipients = append(recipients, r)
-		}
-	}
+	recipients, rerrors, rtempError := reportRecipients(ctx, log, resolver, dom, "rua", record.AggregateReportAddresses, func(r *dmarc.Record) []dmarc.URI { return r.AggregateReportAddresses })
+	errors = append(errors, rerrors...)
+	tempError = tempError || rtempError
 
 	if len(recipients) == 0 {
 		// No reports requested, perfectly fine, no work to do for us.
@@ -769,14 +794,9 @@ Period: %s - %s UTC
 	var queued bool
 	for _, rcpt := range recipients {
 		// If recipient is on suppression list, we won't queue the reporting message.
-		q := bstore.QueryDB[SuppressAddress](ctx, db)
-		q.FilterNonzero(SuppressAddress{ReportingAddress: rcpt.address.Path().String()})
-		q.FilterGreater("Until", time.Now())
-		exists, err := q.Exists()
-		if err != nil {
-			return false, fmt.Errorf("querying suppress list: %v", err)
-		}
-		if exists {
+		if exists, err := suppressed(ctx, db, rcpt.address); err != nil {
+			return false, err
+		} else if exists {
 			log.Info("suppressing outgoing dmarc aggregate report", slog.Any("reportingaddress", rcpt.address))
 			continue
 		}
@@ -933,14 +953,9 @@ Submitting-URI: %s
 
 	for _, rcpt := range recipients {
 		// If recipient is on suppression list, we won't queue the reporting message.
-		q := bstore.QueryDB[SuppressAddress](ctx, db)
-		q.FilterNonzero(SuppressAddress{ReportingAddress: rcpt.Address.Path().String()})
-		q.FilterGreater("Until", time.Now())
-		exists, err := q.Exists()
-		if err != nil {
-			return fmt.Errorf("querying suppress list: %v", err)
-		}
-		if exists {
+		if exists, err := suppressed(ctx, db, rcpt.Address); err != nil {
+			return err
+		} else if exists {
 			log.Info("suppressing outgoing dmarc error report", slog.Any("reportingaddress", rcpt.Address))
 			continue
 		}
@@ -0,0 +1,439 @@
+package dmarcdb
+
+// Failure reports (also called forensic reports) are sent for individual messages
+// that fail DMARC, in AFRF format. ../rfc/7489:2006 ../rfc/6591 ../rfc/5965
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/dmarc"
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/message"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/moxvar"
+	"github.com/mjl-/mox/queue"
+	"github.com/mjl-/mox/smtp"
+	"github.com/mjl-/mox/store"
+)
+
+var metricFailureReport = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "mox_dmarcdb_failure_report_total",
+		Help: "DMARC failure reports for incoming messages.",
+	},
+	[]string{
+		"result", // "queued", "ratelimited", "norecipients", "error"
+	},
+)
+
+// Messages larger than this are only included with their header in failure
+// reports.
+const failureReportMaxMessage = 256 * 1024
+
+// FailureReport is a failure report that was sent, kept for a day for rate
+// limiting.
+type FailureReport struct {
+	ID              int64
+	Sent            time.Time `bstore:"default now,index"`
+	RecipientDomain string    `bstore:"index RecipientDomain+Sent"` // Domain of reporting address, unicode.
+}
+
+// FailureMessage holds details about an incoming message that failed DMARC, for
+// sending a failure report.
+type FailureMessage struct {
+	FromDomain     dns.Domain   // Domain of message From header.
+	Result         dmarc.Result // With Record set.
+	SourceIP       string
+	MailFrom       string // Address in SMTP MAIL FROM, can be empty.
+	RcptTo         string // Address in SMTP RCPT TO.
+	Arrival        time.Time
+	DeliveryResult string // "delivered", "spam" or "reject". ../rfc/6591:254
+	AuthResults    string // Authentication-Results header added to the message, including name and ending in CRLF.
+	Message        []byte // Message or its header, see FailureReportMessage.
+}
+
+// failureReportOptions returns whether the fo= options of a DMARC record request a
+// failure report for the evaluation results.
+//
+// dkimFail indicates whether a DKIM signature failed verification, regardless of
+// alignment. spfFail indicates whether SPF evaluated to fail, regardless of
+// alignment. ../rfc/7489:1376
+func failureReportOptions(options []string, alignedDKIMPass, alignedSPFPass, dkimFail, spfFail bool) bool {
+	if len(options) == 0 {
+		options = []string{"0"}
+	}
+	for _, o := range options {
+		switch strings.ToLower(o) {
+		case "0":
+			if !alignedDKIMPass && !alignedSPFPass {
+				return true
+			}
+		case "1":
+			if !alignedDKIMPass || !alignedSPFPass {
+				return true
+			}
+		case "d":
+			if dkimFail {
+				return true
+			}
+		case "s":
+			if spfFail {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FailureReportRequested returns whether a failure report should be sent for an
+// incoming message with From domain fromDomain and the DMARC result: if failure
+// reports are configured for the domain, and requested by its DMARC record in AFRF
+// format for the results.
+func FailureReportRequested(fromDomain dns.Domain, result dmarc.Result, dkimFail, spfFail bool) bool {
+	conf := mox.Conf.Static.DMARCFailureReports
+	if conf == nil || result.Record == nil || len(result.Record.FailureReportAddresses) == 0 {
+		return false
+	}
+	if !slices.ContainsFunc(conf.ParsedDomains, func(d dns.Domain) bool {
+		return fromDomain == d || strings.HasSuffix(fromDomain.ASCII, "."+d.ASCII)
+	}) {
+		return false
+	}
+	// ../rfc/7489:1412
+	if len(result.Record.ReportingFormat) > 0 && !slices.ContainsFunc(result.Record.ReportingFormat, func(s string) bool { return strings.EqualFold(s, "afrf") }) {
+		return false
+	}
+	return failureReportOptions(result.Record.FailureReportingOptions, result.AlignedDKIMPass, result.AlignedSPFPass, dkimFail, spfFail)
+}
+
+// FailureReportMessage returns the message to include in a failure report: the
+// full message if configured and not too large, otherwise only the header.
+// bodyOffset is the offset of the body in the message.
+func FailureReportMessage(r io.ReaderAt, size, bodyOffset int64) ([]byte, error) {
+	n := bodyOffset
+	if conf := mox.Conf.Static.DMARCFailureReports; conf != nil && conf.IncludeBody && size <= failureReportMaxMessage {
+		n = size
+	}
+	buf := make([]byte, n)
+	if _, err := r.ReadAt(buf, 0); err != nil && !(err == io.EOF && n == size) {
+		return nil, fmt.Errorf("reading message for failure report: %v", err)
+	}
+	return buf, nil
+}
+
+// Matches the localpart of email addresses, for redaction. ../rfc/6590:170
+var redactAddressRegexp = regexp.MustCompile(`("[^"\r\n]*"|[^\s<>()\[\]\\,;:@"]+)@`)
+
+func redactAddresses(s string) string {
+	return redactAddressRegexp.ReplaceAllString(s, "redacted@")
+}
+
+// failureReportContent returns the message for a failure report, with configured
+// header fields removed and addresses redacted, and whether it is a full
+// message.
+func failureReportContent(data []byte) (content []byte, full bool) {
+	conf := mox.Conf.Static.DMARCFailureReports
+
+	// Data is either the header including the empty line, or a full message.
+	header := data
+	var body []byte
+	if i := bytes.Index(data, []byte("\r\n\r\n")); i >= 0 && i+4 < len(data) {
+		header = data[:i+2]
+		body = data[i+4:]
+		full = true
+	}
+
+	var b bytes.Buffer
+	var skip bool
+	for _, line := range bytes.SplitAfter(header, []byte("\r\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			name, _, _ := bytes.Cut(line, []byte(":"))
+			skip = slices.ContainsFunc(conf.RedactHeaders, func(h string) bool {
+				return strings.EqualFold(h, strings.TrimSpace(string(name)))
+			})
+		}
+		if skip {
+			continue
+		}
+		if conf.RedactAddresses {
+			line = []byte(redactAddresses(string(line)))
+		}
+		b.Write(line)
+	}
+	if full {
+		b.WriteString("\r\n")
+		b.Write(body)
+	}
+	return b.Bytes(), full
+}
+
+// failureReportAllowed checks if a failure report can be sent to the domain of a
+// reporting address without exceeding the rate limit, and registers the report if
+// so.
+func failureReportAllowed(ctx context.Context, db *bstore.DB, rcptDomain dns.Domain) (bool, error) {
+	maxPerHour := mox.Conf.Static.DMARCFailureReports.MaxPerHour
+	if maxPerHour == 0 {
+		maxPerHour = 10
+	}
+
+	var ok bool
+	err := db.Write(ctx, func(tx *bstore.Tx) error {
+		now := time.Now()
+		if _, err := bstore.QueryTx[FailureReport](tx).FilterLess("Sent", now.Add(-24*time.Hour)).Delete(); err != nil {
+			return fmt.Errorf("removing old failure reports: %v", err)
+		}
+
+		q := bstore.QueryTx[FailureReport](tx)
+		q.FilterNonzero(FailureReport{RecipientDomain: rcptDomain.Name()})
+		q.FilterGreater("Sent", now.Add(-time.Hour))
+		n, err := q.Count()
+		if err != nil {
+			return fmt.Errorf("counting recent failure reports: %v", err)
+		}
+		if n >= maxPerHour {
+			return nil
+		}
+		ok = true
+		return tx.Insert(&FailureReport{Sent: now, RecipientDomain: rcptDomain.Name()})
+	})
+	return ok, err
+}
+
+// SendFailureReport composes a failure report for a message and queues it for
+// delivery to the failure reporting addresses of the DMARC record. Callers should
+// check FailureReportRequested first. Addresses in another organizational domain
+// are verified, and addresses on the suppression list are skipped. Reports are
+// rate limited per domain of the reporting addresses.
+func SendFailureReport(ctx context.Context, log mlog.Log, resolver dns.Resolver, fm FailureMessage) error {
+	dom := fm.Result.Domain
+	log = log.With(slog.Any("policydomain", dom))
+
+	recipients, _, _ := reportRecipients(ctx, log, resolver, dom, "ruf", fm.Result.Record.FailureReportAddresses, func(r *dmarc.Record) []dmarc.URI { return r.FailureReportAddresses })
+	var rcpts []recipient
+	for _, rcpt := range recipients {
+		if exists, err := suppressed(ctx, EvalDB, rcpt.address); err != nil {
+			return err
+		} else if exists {
+			log.Info("suppressing outgoing dmarc failure report", slog.Any("reportingaddress", rcpt.address))
+			continue
+		}
+		rcpts = append(rcpts, rcpt)
+	}
+	if len(rcpts) == 0 {
+		log.Debug("no failure reporting addresses to send dmarc failure report to")
+		metricFailureReport.WithLabelValues("norecipients").Inc()
+		return nil
+	}
+
+	// The rate limit is for the receiving side. Many policy domains can have their
+	// failure reports sent to the same domain, so limiting per policy domain would not
+	// protect the reporting domain from a flood of reports.
+	allowed := map[string]bool{}
+	var allowedRcpts []recipient
+	for _, rcpt := range rcpts {
+		rcptDom := rcpt.address.Domain
+		ok, seen := allowed[rcptDom.Name()]
+		if !seen {
+			var err error
+			ok, err = failureReportAllowed(ctx, EvalDB, rcptDom)
+			if err != nil {
+				metricFailureReport.WithLabelValues("error").Inc()
+				return fmt.Errorf("checking failure report rate limit: %v", err)
+			}
+			allowed[rcptDom.Name()] = ok
+			if !ok {
+				log.Info("not sending dmarc failure report due to rate limit for reporting domain", slog.Any("reportingdomain", rcptDom))
+				metricFailureReport.WithLabelValues("ratelimited").Inc()
+			}
+		}
+		if ok {
+			allowedRcpts = append(allowedRcpts, rcpt)
+		}
+	}
+	rcpts = allowedRcpts
+	if len(rcpts) == 0 {
+		return nil
+	}
+
+	msgf, err := store.CreateMessageTemp(log, "dmarcfailurereportout")
+	if err != nil {
+		return fmt.Errorf("creating temporary message file for outgoing dmarc failure report: %v", err)
+	}
+	defer store.CloseRemoveTempFile(log, msgf, "message with generated dmarc failure report")
+
+	from := smtp.NewAddress("postmaster", mox.Conf.Static.HostnameDomain)
+	subject := fmt.Sprintf("DMARC failure report for %s from %s", fm.FromDomain.ASCII, fm.SourceIP)
+
+	var addrs []message.NameAddress
+	for _, rcpt := range rcpts {
+		addrs = append(addrs, message.NameAddress{Address: rcpt.address})
+	}
+
+	msgPrefix, has8bit, smtputf8, messageID, err := composeFailureReport(ctx, log, msgf, from, addrs, subject, fm)
+	if err != nil {
+		metricFailureReport.WithLabelValues("error").Inc()
+		return fmt.Errorf("composing message with outgoing dmarc failure report: %v", err)
+	}
+
+	msgInfo, err := msgf.Stat()
+	if err != nil {
+		return fmt.Errorf("stat message with outgoing dmarc failure report: %v", err)
+	}
+	msgSize := int64(len(msgPrefix)) + msgInfo.Size()
+	for _, rcpt := range rcpts {
+		if rcpt.maxSize > 0 && msgSize > int64(rcpt.maxSize) {
+			log.Debug("dmarc failure report too large for reporting address", slog.Any("reportingaddress", rcpt.address), slog.Int64("size", msgSize))
+			continue
+		}
+
+		qm := queue.MakeMsg(from.Path(), rcpt.address.Path(), has8bit, smtputf8, msgSize, messageID, []byte(msgPrefix), nil, time.Now(), subject)
+		// Like aggregate reports, we don't try as long as regular deliveries, and don't
+		// send DSNs.
+		qm.MaxAttempts = 5
+		qm.IsDMARCReport = true
+
+		if err := queueAdd(ctx, log, mox.Conf.Static.Postmaster.Account, msgf, qm); err != nil {
+			log.Errorx("queueing message with dmarc failure report", err)
+			metricFailureReport.WithLabelValues("error").Inc()
+		} else {
+			log.Debug("dmarc failure report queued", slog.Any("recipient", rcpt.address))
+			metricFailureReport.WithLabelValues("queued").Inc()
+		}
+	}
+	return nil
+}
+
+func composeFailureReport(ctx context.Context, log mlog.Log, mf *os.File, fromAddr smtp.Address, recipients []message.NameAddress, subject string, fm FailureMessage) (msgPrefix string, has8bit, smtputf8 bool, messageID string, rerr error) {
+	conf := mox.Conf.Static.DMARCFailureReports
+
+	xc := message.NewComposer(mf, 100*1024*1024, false)
+	defer func() {
+		x := recover()
+		if x == nil {
+			return
+		}
+		if err, ok := x.(error); ok && errors.Is(err, message.ErrCompose) {
+			rerr = err
+			return
+		}
+		panic(x)
+	}()
+
+	content, full := failureReportContent(fm.Message)
+	if slices.ContainsFunc(content, func(b byte) bool { return b >= 0x80 }) {
+		xc.Has8bit = true
+	}
+
+	xc.HeaderAddrs("From", []message.NameAddress{{Address: fromAddr}})
+	xc.HeaderAddrs("To", recipients)
+	xc.Subject(subject)
+	messageID = fmt.Sprintf("<%s>", mox.MessageIDGen(xc.SMTPUTF8))
+	xc.Header("Message-Id", messageID)
+	xc.Header("Date", time.Now().Format(message.RFC5322Z))
+	xc.Header("User-Agent", "mox/"+moxvar.Version)
+	xc.Header("MIME-Version", "1.0")
+
+	// ../rfc/5965:296
+	mp := multipart.NewWriter(xc)
+	xc.Header("Content-Type", fmt.Sprintf(`multipart/report; report-type="feedback-report"; boundary="%s"`, mp.Boundary()))
+	xc.Line()
+
+	text := fmt.Sprintf(`This is a DMARC failure report for a message with From domain %s, received
+from IP %s, that failed DMARC evaluation. You are receiving this message because
+your address is specified in the "ruf" field of the DMARC record of %s.
+`, fm.FromDomain, fm.SourceIP, fm.Result.Domain)
+	textBody, ct, cte := xc.TextPart("plain", text)
+	textHdr := textproto.MIMEHeader{}
+	textHdr.Set("Content-Type", ct)
+	textHdr.Set("Content-Transfer-Encoding", cte)
+	textp, err := mp.CreatePart(textHdr)
+	xc.Checkf(err, "adding text part to message")
+	_, err = textp.Write(textBody)
+	xc.Checkf(err, "writing text part")
+
+	// Machine-readable report. ../rfc/5965:383 ../rfc/6591:183 ../rfc/7489:2028
+	redact := func(s string) string {
+		if conf.RedactAddresses {
+			return redactAddresses(s)
+		}
+		return s
+	}
+	var alignment []string
+	if fm.Result.AlignedDKIMPass {
+		alignment = append(alignment, "dkim")
+	}
+	if fm.Result.AlignedSPFPass {
+		alignment = append(alignment, "spf")
+	}
+	if len(alignment) == 0 {
+		alignment = []string{"none"}
+	}
+	var report strings.Builder
+	field := func(k, v string) {
+		fmt.Fprintf(&report, "%s: %s\r\n", k, v)
+	}
+	field("Feedback-Type", "auth-failure")
+	field("User-Agent", "mox/"+moxvar.Version)
+	field("Version", "1")
+	field("Original-Mail-From", "<"+redact(fm.MailFrom)+">")
+	field("Original-Rcpt-To", "<"+redact(fm.RcptTo)+">")
+	field("Arrival-Date", fm.Arrival.Format(message.RFC5322Z))
+	field("Source-IP", fm.SourceIP)
+	field("Reported-Domain", fm.FromDomain.ASCII)
+	report.WriteString(redact(fm.AuthResults))
+	field("Auth-Failure", "dmarc")
+	field("Identity-Alignment", strings.Join(alignment, ", "))
+	field("Delivery-Result", fm.DeliveryResult)
+
+	reportHdr := textproto.MIMEHeader{}
+	reportHdr.Set("Content-Type", "message/feedback-report")
+	reportp, err := mp.CreatePart(reportHdr)
+	xc.Checkf(err, "adding feedback report part to message")
+	_, err = reportp.Write([]byte(report.String()))
+	xc.Checkf(err, "writing feedback report")
+
+	// The message, or only its header. ../rfc/6591:326
+	msgHdr := textproto.MIMEHeader{}
+	if full {
+		msgHdr.Set("Content-Type", "message/rfc822")
+	} else {
+		msgHdr.Set("Content-Type", "text/rfc822-headers")
+	}
+	if xc.Has8bit {
+		msgHdr.Set("Content-Transfer-Encoding", "8bit")
+	}
+	msgp, err := mp.CreatePart(msgHdr)
+	xc.Checkf(err, "adding message part")
+	_, err = msgp.Write(content)
+	xc.Checkf(err, "writing message part")
+
+	err = mp.Close()
+	xc.Checkf(err, "closing multipart")
+
+	xc.Flush()
+
+	msgPrefix = dkimSign(ctx, log, fromAddr, xc.SMTPUTF8, mf)
+
+	return msgPrefix, xc.Has8bit, xc.SMTPUTF8, messageID, nil
+}
@@ -0,0 +1,185 @@
+package dmarcdb
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/dmarc"
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/moxio"
+	"github.com/mjl-/mox/queue"
+)
+
+func TestFailureReportOptions(t *testing.T) {
+	test := func(options []string, alignedDKIMPass, alignedSPFPass, dkimFail, spfFail, exp bool) {
+		t.Helper()
+		tcompare(t, failureReportOptions(options, alignedDKIMPass, alignedSPFPass, dkimFail, spfFail), exp)
+	}
+
+	test(nil, false, false, false, false, true)
+	test(nil, true, false, false, false, false)
+	test([]string{"0"}, false, true, false, false, false)
+	test([]string{"1"}, false, true, false, false, true)
+	test([]string{"1"}, true, true, false, false, false)
+	test([]string{"d"}, true, true, true, false, true)
+	test([]string{"d"}, false, false, false, true, false)
+	test([]string{"s"}, false, false, false, true, true)
+	test([]string{"d", "s"}, true, true, false, true, true)
+}
+
+func TestFailureReport(t *testing.T) {
+	os.RemoveAll("../testdata/dmarcdb/data")
+	mox.Context = ctxbg
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/dmarcdb/mox.conf")
+	mox.MustLoadConfig(true, false)
+
+	os.Remove(mox.DataDirPath("dmarceval.db"))
+	err := Init()
+	tcheckf(t, err, "init")
+	defer func() {
+		err := Close()
+		tcheckf(t, err, "close")
+	}()
+
+	mox.Conf.Static.DMARCFailureReports = &config.DMARCFailureReports{
+		MaxPerHour:      2,
+		RedactHeaders:   []string{"Subject"},
+		RedactAddresses: true,
+		ParsedDomains:   []dns.Domain{{ASCII: "sender.example"}},
+	}
+	defer func() {
+		mox.Conf.Static.DMARCFailureReports = nil
+	}()
+
+	record, _, err := dmarc.ParseRecord("v=DMARC1; p=reject; ruf=mailto:ruf@sender.example,mailto:ruf@other.example; fo=1")
+	tcheckf(t, err, "parse dmarc record")
+	result := dmarc.Result{Reject: true, Status: dmarc.StatusFail, AlignedSPFPass: true, Domain: dns.Domain{ASCII: "sender.example"}, Record: record}
+
+	tcompare(t, FailureReportRequested(dns.Domain{ASCII: "sender.example"}, result, false, false), true)
+	tcompare(t, FailureReportRequested(dns.Domain{ASCII: "sub.sender.example"}, result, false, false), true)
+	tcompare(t, FailureReportRequested(dns.Domain{ASCII: "other.example"}, result, false, false), false)
+	r := result
+	r.AlignedDKIMPass = true
+	tcompare(t, FailureReportRequested(dns.Domain{ASCII: "sender.example"}, r, false, false), false)
+	record2 := *record
+	record2.ReportingFormat = []string{"iodef"}
+	r = result
+	r.Record = &record2
+	tcompare(t, FailureReportRequested(dns.Domain{ASCII: "sender.example"}, r, false, false), false)
+
+	msg := strings.ReplaceAll(`From: <mjl@sender.example>
+To: <info@mox.example>
+Subject: secret
+Message-Id: <test@sender.example>
+
+body
+`, "\n", "\r\n")
+	headerOnly, err := FailureReportMessage(strings.NewReader(msg), int64(len(msg)), int64(strings.Index(msg, "body")))
+	tcheckf(t, err, "failure report message")
+	tcompare(t, strings.HasSuffix(string(headerOnly), "\r\n\r\n"), true)
+	mox.Conf.Static.DMARCFailureReports.IncludeBody = true
+	full, err := FailureReportMessage(strings.NewReader(msg), int64(len(msg)), int64(strings.Index(msg, "body")))
+	tcheckf(t, err, "failure report message")
+	tcompare(t, string(full), msg)
+
+	var queued []string
+	queueAdd = func(ctx context.Context, log mlog.Log, senderAccount string, msgFile *os.File, qml ...queue.Msg) error {
+		tcompare(t, len(qml), 1)
+		tcompare(t, qml[0].IsDMARCReport, true)
+		buf, err := io.ReadAll(&moxio.AtReader{R: msgFile})
+		tcheckf(t, err, "read report message")
+		s := string(buf)
+		for _, exp := range []string{
+			"report-type=\"feedback-report\"",
+			"Feedback-Type: auth-failure\r\n",
+			"Auth-Failure: dmarc\r\n",
+			"Identity-Alignment: spf\r\n",
+			"Original-Mail-From: <redacted@sender.example>\r\n",
+			"Delivery-Result: reject\r\n",
+			"Content-Type: message/rfc822",
+			"From: <redacted@sender.example>\r\n",
+			"\r\nbody\r\n",
+		} {
+			if !strings.Contains(s, exp) {
+				t.Fatalf("report does not contain %q:\n%s", exp, s)
+			}
+		}
+		if strings.Contains(s, "secret") || strings.Contains(s, "mjl@") {
+			t.Fatalf("report contains redacted data:\n%s", s)
+		}
+		queued = append(queued, qml[0].Recipient().String())
+		return nil
+	}
+	defer func() {
+		queueAdd = queue.Add
+	}()
+
+	fm := FailureMessage{
+		FromDomain:     dns.Domain{ASCII: "sender.example"},
+		Result:         result,
+		SourceIP:       "10.1.2.3",
+		MailFrom:       "mjl@sender.example",
+		RcptTo:         "info@mox.example",
+		Arrival:        time.Now(),
+		DeliveryResult: "reject",
+		AuthResults:    "Authentication-Results: mail.mox.example; dmarc=fail header.from=sender.example\r\n",
+		Message:        full,
+	}
+
+	// External address other.example did not opt in, we only send to the address in
+	// the organizational domain.
+	log := mlog.New("dmarcdb", nil)
+	resolver := dns.MockResolver{}
+	err = SendFailureReport(ctxbg, log, resolver, fm)
+	tcheckf(t, err, "send failure report")
+	tcompare(t, queued, []string{"ruf@sender.example"})
+
+	// Rate limited after 2 reports in an hour.
+	err = SendFailureReport(ctxbg, log, resolver, fm)
+	tcheckf(t, err, "send failure report")
+	err = SendFailureReport(ctxbg, log, resolver, fm)
+	tcheckf(t, err, "send failure report")
+	tcompare(t, len(queued), 2)
+
+	// Suppressed addresses don't get reports, and don't count for the rate limit.
+	err = EvalDB.Delete(ctxbg, &FailureReport{ID: 1})
+	tcheckf(t, err, "remove failure report")
+	sa := SuppressAddress{ReportingAddress: "ruf@sender.example", Until: time.Now().Add(time.Minute)}
+	err = EvalDB.Insert(ctxbg, &sa)
+	tcheckf(t, err, "insert suppress address")
+	err = SendFailureReport(ctxbg, log, resolver, fm)
+	tcheckf(t, err, "send failure report")
+	tcompare(t, len(queued), 2)
+	err = EvalDB.Delete(ctxbg, &sa)
+	tcheckf(t, err, "remove suppress address")
+	err = SendFailureReport(ctxbg, log, resolver, fm)
+	tcheckf(t, err, "send failure report")
+	tcompare(t, len(queued), 3)
+
+	// The rate limit is per reporting domain, not per policy domain. Another policy
+	// domain with reports sent to sender.example is limited as well, but its own
+	// reporting domain is not.
+	record3, _, err := dmarc.ParseRecord("v=DMARC1; p=reject; ruf=mailto:ruf@sender.example,mailto:ruf@third.example; fo=1")
+	tcheckf(t, err, "parse dmarc record")
+	fm3 := fm
+	fm3.FromDomain = dns.Domain{ASCII: "third.example"}
+	fm3.Result.Domain = fm3.FromDomain
+	fm3.Result.Record = record3
+	resolver = dns.MockResolver{
+		TXT: map[string][]string{
+			"third.example._report._dmarc.sender.example.": {"v=DMARC1"},
+		},
+	}
+	queued = nil
+	err = SendFailureReport(ctxbg, log, resolver, fm3)
+	tcheckf(t, err, "send failure report")
+	tcompare(t, queued, []string{"ruf@third.example"})
+}
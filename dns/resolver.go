@@ -17,7 +17,6 @@ import (
 	"github.com/mjl-/mox/stub"
 )
 
-// todo future: replace with a dnssec capable resolver
 // todo future: change to interface that is closer to DNS. 1. expose nxdomain vs success with zero entries: nxdomain means the name does not exist for any dns resource record type, success with zero records means the name exists for other types than the requested type; 2. add ability to not follow cname records when resolving. the net resolver automatically follows cnames for LookupHost, LookupIP, LookupIPAddr. when resolving names found in mx records, we explicitly must not follow cnames. that seems impossible at the moment. 3. when looking up a cname, actually lookup the record? "net" LookupCNAME will return the requested name with no error if there is no CNAME record. because it returns the canonical name.
 // todo future: add option to not use anything in the cache, for the admin pages where you check the latest DNS settings, ignoring old cached info.
 
@@ -29,6 +28,11 @@ var (
 	MetricLookup stub.HistogramVec = stub.HistogramVecIgnore{}
 )
 
+// Recursive is used for lookups by a StrictResolver without explicit Resolver
+// when set, instead of adns.DefaultResolver. It is set at startup when the
+// built-in DNSSEC-validating recursive resolver is enabled.
+var Recursive Resolver
+
 // Resolver is the interface strict resolver implements.
 type Resolver interface {
 	LookupPort(ctx context.Context, network, service string) (port int, err error)
@@ -59,7 +63,7 @@ func WithPackage(resolver Resolver, name string) Resolver {
 // preventing "search"-relative lookups.
 type StrictResolver struct {
 	Pkg      string         // Name of subsystem that is making DNS requests, for metrics.
-	Resolver *adns.Resolver // Where the actual lookups are done. If nil, adns.DefaultResolver is used for lookups.
+	Resolver *adns.Resolver // Where the actual lookups are done. If nil, Recursive is used if set, otherwise adns.DefaultResolver.
 	Log      *slog.Logger
 }
 
@@ -103,6 +107,9 @@ func (r StrictResolver) WithPackage(name string) Resolver {
 
 func (r StrictResolver) resolver() Resolver {
 	if r.Resolver == nil {
+		if Recursive != nil {
+			return Recursive
+		}
 		return adns.DefaultResolver
 	}
 	return r.Resolver
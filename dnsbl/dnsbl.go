@@ -12,6 +12,12 @@
 //
 // The health of a DNSBL "zone" can be checked through a lookup of 127.0.0.1
 // (must not be present) and 127.0.0.2 (must be present).
+//
+// Domain-based block lists (also known as URIBLs or DBLs) contain domains
+// instead of IPs, e.g. domains linked to from spam messages. They are queried
+// with a name composed of the domain and the zone, e.g.
+// "example.com.dbl.example". Their health is checked through lookups of "test"
+// (must be present) and "invalid" (must not be present).
 package dnsbl
 
 import (
@@ -93,15 +99,56 @@ func Lookup(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, zone
 	} else if err != nil {
 		return StatusTemperr, "", fmt.Errorf("%w: %s", ErrDNS, err)
 	}
+	return StatusFail, lookupExplanation(ctx, log, resolver, addr), nil
+}
 
+// LookupDomain checks if "domain" occurs in the domain-based DNS block list
+// "zone" (e.g. dbl.example.org), as used for checking domains in links in
+// messages.
+//
+// Some block lists return addresses in 127.255.255.0/24 for errors, e.g. when
+// queried through a public DNS resolver. Those are returned as an error, not as a
+// listing.
+func LookupDomain(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, zone dns.Domain, domain dns.Domain) (rstatus Status, rexplanation string, rerr error) {
+	log := mlog.New("dnsbl", elog)
+	start := time.Now()
+	defer func() {
+		MetricLookup.ObserveLabels(float64(time.Since(start))/float64(time.Second), zone.Name(), string(rstatus))
+		log.Debugx("dnsbl domain lookup result", rerr,
+			slog.Any("zone", zone),
+			slog.Any("domain", domain),
+			slog.Any("status", rstatus),
+			slog.String("explanation", rexplanation),
+			slog.Duration("duration", time.Since(start)))
+	}()
+
+	// RFC 5782, section 2.2: Names are looked up like IPs, with the domain instead of
+	// the reversed IP.
+	addr := domain.ASCII + "." + zone.ASCII + "."
+	ips, _, err := dns.WithPackage(resolver, "dnsbl").LookupIP(ctx, "ip4", addr)
+	if dns.IsNotFound(err) {
+		return StatusPass, "", nil
+	} else if err != nil {
+		return StatusTemperr, "", fmt.Errorf("%w: %s", ErrDNS, err)
+	}
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil && ip4[0] == 127 && ip4[1] == 255 && ip4[2] == 255 {
+			return StatusTemperr, "", fmt.Errorf("dnsbl returned error code %s", ip)
+		}
+	}
+	return StatusFail, lookupExplanation(ctx, log, resolver, addr), nil
+}
+
+// lookupExplanation returns the TXT records for a listing, for more information.
+func lookupExplanation(ctx context.Context, log mlog.Log, resolver dns.Resolver, addr string) string {
 	txts, _, err := dns.WithPackage(resolver, "dnsbl").LookupTXT(ctx, addr)
 	if dns.IsNotFound(err) {
-		return StatusFail, "", nil
+		return ""
 	} else if err != nil {
 		log.Debugx("looking up txt record from dnsbl", err, slog.String("addr", addr))
-		return StatusFail, "", nil
+		return ""
 	}
-	return StatusFail, strings.Join(txts, "; "), nil
+	return strings.Join(txts, "; ")
 }
 
 // CheckHealth checks whether the DNSBL "zone" is operating correctly by
@@ -133,3 +180,31 @@ func CheckHealth(ctx context.Context, elog *slog.Logger, resolver dns.Resolver,
 	}
 	return ErrDNS
 }
+
+// CheckDomainHealth checks whether the domain-based DNSBL "zone" is operating
+// correctly by querying for "test" (must be present) and "invalid" (must not be
+// present), as required by RFC 5782, section 5.
+// For temporary errors, ErrDNS is returned.
+func CheckDomainHealth(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, zone dns.Domain) (rerr error) {
+	log := mlog.New("dnsbl", elog)
+	start := time.Now()
+	defer func() {
+		log.Debugx("dnsbl domain healthcheck result", rerr, slog.Any("zone", zone), slog.Duration("duration", time.Since(start)))
+	}()
+
+	status1, _, err1 := LookupDomain(ctx, log.Logger, resolver, zone, dns.Domain{ASCII: "invalid"})
+	status2, _, err2 := LookupDomain(ctx, log.Logger, resolver, zone, dns.Domain{ASCII: "test"})
+	if status1 == StatusPass && status2 == StatusFail {
+		return nil
+	} else if status1 == StatusFail {
+		return fmt.Errorf("dnsbl contains unwanted test domain invalid")
+	} else if status2 == StatusPass {
+		return fmt.Errorf("dnsbl does not contain required test domain test")
+	}
+	if err1 != nil {
+		return err1
+	} else if err2 != nil {
+		return err2
+	}
+	return ErrDNS
+}
@@ -64,3 +64,54 @@ func TestDNSBL(t *testing.T) {
 		t.Fatalf("bad dnsbl is healthy")
 	}
 }
+
+func TestDNSBLDomain(t *testing.T) {
+	ctx := context.Background()
+	log := mlog.New("dnsbl", nil)
+
+	resolver := dns.MockResolver{
+		A: map[string][]string{
+			"test.dbl.example.":           {"127.0.1.2"}, // Required for health.
+			"spam.example.dbl.example.":   {"127.0.1.2"},
+			"public.example.dbl.example.": {"127.255.255.254"}, // Error code.
+			"test.error.example.":         {"127.255.255.254"},
+			"invalid.unhealthy.example.":  {"127.0.1.2"}, // Should not be present.
+			"test.unhealthy.example.":     {"127.0.1.2"},
+		},
+		TXT: map[string][]string{
+			"spam.example.dbl.example.": {"listed!"},
+		},
+	}
+
+	zone := dns.Domain{ASCII: "dbl.example"}
+	if status, expl, err := LookupDomain(ctx, log.Logger, resolver, zone, dns.Domain{ASCII: "spam.example"}); err != nil {
+		t.Fatalf("lookup: %v", err)
+	} else if status != StatusFail {
+		t.Fatalf("lookup, got status %v, expected fail", status)
+	} else if expl != "listed!" {
+		t.Fatalf("lookup, got explanation %q", expl)
+	}
+
+	if status, _, err := LookupDomain(ctx, log.Logger, resolver, zone, dns.Domain{ASCII: "ham.example"}); err != nil {
+		t.Fatalf("lookup: %v", err)
+	} else if status != StatusPass {
+		t.Fatalf("lookup, got status %v, expected pass", status)
+	}
+
+	if status, _, err := LookupDomain(ctx, log.Logger, resolver, zone, dns.Domain{ASCII: "public.example"}); err == nil || status != StatusTemperr {
+		t.Fatalf("lookup with error code, got status %v, err %v, expected temperror with error", status, err)
+	}
+
+	if err := CheckDomainHealth(ctx, log.Logger, resolver, zone); err != nil {
+		t.Fatalf("dnsbl not healthy: %v", err)
+	}
+	if err := CheckDomainHealth(ctx, log.Logger, resolver, dns.Domain{ASCII: "error.example"}); err == nil {
+		t.Fatalf("dnsbl returning error codes is healthy")
+	}
+	if err := CheckDomainHealth(ctx, log.Logger, resolver, dns.Domain{ASCII: "unhealthy.example"}); err == nil {
+		t.Fatalf("bad dnsbl is healthy")
+	}
+	if err := CheckDomainHealth(ctx, log.Logger, resolver, dns.Domain{ASCII: "empty.example"}); err == nil {
+		t.Fatalf("empty dnsbl is healthy")
+	}
+}
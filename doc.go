@@ -21,9 +21,11 @@ any parameters. Followed by the help and usage information for each command.
 	mox [-config config/mox.conf] [-pedantic] ...
 	mox serve
 	mox quickstart [-skipdial] [-existing-webserver] [-hostname host] user@domain [user | uid]
+	mox setup [-listen address]
 	mox stop
 	mox setaccountpassword account
 	mox setadminpassword
+	mox setadmintotp
 	mox loglevels [level [pkg]]
 	mox queue holdrules list
 	mox queue holdrules add [ruleflags]
@@ -47,6 +49,12 @@ any parameters. Followed by the help and usage information for each command.
 	mox queue webhook schedule [filterflags] duration
 	mox queue webhook cancel [filterflags]
 	mox queue webhook print id
+	mox ipban list
+	mox ipban add [-duration duration] [-reason text] ip-or-network
+	mox ipban rm ip-or-network
+	mox ipban allowlist list
+	mox ipban allowlist add [-comment text] ip-or-network
+	mox ipban allowlist rm ip-or-network
 	mox queue webhook retired list [filtersortflags]
 	mox queue webhook retired print id
 	mox import maildir accountname mailboxname maildir
@@ -79,6 +87,9 @@ any parameters. Followed by the help and usage information for each command.
 	mox config tlspubkey add address [name] < cert.pem
 	mox config tlspubkey rm fingerprint
 	mox config tlspubkey gen stem
+	mox config apikey list account
+	mox config apikey add [-expires duration] [-ip range ...] account name scope,...
+	mox config apikey rm account id
 	mox config alias list domain
 	mox config alias print alias
 	mox config alias add alias@domain rcpt1@domain ...
@@ -104,12 +115,13 @@ any parameters. Followed by the help and usage information for each command.
 	mox dkim txt <$selector._domainkey.$domain.key.pkcs8.pem
 	mox dkim verify message
 	mox dkim sign message
-	mox dmarc lookup domain
+	mox dmarc lookup [-bis] domain
 	mox dmarc parsereportmsg message ...
-	mox dmarc verify remoteip mailfromaddress helodomain < message
+	mox dmarc verify [-bis] remoteip mailfromaddress helodomain < message
 	mox dmarc checkreportaddrs domain
 	mox dnsbl check zone ip
 	mox dnsbl checkhealth zone
+	mox junk evaluate account [hammailbox spammailbox]
 	mox mtasts lookup domain
 	mox rdap domainage domain
 	mox retrain [accountname]
@@ -128,6 +140,7 @@ any parameters. Followed by the help and usage information for each command.
 	mox fixuidmeta account
 	mox fixmsgsize [account]
 	mox reparse [account]
+	mox rebuildsearchindex [account]
 	mox ensureparsed account
 	mox recalculatemailboxcounts account
 	mox message parse message.eml
@@ -191,6 +204,31 @@ output of "mox config describe-domains" and see the output of
 	  -skipdial
 	    	skip check for outgoing smtp (port 25) connectivity or for domain age with rdap
 
+# mox setup
+
+Setup starts a web interface on localhost for interactively setting up mox.
+
+Setup is the interactive counterpart of "mox quickstart". It starts a temporary
+web server on localhost, protected with a random token that is part of the URL
+printed at startup. Open that URL in a browser. If mox is set up on a remote
+machine, forward the port with ssh, e.g. "ssh -L 1079:localhost:1079
+you@yourmachine".
+
+The web interface walks through detecting the hostname and IPs of the machine,
+the email address for the initial domain and account, and whether to use ACME
+for TLS certificates. Setup then generates the configuration files
+config/mox.conf and config/domains.conf, in the current directory, like
+quickstart. It shows the DNS records to create, and checks them live with the
+same checks as the admin web interface. On Linux, setup can install the systemd
+service file.
+
+If config/mox.conf already exists, setup skips generating a configuration and
+only helps with checking DNS records and installing the service file.
+
+	usage: mox setup [-listen address]
+	  -listen string
+	    	address to listen on for the setup web interface, should be a loopback address (default "localhost:1079")
+
 # mox stop
 
 Shut mox down, giving connections maximum 3 seconds to stop before closing them.
@@ -227,6 +265,18 @@ The password is read from stdin. Its bcrypt hash is stored in a file named
 
 	usage: mox setadminpassword
 
+# mox setadmintotp
+
+Set a new TOTP secret for the admin, as second factor for the web interface.
+
+A new secret is generated and stored in the file configured as AdminTOTPFile
+in mox.conf. The secret and an otpauth URI are printed, for adding to an
+authenticator app. After setting a secret, admin logins require a code from
+the authenticator app in addition to the admin password. Any previous secret
+stops working. To disable the second factor, remove AdminTOTPFile from mox.conf.
+
+	usage: mox setadmintotp
+
 # mox loglevels
 
 Print the log levels, or set a new default log level, or a level for the given package.
@@ -595,7 +645,7 @@ Prints list of webhooks, their IDs and basic information.
 	  -asc
 	    	sort ascending instead of descending (default)
 	  -event value
-	    	event this webhook is about: incoming, delivered, suppressed, delayed, failed, relayed, expanded, canceled, unrecognized
+	    	event this webhook is about: incoming, delivered, suppressed, delayed, failed, relayed, expanded, canceled, unrecognized, limitreached
 	  -ids value
 	    	comma-separated list of webhook IDs
 	  -n int
@@ -621,7 +671,7 @@ Schedule immediate delivery with "mox queue schedule -now 0".
 	  -account string
 	    	account that queued the message/webhook
 	  -event value
-	    	event this webhook is about: incoming, delivered, suppressed, delayed, failed, relayed, expanded, canceled, unrecognized
+	    	event this webhook is about: incoming, delivered, suppressed, delayed, failed, relayed, expanded, canceled, unrecognized, limitreached
 	  -ids value
 	    	comma-separated list of webhook IDs
 	  -n int
@@ -641,7 +691,7 @@ Fail delivery of matching webhooks.
 	  -account string
 	    	account that queued the message/webhook
 	  -event value
-	    	event this webhook is about: incoming, delivered, suppressed, delayed, failed, relayed, expanded, canceled, unrecognized
+	    	event this webhook is about: incoming, delivered, suppressed, delayed, failed, relayed, expanded, canceled, unrecognized, limitreached
 	  -ids value
 	    	comma-separated list of webhook IDs
 	  -n int
@@ -659,6 +709,63 @@ The webhook is printed to stdout as JSON.
 
 	usage: mox queue webhook print id
 
+# mox ipban list
+
+List IPs and networks that are currently banned.
+
+IPs are banned automatically after repeated failed authentication attempts,
+see IPBans in mox.conf, or manually with "mox ipban add". Connections from
+banned IPs are refused by all listeners.
+
+	usage: mox ipban list
+
+# mox ipban add
+
+Ban an IP or network.
+
+The IP or network in CIDR notation, e.g. 192.0.2.1 or 2001:db8::/64. Without
+duration, the ban does not expire. An existing ban for the same network is
+replaced.
+
+	usage: mox ipban add [-duration duration] [-reason text] ip-or-network
+	  -duration duration
+	    	duration of ban, e.g. 24h, no expiration if 0
+	  -reason string
+	    	reason for ban, for display only
+
+# mox ipban rm
+
+Remove ban for IP or network.
+
+The IP or network must match an existing ban exactly. Removing a ban also resets
+the escalating duration for a next automatic ban.
+
+	usage: mox ipban rm ip-or-network
+
+# mox ipban allowlist list
+
+List IPs and networks that are never banned.
+
+IPs in RateLimitAllowlist in mox.conf are never banned either.
+
+	usage: mox ipban allowlist list
+
+# mox ipban allowlist add
+
+Add IP or network to allowlist for bans.
+
+Existing bans covered by the network are no longer enforced.
+
+	usage: mox ipban allowlist add [-comment text] ip-or-network
+	  -comment string
+	    	comment, e.g. describing the hosts, for display only
+
+# mox ipban allowlist rm
+
+Remove IP or network from allowlist for bans.
+
+	usage: mox ipban allowlist rm ip-or-network
+
 # mox queue webhook retired list
 
 List matching webhooks in the retired queue.
@@ -671,7 +778,7 @@ Prints list of retired webhooks, their IDs and basic information.
 	  -asc
 	    	sort ascending instead of descending (default)
 	  -event value
-	    	event this webhook is about: incoming, delivered, suppressed, delayed, failed, relayed, expanded, canceled, unrecognized
+	    	event this webhook is about: incoming, delivered, suppressed, delayed, failed, relayed, expanded, canceled, unrecognized, limitreached
 	  -ids value
 	    	comma-separated list of retired webhook IDs
 	  -lastactivity string
@@ -1118,6 +1225,44 @@ error too, for reference.
 
 	usage: mox config tlspubkey gen stem
 
+# mox config apikey list
+
+List API keys for the webapi for an account.
+
+The keys themselves are not stored and cannot be listed, only their prefix.
+
+	usage: mox config apikey list account
+
+# mox config apikey add
+
+Add an API key for the webapi to an account, and print the new key.
+
+The key is used as password in HTTP basic authentication, with an email address
+of the account as username. The key is only printed once, it is not stored.
+
+Scopes determine the methods that can be called with the key:
+"send" for sending messages, "read" for retrieving, listing and searching
+messages and mailboxes and for the event stream, "manage" for adding, changing
+and removing messages and mailboxes, and "suppression" for managing the
+suppression list.
+
+Without -ip, the key can be used from any IP. Otherwise, only from IPs within
+the ranges, in CIDR notation.
+
+	usage: mox config apikey add [-expires duration] [-ip range ...] account name scope,...
+	  -expires duration
+	    	if non-zero, duration after which the key expires
+	  -ip value
+	    	ip range in CIDR notation the key can be used from, can be specified multiple times
+
+# mox config apikey rm
+
+Remove an API key for the webapi from an account.
+
+The ID is listed by "mox config apikey list".
+
+	usage: mox config apikey rm account id
+
 # mox config alias list
 
 Show aliases (lists) for domain.
@@ -1397,7 +1542,14 @@ headers prepended.
 
 Lookup dmarc policy for domain, a DNS TXT record at _dmarc.<domain>, validate and print it.
 
-	usage: mox dmarc lookup domain
+The domains where the DMARC record is looked up are printed, along with the
+organizational domain. By default, the organizational domain is found through
+the public suffix list, as in RFC 7489. With -bis, DMARCbis is used: the DMARC
+record and organizational domain are found through a DNS tree walk.
+
+	usage: mox dmarc lookup [-bis] domain
+	  -bis
+	    	use dmarcbis dns tree walk for policy discovery
 
 # mox dmarc parsereportmsg
 
@@ -1423,7 +1575,11 @@ For DSN messages, that address may be empty. The helo domain was specified at
 the beginning of the SMTP transaction that delivered the message. These values
 can be found in message headers.
 
-	usage: mox dmarc verify remoteip mailfromaddress helodomain < message
+With -bis, the DMARC policy is evaluated according to DMARCbis.
+
+	usage: mox dmarc verify [-bis] remoteip mailfromaddress helodomain < message
+	  -bis
+	    	evaluate according to dmarcbis, with dns tree walk for policy discovery
 
 # mox dmarc checkreportaddrs
 
@@ -1455,6 +1611,21 @@ The health of a DNS blocklist can be checked by querying for 127.0.0.1 and
 
 	usage: mox dnsbl checkhealth zone
 
+# mox junk evaluate
+
+Evaluate the junk filter of an account on its labeled messages.
+
+Without mailboxes, messages with the $Junk or $NotJunk flag are evaluated. With
+mailboxes, all messages in the ham and spam mailbox are evaluated. Each message
+is classified as if the junk filter had not been trained with it. Precision,
+recall and accuracy are printed, for the configured threshold. The junk filter
+is not modified.
+
+Useful for evaluating changes to the junk filter configuration, e.g. enabling
+features, after retraining.
+
+	usage: mox junk evaluate account [hammailbox spammailbox]
+
 # mox mtasts lookup
 
 Lookup the MTASTS record and policy for the domain.
@@ -1692,6 +1863,19 @@ while reparsing all messages.
 
 	usage: mox reparse [account]
 
+# mox rebuildsearchindex
+
+Rebuild the full-text search index for the account or all accounts.
+
+The index is kept up to date when messages are delivered, added and removed.
+Messages stored before the index existed are not in the index, and are searched
+by reading the message files, which is slow for large mailboxes. Rebuilding adds
+all messages to the index, and removes words no longer used from the index.
+Messages are indexed in batches, so other access to the mailboxes/messages are
+not blocked while rebuilding.
+
+	usage: mox rebuildsearchindex [account]
+
 # mox ensureparsed
 
 Ensure messages in the database have a pre-parsed MIME form in the database.
@@ -1706,9 +1890,9 @@ Recalculate message counts for all mailboxes in the account, and total message s
 
 When a message is added to/removed from a mailbox, or when message flags change,
 the total, unread, unseen and deleted messages are accounted, the total size of
-the mailbox, and the total message size for the account. In case of a bug in
-this accounting, the numbers could become incorrect. This command will find, fix
-and print them.
+the mailbox, and the total message size for the account. The size of calendar
+and contact objects is accounted too. In case of a bug in this accounting, the
+numbers could become incorrect. This command will find, fix and print them.
 
 	usage: mox recalculatemailboxcounts account
 
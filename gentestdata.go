@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
@@ -16,6 +17,7 @@ import (
 	"github.com/mjl-/mox/dmarcdb"
 	"github.com/mjl-/mox/dmarcrpt"
 	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/greylist"
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/mox-"
 	"github.com/mjl-/mox/moxvar"
@@ -226,6 +228,13 @@ Accounts:
 	err = tlsrptdb.AddReport(ctxbg, c.log, dns.Domain{ASCII: "mox.example"}, "tlsrpt@mox.example", false, &tlsr)
 	xcheckf(err, "adding tls report")
 
+	// Populate greylist.db.
+	err = greylist.Init(false)
+	xcheckf(err, "greylist init")
+	greylistParams := greylist.Params{Delay: 5 * time.Minute, RetryWindow: 24 * time.Hour, AllowDuration: 35 * 24 * time.Hour}
+	_, _, err = greylist.Check(ctxbg, c.log, greylistParams, greylist.IPGroup(net.ParseIP("192.0.2.1")), "other@other.example", []string{"test0@mox.example"}, []string{"other.example"})
+	xcheckf(err, "adding greylist triplet")
+
 	// Populate queue, with a message.
 	err = queue.Init()
 	xcheckf(err, "queue init")
@@ -0,0 +1,384 @@
+// Package greylist implements greylisting of incoming deliveries.
+//
+// A delivery attempt is identified by a triplet of remote IP group, MAIL FROM
+// address and RCPT TO address. The first delivery attempt for a triplet is
+// temporarily rejected. Legitimate mail servers retry the delivery, and a retry
+// after the configured delay and within the retry window is accepted. Many
+// spammers don't retry.
+//
+// The remote IP group is the IP network the connection came from, or the SPF
+// verified MAIL FROM domain, for large senders that retry from different IPs.
+// After a successful retry, the remote IP group and the DKIM/SPF-verified domains
+// of the message are allowlisted for a while, so later deliveries are not
+// delayed.
+package greylist
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/metrics"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/moxvar"
+)
+
+var (
+	metricCheck = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mox_greylist_check_total",
+			Help: "Greylisting checks of delivery attempts by result: allowlisted, knowndomain, passed, new, early.",
+		},
+		[]string{"result"},
+	)
+)
+
+var timeNow = time.Now // Tests override this.
+
+// Results of Check.
+const (
+	ResultAllowlisted = "allowlisted" // Remote IP group is allowlisted.
+	ResultKnownDomain = "knowndomain" // Message has a DKIM/SPF-verified known domain.
+	ResultPassed      = "passed"      // All triplets have passed greylisting.
+	ResultNew         = "new"         // Greylisted, first attempt for a triplet, or after the retry window expired.
+	ResultEarly       = "early"       // Greylisted, retry was too soon after the first attempt.
+)
+
+// Triplet is a delivery attempt for a recipient, from a remote IP group and
+// MAIL FROM address.
+type Triplet struct {
+	ID       int64
+	Group    string `bstore:"nonzero,unique Group+MailFrom+RcptTo"` // IP network, or "spf:" and SPF-verified MAIL FROM domain.
+	MailFrom string // Empty for null sender.
+	RcptTo   string `bstore:"nonzero"`
+
+	FirstSeen time.Time `bstore:"default now"`
+	LastSeen  time.Time `bstore:"default now"`
+	Attempts  int       // Delivery attempts, including the first.
+	Passed    time.Time // Time of first accepted retry. Zero if not yet passed.
+	Expires   time.Time `bstore:"index"` // End of retry window, or of allowlisting after passing.
+}
+
+// AllowedGroup is a remote IP group that has passed greylisting, and is
+// allowlisted until it expires.
+type AllowedGroup struct {
+	Group      string    // IP network, or "spf:" and SPF-verified MAIL FROM domain.
+	Added      time.Time `bstore:"default now"`
+	LastSeen   time.Time `bstore:"default now"`
+	Deliveries int       // Delivery attempts that passed greylisting, including the first.
+	Expires    time.Time `bstore:"index"`
+}
+
+// KnownDomain is a DKIM- or SPF-verified domain of a message that has passed
+// greylisting. Later messages with a verified known domain are not greylisted,
+// regardless of the remote IP.
+type KnownDomain struct {
+	Domain     string    // Domain name with unicode characters.
+	Added      time.Time `bstore:"default now"`
+	LastSeen   time.Time `bstore:"default now"`
+	Deliveries int
+	Expires    time.Time `bstore:"index"`
+}
+
+var DBTypes = []any{Triplet{}, AllowedGroup{}, KnownDomain{}} // Types stored in DB.
+var DB *bstore.DB                                             // Exported for backups.
+
+// Init opens the database. If cleaner is set, a goroutine is started that
+// periodically removes expired records.
+func Init(cleaner bool) error {
+	log := mlog.New("greylist", nil)
+
+	p := mox.DataDirPath("greylist.db")
+	os.MkdirAll(filepath.Dir(p), 0770)
+	opts := bstore.Options{Timeout: 5 * time.Second, Perm: 0660, RegisterLogger: moxvar.RegisterLogger(p, log.Logger)}
+	var err error
+	DB, err = bstore.Open(mox.Shutdown, p, &opts, DBTypes...)
+	if err != nil {
+		return err
+	}
+
+	if cleaner {
+		go clean(log, DB)
+	}
+
+	return nil
+}
+
+// Close closes the database.
+func Close() error {
+	if err := DB.Close(); err != nil {
+		return fmt.Errorf("close db: %w", err)
+	}
+	DB = nil
+	return nil
+}
+
+func clean(log mlog.Log, db *bstore.DB) {
+	defer func() {
+		x := recover()
+		if x != nil {
+			log.Error("greylist cleaner panic", slog.Any("err", x))
+			metrics.PanicInc(metrics.Greylist)
+		}
+	}()
+
+	for {
+		select {
+		case <-mox.Shutdown.Done():
+			return
+		case <-time.After(time.Hour):
+		}
+
+		n, err := Cleanup(mox.Shutdown, db)
+		if err != nil {
+			log.Errorx("removing expired greylist records", err)
+		} else if n > 0 {
+			log.Debug("removed expired greylist records", slog.Int("count", n))
+		}
+	}
+}
+
+// Cleanup removes expired triplets, allowlisted groups and known domains,
+// returning the number of removed records.
+func Cleanup(ctx context.Context, db *bstore.DB) (int, error) {
+	now := timeNow()
+	var n int
+	err := db.Write(ctx, func(tx *bstore.Tx) error {
+		nt, err := bstore.QueryTx[Triplet](tx).FilterLess("Expires", now).Delete()
+		if err != nil {
+			return fmt.Errorf("removing triplets: %w", err)
+		}
+		ng, err := bstore.QueryTx[AllowedGroup](tx).FilterLess("Expires", now).Delete()
+		if err != nil {
+			return fmt.Errorf("removing allowlisted groups: %w", err)
+		}
+		nd, err := bstore.QueryTx[KnownDomain](tx).FilterLess("Expires", now).Delete()
+		if err != nil {
+			return fmt.Errorf("removing known domains: %w", err)
+		}
+		n = nt + ng + nd
+		return nil
+	})
+	return n, err
+}
+
+// IPGroup returns the remote IP group for an IP: its IPv4 /24 or IPv6 /64
+// network. Mail servers of larger senders often retry from a different IP in the
+// same network.
+func IPGroup(ip net.IP) string {
+	var n net.IPNet
+	if ip4 := ip.To4(); ip4 != nil {
+		n = net.IPNet{IP: ip4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}
+	} else {
+		n = net.IPNet{IP: ip.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}
+	}
+	return n.String()
+}
+
+// SPFGroup returns the remote IP group for a delivery with an SPF-verified
+// MAIL FROM domain. Large senders retry from IPs in unrelated networks. An SPF
+// pass means the IP is authorized by the domain, so retries from all of its IPs
+// are in the same group.
+func SPFGroup(domain dns.Domain) string {
+	return "spf:" + domain.Name()
+}
+
+// Params are the greylisting settings of a listener.
+type Params struct {
+	Delay         time.Duration // Minimum time between first attempt and accepted retry.
+	RetryWindow   time.Duration // Maximum time after first attempt for an accepted retry.
+	AllowDuration time.Duration // How long groups, domains and triplets stay allowlisted after last use.
+}
+
+// Check decides whether a delivery attempt, from a remote IP group for
+// recipients, must be greylisted, i.e. temporarily rejected. If any of the
+// verifiedDomains (DKIM or SPF pass) is a known domain, or the group is
+// allowlisted, the message is not greylisted. Otherwise, each recipient triplet
+// must have passed greylisting. When all recipients pass, the group is
+// allowlisted and the verified domains become known.
+//
+// The returned result is one of the Result* constants.
+func Check(ctx context.Context, log mlog.Log, p Params, group, mailFrom string, rcptTo []string, verifiedDomains []string) (greylisted bool, result string, rerr error) {
+	defer func() {
+		if rerr == nil {
+			metricCheck.WithLabelValues(result).Inc()
+		}
+	}()
+
+	now := timeNow()
+	rerr = DB.Write(ctx, func(tx *bstore.Tx) error {
+		ag := AllowedGroup{Group: group}
+		err := tx.Get(&ag)
+		if err != nil && err != bstore.ErrAbsent {
+			return fmt.Errorf("get allowlisted group: %v", err)
+		}
+		groupNew := err == bstore.ErrAbsent
+		if !groupNew && ag.Expires.After(now) {
+			ag.LastSeen = now
+			ag.Deliveries++
+			ag.Expires = now.Add(p.AllowDuration)
+			result = ResultAllowlisted
+			return tx.Update(&ag)
+		}
+
+		for _, d := range verifiedDomains {
+			kd := KnownDomain{Domain: d}
+			if err := tx.Get(&kd); err != nil && err != bstore.ErrAbsent {
+				return fmt.Errorf("get known domain: %v", err)
+			} else if err == nil && kd.Expires.After(now) {
+				kd.LastSeen = now
+				kd.Deliveries++
+				kd.Expires = now.Add(p.AllowDuration)
+				result = ResultKnownDomain
+				return tx.Update(&kd)
+			}
+		}
+
+		result = ResultPassed
+		for _, rcpt := range rcptTo {
+			q := bstore.QueryTx[Triplet](tx)
+			q.FilterNonzero(Triplet{Group: group, RcptTo: rcpt})
+			q.FilterEqual("MailFrom", mailFrom)
+			t, err := q.Get()
+			if err == bstore.ErrAbsent || err == nil && !t.Expires.After(now) {
+				if err == nil {
+					if err := tx.Delete(&t); err != nil {
+						return fmt.Errorf("remove expired triplet: %v", err)
+					}
+				}
+				t = Triplet{Group: group, MailFrom: mailFrom, RcptTo: rcpt, FirstSeen: now, LastSeen: now, Attempts: 1, Expires: now.Add(p.RetryWindow)}
+				if err := tx.Insert(&t); err != nil {
+					return fmt.Errorf("insert triplet: %v", err)
+				}
+				log.Debug("greylisting new triplet", slog.String("group", group), slog.String("mailfrom", mailFrom), slog.String("rcptto", rcpt))
+				greylisted = true
+				result = ResultNew
+				continue
+			} else if err != nil {
+				return fmt.Errorf("get triplet: %v", err)
+			}
+
+			t.LastSeen = now
+			t.Attempts++
+			if t.Passed.IsZero() && now.Before(t.FirstSeen.Add(p.Delay)) {
+				greylisted = true
+				if result != ResultNew {
+					result = ResultEarly
+				}
+			} else {
+				if t.Passed.IsZero() {
+					t.Passed = now
+				}
+				t.Expires = now.Add(p.AllowDuration)
+			}
+			if err := tx.Update(&t); err != nil {
+				return fmt.Errorf("update triplet: %v", err)
+			}
+		}
+		if greylisted {
+			return nil
+		}
+
+		// All recipients passed, the remote IP group and verified domains are trusted
+		// from now on.
+		if groupNew {
+			ag.Added = now
+		}
+		ag.LastSeen = now
+		ag.Deliveries++
+		ag.Expires = now.Add(p.AllowDuration)
+		if err := upsert(tx, &ag, groupNew); err != nil {
+			return fmt.Errorf("storing allowlisted group: %v", err)
+		}
+		for _, d := range verifiedDomains {
+			kd := KnownDomain{Domain: d}
+			err := tx.Get(&kd)
+			if err != nil && err != bstore.ErrAbsent {
+				return fmt.Errorf("get known domain: %v", err)
+			}
+			isNew := err == bstore.ErrAbsent
+			if isNew {
+				kd.Added = now
+			}
+			kd.LastSeen = now
+			kd.Deliveries++
+			kd.Expires = now.Add(p.AllowDuration)
+			if err := upsert(tx, &kd, isNew); err != nil {
+				return fmt.Errorf("storing known domain: %v", err)
+			}
+		}
+		return nil
+	})
+	return
+}
+
+func upsert(tx *bstore.Tx, v any, isNew bool) error {
+	if isNew {
+		return tx.Insert(v)
+	}
+	return tx.Update(v)
+}
+
+// Stats has the numbers of greylisting records, and the most recently seen
+// pending triplets, allowlisted groups and known domains.
+type Stats struct {
+	Pending       int // Triplets that have not yet passed greylisting.
+	Passed        int // Triplets that have passed greylisting.
+	AllowedGroups int
+	KnownDomains  int
+	RecentPending []Triplet
+	RecentAllowed []AllowedGroup
+	RecentKnown   []KnownDomain
+}
+
+// GetStats returns statistics about greylisting, with up to limit recently seen
+// records of each kind. Expired records are not included.
+func GetStats(ctx context.Context, limit int) (Stats, error) {
+	now := timeNow()
+	var st Stats
+	err := DB.Read(ctx, func(tx *bstore.Tx) error {
+		var err error
+		st.Pending, err = bstore.QueryTx[Triplet](tx).FilterGreater("Expires", now).FilterEqual("Passed", time.Time{}).Count()
+		if err != nil {
+			return fmt.Errorf("counting pending triplets: %v", err)
+		}
+		st.Passed, err = bstore.QueryTx[Triplet](tx).FilterGreater("Expires", now).FilterNotEqual("Passed", time.Time{}).Count()
+		if err != nil {
+			return fmt.Errorf("counting passed triplets: %v", err)
+		}
+		st.AllowedGroups, err = bstore.QueryTx[AllowedGroup](tx).FilterGreater("Expires", now).Count()
+		if err != nil {
+			return fmt.Errorf("counting allowlisted groups: %v", err)
+		}
+		st.KnownDomains, err = bstore.QueryTx[KnownDomain](tx).FilterGreater("Expires", now).Count()
+		if err != nil {
+			return fmt.Errorf("counting known domains: %v", err)
+		}
+
+		st.RecentPending, err = bstore.QueryTx[Triplet](tx).FilterGreater("Expires", now).FilterEqual("Passed", time.Time{}).SortDesc("LastSeen").Limit(limit).List()
+		if err != nil {
+			return fmt.Errorf("listing pending triplets: %v", err)
+		}
+		st.RecentAllowed, err = bstore.QueryTx[AllowedGroup](tx).FilterGreater("Expires", now).SortDesc("LastSeen").Limit(limit).List()
+		if err != nil {
+			return fmt.Errorf("listing allowlisted groups: %v", err)
+		}
+		st.RecentKnown, err = bstore.QueryTx[KnownDomain](tx).FilterGreater("Expires", now).SortDesc("LastSeen").Limit(limit).List()
+		if err != nil {
+			return fmt.Errorf("listing known domains: %v", err)
+		}
+		return nil
+	})
+	return st, err
+}
@@ -0,0 +1,113 @@
+package greylist
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+)
+
+var ctxbg = context.Background()
+
+func tcheckf(t *testing.T, err error, format string, args ...any) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %s", fmt.Sprintf(format, args...), err)
+	}
+}
+
+func tcompare(t *testing.T, got, exp any) {
+	t.Helper()
+	if got != exp {
+		t.Fatalf("got %v, expected %v", got, exp)
+	}
+}
+
+func TestGreylist(t *testing.T) {
+	mox.Shutdown = ctxbg
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/greylist/fake.conf")
+	mox.Conf.Static.DataDir = "."
+
+	dbpath := mox.DataDirPath("greylist.db")
+	os.MkdirAll(filepath.Dir(dbpath), 0770)
+	os.Remove(dbpath)
+	defer os.Remove(dbpath)
+
+	log := mlog.New("greylist", nil)
+
+	err := Init(false)
+	tcheckf(t, err, "init database")
+	defer Close()
+
+	now := time.Now().Round(0)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	p := Params{Delay: 5 * time.Minute, RetryWindow: 24 * time.Hour, AllowDuration: 35 * 24 * time.Hour}
+
+	check := func(group, mailFrom string, rcptTo []string, verifiedDomains []string, expGreylisted bool, expResult string) {
+		t.Helper()
+		greylisted, result, err := Check(ctxbg, log, p, group, mailFrom, rcptTo, verifiedDomains)
+		tcheckf(t, err, "check")
+		tcompare(t, greylisted, expGreylisted)
+		tcompare(t, result, expResult)
+	}
+
+	group := IPGroup(net.ParseIP("192.0.2.10"))
+	tcompare(t, group, "192.0.2.0/24")
+	tcompare(t, IPGroup(net.ParseIP("2001:db8::1")), "2001:db8::/64")
+	tcompare(t, SPFGroup(dns.Domain{ASCII: "example.org"}), "spf:example.org")
+
+	rcpts := []string{"mjl@mox.example", "other@mox.example"}
+
+	// First attempt is greylisted, as is a retry that is too early.
+	check(group, "sender@remote.example", rcpts, []string{"remote.example"}, true, ResultNew)
+	now = now.Add(time.Minute)
+	check(group, "sender@remote.example", rcpts, []string{"remote.example"}, true, ResultEarly)
+
+	// An additional recipient is new, so still greylisted.
+	now = now.Add(5 * time.Minute)
+	check(group, "sender@remote.example", append(rcpts, "third@mox.example"), nil, true, ResultNew)
+
+	st, err := GetStats(ctxbg, 10)
+	tcheckf(t, err, "stats")
+	tcompare(t, st.Pending, 1)
+	tcompare(t, st.Passed, 2)
+	tcompare(t, st.AllowedGroups, 0)
+
+	// Retry after delay passes, and allowlists the group and verified domain.
+	check(group, "sender@remote.example", rcpts, []string{"remote.example"}, false, ResultPassed)
+	check(IPGroup(net.ParseIP("192.0.2.20")), "other@remote.example", []string{"new@mox.example"}, nil, false, ResultAllowlisted)
+
+	// Verified known domain from another network bypasses greylisting.
+	check(IPGroup(net.ParseIP("198.51.100.1")), "sender@remote.example", []string{"new@mox.example"}, []string{"remote.example"}, false, ResultKnownDomain)
+
+	// Unknown network and domain is greylisted.
+	check(IPGroup(net.ParseIP("198.51.100.1")), "sender@other.example", []string{"new@mox.example"}, []string{"other.example"}, true, ResultNew)
+
+	st, err = GetStats(ctxbg, 10)
+	tcheckf(t, err, "stats")
+	tcompare(t, st.Pending, 2)
+	tcompare(t, st.Passed, 2)
+	tcompare(t, st.AllowedGroups, 1)
+	tcompare(t, st.KnownDomains, 1)
+	tcompare(t, len(st.RecentPending), 2)
+
+	// After the retry window, a retry is treated as a first attempt.
+	now = now.Add(25 * time.Hour)
+	check(IPGroup(net.ParseIP("198.51.100.1")), "sender@other.example", []string{"new@mox.example"}, nil, true, ResultNew)
+
+	// Expired records are cleaned up.
+	now = now.Add(36 * 24 * time.Hour)
+	n, err := Cleanup(ctxbg, DB)
+	tcheckf(t, err, "cleanup")
+	tcompare(t, n, 6)
+	check(group, "sender@remote.example", rcpts, []string{"remote.example"}, true, ResultNew)
+}
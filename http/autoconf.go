@@ -168,6 +168,11 @@ func autoconfHandle(w http.ResponseWriter, r *http.Request) {
 		resp.EmailProvider.OutgoingServers = append(resp.EmailProvider.OutgoingServers, outgoingALPN)
 	}
 
+	if config.DAV != nil {
+		resp.AddressBook = &davServer{"carddav", email, "http-basic", config.DAV.URL()}
+		resp.Calendar = &davServer{"caldav", email, "http-basic", config.DAV.URL()}
+	}
+
 	// todo: should we put the email address in the URL?
 	resp.ClientConfigUpdate.URL = fmt.Sprintf("https://autoconfig.%s/mail/config-v1.1.xml", domain.ASCII)
 
@@ -330,11 +335,23 @@ type autoconfigResponse struct {
 		OutgoingServers []outgoingServer `xml:"outgoingServer"`
 	} `xml:"emailProvider"`
 
+	AddressBook *davServer `xml:"addressBook,omitempty"`
+	Calendar    *davServer `xml:"calendar,omitempty"`
+
 	ClientConfigUpdate struct {
 		URL string `xml:"url,attr"`
 	} `xml:"clientConfigUpdate"`
 }
 
+// davServer is a CardDAV or CalDAV server in an autoconfig response, as
+// understood by Thunderbird.
+type davServer struct {
+	Type           string `xml:"type,attr"`
+	Username       string `xml:"username"`
+	Authentication string `xml:"authentication"`
+	ServerURL      string `xml:"serverURL"`
+}
+
 type autodiscoverRequest struct {
 	XMLName xml.Name `xml:"Autodiscover"`
 	Request struct {
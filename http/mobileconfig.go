@@ -100,7 +100,8 @@ func (m dict) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 	return nil
 }
 
-// MobileConfig returns a device profile for a macOS Mail email account. The file
+// MobileConfig returns a device profile for a macOS Mail email account, and
+// calendar and contacts accounts if CalDAV/CardDAV is enabled. The file
 // should have a .mobileconfig extension. Opening the file adds it to Profiles in
 // System Preferences, where it can be installed. This profile does not contain a
 // password because sending opaque files containing passwords around to users seems
@@ -187,6 +188,39 @@ func MobileConfig(addresses []string, fullName string) ([]byte, error) {
 			},
 		}),
 	}
+	if config.DAV != nil {
+		// Clients find the principal through the current-user-principal property of the
+		// DAV root.
+		content := p.Dict["PayloadContent"].(array)
+		content = append(content,
+			dict(map[string]any{
+				"CalDAVAccountDescription": addresses[0] + " calendars",
+				"CalDAVHostName":           config.DAV.Host.ASCII,
+				"CalDAVPort":               config.DAV.Port,
+				"CalDAVPrincipalURL":       config.DAV.Path,
+				"CalDAVUseSSL":             true,
+				"CalDAVUsername":           addresses[0],
+				"PayloadIdentifier":        reverseAddr + ".caldav.account",
+				"PayloadType":              "com.apple.caldav.account",
+				"PayloadUUID":              uuid("caldav"),
+				"PayloadVersion":           1,
+			}),
+			dict(map[string]any{
+				"CardDAVAccountDescription": addresses[0] + " contacts",
+				"CardDAVHostName":           config.DAV.Host.ASCII,
+				"CardDAVPort":               config.DAV.Port,
+				"CardDAVPrincipalURL":       config.DAV.Path,
+				"CardDAVUseSSL":             true,
+				"CardDAVUsername":           addresses[0],
+				"PayloadIdentifier":         reverseAddr + ".carddav.account",
+				"PayloadType":               "com.apple.carddav.account",
+				"PayloadUUID":               uuid("carddav"),
+				"PayloadVersion":            1,
+			}),
+		)
+		p.Dict["PayloadContent"] = content
+	}
+
 	if _, err := fmt.Fprint(&w, xml.Header); err != nil {
 		return nil, err
 	}
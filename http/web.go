@@ -32,12 +32,14 @@ import (
 
 	"github.com/mjl-/mox/autotls"
 	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/davserver"
 	"github.com/mjl-/mox/dns"
 	"github.com/mjl-/mox/imapserver"
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/mox-"
 	"github.com/mjl-/mox/ratelimit"
 	"github.com/mjl-/mox/smtpserver"
+	"github.com/mjl-/mox/store"
 	"github.com/mjl-/mox/webaccount"
 	"github.com/mjl-/mox/webadmin"
 	"github.com/mjl-/mox/webapisrv"
@@ -401,12 +403,13 @@ type serve struct {
 	TLSConfig         *tls.Config
 	NextProto         tlsNextProtoMap // For HTTP server, when we do submission/imap with ALPN over the HTTPS port.
 	Favicon           bool
-	Forwarded         bool // Requests are coming from a reverse proxy, we'll use X-Forwarded-For for the IP address to ratelimit.
-	RateLimitDisabled bool // Don't apply ratelimiting.
+	Forwarded         bool               // Requests are coming from a reverse proxy, we'll use X-Forwarded-For for the IP address to ratelimit.
+	RateLimitDisabled bool               // Don't apply ratelimiting.
+	Limiter           *ratelimit.Limiter // If nil, the default limiter is used.
 
 	// SystemHandlers are for MTA-STS, autoconfig, ACME validation. They can't be
 	// overridden by WebHandlers. WebHandlers are evaluated next, and the internal
-	// service handlers from Listeners in mox.conf (for admin, account, webmail, webapi
+	// service handlers from Listeners in mox.conf (for admin, account, webmail, webapi, dav
 	// interfaces) last. WebHandlers can also pass requests to the internal servers.
 	// This order allows admins to serve other content on domains serving the mox.conf
 	// internal services.
@@ -424,25 +427,27 @@ func (s *serve) SystemHandle(name string, hostMatch func(dns.IPDomain) bool, pat
 }
 
 // Like SystemHandle, but for internal services "admin", "account", "webmail",
-// "webapi" configured in the mox.conf Listener.
+// "webapi", "dav" configured in the mox.conf Listener.
 func (s *serve) ServiceHandle(name string, hostMatch func(dns.IPDomain) bool, path string, fn http.Handler) {
 	s.ServiceHandlers = append(s.ServiceHandlers, pathHandler{name, hostMatch, path, fn})
 }
 
-var (
-	limiterConnectionrate = &ratelimit.Limiter{
-		WindowLimits: []ratelimit.WindowLimit{
-			{
-				Window: time.Minute,
-				Limits: [...]int64{1000, 3000, 9000},
-			},
-			{
-				Window: time.Hour,
-				Limits: [...]int64{5000, 15000, 45000},
-			},
+// Default limiter, for listeners without configured limits. Applied to requests,
+// not connections.
+var limiterConnectionrate = newLimiterConnectionrate(nil)
+
+func newLimiterConnectionrate(limits []config.RateLimit) *ratelimit.Limiter {
+	return mox.NewLimiter(limits, []ratelimit.WindowLimit{
+		{
+			Window: time.Minute,
+			Limits: [...]int64{1000, 3000, 9000},
 		},
-	}
-)
+		{
+			Window: time.Hour,
+			Limits: [...]int64{5000, 15000, 45000},
+		},
+	})
+}
 
 // ServeHTTP is the starting point for serving HTTP requests. It dispatches to the
 // right pathHandler or WebHandler, and it generates access logs and tracks
@@ -472,7 +477,22 @@ func (s *serve) ServeHTTP(xw http.ResponseWriter, r *http.Request) {
 		if ip == nil && ipstr != "" {
 			pkglog.Debug("ratelimit: invalid ip", slog.String("ip", ipstr))
 		}
-		if ip != nil && !limiterConnectionrate.Add(ip, now, 1) {
+		if ip != nil && store.IPBanned(ip) {
+			method := metricHTTPMethod(r.Method)
+			proto := "http"
+			if r.TLS != nil {
+				proto = "https"
+			}
+			metricRequest.WithLabelValues("(banned)", proto, method, "403").Observe(0)
+			http.Error(xw, "403 - ip or network banned", http.StatusForbidden)
+			return
+		}
+
+		limiter := s.Limiter
+		if limiter == nil {
+			limiter = limiterConnectionrate
+		}
+		if ip != nil && !limiter.Add(ip, now, 1) {
 			method := metricHTTPMethod(r.Method)
 			proto := "http"
 			if r.TLS != nil {
@@ -571,9 +591,23 @@ func redirectToTrailingSlash(srv *serve, hostMatch func(dns.IPDomain) bool, name
 	}
 }
 
+// davWellKnown redirects the well-known CalDAV and CardDAV locations to the DAV
+// service at path, RFC 6764 section 5.
+func davWellKnown(srv *serve, hostMatch func(dns.IPDomain) bool, path string) {
+	handler := mox.SafeHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, path, http.StatusMovedPermanently)
+	}))
+	srv.ServiceHandle("dav", hostMatch, "/.well-known/caldav", handler)
+	srv.ServiceHandle("dav", hostMatch, "/.well-known/carddav", handler)
+}
+
 // Listen binds to sockets for HTTP listeners, including those required for ACME to
 // generate TLS certificates. It stores the listeners so Serve can start serving them.
 func Listen() {
+	// Limiter with the loaded config.
+	limiterConnectionrate = newLimiterConnectionrate(nil)
+	mox.RegisterLimiter("http-requestrate", limiterConnectionrate, true)
+
 	// Initialize listeners in deterministic order for the same potential error
 	// messages.
 	names := slices.Sorted(maps.Keys(mox.Conf.Static.Listeners))
@@ -581,6 +615,14 @@ func Listen() {
 		l := mox.Conf.Static.Listeners[name]
 		portServe := portServes(name, l)
 
+		if l.RateLimits.HTTP != nil && len(l.RateLimits.HTTP.Rate) > 0 {
+			limiter := newLimiterConnectionrate(l.RateLimits.HTTP.Rate)
+			mox.RegisterLimiter("http-requestrate-"+name, limiter, true)
+			for _, srv := range portServe {
+				srv.Limiter = limiter
+			}
+		}
+
 		ports := slices.Sorted(maps.Keys(portServe))
 		for _, port := range ports {
 			srv := portServe[port]
@@ -618,7 +660,7 @@ func portServes(name string, l config.Listener) map[int]*serve {
 	ensureServe = func(https, forwarded, rateLimitDisabled bool, port int, kind string, favicon bool) *serve {
 		s := portServe[port]
 		if s == nil {
-			s = &serve{nil, nil, tlsNextProtoMap{}, false, false, false, nil, false, nil}
+			s = &serve{nil, nil, tlsNextProtoMap{}, false, false, false, nil, nil, false, nil}
 			portServe[port] = s
 		}
 		s.Kinds = append(s.Kinds, kind)
@@ -759,6 +801,32 @@ func portServes(name string, l config.Listener) map[int]*serve {
 		redirectToTrailingSlash(srv, accountHostMatch, "webapi", path)
 	}
 
+	if l.DAVHTTP.Enabled {
+		port := config.Port(l.DAVHTTP.Port, 80)
+		path := "/dav/"
+		if l.DAVHTTP.Path != "" {
+			path = l.DAVHTTP.Path
+		}
+		srv := ensureServe(false, l.DAVHTTP.Forwarded, false, port, "dav-http at "+path, false)
+		handler := mox.SafeHeaders(http.StripPrefix(strings.TrimRight(path, "/"), davserver.NewServer(path, l.DAVHTTP.Forwarded)))
+		srv.ServiceHandle("dav", accountHostMatch, path, handler)
+		redirectToTrailingSlash(srv, accountHostMatch, "dav", path)
+		davWellKnown(srv, accountHostMatch, path)
+		ensureACMEHTTP01(srv)
+	}
+	if l.DAVHTTPS.Enabled {
+		port := config.Port(l.DAVHTTPS.Port, 443)
+		path := "/dav/"
+		if l.DAVHTTPS.Path != "" {
+			path = l.DAVHTTPS.Path
+		}
+		srv := ensureServe(true, l.DAVHTTPS.Forwarded, false, port, "dav-https at "+path, false)
+		handler := mox.SafeHeaders(http.StripPrefix(strings.TrimRight(path, "/"), davserver.NewServer(path, l.DAVHTTPS.Forwarded)))
+		srv.ServiceHandle("dav", accountHostMatch, path, handler)
+		redirectToTrailingSlash(srv, accountHostMatch, "dav", path)
+		davWellKnown(srv, accountHostMatch, path)
+	}
+
 	if l.WebmailHTTP.Enabled {
 		port := config.Port(l.WebmailHTTP.Port, 80)
 		path := "/webmail/"
@@ -865,7 +933,7 @@ func portServes(name string, l config.Listener) map[int]*serve {
 		if _, ok := portServe[port]; ok {
 			pkglog.Fatal("cannot serve pprof on same endpoint as other http services")
 		}
-		srv := &serve{[]string{"pprof-http"}, nil, nil, false, false, false, nil, false, nil}
+		srv := &serve{[]string{"pprof-http"}, nil, nil, false, false, false, nil, nil, false, nil}
 		portServe[port] = srv
 		srv.SystemHandle("pprof", nil, "/", http.DefaultServeMux)
 	}
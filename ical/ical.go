@@ -0,0 +1,399 @@
+// Package ical parses and writes iCalendar (RFC 5545) and vCard (RFC 6350)
+// data, and handles scheduling messages sent by email (iMIP, RFC 6047).
+//
+// Parsing is minimal: data is split into components and content lines. Values
+// are not interpreted, except by the functions for specific value types.
+package ical
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrSyntax is returned for data that cannot be parsed.
+var ErrSyntax = errors.New("syntax error")
+
+// Component is a parsed iCalendar component, like VCALENDAR or VEVENT, or a vCard.
+type Component struct {
+	Name  string // Upper case, e.g. VCALENDAR, VEVENT, VCARD.
+	Props []ContentLine
+	Comps []*Component
+}
+
+// ContentLine is a property of a component.
+type ContentLine struct {
+	Group  string            // For vCard, e.g. "ITEM1" for "item1.EMAIL".
+	Name   string            // Upper case.
+	Params map[string]string // Upper case names, first value, unquoted.
+	Value  string            // Not unescaped.
+
+	params []string // Parameters as written, e.g. `CN="Mox"`, for writing.
+}
+
+// Limits while parsing.
+const (
+	maxComponentDepth = 8
+	maxContentLines   = 100000
+)
+
+// Parse parses data with a single top-level component.
+func Parse(data string) (*Component, error) {
+	// Unfold lines, RFC 5545 section 3.1, RFC 6350 section 3.2.
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\n ", "")
+	data = strings.ReplaceAll(data, "\n\t", "")
+	lines := strings.Split(data, "\n")
+	if len(lines) > maxContentLines {
+		return nil, fmt.Errorf("%w: too many lines", ErrSyntax)
+	}
+
+	var root *Component
+	var stack []*Component
+	for i, s := range lines {
+		if s == "" {
+			continue
+		}
+		cl, err := ParseContentLine(s)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		switch cl.Name {
+		case "BEGIN":
+			if root != nil && len(stack) == 0 {
+				return nil, fmt.Errorf("%w: multiple top-level components", ErrSyntax)
+			}
+			if len(stack) >= maxComponentDepth {
+				return nil, fmt.Errorf("%w: components nested too deeply", ErrSyntax)
+			}
+			c := &Component{Name: strings.ToUpper(cl.Value)}
+			if c.Name == "" {
+				return nil, fmt.Errorf("%w: line %d: begin without name", ErrSyntax, i+1)
+			}
+			if len(stack) > 0 {
+				p := stack[len(stack)-1]
+				p.Comps = append(p.Comps, c)
+			} else {
+				root = c
+			}
+			stack = append(stack, c)
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(cl.Value) {
+				return nil, fmt.Errorf("%w: line %d: unexpected end of component %q", ErrSyntax, i+1, cl.Value)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("%w: line %d: property outside component", ErrSyntax, i+1)
+			}
+			c := stack[len(stack)-1]
+			c.Props = append(c.Props, cl)
+		}
+	}
+	if root == nil {
+		return nil, fmt.Errorf("%w: no component", ErrSyntax)
+	} else if len(stack) > 0 {
+		return nil, fmt.Errorf("%w: missing end for component %s", ErrSyntax, stack[len(stack)-1].Name)
+	}
+	return root, nil
+}
+
+// ParseContentLine parses a single unfolded line: name *(";" param) ":" value.
+func ParseContentLine(s string) (cl ContentLine, err error) {
+	i := strings.IndexAny(s, ";:")
+	if i <= 0 {
+		return cl, fmt.Errorf("%w: missing property name", ErrSyntax)
+	}
+	cl.Name = strings.ToUpper(s[:i])
+	if g, n, ok := strings.Cut(cl.Name, "."); ok {
+		cl.Group = g
+		cl.Name = n
+	}
+	s = s[i:]
+	for strings.HasPrefix(s, ";") {
+		s = s[1:]
+		start := s
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 {
+			return cl, fmt.Errorf("%w: bad parameter", ErrSyntax)
+		}
+		k := strings.ToUpper(s[:eq])
+		s = s[eq+1:]
+		var v string
+		if strings.HasPrefix(s, `"`) {
+			e := strings.IndexByte(s[1:], '"')
+			if e < 0 {
+				return cl, fmt.Errorf("%w: unterminated quoted parameter value", ErrSyntax)
+			}
+			v = s[1 : 1+e]
+			s = s[2+e:]
+		} else {
+			e := strings.IndexAny(s, ";:,")
+			if e < 0 {
+				return cl, fmt.Errorf("%w: missing value", ErrSyntax)
+			}
+			v = s[:e]
+			s = s[e:]
+		}
+		// Skip additional values of multi-valued parameters.
+		for strings.HasPrefix(s, ",") {
+			s = s[1:]
+			if strings.HasPrefix(s, `"`) {
+				e := strings.IndexByte(s[1:], '"')
+				if e < 0 {
+					return cl, fmt.Errorf("%w: unterminated quoted parameter value", ErrSyntax)
+				}
+				s = s[2+e:]
+			} else {
+				e := strings.IndexAny(s, ";:,")
+				if e < 0 {
+					return cl, fmt.Errorf("%w: missing value", ErrSyntax)
+				}
+				s = s[e:]
+			}
+		}
+		if cl.Params == nil {
+			cl.Params = map[string]string{}
+		}
+		if _, ok := cl.Params[k]; !ok {
+			cl.Params[k] = v
+		}
+		cl.params = append(cl.params, start[:len(start)-len(s)])
+	}
+	if !strings.HasPrefix(s, ":") {
+		return cl, fmt.Errorf("%w: missing value", ErrSyntax)
+	}
+	cl.Value = s[1:]
+	return cl, nil
+}
+
+// Prop returns the first property with name, or nil.
+func (c *Component) Prop(name string) *ContentLine {
+	for i := range c.Props {
+		if c.Props[i].Name == name {
+			return &c.Props[i]
+		}
+	}
+	return nil
+}
+
+// Clone returns a deep copy of c.
+func (c *Component) Clone() *Component {
+	nc := &Component{Name: c.Name}
+	for _, p := range c.Props {
+		nc.Props = append(nc.Props, p.clone())
+	}
+	for _, sc := range c.Comps {
+		nc.Comps = append(nc.Comps, sc.Clone())
+	}
+	return nc
+}
+
+func (cl ContentLine) clone() ContentLine {
+	ncl := cl
+	if cl.Params != nil {
+		ncl.Params = map[string]string{}
+		for k, v := range cl.Params {
+			ncl.Params[k] = v
+		}
+	}
+	ncl.params = append([]string(nil), cl.params...)
+	return ncl
+}
+
+// SetParam sets parameter name to a single value, replacing existing values. If
+// value is empty, the parameter is removed.
+func (cl *ContentLine) SetParam(name, value string) {
+	name = strings.ToUpper(name)
+	var l []string
+	for _, p := range cl.params {
+		k, _, _ := strings.Cut(p, "=")
+		if strings.ToUpper(k) != name {
+			l = append(l, p)
+		}
+	}
+	cl.params = l
+	if cl.Params == nil {
+		cl.Params = map[string]string{}
+	}
+	delete(cl.Params, name)
+	if value == "" {
+		return
+	}
+	v := value
+	if strings.ContainsAny(v, `;:,`) {
+		v = `"` + strings.ReplaceAll(v, `"`, "") + `"`
+	}
+	cl.params = append(cl.params, name+"="+v)
+	cl.Params[name] = value
+}
+
+// NewContentLine returns a content line without parameters. The value must
+// already be escaped.
+func NewContentLine(name, value string) ContentLine {
+	return ContentLine{Name: strings.ToUpper(name), Value: value}
+}
+
+// String returns the content line in iCalendar syntax, without folding and
+// without line ending.
+func (cl ContentLine) String() string {
+	var b strings.Builder
+	if cl.Group != "" {
+		b.WriteString(cl.Group + ".")
+	}
+	b.WriteString(cl.Name)
+	for _, p := range cl.params {
+		b.WriteString(";" + p)
+	}
+	b.WriteString(":" + cl.Value)
+	return b.String()
+}
+
+// String returns the component in iCalendar syntax, with folded lines ending
+// in CRLF.
+func (c *Component) String() string {
+	var b strings.Builder
+	c.write(&b)
+	return b.String()
+}
+
+func (c *Component) write(b *strings.Builder) {
+	writeLine(b, "BEGIN:"+c.Name)
+	for _, p := range c.Props {
+		writeLine(b, p.String())
+	}
+	for _, sc := range c.Comps {
+		sc.write(b)
+	}
+	writeLine(b, "END:"+c.Name)
+}
+
+// writeLine writes s with folding at 75 octets, without splitting UTF-8
+// sequences, RFC 5545 section 3.1.
+func writeLine(b *strings.Builder, s string) {
+	n := 75
+	for len(s) > n {
+		i := n
+		for i > 0 && !utf8.RuneStart(s[i]) {
+			i--
+		}
+		b.WriteString(s[:i] + "\r\n ")
+		s = s[i:]
+		n = 74 // Continuation lines start with a space.
+	}
+	b.WriteString(s + "\r\n")
+}
+
+// Text returns the unescaped value of a TEXT property, RFC 5545 section 3.3.11.
+func (cl ContentLine) Text() string {
+	if !strings.Contains(cl.Value, `\`) {
+		return cl.Value
+	}
+	var b strings.Builder
+	s := cl.Value
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// EscapeText escapes s for use as value of a TEXT property.
+func EscapeText(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, ";", `\;`)
+	s = strings.ReplaceAll(s, ",", `\,`)
+	s = strings.ReplaceAll(s, "\r\n", `\n`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return s
+}
+
+// ParseDateTime parses a DATE or DATE-TIME property value. Floating times and
+// unknown time zones are interpreted as UTC.
+func ParseDateTime(p *ContentLine) (t time.Time, isDate bool, err error) {
+	v := p.Value
+	if len(v) == 8 || p.Params["VALUE"] == "DATE" {
+		t, err := time.Parse("20060102", v)
+		return t, true, err
+	}
+	if strings.HasSuffix(v, "Z") {
+		t, err := time.Parse("20060102T150405Z", v)
+		return t, false, err
+	}
+	loc := time.UTC
+	if tzid := p.Params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(strings.TrimPrefix(tzid, "/")); err == nil {
+			loc = l
+		}
+	}
+	t, err = time.ParseInLocation("20060102T150405", v, loc)
+	return t, false, err
+}
+
+// ParseDuration parses an iCalendar duration, RFC 5545 section 3.3.6.
+func ParseDuration(s string) (time.Duration, error) {
+	var neg bool
+	if strings.HasPrefix(s, "-") {
+		neg = true
+		s = s[1:]
+	} else {
+		s = strings.TrimPrefix(s, "+")
+	}
+	if !strings.HasPrefix(s, "P") || len(s) < 3 {
+		return 0, fmt.Errorf("%w: bad duration", ErrSyntax)
+	}
+	s = s[1:]
+	var d time.Duration
+	var inTime bool
+	for s != "" {
+		if s[0] == 'T' {
+			inTime = true
+			s = s[1:]
+			continue
+		}
+		i := 0
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		if i == 0 || i == len(s) {
+			return 0, fmt.Errorf("%w: bad duration", ErrSyntax)
+		}
+		n, err := strconv.ParseInt(s[:i], 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("%w: bad duration", ErrSyntax)
+		}
+		var unit time.Duration
+		switch {
+		case s[i] == 'W' && !inTime:
+			unit = 7 * 24 * time.Hour
+		case s[i] == 'D' && !inTime:
+			unit = 24 * time.Hour
+		case s[i] == 'H' && inTime:
+			unit = time.Hour
+		case s[i] == 'M' && inTime:
+			unit = time.Minute
+		case s[i] == 'S' && inTime:
+			unit = time.Second
+		default:
+			return 0, fmt.Errorf("%w: bad duration", ErrSyntax)
+		}
+		d += time.Duration(n) * unit
+		s = s[i+1:]
+	}
+	if neg {
+		d = -d
+	}
+	return d, nil
+}
@@ -0,0 +1,97 @@
+package ical
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func tcheckf(t *testing.T, err error, format string, args ...any) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %s", fmt.Sprintf(format, args...), err)
+	}
+}
+
+func tcompare(t *testing.T, got, expect any) {
+	t.Helper()
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("got:\n%#v\nexpected:\n%#v", got, expect)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	test := func(s string, exp time.Duration, expErr bool) {
+		t.Helper()
+		d, err := ParseDuration(s)
+		if (err != nil) != expErr {
+			t.Fatalf("parsing duration %q: got err %v, expected error %v", s, err, expErr)
+		}
+		tcompare(t, d, exp)
+	}
+	test("P1D", 24*time.Hour, false)
+	test("PT1H30M", 90*time.Minute, false)
+	test("P1W", 7*24*time.Hour, false)
+	test("-PT15M", -15*time.Minute, false)
+	test("P1DT2H", 26*time.Hour, false)
+	test("P", 0, true)
+	test("PT1D", 0, true)
+	test("P1H", 0, true)
+	test("1D", 0, true)
+}
+
+func TestContentLine(t *testing.T) {
+	const line = `item1.EMAIL;TYPE=work,pref;X-LABEL="a;b:c":mjl@mox.example`
+	cl, err := ParseContentLine(line)
+	tcheckf(t, err, "parse content line")
+	tcompare(t, cl.Group, "ITEM1")
+	tcompare(t, cl.Name, "EMAIL")
+	tcompare(t, cl.Params, map[string]string{"TYPE": "work", "X-LABEL": "a;b:c"})
+	tcompare(t, cl.Value, "mjl@mox.example")
+	tcompare(t, cl.String(), `ITEM1.EMAIL;TYPE=work,pref;X-LABEL="a;b:c":mjl@mox.example`)
+
+	cl.SetParam("type", "home")
+	cl.SetParam("x-label", "")
+	cl.SetParam("cn", "a:b")
+	tcompare(t, cl.String(), `ITEM1.EMAIL;TYPE=home;CN="a:b":mjl@mox.example`)
+	tcompare(t, cl.Params, map[string]string{"TYPE": "home", "CN": "a:b"})
+
+	_, err = ParseContentLine(`NOVALUE`)
+	if !errors.Is(err, ErrSyntax) {
+		t.Fatalf("got err %v, expected ErrSyntax", err)
+	}
+}
+
+func TestText(t *testing.T) {
+	s := "a, b; c\\d\ne"
+	esc := EscapeText(s)
+	tcompare(t, esc, `a\, b\; c\\d\ne`)
+	tcompare(t, NewContentLine("SUMMARY", esc).Text(), s)
+}
+
+func TestString(t *testing.T) {
+	long := strings.Repeat("é", 100)
+	c := &Component{
+		Name:  "VCALENDAR",
+		Props: []ContentLine{NewContentLine("X-TEST", long)},
+		Comps: []*Component{{Name: "VEVENT", Props: []ContentLine{NewContentLine("UID", "a")}}},
+	}
+	s := c.String()
+	for _, line := range strings.Split(strings.TrimSuffix(s, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Fatalf("line longer than 75 octets: %q", line)
+		}
+	}
+	nc, err := Parse(s)
+	tcheckf(t, err, "parse")
+	tcompare(t, nc.Prop("X-TEST").Value, long)
+	tcompare(t, nc.Comps[0].Prop("UID").Value, "a")
+
+	_, err = Parse("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nEND:VCALENDAR\r\n")
+	if !errors.Is(err, ErrSyntax) {
+		t.Fatalf("got err %v, expected ErrSyntax", err)
+	}
+}
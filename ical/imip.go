@@ -0,0 +1,254 @@
+package ical
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mjl-/mox/moxvar"
+)
+
+// Invite is a scheduling message, as sent by email (iMIP, RFC 6047), with the
+// fields of the main component relevant for showing to a user.
+type Invite struct {
+	Method      string // E.g. REQUEST, REPLY, CANCEL, upper case.
+	Component   string // E.g. VEVENT or VTODO.
+	UID         string
+	Sequence    int
+	Summary     string
+	Location    string
+	Description string
+	Start       time.Time // Zero if absent.
+	End         time.Time // Zero if absent.
+	AllDay      bool      // Start (and end) are dates, without time.
+	Recurring   bool
+	Organizer   Participant
+	Attendees   []Participant
+}
+
+// Participant is an organizer or attendee in an Invite.
+type Participant struct {
+	Address  string // Email address from "mailto:" URI, can be empty for other URIs.
+	Name     string // Common name, can be empty.
+	PartStat string // For attendees, e.g. NEEDS-ACTION, ACCEPTED, DECLINED, TENTATIVE.
+}
+
+var (
+	ErrNoMethod    = errors.New("calendar without method")
+	ErrNoComponent = errors.New("calendar without scheduling component")
+)
+
+// Limit on size of calendar data in a message that is parsed.
+const MaxInviteSize = 1024 * 1024
+
+// ParseInvite parses data as a VCALENDAR with a METHOD property, such as a
+// text/calendar message part.
+func ParseInvite(data string) (*Invite, error) {
+	if len(data) > MaxInviteSize {
+		return nil, fmt.Errorf("%w: calendar data too large", ErrSyntax)
+	}
+	cal, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if cal.Name != "VCALENDAR" {
+		return nil, fmt.Errorf("%w: top-level component must be VCALENDAR, not %s", ErrSyntax, cal.Name)
+	}
+	p := cal.Prop("METHOD")
+	if p == nil || p.Value == "" {
+		return nil, ErrNoMethod
+	}
+	c := mainComponent(cal)
+	if c == nil {
+		return nil, ErrNoComponent
+	}
+
+	inv := &Invite{
+		Method:    strings.ToUpper(p.Value),
+		Component: c.Name,
+		Recurring: c.Prop("RRULE") != nil || c.Prop("RDATE") != nil,
+	}
+	if p := c.Prop("UID"); p != nil {
+		inv.UID = p.Value
+	}
+	if p := c.Prop("SEQUENCE"); p != nil {
+		inv.Sequence, _ = strconv.Atoi(p.Value)
+	}
+	if p := c.Prop("SUMMARY"); p != nil {
+		inv.Summary = p.Text()
+	}
+	if p := c.Prop("LOCATION"); p != nil {
+		inv.Location = p.Text()
+	}
+	if p := c.Prop("DESCRIPTION"); p != nil {
+		inv.Description = p.Text()
+	}
+	if p := c.Prop("DTSTART"); p != nil {
+		inv.Start, inv.AllDay, _ = ParseDateTime(p)
+	}
+	if p := c.Prop("DTEND"); p != nil {
+		inv.End, _, _ = ParseDateTime(p)
+	} else if p := c.Prop("DUE"); p != nil {
+		inv.End, _, _ = ParseDateTime(p)
+	} else if p := c.Prop("DURATION"); p != nil && !inv.Start.IsZero() {
+		if d, err := ParseDuration(p.Value); err == nil {
+			inv.End = inv.Start.Add(d)
+		}
+	}
+	if p := c.Prop("ORGANIZER"); p != nil {
+		inv.Organizer = participant(p)
+	}
+	for _, p := range c.Props {
+		if p.Name == "ATTENDEE" {
+			inv.Attendees = append(inv.Attendees, participant(&p))
+		}
+	}
+	return inv, nil
+}
+
+func participant(p *ContentLine) Participant {
+	pp := Participant{
+		Address:  calAddress(p.Value),
+		Name:     p.Params["CN"],
+		PartStat: strings.ToUpper(p.Params["PARTSTAT"]),
+	}
+	if pp.PartStat == "" && p.Name == "ATTENDEE" {
+		pp.PartStat = "NEEDS-ACTION"
+	}
+	return pp
+}
+
+// calAddress returns the email address from a "mailto:" calendar user address.
+func calAddress(s string) string {
+	if len(s) >= 7 && strings.EqualFold(s[:7], "mailto:") {
+		return s[7:]
+	}
+	return ""
+}
+
+// mainComponent returns the first scheduling component, preferring the one
+// without RECURRENCE-ID, i.e. the recurring master.
+func mainComponent(cal *Component) *Component {
+	var first *Component
+	for _, c := range cal.Comps {
+		if c.Name == "VTIMEZONE" {
+			continue
+		}
+		if c.Prop("RECURRENCE-ID") == nil {
+			return c
+		}
+		if first == nil {
+			first = c
+		}
+	}
+	return first
+}
+
+// isAttendee returns whether p is an ATTENDEE property for address.
+func isAttendee(p ContentLine, address string) bool {
+	return p.Name == "ATTENDEE" && strings.EqualFold(calAddress(p.Value), address)
+}
+
+// Reply returns a METHOD:REPLY calendar (RFC 5546 section 3.2.3) for the
+// METHOD:REQUEST calendar in data, for the attendee with email address
+// "attendee", with the participation status set to partStat, one of ACCEPTED,
+// TENTATIVE or DECLINED.
+func Reply(data, attendee, partStat string, now time.Time) (string, error) {
+	switch partStat {
+	case "ACCEPTED", "TENTATIVE", "DECLINED":
+	default:
+		return "", fmt.Errorf("unknown participation status %q", partStat)
+	}
+	cal, err := Parse(data)
+	if err != nil {
+		return "", err
+	}
+	if cal.Name != "VCALENDAR" {
+		return "", fmt.Errorf("%w: top-level component must be VCALENDAR, not %s", ErrSyntax, cal.Name)
+	}
+	if p := cal.Prop("METHOD"); p == nil || !strings.EqualFold(p.Value, "REQUEST") {
+		return "", errors.New("can only reply to calendar with method REQUEST")
+	}
+	main := mainComponent(cal)
+	if main == nil {
+		return "", ErrNoComponent
+	}
+
+	reply := &Component{
+		Name: "VCALENDAR",
+		Props: []ContentLine{
+			NewContentLine("PRODID", "-//mox//"+EscapeText(moxvar.Version)+"//EN"),
+			NewContentLine("VERSION", "2.0"),
+			NewContentLine("METHOD", "REPLY"),
+		},
+	}
+	stamp := now.UTC().Format("20060102T150405Z")
+	for _, c := range cal.Comps {
+		if c.Name == "VTIMEZONE" {
+			reply.Comps = append(reply.Comps, c.Clone())
+			continue
+		} else if c.Name != main.Name {
+			continue
+		}
+
+		rc := &Component{Name: c.Name}
+		var found bool
+		for _, p := range c.Props {
+			switch p.Name {
+			case "UID", "SEQUENCE", "RECURRENCE-ID", "DTSTART", "DTEND", "DUE", "DURATION", "SUMMARY", "ORGANIZER":
+				rc.Props = append(rc.Props, p.clone())
+			case "ATTENDEE":
+				if !found && isAttendee(p, attendee) {
+					found = true
+					rc.Props = append(rc.Props, replyAttendee(p, partStat))
+				}
+			}
+		}
+		if !found {
+			// We were invited through an address not listed, e.g. through a list. RFC 5546
+			// section 3.2.3 allows an attendee to be added in a reply.
+			rc.Props = append(rc.Props, replyAttendee(NewContentLine("ATTENDEE", "mailto:"+attendee), partStat))
+		}
+		rc.Props = append(rc.Props, NewContentLine("DTSTAMP", stamp))
+		reply.Comps = append(reply.Comps, rc)
+	}
+	return reply.String(), nil
+}
+
+func replyAttendee(p ContentLine, partStat string) ContentLine {
+	p = p.clone()
+	p.SetParam("PARTSTAT", partStat)
+	p.SetParam("RSVP", "")
+	return p
+}
+
+// CalendarObject returns calendar data for storing the METHOD:REQUEST calendar
+// in data in a calendar collection, e.g. through CalDAV, with the participation
+// status of attendee set to partStat. The METHOD property is removed, as
+// required for calendar object resources (RFC 4791 section 4.1).
+func CalendarObject(data, attendee, partStat string) (string, error) {
+	cal, err := Parse(data)
+	if err != nil {
+		return "", err
+	}
+	if cal.Name != "VCALENDAR" {
+		return "", fmt.Errorf("%w: top-level component must be VCALENDAR, not %s", ErrSyntax, cal.Name)
+	}
+	var props []ContentLine
+	for _, p := range cal.Props {
+		if p.Name != "METHOD" {
+			props = append(props, p)
+		}
+	}
+	cal.Props = props
+	for _, c := range cal.Comps {
+		for i, p := range c.Props {
+			if isAttendee(p, attendee) {
+				c.Props[i] = replyAttendee(p, partStat)
+			}
+		}
+	}
+	return cal.String(), nil
+}
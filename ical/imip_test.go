@@ -0,0 +1,99 @@
+package ical
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const request = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:test\r\nMETHOD:REQUEST\r\nBEGIN:VTIMEZONE\r\nTZID:Europe/Amsterdam\r\nEND:VTIMEZONE\r\nBEGIN:VEVENT\r\nUID:meeting1\r\nSEQUENCE:2\r\nDTSTAMP:20240101T000000Z\r\nDTSTART;TZID=Europe/Amsterdam:20240110T100000\r\nDURATION:PT1H\r\nSUMMARY:Team\\, weekly\r\nLOCATION:Room 1\r\nRRULE:FREQ=WEEKLY\r\nORGANIZER;CN=Mox Admin:mailto:admin@mox.example\r\nATTENDEE;CN=Mjl;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:MAILTO:mjl@mox.example\r\nATTENDEE;PARTSTAT=ACCEPTED:mailto:other@mox.example\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+
+func TestParseInvite(t *testing.T) {
+	inv, err := ParseInvite(request)
+	tcheckf(t, err, "parse invite")
+	ams, err := time.LoadLocation("Europe/Amsterdam")
+	tcheckf(t, err, "load location")
+	start := time.Date(2024, 1, 10, 10, 0, 0, 0, ams)
+	exp := Invite{
+		Method:    "REQUEST",
+		Component: "VEVENT",
+		UID:       "meeting1",
+		Sequence:  2,
+		Summary:   "Team, weekly",
+		Location:  "Room 1",
+		Start:     start,
+		End:       start.Add(time.Hour),
+		Recurring: true,
+		Organizer: Participant{"admin@mox.example", "Mox Admin", ""},
+		Attendees: []Participant{
+			{"mjl@mox.example", "Mjl", "NEEDS-ACTION"},
+			{"other@mox.example", "", "ACCEPTED"},
+		},
+	}
+	if !inv.Start.Equal(exp.Start) || !inv.End.Equal(exp.End) {
+		t.Fatalf("got start %v end %v, expected %v %v", inv.Start, inv.End, exp.Start, exp.End)
+	}
+	inv.Start, inv.End, exp.Start, exp.End = time.Time{}, time.Time{}, time.Time{}, time.Time{}
+	tcompare(t, *inv, exp)
+
+	_, err = ParseInvite(strings.ReplaceAll(request, "METHOD:REQUEST\r\n", ""))
+	if !errors.Is(err, ErrNoMethod) {
+		t.Fatalf("got err %v, expected ErrNoMethod", err)
+	}
+	_, err = ParseInvite("BEGIN:VCALENDAR\r\nMETHOD:REQUEST\r\nEND:VCALENDAR\r\n")
+	if !errors.Is(err, ErrNoComponent) {
+		t.Fatalf("got err %v, expected ErrNoComponent", err)
+	}
+}
+
+func TestReply(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	reply, err := Reply(request, "MJL@mox.example", "ACCEPTED", now)
+	tcheckf(t, err, "reply")
+	inv, err := ParseInvite(reply)
+	tcheckf(t, err, "parse reply")
+	tcompare(t, inv.Method, "REPLY")
+	tcompare(t, inv.UID, "meeting1")
+	tcompare(t, inv.Sequence, 2)
+	tcompare(t, inv.Attendees, []Participant{{"mjl@mox.example", "Mjl", "ACCEPTED"}})
+	if strings.Contains(reply, "RSVP") || strings.Contains(reply, "other@mox.example") || strings.Contains(reply, "RRULE") {
+		t.Fatalf("unexpected content in reply:\n%s", reply)
+	}
+	if !strings.Contains(reply, "DTSTAMP:20240102T030405Z\r\n") || !strings.Contains(reply, "BEGIN:VTIMEZONE\r\n") {
+		t.Fatalf("missing content in reply:\n%s", reply)
+	}
+
+	// Attendee not in list is added.
+	reply, err = Reply(request, "list@mox.example", "DECLINED", now)
+	tcheckf(t, err, "reply")
+	inv, err = ParseInvite(reply)
+	tcheckf(t, err, "parse reply")
+	tcompare(t, inv.Attendees, []Participant{{"list@mox.example", "", "DECLINED"}})
+
+	_, err = Reply(request, "mjl@mox.example", "BOGUS", now)
+	if err == nil {
+		t.Fatalf("missing error for bad partstat")
+	}
+	_, err = Reply(reply, "mjl@mox.example", "ACCEPTED", now)
+	if err == nil {
+		t.Fatalf("missing error for reply to reply")
+	}
+}
+
+func TestCalendarObject(t *testing.T) {
+	data, err := CalendarObject(request, "mjl@mox.example", "TENTATIVE")
+	tcheckf(t, err, "calendar object")
+	if strings.Contains(data, "METHOD") || strings.Contains(data, "RSVP") {
+		t.Fatalf("unexpected content in calendar object:\n%s", data)
+	}
+	cal, err := Parse(data)
+	tcheckf(t, err, "parse calendar object")
+	var partStats []string
+	for _, p := range cal.Comps[1].Props {
+		if p.Name == "ATTENDEE" {
+			partStats = append(partStats, p.Params["PARTSTAT"])
+		}
+	}
+	tcompare(t, partStats, []string{"TENTATIVE", "ACCEPTED"})
+}
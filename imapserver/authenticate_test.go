@@ -362,7 +362,7 @@ func TestAuthenticateTLSClientCert(t *testing.T) {
 	cid := connCounter
 	go func() {
 		defer serverConn.Close()
-		serve("test", cid, &serverConfig, serverConn, true, false, false, false, "")
+		serve("test", cid, &serverConfig, serverConn, true, false, false, false, "", nil, nil)
 		close(done)
 	}()
 
@@ -380,3 +380,58 @@ func TestAuthenticateTLSClientCert(t *testing.T) {
 		t.Fatalf("got err %#v, expected tls 'bad certificate' alert", err)
 	}
 }
+
+func TestAuthenticateAppPassword(t *testing.T) {
+	tc := start(t, false)
+	defer tc.close()
+
+	_, imapPassword, err := tc.account.AppPasswordAdd(ctxbg, pkglog, store.AppPassword{Name: "phone", Protocols: []string{store.AppPasswordIMAP}})
+	tcheck(t, err, "add app password")
+	_, submissionPassword, err := tc.account.AppPasswordAdd(ctxbg, pkglog, store.AppPassword{Name: "smtp", Protocols: []string{store.AppPasswordSubmission}})
+	tcheck(t, err, "add app password")
+	_, otherIPPassword, err := tc.account.AppPasswordAdd(ctxbg, pkglog, store.AppPassword{Name: "other", Protocols: []string{store.AppPasswordIMAP}, IPRanges: []string{"192.0.2.0/24"}})
+	tcheck(t, err, "add app password")
+
+	plain := func(status, password string) {
+		t.Helper()
+		tc.transactf(status, "authenticate plain %s", base64.StdEncoding.EncodeToString([]byte("\u0000mjl@mox.example\u0000"+password)))
+	}
+
+	plain("no", submissionPassword) // Not for imap.
+	plain("no", otherIPPassword)    // Not from this IP.
+	plain("ok", imapPassword)
+
+	tc2 := startNoSwitchboard(t, false)
+	tc2.transactf("ok", "login mjl@mox.example %s", imapPassword)
+	tc2.closeNoWait()
+
+	scramAuth := func(method string, h func() hash.Hash, password string, expOK bool) {
+		t.Helper()
+		tc2 := startNoSwitchboard(t, false)
+		defer tc2.closeNoWait()
+		tc2.clientPanic = expOK
+		_, err := tc2.client.AuthenticateSCRAM(method, h, "mjl@mox.example", password)
+		if !expOK && err == nil {
+			t.Fatalf("scram auth succeeded, expected failure")
+		}
+	}
+
+	// App passwords have their own SCRAM salts, the salts of the main password are
+	// used for SCRAM, also after changing the main password.
+	scramAuth("SCRAM-SHA-256", sha256.New, imapPassword, false)
+	scramAuth("SCRAM-SHA-256", sha256.New, password0, true)
+	scramAuth("SCRAM-SHA-256", sha256.New, submissionPassword, false)
+	err = tc.account.SetPassword(pkglog, "newpassword")
+	tcheck(t, err, "set password")
+	scramAuth("SCRAM-SHA-1", sha1.New, imapPassword, false)
+	scramAuth("SCRAM-SHA-1", sha1.New, "newpassword", true)
+	tc2 = startNoSwitchboard(t, false)
+	tc2.transactf("ok", "login mjl@mox.example %s", imapPassword)
+	tc2.closeNoWait()
+
+	l, err := tc.account.AppPasswordList(ctxbg)
+	tcheck(t, err, "list app passwords")
+	if l[0].LastUsed == nil || l[0].LastUsedProtocol != store.AppPasswordIMAP || l[0].LastUsedIP != "127.0.0.10" || l[1].LastUsed != nil || l[2].LastUsed != nil {
+		t.Fatalf("unexpected last use of app passwords: %#v", l)
+	}
+}
@@ -0,0 +1,1540 @@
+package imapserver
+
+/*
+Privilege separation
+
+With config option PreauthUser set, unauthenticated IMAP connections are handled
+by a separate process ("mox imappreauth"), running as a different user, without
+access to the config and data directories, and without private keys. The
+preauth process accepts connections on the IMAP listeners, and immediately
+passes each new connection to the main process. The main process keeps the
+connection, does the TLS handshake, and relays the data to and from the preauth
+process over a new stream socket pair. The preauth process handles the commands
+of the "not authenticated" state, and asks the main process to verify
+credentials. Messages between the processes are JSON, over a unix domain socket
+pair of type SOCK_SEQPACKET, so each message is received in one read, along with
+any file descriptor.
+
+For STARTTLS and after successful authentication, the preauth process gives the
+connection back to the main process: It flushes its output and asks the main
+process to stop relaying, then reads remaining (pipelined) data until the main
+process closes its side, and sends that data to the main process. For STARTTLS,
+the main process writes the OK response, does the TLS handshake and relays over
+a new socket pair. After authentication, the main process serves the session on
+the connection itself, starting with the result of the authentication command.
+Data of an authenticated session never passes through the preauth process.
+
+Only IMAP is separated. SMTP, HTTP and the other protocols are still handled by
+the main process, as is message delivery. TLS handshakes for IMAP are done in
+the main process too. Separating SMTP and HTTP, with an RPC for delivery, is
+left for a separate change.
+
+TLS client certificate authentication is not available with a preauth process.
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mjl-/bstore"
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/mjl-/mox/metrics"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/moxio"
+	"github.com/mjl-/mox/scram"
+	"github.com/mjl-/mox/store"
+)
+
+// Maximum size of a message between main and preauth process.
+const preauthMaxMsgSize = 256 * 1024
+
+// Maximum of data read by the preauth process but not yet handled when handing a
+// connection back to the main process. Base64-encoded in a message.
+const preauthMaxPending = 64 * 1024
+
+// How long an authentication session in the main process can take, including the
+// handoff of the connection after successful authentication.
+var preauthSessionTimeout = 5 * time.Minute
+
+// How long the main process waits for the preauth process after it stopped
+// relaying for a connection, before closing the connection.
+var preauthStopTimeout = time.Minute
+
+// preauthMsg is a message between the main and the preauth process. Requests from
+// the preauth process have a non-zero ID, the response has the same ID. Only one
+// of the request/response fields is set.
+type preauthMsg struct {
+	ID    int64  `json:",omitempty"`
+	Error string `json:",omitempty"` // For a response to a failed request.
+
+	Config     *preauthConfig      `json:",omitempty"` // From main process, first message.
+	Conn       *preauthConnRequest `json:",omitempty"` // With file descriptor of the new connection.
+	Serve      *preauthServe       `json:",omitempty"` // With file descriptor of socket to serve the connection on.
+	Auth       *preauthAuthRequest `json:",omitempty"`
+	AuthResult *preauthAuthResult  `json:",omitempty"`
+	Stop       int64               `json:",omitempty"` // Connection ID to stop relaying for, for STARTTLS or handoff.
+	StartTLS   *preauthStartTLS    `json:",omitempty"` // Response is Serve.
+	Handoff    *preauthHandoff     `json:",omitempty"`
+
+	file *os.File // Received with the message.
+}
+
+// preauthConfig is sent by the main process to the preauth process at startup.
+type preauthConfig struct {
+	Listeners []preauthListener
+	LogLevels map[string]slog.Level
+}
+
+// preauthListener is an IMAP listener for the preauth process. The socket is
+// passed to the preauth process by the privileged process.
+type preauthListener struct {
+	Name              string
+	Protocol          string // "imap" or "imaps".
+	Network           string
+	Addr              string
+	TLS               bool // Whether TLS is available, for STARTTLS or immediately for imaps.
+	NoRequireSTARTTLS bool
+}
+
+// preauthConnRequest is sent by the preauth process with a newly accepted
+// connection.
+type preauthConnRequest struct {
+	Listener string
+	Cid      int64 // Connection ID in preauth process, for logging.
+}
+
+// preauthServe is the response to preauthConnRequest and preauthStartTLS, with
+// the file descriptor of a socket over which the main process relays the
+// connection.
+type preauthServe struct {
+	Conn       int64 // Connection ID in main process.
+	RemoteAddr string
+	LocalAddr  string
+	TLS        bool
+}
+
+// preauthAuthRequest is a step in an authentication attempt, forwarded by the
+// preauth process.
+type preauthAuthRequest struct {
+	Session int64  // Zero for the first step of an authentication attempt.
+	Mech    string // Lower case SASL mechanism, or "login" for the LOGIN command.
+	Data    []byte // Initial response, or response to challenge. For "login", username and password separated by a NUL byte.
+	Abort   bool   // If client aborted the exchange.
+
+	// Only for the first step.
+	Conn      int64
+	UserAgent string
+}
+
+type preauthAuthResult struct {
+	Session   int64
+	Challenge []byte // If not Done, to send to client.
+	Done      bool
+
+	// If done and not successful.
+	ErrorKind             string // "user", "syntax" or "server".
+	Code                  string // IMAP response code, for user errors.
+	Error                 string
+	MissingDerivedSecrets bool // Not to be held against the connection.
+}
+
+// preauthStartTLS requests the main process to respond to a STARTTLS command and
+// do the TLS handshake, after relaying was stopped.
+type preauthStartTLS struct {
+	Conn int64
+	Tag  string
+	Cmd  string
+	Data []byte // Already read from the remote, must be part of the TLS handshake.
+}
+
+// preauthHandoff requests the main process to serve a connection that was
+// authenticated, after relaying was stopped.
+type preauthHandoff struct {
+	Session   int64
+	Conn      int64
+	Tag       string // Of the authentication command, the main process writes the result.
+	Cmd       string // "login" or "authenticate".
+	UserAgent string
+	Data      []byte // Already read from the remote, e.g. pipelined commands.
+}
+
+// handoff holds the state for serving a connection handed off by the preauth
+// process.
+type handoff struct {
+	remoteIP   net.IP
+	remoteAddr string
+	preauthCid int64
+	tag        string
+	cmd        string
+	username   string
+	account    *store.Account
+	userAgent  string
+}
+
+// For the main process, gathered by Listen, used by Serve.
+var preauthListeners []preauthListener
+var preauthTLSConfigs = map[string]*tls.Config{}
+
+// preauthListen registers an IMAP listener handled by the preauth process.
+func preauthListen(log mlog.Log, protocol, listenerName, network, addr string, tlsConfig *tls.Config, xtls, noRequireSTARTTLS bool) {
+	if os.Getuid() == 0 {
+		log.Print("listening for imap for preauth process",
+			slog.String("listener", listenerName),
+			slog.String("addr", addr),
+			slog.String("protocol", protocol))
+		if err := mox.ListenPreauth(network, addr); err != nil {
+			log.Fatalx("imap: listen for imap", err, slog.String("protocol", protocol), slog.String("listener", listenerName))
+		}
+		return
+	}
+
+	pl := preauthListener{
+		Name:              listenerName,
+		Protocol:          protocol,
+		Network:           network,
+		Addr:              addr,
+		TLS:               tlsConfig != nil,
+		NoRequireSTARTTLS: noRequireSTARTTLS,
+	}
+	if tlsConfig != nil {
+		// The main process does the TLS handshakes, see listen1 about session keys.
+		tlsConfig = tlsConfig.Clone()
+		mox.StartTLSSessionTicketKeyRefresher(mox.Shutdown, log, tlsConfig)
+		preauthTLSConfigs[listenerName] = tlsConfig
+	}
+	preauthListeners = append(preauthListeners, pl)
+}
+
+// servePreauthMain serves requests from the preauth process, over the socket
+// passed by the privileged process.
+func servePreauthMain() {
+	log := mlog.New("imapserver", nil)
+	f := mox.PreauthControl()
+	if f == nil {
+		log.Fatal("missing socket for preauth process, mox must be started as root")
+	}
+	uc, err := preauthFileConn(f)
+	if err != nil {
+		log.Fatalx("making connection for preauth process", err)
+	}
+	ps := newPreauthServer(log, uc, preauthTLSConfigs)
+	pconf := preauthConfig{
+		Listeners: preauthListeners,
+		LogLevels: mox.Conf.Log,
+	}
+	err = ps.serve(pconf)
+	log.Errorx("serving preauth process, no more new imap connections", err)
+}
+
+// preauthServer serves requests from the preauth process, in the main process.
+type preauthServer struct {
+	log        mlog.Log
+	conn       *net.UnixConn
+	tlsConfigs map[string]*tls.Config // By listener name.
+	listeners  map[string]preauthListener
+
+	wmutex sync.Mutex // For writing to conn.
+
+	sync.Mutex
+	sessions map[int64]*preauthSession
+	relays   map[int64]*preauthRelay // By connection ID.
+}
+
+// preauthSession is an authentication attempt for the preauth process.
+type preauthSession struct {
+	id             int64
+	conn           int64 // Connection ID, must match at handoff.
+	start          time.Time
+	la             store.LoginAttempt
+	remoteIP       net.IP
+	channelBinding *scram.ChannelBinding // Nil without TLS.
+	step           int
+	username       string
+	account        *store.Account // Set when authenticated, until handoff.
+
+	// For cram-md5.
+	chal string
+
+	// For scram.
+	ss              *scram.Server
+	saltedPasswords [][]byte
+	candidates      []store.AuthSecret
+	finishErr       error // Error from final server message, returned after client response.
+}
+
+// preauthRelay is a remote connection in the main process, with data relayed to
+// and from the preauth process until the preauth process gives it back.
+type preauthRelay struct {
+	id       int64
+	listener string
+	cid      int64 // Of preauth process, for logging.
+	remoteIP net.IP
+	conn     net.Conn // Remote connection, a *tls.Conn when TLS is active.
+	tls      bool
+	pair     *net.UnixConn // Our end of the socket pair with the preauth process.
+	release  func()        // Releases the count in the limiter for open connections, once.
+
+	stopping    atomic.Bool   // Set when the preauth process gives the connection back.
+	stopTimer   *time.Timer   // For closing the connection if the preauth process does not continue after stopping. Protected by lock on preauthServer.
+	remoteDone  chan struct{} // Closed when relaying from remote to preauth process has stopped.
+	preauthDone chan struct{} // Closed when relaying from preauth process to remote has stopped.
+}
+
+func newPreauthServer(log mlog.Log, conn *net.UnixConn, tlsConfigs map[string]*tls.Config) *preauthServer {
+	return &preauthServer{
+		log:        log,
+		conn:       conn,
+		tlsConfigs: tlsConfigs,
+		listeners:  map[string]preauthListener{},
+		sessions:   map[int64]*preauthSession{},
+		relays:     map[int64]*preauthRelay{},
+	}
+}
+
+func (s *preauthServer) write(m preauthMsg, f *os.File) error {
+	s.wmutex.Lock()
+	defer s.wmutex.Unlock()
+	return preauthWriteMsg(s.conn, m, f)
+}
+
+// serve sends the configuration to the preauth process, and handles its requests
+// until the connection fails.
+func (s *preauthServer) serve(config preauthConfig) error {
+	for _, l := range config.Listeners {
+		s.listeners[l.Name] = l
+	}
+	if err := s.write(preauthMsg{Config: &config}, nil); err != nil {
+		return fmt.Errorf("writing config: %v", err)
+	}
+
+	buf := make([]byte, preauthMaxMsgSize)
+	for {
+		m, f, err := preauthReadMsg(s.conn, buf)
+		if err != nil {
+			return err
+		}
+		m.file = f
+		go s.handle(m)
+	}
+}
+
+// handle handles a single request and writes the response.
+func (s *preauthServer) handle(m preauthMsg) {
+	defer func() {
+		x := recover()
+		if x != nil {
+			s.log.Error("unhandled panic handling request from preauth process", slog.Any("err", x))
+			debug.PrintStack()
+			metrics.PanicInc(metrics.Imapserver)
+		}
+	}()
+
+	if m.file != nil && m.Conn == nil {
+		s.log.Error("unexpected file descriptor from preauth process")
+		m.file.Close()
+		m.file = nil
+	}
+
+	resp := preauthMsg{ID: m.ID}
+	var rf *os.File
+	switch {
+	case m.Conn != nil:
+		if m.file == nil {
+			resp.Error = "missing file descriptor for connection"
+			break
+		}
+		r, f, err := s.connection(*m.Conn, m.file)
+		if err != nil {
+			resp.Error = err.Error()
+		} else {
+			resp.Serve = &r
+			rf = f
+		}
+	case m.Auth != nil:
+		r := s.auth(*m.Auth)
+		resp.AuthResult = &r
+	case m.Stop != 0:
+		if err := s.stop(m.Stop); err != nil {
+			resp.Error = err.Error()
+		}
+	case m.StartTLS != nil:
+		r, f, err := s.startTLS(*m.StartTLS)
+		if err != nil {
+			resp.Error = err.Error()
+		} else {
+			resp.Serve = &r
+			rf = f
+		}
+	case m.Handoff != nil:
+		if err := s.handoff(*m.Handoff); err != nil {
+			resp.Error = err.Error()
+		}
+	default:
+		resp.Error = "unknown request"
+	}
+	err := s.write(resp, rf)
+	if err != nil {
+		s.log.Errorx("writing response to preauth process", err)
+	}
+	if rf != nil {
+		// If the preauth process did not get the socket, relaying stops when we close it.
+		err := rf.Close()
+		s.log.Check(err, "closing file for preauth process")
+	}
+}
+
+// connection takes a new connection accepted by the preauth process, does the TLS
+// handshake for immediate TLS, and starts relaying it to the preauth process.
+func (s *preauthServer) connection(req preauthConnRequest, f *os.File) (preauthServe, *os.File, error) {
+	nc, err := net.FileConn(f)
+	err2 := f.Close()
+	s.log.Check(err2, "closing file for connection from preauth process")
+	if err != nil {
+		return preauthServe{}, nil, fmt.Errorf("making connection: %v", err)
+	}
+	l, ok := s.listeners[req.Listener]
+	if !ok {
+		nc.Close()
+		return preauthServe{}, nil, fmt.Errorf("unknown listener %q", req.Listener)
+	}
+
+	r := &preauthRelay{
+		id:       mox.CryptoRandInt(),
+		listener: l.Name,
+		cid:      req.Cid,
+		remoteIP: net.IPv4zero,
+		conn:     nc,
+	}
+	if a, ok := nc.RemoteAddr().(*net.TCPAddr); ok {
+		r.remoteIP = a.IP
+	}
+	if l.Protocol == "imaps" {
+		r.conn, err = s.tlsHandshake(l.Name, req.Cid, nc)
+		if err != nil {
+			return preauthServe{}, nil, err
+		}
+		r.tls = true
+	}
+
+	// Limits are enforced in the main process, the preauth process does not keep state
+	// about remote IPs.
+	rateLimiter, openLimiter := limiters(l.Name)
+	if msg := connectionRefused(s.log, r.remoteIP, rateLimiter, openLimiter); msg != "" {
+		_, err := fmt.Fprintf(r.conn, "* BYE %s\r\n", msg)
+		s.log.Check(err, "writing bye for refused connection")
+		r.conn.Close()
+		return preauthServe{}, nil, fmt.Errorf("connection refused: %s", msg)
+	}
+	var once sync.Once
+	r.release = func() {
+		once.Do(func() {
+			openLimiter.Add(r.remoteIP, time.Now(), -1)
+		})
+	}
+
+	return s.relay(r)
+}
+
+// tlsHandshake does a TLS handshake on a connection of the preauth process. The
+// connection is closed on error.
+func (s *preauthServer) tlsHandshake(listener string, cid int64, conn net.Conn) (*tls.Conn, error) {
+	config := s.tlsConfigs[listener]
+	if config == nil {
+		conn.Close()
+		return nil, fmt.Errorf("no tls config for listener %q", listener)
+	}
+	tc := tls.Server(conn, config)
+	ctx, cancel := context.WithTimeout(mox.Context, time.Minute)
+	defer cancel()
+	if err := tc.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("tls handshake: %v", err)
+	}
+	cs := tc.ConnectionState()
+	version, ciphersuite := moxio.TLSInfo(cs)
+	s.log.Debug("tls handshake completed for preauth process",
+		slog.Int64("preauthcid", cid),
+		slog.String("version", version),
+		slog.String("ciphersuite", ciphersuite),
+		slog.String("sni", cs.ServerName),
+		slog.Bool("resumed", cs.DidResume))
+	return tc, nil
+}
+
+// closeConn closes the remote connection, and releases its count as open
+// connection.
+func (r *preauthRelay) closeConn() error {
+	err := r.conn.Close()
+	r.release()
+	return err
+}
+
+// relay makes a socket pair and starts relaying between the remote connection and
+// the preauth process. The returned file is the end for the preauth process.
+func (s *preauthServer) relay(r *preauthRelay) (preauthServe, *os.File, error) {
+	local, remote, err := preauthSocketpair()
+	if err != nil {
+		r.closeConn()
+		return preauthServe{}, nil, fmt.Errorf("making socket pair: %v", err)
+	}
+	r.pair, err = preauthFileConn(local)
+	err2 := local.Close()
+	s.log.Check(err2, "closing file for socket pair")
+	if err != nil {
+		r.closeConn()
+		remote.Close()
+		return preauthServe{}, nil, fmt.Errorf("making connection for socket pair: %v", err)
+	}
+	r.remoteDone = make(chan struct{})
+	r.preauthDone = make(chan struct{})
+
+	s.Lock()
+	s.relays[r.id] = r
+	s.Unlock()
+
+	go s.relayRemote(r)
+	go s.relayPreauth(r)
+
+	sv := preauthServe{
+		Conn:       r.id,
+		RemoteAddr: r.conn.RemoteAddr().String(),
+		LocalAddr:  r.conn.LocalAddr().String(),
+		TLS:        r.tls,
+	}
+	return sv, remote, nil
+}
+
+// relayRemote copies data from the remote to the preauth process. When the
+// remote closes the connection, writing to the preauth process is closed.
+func (s *preauthServer) relayRemote(r *preauthRelay) {
+	defer close(r.remoteDone)
+
+	buf := make([]byte, 16*1024)
+	for {
+		n, err := r.conn.Read(buf)
+		if n > 0 {
+			if _, err := r.pair.Write(buf[:n]); err != nil {
+				s.log.Debugx("writing to preauth process", err, slog.Int64("preauthcid", r.cid))
+				return
+			}
+		}
+		if err != nil {
+			if !r.stopping.Load() {
+				s.log.Debugx("reading from remote for preauth process", err, slog.Int64("preauthcid", r.cid))
+				err := r.pair.CloseWrite()
+				s.log.Debugx("closing writing to preauth process", err, slog.Int64("preauthcid", r.cid))
+			}
+			return
+		}
+	}
+}
+
+// relayPreauth copies data from the preauth process to the remote. When the
+// preauth process closes the connection without giving it back, the remote
+// connection is closed.
+func (s *preauthServer) relayPreauth(r *preauthRelay) {
+	defer close(r.preauthDone)
+
+	_, err := io.Copy(r.conn, r.pair)
+	if r.stopping.Load() {
+		return
+	}
+	s.log.Debugx("copying from preauth process to remote", err, slog.Int64("preauthcid", r.cid))
+	s.closeRelay(r.id)
+}
+
+// closeRelay closes the connection and socket pair of a relay that has not been
+// taken back.
+func (s *preauthServer) closeRelay(id int64) {
+	s.Lock()
+	r := s.relays[id]
+	delete(s.relays, id)
+	s.Unlock()
+	if r == nil {
+		return
+	}
+	err := r.closeConn()
+	s.log.Debugx("closing remote connection for preauth process", err, slog.Int64("preauthcid", r.cid))
+	err = r.pair.Close()
+	s.log.Debugx("closing socket pair with preauth process", err, slog.Int64("preauthcid", r.cid))
+}
+
+// stop stops relaying data from the remote to the preauth process, and closes
+// writing to the preauth process, so it can read all data sent to it. The
+// connection must be taken back within preauthStopTimeout.
+func (s *preauthServer) stop(id int64) error {
+	s.Lock()
+	r := s.relays[id]
+	s.Unlock()
+	if r == nil {
+		return fmt.Errorf("unknown connection")
+	} else if !r.stopping.CompareAndSwap(false, true) {
+		return fmt.Errorf("connection already stopped")
+	}
+
+	// Interrupt the pending read, and wait for the relaying goroutine to finish.
+	err := r.conn.SetReadDeadline(time.Now())
+	s.log.Check(err, "setting read deadline to stop relaying")
+	<-r.remoteDone
+	err = r.conn.SetReadDeadline(time.Time{})
+	s.log.Check(err, "clearing read deadline")
+	err = r.pair.CloseWrite()
+	s.log.Debugx("closing writing to preauth process", err, slog.Int64("preauthcid", r.cid))
+
+	s.Lock()
+	r.stopTimer = time.AfterFunc(preauthStopTimeout, func() {
+		s.log.Info("preauth process did not continue with stopped connection, closing", slog.Int64("preauthcid", r.cid))
+		s.closeRelay(id)
+	})
+	s.Unlock()
+	return nil
+}
+
+// take takes back a stopped connection from the preauth process, waiting until
+// the preauth process has closed its side of the socket pair.
+func (s *preauthServer) take(id int64) (*preauthRelay, error) {
+	s.Lock()
+	r := s.relays[id]
+	if r == nil || r.stopTimer == nil {
+		s.Unlock()
+		return nil, fmt.Errorf("unknown or not stopped connection")
+	}
+	delete(s.relays, id)
+	r.stopTimer.Stop()
+	s.Unlock()
+
+	timer := time.NewTimer(preauthStopTimeout)
+	defer timer.Stop()
+	select {
+	case <-r.preauthDone:
+	case <-timer.C:
+		r.closeConn()
+		r.pair.Close()
+		return nil, fmt.Errorf("timeout waiting for preauth process to stop writing")
+	}
+	err := r.pair.Close()
+	s.log.Check(err, "closing socket pair with preauth process")
+	return r, nil
+}
+
+// startTLS writes the response to the STARTTLS command for a stopped connection,
+// does the TLS handshake and resumes relaying over a new socket pair.
+func (s *preauthServer) startTLS(req preauthStartTLS) (preauthServe, *os.File, error) {
+	r, err := s.take(req.Conn)
+	if err != nil {
+		return preauthServe{}, nil, err
+	}
+	if r.tls {
+		r.closeConn()
+		return preauthServe{}, nil, fmt.Errorf("tls already active")
+	} else if strings.ContainsAny(req.Tag+req.Cmd, "\r\n") {
+		r.closeConn()
+		return preauthServe{}, nil, fmt.Errorf("bad tag or command")
+	}
+
+	// We add the cid to facilitate debugging in case of TLS connection failure.
+	if _, err := fmt.Fprintf(r.conn, "%s OK %s (%s) done\r\n", req.Tag, req.Cmd, mox.ReceivedID(r.cid)); err != nil {
+		r.closeConn()
+		return preauthServe{}, nil, fmt.Errorf("writing starttls response: %v", err)
+	}
+	conn := r.conn
+	if len(req.Data) > 0 {
+		conn = &prefixConn{req.Data, conn}
+	}
+	tc, err := s.tlsHandshake(r.listener, r.cid, conn)
+	if err != nil {
+		r.release()
+		return preauthServe{}, nil, err
+	}
+	nr := &preauthRelay{
+		id:       r.id,
+		listener: r.listener,
+		cid:      r.cid,
+		remoteIP: r.remoteIP,
+		conn:     tc,
+		tls:      true,
+		release:  r.release,
+	}
+	return s.relay(nr)
+}
+
+// auth does a step in an authentication attempt for the preauth process. Errors
+// are raised with the same panics as commands use, and turned into a result.
+func (s *preauthServer) auth(req preauthAuthRequest) (result preauthAuthResult) {
+	log := s.log
+
+	s.Lock()
+	// Remove sessions that were abandoned, e.g. due to a closed connection.
+	for id, ps := range s.sessions {
+		if time.Since(ps.start) > preauthSessionTimeout {
+			delete(s.sessions, id)
+			if ps.account != nil {
+				err := ps.account.Close()
+				log.Check(err, "closing account of expired preauth session")
+			}
+		}
+	}
+	var ps *preauthSession
+	var r *preauthRelay
+	if req.Session == 0 {
+		r = s.relays[req.Conn]
+	} else {
+		ps = s.sessions[req.Session]
+	}
+	s.Unlock()
+
+	if r != nil {
+		// IP bans and the limit on failed authentication attempts are enforced here, for
+		// the remote IP of the connection we hold, so a compromised preauth process
+		// cannot try passwords without limits. Each attempt counts as a failure until it
+		// succeeds, so concurrent attempts cannot exceed the limit.
+		if store.IPBanned(r.remoteIP) {
+			log.Debug("refusing authentication from banned ip", slog.Any("remoteip", r.remoteIP), slog.Int64("preauthcid", r.cid))
+			return preauthAuthResult{Done: true, ErrorKind: "user", Error: "your ip or network is banned"}
+		}
+		if !mox.LimiterFailedAuth.Add(r.remoteIP, time.Now(), 1) {
+			metrics.AuthenticationRatelimitedInc("imap")
+			log.Debug("refusing authentication due to many auth failures", slog.Any("remoteip", r.remoteIP), slog.Int64("preauthcid", r.cid))
+			return preauthAuthResult{Done: true, ErrorKind: "user", Error: "too many authentication failures"}
+		}
+		ps = newPreauthSession(log, r, req)
+		s.Lock()
+		s.sessions[ps.id] = ps
+		s.Unlock()
+	}
+
+	if ps == nil {
+		return preauthAuthResult{Session: req.Session, Done: true, ErrorKind: "server", Error: "unknown authentication session or connection"}
+	} else if ps.account != nil {
+		return preauthAuthResult{Session: req.Session, Done: true, ErrorKind: "server", Error: "authentication session already done"}
+	}
+	result.Session = ps.id
+
+	remoteIP := ps.remoteIP
+
+	var account *store.Account
+	defer func() {
+		x := recover()
+		if x == nil && !result.Done {
+			return
+		}
+
+		result.Done = true
+		if x == nil {
+			mox.LimiterFailedAuth.Reset(remoteIP, time.Now())
+			ps.account = account
+			ps.la.AccountName = account.Name
+			ps.la.LoginAddress = ps.username
+			ps.la.Result = store.AuthSuccess
+		} else {
+			err, ok := x.(error)
+			if !ok {
+				panic(x)
+			}
+			var sxerr syntaxError
+			var uerr userError
+			var serr serverError
+			if errors.As(err, &sxerr) {
+				result.ErrorKind = "syntax"
+				result.Error = sxerr.errmsg
+			} else if errors.As(err, &uerr) {
+				result.ErrorKind = "user"
+				result.Code = uerr.code
+				result.Error = uerr.Error()
+			} else if errors.As(err, &serr) {
+				log.Errorx("preauth authentication server error", err)
+				result.ErrorKind = "server"
+				result.Error = serr.Error()
+			} else {
+				panic(x)
+			}
+			if account != nil {
+				err := account.Close()
+				log.Check(err, "closing account after failed authentication")
+			}
+			s.Lock()
+			delete(s.sessions, ps.id)
+			s.Unlock()
+		}
+		store.LoginAttemptAdd(context.Background(), log, ps.la)
+	}()
+
+	ps.step++
+	mech := ps.la.AuthMech
+	if req.Abort && (ps.finishErr == nil || ps.step != 3) {
+		ps.la.Result = store.AuthAborted
+		xsyntaxErrorf("authenticate aborted by client")
+	}
+
+	switch mech {
+	case "login", "plain":
+		var username, password string
+		if mech == "login" {
+			t := bytes.SplitN(req.Data, []byte{0}, 2)
+			if len(t) != 2 {
+				xsyntaxErrorf("bad login data")
+			}
+			username = norm.NFC.String(string(t[0]))
+			password = string(t[1])
+		} else {
+			plain := bytes.Split(req.Data, []byte{0})
+			if len(plain) != 3 {
+				xsyntaxErrorf("bad plain auth data, expected 3 nul-separated tokens, got %d tokens", len(plain))
+			}
+			authz := norm.NFC.String(string(plain[0]))
+			username = norm.NFC.String(string(plain[1]))
+			password = string(plain[2])
+			if authz != "" && authz != username {
+				ps.la.LoginAddress = username
+				xusercodeErrorf("AUTHORIZATIONFAILED", "cannot assume role")
+			}
+		}
+		ps.username = username
+		ps.la.LoginAddress = username
+
+		var err error
+		account, ps.la.AccountName, ps.la.AppPasswordName, err = store.OpenEmailAuthProtocol(log, username, password, store.AppPasswordIMAP, remoteIP, mech == "login")
+		if err != nil {
+			if errors.Is(err, store.ErrUnknownCredentials) {
+				ps.la.Result = store.AuthBadCredentials
+				log.Info("failed authentication attempt", slog.String("username", username), slog.Any("remote", remoteIP))
+				if mech == "login" {
+					xusercodeErrorf("AUTHENTICATIONFAILED", "login failed")
+				}
+				xusercodeErrorf("AUTHENTICATIONFAILED", "bad credentials")
+			} else if errors.Is(err, store.ErrLoginDisabled) {
+				ps.la.Result = store.AuthLoginDisabled
+				log.Info("account login disabled", slog.String("username", username))
+				xuserErrorf("%s", err)
+			}
+			if mech == "login" {
+				xuserErrorf("login failed")
+			}
+			xuserErrorf("error")
+		}
+
+	case "cram-md5":
+		if ps.step == 1 {
+			// ../rfc/2195:82
+			ps.chal = fmt.Sprintf("<%d.%d@%s>", uint64(mox.CryptoRandInt()), time.Now().UnixNano(), mox.Conf.Static.HostnameDomain.ASCII)
+			result.Challenge = []byte(ps.chal)
+			return
+		}
+
+		t := strings.Split(string(req.Data), " ")
+		if len(t) != 2 || len(t[1]) != 2*md5.Size {
+			xsyntaxErrorf("malformed cram-md5 response")
+		}
+		ps.username = norm.NFC.String(t[0])
+		ps.la.LoginAddress = ps.username
+		var err error
+		account, ps.la.AccountName, _, err = store.OpenEmail(log, ps.username, false)
+		if err != nil {
+			if errors.Is(err, store.ErrUnknownCredentials) {
+				ps.la.Result = store.AuthBadCredentials
+				log.Info("failed authentication attempt", slog.String("username", ps.username), slog.Any("remote", remoteIP))
+				xusercodeErrorf("AUTHENTICATIONFAILED", "bad credentials")
+			}
+			xserverErrorf("looking up address: %v", err)
+		}
+		secrets := xpreauthSecrets(account, remoteIP)
+		if len(secrets) > 0 && secrets[0].AppPasswordID == 0 && (secrets[0].CRAMMD5.Ipad == nil || secrets[0].CRAMMD5.Opad == nil) {
+			log.Info("cram-md5 auth attempt without derived secrets set, save password again to store secrets", slog.String("username", ps.username))
+			result.MissingDerivedSecrets = true
+		}
+		match := store.CRAMMD5Match(secrets, ps.chal, t[1])
+		if match == nil {
+			ps.la.Result = store.AuthBadCredentials
+			log.Info("failed authentication attempt", slog.String("username", ps.username), slog.Any("remote", remoteIP))
+			xusercodeErrorf("AUTHENTICATIONFAILED", "bad credentials")
+		}
+		if match.AppPasswordID != 0 {
+			ps.la.AppPasswordName = match.AppPasswordName
+			account.AppPasswordUsed(log, match.AppPasswordID, store.AppPasswordIMAP, remoteIP)
+		}
+
+	case "scram-sha-256-plus", "scram-sha-256", "scram-sha-1-plus", "scram-sha-1":
+		var h func() hash.Hash
+		var variant string
+		if strings.HasPrefix(mech, "scram-sha-1") {
+			h = sha1.New
+			variant = "sha1"
+		} else {
+			h = sha256.New
+			variant = "sha256"
+		}
+
+		switch ps.step {
+		case 1:
+			requireChannelBinding := strings.HasSuffix(mech, "-plus")
+			if requireChannelBinding && ps.channelBinding == nil {
+				xuserErrorf("cannot use plus variant with tls channel binding without tls")
+			}
+			var err error
+			ps.ss, err = scram.NewServerChannelBinding(h, req.Data, ps.channelBinding, requireChannelBinding)
+			if err != nil {
+				log.Infox("scram protocol error", err, slog.Any("remote", remoteIP))
+				xuserErrorf("scram protocol error: %s", err)
+			}
+			ps.username = ps.ss.Authentication
+			ps.la.LoginAddress = ps.username
+			acc, accName, _, err := store.OpenEmail(log, ps.username, false)
+			ps.la.AccountName = accName
+			if err != nil {
+				xuserErrorf("scram not possible")
+			}
+			// We only need the account to get the secrets. We open it again after verifying
+			// the client proof.
+			secrets := xpreauthSecrets(acc, remoteIP)
+			err = acc.Close()
+			log.Check(err, "closing account")
+			if ps.ss.Authorization != "" && ps.ss.Authorization != ps.username {
+				xuserErrorf("authentication with authorization for different user not supported")
+			}
+			if len(secrets) == 0 {
+				log.Info("failed authentication attempt", slog.String("username", ps.username), slog.Any("remote", remoteIP))
+				xusercodeErrorf("AUTHENTICATIONFAILED", "bad credentials")
+			}
+			var salt []byte
+			var iterations int
+			salt, iterations, ps.saltedPasswords, ps.candidates = store.SCRAMCandidates(secrets, variant)
+			if salt == nil {
+				result.MissingDerivedSecrets = true
+				log.Info("scram auth attempt without derived secrets set, save password again to store secrets", slog.String("username", ps.username))
+				xuserErrorf("scram not possible")
+			}
+			s1, err := ps.ss.ServerFirst(iterations, salt)
+			xcheckf(err, "scram first server step")
+			result.Challenge = []byte(s1)
+			return
+
+		case 2:
+			s3, index, err := ps.ss.FinishMulti(req.Data, ps.saltedPasswords)
+			if err == nil {
+				if match := ps.candidates[index]; match.AppPasswordID != 0 {
+					ps.la.AppPasswordName = match.AppPasswordName
+					ps.candidates = []store.AuthSecret{match}
+				} else {
+					ps.candidates = nil
+				}
+			} else {
+				ps.finishErr = err
+				if len(s3) == 0 {
+					xpreauthScramError(log, ps, remoteIP)
+				}
+			}
+			// Client must still respond, but there is nothing to say. See ../rfc/9051:6221
+			result.Challenge = []byte(s3)
+			return
+
+		default:
+			if ps.finishErr != nil {
+				xpreauthScramError(log, ps, remoteIP)
+			}
+			var err error
+			account, ps.la.AccountName, _, err = store.OpenEmail(log, ps.username, false)
+			xcheckf(err, "open account")
+			if len(ps.candidates) == 1 {
+				account.AppPasswordUsed(log, ps.candidates[0].AppPasswordID, store.AppPasswordIMAP, remoteIP)
+			}
+		}
+
+	default:
+		ps.la.AuthMech = "(unrecognized)"
+		xuserErrorf("method not supported")
+	}
+
+	if mech != "login" {
+		if accConf, ok := account.Conf(); !ok {
+			xserverErrorf("cannot get account config")
+		} else if accConf.LoginDisabled != "" {
+			ps.la.Result = store.AuthLoginDisabled
+			log.Info("account login disabled", slog.String("username", ps.username))
+			// No AUTHENTICATIONFAILED code, clients could prompt users for different password.
+			xuserErrorf("%w: %s", store.ErrLoginDisabled, accConf.LoginDisabled)
+		}
+	}
+	return preauthAuthResult{Session: ps.id, Done: true}
+}
+
+// newPreauthSession returns a new authentication session for a connection,
+// with TLS details from the connection.
+func newPreauthSession(log mlog.Log, r *preauthRelay, req preauthAuthRequest) *preauthSession {
+	localAddr := r.conn.LocalAddr().String()
+	localIP, _, _ := net.SplitHostPort(localAddr)
+	if localIP == "" {
+		localIP = localAddr
+	}
+	ps := &preauthSession{
+		id:       mox.CryptoRandInt(),
+		conn:     r.id,
+		start:    time.Now(),
+		remoteIP: r.remoteIP,
+		la: store.LoginAttempt{
+			RemoteIP:  r.remoteIP.String(),
+			LocalIP:   localIP,
+			Protocol:  "imap",
+			UserAgent: req.UserAgent,
+			AuthMech:  req.Mech,
+			Result:    store.AuthError, // Replaced later.
+		},
+	}
+	if tc, ok := r.conn.(*tls.Conn); ok {
+		cs := tc.ConnectionState()
+		ps.la.TLS = store.LoginAttemptTLS(&cs)
+		cb, err := scram.NewChannelBinding(&cs)
+		if err != nil {
+			log.Debugx("getting tls channel binding data", err)
+		} else {
+			ps.channelBinding = cb
+		}
+	}
+	return ps
+}
+
+// xpreauthSecrets returns the secrets of the main password and of app passwords
+// allowed for imap.
+func xpreauthSecrets(acc *store.Account, remoteIP net.IP) (secrets []store.AuthSecret) {
+	acc.WithRLock(func() {
+		err := acc.DB.Read(context.TODO(), func(tx *bstore.Tx) error {
+			var err error
+			secrets, err = store.AuthSecrets(tx, store.AppPasswordIMAP, remoteIP)
+			return err
+		})
+		xcheckf(err, "read tx")
+	})
+	return
+}
+
+func xpreauthScramError(log mlog.Log, ps *preauthSession, remoteIP net.IP) {
+	err := ps.finishErr
+	if errors.Is(err, scram.ErrInvalidProof) {
+		ps.la.Result = store.AuthBadCredentials
+		log.Info("failed authentication attempt", slog.String("username", ps.username), slog.Any("remote", remoteIP))
+		xusercodeErrorf("AUTHENTICATIONFAILED", "bad credentials")
+	} else if errors.Is(err, scram.ErrChannelBindingsDontMatch) {
+		ps.la.Result = store.AuthBadChannelBinding
+		log.Warn("bad channel binding during authentication, potential mitm", slog.String("username", ps.username), slog.Any("remote", remoteIP))
+		xusercodeErrorf("AUTHENTICATIONFAILED", "channel bindings do not match, potential mitm")
+	} else if errors.Is(err, scram.ErrInvalidEncoding) {
+		ps.la.Result = store.AuthBadProtocol
+		log.Infox("bad scram protocol message", err, slog.String("username", ps.username), slog.Any("remote", remoteIP))
+		xuserErrorf("bad scram protocol message: %s", err)
+	}
+	xuserErrorf("server final: %w", err)
+}
+
+// handoff takes back a connection that was authenticated by the preauth process,
+// and starts serving it.
+func (s *preauthServer) handoff(h preauthHandoff) error {
+	r, err := s.take(h.Conn)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	ps := s.sessions[h.Session]
+	if ps != nil && ps.account != nil && ps.conn == h.Conn {
+		delete(s.sessions, h.Session)
+	} else {
+		ps = nil
+	}
+	s.Unlock()
+	if ps == nil {
+		s.log.Error("handoff from preauth process for unknown or unauthenticated session", slog.Int64("preauthcid", r.cid))
+		err := r.closeConn()
+		s.log.Check(err, "closing handoff connection")
+		return fmt.Errorf("unknown or unauthenticated session")
+	}
+
+	conn := r.conn
+	if len(h.Data) > 0 {
+		conn = &prefixConn{h.Data, conn}
+	}
+	ho := &handoff{
+		remoteIP:   r.remoteIP,
+		remoteAddr: r.conn.RemoteAddr().String(),
+		preauthCid: r.cid,
+		tag:        h.Tag,
+		cmd:        h.Cmd,
+		username:   ps.username,
+		account:    ps.account,
+		userAgent:  h.UserAgent,
+	}
+	// Serving counts the connection again.
+	r.release()
+	go serve(r.listener, mox.Cid(), nil, conn, r.tls, true, false, false, "", nil, ho)
+	return nil
+}
+
+// PreauthProcess handles unauthenticated IMAP connections, in a separate process,
+// see config option PreauthUser. It receives its configuration from the main
+// process over ctl, and starts serving on the listeners passed by the privileged
+// process. It returns when the connection to the main process fails.
+func PreauthProcess(ctl *os.File) error {
+	log := mlog.New("imapserver", nil)
+	uc, err := preauthFileConn(ctl)
+	if err != nil {
+		return fmt.Errorf("making connection for main process: %v", err)
+	}
+	buf := make([]byte, preauthMaxMsgSize)
+	m, _, err := preauthReadMsg(uc, buf)
+	if err != nil {
+		return fmt.Errorf("reading config: %v", err)
+	} else if m.Config == nil {
+		return fmt.Errorf("first message from main process is not config")
+	}
+	mlog.SetConfig(m.Config.LogLevels)
+
+	// Bans and rate limits are enforced by the main process, which keeps the counts.
+	pc := newPreauthClient(log, uc)
+	for _, l := range m.Config.Listeners {
+		ln, err := mox.Listen(l.Network, l.Addr)
+		if err != nil {
+			return fmt.Errorf("listen for imap on %s: %v", l.Addr, err)
+		}
+		go pc.serveListener(l, ln)
+	}
+	mox.CleanupPassedFiles()
+	return pc.read(buf)
+}
+
+// preauthClient makes requests to the main process, from the preauth process.
+type preauthClient struct {
+	log  mlog.Log
+	conn *net.UnixConn
+
+	wmutex sync.Mutex // For writing to conn.
+
+	sync.Mutex
+	lastID  int64
+	pending map[int64]chan preauthMsg
+	err     error // Set when reading from main process failed.
+}
+
+// preauthConn is a connection in the preauth process. The remote connection is
+// held by the main process, which relays its data.
+type preauthConn struct {
+	client     *preauthClient
+	id         int64 // Connection ID in main process.
+	remoteIP   net.IP
+	remoteAddr string
+	localAddr  string
+}
+
+func newPreauthClient(log mlog.Log, conn *net.UnixConn) *preauthClient {
+	return &preauthClient{log: log, conn: conn, pending: map[int64]chan preauthMsg{}}
+}
+
+// serveListener accepts connections on a listener and passes them to the main
+// process, until shutdown.
+func (pc *preauthClient) serveListener(l preauthListener, ln net.Listener) {
+	go func() {
+		// Stop accepting new connections during shutdown.
+		<-mox.Shutdown.Done()
+		err := ln.Close()
+		pc.log.Check(err, "closing listener")
+	}()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			pc.log.Infox("imap: accept", err, slog.String("protocol", l.Protocol), slog.String("listener", l.Name))
+			continue
+		}
+
+		metricIMAPConnection.WithLabelValues(l.Protocol).Inc()
+		go pc.serveConn(l, conn)
+	}
+}
+
+// serveConn passes a new connection to the main process, and serves the socket
+// over which the main process relays the connection.
+func (pc *preauthClient) serveConn(l preauthListener, nc net.Conn) {
+	cid := mox.Cid()
+	log := pc.log.WithCid(cid)
+
+	fc, ok := nc.(interface{ File() (*os.File, error) })
+	if !ok {
+		log.Error("cannot pass connection to main process", slog.String("type", fmt.Sprintf("%T", nc)))
+		nc.Close()
+		return
+	}
+	f, err := fc.File()
+	err2 := nc.Close()
+	log.Check(err2, "closing connection after duplicating file descriptor")
+	if err != nil {
+		log.Errorx("getting file for connection", err)
+		return
+	}
+	r, err := pc.call(preauthMsg{Conn: &preauthConnRequest{Listener: l.Name, Cid: cid}}, f)
+	err2 = f.Close()
+	log.Check(err2, "closing file for connection")
+	if err != nil {
+		log.Infox("passing connection to main process", err)
+		return
+	} else if r.Serve == nil || r.file == nil {
+		log.Error("missing socket for connection from main process")
+		if r.file != nil {
+			r.file.Close()
+		}
+		return
+	}
+	sc, err := preauthFileConn(r.file)
+	err2 = r.file.Close()
+	log.Check(err2, "closing file for connection from main process")
+	if err != nil {
+		log.Errorx("making connection for socket from main process", err)
+		return
+	}
+
+	pa := &preauthConn{
+		client:     pc,
+		id:         r.Serve.Conn,
+		remoteIP:   net.IPv4zero,
+		remoteAddr: r.Serve.RemoteAddr,
+		localAddr:  r.Serve.LocalAddr,
+	}
+	if ap, err := netip.ParseAddrPort(r.Serve.RemoteAddr); err == nil {
+		pa.remoteIP = net.IP(ap.Addr().Unmap().AsSlice())
+	}
+	var tlsConfig *tls.Config
+	if l.TLS {
+		// Only for announcing STARTTLS, the main process does the TLS handshake.
+		tlsConfig = &tls.Config{}
+	}
+	serve(l.Name, cid, tlsConfig, sc, r.Serve.TLS, true, l.NoRequireSTARTTLS, false, "", pa, nil)
+}
+
+// read reads responses from the main process, until the connection fails.
+func (pc *preauthClient) read(buf []byte) error {
+	for {
+		m, f, err := preauthReadMsg(pc.conn, buf)
+		if err != nil {
+			pc.Lock()
+			pc.err = err
+			for id, ch := range pc.pending {
+				close(ch)
+				delete(pc.pending, id)
+			}
+			pc.Unlock()
+			return err
+		}
+		m.file = f
+		pc.Lock()
+		ch := pc.pending[m.ID]
+		delete(pc.pending, m.ID)
+		pc.Unlock()
+		if ch == nil {
+			pc.log.Error("response from main process for unknown request", slog.Int64("id", m.ID))
+			if f != nil {
+				f.Close()
+			}
+			continue
+		}
+		ch <- m
+	}
+}
+
+// call sends a request, with an optional file descriptor, to the main process and
+// waits for the response. The caller must close a file in the response.
+func (pc *preauthClient) call(m preauthMsg, f *os.File) (preauthMsg, error) {
+	ch := make(chan preauthMsg, 1)
+	pc.Lock()
+	if pc.err != nil {
+		pc.Unlock()
+		return preauthMsg{}, fmt.Errorf("connection to main process: %v", pc.err)
+	}
+	pc.lastID++
+	m.ID = pc.lastID
+	pc.pending[m.ID] = ch
+	pc.Unlock()
+
+	if err := pc.write(m, f); err != nil {
+		pc.Lock()
+		delete(pc.pending, m.ID)
+		pc.Unlock()
+		return preauthMsg{}, fmt.Errorf("writing request to main process: %v", err)
+	}
+
+	// Includes time for a TLS handshake by the main process.
+	timer := time.NewTimer(2 * time.Minute)
+	defer timer.Stop()
+	select {
+	case r, ok := <-ch:
+		if !ok {
+			return preauthMsg{}, fmt.Errorf("connection to main process closed")
+		} else if r.Error != "" {
+			if r.file != nil {
+				r.file.Close()
+			}
+			return preauthMsg{}, errors.New(r.Error)
+		}
+		return r, nil
+	case <-timer.C:
+		pc.Lock()
+		delete(pc.pending, m.ID)
+		pc.Unlock()
+		return preauthMsg{}, fmt.Errorf("timeout waiting for response from main process")
+	}
+}
+
+func (pc *preauthClient) write(m preauthMsg, f *os.File) error {
+	pc.wmutex.Lock()
+	defer pc.wmutex.Unlock()
+	return preauthWriteMsg(pc.conn, m, f)
+}
+
+// cmdPreauthLogin is like cmdLogin, but for the preauth process.
+func (c *conn) cmdPreauthLogin(tag, cmd string, p *parser) {
+	// Request syntax: ../rfc/9051:6667 ../rfc/3501:4804
+	p.xspace()
+	username := norm.NFC.String(p.xastring())
+	p.xspace()
+	password := p.xastring()
+	p.xempty()
+
+	if !c.noRequireSTARTTLS && !c.tls {
+		// ../rfc/9051:5194
+		xusercodeErrorf("PRIVACYREQUIRED", "tls required for login")
+	}
+
+	c.xpreauthAuth(tag, "login", "login", []byte(username+"\x00"+password), false)
+}
+
+// cmdPreauthAuthenticate is like cmdAuthenticate, but for the preauth process.
+func (c *conn) cmdPreauthAuthenticate(tag, cmd string, p *parser) {
+	// Request syntax: ../rfc/9051:6341 ../rfc/3501:4561
+	p.xspace()
+	mech := strings.ToLower(p.xatom())
+
+	// Returns the initial response, and whether the client aborted.
+	xreadInitial := func() ([]byte, bool) {
+		var line string
+		if p.empty() {
+			c.xwritelinef("+ ")
+			line = c.xreadline(false)
+		} else {
+			// ../rfc/9051:1407 ../rfc/4959:84
+			p.xspace()
+			line = p.remainder()
+			if line == "=" {
+				// ../rfc/9051:1450
+				line = "" // Base64 decode will result in empty buffer.
+			}
+		}
+		// ../rfc/9051:1442 ../rfc/3501:1553
+		if line == "*" {
+			return nil, true
+		}
+		buf, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			xsyntaxErrorf("parsing base64: %v", err)
+		}
+		return buf, false
+	}
+
+	var data []byte
+	var abort bool
+	switch mech {
+	case "plain":
+		if !c.noRequireSTARTTLS && !c.tls {
+			// ../rfc/9051:5194
+			xusercodeErrorf("PRIVACYREQUIRED", "tls required for login")
+		}
+
+		// Plain text passwords, mark as traceauth.
+		defer c.xtraceread(mlog.LevelTraceauth)()
+		data, abort = xreadInitial()
+		c.xtraceread(mlog.LevelTrace) // Restore.
+
+	case "cram-md5":
+		// ../rfc/9051:1462
+		p.xempty()
+
+	case "scram-sha-256-plus", "scram-sha-256", "scram-sha-1-plus", "scram-sha-1":
+		if strings.HasSuffix(mech, "-plus") && !c.tls {
+			xuserErrorf("cannot use plus variant with tls channel binding without tls")
+		}
+		data, abort = xreadInitial()
+
+	default:
+		xuserErrorf("method not supported")
+	}
+
+	c.xpreauthAuth(tag, "authenticate", mech, data, abort)
+}
+
+// xpreauthAuth does an authentication exchange through the main process, and
+// hands off the connection to the main process on success.
+func (c *conn) xpreauthAuth(tag, cmd, mech string, data []byte, abort bool) {
+	// For many failed auth attempts, slow down verification attempts.
+	if c.authFailed > 3 && authFailDelay > 0 {
+		mox.Sleep(mox.Context, time.Duration(c.authFailed-3)*authFailDelay)
+	}
+
+	// The limit on failed authentication attempts for the remote IP is enforced by the
+	// main process.
+	var missingDerivedSecrets bool
+	c.authFailed++ // Compensated on success.
+	defer func() {
+		if missingDerivedSecrets {
+			c.authFailed--
+		}
+		// On the 3rd failed authentication, start responding slowly. Successful auth will
+		// cause fast responses again.
+		if c.authFailed >= 3 {
+			c.setSlow(true)
+		}
+	}()
+
+	// The main process adds the addresses and TLS details of the connection.
+	req := preauthAuthRequest{
+		Mech:      mech,
+		Data:      data,
+		Abort:     abort,
+		Conn:      c.preauth.id,
+		UserAgent: c.userAgent,
+	}
+
+	for {
+		resp, err := c.preauth.client.call(preauthMsg{Auth: &req}, nil)
+		xcheckf(err, "authentication through main process")
+		r := resp.AuthResult
+		if r == nil {
+			xserverErrorf("missing authentication result from main process")
+		}
+		if !r.Done {
+			c.xwritelinef("+ %s", base64.StdEncoding.EncodeToString(r.Challenge))
+			line := c.xreadline(false)
+			req = preauthAuthRequest{Session: r.Session, Mech: mech}
+			if line == "*" {
+				req.Abort = true
+			} else if req.Data, err = base64.StdEncoding.DecodeString(line); err != nil {
+				xsyntaxErrorf("parsing base64: %v", err)
+			}
+			continue
+		}
+
+		missingDerivedSecrets = r.MissingDerivedSecrets
+		switch r.ErrorKind {
+		case "":
+		case "user":
+			panic(userError{code: r.Code, err: errors.New(r.Error)})
+		case "syntax":
+			xsyntaxErrorf("%s", r.Error)
+		default:
+			xserverErrorf("%s", r.Error)
+		}
+		c.authFailed = 0
+		c.setSlow(false)
+		c.xpreauthHandoff(r.Session, tag, cmd)
+	}
+}
+
+// xpreauthReturn gives the connection back to the main process. Pending output is
+// flushed, and data sent by the main process but not yet handled is returned.
+// The socket to the main process is closed, no more responses can be written.
+func (c *conn) xpreauthReturn() []byte {
+	c.xflush()
+
+	_, err := c.preauth.client.call(preauthMsg{Stop: c.preauth.id}, nil)
+	xcheckf(err, "stop relaying by main process")
+
+	// Main process stops relaying to the remote when we close writing.
+	uc, ok := c.conn.(*net.UnixConn)
+	if !ok {
+		c.xbrokenf("connection to main process is %T, not unix domain socket", c.conn)
+	}
+	err = uc.CloseWrite()
+	xcheckf(err, "closing writing to main process")
+
+	// Read until the main process closes its side.
+	err = c.conn.SetReadDeadline(time.Now().Add(time.Minute))
+	c.log.Check(err, "setting read deadline")
+	buf, err := io.ReadAll(io.LimitReader(c.br, preauthMaxPending+1))
+	if err != nil {
+		c.xbrokenf("reading pending data from main process: %s (%w)", err, errIO)
+	} else if len(buf) > preauthMaxPending {
+		c.xbrokenf("too much pending data for main process (%w)", errProtocol)
+	}
+	err = c.conn.Close()
+	c.log.Check(err, "closing connection to main process")
+	return buf
+}
+
+// xpreauthStarttls gives the connection back to the main process, which writes
+// the response and does the TLS handshake. Serving continues on a new socket.
+func (c *conn) xpreauthStarttls(tag, cmd string) {
+	data := c.xpreauthReturn()
+
+	st := preauthStartTLS{
+		Conn: c.preauth.id,
+		Tag:  tag,
+		Cmd:  cmd,
+		Data: data,
+	}
+	r, err := c.preauth.client.call(preauthMsg{StartTLS: &st}, nil)
+	if err != nil {
+		c.xbrokenf("starttls through main process: %s (%w)", err, errIO)
+	} else if r.Serve == nil || r.file == nil {
+		if r.file != nil {
+			r.file.Close()
+		}
+		c.xbrokenf("missing socket from main process after starttls (%w)", errIO)
+	}
+	nc, err := preauthFileConn(r.file)
+	err2 := r.file.Close()
+	c.log.Check(err2, "closing file for connection from main process")
+	if err != nil {
+		c.xbrokenf("making connection for socket from main process: %s (%w)", err, errIO)
+	}
+	c.preauth.id = r.Serve.Conn
+	c.conn = nc
+	c.tr = moxio.NewTraceReader(c.log, "C: ", c.conn)
+	c.br = bufio.NewReader(c.tr)
+	c.tls = true
+}
+
+// xpreauthHandoff gives the authenticated connection back to the main process,
+// which serves it further. The connection in the preauth process is closed.
+func (c *conn) xpreauthHandoff(session int64, tag, cmd string) {
+	data := c.xpreauthReturn()
+
+	h := preauthHandoff{
+		Session:   session,
+		Conn:      c.preauth.id,
+		Tag:       tag,
+		Cmd:       cmd,
+		UserAgent: c.userAgent,
+		Data:      data,
+	}
+	if _, err := c.preauth.client.call(preauthMsg{Handoff: &h}, nil); err != nil {
+		c.xbrokenf("handing off connection to main process: %s (%w)", err, errIO)
+	}
+	c.log.Info("authenticated, connection handed off to main process")
+	panic(cleanClose)
+}
@@ -0,0 +1,160 @@
+package imapserver
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/mjl-/mox/imapclient"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/ratelimit"
+)
+
+// Test authentication and handoff through a preauth process, with the preauth
+// and main side in this process, communicating over a socket pair.
+func TestPreauthProcess(t *testing.T) {
+	tc := start(t, false)
+	defer tc.close()
+
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_SEQPACKET, 0)
+	tcheck(t, err, "socketpair")
+	mainConn, err := preauthFileConn(os.NewFile(uintptr(fds[0]), "main"))
+	tcheck(t, err, "main conn")
+	childConn, err := preauthFileConn(os.NewFile(uintptr(fds[1]), "preauth"))
+	tcheck(t, err, "preauth conn")
+	defer mainConn.Close()
+	defer childConn.Close()
+
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{fakeCert(t, false)}}
+	ps := newPreauthServer(pkglog, mainConn, map[string]*tls.Config{"test": tlsConfig, "tests": tlsConfig})
+	listeners := []preauthListener{
+		{Name: "test", Protocol: "imap", TLS: true, NoRequireSTARTTLS: true},
+		{Name: "tests", Protocol: "imaps", TLS: true},
+	}
+	go ps.serve(preauthConfig{Listeners: listeners})
+
+	buf := make([]byte, preauthMaxMsgSize)
+	m, _, err := preauthReadMsg(childConn, buf)
+	tcheck(t, err, "read config")
+	if m.Config == nil || len(m.Config.Listeners) != len(listeners) {
+		t.Fatalf("got config %v, expected listeners %v", m.Config, listeners)
+	}
+
+	pc := newPreauthClient(pkglog, childConn)
+	go pc.read(buf)
+
+	addrs := map[string]string{}
+	for _, l := range listeners {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		tcheck(t, err, "listen")
+		defer ln.Close()
+		addrs[l.Name] = ln.Addr().String()
+		go pc.serveListener(l, ln)
+	}
+
+	dial := func(name string, xtls bool) *imapclient.Conn {
+		t.Helper()
+		conn, err := net.Dial("tcp", addrs[name])
+		tcheck(t, err, "dial")
+		if xtls {
+			conn = tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+		}
+		client, err := imapclient.New(conn, &imapclient.Opts{Error: func(err error) {}})
+		tcheck(t, err, "new client")
+		return client
+	}
+
+	// Plain text connection, with bad and good login.
+	client := dial("test", false)
+	_, err = client.Login("mjl@mox.example", "badpassword")
+	if err == nil {
+		t.Fatalf("login with bad password succeeded")
+	}
+	_, err = client.Login("mjl@mox.example", password0)
+	tcheck(t, err, "login")
+	_, err = client.Select("inbox")
+	tcheck(t, err, "select after handoff")
+	client.Close()
+
+	// After handoff, the main process serves the connection itself, nothing is
+	// relayed through the preauth process anymore.
+	ps.Lock()
+	nrelays := len(ps.relays)
+	ps.Unlock()
+	if nrelays != 0 {
+		t.Fatalf("%d connections still relayed after handoff, expected 0", nrelays)
+	}
+
+	// Commands pipelined after the login are sent to the main process at handoff.
+	conn, err := net.Dial("tcp", addrs["test"])
+	tcheck(t, err, "dial")
+	br := bufio.NewReader(conn)
+	readline := func() string {
+		t.Helper()
+		line, err := br.ReadString('\n')
+		tcheck(t, err, "read line")
+		return line
+	}
+	readline() // Greeting.
+	_, err = fmt.Fprintf(conn, "a login mjl@mox.example \"%s\"\r\nb select inbox\r\n", password0)
+	tcheck(t, err, "write")
+	for !strings.HasPrefix(readline(), "a OK ") {
+	}
+	for {
+		line := readline()
+		if strings.HasPrefix(line, "b ") {
+			if !strings.HasPrefix(line, "b OK ") {
+				t.Fatalf("got %q, expected ok for pipelined select", line)
+			}
+			break
+		}
+	}
+	conn.Close()
+
+	// TLS connection, with the handshake by the main process, and channel binding.
+	client = dial("tests", true)
+	_, err = client.AuthenticateSCRAM("SCRAM-SHA-256-PLUS", sha256.New, "mjl@mox.example", password0)
+	tcheck(t, err, "authenticate scram")
+	_, err = client.Select("inbox")
+	tcheck(t, err, "select after handoff")
+	client.Close()
+
+	// STARTTLS, then authenticate plain.
+	client = dial("test", false)
+	_, err = client.StartTLS(&tls.Config{InsecureSkipVerify: true})
+	tcheck(t, err, "starttls")
+	_, err = client.AuthenticatePlain("mjl@mox.example", password0)
+	tcheck(t, err, "authenticate plain")
+	_, err = client.Select("inbox")
+	tcheck(t, err, "select after handoff")
+	client.Close()
+
+	// The limit on failed authentication attempts is enforced by the main process.
+	limiterFailedAuth := mox.LimiterFailedAuth
+	defer func() {
+		mox.LimiterFailedAuth = limiterFailedAuth
+	}()
+	mox.LimiterFailedAuth = &ratelimit.Limiter{
+		WindowLimits: []ratelimit.WindowLimit{{Window: time.Minute, Limits: [...]int64{2, 2, 2}}},
+	}
+	client = dial("test", false)
+	for range 2 {
+		_, err = client.Login("mjl@mox.example", "badpassword")
+		if err == nil || strings.Contains(err.Error(), "too many") {
+			t.Fatalf("got err %v, expected bad credentials", err)
+		}
+	}
+	_, err = client.Login("mjl@mox.example", password0)
+	if err == nil || !strings.Contains(err.Error(), "too many authentication failures") {
+		t.Fatalf("got err %v, expected too many authentication failures", err)
+	}
+	client.Close()
+}
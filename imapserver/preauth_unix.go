@@ -0,0 +1,109 @@
+//go:build unix
+
+package imapserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+func preauthFileConn(f *os.File) (*net.UnixConn, error) {
+	nc, err := net.FileConn(f)
+	if err != nil {
+		return nil, err
+	}
+	uc, ok := nc.(*net.UnixConn)
+	if !ok {
+		nc.Close()
+		return nil, fmt.Errorf("connection is %T, not unix domain socket", nc)
+	}
+	return uc, nil
+}
+
+// preauthWriteMsg writes a message, with an optional file descriptor.
+func preauthWriteMsg(uc *net.UnixConn, m preauthMsg, f *os.File) error {
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return err
+	} else if len(buf) > preauthMaxMsgSize {
+		return fmt.Errorf("message too large")
+	}
+	var oob []byte
+	if f != nil {
+		oob = syscall.UnixRights(int(f.Fd()))
+	}
+	_, _, err = uc.WriteMsgUnix(buf, oob, nil)
+	return err
+}
+
+// preauthReadMsg reads a message, and the file descriptor if it was sent with
+// the message.
+func preauthReadMsg(uc *net.UnixConn, buf []byte) (preauthMsg, *os.File, error) {
+	oob := make([]byte, syscall.CmsgSpace(4*4))
+	n, oobn, flags, _, err := uc.ReadMsgUnix(buf, oob)
+	if err != nil {
+		return preauthMsg{}, nil, err
+	} else if n == 0 && oobn == 0 {
+		return preauthMsg{}, nil, fmt.Errorf("connection closed")
+	}
+
+	var files []*os.File
+	if oobn > 0 {
+		scms, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			return preauthMsg{}, nil, fmt.Errorf("parsing socket control message: %v", err)
+		}
+		for _, scm := range scms {
+			fds, err := syscall.ParseUnixRights(&scm)
+			if err != nil {
+				return preauthMsg{}, nil, fmt.Errorf("parsing unix rights: %v", err)
+			}
+			for _, fd := range fds {
+				syscall.CloseOnExec(fd)
+				files = append(files, os.NewFile(uintptr(fd), "preauth"))
+			}
+		}
+	}
+	closeFiles := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+
+	if flags&(syscall.MSG_TRUNC|syscall.MSG_CTRUNC) != 0 {
+		closeFiles()
+		return preauthMsg{}, nil, fmt.Errorf("message truncated")
+	} else if len(files) > 1 {
+		closeFiles()
+		return preauthMsg{}, nil, fmt.Errorf("multiple file descriptors in message")
+	}
+	var m preauthMsg
+	if err := json.Unmarshal(buf[:n], &m); err != nil {
+		closeFiles()
+		return preauthMsg{}, nil, fmt.Errorf("parsing message: %v", err)
+	}
+	var f *os.File
+	if len(files) == 1 {
+		f = files[0]
+	}
+	return m, f, nil
+}
+
+// preauthSocketpair returns a pair of connected stream sockets, for handing off a
+// connection.
+func preauthSocketpair() (*os.File, *os.File, error) {
+	syscall.ForkLock.RLock()
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err == nil {
+		syscall.CloseOnExec(fds[0])
+		syscall.CloseOnExec(fds[1])
+	}
+	syscall.ForkLock.RUnlock()
+	if err != nil {
+		return nil, nil, err
+	}
+	return os.NewFile(uintptr(fds[0]), "handoff0"), os.NewFile(uintptr(fds[1]), "handoff1"), nil
+}
@@ -0,0 +1,25 @@
+package imapserver
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+var errPreauthUnsupported = errors.New("preauth process not supported on windows")
+
+func preauthFileConn(f *os.File) (*net.UnixConn, error) {
+	return nil, errPreauthUnsupported
+}
+
+func preauthWriteMsg(uc *net.UnixConn, m preauthMsg, f *os.File) error {
+	return errPreauthUnsupported
+}
+
+func preauthReadMsg(uc *net.UnixConn, buf []byte) (preauthMsg, *os.File, error) {
+	return preauthMsg{}, nil, errPreauthUnsupported
+}
+
+func preauthSocketpair() (*os.File, *os.File, error) {
+	return nil, nil, errPreauthUnsupported
+}
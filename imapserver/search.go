@@ -637,26 +637,30 @@ func (c *conn) searchMatch(tx *bstore.Tx, msgCount uint32, seq msgseq, m store.M
 func (s *search) match(sk searchKey, bodySearch, textSearch *store.WordSearch) (match bool) {
 	match = s.match0(sk)
 	if match && bodySearch != nil {
-		if !s.xensurePart() {
-			match = false
-			return
-		}
-		var err error
-		match, err = bodySearch.MatchPart(s.c.log, s.p, false)
-		xcheckf(err, "search words in bodies")
+		match = s.matchWords(bodySearch, false)
 	}
 	if match && textSearch != nil {
-		if !s.xensurePart() {
-			match = false
-			return
-		}
-		var err error
-		match, err = textSearch.MatchPart(s.c.log, s.p, true)
-		xcheckf(err, "search words in headers and bodies")
+		match = s.matchWords(textSearch, true)
 	}
 	return
 }
 
+// matchWords matches a word search using the full-text search index, falling back
+// to reading the message if the index cannot give an answer.
+func (s *search) matchWords(ws *store.WordSearch, headerToo bool) bool {
+	match, indexed, err := ws.MatchIndex(s.tx, s.m.ID, headerToo)
+	xcheckf(err, "search words in index")
+	if indexed {
+		return match
+	}
+	if !s.xensurePart() {
+		return false
+	}
+	match, err = ws.MatchPart(s.c.log, s.p, headerToo)
+	xcheckf(err, "search words in message")
+	return match
+}
+
 // ensure message, reader and part are loaded. returns whether that was
 // successful.
 func (s *search) xensurePart() bool {
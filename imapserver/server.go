@@ -45,7 +45,6 @@ import (
 	"io"
 	"log/slog"
 	"maps"
-	"math"
 	"net"
 	"os"
 	"path"
@@ -105,8 +104,16 @@ var (
 
 var unhandledPanics atomic.Int64 // For tests.
 
+// Default limiters, for listeners without configured limits.
 var limiterConnectionrate, limiterConnections *ratelimit.Limiter
 
+// Limiters for listeners with configured limits, by listener name.
+var listenerLimiters = map[string]connLimiters{}
+
+type connLimiters struct {
+	rate, open *ratelimit.Limiter
+}
+
 func init() {
 	// Also called by tests, so they don't trigger the rate limiter.
 	limitersInit()
@@ -114,22 +121,43 @@ func init() {
 
 func limitersInit() {
 	mox.LimitersInit()
-	limiterConnectionrate = &ratelimit.Limiter{
-		WindowLimits: []ratelimit.WindowLimit{
-			{
-				Window: time.Minute,
-				Limits: [...]int64{300, 900, 2700},
-			},
+	limiterConnectionrate = mox.NewLimiter(nil, []ratelimit.WindowLimit{
+		{
+			Window: time.Minute,
+			Limits: [...]int64{300, 900, 2700},
 		},
+	})
+	limiterConnections = mox.NewOpenLimiter(nil, [...]int64{30, 90, 270})
+	mox.RegisterLimiter("imap-connectionrate", limiterConnectionrate, true)
+	mox.RegisterOpenLimiter("imap-connections", limiterConnections)
+	listenerLimiters = map[string]connLimiters{}
+}
+
+// listenerLimitersInit initializes limiters for a listener with configured
+// limits.
+func listenerLimitersInit(listenerName string, cl *config.ConnectionLimits) {
+	if cl == nil {
+		return
 	}
-	limiterConnections = &ratelimit.Limiter{
-		WindowLimits: []ratelimit.WindowLimit{
-			{
-				Window: time.Duration(math.MaxInt64), // All of time.
-				Limits: [...]int64{30, 90, 270},
-			},
-		},
+	ll := connLimiters{limiterConnectionrate, limiterConnections}
+	if len(cl.Rate) > 0 {
+		ll.rate = mox.NewLimiter(cl.Rate, nil)
+		mox.RegisterLimiter("imap-connectionrate-"+listenerName, ll.rate, true)
+	}
+	if cl.Open != nil {
+		ll.open = mox.NewOpenLimiter(cl.Open, [3]int64{})
+		mox.RegisterOpenLimiter("imap-connections-"+listenerName, ll.open)
+	}
+	listenerLimiters[listenerName] = ll
+}
+
+// limiters returns the limiters on connection rate and open connections for a
+// listener.
+func limiters(listenerName string) (rate, open *ratelimit.Limiter) {
+	if ll, ok := listenerLimiters[listenerName]; ok {
+		return ll.rate, ll.open
 	}
+	return limiterConnectionrate, limiterConnections
 }
 
 // Delay after bad/suspicious behaviour. Tests set these to zero.
@@ -198,6 +226,8 @@ type conn struct {
 	tls               bool // Whether TLS has been initialized.
 	viaHTTPS          bool // Whether this connection came in via HTTPS (using TLS ALPN).
 	noTLSClientAuth   bool
+	listenerName      string
+	preauth           *preauthConn       // In the preauth process, for authenticating through the main process.
 	br                *bufio.Reader      // From remote, with TLS unwrapped in case of TLS, and possibly wrapping inflate.
 	tr                *moxio.TraceReader // Kept to change trace level when reading/writing cmd/auth/data.
 	line              chan lineErr       // If set, instead of reading from br, a line is read from this channel. For reading a line in IDLE while also waiting for mailbox/account updates.
@@ -382,9 +412,13 @@ type msgseq uint32
 
 // Listen initializes all imap listeners for the configuration, and stores them for Serve to start them.
 func Listen() {
+	// Limiters with the loaded config.
+	limitersInit()
+
 	names := slices.Sorted(maps.Keys(mox.Conf.Static.Listeners))
 	for _, name := range names {
 		listener := mox.Conf.Static.Listeners[name]
+		listenerLimitersInit(name, listener.RateLimits.IMAP)
 
 		var tlsConfig *tls.Config
 		var noTLSClientAuth bool
@@ -414,13 +448,18 @@ var servers []func()
 func listen1(protocol, listenerName, ip string, port int, tlsConfig *tls.Config, xtls, noTLSClientAuth, noRequireSTARTTLS bool) {
 	log := mlog.New("imapserver", nil)
 	addr := net.JoinHostPort(ip, fmt.Sprintf("%d", port))
+	network := mox.Network(ip)
+	if mox.Conf.Static.PreauthUser != "" {
+		// Unauthenticated connections are handled by the preauth process.
+		preauthListen(log, protocol, listenerName, network, addr, tlsConfig, xtls, noRequireSTARTTLS)
+		return
+	}
 	if os.Getuid() == 0 {
 		log.Print("listening for imap",
 			slog.String("listener", listenerName),
 			slog.String("addr", addr),
 			slog.String("protocol", protocol))
 	}
-	network := mox.Network(ip)
 	ln, err := mox.Listen(network, addr)
 	if err != nil {
 		log.Fatalx("imap: listen for imap", err, slog.String("protocol", protocol), slog.String("listener", listenerName))
@@ -444,7 +483,7 @@ func listen1(protocol, listenerName, ip string, port int, tlsConfig *tls.Config,
 			}
 
 			metricIMAPConnection.WithLabelValues(protocol).Inc()
-			go serve(listenerName, mox.Cid(), tlsConfig, conn, xtls, noTLSClientAuth, noRequireSTARTTLS, false, "")
+			go serve(listenerName, mox.Cid(), tlsConfig, conn, xtls, noTLSClientAuth, noRequireSTARTTLS, false, "", nil, nil)
 		}
 	}
 
@@ -453,11 +492,11 @@ func listen1(protocol, listenerName, ip string, port int, tlsConfig *tls.Config,
 
 // ServeTLSConn serves IMAP on a TLS connection.
 func ServeTLSConn(listenerName string, conn *tls.Conn, tlsConfig *tls.Config) {
-	serve(listenerName, mox.Cid(), tlsConfig, conn, true, true, false, true, "")
+	serve(listenerName, mox.Cid(), tlsConfig, conn, true, true, false, true, "", nil, nil)
 }
 
 func ServeConnPreauth(listenerName string, cid int64, conn net.Conn, preauthAddress string) {
-	serve(listenerName, cid, nil, conn, false, true, true, false, preauthAddress)
+	serve(listenerName, cid, nil, conn, false, true, true, false, preauthAddress, nil, nil)
 }
 
 // Serve starts serving on all listeners, launching a goroutine per listener.
@@ -466,6 +505,10 @@ func Serve() {
 		go serve()
 	}
 	servers = nil
+
+	if len(preauthListeners) > 0 {
+		go servePreauthMain()
+	}
 }
 
 // Logbg returns a logger for logging in the background (in a goroutine), eg for
@@ -770,15 +813,25 @@ var cleanClose struct{} // Sentinel value for panic/recover indicating clean clo
 // If accountAddress is not empty, it is the email address of the account to open
 // preauthenticated.
 //
+// If pa is set, we are the preauth process, serving a connection relayed by the
+// main process, and authenticate through the main process. If h is set, we are
+// the main process, serving a connection that was authenticated by the preauth
+// process.
+//
 // The connection is closed before returning.
-func serve(listenerName string, cid int64, tlsConfig *tls.Config, nc net.Conn, xtls, noTLSClientAuth, noRequireSTARTTLS, viaHTTPS bool, preauthAddress string) {
+func serve(listenerName string, cid int64, tlsConfig *tls.Config, nc net.Conn, xtls, noTLSClientAuth, noRequireSTARTTLS, viaHTTPS bool, preauthAddress string, pa *preauthConn, h *handoff) {
 	var remoteIP net.IP
-	if a, ok := nc.RemoteAddr().(*net.TCPAddr); ok {
+	if h != nil {
+		remoteIP = h.remoteIP
+	} else if pa != nil {
+		remoteIP = pa.remoteIP
+	} else if a, ok := nc.RemoteAddr().(*net.TCPAddr); ok {
 		remoteIP = a.IP
 	} else {
 		// For tests and for imapserve.
 		remoteIP = net.ParseIP("127.0.0.10")
 	}
+	rateLimiter, openLimiter := limiters(listenerName)
 
 	c := &conn{
 		cid:               cid,
@@ -786,6 +839,8 @@ func serve(listenerName string, cid int64, tlsConfig *tls.Config, nc net.Conn, x
 		tls:               xtls,
 		viaHTTPS:          viaHTTPS,
 		noTLSClientAuth:   noTLSClientAuth,
+		listenerName:      listenerName,
+		preauth:           pa,
 		lastlog:           time.Now(),
 		baseTLSConfig:     tlsConfig,
 		remoteIP:          remoteIP,
@@ -831,12 +886,26 @@ func serve(listenerName string, cid int64, tlsConfig *tls.Config, nc net.Conn, x
 		}
 	}
 
-	c.log.Info("new connection",
-		slog.Any("remote", c.conn.RemoteAddr()),
-		slog.Any("local", c.conn.LocalAddr()),
-		slog.Bool("tls", xtls),
-		slog.Bool("viahttps", viaHTTPS),
-		slog.String("listener", listenerName))
+	if h != nil {
+		c.log.Info("new connection from preauth process",
+			slog.String("remote", h.remoteAddr),
+			slog.Int64("preauthcid", h.preauthCid),
+			slog.Bool("tls", xtls),
+			slog.String("listener", listenerName))
+	} else if pa != nil {
+		c.log.Info("new connection",
+			slog.String("remote", pa.remoteAddr),
+			slog.String("local", pa.localAddr),
+			slog.Bool("tls", xtls),
+			slog.String("listener", listenerName))
+	} else {
+		c.log.Info("new connection",
+			slog.Any("remote", c.conn.RemoteAddr()),
+			slog.Any("local", c.conn.LocalAddr()),
+			slog.Bool("tls", xtls),
+			slog.Bool("viahttps", viaHTTPS),
+			slog.String("listener", listenerName))
+	}
 
 	defer func() {
 		err := c.conn.Close()
@@ -869,7 +938,33 @@ func serve(listenerName string, cid int64, tlsConfig *tls.Config, nc net.Conn, x
 		}
 	}()
 
-	if xtls && !viaHTTPS {
+	if h != nil {
+		// Authenticated in the preauth process, which already did the TLS handshake and
+		// checked the connection rate and authentication failures.
+		c.username = h.username
+		c.account = h.account
+		c.comm = store.RegisterComm(c.account)
+		c.userAgent = h.userAgent
+		c.state = stateAuthenticated
+
+		if !openLimiter.Add(c.remoteIP, time.Now(), 1) {
+			c.log.Debug("refusing connection due to many open connections", slog.Any("remoteip", c.remoteIP))
+			c.xwritelinef("* BYE too many open connections from your ip or network")
+			return
+		}
+		defer openLimiter.Add(c.remoteIP, time.Now(), -1)
+
+		mox.Connections.Register(nc, "imap", listenerName)
+		defer mox.Connections.Unregister(nc)
+
+		c.xwritelinef("%s OK [CAPABILITY %s] %s done", h.tag, c.capabilities(), h.cmd)
+		for {
+			c.command()
+			c.xflush()
+		}
+	}
+
+	if xtls && !viaHTTPS && pa == nil {
 		// Start TLS on connection. We perform the handshake explicitly, so we can set a
 		// timeout, do client certificate authentication, log TLS details afterwards.
 		c.xtlsHandshakeAndAuthenticate(c.conn)
@@ -883,25 +978,14 @@ func serve(listenerName string, cid int64, tlsConfig *tls.Config, nc net.Conn, x
 	default:
 	}
 
-	if !limiterConnectionrate.Add(c.remoteIP, time.Now(), 1) {
-		c.xwritelinef("* BYE connection rate from your ip or network too high, slow down please")
-		return
-	}
-
-	// If remote IP/network resulted in too many authentication failures, refuse to serve.
-	if !mox.LimiterFailedAuth.CanAdd(c.remoteIP, time.Now(), 1) {
-		metrics.AuthenticationRatelimitedInc("imap")
-		c.log.Debug("refusing connection due to many auth failures", slog.Any("remoteip", c.remoteIP))
-		c.xwritelinef("* BYE too many auth failures")
-		return
-	}
-
-	if !limiterConnections.Add(c.remoteIP, time.Now(), 1) {
-		c.log.Debug("refusing connection due to many open connections", slog.Any("remoteip", c.remoteIP))
-		c.xwritelinef("* BYE too many open connections from your ip or network")
-		return
+	// For the preauth process, the main process enforces bans and limits.
+	if pa == nil {
+		if msg := connectionRefused(c.log, c.remoteIP, rateLimiter, openLimiter); msg != "" {
+			c.xwritelinef("* BYE %s", msg)
+			return
+		}
+		defer openLimiter.Add(c.remoteIP, time.Now(), -1)
 	}
-	defer limiterConnections.Add(c.remoteIP, time.Now(), -1)
 
 	// We register and unregister the original connection, in case it c.conn is
 	// replaced with a TLS connection later on.
@@ -950,6 +1034,34 @@ func serve(listenerName string, cid int64, tlsConfig *tls.Config, nc net.Conn, x
 	}
 }
 
+// connectionRefused returns the reason for refusing a new connection from a banned
+// IP or an IP over its limits, for a "* BYE" response. If the connection is
+// allowed, it is counted as open and must be released with openLimiter.Add with
+// -1.
+func connectionRefused(log mlog.Log, remoteIP net.IP, rateLimiter, openLimiter *ratelimit.Limiter) string {
+	if store.IPBanned(remoteIP) {
+		log.Debug("refusing connection from banned ip", slog.Any("remoteip", remoteIP))
+		return "your ip or network is banned"
+	}
+
+	if !rateLimiter.Add(remoteIP, time.Now(), 1) {
+		return "connection rate from your ip or network too high, slow down please"
+	}
+
+	// If remote IP/network resulted in too many authentication failures, refuse to serve.
+	if !mox.LimiterFailedAuth.CanAdd(remoteIP, time.Now(), 1) {
+		metrics.AuthenticationRatelimitedInc("imap")
+		log.Debug("refusing connection due to many auth failures", slog.Any("remoteip", remoteIP))
+		return "too many auth failures"
+	}
+
+	if !openLimiter.Add(remoteIP, time.Now(), 1) {
+		log.Debug("refusing connection due to many open connections", slog.Any("remoteip", remoteIP))
+		return "too many open connections from your ip or network"
+	}
+	return ""
+}
+
 // isClosed returns whether i/o failed, typically because the connection is closed.
 // For connection errors, we often want to generate fewer logs.
 func isClosed(err error) bool {
@@ -2414,7 +2526,7 @@ func (c *conn) capabilities() string {
 	} else {
 		caps += " LOGINDISABLED"
 	}
-	if c.tls && len(c.conn.(*tls.Conn).ConnectionState().PeerCertificates) > 0 && !c.viaHTTPS && !c.noTLSClientAuth {
+	if c.tls && !c.viaHTTPS && !c.noTLSClientAuth && len(c.conn.(*tls.Conn).ConnectionState().PeerCertificates) > 0 {
 		caps += " AUTH=EXTERNAL"
 	}
 	return caps
@@ -2574,6 +2686,11 @@ func (c *conn) cmdStarttls(tag, cmd string, p *parser) {
 		xsyntaxErrorf("starttls not announced")
 	}
 
+	if c.preauth != nil {
+		c.xpreauthStarttls(tag, cmd)
+		return
+	}
+
 	conn := xprefixConn(c.conn, c.br)
 	// We add the cid to facilitate debugging in case of TLS connection failure.
 	c.ok(tag, cmd+" ("+mox.ReceivedID(c.cid)+")")
@@ -2597,6 +2714,11 @@ func (c *conn) cmdAuthenticate(tag, cmd string, p *parser) {
 	// Command: ../rfc/9051:1403 ../rfc/3501:1519
 	// Examples: ../rfc/9051:1520 ../rfc/3501:1631
 
+	if c.preauth != nil {
+		c.cmdPreauthAuthenticate(tag, cmd, p)
+		return
+	}
+
 	// For many failed auth attempts, slow down verification attempts.
 	if c.authFailed > 3 && authFailDelay > 0 {
 		mox.Sleep(mox.Context, time.Duration(c.authFailed-3)*authFailDelay)
@@ -2710,7 +2832,7 @@ func (c *conn) cmdAuthenticate(tag, cmd string, p *parser) {
 		}
 
 		var err error
-		account, c.loginAttempt.AccountName, err = store.OpenEmailAuth(c.log, username, password, false)
+		account, c.loginAttempt.AccountName, c.loginAttempt.AppPasswordName, err = store.OpenEmailAuthProtocol(c.log, username, password, store.AppPasswordIMAP, c.remoteIP, false)
 		if err != nil {
 			if errors.Is(err, store.ErrUnknownCredentials) {
 				c.loginAttempt.Result = store.AuthBadCredentials
@@ -2748,39 +2870,29 @@ func (c *conn) cmdAuthenticate(tag, cmd string, p *parser) {
 			}
 			xserverErrorf("looking up address: %v", err)
 		}
-		var ipadhash, opadhash hash.Hash
+		// Secrets of the main password and of app passwords allowed for imap.
+		var secrets []store.AuthSecret
 		account.WithRLock(func() {
 			err := account.DB.Read(context.TODO(), func(tx *bstore.Tx) error {
-				password, err := bstore.QueryTx[store.Password](tx).Get()
-				if err == bstore.ErrAbsent {
-					c.log.Info("failed authentication attempt", slog.String("username", username), slog.Any("remote", c.remoteIP))
-					xusercodeErrorf("AUTHENTICATIONFAILED", "bad credentials")
-				}
-				if err != nil {
-					return err
-				}
-
-				ipadhash = password.CRAMMD5.Ipad
-				opadhash = password.CRAMMD5.Opad
-				return nil
+				var err error
+				secrets, err = store.AuthSecrets(tx, store.AppPasswordIMAP, c.remoteIP)
+				return err
 			})
 			xcheckf(err, "tx read")
 		})
-		if ipadhash == nil || opadhash == nil {
+		if len(secrets) > 0 && secrets[0].AppPasswordID == 0 && (secrets[0].CRAMMD5.Ipad == nil || secrets[0].CRAMMD5.Opad == nil) {
 			c.log.Info("cram-md5 auth attempt without derived secrets set, save password again to store secrets", slog.String("username", username))
-			c.log.Info("failed authentication attempt", slog.String("username", username), slog.Any("remote", c.remoteIP))
 			missingDerivedSecrets = true
-			xusercodeErrorf("AUTHENTICATIONFAILED", "bad credentials")
 		}
-
-		// ../rfc/2195:138 ../rfc/2104:142
-		ipadhash.Write([]byte(chal))
-		opadhash.Write(ipadhash.Sum(nil))
-		digest := fmt.Sprintf("%x", opadhash.Sum(nil))
-		if digest != t[1] {
+		match := store.CRAMMD5Match(secrets, chal, t[1])
+		if match == nil {
 			c.log.Info("failed authentication attempt", slog.String("username", username), slog.Any("remote", c.remoteIP))
 			xusercodeErrorf("AUTHENTICATIONFAILED", "bad credentials")
 		}
+		if match.AppPasswordID != 0 {
+			c.loginAttempt.AppPasswordName = match.AppPasswordName
+			account.AppPasswordUsed(c.log, match.AppPasswordID, store.AppPasswordIMAP, c.remoteIP)
+		}
 
 	case "SCRAM-SHA-256-PLUS", "SCRAM-SHA-256", "SCRAM-SHA-1-PLUS", "SCRAM-SHA-1":
 		// todo: improve handling of errors during scram. e.g. invalid parameters. should we abort the imap command, or continue until the end and respond with a scram-level error?
@@ -2790,11 +2902,14 @@ func (c *conn) cmdAuthenticate(tag, cmd string, p *parser) {
 
 		c.loginAttempt.AuthMech = strings.ToLower(authType)
 		var h func() hash.Hash
+		var variant string
 		switch c.loginAttempt.AuthMech {
 		case "scram-sha-1", "scram-sha-1-plus":
 			h = sha1.New
+			variant = "sha1"
 		case "scram-sha-256", "scram-sha-256-plus":
 			h = sha256.New
+			variant = "sha256"
 		default:
 			xserverErrorf("missing case for scram variant")
 		}
@@ -2828,37 +2943,31 @@ func (c *conn) cmdAuthenticate(tag, cmd string, p *parser) {
 		if ss.Authorization != "" && ss.Authorization != username {
 			xuserErrorf("authentication with authorization for different user not supported")
 		}
-		var xscram store.SCRAM
+		// Secrets of the main password and of app passwords allowed for imap.
+		var secrets []store.AuthSecret
 		account.WithRLock(func() {
 			err := account.DB.Read(context.TODO(), func(tx *bstore.Tx) error {
-				password, err := bstore.QueryTx[store.Password](tx).Get()
-				if err == bstore.ErrAbsent {
-					c.log.Info("failed authentication attempt", slog.String("username", username), slog.Any("remote", c.remoteIP))
-					xusercodeErrorf("AUTHENTICATIONFAILED", "bad credentials")
-				}
-				xcheckf(err, "fetching credentials")
-				switch c.loginAttempt.AuthMech {
-				case "scram-sha-1", "scram-sha-1-plus":
-					xscram = password.SCRAMSHA1
-				case "scram-sha-256", "scram-sha-256-plus":
-					xscram = password.SCRAMSHA256
-				default:
-					xserverErrorf("missing case for scram credentials")
-				}
-				if len(xscram.Salt) == 0 || xscram.Iterations == 0 || len(xscram.SaltedPassword) == 0 {
-					missingDerivedSecrets = true
-					c.log.Info("scram auth attempt without derived secrets set, save password again to store secrets", slog.String("username", username))
-					xuserErrorf("scram not possible")
-				}
-				return nil
+				var err error
+				secrets, err = store.AuthSecrets(tx, store.AppPasswordIMAP, c.remoteIP)
+				return err
 			})
 			xcheckf(err, "read tx")
 		})
-		s1, err := ss.ServerFirst(xscram.Iterations, xscram.Salt)
+		if len(secrets) == 0 {
+			c.log.Info("failed authentication attempt", slog.String("username", username), slog.Any("remote", c.remoteIP))
+			xusercodeErrorf("AUTHENTICATIONFAILED", "bad credentials")
+		}
+		salt, iterations, saltedPasswords, candidates := store.SCRAMCandidates(secrets, variant)
+		if salt == nil {
+			missingDerivedSecrets = true
+			c.log.Info("scram auth attempt without derived secrets set, save password again to store secrets", slog.String("username", username))
+			xuserErrorf("scram not possible")
+		}
+		s1, err := ss.ServerFirst(iterations, salt)
 		xcheckf(err, "scram first server step")
 		c.xwritelinef("+ %s", base64.StdEncoding.EncodeToString([]byte(s1)))
 		c2 := xreadContinuation()
-		s3, err := ss.Finish(c2, xscram.SaltedPassword)
+		s3, index, err := ss.FinishMulti(c2, saltedPasswords)
 		if len(s3) > 0 {
 			c.xwritelinef("+ %s", base64.StdEncoding.EncodeToString([]byte(s3)))
 		}
@@ -2879,6 +2988,10 @@ func (c *conn) cmdAuthenticate(tag, cmd string, p *parser) {
 			}
 			xuserErrorf("server final: %w", err)
 		}
+		if match := candidates[index]; match.AppPasswordID != 0 {
+			c.loginAttempt.AppPasswordName = match.AppPasswordName
+			account.AppPasswordUsed(c.log, match.AppPasswordID, store.AppPasswordIMAP, c.remoteIP)
+		}
 
 		// Client must still respond, but there is nothing to say. See ../rfc/9051:6221
 		// The message should be empty. todo: should we require it is empty?
@@ -2967,6 +3080,11 @@ func (c *conn) cmdAuthenticate(tag, cmd string, p *parser) {
 func (c *conn) cmdLogin(tag, cmd string, p *parser) {
 	// Command: ../rfc/9051:1597 ../rfc/3501:1663
 
+	if c.preauth != nil {
+		c.cmdPreauthLogin(tag, cmd, p)
+		return
+	}
+
 	c.newLoginAttempt(true, "login")
 	defer func() {
 		if c.loginAttempt.Result == store.AuthSuccess {
@@ -3004,8 +3122,9 @@ func (c *conn) cmdLogin(tag, cmd string, p *parser) {
 		}
 	}()
 
-	account, accName, err := store.OpenEmailAuth(c.log, username, password, true)
+	account, accName, appPasswordName, err := store.OpenEmailAuthProtocol(c.log, username, password, store.AppPasswordIMAP, c.remoteIP, true)
 	c.loginAttempt.AccountName = accName
+	c.loginAttempt.AppPasswordName = appPasswordName
 	if err != nil {
 		var code string
 		if errors.Is(err, store.ErrUnknownCredentials) {
@@ -4035,7 +4154,7 @@ func (c *conn) cmdAppend(tag, cmd string, p *parser) {
 				du := store.DiskUsage{ID: 1}
 				err := tx.Get(&du)
 				xcheckf(err, "get quota disk usage")
-				quotaAvail = quotaMsgMax - du.MessageSize
+				quotaAvail = quotaMsgMax - du.MessageSize - du.DAVSize
 			})
 		})
 	}
@@ -4349,7 +4468,7 @@ func (c *conn) cmdGetquotaroot(tag, cmd string, p *parser) {
 				du := store.DiskUsage{ID: 1}
 				err := tx.Get(&du)
 				xcheckf(err, "gather used quota")
-				size = du.MessageSize
+				size = du.MessageSize + du.DAVSize
 			})
 		}
 	})
@@ -4391,7 +4510,7 @@ func (c *conn) cmdGetquota(tag, cmd string, p *parser) {
 				du := store.DiskUsage{ID: 1}
 				err := tx.Get(&du)
 				xcheckf(err, "gather used quota")
-				size = du.MessageSize
+				size = du.MessageSize + du.DAVSize
 			})
 		}
 	})
@@ -4818,6 +4937,9 @@ func (c *conn) cmdxCopy(isUID bool, tag, cmd string, p *parser) {
 					xcheckf(err, "inserting message recipient")
 				}
 
+				err = store.SearchIndexCopy(tx, origID, m.ID)
+				xcheckf(err, "copying search index entries")
+
 				mbDst.Add(m.MailboxCounts())
 			}
 
@@ -5010,7 +5132,7 @@ func (c *conn) xmoveMessages(tx *bstore.Tx, q *bstore.Query[store.Message], expe
 	mbSrc.ModSeq = modseq
 	mbDst.ModSeq = modseq
 
-	var jf *junk.Filter
+	var jf junk.Classifier
 	defer func() {
 		if jf != nil {
 			err := jf.CloseDiscard()
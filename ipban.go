@@ -0,0 +1,139 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+func cmdIPBanList(c *cmd) {
+	c.help = `List IPs and networks that are currently banned.
+
+IPs are banned automatically after repeated failed authentication attempts,
+see IPBans in mox.conf, or manually with "mox ipban add". Connections from
+banned IPs are refused by all listeners.
+`
+	if len(c.Parse()) != 0 {
+		c.Usage()
+	}
+	mustLoadConfig()
+	ctlcmdIPBanList(xctl())
+}
+
+func ctlcmdIPBanList(ctl *ctl) {
+	ctl.xwrite("ipbanlist")
+	ctl.xreadok()
+	if _, err := io.Copy(os.Stdout, ctl.reader()); err != nil {
+		log.Fatalf("%s", err)
+	}
+}
+
+func cmdIPBanAdd(c *cmd) {
+	c.params = "[-duration duration] [-reason text] ip-or-network"
+	c.help = `Ban an IP or network.
+
+The IP or network in CIDR notation, e.g. 192.0.2.1 or 2001:db8::/64. Without
+duration, the ban does not expire. An existing ban for the same network is
+replaced.
+`
+	var duration time.Duration
+	var reason string
+	c.flag.DurationVar(&duration, "duration", 0, "duration of ban, e.g. 24h, no expiration if 0")
+	c.flag.StringVar(&reason, "reason", "", "reason for ban, for display only")
+	args := c.Parse()
+	if len(args) != 1 {
+		c.Usage()
+	}
+	mustLoadConfig()
+	ctlcmdIPBanAdd(xctl(), args[0], duration, reason)
+}
+
+func ctlcmdIPBanAdd(ctl *ctl, ipnet string, duration time.Duration, reason string) {
+	ctl.xwrite("ipbanadd")
+	ctl.xwrite(ipnet)
+	ctl.xwrite(duration.String())
+	ctl.xwrite(reason)
+	ctl.xreadok()
+}
+
+func cmdIPBanRemove(c *cmd) {
+	c.params = "ip-or-network"
+	c.help = `Remove ban for IP or network.
+
+The IP or network must match an existing ban exactly. Removing a ban also resets
+the escalating duration for a next automatic ban.
+`
+	args := c.Parse()
+	if len(args) != 1 {
+		c.Usage()
+	}
+	mustLoadConfig()
+	ctlcmdIPBanRemove(xctl(), args[0])
+}
+
+func ctlcmdIPBanRemove(ctl *ctl, ipnet string) {
+	ctl.xwrite("ipbanremove")
+	ctl.xwrite(ipnet)
+	ctl.xreadok()
+}
+
+func cmdIPBanAllowlistList(c *cmd) {
+	c.help = `List IPs and networks that are never banned.
+
+IPs in RateLimitAllowlist in mox.conf are never banned either.
+`
+	if len(c.Parse()) != 0 {
+		c.Usage()
+	}
+	mustLoadConfig()
+	ctlcmdIPBanAllowlistList(xctl())
+}
+
+func ctlcmdIPBanAllowlistList(ctl *ctl) {
+	ctl.xwrite("ipbanallowlistlist")
+	ctl.xreadok()
+	if _, err := io.Copy(os.Stdout, ctl.reader()); err != nil {
+		log.Fatalf("%s", err)
+	}
+}
+
+func cmdIPBanAllowlistAdd(c *cmd) {
+	c.params = "[-comment text] ip-or-network"
+	c.help = `Add IP or network to allowlist for bans.
+
+Existing bans covered by the network are no longer enforced.
+`
+	var comment string
+	c.flag.StringVar(&comment, "comment", "", "comment, e.g. describing the hosts, for display only")
+	args := c.Parse()
+	if len(args) != 1 {
+		c.Usage()
+	}
+	mustLoadConfig()
+	ctlcmdIPBanAllowlistAdd(xctl(), args[0], comment)
+}
+
+func ctlcmdIPBanAllowlistAdd(ctl *ctl, ipnet, comment string) {
+	ctl.xwrite("ipbanallowlistadd")
+	ctl.xwrite(ipnet)
+	ctl.xwrite(comment)
+	ctl.xreadok()
+}
+
+func cmdIPBanAllowlistRemove(c *cmd) {
+	c.params = "ip-or-network"
+	c.help = `Remove IP or network from allowlist for bans.`
+	args := c.Parse()
+	if len(args) != 1 {
+		c.Usage()
+	}
+	mustLoadConfig()
+	ctlcmdIPBanAllowlistRemove(xctl(), args[0])
+}
+
+func ctlcmdIPBanAllowlistRemove(ctl *ctl, ipnet string) {
+	ctl.xwrite("ipbanallowlistremove")
+	ctl.xwrite(ipnet)
+	ctl.xreadok()
+}
@@ -0,0 +1,129 @@
+package junk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/message"
+)
+
+// Classifier trains on messages and classifies them as ham or spam. Filter
+// classifies based on words only. Combined classifies based on words and feature
+// tokens describing the structure of a message.
+type Classifier interface {
+	// ParseMessage returns the tokens for a message, used for training and
+	// classifying.
+	ParseMessage(p message.Part) (map[string]struct{}, error)
+
+	ClassifyWords(ctx context.Context, words map[string]struct{}) (Result, error)
+	ClassifyMessage(ctx context.Context, m message.Part) (Result, error)
+	ClassifyMessageReader(ctx context.Context, mf io.ReaderAt, size int64) (Result, error)
+	ClassifyMessagePath(ctx context.Context, path string) (Result, error)
+
+	Train(ctx context.Context, ham bool, words map[string]struct{}) error
+	Untrain(ctx context.Context, ham bool, words map[string]struct{}) error
+	TrainMessage(ctx context.Context, r io.ReaderAt, size int64, ham bool) error
+	UntrainMessage(ctx context.Context, r io.ReaderAt, size int64, ham bool) error
+
+	Save() error
+	Close() error
+	CloseDiscard() error
+
+	// DB returns the database, for backups.
+	DB() *bstore.DB
+}
+
+var _ Classifier = (*Filter)(nil)
+var _ Classifier = (*Combined)(nil)
+
+// Combined is a classifier that uses both the words of a message, like Filter,
+// and feature tokens as returned by FeatureTokens. Tokens are stored in the same
+// database as words. A database trained with Filter can be used with Combined,
+// but classifications only improve after training with feature tokens.
+type Combined struct {
+	*Filter
+}
+
+// NewCombined returns a classifier using words and message features, with f
+// for storage.
+func NewCombined(f *Filter) *Combined {
+	return &Combined{f}
+}
+
+// ParseMessage returns both the words and the feature tokens for a message.
+func (c *Combined) ParseMessage(p message.Part) (map[string]struct{}, error) {
+	words, err := c.Filter.ParseMessage(p)
+	if err != nil {
+		return nil, err
+	}
+	features, err := FeatureTokens(p)
+	if err != nil {
+		return nil, fmt.Errorf("parsing message features: %v", err)
+	}
+	maps.Copy(words, features)
+	return words, nil
+}
+
+// ClassifyMessagePath is a convenience wrapper for calling ClassifyMessage on a file.
+func (c *Combined) ClassifyMessagePath(ctx context.Context, path string) (Result, error) {
+	if c.closed {
+		return Result{}, errClosed
+	}
+
+	mf, err := os.Open(path)
+	if err != nil {
+		return Result{}, err
+	}
+	defer func() {
+		err := mf.Close()
+		c.log.Check(err, "closing file after classify")
+	}()
+	fi, err := mf.Stat()
+	if err != nil {
+		return Result{}, err
+	}
+	return c.ClassifyMessageReader(ctx, mf, fi.Size())
+}
+
+func (c *Combined) ClassifyMessageReader(ctx context.Context, mf io.ReaderAt, size int64) (Result, error) {
+	m, err := message.EnsurePart(c.log.Logger, false, mf, size)
+	if err != nil && errors.Is(err, message.ErrBadContentType) {
+		// Invalid content-type header is a sure sign of spam.
+		return Result{Probability: 1, Significant: true}, nil
+	}
+	return c.ClassifyMessage(ctx, m)
+}
+
+// ClassifyMessage parses the mail message and returns the spam probability based
+// on its words and features.
+func (c *Combined) ClassifyMessage(ctx context.Context, m message.Part) (Result, error) {
+	words, err := c.ParseMessage(m)
+	if err != nil {
+		return Result{}, err
+	}
+	return c.ClassifyWords(ctx, words)
+}
+
+func (c *Combined) TrainMessage(ctx context.Context, r io.ReaderAt, size int64, ham bool) error {
+	p, _ := message.EnsurePart(c.log.Logger, false, r, size)
+	words, err := c.ParseMessage(p)
+	if err != nil {
+		return fmt.Errorf("parsing mail contents: %v", err)
+	}
+	return c.Train(ctx, ham, words)
+}
+
+func (c *Combined) UntrainMessage(ctx context.Context, r io.ReaderAt, size int64, ham bool) error {
+	p, _ := message.EnsurePart(c.log.Logger, false, r, size)
+	words, err := c.ParseMessage(p)
+	if err != nil {
+		return fmt.Errorf("parsing mail contents: %v", err)
+	}
+	return c.Untrain(ctx, ham, words)
+}
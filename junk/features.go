@@ -0,0 +1,349 @@
+package junk
+
+// Feature tokens describe the structure of a message, in addition to the words of
+// its text. Spam that consists mostly of images, links to URL shorteners, or
+// obfuscated HTML has few words to go on, but its structure often stands out.
+// Feature tokens start with "#", which cannot occur in words, and are trained and
+// classified like words.
+
+import (
+	"io"
+	"net/netip"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/mjl-/mox/message"
+)
+
+// Maximum number of bytes read from a text or HTML part for features.
+const maxFeaturePartSize = 1024 * 1024
+
+// Maximum number of distinct URL domains added as feature, per message.
+const maxURLDomains = 20
+
+// Domains of well-known URL shortening services. Spammers use them to hide
+// destinations of links.
+var urlShorteners = map[string]bool{
+	"bit.ly":      true,
+	"buff.ly":     true,
+	"cutt.ly":     true,
+	"goo.gl":      true,
+	"is.gd":       true,
+	"ow.ly":       true,
+	"rb.gy":       true,
+	"rebrand.ly":  true,
+	"shorturl.at": true,
+	"t.co":        true,
+	"t.ly":        true,
+	"tiny.cc":     true,
+	"tinyurl.com": true,
+	"v.gd":        true,
+}
+
+// Matches URLs in text, capturing the host.
+var urlRegexp = regexp.MustCompile(`(?i)\bhttps?://(?:[^\s/?#@<>"'\\]*@)?(\[[0-9a-f:.]+\]|[\p{L}\p{N}][-\p{L}\p{N}.]*)`)
+
+// bucket returns a coarse indication of a count, for use in a feature token.
+func bucket(n int) string {
+	switch {
+	case n == 0:
+		return "0"
+	case n == 1:
+		return "1"
+	case n <= 5:
+		return "2-5"
+	case n <= 20:
+		return "6-20"
+	default:
+		return "21+"
+	}
+}
+
+// features holds state while gathering feature tokens for a message.
+type features struct {
+	tokens     map[string]struct{}
+	urlDomains map[string]struct{}
+	urls       int
+	text, html bool // Whether message has text/plain and text/html parts.
+}
+
+func (fs *features) add(s string) {
+	if len(s) > bbolt.MaxKeySize {
+		return
+	}
+	fs.tokens[s] = struct{}{}
+}
+
+// addURL adds features for a link to a URL with host.
+func (fs *features) addURL(host string) {
+	fs.urls++
+	host = strings.ToLower(strings.TrimRight(host, ".-"))
+	if strings.HasPrefix(host, "[") {
+		fs.add("#url:ip")
+		return
+	}
+	if _, err := netip.ParseAddr(host); err == nil {
+		fs.add("#url:ip")
+		return
+	}
+	if urlShorteners[strings.TrimPrefix(host, "www.")] {
+		fs.add("#url:shortener")
+	}
+	if _, ok := fs.urlDomains[host]; !ok && len(fs.urlDomains) < maxURLDomains {
+		fs.urlDomains[host] = struct{}{}
+		fs.add("#url:" + host)
+	}
+}
+
+// FeatureTokens returns tokens describing the structure of the message: header
+// properties, domains of links, attachment types, HTML structure and
+// authentication results. The first Authentication-Results header is used, which
+// is the header added by mox during delivery.
+func FeatureTokens(p message.Part) (map[string]struct{}, error) {
+	fs := &features{
+		tokens:     map[string]struct{}{},
+		urlDomains: map[string]struct{}{},
+	}
+	if err := fs.headers(p); err != nil {
+		return nil, err
+	}
+	if err := fs.walk(p); err != nil {
+		return nil, err
+	}
+	if fs.html && !fs.text {
+		fs.add("#html:only")
+	}
+	fs.add("#urls:" + bucket(fs.urls))
+	return fs.tokens, nil
+}
+
+// headers adds features from the message header.
+func (fs *features) headers(p message.Part) error {
+	hdrs, err := p.Header()
+	if err != nil {
+		return err
+	}
+
+	if ar := hdrs.Get("Authentication-Results"); ar != "" {
+		if r, err := message.ParseAuthResults(ar + "\r\n"); err == nil {
+			for _, m := range r.Methods {
+				switch m.Method {
+				case "spf", "dkim", "dmarc", "iprev":
+					fs.add("#auth:" + m.Method + "=" + m.Result)
+				}
+			}
+		} else {
+			fs.add("#auth:invalid")
+		}
+	}
+
+	msgID := hdrs.Get("Message-Id")
+	if msgID == "" {
+		fs.add("#hdr:no-message-id")
+	} else if _, dom, ok := strings.Cut(strings.Trim(strings.TrimSpace(msgID), "<>"), "@"); ok && dom != "" {
+		fs.add("#hdr:message-id-domain:" + strings.ToLower(dom))
+	}
+	if hdrs.Get("Date") == "" {
+		fs.add("#hdr:no-date")
+	}
+	if len(hdrs.Values("To")) == 0 && len(hdrs.Values("Cc")) == 0 {
+		fs.add("#hdr:no-to")
+	}
+	for _, k := range []string{"X-Mailer", "User-Agent"} {
+		// Only the name, e.g. "Thunderbird" for "Thunderbird/128.0", versions change often.
+		v := strings.TrimSpace(hdrs.Get(k))
+		if i := strings.IndexFunc(v, func(c rune) bool { return !unicode.IsLetter(c) && c != '-' }); i >= 0 {
+			v = v[:i]
+		}
+		if v != "" {
+			fs.add("#hdr:mailer:" + strings.ToLower(v))
+		}
+	}
+	if hdrs.Get("List-Unsubscribe") != "" {
+		fs.add("#hdr:list-unsubscribe")
+	}
+	if v := strings.ToLower(strings.TrimSpace(hdrs.Get("Precedence"))); v != "" {
+		fs.add("#hdr:precedence:" + v)
+	}
+
+	if env := p.Envelope; env != nil {
+		if len(env.From) != 1 {
+			fs.add("#hdr:from-count:" + bucket(len(env.From)))
+		} else if len(env.ReplyTo) > 0 && !strings.EqualFold(env.ReplyTo[0].Host, env.From[0].Host) {
+			fs.add("#hdr:reply-to-other-domain")
+		}
+		var letters, upper int
+		for _, c := range env.Subject {
+			if unicode.IsLetter(c) {
+				letters++
+				if unicode.IsUpper(c) {
+					upper++
+				}
+			}
+		}
+		if letters >= 8 && upper == letters {
+			fs.add("#hdr:subject-uppercase")
+		}
+	}
+	return nil
+}
+
+// walk adds features for the part and its subparts.
+func (fs *features) walk(p message.Part) error {
+	ct := strings.ToLower(p.MediaType + "/" + p.MediaSubType)
+	if p.MediaType == "MULTIPART" {
+		for _, sp := range p.Parts {
+			if err := fs.walk(sp); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if p.Message != nil {
+		// Nested message, e.g. forwarded, its structure is not of the sender.
+		fs.add("#attach:" + ct)
+		return nil
+	}
+
+	disp, filename, _ := p.DispositionFilename()
+	if strings.EqualFold(disp, "attachment") || filename != "" || ct != "/" && p.MediaType != "TEXT" {
+		fs.add("#attach:" + ct)
+		if ext := strings.ToLower(filepath.Ext(filename)); len(ext) > 1 && len(ext) <= 10 {
+			fs.add("#attach-ext:" + ext)
+		}
+		return nil
+	}
+
+	r := io.LimitReader(p.ReaderUTF8OrBinary(), maxFeaturePartSize)
+	switch ct {
+	case "text/html":
+		fs.html = true
+		return fs.htmlStructure(r)
+	case "/", "text/plain":
+		fs.text = true
+		buf, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		for _, m := range urlRegexp.FindAllStringSubmatch(string(buf), -1) {
+			fs.addURL(m[1])
+		}
+	}
+	return nil
+}
+
+// htmlStructure adds features for the structure of an HTML part, e.g. number of
+// images, amount of text, hidden content, and links with a URL as text that
+// doesn't match the URL of the link.
+func (fs *features) htmlStructure(r io.Reader) error {
+	t := html.NewTokenizer(r)
+	var images, links, textLen int
+	var hidden, forms, scripts, mismatch bool
+	var href string   // Of current anchor, for checking its text.
+	var inA bool      // Whether we're in an anchor.
+	var aText []byte  // Text of current anchor.
+	var skipText bool // In style or script.
+	for {
+		switch t.Next() {
+		case html.ErrorToken:
+			if err := t.Err(); err != io.EOF {
+				return err
+			}
+			fs.add("#html:images:" + bucket(images))
+			fs.add("#html:links:" + bucket(links))
+			if images > 0 && textLen < 200 {
+				fs.add("#html:image-heavy")
+			}
+			if hidden {
+				fs.add("#html:hidden")
+			}
+			if forms {
+				fs.add("#html:form")
+			}
+			if scripts {
+				fs.add("#html:script")
+			}
+			if mismatch {
+				fs.add("#html:link-text-mismatch")
+			}
+			return nil
+
+		case html.TextToken:
+			if skipText {
+				continue
+			}
+			text := t.Text()
+			textLen += len(strings.TrimSpace(string(text)))
+			if inA {
+				aText = append(aText, text...)
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tagBuf, moreAttr := t.TagName()
+			tag := string(tagBuf)
+			var attrs map[string]string
+			for moreAttr {
+				var k, v []byte
+				k, v, moreAttr = t.TagAttr()
+				if attrs == nil {
+					attrs = map[string]string{}
+				}
+				attrs[string(k)] = string(v)
+			}
+			style := strings.ReplaceAll(strings.ToLower(attrs["style"]), " ", "")
+			if strings.Contains(style, "display:none") || strings.Contains(style, "visibility:hidden") || strings.Contains(style, "font-size:0") || strings.Contains(style, "opacity:0;") || strings.HasSuffix(style, "opacity:0") {
+				hidden = true
+			}
+			switch tag {
+			case "img":
+				images++
+				if m := urlRegexp.FindStringSubmatch(attrs["src"]); m != nil {
+					fs.addURL(m[1])
+				}
+			case "a":
+				if h := attrs["href"]; h != "" {
+					links++
+					if m := urlRegexp.FindStringSubmatch(h); m != nil {
+						fs.addURL(m[1])
+						href = strings.ToLower(m[1])
+					} else {
+						href = ""
+					}
+					inA = true
+					aText = aText[:0]
+				}
+			case "form":
+				forms = true
+				if m := urlRegexp.FindStringSubmatch(attrs["action"]); m != nil {
+					fs.addURL(m[1])
+				}
+			case "script":
+				scripts = true
+				skipText = true
+			case "style":
+				skipText = true
+			}
+
+		case html.EndTagToken:
+			tagBuf, _ := t.TagName()
+			switch string(tagBuf) {
+			case "a":
+				// Link text that looks like a URL to another host than the link is a phishing signal.
+				if inA && href != "" {
+					if m := urlRegexp.FindStringSubmatch(strings.TrimSpace(string(aText))); m != nil && !strings.EqualFold(m[1], href) {
+						mismatch = true
+					}
+				}
+				inA = false
+			case "script", "style":
+				skipText = false
+			}
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package junk
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mjl-/mox/message"
+	"github.com/mjl-/mox/mlog"
+)
+
+const featureMsgSpam = `Authentication-Results: mox.example; spf=fail smtp.mailfrom=spam.example;
+	dkim=none; dmarc=fail header.from=spam.example
+From: <sender@spam.example>
+Reply-To: <collect@other.example>
+To: <mjl@mox.example>
+Subject: WIN A FREE PRIZE NOW
+X-Mailer: MassMailer 1.0
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary=x
+
+--x
+Content-Type: text/html
+
+<html><body><img src="https://img.spam.example/a.png"><img src="https://img.spam.example/b.png">
+<a href="https://bit.ly/abc">https://www.bank.example/login</a>
+<div style="display: none">hidden words</div>
+<form action="https://192.0.2.1/post"></form>
+</body></html>
+--x
+Content-Type: application/octet-stream
+Content-Disposition: attachment; filename="invoice.exe"
+
+binary
+--x--
+`
+
+const featureMsgHam = `Authentication-Results: mox.example; spf=pass smtp.mailfrom=ham.example;
+	dkim=pass header.d=ham.example; dmarc=pass header.from=ham.example
+From: <friend@ham.example>
+To: <mjl@mox.example>
+Subject: lunch tomorrow?
+Message-Id: <1234@ham.example>
+Date: Mon, 19 Oct 2026 12:00:00 +0200
+User-Agent: Thunderbird/128.0
+Content-Type: text/plain
+
+Shall we have lunch tomorrow? Menu is at https://restaurant.example/menu.
+`
+
+func parseTestMessage(t *testing.T, s string) message.Part {
+	t.Helper()
+	s = strings.ReplaceAll(s, "\n", "\r\n")
+	p, err := message.EnsurePart(pkglog.Logger, false, strings.NewReader(s), int64(len(s)))
+	tcheck(t, err, "parse message")
+	return p
+}
+
+var pkglog = mlog.New("junk", nil)
+
+func TestFeatureTokens(t *testing.T) {
+	check := func(msg string, expect, notExpect []string) {
+		t.Helper()
+		tokens, err := FeatureTokens(parseTestMessage(t, msg))
+		tcheck(t, err, "feature tokens")
+		for _, tok := range expect {
+			if _, ok := tokens[tok]; !ok {
+				t.Fatalf("missing token %q in %v", tok, tokens)
+			}
+		}
+		for _, tok := range notExpect {
+			if _, ok := tokens[tok]; ok {
+				t.Fatalf("unexpected token %q in %v", tok, tokens)
+			}
+		}
+		for tok := range tokens {
+			if !strings.HasPrefix(tok, "#") {
+				t.Fatalf("token %q without # prefix", tok)
+			}
+		}
+	}
+
+	check(featureMsgSpam, []string{
+		"#auth:spf=fail",
+		"#auth:dkim=none",
+		"#auth:dmarc=fail",
+		"#hdr:no-message-id",
+		"#hdr:no-date",
+		"#hdr:reply-to-other-domain",
+		"#hdr:subject-uppercase",
+		"#hdr:mailer:massmailer",
+		"#url:bit.ly",
+		"#url:shortener",
+		"#url:ip",
+		"#url:img.spam.example",
+		"#urls:2-5", // Anchor, images, form.
+		"#html:only",
+		"#html:images:2-5",
+		"#html:links:1",
+		"#html:image-heavy",
+		"#html:hidden",
+		"#html:form",
+		"#html:link-text-mismatch",
+		"#attach:application/octet-stream",
+		"#attach-ext:.exe",
+	}, []string{"#hdr:no-to"})
+
+	check(featureMsgHam, []string{
+		"#auth:spf=pass",
+		"#auth:dkim=pass",
+		"#auth:dmarc=pass",
+		"#hdr:message-id-domain:ham.example",
+		"#hdr:mailer:thunderbird",
+		"#url:restaurant.example",
+		"#urls:1",
+	}, []string{
+		"#hdr:no-message-id",
+		"#hdr:no-date",
+		"#hdr:subject-uppercase",
+		"#html:only",
+		"#url:shortener",
+	})
+}
+
+func TestCombined(t *testing.T) {
+	dbPath := filepath.FromSlash("../testdata/junk/combined.db")
+	bloomPath := filepath.FromSlash("../testdata/junk/combined.bloom")
+	os.Remove(dbPath)
+	os.Remove(bloomPath)
+	defer os.Remove(dbPath)
+	defer os.Remove(bloomPath)
+
+	params := Params{Onegrams: true, MaxPower: 0.01, TopWords: 10, Features: true}
+	f, err := NewFilter(ctxbg, pkglog, params, dbPath, bloomPath)
+	tcheck(t, err, "new filter")
+	var c Classifier = NewCombined(f)
+	defer func() {
+		err := c.Close()
+		tcheck(t, err, "close")
+	}()
+
+	// Combined tokens include both words and features.
+	words, err := c.ParseMessage(parseTestMessage(t, featureMsgHam))
+	tcheck(t, err, "parse message")
+	if _, ok := words["lunch"]; !ok {
+		t.Fatalf("missing word in %v", words)
+	}
+	if _, ok := words["#auth:dmarc=pass"]; !ok {
+		t.Fatalf("missing feature in %v", words)
+	}
+
+	train := func(msg string, ham bool) {
+		t.Helper()
+		msg = strings.ReplaceAll(msg, "\n", "\r\n")
+		err := c.TrainMessage(ctxbg, strings.NewReader(msg), int64(len(msg)), ham)
+		tcheck(t, err, "train message")
+	}
+	for range 3 {
+		train(featureMsgHam, true)
+		train(featureMsgSpam, false)
+	}
+
+	// A new spam message with different words but the same structure is recognized
+	// through its features.
+	spam := strings.ReplaceAll(featureMsgSpam, "WIN A FREE PRIZE NOW", "CLAIM YOUR REWARD TODAY")
+	spam = strings.ReplaceAll(spam, "hidden words", "other text")
+	result, err := c.ClassifyMessage(ctxbg, parseTestMessage(t, spam))
+	tcheck(t, err, "classify")
+	if result.Probability < 0.9 {
+		t.Fatalf("got probability %v, expected spam", result.Probability)
+	}
+	if !slices.ContainsFunc(result.Spams, func(ws WordScore) bool { return strings.HasPrefix(ws.Word, "#") }) {
+		t.Fatalf("no features in spam scores %v", result.Spams)
+	}
+
+	// Untraining removes feature tokens too.
+	msg := strings.ReplaceAll(featureMsgSpam, "\n", "\r\n")
+	err = c.UntrainMessage(ctxbg, strings.NewReader(msg), int64(len(msg)), false)
+	tcheck(t, err, "untrain message")
+}
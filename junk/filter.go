@@ -8,7 +8,6 @@
 package junk
 
 // todo: look at inverse chi-square function? see https://www.linuxjournal.com/article/6467
-// todo: perhaps: whether anchor text in links in html are different from the url
 
 import (
 	"context"
@@ -56,6 +55,7 @@ type Params struct {
 	TopWords    int     `sconf-doc:"Number of most spammy/hammy words to use for calculating probability. E.g. 10."`
 	IgnoreWords float64 `sconf:"optional" sconf-doc:"Ignore words that are this much away from 0.5 haminess/spaminess. E.g. 0.1, causing word (combinations) of 0.4 to 0.6 to be ignored."`
 	RareWords   int     `sconf:"optional" sconf-doc:"Occurrences in word database until a word is considered rare and its influence in calculating probability reduced. E.g. 1 or 2."`
+	Features    bool    `sconf:"optional" sconf-doc:"Also train and classify with tokens describing the structure of messages: header properties, domains of links, attachment types, HTML structure (e.g. many images, hidden text) and authentication results. Enabling or disabling changes the tokens used for classification, making the token counts in the database inconsistent with how messages are classified, so the junk filter must be retrained after changing this setting, e.g. with \"mox retrain\"."`
 }
 
 var DBTypes = []any{Wordscore{}} // Stored in DB.
@@ -0,0 +1,327 @@
+// Package locallist implements IP and domain lists read from local files, for
+// use as block or allow lists for incoming messages, and for serving over DNS
+// like a DNSBL.
+//
+// The file format is similar to the ip4set and dnset datasets of rbldnsd. Each
+// line has an entry, optionally followed by whitespace and a text for the entry.
+// Entries:
+//
+//	192.0.2.1        IP address.
+//	198.51.100.0/24  Network, also for IPv6.
+//	example.com      Domain, matching only itself.
+//	.example.net     Domain and its subdomains.
+//	*.example.org    Only subdomains of the domain.
+//	!198.51.100.7    Exclusion of an IP, network or domain from a less specific entry.
+//	:127.0.0.2:text  Address for listings served over DNS, and the text for
+//	                 entries without text. In texts, "$" is replaced with the
+//	                 IP or domain.
+//
+// Empty lines and lines starting with "#" are ignored.
+package locallist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mlog"
+)
+
+var timeNow = time.Now // Tests override this.
+
+// How often we check if the file has changed.
+const checkInterval = time.Second
+
+// DefaultAddress is the address in the A records for listed IPs and domains served
+// over DNS, unless overridden in the file.
+var DefaultAddress = netip.AddrFrom4([4]byte{127, 0, 0, 2})
+
+// List is an IP and domain list from a file. The file is read again when it
+// changes, checked on use.
+type List struct {
+	Path string
+
+	sync.Mutex
+	checked time.Time // Last check for changes.
+	modTime time.Time
+	size    int64
+	d       *data
+}
+
+type entry struct {
+	exclude bool
+	text    string
+}
+
+// data is the parsed contents of a file.
+type data struct {
+	address   netip.Addr
+	text      string
+	prefixes  map[netip.Prefix]entry
+	bits4     []int // Prefix lengths for IPv4 in prefixes, longest first.
+	bits6     []int // Prefix lengths for IPv6 in prefixes, longest first.
+	exact     map[string]entry
+	wildcards map[string]entry // Matching subdomains of the domain.
+	serial    uint32
+}
+
+var lists = struct {
+	sync.Mutex
+	m map[string]*List
+}{m: map[string]*List{}}
+
+// Load returns the list for the file at path, reading the file if it isn't
+// already loaded. Lists are shared between callers for the same path.
+func Load(path string) (*List, error) {
+	lists.Lock()
+	defer lists.Unlock()
+	if l, ok := lists.m[path]; ok {
+		return l, nil
+	}
+	l := &List{Path: path}
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	lists.m[path] = l
+	return l, nil
+}
+
+// load reads and parses the file. Must be called with lock held, or before the
+// list is shared.
+func (l *List) load() error {
+	f, err := os.Open(l.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	d, err := parse(f)
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", l.Path, err)
+	}
+	d.serial = uint32(fi.ModTime().Unix())
+	l.checked = timeNow()
+	l.modTime = fi.ModTime()
+	l.size = fi.Size()
+	l.d = d
+	return nil
+}
+
+// current returns the data for the list, reading the file again if it has
+// changed. If reading fails, an error is logged and the previous data is used.
+func (l *List) current(log mlog.Log) *data {
+	l.Lock()
+	defer l.Unlock()
+
+	now := timeNow()
+	if now.Sub(l.checked) < checkInterval {
+		return l.d
+	}
+	l.checked = now
+	fi, err := os.Stat(l.Path)
+	if err != nil {
+		log.Errorx("checking local list for changes, using previous version", err, slog.String("path", l.Path))
+		return l.d
+	}
+	if fi.ModTime().Equal(l.modTime) && fi.Size() == l.size {
+		return l.d
+	}
+	if err := l.load(); err != nil {
+		log.Errorx("reloading changed local list, using previous version", err, slog.String("path", l.Path))
+		return l.d
+	}
+	log.Info("reloaded changed local list", slog.String("path", l.Path))
+	return l.d
+}
+
+func parse(r io.Reader) (*data, error) {
+	d := &data{
+		address:   DefaultAddress,
+		prefixes:  map[netip.Prefix]entry{},
+		exact:     map[string]entry{},
+		wildcards: map[string]entry{},
+	}
+	seen4 := map[int]bool{}
+	seen6 := map[int]bool{}
+
+	scanner := bufio.NewScanner(r)
+	var lineno int
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, ":") {
+			t := strings.SplitN(line[1:], ":", 2)
+			if t[0] != "" {
+				ip, err := netip.ParseAddr(t[0])
+				if err != nil || !ip.Is4() {
+					return nil, fmt.Errorf("line %d: invalid ipv4 address %q for listings", lineno, t[0])
+				}
+				d.address = ip
+			}
+			if len(t) == 2 {
+				d.text = t[1]
+			}
+			continue
+		}
+
+		var e entry
+		s := line
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			s, e.text = line[:i], strings.TrimSpace(line[i+1:])
+		}
+		if strings.HasPrefix(s, "!") {
+			e.exclude = true
+			s = s[1:]
+		}
+
+		if strings.Contains(s, ":") || strings.Contains(s, "/") || isIPv4(s) {
+			var p netip.Prefix
+			var err error
+			if strings.Contains(s, "/") {
+				p, err = netip.ParsePrefix(s)
+				if err == nil && p != p.Masked() {
+					err = fmt.Errorf("network has bits set after prefix")
+				}
+			} else {
+				var ip netip.Addr
+				ip, err = netip.ParseAddr(s)
+				if err == nil {
+					p = netip.PrefixFrom(ip, ip.BitLen())
+				}
+			}
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid ip or network %q: %v", lineno, s, err)
+			}
+			p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits())
+			d.prefixes[p] = e
+			if p.Addr().Is4() {
+				seen4[p.Bits()] = true
+			} else {
+				seen6[p.Bits()] = true
+			}
+			continue
+		}
+
+		var exact, wildcard bool
+		if strings.HasPrefix(s, "*.") {
+			wildcard = true
+			s = s[2:]
+		} else if strings.HasPrefix(s, ".") {
+			exact = true
+			wildcard = true
+			s = s[1:]
+		} else {
+			exact = true
+		}
+		dom, err := dns.ParseDomain(strings.TrimSuffix(s, "."))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid domain %q: %v", lineno, s, err)
+		}
+		if exact {
+			d.exact[dom.ASCII] = e
+		}
+		if wildcard {
+			d.wildcards[dom.ASCII] = e
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	d.bits4 = sortedBits(seen4)
+	d.bits6 = sortedBits(seen6)
+	return d, nil
+}
+
+func isIPv4(s string) bool {
+	ip, err := netip.ParseAddr(s)
+	return err == nil && ip.Is4()
+}
+
+func sortedBits(m map[int]bool) []int {
+	var l []int
+	for bits := range m {
+		l = append(l, bits)
+	}
+	slices.Sort(l)
+	slices.Reverse(l)
+	return l
+}
+
+func (d *data) entryText(e entry, subject string) string {
+	text := e.text
+	if text == "" {
+		text = d.text
+	}
+	return strings.ReplaceAll(text, "$", subject)
+}
+
+func (d *data) lookupIP(ip netip.Addr) (listed bool, text string) {
+	ip = ip.Unmap()
+	bits := d.bits6
+	if ip.Is4() {
+		bits = d.bits4
+	}
+	// Most specific entry wins, it may be an exclusion.
+	for _, n := range bits {
+		p, err := ip.Prefix(n)
+		if err != nil {
+			continue
+		}
+		if e, ok := d.prefixes[p]; ok {
+			if e.exclude {
+				return false, ""
+			}
+			return true, d.entryText(e, ip.String())
+		}
+	}
+	return false, ""
+}
+
+func (d *data) lookupDomain(name string) (listed bool, text string) {
+	e, ok := d.exact[name]
+	for s := name; !ok; {
+		i := strings.IndexByte(s, '.')
+		if i < 0 {
+			return false, ""
+		}
+		s = s[i+1:]
+		e, ok = d.wildcards[s]
+	}
+	if e.exclude {
+		return false, ""
+	}
+	return true, d.entryText(e, name)
+}
+
+// LookupIP returns whether the IP is listed, and if so the text for the
+// entry.
+func (l *List) LookupIP(log mlog.Log, ip net.IP) (listed bool, text string) {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false, ""
+	}
+	return l.current(log).lookupIP(addr)
+}
+
+// LookupDomain returns whether the domain is listed, and if so the text for the
+// entry.
+func (l *List) LookupDomain(log mlog.Log, d dns.Domain) (listed bool, text string) {
+	return l.current(log).lookupDomain(d.ASCII)
+}
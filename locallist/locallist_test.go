@@ -0,0 +1,247 @@
+package locallist
+
+import (
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mlog"
+)
+
+const testList = `# Test list.
+:127.0.0.3:listed: $
+192.0.2.0/24
+!192.0.2.10
+192.0.2.11 specific
+2001:db8::/32
+example.com
+.example.net
+*.example.org
+!sub.example.net
+`
+
+func TestParse(t *testing.T) {
+	d, err := parse(strings.NewReader(testList))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	if d.address.String() != "127.0.0.3" {
+		t.Fatalf("got address %s, expected 127.0.0.3", d.address)
+	}
+
+	ipTests := []struct {
+		ip     string
+		listed bool
+		text   string
+	}{
+		{"192.0.2.1", true, "listed: 192.0.2.1"},
+		{"192.0.2.10", false, ""},
+		{"192.0.2.11", true, "specific"},
+		{"::ffff:192.0.2.1", true, "listed: 192.0.2.1"},
+		{"198.51.100.1", false, ""},
+		{"2001:db8::1", true, "listed: 2001:db8::1"},
+		{"2001:db9::1", false, ""},
+	}
+	for _, tc := range ipTests {
+		listed, text := d.lookupIP(netip.MustParseAddr(tc.ip))
+		if listed != tc.listed || text != tc.text {
+			t.Fatalf("lookup ip %s: got %v %q, expected %v %q", tc.ip, listed, text, tc.listed, tc.text)
+		}
+	}
+
+	domainTests := []struct {
+		name   string
+		listed bool
+	}{
+		{"example.com", true},
+		{"sub.example.com", false},
+		{"example.net", true},
+		{"a.b.example.net", true},
+		{"sub.example.net", false},
+		{"x.sub.example.net", true}, // Exclusion is exact only.
+		{"example.org", false},
+		{"sub.example.org", true},
+		{"other.example", false},
+	}
+	for _, tc := range domainTests {
+		listed, _ := d.lookupDomain(tc.name)
+		if listed != tc.listed {
+			t.Fatalf("lookup domain %s: got %v, expected %v", tc.name, listed, tc.listed)
+		}
+	}
+
+	bad := []string{
+		"192.0.2.1/24",
+		"192.0.2.0/33",
+		"2001:db8::zz",
+		":bogus:",
+		"-bad-.example",
+	}
+	for _, s := range bad {
+		if _, err := parse(strings.NewReader(s + "\n")); err == nil {
+			t.Fatalf("parse %q: expected error", s)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	log := mlog.New("locallist", nil)
+
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	p := filepath.Join(t.TempDir(), "list.txt")
+	err := os.WriteFile(p, []byte("192.0.2.1\n"), 0660)
+	tcheck(t, err, "write")
+
+	l, err := Load(p)
+	tcheck(t, err, "load")
+	if l2, err := Load(p); err != nil || l2 != l {
+		t.Fatalf("second load did not return same list")
+	}
+	if listed, _ := l.LookupIP(log, net.ParseIP("192.0.2.1")); !listed {
+		t.Fatalf("ip not listed")
+	}
+
+	err = os.WriteFile(p, []byte("192.0.2.2\nexample.com\n"), 0660)
+	tcheck(t, err, "write")
+	mtime := now.Add(time.Minute)
+	err = os.Chtimes(p, mtime, mtime)
+	tcheck(t, err, "chtimes")
+
+	// Not checked again within interval.
+	if listed, _ := l.LookupIP(log, net.ParseIP("192.0.2.1")); !listed {
+		t.Fatalf("ip no longer listed before check interval")
+	}
+
+	now = now.Add(2 * checkInterval)
+	if listed, _ := l.LookupIP(log, net.ParseIP("192.0.2.1")); listed {
+		t.Fatalf("ip still listed after change")
+	}
+	if listed, _ := l.LookupDomain(log, dns.Domain{ASCII: "example.com"}); !listed {
+		t.Fatalf("domain not listed after change")
+	}
+
+	// Invalid file, previous version is kept.
+	err = os.WriteFile(p, []byte("192.0.2.0/8\n"), 0660)
+	tcheck(t, err, "write")
+	mtime = mtime.Add(time.Minute)
+	err = os.Chtimes(p, mtime, mtime)
+	tcheck(t, err, "chtimes")
+	now = now.Add(2 * checkInterval)
+	if listed, _ := l.LookupIP(log, net.ParseIP("192.0.2.2")); !listed {
+		t.Fatalf("previous version not kept after invalid change")
+	}
+}
+
+func TestServer(t *testing.T) {
+	log := mlog.New("locallist", nil)
+
+	d, err := parse(strings.NewReader(testList))
+	tcheck(t, err, "parse")
+	l := &List{Path: "test", checked: time.Now().Add(time.Hour), d: d}
+	srv := &Server{
+		Zones:    []Zone{{dns.Domain{ASCII: "bl.mox.example"}, l}},
+		Hostname: dns.Domain{ASCII: "mail.mox.example"},
+		Allowed:  []net.IPNet{{IP: net.ParseIP("10.0.0.0").To4(), Mask: net.CIDRMask(8, 32)}},
+	}
+	remote := &net.UDPAddr{IP: net.ParseIP("10.1.2.3"), Port: 1234}
+
+	query := func(name string, qtype dnsmessage.Type) dnsmessage.Message {
+		t.Helper()
+		q := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: 1},
+			Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName(name), Type: qtype, Class: dnsmessage.ClassINET}},
+		}
+		buf, err := q.Pack()
+		tcheck(t, err, "pack query")
+		resp := srv.handle(log, buf, remote, 512)
+		if resp == nil {
+			t.Fatalf("no response")
+		}
+		var m dnsmessage.Message
+		err = m.Unpack(resp)
+		tcheck(t, err, "unpack response")
+		if m.ID != 1 || !m.Response {
+			t.Fatalf("bad response header %#v", m.Header)
+		}
+		return m
+	}
+
+	m := query("1.2.0.192.bl.mox.example.", dnsmessage.TypeA)
+	if m.RCode != dnsmessage.RCodeSuccess || len(m.Answers) != 1 || m.Answers[0].Body.(*dnsmessage.AResource).A != [4]byte{127, 0, 0, 3} {
+		t.Fatalf("listed ip, got %#v", m)
+	}
+
+	m = query("1.2.0.192.bl.mox.example.", dnsmessage.TypeTXT)
+	if len(m.Answers) != 1 || m.Answers[0].Body.(*dnsmessage.TXTResource).TXT[0] != "listed: 192.0.2.1" {
+		t.Fatalf("listed ip txt, got %#v", m)
+	}
+
+	// Health check address.
+	m = query("2.0.0.127.bl.mox.example.", dnsmessage.TypeA)
+	if len(m.Answers) != 1 {
+		t.Fatalf("test address, got %#v", m)
+	}
+
+	m = query("1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.bl.mox.example.", dnsmessage.TypeA)
+	if len(m.Answers) != 1 {
+		t.Fatalf("listed ipv6, got %#v", m)
+	}
+
+	m = query("sub.example.org.bl.mox.example.", dnsmessage.TypeA)
+	if len(m.Answers) != 1 {
+		t.Fatalf("listed domain, got %#v", m)
+	}
+
+	m = query("10.2.0.192.bl.mox.example.", dnsmessage.TypeA)
+	if m.RCode != dnsmessage.RCodeNameError || len(m.Answers) != 0 || len(m.Authorities) != 1 {
+		t.Fatalf("excluded ip, got %#v", m)
+	}
+
+	m = query("1.2.0.192.bl.mox.example.", dnsmessage.TypeMX)
+	if m.RCode != dnsmessage.RCodeSuccess || len(m.Answers) != 0 || len(m.Authorities) != 1 {
+		t.Fatalf("nodata, got %#v", m)
+	}
+
+	m = query("bl.mox.example.", dnsmessage.TypeSOA)
+	if len(m.Answers) != 1 || !m.Authoritative {
+		t.Fatalf("soa, got %#v", m)
+	}
+
+	m = query("other.example.", dnsmessage.TypeA)
+	if m.RCode != dnsmessage.RCodeRefused {
+		t.Fatalf("outside zone, got %#v", m)
+	}
+
+	// Queries from IPs outside the allowed networks are ignored.
+	q := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: 1},
+		Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName("1.2.0.192.bl.mox.example."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}},
+	}
+	buf, err := q.Pack()
+	tcheck(t, err, "pack query")
+	if resp := srv.handle(log, buf, &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1234}, 512); resp != nil {
+		t.Fatalf("got response for query from disallowed ip")
+	}
+	srv.Allowed = nil
+	if resp := srv.handle(log, buf, remote, 512); resp != nil {
+		t.Fatalf("got response without allowed networks")
+	}
+}
+
+func tcheck(t *testing.T, err error, msg string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %s", msg, err)
+	}
+}
@@ -0,0 +1,399 @@
+package locallist
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/metrics"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+)
+
+var (
+	metricDNSQuery = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mox_locallist_dns_query_total",
+			Help: "DNS queries for local lists by result: listed, notlisted, nodata, refused, error.",
+		},
+		[]string{"result"},
+	)
+)
+
+// TTL for served records.
+const ttl = 300
+
+// Zone is a list served over DNS.
+type Zone struct {
+	Name dns.Domain
+	List *List
+}
+
+// Server answers DNS queries for lists under their zones.
+type Server struct {
+	Zones    []Zone
+	Hostname dns.Domain  // For NS and SOA records.
+	Allowed  []net.IPNet // Networks of clients allowed to query. Queries from other IPs, or all queries if empty, are ignored.
+}
+
+var servers []func()
+
+// Listen initializes UDP and TCP network listeners for serving local lists over
+// DNS, on all listeners with DNSLists enabled. The listeners are stored for a
+// later call to Serve.
+func Listen() {
+	log := mlog.New("locallist", nil)
+
+	var zones []Zone
+	seen := map[dns.Domain]bool{}
+	names := slices.Sorted(maps.Keys(mox.Conf.Static.Listeners))
+	for _, name := range names {
+		for _, ll := range mox.Conf.Static.Listeners[name].SMTP.LocalLists {
+			if ll.ZoneDomain.IsZero() || seen[ll.ZoneDomain] {
+				continue
+			}
+			seen[ll.ZoneDomain] = true
+			l, err := Load(ll.Path)
+			if err != nil {
+				log.Fatalx("loading local list", err, slog.String("path", ll.Path))
+			}
+			zones = append(zones, Zone{ll.ZoneDomain, l})
+		}
+	}
+	for _, name := range names {
+		listener := mox.Conf.Static.Listeners[name]
+		if !listener.DNSLists.Enabled {
+			continue
+		}
+		if len(listener.DNSLists.AllowedNets) == 0 {
+			log.Fatal("dns lists: refusing to serve without allowed networks", slog.String("listener", name))
+		}
+		srv := &Server{zones, mox.Conf.Static.HostnameDomain, listener.DNSLists.AllowedNets}
+		port := config.Port(listener.DNSLists.Port, 53)
+		for _, ip := range listener.IPs {
+			listen1(log, srv, name, ip, port)
+		}
+	}
+}
+
+func listen1(log mlog.Log, srv *Server, name, ip string, port int) {
+	addr := net.JoinHostPort(ip, fmt.Sprintf("%d", port))
+	if os.Getuid() == 0 {
+		log.Print("listening for dns lists", slog.String("listener", name), slog.String("address", addr))
+	}
+	network := mox.Network(ip)
+	ln, err := mox.Listen(network, addr)
+	if err != nil {
+		log.Fatalx("dns lists: listen for tcp", err, slog.String("listener", name))
+	}
+	udpnetwork := "udp" + strings.TrimPrefix(network, "tcp")
+	pc, err := mox.ListenPacket(udpnetwork, addr)
+	if err != nil {
+		log.Fatalx("dns lists: listen for udp", err, slog.String("listener", name))
+	}
+
+	servers = append(servers, func() { srv.ServeUDP(log, pc) }, func() { srv.ServeTCP(log, ln) })
+}
+
+// Serve starts serving on all listeners, launching a goroutine per listener.
+func Serve() {
+	for _, serve := range servers {
+		go serve()
+	}
+}
+
+// ServeUDP answers queries from the packet connection until it is closed.
+func (s *Server) ServeUDP(log mlog.Log, pc net.PacketConn) {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Infox("dns lists: reading udp packet", err)
+			continue
+		}
+		resp := s.handle(log, buf[:n], addr, 512)
+		if resp == nil {
+			continue
+		}
+		if _, err := pc.WriteTo(resp, addr); err != nil {
+			log.Debugx("dns lists: writing udp response", err, slog.Any("remote", addr))
+		}
+	}
+}
+
+// ServeTCP answers queries on connections accepted from the listener until it is
+// closed.
+func (s *Server) ServeTCP(log mlog.Log, ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Infox("dns lists: accept", err)
+			continue
+		}
+		go s.serveConn(log, conn)
+	}
+}
+
+func (s *Server) serveConn(log mlog.Log, conn net.Conn) {
+	defer func() {
+		x := recover()
+		if x != nil {
+			log.Error("dns lists: panic handling connection", slog.Any("err", x))
+			metrics.PanicInc(metrics.Locallist)
+		}
+		conn.Close()
+	}()
+
+	for {
+		// Clients may send multiple queries, they must send them within 10 seconds.
+		if err := conn.SetDeadline(time.Now().Add(10 * time.Second)); err != nil {
+			return
+		}
+		var lenbuf [2]byte
+		if _, err := io.ReadFull(conn, lenbuf[:]); err != nil {
+			return
+		}
+		buf := make([]byte, binary.BigEndian.Uint16(lenbuf[:]))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return
+		}
+		resp := s.handle(log, buf, conn.RemoteAddr(), 65535)
+		if resp == nil {
+			return
+		}
+		out := binary.BigEndian.AppendUint16(nil, uint16(len(resp)))
+		if _, err := conn.Write(append(out, resp...)); err != nil {
+			return
+		}
+	}
+}
+
+// allowed returns whether remote is in one of the allowed networks.
+func (s *Server) allowed(remote net.Addr) bool {
+	var ip net.IP
+	switch a := remote.(type) {
+	case *net.UDPAddr:
+		ip = a.IP
+	case *net.TCPAddr:
+		ip = a.IP
+	default:
+		return false
+	}
+	for _, ipnet := range s.Allowed {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// handle returns the response to a query, or nil if no response should be sent.
+// Responses larger than maxSize are truncated.
+func (s *Server) handle(log mlog.Log, buf []byte, remote net.Addr, maxSize int) []byte {
+	// Not responding to disallowed clients, we don't want to be used for reflection
+	// attacks.
+	if !s.allowed(remote) {
+		metricDNSQuery.WithLabelValues("refused").Inc()
+		log.Debug("dns lists: ignoring query from ip not allowed", slog.Any("remote", remote))
+		return nil
+	}
+
+	var p dnsmessage.Parser
+	hdr, err := p.Start(buf)
+	if err != nil || hdr.Response {
+		metricDNSQuery.WithLabelValues("error").Inc()
+		return nil
+	}
+	resp := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:               hdr.ID,
+			Response:         true,
+			OpCode:           hdr.OpCode,
+			RecursionDesired: hdr.RecursionDesired,
+		},
+	}
+	pack := func(result string) []byte {
+		metricDNSQuery.WithLabelValues(result).Inc()
+		b, err := resp.Pack()
+		if err == nil && len(b) > maxSize {
+			resp.Truncated = true
+			resp.Answers = nil
+			resp.Authorities = nil
+			b, err = resp.Pack()
+		}
+		if err != nil {
+			log.Errorx("dns lists: packing response", err)
+			return nil
+		}
+		return b
+	}
+
+	if hdr.OpCode != 0 {
+		resp.RCode = dnsmessage.RCodeNotImplemented
+		return pack("error")
+	}
+	questions, err := p.AllQuestions()
+	if err != nil || len(questions) != 1 {
+		resp.RCode = dnsmessage.RCodeFormatError
+		return pack("error")
+	}
+	q := questions[0]
+	resp.Questions = questions
+	if q.Class != dnsmessage.ClassINET {
+		resp.RCode = dnsmessage.RCodeRefused
+		return pack("refused")
+	}
+
+	qname := strings.ToLower(strings.TrimSuffix(q.Name.String(), "."))
+	var zone Zone
+	var rel string
+	for _, z := range s.Zones {
+		if qname == z.Name.ASCII {
+			zone, rel = z, ""
+			break
+		} else if strings.HasSuffix(qname, "."+z.Name.ASCII) && (zone.List == nil || len(z.Name.ASCII) > len(zone.Name.ASCII)) {
+			zone, rel = z, strings.TrimSuffix(qname, "."+z.Name.ASCII)
+		}
+	}
+	if zone.List == nil {
+		resp.RCode = dnsmessage.RCodeRefused
+		return pack("refused")
+	}
+	resp.Authoritative = true
+	d := zone.List.current(log)
+
+	zoneName := dnsmessage.MustNewName(zone.Name.ASCII + ".")
+	hostname := dnsmessage.MustNewName(s.Hostname.ASCII + ".")
+	soa := dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: zoneName, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET, TTL: ttl},
+		Body: &dnsmessage.SOAResource{
+			NS:      hostname,
+			MBox:    dnsmessage.MustNewName("hostmaster." + s.Hostname.ASCII + "."),
+			Serial:  d.serial,
+			Refresh: 3600,
+			Retry:   600,
+			Expire:  86400,
+			MinTTL:  60,
+		},
+	}
+
+	if rel == "" {
+		switch q.Type {
+		case dnsmessage.TypeSOA:
+			resp.Answers = append(resp.Answers, soa)
+		case dnsmessage.TypeNS:
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: zoneName, Type: dnsmessage.TypeNS, Class: dnsmessage.ClassINET, TTL: ttl},
+				Body:   &dnsmessage.NSResource{NS: hostname},
+			})
+		default:
+			resp.Authorities = append(resp.Authorities, soa)
+			return pack("nodata")
+		}
+		return pack("notlisted")
+	}
+
+	listed, text := d.lookup(rel)
+	if !listed {
+		resp.RCode = dnsmessage.RCodeNameError
+		resp.Authorities = append(resp.Authorities, soa)
+		return pack("notlisted")
+	}
+	if text == "" {
+		text = "listed"
+	}
+
+	rh := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: ttl}
+	if q.Type == dnsmessage.TypeA || q.Type == dnsmessage.TypeALL {
+		rh.Type = dnsmessage.TypeA
+		resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: rh, Body: &dnsmessage.AResource{A: d.address.As4()}})
+	}
+	if q.Type == dnsmessage.TypeTXT || q.Type == dnsmessage.TypeALL {
+		rh.Type = dnsmessage.TypeTXT
+		var l []string
+		for len(text) > 255 {
+			l = append(l, text[:255])
+			text = text[255:]
+		}
+		l = append(l, text)
+		resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: rh, Body: &dnsmessage.TXTResource{TXT: l}})
+	}
+	if len(resp.Answers) == 0 {
+		resp.Authorities = append(resp.Authorities, soa)
+		return pack("nodata")
+	}
+	log.Debug("dns lists: listed", slog.String("name", qname), slog.Any("remote", remote))
+	return pack("listed")
+}
+
+// lookup looks up a name relative to the zone. The name is a reversed IPv4
+// address (e.g. 1.2.0.192), reversed IPv6 nibbles, or a domain.
+func (d *data) lookup(rel string) (listed bool, text string) {
+	labels := strings.Split(rel, ".")
+	if ip, ok := reverseIP(labels); ok {
+		// For DNSBL health checks. ../rfc/5782:355
+		if ip == DefaultAddress {
+			return true, "test address"
+		}
+		return d.lookupIP(ip)
+	}
+	return d.lookupDomain(rel)
+}
+
+// reverseIP parses labels of a reversed IPv4 address, or of IPv6 nibbles.
+func reverseIP(labels []string) (netip.Addr, bool) {
+	switch len(labels) {
+	case 4:
+		var b [4]byte
+		for i, s := range labels {
+			v, err := strconv.ParseUint(s, 10, 8)
+			if err != nil || len(s) > 1 && s[0] == '0' {
+				return netip.Addr{}, false
+			}
+			b[3-i] = byte(v)
+		}
+		return netip.AddrFrom4(b), true
+	case 32:
+		var b [16]byte
+		for i, s := range labels {
+			if len(s) != 1 {
+				return netip.Addr{}, false
+			}
+			v, err := strconv.ParseUint(s, 16, 8)
+			if err != nil {
+				return netip.Addr{}, false
+			}
+			n := 31 - i
+			if n%2 == 0 {
+				b[n/2] |= byte(v) << 4
+			} else {
+				b[n/2] |= byte(v)
+			}
+		}
+		return netip.AddrFrom16(b), true
+	}
+	return netip.Addr{}, false
+}
@@ -190,6 +190,8 @@ during those commands instead of during "data".
 	golog.Print(" http://localhost:1080/webmail/                  - webmail http (without tls)")
 	golog.Print("https://localhost:1443/webapi/                   - webmail https (email mox@localhost, password moxmoxmox)")
 	golog.Print(" http://localhost:1080/webapi/                   - webmail http (without tls)")
+	golog.Print("https://localhost:1443/dav/                      - caldav/carddav https (email mox@localhost, password moxmoxmox)")
+	golog.Print(" http://localhost:1080/dav/                      - caldav/carddav http (without tls)")
 	golog.Print("https://localhost:1443/admin/                    - admin https (password moxadmin)")
 	golog.Print(" http://localhost:1080/admin/                    - admin http (without tls)")
 	golog.Print("")
@@ -354,6 +356,12 @@ func writeLocalConfig(log mlog.Log, dir, ip string) (rerr error) {
 	local.WebAPIHTTPS.Enabled = true
 	local.WebAPIHTTPS.Port = 1443
 	local.WebAPIHTTPS.Path = "/webapi/"
+	local.DAVHTTP.Enabled = true
+	local.DAVHTTP.Port = 1080
+	local.DAVHTTP.Path = "/dav/"
+	local.DAVHTTPS.Enabled = true
+	local.DAVHTTPS.Port = 1443
+	local.DAVHTTPS.Path = "/dav/"
 	local.AdminHTTP.Enabled = true
 	local.AdminHTTP.Port = 1080
 	local.AdminHTTPS.Enabled = true
@@ -71,6 +71,7 @@ import (
 	"github.com/mjl-/mox/store"
 	"github.com/mjl-/mox/tlsrpt"
 	"github.com/mjl-/mox/tlsrptdb"
+	"github.com/mjl-/mox/totp"
 	"github.com/mjl-/mox/updates"
 	"github.com/mjl-/mox/webadmin"
 	"github.com/mjl-/mox/webapi"
@@ -104,9 +105,11 @@ var commands = []struct {
 }{
 	{"serve", cmdServe},
 	{"quickstart", cmdQuickstart},
+	{"setup", cmdSetup},
 	{"stop", cmdStop},
 	{"setaccountpassword", cmdSetaccountpassword},
 	{"setadminpassword", cmdSetadminpassword},
+	{"setadmintotp", cmdSetadmintotp},
 	{"loglevels", cmdLoglevels},
 	{"queue holdrules list", cmdQueueHoldrulesList},
 	{"queue holdrules add", cmdQueueHoldrulesAdd},
@@ -130,6 +133,12 @@ var commands = []struct {
 	{"queue webhook schedule", cmdQueueHookSchedule},
 	{"queue webhook cancel", cmdQueueHookCancel},
 	{"queue webhook print", cmdQueueHookPrint},
+	{"ipban list", cmdIPBanList},
+	{"ipban add", cmdIPBanAdd},
+	{"ipban rm", cmdIPBanRemove},
+	{"ipban allowlist list", cmdIPBanAllowlistList},
+	{"ipban allowlist add", cmdIPBanAllowlistAdd},
+	{"ipban allowlist rm", cmdIPBanAllowlistRemove},
 	{"queue webhook retired list", cmdQueueHookRetiredList},
 	{"queue webhook retired print", cmdQueueHookRetiredPrint},
 	{"import maildir", cmdImportMaildir},
@@ -163,6 +172,9 @@ var commands = []struct {
 	{"config tlspubkey add", cmdConfigTlspubkeyAdd},
 	{"config tlspubkey rm", cmdConfigTlspubkeyRemove},
 	{"config tlspubkey gen", cmdConfigTlspubkeyGen},
+	{"config apikey list", cmdConfigAPIKeyList},
+	{"config apikey add", cmdConfigAPIKeyAdd},
+	{"config apikey rm", cmdConfigAPIKeyRemove},
 	{"config alias list", cmdConfigAliasList},
 	{"config alias print", cmdConfigAliasPrint},
 	{"config alias add", cmdConfigAliasAdd},
@@ -199,6 +211,7 @@ var commands = []struct {
 	{"dmarc checkreportaddrs", cmdDMARCCheckreportaddrs},
 	{"dnsbl check", cmdDNSBLCheck},
 	{"dnsbl checkhealth", cmdDNSBLCheckhealth},
+	{"junk evaluate", cmdJunkEvaluate},
 	{"mtasts lookup", cmdMTASTSLookup},
 	{"rdap domainage", cmdRDAPDomainage},
 	{"retrain", cmdRetrain},
@@ -218,6 +231,7 @@ var commands = []struct {
 	{"fixuidmeta", cmdFixUIDMeta},
 	{"fixmsgsize", cmdFixmsgsize},
 	{"reparse", cmdReparse},
+	{"rebuildsearchindex", cmdRebuildSearchIndex},
 	{"ensureparsed", cmdEnsureParsed},
 	{"recalculatemailboxcounts", cmdRecalculateMailboxCounts},
 	{"message parse", cmdMessageParse},
@@ -243,6 +257,7 @@ var commands = []struct {
 	{"openaccounts", cmdOpenaccounts},
 	{"readmessages", cmdReadmessages},
 	{"queuefillretired", cmdQueueFillRetired},
+	{"imappreauth", cmdIMAPPreauth},
 }
 
 var cmds []cmd
@@ -1199,6 +1214,98 @@ func ctlcmdConfigTlspubkeyRemove(ctl *ctl, fingerprint string) {
 	ctl.xreadok()
 }
 
+func cmdConfigAPIKeyList(c *cmd) {
+	c.params = "account"
+	c.help = `List API keys for the webapi for an account.
+
+The keys themselves are not stored and cannot be listed, only their prefix.
+`
+	args := c.Parse()
+	if len(args) != 1 {
+		c.Usage()
+	}
+
+	mustLoadConfig()
+	ctlcmdConfigAPIKeyList(xctl(), args[0])
+}
+
+func ctlcmdConfigAPIKeyList(ctl *ctl, account string) {
+	ctl.xwrite("apikeylist")
+	ctl.xwrite(account)
+	ctl.xreadok()
+	ctl.xstreamto(os.Stdout)
+}
+
+func cmdConfigAPIKeyAdd(c *cmd) {
+	c.params = "[-expires duration] [-ip range ...] account name scope,..."
+	c.help = `Add an API key for the webapi to an account, and print the new key.
+
+The key is used as password in HTTP basic authentication, with an email address
+of the account as username. The key is only printed once, it is not stored.
+
+Scopes determine the methods that can be called with the key:
+"send" for sending messages, "read" for retrieving, listing and searching
+messages and mailboxes and for the event stream, "manage" for adding, changing
+and removing messages and mailboxes, and "suppression" for managing the
+suppression list.
+
+Without -ip, the key can be used from any IP. Otherwise, only from IPs within
+the ranges, in CIDR notation.
+`
+	var expires time.Duration
+	var ipranges []string
+	c.flag.DurationVar(&expires, "expires", 0, "if non-zero, duration after which the key expires")
+	c.flag.Func("ip", "ip range in CIDR notation the key can be used from, can be specified multiple times", func(s string) error {
+		ipranges = append(ipranges, s)
+		return nil
+	})
+	args := c.Parse()
+	if len(args) != 3 {
+		c.Usage()
+	}
+
+	var expiresStr string
+	if expires > 0 {
+		expiresStr = time.Now().Add(expires).Format(time.RFC3339)
+	}
+
+	mustLoadConfig()
+	ctlcmdConfigAPIKeyAdd(xctl(), args[0], args[1], args[2], expiresStr, ipranges)
+}
+
+func ctlcmdConfigAPIKeyAdd(ctl *ctl, account, name, scopes, expires string, ipranges []string) {
+	ctl.xwrite("apikeyadd")
+	ctl.xwrite(account)
+	ctl.xwrite(name)
+	ctl.xwrite(scopes)
+	ctl.xwrite(expires)
+	ctl.xwrite(strings.Join(ipranges, ","))
+	ctl.xreadok()
+	fmt.Println(ctl.xread())
+}
+
+func cmdConfigAPIKeyRemove(c *cmd) {
+	c.params = "account id"
+	c.help = `Remove an API key for the webapi from an account.
+
+The ID is listed by "mox config apikey list".
+`
+	args := c.Parse()
+	if len(args) != 2 {
+		c.Usage()
+	}
+
+	mustLoadConfig()
+	ctlcmdConfigAPIKeyRemove(xctl(), args[0], args[1])
+}
+
+func ctlcmdConfigAPIKeyRemove(ctl *ctl, account, id string) {
+	ctl.xwrite("apikeyrm")
+	ctl.xwrite(account)
+	ctl.xwrite(id)
+	ctl.xreadok()
+}
+
 func cmdConfigTlspubkeyGen(c *cmd) {
 	c.params = "stem"
 	c.help = `Generate an ed25519 private key and minimal certificate for use a TLS public key and write to files starting with stem.
@@ -1792,6 +1899,32 @@ The password is read from stdin. Its bcrypt hash is stored in a file named
 	xcheckf(err, "writing hash to admin password file")
 }
 
+func cmdSetadmintotp(c *cmd) {
+	c.help = `Set a new TOTP secret for the admin, as second factor for the web interface.
+
+A new secret is generated and stored in the file configured as AdminTOTPFile
+in mox.conf. The secret and an otpauth URI are printed, for adding to an
+authenticator app. After setting a secret, admin logins require a code from
+the authenticator app in addition to the admin password. Any previous secret
+stops working. To disable the second factor, remove AdminTOTPFile from mox.conf.
+`
+	if len(c.Parse()) != 0 {
+		c.Usage()
+	}
+	mustLoadConfig()
+
+	if mox.Conf.Static.AdminTOTPFile == "" {
+		log.Fatal("no admin totp file configured, set AdminTOTPFile in mox.conf, e.g. to adminotp")
+	}
+	path := mox.ConfigDirPath(mox.Conf.Static.AdminTOTPFile)
+
+	secret := totp.NewSecret()
+	err := os.WriteFile(path, []byte(secret+"\n"), 0660)
+	xcheckf(err, "writing admin totp file")
+	fmt.Printf("secret: %s\n", secret)
+	fmt.Printf("uri: %s\n", totp.URI(mox.Conf.Static.HostnameDomain.ASCII, "admin", secret))
+}
+
 func xreadpassword() string {
 	fmt.Printf(`
 Type new password. Password WILL echo.
@@ -2846,15 +2979,43 @@ func cmdDKIMLookup(c *cmd) {
 }
 
 func cmdDMARCLookup(c *cmd) {
-	c.params = "domain"
-	c.help = "Lookup dmarc policy for domain, a DNS TXT record at _dmarc.<domain>, validate and print it."
+	c.params = "[-bis] domain"
+	c.help = `Lookup dmarc policy for domain, a DNS TXT record at _dmarc.<domain>, validate and print it.
+
+The domains where the DMARC record is looked up are printed, along with the
+organizational domain. By default, the organizational domain is found through
+the public suffix list, as in RFC 7489. With -bis, DMARCbis is used: the DMARC
+record and organizational domain are found through a DNS tree walk.
+`
+	var bis bool
+	c.flag.BoolVar(&bis, "bis", false, "use dmarcbis dns tree walk for policy discovery")
 	args := c.Parse()
 	if len(args) != 1 {
 		c.Usage()
 	}
 
+	discovery := dmarc.DiscoveryPublicSuffix
+	if bis {
+		discovery = dmarc.DiscoveryTreeWalk
+	}
+
 	fromdomain := xparseDomain(args[0], "domain")
-	_, domain, _, txt, authentic, err := dmarc.Lookup(context.Background(), c.log.Logger, dns.StrictResolver{}, fromdomain)
+	_, domain, _, txt, authentic, err := dmarc.Lookup(context.Background(), c.log.Logger, dns.StrictResolver{}, fromdomain, discovery)
+
+	fmt.Printf("discovery path:\n")
+	for _, d := range dmarc.DiscoveryPath(context.Background(), c.log.Logger, fromdomain, discovery) {
+		fmt.Printf("\t_dmarc.%s\n", d)
+		if d == domain {
+			break
+		}
+	}
+	orgDomain, orgErr := dmarc.OrganizationalDomain(context.Background(), c.log.Logger, dns.StrictResolver{}, fromdomain, discovery)
+	if orgErr != nil {
+		fmt.Printf("organizational domain: %s (error: %v)\n", orgDomain, orgErr)
+	} else {
+		fmt.Printf("organizational domain: %s\n", orgDomain)
+	}
+
 	xcheckf(err, "dmarc lookup domain %s", fromdomain)
 	fmt.Printf("dmarc record at domain %s: %s\n", domain, txt)
 	fmt.Printf("(%s)\n", dnssecStatus(authentic))
@@ -2868,7 +3029,7 @@ func dnssecStatus(v bool) string {
 }
 
 func cmdDMARCVerify(c *cmd) {
-	c.params = "remoteip mailfromaddress helodomain < message"
+	c.params = "[-bis] remoteip mailfromaddress helodomain < message"
 	c.help = `Parse an email message and evaluate it against the DMARC policy of the domain in the From-header.
 
 mailfromaddress and helodomain are used for SPF validation. If both are empty,
@@ -2878,12 +3039,21 @@ mailfromaddress should be the address used as MAIL FROM in the SMTP session.
 For DSN messages, that address may be empty. The helo domain was specified at
 the beginning of the SMTP transaction that delivered the message. These values
 can be found in message headers.
+
+With -bis, the DMARC policy is evaluated according to DMARCbis.
 `
+	var bis bool
+	c.flag.BoolVar(&bis, "bis", false, "evaluate according to dmarcbis, with dns tree walk for policy discovery")
 	args := c.Parse()
 	if len(args) != 3 {
 		c.Usage()
 	}
 
+	discovery := dmarc.DiscoveryPublicSuffix
+	if bis {
+		discovery = dmarc.DiscoveryTreeWalk
+	}
+
 	var heloDomain *dns.Domain
 
 	remoteIP := xparseIP(args[0], "remoteip")
@@ -2942,7 +3112,7 @@ can be found in message headers.
 		fmt.Printf("dkim result: %q (err %v)\n", r.Status, r.Err)
 	}
 
-	_, result := dmarc.Verify(context.Background(), c.log.Logger, dns.StrictResolver{}, dmarcFrom.Domain, dkimResults, spfStatus, spfIdentity, false)
+	_, result := dmarc.Verify(context.Background(), c.log.Logger, dns.StrictResolver{}, dmarcFrom.Domain, dkimResults, spfStatus, spfIdentity, false, discovery)
 	xcheckf(result.Err, "dmarc verify")
 	fmt.Printf("dmarc from: %s\ndmarc status: %q\ndmarc reject: %v\ncmarc record: %s\n", dmarcFrom, result.Status, result.Reject, result.Record)
 }
@@ -2963,7 +3133,7 @@ address must opt-in to receiving DMARC reports by creating a DMARC record at
 	}
 
 	dom := xparseDomain(args[0], "domain")
-	_, domain, record, txt, authentic, err := dmarc.Lookup(context.Background(), c.log.Logger, dns.StrictResolver{}, dom)
+	_, domain, record, txt, authentic, err := dmarc.Lookup(context.Background(), c.log.Logger, dns.StrictResolver{}, dom, dmarc.DiscoveryPublicSuffix)
 	xcheckf(err, "dmarc lookup domain %s", dom)
 	fmt.Printf("dmarc record at domain %s: %q\n", domain, txt)
 	fmt.Printf("(%s)\n", dnssecStatus(authentic))
@@ -3315,6 +3485,41 @@ func ctlcmdRetrain(ctl *ctl, account string) {
 	ctl.xreadok()
 }
 
+func cmdJunkEvaluate(c *cmd) {
+	c.params = "account [hammailbox spammailbox]"
+	c.help = `Evaluate the junk filter of an account on its labeled messages.
+
+Without mailboxes, messages with the $Junk or $NotJunk flag are evaluated. With
+mailboxes, all messages in the ham and spam mailbox are evaluated. Each message
+is classified as if the junk filter had not been trained with it. Precision,
+recall and accuracy are printed, for the configured threshold. The junk filter
+is not modified.
+
+Useful for evaluating changes to the junk filter configuration, e.g. enabling
+features, after retraining.
+`
+	args := c.Parse()
+	if len(args) != 1 && len(args) != 3 {
+		c.Usage()
+	}
+	var hamMailbox, spamMailbox string
+	if len(args) == 3 {
+		hamMailbox, spamMailbox = args[1], args[2]
+	}
+
+	mustLoadConfig()
+	ctlcmdJunkEvaluate(xctl(), args[0], hamMailbox, spamMailbox)
+}
+
+func ctlcmdJunkEvaluate(ctl *ctl, account, hamMailbox, spamMailbox string) {
+	ctl.xwrite("junkevaluate")
+	ctl.xwrite(account)
+	ctl.xwrite(hamMailbox)
+	ctl.xwrite(spamMailbox)
+	ctl.xreadok()
+	ctl.xstreamto(os.Stdout)
+}
+
 func cmdTLSRPTDBAddReport(c *cmd) {
 	c.unlisted = true
 	c.params = "< message"
@@ -3843,6 +4048,37 @@ func ctlcmdReparse(ctl *ctl, account string) {
 	ctl.xstreamto(os.Stdout)
 }
 
+func cmdRebuildSearchIndex(c *cmd) {
+	c.params = "[account]"
+	c.help = `Rebuild the full-text search index for the account or all accounts.
+
+The index is kept up to date when messages are delivered, added and removed.
+Messages stored before the index existed are not in the index, and are searched
+by reading the message files, which is slow for large mailboxes. Rebuilding adds
+all messages to the index, and removes words no longer used from the index.
+Messages are indexed in batches, so other access to the mailboxes/messages are
+not blocked while rebuilding.
+`
+	args := c.Parse()
+	if len(args) > 1 {
+		c.Usage()
+	}
+
+	mustLoadConfig()
+	var account string
+	if len(args) == 1 {
+		account = args[0]
+	}
+	ctlcmdRebuildSearchIndex(xctl(), account)
+}
+
+func ctlcmdRebuildSearchIndex(ctl *ctl, account string) {
+	ctl.xwrite("rebuildsearchindex")
+	ctl.xwrite(account)
+	ctl.xreadok()
+	ctl.xstreamto(os.Stdout)
+}
+
 func cmdEnsureParsed(c *cmd) {
 	c.params = "account"
 	c.help = "Ensure messages in the database have a pre-parsed MIME form in the database."
@@ -3900,9 +4136,9 @@ func cmdRecalculateMailboxCounts(c *cmd) {
 
 When a message is added to/removed from a mailbox, or when message flags change,
 the total, unread, unseen and deleted messages are accounted, the total size of
-the mailbox, and the total message size for the account. In case of a bug in
-this accounting, the numbers could become incorrect. This command will find, fix
-and print them.
+the mailbox, and the total message size for the account. The size of calendar
+and contact objects is accounted too. In case of a bug in this accounting, the
+numbers could become incorrect. This command will find, fix and print them.
 `
 	args := c.Parse()
 	if len(args) != 1 {
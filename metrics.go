@@ -11,6 +11,8 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 
+	"github.com/mjl-/mox/bimi"
+	"github.com/mjl-/mox/contentscan"
 	"github.com/mjl-/mox/dane"
 	"github.com/mjl-/mox/dkim"
 	"github.com/mjl-/mox/dmarc"
@@ -20,6 +22,7 @@ import (
 	"github.com/mjl-/mox/metrics"
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/mtasts"
+	"github.com/mjl-/mox/recursor"
 	"github.com/mjl-/mox/smtpclient"
 	"github.com/mjl-/mox/spf"
 	"github.com/mjl-/mox/subjectpass"
@@ -122,6 +125,18 @@ func init() {
 			"use",    // yes/no, if policy is used after random selection
 		},
 	)}
+	bimi.MetricVerify = histogramVec{promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "mox_bimi_verify_duration_seconds",
+			Help:    "BIMI verify, including lookup and fetching logo and certificate, duration and result.",
+			Buckets: []float64{0.001, 0.005, 0.01, 0.05, 0.100, 0.5, 1, 5, 10, 20, 30},
+		},
+		[]string{
+			"status",
+			"evidence", // vmc, cmc or empty
+		},
+	)}
+	bimi.HTTPClientObserve = httpClientObserve
 	dns.MetricLookup = histogramVec{
 		promauto.NewHistogramVec(
 			prometheus.HistogramOpts{
@@ -149,6 +164,18 @@ func init() {
 		},
 	)}
 
+	contentscan.MetricScan = histogramVec{promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "mox_contentscan_duration_seconds",
+			Help:    "Scans of message content for viruses/malware with an external scanner.",
+			Buckets: []float64{0.01, 0.05, 0.100, 0.5, 1, 5, 10, 20, 30, 60},
+		},
+		[]string{
+			"protocol", // clamd, icap
+			"result",   // clean, infected, error
+		},
+	)}
+
 	iprev.MetricIPRev = histogramVec{promauto.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "mox_iprev_lookup_total",
@@ -170,6 +197,35 @@ func init() {
 	)}
 	mtasts.HTTPClientObserve = httpClientObserve
 
+	recursor.MetricQuery = histogramVec{promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "mox_recursor_query_duration_seconds",
+			Help:    "Queries by the built-in recursive resolver to authoritative name servers.",
+			Buckets: []float64{0.001, 0.005, 0.01, 0.05, 0.100, 0.5, 1, 5},
+		},
+		[]string{
+			"result", // ok, error, timeout
+		},
+	)}
+	recursor.MetricCache = counterVec{promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mox_recursor_cache_total",
+			Help: "Cache lookups by the built-in recursive resolver.",
+		},
+		[]string{
+			"result", // hit, nsec (negative response synthesized from cached nsec records), miss
+		},
+	)}
+	recursor.MetricValidation = counterVec{promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mox_recursor_validation_total",
+			Help: "DNSSEC validation results of responses by the built-in recursive resolver.",
+		},
+		[]string{
+			"status", // secure, insecure, bogus
+		},
+	)}
+
 	smtpclient.MetricCommands = histogramVec{promauto.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "mox_smtpclient_command_duration_seconds",
@@ -43,6 +43,9 @@ const (
 	Webmailrequest   Panic = "webmailrequest"
 	Webmailquery     Panic = "webmailquery"
 	Webmailhandle    Panic = "webmailhandle"
+	Davserver        Panic = "davserver"
+	Greylist         Panic = "greylist"
+	Locallist        Panic = "locallist"
 )
 
 func init() {
@@ -68,6 +71,9 @@ func init() {
 		Webmailrequest,
 		Webmailquery,
 		Webmailhandle,
+		Davserver,
+		Greylist,
+		Locallist,
 	}
 	for _, name := range names {
 		metricPanic.WithLabelValues(string(name)).Add(0)
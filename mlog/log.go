@@ -160,6 +160,9 @@ var CidKey key = "cid"
 // Ideally, a Log could be passed instead, but contexts are more pervasive. For the same
 // reason WithContext is more common than WithCid.
 func (l Log) WithContext(ctx context.Context) Log {
+	if ctx == nil {
+		return l
+	}
 	cidv := ctx.Value(CidKey)
 	if cidv == nil {
 		return l
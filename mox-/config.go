@@ -24,6 +24,7 @@ import (
 	"net/url"
 	"os"
 	"os/user"
+	"path"
 	"path/filepath"
 	"regexp"
 	"slices"
@@ -39,13 +40,16 @@ import (
 	"github.com/mjl-/sconf"
 
 	"github.com/mjl-/mox/autotls"
+	"github.com/mjl-/mox/bimi"
 	"github.com/mjl-/mox/config"
 	"github.com/mjl-/mox/dkim"
+	"github.com/mjl-/mox/dmarc"
 	"github.com/mjl-/mox/dns"
 	"github.com/mjl-/mox/message"
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/moxio"
 	"github.com/mjl-/mox/mtasts"
+	"github.com/mjl-/mox/recursor"
 	"github.com/mjl-/mox/smtp"
 )
 
@@ -64,13 +68,14 @@ var (
 
 var ErrConfig = errors.New("config error")
 
-// Set by packages webadmin, webaccount, webmail, webapisrv to prevent cyclic dependencies.
+// Set by packages webadmin, webaccount, webmail, webapisrv, davserver to prevent cyclic dependencies.
 var NewWebadminHandler = func(basePath string, isForwarded bool) http.Handler { return nopHandler }
 var NewWebaccountHandler = func(basePath string, isForwarded bool) http.Handler { return nopHandler }
 var NewWebmailHandler = func(maxMsgSize int64, basePath string, isForwarded bool, accountPath string) http.Handler {
 	return nopHandler
 }
 var NewWebapiHandler = func(maxMsgSize int64, basePath string, isForwarded bool) http.Handler { return nopHandler }
+var NewDAVHandler = func(basePath string, isForwarded bool) http.Handler { return nopHandler }
 
 var nopHandler = http.HandlerFunc(nil)
 
@@ -310,6 +315,15 @@ func (c *Config) IsClientSettingsDomain(d dns.Domain) (is bool) {
 	return
 }
 
+// DMARCDiscovery returns how DMARC records and organizational domains are found
+// for incoming messages, i.e. whether DMARCbis is enabled.
+func (c *Config) DMARCDiscovery() dmarc.Discovery {
+	if c.Static.DMARCbis {
+		return dmarc.DiscoveryTreeWalk
+	}
+	return dmarc.DiscoveryPublicSuffix
+}
+
 func (c *Config) allowACMEHosts(log mlog.Log, checkACMEHosts bool) {
 	for _, l := range c.Static.Listeners {
 		if l.TLS == nil || l.TLS.ACME == "" {
@@ -600,6 +614,82 @@ func PrepareStaticConfig(ctx context.Context, log mlog.Log, configFile string, c
 		}
 	}
 
+	if c.PreauthUser != "" {
+		if u, err := user.Lookup(c.PreauthUser); err == nil {
+			if uid, err := strconv.ParseUint(u.Uid, 10, 32); err != nil {
+				addErrorf("parsing uid %s for preauth user: %v", u.Uid, err)
+			} else {
+				c.PreauthUID = uint32(uid)
+			}
+		} else if uid, err := strconv.ParseUint(c.PreauthUser, 10, 32); err != nil {
+			addErrorf("parsing unknown preauth user %s as uid: %v", c.PreauthUser, err)
+		} else {
+			c.PreauthUID = uint32(uid)
+		}
+		if c.PreauthUID == 0 || c.PreauthUID == c.UID {
+			addErrorf("preauth user %s must be different from root and from user %s", c.PreauthUser, c.User)
+		}
+	}
+
+	for _, s := range c.RateLimitAllowlist {
+		if ipnet, err := ParseIPNet(s); err != nil {
+			addErrorf("parsing rate limit allowlist ip or network %q: %v", s, err)
+		} else {
+			c.RateLimitAllowlistNets = append(c.RateLimitAllowlistNets, ipnet)
+		}
+	}
+	checkRateLimits := func(kind string, l []config.RateLimit) {
+		for _, rl := range l {
+			if rl.Window <= 0 {
+				addErrorf("%s: rate limit must have a positive window", kind)
+			}
+			if rl.IP <= 0 || rl.Subnet <= 0 || rl.Network <= 0 {
+				addErrorf("%s: rate limits must be positive", kind)
+			}
+		}
+	}
+	checkRateLimits("failed auth", c.FailedAuthRateLimits)
+
+	if c.IPBans.Failures < 0 || c.IPBans.Window < 0 || c.IPBans.Duration < 0 || c.IPBans.MaxDuration < 0 {
+		addErrorf("ip bans: failures, window and durations cannot be negative")
+	}
+	if c.IPBans.Failures == 0 {
+		c.IPBans.Failures = 20
+	}
+	if c.IPBans.Window == 0 {
+		c.IPBans.Window = time.Hour
+	}
+	if c.IPBans.Duration == 0 {
+		c.IPBans.Duration = time.Hour
+	}
+	if c.IPBans.MaxDuration == 0 {
+		c.IPBans.MaxDuration = 30 * 24 * time.Hour
+	}
+
+	if cs := c.ContentScanner; cs != nil {
+		switch cs.Protocol {
+		case "clamd":
+			if cs.Address == "" {
+				addErrorf("content scanner: address required")
+			}
+		case "icap":
+			if u, err := url.Parse(cs.Address); err != nil || u.Scheme != "icap" || u.Host == "" {
+				addErrorf("content scanner: address must be a url of the form icap://host[:port]/service")
+			}
+		default:
+			addErrorf("content scanner: unknown protocol %q, must be clamd or icap", cs.Protocol)
+		}
+		if cs.Timeout < 0 || cs.MaxSize < 0 {
+			addErrorf("content scanner: timeout and max size cannot be negative")
+		}
+		if cs.Timeout == 0 {
+			cs.Timeout = 30 * time.Second
+		}
+		if cs.MaxSize == 0 {
+			cs.MaxSize = 25 * 1024 * 1024
+		}
+	}
+
 	hostname, err := dns.ParseDomain(c.Hostname)
 	if err != nil {
 		addErrorf("parsing hostname: %s", err)
@@ -735,6 +825,7 @@ func PrepareStaticConfig(ctx context.Context, log mlog.Log, configFile string, c
 	}
 
 	var haveUnspecifiedSMTPListener bool
+	localListZones := map[dns.Domain]string{} // Zone to path, zones must refer to a single list.
 	for name, l := range c.Listeners {
 		addListenerErrorf := func(format string, args ...any) {
 			addErrorf("listener %s: %s", name, fmt.Sprintf(format, args...))
@@ -900,6 +991,70 @@ func PrepareStaticConfig(ctx context.Context, log mlog.Log, configFile string, c
 			}
 			l.SMTP.DNSBLZones = append(l.SMTP.DNSBLZones, d)
 		}
+		for _, s := range l.SMTP.URIBLs {
+			d, err := dns.ParseDomain(s)
+			if err != nil {
+				addListenerErrorf("parsing URIBL zone %q: %s", s, err)
+				continue
+			}
+			l.SMTP.URIBLZones = append(l.SMTP.URIBLZones, d)
+		}
+		if l.SMTP.URIBLMaxLookups < 0 {
+			addListenerErrorf("URIBLMaxLookups must be >= 0")
+		} else if l.SMTP.URIBLMaxLookups == 0 {
+			l.SMTP.URIBLMaxLookups = 20
+		}
+		for i, ll := range l.SMTP.LocalLists {
+			if ll.File == "" {
+				addListenerErrorf("local list without file")
+				continue
+			}
+			ll.Path = configDirPath(configFile, ll.File)
+			if _, err := os.Stat(ll.Path); err != nil {
+				addListenerErrorf("local list: %v", err)
+			}
+			if ll.Zone != "" {
+				d, err := dns.ParseDomain(ll.Zone)
+				if err != nil {
+					addListenerErrorf("parsing local list zone %q: %s", ll.Zone, err)
+				} else if p, ok := localListZones[d]; ok && p != ll.Path {
+					addListenerErrorf("local list zone %s already used for file %s", d, p)
+				} else {
+					ll.ZoneDomain = d
+					localListZones[d] = ll.Path
+				}
+			}
+			l.SMTP.LocalLists[i] = ll
+		}
+		if l.DNSLists.Enabled {
+			if len(l.DNSLists.AllowedNetworks) == 0 {
+				addListenerErrorf("dns lists require allowed networks")
+			}
+			for _, s := range l.DNSLists.AllowedNetworks {
+				if ipnet, err := ParseIPNet(s); err != nil {
+					addListenerErrorf("parsing dns lists allowed ip or network %q: %v", s, err)
+				} else {
+					l.DNSLists.AllowedNets = append(l.DNSLists.AllowedNets, ipnet)
+				}
+			}
+		}
+		if g := l.SMTP.Greylisting; g != nil {
+			if g.Delay < 0 || g.RetryWindow < 0 || g.AllowDuration < 0 {
+				addListenerErrorf("greylisting durations cannot be negative")
+			}
+			if g.Delay == 0 {
+				g.Delay = 5 * time.Minute
+			}
+			if g.RetryWindow == 0 {
+				g.RetryWindow = 24 * time.Hour
+			}
+			if g.AllowDuration == 0 {
+				g.AllowDuration = 35 * 24 * time.Hour
+			}
+			if g.RetryWindow <= g.Delay {
+				addListenerErrorf("greylisting retry window must be longer than delay")
+			}
+		}
 		if l.IPsNATed && len(l.NATIPs) > 0 {
 			addListenerErrorf("both IPsNATed and NATIPs configued (remove deprecated IPsNATed)")
 		}
@@ -931,6 +1086,27 @@ func PrepareStaticConfig(ctx context.Context, log mlog.Log, configFile string, c
 		l.WebmailHTTPS.Path = cleanPath("WebmailHTTPS", l.WebmailHTTPS.Enabled, l.WebmailHTTPS.Path)
 		l.WebAPIHTTP.Path = cleanPath("WebAPIHTTP", l.WebAPIHTTP.Enabled, l.WebAPIHTTP.Path)
 		l.WebAPIHTTPS.Path = cleanPath("WebAPIHTTPS", l.WebAPIHTTPS.Enabled, l.WebAPIHTTPS.Path)
+		l.DAVHTTP.Path = cleanPath("DAVHTTP", l.DAVHTTP.Enabled, l.DAVHTTP.Path)
+		l.DAVHTTPS.Path = cleanPath("DAVHTTPS", l.DAVHTTPS.Enabled, l.DAVHTTPS.Path)
+		checkConnectionLimits := func(kind string, cl *config.ConnectionLimits) {
+			if cl == nil {
+				return
+			}
+			checkRateLimits(fmt.Sprintf("listener %s: %s", name, kind), cl.Rate)
+			if cl.Open == nil {
+				return
+			}
+			if cl.Open.Window != 0 {
+				addListenerErrorf("%s: limit on open connections cannot have a window", kind)
+			}
+			if cl.Open.IP <= 0 || cl.Open.Subnet <= 0 || cl.Open.Network <= 0 {
+				addListenerErrorf("%s: limits on open connections must be positive", kind)
+			}
+		}
+		checkConnectionLimits("SMTP", l.RateLimits.SMTP)
+		checkConnectionLimits("Submission", l.RateLimits.Submission)
+		checkConnectionLimits("IMAP", l.RateLimits.IMAP)
+		checkConnectionLimits("HTTP", l.RateLimits.HTTP)
 		c.Listeners[name] = l
 	}
 	if haveUnspecifiedSMTPListener {
@@ -1049,14 +1225,24 @@ func PrepareStaticConfig(ctx context.Context, log mlog.Log, configFile string, c
 			addErrorf("transport %s: %s", name, fmt.Sprintf(format, args...))
 		}
 
-		if t.DisableIPv4 && t.DisableIPv6 {
+		disable4, disable6 := t.DisableIPv4, t.DisableIPv6
+		if t.IPPool != "" {
+			pool, ok := c.IPPools[t.IPPool]
+			if !ok {
+				addTransportErrorf("unknown ip pool %q", t.IPPool)
+			} else {
+				disable4 = disable4 || !slices.ContainsFunc(pool.IPs, func(pip config.IPPoolIP) bool { return pip.ParsedIP.To4() != nil })
+				disable6 = disable6 || !slices.ContainsFunc(pool.IPs, func(pip config.IPPoolIP) bool { return pip.ParsedIP.To4() == nil })
+			}
+		}
+		if disable4 && disable6 {
 			addTransportErrorf("both IPv4 and IPv6 are disabled, enable at least one")
 		}
 		t.IPFamily = "ip"
-		if t.DisableIPv4 {
+		if disable4 {
 			t.IPFamily = "ip6"
 		}
-		if t.DisableIPv6 {
+		if disable6 {
 			t.IPFamily = "ip4"
 		}
 	}
@@ -1088,6 +1274,118 @@ func PrepareStaticConfig(ctx context.Context, log mlog.Log, configFile string, c
 		}
 	}
 
+	for name, pool := range c.IPPools {
+		addPoolErrorf := func(format string, args ...any) {
+			addErrorf("ip pool %s: %s", name, fmt.Sprintf(format, args...))
+		}
+
+		if len(pool.IPs) == 0 {
+			addPoolErrorf("must have at least one ip")
+		}
+		switch pool.Selection {
+		case "", "roundrobin", "sticky":
+		default:
+			addPoolErrorf("unknown selection %q, must be roundrobin or sticky", pool.Selection)
+		}
+		seen := map[string]bool{}
+		for i, pip := range pool.IPs {
+			ip := net.ParseIP(pip.IP)
+			if ip == nil || ip.IsUnspecified() {
+				addPoolErrorf("bad ip %q", pip.IP)
+				continue
+			}
+			if seen[ip.String()] {
+				addPoolErrorf("duplicate ip %s", ip)
+			}
+			seen[ip.String()] = true
+			pool.IPs[i].ParsedIP = ip
+			pool.IPs[i].HostnameDomain = c.HostnameDomain
+			if pip.Hostname != "" {
+				d, err := dns.ParseDomain(pip.Hostname)
+				if err != nil {
+					addPoolErrorf("bad hostname %q for ip %s: %v", pip.Hostname, ip, err)
+				}
+				pool.IPs[i].HostnameDomain = d
+			}
+			if pip.WarmupStart != "" {
+				t, err := time.Parse("2006-01-02", pip.WarmupStart)
+				if err != nil {
+					addPoolErrorf("bad warmup start %q for ip %s, must be of form 2006-01-02: %v", pip.WarmupStart, ip, err)
+				}
+				pool.IPs[i].WarmupStartTime = t
+			}
+		}
+		for _, n := range pool.Warmup {
+			if n <= 0 {
+				addPoolErrorf("warmup limits must be > 0")
+				break
+			}
+		}
+	}
+
+	if rr := c.RecursiveResolver; rr != nil {
+		for _, s := range rr.TrustAnchors {
+			if _, _, err := recursor.ParseTrustAnchor(s); err != nil {
+				addErrorf("recursive resolver: bad trust anchor %q: %v", s, err)
+			}
+		}
+		if rr.CacheSize < 0 {
+			addErrorf("recursive resolver: cache size must be >= 0")
+		}
+	}
+
+	if fr := c.DMARCFailureReports; fr != nil {
+		if len(fr.Domains) == 0 {
+			addErrorf("dmarc failure reports: must have at least one domain")
+		}
+		fr.ParsedDomains = nil
+		for _, s := range fr.Domains {
+			d, err := dns.ParseDomain(s)
+			if err != nil {
+				addErrorf("dmarc failure reports: bad domain %q: %v", s, err)
+				continue
+			}
+			fr.ParsedDomains = append(fr.ParsedDomains, d)
+		}
+		if fr.MaxPerHour < 0 {
+			addErrorf("dmarc failure reports: max per hour must be >= 0")
+		}
+	}
+
+	for name, t := range c.DestinationThrottles {
+		addThrottleErrorf := func(format string, args ...any) {
+			addErrorf("destination throttle %s: %s", name, fmt.Sprintf(format, args...))
+		}
+
+		if len(t.Domains) == 0 && len(t.MXHosts) == 0 {
+			addThrottleErrorf("must have domains or mx hosts")
+		}
+		if t.MaxConcurrent < 0 || t.MessagesPerMinute < 0 || t.MessagesPerHour < 0 {
+			addThrottleErrorf("limits must be >= 0")
+		}
+		parse := func(kind, s string) string {
+			name, dot := strings.CutPrefix(s, ".")
+			d, err := dns.ParseDomain(name)
+			if err != nil {
+				addThrottleErrorf("bad %s %q: %v", kind, s, err)
+				return ""
+			}
+			if dot {
+				return "." + d.ASCII
+			}
+			return d.ASCII
+		}
+		t.DomainsASCII = nil
+		for _, s := range t.Domains {
+			t.DomainsASCII = append(t.DomainsASCII, parse("domain", s))
+		}
+		t.MXHostsASCII = nil
+		for _, s := range t.MXHosts {
+			t.MXHostsASCII = append(t.MXHostsASCII, parse("mx host", s))
+		}
+		c.DestinationThrottles[name] = t
+	}
+
 	for name, t := range c.Transports {
 		addTransportErrorf := func(format string, args ...any) {
 			addErrorf("transport %s: %s", name, fmt.Sprintf(format, args...))
@@ -1174,6 +1472,62 @@ func ParseDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string, s
 	return c, fi.ModTime(), accDests, aliases, errs
 }
 
+// checkSendLimits checks the limits and policy for outgoing messages of an
+// account or domain.
+func checkSendLimits(l *config.SendLimits, addErrorf func(format string, args ...any)) {
+	if l == nil {
+		return
+	}
+	for _, c := range []config.SendLimitCounts{l.All, l.Submission, l.WebAPI} {
+		if min(c.MessagesPerHour, c.MessagesPerDay, c.MessagesPerMonth, c.RecipientsPerHour, c.RecipientsPerDay, c.RecipientsPerMonth) < 0 {
+			addErrorf("send limits cannot be negative")
+		}
+	}
+	switch l.Policy {
+	case "", "reject", "hold", "notify":
+	default:
+		addErrorf("unknown send limit policy %q, must be reject, hold or notify", l.Policy)
+	}
+}
+
+// checkAttachmentRules checks and normalizes attachment rules of an account or
+// domain.
+func checkAttachmentRules(rules []config.AttachmentRule, addErrorf func(format string, args ...any)) {
+	for i := range rules {
+		r := &rules[i]
+		switch r.Direction {
+		case "", "incoming", "outgoing":
+		default:
+			addErrorf("attachment rule %d: unknown direction %q, must be empty, incoming or outgoing", i+1, r.Direction)
+		}
+		for j, ct := range r.ContentTypes {
+			ct = strings.ToLower(ct)
+			if _, err := path.Match(ct, ""); err != nil || !strings.Contains(ct, "/") {
+				addErrorf("attachment rule %d: invalid content type pattern %q, must be of the form type/subtype, with optional wildcards", i+1, r.ContentTypes[j])
+			}
+			r.ContentTypes[j] = ct
+		}
+		for j, ext := range r.Extensions {
+			ext = strings.ToLower(ext)
+			if len(ext) < 2 || !strings.HasPrefix(ext, ".") {
+				addErrorf("attachment rule %d: invalid extension %q, must start with a dot", i+1, r.Extensions[j])
+			}
+			r.Extensions[j] = ext
+		}
+		if r.MinSize < 0 {
+			addErrorf("attachment rule %d: MinSize cannot be negative", i+1)
+		}
+		if len(r.ContentTypes) == 0 && len(r.Extensions) == 0 && !r.EncryptedArchive && !r.UninspectableArchive && r.MinSize == 0 {
+			addErrorf("attachment rule %d: must have at least one of ContentTypes, Extensions, EncryptedArchive, UninspectableArchive or MinSize", i+1)
+		}
+		switch r.Action {
+		case "reject", "strip", "quarantine":
+		default:
+			addErrorf("attachment rule %d: unknown action %q, must be reject, strip or quarantine", i+1, r.Action)
+		}
+	}
+}
+
 func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string, static config.Static, c *config.Dynamic) (accDests map[string]AccountDestination, aliases map[string]config.Alias, errs []error) {
 	addErrorf := func(format string, args ...any) {
 		errs = append(errs, fmt.Errorf(format, args...))
@@ -1274,6 +1628,9 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 
 		domain.Domain = dnsdomain
 
+		checkSendLimits(domain.SendLimits, addDomainErrorf)
+		checkAttachmentRules(domain.AttachmentRules, addDomainErrorf)
+
 		if domain.ClientSettingsDomain != "" {
 			csd, err := dns.ParseDomain(domain.ClientSettingsDomain)
 			if err != nil {
@@ -1411,6 +1768,21 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 			}
 		}
 
+		if domain.BIMI != nil {
+			if domain.BIMI.Selector != "" {
+				if _, err := dns.ParseDomain(domain.BIMI.Selector); err != nil {
+					addDomainErrorf("invalid BIMI selector %q: %v", domain.BIMI.Selector, err)
+				}
+			}
+			if domain.BIMI.LogoURL == "" {
+				addDomainErrorf("BIMI LogoURL must be set")
+			}
+			r := bimi.Record{Version: "BIMI1", Location: domain.BIMI.LogoURL, Authority: domain.BIMI.AuthorityURL}
+			if _, _, err := bimi.ParseRecord(r.String()); err != nil {
+				addDomainErrorf("invalid BIMI logo or authority url: %v", err)
+			}
+		}
+
 		checkRoutes("routes for domain", domain.Routes)
 
 		c.Domains[d] = domain
@@ -1468,6 +1840,9 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 			acc.NotJunkMailbox = r
 		}
 
+		checkSendLimits(acc.SendLimits, addAccountErrorf)
+		checkAttachmentRules(acc.AttachmentRules, addAccountErrorf)
+
 		if acc.JunkFilter != nil {
 			params := acc.JunkFilter.Params
 			if params.MaxPower < 0 || params.MaxPower > 0.5 {
@@ -1506,16 +1881,22 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 		c.Accounts[accName] = acc
 
 		if acc.OutgoingWebhook != nil {
-			u, err := url.Parse(acc.OutgoingWebhook.URL)
-			if err == nil && (u.Scheme != "http" && u.Scheme != "https") {
-				err = errors.New("scheme must be http or https")
-			}
-			if err != nil {
-				addAccountErrorf("parsing outgoing hook url %q: %v", acc.OutgoingWebhook.URL, err)
+			if acc.OutgoingWebhook.EventStreamOnly {
+				if acc.OutgoingWebhook.URL != "" {
+					addAccountErrorf("outgoing hook url must be empty with EventStreamOnly")
+				}
+			} else {
+				u, err := url.Parse(acc.OutgoingWebhook.URL)
+				if err == nil && (u.Scheme != "http" && u.Scheme != "https") {
+					err = errors.New("scheme must be http or https")
+				}
+				if err != nil {
+					addAccountErrorf("parsing outgoing hook url %q: %v", acc.OutgoingWebhook.URL, err)
+				}
 			}
 
 			// note: outgoing hook events are in ../queue/hooks.go, ../mox-/config.go, ../queue.go and ../webapi/gendoc.sh. keep in sync.
-			outgoingHookEvents := []string{"delivered", "suppressed", "delayed", "failed", "relayed", "expanded", "canceled", "unrecognized"}
+			outgoingHookEvents := []string{"delivered", "suppressed", "delayed", "failed", "relayed", "expanded", "canceled", "unrecognized", "limitreached"}
 			for _, e := range acc.OutgoingWebhook.Events {
 				if !slices.Contains(outgoingHookEvents, e) {
 					addAccountErrorf("unknown outgoing hook event %q", e)
@@ -1523,12 +1904,18 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 			}
 		}
 		if acc.IncomingWebhook != nil {
-			u, err := url.Parse(acc.IncomingWebhook.URL)
-			if err == nil && (u.Scheme != "http" && u.Scheme != "https") {
-				err = errors.New("scheme must be http or https")
-			}
-			if err != nil {
-				addAccountErrorf("parsing incoming hook url %q: %v", acc.IncomingWebhook.URL, err)
+			if acc.IncomingWebhook.EventStreamOnly {
+				if acc.IncomingWebhook.URL != "" {
+					addAccountErrorf("incoming hook url must be empty with EventStreamOnly")
+				}
+			} else {
+				u, err := url.Parse(acc.IncomingWebhook.URL)
+				if err == nil && (u.Scheme != "http" && u.Scheme != "https") {
+					err = errors.New("scheme must be http or https")
+				}
+				if err != nil {
+					addAccountErrorf("parsing incoming hook url %q: %v", acc.IncomingWebhook.URL, err)
+				}
 			}
 		}
 
@@ -2108,6 +2495,8 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 				wi.Handler = NewWebmailHandler(config.DefaultMaxMsgSize, wi.BasePath, isForwarded, accountPath)
 			case "webapi":
 				wi.Handler = NewWebapiHandler(config.DefaultMaxMsgSize, wi.BasePath, isForwarded)
+			case "dav":
+				wi.Handler = NewDAVHandler(wi.BasePath, isForwarded)
 			default:
 				addHandlerErrorf("internal service: unknown service %q", wi.Service)
 			}
@@ -8,6 +8,7 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 )
 
 // Fork and exec as unprivileged user.
@@ -37,6 +38,17 @@ func ForkExecUnprivileged() {
 	env := os.Environ()
 	env = append(env, "MOX_SOCKETS="+strings.Join(addrs, ","), "MOX_FILES="+strings.Join(paths, ","))
 
+	// If configured, start the process for handling unauthenticated connections, as
+	// separate user. It gets the listeners for its connections, and one end of a
+	// socket pair for communicating with the main process, which gets the other end.
+	var preauth *os.Process
+	if len(passedPreauthListeners) > 0 {
+		var preauthFile *os.File
+		preauth, preauthFile = startPreauth(prog)
+		files = append(files, preauthFile)
+		env = append(env, "MOX_PREAUTH=1")
+	}
+
 	p, err := os.StartProcess(prog, os.Args, &os.ProcAttr{
 		Env:   env,
 		Files: files,
@@ -51,6 +63,10 @@ func ForkExecUnprivileged() {
 		pkglog.Fatalx("fork and exec", err)
 	}
 	CleanupPassedFiles()
+	if preauth != nil {
+		err := files[len(files)-1].Close()
+		pkglog.Check(err, "closing preauth control socket")
+	}
 
 	// If we get a interrupt/terminate signal, pass it on to the child. For interrupt,
 	// the child probably already got it.
@@ -63,14 +79,89 @@ func ForkExecUnprivileged() {
 			sig := <-sigc
 			err := p.Signal(sig)
 			pkglog.Check(err, "forwarding signal root to unprivileged process")
+			if preauth != nil {
+				err := preauth.Signal(sig)
+				pkglog.Check(err, "forwarding signal root to preauth process")
+			}
 		}
 	}()
 
+	// The main process cannot do much without the preauth process, so we stop it if
+	// the preauth process stops.
+	preauthDone := make(chan struct{})
+	if preauth != nil {
+		go func() {
+			defer close(preauthDone)
+			st, err := preauth.Wait()
+			if err != nil {
+				pkglog.Errorx("wait for preauth process", err)
+			} else {
+				pkglog.Print("preauth process stopped, stopping unprivileged process", slog.Int("exitcode", st.ExitCode()))
+			}
+			err = p.Signal(syscall.SIGTERM)
+			pkglog.Check(err, "signaling unprivileged process after preauth process stopped")
+		}()
+	}
+
 	st, err := p.Wait()
 	if err != nil {
 		pkglog.Fatalx("wait", err)
 	}
 	code := st.ExitCode()
+	if preauth != nil {
+		err := preauth.Signal(syscall.SIGTERM)
+		pkglog.Check(err, "signaling preauth process")
+		select {
+		case <-preauthDone:
+		case <-time.After(5 * time.Second):
+			err := preauth.Kill()
+			pkglog.Check(err, "killing preauth process")
+		}
+	}
 	pkglog.Print("stopping after child exit", slog.Int("exitcode", code))
 	os.Exit(code)
 }
+
+// startPreauth starts the process for handling unauthenticated connections,
+// running as the preauth user, and returns the process and the file for the main
+// process for communicating with the preauth process.
+func startPreauth(prog string) (*os.Process, *os.File) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_SEQPACKET, 0)
+	if err != nil {
+		pkglog.Fatalx("making socket pair for preauth process", err)
+	}
+	mainFile := os.NewFile(uintptr(fds[0]), "preauthmain")
+	preauthFile := os.NewFile(uintptr(fds[1]), "preauth")
+
+	files := []*os.File{os.Stdin, os.Stdout, os.Stderr}
+	var addrs []string
+	for addr, f := range passedPreauthListeners {
+		files = append(files, f)
+		addrs = append(addrs, addr)
+	}
+	files = append(files, preauthFile)
+
+	// We don't pass our environment, and start in the root directory. The preauth
+	// process does not need access to files. It gets its configuration from the main
+	// process.
+	env := []string{"MOX_SOCKETS=" + strings.Join(addrs, ","), "MOX_PREAUTH=1"}
+	args := []string{os.Args[0], "imappreauth"}
+	p, err := os.StartProcess(prog, args, &os.ProcAttr{
+		Dir:   "/",
+		Env:   env,
+		Files: files,
+		Sys: &syscall.SysProcAttr{
+			Credential: &syscall.Credential{
+				Uid: Conf.Static.PreauthUID,
+				Gid: Conf.Static.GID,
+			},
+		},
+	})
+	if err != nil {
+		pkglog.Fatalx("fork and exec preauth process", err)
+	}
+	err = preauthFile.Close()
+	pkglog.Check(err, "closing preauth end of preauth socket pair")
+	pkglog.Print("started preauth process", slog.Any("pid", p.Pid), slog.Any("uid", Conf.Static.PreauthUID))
+	return p, mainFile
+}
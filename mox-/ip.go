@@ -25,7 +25,7 @@ func Network(ip string) string {
 
 // DomainSPFIPs returns IPs to include in SPF records for domains. It includes the
 // IPs on listeners that have SMTP enabled, and includes IPs configured for SOCKS
-// transports.
+// transports and IP pools.
 func DomainSPFIPs() (ips []net.IP) {
 	for _, l := range Conf.Static.Listeners {
 		if !l.SMTP.Enabled || l.IPsNATed {
@@ -48,6 +48,11 @@ func DomainSPFIPs() (ips []net.IP) {
 			ips = append(ips, t.Socks.IPs...)
 		}
 	}
+	for _, pool := range Conf.Static.IPPools {
+		for _, pip := range pool.IPs {
+			ips = append(ips, pip.ParsedIP)
+		}
+	}
 	return ips
 }
 
@@ -125,6 +130,11 @@ func IPs(ctx context.Context, receiveOnly bool) ([]net.IP, error) {
 			ips = append(ips, t.Socks.IPs...)
 		}
 	}
+	for _, pool := range Conf.Static.IPPools {
+		for _, pip := range pool.IPs {
+			ips = append(ips, pip.ParsedIP)
+		}
+	}
 
 	return ips, nil
 }
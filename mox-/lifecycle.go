@@ -22,6 +22,14 @@ import (
 var passedListeners = map[string]*os.File{} // Listen address to file descriptor.
 var passedFiles = map[string][]*os.File{}   // Path to file descriptors.
 
+// Listen address to file descriptor, for the process handling unauthenticated
+// connections, see config PreauthUser.
+var passedPreauthListeners = map[string]*os.File{}
+
+// Unix domain socket between main process and process handling unauthenticated
+// connections. Passed in by the privileged process, indicated by $MOX_PREAUTH.
+var preauthControl *os.File
+
 // RestorePassedFiles reads addresses from $MOX_SOCKETS and paths from $MOX_FILES
 // and prepares an os.File for each file descriptor, which are used by later calls
 // of Listen or opening files.
@@ -42,16 +50,25 @@ func RestorePassedFiles() {
 		o++
 	}
 
-	files := os.Getenv("MOX_FILES")
-	if files == "" {
-		return
+	if files := os.Getenv("MOX_FILES"); files != "" {
+		for path := range strings.SplitSeq(files, ",") {
+			passedFiles[path] = append(passedFiles[path], os.NewFile(o, path))
+			o++
+		}
 	}
-	for path := range strings.SplitSeq(files, ",") {
-		passedFiles[path] = append(passedFiles[path], os.NewFile(o, path))
-		o++
+
+	if os.Getenv("MOX_PREAUTH") != "" {
+		preauthControl = os.NewFile(o, "preauth")
 	}
 }
 
+// PreauthControl returns the unix domain socket for communication between the
+// main process and the process handling unauthenticated connections, or nil if
+// not passed in by the privileged process.
+func PreauthControl() *os.File {
+	return preauthControl
+}
+
 // CleanupPassedFiles closes the listening socket file descriptors and files passed
 // in by the parent process. To be called by the unprivileged child after listeners
 // have been recreated (they dup the file descriptor), and by the privileged
@@ -67,6 +84,10 @@ func CleanupPassedFiles() {
 			pkglog.Check(err, "closing path file descriptor")
 		}
 	}
+	for _, f := range passedPreauthListeners {
+		err := f.Close()
+		pkglog.Check(err, "closing preauth listener socket file descriptor")
+	}
 }
 
 // For privileged file descriptor operations (listen and opening privileged files),
@@ -114,6 +135,70 @@ func Listen(network, addr string) (net.Listener, error) {
 	return ln, err
 }
 
+// ListenPacket is like Listen, but for packet-oriented (UDP) connections.
+func ListenPacket(network, addr string) (net.PacketConn, error) {
+	// Listeners are keyed by address, prefix with the network to prevent clashing
+	// with a TCP listener on the same address.
+	key := network + "/" + addr
+
+	if os.Getuid() != 0 && !FilesImmediate {
+		f, ok := passedListeners[key]
+		if !ok {
+			return nil, fmt.Errorf("no file descriptor for listener %s", key)
+		}
+		pc, err := net.FilePacketConn(f)
+		if err != nil {
+			return nil, fmt.Errorf("making packet connection from file descriptor for address %s: %v", key, err)
+		}
+		return pc, nil
+	}
+
+	if _, ok := passedListeners[key]; ok {
+		return nil, fmt.Errorf("duplicate listener: %s", key)
+	}
+
+	pc, err := net.ListenPacket(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if !FilesImmediate {
+		udpconn, ok := pc.(*net.UDPConn)
+		if !ok {
+			return nil, fmt.Errorf("packet connection not udp, but %T, for network %s, address %s", pc, network, addr)
+		}
+		f, err := udpconn.File()
+		if err != nil {
+			return nil, fmt.Errorf("dup packet connection: %v", err)
+		}
+		passedListeners[key] = f
+	}
+	return pc, err
+}
+
+// ListenPreauth creates a network listener as root, for passing to the process
+// handling unauthenticated connections instead of to the unprivileged main
+// process.
+func ListenPreauth(network, addr string) error {
+	if _, ok := passedPreauthListeners[addr]; ok {
+		return fmt.Errorf("duplicate listener: %s", addr)
+	}
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	tcpln, ok := ln.(*net.TCPListener)
+	if !ok {
+		return fmt.Errorf("listener not a tcp listener, but %T, for network %s, address %s", ln, network, addr)
+	}
+	f, err := tcpln.File()
+	if err != nil {
+		return fmt.Errorf("dup listener: %v", err)
+	}
+	passedPreauthListeners[addr] = f
+	return nil
+}
+
 // Open a privileged file, such as a TLS private key. When running as root
 // (during startup), the file is opened and the file descriptor is stored.
 // These file descriptors are passed to the unprivileged process. When in the
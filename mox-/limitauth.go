@@ -8,19 +8,20 @@ import (
 
 var LimiterFailedAuth *ratelimit.Limiter
 
-// LimitesrsInit initializes the failed auth rate limiter.
+// LimitesrsInit initializes the failed auth rate limiter, with the limits from
+// the config, or the defaults. The limiter is registered for keeping counts
+// across restarts.
 func LimitersInit() {
-	LimiterFailedAuth = &ratelimit.Limiter{
-		WindowLimits: []ratelimit.WindowLimit{
-			{
-				// Max 10 failures/minute for ipmasked1, 30 or ipmasked2, 90 for ipmasked3.
-				Window: time.Minute,
-				Limits: [...]int64{10, 30, 90},
-			},
-			{
-				Window: 24 * time.Hour,
-				Limits: [...]int64{50, 150, 450},
-			},
+	LimiterFailedAuth = NewLimiter(Conf.Static.FailedAuthRateLimits, []ratelimit.WindowLimit{
+		{
+			// Max 10 failures/minute for ipmasked1, 30 or ipmasked2, 90 for ipmasked3.
+			Window: time.Minute,
+			Limits: [...]int64{10, 30, 90},
 		},
-	}
+		{
+			Window: 24 * time.Hour,
+			Limits: [...]int64{50, 150, 450},
+		},
+	})
+	RegisterLimiter("failedauth", LimiterFailedAuth, true)
 }
@@ -0,0 +1,215 @@
+package mox
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/moxio"
+	"github.com/mjl-/mox/ratelimit"
+)
+
+// Rate limiters by name, for listing and clearing limited IPs in the admin web
+// interface, and for keeping counts across restarts.
+var limiters = struct {
+	sync.Mutex
+	m map[string]namedLimiter
+}{m: map[string]namedLimiter{}}
+
+type namedLimiter struct {
+	limiter *ratelimit.Limiter
+	persist bool
+	open    bool // Counts open connections, not cleared or persisted.
+}
+
+// RegisterLimiter registers a limiter by name, replacing an earlier limiter with
+// the same name. If persist is set, counts are saved by LimitersSave and restored
+// by LimitersLoad.
+func RegisterLimiter(name string, l *ratelimit.Limiter, persist bool) {
+	limiters.Lock()
+	defer limiters.Unlock()
+	limiters.m[name] = namedLimiter{l, persist, false}
+}
+
+// RegisterOpenLimiter registers a limiter for open connections by name, for
+// listing only. Its counts are decreased when connections close, so they are not
+// cleared by LimiterClear, and not saved and restored.
+func RegisterOpenLimiter(name string, l *ratelimit.Limiter) {
+	limiters.Lock()
+	defer limiters.Unlock()
+	limiters.m[name] = namedLimiter{l, false, true}
+}
+
+// Limiters returns the registered limiters, by name.
+func Limiters() map[string]*ratelimit.Limiter {
+	limiters.Lock()
+	defer limiters.Unlock()
+	m := make(map[string]*ratelimit.Limiter, len(limiters.m))
+	for name, nl := range limiters.m {
+		m[name] = nl.limiter
+	}
+	return m
+}
+
+// IsOpenLimiter returns whether the limiter with the name was registered as
+// limiter for open connections.
+func IsOpenLimiter(name string) bool {
+	limiters.Lock()
+	defer limiters.Unlock()
+	return limiters.m[name].open
+}
+
+// LimiterClear clears the counts for an IP or network, in the limiter with the
+// name, or in all limiters if name is empty. Limiters for open connections are
+// not cleared.
+func LimiterClear(name string, ipnet net.IPNet) error {
+	limiters.Lock()
+	defer limiters.Unlock()
+	if name != "" {
+		nl, ok := limiters.m[name]
+		if !ok {
+			return fmt.Errorf("unknown rate limiter %q", name)
+		} else if nl.open {
+			return fmt.Errorf("cannot clear limiter %q for open connections", name)
+		}
+		nl.limiter.Clear(ipnet)
+		return nil
+	}
+	for _, nl := range limiters.m {
+		if !nl.open {
+			nl.limiter.Clear(ipnet)
+		}
+	}
+	return nil
+}
+
+// NewLimiter returns a limiter with the configured rate limits, or with the
+// default window limits if none are configured. IPs in the configured
+// RateLimitAllowlist are not limited.
+func NewLimiter(limits []config.RateLimit, defaults []ratelimit.WindowLimit) *ratelimit.Limiter {
+	l := &ratelimit.Limiter{
+		WindowLimits: slices.Clone(defaults),
+		Allowlist:    Conf.Static.RateLimitAllowlistNets,
+	}
+	if len(limits) > 0 {
+		l.WindowLimits = nil
+		for _, rl := range limits {
+			l.WindowLimits = append(l.WindowLimits, ratelimit.WindowLimit{
+				Window: rl.Window,
+				Limits: [...]int64{rl.IP, rl.Subnet, rl.Network},
+			})
+		}
+	}
+	return l
+}
+
+// NewOpenLimiter returns a limiter for open connections, with the configured
+// limit, or with the default limit if not configured. IPs in the configured
+// RateLimitAllowlist are not limited.
+func NewOpenLimiter(limit *config.RateLimit, defaults [3]int64) *ratelimit.Limiter {
+	if limit != nil {
+		defaults = [...]int64{limit.IP, limit.Subnet, limit.Network}
+	}
+	return &ratelimit.Limiter{
+		WindowLimits: []ratelimit.WindowLimit{
+			{
+				Window: time.Duration(math.MaxInt64), // All of time.
+				Limits: defaults,
+			},
+		},
+		Allowlist: Conf.Static.RateLimitAllowlistNets,
+	}
+}
+
+// File in data directory with counts of persisted limiters.
+const limitersFile = "ratelimits.json"
+
+// LimitersLoad restores the counts of registered persisted limiters, as saved by
+// LimitersSave. Counts of windows that have passed are ignored. To be called
+// after all limiters have been registered, before accepting connections.
+func LimitersLoad(log mlog.Log) {
+	buf, err := os.ReadFile(DataDirPath(limitersFile))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorx("reading rate limiter counts", err)
+		}
+		return
+	}
+	var saved map[string][]ratelimit.Entry
+	if err := json.Unmarshal(buf, &saved); err != nil {
+		log.Errorx("parsing rate limiter counts", err)
+		return
+	}
+
+	limiters.Lock()
+	defer limiters.Unlock()
+	now := time.Now()
+	for name, entries := range saved {
+		if nl, ok := limiters.m[name]; ok && nl.persist {
+			nl.limiter.Restore(entries, now)
+		}
+	}
+	log.Debug("restored rate limiter counts", slog.Int("limiters", len(saved)))
+}
+
+// LimitersSave saves the counts of registered persisted limiters, for restoring
+// with LimitersLoad after a restart.
+func LimitersSave(log mlog.Log) error {
+	limiters.Lock()
+	names := slices.Sorted(maps.Keys(limiters.m))
+	saved := map[string][]ratelimit.Entry{}
+	now := time.Now()
+	for _, name := range names {
+		nl := limiters.m[name]
+		if !nl.persist {
+			continue
+		}
+		if entries := nl.limiter.Entries(now); len(entries) > 0 {
+			saved[name] = entries
+		}
+	}
+	limiters.Unlock()
+
+	buf, err := json.Marshal(saved)
+	if err != nil {
+		return fmt.Errorf("marshal rate limiter counts: %v", err)
+	}
+	p := DataDirPath(limitersFile)
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0660); err != nil {
+		return fmt.Errorf("write rate limiter counts: %v", err)
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		return fmt.Errorf("rename rate limiter counts file: %v", err)
+	}
+	if err := moxio.SyncDir(log, filepath.Dir(p)); err != nil {
+		return fmt.Errorf("sync data dir after writing rate limiter counts: %v", err)
+	}
+	return nil
+}
+
+// ParseIPNet parses an IP network in CIDR notation, or a single IP, which is
+// returned as a /32 or /128 network.
+func ParseIPNet(s string) (net.IPNet, error) {
+	if ip := net.ParseIP(s); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			return net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	_, ipnet, err := net.ParseCIDR(s)
+	if err != nil {
+		return net.IPNet{}, err
+	}
+	return *ipnet, nil
+}
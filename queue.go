@@ -621,9 +621,9 @@ func flagHookFilterSort(fs *flag.FlagSet, f *queue.HookFilter, s *queue.HookSort
 	fs.StringVar(&f.Account, "account", "", "account that queued the message/webhook")
 	fs.StringVar(&f.Submitted, "submitted", "", `filter by time of submission relative to now, value must start with "<" (before now) or ">" (after now)`)
 	fs.StringVar(&f.NextAttempt, "nextattempt", "", `filter by time of next delivery attempt relative to now, value must start with "<" (before now) or ">" (after now)`)
-	fs.Func("event", `event this webhook is about: incoming, delivered, suppressed, delayed, failed, relayed, expanded, canceled, unrecognized`, func(v string) error {
+	fs.Func("event", `event this webhook is about: incoming, delivered, suppressed, delayed, failed, relayed, expanded, canceled, unrecognized, limitreached`, func(v string) error {
 		switch v {
-		case "incoming", "delivered", "suppressed", "delayed", "failed", "relayed", "expanded", "canceled", "unrecognized":
+		case "incoming", "delivered", "suppressed", "delayed", "failed", "relayed", "expanded", "canceled", "unrecognized", "limitreached":
 			f.Event = v
 		default:
 			return fmt.Errorf("invalid parameter %q", v)
@@ -663,9 +663,9 @@ func flagHookRetiredFilterSort(fs *flag.FlagSet, f *queue.HookRetiredFilter, s *
 	fs.StringVar(&f.Account, "account", "", "account that queued the message/webhook")
 	fs.StringVar(&f.Submitted, "submitted", "", `filter by time of submission relative to now, value must start with "<" (before now) or ">" (after now)`)
 	fs.StringVar(&f.LastActivity, "lastactivity", "", `filter by time of last activity relative to now, value must start with "<" (before now) or ">" (after now)`)
-	fs.Func("event", `event this webhook is about: incoming, delivered, suppressed, delayed, failed, relayed, expanded, canceled, unrecognized`, func(v string) error {
+	fs.Func("event", `event this webhook is about: incoming, delivered, suppressed, delayed, failed, relayed, expanded, canceled, unrecognized, limitreached`, func(v string) error {
 		switch v {
-		case "incoming", "delivered", "suppressed", "delayed", "failed", "relayed", "expanded", "canceled", "unrecognized":
+		case "incoming", "delivered", "suppressed", "delayed", "failed", "relayed", "expanded", "canceled", "unrecognized", "limitreached":
 			f.Event = v
 		default:
 			return fmt.Errorf("invalid parameter %q", v)
@@ -9,6 +9,7 @@ import (
 	"log/slog"
 	"net"
 	"os"
+	"slices"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -160,6 +161,9 @@ func deliverDirect(qlog mlog.Log, resolver dns.Resolver, dialer smtpclient.Diale
 		return
 	}
 
+	// Destination throttles can match on MX hosts.
+	destinationMXHosts(m0.RecipientDomain, hostPrefs)
+
 	tlsRequiredNo := m0.RequireTLS != nil && !*m0.RequireTLS
 
 	// Check for MTA-STS policy and enforce it if needed.
@@ -195,6 +199,12 @@ func deliverDirect(qlog mlog.Log, resolver dns.Resolver, dialer smtpclient.Diale
 	var remoteMTA dsn.NameIP
 	var lastErr = errors.New("no error") // Can be smtpclient.Error.
 	nmissingRequireTLS := 0
+	// Hosts we could not connect to because the IPs of the IP pool for their address
+	// families reached their warm-up limit.
+	nipPoolExhausted := 0
+	// Failure for the destination throttle and stats, registered once for the delivery
+	// attempt after trying the hosts. Rate limiting by any host takes precedence.
+	var destFailure string
 	// todo: should make distinction between host permanently not accepting the message, and the message not being deliverable permanently. e.g. a mx host may have a size limit, or not accept 8bitmime, while another host in the list does accept the message. same for smtputf8, ../rfc/6531:555
 	for _, hp := range hostPrefs {
 		h := hp.Host
@@ -286,9 +296,24 @@ func deliverDirect(qlog mlog.Log, resolver dns.Resolver, dialer smtpclient.Diale
 		}
 
 		remoteMTA = dsn.NameIP{Name: h.XString(false), IP: remoteIP}
-		if result.err != nil {
+		if result.err != nil && errors.Is(result.err, errIPPoolExhausted) {
+			nqlog.Infox("not connecting to host", result.err, slog.Any("host", h))
+			lastErr = result.err
+			nipPoolExhausted++
+			continue
+		} else if result.err != nil {
 			lastErr = result.err
 			var cerr smtpclient.Error
+			failure := destTempError
+			if isRateLimited(result.err) {
+				nqlog.Info("remote smtp server appears to be rate limiting, backing off for destination", slog.Any("host", h))
+				failure = destRateLimited
+			} else if errors.As(result.err, &cerr) && cerr.Permanent {
+				failure = destPermError
+			}
+			if destFailure != destRateLimited {
+				destFailure = failure
+			}
 			if errors.As(result.err, &cerr) {
 				if cerr.Secode == smtp.SePol7MissingReqTLS30 {
 					nmissingRequireTLS++
@@ -300,6 +325,19 @@ func deliverDirect(qlog mlog.Log, resolver dns.Resolver, dialer smtpclient.Diale
 			continue
 		}
 
+		results := destResults{delivered: len(result.delivered)}
+		for _, mr := range result.failed {
+			resp := smtpclient.Error(mr.resp)
+			if isRateLimited(resp) {
+				results.rateLimited++
+			} else if resp.Permanent {
+				results.permErrors++
+			} else {
+				results.tempErrors++
+			}
+		}
+		destinationResult(m0.RecipientDomain, results)
+
 		delMsgs := make([]Msg, len(result.delivered))
 		for i, mr := range result.delivered {
 			mqlog := nqlog.With(slog.Int64("msgid", mr.msg.ID), slog.Any("recipient", mr.msg.Recipient()))
@@ -346,6 +384,44 @@ func deliverDirect(qlog mlog.Log, resolver dns.Resolver, dialer smtpclient.Diale
 	// failures.
 	// todo: possibly detect that future deliveries will fail due to long ttl's of cached records that are preventing delivery.
 
+	// If we could not try any host because the IPs of the IP pool reached their
+	// warm-up limit, we postpone delivery until the next day, like when all IPs of the
+	// pool are exhausted. This does not count as an attempt.
+	if nipPoolExhausted > 0 && destFailure == "" {
+		now := time.Now()
+		err := DB.Write(context.Background(), func(tx *bstore.Tx) error {
+			for _, m := range msgs {
+				var lastAttempt *time.Time
+				if n := len(m.Results); n >= 2 {
+					t := m.Results[n-2].Start
+					lastAttempt = &t
+				}
+				ipWarmupPostpone(m, lastAttempt, now)
+				if err := tx.Update(m); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			qlog.Errorx("updating messages for postponed delivery", err)
+		} else {
+			qlog.Info("ips in ip pool for address families of remote hosts reached warm-up limit for today, postponing delivery", slog.String("pool", transportDirect.IPPool), slog.Time("nextattempt", m0.NextAttempt))
+			metricIPWarmupPostponed.WithLabelValues(transportDirect.IPPool).Inc()
+		}
+		kick()
+		return
+	}
+
+	switch destFailure {
+	case destRateLimited:
+		destinationResult(m0.RecipientDomain, destResults{rateLimited: len(msgs)})
+	case destPermError:
+		destinationResult(m0.RecipientDomain, destResults{permErrors: len(msgs)})
+	case destTempError:
+		destinationResult(m0.RecipientDomain, destResults{tempErrors: len(msgs)})
+	}
+
 	// If we failed due to requiretls not being satisfied, make the delivery permanent.
 	// It is unlikely the recipient domain will implement requiretls during our retry
 	// period. Best to let the sender know immediately.
@@ -589,11 +665,43 @@ func deliverHost(log mlog.Log, resolver dns.Resolver, dialer smtpclient.Dialer,
 		return deliverResult{err: smtpErr}
 	}
 
+	// Local IPs to connect from, from the IP pool if configured.
+	localIPs := mox.Conf.Static.SpecifiedSMTPListenIPs
+	var pool *config.IPPool
+	if transportDirect != nil && transportDirect.IPPool != "" {
+		if p, ok := mox.Conf.Static.IPPools[transportDirect.IPPool]; ok {
+			pool = &p
+			localIPs = ipPoolSelect(log, transportDirect.IPPool, p, m0.RecipientDomain.Domain)
+			log.Debug("selected local ips from ip pool", slog.String("pool", transportDirect.IPPool), slog.Any("localips", localIPs))
+
+			// IPs of an address family can all be at their warm-up limit. We never dial
+			// without a local IP from the pool, so we only connect to remote IPs we have a
+			// local IP for. If the pool has IPs for a skipped address family, they are at
+			// their warm-up limit and the delivery attempt is postponed.
+			sameFamily := func(a, b net.IP) bool { return (a.To4() != nil) == (b.To4() != nil) }
+			var exhausted bool
+			ips = slices.DeleteFunc(ips, func(ip net.IP) bool {
+				if slices.ContainsFunc(localIPs, func(lip net.IP) bool { return sameFamily(lip, ip) }) {
+					return false
+				}
+				exhausted = exhausted || slices.ContainsFunc(p.IPs, func(pip config.IPPoolIP) bool { return sameFamily(pip.ParsedIP, ip) })
+				return true
+			})
+			if err == nil && len(ips) == 0 {
+				if exhausted {
+					err = fmt.Errorf("%w: ip pool %s", errIPPoolExhausted, transportDirect.IPPool)
+				} else {
+					err = fmt.Errorf("no ip in ip pool %s for address family of remote host", transportDirect.IPPool)
+				}
+			}
+		}
+	}
+
 	// Dial the remote host given the IPs if no error yet.
 	var conn net.Conn
 	if err == nil {
 		connectionCounter.Add(1)
-		conn, remoteIP, err = smtpclient.Dial(ctx, log.Logger, dialer, host, ips, 25, m0.DialedIPs, mox.Conf.Static.SpecifiedSMTPListenIPs)
+		conn, remoteIP, err = smtpclient.Dial(ctx, log.Logger, dialer, host, ips, 25, m0.DialedIPs, localIPs)
 	}
 	cancel()
 
@@ -622,6 +730,29 @@ func deliverHost(log mlog.Log, resolver dns.Resolver, dialer smtpclient.Dialer,
 
 	// todo future: get closer to timeouts specified in rfc? ../rfc/5321:3610
 	log = log.With(slog.Any("remoteip", remoteIP))
+
+	// With an IP pool, we use the hostname configured for the local IP we connected
+	// from, and count delivered messages for the warm-up schedule.
+	if pool != nil {
+		addr, ok := conn.LocalAddr().(*net.TCPAddr)
+		if ok {
+			ourHostname, ok = ipPoolHostname(*pool, addr.IP)
+		}
+		if !ok {
+			err := conn.Close()
+			log.Check(err, "closing connection")
+			return deliverResult{err: fmt.Errorf("connected from local address %s not in ip pool %s", conn.LocalAddr(), transportDirect.IPPool)}
+		}
+		if len(pool.Warmup) > 0 {
+			defer func() {
+				if len(result.delivered) > 0 {
+					err := ipWarmupAdd(context.Background(), addr.IP, len(result.delivered))
+					log.Check(err, "adding delivered messages to ip warm-up count")
+				}
+			}()
+		}
+		log = log.With(slog.Any("localip", addr.IP))
+	}
 	ctx, cancel = context.WithTimeout(mox.Shutdown, 30*time.Minute)
 	defer cancel()
 	mox.Connections.Register(conn, "smtpclient", "queue")
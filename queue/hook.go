@@ -60,7 +60,7 @@ type Hook struct {
 	Extra      map[string]string // From submitted message.
 
 	Account       string `bstore:"nonzero"`
-	URL           string `bstore:"nonzero"` // Taken from config when webhook is scheduled.
+	URL           string // Taken from config when webhook is scheduled. Empty for hooks that are only available through the webapi event stream.
 	Authorization string // Optional value for authorization header to include in HTTP request.
 	IsIncoming    bool
 	OutgoingEvent string // Empty string if not outgoing.
@@ -68,7 +68,7 @@ type Hook struct {
 
 	Submitted   time.Time `bstore:"default now,index"`
 	Attempts    int
-	NextAttempt time.Time `bstore:"nonzero,index"` // Index for fast scheduling.
+	NextAttempt time.Time `bstore:"nonzero,index"` // Index for fast scheduling. For hooks without URL, the time at which the hook is retired as failed if it hasn't been acknowledged through the event stream.
 	Results     []HookResult
 }
 
@@ -145,7 +145,7 @@ type HookRetired struct {
 	Extra      map[string]string // From submitted message.
 
 	Account       string `bstore:"nonzero,index Account+LastActivity"`
-	URL           string `bstore:"nonzero"` // Taken from config at start of each attempt.
+	URL           string // Taken from config at start of each attempt. Empty for hooks only available through the webapi event stream.
 	Authorization bool   // Whether request had authorization without keeping it around.
 	IsIncoming    bool
 	OutgoingEvent string
@@ -980,6 +980,11 @@ func parseSMTPCodes(line string) (code int, secode string) {
 // Insert hook into database, but first retire any existing pending hook for
 // QueueMsgID if it is > 0.
 func hookInsert(tx *bstore.Tx, h *Hook, now time.Time, accountKeepPeriod time.Duration) error {
+	if h.URL == "" {
+		// Only available through the event stream. We give the same time for
+		// acknowledgement as we spend on delivery attempts for regular webhooks.
+		h.NextAttempt = now.Add(hookStreamPeriod)
+	}
 	if err := tx.Insert(h); err != nil {
 		return fmt.Errorf("insert webhook: %v", err)
 	}
@@ -1039,6 +1044,7 @@ func hookqueueKick() {
 	case hookqueue <- struct{}{}:
 	default:
 	}
+	hookStreamKick()
 }
 
 func startHookQueue(done chan struct{}) {
@@ -1078,6 +1084,7 @@ func hookNextWork(ctx context.Context, log mlog.Log, busyURLs map[string]struct{
 		}
 		q.FilterNotEqual("URL", urls...)
 	}
+	// Hooks without URL are also returned, we need to expire them.
 	q.SortAsc("NextAttempt")
 	q.Limit(1)
 	h, err := q.Get()
@@ -1102,11 +1109,13 @@ func hookLaunchWork(log mlog.Log, busyURLs map[string]struct{}) int {
 		}
 		q.FilterNotEqual("URL", urls...)
 	}
-	var hooks []Hook
+	var hooks, expired []Hook
 	seen := map[string]bool{}
 	err := q.ForEach(func(h Hook) error {
 		u := h.URL
-		if _, ok := busyURLs[u]; !ok && !seen[u] {
+		if u == "" {
+			expired = append(expired, h)
+		} else if _, ok := busyURLs[u]; !ok && !seen[u] {
 			seen[u] = true
 			hooks = append(hooks, h)
 		}
@@ -1118,6 +1127,9 @@ func hookLaunchWork(log mlog.Log, busyURLs map[string]struct{}) int {
 		return -1
 	}
 
+	for _, h := range expired {
+		hookStreamExpire(log, h)
+	}
 	for _, h := range hooks {
 		busyURLs[h.URL] = struct{}{}
 		go hookDeliver(log, h)
@@ -1127,10 +1139,18 @@ func hookLaunchWork(log mlog.Log, busyURLs map[string]struct{}) int {
 
 var hookIntervals []time.Duration
 
+// Period after which hooks that are only available through the event stream are
+// retired as failed when they haven't been acknowledged. Same as the period
+// between the first and last delivery attempt of regular webhooks.
+var hookStreamPeriod time.Duration
+
 func init() {
 	const M = time.Minute
 	const H = time.Hour
 	hookIntervals = []time.Duration{M, 2 * M, 4 * M, 15 * M / 2, 15 * M, 30 * M, 1 * H, 2 * H, 4 * H, 8 * H, 16 * H}
+	for _, d := range hookIntervals {
+		hookStreamPeriod += d
+	}
 }
 
 func hookDeliver(log mlog.Log, h Hook) {
@@ -683,3 +683,80 @@ func TestHookListFilterSort(t *testing.T) {
 	tcheck(t, err, "list single")
 	tcompare(t, lr, []HookRetired{hrlrev[0]})
 }
+
+// Test hooks retrieved through the event stream, with acknowledgement and expiration.
+func TestHookStream(t *testing.T) {
+	_, cleanup := setup(t)
+	defer cleanup()
+
+	kick, unsubscribe := HookStreamSubscribe()
+	defer unsubscribe()
+
+	now := time.Now().Round(0)
+	h := Hook{0, 0, "fromid", "messageid", "subj", nil, "stream", "", "", false, "delivered", `{"Event":"delivered"}`, now, 0, now, []HookResult{}}
+	hl := []Hook{h, h, h}
+	hl[2].IsIncoming = true
+	hl[2].OutgoingEvent = ""
+	err := DB.Write(ctxbg, func(tx *bstore.Tx) error {
+		for i := range hl {
+			err := hookInsert(tx, &hl[i], now, time.Minute)
+			tcheck(t, err, "insert hook")
+		}
+		return nil
+	})
+	tcheck(t, err, "inserting hooks")
+	tcompare(t, hl[0].NextAttempt, now.Add(hookStreamPeriod))
+
+	hookqueueKick()
+	select {
+	case <-kick:
+	default:
+		t.Fatalf("no kick for event stream subscriber")
+	}
+
+	l, err := HookStreamList(ctxbg, "stream", 0, 10)
+	tcheck(t, err, "list events")
+	tcompare(t, len(l), 3)
+	tcompare(t, l[0], HookEvent{hl[0].ID, false, "delivered", hl[0].Payload})
+	tcompare(t, l[2].Event, "incoming")
+
+	l, err = HookStreamList(ctxbg, "mjl", 0, 10)
+	tcheck(t, err, "list events for other account")
+	tcompare(t, len(l), 0)
+
+	// Acknowledge first hook, it is retired successfully but still listed.
+	n, err := HookAcknowledge(ctxbg, pkglog, "stream", hl[0].ID)
+	tcheck(t, err, "acknowledge")
+	tcompare(t, n, 1)
+	hr := HookRetired{ID: hl[0].ID}
+	err = DB.Get(ctxbg, &hr)
+	tcheck(t, err, "get retired hook")
+	tcompare(t, hr.Success, true)
+	l, err = HookStreamList(ctxbg, "stream", 0, 2)
+	tcheck(t, err, "list events")
+	tcompare(t, len(l), 2)
+	tcompare(t, l[0].ID, hl[0].ID)
+	tcompare(t, l[1].ID, hl[1].ID)
+
+	l, err = HookStreamList(ctxbg, "stream", hl[1].ID, 10)
+	tcheck(t, err, "list events")
+	tcompare(t, len(l), 1)
+	tcompare(t, l[0].ID, hl[2].ID)
+
+	// Unacknowledged hooks are retired as failed when launching work.
+	_, err = HookNextAttemptSet(ctxbg, HookFilter{Account: "stream"}, now.Add(-time.Second))
+	tcheck(t, err, "set next attempt")
+	hookLaunchWork(pkglog, map[string]struct{}{})
+	qn, err := HookQueueSize(ctxbg)
+	tcheck(t, err, "hook queue size")
+	tcompare(t, qn, 0)
+	hr = HookRetired{ID: hl[1].ID}
+	err = DB.Get(ctxbg, &hr)
+	tcheck(t, err, "get retired hook")
+	tcompare(t, hr.Success, false)
+
+	// Acknowledging retired hooks is a no-op.
+	n, err = HookAcknowledge(ctxbg, pkglog, "stream", hl[2].ID)
+	tcheck(t, err, "acknowledge")
+	tcompare(t, n, 0)
+}
@@ -0,0 +1,173 @@
+package queue
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/mlog"
+)
+
+// Webhooks can also be retrieved by clients through an event stream (see
+// ../webapisrv), e.g. for clients that cannot receive HTTP requests. Hooks
+// without URL are only available through the event stream. Hooks are
+// acknowledged by clients through the ID of the last seen hook, and
+// acknowledged hooks are retired as successfully delivered.
+
+// HookEvent is a hook as returned for the event stream, either from the webhook
+// queue or from the retired webhooks.
+type HookEvent struct {
+	ID         int64  // Hook ID, used as event ID.
+	IsIncoming bool   // If set, Payload is a webhook.Incoming, otherwise webhook.Outgoing.
+	Event      string // "incoming" or outgoing event, e.g. "delivered".
+	Payload    string // JSON data.
+}
+
+var hookStream = struct {
+	sync.Mutex
+	subscribers map[chan struct{}]struct{}
+}{subscribers: map[chan struct{}]struct{}{}}
+
+// HookStreamSubscribe returns a channel on which a message is sent when new hooks
+// may have been queued. The returned function must be called to unsubscribe.
+func HookStreamSubscribe() (chan struct{}, func()) {
+	c := make(chan struct{}, 1)
+	hookStream.Lock()
+	defer hookStream.Unlock()
+	hookStream.subscribers[c] = struct{}{}
+	return c, func() {
+		hookStream.Lock()
+		defer hookStream.Unlock()
+		delete(hookStream.subscribers, c)
+	}
+}
+
+func hookStreamKick() {
+	hookStream.Lock()
+	defer hookStream.Unlock()
+	for c := range hookStream.subscribers {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// HookStreamList returns up to max hooks for the account with an ID larger than
+// lastID, from both the webhook queue and the retired webhooks, ordered by ID.
+func HookStreamList(ctx context.Context, accountName string, lastID int64, max int) ([]HookEvent, error) {
+	var l []HookEvent
+	err := DB.Read(ctx, func(tx *bstore.Tx) error {
+		q := bstore.QueryTx[Hook](tx)
+		q.FilterNonzero(Hook{Account: accountName})
+		q.FilterGreater("ID", lastID)
+		q.SortAsc("ID")
+		q.Limit(max)
+		err := q.ForEach(func(h Hook) error {
+			l = append(l, hookEvent(h.ID, h.IsIncoming, h.OutgoingEvent, h.Payload))
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("listing hooks: %v", err)
+		}
+
+		qr := bstore.QueryTx[HookRetired](tx)
+		qr.FilterNonzero(HookRetired{Account: accountName})
+		qr.FilterGreater("ID", lastID)
+		qr.SortAsc("ID")
+		qr.Limit(max)
+		err = qr.ForEach(func(hr HookRetired) error {
+			l = append(l, hookEvent(hr.ID, hr.IsIncoming, hr.OutgoingEvent, hr.Payload))
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("listing retired hooks: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(l, func(a, b HookEvent) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	if len(l) > max {
+		l = l[:max]
+	}
+	return l, nil
+}
+
+func hookEvent(id int64, isIncoming bool, outgoingEvent, payload string) HookEvent {
+	event := outgoingEvent
+	if isIncoming {
+		event = "incoming"
+	}
+	return HookEvent{id, isIncoming, event, payload}
+}
+
+// HookAcknowledge retires all hooks in the queue for the account with an ID up
+// to and including lastID as successfully delivered, because they were received
+// through the event stream.
+func HookAcknowledge(ctx context.Context, log mlog.Log, accountName string, lastID int64) (affected int, err error) {
+	var hooks []Hook
+	err = DB.Write(ctx, func(tx *bstore.Tx) error {
+		q := bstore.QueryTx[Hook](tx)
+		q.FilterNonzero(Hook{Account: accountName})
+		q.FilterLessEqual("ID", lastID)
+		q.Gather(&hooks)
+		n, err := q.Delete()
+		if err != nil {
+			return fmt.Errorf("selecting and deleting acknowledged hooks from queue: %v", err)
+		}
+
+		now := time.Now()
+		keep := hookRetiredKeep(accountName)
+		if keep > 0 {
+			for _, h := range hooks {
+				hr := h.Retired(true, now, now.Add(keep))
+				hr.Results = append(hr.Results, HookResult{Start: now, Success: true, Response: "acknowledged through event stream"})
+				if err := tx.Insert(&hr); err != nil {
+					return fmt.Errorf("inserting retired hook: %v", err)
+				}
+			}
+		}
+		affected = n
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, h := range hooks {
+		log.Debug("hook acknowledged through event stream", h.attrs()...)
+	}
+	return affected, nil
+}
+
+// hookStreamExpire retires a hook without URL that wasn't acknowledged in time.
+func hookStreamExpire(log mlog.Log, h Hook) {
+	err := DB.Write(context.Background(), func(tx *bstore.Tx) error {
+		if err := tx.Delete(&h); err == bstore.ErrAbsent {
+			// Acknowledged in the mean time.
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("removing expired webhook from database: %v", err)
+		}
+		now := time.Now()
+		keep := hookRetiredKeep(h.Account)
+		if keep > 0 {
+			hr := h.Retired(false, now, now.Add(keep))
+			hr.Results = append(hr.Results, HookResult{Start: now, Error: "not acknowledged through event stream"})
+			if err := tx.Insert(&hr); err != nil {
+				return fmt.Errorf("inserting retired webhook in database: %v", err)
+			}
+		}
+		return nil
+	})
+	log.Check(err, "retiring expired webhook for event stream", slog.Int64("webhookid", h.ID))
+}
@@ -0,0 +1,238 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+)
+
+// errIPPoolExhausted is returned when all IPs in an IP pool for the address
+// families of a remote host reached their warm-up limit for today. Delivery is
+// postponed, not failed.
+var errIPPoolExhausted = errors.New("all ips in ip pool for address family of remote host reached warm-up limit")
+
+// State for selecting IPs from IP pools: round robin positions, and IPs the DNSBL
+// monitor found listed.
+var ipPools = struct {
+	sync.Mutex
+	next   map[string]int  // Key is pool name and address family.
+	listed map[string]bool // Key is IP as string.
+}{next: map[string]int{}, listed: map[string]bool{}}
+
+// IPListedSet marks an IP as listed in a DNSBL, or no longer listed. Called by the
+// DNSBL monitor. Listed IPs are not used from IP pools, unless all IPs of an
+// address family in a pool are listed.
+func IPListedSet(ip net.IP, listed bool) {
+	ipPools.Lock()
+	defer ipPools.Unlock()
+	if listed {
+		ipPools.listed[ip.String()] = true
+	} else {
+		delete(ipPools.listed, ip.String())
+	}
+}
+
+// IPListed returns whether ip was found listed in a DNSBL by the DNSBL monitor.
+func IPListed(ip net.IP) bool {
+	ipPools.Lock()
+	defer ipPools.Unlock()
+	return ipPools.listed[ip.String()]
+}
+
+// IPWarmup is the number of messages delivered from an IP in an IP pool on a day,
+// for enforcing the warm-up schedule of the pool.
+type IPWarmup struct {
+	ID       int64
+	IP       string `bstore:"nonzero,index IP+Day"`
+	Day      string `bstore:"nonzero,index"` // In UTC, in form 2006-01-02.
+	Messages int
+}
+
+// IPWarmupStats is the warm-up state of an IP in an IP pool for today.
+type IPWarmupStats struct {
+	Pool     string
+	IP       string
+	Day      int // Day in the warm-up schedule, starting at 0. Beyond the schedule when warmed up.
+	Limit    int // Maximum number of messages for today. Zero if warmed up, i.e. no limit.
+	Messages int // Messages delivered today.
+}
+
+// ipWarmupLimit returns the maximum number of messages that can be delivered
+// from the IP today, and the day in the warm-up schedule. Limit 0 means no limit.
+func ipWarmupLimit(pool config.IPPool, pip config.IPPoolIP, now time.Time) (limit, day int) {
+	if pip.WarmupStartTime.IsZero() {
+		return 0, 0
+	}
+	day = max(0, int(now.UTC().Sub(pip.WarmupStartTime)/(24*time.Hour)))
+	if day < len(pool.Warmup) {
+		limit = pool.Warmup[day]
+	}
+	return limit, day
+}
+
+// ipWarmupCounts returns the number of messages delivered today per IP.
+func ipWarmupCounts(tx *bstore.Tx, now time.Time) (map[string]int, error) {
+	counts := map[string]int{}
+	q := bstore.QueryTx[IPWarmup](tx)
+	q.FilterNonzero(IPWarmup{Day: now.UTC().Format("2006-01-02")})
+	err := q.ForEach(func(w IPWarmup) error {
+		counts[w.IP] += w.Messages
+		return nil
+	})
+	return counts, err
+}
+
+// ipWarmupExhausted returns the IPs of the pool that reached their warm-up limit
+// for today.
+func ipWarmupExhausted(tx *bstore.Tx, pool config.IPPool, now time.Time) (map[string]bool, error) {
+	if len(pool.Warmup) == 0 {
+		return nil, nil
+	}
+	counts, err := ipWarmupCounts(tx, now)
+	if err != nil {
+		return nil, err
+	}
+	exhausted := map[string]bool{}
+	for _, pip := range pool.IPs {
+		if limit, _ := ipWarmupLimit(pool, pip, now); limit > 0 && counts[pip.ParsedIP.String()] >= limit {
+			exhausted[pip.ParsedIP.String()] = true
+		}
+	}
+	return exhausted, nil
+}
+
+// ipWarmupAdd adds n delivered messages to the count for ip for today. Counts for
+// previous days are removed.
+func ipWarmupAdd(ctx context.Context, ip net.IP, n int) error {
+	day := time.Now().UTC().Format("2006-01-02")
+	return DB.Write(ctx, func(tx *bstore.Tx) error {
+		if _, err := bstore.QueryTx[IPWarmup](tx).FilterLess("Day", day).Delete(); err != nil {
+			return fmt.Errorf("removing old ip warm-up counts: %v", err)
+		}
+		w, err := bstore.QueryTx[IPWarmup](tx).FilterNonzero(IPWarmup{IP: ip.String(), Day: day}).Get()
+		if err == bstore.ErrAbsent {
+			return tx.Insert(&IPWarmup{IP: ip.String(), Day: day, Messages: n})
+		} else if err != nil {
+			return fmt.Errorf("get ip warm-up count: %v", err)
+		}
+		w.Messages += n
+		return tx.Update(&w)
+	})
+}
+
+// ipWarmupPostpone undoes the registration of the delivery attempt for m, and
+// schedules the next attempt at the start of the next day, when new warm-up
+// limits apply.
+func ipWarmupPostpone(m *Msg, lastAttempt *time.Time, now time.Time) {
+	m.Attempts--
+	m.Results = m.Results[:len(m.Results)-1]
+	m.LastAttempt = lastAttempt
+	y, mo, d := now.UTC().Date()
+	m.NextAttempt = time.Date(y, mo, d+1, 0, 0, 0, 0, time.UTC).Add(time.Duration(jitter.IntN(600)) * time.Second)
+}
+
+// ipWarmupStats returns the warm-up state for IPs in pools with a warm-up schedule.
+func ipWarmupStats(now time.Time) ([]IPWarmupStats, error) {
+	var counts map[string]int
+	err := DB.Read(mox.Shutdown, func(tx *bstore.Tx) (err error) {
+		counts, err = ipWarmupCounts(tx, now)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get ip warm-up counts: %v", err)
+	}
+
+	names := make([]string, 0, len(mox.Conf.Static.IPPools))
+	for name, pool := range mox.Conf.Static.IPPools {
+		if len(pool.Warmup) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var l []IPWarmupStats
+	for _, name := range names {
+		pool := mox.Conf.Static.IPPools[name]
+		for _, pip := range pool.IPs {
+			limit, day := ipWarmupLimit(pool, pip, now)
+			if pip.WarmupStartTime.IsZero() {
+				day = len(pool.Warmup)
+			}
+			ip := pip.ParsedIP.String()
+			l = append(l, IPWarmupStats{name, ip, day, limit, counts[ip]})
+		}
+	}
+	return l, nil
+}
+
+// ipPoolSelect returns the local IPs to connect from to a host for
+// recipientDomain, at most one IPv4 and one IPv6 address, selected from the pool
+// according to its selection method. IPs that reached their warm-up limit for
+// today are not used.
+func ipPoolSelect(log mlog.Log, poolName string, pool config.IPPool, recipientDomain dns.Domain) []net.IP {
+	var exhausted map[string]bool
+	err := DB.Read(mox.Shutdown, func(tx *bstore.Tx) (err error) {
+		exhausted, err = ipWarmupExhausted(tx, pool, time.Now())
+		return err
+	})
+	log.Check(err, "checking ip warm-up limits for ip pool, ignoring", slog.String("pool", poolName))
+
+	var ips []net.IP
+	for _, family := range []string{"ip4", "ip6"} {
+		var all, usable []net.IP
+		for _, pip := range pool.IPs {
+			if (pip.ParsedIP.To4() != nil) != (family == "ip4") || exhausted[pip.ParsedIP.String()] {
+				continue
+			}
+			all = append(all, pip.ParsedIP)
+			if !IPListed(pip.ParsedIP) {
+				usable = append(usable, pip.ParsedIP)
+			}
+		}
+		if len(all) == 0 {
+			continue
+		}
+		if len(usable) == 0 {
+			log.Info("all ips of address family in ip pool are listed in dnsbl, using them anyway", slog.String("pool", poolName), slog.String("family", family))
+			usable = all
+		}
+
+		var i int
+		if pool.Selection == "sticky" {
+			h := fnv.New32a()
+			h.Write([]byte(recipientDomain.ASCII))
+			i = int(h.Sum32() % uint32(len(usable)))
+		} else {
+			key := poolName + " " + family
+			ipPools.Lock()
+			i = ipPools.next[key] % len(usable)
+			ipPools.next[key] = i + 1
+			ipPools.Unlock()
+		}
+		ips = append(ips, usable[i])
+	}
+	return ips
+}
+
+// ipPoolHostname returns the hostname for EHLO for connections from local ip. If
+// ip is not in the pool, false is returned.
+func ipPoolHostname(pool config.IPPool, ip net.IP) (dns.Domain, bool) {
+	for _, pip := range pool.IPs {
+		if pip.ParsedIP.Equal(ip) {
+			return pip.HostnameDomain, true
+		}
+	}
+	return dns.Domain{}, false
+}
@@ -0,0 +1,96 @@
+package queue
+
+import (
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mox-"
+)
+
+func TestIPPool(t *testing.T) {
+	_, cleanup := setup(t)
+	defer cleanup()
+
+	pool := mox.Conf.Static.IPPools["bulk"]
+	tcompare(t, mox.Conf.Static.Transports["pool"].Direct.IPFamily, "ip")
+
+	ip1 := net.ParseIP("192.0.2.1")
+	ip2 := net.ParseIP("192.0.2.2")
+	ip6 := net.ParseIP("2001:db8::1")
+	rcptDom := dns.Domain{ASCII: "remote.example"}
+
+	// Round robin, with an IPv4 and IPv6 address each time.
+	tcompare(t, ipPoolSelect(pkglog, "bulk", pool, rcptDom), []net.IP{ip1, ip6})
+	tcompare(t, ipPoolSelect(pkglog, "bulk", pool, rcptDom), []net.IP{ip2, ip6})
+	tcompare(t, ipPoolSelect(pkglog, "bulk", pool, rcptDom), []net.IP{ip1, ip6})
+
+	// Listed IPs are skipped, unless all IPs of the family are listed.
+	IPListedSet(ip1, true)
+	tcompare(t, ipPoolSelect(pkglog, "bulk", pool, rcptDom), []net.IP{ip2, ip6})
+	tcompare(t, ipPoolSelect(pkglog, "bulk", pool, rcptDom), []net.IP{ip2, ip6})
+	IPListedSet(ip6, true)
+	tcompare(t, ipPoolSelect(pkglog, "bulk", pool, rcptDom)[1], ip6)
+	IPListedSet(ip1, false)
+	IPListedSet(ip6, false)
+
+	// Sticky selection uses the same IP for a domain.
+	pool.Selection = "sticky"
+	first := ipPoolSelect(pkglog, "bulk", pool, rcptDom)
+	for range 3 {
+		tcompare(t, ipPoolSelect(pkglog, "bulk", pool, rcptDom), first)
+	}
+
+	// IPs at their warm-up limit for today are not used. IPs without warm-up start
+	// have no limit.
+	now := time.Now()
+	pool.Selection = "roundrobin"
+	pool.Warmup = []int{2, 10}
+	pool.IPs = slices.Clone(pool.IPs)
+	pool.IPs[0].WarmupStartTime = now.Add(-36 * time.Hour)
+	pool.IPs[2].WarmupStartTime = now
+	limit, day := ipWarmupLimit(pool, pool.IPs[0], now)
+	tcompare(t, []int{limit, day}, []int{10, 1})
+	limit, _ = ipWarmupLimit(pool, pool.IPs[1], now)
+	tcompare(t, limit, 0)
+	err := ipWarmupAdd(ctxbg, ip1, 10)
+	tcheck(t, err, "add warm-up count")
+	err = ipWarmupAdd(ctxbg, ip6, 2)
+	tcheck(t, err, "add warm-up count")
+	for range 3 {
+		tcompare(t, ipPoolSelect(pkglog, "bulk", pool, rcptDom), []net.IP{ip2})
+	}
+	var exhausted map[string]bool
+	err = DB.Read(ctxbg, func(tx *bstore.Tx) (err error) {
+		exhausted, err = ipWarmupExhausted(tx, pool, now)
+		return err
+	})
+	tcheck(t, err, "warm-up exhausted")
+	tcompare(t, exhausted, map[string]bool{ip1.String(): true, ip6.String(): true})
+
+	orig := mox.Conf.Static.IPPools["bulk"]
+	mox.Conf.Static.IPPools["bulk"] = pool
+	defer func() {
+		mox.Conf.Static.IPPools["bulk"] = orig
+	}()
+	stats, err := ipWarmupStats(now)
+	tcheck(t, err, "warm-up stats")
+	tcompare(t, stats, []IPWarmupStats{
+		{"bulk", ip1.String(), 1, 10, 10},
+		{"bulk", ip2.String(), 2, 0, 0},
+		{"bulk", ip6.String(), 0, 2, 2},
+	})
+
+	hostname, ok := ipPoolHostname(pool, ip2)
+	tcompare(t, ok, true)
+	tcompare(t, hostname, dns.Domain{ASCII: "bulk2.mox.example"})
+	hostname, ok = ipPoolHostname(pool, ip6)
+	tcompare(t, ok, true)
+	tcompare(t, hostname, mox.Conf.Static.HostnameDomain)
+	_, ok = ipPoolHostname(pool, net.ParseIP("192.0.2.3"))
+	tcompare(t, ok, false)
+}
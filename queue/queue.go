@@ -75,12 +75,21 @@ var (
 			Help: "Messages in queue that are on hold.",
 		},
 	)
+	metricIPWarmupPostponed = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mox_queue_ipwarmup_postponed_total",
+			Help: "Delivery attempts postponed because all IPs of an IP pool reached their warm-up limit for the day.",
+		},
+		[]string{
+			"pool",
+		},
+	)
 )
 
 var jitter = mox.NewPseudoRand()
 
-var DBTypes = []any{Msg{}, HoldRule{}, MsgRetired{}, webapi.Suppression{}, Hook{}, HookRetired{}} // Types stored in DB.
-var DB *bstore.DB                                                                                 // Exported for making backups.
+var DBTypes = []any{Msg{}, HoldRule{}, MsgRetired{}, webapi.Suppression{}, Hook{}, HookRetired{}, SendUsagePeriod{}, IPWarmup{}} // Types stored in DB.
+var DB *bstore.DB                                                                                                                // Exported for making backups.
 
 // Allow requesting delivery starting from up to this interval from time of submission.
 const FutureReleaseIntervalMax = 60 * 24 * time.Hour
@@ -136,7 +145,7 @@ type Msg struct {
 	Attempts           int                 // Next attempt is based on last attempt and exponential back off based on attempts.
 	MaxAttempts        int                 // Max number of attempts before giving up. If 0, then the default of 8 attempts is used instead.
 	DialedIPs          map[string][]net.IP // For each host, the IPs that were dialed. Used for IP selection for later attempts.
-	NextAttempt        time.Time           // For scheduling.
+	NextAttempt        time.Time           `bstore:"index"` // For scheduling.
 	LastAttempt        *time.Time
 	Results            []MsgResult
 
@@ -1107,6 +1116,13 @@ func OpenMessage(ctx context.Context, id int64) (ReadReaderAtCloser, error) {
 const maxConcurrentDeliveries = 10
 const maxConcurrentHookDeliveries = 10
 
+// Maximum number of due messages looked at when scheduling deliveries, in order
+// of the NextAttempt index. Messages for throttled destinations are skipped, and a
+// large backlog for throttled destinations should not cause a walk over the whole
+// queue for each scheduling round. Messages beyond the limit are considered once
+// deliveries to the throttled destinations make progress.
+const maxScheduleScan = 1000
+
 // Start opens the database by calling Init, then starts the delivery and cleanup
 // processes.
 func Start(resolver dns.Resolver, done chan struct{}) error {
@@ -1201,23 +1217,56 @@ func nextWork(ctx context.Context, log mlog.Log, busyDomains map[string]struct{}
 	}
 	q.FilterEqual("Hold", false)
 	q.SortAsc("NextAttempt")
-	q.Limit(1)
-	qm, err := q.Get()
-	if err == bstore.ErrAbsent {
-		return 24 * time.Hour
-	} else if err != nil {
+
+	// Messages for throttled destinations are skipped. A destination throttled until
+	// some time may be the next work. Destinations throttled until a delivery
+	// finishes are woken up by the delivery result.
+	now := time.Now()
+	var next time.Time
+	seen := map[string]bool{}
+	var scanned int
+	err := q.ForEach(func(m Msg) error {
+		if !m.NextAttempt.After(now) {
+			scanned++
+			if scanned > maxScheduleScan {
+				return bstore.StopForEach
+			}
+			if seen[m.RecipientDomainStr] {
+				return nil
+			}
+			seen[m.RecipientDomainStr] = true
+			until, throttled := destinationThrottled(m.RecipientDomain, now)
+			if !throttled {
+				next = m.NextAttempt
+				return bstore.StopForEach
+			} else if !until.IsZero() && (next.IsZero() || until.Before(next)) {
+				next = until
+			}
+			return nil
+		}
+		if next.IsZero() || m.NextAttempt.Before(next) {
+			next = m.NextAttempt
+		}
+		return bstore.StopForEach
+	})
+	if err != nil {
 		log.Errorx("finding time for next delivery attempt", err)
 		return 1 * time.Minute
+	} else if next.IsZero() && scanned > maxScheduleScan {
+		// Messages we did not look at may be deliverable.
+		return 1 * time.Minute
+	} else if next.IsZero() {
+		return 24 * time.Hour
 	}
-	return time.Until(qm.NextAttempt)
+	return time.Until(next)
 }
 
 func launchWork(log mlog.Log, resolver dns.Resolver, busyDomains map[string]struct{}) int {
+	now := time.Now()
 	q := bstore.QueryDB[Msg](mox.Shutdown, DB)
-	q.FilterLessEqual("NextAttempt", time.Now())
+	q.FilterLessEqual("NextAttempt", now)
 	q.FilterEqual("Hold", false)
 	q.SortAsc("NextAttempt")
-	q.Limit(maxConcurrentDeliveries)
 	if len(busyDomains) > 0 {
 		var doms []any
 		for d := range busyDomains {
@@ -1225,18 +1274,31 @@ func launchWork(log mlog.Log, resolver dns.Resolver, busyDomains map[string]stru
 		}
 		q.FilterNotEqual("RecipientDomainStr", doms...)
 	}
+	q.Limit(maxScheduleScan)
 	var msgs []Msg
 	seen := map[string]bool{}
 	err := q.ForEach(func(m Msg) error {
 		dom := m.RecipientDomainStr
 		if _, ok := busyDomains[dom]; !ok && !seen[dom] {
 			seen[dom] = true
+			if _, throttled := destinationThrottled(m.RecipientDomain, now); throttled {
+				return nil
+			}
+			// Register the delivery immediately, for the concurrency limit of throttles
+			// of next messages.
+			destinationStart(m.RecipientDomain, now)
 			msgs = append(msgs, m)
 		}
+		if len(busyDomains)+len(msgs) >= maxConcurrentDeliveries {
+			return bstore.StopForEach
+		}
 		return nil
 	})
 	if err != nil {
 		log.Errorx("querying for work in queue", err)
+		for _, m := range msgs {
+			destinationDone(m.RecipientDomain)
+		}
 		mox.Sleep(mox.Shutdown, 1*time.Second)
 		return -1
 	}
@@ -1282,7 +1344,7 @@ func retireMsgs(log mlog.Log, tx *bstore.Tx, event webhook.OutgoingEvent, code i
 		hookURL = accConf.OutgoingWebhook.URL
 	}
 	log.Debug("retiring messages from queue", slog.Any("event", event), slog.String("account", m0.SenderAccount), slog.Bool("ok", ok), slog.String("webhookurl", hookURL))
-	if hookURL != "" && (len(accConf.OutgoingWebhook.Events) == 0 || slices.Contains(accConf.OutgoingWebhook.Events, string(event))) {
+	if accConf.OutgoingWebhook != nil && (len(accConf.OutgoingWebhook.Events) == 0 || slices.Contains(accConf.OutgoingWebhook.Events, string(event))) {
 		for _, m := range msgs {
 			suppressing := slices.Contains(suppressedMsgIDs, m.ID)
 			h, err := hookCompose(m, hookURL, accConf.OutgoingWebhook.Authorization, event, suppressing, code, secode)
@@ -1341,6 +1403,7 @@ func deliver(log mlog.Log, resolver dns.Resolver, m0 Msg) {
 		slog.Int("attempts", m0.Attempts+1))
 
 	defer func() {
+		destinationDone(m0.RecipientDomain)
 		deliveryResults <- formatIPDomain(m0.RecipientDomain)
 
 		x := recover()
@@ -1376,6 +1439,7 @@ func deliver(log mlog.Log, resolver dns.Resolver, m0 Msg) {
 	now := time.Now()
 	var backoff time.Duration
 	var origNextAttempt time.Time
+	var origLastAttempt *time.Time
 	prepare := func() error {
 		// Refresh message within transaction.
 		m0 = Msg{ID: m0.ID}
@@ -1389,6 +1453,7 @@ func deliver(log mlog.Log, resolver dns.Resolver, m0 Msg) {
 		}
 		m0.Attempts++
 		origNextAttempt = m0.NextAttempt
+		origLastAttempt = m0.LastAttempt
 		m0.LastAttempt = &now
 		m0.NextAttempt = now.Add(backoff)
 		m0.Results = append(m0.Results, MsgResult{Start: now, Error: resultErrorDelivering})
@@ -1465,6 +1530,30 @@ func deliver(log mlog.Log, resolver dns.Resolver, m0 Msg) {
 		qlog.Debug("delivering with transport")
 	}
 
+	// If all IPs of the IP pool of the transport reached their warm-up limit for
+	// today, we postpone delivery until the next day. This does not count as an
+	// attempt.
+	if transport.Direct != nil && transport.Direct.IPPool != "" {
+		pool := mox.Conf.Static.IPPools[transport.Direct.IPPool]
+		exhausted, err := ipWarmupExhausted(xtx, pool, now)
+		if err != nil {
+			qlog.Errorx("checking ip warm-up limits for ip pool, continuing", err, slog.String("pool", transport.Direct.IPPool))
+		} else if len(pool.Warmup) > 0 && len(exhausted) == len(pool.IPs) {
+			ipWarmupPostpone(&m0, origLastAttempt, now)
+			qlog.Info("all ips in ip pool reached warm-up limit for today, postponing delivery", slog.String("pool", transport.Direct.IPPool), slog.Time("nextattempt", m0.NextAttempt))
+			metricIPWarmupPostponed.WithLabelValues(transport.Direct.IPPool).Inc()
+			if err := xtx.Update(&m0); err != nil {
+				qlog.Errorx("updating message for postponed delivery", err)
+				return
+			}
+			err = xtx.Commit()
+			qlog.Check(err, "commit postponing delivery")
+			xtx = nil
+			kick()
+			return
+		}
+	}
+
 	// Attempt to gather more recipients for this identical message, only with the same
 	// recipient domain, and under the same conditions (recipientdomain, attempts,
 	// requiretls, transport). ../rfc/5321:3759
@@ -1516,6 +1605,8 @@ func deliver(log mlog.Log, resolver dns.Resolver, m0 Msg) {
 	}
 	xtx = nil
 
+	destinationSent(m0.RecipientDomain, len(msgs), now)
+
 	if len(msgs) > 1 {
 		ids := make([]int64, len(msgs))
 		rcpts := make([]smtp.Path, len(msgs))
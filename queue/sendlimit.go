@@ -0,0 +1,548 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/message"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/store"
+	"github.com/mjl-/mox/webhook"
+)
+
+var metricSendLimitReached = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "mox_queue_sendlimit_reached_total",
+		Help: "Submitted messages that reached a configured send limit for an account or domain.",
+	},
+	[]string{
+		"scope",  // "account" or "domain"
+		"policy", // "reject", "hold", "notify"
+	},
+)
+
+// ErrSendLimit is returned by SendLimitCheck when a message would exceed a send
+// limit with policy "reject", wrapped in a SendLimitError.
+var ErrSendLimit = errors.New("send limit reached")
+
+// SendLimitError is returned by SendLimitCheck for a limit that was reached. Use
+// errors.Is with ErrSendLimit, or errors.As to get the limit.
+type SendLimitError struct {
+	Limit webhook.SendLimit
+}
+
+func (e SendLimitError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrSendLimit, sendLimitText(e.Limit))
+}
+
+func (e SendLimitError) Unwrap() error {
+	return ErrSendLimit
+}
+
+// Sources of submitted messages, for send limits. Limits for "Submission" apply to
+// messages submitted through SMTP and webmail.
+const (
+	SendSourceSMTP    = "smtp"
+	SendSourceWebmail = "webmail"
+	SendSourceWebAPI  = "webapi"
+)
+
+// Periods over which send limits are evaluated. A month is 30 days.
+var sendLimitPeriods = map[string]time.Duration{
+	"hour":  time.Hour,
+	"day":   24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+}
+
+// SendUsagePeriod holds the numbers of messages and recipients submitted by an
+// account with a message From address in a domain through a source, in an hour
+// or a day (UTC). Usage is recorded in both an hour and a day period. Counting
+// for send limits only reads the periods for the past 24 hours and 30 days, not
+// individual messages. Hour periods are removed after a day, day periods after 30
+// days.
+type SendUsagePeriod struct {
+	ID         int64
+	Start      time.Time `bstore:"nonzero,index"` // Start of hour or day, in UTC.
+	Account    string    `bstore:"nonzero,index Account+Start"`
+	FromDomain string    `bstore:"nonzero,index FromDomain+Start"` // Domain of message From address, in unicode.
+	Source     string    `bstore:"nonzero"`                        // SendSourceSMTP, SendSourceWebmail or SendSourceWebAPI.
+	Day        bool      // Whether this is a day period instead of an hour period.
+	Messages   int
+	Recipients int
+}
+
+// sendPeriodStarts returns the start of the hour and the day (UTC) for t.
+func sendPeriodStarts(t time.Time) (hour, day time.Time) {
+	t = t.UTC()
+	y, m, d := t.Date()
+	return t.Truncate(time.Hour), time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// SendCounts are the numbers of messages and recipients submitted in the current
+// hour, the past day (24 hours, in whole hours) and the past month (30 days, in
+// whole days, UTC).
+type SendCounts struct {
+	MessagesHour    int
+	MessagesDay     int
+	MessagesMonth   int
+	RecipientsHour  int
+	RecipientsDay   int
+	RecipientsMonth int
+}
+
+func (c *SendCounts) add(p SendUsagePeriod, hour time.Time) {
+	if p.Day {
+		c.MessagesMonth += p.Messages
+		c.RecipientsMonth += p.Recipients
+		return
+	}
+	if p.Start.Equal(hour) {
+		c.MessagesHour += p.Messages
+		c.RecipientsHour += p.Recipients
+	}
+	c.MessagesDay += p.Messages
+	c.RecipientsDay += p.Recipients
+}
+
+// SendUsageCounts are the counts of submitted messages for an account or domain,
+// matching the groups of limits in config.SendLimits.
+type SendUsageCounts struct {
+	All        SendCounts
+	Submission SendCounts // Through SMTP and webmail.
+	WebAPI     SendCounts
+}
+
+// sendUsageCounts returns the counts for the account or domain matching the
+// nonzero fields of filter.
+func sendUsageCounts(tx *bstore.Tx, filter SendUsagePeriod, now time.Time) (SendUsageCounts, error) {
+	hour, day := sendPeriodStarts(now)
+	hourFirst := hour.Add(-23 * time.Hour)
+	dayFirst := day.AddDate(0, 0, -29)
+
+	var c SendUsageCounts
+	q := bstore.QueryTx[SendUsagePeriod](tx)
+	q.FilterNonzero(filter)
+	q.FilterGreaterEqual("Start", dayFirst)
+	err := q.ForEach(func(p SendUsagePeriod) error {
+		if !p.Day && p.Start.Before(hourFirst) {
+			return nil
+		}
+		c.All.add(p, hour)
+		if p.Source == SendSourceWebAPI {
+			c.WebAPI.add(p, hour)
+		} else {
+			c.Submission.add(p, hour)
+		}
+		return nil
+	})
+	if err != nil {
+		return SendUsageCounts{}, fmt.Errorf("counting submitted messages: %v", err)
+	}
+	return c, nil
+}
+
+// SendUsageAccount returns the counts of messages submitted by an account.
+func SendUsageAccount(ctx context.Context, accountName string) (c SendUsageCounts, rerr error) {
+	rerr = DB.Read(ctx, func(tx *bstore.Tx) error {
+		var err error
+		c, err = sendUsageCounts(tx, SendUsagePeriod{Account: accountName}, time.Now())
+		return err
+	})
+	return
+}
+
+// SendUsageDomain returns the counts of messages submitted with a message From
+// address in domain, by all accounts.
+func SendUsageDomain(ctx context.Context, domain dns.Domain) (c SendUsageCounts, rerr error) {
+	rerr = DB.Read(ctx, func(tx *bstore.Tx) error {
+		var err error
+		c, err = sendUsageCounts(tx, SendUsagePeriod{FromDomain: domain.Name()}, time.Now())
+		return err
+	})
+	return
+}
+
+// sendLimitFind returns the first limit that would be exceeded by submitting a
+// message with nrecipients, or nil if none.
+func sendLimitFind(tx *bstore.Tx, scope, name string, limits *config.SendLimits, filter SendUsagePeriod, source string, nrecipients int, now time.Time) (*webhook.SendLimit, error) {
+	if limits == nil {
+		return nil, nil
+	}
+	counts, err := sendUsageCounts(tx, filter, now)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := limits.Policy
+	if policy == "" {
+		policy = "reject"
+	}
+
+	type group struct {
+		source string
+		limits config.SendLimitCounts
+		counts SendCounts
+	}
+	groups := []group{{"all", limits.All, counts.All}}
+	if source == SendSourceWebAPI {
+		groups = append(groups, group{"webapi", limits.WebAPI, counts.WebAPI})
+	} else {
+		groups = append(groups, group{"submission", limits.Submission, counts.Submission})
+	}
+	for _, g := range groups {
+		l, c := g.limits, g.counts
+		checks := []struct {
+			kind, period string
+			limit, count int
+		}{
+			{"messages", "hour", l.MessagesPerHour, c.MessagesHour + 1},
+			{"messages", "day", l.MessagesPerDay, c.MessagesDay + 1},
+			{"messages", "month", l.MessagesPerMonth, c.MessagesMonth + 1},
+			{"recipients", "hour", l.RecipientsPerHour, c.RecipientsHour + nrecipients},
+			{"recipients", "day", l.RecipientsPerDay, c.RecipientsDay + nrecipients},
+			{"recipients", "month", l.RecipientsPerMonth, c.RecipientsMonth + nrecipients},
+		}
+		for _, x := range checks {
+			if x.limit > 0 && x.count > x.limit {
+				return &webhook.SendLimit{
+					Scope:  scope,
+					Name:   name,
+					Source: g.source,
+					Kind:   x.kind,
+					Period: x.period,
+					Limit:  x.limit,
+					Count:  x.count,
+					Policy: policy,
+				}, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func sendLimitText(l webhook.SendLimit) string {
+	var what string
+	switch l.Source {
+	case "all":
+		what = "all messages"
+	case "submission":
+		what = "messages submitted through smtp and webmail"
+	case "webapi":
+		what = "messages submitted through the webapi"
+	}
+	return fmt.Sprintf("%s %q reached limit of %d %s per %s for %s, with %d (policy %s)", l.Scope, l.Name, l.Limit, l.Kind, l.Period, what, l.Count, l.Policy)
+}
+
+// Last time a webhook and postmaster notification were sent for a limit, to send
+// them at most once per period. Key is formed from the fields of a SendLimit.
+var sendLimitNotified = struct {
+	sync.Mutex
+	last map[string]time.Time
+}{last: map[string]time.Time{}}
+
+func sendLimitNotifyFirst(l webhook.SendLimit, now time.Time) bool {
+	key := strings.Join([]string{l.Scope, l.Name, l.Source, l.Kind, l.Period}, "\n")
+	period := sendLimitPeriods[l.Period]
+
+	sendLimitNotified.Lock()
+	defer sendLimitNotified.Unlock()
+	if tm, ok := sendLimitNotified.last[key]; ok && now.Sub(tm) < period {
+		return false
+	}
+	sendLimitNotified.last[key] = now
+	return true
+}
+
+// SendLimitCheck checks whether submitting a message from accountName, with a
+// message From address in fromDomain, to nrecipients would exceed a send limit
+// configured for the account or the domain, and if not, records the message as
+// submitted. Checking and recording is done in a single transaction, so
+// concurrent submissions cannot exceed limits. Source is one of the SendSource*
+// constants.
+//
+// If a limit is reached, the policy of the limits applies. For "reject", an error
+// wrapping ErrSendLimit is returned, no usage is recorded and the message must not
+// be queued. For "hold", a hold rule is added for the account or domain before
+// returning, so the message is held when queued. For "notify", the message can be
+// queued as normal. For all policies, an outgoing webhook is queued if configured
+// for the account, and for policies hold and notify the postmaster is notified,
+// both at most once per limit per period.
+//
+// The recorded usage is returned. If the message is not queued after all, callers
+// must remove the usage with SendUsageRemove. Periods older than 30 days are
+// removed periodically.
+func SendLimitCheck(ctx context.Context, log mlog.Log, accountName string, fromDomain dns.Domain, source string, nrecipients int, messageID, subject string) (usage SendUsage, rerr error) {
+	accConf, ok := mox.Conf.Account(accountName)
+	if !ok {
+		return SendUsage{}, fmt.Errorf("unknown account %q", accountName)
+	}
+	domConf, _ := mox.Conf.Domain(fromDomain)
+
+	now := time.Now()
+	var l *webhook.SendLimit
+	err := DB.Write(ctx, func(tx *bstore.Tx) error {
+		var err error
+		l, err = sendLimitFind(tx, "account", accountName, accConf.SendLimits, SendUsagePeriod{Account: accountName}, source, nrecipients, now)
+		if err != nil {
+			return err
+		}
+		if l == nil {
+			l, err = sendLimitFind(tx, "domain", fromDomain.Name(), domConf.SendLimits, SendUsagePeriod{FromDomain: fromDomain.Name()}, source, nrecipients, now)
+			if err != nil {
+				return err
+			}
+		}
+		if l != nil && l.Policy == "reject" {
+			return nil
+		}
+
+		u := SendUsage{now, accountName, fromDomain.Name(), source, nrecipients}
+		if err := sendUsageAdd(tx, u, 1); err != nil {
+			return fmt.Errorf("adding send usage: %v", err)
+		}
+		usage = u
+		return nil
+	})
+	if err != nil {
+		return SendUsage{}, fmt.Errorf("checking send limits: %v", err)
+	}
+
+	sendUsageCleanup(ctx, log, now)
+
+	if l == nil {
+		return usage, nil
+	}
+
+	text := sendLimitText(*l)
+	metricSendLimitReached.WithLabelValues(l.Scope, l.Policy).Inc()
+	log.Info("send limit reached",
+		slog.String("account", accountName),
+		slog.String("limit", text))
+
+	if sendLimitNotifyFirst(*l, now) {
+		if err := sendLimitHook(ctx, log, accConf, accountName, *l, text, messageID, subject, now); err != nil {
+			log.Errorx("queueing webhook for reached send limit", err)
+		}
+		if l.Policy != "reject" {
+			sendLimitPostmaster(log, accountName, text, now)
+		}
+	}
+
+	switch l.Policy {
+	case "reject":
+		return SendUsage{}, SendLimitError{*l}
+	case "hold":
+		hr := HoldRule{Account: accountName}
+		if l.Scope == "domain" {
+			hr = HoldRule{SenderDomain: fromDomain}
+		}
+		if err := sendLimitHold(ctx, log, hr); err != nil {
+			return usage, fmt.Errorf("adding hold rule for send limit: %v", err)
+		}
+	}
+	return usage, nil
+}
+
+// SendUsage is a submitted message recorded by SendLimitCheck.
+type SendUsage struct {
+	Submitted  time.Time
+	Account    string
+	FromDomain string
+	Source     string
+	Recipients int
+}
+
+// sendUsageAdd adds (or with n -1, subtracts) usage u to the counts of its hour
+// and day periods.
+func sendUsageAdd(tx *bstore.Tx, u SendUsage, n int) error {
+	hour, day := sendPeriodStarts(u.Submitted)
+	for _, start := range []time.Time{hour, day} {
+		p := SendUsagePeriod{Start: start, Account: u.Account, FromDomain: u.FromDomain, Source: u.Source, Day: start.Equal(day)}
+		q := bstore.QueryTx[SendUsagePeriod](tx)
+		q.FilterNonzero(SendUsagePeriod{Account: p.Account, FromDomain: p.FromDomain, Source: p.Source})
+		q.FilterEqual("Start", p.Start)
+		q.FilterEqual("Day", p.Day)
+		xp, err := q.Get()
+		if err == bstore.ErrAbsent && n < 0 {
+			continue
+		} else if err == nil {
+			p = xp
+		} else if err != bstore.ErrAbsent {
+			return fmt.Errorf("get send usage period: %v", err)
+		}
+		p.Messages = max(0, p.Messages+n)
+		p.Recipients = max(0, p.Recipients+n*u.Recipients)
+		if p.ID == 0 {
+			err = tx.Insert(&p)
+		} else {
+			err = tx.Update(&p)
+		}
+		if err != nil {
+			return fmt.Errorf("storing send usage period: %v", err)
+		}
+	}
+	return nil
+}
+
+// sendLimitHold adds hold rule hr, unless an identical rule already exists.
+func sendLimitHold(ctx context.Context, log mlog.Log, hr HoldRule) error {
+	l, err := HoldRuleList(ctx)
+	if err != nil {
+		return err
+	}
+	for _, xhr := range l {
+		if xhr.Account == hr.Account && xhr.SenderDomainStr == hr.SenderDomain.Name() && xhr.RecipientDomainStr == "" {
+			return nil
+		}
+	}
+	_, err = HoldRuleAdd(ctx, log, hr)
+	return err
+}
+
+// sendLimitHook queues an outgoing webhook with event "limitreached", if the
+// account has outgoing webhooks configured for the event.
+func sendLimitHook(ctx context.Context, log mlog.Log, accConf config.Account, accountName string, l webhook.SendLimit, text, messageID, subject string, now time.Time) error {
+	hooks := accConf.OutgoingWebhook
+	if hooks == nil || len(hooks.Events) > 0 && !slices.Contains(hooks.Events, string(webhook.EventLimitReached)) {
+		return nil
+	}
+
+	data := webhook.Outgoing{
+		Event:         webhook.EventLimitReached,
+		MessageID:     messageID,
+		Subject:       subject,
+		WebhookQueued: now,
+		Error:         text,
+		Extra:         map[string]string{},
+		SendLimit:     &l,
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("marshal webhook payload: %v", err)
+	}
+	h := Hook{
+		MessageID:     messageID,
+		Subject:       subject,
+		Account:       accountName,
+		URL:           hooks.URL,
+		Authorization: hooks.Authorization,
+		OutgoingEvent: string(webhook.EventLimitReached),
+		Payload:       string(payload),
+		Submitted:     now,
+		NextAttempt:   now,
+	}
+	err = DB.Write(ctx, func(tx *bstore.Tx) error {
+		return hookInsert(tx, &h, now, accConf.KeepRetiredWebhookPeriod)
+	})
+	if err != nil {
+		return err
+	}
+	log.Debug("queued webhook for reached send limit", h.attrs()...)
+	hookqueueKick()
+	return nil
+}
+
+// sendLimitPostmaster delivers a message about a reached send limit to the
+// postmaster mailbox. Errors are logged.
+func sendLimitPostmaster(log mlog.Log, accountName, text string, now time.Time) {
+	a, err := store.OpenAccount(log, mox.Conf.Static.Postmaster.Account, false)
+	if err != nil {
+		log.Errorx("open postmaster account for send limit notification", err)
+		return
+	}
+	defer func() {
+		err := a.Close()
+		log.Check(err, "closing account")
+	}()
+	f, err := store.CreateMessageTemp(log, "sendlimit")
+	if err != nil {
+		log.Errorx("making temporary message file for send limit notification", err)
+		return
+	}
+	defer store.CloseRemoveTempFile(log, f, "message for send limit notification")
+
+	m := store.Message{
+		Received: now,
+		Flags:    store.Flags{Flagged: true},
+	}
+	n, err := fmt.Fprintf(f, "Date: %s\r\nSubject: mox send limit reached for account %s\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: 8bit\r\n\r\nHi!\r\n\r\nA message submitted by account %s reached a send limit:\r\n\r\n%s\r\n\r\nThis notification is sent at most once per limit per period.\r\n\r\nCheers,\r\nmox\r\n", now.Format(message.RFC5322Z), accountName, accountName, text)
+	if err != nil {
+		log.Errorx("writing temporary message file for send limit notification", err)
+		return
+	}
+	m.Size = int64(n)
+
+	a.WithWLock(func() {
+		err = a.DeliverMailbox(log, mox.Conf.Static.Postmaster.Mailbox, &m, f)
+	})
+	log.Check(err, "delivering send limit notification to postmaster")
+}
+
+var sendUsageCleaned = struct {
+	sync.Mutex
+	last time.Time
+}{}
+
+// SendUsageRemove removes usage recorded by SendLimitCheck, for a message that was
+// not queued after all. A zero usage is ignored.
+func SendUsageRemove(ctx context.Context, u SendUsage) error {
+	if u.Submitted.IsZero() {
+		return nil
+	}
+	err := DB.Write(ctx, func(tx *bstore.Tx) error {
+		return sendUsageAdd(tx, u, -1)
+	})
+	if err != nil {
+		return fmt.Errorf("removing send usage: %v", err)
+	}
+	return nil
+}
+
+// sendUsageCleanup removes hour periods older than a day and day periods older
+// than 30 days, at most once per hour.
+func sendUsageCleanup(ctx context.Context, log mlog.Log, now time.Time) {
+	sendUsageCleaned.Lock()
+	cleanup := now.Sub(sendUsageCleaned.last) > time.Hour
+	if cleanup {
+		sendUsageCleaned.last = now
+	}
+	sendUsageCleaned.Unlock()
+	if cleanup {
+		hour, day := sendPeriodStarts(now)
+		var n int
+		err := DB.Write(ctx, func(tx *bstore.Tx) error {
+			q := bstore.QueryTx[SendUsagePeriod](tx)
+			q.FilterEqual("Day", false)
+			q.FilterLess("Start", hour.Add(-23*time.Hour))
+			nh, err := q.Delete()
+			if err != nil {
+				return err
+			}
+			q = bstore.QueryTx[SendUsagePeriod](tx)
+			q.FilterEqual("Day", true)
+			q.FilterLess("Start", day.AddDate(0, 0, -29))
+			nd, err := q.Delete()
+			n = nh + nd
+			return err
+		})
+		log.Check(err, "removing old send usage periods")
+		if n > 0 {
+			log.Debug("removed old send usage periods", slog.Int("count", n))
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/webhook"
+)
+
+func TestSendLimit(t *testing.T) {
+	_, cleanup := setup(t)
+	defer cleanup()
+
+	dom := dns.Domain{ASCII: "mox.example"}
+	check := func(source string, nrcpt int) error {
+		t.Helper()
+		_, err := SendLimitCheck(ctxbg, pkglog, "hook", dom, source, nrcpt, "<test@mox.example>", "test")
+		return err
+	}
+	limitHooks := func() []Hook {
+		t.Helper()
+		l, err := bstore.QueryDB[Hook](ctxbg, DB).FilterNonzero(Hook{OutgoingEvent: string(webhook.EventLimitReached)}).List()
+		tcheck(t, err, "list hooks")
+		return l
+	}
+
+	// No limits configured. Usage is recorded, and removed again as if the message
+	// could not be queued.
+	su, err := SendLimitCheck(ctxbg, pkglog, "hook", dom, SendSourceSMTP, 100, "<test@mox.example>", "test")
+	tcheck(t, err, "check without limits")
+	usage, err := SendUsageAccount(ctxbg, "hook")
+	tcheck(t, err, "send usage")
+	tcompare(t, usage.All, SendCounts{1, 1, 1, 100, 100, 100})
+	err = SendUsageRemove(ctxbg, su)
+	tcheck(t, err, "remove send usage")
+
+	accConf := mox.Conf.Dynamic.Accounts["hook"]
+	accConf.SendLimits = &config.SendLimits{
+		All:    config.SendLimitCounts{MessagesPerHour: 2},
+		WebAPI: config.SendLimitCounts{RecipientsPerDay: 3},
+	}
+	mox.Conf.Dynamic.Accounts["hook"] = accConf
+
+	err = check(SendSourceSMTP, 1)
+	tcheck(t, err, "check")
+	err = check(SendSourceWebAPI, 4)
+	if !errors.Is(err, ErrSendLimit) {
+		t.Fatalf("got err %v, expected ErrSendLimit for webapi recipients", err)
+	}
+	err = check(SendSourceWebAPI, 3)
+	tcheck(t, err, "check")
+
+	err = check(SendSourceSMTP, 1)
+	if !errors.Is(err, ErrSendLimit) {
+		t.Fatalf("got err %v, expected ErrSendLimit for messages", err)
+	}
+
+	// Webhook is queued once per limit per period.
+	err = check(SendSourceWebmail, 1)
+	if !errors.Is(err, ErrSendLimit) {
+		t.Fatalf("got err %v, expected ErrSendLimit for messages", err)
+	}
+	hooks := limitHooks()
+	tcompare(t, len(hooks), 2)
+	var out webhook.Outgoing
+	err = json.Unmarshal([]byte(hooks[1].Payload), &out)
+	tcheck(t, err, "parse webhook payload")
+	tcompare(t, out.Event, webhook.EventLimitReached)
+	tcompare(t, out.MessageID, "<test@mox.example>")
+	tcompare(t, *out.SendLimit, webhook.SendLimit{Scope: "account", Name: "hook", Source: "all", Kind: "messages", Period: "hour", Limit: 2, Count: 3, Policy: "reject"})
+
+	usage, err = SendUsageAccount(ctxbg, "hook")
+	tcheck(t, err, "send usage")
+	tcompare(t, usage.All, SendCounts{2, 2, 2, 4, 4, 4})
+	tcompare(t, usage.Submission, SendCounts{1, 1, 1, 1, 1, 1})
+	tcompare(t, usage.WebAPI, SendCounts{1, 1, 1, 3, 3, 3})
+	usage, err = SendUsageDomain(ctxbg, dom)
+	tcheck(t, err, "send usage")
+	tcompare(t, usage.All, SendCounts{2, 2, 2, 4, 4, 4})
+
+	// Domain limit with policy hold adds a hold rule for the domain, once.
+	accConf.SendLimits = nil
+	mox.Conf.Dynamic.Accounts["hook"] = accConf
+	domConf := mox.Conf.Dynamic.Domains["mox.example"]
+	domConf.SendLimits = &config.SendLimits{
+		Submission: config.SendLimitCounts{RecipientsPerMonth: 1},
+		Policy:     "hold",
+	}
+	mox.Conf.Dynamic.Domains["mox.example"] = domConf
+	for range 2 {
+		err = check(SendSourceSMTP, 1)
+		tcheck(t, err, "check with hold policy")
+	}
+	holdRules, err := HoldRuleList(ctxbg)
+	tcheck(t, err, "list hold rules")
+	tcompare(t, len(holdRules), 1)
+	tcompare(t, holdRules[0].SenderDomainStr, "mox.example")
+	tcompare(t, holdRules[0].Account, "")
+
+	// Policy notify accepts the message. The notification for this limit was already
+	// sent.
+	domConf.SendLimits.Policy = "notify"
+	mox.Conf.Dynamic.Domains["mox.example"] = domConf
+	err = check(SendSourceWebmail, 1)
+	tcheck(t, err, "check with notify policy")
+	hooks = limitHooks()
+	tcompare(t, len(hooks), 3)
+
+	// Counts are aggregated per hour and day. Hour periods count for the past day, day
+	// periods for the past month.
+	now := time.Now()
+	hour, day := sendPeriodStarts(now)
+	periods := []SendUsagePeriod{
+		{Start: hour, Messages: 1, Recipients: 1},
+		{Start: hour.Add(-2 * time.Hour), Messages: 2, Recipients: 2},
+		{Start: hour.Add(-30 * time.Hour), Messages: 4, Recipients: 4},
+		{Start: day, Day: true, Messages: 3, Recipients: 3},
+		{Start: day.AddDate(0, 0, -10), Day: true, Messages: 5, Recipients: 5},
+		{Start: day.AddDate(0, 0, -40), Day: true, Messages: 6, Recipients: 6},
+	}
+	for _, p := range periods {
+		p.Account = "other"
+		p.FromDomain = "other.example"
+		p.Source = SendSourceWebAPI
+		err := DB.Insert(ctxbg, &p)
+		tcheck(t, err, "insert send usage period")
+	}
+	usage, err = SendUsageAccount(ctxbg, "other")
+	tcheck(t, err, "send usage")
+	tcompare(t, usage.WebAPI, SendCounts{1, 3, 8, 1, 3, 8})
+	tcompare(t, usage.Submission, SendCounts{})
+
+	// Old periods are removed.
+	sendUsageCleaned.last = time.Time{}
+	sendUsageCleanup(ctxbg, pkglog, now)
+	n, err := bstore.QueryDB[SendUsagePeriod](ctxbg, DB).FilterNonzero(SendUsagePeriod{Account: "other"}).Count()
+	tcheck(t, err, "count send usage periods")
+	tcompare(t, n, 4)
+}
@@ -0,0 +1,405 @@
+package queue
+
+import (
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/smtp"
+	"github.com/mjl-/mox/smtpclient"
+)
+
+var (
+	metricDestinationDelivery = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mox_queue_destination_delivery_total",
+			Help: "Messages in delivery attempts to remote hosts, per destination throttle.",
+		},
+		[]string{
+			"throttle", // Name of destination throttle, or "none".
+			"result",   // "delivered", "temperror", "permerror", "ratelimited"
+		},
+	)
+	metricDestinationBackoff = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mox_queue_destination_backoff_total",
+			Help: "Backoffs started for a destination after a response that looks like rate limiting.",
+		},
+		[]string{
+			"throttle", // Name of destination throttle, or "none".
+		},
+	)
+)
+
+// Results of deliveries to destinations, for stats and backoff.
+const (
+	destDelivered   = "delivered"
+	destTempError   = "temperror"
+	destPermError   = "permerror"
+	destRateLimited = "ratelimited"
+)
+
+// Backoff durations for destinations after responses that look like rate
+// limiting.
+const (
+	destBackoffMin = time.Minute
+	destBackoffMax = time.Hour
+)
+
+// DestinationStats holds statistics about deliveries to a recipient domain, since
+// startup. Domains without delivery attempts in the past 24 hours are not kept.
+type DestinationStats struct {
+	Domain       string    // Recipient domain, or IP address in brackets.
+	Throttle     string    // Name of matching destination throttle, if any.
+	Active       int       // Current number of deliveries.
+	Delivered    int       // Messages delivered.
+	TempErrors   int       // Messages that failed with a temporary error, excluding rate limiting.
+	PermErrors   int       // Messages that failed with a permanent error.
+	RateLimited  int       // Messages that failed with a response that looks like rate limiting.
+	LastAttempt  time.Time // Start of most recent delivery.
+	BackoffUntil time.Time // For domains without throttle. While in the future, no deliveries are started due to rate limiting responses.
+
+	backoff time.Duration
+}
+
+// ThrottleStats holds the state of a destination throttle, with statistics since
+// startup.
+type ThrottleStats struct {
+	Name              string
+	MaxConcurrent     int // From configuration, 0 means no limit.
+	MessagesPerMinute int // From configuration, 0 means no limit.
+	MessagesPerHour   int // From configuration, 0 means no limit.
+	Active            int // Current number of deliveries.
+	MessagesMinute    int // Messages in deliveries started in the past minute.
+	MessagesHour      int // Messages in deliveries started in the past hour.
+	Delivered         int
+	TempErrors        int
+	PermErrors        int
+	RateLimited       int
+	BackoffUntil      time.Time // While in the future, no deliveries are started due to rate limiting responses.
+
+	backoff time.Duration
+	sent    []throttleSent
+}
+
+type throttleSent struct {
+	time time.Time
+	n    int
+}
+
+// State for throttling deliveries to destinations, and their stats.
+var destinations = struct {
+	sync.Mutex
+	domains     map[string]*DestinationStats // Key is formatted recipient domain.
+	throttles   map[string]*ThrottleStats    // Key is throttle name.
+	mxThrottles map[string]string            // Formatted recipient domain to throttle name, learned from MX hosts. Empty for no match.
+	lastPrune   time.Time
+}{domains: map[string]*DestinationStats{}, throttles: map[string]*ThrottleStats{}, mxThrottles: map[string]string{}}
+
+// matchDomainASCII returns whether name matches one of the patterns, which are
+// exact names, or start with a dot to match subdomains.
+func matchDomainASCII(name string, patterns []string) bool {
+	for _, p := range patterns {
+		if name == p || strings.HasPrefix(p, ".") && strings.HasSuffix(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// destinationThrottleName returns the name of the throttle for the recipient
+// domain, or empty. Must be called with lock held.
+func destinationThrottleName(dom dns.IPDomain) string {
+	if dom.IsIP() {
+		return ""
+	}
+	names := make([]string, 0, len(mox.Conf.Static.DestinationThrottles))
+	for name := range mox.Conf.Static.DestinationThrottles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if matchDomainASCII(dom.Domain.ASCII, mox.Conf.Static.DestinationThrottles[name].DomainsASCII) {
+			return name
+		}
+	}
+	name := destinations.mxThrottles[formatIPDomain(dom)]
+	if _, ok := mox.Conf.Static.DestinationThrottles[name]; ok {
+		return name
+	}
+	return ""
+}
+
+// destinationState returns the (new) stats for the recipient domain, and its
+// throttle, which can be nil. Must be called with lock held.
+func destinationState(dom dns.IPDomain) (*DestinationStats, *ThrottleStats, config.DestinationThrottle) {
+	key := formatIPDomain(dom)
+	ds := destinations.domains[key]
+	if ds == nil {
+		ds = &DestinationStats{Domain: key}
+		destinations.domains[key] = ds
+	}
+	name := destinationThrottleName(dom)
+	ds.Throttle = name
+	if name == "" {
+		return ds, nil, config.DestinationThrottle{}
+	}
+	t := mox.Conf.Static.DestinationThrottles[name]
+	ts := destinations.throttles[name]
+	if ts == nil {
+		ts = &ThrottleStats{Name: name}
+		destinations.throttles[name] = ts
+	}
+	return ds, ts, t
+}
+
+// throttleMessages returns the number of messages sent since the given time, and
+// when the first of those leaves the window.
+func throttleMessages(ts *ThrottleStats, since time.Time, window time.Duration) (n int, free time.Time) {
+	for _, s := range ts.sent {
+		if s.time.After(since) {
+			if free.IsZero() {
+				free = s.time.Add(window)
+			}
+			n += s.n
+		}
+	}
+	return
+}
+
+// destinationThrottled returns whether no delivery should be started for the
+// recipient domain because of a destination throttle or a backoff after rate
+// limiting responses. If until is zero, the destination is throttled until a
+// delivery finishes, otherwise until the time has passed.
+func destinationThrottled(dom dns.IPDomain, now time.Time) (until time.Time, throttled bool) {
+	destinations.Lock()
+	defer destinations.Unlock()
+
+	ds, ts, t := destinationState(dom)
+	if ts == nil {
+		return ds.BackoffUntil, ds.BackoffUntil.After(now)
+	}
+	if ts.BackoffUntil.After(now) {
+		return ts.BackoffUntil, true
+	}
+	if t.MaxConcurrent > 0 && ts.Active >= t.MaxConcurrent {
+		return time.Time{}, true
+	}
+	if t.MessagesPerMinute > 0 {
+		if n, free := throttleMessages(ts, now.Add(-time.Minute), time.Minute); n >= t.MessagesPerMinute {
+			until = free
+		}
+	}
+	if t.MessagesPerHour > 0 {
+		if n, free := throttleMessages(ts, now.Add(-time.Hour), time.Hour); n >= t.MessagesPerHour && free.After(until) {
+			until = free
+		}
+	}
+	return until, !until.IsZero()
+}
+
+// destinationStart registers the start of a delivery to the recipient domain.
+func destinationStart(dom dns.IPDomain, now time.Time) {
+	destinations.Lock()
+	defer destinations.Unlock()
+
+	if now.Sub(destinations.lastPrune) > time.Hour {
+		destinations.lastPrune = now
+		for k, ds := range destinations.domains {
+			if ds.Active == 0 && now.Sub(ds.LastAttempt) > 24*time.Hour {
+				delete(destinations.domains, k)
+				delete(destinations.mxThrottles, k)
+			}
+		}
+		for k := range destinations.throttles {
+			if _, ok := mox.Conf.Static.DestinationThrottles[k]; !ok {
+				delete(destinations.throttles, k)
+			}
+		}
+	}
+
+	ds, ts, _ := destinationState(dom)
+	ds.Active++
+	ds.LastAttempt = now
+	if ts != nil {
+		ts.Active++
+	}
+}
+
+// destinationDone registers the end of a delivery to the recipient domain.
+func destinationDone(dom dns.IPDomain) {
+	destinations.Lock()
+	defer destinations.Unlock()
+
+	ds := destinations.domains[formatIPDomain(dom)]
+	if ds == nil || ds.Active == 0 {
+		return
+	}
+	ds.Active--
+	if ts := destinations.throttles[ds.Throttle]; ts != nil && ts.Active > 0 {
+		ts.Active--
+	}
+}
+
+// destinationSent registers n messages in a delivery to the recipient domain, for
+// the rate limits of its throttle.
+func destinationSent(dom dns.IPDomain, n int, now time.Time) {
+	destinations.Lock()
+	defer destinations.Unlock()
+
+	_, ts, _ := destinationState(dom)
+	if ts == nil {
+		return
+	}
+	hourAgo := now.Add(-time.Hour)
+	ts.sent = slices.DeleteFunc(ts.sent, func(s throttleSent) bool { return !s.time.After(hourAgo) })
+	ts.sent = append(ts.sent, throttleSent{now, n})
+}
+
+// destinationMXHosts registers the MX hosts for a recipient domain, for matching
+// against the MX hosts of throttles.
+func destinationMXHosts(dom dns.IPDomain, hosts []smtpclient.HostPref) {
+	if dom.IsIP() {
+		return
+	}
+	names := make([]string, 0, len(mox.Conf.Static.DestinationThrottles))
+	for name := range mox.Conf.Static.DestinationThrottles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var match string
+findMatch:
+	for _, name := range names {
+		for _, h := range hosts {
+			if h.Host.IsDomain() && matchDomainASCII(h.Host.Domain.ASCII, mox.Conf.Static.DestinationThrottles[name].MXHostsASCII) {
+				match = name
+				break findMatch
+			}
+		}
+	}
+
+	destinations.Lock()
+	defer destinations.Unlock()
+	destinations.mxThrottles[formatIPDomain(dom)] = match
+}
+
+// Matches texts in SMTP responses about rate limiting.
+var rateLimitRegexp = regexp.MustCompile(`(?i)\b(rate|rate[- ]limit(ed|ing)?|too many (messages|emails|connections|recipients)|throttl\w*|busy)\b`)
+
+// isRateLimited returns whether err is a temporary SMTP error that looks like
+// the remote server is rate limiting us.
+func isRateLimited(err error) bool {
+	cerr, ok := err.(smtpclient.Error)
+	if !ok || cerr.Permanent || cerr.Code/100 != 4 {
+		return false
+	}
+	if cerr.Code == smtp.C421ServiceUnavail {
+		return true
+	}
+	return rateLimitRegexp.MatchString(strings.Join(append([]string{cerr.Line}, cerr.MoreLines...), "\n"))
+}
+
+// destResults holds the number of messages per result of a delivery attempt to a
+// destination.
+type destResults struct {
+	delivered, tempErrors, permErrors, rateLimited int
+}
+
+// destinationResult registers the results of a delivery attempt to the recipient
+// domain, to be called once per attempt. If the attempt had responses that look
+// like rate limiting, a backoff for the destination is started or extended.
+// Otherwise, successful deliveries reset the backoff.
+func destinationResult(dom dns.IPDomain, r destResults) {
+	destinations.Lock()
+	defer destinations.Unlock()
+
+	ds, ts, _ := destinationState(dom)
+	add := func(delivered, tempErrors, permErrors, rateLimited *int) {
+		*delivered += r.delivered
+		*tempErrors += r.tempErrors
+		*permErrors += r.permErrors
+		*rateLimited += r.rateLimited
+	}
+	add(&ds.Delivered, &ds.TempErrors, &ds.PermErrors, &ds.RateLimited)
+	label := "none"
+	if ts != nil {
+		label = ts.Name
+		add(&ts.Delivered, &ts.TempErrors, &ts.PermErrors, &ts.RateLimited)
+	}
+	for result, n := range map[string]int{destDelivered: r.delivered, destTempError: r.tempErrors, destPermError: r.permErrors, destRateLimited: r.rateLimited} {
+		if n > 0 {
+			metricDestinationDelivery.WithLabelValues(label, result).Add(float64(n))
+		}
+	}
+
+	backoff, until := &ds.backoff, &ds.BackoffUntil
+	if ts != nil {
+		backoff, until = &ts.backoff, &ts.BackoffUntil
+	}
+	if r.rateLimited > 0 {
+		*backoff = min(max(2**backoff, destBackoffMin), destBackoffMax)
+		*until = time.Now().Add(*backoff)
+		metricDestinationBackoff.WithLabelValues(label).Inc()
+	} else if r.delivered > 0 {
+		*backoff = 0
+	}
+}
+
+// DeliveryStats holds the state of destination throttles, statistics about
+// deliveries to recipient domains, and the warm-up state of IPs in IP pools.
+type DeliveryStats struct {
+	Throttles    []ThrottleStats
+	Destinations []DestinationStats // Most recent delivery attempt first.
+	IPWarmups    []IPWarmupStats
+}
+
+// DeliveryStatsGet returns current delivery stats, for the admin web interface.
+func DeliveryStatsGet() (DeliveryStats, error) {
+	now := time.Now()
+
+	var stats DeliveryStats
+	destinations.Lock()
+	names := make([]string, 0, len(mox.Conf.Static.DestinationThrottles))
+	for name := range mox.Conf.Static.DestinationThrottles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t := mox.Conf.Static.DestinationThrottles[name]
+		ts := ThrottleStats{Name: name}
+		if xts := destinations.throttles[name]; xts != nil {
+			ts = *xts
+			ts.MessagesMinute, _ = throttleMessages(xts, now.Add(-time.Minute), time.Minute)
+			ts.MessagesHour, _ = throttleMessages(xts, now.Add(-time.Hour), time.Hour)
+			ts.sent = nil
+		}
+		ts.MaxConcurrent = t.MaxConcurrent
+		ts.MessagesPerMinute = t.MessagesPerMinute
+		ts.MessagesPerHour = t.MessagesPerHour
+		stats.Throttles = append(stats.Throttles, ts)
+	}
+	for _, ds := range destinations.domains {
+		if ds.Active > 0 || now.Sub(ds.LastAttempt) <= 24*time.Hour {
+			stats.Destinations = append(stats.Destinations, *ds)
+		}
+	}
+	destinations.Unlock()
+
+	sort.Slice(stats.Destinations, func(i, j int) bool {
+		return stats.Destinations[i].LastAttempt.After(stats.Destinations[j].LastAttempt)
+	})
+
+	var err error
+	stats.IPWarmups, err = ipWarmupStats(now)
+	return stats, err
+}
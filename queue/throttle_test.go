@@ -0,0 +1,117 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/smtpclient"
+)
+
+func TestDestinationThrottle(t *testing.T) {
+	_, cleanup := setup(t)
+	defer cleanup()
+
+	mox.Conf.Static.DestinationThrottles = map[string]config.DestinationThrottle{
+		"big": {
+			DomainsASCII:      []string{"big.example", ".big.example"},
+			MXHostsASCII:      []string{".mx.big.example"},
+			MaxConcurrent:     1,
+			MessagesPerMinute: 3,
+		},
+	}
+	defer func() {
+		mox.Conf.Static.DestinationThrottles = nil
+	}()
+
+	// Start without state from deliveries in other tests.
+	destinations.Lock()
+	destinations.domains = map[string]*DestinationStats{}
+	destinations.throttles = map[string]*ThrottleStats{}
+	destinations.mxThrottles = map[string]string{}
+	destinations.Unlock()
+
+	ipdom := func(s string) dns.IPDomain {
+		return dns.IPDomain{Domain: dns.Domain{ASCII: s}}
+	}
+	now := time.Now()
+	throttled := func(dom dns.IPDomain, expThrottled bool, expUntil time.Time) {
+		t.Helper()
+		until, throttled := destinationThrottled(dom, now)
+		tcompare(t, throttled, expThrottled)
+		tcompare(t, until.Equal(expUntil), true)
+	}
+
+	big := ipdom("big.example")
+	sub := ipdom("sub.big.example")
+	other := ipdom("other.example")
+	hosted := ipdom("hosted.example")
+
+	// Concurrency limit applies to all domains of the throttle.
+	throttled(big, false, time.Time{})
+	destinationStart(big, now)
+	throttled(sub, true, time.Time{})
+	throttled(other, false, time.Time{})
+	destinationDone(big)
+	throttled(sub, false, time.Time{})
+
+	// Rate limit per minute.
+	destinationSent(big, 2, now.Add(-30*time.Second))
+	throttled(big, false, time.Time{})
+	destinationSent(sub, 1, now)
+	throttled(big, true, now.Add(30*time.Second))
+
+	// Throttle matched through MX hosts.
+	throttled(hosted, false, time.Time{})
+	destinationMXHosts(hosted, []smtpclient.HostPref{{Host: ipdom("in1.mx.big.example"), Pref: 10}})
+	throttled(hosted, true, now.Add(30*time.Second))
+
+	// Rate limiting responses start a backoff, doubling until a successful delivery.
+	destinationStart(other, now)
+	destinationDone(other)
+	destinationResult(other, destResults{rateLimited: 1})
+	until, ok := destinationThrottled(other, now)
+	tcompare(t, ok, true)
+	tcompare(t, until.Sub(now) > 50*time.Second && until.Sub(now) <= 70*time.Second, true)
+	destinationResult(other, destResults{rateLimited: 1})
+	until, _ = destinationThrottled(other, now)
+	tcompare(t, until.Sub(now) > 110*time.Second, true)
+	destinationResult(other, destResults{delivered: 2})
+	tcompare(t, destinations.domains["other.example"].backoff, time.Duration(0))
+
+	stats, err := DeliveryStatsGet()
+	tcheck(t, err, "delivery stats")
+	tcompare(t, len(stats.Throttles), 1)
+	ts := stats.Throttles[0]
+	tcompare(t, []int{ts.Active, ts.MaxConcurrent, ts.MessagesMinute, ts.MessagesHour, ts.MessagesPerMinute}, []int{0, 1, 3, 3, 3})
+	var found bool
+	for _, ds := range stats.Destinations {
+		if ds.Domain == "other.example" {
+			found = true
+			tcompare(t, []int{ds.Delivered, ds.RateLimited}, []int{2, 2})
+		}
+	}
+	tcompare(t, found, true)
+}
+
+func TestIsRateLimited(t *testing.T) {
+	test := func(err error, exp bool) {
+		t.Helper()
+		tcompare(t, isRateLimited(err), exp)
+	}
+
+	test(smtpclient.Error{Code: 421, Line: "421 4.7.0 Try again later, closing connection."}, true)
+	test(smtpclient.Error{Code: 450, Secode: "2.1", Line: "450 4.2.1 The user you are trying to contact is receiving mail at a rate that prevents additional messages from being delivered."}, true)
+	test(smtpclient.Error{Code: 451, Secode: "7.500", Line: "451 4.7.500 Server busy. Please try again later."}, true)
+	test(smtpclient.Error{Code: 452, Line: "452 Too many messages from your IP"}, true)
+	test(smtpclient.Error{Code: 451, Secode: "7.1", Line: "451 4.7.1 Greylisted, try again later"}, false)
+	test(smtpclient.Error{Code: 450, Line: "450 Mailbox unavailable, separate issue"}, false)
+	test(smtpclient.Error{Permanent: true, Code: 550, Line: "550 5.7.1 Rate limit exceeded"}, false)
+	test(errDummy{}, false)
+}
+
+type errDummy struct{}
+
+func (errDummy) Error() string { return "dummy" }
@@ -248,65 +248,9 @@ Troubleshooting hints:
 
 	// If we find IPs based on network interfaces, {public,private}ListenerIPs are set
 	// based on these values.
-	var loopbackIPs, privateIPs, publicIPs []string
-
-	// Gather IP addresses for public and private listeners.
-	// We look at each network interface. If an interface has a private address, we
-	// conservatively assume all addresses on that interface are private.
-	ifaces, err := net.Interfaces()
+	loopbackIPs, privateIPs, publicIPs, err := interfaceIPs()
 	if err != nil {
-		fatalf("listing network interfaces: %s", err)
-	}
-	parseAddrIP := func(s string) net.IP {
-		if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
-			s = s[1 : len(s)-1]
-		}
-		ip, _, _ := net.ParseCIDR(s)
-		return ip
-	}
-	for _, iface := range ifaces {
-		if iface.Flags&net.FlagUp == 0 {
-			continue
-		}
-		addrs, err := iface.Addrs()
-		if err != nil {
-			fatalf("listing address for network interface: %s", err)
-		}
-		if len(addrs) == 0 {
-			continue
-		}
-
-		// todo: should we detect temporary/ephemeral ipv6 addresses and not add them?
-		var nonpublic bool
-		for _, addr := range addrs {
-			ip := parseAddrIP(addr.String())
-			if ip.IsInterfaceLocalMulticast() || ip.IsLinkLocalMulticast() || ip.IsLinkLocalUnicast() || ip.IsMulticast() {
-				continue
-			}
-			if ip.IsLoopback() || ip.IsPrivate() {
-				nonpublic = true
-				break
-			}
-		}
-
-		for _, addr := range addrs {
-			ip := parseAddrIP(addr.String())
-			if ip == nil {
-				continue
-			}
-			if ip.IsInterfaceLocalMulticast() || ip.IsLinkLocalMulticast() || ip.IsLinkLocalUnicast() || ip.IsMulticast() {
-				continue
-			}
-			if nonpublic {
-				if ip.IsLoopback() {
-					loopbackIPs = append(loopbackIPs, ip.String())
-				} else {
-					privateIPs = append(privateIPs, ip.String())
-				}
-			} else {
-				publicIPs = append(publicIPs, ip.String())
-			}
-		}
+		fatalf("%s", err)
 	}
 
 	var dnshostname dns.Domain
@@ -836,6 +780,9 @@ and check the admin page for the needed DNS records.`)
 		public.MTASTSHTTPS.Enabled = true
 		public.WebserverHTTP.Enabled = true
 		public.WebserverHTTPS.Enabled = true
+		// Calendar and contacts clients typically run on phones, they need access
+		// through the public listener.
+		public.DAVHTTPS.Enabled = true
 	}
 
 	// Suggest blocklists, but we'll comment them out after generating the config.
@@ -856,6 +803,7 @@ and check the admin page for the needed DNS records.`)
 	internal.AdminHTTP.Enabled = true
 	internal.WebmailHTTP.Enabled = true
 	internal.WebAPIHTTP.Enabled = true
+	internal.DAVHTTP.Enabled = true
 	internal.MetricsHTTP.Enabled = true
 	if existingWebserver {
 		internal.AccountHTTP.Port = 1080
@@ -866,6 +814,8 @@ and check the admin page for the needed DNS records.`)
 		internal.WebmailHTTP.Forwarded = true
 		internal.WebAPIHTTP.Port = 1080
 		internal.WebAPIHTTP.Forwarded = true
+		internal.DAVHTTP.Port = 1080
+		internal.DAVHTTP.Forwarded = true
 		internal.AutoconfigHTTPS.Enabled = true
 		internal.AutoconfigHTTPS.Port = 81
 		internal.AutoconfigHTTPS.NonTLS = true
@@ -1127,3 +1077,67 @@ and 80, see "mox help quickstart" with the -existing-webserver option.
 
 	cleanupPaths = nil
 }
+
+// interfaceIPs returns the IPs of the network interfaces that are up, grouped
+// into loopback, private and public IPs.
+//
+// We look at each network interface. If an interface has a private address, we
+// conservatively assume all addresses on that interface are private.
+func interfaceIPs() (loopbackIPs, privateIPs, publicIPs []string, rerr error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("listing network interfaces: %s", err)
+	}
+	parseAddrIP := func(s string) net.IP {
+		if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+			s = s[1 : len(s)-1]
+		}
+		ip, _, _ := net.ParseCIDR(s)
+		return ip
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("listing address for network interface: %s", err)
+		}
+		if len(addrs) == 0 {
+			continue
+		}
+
+		// todo: should we detect temporary/ephemeral ipv6 addresses and not add them?
+		var nonpublic bool
+		for _, addr := range addrs {
+			ip := parseAddrIP(addr.String())
+			if ip.IsInterfaceLocalMulticast() || ip.IsLinkLocalMulticast() || ip.IsLinkLocalUnicast() || ip.IsMulticast() {
+				continue
+			}
+			if ip.IsLoopback() || ip.IsPrivate() {
+				nonpublic = true
+				break
+			}
+		}
+
+		for _, addr := range addrs {
+			ip := parseAddrIP(addr.String())
+			if ip == nil {
+				continue
+			}
+			if ip.IsInterfaceLocalMulticast() || ip.IsLinkLocalMulticast() || ip.IsLinkLocalUnicast() || ip.IsMulticast() {
+				continue
+			}
+			if nonpublic {
+				if ip.IsLoopback() {
+					loopbackIPs = append(loopbackIPs, ip.String())
+				} else {
+					privateIPs = append(privateIPs, ip.String())
+				}
+			} else {
+				publicIPs = append(publicIPs, ip.String())
+			}
+		}
+	}
+	return
+}
@@ -2,7 +2,11 @@
 package ratelimit
 
 import (
+	"bytes"
+	"cmp"
 	"net"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 )
@@ -12,6 +16,7 @@ import (
 type Limiter struct {
 	sync.Mutex
 	WindowLimits []WindowLimit
+	Allowlist    []net.IPNet // IPs in these networks are never limited, and not counted.
 	ipmasked     [3][16]byte
 }
 
@@ -39,6 +44,10 @@ func (l *Limiter) CanAdd(ip net.IP, tm time.Time, n int64) bool {
 }
 
 func (l *Limiter) checkAdd(add bool, ip net.IP, tm time.Time, n int64) bool {
+	if l.allowed(ip) {
+		return true
+	}
+
 	l.Lock()
 	defer l.Unlock()
 
@@ -86,6 +95,10 @@ func (l *Limiter) checkAdd(add bool, ip net.IP, tm time.Time, n int64) bool {
 
 // Reset sets the counter to 0 for key and ip, and subtracts from the ipmasked counts.
 func (l *Limiter) Reset(ip net.IP, tm time.Time) {
+	if l.allowed(ip) {
+		return
+	}
+
 	l.Lock()
 	defer l.Unlock()
 
@@ -115,32 +128,146 @@ func (l *Limiter) Reset(ip net.IP, tm time.Time) {
 	}
 }
 
+func (l *Limiter) allowed(ip net.IP) bool {
+	for _, n := range l.Allowlist {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 func (l *Limiter) maskIP(i int, ip net.IP) [16]byte {
 	isv4 := ip.To4() != nil
+	ipmasked := ip.Mask(maskNet(i, isv4).Mask)
+	return *(*[16]byte)(ipmasked.To16())
+}
 
-	var ipmasked net.IP
+// maskNet returns the network mask for the IP class/subnet, for IPv4 or IPv6.
+func maskNet(i int, isv4 bool) net.IPNet {
 	if isv4 {
 		switch i {
 		case 0:
-			ipmasked = ip
+			return net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(32, 32)}
 		case 1:
-			ipmasked = ip.Mask(net.CIDRMask(26, 32))
+			return net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(26, 32)}
 		case 2:
-			ipmasked = ip.Mask(net.CIDRMask(21, 32))
+			return net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(21, 32)}
 		default:
 			panic("missing case for maskip ipv4")
 		}
-	} else {
-		switch i {
-		case 0:
-			ipmasked = ip.Mask(net.CIDRMask(64, 128))
-		case 1:
-			ipmasked = ip.Mask(net.CIDRMask(48, 128))
-		case 2:
-			ipmasked = ip.Mask(net.CIDRMask(32, 128))
-		default:
-			panic("missing case for masking ipv6")
+	}
+	switch i {
+	case 0:
+		return net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(64, 128)}
+	case 1:
+		return net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(48, 128)}
+	case 2:
+		return net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(32, 128)}
+	default:
+		panic("missing case for masking ipv6")
+	}
+}
+
+// Entry is a count for an IP class/subnet in the current time window of a limiter.
+type Entry struct {
+	Window time.Duration
+	Time   uint32 // Time/Window, identifies the window.
+	Index  uint8  // IP class/subnet, 0 for a single IP (or IPv6 /64), 1 and 2 for the larger networks.
+	Net    string // IP or network in CIDR notation.
+	Count  int64
+	Limit  int64 // Limit for this IP class/subnet in this window.
+}
+
+// Entries returns all non-zero counts for the windows that are current at tm.
+func (l *Limiter) Entries(tm time.Time) []Entry {
+	l.Lock()
+	defer l.Unlock()
+
+	var entries []Entry
+	for _, pl := range l.WindowLimits {
+		t := uint32(tm.UnixNano() / int64(pl.Window))
+		if t != pl.Time {
+			continue
+		}
+		for k, v := range pl.Counts {
+			if v <= 0 {
+				continue
+			}
+			ip := net.IP(bytes.Clone(k.IPMasked[:]))
+			isv4 := ip.To4() != nil
+			if isv4 {
+				ip = ip.To4()
+			}
+			ones, _ := maskNet(int(k.Index), isv4).Mask.Size()
+			ipnet := net.IPNet{IP: ip, Mask: net.CIDRMask(ones, len(ip)*8)}
+			entries = append(entries, Entry{pl.Window, pl.Time, k.Index, ipnet.String(), v, pl.Limits[k.Index]})
+		}
+	}
+	slices.SortFunc(entries, func(a, b Entry) int {
+		if a.Window != b.Window {
+			return cmp.Compare(a.Window, b.Window)
+		}
+		if a.Index != b.Index {
+			return cmp.Compare(a.Index, b.Index)
+		}
+		return strings.Compare(a.Net, b.Net)
+	})
+	return entries
+}
+
+// Restore adds counts, e.g. saved with Entries before a restart. Entries for
+// windows that are not configured for the limiter, or that are no longer current
+// at tm, are ignored.
+func (l *Limiter) Restore(entries []Entry, tm time.Time) {
+	l.Lock()
+	defer l.Unlock()
+
+	for _, e := range entries {
+		_, ipnet, err := net.ParseCIDR(e.Net)
+		if err != nil || e.Index > 2 {
+			continue
+		}
+		for i, pl := range l.WindowLimits {
+			t := uint32(tm.UnixNano() / int64(pl.Window))
+			if pl.Window != e.Window || t != e.Time {
+				continue
+			}
+			if pl.Time != t || pl.Counts == nil {
+				l.WindowLimits[i].Time = t
+				l.WindowLimits[i].Counts = map[struct {
+					Index    uint8
+					IPMasked [16]byte
+				}]int64{}
+			}
+			k := struct {
+				Index    uint8
+				IPMasked [16]byte
+			}{e.Index, *(*[16]byte)(ipnet.IP.To16())}
+			l.WindowLimits[i].Counts[k] += e.Count
+		}
+	}
+}
+
+// Clear removes the counts for all IPs and networks that overlap with ipnet, in
+// all windows. Clearing a single IP also clears the counts of the networks it is
+// in.
+func (l *Limiter) Clear(ipnet net.IPNet) {
+	l.Lock()
+	defer l.Unlock()
+
+	for _, pl := range l.WindowLimits {
+		for k := range pl.Counts {
+			ip := net.IP(k.IPMasked[:])
+			isv4 := ip.To4() != nil
+			if isv4 != (ipnet.IP.To4() != nil) {
+				continue
+			}
+			n := maskNet(int(k.Index), isv4)
+			n.IP = ip
+			if ipnet.Contains(ip) || n.Contains(ipnet.IP) {
+				delete(pl.Counts, k)
+			}
 		}
 	}
-	return *(*[16]byte)(ipmasked.To16())
 }
@@ -70,3 +70,67 @@ func TestLimiter(t *testing.T) {
 	check(true, net.ParseIP("10.0.1.1"), min3, 1)    // ipmasked3 still ok
 	check(false, net.ParseIP("10.0.1.255"), min3, 1) // ipmasked3 also full
 }
+
+func TestLimiterEntries(t *testing.T) {
+	newLimiter := func() *Limiter {
+		return &Limiter{
+			WindowLimits: []WindowLimit{
+				{
+					Window: time.Minute,
+					Limits: [...]int64{2, 4, 6},
+				},
+			},
+			Allowlist: []net.IPNet{{IP: net.ParseIP("10.1.0.0"), Mask: net.CIDRMask(16, 32)}},
+		}
+	}
+	l := newLimiter()
+
+	now := time.Now()
+	l.Add(net.ParseIP("10.0.0.1"), now, 2)
+	l.Add(net.ParseIP("10.0.0.2"), now, 1)
+	if !l.Add(net.ParseIP("10.1.0.1"), now, 100) {
+		t.Fatalf("allowlisted ip was limited")
+	}
+
+	entries := l.Entries(now)
+	exp := []string{"10.0.0.1/32", "10.0.0.2/32", "10.0.0.0/26", "10.0.0.0/21"}
+	if len(entries) != len(exp) {
+		t.Fatalf("got entries %v, expected %v", entries, exp)
+	}
+	for i, e := range entries {
+		if e.Net != exp[i] {
+			t.Fatalf("entry %d, got net %q, expected %q", i, e.Net, exp[i])
+		}
+	}
+	if entries[0].Count != 2 || entries[0].Limit != 2 || entries[2].Count != 3 {
+		t.Fatalf("unexpected counts in entries %v", entries)
+	}
+
+	// Restore in new limiter, e.g. after restart.
+	l = newLimiter()
+	l.Restore(entries, now)
+	if l.CanAdd(net.ParseIP("10.0.0.1"), now, 1) {
+		t.Fatalf("restored limiter allows ip at limit")
+	}
+	if !l.CanAdd(net.ParseIP("10.0.0.2"), now, 1) {
+		t.Fatalf("restored limiter does not allow ip below limit")
+	}
+	// Entries from an older window are not restored.
+	l = newLimiter()
+	l.Restore(entries, now.Add(time.Minute))
+	if len(l.Entries(now.Add(time.Minute))) != 0 {
+		t.Fatalf("entries from old window were restored")
+	}
+
+	// Clearing an IP also clears the networks it is in.
+	l = newLimiter()
+	l.Restore(entries, now)
+	l.Clear(net.IPNet{IP: net.ParseIP("10.0.0.1"), Mask: net.CIDRMask(32, 32)})
+	entries = l.Entries(now)
+	if len(entries) != 1 || entries[0].Net != "10.0.0.2/32" {
+		t.Fatalf("got entries %v after clear, expected only 10.0.0.2/32", entries)
+	}
+	if !l.CanAdd(net.ParseIP("10.0.0.1"), now, 2) {
+		t.Fatalf("cleared ip still limited")
+	}
+}
@@ -0,0 +1,307 @@
+package recursor
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/moxio"
+)
+
+// DefaultTrustAnchors are the DS records for the root zone key signing keys, from
+// https://data.iana.org/root-anchors/root-anchors.xml.
+var DefaultTrustAnchors = []string{
+	". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+	". IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+}
+
+// holdDown is the time a new key signing key must be seen in the root DNSKEY set
+// before it is trusted, RFC 5011 section 2.4.1.
+const holdDown = 30 * 24 * time.Hour
+
+// anchorState is kept in a file, for automated updates of trust anchors according
+// to RFC 5011.
+type anchorState struct {
+	Keys    []anchorKey
+	Revoked []string // Base64 DNSKEY rdata, without revoke flag.
+}
+
+type anchorKey struct {
+	DNSKEY    string // Base64 rdata.
+	FirstSeen time.Time
+	Trusted   bool // After hold-down time.
+}
+
+// anchors holds the configured trust anchors for the root zone, and the keys
+// added through RFC 5011 updates.
+type anchors struct {
+	sync.Mutex
+	log   mlog.Log
+	ds    []ds
+	keys  [][]byte // DNSKEY rdata.
+	file  string   // If empty, no updates.
+	state anchorState
+}
+
+// ParseTrustAnchor parses a trust anchor for the root zone in DNS presentation
+// format, either a DS or DNSKEY record, e.g.:
+//
+//	. IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D
+func ParseTrustAnchor(s string) (isDS bool, rdata []byte, err error) {
+	t := strings.Fields(s)
+	if len(t) == 0 || t[0] != "." {
+		return false, nil, errors.New("trust anchor must be for root zone")
+	}
+	t = t[1:]
+	// Optional TTL and class.
+	if len(t) > 0 {
+		if _, err := strconv.ParseUint(t[0], 10, 32); err == nil {
+			t = t[1:]
+		}
+	}
+	if len(t) > 0 && strings.EqualFold(t[0], "IN") {
+		t = t[1:]
+	}
+	if len(t) < 5 {
+		return false, nil, errors.New("missing fields in trust anchor")
+	}
+	num := func(s string, bits int) (uint64, error) {
+		return strconv.ParseUint(s, 10, bits)
+	}
+	switch strings.ToUpper(t[0]) {
+	case "DS":
+		tag, err := num(t[1], 16)
+		if err != nil {
+			return false, nil, fmt.Errorf("parsing key tag: %v", err)
+		}
+		alg, err := num(t[2], 8)
+		if err != nil {
+			return false, nil, fmt.Errorf("parsing algorithm: %v", err)
+		}
+		dt, err := num(t[3], 8)
+		if err != nil {
+			return false, nil, fmt.Errorf("parsing digest type: %v", err)
+		}
+		digest, err := hex.DecodeString(strings.Join(t[4:], ""))
+		if err != nil {
+			return false, nil, fmt.Errorf("parsing digest: %v", err)
+		}
+		rdata = []byte{byte(tag >> 8), byte(tag), byte(alg), byte(dt)}
+		return true, append(rdata, digest...), nil
+	case "DNSKEY":
+		flags, err := num(t[1], 16)
+		if err != nil {
+			return false, nil, fmt.Errorf("parsing flags: %v", err)
+		}
+		proto, err := num(t[2], 8)
+		if err != nil {
+			return false, nil, fmt.Errorf("parsing protocol: %v", err)
+		}
+		alg, err := num(t[3], 8)
+		if err != nil {
+			return false, nil, fmt.Errorf("parsing algorithm: %v", err)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.Join(t[4:], ""))
+		if err != nil {
+			return false, nil, fmt.Errorf("parsing public key: %v", err)
+		}
+		rdata = []byte{byte(flags >> 8), byte(flags), byte(proto), byte(alg)}
+		return false, append(rdata, key...), nil
+	}
+	return false, nil, fmt.Errorf("unknown trust anchor type %q, must be DS or DNSKEY", t[0])
+}
+
+func newAnchors(log mlog.Log, trustAnchors []string, file string) (*anchors, error) {
+	if len(trustAnchors) == 0 {
+		trustAnchors = DefaultTrustAnchors
+	}
+	a := &anchors{log: log, file: file}
+	for _, s := range trustAnchors {
+		isDS, rdata, err := ParseTrustAnchor(s)
+		if err != nil {
+			return nil, fmt.Errorf("parsing trust anchor %q: %v", s, err)
+		}
+		if isDS {
+			d, err := parseDS(rdata)
+			if err != nil {
+				return nil, fmt.Errorf("parsing trust anchor %q: %v", s, err)
+			}
+			a.ds = append(a.ds, d)
+		} else {
+			a.keys = append(a.keys, rdata)
+		}
+	}
+	if file != "" {
+		buf, err := os.ReadFile(file)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("reading trust anchor state: %v", err)
+		} else if err == nil {
+			if err := json.Unmarshal(buf, &a.state); err != nil {
+				return nil, fmt.Errorf("parsing trust anchor state: %v", err)
+			}
+		}
+	}
+	return a, nil
+}
+
+// trusted returns the DS records and DNSKEYs currently trusted for the root zone.
+// Keys that have been revoked are not returned.
+func (a *anchors) trusted() ([]ds, [][]byte) {
+	a.Lock()
+	defer a.Unlock()
+
+	revoked := map[string]bool{}
+	for _, s := range a.state.Revoked {
+		revoked[s] = true
+	}
+	var dss []ds
+	for _, d := range a.ds {
+		var isRevoked bool
+		for s := range revoked {
+			buf, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				continue
+			}
+			k, err := parseDNSKEY(rr{Data: buf})
+			if err == nil && dsMatches(d, rootName, k) {
+				isRevoked = true
+				break
+			}
+		}
+		if !isRevoked {
+			dss = append(dss, d)
+		}
+	}
+	var keys [][]byte
+	for _, k := range a.keys {
+		if !revoked[base64.StdEncoding.EncodeToString(k)] {
+			keys = append(keys, k)
+		}
+	}
+	for _, k := range a.state.Keys {
+		if k.Trusted && !revoked[k.DNSKEY] {
+			if buf, err := base64.StdEncoding.DecodeString(k.DNSKEY); err == nil {
+				keys = append(keys, buf)
+			}
+		}
+	}
+	return dss, keys
+}
+
+// update processes the validated root DNSKEY set for RFC 5011 trust anchor
+// updates: New key signing keys are trusted after the hold-down time, and
+// revoked keys that have signed the DNSKEY set are no longer trusted.
+func (a *anchors) update(keys []dnskey, sigs []rrsig, now time.Time) {
+	if a.file == "" {
+		return
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	var keyrrs []rr
+	for _, k := range keys {
+		keyrrs = append(keyrrs, k.rr)
+	}
+
+	var changed bool
+	present := map[string]bool{}
+	for _, k := range keys {
+		if k.Flags&flagSEP == 0 || !algorithmSupported(k.Algorithm) {
+			continue
+		}
+		if k.Flags&flagRevoke != 0 {
+			// Key must have signed the DNSKEY set itself, with the revoke flag set.
+			tag := keyTag(k.rr.Data)
+			unrevoked := k
+			unrevoked.Flags &^= flagRevoke
+			var selfSigned bool
+			for _, sig := range sigs {
+				if sig.KeyTag == tag && sig.Algorithm == k.Algorithm && verifySignature(sig, unrevoked, keyrrs, now) == nil {
+					selfSigned = true
+					break
+				}
+			}
+			data := slices.Clone(k.rr.Data)
+			data[1] &^= flagRevoke
+			s := base64.StdEncoding.EncodeToString(data)
+			if selfSigned && !slices.Contains(a.state.Revoked, s) {
+				a.log.Info("dnssec root trust anchor revoked", slog.Int("keytag", int(keyTag(data))))
+				a.state.Revoked = append(a.state.Revoked, s)
+				a.state.Keys = slices.DeleteFunc(a.state.Keys, func(ak anchorKey) bool { return ak.DNSKEY == s })
+				changed = true
+			}
+			continue
+		}
+
+		s := base64.StdEncoding.EncodeToString(k.rr.Data)
+		present[s] = true
+		if a.anchored(k) || slices.Contains(a.state.Revoked, s) {
+			continue
+		}
+		i := slices.IndexFunc(a.state.Keys, func(ak anchorKey) bool { return ak.DNSKEY == s })
+		if i < 0 {
+			a.log.Info("new dnssec root key signing key seen, pending hold-down", slog.Int("keytag", int(keyTag(k.rr.Data))))
+			a.state.Keys = append(a.state.Keys, anchorKey{DNSKEY: s, FirstSeen: now})
+			changed = true
+		} else if ak := &a.state.Keys[i]; !ak.Trusted && now.Sub(ak.FirstSeen) >= holdDown {
+			a.log.Info("dnssec root key signing key now trusted after hold-down", slog.Int("keytag", int(keyTag(k.rr.Data))))
+			ak.Trusted = true
+			changed = true
+		}
+	}
+	// Pending keys that disappeared must start their hold-down again when they
+	// reappear, RFC 5011 section 4.
+	n := len(a.state.Keys)
+	a.state.Keys = slices.DeleteFunc(a.state.Keys, func(ak anchorKey) bool { return !ak.Trusted && !present[ak.DNSKEY] })
+	changed = changed || len(a.state.Keys) != n
+
+	if changed {
+		if err := a.save(); err != nil {
+			a.log.Errorx("saving dnssec trust anchor state", err)
+		}
+	}
+}
+
+// anchored returns whether key is a configured trust anchor, or matches a
+// configured DS trust anchor. Must be called with lock held.
+func (a *anchors) anchored(k dnskey) bool {
+	for _, d := range a.ds {
+		if dsMatches(d, rootName, k) {
+			return true
+		}
+	}
+	for _, buf := range a.keys {
+		if slices.Equal(buf, k.rr.Data) {
+			return true
+		}
+	}
+	return false
+}
+
+// save writes the anchor state atomically. Must be called with lock held.
+func (a *anchors) save() error {
+	buf, err := json.MarshalIndent(a.state, "", "\t")
+	if err != nil {
+		return fmt.Errorf("marshal trust anchor state: %v", err)
+	}
+	tmp := a.file + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0660); err != nil {
+		return fmt.Errorf("write trust anchor state: %v", err)
+	}
+	if err := os.Rename(tmp, a.file); err != nil {
+		return fmt.Errorf("rename trust anchor state file: %v", err)
+	}
+	return moxio.SyncDir(a.log, filepath.Dir(a.file))
+}
@@ -0,0 +1,145 @@
+package recursor
+
+import (
+	"crypto/ed25519"
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testKey struct {
+	priv ed25519.PrivateKey
+	key  dnskey
+}
+
+func newTestKey(t *testing.T, flags uint16) testKey {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(cryptorand.Reader)
+	tcheck(t, err, "generate key")
+	data := binary.BigEndian.AppendUint16(nil, flags)
+	data = append(data, 3, algED25519)
+	k, err := parseDNSKEY(rr{rootName, typeDNSKEY, classINET, 3600, append(data, pub...)})
+	tcheck(t, err, "parse dnskey")
+	return testKey{priv, k}
+}
+
+// sign returns a signature by k over keys.
+func (k testKey) sign(t *testing.T, keys []dnskey, now time.Time) rrsig {
+	t.Helper()
+	var rrset []rr
+	for _, key := range keys {
+		rrset = append(rrset, key.rr)
+	}
+	d := binary.BigEndian.AppendUint16(nil, typeDNSKEY)
+	d = append(d, algED25519, 0)
+	d = binary.BigEndian.AppendUint32(d, 3600)
+	d = binary.BigEndian.AppendUint32(d, uint32(now.Unix()+3600))
+	d = binary.BigEndian.AppendUint32(d, uint32(now.Unix()-3600))
+	d = binary.BigEndian.AppendUint16(d, keyTag(k.key.rr.Data))
+	d = append(d, rootName...)
+	sig, err := parseRRSIG(rr{rootName, typeRRSIG, classINET, 3600, d})
+	tcheck(t, err, "parse rrsig")
+	data, err := signedData(sig, rrset)
+	tcheck(t, err, "signed data")
+	sig.Signature = ed25519.Sign(k.priv, data)
+	return sig
+}
+
+func TestAnchorUpdates(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "anchors.json")
+
+	k1 := newTestKey(t, 257)
+	d := dsDigest(digestSHA256, rootName, k1.key.rr.Data)
+	anchor := fmt.Sprintf(". IN DS %d %d %d %x", keyTag(k1.key.rr.Data), algED25519, digestSHA256, d)
+
+	a, err := newAnchors(pkglog, []string{anchor}, file)
+	tcheck(t, err, "new anchors")
+
+	checkTrusted := func(a *anchors, expDS, expKeys int) {
+		t.Helper()
+		dss, keys := a.trusted()
+		if len(dss) != expDS || len(keys) != expKeys {
+			t.Fatalf("got %d ds and %d keys trusted, expected %d and %d", len(dss), len(keys), expDS, expKeys)
+		}
+	}
+	checkTrusted(a, 1, 0)
+
+	// New key is pending until hold-down time has passed.
+	now := time.Now()
+	k2 := newTestKey(t, 257)
+	keys := []dnskey{k1.key, k2.key}
+	a.update(keys, []rrsig{k1.sign(t, keys, now)}, now)
+	checkTrusted(a, 1, 0)
+
+	now = now.Add(holdDown / 2)
+	a.update(keys, []rrsig{k1.sign(t, keys, now)}, now)
+	checkTrusted(a, 1, 0)
+
+	now = now.Add(holdDown / 2)
+	a.update(keys, []rrsig{k1.sign(t, keys, now)}, now)
+	checkTrusted(a, 1, 1)
+
+	// State is persisted.
+	a, err = newAnchors(pkglog, []string{anchor}, file)
+	tcheck(t, err, "new anchors")
+	checkTrusted(a, 1, 1)
+
+	// Revocation of k1 without its own signature is ignored.
+	k1r := k1
+	k1r.key, err = parseDNSKEY(rr{rootName, typeDNSKEY, classINET, 3600, append([]byte{k1.key.rr.Data[0], k1.key.rr.Data[1] | flagRevoke}, k1.key.rr.Data[2:]...)})
+	tcheck(t, err, "parse revoked dnskey")
+	keys = []dnskey{k1r.key, k2.key}
+	a.update(keys, []rrsig{k2.sign(t, keys, now)}, now)
+	checkTrusted(a, 1, 1)
+
+	// Self-signed revocation removes the trust anchor.
+	a.update(keys, []rrsig{k1r.sign(t, keys, now), k2.sign(t, keys, now)}, now)
+	checkTrusted(a, 0, 1)
+
+	a, err = newAnchors(pkglog, []string{anchor}, file)
+	tcheck(t, err, "new anchors")
+	checkTrusted(a, 0, 1)
+
+	// A pending key that disappears starts over.
+	k3 := newTestKey(t, 257)
+	keys = []dnskey{k2.key, k3.key}
+	a.update(keys, []rrsig{k2.sign(t, keys, now)}, now)
+	keys = []dnskey{k2.key}
+	a.update(keys, []rrsig{k2.sign(t, keys, now)}, now.Add(holdDown/2))
+	keys = []dnskey{k2.key, k3.key}
+	a.update(keys, []rrsig{k2.sign(t, keys, now)}, now.Add(holdDown))
+	checkTrusted(a, 0, 1)
+	a.update(keys, []rrsig{k2.sign(t, keys, now)}, now.Add(holdDown*2))
+	checkTrusted(a, 0, 2)
+
+	// Without file, no updates are done.
+	a, err = newAnchors(pkglog, []string{anchor}, "")
+	tcheck(t, err, "new anchors")
+	keys = []dnskey{k1.key, k2.key}
+	a.update(keys, []rrsig{k1.sign(t, keys, now)}, now.Add(-holdDown))
+	a.update(keys, []rrsig{k1.sign(t, keys, now)}, now)
+	checkTrusted(a, 1, 0)
+}
+
+func TestParseTrustAnchor(t *testing.T) {
+	for _, s := range DefaultTrustAnchors {
+		isDS, _, err := ParseTrustAnchor(s)
+		tcheck(t, err, "parse default trust anchor")
+		if !isDS {
+			t.Fatalf("default trust anchor not ds")
+		}
+	}
+	isDS, data, err := ParseTrustAnchor(". 3600 IN DNSKEY 257 3 15 l02Woi0iS8Aa25FQkUd9RMzZHJpBoRQwAQEX1SxZJA4=")
+	tcheck(t, err, "parse dnskey trust anchor")
+	if isDS || len(data) != 4+32 {
+		t.Fatalf("bad dnskey trust anchor")
+	}
+	for _, s := range []string{"", "example. IN DS 1 8 2 00", ". IN DS 1 8", ". IN A 1 2 3 4", ". IN DS 1 8 2 zz"} {
+		if _, _, err := ParseTrustAnchor(s); err == nil {
+			t.Fatalf("bad trust anchor %q parsed", s)
+		}
+	}
+}
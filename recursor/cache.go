@@ -0,0 +1,260 @@
+package recursor
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// Cached TTLs are capped, and bogus results are kept for a short while to
+// prevent hammering servers with queries that will fail again.
+const (
+	maxTTL      = 24 * 3600
+	maxNegTTL   = 3 * 3600
+	bogusTTL    = 60
+	minCacheTTL = 1
+)
+
+type security int
+
+const (
+	secInsecure security = iota
+	secSecure
+)
+
+func (s security) String() string {
+	if s == secSecure {
+		return "secure"
+	}
+	return "insecure"
+}
+
+// response is the validated result of a lookup of a single name and type, without
+// following CNAMEs.
+type response struct {
+	Rcode    int  // rcodeSuccess or rcodeNXDomain.
+	Records  []rr // Records of requested type, or a CNAME record. Empty for NXDOMAIN and NODATA.
+	Security security
+	NoData   noData // For secure NODATA responses.
+	TTL      uint32 // At time of validation.
+	Err      error  // Bogus response, wrapping errBogus.
+}
+
+type cacheKey struct {
+	name  string
+	qtype uint16
+}
+
+type answerEntry struct {
+	resp    *response
+	expires time.Time
+}
+
+// zoneEntry holds the validated keys for a zone, or whether it is insecure or not
+// a zone at all.
+type zoneEntry struct {
+	keys     []dnskey // For secure zones.
+	security security
+	notZone  bool  // Name is not at a zone cut.
+	err      error // Bogus.
+	expires  time.Time
+}
+
+type delegation struct {
+	servers []netip.Addr
+	expires time.Time
+}
+
+type nsecEntry struct {
+	nsec    nsec
+	expires time.Time
+}
+
+// cache holds answers, zone keys, delegations and validated NSEC records. The
+// NSEC records are used for synthesizing negative answers without querying,
+// RFC 8198.
+type cache struct {
+	sync.Mutex
+	max         int
+	answers     map[cacheKey]answerEntry
+	zones       map[string]zoneEntry
+	delegations map[string]delegation
+	nsecs       map[string]map[string]nsecEntry // Zone, owner.
+	n           int                             // Number of entries in all maps, excluding zones and delegations.
+}
+
+func newCache(max int) *cache {
+	return &cache{
+		max:         max,
+		answers:     map[cacheKey]answerEntry{},
+		zones:       map[string]zoneEntry{},
+		delegations: map[string]delegation{},
+		nsecs:       map[string]map[string]nsecEntry{},
+	}
+}
+
+func ttlTime(now time.Time, ttl uint32) time.Time {
+	return now.Add(time.Duration(max(ttl, minCacheTTL)) * time.Second)
+}
+
+func (c *cache) answer(name string, qtype uint16, now time.Time) *response {
+	c.Lock()
+	defer c.Unlock()
+	k := cacheKey{name, qtype}
+	e, ok := c.answers[k]
+	if !ok {
+		return nil
+	}
+	if !now.Before(e.expires) {
+		delete(c.answers, k)
+		c.n--
+		return nil
+	}
+	return e.resp
+}
+
+func (c *cache) addAnswer(name string, qtype uint16, resp *response, ttl uint32, now time.Time) {
+	c.Lock()
+	defer c.Unlock()
+	k := cacheKey{name, qtype}
+	if _, ok := c.answers[k]; !ok {
+		c.n++
+	}
+	c.answers[k] = answerEntry{resp, ttlTime(now, ttl)}
+	c.evict(now)
+}
+
+func (c *cache) zone(name string, now time.Time) (zoneEntry, bool) {
+	c.Lock()
+	defer c.Unlock()
+	e, ok := c.zones[name]
+	if ok && !now.Before(e.expires) {
+		delete(c.zones, name)
+		return zoneEntry{}, false
+	}
+	return e, ok
+}
+
+func (c *cache) addZone(name string, e zoneEntry) {
+	c.Lock()
+	defer c.Unlock()
+	c.zones[name] = e
+}
+
+// closestDelegation returns the deepest cached zone that name is in, with its
+// servers. If nothing is cached, ok is false.
+func (c *cache) closestDelegation(name string, now time.Time) (zone string, servers []netip.Addr, ok bool) {
+	c.Lock()
+	defer c.Unlock()
+	for {
+		if d, ok := c.delegations[name]; ok {
+			if now.Before(d.expires) {
+				return name, d.servers, true
+			}
+			delete(c.delegations, name)
+		}
+		if name == rootName {
+			return "", nil, false
+		}
+		name = parentName(name)
+	}
+}
+
+func (c *cache) addDelegation(zone string, servers []netip.Addr, ttl uint32, now time.Time) {
+	c.Lock()
+	defer c.Unlock()
+	c.delegations[zone] = delegation{servers, ttlTime(now, ttl)}
+}
+
+func (c *cache) addNSEC(zone string, n nsec, ttl uint32, now time.Time) {
+	c.Lock()
+	defer c.Unlock()
+	m := c.nsecs[zone]
+	if m == nil {
+		m = map[string]nsecEntry{}
+		c.nsecs[zone] = m
+	}
+	if _, ok := m[n.Owner]; !ok {
+		c.n++
+	}
+	m[n.Owner] = nsecEntry{n, ttlTime(now, ttl)}
+	c.evict(now)
+}
+
+// denials returns proofs with the cached unexpired NSEC records of the zones
+// that name is in, deepest zone first.
+func (c *cache) denials(name string, now time.Time) []*denial {
+	c.Lock()
+	defer c.Unlock()
+	var l []*denial
+	for {
+		if m, ok := c.nsecs[name]; ok {
+			d := &denial{Zone: name, hashes: map[string][]byte{}}
+			for owner, e := range m {
+				if now.Before(e.expires) {
+					d.NSEC = append(d.NSEC, e.nsec)
+				} else {
+					delete(m, owner)
+					c.n--
+				}
+			}
+			if len(d.NSEC) > 0 {
+				l = append(l, d)
+			}
+		}
+		if name == rootName {
+			return l
+		}
+		name = parentName(name)
+	}
+}
+
+// evict removes expired entries when the cache is full. If that does not free up
+// enough space, random entries are removed until the cache is at 3/4 of its
+// maximum size. Must be called with lock held.
+func (c *cache) evict(now time.Time) {
+	if c.n <= c.max {
+		return
+	}
+	for k, e := range c.answers {
+		if !now.Before(e.expires) {
+			delete(c.answers, k)
+			c.n--
+		}
+	}
+	for _, m := range c.nsecs {
+		for k, e := range m {
+			if !now.Before(e.expires) {
+				delete(m, k)
+				c.n--
+			}
+		}
+	}
+	// Map iteration order is random.
+	for k := range c.answers {
+		if c.n <= c.max*3/4 {
+			break
+		}
+		delete(c.answers, k)
+		c.n--
+	}
+	for _, m := range c.nsecs {
+		for k := range m {
+			if c.n <= c.max*3/4 {
+				break
+			}
+			delete(m, k)
+			c.n--
+		}
+	}
+	for k, e := range c.zones {
+		if !now.Before(e.expires) {
+			delete(c.zones, k)
+		}
+	}
+	for k, d := range c.delegations {
+		if !now.Before(d.expires) {
+			delete(c.delegations, k)
+		}
+	}
+}
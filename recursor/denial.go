@@ -0,0 +1,395 @@
+package recursor
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Proofs of non-existence with NSEC, RFC 4035 section 5.4, and NSEC3, RFC 5155
+// section 8. The records passed to the functions in this file must already have
+// been verified.
+
+// maxNSEC3Iterations is the maximum number of additional NSEC3 hash iterations
+// we are willing to compute. Responses with NSEC3 records with more iterations are
+// treated as insecure, RFC 9276 section 3.2.
+const maxNSEC3Iterations = 100
+
+var errNSEC3Iterations = errors.New("nsec3 iterations above limit")
+
+var b32hex = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// typeBitmapHas returns whether type t is in a NSEC/NSEC3 type bitmap, RFC 4034
+// section 4.1.2.
+func typeBitmapHas(bitmap []byte, t uint16) bool {
+	window := byte(t >> 8)
+	bit := byte(t & 0xff)
+	for len(bitmap) >= 2 {
+		w, n := bitmap[0], int(bitmap[1])
+		if n < 1 || n > 32 || len(bitmap) < 2+n {
+			return false
+		}
+		if w == window {
+			i := int(bit / 8)
+			return i < n && bitmap[2+i]&(0x80>>(bit%8)) != 0
+		}
+		bitmap = bitmap[2+n:]
+	}
+	return false
+}
+
+type nsec struct {
+	Owner  string
+	Next   string // Lower case.
+	Bitmap []byte
+}
+
+func parseNSEC(r rr) (nsec, error) {
+	next, bitmap, err := rdataName(r.Data)
+	if err != nil {
+		return nsec{}, err
+	}
+	return nsec{r.Name, lowerName(next), bitmap}, nil
+}
+
+// covers returns whether name is between owner and next, i.e. does not exist.
+// The last NSEC record of a zone has the apex as next name.
+func (n nsec) covers(name string) bool {
+	if compareNames(n.Owner, name) >= 0 {
+		return false
+	}
+	if compareNames(name, n.Next) < 0 || compareNames(n.Next, n.Owner) <= 0 {
+		// An NSEC at a delegation (without SOA) or a DNAME cannot prove non-existence of
+		// names below it, they are in another zone or are redirected, RFC 6840 section
+		// 4.1.
+		if isSubdomain(name, n.Owner) && (typeBitmapHas(n.Bitmap, typeNS) && !typeBitmapHas(n.Bitmap, typeSOA) || typeBitmapHas(n.Bitmap, typeDNAME)) {
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+// commonAncestor returns the longest name that both a and b are a subdomain of.
+func commonAncestor(a, b string) string {
+	la := nameLabels(a)
+	lb := nameLabels(b)
+	n := 0
+	for i, j := len(la)-1, len(lb)-1; i >= 0 && j >= 0 && strings.EqualFold(la[i], lb[j]); i, j = i-1, j-1 {
+		n++
+	}
+	return lastLabels(a, n)
+}
+
+type nsec3 struct {
+	Zone       string
+	Hash       []byte // From owner name.
+	HashAlg    uint8
+	Flags      uint8
+	Iterations uint16
+	Salt       []byte
+	NextHash   []byte
+	Bitmap     []byte
+}
+
+func parseNSEC3(r rr) (nsec3, error) {
+	d := r.Data
+	if len(d) < 5 || r.Name == rootName {
+		return nsec3{}, errMalformed
+	}
+	n := nsec3{
+		Zone:       parentName(r.Name),
+		HashAlg:    d[0],
+		Flags:      d[1],
+		Iterations: binary.BigEndian.Uint16(d[2:]),
+	}
+	sl := int(d[4])
+	d = d[5:]
+	if len(d) < sl+1 {
+		return nsec3{}, errMalformed
+	}
+	n.Salt = d[:sl]
+	d = d[sl:]
+	hl := int(d[0])
+	d = d[1:]
+	if len(d) < hl {
+		return nsec3{}, errMalformed
+	}
+	n.NextHash = d[:hl]
+	n.Bitmap = d[hl:]
+	var err error
+	n.Hash, err = b32hex.DecodeString(strings.ToUpper(nameLabels(r.Name)[0]))
+	if err != nil || len(n.Hash) != len(n.NextHash) {
+		return nsec3{}, errMalformed
+	}
+	return n, nil
+}
+
+// nsec3Hash hashes name with the parameters of n, RFC 5155 section 5.
+func nsec3Hash(name string, salt []byte, iterations uint16) []byte {
+	h := sha1.New()
+	h.Write([]byte(lowerName(name)))
+	h.Write(salt)
+	buf := h.Sum(nil)
+	for range iterations {
+		h.Reset()
+		h.Write(buf)
+		h.Write(salt)
+		buf = h.Sum(buf[:0])
+	}
+	return buf
+}
+
+func (n nsec3) optOut() bool {
+	return n.Flags&1 != 0
+}
+
+func (n nsec3) matches(hash []byte) bool {
+	return bytes.Equal(n.Hash, hash)
+}
+
+// covers returns whether hash is between the owner and next hash. The last NSEC3
+// record in the chain wraps around, covering hashes after its owner and before the
+// first owner.
+func (n nsec3) covers(hash []byte) bool {
+	if bytes.Compare(n.NextHash, n.Hash) <= 0 {
+		return bytes.Compare(hash, n.Hash) > 0 || bytes.Compare(hash, n.NextHash) < 0
+	}
+	return bytes.Compare(n.Hash, hash) < 0 && bytes.Compare(hash, n.NextHash) < 0
+}
+
+// denial holds the records for a proof of non-existence.
+type denial struct {
+	Zone   string
+	NSEC   []nsec
+	NSEC3  []nsec3
+	hashes map[string][]byte
+}
+
+// newDenial parses the NSEC and NSEC3 records of zone in rrs.
+func newDenial(zone string, rrs []rr) (*denial, error) {
+	d := &denial{Zone: zone, hashes: map[string][]byte{}}
+	for _, r := range rrs {
+		switch r.Type {
+		case typeNSEC:
+			if !isSubdomain(r.Name, zone) {
+				continue
+			}
+			n, err := parseNSEC(r)
+			if err != nil {
+				return nil, fmt.Errorf("%w: parsing nsec: %v", errBogus, err)
+			}
+			d.NSEC = append(d.NSEC, n)
+		case typeNSEC3:
+			n, err := parseNSEC3(r)
+			if err != nil {
+				return nil, fmt.Errorf("%w: parsing nsec3: %v", errBogus, err)
+			}
+			if n.Zone != zone || n.HashAlg != 1 {
+				continue
+			}
+			if n.Iterations > maxNSEC3Iterations {
+				return nil, errNSEC3Iterations
+			}
+			d.NSEC3 = append(d.NSEC3, n)
+		}
+	}
+	return d, nil
+}
+
+func (d *denial) hash(name string, n nsec3) []byte {
+	k := name + "\x00" + string(n.Salt) + "\x00" + fmt.Sprint(n.Iterations)
+	if h, ok := d.hashes[k]; ok {
+		return h
+	}
+	h := nsec3Hash(name, n.Salt, n.Iterations)
+	d.hashes[k] = h
+	return h
+}
+
+func (d *denial) matchNSEC(name string) *nsec {
+	for i, n := range d.NSEC {
+		if n.Owner == name {
+			return &d.NSEC[i]
+		}
+	}
+	return nil
+}
+
+func (d *denial) coverNSEC(name string) *nsec {
+	for i, n := range d.NSEC {
+		if n.covers(name) {
+			return &d.NSEC[i]
+		}
+	}
+	return nil
+}
+
+func (d *denial) matchNSEC3(name string) *nsec3 {
+	for i, n := range d.NSEC3 {
+		if n.matches(d.hash(name, n)) {
+			return &d.NSEC3[i]
+		}
+	}
+	return nil
+}
+
+func (d *denial) coverNSEC3(name string) *nsec3 {
+	for i, n := range d.NSEC3 {
+		if n.covers(d.hash(name, n)) {
+			return &d.NSEC3[i]
+		}
+	}
+	return nil
+}
+
+// closestEncloser returns the closest encloser of name and the NSEC3 record
+// covering the next closer name, RFC 5155 section 8.3.
+func (d *denial) closestEncloser(name string) (string, *nsec3, error) {
+	next := name
+	for ce := parentName(name); isSubdomain(ce, d.Zone); ce = parentName(ce) {
+		if d.matchNSEC3(ce) != nil {
+			nc := d.coverNSEC3(next)
+			if nc == nil {
+				return "", nil, fmt.Errorf("%w: no nsec3 covering next closer name %s", errBogus, nameString(next))
+			}
+			return ce, nc, nil
+		}
+		next = ce
+		if ce == d.Zone {
+			break
+		}
+	}
+	return "", nil, fmt.Errorf("%w: no closest encloser proof for %s", errBogus, nameString(name))
+}
+
+func wildcardName(name string) string {
+	return "\x01*" + name
+}
+
+// proveNXDomain checks that name does not exist, and that there is no wildcard
+// that would match it. If the proof relies on an NSEC3 record with the opt-out
+// flag, an unsigned delegation may exist for the name, and optOut is set.
+func (d *denial) proveNXDomain(name string) (optOut bool, rerr error) {
+	if len(d.NSEC) > 0 {
+		n := d.coverNSEC(name)
+		if n == nil {
+			return false, fmt.Errorf("%w: no nsec covering %s", errBogus, nameString(name))
+		}
+		ce := commonAncestor(name, n.Owner)
+		if a := commonAncestor(name, n.Next); labelCount(a) > labelCount(ce) {
+			ce = a
+		}
+		if d.coverNSEC(wildcardName(ce)) == nil {
+			return false, fmt.Errorf("%w: no nsec proving absence of wildcard at %s", errBogus, nameString(ce))
+		}
+		return false, nil
+	}
+	if len(d.NSEC3) > 0 {
+		if d.matchNSEC3(name) != nil {
+			return false, fmt.Errorf("%w: nsec3 matches name claimed not to exist", errBogus)
+		}
+		ce, nc, err := d.closestEncloser(name)
+		if err != nil {
+			return false, err
+		}
+		if d.coverNSEC3(wildcardName(ce)) == nil {
+			return false, fmt.Errorf("%w: no nsec3 proving absence of wildcard at %s", errBogus, nameString(ce))
+		}
+		return nc.optOut(), nil
+	}
+	return false, fmt.Errorf("%w: missing nsec or nsec3 records", errBogus)
+}
+
+// noData describes a proven absence of a type at a name.
+type noData struct {
+	Delegation bool // The name is a delegation to another zone, e.g. for DS queries.
+	OptOut     bool // No matching NSEC3, covered by NSEC3 with opt-out: an unsigned delegation may exist.
+	Wildcard   bool // Proof is for a wildcard that matches the name.
+}
+
+// proveNoData checks that name exists but has no records of type t, and no CNAME.
+func (d *denial) proveNoData(name string, t uint16) (noData, error) {
+	absent := func(bitmap []byte) bool {
+		return !typeBitmapHas(bitmap, t) && (t == typeCNAME || !typeBitmapHas(bitmap, typeCNAME))
+	}
+	delegation := func(bitmap []byte) bool {
+		return typeBitmapHas(bitmap, typeNS) && !typeBitmapHas(bitmap, typeSOA)
+	}
+
+	if len(d.NSEC) > 0 {
+		if n := d.matchNSEC(name); n != nil {
+			if !absent(n.Bitmap) {
+				return noData{}, fmt.Errorf("%w: nsec claims type exists", errBogus)
+			}
+			if t != typeDS && delegation(n.Bitmap) {
+				return noData{}, fmt.Errorf("%w: nsec from parent side of delegation", errBogus)
+			}
+			return noData{Delegation: delegation(n.Bitmap)}, nil
+		}
+		n := d.coverNSEC(name)
+		if n == nil {
+			return noData{}, fmt.Errorf("%w: no nsec matching or covering %s", errBogus, nameString(name))
+		}
+		// Empty non-terminal: next name is below name.
+		if isSubdomain(n.Next, name) {
+			return noData{}, nil
+		}
+		ce := commonAncestor(name, n.Owner)
+		if a := commonAncestor(name, n.Next); labelCount(a) > labelCount(ce) {
+			ce = a
+		}
+		if w := d.matchNSEC(wildcardName(ce)); w != nil && absent(w.Bitmap) {
+			return noData{Wildcard: true}, nil
+		}
+		return noData{}, fmt.Errorf("%w: no nsec proving absence of type at %s", errBogus, nameString(name))
+	}
+	if len(d.NSEC3) > 0 {
+		if n := d.matchNSEC3(name); n != nil {
+			if !absent(n.Bitmap) {
+				return noData{}, fmt.Errorf("%w: nsec3 claims type exists", errBogus)
+			}
+			if t != typeDS && delegation(n.Bitmap) {
+				return noData{}, fmt.Errorf("%w: nsec3 from parent side of delegation", errBogus)
+			}
+			return noData{Delegation: delegation(n.Bitmap)}, nil
+		}
+		ce, nc, err := d.closestEncloser(name)
+		if err != nil {
+			return noData{}, err
+		}
+		if t == typeDS && nc.optOut() {
+			return noData{OptOut: true}, nil
+		}
+		if w := d.matchNSEC3(wildcardName(ce)); w != nil && absent(w.Bitmap) {
+			return noData{Wildcard: true}, nil
+		}
+		return noData{}, fmt.Errorf("%w: no nsec3 proving absence of type at %s", errBogus, nameString(name))
+	}
+	return noData{}, fmt.Errorf("%w: missing nsec or nsec3 records", errBogus)
+}
+
+// proveWildcardAnswer checks that name, for which an answer was synthesized from
+// a wildcard at the closest encloser with the given number of labels, does not
+// exist itself.
+func (d *denial) proveWildcardAnswer(name string, labels int) error {
+	ce := lastLabels(name, labels)
+	if len(d.NSEC) > 0 {
+		if d.coverNSEC(name) == nil {
+			return fmt.Errorf("%w: no nsec covering wildcard-expanded name %s", errBogus, nameString(name))
+		}
+		return nil
+	}
+	if len(d.NSEC3) > 0 {
+		next := lastLabels(name, labels+1)
+		if d.coverNSEC3(next) == nil {
+			return fmt.Errorf("%w: no nsec3 covering next closer name %s for wildcard at %s", errBogus, nameString(next), nameString(ce))
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: missing nsec or nsec3 records for wildcard answer", errBogus)
+}
@@ -0,0 +1,450 @@
+package recursor
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"time"
+)
+
+// DNSSEC algorithms we can verify, RFC 8624. Zones signed with only other
+// algorithms are treated as insecure.
+const (
+	algRSASHA256       = 8
+	algRSASHA512       = 10
+	algECDSAP256SHA256 = 13
+	algECDSAP384SHA384 = 14
+	algED25519         = 15
+)
+
+// DS digest types.
+const (
+	digestSHA1   = 1
+	digestSHA256 = 2
+	digestSHA384 = 4
+)
+
+// DNSKEY flags.
+const (
+	flagZoneKey = 1 << 8
+	flagRevoke  = 1 << 7
+	flagSEP     = 1 << 0
+)
+
+func algorithmSupported(alg uint8) bool {
+	switch alg {
+	case algRSASHA256, algRSASHA512, algECDSAP256SHA256, algECDSAP384SHA384, algED25519:
+		return true
+	}
+	return false
+}
+
+func digestSupported(t uint8) bool {
+	return t == digestSHA1 || t == digestSHA256 || t == digestSHA384
+}
+
+var errBogus = errors.New("dnssec validation failed")
+
+// rrsig is a parsed RRSIG record, RFC 4034 section 3.
+type rrsig struct {
+	TypeCovered uint16
+	Algorithm   uint8
+	Labels      uint8
+	OrigTTL     uint32
+	Expiration  uint32
+	Inception   uint32
+	KeyTag      uint16
+	Signer      string // Lower case.
+	Signature   []byte
+
+	rr rr
+}
+
+func parseRRSIG(r rr) (rrsig, error) {
+	d := r.Data
+	if len(d) < 18 {
+		return rrsig{}, errMalformed
+	}
+	s := rrsig{
+		TypeCovered: binary.BigEndian.Uint16(d[0:]),
+		Algorithm:   d[2],
+		Labels:      d[3],
+		OrigTTL:     binary.BigEndian.Uint32(d[4:]),
+		Expiration:  binary.BigEndian.Uint32(d[8:]),
+		Inception:   binary.BigEndian.Uint32(d[12:]),
+		KeyTag:      binary.BigEndian.Uint16(d[16:]),
+		rr:          r,
+	}
+	signer, rest, err := rdataName(d[18:])
+	if err != nil {
+		return rrsig{}, err
+	}
+	s.Signer = lowerName(signer)
+	s.Signature = rest
+	return s, nil
+}
+
+// dnskey is a parsed DNSKEY record, RFC 4034 section 2.
+type dnskey struct {
+	Flags     uint16
+	Protocol  uint8
+	Algorithm uint8
+	PublicKey []byte
+
+	rr rr
+}
+
+func parseDNSKEY(r rr) (dnskey, error) {
+	d := r.Data
+	if len(d) < 4 {
+		return dnskey{}, errMalformed
+	}
+	return dnskey{
+		Flags:     binary.BigEndian.Uint16(d[0:]),
+		Protocol:  d[2],
+		Algorithm: d[3],
+		PublicKey: d[4:],
+		rr:        r,
+	}, nil
+}
+
+// keyTag calculates the key tag of DNSKEY rdata, RFC 4034 appendix B.
+func keyTag(rdata []byte) uint16 {
+	var ac uint32
+	for i, b := range rdata {
+		if i&1 == 1 {
+			ac += uint32(b)
+		} else {
+			ac += uint32(b) << 8
+		}
+	}
+	ac += ac >> 16 & 0xffff
+	return uint16(ac)
+}
+
+// ds is a parsed DS record, RFC 4034 section 5.
+type ds struct {
+	KeyTag     uint16
+	Algorithm  uint8
+	DigestType uint8
+	Digest     []byte
+}
+
+func parseDS(data []byte) (ds, error) {
+	if len(data) < 5 {
+		return ds{}, errMalformed
+	}
+	return ds{binary.BigEndian.Uint16(data), data[2], data[3], data[4:]}, nil
+}
+
+// dsDigest returns the DS digest for a DNSKEY with owner name.
+func dsDigest(digestType uint8, owner string, keyRdata []byte) []byte {
+	buf := append([]byte(owner), keyRdata...)
+	switch digestType {
+	case digestSHA1:
+		h := sha1.Sum(buf)
+		return h[:]
+	case digestSHA256:
+		h := sha256.Sum256(buf)
+		return h[:]
+	case digestSHA384:
+		h := sha512.Sum384(buf)
+		return h[:]
+	}
+	return nil
+}
+
+// dsMatches returns whether DS record d matches DNSKEY k at owner.
+func dsMatches(d ds, owner string, k dnskey) bool {
+	if d.Algorithm != k.Algorithm || d.KeyTag != keyTag(k.rr.Data) || !digestSupported(d.DigestType) {
+		return false
+	}
+	return subtle.ConstantTimeCompare(d.Digest, dsDigest(d.DigestType, owner, k.rr.Data)) == 1
+}
+
+// Types with domain names in RDATA that must be lower cased for the canonical form
+// used in signatures, RFC 4034 section 6.2 with the changes of RFC 6840 section
+// 5.1. We only handle the types we can parse names from.
+func canonicalRdata(r rr) []byte {
+	lower := func(data []byte, off int) []byte {
+		name, _, err := rdataName(data[off:])
+		if err != nil {
+			return data
+		}
+		nd := slices.Clone(data)
+		copy(nd[off:], lowerName(name))
+		return nd
+	}
+	switch r.Type {
+	case typeNS, typeCNAME, typePTR, typeDNAME:
+		return lower(r.Data, 0)
+	case typeMX:
+		if len(r.Data) > 2 {
+			return lower(r.Data, 2)
+		}
+	case typeSRV:
+		if len(r.Data) > 6 {
+			return lower(r.Data, 6)
+		}
+	case typeSOA:
+		d := lower(r.Data, 0)
+		mname, _, err := rdataName(d)
+		if err != nil {
+			return d
+		}
+		return lower(d, len(mname))
+	}
+	return r.Data
+}
+
+// signedData returns the data that is signed by sig for rrset, RFC 4034 section
+// 3.1.8.1.
+func signedData(sig rrsig, rrset []rr) ([]byte, error) {
+	if len(rrset) == 0 {
+		return nil, errors.New("empty rrset")
+	}
+	owner := rrset[0].Name
+	n := labelCount(owner)
+	if int(sig.Labels) > n {
+		return nil, errors.New("rrsig labels larger than owner name labels")
+	} else if int(sig.Labels) < n {
+		// Expanded from wildcard.
+		owner = "\x01*" + lastLabels(owner, int(sig.Labels))
+	}
+
+	b := slices.Clone(sig.rr.Data[:18])
+	b = append(b, sig.Signer...)
+
+	rdatas := make([][]byte, len(rrset))
+	for i, r := range rrset {
+		rdatas[i] = canonicalRdata(r)
+	}
+	slices.SortFunc(rdatas, bytes.Compare)
+	rdatas = slices.CompactFunc(rdatas, bytes.Equal)
+	for _, d := range rdatas {
+		b = packRR(b, rr{owner, rrset[0].Type, rrset[0].Class, sig.OrigTTL, d})
+	}
+	return b, nil
+}
+
+// serialBefore compares 32-bit timestamps with serial number arithmetic, RFC
+// 1982, as required for RRSIG inception and expiration times.
+func serialBefore(a, b uint32) bool {
+	return int32(a-b) < 0
+}
+
+// checkValidity checks the inception and expiration time of a signature.
+func checkValidity(sig rrsig, now time.Time) error {
+	t := uint32(now.Unix())
+	if serialBefore(t, sig.Inception) {
+		return fmt.Errorf("signature not yet valid")
+	}
+	if serialBefore(sig.Expiration, t) {
+		return fmt.Errorf("signature expired")
+	}
+	return nil
+}
+
+// verifySignature checks the signature of sig over rrset with key. Owner names of
+// the rrset must be identical, and sig.Signer must have been checked by the
+// caller to be the owner of key.
+func verifySignature(sig rrsig, key dnskey, rrset []rr, now time.Time) error {
+	if key.Flags&flagZoneKey == 0 || key.Flags&flagRevoke != 0 || key.Protocol != 3 {
+		return fmt.Errorf("key cannot be used for signatures")
+	}
+	if key.Algorithm != sig.Algorithm {
+		return fmt.Errorf("key algorithm mismatch")
+	}
+	if err := checkValidity(sig, now); err != nil {
+		return err
+	}
+	data, err := signedData(sig, rrset)
+	if err != nil {
+		return err
+	}
+
+	switch sig.Algorithm {
+	case algRSASHA256, algRSASHA512:
+		pk, err := rsaPublicKey(key.PublicKey)
+		if err != nil {
+			return err
+		}
+		if sig.Algorithm == algRSASHA256 {
+			h := sha256.Sum256(data)
+			return rsa.VerifyPKCS1v15(pk, crypto.SHA256, h[:], sig.Signature)
+		}
+		h := sha512.Sum512(data)
+		return rsa.VerifyPKCS1v15(pk, crypto.SHA512, h[:], sig.Signature)
+
+	case algECDSAP256SHA256, algECDSAP384SHA384:
+		curve, size := elliptic.P256(), 32
+		var digest []byte
+		if sig.Algorithm == algECDSAP256SHA256 {
+			h := sha256.Sum256(data)
+			digest = h[:]
+		} else {
+			curve, size = elliptic.P384(), 48
+			h := sha512.Sum384(data)
+			digest = h[:]
+		}
+		if len(key.PublicKey) != 2*size || len(sig.Signature) != 2*size {
+			return fmt.Errorf("bad ecdsa key or signature size")
+		}
+		pk := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(key.PublicKey[:size]),
+			Y:     new(big.Int).SetBytes(key.PublicKey[size:]),
+		}
+		r := new(big.Int).SetBytes(sig.Signature[:size])
+		s := new(big.Int).SetBytes(sig.Signature[size:])
+		if !ecdsa.Verify(pk, digest, r, s) {
+			return fmt.Errorf("bad ecdsa signature")
+		}
+		return nil
+
+	case algED25519:
+		if len(key.PublicKey) != ed25519.PublicKeySize {
+			return fmt.Errorf("bad ed25519 key size")
+		}
+		if !ed25519.Verify(ed25519.PublicKey(key.PublicKey), data, sig.Signature) {
+			return fmt.Errorf("bad ed25519 signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported algorithm %d", sig.Algorithm)
+}
+
+// rsaPublicKey parses an RSA public key in DNSKEY format, RFC 3110.
+func rsaPublicKey(buf []byte) (*rsa.PublicKey, error) {
+	if len(buf) < 1 {
+		return nil, errMalformed
+	}
+	n := int(buf[0])
+	buf = buf[1:]
+	if n == 0 {
+		if len(buf) < 2 {
+			return nil, errMalformed
+		}
+		n = int(binary.BigEndian.Uint16(buf))
+		buf = buf[2:]
+	}
+	if n == 0 || n > 4 || len(buf) <= n {
+		return nil, fmt.Errorf("unsupported rsa exponent size")
+	}
+	var e int
+	for _, c := range buf[:n] {
+		e = e<<8 | int(c)
+	}
+	mod := new(big.Int).SetBytes(buf[n:])
+	if mod.BitLen() < 1024 || mod.BitLen() > 4096 {
+		return nil, fmt.Errorf("unsupported rsa key size %d", mod.BitLen())
+	}
+	return &rsa.PublicKey{N: mod, E: e}, nil
+}
+
+// verifyRRset verifies rrset with one of sigs, made by one of keys of zone. It
+// returns the signature that verified, for determining TTLs and wildcard
+// expansion.
+func verifyRRset(zone string, keys []dnskey, rrset []rr, sigs []rrsig, now time.Time) (rrsig, error) {
+	if len(rrset) == 0 {
+		return rrsig{}, fmt.Errorf("%w: no records", errBogus)
+	}
+	var errs []error
+	for _, sig := range sigs {
+		if sig.Signer != zone || sig.TypeCovered != rrset[0].Type || !isSubdomain(rrset[0].Name, sig.Signer) {
+			continue
+		}
+		for _, k := range keys {
+			if k.Algorithm != sig.Algorithm || keyTag(k.rr.Data) != sig.KeyTag {
+				continue
+			}
+			err := verifySignature(sig, k, rrset, now)
+			if err == nil {
+				return sig, nil
+			}
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 0 {
+		return rrsig{}, fmt.Errorf("%w: no usable signature for %s %s by %s", errBogus, nameString(rrset[0].Name), typeString(rrset[0].Type), nameString(zone))
+	}
+	return rrsig{}, fmt.Errorf("%w: verifying %s %s: %w", errBogus, nameString(rrset[0].Name), typeString(rrset[0].Type), errors.Join(errs...))
+}
+
+// verifyDNSKEYs verifies a DNSKEY rrset for zone against DS records, or trust
+// anchor keys. The DNSKEY rrset must be signed by a key that matches a DS record
+// or trust anchor key. If none of the DS records or anchor keys are for
+// supported algorithms and digest types, supported is false and the zone must be
+// treated as insecure.
+func verifyDNSKEYs(zone string, keyrrs []rr, sigs []rrsig, dss []ds, anchorKeys [][]byte, now time.Time) (keys []dnskey, supported bool, rerr error) {
+	for _, r := range keyrrs {
+		k, err := parseDNSKEY(r)
+		if err != nil {
+			return nil, true, fmt.Errorf("%w: parsing dnskey: %v", errBogus, err)
+		}
+		keys = append(keys, k)
+	}
+
+	var trusted []dnskey
+	for _, d := range dss {
+		if !algorithmSupported(d.Algorithm) || !digestSupported(d.DigestType) {
+			continue
+		}
+		supported = true
+		for _, k := range keys {
+			if dsMatches(d, zone, k) {
+				trusted = append(trusted, k)
+			}
+		}
+	}
+	for _, ak := range anchorKeys {
+		a, err := parseDNSKEY(rr{Data: ak})
+		if err != nil || !algorithmSupported(a.Algorithm) {
+			continue
+		}
+		supported = true
+		for _, k := range keys {
+			if bytes.Equal(k.rr.Data, ak) {
+				trusted = append(trusted, k)
+			}
+		}
+	}
+	if !supported {
+		return nil, false, nil
+	}
+	if len(trusted) == 0 {
+		return nil, true, fmt.Errorf("%w: no dnskey matches ds records or trust anchors for %s", errBogus, nameString(zone))
+	}
+	if _, err := verifyRRset(zone, trusted, keyrrs, sigs, now); err != nil {
+		return nil, true, err
+	}
+	return keys, true, nil
+}
+
+// rrsetTTL returns the TTL to use for a validated rrset: the lowest TTL, capped
+// by the original TTL and the remaining validity of the signature.
+func rrsetTTL(rrset []rr, sig *rrsig, now time.Time) uint32 {
+	ttl := uint32(maxTTL)
+	for _, r := range rrset {
+		ttl = min(ttl, r.TTL)
+	}
+	if sig != nil {
+		ttl = min(ttl, sig.OrigTTL)
+		if remain := int64(int32(sig.Expiration - uint32(now.Unix()))); remain < int64(ttl) {
+			ttl = uint32(max(remain, 0))
+		}
+	}
+	return ttl
+}
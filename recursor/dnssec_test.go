@@ -0,0 +1,90 @@
+package recursor
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Example from RFC 8080 section 6.1.
+func TestVerifyEd25519(t *testing.T) {
+	zone, err := parseName("example.com.")
+	tcheck(t, err, "parse name")
+	mailName, err := parseName("mail.example.com.")
+	tcheck(t, err, "parse name")
+
+	pub, err := base64.StdEncoding.DecodeString("l02Woi0iS8Aa25FQkUd9RMzZHJpBoRQwAQEX1SxZJA4=")
+	tcheck(t, err, "decode key")
+	key, err := parseDNSKEY(rr{zone, typeDNSKEY, classINET, 3600, append([]byte{1, 1, 3, algED25519}, pub...)})
+	tcheck(t, err, "parse dnskey")
+	if tag := keyTag(key.rr.Data); tag != 3613 {
+		t.Fatalf("got keytag %d, expected 3613", tag)
+	}
+
+	mx := rr{zone, typeMX, classINET, 3600, append([]byte{0, 10}, mailName...)}
+
+	sigbuf, err := base64.StdEncoding.DecodeString("oL9krJun7xfBOIWcGHi7mag5/hdZrKWw15jPGrHpjQeRAvTdszaPD+QLs3fx8A4M3e23mRZ9VrbpMngwcrqNAg==")
+	tcheck(t, err, "decode signature")
+	d := binary.BigEndian.AppendUint16(nil, typeMX)
+	d = append(d, algED25519, 2)
+	d = binary.BigEndian.AppendUint32(d, 3600)
+	d = binary.BigEndian.AppendUint32(d, 1440021600)
+	d = binary.BigEndian.AppendUint32(d, 1438207200)
+	d = binary.BigEndian.AppendUint16(d, 3613)
+	d = append(d, zone...)
+	sig, err := parseRRSIG(rr{zone, typeRRSIG, classINET, 3600, append(d, sigbuf...)})
+	tcheck(t, err, "parse rrsig")
+
+	now := time.Unix(1439000000, 0)
+	err = verifySignature(sig, key, []rr{mx}, now)
+	tcheck(t, err, "verify signature")
+
+	// Outside validity period.
+	if err := verifySignature(sig, key, []rr{mx}, time.Unix(1450000000, 0)); err == nil {
+		t.Fatalf("expired signature verified")
+	}
+
+	// Modified data.
+	mx.Data = slices.Clone(mx.Data)
+	mx.Data[1] = 20
+	if err := verifySignature(sig, key, []rr{mx}, now); err == nil {
+		t.Fatalf("signature over modified data verified")
+	}
+
+	// Revoked key.
+	key.Flags |= flagRevoke
+	mx.Data[1] = 10
+	if err := verifySignature(sig, key, []rr{mx}, now); err == nil {
+		t.Fatalf("signature with revoked key verified")
+	}
+}
+
+func TestNames(t *testing.T) {
+	// Canonical ordering, RFC 4034 section 6.1.
+	l := []string{"example.", "a.example.", "yljkjljk.a.example.", "Z.a.example.", "zABC.a.EXAMPLE.", "z.example.", `\001.z.example.`, "*.z.example.", `\200.z.example.`}
+	var names []string
+	for _, s := range l {
+		n, err := parseName(s)
+		tcheck(t, err, "parse name")
+		names = append(names, n)
+	}
+	for i := range names[1:] {
+		if compareNames(names[i], names[i+1]) >= 0 {
+			t.Fatalf("name %q not before %q", l[i], l[i+1])
+		}
+	}
+
+	n, err := parseName("Mail.Example.COM")
+	tcheck(t, err, "parse name")
+	if s := nameString(n); s != "mail.example.com." {
+		t.Fatalf("got %q", s)
+	}
+	if labelCount(n) != 3 || parentName(n) != "\x07example\x03com\x00" || !isSubdomain(n, n) {
+		t.Fatalf("bad name helpers for %q", n)
+	}
+	if _, err := parseName("a..example."); err == nil {
+		t.Fatalf("empty label accepted")
+	}
+}
@@ -0,0 +1,792 @@
+// Package recursor is a recursive DNS resolver with DNSSEC validation.
+//
+// The resolver starts at the root name servers and follows referrals to the
+// authoritative name servers for a name. Responses are validated with DNSSEC,
+// with a chain of trust from the root trust anchors, RFC 4033, 4034 and 4035.
+// Validated results are marked as authentic, like the "AD" bit a validating
+// resolver sets. Bogus responses result in errors. Responses in unsigned zones,
+// with proof of an insecure delegation, are not authentic.
+//
+// Validated NSEC records are cached and used for synthesizing negative responses,
+// RFC 8198. Root trust anchors can be kept up to date automatically, RFC 5011.
+//
+// A Recursor implements dns.Resolver. It can be used as dns.Recursive, for use by
+// all dns.StrictResolver instances without an explicit adns.Resolver.
+package recursor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/stub"
+)
+
+var (
+	MetricQuery      stub.HistogramVec = stub.HistogramVecIgnore{}
+	MetricCache      stub.CounterVec   = stub.CounterVecIgnore{}
+	MetricValidation stub.CounterVec   = stub.CounterVecIgnore{}
+)
+
+// Limits on the amount of work for a single lookup.
+const (
+	maxQueries   = 150 // Upstream queries.
+	maxDepth     = 16  // Nested lookups, for name server addresses and DS/DNSKEY records.
+	maxReferrals = 24
+	maxCNAMEs    = 8
+	maxServers   = 4 // Attempts for a single query.
+)
+
+var (
+	errLimit         = errors.New("resolution limit reached")
+	errServerFailure = errors.New("no usable response from name servers")
+	errNotFound      = errors.New("no such host")
+)
+
+// RootHints are the addresses of the root name servers, from
+// https://www.internic.net/domain/named.root.
+var RootHints = []netip.Addr{
+	netip.MustParseAddr("198.41.0.4"), netip.MustParseAddr("2001:503:ba3e::2:30"), // a
+	netip.MustParseAddr("170.247.170.2"), netip.MustParseAddr("2801:1b8:10::b"), // b
+	netip.MustParseAddr("192.33.4.12"), netip.MustParseAddr("2001:500:2::c"), // c
+	netip.MustParseAddr("199.7.91.13"), netip.MustParseAddr("2001:500:2d::d"), // d
+	netip.MustParseAddr("192.203.230.10"), netip.MustParseAddr("2001:500:a8::e"), // e
+	netip.MustParseAddr("192.5.5.241"), netip.MustParseAddr("2001:500:2f::f"), // f
+	netip.MustParseAddr("192.112.36.4"), netip.MustParseAddr("2001:500:12::d0d"), // g
+	netip.MustParseAddr("198.97.190.53"), netip.MustParseAddr("2001:500:1::53"), // h
+	netip.MustParseAddr("192.36.148.17"), netip.MustParseAddr("2001:7fe::53"), // i
+	netip.MustParseAddr("192.58.128.30"), netip.MustParseAddr("2001:503:c27::2:30"), // j
+	netip.MustParseAddr("193.0.14.129"), netip.MustParseAddr("2001:7fd::1"), // k
+	netip.MustParseAddr("199.7.83.42"), netip.MustParseAddr("2001:500:9f::42"), // l
+	netip.MustParseAddr("202.12.27.33"), netip.MustParseAddr("2001:dc3::35"), // m
+}
+
+// Options for a new Recursor.
+type Options struct {
+	// DS or DNSKEY records for the root zone in presentation format, see
+	// ParseTrustAnchor. If empty, DefaultTrustAnchors are used.
+	TrustAnchors []string
+
+	// File for keeping track of updates to the root trust anchors, RFC 5011. If
+	// empty, the trust anchors are not updated.
+	TrustAnchorFile string
+
+	// Maximum number of cached answers and NSEC records. Default 10000.
+	CacheSize int
+
+	// Addresses of the root name servers. If empty, RootHints are used.
+	RootServers []netip.Addr
+
+	// For sending queries. If nil, NetTransport is used.
+	Transport Transport
+}
+
+// Recursor is a recursive DNSSEC-validating resolver.
+type Recursor struct {
+	log       mlog.Log
+	transport Transport
+	roots     []netip.Addr
+	anchors   *anchors
+	cache     *cache
+	now       func() time.Time
+
+	sync.Mutex
+	failed map[netip.Addr]time.Time // Servers that recently did not respond.
+}
+
+// New returns a new recursive resolver.
+func New(elog *slog.Logger, opts Options) (*Recursor, error) {
+	log := mlog.New("recursor", elog)
+	a, err := newAnchors(log, opts.TrustAnchors, opts.TrustAnchorFile)
+	if err != nil {
+		return nil, err
+	}
+	r := &Recursor{
+		log:       log,
+		transport: opts.Transport,
+		roots:     opts.RootServers,
+		anchors:   a,
+		cache:     newCache(opts.CacheSize),
+		now:       time.Now,
+		failed:    map[netip.Addr]time.Time{},
+	}
+	if r.transport == nil {
+		r.transport = NetTransport{}
+	}
+	if len(r.roots) == 0 {
+		r.roots = RootHints
+	}
+	if opts.CacheSize <= 0 {
+		r.cache.max = 10000
+	}
+	return r, nil
+}
+
+// state limits the work done for a single lookup.
+type state struct {
+	queries int
+	depth   int
+}
+
+// resolve looks up name and type, following CNAMEs. The returned records are
+// of type qtype. Authentic is set if all responses were validated with DNSSEC.
+func (r *Recursor) resolve(ctx context.Context, name string, qtype uint16) (records []rr, canonical string, authentic bool, rerr error) {
+	st := &state{}
+	authentic = true
+	for range maxCNAMEs + 1 {
+		resp, err := r.lookup(ctx, st, name, qtype)
+		if err != nil {
+			return nil, "", false, err
+		}
+		authentic = authentic && resp.Security == secSecure
+		if resp.Rcode == rcodeNXDomain {
+			return nil, name, authentic, errNotFound
+		}
+		if len(resp.Records) > 0 && resp.Records[0].Type == typeCNAME && qtype != typeCNAME {
+			target, _, err := rdataName(resp.Records[0].Data)
+			if err != nil {
+				return nil, "", false, fmt.Errorf("%w: parsing cname target: %v", errServerFailure, err)
+			}
+			name, err = parseName(nameString(target))
+			if err != nil {
+				return nil, "", false, fmt.Errorf("%w: bad cname target: %v", errServerFailure, err)
+			}
+			continue
+		}
+		if len(resp.Records) == 0 {
+			return nil, name, authentic, errNotFound
+		}
+		return resp.Records, name, authentic, nil
+	}
+	return nil, "", false, fmt.Errorf("%w: too many cnames", errLimit)
+}
+
+// lookup returns the validated response for name and type, from the cache if
+// possible. CNAMEs are not followed. An error is returned for bogus responses,
+// and for failures to get a response.
+func (r *Recursor) lookup(ctx context.Context, st *state, name string, qtype uint16) (*response, error) {
+	now := r.now()
+	if resp := r.cache.answer(name, qtype, now); resp != nil {
+		MetricCache.IncLabels("hit")
+		return resp, resp.Err
+	}
+	if resp := r.synthesize(name, qtype, now); resp != nil {
+		MetricCache.IncLabels("nsec")
+		return resp, nil
+	}
+	MetricCache.IncLabels("miss")
+
+	m, zone, err := r.iterate(ctx, st, name, qtype)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.validate(ctx, st, zone, name, qtype, m)
+	if err != nil && errors.Is(err, errBogus) {
+		r.log.Debugx("dnssec validation failed", err, slog.String("name", nameString(name)), slog.String("type", typeString(qtype)))
+		MetricValidation.IncLabels("bogus")
+		r.cache.addAnswer(name, qtype, &response{Err: err}, bogusTTL, now)
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+	MetricValidation.IncLabels(resp.Security.String())
+	r.cache.addAnswer(name, qtype, resp, resp.TTL, now)
+	return resp, nil
+}
+
+// synthesize returns a negative response from cached NSEC records, if possible.
+func (r *Recursor) synthesize(name string, qtype uint16, now time.Time) *response {
+	for _, d := range r.cache.denials(name, now) {
+		if _, err := d.proveNXDomain(name); err == nil {
+			return &response{Rcode: rcodeNXDomain, Security: secSecure}
+		}
+		if nd, err := d.proveNoData(name, qtype); err == nil {
+			return &response{Rcode: rcodeSuccess, Security: secSecure, NoData: nd}
+		}
+	}
+	return nil
+}
+
+// iterate sends queries starting at the closest known zone, following referrals
+// until a response is received that is not a referral. The zone that the response
+// came from is returned. For DS records, the response is from the parent zone.
+func (r *Recursor) iterate(ctx context.Context, st *state, name string, qtype uint16) (*message, string, error) {
+	start := name
+	if qtype == typeDS && name != rootName {
+		start = parentName(name)
+	}
+	zone, servers, ok := r.cache.closestDelegation(start, r.now())
+	if !ok {
+		zone, servers = rootName, r.roots
+	}
+	for range maxReferrals {
+		m, err := r.exchange(ctx, st, servers, name, qtype)
+		if err != nil {
+			return nil, "", err
+		}
+		child, nsrrs := referral(m, zone, name)
+		if child == "" || qtype == typeDS && child == name {
+			return m, zone, nil
+		}
+		addrs, ttl, err := r.delegationServers(ctx, st, zone, child, nsrrs, m.Additional)
+		if err != nil {
+			return nil, "", err
+		}
+		r.cache.addDelegation(child, addrs, ttl, r.now())
+		zone, servers = child, addrs
+	}
+	return nil, "", fmt.Errorf("%w: too many referrals for %s", errLimit, nameString(name))
+}
+
+// referral returns the child zone and its NS records if m is a referral from zone
+// towards name.
+func referral(m *message, zone, name string) (string, []rr) {
+	if m.Rcode != rcodeSuccess || len(m.Answer) > 0 {
+		return "", nil
+	}
+	var child string
+	var nsrrs []rr
+	for _, a := range m.Authority {
+		if a.Type == typeSOA {
+			return "", nil
+		}
+		if a.Type != typeNS || a.Name == zone || !isSubdomain(a.Name, zone) || !isSubdomain(name, a.Name) {
+			continue
+		}
+		if child != "" && a.Name != child {
+			continue
+		}
+		child = a.Name
+		nsrrs = append(nsrrs, a)
+	}
+	return child, nsrrs
+}
+
+// delegationServers returns the addresses of the name servers of child zone, from
+// glue records in the referral from zone if present, otherwise resolved.
+func (r *Recursor) delegationServers(ctx context.Context, st *state, zone, child string, nsrrs []rr, additional []rr) ([]netip.Addr, uint32, error) {
+	ttl := uint32(maxTTL)
+	var targets []string
+	for _, ns := range nsrrs {
+		ttl = min(ttl, ns.TTL)
+		if t, _, err := rdataName(ns.Data); err == nil {
+			targets = append(targets, lowerName(t))
+		}
+	}
+
+	var addrs []netip.Addr
+	for _, t := range targets {
+		// Only glue from the zone that is authoritative for the name server name is
+		// used, to prevent cache poisoning.
+		if !isSubdomain(t, zone) {
+			continue
+		}
+		for _, a := range additional {
+			if a.Name != t || a.Type != typeA && a.Type != typeAAAA {
+				continue
+			}
+			if ip, ok := netip.AddrFromSlice(a.Data); ok {
+				addrs = append(addrs, ip.Unmap())
+			}
+		}
+	}
+	if len(addrs) > 0 {
+		return addrs, ttl, nil
+	}
+
+	rand.Shuffle(len(targets), func(i, j int) { targets[i], targets[j] = targets[j], targets[i] })
+	var lastErr error
+	for _, t := range targets {
+		// Name servers in the child zone need glue.
+		if isSubdomain(t, child) {
+			continue
+		}
+		ips, err := r.serverAddrs(ctx, st, t)
+		if err != nil {
+			lastErr = err
+			if errors.Is(err, errLimit) || ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		addrs = append(addrs, ips...)
+		if len(addrs) >= 2 {
+			break
+		}
+	}
+	if len(addrs) == 0 {
+		if lastErr == nil {
+			lastErr = errors.New("no name server addresses")
+		}
+		return nil, 0, fmt.Errorf("%w: resolving name servers for %s: %w", errServerFailure, nameString(child), lastErr)
+	}
+	return addrs, ttl, nil
+}
+
+// serverAddrs resolves the IPv4 and IPv6 addresses of a name server.
+func (r *Recursor) serverAddrs(ctx context.Context, st *state, name string) ([]netip.Addr, error) {
+	if st.depth >= maxDepth {
+		return nil, fmt.Errorf("%w: nesting too deep", errLimit)
+	}
+	st.depth++
+	defer func() { st.depth-- }()
+
+	var addrs []netip.Addr
+	var errs []error
+	for _, t := range []uint16{typeA, typeAAAA} {
+		resp, err := r.lookup(ctx, st, name, t)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, rec := range resp.Records {
+			if rec.Type != t {
+				continue
+			}
+			if ip, ok := netip.AddrFromSlice(rec.Data); ok {
+				addrs = append(addrs, ip.Unmap())
+			}
+		}
+	}
+	if len(addrs) == 0 && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return addrs, nil
+}
+
+// exchange sends the query to servers until a response is received.
+func (r *Recursor) exchange(ctx context.Context, st *state, servers []netip.Addr, name string, qtype uint16) (*message, error) {
+	now := time.Now()
+	servers = slices.Clone(servers)
+	rand.Shuffle(len(servers), func(i, j int) { servers[i], servers[j] = servers[j], servers[i] })
+	// Try servers that recently failed last.
+	r.Lock()
+	slices.SortStableFunc(servers, func(a, b netip.Addr) int {
+		fa := now.Sub(r.failed[a]) < time.Minute
+		fb := now.Sub(r.failed[b]) < time.Minute
+		if fa == fb {
+			return 0
+		} else if fa {
+			return 1
+		}
+		return -1
+	})
+	r.Unlock()
+
+	var lastErr error
+	for i, server := range servers {
+		if i >= maxServers {
+			break
+		}
+		if st.queries >= maxQueries {
+			return nil, fmt.Errorf("%w: too many queries", errLimit)
+		}
+		st.queries++
+
+		start := time.Now()
+		m, err := r.exchange1(ctx, server, name, qtype)
+		result := "ok"
+		if err != nil {
+			result = "error"
+			if errors.Is(err, context.DeadlineExceeded) {
+				result = "timeout"
+			}
+		}
+		MetricQuery.ObserveLabels(float64(time.Since(start))/float64(time.Second), result)
+		if err == nil {
+			r.log.Debug("upstream query",
+				slog.String("name", nameString(name)),
+				slog.String("type", typeString(qtype)),
+				slog.Any("server", server),
+				slog.Int("rcode", m.Rcode),
+				slog.Duration("duration", time.Since(start)))
+			return m, nil
+		}
+		r.log.Debugx("upstream query", err,
+			slog.String("name", nameString(name)),
+			slog.String("type", typeString(qtype)),
+			slog.Any("server", server))
+		lastErr = err
+		r.Lock()
+		r.failed[server] = now
+		r.Unlock()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no name servers")
+	}
+	return nil, fmt.Errorf("%w: querying %s %s: %w", errServerFailure, nameString(name), typeString(qtype), lastErr)
+}
+
+func (r *Recursor) exchange1(ctx context.Context, server netip.Addr, name string, qtype uint16) (*message, error) {
+	id := uint16(rand.Uint32())
+	buf, err := r.transport.Exchange(ctx, server, buildQuery(id, name, qtype))
+	if err != nil {
+		return nil, err
+	}
+	m, err := parseMessage(buf)
+	if err != nil {
+		return nil, err
+	}
+	if m.ID != id || m.Flags&flagQR == 0 || len(m.Question) != 1 || m.Question[0] != (question{name, qtype, classINET}) {
+		return nil, errors.New("response does not match query")
+	}
+	if m.Rcode != rcodeSuccess && m.Rcode != rcodeNXDomain {
+		return nil, fmt.Errorf("server responded with rcode %d", m.Rcode)
+	}
+	return m, nil
+}
+
+// selectRRset returns the records of type t at name, with their signatures.
+func selectRRset(section []rr, name string, t uint16) ([]rr, []rrsig) {
+	var rrset []rr
+	var sigs []rrsig
+	for _, a := range section {
+		if a.Name != name || a.Class != classINET {
+			continue
+		}
+		if a.Type == t {
+			rrset = append(rrset, a)
+		} else if a.Type == typeRRSIG {
+			if sig, err := parseRRSIG(a); err == nil && sig.TypeCovered == t {
+				sigs = append(sigs, sig)
+			}
+		}
+	}
+	return rrset, sigs
+}
+
+// validate checks the response m, from zone, for name and type.
+func (r *Recursor) validate(ctx context.Context, st *state, zone, name string, qtype uint16, m *message) (*response, error) {
+	now := r.now()
+
+	rrset, sigs := selectRRset(m.Answer, name, qtype)
+	if len(rrset) == 0 && qtype != typeCNAME {
+		rrset, sigs = selectRRset(m.Answer, name, typeCNAME)
+	}
+	if len(rrset) == 0 || rrset[0].Type == typeCNAME && qtype != typeCNAME && len(sigs) == 0 {
+		// Check for DNAME at an ancestor, we synthesize the CNAME ourselves. Servers
+		// include an unsigned synthesized CNAME, which we ignore.
+		for a := parentName(name); ; a = parentName(a) {
+			dname, dsigs := selectRRset(m.Answer, a, typeDNAME)
+			if len(dname) > 0 {
+				return r.validateDNAME(ctx, st, zone, name, dname, dsigs, m)
+			}
+			if a == rootName || a == zone {
+				break
+			}
+		}
+	}
+
+	if len(rrset) > 0 {
+		sec, ttl, err := r.verifyAnswer(ctx, st, zone, name, rrset, sigs, m)
+		if err != nil {
+			return nil, err
+		}
+		return &response{Rcode: rcodeSuccess, Records: rrset, Security: sec, TTL: ttl}, nil
+	}
+
+	if m.Rcode != rcodeSuccess && m.Rcode != rcodeNXDomain {
+		return nil, fmt.Errorf("%w: rcode %d", errServerFailure, m.Rcode)
+	}
+	resp := &response{Rcode: m.Rcode, TTL: negativeTTL(m.Authority)}
+
+	var signer string
+	for _, a := range m.Authority {
+		if a.Type != typeRRSIG {
+			continue
+		}
+		sig, err := parseRRSIG(a)
+		if err == nil && (sig.TypeCovered == typeSOA || sig.TypeCovered == typeNSEC || sig.TypeCovered == typeNSEC3) {
+			signer = sig.Signer
+			break
+		}
+	}
+	if signer == "" {
+		sec, err := r.unsignedStatus(ctx, st, zone, name, qtype)
+		if err != nil {
+			return nil, err
+		}
+		resp.Security = sec
+		return resp, nil
+	}
+	if !isSubdomain(name, signer) || qtype == typeDS && signer == name {
+		return nil, fmt.Errorf("%w: negative response for %s %s signed by %s", errBogus, nameString(name), typeString(qtype), nameString(signer))
+	}
+	ze, err := r.zoneKeys(ctx, st, signer)
+	if err != nil {
+		return nil, err
+	} else if ze.notZone {
+		return nil, fmt.Errorf("%w: signer %s is not a zone", errBogus, nameString(signer))
+	} else if ze.security == secInsecure {
+		resp.Security = secInsecure
+		return resp, nil
+	}
+
+	d, dttl, err := r.verifiedDenial(signer, ze.keys, m.Authority, now)
+	if errors.Is(err, errNSEC3Iterations) {
+		resp.Security = secInsecure
+		return resp, nil
+	} else if err != nil {
+		return nil, err
+	}
+	resp.TTL = min(resp.TTL, dttl)
+	if m.Rcode == rcodeNXDomain {
+		optOut, err := d.proveNXDomain(name)
+		if err != nil {
+			return nil, err
+		}
+		if optOut {
+			resp.Security = secInsecure
+			return resp, nil
+		}
+	} else {
+		resp.NoData, err = d.proveNoData(name, qtype)
+		if err != nil {
+			return nil, err
+		}
+	}
+	resp.Security = secSecure
+	for _, n := range d.NSEC {
+		r.cache.addNSEC(signer, n, resp.TTL, now)
+	}
+	return resp, nil
+}
+
+// validateDNAME verifies a DNAME record, and returns a response with a CNAME
+// record synthesized from it, RFC 6672.
+func (r *Recursor) validateDNAME(ctx context.Context, st *state, zone, name string, dname []rr, sigs []rrsig, m *message) (*response, error) {
+	sec, ttl, err := r.verifyAnswer(ctx, st, zone, dname[0].Name, dname, sigs, m)
+	if err != nil {
+		return nil, err
+	}
+	target, _, err := rdataName(dname[0].Data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: parsing dname target: %v", errServerFailure, err)
+	}
+	prefix := name[:len(name)-len(dname[0].Name)]
+	if len(prefix)+len(target) > 255 {
+		return nil, fmt.Errorf("%w: dname substitution results in name that is too long", errServerFailure)
+	}
+	cname := rr{Name: name, Type: typeCNAME, Class: classINET, TTL: ttl, Data: []byte(prefix + target)}
+	return &response{Rcode: rcodeSuccess, Records: []rr{cname}, Security: sec, TTL: ttl}, nil
+}
+
+// verifyAnswer verifies a positive answer, returning its security status and the
+// TTL for caching.
+func (r *Recursor) verifyAnswer(ctx context.Context, st *state, zone, name string, rrset []rr, sigs []rrsig, m *message) (security, uint32, error) {
+	now := r.now()
+	if len(sigs) == 0 {
+		sec, err := r.unsignedStatus(ctx, st, zone, name, rrset[0].Type)
+		return sec, rrsetTTL(rrset, nil, now), err
+	}
+
+	signer := sigs[0].Signer
+	if !isSubdomain(name, signer) || rrset[0].Type == typeDS && signer == name {
+		return 0, 0, fmt.Errorf("%w: %s %s signed by %s", errBogus, nameString(name), typeString(rrset[0].Type), nameString(signer))
+	}
+	ze, err := r.zoneKeys(ctx, st, signer)
+	if err != nil {
+		return 0, 0, err
+	} else if ze.notZone {
+		return 0, 0, fmt.Errorf("%w: signer %s is not a zone", errBogus, nameString(signer))
+	} else if ze.security == secInsecure {
+		return secInsecure, rrsetTTL(rrset, nil, now), nil
+	}
+	sig, err := verifyRRset(signer, ze.keys, rrset, sigs, now)
+	if err != nil {
+		return 0, 0, err
+	}
+	ttl := rrsetTTL(rrset, &sig, now)
+	if n := labelCount(name); int(sig.Labels) < n && !(int(sig.Labels) == n-1 && nameLabels(name)[0] == "*") {
+		// Expanded from wildcard, the name itself must not exist.
+		d, dttl, err := r.verifiedDenial(signer, ze.keys, m.Authority, now)
+		if errors.Is(err, errNSEC3Iterations) {
+			return secInsecure, ttl, nil
+		} else if err != nil {
+			return 0, 0, err
+		}
+		if err := d.proveWildcardAnswer(name, int(sig.Labels)); err != nil {
+			return 0, 0, err
+		}
+		ttl = min(ttl, dttl)
+	}
+	return secSecure, ttl, nil
+}
+
+// verifiedDenial verifies the NSEC and NSEC3 records in section with the keys of
+// zone.
+func (r *Recursor) verifiedDenial(zone string, keys []dnskey, section []rr, now time.Time) (*denial, uint32, error) {
+	ttl := uint32(maxTTL)
+	var verified []rr
+	done := map[cacheKey]bool{}
+	for _, a := range section {
+		if a.Type != typeNSEC && a.Type != typeNSEC3 || done[cacheKey{a.Name, a.Type}] {
+			continue
+		}
+		done[cacheKey{a.Name, a.Type}] = true
+		rrset, sigs := selectRRset(section, a.Name, a.Type)
+		sig, err := verifyRRset(zone, keys, rrset, sigs, now)
+		if err != nil {
+			return nil, 0, err
+		}
+		ttl = min(ttl, rrsetTTL(rrset, &sig, now))
+		verified = append(verified, rrset...)
+	}
+	d, err := newDenial(zone, verified)
+	return d, ttl, err
+}
+
+// negativeTTL returns the TTL for negative caching from the SOA record, RFC 2308.
+func negativeTTL(authority []rr) uint32 {
+	for _, a := range authority {
+		if a.Type != typeSOA {
+			continue
+		}
+		ttl := a.TTL
+		_, rest, err := rdataName(a.Data)
+		if err == nil {
+			if _, rest, err = rdataName(rest); err == nil && len(rest) == 20 {
+				minimum := uint32(rest[16])<<24 | uint32(rest[17])<<16 | uint32(rest[18])<<8 | uint32(rest[19])
+				ttl = min(ttl, minimum)
+			}
+		}
+		return min(ttl, maxNegTTL)
+	}
+	return bogusTTL
+}
+
+// unsignedStatus determines whether an unsigned response from zone for name is
+// insecure, because name is in an unsigned zone with a proven insecure
+// delegation, or bogus.
+func (r *Recursor) unsignedStatus(ctx context.Context, st *state, zone, name string, qtype uint16) (security, error) {
+	// The zone we got the response from may not be an actual zone cut, or may have
+	// been unsigned itself.
+	z := zone
+	for {
+		ze, err := r.zoneKeys(ctx, st, z)
+		if err != nil {
+			return 0, err
+		}
+		if !ze.notZone && ze.security == secInsecure {
+			return secInsecure, nil
+		}
+		if !ze.notZone || z == rootName {
+			break
+		}
+		z = parentName(z)
+	}
+
+	// Zone z is signed. A zone between z and name, served by the same name servers,
+	// could be unsigned. For DS records, the response is from the parent zone, so
+	// name itself is not checked.
+	end := name
+	if qtype == typeDS {
+		end = parentName(name)
+	}
+	var names []string
+	for n := end; n != z && isSubdomain(n, z); n = parentName(n) {
+		names = append(names, n)
+	}
+	slices.Reverse(names)
+	for _, n := range names {
+		ze, err := r.zoneKeys(ctx, st, n)
+		if err != nil {
+			return 0, err
+		}
+		if !ze.notZone && ze.security == secInsecure {
+			return secInsecure, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: unsigned response for %s %s in signed zone %s", errBogus, nameString(name), typeString(qtype), nameString(z))
+}
+
+// zoneKeys returns the validated DNSKEYs for zone, or whether it is insecure or
+// not a zone.
+func (r *Recursor) zoneKeys(ctx context.Context, st *state, zone string) (zoneEntry, error) {
+	now := r.now()
+	if e, ok := r.cache.zone(zone, now); ok {
+		return e, e.err
+	}
+	if st.depth >= maxDepth {
+		return zoneEntry{}, fmt.Errorf("%w: nesting too deep", errLimit)
+	}
+	st.depth++
+	defer func() { st.depth-- }()
+
+	e, ttl, err := r.fetchZoneKeys(ctx, st, zone)
+	if err != nil && !errors.Is(err, errBogus) {
+		return zoneEntry{}, err
+	} else if err != nil {
+		r.log.Debugx("dnssec validation of zone keys failed", err, slog.String("zone", nameString(zone)))
+		e = zoneEntry{err: err}
+		ttl = bogusTTL
+	}
+	e.expires = ttlTime(now, ttl)
+	r.cache.addZone(zone, e)
+	return e, err
+}
+
+func (r *Recursor) fetchZoneKeys(ctx context.Context, st *state, zone string) (zoneEntry, uint32, error) {
+	var dss []ds
+	var anchorKeys [][]byte
+	ttl := uint32(maxTTL)
+	if zone == rootName {
+		dss, anchorKeys = r.anchors.trusted()
+		if len(dss) == 0 && len(anchorKeys) == 0 {
+			return zoneEntry{security: secInsecure}, ttl, nil
+		}
+	} else {
+		resp, err := r.lookup(ctx, st, zone, typeDS)
+		if err != nil {
+			return zoneEntry{}, 0, err
+		}
+		ttl = resp.TTL
+		if resp.Security == secInsecure {
+			return zoneEntry{security: secInsecure}, ttl, nil
+		}
+		if resp.Rcode == rcodeNXDomain || len(resp.Records) > 0 && resp.Records[0].Type != typeDS {
+			return zoneEntry{security: secSecure, notZone: true}, ttl, nil
+		}
+		if len(resp.Records) == 0 {
+			if resp.NoData.Delegation || resp.NoData.OptOut {
+				return zoneEntry{security: secInsecure}, ttl, nil
+			}
+			return zoneEntry{security: secSecure, notZone: true}, ttl, nil
+		}
+		for _, rec := range resp.Records {
+			d, err := parseDS(rec.Data)
+			if err != nil {
+				return zoneEntry{}, 0, fmt.Errorf("%w: parsing ds record: %v", errBogus, err)
+			}
+			dss = append(dss, d)
+		}
+	}
+
+	m, _, err := r.iterate(ctx, st, zone, typeDNSKEY)
+	if err != nil {
+		return zoneEntry{}, 0, err
+	}
+	keyrrs, sigs := selectRRset(m.Answer, zone, typeDNSKEY)
+	now := r.now()
+	keys, supported, err := verifyDNSKEYs(zone, keyrrs, sigs, dss, anchorKeys, now)
+	if err != nil {
+		return zoneEntry{}, 0, err
+	} else if !supported {
+		r.log.Debug("zone has no supported dnssec algorithms, treating as insecure", slog.String("zone", nameString(zone)))
+		return zoneEntry{security: secInsecure}, ttl, nil
+	}
+	if zone == rootName {
+		r.anchors.update(keys, sigs, now)
+	}
+	return zoneEntry{keys: keys, security: secSecure}, min(ttl, rrsetTTL(keyrrs, nil, now)), nil
+}
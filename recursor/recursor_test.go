@@ -0,0 +1,982 @@
+package recursor
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mjl-/adns"
+
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mlog"
+)
+
+var pkglog = mlog.New("recursor", nil)
+
+func tcheck(t testing.TB, err error, msg string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %s", msg, err)
+	}
+}
+
+func isTemporary(err error) bool {
+	var dnsErr *adns.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsTemporary
+}
+
+// testZone is a zone from testdata/recursor, signed at test time.
+type testZone struct {
+	origin  string
+	server  netip.Addr
+	sign    string // "", "nsec", "nsec3", "nsec3-optout".
+	alg     uint8
+	records []rr
+	badDS   map[string]bool
+	dsAlg   map[string]uint8
+	badSig  map[cacheKey]bool
+	noSig   map[cacheKey]bool
+
+	key     crypto.Signer
+	keyData []byte // DNSKEY rdata.
+
+	sigs   map[cacheKey][]rr
+	nsec   []rr                // Sorted NSEC or NSEC3 records.
+	nsec3  map[string][]byte   // Name to hash, for NSEC3 zones.
+	exists map[string]bool     // Including empty non-terminals.
+	deleg  map[string]struct{} // Delegation points.
+}
+
+var nsec3Salt = []byte{0xab, 0xcd}
+
+const nsec3Iter = 1
+
+func parseTestZone(t testing.TB, path string) *testZone {
+	t.Helper()
+	buf, err := os.ReadFile(path)
+	tcheck(t, err, "read zone")
+	z := &testZone{
+		badDS:  map[string]bool{},
+		dsAlg:  map[string]uint8{},
+		badSig: map[cacheKey]bool{},
+		noSig:  map[cacheKey]bool{},
+	}
+	name := func(s string) string {
+		if s == "@" {
+			return z.origin
+		}
+		if !strings.HasSuffix(s, ".") {
+			s += "." + nameString(z.origin)
+		}
+		n, err := parseName(s)
+		tcheck(t, err, "parse name")
+		return n
+	}
+	for _, line := range strings.Split(string(buf), "\n") {
+		if strings.HasPrefix(line, ";") || strings.TrimSpace(line) == "" {
+			continue
+		}
+		f := splitFields(line)
+		switch f[0] {
+		case "$ORIGIN":
+			z.origin, err = parseName(f[1])
+			tcheck(t, err, "parse origin")
+			continue
+		case "$SERVER":
+			z.server = netip.MustParseAddr(f[1])
+			continue
+		case "$SIGN":
+			z.sign = f[1]
+			v, err := strconv.ParseUint(f[2], 10, 8)
+			tcheck(t, err, "parse algorithm")
+			z.alg = uint8(v)
+			continue
+		case "$BADDS":
+			z.badDS[name(f[1])] = true
+			continue
+		case "$DSALG":
+			v, err := strconv.ParseUint(f[2], 10, 8)
+			tcheck(t, err, "parse algorithm")
+			z.dsAlg[name(f[1])] = uint8(v)
+			continue
+		case "$BADSIG", "$NOSIG":
+			k := cacheKey{name(f[1]), typeFromString(t, f[2])}
+			if f[0] == "$BADSIG" {
+				z.badSig[k] = true
+			} else {
+				z.noSig[k] = true
+			}
+			continue
+		}
+		owner := name(f[0])
+		f = f[1:]
+		ttl := uint32(3600)
+		if v, err := strconv.ParseUint(f[0], 10, 32); err == nil {
+			ttl = uint32(v)
+			f = f[1:]
+		}
+		if f[0] == "IN" {
+			f = f[1:]
+		}
+		typ := typeFromString(t, f[0])
+		z.records = append(z.records, rr{owner, typ, classINET, ttl, packRdata(t, typ, f[1:], name)})
+	}
+	return z
+}
+
+// splitFields splits a line into fields, keeping quoted strings (with quotes) as
+// single fields, and removing comments.
+func splitFields(line string) []string {
+	var l []string
+	var cur strings.Builder
+	var quoted bool
+	for _, c := range line {
+		switch {
+		case c == '"':
+			quoted = !quoted
+			cur.WriteRune(c)
+		case c == ';' && !quoted:
+			if cur.Len() > 0 {
+				l = append(l, cur.String())
+			}
+			return l
+		case (c == ' ' || c == '\t') && !quoted:
+			if cur.Len() > 0 {
+				l = append(l, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(c)
+		}
+	}
+	if cur.Len() > 0 {
+		l = append(l, cur.String())
+	}
+	return l
+}
+
+func typeFromString(t testing.TB, s string) uint16 {
+	for _, typ := range []uint16{typeA, typeNS, typeCNAME, typeSOA, typePTR, typeMX, typeTXT, typeAAAA, typeSRV, typeDNAME, typeDS, typeTLSA} {
+		if typeString(typ) == s {
+			return typ
+		}
+	}
+	t.Fatalf("unknown type %q", s)
+	return 0
+}
+
+func packRdata(t testing.TB, typ uint16, f []string, name func(string) string) []byte {
+	t.Helper()
+	num := func(s string, bits int) uint64 {
+		v, err := strconv.ParseUint(s, 10, bits)
+		tcheck(t, err, "parse number")
+		return v
+	}
+	var b []byte
+	switch typ {
+	case typeA, typeAAAA:
+		b = netip.MustParseAddr(f[0]).AsSlice()
+	case typeNS, typeCNAME, typePTR, typeDNAME:
+		b = []byte(name(f[0]))
+	case typeMX:
+		b = binary.BigEndian.AppendUint16(nil, uint16(num(f[0], 16)))
+		b = append(b, name(f[1])...)
+	case typeTXT:
+		for _, s := range f {
+			s = strings.Trim(s, `"`)
+			b = append(b, byte(len(s)))
+			b = append(b, s...)
+		}
+	case typeSRV:
+		for _, s := range f[:3] {
+			b = binary.BigEndian.AppendUint16(b, uint16(num(s, 16)))
+		}
+		b = append(b, name(f[3])...)
+	case typeTLSA:
+		b = []byte{byte(num(f[0], 8)), byte(num(f[1], 8)), byte(num(f[2], 8))}
+		h, err := hex.DecodeString(f[3])
+		tcheck(t, err, "parse hex")
+		b = append(b, h...)
+	case typeSOA:
+		b = append([]byte(name(f[0])), name(f[1])...)
+		for _, s := range f[2:7] {
+			b = binary.BigEndian.AppendUint32(b, uint32(num(s, 32)))
+		}
+	default:
+		t.Fatalf("cannot pack type %d", typ)
+	}
+	return b
+}
+
+func (z *testZone) generateKey(t testing.TB) {
+	t.Helper()
+	var pub []byte
+	switch z.alg {
+	case algRSASHA256:
+		k, err := rsa.GenerateKey(cryptorand.Reader, 2048)
+		tcheck(t, err, "generate rsa key")
+		z.key = k
+		e := big32(uint32(k.E))
+		pub = append([]byte{byte(len(e))}, e...)
+		pub = append(pub, k.N.Bytes()...)
+	case algECDSAP256SHA256:
+		k, err := ecdsa.GenerateKey(elliptic.P256(), cryptorand.Reader)
+		tcheck(t, err, "generate ecdsa key")
+		z.key = k
+		pub = make([]byte, 64)
+		k.X.FillBytes(pub[:32])
+		k.Y.FillBytes(pub[32:])
+	case algED25519:
+		p, k, err := ed25519.GenerateKey(cryptorand.Reader)
+		tcheck(t, err, "generate ed25519 key")
+		z.key = k
+		pub = p
+	default:
+		t.Fatalf("unsupported algorithm %d", z.alg)
+	}
+	z.keyData = append([]byte{1, 1, 3, z.alg}, pub...) // Flags 257: zone key and sep.
+}
+
+func big32(v uint32) []byte {
+	b := binary.BigEndian.AppendUint32(nil, v)
+	for len(b) > 1 && b[0] == 0 {
+		b = b[1:]
+	}
+	return b
+}
+
+// signRRset returns an RRSIG record for rrset.
+func (z *testZone) signRRset(t testing.TB, rrset []rr) rr {
+	t.Helper()
+	owner := rrset[0].Name
+	labels := labelCount(owner)
+	if strings.HasPrefix(owner, "\x01*") {
+		labels--
+	}
+	now := uint32(time.Now().Unix())
+	hdr := binary.BigEndian.AppendUint16(nil, rrset[0].Type)
+	hdr = append(hdr, z.alg, byte(labels))
+	hdr = binary.BigEndian.AppendUint32(hdr, rrset[0].TTL)
+	hdr = binary.BigEndian.AppendUint32(hdr, now+30*24*3600)
+	hdr = binary.BigEndian.AppendUint32(hdr, now-3600)
+	hdr = binary.BigEndian.AppendUint16(hdr, keyTag(z.keyData))
+	hdr = append(hdr, z.origin...)
+	sig, err := parseRRSIG(rr{Data: hdr})
+	tcheck(t, err, "parse rrsig")
+	data, err := signedData(sig, rrset)
+	tcheck(t, err, "signed data")
+
+	var sigbuf []byte
+	switch k := z.key.(type) {
+	case *rsa.PrivateKey:
+		h := sha256.Sum256(data)
+		sigbuf, err = rsa.SignPKCS1v15(cryptorand.Reader, k, crypto.SHA256, h[:])
+		tcheck(t, err, "rsa sign")
+	case *ecdsa.PrivateKey:
+		h := sha256.Sum256(data)
+		r, s, err := ecdsa.Sign(cryptorand.Reader, k, h[:])
+		tcheck(t, err, "ecdsa sign")
+		sigbuf = make([]byte, 64)
+		r.FillBytes(sigbuf[:32])
+		s.FillBytes(sigbuf[32:])
+	case ed25519.PrivateKey:
+		sigbuf = ed25519.Sign(k, data)
+	}
+	return rr{owner, typeRRSIG, classINET, rrset[0].TTL, append(hdr, sigbuf...)}
+}
+
+func typeBitmap(types []uint16) []byte {
+	slices.Sort(types)
+	types = slices.Compact(types)
+	var b []byte
+	for i := 0; i < len(types); {
+		window := types[i] >> 8
+		bits := make([]byte, 32)
+		n := 0
+		for ; i < len(types) && types[i]>>8 == window; i++ {
+			v := types[i] & 0xff
+			bits[v/8] |= 0x80 >> (v % 8)
+			n = int(v/8) + 1
+		}
+		b = append(b, byte(window), byte(n))
+		b = append(b, bits[:n]...)
+	}
+	return b
+}
+
+func (z *testZone) rrset(name string, typ uint16) []rr {
+	var l []rr
+	for _, r := range z.records {
+		if r.Name == name && r.Type == typ {
+			l = append(l, r)
+		}
+	}
+	return l
+}
+
+// authoritative returns whether name is authoritative data in the zone, i.e. not
+// below a delegation point.
+func (z *testZone) authoritative(name string) bool {
+	for n := parentName(name); isSubdomain(n, z.origin) && n != z.origin; n = parentName(n) {
+		if _, ok := z.deleg[n]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+// finish adds DNSKEY, DS, NSEC/NSEC3 and RRSIG records. Child zones must have
+// been finished first.
+func (z *testZone) finish(t testing.TB, zones []*testZone) {
+	t.Helper()
+	z.deleg = map[string]struct{}{}
+	for _, r := range z.records {
+		if r.Type == typeNS && r.Name != z.origin {
+			z.deleg[r.Name] = struct{}{}
+		}
+	}
+	if z.sign != "" {
+		z.records = append(z.records, rr{z.origin, typeDNSKEY, classINET, 3600, z.keyData})
+	}
+	for _, c := range zones {
+		if _, ok := z.deleg[c.origin]; !ok || c.sign == "" || z.sign == "" {
+			continue
+		}
+		digest := dsDigest(digestSHA256, c.origin, c.keyData)
+		if z.badDS[c.origin] {
+			digest[0] ^= 0xff
+		}
+		alg := c.alg
+		if a, ok := z.dsAlg[c.origin]; ok {
+			alg = a
+		}
+		d := binary.BigEndian.AppendUint16(nil, keyTag(c.keyData))
+		d = append(d, alg, digestSHA256)
+		z.records = append(z.records, rr{c.origin, typeDS, classINET, 3600, append(d, digest...)})
+	}
+
+	// Names that exist, including empty non-terminals.
+	z.exists = map[string]bool{}
+	types := map[string][]uint16{}
+	for _, r := range z.records {
+		if !z.authoritative(r.Name) {
+			continue
+		}
+		types[r.Name] = append(types[r.Name], r.Type)
+		for n := r.Name; isSubdomain(n, z.origin); n = parentName(n) {
+			z.exists[n] = true
+			if n == z.origin {
+				break
+			}
+		}
+	}
+	if z.sign == "" {
+		return
+	}
+
+	unsignedDeleg := func(n string) bool {
+		_, ok := z.deleg[n]
+		return ok && len(z.rrset(n, typeDS)) == 0
+	}
+
+	var minimum uint32 = 3600
+	if soa := z.rrset(z.origin, typeSOA); len(soa) > 0 {
+		minimum = binary.BigEndian.Uint32(soa[0].Data[len(soa[0].Data)-4:])
+	}
+	switch z.sign {
+	case "nsec":
+		owners := slices.Collect(func(yield func(string) bool) {
+			for n := range types {
+				if !yield(n) {
+					return
+				}
+			}
+		})
+		slices.SortFunc(owners, compareNames)
+		for i, n := range owners {
+			next := owners[(i+1)%len(owners)]
+			tl := append(slices.Clone(types[n]), typeNSEC, typeRRSIG)
+			if unsignedDeleg(n) {
+				tl = []uint16{typeNS, typeNSEC, typeRRSIG}
+			}
+			z.nsec = append(z.nsec, rr{n, typeNSEC, classINET, minimum, append([]byte(next), typeBitmap(tl)...)})
+		}
+	case "nsec3", "nsec3-optout":
+		optout := z.sign == "nsec3-optout"
+		z.nsec3 = map[string][]byte{}
+		type hashed struct {
+			hash []byte
+			name string
+		}
+		var l []hashed
+		for n := range z.exists {
+			if optout && unsignedDeleg(n) {
+				continue
+			}
+			h := nsec3Hash(n, nsec3Salt, nsec3Iter)
+			z.nsec3[n] = h
+			l = append(l, hashed{h, n})
+		}
+		slices.SortFunc(l, func(a, b hashed) int { return bytes.Compare(a.hash, b.hash) })
+		var flags byte
+		if optout {
+			flags = 1
+		}
+		for i, h := range l {
+			next := l[(i+1)%len(l)].hash
+			var tl []uint16
+			if len(types[h.name]) > 0 {
+				tl = append(slices.Clone(types[h.name]), typeRRSIG)
+				if unsignedDeleg(h.name) {
+					tl = []uint16{typeNS}
+				}
+			}
+			d := []byte{1, flags, 0, nsec3Iter, byte(len(nsec3Salt))}
+			d = append(d, nsec3Salt...)
+			d = append(d, byte(len(next)))
+			d = append(d, next...)
+			d = append(d, typeBitmap(tl)...)
+			label := strings.ToLower(b32hex.EncodeToString(h.hash))
+			owner := string([]byte{byte(len(label))}) + label + z.origin
+			z.nsec = append(z.nsec, rr{owner, typeNSEC3, classINET, minimum, d})
+		}
+	}
+
+	// Sign all authoritative rrsets, except NS records at delegations.
+	z.sigs = map[cacheKey][]rr{}
+	all := append(slices.Clone(z.records), z.nsec...)
+	for _, r := range all {
+		k := cacheKey{r.Name, r.Type}
+		if _, ok := z.sigs[k]; ok || !z.authoritative(r.Name) || z.noSig[k] {
+			continue
+		}
+		if _, ok := z.deleg[r.Name]; ok && r.Type == typeNS {
+			continue
+		}
+		var rrset []rr
+		for _, o := range all {
+			if o.Name == r.Name && o.Type == r.Type {
+				rrset = append(rrset, o)
+			}
+		}
+		sig := z.signRRset(t, rrset)
+		if z.badSig[k] {
+			sig.Data[len(sig.Data)-1] ^= 0xff
+		}
+		z.sigs[k] = []rr{sig}
+	}
+}
+
+func loadTestZones(t testing.TB) []*testZone {
+	t.Helper()
+	files, err := filepath.Glob("../testdata/recursor/*.zone")
+	tcheck(t, err, "list zones")
+	var zones []*testZone
+	for _, f := range files {
+		z := parseTestZone(t, f)
+		if z.sign != "" {
+			z.generateKey(t)
+		}
+		zones = append(zones, z)
+	}
+	// Finish deepest zones first, their DS records are needed in parents.
+	slices.SortFunc(zones, func(a, b *testZone) int { return labelCount(b.origin) - labelCount(a.origin) })
+	for _, z := range zones {
+		z.finish(t, zones)
+	}
+	return zones
+}
+
+// testTransport acts as authoritative name servers for the test zones.
+type testTransport struct {
+	t     *testing.T
+	zones []*testZone
+
+	sync.Mutex
+	queries []question
+}
+
+func (tt *testTransport) nqueries() int {
+	tt.Lock()
+	defer tt.Unlock()
+	return len(tt.queries)
+}
+
+func (tt *testTransport) Exchange(ctx context.Context, server netip.Addr, query []byte) ([]byte, error) {
+	q, err := parseMessage(query)
+	if err != nil || len(q.Question) != 1 {
+		return nil, fmt.Errorf("bad query")
+	}
+	qq := q.Question[0]
+	tt.Lock()
+	tt.queries = append(tt.queries, qq)
+	tt.Unlock()
+
+	// Find the deepest zone served by this server. DS records are served from the
+	// parent side.
+	var z *testZone
+	for _, c := range tt.zones {
+		if c.server != server || !isSubdomain(qq.Name, c.origin) || qq.Type == typeDS && qq.Name == c.origin && c.origin != rootName {
+			continue
+		}
+		if z == nil || labelCount(c.origin) > labelCount(z.origin) {
+			z = c
+		}
+	}
+	m := &message{ID: q.ID, Flags: flagQR, Question: q.Question}
+	if z == nil {
+		m.Rcode = rcodeRefused
+	} else {
+		z.respond(qq.Name, qq.Type, m)
+	}
+	return packMessage(m), nil
+}
+
+func packMessage(m *message) []byte {
+	b := binary.BigEndian.AppendUint16(nil, m.ID)
+	b = binary.BigEndian.AppendUint16(b, m.Flags|uint16(m.Rcode&0xf))
+	for _, n := range []int{len(m.Question), len(m.Answer), len(m.Authority), len(m.Additional)} {
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	}
+	for _, q := range m.Question {
+		b = append(b, q.Name...)
+		b = binary.BigEndian.AppendUint16(b, q.Type)
+		b = binary.BigEndian.AppendUint16(b, q.Class)
+	}
+	for _, section := range [][]rr{m.Answer, m.Authority, m.Additional} {
+		for _, r := range section {
+			b = packRR(b, r)
+		}
+	}
+	return b
+}
+
+// signed returns rrset with its signatures.
+func (z *testZone) signed(rrset []rr) []rr {
+	if len(rrset) == 0 {
+		return nil
+	}
+	return append(slices.Clone(rrset), z.sigs[cacheKey{rrset[0].Name, rrset[0].Type}]...)
+}
+
+func (z *testZone) nsecRR(owner string) []rr {
+	for _, r := range z.nsec {
+		if r.Name == owner {
+			return z.signed([]rr{r})
+		}
+	}
+	return nil
+}
+
+// coverNSEC returns the NSEC record covering name.
+func (z *testZone) coverNSEC(name string) []rr {
+	for _, r := range z.nsec {
+		n, _ := parseNSEC(r)
+		if n.covers(name) {
+			return z.signed([]rr{r})
+		}
+	}
+	return nil
+}
+
+func (z *testZone) matchNSEC3(name string) []rr {
+	h := nsec3Hash(name, nsec3Salt, nsec3Iter)
+	for _, r := range z.nsec {
+		if n, _ := parseNSEC3(r); n.matches(h) {
+			return z.signed([]rr{r})
+		}
+	}
+	return nil
+}
+
+func (z *testZone) coverNSEC3(name string) []rr {
+	h := nsec3Hash(name, nsec3Salt, nsec3Iter)
+	for _, r := range z.nsec {
+		if n, _ := parseNSEC3(r); n.covers(h) {
+			return z.signed([]rr{r})
+		}
+	}
+	return nil
+}
+
+// closestEncloser returns the longest existing ancestor of name.
+func (z *testZone) closestEncloser(name string) string {
+	for n := parentName(name); ; n = parentName(n) {
+		if z.exists[n] {
+			return n
+		}
+	}
+}
+
+// nextCloser returns the name one label longer than ce towards name.
+func nextCloser(name, ce string) string {
+	return lastLabels(name, labelCount(ce)+1)
+}
+
+func (z *testZone) respond(name string, qtype uint16, m *message) {
+	nsec3 := z.nsec3 != nil
+	soa := func() []rr { return z.signed(z.rrset(z.origin, typeSOA)) }
+
+	// Referral for names at or below a delegation.
+	for n := name; n != z.origin; n = parentName(n) {
+		if _, ok := z.deleg[n]; !ok || qtype == typeDS && n == name {
+			continue
+		}
+		ns := z.rrset(n, typeNS)
+		m.Authority = append(m.Authority, ns...)
+		if ds := z.rrset(n, typeDS); len(ds) > 0 {
+			m.Authority = append(m.Authority, z.signed(ds)...)
+		} else if z.sign == "nsec" {
+			m.Authority = append(m.Authority, z.nsecRR(n)...)
+		} else if nsec3 {
+			if match := z.matchNSEC3(n); match != nil {
+				m.Authority = append(m.Authority, match...)
+			} else {
+				ce := z.closestEncloser(n)
+				m.Authority = append(m.Authority, z.matchNSEC3(ce)...)
+				m.Authority = append(m.Authority, z.coverNSEC3(nextCloser(n, ce))...)
+			}
+		}
+		for _, r := range ns {
+			target, _, _ := rdataName(r.Data)
+			m.Additional = append(m.Additional, z.rrset(target, typeA)...)
+		}
+		return
+	}
+
+	m.Flags |= flagAA
+
+	// DNAME at an ancestor.
+	for n := parentName(name); isSubdomain(n, z.origin); n = parentName(n) {
+		if dname := z.rrset(n, typeDNAME); len(dname) > 0 {
+			m.Answer = append(m.Answer, z.signed(dname)...)
+			target, _, _ := rdataName(dname[0].Data)
+			cname := rr{name, typeCNAME, classINET, dname[0].TTL, []byte(name[:len(name)-len(n)] + target)}
+			m.Answer = append(m.Answer, cname)
+			return
+		}
+		if n == z.origin {
+			break
+		}
+	}
+
+	if z.exists[name] {
+		if rrset := z.rrset(name, qtype); len(rrset) > 0 {
+			m.Answer = z.signed(rrset)
+			return
+		}
+		if cname := z.rrset(name, typeCNAME); len(cname) > 0 {
+			m.Answer = z.signed(cname)
+			return
+		}
+		// No data.
+		m.Authority = soa()
+		if nsec3 {
+			if match := z.matchNSEC3(name); match != nil {
+				m.Authority = append(m.Authority, match...)
+			} else {
+				// Opt-out unsigned delegation, for DS queries.
+				ce := z.closestEncloser(name)
+				m.Authority = append(m.Authority, z.matchNSEC3(ce)...)
+				m.Authority = append(m.Authority, z.coverNSEC3(nextCloser(name, ce))...)
+			}
+		} else if z.sign == "nsec" {
+			if n := z.nsecRR(name); n != nil {
+				m.Authority = append(m.Authority, n...)
+			} else {
+				// Empty non-terminal.
+				m.Authority = append(m.Authority, z.coverNSEC(name)...)
+			}
+		}
+		return
+	}
+
+	ce := z.closestEncloser(name)
+	wildcard := wildcardName(ce)
+	if rrset := z.rrset(wildcard, qtype); len(rrset) > 0 {
+		for _, r := range z.signed(rrset) {
+			r.Name = name
+			m.Answer = append(m.Answer, r)
+		}
+		if nsec3 {
+			m.Authority = z.coverNSEC3(nextCloser(name, ce))
+		} else if z.sign == "nsec" {
+			m.Authority = z.coverNSEC(name)
+		}
+		return
+	}
+
+	m.Rcode = rcodeNXDomain
+	m.Authority = soa()
+	if nsec3 {
+		m.Authority = append(m.Authority, z.matchNSEC3(ce)...)
+		m.Authority = append(m.Authority, z.coverNSEC3(nextCloser(name, ce))...)
+		m.Authority = append(m.Authority, z.coverNSEC3(wildcard)...)
+	} else if z.sign == "nsec" {
+		m.Authority = append(m.Authority, z.coverNSEC(name)...)
+		m.Authority = append(m.Authority, z.coverNSEC(wildcard)...)
+	}
+}
+
+// newTestRecursor returns a recursor using the test zones, with the root key as
+// trust anchor.
+func newTestRecursor(t *testing.T, zones []*testZone) (*Recursor, *testTransport) {
+	t.Helper()
+	var root *testZone
+	for _, z := range zones {
+		if z.origin == rootName {
+			root = z
+		}
+	}
+	digest := dsDigest(digestSHA256, rootName, root.keyData)
+	anchor := fmt.Sprintf(". IN DS %d %d %d %X", keyTag(root.keyData), root.alg, digestSHA256, digest)
+	tt := &testTransport{t: t, zones: zones}
+	r, err := New(pkglog.Logger, Options{
+		TrustAnchors: []string{anchor},
+		RootServers:  []netip.Addr{root.server},
+		Transport:    tt,
+	})
+	tcheck(t, err, "new recursor")
+	return r, tt
+}
+
+func TestRecursor(t *testing.T) {
+	zones := loadTestZones(t)
+	r, tt := newTestRecursor(t, zones)
+	ctxbg := context.Background()
+
+	checkNotFound := func(err error, authentic bool, expAuthentic bool) {
+		t.Helper()
+		var dnsErr *adns.DNSError
+		if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			t.Fatalf("got err %v, expected not found", err)
+		}
+		if authentic != expAuthentic {
+			t.Fatalf("got authentic %v, expected %v", authentic, expAuthentic)
+		}
+	}
+	checkBogus := func(err error) {
+		t.Helper()
+		var code adns.ErrorCode
+		if !errors.As(err, &code) || code != adns.ErrDNSSECBogus {
+			t.Fatalf("got err %v, expected dnssec bogus", err)
+		}
+		if !isTemporary(err) {
+			t.Fatalf("bogus error %v not temporary", err)
+		}
+	}
+	checkAuthentic := func(result adns.Result, err error, exp bool) {
+		t.Helper()
+		tcheck(t, err, "lookup")
+		if result.Authentic != exp {
+			t.Fatalf("got authentic %v, expected %v", result.Authentic, exp)
+		}
+	}
+
+	// Secure, with NSEC.
+	ips, result, err := r.LookupIP(ctxbg, "ip", "mail.secure.example.")
+	checkAuthentic(result, err, true)
+	if len(ips) != 2 || ips[0].String() != "192.0.2.10" || ips[1].String() != "2001:db8::10" {
+		t.Fatalf("got ips %v", ips)
+	}
+
+	mxs, result, err := r.LookupMX(ctxbg, "secure.example.")
+	checkAuthentic(result, err, true)
+	if len(mxs) != 1 || mxs[0].Host != "mail.secure.example." || mxs[0].Pref != 10 {
+		t.Fatalf("got mx %v", mxs)
+	}
+
+	txts, result, err := r.LookupTXT(ctxbg, "long.secure.example.")
+	checkAuthentic(result, err, true)
+	if len(txts) != 1 || txts[0] != "first part second part" {
+		t.Fatalf("got txts %q", txts)
+	}
+
+	tlsas, result, err := r.LookupTLSA(ctxbg, 25, "tcp", "mail.secure.example.")
+	checkAuthentic(result, err, true)
+	if len(tlsas) != 1 || tlsas[0].Usage != adns.TLSAUsageDANEEE || tlsas[0].Selector != adns.TLSASelectorSPKI || len(tlsas[0].CertAssoc) != 32 {
+		t.Fatalf("got tlsa %v", tlsas)
+	}
+
+	_, srvs, result, err := r.LookupSRV(ctxbg, "imaps", "tcp", "secure.example.")
+	checkAuthentic(result, err, true)
+	if len(srvs) != 1 || srvs[0].Port != 993 || srvs[0].Target != "mail.secure.example." {
+		t.Fatalf("got srv %v", srvs)
+	}
+
+	// CNAME within secure zone, and to insecure zone.
+	addrs, result, err := r.LookupHost(ctxbg, "alias.secure.example.")
+	checkAuthentic(result, err, true)
+	if len(addrs) != 2 {
+		t.Fatalf("got addrs %v", addrs)
+	}
+	addrs, result, err = r.LookupHost(ctxbg, "external.secure.example.")
+	checkAuthentic(result, err, false)
+	if len(addrs) != 1 || addrs[0] != "192.0.2.30" {
+		t.Fatalf("got addrs %v", addrs)
+	}
+
+	cname, result, err := r.LookupCNAME(ctxbg, "alias.secure.example.")
+	checkAuthentic(result, err, true)
+	if cname != "mail.secure.example." {
+		t.Fatalf("got cname %q", cname)
+	}
+	cname, _, err = r.LookupCNAME(ctxbg, "mail.secure.example.")
+	tcheck(t, err, "lookup cname")
+	if cname != "mail.secure.example." {
+		t.Fatalf("got cname %q, expected name itself", cname)
+	}
+
+	// Wildcard.
+	ips, result, err = r.LookupIP(ctxbg, "ip4", "anything.wild.secure.example.")
+	checkAuthentic(result, err, true)
+	if len(ips) != 1 || ips[0].String() != "192.0.2.20" {
+		t.Fatalf("got ips %v", ips)
+	}
+
+	// DNAME, to NSEC3 zone.
+	ips, result, err = r.LookupIP(ctxbg, "ip4", "www.dname.secure.example.")
+	checkAuthentic(result, err, true)
+	if len(ips) != 1 || ips[0].String() != "192.0.2.40" {
+		t.Fatalf("got ips %v", ips)
+	}
+
+	// NXDOMAIN, NODATA and empty non-terminal.
+	_, result, err = r.LookupTXT(ctxbg, "absent.secure.example.")
+	checkNotFound(err, result.Authentic, true)
+	_, result, err = r.LookupTXT(ctxbg, "mail.secure.example.")
+	checkNotFound(err, result.Authentic, true)
+	_, result, err = r.LookupTXT(ctxbg, "ent.secure.example.")
+	checkNotFound(err, result.Authentic, true)
+
+	// Negative answers synthesized from cached NSEC records, RFC 8198. The NSEC
+	// record that proved absent.secure.example does not exist also covers
+	// absent2.secure.example.
+	n := tt.nqueries()
+	_, result, err = r.LookupTXT(ctxbg, "absent2.secure.example.")
+	checkNotFound(err, result.Authentic, true)
+	_, result, err = r.LookupMX(ctxbg, "mail.secure.example.")
+	checkNotFound(err, result.Authentic, true)
+	if tt.nqueries() != n {
+		t.Fatalf("aggressive nsec caching: got %d new queries, expected none", tt.nqueries()-n)
+	}
+
+	// Cached positive answer.
+	_, result, err = r.LookupMX(ctxbg, "secure.example.")
+	checkAuthentic(result, err, true)
+	if tt.nqueries() != n {
+		t.Fatalf("cached answer: got %d new queries, expected none", tt.nqueries()-n)
+	}
+
+	// NSEC3.
+	mxs, result, err = r.LookupMX(ctxbg, "nsec3.example.")
+	checkAuthentic(result, err, true)
+	if len(mxs) != 1 || mxs[0].Host != "www.nsec3.example." {
+		t.Fatalf("got mx %v", mxs)
+	}
+	_, result, err = r.LookupTXT(ctxbg, "absent.nsec3.example.")
+	checkNotFound(err, result.Authentic, true)
+	_, result, err = r.LookupTXT(ctxbg, "www.nsec3.example.")
+	checkNotFound(err, result.Authentic, true)
+	_, result, err = r.LookupTXT(ctxbg, "ent.nsec3.example.")
+	checkNotFound(err, result.Authentic, true)
+	txts, result, err = r.LookupTXT(ctxbg, "x.wild.nsec3.example.")
+	checkAuthentic(result, err, true)
+	if len(txts) != 1 || txts[0] != "wildcard" {
+		t.Fatalf("got txts %q", txts)
+	}
+
+	// Insecure delegation, proven with NSEC3 opt-out.
+	ips, result, err = r.LookupIP(ctxbg, "ip4", "www.insecure.example.")
+	checkAuthentic(result, err, false)
+	if len(ips) != 1 || ips[0].String() != "192.0.2.30" {
+		t.Fatalf("got ips %v", ips)
+	}
+	_, result, err = r.LookupTXT(ctxbg, "absent.insecure.example.")
+	checkNotFound(err, result.Authentic, false)
+
+	// Nonexistent name in TLD with opt-out, could be an unsigned delegation.
+	_, result, err = r.LookupTXT(ctxbg, "absent.example.")
+	checkNotFound(err, result.Authentic, false)
+
+	// Reverse lookup, in root zone.
+	names, result, err := r.LookupAddr(ctxbg, "192.0.2.30")
+	checkAuthentic(result, err, true)
+	if len(names) != 1 || names[0] != "www.insecure.example." {
+		t.Fatalf("got names %v", names)
+	}
+
+	// DS record does not match key.
+	_, _, err = r.LookupIP(ctxbg, "ip4", "www.bogus.example.")
+	checkBogus(err)
+
+	// Corrupted and missing signatures.
+	_, _, err = r.LookupIP(ctxbg, "ip4", "bad.secure.example.")
+	checkBogus(err)
+	_, _, err = r.LookupIP(ctxbg, "ip4", "unsigned.secure.example.")
+	checkBogus(err)
+
+	// Unsupported algorithm in DS record makes zone insecure.
+	ips, result, err = r.LookupIP(ctxbg, "ip4", "www.unsupported.example.")
+	checkAuthentic(result, err, false)
+	if len(ips) != 1 {
+		t.Fatalf("got ips %v", ips)
+	}
+
+	// Unreachable: no server for zone.
+	r2, _ := newTestRecursor(t, zones)
+	r2.roots = []netip.Addr{netip.MustParseAddr("10.0.0.99")}
+	_, _, err = r2.LookupIP(ctxbg, "ip4", "mail.secure.example.")
+	if err == nil || !isTemporary(err) {
+		t.Fatalf("got err %v, expected temporary error", err)
+	}
+}
+
+// Without trust anchors, nothing validates, but lookups succeed.
+func TestRecursorBadAnchor(t *testing.T) {
+	zones := loadTestZones(t)
+	r, _ := newTestRecursor(t, zones)
+	// Anchor for a key the root zone does not have.
+	anchor := ". IN DS 12345 13 2 0000000000000000000000000000000000000000000000000000000000000000"
+	a, err := newAnchors(pkglog, []string{anchor}, "")
+	tcheck(t, err, "new anchors")
+	r.anchors = a
+	_, _, err = r.LookupIP(context.Background(), "ip4", "mail.secure.example.")
+	var code adns.ErrorCode
+	if !errors.As(err, &code) || code != adns.ErrDNSSECBogus {
+		t.Fatalf("got err %v, expected bogus", err)
+	}
+}
+
+// A StrictResolver without adns.Resolver uses dns.Recursive.
+func TestStrictResolverRecursive(t *testing.T) {
+	zones := loadTestZones(t)
+	r, _ := newTestRecursor(t, zones)
+	dns.Recursive = r
+	defer func() { dns.Recursive = nil }()
+
+	txts, result, err := dns.StrictResolver{}.LookupTXT(context.Background(), "secure.example.")
+	tcheck(t, err, "lookup txt")
+	if !result.Authentic || len(txts) != 1 || txts[0] != "v=spf1 mx -all" {
+		t.Fatalf("got txts %q, authentic %v", txts, result.Authentic)
+	}
+}
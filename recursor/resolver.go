@@ -0,0 +1,331 @@
+package recursor
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/mjl-/adns"
+
+	"github.com/mjl-/mox/dns"
+)
+
+var _ dns.Resolver = (*Recursor)(nil)
+
+// dnsError returns an error like the ones adns returns.
+func dnsError(err error, name string) error {
+	if err == nil {
+		return nil
+	}
+	e := &adns.DNSError{Err: err.Error(), Name: name}
+	switch {
+	case errors.Is(err, errNotFound):
+		e.IsNotFound = true
+	case errors.Is(err, errBogus):
+		e.IsTemporary = true
+		e.UnwrapErr = adns.ExtendedError{InfoCode: adns.ErrDNSSECBogus, ExtraText: err.Error()}
+	case errors.Is(err, context.DeadlineExceeded):
+		e.IsTimeout = true
+		e.IsTemporary = true
+		e.UnwrapErr = err
+	case errors.Is(err, context.Canceled):
+		e.UnwrapErr = err
+	default:
+		e.IsTemporary = true
+		e.UnwrapErr = adns.ExtendedError{InfoCode: adns.ErrNoReachableAuthority, ExtraText: err.Error()}
+	}
+	return e
+}
+
+// lookupType resolves name, following CNAMEs, and returns the records of type t,
+// and the canonical name.
+func (r *Recursor) lookupType(ctx context.Context, host string, t uint16) ([]rr, string, adns.Result, error) {
+	name, err := parseName(host)
+	if err != nil {
+		return nil, "", adns.Result{}, &adns.DNSError{Err: fmt.Sprintf("invalid name: %v", err), Name: host}
+	}
+	records, canonical, authentic, err := r.resolve(ctx, name, t)
+	return records, nameString(canonical), adns.Result{Authentic: authentic}, dnsError(err, host)
+}
+
+func (r *Recursor) LookupPort(ctx context.Context, network, service string) (port int, err error) {
+	return net.DefaultResolver.LookupPort(ctx, network, service)
+}
+
+func (r *Recursor) LookupAddr(ctx context.Context, addr string) ([]string, adns.Result, error) {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return nil, adns.Result{}, &adns.DNSError{Err: "unrecognized address", Name: addr}
+	}
+	records, _, result, err := r.lookupType(ctx, reverseName(ip), typePTR)
+	if err != nil {
+		return nil, result, err
+	}
+	var names []string
+	for _, rec := range records {
+		if n, _, err := rdataName(rec.Data); err == nil {
+			names = append(names, nameString(n))
+		}
+	}
+	return names, result, nil
+}
+
+// reverseName returns the name for PTR lookups of ip.
+func reverseName(ip netip.Addr) string {
+	var b strings.Builder
+	if ip.Is4() || ip.Is4In6() {
+		a := ip.Unmap().As4()
+		for i := 3; i >= 0; i-- {
+			fmt.Fprintf(&b, "%d.", a[i])
+		}
+		b.WriteString("in-addr.arpa.")
+		return b.String()
+	}
+	a := ip.As16()
+	for i := 15; i >= 0; i-- {
+		fmt.Fprintf(&b, "%x.%x.", a[i]&0xf, a[i]>>4)
+	}
+	b.WriteString("ip6.arpa.")
+	return b.String()
+}
+
+// LookupCNAME follows CNAME records starting at host, and returns the canonical
+// name. If host has no CNAME record, host is returned.
+func (r *Recursor) LookupCNAME(ctx context.Context, host string) (string, adns.Result, error) {
+	name, err := parseName(host)
+	if err != nil {
+		return "", adns.Result{}, &adns.DNSError{Err: fmt.Sprintf("invalid name: %v", err), Name: host}
+	}
+	canonical := host
+	authentic := true
+	st := &state{}
+	for range maxCNAMEs + 1 {
+		resp, err := r.lookup(ctx, st, name, typeCNAME)
+		if err != nil {
+			return "", adns.Result{}, dnsError(err, host)
+		}
+		authentic = authentic && resp.Security == secSecure
+		if resp.Rcode == rcodeNXDomain && canonical == host {
+			return "", adns.Result{Authentic: authentic}, dnsError(errNotFound, host)
+		}
+		if len(resp.Records) == 0 {
+			return canonical, adns.Result{Authentic: authentic}, nil
+		}
+		target, _, err := rdataName(resp.Records[0].Data)
+		if err != nil {
+			return "", adns.Result{}, dnsError(fmt.Errorf("%w: parsing cname target: %v", errServerFailure, err), host)
+		}
+		canonical = nameString(target)
+		if name, err = parseName(canonical); err != nil {
+			return "", adns.Result{}, dnsError(fmt.Errorf("%w: bad cname target: %v", errServerFailure, err), host)
+		}
+	}
+	return "", adns.Result{}, dnsError(fmt.Errorf("%w: too many cnames", errLimit), host)
+}
+
+func (r *Recursor) LookupHost(ctx context.Context, host string) ([]string, adns.Result, error) {
+	ips, result, err := r.LookupIP(ctx, "ip", host)
+	var addrs []string
+	for _, ip := range ips {
+		addrs = append(addrs, ip.String())
+	}
+	return addrs, result, err
+}
+
+// LookupIP looks up IPv4 and/or IPv6 addresses, for network "ip", "ip4" or "ip6".
+func (r *Recursor) LookupIP(ctx context.Context, network, host string) ([]net.IP, adns.Result, error) {
+	var types []uint16
+	switch network {
+	case "ip":
+		types = []uint16{typeA, typeAAAA}
+	case "ip4":
+		types = []uint16{typeA}
+	case "ip6":
+		types = []uint16{typeAAAA}
+	default:
+		return nil, adns.Result{}, fmt.Errorf("unsupported network %q", network)
+	}
+	var ips []net.IP
+	var firstErr error
+	authentic := true
+	for _, t := range types {
+		records, _, result, err := r.lookupType(ctx, host, t)
+		authentic = authentic && result.Authentic
+		if err != nil {
+			var dnsErr *adns.DNSError
+			if firstErr == nil || errors.As(firstErr, &dnsErr) && dnsErr.IsNotFound {
+				firstErr = err
+			}
+			continue
+		}
+		for _, rec := range records {
+			ips = append(ips, net.IP(slices.Clone(rec.Data)))
+		}
+	}
+	if len(ips) == 0 {
+		return nil, adns.Result{Authentic: authentic}, firstErr
+	}
+	return ips, adns.Result{Authentic: authentic}, nil
+}
+
+func (r *Recursor) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, adns.Result, error) {
+	ips, result, err := r.LookupIP(ctx, "ip", host)
+	var addrs []net.IPAddr
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: ip})
+	}
+	return addrs, result, err
+}
+
+// LookupMX returns the MX records sorted by preference, randomized within a
+// preference.
+func (r *Recursor) LookupMX(ctx context.Context, name string) ([]*net.MX, adns.Result, error) {
+	records, _, result, err := r.lookupType(ctx, name, typeMX)
+	if err != nil {
+		return nil, result, err
+	}
+	var l []*net.MX
+	for _, rec := range records {
+		if len(rec.Data) < 3 {
+			continue
+		}
+		if host, _, err := rdataName(rec.Data[2:]); err == nil {
+			l = append(l, &net.MX{Host: nameString(host), Pref: binary.BigEndian.Uint16(rec.Data)})
+		}
+	}
+	rand.Shuffle(len(l), func(i, j int) { l[i], l[j] = l[j], l[i] })
+	slices.SortStableFunc(l, func(a, b *net.MX) int { return int(a.Pref) - int(b.Pref) })
+	return l, result, nil
+}
+
+func (r *Recursor) LookupNS(ctx context.Context, name string) ([]*net.NS, adns.Result, error) {
+	records, _, result, err := r.lookupType(ctx, name, typeNS)
+	if err != nil {
+		return nil, result, err
+	}
+	var l []*net.NS
+	for _, rec := range records {
+		if host, _, err := rdataName(rec.Data); err == nil {
+			l = append(l, &net.NS{Host: nameString(host)})
+		}
+	}
+	return l, result, nil
+}
+
+// LookupSRV looks up SRV records at "_service._proto.name", or name if service and
+// proto are empty. Records are sorted by priority, and randomized by weight
+// within a priority.
+func (r *Recursor) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, adns.Result, error) {
+	target := name
+	if service != "" || proto != "" {
+		target = "_" + service + "._" + proto + "." + name
+	}
+	records, canonical, result, err := r.lookupType(ctx, target, typeSRV)
+	if err != nil {
+		return "", nil, result, err
+	}
+	var l []*net.SRV
+	for _, rec := range records {
+		d := rec.Data
+		if len(d) < 7 {
+			continue
+		}
+		if host, _, err := rdataName(d[6:]); err == nil {
+			l = append(l, &net.SRV{
+				Priority: binary.BigEndian.Uint16(d[0:]),
+				Weight:   binary.BigEndian.Uint16(d[2:]),
+				Port:     binary.BigEndian.Uint16(d[4:]),
+				Target:   nameString(host),
+			})
+		}
+	}
+	sortSRV(l)
+	return canonical, l, result, nil
+}
+
+// sortSRV sorts by priority, and within a priority by weighted random selection,
+// RFC 2782.
+func sortSRV(l []*net.SRV) {
+	slices.SortStableFunc(l, func(a, b *net.SRV) int { return int(a.Priority) - int(b.Priority) })
+	for i := 0; i < len(l); {
+		j := i + 1
+		for j < len(l) && l[j].Priority == l[i].Priority {
+			j++
+		}
+		group := l[i:j]
+		for k := range group {
+			var sum int
+			for _, s := range group[k:] {
+				sum += int(s.Weight)
+			}
+			if sum == 0 {
+				break
+			}
+			n := rand.IntN(sum)
+			for m, s := range group[k:] {
+				n -= int(s.Weight)
+				if n < 0 {
+					group[k], group[k+m] = group[k+m], group[k]
+					break
+				}
+			}
+		}
+		i = j
+	}
+}
+
+// LookupTXT returns the TXT records, with the strings of a record concatenated.
+func (r *Recursor) LookupTXT(ctx context.Context, name string) ([]string, adns.Result, error) {
+	records, _, result, err := r.lookupType(ctx, name, typeTXT)
+	if err != nil {
+		return nil, result, err
+	}
+	var l []string
+	for _, rec := range records {
+		var s strings.Builder
+		d := rec.Data
+		for len(d) > 0 {
+			n := int(d[0])
+			if 1+n > len(d) {
+				break
+			}
+			s.Write(d[1 : 1+n])
+			d = d[1+n:]
+		}
+		l = append(l, s.String())
+	}
+	return l, result, nil
+}
+
+// LookupTLSA looks up TLSA records at "_port._protocol.host", or host if port is
+// 0 and protocol empty.
+func (r *Recursor) LookupTLSA(ctx context.Context, port int, protocol, host string) ([]adns.TLSA, adns.Result, error) {
+	name := host
+	if port != 0 || protocol != "" {
+		name = fmt.Sprintf("_%d._%s.%s", port, protocol, host)
+	}
+	records, _, result, err := r.lookupType(ctx, name, typeTLSA)
+	if err != nil {
+		return nil, result, err
+	}
+	var l []adns.TLSA
+	for _, rec := range records {
+		d := rec.Data
+		if len(d) < 3 {
+			continue
+		}
+		l = append(l, adns.TLSA{
+			Usage:     adns.TLSAUsage(d[0]),
+			Selector:  adns.TLSASelector(d[1]),
+			MatchType: adns.TLSAMatchType(d[2]),
+			CertAssoc: slices.Clone(d[3:]),
+		})
+	}
+	return l, result, nil
+}
@@ -0,0 +1,89 @@
+package recursor
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// Transport sends a DNS query message to an authoritative name server, and
+// returns the response message.
+type Transport interface {
+	Exchange(ctx context.Context, server netip.Addr, query []byte) ([]byte, error)
+}
+
+// NetTransport sends queries over UDP to port 53, retrying over TCP if the
+// response is truncated.
+type NetTransport struct {
+	Timeout time.Duration // Per attempt. Default 3s.
+}
+
+var _ Transport = NetTransport{}
+
+func (t NetTransport) Exchange(ctx context.Context, server netip.Addr, query []byte) ([]byte, error) {
+	timeout := t.Timeout
+	if timeout == 0 {
+		timeout = 3 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	addr := netip.AddrPortFrom(server, 53).String()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// Ignore responses with a different ID, they are not for us.
+		if n < 12 || binary.BigEndian.Uint16(buf) != binary.BigEndian.Uint16(query) {
+			continue
+		}
+		if binary.BigEndian.Uint16(buf[2:])&flagTC == 0 {
+			return buf[:n], nil
+		}
+		break
+	}
+
+	// Truncated, retry over TCP.
+	tconn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer tconn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		tconn.SetDeadline(deadline)
+	}
+	msg := binary.BigEndian.AppendUint16(nil, uint16(len(query)))
+	msg = append(msg, query...)
+	if _, err := tconn.Write(msg); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(tconn, buf[:2]); err != nil {
+		return nil, err
+	}
+	n := int(binary.BigEndian.Uint16(buf))
+	if n < 12 {
+		return nil, fmt.Errorf("short tcp response")
+	}
+	if _, err := io.ReadFull(tconn, buf[:n]); err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
@@ -0,0 +1,522 @@
+package recursor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// We do our own DNS message parsing: We need the RDATA of records in the exact
+// (uncompressed) wire format for verifying DNSSEC signatures, and need access to
+// types the standard library doesn't know about.
+
+// DNS record types we handle.
+const (
+	typeA          uint16 = 1
+	typeNS         uint16 = 2
+	typeCNAME      uint16 = 5
+	typeSOA        uint16 = 6
+	typePTR        uint16 = 12
+	typeMX         uint16 = 15
+	typeTXT        uint16 = 16
+	typeAAAA       uint16 = 28
+	typeSRV        uint16 = 33
+	typeDNAME      uint16 = 39
+	typeOPT        uint16 = 41
+	typeDS         uint16 = 43
+	typeRRSIG      uint16 = 46
+	typeNSEC       uint16 = 47
+	typeDNSKEY     uint16 = 48
+	typeNSEC3      uint16 = 50
+	typeNSEC3PARAM uint16 = 51
+	typeTLSA       uint16 = 52
+)
+
+const classINET uint16 = 1
+
+// Response codes.
+const (
+	rcodeSuccess  = 0
+	rcodeServFail = 2
+	rcodeNXDomain = 3
+	rcodeRefused  = 5
+)
+
+// Header flags.
+const (
+	flagQR = 1 << 15
+	flagAA = 1 << 10
+	flagTC = 1 << 9
+	flagRD = 1 << 8
+	flagCD = 1 << 4
+)
+
+var errMalformed = errors.New("malformed dns message")
+
+// A name is a domain name in DNS wire format: length-prefixed labels, ending
+// with the empty root label. Owner names of records are always lower case.
+// Names in RDATA keep their case.
+
+const rootName = "\x00"
+
+// parseName parses a name in presentation format, with optional trailing dot,
+// into a lower case name in wire format. Backslash-escapes are allowed.
+func parseName(s string) (string, error) {
+	if s == "." || s == "" {
+		return rootName, nil
+	}
+	s = strings.TrimSuffix(s, ".")
+	var b []byte
+	var label []byte
+	endLabel := func() error {
+		if len(label) == 0 || len(label) > 63 {
+			return fmt.Errorf("invalid label length %d", len(label))
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+		label = label[:0]
+		return nil
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '.':
+			if err := endLabel(); err != nil {
+				return "", err
+			}
+		case '\\':
+			if i+1 >= len(s) {
+				return "", fmt.Errorf("backslash at end of name")
+			}
+			if isDigit(s[i+1]) {
+				if i+3 >= len(s) || !isDigit(s[i+2]) || !isDigit(s[i+3]) {
+					return "", fmt.Errorf("bad decimal escape")
+				}
+				v, _ := strconv.Atoi(s[i+1 : i+4])
+				if v > 255 {
+					return "", fmt.Errorf("bad decimal escape")
+				}
+				label = append(label, byte(v))
+				i += 3
+			} else {
+				label = append(label, s[i+1])
+				i++
+			}
+		default:
+			label = append(label, c)
+		}
+	}
+	if err := endLabel(); err != nil {
+		return "", err
+	}
+	b = append(b, 0)
+	if len(b) > 255 {
+		return "", fmt.Errorf("name too long")
+	}
+	return lowerName(string(b)), nil
+}
+
+// lowerName returns n with ASCII letters lower cased. Other bytes in labels are
+// left as is, unlike strings.ToLower, RFC 4343.
+func lowerName(n string) string {
+	b := []byte(n)
+	for i, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			b[i] = c + ('a' - 'A')
+		}
+	}
+	return string(b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// nameString returns the presentation format of a wire-format name, with
+// trailing dot.
+func nameString(n string) string {
+	if n == rootName {
+		return "."
+	}
+	var b strings.Builder
+	for _, l := range nameLabels(n) {
+		for i := 0; i < len(l); i++ {
+			c := l[i]
+			switch {
+			case c == '.' || c == '\\':
+				b.WriteByte('\\')
+				b.WriteByte(c)
+			case c <= ' ' || c >= 0x7f:
+				fmt.Fprintf(&b, "\\%03d", c)
+			default:
+				b.WriteByte(c)
+			}
+		}
+		b.WriteByte('.')
+	}
+	return b.String()
+}
+
+// nameLabels returns the labels of a name, from left to right, without the root
+// label.
+func nameLabels(n string) []string {
+	var l []string
+	for len(n) > 1 {
+		k := int(n[0])
+		l = append(l, n[1:1+k])
+		n = n[1+k:]
+	}
+	return l
+}
+
+func labelCount(n string) int {
+	var c int
+	for len(n) > 1 {
+		c++
+		n = n[1+int(n[0]):]
+	}
+	return c
+}
+
+// parentName returns the name without its first label. The parent of the root is
+// the root.
+func parentName(n string) string {
+	if n == rootName {
+		return n
+	}
+	return n[1+int(n[0]):]
+}
+
+// lastLabels returns the name consisting of the last k labels of n.
+func lastLabels(n string, k int) string {
+	for c := labelCount(n); c > k; c-- {
+		n = parentName(n)
+	}
+	return n
+}
+
+// isSubdomain returns whether n is equal to or below zone.
+func isSubdomain(n, zone string) bool {
+	for {
+		if n == zone {
+			return true
+		} else if n == rootName {
+			return false
+		}
+		n = parentName(n)
+	}
+}
+
+// compareNames compares names in canonical DNS order, RFC 4034 section 6.1:
+// label by label from the right, labels compared as lower case byte strings.
+func compareNames(a, b string) int {
+	la := nameLabels(a)
+	lb := nameLabels(b)
+	for i, j := len(la)-1, len(lb)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if c := strings.Compare(lowerName(la[i]), lowerName(lb[j])); c != 0 {
+			return c
+		}
+	}
+	return len(la) - len(lb)
+}
+
+// rr is a resource record. RDATA has names uncompressed, so it can be used for
+// DNSSEC verification.
+type rr struct {
+	Name  string // Wire format, lower case.
+	Type  uint16
+	Class uint16
+	TTL   uint32
+	Data  []byte
+}
+
+type question struct {
+	Name  string
+	Type  uint16
+	Class uint16
+}
+
+type message struct {
+	ID         uint16
+	Flags      uint16
+	Rcode      int // Including extended rcode from OPT record.
+	Question   []question
+	Answer     []rr
+	Authority  []rr
+	Additional []rr // Without OPT record.
+}
+
+// buildQuery returns a DNS query message for name and type, with an EDNS0 OPT
+// record with the DNSSEC OK bit set. Recursion is not requested, we are doing
+// the iteration ourselves. Checking disabled is set, so upstream servers that
+// validate (e.g. forwarders) give us the data even when they think it is bogus,
+// we do our own validation.
+func buildQuery(id uint16, name string, qtype uint16) []byte {
+	b := make([]byte, 12, 12+len(name)+4+11)
+	binary.BigEndian.PutUint16(b[0:], id)
+	binary.BigEndian.PutUint16(b[2:], flagCD)
+	binary.BigEndian.PutUint16(b[4:], 1)  // qdcount
+	binary.BigEndian.PutUint16(b[10:], 1) // arcount
+	b = append(b, name...)
+	b = binary.BigEndian.AppendUint16(b, qtype)
+	b = binary.BigEndian.AppendUint16(b, classINET)
+	// OPT record, RFC 6891.
+	b = append(b, 0) // Root name.
+	b = binary.BigEndian.AppendUint16(b, typeOPT)
+	b = binary.BigEndian.AppendUint16(b, 1232)  // UDP payload size.
+	b = append(b, 0, 0)                         // Extended rcode, version.
+	b = binary.BigEndian.AppendUint16(b, 1<<15) // DNSSEC OK.
+	b = binary.BigEndian.AppendUint16(b, 0)     // RDLENGTH.
+	return b
+}
+
+// parseMessage parses a DNS message. Names in RDATA of types that can be
+// compressed are decompressed.
+func parseMessage(buf []byte) (*message, error) {
+	if len(buf) < 12 {
+		return nil, errMalformed
+	}
+	m := &message{
+		ID:    binary.BigEndian.Uint16(buf[0:]),
+		Flags: binary.BigEndian.Uint16(buf[2:]),
+	}
+	m.Rcode = int(m.Flags & 0xf)
+	qd := int(binary.BigEndian.Uint16(buf[4:]))
+	an := int(binary.BigEndian.Uint16(buf[6:]))
+	ns := int(binary.BigEndian.Uint16(buf[8:]))
+	ar := int(binary.BigEndian.Uint16(buf[10:]))
+	off := 12
+	for range qd {
+		name, o, err := unpackName(buf, off)
+		if err != nil {
+			return nil, err
+		}
+		if o+4 > len(buf) {
+			return nil, errMalformed
+		}
+		m.Question = append(m.Question, question{lowerName(name), binary.BigEndian.Uint16(buf[o:]), binary.BigEndian.Uint16(buf[o+2:])})
+		off = o + 4
+	}
+	section := func(n int) ([]rr, error) {
+		var l []rr
+		for range n {
+			r, o, err := unpackRR(buf, off)
+			if err != nil {
+				return nil, err
+			}
+			off = o
+			l = append(l, r)
+		}
+		return l, nil
+	}
+	var err error
+	if m.Answer, err = section(an); err != nil {
+		return nil, err
+	}
+	if m.Authority, err = section(ns); err != nil {
+		return nil, err
+	}
+	additional, err := section(ar)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range additional {
+		if r.Type == typeOPT {
+			// Extended rcode in upper 8 bits of TTL.
+			m.Rcode |= int(r.TTL>>24) << 4
+			continue
+		}
+		m.Additional = append(m.Additional, r)
+	}
+	return m, nil
+}
+
+// unpackName returns a name in wire format starting at off, following
+// compression pointers. The returned offset is after the name in the original
+// position.
+func unpackName(buf []byte, off int) (string, int, error) {
+	var b []byte
+	end := -1
+	ptrs := 0
+	for {
+		if off >= len(buf) {
+			return "", 0, errMalformed
+		}
+		c := int(buf[off])
+		switch c & 0xc0 {
+		case 0x00:
+			if off+1+c > len(buf) {
+				return "", 0, errMalformed
+			}
+			b = append(b, buf[off:off+1+c]...)
+			if len(b) > 255 {
+				return "", 0, errMalformed
+			}
+			off += 1 + c
+			if c == 0 {
+				if end < 0 {
+					end = off
+				}
+				return string(b), end, nil
+			}
+		case 0xc0:
+			if off+2 > len(buf) {
+				return "", 0, errMalformed
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			ptrs++
+			if ptrs > 64 {
+				return "", 0, errMalformed
+			}
+			off = int(binary.BigEndian.Uint16(buf[off:]) & 0x3fff)
+		default:
+			return "", 0, errMalformed
+		}
+	}
+}
+
+func unpackRR(buf []byte, off int) (rr, int, error) {
+	name, off, err := unpackName(buf, off)
+	if err != nil {
+		return rr{}, 0, err
+	}
+	if off+10 > len(buf) {
+		return rr{}, 0, errMalformed
+	}
+	r := rr{
+		Name:  lowerName(name),
+		Type:  binary.BigEndian.Uint16(buf[off:]),
+		Class: binary.BigEndian.Uint16(buf[off+2:]),
+		TTL:   binary.BigEndian.Uint32(buf[off+4:]),
+	}
+	n := int(binary.BigEndian.Uint16(buf[off+8:]))
+	off += 10
+	if off+n > len(buf) {
+		return rr{}, 0, errMalformed
+	}
+	end := off + n
+
+	// Decompress names for types from RFC 1035 (and SRV, which some servers
+	// compress).
+	var data []byte
+	name1 := func() error {
+		s, o, err := unpackName(buf, off)
+		if err != nil || o > end {
+			return errMalformed
+		}
+		data = append(data, s...)
+		off = o
+		return nil
+	}
+	fixed := func(k int) error {
+		if off+k > end {
+			return errMalformed
+		}
+		data = append(data, buf[off:off+k]...)
+		off += k
+		return nil
+	}
+	switch r.Type {
+	case typeNS, typeCNAME, typePTR, typeDNAME:
+		err = name1()
+	case typeMX:
+		if err = fixed(2); err == nil {
+			err = name1()
+		}
+	case typeSRV:
+		if err = fixed(6); err == nil {
+			err = name1()
+		}
+	case typeSOA:
+		if err = name1(); err == nil {
+			if err = name1(); err == nil {
+				err = fixed(20)
+			}
+		}
+	default:
+		err = fixed(n)
+	}
+	if err != nil {
+		return rr{}, 0, err
+	}
+	if off != end {
+		return rr{}, 0, errMalformed
+	}
+	r.Data = data
+	return r, end, nil
+}
+
+// packRR returns the wire format of a record, without compression.
+func packRR(b []byte, r rr) []byte {
+	b = append(b, r.Name...)
+	b = binary.BigEndian.AppendUint16(b, r.Type)
+	b = binary.BigEndian.AppendUint16(b, r.Class)
+	b = binary.BigEndian.AppendUint32(b, r.TTL)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(r.Data)))
+	return append(b, r.Data...)
+}
+
+// rdataName returns the name at the start of data, and the remaining data.
+func rdataName(data []byte) (string, []byte, error) {
+	var o int
+	for {
+		if o >= len(data) {
+			return "", nil, errMalformed
+		}
+		c := int(data[o])
+		if c&0xc0 != 0 {
+			return "", nil, errMalformed
+		}
+		o += 1 + c
+		if c == 0 {
+			break
+		}
+	}
+	if o > len(data) || o > 255 {
+		return "", nil, errMalformed
+	}
+	return string(data[:o]), data[o:], nil
+}
+
+// typeString returns the name of known types, for logging and errors.
+func typeString(t uint16) string {
+	switch t {
+	case typeA:
+		return "A"
+	case typeNS:
+		return "NS"
+	case typeCNAME:
+		return "CNAME"
+	case typeSOA:
+		return "SOA"
+	case typePTR:
+		return "PTR"
+	case typeMX:
+		return "MX"
+	case typeTXT:
+		return "TXT"
+	case typeAAAA:
+		return "AAAA"
+	case typeSRV:
+		return "SRV"
+	case typeDNAME:
+		return "DNAME"
+	case typeDS:
+		return "DS"
+	case typeRRSIG:
+		return "RRSIG"
+	case typeNSEC:
+		return "NSEC"
+	case typeDNSKEY:
+		return "DNSKEY"
+	case typeNSEC3:
+		return "NSEC3"
+	case typeTLSA:
+		return "TLSA"
+	}
+	return fmt.Sprintf("TYPE%d", t)
+}
@@ -0,0 +1,44 @@
+package recursor
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func FuzzParseMessage(f *testing.F) {
+	f.Add([]byte{})
+
+	// Queries and responses for all records in the test zones.
+	zones := loadTestZones(f)
+	for _, z := range zones {
+		for _, r := range z.records {
+			f.Add(buildQuery(1, r.Name, r.Type))
+			m := &message{ID: 1, Flags: flagQR, Question: []question{{r.Name, r.Type, classINET}}}
+			z.respond(r.Name, r.Type, m)
+			f.Add(packMessage(m))
+		}
+	}
+
+	// Response with a compressed owner name and compressed name in rdata.
+	b := packMessage(&message{ID: 1, Flags: flagQR, Question: []question{{"\x04mail\x07example\x00", typeMX, classINET}}})
+	binary.BigEndian.PutUint16(b[6:], 1) // ancount
+	b = append(b, 0xc0, 12)
+	b = binary.BigEndian.AppendUint16(b, typeMX)
+	b = binary.BigEndian.AppendUint16(b, classINET)
+	b = binary.BigEndian.AppendUint32(b, 300)
+	b = binary.BigEndian.AppendUint16(b, 4)
+	b = binary.BigEndian.AppendUint16(b, 10)
+	b = append(b, 0xc0, 12)
+	f.Add(b)
+
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		m, err := parseMessage(buf)
+		if err != nil {
+			return
+		}
+		// Names are decompressed, so the message can be packed and parsed again.
+		if _, err := parseMessage(packMessage(m)); err != nil {
+			t.Fatalf("parsing repacked message: %v", err)
+		}
+	})
+}
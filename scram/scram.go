@@ -146,6 +146,30 @@ type Server struct {
 	channelBinding      []byte
 }
 
+// ChannelBinding holds the TLS version and channel binding data of a TLS
+// connection, for a server that does not have access to the TLS connection
+// itself, e.g. because it is handled by another process.
+type ChannelBinding struct {
+	Version  uint16 // TLS version, e.g. tls.VersionTLS13.
+	Unique   []byte // For "tls-unique", with TLS 1.2 and earlier. Can be nil.
+	Exporter []byte // For "tls-exporter", with TLS 1.3 and later.
+}
+
+// NewChannelBinding returns the channel binding data for a TLS connection.
+func NewChannelBinding(cs *tls.ConnectionState) (*ChannelBinding, error) {
+	cb := &ChannelBinding{Version: cs.Version}
+	if cs.Version <= tls.VersionTLS12 {
+		cb.Unique = cs.TLSUnique
+		return cb, nil
+	}
+	var err error
+	cb.Exporter, err = channelBindData(cs)
+	if err != nil {
+		return nil, err
+	}
+	return cb, nil
+}
+
 // NewServer returns a server given the first SCRAM message from a client.
 //
 // If cs is set, the PLUS variant can be negotiated, binding the authentication
@@ -161,6 +185,24 @@ type Server struct {
 //   - Read initial data from client, call NewServer (this call), then ServerFirst and write to the client.
 //   - Read response from client, call Finish or FinishFinal and write the resulting string.
 func NewServer(h func() hash.Hash, clientFirst []byte, cs *tls.ConnectionState, channelBindingRequired bool) (server *Server, rerr error) {
+	var cb *ChannelBinding
+	if cs != nil {
+		var err error
+		cb, err = NewChannelBinding(cs)
+		if err != nil {
+			// We can pass back the error, it should never contain sensitive data, and only
+			// happen due to incorrect calling or a TLS config that is currently impossible
+			// (renegotiation enabled).
+			return nil, fmt.Errorf("error fetching channel binding data: %v: %w", err, ErrOtherError)
+		}
+	}
+	return NewServerChannelBinding(h, clientFirst, cb, channelBindingRequired)
+}
+
+// NewServerChannelBinding is like NewServer, but with channel binding data
+// instead of a TLS connection state. If cb is nil, the PLUS variant cannot be
+// negotiated.
+func NewServerChannelBinding(h func() hash.Hash, clientFirst []byte, cb *ChannelBinding, channelBindingRequired bool) (server *Server, rerr error) {
 	p := newParser(clientFirst)
 	defer p.recover(&rerr)
 
@@ -191,34 +233,28 @@ func NewServer(h func() hash.Hash, clientFirst []byte, cs *tls.ConnectionState,
 		// sensitive... ../rfc/5802:547
 		switch cbname {
 		case "tls-unique":
-			if cs == nil {
+			if cb == nil {
 				p.xerrorf("no tls connection: %w", ErrChannelBindingsDontMatch)
-			} else if cs.Version >= tls.VersionTLS13 {
+			} else if cb.Version >= tls.VersionTLS13 {
 				// ../rfc/9266:122
 				p.xerrorf("tls-unique not defined for tls 1.3 and later, use tls-exporter: %w", ErrChannelBindingsDontMatch)
-			} else if cs.TLSUnique == nil {
+			} else if cb.Unique == nil {
 				// As noted in the crypto/tls documentation.
 				p.xerrorf("no tls-unique channel binding value for this tls connection, possibly due to missing extended master key support and/or resumed connection: %w", ErrChannelBindingsDontMatch)
 			}
+			server.channelBinding = cb.Unique
 		case "tls-exporter":
-			if cs == nil {
+			if cb == nil {
 				p.xerrorf("no tls connection: %w", ErrChannelBindingsDontMatch)
-			} else if cs.Version < tls.VersionTLS13 {
+			} else if cb.Version < tls.VersionTLS13 {
 				// Using tls-exporter with pre-1.3 TLS would require more precautions. Perhaps later.
 				// ../rfc/9266:201
 				p.xerrorf("tls-exporter with tls before 1.3 not implemented, use tls-unique: %w", ErrChannelBindingsDontMatch)
 			}
+			server.channelBinding = cb.Exporter
 		default:
 			p.xerrorf("unknown parameter p %s: %w", cbname, ErrUnsupportedChannelBindingType)
 		}
-		cb, err := channelBindData(cs)
-		if err != nil {
-			// We can pass back the error, it should never contain sensitive data, and only
-			// happen due to incorrect calling or a TLS config that is currently impossible
-			// (renegotiation enabled).
-			p.xerrorf("error fetching channel binding data: %v: %w", err, ErrOtherError)
-		}
-		server.channelBinding = cb
 	default:
 		p.xerrorf("unrecognized gs2 channel bind flag")
 	}
@@ -273,6 +309,16 @@ func (s *Server) ServerFirst(iterations int, salt []byte) (string, error) {
 // authorization requested is not acceptable, the server should call
 // FinishError instead.
 func (s *Server) Finish(clientFinal []byte, saltedPassword []byte) (serverFinal string, rerr error) {
+	serverFinal, _, rerr = s.FinishMulti(clientFinal, [][]byte{saltedPassword})
+	return
+}
+
+// FinishMulti is like Finish, but verifies the client against multiple salted
+// passwords, e.g. for a main password and application-specific passwords. All
+// salted passwords must be derived with the salt and iterations passed to
+// ServerFirst. On success, index is the index of the matching salted password.
+func (s *Server) FinishMulti(clientFinal []byte, saltedPasswords [][]byte) (serverFinal string, index int, rerr error) {
+	index = -1
 	p := newParser(clientFinal)
 	defer p.recover(&rerr)
 
@@ -282,12 +328,12 @@ func (s *Server) Finish(clientFinal []byte, saltedPassword []byte) (serverFinal
 	cbind := p.xchannelBinding()
 	cbindExp := append([]byte(s.gs2header), s.channelBinding...)
 	if !bytes.Equal(cbind, cbindExp) {
-		return "e=" + string(ErrChannelBindingsDontMatch), ErrChannelBindingsDontMatch
+		return "e=" + string(ErrChannelBindingsDontMatch), -1, ErrChannelBindingsDontMatch
 	}
 	p.xtake(",")
 	nonce := p.xnonce()
 	if nonce != s.nonce {
-		return "e=" + string(ErrInvalidProof), ErrInvalidProof
+		return "e=" + string(ErrInvalidProof), -1, ErrInvalidProof
 	}
 	for !p.peek(",p=") {
 		p.xtake(",")
@@ -300,20 +346,23 @@ func (s *Server) Finish(clientFinal []byte, saltedPassword []byte) (serverFinal
 
 	authMsg := s.clientFirstBare + "," + s.serverFirst + "," + s.clientFinalWithoutProof
 
-	clientKey := hmac0(s.h, saltedPassword, "Client Key")
-	h := s.h()
-	h.Write(clientKey)
-	storedKey := h.Sum(nil)
+	for i, saltedPassword := range saltedPasswords {
+		clientKey := hmac0(s.h, saltedPassword, "Client Key")
+		h := s.h()
+		h.Write(clientKey)
+		storedKey := h.Sum(nil)
 
-	clientSig := hmac0(s.h, storedKey, authMsg)
-	xor(clientSig, clientKey) // Now clientProof.
-	if !bytes.Equal(clientSig, proof) {
-		return "e=" + string(ErrInvalidProof), ErrInvalidProof
-	}
+		clientSig := hmac0(s.h, storedKey, authMsg)
+		xor(clientSig, clientKey) // Now clientProof.
+		if !bytes.Equal(clientSig, proof) {
+			continue
+		}
 
-	serverKey := hmac0(s.h, saltedPassword, "Server Key")
-	serverSig := hmac0(s.h, serverKey, authMsg)
-	return fmt.Sprintf("v=%s", base64.StdEncoding.EncodeToString(serverSig)), nil
+		serverKey := hmac0(s.h, saltedPassword, "Server Key")
+		serverSig := hmac0(s.h, serverKey, authMsg)
+		return fmt.Sprintf("v=%s", base64.StdEncoding.EncodeToString(serverSig)), i, nil
+	}
+	return "e=" + string(ErrInvalidProof), -1, ErrInvalidProof
 }
 
 // FinishError returns an error message to write to the client for the final
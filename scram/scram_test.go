@@ -59,8 +59,8 @@ func TestSCRAMSHA256Server(t *testing.T) {
 	tcheck(t, err, "saltpassword")
 
 	server, err := NewServer(sha256.New, []byte("n,,n=user,r=rOprNGfwEbeRWgbNEkqO"), nil, false)
-	server.serverNonceOverride = "%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0"
 	tcheck(t, err, "newserver")
+	server.serverNonceOverride = "%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0"
 	resp, err := server.ServerFirst(4096, salt)
 	tcheck(t, err, "server first")
 	if resp != "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096" {
@@ -80,8 +80,8 @@ func TestScramServerBadPassword(t *testing.T) {
 	tcheck(t, err, "saltpassword")
 
 	server, err := NewServer(sha256.New, []byte("n,,n=user,r=rOprNGfwEbeRWgbNEkqO"), nil, false)
-	server.serverNonceOverride = "%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0"
 	tcheck(t, err, "newserver")
+	server.serverNonceOverride = "%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0"
 	_, err = server.ServerFirst(4096, salt)
 	tcheck(t, err, "server first")
 	_, err = server.Finish([]byte("c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="), saltedPassword)
@@ -97,8 +97,8 @@ func TestScramServerBadIterations(t *testing.T) {
 	tcheck(t, err, "saltpassword")
 
 	server, err := NewServer(sha256.New, []byte("n,,n=user,r=rOprNGfwEbeRWgbNEkqO"), nil, false)
-	server.serverNonceOverride = "%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0"
 	tcheck(t, err, "newserver")
+	server.serverNonceOverride = "%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0"
 	_, err = server.ServerFirst(4096, salt)
 	tcheck(t, err, "server first")
 	_, err = server.Finish([]byte("c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="), saltedPassword)
@@ -123,6 +123,38 @@ func TestScramServerBad(t *testing.T) {
 	}
 }
 
+func TestScramServerMulti(t *testing.T) {
+	salt := base64Decode("W22ZaJ0SNY7soEsUEjb6gQ==")
+	other, err := SaltPassword(sha256.New, "other", salt, 4096)
+	tcheck(t, err, "saltpassword")
+	pencil, err := SaltPassword(sha256.New, "pencil", salt, 4096)
+	tcheck(t, err, "saltpassword")
+
+	server, err := NewServer(sha256.New, []byte("n,,n=user,r=rOprNGfwEbeRWgbNEkqO"), nil, false)
+	tcheck(t, err, "newserver")
+	server.serverNonceOverride = "%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0"
+	_, err = server.ServerFirst(4096, salt)
+	tcheck(t, err, "server first")
+	serverFinal, index, err := server.FinishMulti([]byte("c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="), [][]byte{other, pencil})
+	tcheck(t, err, "finish")
+	if index != 1 {
+		t.Fatalf("got index %d, expected 1", index)
+	}
+	if serverFinal != "v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=" {
+		t.Fatalf("bad server final")
+	}
+
+	server, err = NewServer(sha256.New, []byte("n,,n=user,r=rOprNGfwEbeRWgbNEkqO"), nil, false)
+	tcheck(t, err, "newserver")
+	server.serverNonceOverride = "%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0"
+	_, err = server.ServerFirst(4096, salt)
+	tcheck(t, err, "server first")
+	_, index, err = server.FinishMulti([]byte("c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="), [][]byte{other})
+	if !errors.Is(err, ErrInvalidProof) || index != -1 {
+		t.Fatalf("got %v, index %d, expected ErrInvalidProof and index -1", err, index)
+	}
+}
+
 func TestScramClient(t *testing.T) {
 	c := NewClient(sha256.New, "user", "", false, nil)
 	c.clientNonce = "rOprNGfwEbeRWgbNEkqO"
@@ -7,12 +7,15 @@ import (
 
 	"github.com/mjl-/mox/dmarcdb"
 	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/greylist"
 	"github.com/mjl-/mox/http"
 	"github.com/mjl-/mox/imapserver"
+	"github.com/mjl-/mox/locallist"
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/mox-"
 	"github.com/mjl-/mox/mtastsdb"
 	"github.com/mjl-/mox/queue"
+	"github.com/mjl-/mox/recursor"
 	"github.com/mjl-/mox/smtpserver"
 	"github.com/mjl-/mox/store"
 	"github.com/mjl-/mox/tlsrptdb"
@@ -47,7 +50,9 @@ func shutdown(log mlog.Log) {
 			log.Print("shutting down with pending sockets")
 		}
 	}
-	err := os.Remove(mox.DataDirPath("ctl"))
+	err := mox.LimitersSave(log)
+	log.Check(err, "saving rate limiter counts during shutdown")
+	err = os.Remove(mox.DataDirPath("ctl"))
 	log.Check(err, "removing ctl unix domain socket during shutdown")
 }
 
@@ -57,6 +62,7 @@ func start(mtastsdbRefresher, sendDMARCReports, sendTLSReports, skipForkExec boo
 	smtpserver.Listen()
 	imapserver.Listen()
 	http.Listen()
+	locallist.Listen()
 
 	if !skipForkExec {
 		// If we were just launched as root, fork and exec as unprivileged user, handing
@@ -70,6 +76,21 @@ func start(mtastsdbRefresher, sendDMARCReports, sendTLSReports, skipForkExec boo
 		}
 	}
 
+	if rr := mox.Conf.Static.RecursiveResolver; rr != nil && rr.Enabled {
+		opts := recursor.Options{
+			TrustAnchors: rr.TrustAnchors,
+			CacheSize:    rr.CacheSize,
+		}
+		if !rr.NoTrustAnchorUpdates {
+			opts.TrustAnchorFile = mox.DataDirPath("dnssec-trust-anchors.json")
+		}
+		r, err := recursor.New(nil, opts)
+		if err != nil {
+			return fmt.Errorf("recursive resolver: %s", err)
+		}
+		dns.Recursive = r
+	}
+
 	if err := mtastsdb.Init(mtastsdbRefresher); err != nil {
 		return fmt.Errorf("mtastsdb init: %s", err)
 	}
@@ -82,6 +103,10 @@ func start(mtastsdbRefresher, sendDMARCReports, sendTLSReports, skipForkExec boo
 		return fmt.Errorf("dmarcdb init: %s", err)
 	}
 
+	if err := greylist.Init(true); err != nil {
+		return fmt.Errorf("greylist init: %s", err)
+	}
+
 	if err := store.Init(mox.Context); err != nil {
 		return fmt.Errorf("store init: %s", err)
 	}
@@ -99,10 +124,22 @@ func start(mtastsdbRefresher, sendDMARCReports, sendTLSReports, skipForkExec boo
 		tlsrptsend.Start(dns.StrictResolver{Pkg: "tlsrptsend"})
 	}
 
+	// Rate limiter counts are kept across restarts. We save periodically in case of
+	// an unclean shutdown.
+	log := mlog.New("serve", nil)
+	mox.LimitersLoad(log)
+	go func() {
+		for !mox.Sleep(mox.Shutdown, 5*time.Minute) {
+			err := mox.LimitersSave(log)
+			log.Check(err, "saving rate limiter counts")
+		}
+	}()
+
 	store.StartAuthCache()
 	smtpserver.Serve()
 	imapserver.Serve()
 	http.Serve()
+	locallist.Serve()
 
 	go func() {
 		store.Switchboard()
@@ -24,6 +24,7 @@ import (
 
 	"github.com/mjl-/mox/dns"
 	"github.com/mjl-/mox/dnsbl"
+	"github.com/mjl-/mox/imapserver"
 	"github.com/mjl-/mox/message"
 	"github.com/mjl-/mox/metrics"
 	"github.com/mjl-/mox/mlog"
@@ -105,7 +106,7 @@ func monitorDNSBL(log mlog.Log) {
 		var publicIPs []net.IP
 		var publicIPstrs []string
 		for _, ip := range ips {
-			if ip.IsLoopback() || ip.IsPrivate() {
+			if ip.IsLoopback() || ip.IsPrivate() || slices.Contains(publicIPstrs, ip.String()) {
 				continue
 			}
 			publicIPs = append(publicIPs, ip)
@@ -120,8 +121,10 @@ func monitorDNSBL(log mlog.Log) {
 			}
 		}
 
-		// Do DNSBL checks and update metric.
+		// Do DNSBL checks and update metric. IPs that are listed are not used from IP
+		// pools for outgoing deliveries.
 		for _, ip := range publicIPs {
+			var listed bool
 			for _, zone := range zones {
 				status, expl, err := dnsbl.Lookup(mox.Context, log.Logger, resolver, zone, ip)
 				if err != nil {
@@ -134,6 +137,8 @@ func monitorDNSBL(log mlog.Log) {
 				var v float64
 				if status == dnsbl.StatusPass {
 					v = 1
+				} else if status == dnsbl.StatusFail {
+					listed = true
 				}
 				metricDNSBL.WithLabelValues(zone.Name(), ip.String()).Set(v)
 				k := key{zone, ip.String()}
@@ -141,6 +146,10 @@ func monitorDNSBL(log mlog.Log) {
 
 				time.Sleep(time.Second)
 			}
+			if listed != queue.IPListed(ip) {
+				log.Info("ip listed status in dnsbls changed", slog.Any("ip", ip), slog.Bool("listed", listed))
+			}
+			queue.IPListedSet(ip, listed)
 		}
 	}
 }
@@ -596,3 +605,56 @@ func fixperms(log mlog.Log, workdir, configdir, datadir string, moxuid, moxgid u
 	}
 	return nil
 }
+
+func cmdIMAPPreauth(c *cmd) {
+	c.unlisted = true
+	c.help = `Handle unauthenticated IMAP connections, started by "mox serve".
+
+With config option PreauthUser set, "mox serve" starts this process as the
+preauth user, passing it the listening IMAP sockets and a socket to the main
+process. New connections are passed to the main process, which does the TLS
+handshake and relays data until authentication. Credentials are verified by the
+main process, which serves authenticated connections itself.
+`
+	args := c.Parse()
+	if len(args) != 0 {
+		c.Usage()
+	}
+
+	log := c.log
+	if os.Getuid() == 0 {
+		log.Fatal("imappreauth must not run as root")
+	}
+	mox.Shutdown, mox.ShutdownCancel = context.WithCancel(context.Background())
+	mox.Context, mox.ContextCancel = context.WithCancel(context.Background())
+
+	mox.RestorePassedFiles()
+	ctl := mox.PreauthControl()
+	if ctl == nil {
+		log.Fatal("missing socket to main process, imappreauth is started by mox serve")
+	}
+
+	go func() {
+		sigc := make(chan os.Signal, 1)
+		signal.Notify(sigc, syscall.SIGTERM, syscall.SIGINT)
+		sig := <-sigc
+		log.Print("shutting down imap preauth process", slog.Any("signal", sig))
+		mox.ShutdownCancel()
+		select {
+		case <-mox.Connections.Done():
+		case <-time.After(3 * time.Second):
+			mox.ContextCancel()
+			mox.Connections.Shutdown()
+		}
+		os.Exit(0)
+	}()
+
+	err := imapserver.PreauthProcess(ctl)
+	select {
+	case <-mox.Shutdown.Done():
+		// Main process went away during shutdown, the signal handler exits.
+		select {}
+	default:
+	}
+	log.Fatalx("imap preauth process", err)
+}
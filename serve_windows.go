@@ -14,3 +14,14 @@ func cmdServe(c *cmd) {
 	}
 	log.Fatalln("mox serve not implemented on windows yet due to unfamiliarity with the windows security model, other commands including localserve do work")
 }
+
+func cmdIMAPPreauth(c *cmd) {
+	c.unlisted = true
+	c.help = `Handle unauthenticated IMAP connections. Not implemented on windows.
+`
+	args := c.Parse()
+	if len(args) != 0 {
+		c.Usage()
+	}
+	log.Fatalln("mox imappreauth not implemented on windows")
+}
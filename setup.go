@@ -0,0 +1,555 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	cryptorand "crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mjl-/sherpa"
+
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/smtp"
+	"github.com/mjl-/mox/webadmin"
+)
+
+func cmdSetup(c *cmd) {
+	c.params = "[-listen address]"
+	c.help = `Setup starts a web interface on localhost for interactively setting up mox.
+
+Setup is the interactive counterpart of "mox quickstart". It starts a temporary
+web server on localhost, protected with a random token that is part of the URL
+printed at startup. Open that URL in a browser. If mox is set up on a remote
+machine, forward the port with ssh, e.g. "ssh -L 1079:localhost:1079
+you@yourmachine".
+
+The web interface walks through detecting the hostname and IPs of the machine,
+the email address for the initial domain and account, and whether to use ACME
+for TLS certificates. Setup then generates the configuration files
+config/mox.conf and config/domains.conf, in the current directory, like
+quickstart. It shows the DNS records to create, and checks them live with the
+same checks as the admin web interface. On Linux, setup can install the systemd
+service file.
+
+If config/mox.conf already exists, setup skips generating a configuration and
+only helps with checking DNS records and installing the service file.
+`
+	listen := "localhost:1079"
+	c.flag.StringVar(&listen, "listen", listen, "address to listen on for the setup web interface, should be a loopback address")
+	args := c.Parse()
+	if len(args) != 0 {
+		c.Usage()
+	}
+
+	buf := make([]byte, 18)
+	cryptorand.Read(buf)
+	s := &setupServer{
+		token: base64.RawURLEncoding.EncodeToString(buf),
+		done:  make(chan struct{}),
+	}
+	if _, err := os.Stat(filepath.FromSlash("config/mox.conf")); err == nil {
+		s.loadConfig()
+	}
+
+	ln, err := net.Listen("tcp", listen)
+	xcheckf(err, "listen for setup web interface")
+	srv := &http.Server{Handler: s, ReadHeaderTimeout: 30 * time.Second}
+	go func() {
+		err := srv.Serve(ln)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("serving setup web interface: %v", err)
+		}
+	}()
+
+	fmt.Printf("Setup web interface is available at:\n\n\thttp://%s/%s/\n\n", ln.Addr(), s.token)
+	fmt.Printf("Open it in your browser. Press ctrl-c to stop setup.\n")
+	<-s.done
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = srv.Shutdown(ctx)
+	xcheckf(err, "shutting down setup web interface")
+	fmt.Printf("Setup is done.\n")
+}
+
+// setupServer serves the setup web interface.
+type setupServer struct {
+	token string
+	done  chan struct{}
+
+	sync.Mutex
+	finished   bool
+	output     string  // Output of quickstart, includes generated passwords.
+	configErrs []error // Errors loading the config, if any.
+	loaded     bool    // Whether the configuration has been loaded.
+}
+
+// loadConfig loads the configuration, for listing and checking domains.
+// Must be called with lock held, or before serving.
+func (s *setupServer) loadConfig() {
+	mox.ConfigStaticPath = filepath.FromSlash("config/mox.conf")
+	mox.ConfigDynamicPath = filepath.FromSlash("config/domains.conf")
+	s.configErrs = mox.LoadConfig(context.Background(), mlog.New("setup", nil), false, false)
+	s.loaded = len(s.configErrs) == 0
+}
+
+// setupDetect is the result of detecting settings of the machine.
+type setupDetect struct {
+	Hostname        string
+	HostnameIPs     []string
+	HostnameErr     string
+	LoopbackIPs     []string
+	PrivateIPs      []string
+	PublicIPs       []string
+	IPsErr          string
+	DNSSEC          bool
+	DNSSECErr       string
+	ExistingWebHTTP bool // Whether something is listening on port 80.
+}
+
+// detect gathers the host name, IPs and resolver properties. If hostname is
+// empty, the host name is guessed.
+func detect(ctx context.Context, hostname string) (d setupDetect) {
+	resolver := dns.StrictResolver{}
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	var err error
+	d.LoopbackIPs, d.PrivateIPs, d.PublicIPs, err = interfaceIPs()
+	if err != nil {
+		d.IPsErr = err.Error()
+	}
+
+	// Some DNSSEC-verifying resolvers return unauthentic data for ".", so we check "com".
+	if _, result, err := resolver.LookupNS(ctx, "com."); err != nil {
+		d.DNSSECErr = err.Error()
+	} else {
+		d.DNSSEC = result.Authentic
+	}
+
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+		if !strings.Contains(hostname, ".") {
+			// Linux machines often don't have an FQDN as name. Try reverse lookups of public IPs.
+			for _, ip := range d.PublicIPs {
+				names, _, err := resolver.LookupAddr(ctx, ip)
+				if err != nil {
+					continue
+				}
+				if i := slices.IndexFunc(names, func(s string) bool { return strings.Contains(strings.TrimSuffix(s, "."), ".") }); i >= 0 {
+					hostname = strings.TrimSuffix(names[i], ".")
+					break
+				}
+			}
+		}
+	}
+	d.Hostname = hostname
+
+	if dom, err := dns.ParseDomain(hostname); err != nil {
+		d.HostnameErr = err.Error()
+	} else if ips, _, err := resolver.LookupIPAddr(ctx, dom.ASCII+"."); err != nil {
+		d.HostnameErr = err.Error()
+	} else {
+		for _, ip := range ips {
+			d.HostnameIPs = append(d.HostnameIPs, ip.IP.String())
+		}
+	}
+
+	if conn, err := net.DialTimeout("tcp", "127.0.0.1:80", time.Second); err == nil {
+		conn.Close()
+		d.ExistingWebHTTP = true
+	}
+	return d
+}
+
+// setupCheck is a named result of a domain check, for display.
+type setupCheck struct {
+	Name string
+	webadmin.Result
+}
+
+// setupPage holds the data for rendering the setup template.
+type setupPage struct {
+	Step string // "detect" or "dns"
+	Err  string
+	Msg  string
+
+	// For step "detect".
+	Detect            setupDetect
+	Email             string
+	User              string
+	ExistingWebserver bool
+	SkipDial          bool
+
+	// For step "dns".
+	Output  string
+	Linux   bool
+	Domains []setupDomain
+}
+
+type setupDomain struct {
+	Name    string
+	Records []string
+	Checked bool
+	Checks  []setupCheck
+}
+
+func (s *setupServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	prefix := "/" + s.token + "/"
+	if len(r.URL.Path) < len(prefix) || subtle.ConstantTimeCompare([]byte(r.URL.Path[:len(prefix)]), []byte(prefix)) != 1 {
+		http.NotFound(w, r)
+		return
+	}
+	path := r.URL.Path[len(prefix):]
+
+	h := w.Header()
+	h.Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'")
+	h.Set("X-Frame-Options", "deny")
+	h.Set("Referrer-Policy", "no-referrer")
+	h.Set("Cache-Control", "no-store")
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s.finished {
+		http.Error(w, "setup is done", http.StatusGone)
+		return
+	}
+
+	ctx := r.Context()
+	switch {
+	case path == "" && r.Method == "GET":
+		if s.loaded {
+			s.serveDNS(ctx, w, r, "", "")
+			return
+		}
+		p := setupPage{
+			Step:              "detect",
+			Detect:            detect(ctx, r.FormValue("hostname")),
+			Email:             r.FormValue("email"),
+			User:              r.FormValue("user"),
+			ExistingWebserver: r.FormValue("existingwebserver") != "",
+			SkipDial:          r.FormValue("skipdial") != "",
+		}
+		if p.User == "" {
+			p.User = "mox"
+		}
+		if !p.ExistingWebserver && r.FormValue("hostname") == "" {
+			p.ExistingWebserver = p.Detect.ExistingWebHTTP
+		}
+		if len(s.configErrs) > 0 {
+			p.Err = fmt.Sprintf("config/mox.conf exists but cannot be loaded: %v", errors.Join(s.configErrs...))
+		}
+		s.render(w, p)
+
+	case path == "generate" && r.Method == "POST":
+		if s.loaded {
+			http.Error(w, "configuration already exists", http.StatusBadRequest)
+			return
+		}
+		s.serveGenerate(ctx, w, r)
+
+	case path == "install" && r.Method == "POST":
+		if err := installService(); err != nil {
+			s.serveDNS(ctx, w, r, err.Error(), "")
+		} else {
+			s.serveDNS(ctx, w, r, "", `Service file installed and enabled. Start mox with "systemctl start mox.service".`)
+		}
+
+	case path == "done" && r.Method == "POST":
+		s.finished = true
+		close(s.done)
+		fmt.Fprintln(w, "Setup is done, the setup web interface has stopped. You can close this window.")
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// System user name or uid, as passed to quickstart.
+var systemUserRegexp = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.-]*$`)
+
+// serveGenerate runs quickstart to generate the configuration files.
+func (s *setupServer) serveGenerate(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	email := strings.TrimSpace(r.FormValue("email"))
+	hostname := strings.TrimSpace(r.FormValue("hostname"))
+	user := strings.TrimSpace(r.FormValue("user"))
+
+	var errmsg string
+	if _, err := smtp.ParseAddress(email); err != nil {
+		errmsg = fmt.Sprintf("parsing email address: %v", err)
+	} else if _, err := dns.ParseDomain(hostname); hostname != "" && err != nil {
+		errmsg = fmt.Sprintf("parsing hostname: %v", err)
+	} else if user != "" && !systemUserRegexp.MatchString(user) {
+		errmsg = fmt.Sprintf("invalid system user %q, must be a user name or uid", user)
+	}
+
+	var output []byte
+	if errmsg == "" {
+		args := []string{"quickstart"}
+		if r.FormValue("existingwebserver") != "" {
+			args = append(args, "-existing-webserver")
+		}
+		if r.FormValue("skipdial") != "" {
+			args = append(args, "-skipdial")
+		}
+		// Only pass the hostname if it was changed from the detected name, quickstart
+		// configures the IPs of an explicitly specified hostname for the listeners.
+		if hostname != "" && hostname != r.FormValue("detectedhostname") {
+			args = append(args, "-hostname", hostname)
+		}
+		args = append(args, "--", email)
+		if user != "" {
+			args = append(args, user)
+		}
+
+		exe, err := os.Executable()
+		if err != nil {
+			exe = os.Args[0]
+		}
+		qctx, cancel := context.WithTimeout(ctx, 3*time.Minute)
+		defer cancel()
+		cmd := exec.CommandContext(qctx, exe, args...)
+		output, err = cmd.CombinedOutput()
+		if err != nil {
+			errmsg = fmt.Sprintf("quickstart failed: %v\n\n%s", err, output)
+		}
+	}
+	if errmsg != "" {
+		p := setupPage{
+			Step:              "detect",
+			Err:               errmsg,
+			Detect:            detect(ctx, hostname),
+			Email:             email,
+			User:              user,
+			ExistingWebserver: r.FormValue("existingwebserver") != "",
+			SkipDial:          r.FormValue("skipdial") != "",
+		}
+		s.render(w, p)
+		return
+	}
+
+	s.output = string(output)
+	s.loadConfig()
+	if len(s.configErrs) > 0 {
+		s.render(w, setupPage{Step: "dns", Output: s.output, Err: fmt.Sprintf("loading generated config: %v", errors.Join(s.configErrs...))})
+		return
+	}
+	http.Redirect(w, r, "/"+s.token+"/", http.StatusSeeOther)
+}
+
+// serveDNS shows the DNS records of the configured domains, and the result of
+// checks for the domain in query parameter "check".
+func (s *setupServer) serveDNS(ctx context.Context, w http.ResponseWriter, r *http.Request, errmsg, msg string) {
+	p := setupPage{
+		Step:   "dns",
+		Err:    errmsg,
+		Msg:    msg,
+		Output: s.output,
+		Linux:  runtime.GOOS == "linux" && os.Getenv("MOX_DOCKER") == "",
+	}
+	log := mlog.New("setup", nil)
+	check := r.FormValue("check")
+	for _, name := range mox.Conf.Domains() {
+		d := setupDomain{Name: name}
+		d.Records, _ = setupCall(func() []string { return webadmin.DomainRecords(ctx, log, name) })
+		if name == check {
+			d.Checked = true
+			result, err := setupCall(func() webadmin.CheckResult { return webadmin.Admin{}.CheckDomain(ctx, name) })
+			if err != nil {
+				d.Checks = []setupCheck{{"Check", webadmin.Result{Errors: []string{err.Error()}}}}
+			} else {
+				d.Checks = []setupCheck{
+					{"DNSSEC", result.DNSSEC.Result},
+					{"IPRev", result.IPRev.Result},
+					{"MX", result.MX.Result},
+					{"TLS", result.TLS.Result},
+					{"DANE", result.DANE.Result},
+					{"SPF", result.SPF.Result},
+					{"DKIM", result.DKIM.Result},
+					{"DMARC", result.DMARC.Result},
+					{"Host TLSRPT", result.HostTLSRPT.Result},
+					{"Domain TLSRPT", result.DomainTLSRPT.Result},
+					{"MTA-STS", result.MTASTS.Result},
+					{"SRV conf", result.SRVConf.Result},
+					{"Autoconf", result.Autoconf.Result},
+					{"Autodiscover", result.Autodiscover.Result},
+				}
+			}
+		}
+		p.Domains = append(p.Domains, d)
+	}
+	s.render(w, p)
+}
+
+// setupCall calls fn, returning a sherpa error it panics with as error.
+func setupCall[T any](fn func() T) (r T, rerr error) {
+	defer func() {
+		x := recover()
+		if x == nil {
+			return
+		}
+		if err, ok := x.(*sherpa.Error); ok {
+			rerr = err
+			return
+		}
+		panic(x)
+	}()
+	return fn(), nil
+}
+
+// installService installs mox.service, as written by quickstart, as systemd
+// service, and enables it.
+func installService() error {
+	if runtime.GOOS != "linux" {
+		return errors.New("installing service file only supported on linux")
+	}
+	buf, err := os.ReadFile("mox.service")
+	if err != nil {
+		return fmt.Errorf("reading mox.service: %v", err)
+	}
+	const path = "/etc/systemd/system/mox.service"
+	if err := os.WriteFile(path, buf, 0644); err != nil {
+		return fmt.Errorf("writing %s: %v (setup must run as root to install the service file)", path, err)
+	}
+	for _, args := range [][]string{{"daemon-reload"}, {"enable", "mox.service"}} {
+		if out, err := exec.Command("systemctl", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("systemctl %s: %v: %s", strings.Join(args, " "), err, bytes.TrimSpace(out))
+		}
+	}
+	return nil
+}
+
+func (s *setupServer) render(w http.ResponseWriter, p setupPage) {
+	h := w.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	var b bytes.Buffer
+	if err := setupTemplate.Execute(&b, struct {
+		Token string
+		setupPage
+	}{s.token, p}); err != nil {
+		http.Error(w, "500 - internal server error - executing template: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(b.Bytes())
+}
+
+var setupTemplate = htmltemplate.Must(htmltemplate.New("setup").Parse(`<!doctype html>
+<html>
+	<head>
+		<meta charset="utf-8" />
+		<meta name="viewport" content="width=device-width, initial-scale=1" />
+		<title>Mox setup</title>
+		<style>
+body, html { padding: 1em; font-size: 16px; }
+* { font-size: inherit; font-family: ubuntu, lato, sans-serif; margin: 0; padding: 0; box-sizing: border-box; }
+h1, h2 { margin-bottom: 1ex; }
+h1 { font-size: 1.2rem; }
+h2 { font-size: 1.1rem; margin-top: 2ex; }
+p { margin-bottom: 1ex; max-width: 50em; }
+pre { font-family: monospace; white-space: pre-wrap; background-color: #eee; padding: .5em; margin-bottom: 1ex; }
+table td, table th { padding: .2em .5em; vertical-align: top; text-align: left; }
+input[type=text] { width: 25em; padding: .2em; }
+button { padding: .2em .5em; }
+.error { background-color: #ffcfcf; padding: .5em; margin-bottom: 1ex; white-space: pre-wrap; }
+.warning { background-color: #ffca91; padding: 0 .2em; }
+.ok { background-color: #d2f791; padding: 0 .2em; }
+		</style>
+	</head>
+	<body>
+		<h1>Mox setup</h1>
+{{ if .Err }}<div class="error">{{ .Err }}</div>{{ end }}
+{{ if .Msg }}<p><span class="ok">{{ .Msg }}</span></p>{{ end }}
+{{ if eq .Step "detect" }}
+		<h2>Detected</h2>
+		<table>
+			<tr><th>Host name</th><td>{{ .Detect.Hostname }}</td></tr>
+			<tr><th>IPs of host name</th><td>{{ if .Detect.HostnameErr }}<span class="warning">{{ .Detect.HostnameErr }}</span>{{ else }}{{ range .Detect.HostnameIPs }}{{ . }} {{ end }}{{ end }}</td></tr>
+			<tr><th>Public IPs</th><td>{{ range .Detect.PublicIPs }}{{ . }} {{ else }}none{{ end }}</td></tr>
+			<tr><th>Private IPs</th><td>{{ range .Detect.PrivateIPs }}{{ . }} {{ else }}none{{ end }}</td></tr>
+			<tr><th>Loopback IPs</th><td>{{ range .Detect.LoopbackIPs }}{{ . }} {{ else }}none{{ end }}</td></tr>
+			{{ if .Detect.IPsErr }}<tr><th></th><td><span class="warning">{{ .Detect.IPsErr }}</span></td></tr>{{ end }}
+			<tr><th>DNSSEC-verifying resolver</th><td>{{ if .Detect.DNSSECErr }}<span class="warning">{{ .Detect.DNSSECErr }}</span>{{ else if .Detect.DNSSEC }}<span class="ok">yes</span>{{ else }}<span class="warning">no, install a DNSSEC-verifying resolver like unbound</span>{{ end }}</td></tr>
+			<tr><th>Webserver on port 80</th><td>{{ if .Detect.ExistingWebHTTP }}<span class="warning">yes, mox cannot use port 80 and 443 unless it is stopped</span>{{ else }}no{{ end }}</td></tr>
+		</table>
+		<p>If the host name is not correct, change it and detect again. The host name should be the fully qualified domain name mox will run on, e.g. mail.example.org.</p>
+		<form method="GET" action="/{{ .Token }}/">
+			<input type="text" name="hostname" value="{{ .Detect.Hostname }}" required />
+			<input type="hidden" name="email" value="{{ .Email }}" />
+			<button type="submit">Detect again</button>
+		</form>
+
+		<h2>Configuration</h2>
+		<form method="POST" action="/{{ .Token }}/generate">
+			<input type="hidden" name="hostname" value="{{ .Detect.Hostname }}" />
+			<input type="hidden" name="detectedhostname" value="{{ .Detect.Hostname }}" />
+			<table>
+				<tr><th>Email address</th><td><input type="text" name="email" value="{{ .Email }}" placeholder="you@example.org" required /><br/>The domain of the address is added, and an account named after the localpart is created.</td></tr>
+				<tr><th>System user</th><td><input type="text" name="user" value="{{ .User }}" /><br/>User or uid mox runs as after initialization.</td></tr>
+				<tr><th>TLS</th><td>
+					<label><input type="radio" name="existingwebserver" value="" {{ if not .ExistingWebserver }}checked{{ end }} /> Mox listens on port 80 and 443, with TLS certificates through ACME from Let's Encrypt (recommended).</label><br/>
+					<label><input type="radio" name="existingwebserver" value="yes" {{ if .ExistingWebserver }}checked{{ end }} /> Use an existing webserver as reverse proxy. You will have to configure TLS certificates.</label>
+				</td></tr>
+				<tr><th>Checks</th><td><label><input type="checkbox" name="skipdial" value="yes" {{ if .SkipDial }}checked{{ end }} /> Skip check for outgoing SMTP connectivity and domain age.</label></td></tr>
+			</table>
+			<p><button type="submit">Generate configuration</button></p>
+			<p>Configuration files are written to config/mox.conf and config/domains.conf in the current directory, the account data to data/.</p>
+		</form>
+{{ else }}
+	{{ if .Output }}
+		<h2>Output of quickstart</h2>
+		<p>Save the passwords below, they are not shown again. The output is also written to quickstart.log.</p>
+		<pre>{{ .Output }}</pre>
+	{{ end }}
+	{{ range .Domains }}
+		<h2>DNS records for {{ .Name }}</h2>
+		<pre>{{ range .Records }}{{ . }}
+{{ end }}</pre>
+		<form method="GET" action="/{{ $.Token }}/">
+			<input type="hidden" name="check" value="{{ .Name }}" />
+			<button type="submit">{{ if .Checked }}Check DNS records again{{ else }}Check DNS records{{ end }}</button>
+		</form>
+		{{ if .Checked }}
+		<table>
+			{{ range .Checks }}
+			<tr>
+				<th>{{ .Name }}</th>
+				<td>
+					{{ if and (not .Errors) (not .Warnings) }}<span class="ok">OK</span>{{ end }}
+					{{ range .Errors }}<div class="error">{{ . }}</div>{{ end }}
+					{{ range .Warnings }}<div><span class="warning">{{ . }}</span></div>{{ end }}
+					{{ range .Instructions }}<pre>{{ . }}</pre>{{ end }}
+				</td>
+			</tr>
+			{{ end }}
+		</table>
+		{{ end }}
+	{{ end }}
+	{{ if .Linux }}
+		<h2>Service</h2>
+		<p>Install mox.service as systemd service and enable it. Setup must run as root for this.</p>
+		<form method="POST" action="/{{ .Token }}/install"><button type="submit">Install service file</button></form>
+	{{ end }}
+		<h2>Done</h2>
+		<form method="POST" action="/{{ .Token }}/done"><button type="submit">Stop setup</button></form>
+{{ end }}
+	</body>
+</html>
+`))
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSetupServer(t *testing.T) {
+	s := &setupServer{token: "secret", done: make(chan struct{}), loaded: true}
+
+	test := func(method, path string, expCode int, expBody string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		if w.Code != expCode {
+			t.Fatalf("%s %s: got status %d, expected %d", method, path, w.Code, expCode)
+		}
+		if !strings.Contains(w.Body.String(), expBody) {
+			t.Fatalf("%s %s: body does not contain %q:\n%s", method, path, expBody, w.Body.String())
+		}
+	}
+
+	// Token is required.
+	test("GET", "/", http.StatusNotFound, "")
+	test("GET", "/bogus/", http.StatusNotFound, "")
+	test("GET", "/secre/", http.StatusNotFound, "")
+
+	// With configuration loaded, DNS records are shown.
+	test("GET", "/secret/", http.StatusOK, "Stop setup")
+	test("GET", "/secret/unknown", http.StatusNotFound, "")
+	test("POST", "/secret/generate", http.StatusBadRequest, "configuration already exists")
+
+	test("POST", "/secret/done", http.StatusOK, "Setup is done")
+	select {
+	case <-s.done:
+	default:
+		t.Fatalf("setup not done")
+	}
+	test("GET", "/secret/", http.StatusGone, "")
+}
@@ -2,20 +2,29 @@ package smtpserver
 
 import (
 	"context"
+	"log/slog"
 
 	"github.com/mjl-/mox/dkim"
+	"github.com/mjl-/mox/dmarc"
 	"github.com/mjl-/mox/dns"
 	"github.com/mjl-/mox/mlog"
-	"github.com/mjl-/mox/publicsuffix"
 	"github.com/mjl-/mox/spf"
 	"github.com/mjl-/mox/store"
 )
 
 // Alignment compares the msgFromDomain with the dkim and spf results, and returns
-// a validation, one of: Strict, Relaxed, None.
-func alignment(ctx context.Context, log mlog.Log, msgFromDomain dns.Domain, dkimResults []dkim.Result, spfStatus spf.Status, spfIdentity *dns.Domain) store.Validation {
+// a validation, one of: Strict, Relaxed, None. Organizational domains for relaxed
+// alignment are found through the public suffix list, or a DNS tree walk for
+// DMARCbis.
+func alignment(ctx context.Context, log mlog.Log, resolver dns.Resolver, msgFromDomain dns.Domain, dkimResults []dkim.Result, spfStatus spf.Status, spfIdentity *dns.Domain, discovery dmarc.Discovery) store.Validation {
 	var strict, relaxed bool
-	msgFromOrgDomain := publicsuffix.Lookup(ctx, log.Logger, msgFromDomain)
+
+	orgDomain := func(d dns.Domain) dns.Domain {
+		od, err := dmarc.OrganizationalDomain(ctx, log.Logger, resolver, d, discovery)
+		log.Check(err, "looking up organizational domain for alignment", slog.Any("domain", d))
+		return od
+	}
+	msgFromOrgDomain := orgDomain(msgFromDomain)
 
 	// todo: should take temperror and permerror into account.
 	for _, dr := range dkimResults {
@@ -26,12 +35,12 @@ func alignment(ctx context.Context, log mlog.Log, msgFromDomain dns.Domain, dkim
 			strict = true
 			break
 		} else {
-			relaxed = relaxed || msgFromOrgDomain == publicsuffix.Lookup(ctx, log.Logger, dr.Sig.Domain)
+			relaxed = relaxed || msgFromOrgDomain == orgDomain(dr.Sig.Domain)
 		}
 	}
 	if !strict && spfStatus == spf.StatusPass {
 		strict = msgFromDomain == *spfIdentity
-		relaxed = relaxed || msgFromOrgDomain == publicsuffix.Lookup(ctx, log.Logger, *spfIdentity)
+		relaxed = relaxed || msgFromOrgDomain == orgDomain(*spfIdentity)
 	}
 	if strict {
 		return store.ValidationStrict
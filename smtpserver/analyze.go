@@ -11,7 +11,9 @@ import (
 
 	"github.com/mjl-/bstore"
 
+	"github.com/mjl-/mox/attachpolicy"
 	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/contentscan"
 	"github.com/mjl-/mox/dkim"
 	"github.com/mjl-/mox/dmarc"
 	"github.com/mjl-/mox/dmarcrpt"
@@ -41,10 +43,16 @@ type delivery struct {
 	msgCc            []message.Address
 	msgFrom          smtp.Address
 	dnsBLs           []dns.Domain
+	localLists       []localList
+	uribl            uriblConfig
+	linkDomains      func() []dns.Domain // Domains of links in the message, for URIBL checks.
 	dmarcUse         bool
 	dmarcResult      dmarc.Result
 	dkimResults      []dkim.Result
 	iprevStatus      iprev.Status
+	authResults      string // Authentication-Results header, prepended to message for junk filter classification with features.
+	contentScan      contentscan.Result
+	attachments      attachpolicy.Verdict // Result of attachment rules. If action is strip, dataFile is already stripped.
 	smtputf8         bool
 }
 
@@ -80,6 +88,12 @@ const (
 	reasonJunkContent       = "junk-content"
 	reasonJunkContentStrict = "junk-content-strict"
 	reasonDNSBlocklisted    = "dns-blocklisted"
+	reasonLocalAllowlist    = "local-allowlist"
+	reasonLocalBlocklist    = "local-blocklist"
+	reasonURIBlocklisted    = "uri-blocklisted"
+	reasonContentInfected   = "content-infected"
+	reasonAttachReject      = "attachment-reject" // Not added to rejects.
+	reasonAttachQuarantine  = "attachment-quarantine"
 	reasonSubjectpass       = "subjectpass"
 	reasonSubjectpassError  = "subjectpass-error"
 	reasonIPrev             = "iprev"     // No or mild junk reputation signals, and bad iprev.
@@ -204,6 +218,24 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 	if rs != nil {
 		mailbox = rs.Mailbox
 	}
+
+	// Infected messages only get here with quarantine enabled. They are rejected
+	// regardless of rulesets, and stored in the Rejects mailbox.
+	if d.contentScan.Status == contentscan.StatusInfected {
+		addReasonText("message contains virus or malware %q", d.contentScan.Threat)
+		return analysis{d, false, mailbox, smtp.C554TransactionFailed, smtp.SePol7Other0, true, fmt.Sprintf("message contains virus or malware %q", d.contentScan.Threat), nil, nil, nil, reasonContentInfected, reasonText, "", headers}
+	}
+	// Messages with attachments not allowed by policy are rejected regardless of
+	// rulesets. With quarantine, the message is stored in the Rejects mailbox.
+	switch d.attachments.Action {
+	case attachpolicy.ActionReject, attachpolicy.ActionQuarantine:
+		reason := reasonAttachReject
+		if d.attachments.Action == attachpolicy.ActionQuarantine {
+			reason = reasonAttachQuarantine
+		}
+		addReasonText("%s", d.attachments.Reason())
+		return analysis{d, false, mailbox, smtp.C554TransactionFailed, smtp.SePol7DeliveryUnauth1, true, "message rejected: " + d.attachments.Reason(), nil, nil, nil, reason, reasonText, "", headers}
+	}
 	if rs != nil && !rs.ListAllowDNSDomain.IsZero() {
 		// todo: on temporary failures, reject temporarily?
 		if isListDomain(d, rs.ListAllowDNSDomain) {
@@ -410,6 +442,23 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 		return reject(code, smtp.SePol7MultiAuthFails26, msg, nil, reasonMsgAuthRequired)
 	}
 
+	// Messages from an IP or verified domain in a local allowlist are accepted without
+	// looking at reputation, DNSBLs or junk filter.
+	if listed, text := localListed(log, d, true); listed {
+		addReasonText("local allowlist: %s", text)
+		return analysis{
+			d:                   d,
+			accept:              true,
+			mailbox:             mailbox,
+			dmarcReport:         dmarcReport,
+			tlsReport:           tlsReport,
+			reason:              reasonLocalAllowlist,
+			reasonText:          reasonText,
+			dmarcOverrideReason: dmarcOverrideReason,
+			headers:             headers,
+		}
+	}
+
 	// Determine if message is acceptable based on DMARC domain, DKIM identities, or
 	// host-based reputation.
 	var isjunk *bool
@@ -533,6 +582,23 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 		}
 	}
 
+	// Check the domains of links in the message against URIBLs. A listing makes the
+	// junk filter stricter, or is a reason to reject.
+	var uriblisted bool
+	if len(d.uribl.zones) > 0 {
+		var text string
+		uriblisted, text = uriblListed(ctx, log, resolver, d)
+		if uriblisted && d.uribl.reject {
+			log.Info("rejecting due to link to domain in uribl", slog.String("listing", text))
+			addReasonText("uribl: %s", text)
+			return reject(smtp.C451LocalErr, smtp.SeSys3Other0, "error processing", nil, reasonURIBlocklisted)
+		} else if uriblisted {
+			addReasonText("uribl: %s", text)
+		} else {
+			addReasonText("no link domains blocklisted")
+		}
+	}
+
 	reason = reasonNoBadSignals
 	accept := true
 	var junkSubjectpass bool
@@ -542,7 +608,16 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 			err := f.Close()
 			log.Check(err, "closing junkfilter")
 		}()
-		result, err := f.ClassifyMessageReader(ctx, store.FileMsgReader(d.m.MsgPrefix, d.dataFile), d.m.Size)
+		// With features, the message is classified with our Authentication-Results
+		// header, like the message will be stored and later trained. Without features,
+		// classification is as before features existed, so token counts of existing
+		// junk filters stay consistent.
+		prefix, size := d.m.MsgPrefix, d.m.Size
+		if jf.Features {
+			prefix = append([]byte(d.authResults), d.m.MsgPrefix...)
+			size += int64(len(d.authResults))
+		}
+		result, err := f.ClassifyMessageReader(ctx, store.FileMsgReader(prefix, d.dataFile), size)
 		if err != nil {
 			log.Errorx("testing for spam", err)
 			addReasonText("classify message error: %v", err)
@@ -581,7 +656,12 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 		// With an iprev fail, non-TLS connection or our address not in To/Cc header, we set a higher bar for content.
 		reason = reasonJunkContent
 		var thresholdRemark string
-		if suspiciousIPrevFail && threshold > 0.25 {
+		if uriblisted && threshold > 0.25 {
+			threshold = 0.25
+			log.Info("setting junk threshold due to link to domain in uribl", slog.Float64("threshold", threshold))
+			reason = reasonJunkContentStrict
+			thresholdRemark = " (stricter due to link to domain in uribl)"
+		} else if suspiciousIPrevFail && threshold > 0.25 {
 			threshold = 0.25
 			log.Info("setting junk threshold due to iprev fail", slog.Float64("threshold", threshold))
 			reason = reasonJunkContentStrict
@@ -601,7 +681,7 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 			reason = reasonJunkContentStrict
 			thresholdRemark = " (stricter due to recipient address not in to/cc header)"
 		}
-		accept = result.Probability <= threshold || (!result.Significant && !suspiciousIPrevFail)
+		accept = result.Probability <= threshold || (!result.Significant && !suspiciousIPrevFail && !uriblisted)
 		junkSubjectpass = result.Probability < threshold-0.2
 		log.Info("content analyzed",
 			slog.Bool("accept", accept),
@@ -654,6 +734,14 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 	// If content looks good, we'll still look at DNS block lists for a reason to
 	// reject. We normally won't get here if we've communicated with this sender
 	// before.
+	if accept {
+		if listed, text := localListed(log, d, false); listed {
+			log.Info("rejecting due to listing in local blocklist", slog.String("listing", text))
+			accept = false
+			reason = reasonLocalBlocklist
+			addReasonText("local blocklist: %s", text)
+		}
+	}
 	var dnsblocklisted bool
 	if accept {
 		blocked := func(zone dns.Domain) bool {
@@ -0,0 +1,45 @@
+package smtpserver
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/mjl-/mox/attachpolicy"
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/store"
+)
+
+// attachmentRules returns the attachment rules of the account and domain
+// combined. For incoming deliveries, domain is the recipient domain, for
+// submissions the domain of the message From address.
+func attachmentRules(accConf config.Account, domain dns.Domain) []config.AttachmentRule {
+	rules := accConf.AttachmentRules
+	if dc, ok := mox.Conf.Domain(domain); ok && len(dc.AttachmentRules) > 0 {
+		rules = append(slices.Clone(rules), dc.AttachmentRules...)
+	}
+	return rules
+}
+
+// stripAttachments writes the message in dataFile with the attachments of the
+// verdict replaced by a notice to a new temporary file. The caller must close
+// and remove the returned file.
+func stripAttachments(log mlog.Log, dataFile *os.File, size int64, v attachpolicy.Verdict) (rf *os.File, rsize int64, rerr error) {
+	f, err := store.CreateMessageTemp(log, "smtp-stripped")
+	if err != nil {
+		return nil, 0, fmt.Errorf("creating temporary file: %w", err)
+	}
+	defer func() {
+		if rerr != nil {
+			store.CloseRemoveTempFile(log, f, "message with stripped attachments after error")
+		}
+	}()
+	n, err := attachpolicy.Strip(f, dataFile, size, v)
+	if err != nil {
+		return nil, 0, err
+	}
+	return f, n, nil
+}
@@ -0,0 +1,44 @@
+package smtpserver
+
+import (
+	"context"
+	"log/slog"
+	"net/textproto"
+	"slices"
+	"strings"
+
+	"github.com/mjl-/mox/bimi"
+	"github.com/mjl-/mox/dkim"
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/publicsuffix"
+)
+
+// bimiSelector returns the BIMI selector to use for a message. A BIMI-Selector
+// header is only used if it was signed by a passing DKIM signature aligned with
+// the From domain, otherwise the default selector is returned.
+func bimiSelector(ctx context.Context, log mlog.Log, msgFromDomain dns.Domain, headers textproto.MIMEHeader, dkimResults []dkim.Result) string {
+	v := headers.Get("BIMI-Selector")
+	if v == "" {
+		return bimi.DefaultSelector
+	}
+	fromOrgDomain := publicsuffix.Lookup(ctx, log.Logger, msgFromDomain)
+	signed := slices.ContainsFunc(dkimResults, func(r dkim.Result) bool {
+		if r.Status != dkim.StatusPass || r.Sig == nil || publicsuffix.Lookup(ctx, log.Logger, r.Sig.Domain) != fromOrgDomain {
+			return false
+		}
+		return slices.ContainsFunc(r.Sig.SignedHeaders, func(h string) bool {
+			return strings.EqualFold(h, "BIMI-Selector")
+		})
+	})
+	if !signed {
+		log.Debug("ignoring bimi-selector header not signed with aligned dkim signature")
+		return bimi.DefaultSelector
+	}
+	selector, err := bimi.ParseSelectorHeader(v)
+	if err != nil {
+		log.Debugx("parsing bimi-selector header, using default selector", err, slog.String("header", v))
+		return bimi.DefaultSelector
+	}
+	return selector
+}
@@ -0,0 +1,71 @@
+package smtpserver
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/mjl-/mox/contentscan"
+	"github.com/mjl-/mox/message"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/smtp"
+)
+
+// contentScan scans the message in dataFile with the configured content scanner,
+// for incoming deliveries and submissions. It returns the result, and a header to
+// add to the message. If no content scanner is configured, a zero result and an
+// empty header are returned. If the message is too large for scanning, or scanning
+// fails, and the scanner is configured to fail open, a zero result and an empty
+// header are returned as well. If the scanner fails closed, a message that is too
+// large is rejected with a permanent error, and a failed scan results in a
+// temporary error to the SMTP client.
+func (c *conn) xcontentScan(ctx context.Context, dataFile *os.File, size int64) (contentscan.Result, string) {
+	cs := mox.Conf.Static.ContentScanner
+	if cs == nil {
+		return contentscan.Result{}, ""
+	}
+	if size > cs.MaxSize {
+		if cs.FailOpen {
+			c.log.Info("message too large for content scan, accepting message due to fail-open", slog.Int64("size", size), slog.Int64("maxsize", cs.MaxSize))
+			return contentscan.Result{}, ""
+		}
+		// Retrying won't make the message smaller, so the error is permanent.
+		c.log.Info("message too large for content scan, rejecting", slog.Int64("size", size), slog.Int64("maxsize", cs.MaxSize))
+		xsmtpUserErrorf(smtp.C552MailboxFull, smtp.SeSys3MsgLimitExceeded4, "message too large for content scan")
+	}
+
+	result, err := contentscan.Scan(ctx, c.log.Logger, cs.Protocol, cs.Address, cs.Timeout, io.NewSectionReader(dataFile, 0, size))
+	if err != nil {
+		metricServerErrors.WithLabelValues("contentscan").Inc()
+		if cs.FailOpen {
+			c.log.Errorx("scanning message content, accepting message due to fail-open", err)
+			return contentscan.Result{}, ""
+		}
+		c.log.Errorx("scanning message content", err)
+		xsmtpServerErrorf(codes{smtp.C451LocalErr, smtp.SeSys3Other0}, "error scanning message content, try again later")
+	}
+	c.log.Debug("content scanned", slog.Any("status", result.Status), slog.String("threat", result.Threat))
+	return result, contentScanHeader(cs.Protocol, result)
+}
+
+// contentScanHeader returns an X-Mox-Content-Scan header for the result, in a
+// syntax similar to Authentication-Results, e.g.:
+//
+//	X-Mox-Content-Scan: mail.example; clamd=infected reason="Eicar-Signature"
+func contentScanHeader(protocol string, result contentscan.Result) string {
+	hw := &message.HeaderWriter{}
+	hw.Add("", "X-Mox-Content-Scan: "+mox.Conf.Static.HostnameDomain.ASCII+";")
+	hw.Add(" ", protocol+"="+string(result.Status))
+	if result.Threat != "" {
+		threat := strings.Map(func(c rune) rune {
+			if c < ' ' || c == 0x7f || c == '"' || c == '\\' {
+				return ' '
+			}
+			return c
+		}, result.Threat)
+		hw.Add(" ", `reason="`+threat+`"`)
+	}
+	return hw.String()
+}
@@ -0,0 +1,62 @@
+package smtpserver
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/mjl-/mox/greylist"
+	"github.com/mjl-/mox/smtp"
+)
+
+// xgreylist checks whether the message transaction must be greylisted, and
+// aborts the transaction with a temporary error if so.
+//
+// Only recipients for which the message would be accepted without reputation
+// (no bad signals, but also no known sender) are subject to greylisting. Messages
+// from senders with a good reputation at the account, and messages that would be
+// rejected anyway, are not greylisted. If any recipient requires greylisting, the
+// whole transaction is greylisted, and nothing is delivered.
+func (c *conn) xgreylist(ctx context.Context, analyses []*rcptAnalysis, spfPass bool, verifiedDKIMDomains []string) {
+	var rcpts []string
+	for _, ra := range analyses {
+		a0 := ra.a0
+		if !a0.accept || a0.reason != reasonNoBadSignals || a0.d.m.IsForward || a0.d.m.IsMailingList || a0.dmarcReport != nil || a0.tlsReport != nil {
+			continue
+		}
+		rcpts = append(rcpts, ra.rcpt.Addr.String())
+	}
+	if len(rcpts) == 0 {
+		return
+	}
+
+	// Large senders retry from different IPs. If the IP is authorized through SPF for
+	// the MAIL FROM domain, we group by that domain instead of by IP network.
+	group := greylist.IPGroup(c.remoteIP)
+	verifiedDomains := verifiedDKIMDomains
+	if spfPass && !c.mailFrom.IsZero() && !c.mailFrom.IPDomain.Domain.IsZero() {
+		group = greylist.SPFGroup(c.mailFrom.IPDomain.Domain)
+		verifiedDomains = append([]string{c.mailFrom.IPDomain.Domain.Name()}, verifiedDomains...)
+	}
+
+	var mailFrom string
+	if !c.mailFrom.IsZero() {
+		mailFrom = c.mailFrom.String()
+	}
+
+	p := greylist.Params{
+		Delay:         c.greylisting.Delay,
+		RetryWindow:   c.greylisting.RetryWindow,
+		AllowDuration: c.greylisting.AllowDuration,
+	}
+	greylisted, result, err := greylist.Check(ctx, c.log, p, group, mailFrom, rcpts, verifiedDomains)
+	if err != nil {
+		// We don't want to lose messages due to a database error, we deliver.
+		c.log.Errorx("checking greylisting, not greylisting", err)
+		return
+	}
+	c.log.Debug("greylisting checked", slog.String("group", group), slog.Bool("greylisted", greylisted), slog.String("result", result))
+	if greylisted {
+		c.log.Info("greylisting message transaction", slog.String("group", group), slog.String("result", result), slog.Any("mailfrom", c.mailFrom))
+		xsmtpUserErrorf(smtp.C451LocalErr, smtp.SePol7DeliveryUnauth1, "greylisted, please try again later")
+	}
+}
@@ -0,0 +1,68 @@
+package smtpserver
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/locallist"
+	"github.com/mjl-/mox/mlog"
+)
+
+// localList is a local IP and domain list, used as block or allow list for
+// incoming deliveries.
+type localList struct {
+	file  string // As configured, for reason texts.
+	list  *locallist.List
+	allow bool
+}
+
+// localListed returns whether the remote IP or a domain of the message is
+// listed in one of the local allow or block lists, and a description of the match
+// for the reason text.
+//
+// For allowlists, only verified domains are looked up. For blocklists, all
+// domains are looked up, also unverified: a sender claiming a blocked domain
+// doesn't get a pass.
+func localListed(log mlog.Log, d delivery, allow bool) (bool, string) {
+	var domains []string
+	if allow {
+		if d.m.EHLOValidated {
+			domains = append(domains, d.m.EHLODomain)
+		}
+		if d.m.MailFromValidated {
+			domains = append(domains, d.m.MailFromDomain)
+		}
+		if d.m.MsgFromValidated {
+			domains = append(domains, d.m.MsgFromDomain)
+		}
+	} else {
+		domains = append(domains, d.m.EHLODomain, d.m.MailFromDomain, d.m.MsgFromDomain)
+	}
+	domains = append(domains, d.m.DKIMDomains...)
+
+	ip := net.ParseIP(d.m.RemoteIP)
+	for _, ll := range d.localLists {
+		if ll.allow != allow {
+			continue
+		}
+		if ip != nil {
+			if listed, text := ll.list.LookupIP(log, ip); listed {
+				return true, fmt.Sprintf("ip %s listed in %s (%s)", ip, ll.file, text)
+			}
+		}
+		for _, s := range domains {
+			if s == "" {
+				continue
+			}
+			dom, err := dns.ParseDomain(s)
+			if err != nil {
+				continue
+			}
+			if listed, text := ll.list.LookupDomain(log, dom); listed {
+				return true, fmt.Sprintf("domain %s listed in %s (%s)", dom, ll.file, text)
+			}
+		}
+	}
+	return false, ""
+}
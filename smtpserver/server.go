@@ -20,7 +20,6 @@ import (
 	"io"
 	"log/slog"
 	"maps"
-	"math"
 	"net"
 	"net/textproto"
 	"os"
@@ -39,7 +38,10 @@ import (
 
 	"github.com/mjl-/bstore"
 
+	"github.com/mjl-/mox/attachpolicy"
+	"github.com/mjl-/mox/bimi"
 	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/contentscan"
 	"github.com/mjl-/mox/dkim"
 	"github.com/mjl-/mox/dmarc"
 	"github.com/mjl-/mox/dmarcdb"
@@ -47,6 +49,7 @@ import (
 	"github.com/mjl-/mox/dns"
 	"github.com/mjl-/mox/dsn"
 	"github.com/mjl-/mox/iprev"
+	"github.com/mjl-/mox/locallist"
 	"github.com/mjl-/mox/message"
 	"github.com/mjl-/mox/metrics"
 	"github.com/mjl-/mox/mlog"
@@ -71,7 +74,22 @@ var errIO = errors.New("io error")
 // delivered to the account named mox.
 var Localserve bool
 
+// Default limiters, for SMTP and for submission on listeners without configured
+// limits.
 var limiterConnectionRate, limiterConnections *ratelimit.Limiter
+var limiterSubmissionConnectionRate, limiterSubmissionConnections *ratelimit.Limiter
+
+// Limiters for listeners with configured limits, for SMTP and submission.
+var listenerLimiters = map[listenerProtocol]connLimiters{}
+
+type listenerProtocol struct {
+	listenerName string
+	submission   bool
+}
+
+type connLimiters struct {
+	rate, open *ratelimit.Limiter
+}
 
 // For delivery rate limiting. Variable because changed during tests.
 var limitIPMasked1MessagesPerMinute int = 500
@@ -88,23 +106,62 @@ func init() {
 
 func limitersInit() {
 	mox.LimitersInit()
-	// todo future: make these configurable
-	limiterConnectionRate = &ratelimit.Limiter{
-		WindowLimits: []ratelimit.WindowLimit{
-			{
-				Window: time.Minute,
-				Limits: [...]int64{300, 900, 2700},
-			},
+	limiterConnectionRate = mox.NewLimiter(nil, []ratelimit.WindowLimit{
+		{
+			Window: time.Minute,
+			Limits: [...]int64{300, 900, 2700},
 		},
-	}
-	limiterConnections = &ratelimit.Limiter{
-		WindowLimits: []ratelimit.WindowLimit{
-			{
-				Window: time.Duration(math.MaxInt64), // All of time.
-				Limits: [...]int64{30, 90, 270},
-			},
+	})
+	limiterConnections = mox.NewOpenLimiter(nil, [...]int64{30, 90, 270})
+	mox.RegisterLimiter("smtp-connectionrate", limiterConnectionRate, true)
+	mox.RegisterOpenLimiter("smtp-connections", limiterConnections)
+	limiterSubmissionConnectionRate = mox.NewLimiter(nil, []ratelimit.WindowLimit{
+		{
+			Window: time.Minute,
+			Limits: [...]int64{300, 900, 2700},
 		},
+	})
+	limiterSubmissionConnections = mox.NewOpenLimiter(nil, [...]int64{30, 90, 270})
+	mox.RegisterLimiter("submission-connectionrate", limiterSubmissionConnectionRate, true)
+	mox.RegisterOpenLimiter("submission-connections", limiterSubmissionConnections)
+	listenerLimiters = map[listenerProtocol]connLimiters{}
+}
+
+// listenerLimitersInit initializes limiters for SMTP or submission on a listener
+// with configured limits.
+func listenerLimitersInit(listenerName string, submission bool, cl *config.ConnectionLimits) {
+	if cl == nil {
+		return
+	}
+	protocol := "smtp"
+	if submission {
+		protocol = "submission"
+	}
+	ll := connLimiters{limiterConnectionRate, limiterConnections}
+	if submission {
+		ll = connLimiters{limiterSubmissionConnectionRate, limiterSubmissionConnections}
 	}
+	if len(cl.Rate) > 0 {
+		ll.rate = mox.NewLimiter(cl.Rate, nil)
+		mox.RegisterLimiter(protocol+"-connectionrate-"+listenerName, ll.rate, true)
+	}
+	if cl.Open != nil {
+		ll.open = mox.NewOpenLimiter(cl.Open, [3]int64{})
+		mox.RegisterOpenLimiter(protocol+"-connections-"+listenerName, ll.open)
+	}
+	listenerLimiters[listenerProtocol{listenerName, submission}] = ll
+}
+
+// limiters returns the limiters on connection rate and open connections for SMTP
+// or submission on a listener.
+func limiters(listenerName string, submission bool) (rate, open *ratelimit.Limiter) {
+	if ll, ok := listenerLimiters[listenerProtocol{listenerName, submission}]; ok {
+		return ll.rate, ll.open
+	}
+	if submission {
+		return limiterSubmissionConnectionRate, limiterSubmissionConnections
+	}
+	return limiterConnectionRate, limiterConnections
 }
 
 var (
@@ -157,7 +214,7 @@ var (
 	metricSubmission = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "mox_smtpserver_submission_total",
-			Help: "SMTP server incoming submission results, known values (those ending with error are server errors): ok, badmessage, badfrom, badheader, messagelimiterror, recipientlimiterror, localserveerror, queueerror.",
+			Help: "SMTP server incoming submission results, known values (those ending with error are server errors): ok, badmessage, badfrom, badheader, infected, attachment, messagelimiterror, recipientlimiterror, sendlimiterror, localserveerror, queueerror.",
 		},
 		[]string{
 			"result",
@@ -201,9 +258,14 @@ func durationDefault(delay *time.Duration, def time.Duration) time.Duration {
 // Listen initializes network listeners for incoming SMTP connection.
 // The listeners are stored for a later call to Serve.
 func Listen() {
+	// Limiters with the loaded config.
+	limitersInit()
+
 	names := slices.Sorted(maps.Keys(mox.Conf.Static.Listeners))
 	for _, name := range names {
 		listener := mox.Conf.Static.Listeners[name]
+		listenerLimitersInit(name, false, listener.RateLimits.SMTP)
+		listenerLimitersInit(name, true, listener.RateLimits.Submission)
 
 		var tlsConfig, tlsConfigDelivery *tls.Config
 		var noTLSClientAuth bool
@@ -226,6 +288,15 @@ func Listen() {
 			if listener.Hostname != "" {
 				hostname = listener.HostnameDomain
 			}
+			var localLists []localList
+			for _, ll := range listener.SMTP.LocalLists {
+				l, err := locallist.Load(ll.Path)
+				if err != nil {
+					mlog.New("smtpserver", nil).Fatalx("loading local list", err, slog.String("listener", name), slog.String("path", ll.Path))
+				}
+				localLists = append(localLists, localList{ll.File, l, ll.Allow})
+			}
+			uribl := uriblConfig{listener.SMTP.URIBLZones, listener.SMTP.URIBLReject, listener.SMTP.URIBLMaxLookups}
 			port := config.Port(listener.SMTP.Port, 25)
 			for _, ip := range listener.IPs {
 				firstTimeSenderDelay := durationDefault(listener.SMTP.FirstTimeSenderDelay, firstTimeSenderDelayDefault)
@@ -236,7 +307,7 @@ func Listen() {
 					// https://github.com/golang/go/issues/70232.
 					tlsConfigDelivery.SessionTicketsDisabled = listener.SMTP.TLSSessionTicketsDisabled == nil || *listener.SMTP.TLSSessionTicketsDisabled
 				}
-				listen1("smtp", name, ip, port, hostname, tlsConfigDelivery, false, false, noTLSClientAuth, maxMsgSize, false, listener.SMTP.RequireSTARTTLS, !listener.SMTP.NoRequireTLS, listener.SMTP.DNSBLZones, firstTimeSenderDelay)
+				listen1("smtp", name, ip, port, hostname, tlsConfigDelivery, false, false, noTLSClientAuth, maxMsgSize, false, listener.SMTP.RequireSTARTTLS, !listener.SMTP.NoRequireTLS, listener.SMTP.DNSBLZones, localLists, uribl, firstTimeSenderDelay, listener.SMTP.Greylisting)
 			}
 		}
 		if listener.Submission.Enabled {
@@ -246,7 +317,7 @@ func Listen() {
 			}
 			port := config.Port(listener.Submission.Port, 587)
 			for _, ip := range listener.IPs {
-				listen1("submission", name, ip, port, hostname, tlsConfig, true, false, noTLSClientAuth, maxMsgSize, !listener.Submission.NoRequireSTARTTLS, !listener.Submission.NoRequireSTARTTLS, true, nil, 0)
+				listen1("submission", name, ip, port, hostname, tlsConfig, true, false, noTLSClientAuth, maxMsgSize, !listener.Submission.NoRequireSTARTTLS, !listener.Submission.NoRequireSTARTTLS, true, nil, nil, uriblConfig{}, 0, nil)
 			}
 		}
 
@@ -257,7 +328,7 @@ func Listen() {
 			}
 			port := config.Port(listener.Submissions.Port, 465)
 			for _, ip := range listener.IPs {
-				listen1("submissions", name, ip, port, hostname, tlsConfig, true, true, noTLSClientAuth, maxMsgSize, true, true, true, nil, 0)
+				listen1("submissions", name, ip, port, hostname, tlsConfig, true, true, noTLSClientAuth, maxMsgSize, true, true, true, nil, nil, uriblConfig{}, 0, nil)
 			}
 		}
 	}
@@ -265,7 +336,7 @@ func Listen() {
 
 var servers []func()
 
-func listen1(protocol, name, ip string, port int, hostname dns.Domain, tlsConfig *tls.Config, submission, xtls, noTLSClientAuth bool, maxMessageSize int64, requireTLSForAuth, requireTLSForDelivery, requireTLS bool, dnsBLs []dns.Domain, firstTimeSenderDelay time.Duration) {
+func listen1(protocol, name, ip string, port int, hostname dns.Domain, tlsConfig *tls.Config, submission, xtls, noTLSClientAuth bool, maxMessageSize int64, requireTLSForAuth, requireTLSForDelivery, requireTLS bool, dnsBLs []dns.Domain, localLists []localList, uribl uriblConfig, firstTimeSenderDelay time.Duration, greylisting *config.Greylisting) {
 	log := mlog.New("smtpserver", nil)
 	addr := net.JoinHostPort(ip, fmt.Sprintf("%d", port))
 	if os.Getuid() == 0 {
@@ -299,7 +370,7 @@ func listen1(protocol, name, ip string, port int, hostname dns.Domain, tlsConfig
 
 			// Package is set on the resolver by the dkim/spf/dmarc/etc packages.
 			resolver := dns.StrictResolver{Log: log.Logger}
-			go serve(name, mox.Cid(), hostname, tlsConfig, conn, resolver, submission, xtls, false, noTLSClientAuth, maxMessageSize, requireTLSForAuth, requireTLSForDelivery, requireTLS, dnsBLs, firstTimeSenderDelay)
+			go serve(name, mox.Cid(), hostname, tlsConfig, conn, resolver, submission, xtls, false, noTLSClientAuth, maxMessageSize, requireTLSForAuth, requireTLSForDelivery, requireTLS, dnsBLs, localLists, uribl, firstTimeSenderDelay, greylisting)
 		}
 	}
 
@@ -349,7 +420,10 @@ type conn struct {
 	cmdStart              time.Time // Start of current command.
 	ncmds                 int       // Number of commands processed. Used to abort connection when first incoming command is unknown/invalid.
 	dnsBLs                []dns.Domain
+	localLists            []localList
+	uribl                 uriblConfig
 	firstTimeSenderDelay  time.Duration
+	greylisting           *config.Greylisting // If set, deliveries from senders without reputation are greylisted.
 
 	// If non-zero, taken into account during Read and Write. Set while processing DATA
 	// command, we don't want the entire delivery to take too long.
@@ -390,6 +464,22 @@ type rcptAlias struct {
 	CanonicalAddress string // Optional catchall part stripped and/or lowercased.
 }
 
+// rcptAnalysis is the result of analyzing an incoming message for a recipient.
+type rcptAnalysis struct {
+	rcpt recipient
+	la   []analysis // Analysis for each account, multiple for aliases. Each has an open account.
+	a0   *analysis  // Analysis used for accept/reject decision.
+}
+
+// close closes the accounts of the analyses.
+func (ra *rcptAnalysis) close(log mlog.Log) {
+	for _, a := range ra.la {
+		err := a.d.acc.Close()
+		log.Check(err, "close account")
+	}
+	ra.la = nil
+}
+
 type recipient struct {
 	Addr smtp.Path
 
@@ -864,10 +954,10 @@ var cleanClose struct{} // Sentinel value for panic/recover indicating clean clo
 func ServeTLSConn(listenerName string, hostname dns.Domain, conn *tls.Conn, tlsConfig *tls.Config, submission, viaHTTPS bool, maxMsgSize int64, requireTLS bool) {
 	log := mlog.New("smtpserver", nil)
 	resolver := dns.StrictResolver{Log: log.Logger}
-	serve(listenerName, mox.Cid(), hostname, tlsConfig, conn, resolver, submission, true, viaHTTPS, true, maxMsgSize, true, true, requireTLS, nil, 0)
+	serve(listenerName, mox.Cid(), hostname, tlsConfig, conn, resolver, submission, true, viaHTTPS, true, maxMsgSize, true, true, requireTLS, nil, nil, uriblConfig{}, 0, nil)
 }
 
-func serve(listenerName string, cid int64, hostname dns.Domain, tlsConfig *tls.Config, nc net.Conn, resolver dns.Resolver, submission, xtls, viaHTTPS, noTLSClientAuth bool, maxMessageSize int64, requireTLSForAuth, requireTLSForDelivery, requireTLS bool, dnsBLs []dns.Domain, firstTimeSenderDelay time.Duration) {
+func serve(listenerName string, cid int64, hostname dns.Domain, tlsConfig *tls.Config, nc net.Conn, resolver dns.Resolver, submission, xtls, viaHTTPS, noTLSClientAuth bool, maxMessageSize int64, requireTLSForAuth, requireTLSForDelivery, requireTLS bool, dnsBLs []dns.Domain, localLists []localList, uribl uriblConfig, firstTimeSenderDelay time.Duration, greylisting *config.Greylisting) {
 	var localIP, remoteIP net.IP
 	if a, ok := nc.LocalAddr().(*net.TCPAddr); ok {
 		localIP = a.IP
@@ -906,7 +996,10 @@ func serve(listenerName string, cid int64, hostname dns.Domain, tlsConfig *tls.C
 		requireTLSForAuth:     requireTLSForAuth,
 		requireTLSForDelivery: requireTLSForDelivery,
 		dnsBLs:                dnsBLs,
+		localLists:            localLists,
+		uribl:                 uribl,
 		firstTimeSenderDelay:  firstTimeSenderDelay,
+		greylisting:           greylisting,
 	}
 	var logmutex sync.Mutex
 	// Also see (and possibly update) c.logbg, for logging in a goroutine.
@@ -975,7 +1068,14 @@ func serve(listenerName string, cid int64, hostname dns.Domain, tlsConfig *tls.C
 	default:
 	}
 
-	if !limiterConnectionRate.Add(c.remoteIP, time.Now(), 1) {
+	if store.IPBanned(c.remoteIP) {
+		c.log.Debug("refusing connection from banned ip", slog.Any("remoteip", c.remoteIP))
+		c.xwritecodeline(smtp.C421ServiceUnavail, smtp.SePol7Other0, "your ip or network is banned", nil)
+		return
+	}
+
+	rateLimiter, openLimiter := limiters(listenerName, submission)
+	if !rateLimiter.Add(c.remoteIP, time.Now(), 1) {
 		c.xwritecodeline(smtp.C421ServiceUnavail, smtp.SePol7Other0, "connection rate from your ip or network too high, slow down please", nil)
 		return
 	}
@@ -988,12 +1088,12 @@ func serve(listenerName string, cid int64, hostname dns.Domain, tlsConfig *tls.C
 		return
 	}
 
-	if !limiterConnections.Add(c.remoteIP, time.Now(), 1) {
+	if !openLimiter.Add(c.remoteIP, time.Now(), 1) {
 		c.log.Debug("refusing connection due to many open connections", slog.Any("remoteip", c.remoteIP))
 		c.xwritecodeline(smtp.C421ServiceUnavail, smtp.SePol7Other0, "too many open connections from your ip or network", nil)
 		return
 	}
-	defer limiterConnections.Add(c.remoteIP, time.Now(), -1)
+	defer openLimiter.Add(c.remoteIP, time.Now(), -1)
 
 	// We register and unregister the original connection, in case c.conn is replaced
 	// with a TLS connection later on.
@@ -1414,7 +1514,7 @@ func (c *conn) cmdAuth(p *parser) {
 		}
 
 		var err error
-		account, la.AccountName, err = store.OpenEmailAuth(c.log, username, password, false)
+		account, la.AccountName, la.AppPasswordName, err = store.OpenEmailAuthProtocol(c.log, username, password, store.AppPasswordSubmission, c.remoteIP, false)
 		if err != nil && errors.Is(err, store.ErrUnknownCredentials) {
 			// ../rfc/4954:274
 			la.Result = store.AuthBadCredentials
@@ -1457,7 +1557,7 @@ func (c *conn) cmdAuth(p *parser) {
 		c.xtrace(mlog.LevelTrace) // Restore.
 
 		var err error
-		account, la.AccountName, err = store.OpenEmailAuth(c.log, username, password, false)
+		account, la.AccountName, la.AppPasswordName, err = store.OpenEmailAuthProtocol(c.log, username, password, store.AppPasswordSubmission, c.remoteIP, false)
 		if err != nil && errors.Is(err, store.ErrUnknownCredentials) {
 			// ../rfc/4954:274
 			la.Result = store.AuthBadCredentials
@@ -1492,39 +1592,29 @@ func (c *conn) cmdAuth(p *parser) {
 		}
 		xcheckf(err, "looking up address")
 		la.AccountName = account.Name
-		var ipadhash, opadhash hash.Hash
+		// Secrets of the main password and of app passwords allowed for submission.
+		var secrets []store.AuthSecret
 		account.WithRLock(func() {
 			err := account.DB.Read(context.TODO(), func(tx *bstore.Tx) error {
-				password, err := bstore.QueryTx[store.Password](tx).Get()
-				if err == bstore.ErrAbsent {
-					c.log.Info("failed authentication attempt", slog.String("username", username), slog.Any("remote", c.remoteIP))
-					xsmtpUserErrorf(smtp.C535AuthBadCreds, smtp.SePol7AuthBadCreds8, "bad user/pass")
-				}
-				if err != nil {
-					return err
-				}
-
-				ipadhash = password.CRAMMD5.Ipad
-				opadhash = password.CRAMMD5.Opad
-				return nil
+				var err error
+				secrets, err = store.AuthSecrets(tx, store.AppPasswordSubmission, c.remoteIP)
+				return err
 			})
 			xcheckf(err, "tx read")
 		})
-		if ipadhash == nil || opadhash == nil {
+		if len(secrets) > 0 && secrets[0].AppPasswordID == 0 && (secrets[0].CRAMMD5.Ipad == nil || secrets[0].CRAMMD5.Opad == nil) {
 			missingDerivedSecrets = true
 			c.log.Info("cram-md5 auth attempt without derived secrets set, save password again to store secrets", slog.String("username", username))
-			c.log.Info("failed authentication attempt", slog.String("username", username), slog.Any("remote", c.remoteIP))
-			xsmtpUserErrorf(smtp.C535AuthBadCreds, smtp.SePol7AuthBadCreds8, "bad user/pass")
 		}
-
-		// ../rfc/2195:138 ../rfc/2104:142
-		ipadhash.Write([]byte(chal))
-		opadhash.Write(ipadhash.Sum(nil))
-		digest := fmt.Sprintf("%x", opadhash.Sum(nil))
-		if digest != t[1] {
+		match := store.CRAMMD5Match(secrets, chal, t[1])
+		if match == nil {
 			c.log.Info("failed authentication attempt", slog.String("username", username), slog.Any("remote", c.remoteIP))
 			xsmtpUserErrorf(smtp.C535AuthBadCreds, smtp.SePol7AuthBadCreds8, "bad user/pass")
 		}
+		if match.AppPasswordID != 0 {
+			la.AppPasswordName = match.AppPasswordName
+			account.AppPasswordUsed(c.log, match.AppPasswordID, store.AppPasswordSubmission, c.remoteIP)
+		}
 
 	case "SCRAM-SHA-256-PLUS", "SCRAM-SHA-256", "SCRAM-SHA-1-PLUS", "SCRAM-SHA-1":
 		// todo: improve handling of errors during scram. e.g. invalid parameters. should we abort the imap command, or continue until the end and respond with a scram-level error?
@@ -1534,11 +1624,14 @@ func (c *conn) cmdAuth(p *parser) {
 
 		la.AuthMech = strings.ToLower(mech)
 		var h func() hash.Hash
+		var variant string
 		switch la.AuthMech {
 		case "scram-sha-1", "scram-sha-1-plus":
 			h = sha1.New
+			variant = "sha1"
 		case "scram-sha-256", "scram-sha-256-plus":
 			h = sha256.New
+			variant = "sha256"
 		default:
 			xsmtpServerErrorf(codes{smtp.C554TransactionFailed, smtp.SeSys3Other0}, "missing scram auth method case")
 		}
@@ -1573,38 +1666,32 @@ func (c *conn) cmdAuth(p *parser) {
 		if ss.Authorization != "" && ss.Authorization != username {
 			xsmtpUserErrorf(smtp.C535AuthBadCreds, smtp.SePol7AuthBadCreds8, "authentication with authorization for different user not supported")
 		}
-		var xscram store.SCRAM
+		// Secrets of the main password and of app passwords allowed for submission.
+		var secrets []store.AuthSecret
 		account.WithRLock(func() {
 			err := account.DB.Read(context.TODO(), func(tx *bstore.Tx) error {
-				password, err := bstore.QueryTx[store.Password](tx).Get()
-				if err == bstore.ErrAbsent {
-					c.log.Info("failed authentication attempt", slog.String("username", username), slog.Any("remote", c.remoteIP))
-					xsmtpUserErrorf(smtp.C535AuthBadCreds, smtp.SePol7AuthBadCreds8, "bad user/pass")
-				}
-				xcheckf(err, "fetching credentials")
-				switch la.AuthMech {
-				case "scram-sha-1", "scram-sha-1-plus":
-					xscram = password.SCRAMSHA1
-				case "scram-sha-256", "scram-sha-256-plus":
-					xscram = password.SCRAMSHA256
-				default:
-					xsmtpServerErrorf(codes{smtp.C554TransactionFailed, smtp.SeSys3Other0}, "missing scram auth credentials case")
-				}
-				if len(xscram.Salt) == 0 || xscram.Iterations == 0 || len(xscram.SaltedPassword) == 0 {
-					missingDerivedSecrets = true
-					c.log.Info("scram auth attempt without derived secrets set, save password again to store secrets", slog.String("address", username))
-					c.log.Info("failed authentication attempt", slog.String("username", username), slog.Any("remote", c.remoteIP))
-					xsmtpUserErrorf(smtp.C454TempAuthFail, smtp.SeSys3Other0, "scram not possible")
-				}
-				return nil
+				var err error
+				secrets, err = store.AuthSecrets(tx, store.AppPasswordSubmission, c.remoteIP)
+				return err
 			})
 			xcheckf(err, "read tx")
 		})
-		s1, err := ss.ServerFirst(xscram.Iterations, xscram.Salt)
+		if len(secrets) == 0 {
+			c.log.Info("failed authentication attempt", slog.String("username", username), slog.Any("remote", c.remoteIP))
+			xsmtpUserErrorf(smtp.C535AuthBadCreds, smtp.SePol7AuthBadCreds8, "bad user/pass")
+		}
+		salt, iterations, saltedPasswords, candidates := store.SCRAMCandidates(secrets, variant)
+		if salt == nil {
+			missingDerivedSecrets = true
+			c.log.Info("scram auth attempt without derived secrets set, save password again to store secrets", slog.String("address", username))
+			c.log.Info("failed authentication attempt", slog.String("username", username), slog.Any("remote", c.remoteIP))
+			xsmtpUserErrorf(smtp.C454TempAuthFail, smtp.SeSys3Other0, "scram not possible")
+		}
+		s1, err := ss.ServerFirst(iterations, salt)
 		xcheckf(err, "scram first server step")
 		c.xwritelinef("%d %s", smtp.C334ContinueAuth, base64.StdEncoding.EncodeToString([]byte(s1))) // ../rfc/4954:187
 		c2 := xreadContinuation()
-		s3, err := ss.Finish(c2, xscram.SaltedPassword)
+		s3, index, err := ss.FinishMulti(c2, saltedPasswords)
 		if len(s3) > 0 {
 			c.xwritelinef("%d %s", smtp.C334ContinueAuth, base64.StdEncoding.EncodeToString([]byte(s3))) // ../rfc/4954:187
 		}
@@ -1625,6 +1712,10 @@ func (c *conn) cmdAuth(p *parser) {
 			}
 			xcheckf(err, "server final")
 		}
+		if match := candidates[index]; match.AppPasswordID != 0 {
+			la.AppPasswordName = match.AppPasswordName
+			account.AppPasswordUsed(c.log, match.AppPasswordID, store.AppPasswordSubmission, c.remoteIP)
+		}
 
 		// Client must still respond, but there is nothing to say. See ../rfc/9051:6221
 		// The message should be empty. todo: should we require it is empty?
@@ -2302,13 +2393,17 @@ func (c *conn) cmdData(p *parser) {
 		return recvHdr.String()
 	}
 
+	// Scan for viruses/malware, if configured. Both for submission and incoming
+	// deliveries.
+	scanResult, scanHeader := c.xcontentScan(cmdctx, dataFile, msgWriter.Size)
+
 	// Submission is easiest because user is trusted. Far fewer checks to make. So
 	// handle it first, and leave the rest of the function for handling wild west
 	// internet traffic.
 	if c.submission {
-		c.submit(cmdctx, recvHdrFor, msgWriter, dataFile, part)
+		c.submit(cmdctx, recvHdrFor, msgWriter, dataFile, part, scanResult, scanHeader)
 	} else {
-		c.deliver(cmdctx, recvHdrFor, msgWriter, iprevStatus, iprevAuthentic, dataFile)
+		c.deliver(cmdctx, recvHdrFor, msgWriter, iprevStatus, iprevAuthentic, dataFile, scanResult, scanHeader)
 	}
 }
 
@@ -2330,9 +2425,15 @@ func hasTLSRequiredNo(h textproto.MIMEHeader) bool {
 }
 
 // submit is used for mail from authenticated users that we will try to deliver.
-func (c *conn) submit(ctx context.Context, recvHdrFor func(string) string, msgWriter *message.Writer, dataFile *os.File, part *message.Part) {
+func (c *conn) submit(ctx context.Context, recvHdrFor func(string) string, msgWriter *message.Writer, dataFile *os.File, part *message.Part, scanResult contentscan.Result, scanHeader string) {
 	// Similar between ../smtpserver/server.go:/submit\( and ../webmail/api.go:/MessageSubmit\( and ../webapisrv/server.go:/Send\(
 
+	if scanResult.Status == contentscan.StatusInfected {
+		metricSubmission.WithLabelValues("infected").Inc()
+		c.log.Info("rejecting submission of infected message", slog.String("threat", scanResult.Threat), slog.String("user", c.username))
+		xsmtpUserErrorf(smtp.C554TransactionFailed, smtp.SePol7Other0, "message contains virus or malware %q", scanResult.Threat)
+	}
+
 	var msgPrefix []byte
 
 	// Check that user is only sending email as one of its configured identities. Not
@@ -2371,6 +2472,27 @@ func (c *conn) submit(ctx context.Context, recvHdrFor func(string) string, msgWr
 		xsmtpUserErrorf(smtp.C550MailboxUnavail, smtp.SeMsg6Other0, "message should not have Return-Path header")
 	}
 
+	// Apply attachment policy of account and message From domain. Stripping must be
+	// done before DKIM-signing.
+	dataSize := msgWriter.Size
+	accConf, _ := c.account.Conf()
+	if rules := attachmentRules(accConf, msgFrom.Domain); len(rules) > 0 {
+		v := attachpolicy.Inspect(c.log.Logger, dataFile, dataSize).Evaluate(rules, attachpolicy.Outgoing)
+		switch v.Action {
+		case attachpolicy.ActionReject, attachpolicy.ActionQuarantine:
+			metricSubmission.WithLabelValues("attachment").Inc()
+			c.log.Info("rejecting submission due to attachment policy", slog.String("reason", v.Reason()), slog.String("user", c.username))
+			xsmtpUserErrorf(smtp.C554TransactionFailed, smtp.SePol7DeliveryUnauth1, "message rejected: %s", v.Reason())
+		case attachpolicy.ActionStrip:
+			f, size, err := stripAttachments(c.log, dataFile, dataSize, v)
+			xcheckf(err, "stripping attachments from message")
+			defer store.CloseRemoveTempFile(c.log, f, "submitted message with stripped attachments")
+			c.log.Info("stripped attachments from submitted message", slog.String("reason", v.Reason()), slog.String("user", c.username))
+			dataFile = f
+			dataSize = size
+		}
+	}
+
 	// Add Message-Id header if missing.
 	// ../rfc/5321:4131 ../rfc/6409:751
 	messageID := header.Get("Message-Id")
@@ -2435,6 +2557,30 @@ func (c *conn) submit(ctx context.Context, recvHdrFor func(string) string, msgWr
 		xsmtpServerErrorf(codes{smtp.C451LocalErr, smtp.SeSys3Other0}, "domain of message from header is temporarily disabled")
 	}
 
+	// Check send limits for account and domain, recording usage. May add a hold rule.
+	// If we don't queue the message after all, the usage is removed again.
+	usage, err := queue.SendLimitCheck(ctx, c.log, c.account.Name, msgFrom.Domain, queue.SendSourceSMTP, len(c.recipients), messageID, header.Get("Subject"))
+	var sendLimitErr queue.SendLimitError
+	if errors.As(err, &sendLimitErr) {
+		metricSubmission.WithLabelValues("sendlimiterror").Inc()
+		// Retrying makes sense for an hourly limit. For daily and monthly limits, clients
+		// would keep retrying for too long, so we reject permanently.
+		code := smtp.C451LocalErr
+		if sendLimitErr.Limit.Period != "hour" {
+			code = smtp.C550MailboxUnavail
+		}
+		xsmtpUserErrorf(code, smtp.SePol7DeliveryUnauth1, "%s", err)
+	} else {
+		xcheckf(err, "checking send limits")
+	}
+	var queued bool
+	defer func() {
+		if !queued {
+			err := queue.SendUsageRemove(context.Background(), usage)
+			c.log.Check(err, "removing send usage for message that was not queued")
+		}
+	}()
+
 	selectors := mox.DKIMSelectors(confDom.DKIM)
 	if len(selectors) > 0 {
 		canonical := mox.CanonicalLocalpart(msgFrom.Localpart, confDom)
@@ -2460,13 +2606,13 @@ func (c *conn) submit(ctx context.Context, recvHdrFor func(string) string, msgWr
 		},
 	}
 	msgPrefix = append(msgPrefix, []byte(authResults.Header())...)
+	msgPrefix = append(msgPrefix, []byte(scanHeader)...)
 
 	// We always deliver through the queue. It would be more efficient to deliver
 	// directly for local accounts, but we don't want to circumvent all the anti-spam
 	// measures. Accounts on a single mox instance should be allowed to block each
 	// other.
 
-	accConf, _ := c.account.Conf()
 	loginAddr, err := smtp.ParseAddress(c.username)
 	xcheckf(err, "parsing login address")
 	useFromID := slices.Contains(accConf.ParsedFromIDLoginAddresses, loginAddr)
@@ -2517,7 +2663,7 @@ func (c *conn) submit(ctx context.Context, recvHdrFor func(string) string, msgWr
 			rcptTo = rcpt.Addr.String()
 		}
 		xmsgPrefix := append([]byte(recvHdrFor(rcptTo)), msgPrefix...)
-		msgSize := int64(len(xmsgPrefix)) + msgWriter.Size
+		msgSize := int64(len(xmsgPrefix)) + dataSize
 		qm := queue.MakeMsg(fp, rcpt.Addr, msgWriter.Has8bit, c.msgsmtputf8, msgSize, messageID, xmsgPrefix, c.requireTLS, now, header.Get("Subject"))
 		if !c.futureRelease.IsZero() {
 			qm.NextAttempt = c.futureRelease
@@ -2540,6 +2686,7 @@ func (c *conn) submit(ctx context.Context, recvHdrFor func(string) string, msgWr
 		c.log.Errorx("queuing message", err)
 		xsmtpServerErrorf(errCodes(smtp.C451LocalErr, smtp.SeSys3Other0, err), "error delivering message: %v", err)
 	}
+	queued = true
 	metricSubmission.WithLabelValues("ok").Inc()
 	for i, rcpt := range c.recipients {
 		c.log.Info("messages queued for delivery",
@@ -2606,9 +2753,17 @@ func (c *conn) xlocalserveError(lp smtp.Localpart) {
 
 // deliver is called for incoming messages from external, typically untrusted
 // sources. i.e. not submitted by authenticated users.
-func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgWriter *message.Writer, iprevStatus iprev.Status, iprevAuthentic bool, dataFile *os.File) {
+func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgWriter *message.Writer, iprevStatus iprev.Status, iprevAuthentic bool, dataFile *os.File, scanResult contentscan.Result, scanHeader string) {
 	// todo: in decision making process, if we run into (some) temporary errors, attempt to continue. if we decide to accept, all good. if we decide to reject, we'll make it a temporary reject.
 
+	// Infected messages are rejected for all recipients. With quarantine, each
+	// recipient analysis rejects the message, so it is stored in the Rejects mailbox.
+	if scanResult.Status == contentscan.StatusInfected && !mox.Conf.Static.ContentScanner.Quarantine {
+		metricDelivery.WithLabelValues("reject", reasonContentInfected).Inc()
+		c.log.Info("rejecting infected message", slog.String("threat", scanResult.Threat))
+		xsmtpUserErrorf(smtp.C554TransactionFailed, smtp.SePol7Other0, "message contains virus or malware %q", scanResult.Threat)
+	}
+
 	var msgFrom smtp.Address
 	var envelope *message.Envelope
 	var headers textproto.MIMEHeader
@@ -2623,6 +2778,25 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 		c.log.Infox("parsing message for From address", err)
 	}
 
+	// Domains of links in the message, for URIBL checks. Only extracted when needed,
+	// and once for all recipients.
+	linkDomains := sync.OnceValue(func() []dns.Domain {
+		return messageLinkDomains(c.log, part)
+	})
+
+	// Attachments in the message, for attachment rules of accounts and domains. Only
+	// inspected when needed, and once for all recipients.
+	attachInspection := sync.OnceValue(func() *attachpolicy.Inspection {
+		return attachpolicy.Inspect(c.log.Logger, dataFile, msgWriter.Size)
+	})
+	// Messages with attachments stripped for recipients, removed when we are done.
+	var strippedFiles []*os.File
+	defer func() {
+		for _, f := range strippedFiles {
+			store.CloseRemoveTempFile(c.log, f, "delivered message with stripped attachments")
+		}
+	}()
+
 	// Basic loop detection. ../rfc/5321:4065 ../rfc/5321:1526
 	if len(headers.Values("Received")) > 100 {
 		xsmtpUserErrorf(smtp.C550MailboxUnavail, smtp.SeNet4Loop6, "loop detected, more than 100 Received headers")
@@ -2928,7 +3102,7 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 			Result: string(dmarcResult.Status),
 		}
 	} else {
-		msgFromValidation = alignment(ctx, c.log, msgFrom.Domain, dkimResults, receivedSPF.Result, spfIdentity)
+		msgFromValidation = alignment(ctx, c.log, c.resolver, msgFrom.Domain, dkimResults, receivedSPF.Result, spfIdentity, mox.Conf.DMARCDiscovery())
 
 		// We are doing the DMARC evaluation now. But we only store it for inclusion in an
 		// aggregate report when we actually use it. We use an evaluation for each
@@ -2941,7 +3115,7 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 
 		dmarcctx, dmarccancel := context.WithTimeout(ctx, time.Minute)
 		defer dmarccancel()
-		dmarcUse, dmarcResult = dmarc.Verify(dmarcctx, c.log.Logger, c.resolver, msgFrom.Domain, dkimResults, receivedSPF.Result, spfIdentity, applyRandomPercentage)
+		dmarcUse, dmarcResult = dmarc.Verify(dmarcctx, c.log.Logger, c.resolver, msgFrom.Domain, dkimResults, receivedSPF.Result, spfIdentity, applyRandomPercentage, mox.Conf.DMARCDiscovery())
 		dmarccancel()
 		var comment string
 		if dmarcResult.RecordAuthentic {
@@ -2967,6 +3141,34 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 	}
 	c.log.Debug("dmarc verification", slog.Any("result", dmarcResult.Status), slog.Any("domain", msgFrom.Domain))
 
+	// BIMI, for showing a logo of the sender domain. Only for messages that passed
+	// DMARC, we do the same evaluation for all recipients.
+	var bimiResult bimi.Result
+	var bimiMethod *message.AuthMethod
+	if ib := mox.Conf.Static.IncomingBIMI; ib != nil && ib.Enabled && dmarcResult.Status == dmarc.StatusPass {
+		selector := bimiSelector(ctx, c.log, msgFrom.Domain, headers, dkimResults)
+		// We don't want to keep the remote waiting for slow web servers. Fetches of logos
+		// and certificates continue in the background after the timeout, their results are
+		// cached for later messages from the domain.
+		bimictx, bimicancel := context.WithTimeout(ctx, 5*time.Second)
+		defer bimicancel()
+		bimiResult = bimi.Verify(bimictx, c.log.Logger, c.resolver, msgFrom.Domain, selector, dmarcResult, mox.Conf.DMARCDiscovery(), ib.RequireCertificate)
+		bimicancel()
+		if bimiResult.Status != bimi.StatusSkipped {
+			bimiMethod = &message.AuthMethod{
+				Method: "bimi",
+				Result: string(bimiResult.Status),
+				Props: []message.AuthProp{
+					message.MakeAuthProp("header", "d", bimiResult.Domain.ASCII, true, bimiResult.Domain.ASCIIExtra(c.msgsmtputf8)),
+					message.MakeAuthProp("header", "selector", bimiResult.Selector, false, ""),
+				},
+			}
+			if bimiResult.Evidence != "" {
+				bimiMethod.Props = append(bimiMethod.Props, message.MakeAuthProp("policy", "authority", bimiResult.Evidence, false, ""))
+			}
+		}
+	}
+
 	// Prepare for analyzing content, calculating reputation.
 	ipmasked1, ipmasked2, ipmasked3 := ipmasked(c.remoteIP)
 	var verifiedDKIMDomains []string
@@ -2984,6 +3186,11 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 		}
 	}
 
+	// The junk filter classifies the message with an Authentication-Results header
+	// like the one we add during delivery, without the per-recipient DMARC overrides.
+	classifyAuthResults := authResults
+	classifyAuthResults.Methods = append(slices.Clone(authResults.Methods), dmarcMethod)
+
 	// When we deliver, we try to remove from rejects mailbox based on message-id.
 	// We'll parse it when we need it, but it is the same for each recipient.
 	var messageID string
@@ -3083,6 +3290,10 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 			DKIMDomains:        verifiedDKIMDomains,
 			DSN:                isDSN,
 			Size:               msgWriter.Size,
+			BIMI:               string(bimiResult.Status),
+		}
+		if bimiResult.Status == bimi.StatusPass {
+			m.BIMILogo = bimiResult.Logo
 		}
 		if c.tls {
 			tlsState := c.conn.(*tls.Conn).ConnectionState()
@@ -3095,22 +3306,46 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 			m.ReceivedTLSVersion = 1 // Signals plain text delivery.
 		}
 
+		// Apply attachment policy of account and recipient domain. Rejections are done
+		// during analysis. For stripping, we continue with a modified message for this
+		// account.
+		msgFile := dataFile
+		var attachVerdict attachpolicy.Verdict
+		accConf, _ := acc.Conf()
+		if rules := attachmentRules(accConf, deliverTo.IPDomain.Domain); len(rules) > 0 {
+			attachVerdict = attachInspection().Evaluate(rules, attachpolicy.Incoming)
+			if attachVerdict.Action == attachpolicy.ActionStrip {
+				f, size, err := stripAttachments(log, dataFile, msgWriter.Size, attachVerdict)
+				if err != nil {
+					log.Errorx("stripping attachments from message", err)
+					metricDelivery.WithLabelValues("attachmenterror", "").Inc()
+					return nil, err
+				}
+				strippedFiles = append(strippedFiles, f)
+				msgFile = f
+				m.Size = size
+				log.Info("stripped attachments from incoming message", slog.String("reason", attachVerdict.Reason()))
+			}
+		}
+
 		var msgTo, msgCc []message.Address
 		if envelope != nil {
 			msgTo = envelope.To
 			msgCc = envelope.CC
 		}
-		d := delivery{c.tls, &m, dataFile, smtpRcptTo, deliverTo, destination, canonicalAddr, acc, msgTo, msgCc, msgFrom, c.dnsBLs, dmarcUse, dmarcResult, dkimResults, iprevStatus, c.smtputf8}
+		d := delivery{c.tls, &m, msgFile, smtpRcptTo, deliverTo, destination, canonicalAddr, acc, msgTo, msgCc, msgFrom, c.dnsBLs, c.localLists, c.uribl, linkDomains, dmarcUse, dmarcResult, dkimResults, iprevStatus, classifyAuthResults.Header(), scanResult, attachVerdict, c.smtputf8}
 
 		r := analyze(ctx, log, c.resolver, d)
 		return &r, nil
 	}
 
-	// Either deliver the message, or call addError to register the recipient as failed.
-	// If recipient is an alias, we may be delivering to multiple address/accounts and
-	// we will consider a message delivered if we delivered it to at least one account
-	// (others may be over quota).
-	processRecipient := func(rcpt recipient) {
+	// Whether a DMARC failure report was sent for the message. We send at most one,
+	// not one per recipient.
+	var dmarcFailureReported bool
+
+	// Analyze the message for the recipient, or call addError to register the
+	// recipient as failed and return nil.
+	analyzeRecipient := func(rcpt recipient) (ra *rcptAnalysis) {
 		log := c.log.With(slog.Any("mailfrom", c.mailFrom), slog.Any("rcptto", rcpt.Addr))
 
 		// If this is not a valid local user, we send back a DSN. This can only happen when
@@ -3128,9 +3363,13 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 		}
 
 		// la holds all analysis, and message preparation, for all accounts (multiple for
-		// aliases). Each has an open account that we we close on return.
+		// aliases). Each has an open account that we close on failure, or that is closed
+		// when we are done with the transaction.
 		var la []analysis
 		defer func() {
+			if ra != nil {
+				return
+			}
 			for _, a := range la {
 				err := a.d.acc.Close()
 				log.Check(err, "close account")
@@ -3176,6 +3415,16 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 			la = []analysis{*a}
 			a0 = &la[0]
 		}
+		return &rcptAnalysis{rcpt, la, a0}
+	}
+
+	// Either deliver the message, or call addError to register the recipient as failed.
+	// If recipient is an alias, we may be delivering to multiple address/accounts and
+	// we will consider a message delivered if we delivered it to at least one account
+	// (others may be over quota).
+	processRecipient := func(ra *rcptAnalysis) {
+		rcpt, la, a0 := ra.rcpt, ra.la, ra.a0
+		log := c.log.With(slog.Any("mailfrom", c.mailFrom), slog.Any("rcptto", rcpt.Addr))
 
 		if !a0.accept && a0.reason == reasonHighRate {
 			log.Info("incoming message rejected for high rate, not storing in rejects mailbox", slog.String("reason", a0.reason), slog.Any("msgfrom", msgFrom))
@@ -3184,6 +3433,12 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 			addError(rcpt, a0.code, a0.secode, a0.userError, a0.errmsg)
 			return
 		}
+		if !a0.accept && a0.reason == reasonAttachReject {
+			log.Info("incoming message rejected by attachment policy, not storing in rejects mailbox", slog.String("reason", a0.reason), slog.Any("msgfrom", msgFrom))
+			metricDelivery.WithLabelValues("reject", a0.reason).Inc()
+			addError(rcpt, a0.code, a0.secode, a0.userError, a0.errmsg)
+			return
+		}
 
 		// Any DMARC result override is stored in the evaluation for outgoing DMARC
 		// aggregate reports, and added to the Authentication-Results message header.
@@ -3211,6 +3466,9 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 		rcptAuthResults := authResults
 		rcptAuthResults.Methods = slices.Clone(authResults.Methods)
 		rcptAuthResults.Methods = append(rcptAuthResults.Methods, rcptDMARCMethod)
+		if bimiMethod != nil {
+			rcptAuthResults.Methods = append(rcptAuthResults.Methods, *bimiMethod)
+		}
 
 		// Prepend reason as message header, for easy viewing in mail clients.
 		var xmox string
@@ -3242,6 +3500,7 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 					"Delivered-To: " + la[i].d.deliverTo.XString(c.msgsmtputf8) + "\r\n" + // ../rfc/9228:274
 					"Return-Path: <" + c.mailFrom.String() + ">\r\n" + // ../rfc/5321:3300
 					rcptAuthResults.Header() +
+					scanHeader +
 					receivedSPF.Header() +
 					recvHdrFor(rcpt.Addr.String()),
 			)
@@ -3331,7 +3590,7 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 					Policy:          dmarcrpt.Disposition(r.Policy),
 					SubdomainPolicy: sp,
 					Percentage:      r.Percentage,
-					// We don't save ReportingOptions, we don't do per-message failure reporting.
+					// We don't save ReportingOptions, failure reports are sent per message.
 				},
 				SourceIP:        c.remoteIP.String(),
 				Disposition:     disposition,
@@ -3382,6 +3641,51 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 			log.Check(err, "adding dmarc evaluation to database for aggregate report")
 		}
 
+		// Send a DMARC failure report if requested by the policy domain and enabled for it
+		// in our config. Not for messages to reporting addresses, to prevent loops.
+		// ../rfc/7489:2006
+		if !dmarcFailureReported && !mox.Conf.Static.NoOutgoingDMARCReports && dmarcResult.Status == dmarc.StatusFail && !(a0.d.destination.DMARCReports || a0.d.destination.HostTLSReports || a0.d.destination.DomainTLSReports) {
+			dkimFail := slices.ContainsFunc(dkimResults, func(r dkim.Result) bool { return r.Status == dkim.StatusFail })
+			if dmarcdb.FailureReportRequested(msgFrom.Domain, dmarcResult, dkimFail, receivedSPF.Result == spf.StatusFail) {
+				dmarcFailureReported = true
+				deliveryResult := "delivered" // ../rfc/6591:254
+				if !a0.accept {
+					deliveryResult = "reject"
+				} else if a0.d.m.IsReject {
+					deliveryResult = "spam"
+				}
+				msg, err := dmarcdb.FailureReportMessage(dataFile, msgWriter.Size, part.BodyOffset)
+				if err != nil {
+					log.Errorx("reading message for dmarc failure report", err)
+				} else {
+					fm := dmarcdb.FailureMessage{
+						FromDomain:     msgFrom.Domain,
+						Result:         dmarcResult,
+						SourceIP:       c.remoteIP.String(),
+						MailFrom:       c.mailFrom.String(),
+						RcptTo:         rcpt.Addr.String(),
+						Arrival:        a0.d.m.Received,
+						DeliveryResult: deliveryResult,
+						AuthResults:    rcptAuthResults.Header(),
+						Message:        msg,
+					}
+					go func() {
+						defer func() {
+							x := recover() // Should not happen, but don't take program down if it does.
+							if x != nil {
+								c.log.Error("dmarc failure report panic", slog.Any("err", x))
+								debug.PrintStack()
+								metrics.PanicInc(metrics.Dmarcdb)
+							}
+						}()
+
+						err := dmarcdb.SendFailureReport(context.Background(), log, c.resolver, fm)
+						log.Check(err, "sending dmarc failure report")
+					}()
+				}
+			}
+		}
+
 		if !a0.accept {
 			for _, a := range la {
 				// Don't add message if address was also explicitly present in a RCPT TO command.
@@ -3393,7 +3697,7 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 				if conf.RejectsMailbox == "" {
 					continue
 				}
-				present, _, messagehash, err := rejectPresent(log, a.d.acc, conf.RejectsMailbox, a.d.m, dataFile)
+				present, _, messagehash, err := rejectPresent(log, a.d.acc, conf.RejectsMailbox, a.d.m, a.d.dataFile)
 				if err != nil {
 					log.Errorx("checking whether reject is already present", err)
 					continue
@@ -3447,7 +3751,7 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 							mbrej = &nmb
 						}
 						a.d.m.MailboxID = mbrej.ID
-						if err := a.d.acc.MessageAdd(log, tx, mbrej, a.d.m, dataFile, store.AddOpts{}); err != nil {
+						if err := a.d.acc.MessageAdd(log, tx, mbrej, a.d.m, a.d.dataFile, store.AddOpts{}); err != nil {
 							return fmt.Errorf("delivering spammy mail to rejects mailbox: %v", err)
 						}
 						newID = a.d.m.ID
@@ -3525,7 +3829,7 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 
 		// Gather the message-id before we deliver and the file may be consumed.
 		if !parsedMessageID {
-			if p, err := message.Parse(c.log.Logger, false, store.FileMsgReader(a0.d.m.MsgPrefix, dataFile)); err != nil {
+			if p, err := message.Parse(c.log.Logger, false, store.FileMsgReader(a0.d.m.MsgPrefix, a0.d.dataFile)); err != nil {
 				log.Infox("parsing message for message-id", err)
 			} else if header, err := p.Header(); err != nil {
 				log.Infox("parsing message header for message-id", err)
@@ -3548,7 +3852,7 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 
 			var delivered bool
 			a.d.acc.WithWLock(func() {
-				if err := a.d.acc.DeliverMailbox(log, a.mailbox, a.d.m, dataFile); err != nil {
+				if err := a.d.acc.DeliverMailbox(log, a.mailbox, a.d.m, a.d.dataFile); err != nil {
 					log.Errorx("delivering", err)
 					metricDelivery.WithLabelValues("delivererror", a0.reason).Inc()
 					if errors.Is(err, store.ErrOverQuota) {
@@ -3574,7 +3878,7 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 
 			// Pass delivered messages to queue for DSN processing and/or hooks.
 			if delivered {
-				mr := store.FileMsgReader(a.d.m.MsgPrefix, dataFile)
+				mr := store.FileMsgReader(a.d.m.MsgPrefix, a.d.dataFile)
 				part, err := a.d.m.LoadPart(mr)
 				if err != nil {
 					log.Errorx("loading parsed part for evaluating webhook", err)
@@ -3597,9 +3901,29 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 		}
 	}
 
-	// For each recipient, do final spam analysis and delivery.
+	// For each recipient, do final spam analysis. We analyze all recipients before
+	// delivering, for greylisting the transaction as a whole.
+	var analyses []*rcptAnalysis
+	defer func() {
+		for _, ra := range analyses {
+			ra.close(c.log)
+		}
+	}()
 	for _, rcpt := range c.recipients {
-		processRecipient(rcpt)
+		if ra := analyzeRecipient(rcpt); ra != nil {
+			analyses = append(analyses, ra)
+		}
+	}
+
+	if c.greylisting != nil && c.greylisting.Enabled && !Localserve {
+		c.xgreylist(ctx, analyses, mailFromValidation == store.ValidationPass, verifiedDKIMDomains)
+	}
+
+	// Deliver to each recipient. Accounts are closed as soon as we are done with
+	// them, before responding to the client.
+	for _, ra := range analyses {
+		processRecipient(ra)
+		ra.close(c.log)
 	}
 
 	// If all recipients failed to deliver, return an error.
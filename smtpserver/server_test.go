@@ -26,10 +26,14 @@ import (
 
 	"github.com/mjl-/bstore"
 
+	"bufio"
+	"encoding/binary"
 	"github.com/mjl-/mox/config"
 	"github.com/mjl-/mox/dkim"
 	"github.com/mjl-/mox/dmarcdb"
 	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/greylist"
+	"github.com/mjl-/mox/locallist"
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/mox-"
 	"github.com/mjl-/mox/queue"
@@ -40,6 +44,7 @@ import (
 	"github.com/mjl-/mox/subjectpass"
 	"github.com/mjl-/mox/tlsrptdb"
 	"github.com/mjl-/mox/webops"
+	"io"
 )
 
 var ctxbg = context.Background()
@@ -98,6 +103,9 @@ type testserver struct {
 	submission   bool
 	requiretls   bool
 	dnsbls       []dns.Domain
+	localLists   []localList
+	uribl        uriblConfig
+	greylisting  *config.Greylisting
 	tlsmode      smtpclient.TLSMode
 	tlspkix      bool
 	xops         webops.XOps
@@ -152,6 +160,8 @@ func newTestServer(t *testing.T, configPath string, resolver dns.Resolver) *test
 	tcheck(t, err, "dmarcdb init")
 	err = tlsrptdb.Init()
 	tcheck(t, err, "tlsrptdb init")
+	err = greylist.Init(false)
+	tcheck(t, err, "greylist init")
 	err = store.Init(ctxbg)
 	tcheck(t, err, "store init")
 
@@ -177,6 +187,8 @@ func (ts *testserver) close() {
 	tcheck(ts.t, err, "dmarcdb close")
 	err = tlsrptdb.Close()
 	tcheck(ts.t, err, "tlsrptdb close")
+	err = greylist.Close()
+	tcheck(ts.t, err, "greylist close")
 	ts.comm.Unregister()
 	queue.Shutdown()
 	err = ts.acc.Close()
@@ -257,7 +269,7 @@ func (ts *testserver) runRaw(fn func(clientConn net.Conn)) {
 	defer func() { <-serverdone }()
 
 	go func() {
-		serve("test", ts.cid-2, dns.Domain{ASCII: "mox.example"}, ts.serverConfig, serverConn, ts.resolver, ts.submission, ts.immediateTLS, false, false, 100<<20, false, false, ts.requiretls, ts.dnsbls, 0)
+		serve("test", ts.cid-2, dns.Domain{ASCII: "mox.example"}, ts.serverConfig, serverConn, ts.resolver, ts.submission, ts.immediateTLS, false, false, 100<<20, false, false, ts.requiretls, ts.dnsbls, ts.localLists, ts.uribl, 0, ts.greylisting)
 		close(serverdone)
 	}()
 
@@ -367,6 +379,16 @@ func TestSubmission(t *testing.T) {
 	err = acc.Close()
 	tcheck(t, err, "close account")
 
+	// App passwords, one for submission, one only for imap.
+	acc, err = store.OpenAccount(pkglog, "mjl", false)
+	tcheck(t, err, "open account")
+	_, submissionPassword, err := acc.AppPasswordAdd(ctxbg, pkglog, store.AppPassword{Name: "phone", Protocols: []string{store.AppPasswordSubmission}})
+	tcheck(t, err, "add app password")
+	_, imapPassword, err := acc.AppPasswordAdd(ctxbg, pkglog, store.AppPassword{Name: "imap", Protocols: []string{store.AppPasswordIMAP}})
+	tcheck(t, err, "add app password")
+	err = acc.Close()
+	tcheck(t, err, "close account")
+
 	ts.submission = true
 	testAuth(nil, "", "", &smtpclient.Error{Permanent: true, Code: smtp.C530SecurityRequired, Secode: smtp.SePol7Other0})
 	authfns := []func(user, pass string, cs *tls.ConnectionState) sasl.Client{
@@ -386,7 +408,7 @@ func TestSubmission(t *testing.T) {
 			return sasl.NewClientSCRAMSHA256PLUS(user, pass, *cs)
 		},
 	}
-	for _, fn := range authfns {
+	for i, fn := range authfns {
 		testAuth(fn, "mjl@mox.example", "test", &smtpclient.Error{Code: smtp.C535AuthBadCreds, Secode: smtp.SePol7AuthBadCreds8})           // Bad (short) password.
 		testAuth(fn, "mjl@mox.example", password0+"test", &smtpclient.Error{Code: smtp.C535AuthBadCreds, Secode: smtp.SePol7AuthBadCreds8}) // Bad password.
 		testAuth(fn, "mjl@mox.example", password0, nil)
@@ -397,6 +419,13 @@ func TestSubmission(t *testing.T) {
 		testAuth(fn, "mo\u0301x@mox.example", password1, nil)
 		testAuth(fn, "disabled@mox.example", "test1234", &smtpclient.Error{Code: smtp.C525AccountDisabled, Secode: smtp.SePol7AccountDisabled13})
 		testAuth(fn, "disabled@mox.example", "bogus", &smtpclient.Error{Code: smtp.C535AuthBadCreds, Secode: smtp.SePol7AuthBadCreds8})
+		// App passwords have their own SCRAM salts, SCRAM only works with the main password.
+		if i < 3 {
+			testAuth(fn, "mjl@mox.example", submissionPassword, nil)
+		} else {
+			testAuth(fn, "mjl@mox.example", submissionPassword, &smtpclient.Error{Code: smtp.C535AuthBadCreds, Secode: smtp.SePol7AuthBadCreds8})
+		}
+		testAuth(fn, "mjl@mox.example", imapPassword, &smtpclient.Error{Code: smtp.C535AuthBadCreds, Secode: smtp.SePol7AuthBadCreds8}) // Not for submission.
 	}
 
 	// Create a certificate, register its public key with account, and make a tls
@@ -476,7 +505,7 @@ func TestSubmission(t *testing.T) {
 		tlsConfig := &tls.Config{
 			Certificates: []tls.Certificate{fakeCert(ts.t, false)},
 		}
-		serve("test", ts.cid-2, dns.Domain{ASCII: "mox.example"}, tlsConfig, serverConn, ts.resolver, ts.submission, ts.immediateTLS, false, false, 100<<20, false, false, false, ts.dnsbls, 0)
+		serve("test", ts.cid-2, dns.Domain{ASCII: "mox.example"}, tlsConfig, serverConn, ts.resolver, ts.submission, ts.immediateTLS, false, false, 100<<20, false, false, false, ts.dnsbls, ts.localLists, ts.uribl, 0, ts.greylisting)
 		close(serverdone)
 	}()
 
@@ -1077,6 +1106,425 @@ func TestBlocklistedSubjectpass(t *testing.T) {
 	})
 }
 
+// Test local block and allow lists.
+func TestLocalList(t *testing.T) {
+	resolver := &dns.MockResolver{
+		A: map[string][]string{
+			"example.org.":              {"127.0.0.10"}, // For mx check.
+			"2.0.0.127.dnsbl.example.":  {"127.0.0.2"},  // For healthcheck.
+			"10.0.0.127.dnsbl.example.": {"127.0.0.10"}, // Where our connection pretends to come from.
+		},
+		TXT: map[string][]string{
+			"example.org.":        {"v=spf1 ip4:127.0.0.10 -all"},
+			"_dmarc.example.org.": {"v=DMARC1;p=reject"},
+		},
+		PTR: map[string][]string{
+			"127.0.0.10": {"example.org."}, // For iprev check.
+		},
+	}
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/mox.conf"), resolver)
+	defer ts.close()
+
+	loadList := func(allow bool, content string) localList {
+		t.Helper()
+		p := filepath.Join(t.TempDir(), "list.txt")
+		err := os.WriteFile(p, []byte(content), 0660)
+		tcheck(t, err, "write list")
+		l, err := locallist.Load(p)
+		tcheck(t, err, "load list")
+		return localList{"list.txt", l, allow}
+	}
+
+	deliver := func(expErr *smtpclient.Error) {
+		t.Helper()
+		ts.run(func(client *smtpclient.Client) {
+			mailFrom := "remote@example.org"
+			rcptTo := "mjl@mox.example"
+			err := client.Deliver(ctxbg, mailFrom, rcptTo, int64(len(deliverMessage)), strings.NewReader(deliverMessage), false, false, false)
+			ts.smtpErr(err, expErr)
+		})
+	}
+
+	// Remote IP in blocklist, temporary error like a DNSBL.
+	ts.localLists = []localList{loadList(false, "127.0.0.0/24 local block\n")}
+	deliver(&smtpclient.Error{Permanent: false, Code: smtp.C451LocalErr, Secode: smtp.SeSys3Other0})
+
+	// Domain in blocklist.
+	ts.localLists = []localList{loadList(false, ".example.org\n")}
+	deliver(&smtpclient.Error{Permanent: false, Code: smtp.C451LocalErr, Secode: smtp.SeSys3Other0})
+
+	// Verified domain in allowlist skips DNSBL. No message has been accepted yet, so
+	// there is no reputation.
+	ts.localLists = nil
+	ts.dnsbls = []dns.Domain{{ASCII: "dnsbl.example"}}
+	deliver(&smtpclient.Error{Permanent: false, Code: smtp.C451LocalErr, Secode: smtp.SeSys3Other0})
+	ts.localLists = []localList{loadList(true, "example.org\n")}
+	deliver(nil)
+}
+
+// Test URIBL checks on domains of links in messages.
+func TestURIBL(t *testing.T) {
+	resolver := &dns.MockResolver{
+		A: map[string][]string{
+			"example.org.":                {"127.0.0.10"}, // For mx check.
+			"test.dbl.example.":           {"127.0.1.2"},  // For healthcheck.
+			"spam.example.dbl.example.":   {"127.0.1.2"},
+			"mox.example.dbl.example.":    {"127.0.1.2"},       // Our own domain, not looked up.
+			"public.example.dbl.example.": {"127.255.255.254"}, // Error code, not a listing.
+		},
+		TXT: map[string][]string{
+			"example.org.":              {"v=spf1 ip4:127.0.0.10 -all"},
+			"_dmarc.example.org.":       {"v=DMARC1;p=reject"},
+			"spam.example.dbl.example.": {"spam domain"},
+		},
+		PTR: map[string][]string{
+			"127.0.0.10": {"example.org."}, // For iprev check.
+		},
+	}
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/junk/mox.conf"), resolver)
+	defer ts.close()
+	ts.uribl = uriblConfig{[]dns.Domain{{ASCII: "dbl.example"}}, true, 20}
+
+	msg := func(body string) string {
+		return strings.ReplaceAll(`From: <remote@example.org>
+To: <mjl@mox.example>
+Subject: test
+Message-Id: <test@example.org>
+Content-Type: text/html
+
+`+body+`
+`, "\n", "\r\n")
+	}
+
+	deliver := func(msg string, expErr *smtpclient.Error) {
+		t.Helper()
+		ts.run(func(client *smtpclient.Client) {
+			mailFrom := "remote@example.org"
+			rcptTo := "mjl@mox.example"
+			err := client.Deliver(ctxbg, mailFrom, rcptTo, int64(len(msg)), strings.NewReader(msg), false, false, false)
+			ts.smtpErr(err, expErr)
+		})
+	}
+
+	// Link to listed subdomain, through its organizational domain, rejected.
+	deliver(msg(`<a href="https://www.spam&#46;example/x">click</a>`), &smtpclient.Error{Permanent: false, Code: smtp.C451LocalErr, Secode: smtp.SeSys3Other0})
+
+	// Without reject, the junk filter is stricter. The filter is untrained, so its
+	// result is not significant, which is now not enough to accept.
+	ts.uribl.reject = false
+	deliver(msg(`see www.spam.example`), &smtpclient.Error{Permanent: false, Code: smtp.C451LocalErr, Secode: smtp.SeSys3Other0})
+
+	// Links to our own domains are not looked up. Lookup limit is reached before the
+	// listed domain.
+	ts.uribl.maxLookups = 1
+	deliver(msg(`https://mail.mox.example/ https://public.example/ https://spam.example/`), nil)
+}
+
+// fakeClamd serves the clamd INSTREAM command, finding a virus in messages
+// containing "virus-test-marker".
+func fakeClamd(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	tcheck(t, err, "listen")
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				if _, err := br.ReadString(0); err != nil {
+					return
+				}
+				var data []byte
+				for {
+					var n uint32
+					if err := binary.Read(br, binary.BigEndian, &n); err != nil {
+						return
+					}
+					if n == 0 {
+						break
+					}
+					buf := make([]byte, n)
+					if _, err := io.ReadFull(br, buf); err != nil {
+						return
+					}
+					data = append(data, buf...)
+				}
+				if bytes.Contains(data, []byte("virus-test-marker")) {
+					fmt.Fprint(conn, "stream: Test-Virus FOUND\x00")
+				} else {
+					fmt.Fprint(conn, "stream: OK\x00")
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// Test scanning of incoming and submitted messages for viruses.
+func TestContentScan(t *testing.T) {
+	resolver := &dns.MockResolver{
+		A: map[string][]string{
+			"example.org.": {"127.0.0.10"}, // For mx check.
+		},
+		TXT: map[string][]string{
+			"example.org.":        {"v=spf1 ip4:127.0.0.10 -all"},
+			"_dmarc.example.org.": {"v=DMARC1;p=reject"},
+		},
+		PTR: map[string][]string{
+			"127.0.0.10": {"example.org."}, // For iprev check.
+		},
+	}
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/junk/mox.conf"), resolver)
+	defer ts.close()
+
+	cs := &config.ContentScanner{Protocol: "clamd", Address: fakeClamd(t), Timeout: time.Second, MaxSize: 1024 * 1024}
+	mox.Conf.Static.ContentScanner = cs
+	defer func() {
+		mox.Conf.Static.ContentScanner = nil
+	}()
+
+	var msgID int
+	msg := func(body string) string {
+		msgID++
+		return strings.ReplaceAll(fmt.Sprintf(`From: <remote@example.org>
+To: <mjl@mox.example>
+Subject: test
+Message-Id: <test%d@example.org>
+
+%s
+`, msgID, body), "\n", "\r\n")
+	}
+
+	deliver := func(msg string, expErr *smtpclient.Error) {
+		t.Helper()
+		ts.run(func(client *smtpclient.Client) {
+			mailFrom := "remote@example.org"
+			rcptTo := "mjl@mox.example"
+			err := client.Deliver(ctxbg, mailFrom, rcptTo, int64(len(msg)), strings.NewReader(msg), false, false, false)
+			ts.smtpErr(err, expErr)
+		})
+	}
+	infected := &smtpclient.Error{Permanent: true, Code: smtp.C554TransactionFailed, Secode: smtp.SePol7Other0}
+
+	// Clean message is delivered, with header.
+	deliver(msg("clean"), nil)
+	ts.checkCount("Inbox", 1)
+	m, err := bstore.QueryDB[store.Message](ctxbg, ts.acc.DB).FilterEqual("Expunged", false).Get()
+	tcheck(t, err, "get message")
+	if !strings.Contains(string(m.MsgPrefix), "X-Mox-Content-Scan: mox.example; clamd=clean\r\n") {
+		t.Fatalf("missing content scan header in message prefix %q", m.MsgPrefix)
+	}
+
+	// Infected message is rejected.
+	deliver(msg("virus-test-marker"), infected)
+	ts.checkCount("Inbox", 1)
+
+	// With quarantine, infected message is also stored in Rejects mailbox.
+	cs.Quarantine = true
+	deliver(msg("virus-test-marker"), infected)
+	ts.checkCount("Inbox", 1)
+	ts.checkCount("Rejects", 1)
+
+	// Messages larger than max size are rejected when failing closed, and accepted
+	// without scanning when failing open.
+	cs.MaxSize = 10
+	deliver(msg("virus-test-marker"), &smtpclient.Error{Permanent: true, Code: smtp.C552MailboxFull, Secode: smtp.SeSys3MsgLimitExceeded4})
+	ts.checkCount("Inbox", 1)
+	cs.FailOpen = true
+	deliver(msg("virus-test-marker"), nil)
+	ts.checkCount("Inbox", 2)
+	cs.FailOpen = false
+	cs.MaxSize = 1024 * 1024
+
+	// Scanner not reachable, fail-closed and fail-open.
+	cs.Address = "127.0.0.1:1"
+	deliver(msg("clean"), &smtpclient.Error{Permanent: false, Code: smtp.C451LocalErr, Secode: smtp.SeSys3Other0})
+	ts.checkCount("Inbox", 2)
+	cs.FailOpen = true
+	deliver(msg("clean"), nil)
+	ts.checkCount("Inbox", 3)
+
+	// Submission of infected message is rejected, also with quarantine.
+	cs.Address = fakeClamd(t)
+	ts.submission = true
+	ts.user = "mjl@mox.example"
+	ts.pass = password0
+	submit := func(msg string, expErr *smtpclient.Error) {
+		t.Helper()
+		ts.run(func(client *smtpclient.Client) {
+			mailFrom := "mjl@mox.example"
+			rcptTo := "remote@example.org"
+			err := client.Deliver(ctxbg, mailFrom, rcptTo, int64(len(msg)), strings.NewReader(msg), false, false, false)
+			ts.smtpErr(err, expErr)
+		})
+	}
+	submitMsg := strings.ReplaceAll(submitMessage, "test email", "virus-test-marker")
+	submit(submitMsg, infected)
+	submit(submitMessage, nil)
+}
+
+// Test attachment rules of account and domain for incoming and submitted messages.
+func TestAttachmentPolicy(t *testing.T) {
+	resolver := &dns.MockResolver{
+		A: map[string][]string{
+			"example.org.": {"127.0.0.10"}, // For mx check.
+		},
+		TXT: map[string][]string{
+			"example.org.":        {"v=spf1 ip4:127.0.0.10 -all"},
+			"_dmarc.example.org.": {"v=DMARC1;p=reject"},
+		},
+		PTR: map[string][]string{
+			"127.0.0.10": {"example.org."}, // For iprev check.
+		},
+	}
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/junk/mox.conf"), resolver)
+	defer ts.close()
+
+	acc := mox.Conf.Dynamic.Accounts[ts.acc.Name]
+	acc.AttachmentRules = []config.AttachmentRule{
+		{Extensions: []string{".exe"}, Action: "reject"},
+		{Extensions: []string{".docm"}, Direction: "incoming", Action: "quarantine"},
+	}
+	mox.Conf.Dynamic.Accounts[ts.acc.Name] = acc
+	dom := mox.Conf.Dynamic.Domains["mox.example"]
+	dom.AttachmentRules = []config.AttachmentRule{
+		{Extensions: []string{".js"}, Action: "strip"},
+	}
+	mox.Conf.Dynamic.Domains["mox.example"] = dom
+	defer func() {
+		acc.AttachmentRules = nil
+		mox.Conf.Dynamic.Accounts[ts.acc.Name] = acc
+		dom.AttachmentRules = nil
+		mox.Conf.Dynamic.Domains["mox.example"] = dom
+	}()
+
+	var msgID int
+	msg := func(from, to, filename string) string {
+		msgID++
+		return strings.ReplaceAll(fmt.Sprintf(`From: <%s>
+To: <%s>
+Subject: test
+Message-Id: <test%d@example.org>
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary=x
+
+--x
+Content-Type: text/plain
+
+see attachment
+--x
+Content-Type: application/octet-stream
+Content-Disposition: attachment; filename="%s"
+Content-Transfer-Encoding: base64
+
+YWxlcnQoMSk=
+--x--
+`, from, to, msgID, filename), "\n", "\r\n")
+	}
+
+	deliver := func(msg string, expErr *smtpclient.Error) {
+		t.Helper()
+		ts.run(func(client *smtpclient.Client) {
+			mailFrom := "remote@example.org"
+			rcptTo := "mjl@mox.example"
+			err := client.Deliver(ctxbg, mailFrom, rcptTo, int64(len(msg)), strings.NewReader(msg), false, false, false)
+			ts.smtpErr(err, expErr)
+		})
+	}
+	rejected := &smtpclient.Error{Permanent: true, Code: smtp.C554TransactionFailed, Secode: smtp.SePol7DeliveryUnauth1}
+
+	// Allowed attachment is delivered as is.
+	deliver(msg("remote@example.org", "mjl@mox.example", "report.pdf"), nil)
+	ts.checkCount("Inbox", 1)
+
+	// Rejected, not stored in Rejects mailbox, which isn't created.
+	deliver(msg("remote@example.org", "mjl@mox.example", "report.pdf.exe"), rejected)
+	ts.checkCount("Inbox", 1)
+
+	// Quarantined, rejected but stored in Rejects mailbox.
+	deliver(msg("remote@example.org", "mjl@mox.example", "letter.docm"), rejected)
+	ts.checkCount("Inbox", 1)
+	ts.checkCount("Rejects", 1)
+
+	// Stripped attachment, message is delivered with notice.
+	deliver(msg("remote@example.org", "mjl@mox.example", "script.js"), nil)
+	ts.checkCount("Inbox", 2)
+	m, err := bstore.QueryDB[store.Message](ctxbg, ts.acc.DB).FilterEqual("Expunged", false).SortDesc("ID").Limit(1).Get()
+	tcheck(t, err, "get message")
+	buf, err := io.ReadAll(ts.acc.MessageReader(m))
+	tcheck(t, err, "read message")
+	if int64(len(buf)) != m.Size {
+		t.Fatalf("message has size %d, expected %d", len(buf), m.Size)
+	}
+	if strings.Contains(string(buf), "YWxlcnQoMSk=") || !strings.Contains(string(buf), "- script.js") {
+		t.Fatalf("attachment not stripped from message:\n%s", buf)
+	}
+
+	// Submissions, quarantine rule only applies to incoming messages.
+	ts.submission = true
+	ts.user = "mjl@mox.example"
+	ts.pass = password0
+	submit := func(msg string, expErr *smtpclient.Error) {
+		t.Helper()
+		ts.run(func(client *smtpclient.Client) {
+			mailFrom := "mjl@mox.example"
+			rcptTo := "remote@example.org"
+			err := client.Deliver(ctxbg, mailFrom, rcptTo, int64(len(msg)), strings.NewReader(msg), false, false, false)
+			ts.smtpErr(err, expErr)
+		})
+	}
+	submit(msg("mjl@mox.example", "remote@example.org", "report.pdf.exe"), rejected)
+	submit(msg("mjl@mox.example", "remote@example.org", "letter.docm"), nil)
+	submit(msg("mjl@mox.example", "remote@example.org", "script.js"), nil)
+}
+
+// Test greylisting of deliveries from senders without reputation.
+func TestGreylist(t *testing.T) {
+	resolver := &dns.MockResolver{
+		A: map[string][]string{
+			"example.org.": {"127.0.0.10"}, // For mx check.
+		},
+		TXT: map[string][]string{
+			"example.org.":        {"v=spf1 ip4:127.0.0.10 -all"},
+			"_dmarc.example.org.": {"v=DMARC1;p=reject"},
+		},
+		PTR: map[string][]string{
+			"127.0.0.10": {"example.org."}, // For iprev check.
+		},
+	}
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/mox.conf"), resolver)
+	ts.greylisting = &config.Greylisting{Enabled: true, Delay: 100 * time.Millisecond, RetryWindow: time.Hour, AllowDuration: time.Hour}
+	defer ts.close()
+
+	deliver := func(mailFrom string, expErr *smtpclient.Error) {
+		t.Helper()
+		ts.run(func(client *smtpclient.Client) {
+			rcptTo := "mjl@mox.example"
+			err := client.Deliver(ctxbg, mailFrom, rcptTo, int64(len(deliverMessage)), strings.NewReader(deliverMessage), false, false, false)
+			ts.smtpErr(err, expErr)
+		})
+	}
+	greylisted := &smtpclient.Error{Permanent: false, Code: smtp.C451LocalErr, Secode: smtp.SePol7DeliveryUnauth1}
+
+	// First attempt, and an immediate retry, are greylisted.
+	deliver("remote@example.org", greylisted)
+	deliver("remote@example.org", greylisted)
+	ts.checkCount("Inbox", 0)
+
+	// Retry after delay is accepted.
+	time.Sleep(150 * time.Millisecond)
+	deliver("remote@example.org", nil)
+	ts.checkCount("Inbox", 1)
+
+	// The SPF-verified domain is now allowlisted, also for other senders.
+	deliver("other@example.org", nil)
+	ts.checkCount("Inbox", 2)
+}
+
 // Test accepting a DMARC report.
 func TestDMARCReport(t *testing.T) {
 	resolver := &dns.MockResolver{
@@ -1426,7 +1874,7 @@ func TestNonSMTP(t *testing.T) {
 		tlsConfig := &tls.Config{
 			Certificates: []tls.Certificate{fakeCert(ts.t, false)},
 		}
-		serve("test", ts.cid-2, dns.Domain{ASCII: "mox.example"}, tlsConfig, serverConn, ts.resolver, ts.submission, false, false, false, 100<<20, false, false, false, ts.dnsbls, 0)
+		serve("test", ts.cid-2, dns.Domain{ASCII: "mox.example"}, tlsConfig, serverConn, ts.resolver, ts.submission, false, false, false, 100<<20, false, false, false, ts.dnsbls, ts.localLists, ts.uribl, 0, ts.greylisting)
 		close(serverdone)
 	}()
 
@@ -1484,6 +1932,19 @@ func TestLimitOutgoing(t *testing.T) {
 	testSubmit("b@other.example", nil)
 	testSubmit("b@other.example", nil)
 	testSubmit("b@other.example", &smtpclient.Error{Code: smtp.C451LocalErr, Secode: smtp.SePol7DeliveryUnauth1}) // Would be 5th message.
+
+	// Send limits, with counts of messages submitted above.
+	acc := mox.Conf.Dynamic.Accounts[ts.acc.Name]
+	acc.MaxOutgoingMessagesPerDay = 0
+	acc.SendLimits = &config.SendLimits{Submission: config.SendLimitCounts{MessagesPerHour: 5}}
+	mox.Conf.Dynamic.Accounts[ts.acc.Name] = acc
+	testSubmit("b@other.example", nil)
+	testSubmit("b@other.example", &smtpclient.Error{Code: smtp.C451LocalErr, Secode: smtp.SePol7DeliveryUnauth1}) // Would be 6th message.
+
+	// Daily limits are rejected with a permanent error.
+	acc.SendLimits = &config.SendLimits{Submission: config.SendLimitCounts{MessagesPerDay: 5}}
+	mox.Conf.Dynamic.Accounts[ts.acc.Name] = acc
+	testSubmit("b@other.example", &smtpclient.Error{Permanent: true, Code: smtp.C550MailboxUnavail, Secode: smtp.SePol7DeliveryUnauth1})
 }
 
 // Test account size limit enforcement.
@@ -0,0 +1,209 @@
+package smtpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/dnsbl"
+	"github.com/mjl-/mox/message"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/publicsuffix"
+)
+
+// uriblConfig is the configuration for checking domains of links in messages
+// against URIBLs, from the listener.
+type uriblConfig struct {
+	zones      []dns.Domain
+	reject     bool // Reject instead of stricter junk filtering.
+	maxLookups int  // Per zone, per message.
+}
+
+var uriblHealth = struct {
+	sync.Mutex
+	zones map[dns.Domain]dnsblStatus
+}{
+	zones: map[dns.Domain]dnsblStatus{},
+}
+
+// checkURIBLHealth checks healthiness of URIBL "zone", keeping the result cached
+// for 4 hours.
+func checkURIBLHealth(ctx context.Context, log mlog.Log, resolver dns.Resolver, zone dns.Domain) (rok bool) {
+	uriblHealth.Lock()
+	defer uriblHealth.Unlock()
+	status, ok := uriblHealth.zones[zone]
+	if !ok || time.Since(status.last) > 4*time.Hour {
+		status.err = dnsbl.CheckDomainHealth(ctx, log.Logger, resolver, zone)
+		status.last = time.Now()
+		uriblHealth.zones[zone] = status
+	}
+	return status.err == nil || errors.Is(status.err, dnsbl.ErrDNS)
+}
+
+// Cache of URIBL lookup results. Many messages from a spam run link to the same
+// domains, we don't want to look them up for each message. Temporary errors are
+// not cached.
+var uriblCache = struct {
+	sync.Mutex
+	results map[uriblKey]uriblResult
+}{
+	results: map[uriblKey]uriblResult{},
+}
+
+type uriblKey struct {
+	zone   dns.Domain
+	domain dns.Domain
+}
+
+type uriblResult struct {
+	expires     time.Time
+	listed      bool
+	explanation string
+}
+
+const (
+	uriblCacheTTL = time.Hour
+	uriblCacheMax = 10000
+)
+
+// uriblLookup returns whether domain is listed in the URIBL zone, using the cache.
+func uriblLookup(ctx context.Context, log mlog.Log, resolver dns.Resolver, zone, domain dns.Domain) (listed bool, explanation string) {
+	key := uriblKey{zone, domain}
+	now := time.Now()
+
+	uriblCache.Lock()
+	r, ok := uriblCache.results[key]
+	uriblCache.Unlock()
+	if ok && now.Before(r.expires) {
+		return r.listed, r.explanation
+	}
+
+	status, expl, err := dnsbl.LookupDomain(ctx, log.Logger, resolver, zone, domain)
+	if err != nil {
+		log.Infox("uribl lookup", err, slog.Any("zone", zone), slog.Any("domain", domain), slog.Any("status", status))
+		return false, ""
+	}
+	r = uriblResult{now.Add(uriblCacheTTL), status == dnsbl.StatusFail, expl}
+
+	uriblCache.Lock()
+	defer uriblCache.Unlock()
+	if len(uriblCache.results) >= uriblCacheMax {
+		for k, v := range uriblCache.results {
+			if now.After(v.expires) {
+				delete(uriblCache.results, k)
+			}
+		}
+		if len(uriblCache.results) >= uriblCacheMax {
+			clear(uriblCache.results)
+		}
+	}
+	uriblCache.results[key] = r
+	return r.listed, r.explanation
+}
+
+// Matches URLs, and host names starting with "www.", capturing the host name.
+var linkRegexp = regexp.MustCompile(`(?i)(?:\b(?:https?|ftp)://(?:[^\s/?#@<>"'\\]*@)?|\b(www\.))([\p{L}\p{N}][-\p{L}\p{N}.]*)`)
+
+// Maximum number of bytes read from a text part when looking for links.
+const maxLinkPartSize = 1024 * 1024
+
+// messageLinkDomains returns the domains of links in the text and HTML parts of
+// the message, in order of appearance, without duplicates. IP addresses are
+// skipped.
+func messageLinkDomains(log mlog.Log, part message.Part) []dns.Domain {
+	if err := part.Walk(log.Logger, nil); err != nil {
+		// We continue with what we could parse.
+		log.Debugx("parsing message for links", err)
+	}
+
+	var l []dns.Domain
+	seen := map[dns.Domain]bool{}
+	var walk func(p *message.Part)
+	walk = func(p *message.Part) {
+		if p.MediaType == "" || p.MediaType == "TEXT" && (p.MediaSubType == "PLAIN" || p.MediaSubType == "HTML") {
+			buf, err := io.ReadAll(io.LimitReader(p.ReaderUTF8OrBinary(), maxLinkPartSize))
+			if err != nil {
+				log.Debugx("reading text part for links", err)
+			}
+			s := string(buf)
+			if p.MediaSubType == "HTML" {
+				// Links in HTML can have escaped characters, e.g. "&#46;" for a dot.
+				s = html.UnescapeString(s)
+			}
+			for _, m := range linkRegexp.FindAllStringSubmatch(s, -1) {
+				host := strings.TrimRight(m[1]+m[2], ".-")
+				if !strings.Contains(host, ".") {
+					continue
+				}
+				d, err := dns.ParseDomain(host)
+				if err != nil || seen[d] {
+					continue
+				}
+				seen[d] = true
+				l = append(l, d)
+			}
+		}
+		for i := range p.Parts {
+			walk(&p.Parts[i])
+		}
+	}
+	walk(&part)
+	return l
+}
+
+// uriblListed looks up the domains of links in the message in the configured
+// URIBLs, and returns whether a domain is listed, with a description for the
+// reason text. For each link, both the organizational domain and the host name are
+// looked up. Links to our own domains are skipped.
+func uriblListed(ctx context.Context, log mlog.Log, resolver dns.Resolver, d delivery) (bool, string) {
+	var names []dns.Domain
+	seen := map[dns.Domain]bool{}
+	for _, dom := range d.linkDomains() {
+		org := publicsuffix.Lookup(ctx, log.Logger, dom)
+		if _, ok := mox.Conf.Domain(org); ok {
+			continue
+		}
+		for _, name := range []dns.Domain{org, dom} {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return false, ""
+	}
+	if len(names) > d.uribl.maxLookups {
+		log.Debug("limiting number of uribl lookups", slog.Int("domains", len(names)), slog.Int("max", d.uribl.maxLookups))
+		names = names[:d.uribl.maxLookups]
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	// Note: We don't check in parallel, we are in no hurry to accept possible spam.
+	for _, zone := range d.uribl.zones {
+		if !checkURIBLHealth(ctx, log, resolver, zone) {
+			log.Info("uribl not healthy, skipping", slog.Any("zone", zone))
+			continue
+		}
+		for _, name := range names {
+			if listed, expl := uriblLookup(ctx, log, resolver, zone, name); listed {
+				text := fmt.Sprintf("domain %s listed in uribl %s", name.XName(d.smtputf8), zone.XName(d.smtputf8))
+				if expl != "" {
+					text += ": " + expl
+				}
+				return true, text
+			}
+		}
+	}
+	return false, ""
+}
@@ -0,0 +1,51 @@
+package smtpserver
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/message"
+	"github.com/mjl-/mox/mlog"
+)
+
+func TestMessageLinkDomains(t *testing.T) {
+	log := mlog.New("smtpserver", nil)
+
+	msg := strings.ReplaceAll(`From: <remote@example.org>
+To: <mjl@mox.example>
+Subject: test
+MIME-Version: 1.0
+Content-Type: multipart/alternative; boundary=x
+
+--x
+Content-Type: text/plain
+
+Visit https://user@One.Example/path, or www.two.example. Not: 192.0.2.1,
+http://192.0.2.1/, https://localhost/ or two.example without scheme.
+--x
+Content-Type: text/html
+
+<a href="http://three&#46;example:8080/?x=1">link</a> <img src="https://one.example/x.png">
+<a href="https://xn--74h.example/">unicode</a>
+--x
+Content-Type: application/octet-stream
+
+https://four.example/
+--x--
+`, "\n", "\r\n")
+
+	part, err := message.Parse(log.Logger, false, strings.NewReader(msg))
+	tcheck(t, err, "parse message")
+	l := messageLinkDomains(log, part)
+	var names []string
+	for _, d := range l {
+		names = append(names, d.ASCII)
+	}
+	exp := []string{"one.example", "www.two.example", "three.example", "xn--74h.example"}
+	tcompare(t, names, exp)
+
+	dom, err := dns.ParseDomain("☺.example")
+	tcheck(t, err, "parse domain")
+	tcompare(t, l[3], dom)
+}
@@ -28,6 +28,7 @@ import (
 	"crypto/sha1"
 	"crypto/sha256"
 	"encoding"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -519,6 +520,16 @@ type Message struct {
 	OrigEHLODomain  string
 	OrigDKIMDomains []string
 
+	// Result of BIMI verification for the domain of the message From header, e.g.
+	// "pass", "none" or "fail". Empty if not evaluated. For "pass",
+	// BIMIIndicatorHash references the BIMIIndicator with the SVG Tiny PS logo, shown
+	// in the webmail message list.
+	BIMI              string
+	BIMIIndicatorHash string `json:"-"`
+
+	// BIMI logo for a message being delivered, stored as BIMIIndicator by MessageAdd.
+	BIMILogo []byte `bstore:"-" json:"-"`
+
 	// Canonicalized Message-Id, always lower-case and normalized quoting, without
 	// <>'s. Empty if missing. Used for matching message threads, and to prevent
 	// duplicate reject delivery.
@@ -794,6 +805,7 @@ type RecipientDomainTLS struct {
 type DiskUsage struct {
 	ID          int64 // Always one record with ID 1.
 	MessageSize int64 // Sum of all messages, for quota accounting.
+	DAVSize     int64 // Sum of data of calendar and contact objects, also counted towards quota.
 }
 
 // SessionToken and CSRFToken are types to prevent mixing them up.
@@ -908,6 +920,14 @@ type MessageErase struct {
 	SkipUpdateDiskUsage bool
 }
 
+// BIMIIndicator is a BIMI logo, verified during delivery. Many messages have the
+// same logo, it is stored once and referenced by Message.BIMIIndicatorHash.
+// Indicators are kept when messages are removed.
+type BIMIIndicator struct {
+	Hash string // Hex SHA-256 of Logo.
+	Logo []byte `bstore:"nonzero"` // SVG Tiny PS.
+}
+
 // Types stored in DB.
 var DBTypes = []any{
 	NextUIDValidity{},
@@ -930,6 +950,17 @@ var DBTypes = []any{
 	RulesetNoMailbox{},
 	Annotation{},
 	MessageErase{},
+	APIKey{},
+	AppPassword{},
+	TOTP{},
+	RecoveryCode{},
+	WebAuthnCredential{},
+	SearchWord{},
+	SearchPosting{},
+	SearchIndexed{},
+	DAVCollection{},
+	DAVObject{},
+	BIMIIndicator{},
 }
 
 // Account holds the information about a user, includings mailboxes, messages, imap subscriptions.
@@ -1244,6 +1275,9 @@ func OpenAccountDB(log mlog.Log, accountDir, accountName string) (a *Account, re
 			if err := tx.Update(&m); err != nil {
 				return fmt.Errorf("save erase of message %d in database: %w", m.ID, err)
 			}
+			if err := searchIndexRemove(tx, m.ID); err != nil {
+				return fmt.Errorf("removing erased message %d from search index: %w", m.ID, err)
+			}
 		}
 
 		if duChanged {
@@ -1916,7 +1950,7 @@ func (a *Account) CheckConsistency() error {
 
 		// If configured, we'll be building up the junk filter for the messages, to compare
 		// against the on-disk junk filter.
-		var jf *junk.Filter
+		var jf junk.Classifier
 		conf, _ := a.Conf()
 		if conf.JunkFilter != nil {
 			random := make([]byte, 16)
@@ -2069,7 +2103,7 @@ func (a *Account) CheckConsistency() error {
 
 		// Compare on-disk junk filter with our recalculated filter.
 		if jf != nil {
-			load := func(f *junk.Filter) (map[junk.Wordscore]struct{}, error) {
+			load := func(f junk.Classifier) (map[junk.Wordscore]struct{}, error) {
 				words := map[junk.Wordscore]struct{}{}
 				err := bstore.QueryDB[junk.Wordscore](ctx, f.DB()).ForEach(func(w junk.Wordscore) error {
 					if w.Ham != 0 || w.Spam != 0 {
@@ -2219,7 +2253,7 @@ type AddOpts struct {
 
 	// If JunkFilter is set, it is used for training. If not set, and the filter must
 	// be trained for a message, the junk filter is opened, modified and saved to disk.
-	JunkFilter *junk.Filter
+	JunkFilter junk.Classifier
 
 	SkipTraining bool
 
@@ -2275,7 +2309,7 @@ func (a *Account) MessageAdd(log mlog.Log, tx *bstore.Tx, mb *Mailbox, m *Messag
 
 		if !opts.SkipCheckQuota {
 			maxSize := a.QuotaMessageSize()
-			if maxSize > 0 && m.Size > maxSize-du.MessageSize {
+			if maxSize > 0 && m.Size > maxSize-du.MessageSize-du.DAVSize {
 				return fmt.Errorf("%w: max size %d bytes", ErrOverQuota, maxSize)
 			}
 		}
@@ -2324,6 +2358,19 @@ func (a *Account) MessageAdd(log mlog.Log, tx *bstore.Tx, mb *Mailbox, m *Messag
 		mb.Keywords, _ = MergeKeywords(mb.Keywords, m.Keywords)
 	}
 
+	if len(m.BIMILogo) > 0 {
+		h := sha256.Sum256(m.BIMILogo)
+		bi := BIMIIndicator{Hash: hex.EncodeToString(h[:]), Logo: m.BIMILogo}
+		if err := tx.Get(&BIMIIndicator{Hash: bi.Hash}); err == bstore.ErrAbsent {
+			if err := tx.Insert(&bi); err != nil {
+				return fmt.Errorf("inserting bimi indicator: %v", err)
+			}
+		} else if err != nil {
+			return fmt.Errorf("get bimi indicator: %v", err)
+		}
+		m.BIMIIndicatorHash = bi.Hash
+	}
+
 	conf, _ := a.Conf()
 	m.JunkFlagsForMailbox(*mb, conf)
 
@@ -2414,6 +2461,12 @@ func (a *Account) MessageAdd(log mlog.Log, tx *bstore.Tx, mb *Mailbox, m *Messag
 		}
 	}
 
+	if getPart() != nil {
+		if err := searchIndexMessage(log, tx, m.ID, part); err != nil {
+			return fmt.Errorf("adding message to search index: %w", err)
+		}
+	}
+
 	// todo: perhaps we should match the recipients based on smtp submission and a matching message-id? we now miss the addresses in bcc's if the mail client doesn't save a message that includes the bcc header in the sent mailbox.
 	if mb.Sent && getPart() != nil && part.Envelope != nil {
 		e := part.Envelope
@@ -2535,55 +2588,13 @@ func (a *Account) SetPassword(log mlog.Log, password string) error {
 		return fmt.Errorf("password must be at least 8 characters long")
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return fmt.Errorf("generating password hash: %w", err)
-	}
-
 	err = a.DB.Write(context.TODO(), func(tx *bstore.Tx) error {
 		if _, err := bstore.QueryTx[Password](tx).Delete(); err != nil {
 			return fmt.Errorf("deleting existing password: %v", err)
 		}
-		var pw Password
-		pw.Hash = string(hash)
-
-		// CRAM-MD5 calculates an HMAC-MD5, with the password as key, over a per-attempt
-		// unique text that includes a timestamp. HMAC performs two hashes. Both times, the
-		// first block is based on the key/password. We hash those first blocks now, and
-		// store the hash state in the database. When we actually authenticate, we'll
-		// complete the HMAC by hashing only the text. We cannot store crypto/hmac's hash,
-		// because it does not expose its internal state and isn't a BinaryMarshaler.
-		// ../rfc/2104:121
-		pw.CRAMMD5.Ipad = md5.New()
-		pw.CRAMMD5.Opad = md5.New()
-		key := []byte(password)
-		if len(key) > 64 {
-			t := md5.Sum(key)
-			key = t[:]
-		}
-		ipad := make([]byte, md5.BlockSize)
-		opad := make([]byte, md5.BlockSize)
-		copy(ipad, key)
-		copy(opad, key)
-		for i := range ipad {
-			ipad[i] ^= 0x36
-			opad[i] ^= 0x5c
-		}
-		pw.CRAMMD5.Ipad.Write(ipad)
-		pw.CRAMMD5.Opad.Write(opad)
-
-		pw.SCRAMSHA1.Salt = scram.MakeRandom()
-		pw.SCRAMSHA1.Iterations = 2 * 4096
-		pw.SCRAMSHA1.SaltedPassword, err = scram.SaltPassword(sha1.New, password, pw.SCRAMSHA1.Salt, pw.SCRAMSHA1.Iterations)
-		if err != nil {
-			return fmt.Errorf("scram sha1 salt password: %w", err)
-		}
-
-		pw.SCRAMSHA256.Salt = scram.MakeRandom()
-		pw.SCRAMSHA256.Iterations = 4096
-		pw.SCRAMSHA256.SaltedPassword, err = scram.SaltPassword(sha256.New, password, pw.SCRAMSHA256.Salt, pw.SCRAMSHA256.Iterations)
+		pw, err := derivePassword(password)
 		if err != nil {
-			return fmt.Errorf("scram sha256 salt password: %w", err)
+			return err
 		}
 
 		if err := tx.Insert(&pw); err != nil {
@@ -2598,6 +2609,59 @@ func (a *Account) SetPassword(log mlog.Log, password string) error {
 	return err
 }
 
+// derivePassword returns the bcrypt hash and the derived secrets for
+// authentication mechanisms for a precis-normalized password, with new random
+// SCRAM salts.
+func derivePassword(password string) (Password, error) {
+	var pw Password
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return pw, fmt.Errorf("generating password hash: %w", err)
+	}
+	pw.Hash = string(hash)
+
+	// CRAM-MD5 calculates an HMAC-MD5, with the password as key, over a per-attempt
+	// unique text that includes a timestamp. HMAC performs two hashes. Both times, the
+	// first block is based on the key/password. We hash those first blocks now, and
+	// store the hash state in the database. When we actually authenticate, we'll
+	// complete the HMAC by hashing only the text. We cannot store crypto/hmac's hash,
+	// because it does not expose its internal state and isn't a BinaryMarshaler.
+	// ../rfc/2104:121
+	pw.CRAMMD5.Ipad = md5.New()
+	pw.CRAMMD5.Opad = md5.New()
+	key := []byte(password)
+	if len(key) > 64 {
+		t := md5.Sum(key)
+		key = t[:]
+	}
+	ipad := make([]byte, md5.BlockSize)
+	opad := make([]byte, md5.BlockSize)
+	copy(ipad, key)
+	copy(opad, key)
+	for i := range ipad {
+		ipad[i] ^= 0x36
+		opad[i] ^= 0x5c
+	}
+	pw.CRAMMD5.Ipad.Write(ipad)
+	pw.CRAMMD5.Opad.Write(opad)
+
+	pw.SCRAMSHA1.Salt = scram.MakeRandom()
+	pw.SCRAMSHA1.Iterations = 2 * 4096
+	pw.SCRAMSHA256.Salt = scram.MakeRandom()
+	pw.SCRAMSHA256.Iterations = 4096
+
+	pw.SCRAMSHA1.SaltedPassword, err = scram.SaltPassword(sha1.New, password, pw.SCRAMSHA1.Salt, pw.SCRAMSHA1.Iterations)
+	if err != nil {
+		return pw, fmt.Errorf("scram sha1 salt password: %w", err)
+	}
+	pw.SCRAMSHA256.SaltedPassword, err = scram.SaltPassword(sha256.New, password, pw.SCRAMSHA256.Salt, pw.SCRAMSHA256.Iterations)
+	if err != nil {
+		return pw, fmt.Errorf("scram sha256 salt password: %w", err)
+	}
+	return pw, nil
+}
+
 // SessionsClear invalidates all (web) login sessions for the account.
 func (a *Account) SessionsClear(ctx context.Context, log mlog.Log) error {
 	return a.DB.Write(ctx, func(tx *bstore.Tx) error {
@@ -2988,7 +3052,7 @@ func (a *Account) DeliverMailbox(log mlog.Log, mailbox string, m *Message, msgFi
 }
 
 type RemoveOpts struct {
-	JunkFilter *junk.Filter // If set, this filter is used for training, instead of opening and saving the junk filter.
+	JunkFilter junk.Classifier // If set, this filter is used for training, instead of opening and saving the junk filter.
 }
 
 // MessageRemove markes messages as expunged, updates mailbox counts for the
@@ -3218,7 +3282,8 @@ func (a *Account) QuotaMessageSize() int64 {
 }
 
 // CanAddMessageSize checks if a message of size bytes can be added, depending on
-// total message size and configured quota for account.
+// total message size, size of calendar and contact objects, and configured quota
+// for account. Also used for adding calendar and contact objects.
 func (a *Account) CanAddMessageSize(tx *bstore.Tx, size int64) (ok bool, maxSize int64, err error) {
 	maxSize = a.QuotaMessageSize()
 	if maxSize <= 0 {
@@ -3229,7 +3294,7 @@ func (a *Account) CanAddMessageSize(tx *bstore.Tx, size int64) (ok bool, maxSize
 	if err := tx.Get(&du); err != nil {
 		return false, maxSize, fmt.Errorf("get diskusage: %v", err)
 	}
-	return du.MessageSize+size <= maxSize, maxSize, nil
+	return du.MessageSize+du.DAVSize+size <= maxSize, maxSize, nil
 }
 
 // We keep a cache of recent successful authentications, so we don't have to bcrypt successful calls each time.
@@ -77,6 +77,9 @@ func TestMailbox(t *testing.T) {
 	m.ThreadCollapsed = true
 	var mbsent Mailbox
 	mreject := m
+	// Messages with the same BIMI logo reference a single stored indicator.
+	msent.BIMILogo = []byte("<svg/>")
+	mreject.BIMILogo = msent.BIMILogo
 	mconsumed := Message{
 		Received:  m.Received,
 		Size:      int64(len(msgPrefixCatchall)) + msgWriter.Size,
@@ -117,6 +120,12 @@ func TestMailbox(t *testing.T) {
 		})
 		tcheck(t, err, "deliver as sent and rejects")
 
+		n, err := bstore.QueryDB[BIMIIndicator](ctxbg, acc.DB).Count()
+		tcheck(t, err, "count bimi indicators")
+		if n != 1 || msent.BIMIIndicatorHash == "" || msent.BIMIIndicatorHash != mreject.BIMIIndicatorHash {
+			t.Fatalf("got %d bimi indicators, hashes %q and %q, expected 1 indicator referenced by both messages", n, msent.BIMIIndicatorHash, mreject.BIMIIndicatorHash)
+		}
+
 		err = acc.DeliverDestination(log, conf.Destinations["mjl"], &mconsumed, msgFile)
 		tcheck(t, err, "deliver with consume")
 
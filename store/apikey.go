@@ -0,0 +1,208 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/mlog"
+)
+
+// APIKeyPrefix is the start of each API key. It allows recognizing API keys, e.g.
+// in the password field of HTTP basic authentication, and when scanning for leaked
+// secrets.
+const APIKeyPrefix = "moxapi-"
+
+// Scopes for API keys. An API key can have one or more scopes, each giving access
+// to a group of webapi methods.
+const (
+	APIScopeSend        = "send"        // Sending messages.
+	APIScopeRead        = "read"        // Listing, searching and retrieving messages and mailboxes, and receiving events.
+	APIScopeManage      = "manage"      // Adding, changing, moving and removing messages and mailboxes, and acknowledging events.
+	APIScopeSuppression = "suppression" // Managing the suppression list.
+)
+
+// APIScopes is the list of all valid scopes.
+var APIScopes = []string{APIScopeSend, APIScopeRead, APIScopeManage, APIScopeSuppression}
+
+var ErrAPIKeyNotAllowed = errors.New("api key not allowed")
+
+// APIKey is a key for authenticating to the webapi as an alternative to the
+// account password. Only a hash of the key is stored, the key itself is only
+// returned when it is added.
+type APIKey struct {
+	ID      int64
+	Created time.Time `bstore:"nonzero,default now"`
+
+	// Descriptive name to identify the key, e.g. the application it is used in.
+	Name string `bstore:"nonzero"`
+
+	// First characters of the key, for identifying the key.
+	Prefix string `bstore:"nonzero"`
+
+	// Raw-url-base64-encoded SHA-256 hash of the full key.
+	Hash string `bstore:"nonzero,unique" json:"-"`
+
+	// Scopes this key can be used for, see APIScopes.
+	Scopes []string `bstore:"nonzero"`
+
+	// If set, the key cannot be used after this time.
+	Expires *time.Time
+
+	// If non-empty, the key can only be used from IPs within these ranges, in CIDR
+	// notation, e.g. "192.0.2.0/24" or "2001:db8::1/128".
+	IPRanges []string
+
+	// Time of last use, nil if never used.
+	LastUsed *time.Time
+
+	// IP of last use, empty if never used.
+	LastUsedIP string
+}
+
+// HasScope returns whether the key has the scope.
+func (k APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// CheckAPIKey checks the fields that can be set by users.
+func CheckAPIKey(k APIKey) error {
+	if strings.TrimSpace(k.Name) == "" {
+		return fmt.Errorf("name required")
+	}
+	if len(k.Scopes) == 0 {
+		return fmt.Errorf("at least one scope required")
+	}
+	for _, s := range k.Scopes {
+		if !slices.Contains(APIScopes, s) {
+			return fmt.Errorf("unknown scope %q, must be one of %s", s, strings.Join(APIScopes, ", "))
+		}
+	}
+	for _, s := range k.IPRanges {
+		if _, _, err := net.ParseCIDR(s); err != nil {
+			return fmt.Errorf("parsing ip range %q: %v", s, err)
+		}
+	}
+	return nil
+}
+
+func apiKeyHash(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// APIKeyAdd generates a new API key and adds it to the account. The Name,
+// Scopes, Expires and IPRanges fields of k are used. The returned key is only
+// available once, only its hash is stored.
+func (a *Account) APIKeyAdd(ctx context.Context, k APIKey) (APIKey, string, error) {
+	if err := CheckAPIKey(k); err != nil {
+		return APIKey{}, "", err
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return APIKey{}, "", fmt.Errorf("generating key: %v", err)
+	}
+	key := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(buf)
+
+	nk := APIKey{
+		Name:     strings.TrimSpace(k.Name),
+		Prefix:   key[:len(APIKeyPrefix)+6],
+		Hash:     apiKeyHash(key),
+		Scopes:   k.Scopes,
+		Expires:  k.Expires,
+		IPRanges: k.IPRanges,
+	}
+	if err := a.DB.Insert(ctx, &nk); err != nil {
+		return APIKey{}, "", fmt.Errorf("inserting api key: %v", err)
+	}
+	return nk, key, nil
+}
+
+// APIKeyList returns all API keys for the account.
+func (a *Account) APIKeyList(ctx context.Context) ([]APIKey, error) {
+	return bstore.QueryDB[APIKey](ctx, a.DB).SortAsc("ID").List()
+}
+
+// APIKeyRemove removes an API key by ID. If absent, bstore.ErrAbsent is
+// returned.
+func (a *Account) APIKeyRemove(ctx context.Context, id int64) error {
+	return a.DB.Delete(ctx, &APIKey{ID: id})
+}
+
+// OpenEmailAPIKey opens an account given an email address and API key, used
+// from remoteIP. The last use of the key is recorded.
+//
+// The email address may contain a catchall separator. For unknown keys,
+// ErrUnknownCredentials is returned. For keys that have expired or that are used
+// from an IP that is not allowed, an error wrapping ErrAPIKeyNotAllowed is
+// returned. For invalid credentials, a nil account is returned, but accName may
+// be non-empty.
+func OpenEmailAPIKey(ctx context.Context, log mlog.Log, email, key string, remoteIP net.IP, checkLoginDisabled bool) (racc *Account, raccName string, rk APIKey, rerr error) {
+	// Like OpenEmailAuth, we check for LoginDisabled after verifying the key.
+	acc, accName, _, err := OpenEmail(log, email, false)
+	if err != nil {
+		return nil, "", APIKey{}, err
+	}
+
+	defer func() {
+		if rerr != nil {
+			err := acc.Close()
+			log.Check(err, "closing account after open api key failure")
+			racc = nil
+		}
+	}()
+
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return acc, accName, APIKey{}, ErrUnknownCredentials
+	}
+
+	var k APIKey
+	err = acc.DB.Write(ctx, func(tx *bstore.Tx) error {
+		q := bstore.QueryTx[APIKey](tx)
+		q.FilterNonzero(APIKey{Hash: apiKeyHash(key)})
+		var err error
+		k, err = q.Get()
+		if err == bstore.ErrAbsent {
+			return ErrUnknownCredentials
+		} else if err != nil {
+			return fmt.Errorf("looking up api key: %v", err)
+		}
+
+		now := time.Now()
+		if k.Expires != nil && now.After(*k.Expires) {
+			return fmt.Errorf("%w: expired", ErrAPIKeyNotAllowed)
+		} else if !ipRangesAllow(k.IPRanges, remoteIP) {
+			return fmt.Errorf("%w: not allowed from ip %s", ErrAPIKeyNotAllowed, remoteIP)
+		}
+
+		k.LastUsed = &now
+		k.LastUsedIP = remoteIP.String()
+		if err := tx.Update(&k); err != nil {
+			return fmt.Errorf("updating last use of api key: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return acc, accName, APIKey{}, err
+	}
+
+	if checkLoginDisabled {
+		conf, aok := acc.Conf()
+		if !aok {
+			return acc, accName, APIKey{}, fmt.Errorf("cannot find config for account")
+		} else if conf.LoginDisabled != "" {
+			return acc, accName, APIKey{}, fmt.Errorf("%w: %s", ErrLoginDisabled, conf.LoginDisabled)
+		}
+	}
+	return acc, accName, k, nil
+}
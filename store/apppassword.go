@@ -0,0 +1,378 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/text/secure/precis"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/mlog"
+)
+
+// Protocols that app passwords can be used for. They match the protocol of
+// LoginAttempt.
+const (
+	AppPasswordIMAP       = "imap"
+	AppPasswordSubmission = "submission"
+	AppPasswordWebAPI     = "webapi"
+	AppPasswordDAV        = "dav"
+)
+
+// AppPasswordProtocols is the list of all protocols that app passwords can be
+// restricted to.
+var AppPasswordProtocols = []string{AppPasswordIMAP, AppPasswordSubmission, AppPasswordWebAPI, AppPasswordDAV}
+
+// AppPassword is an application-specific password, an alternative to the main
+// account password for a single application, e.g. an email client on a phone.
+// App passwords are generated, restricted to protocols and optionally IP
+// ranges, and can be revoked individually. They cannot be used for logging in to
+// the web interfaces.
+//
+// App passwords start with a non-secret prefix, followed by a dash and the secret
+// part. During login, the prefix selects the app password to check, so a failed
+// login costs at most one password hash comparison for app passwords.
+//
+// Each app password has its own SCRAM salts. For SCRAM authentication, the server
+// must send a salt and iteration count before it knows which password the client
+// uses. So SCRAM authentication can only be done with the main password, or with
+// the first app password if the account has no password. Clients must use
+// authentication mechanisms like PLAIN (with TLS) for app passwords.
+type AppPassword struct {
+	ID      int64
+	Created time.Time `bstore:"nonzero,default now"`
+
+	// First group of letters of the app password, not secret. Unique within the
+	// account.
+	Prefix string `bstore:"index"`
+
+	// Descriptive name to identify the app password, e.g. the device or application
+	// it is used in.
+	Name string `bstore:"nonzero"`
+
+	// Protocols the app password can be used for, see AppPasswordProtocols.
+	Protocols []string `bstore:"nonzero"`
+
+	// If non-empty, the app password can only be used from IPs within these ranges,
+	// in CIDR notation.
+	IPRanges []string
+
+	// Hash and derived secrets, like for the main password.
+	Secrets Password `json:"-"`
+
+	// Time of last use, nil if never used.
+	LastUsed *time.Time
+
+	// IP of last use, empty if never used.
+	LastUsedIP string
+
+	// Protocol of last use, empty if never used.
+	LastUsedProtocol string
+}
+
+// Allowed returns whether the app password can be used for the protocol, from
+// remoteIP.
+func (ap AppPassword) Allowed(protocol string, remoteIP net.IP) bool {
+	return slices.Contains(ap.Protocols, protocol) && ipRangesAllow(ap.IPRanges, remoteIP)
+}
+
+// ipRangesAllow returns whether ip is within one of the ranges, in CIDR notation.
+// If ranges is empty, all IPs are allowed.
+func ipRangesAllow(ranges []string, ip net.IP) bool {
+	if len(ranges) == 0 {
+		return true
+	}
+	for _, s := range ranges {
+		_, ipnet, err := net.ParseCIDR(s)
+		if err == nil && ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckAppPassword checks the fields that can be set by users.
+func CheckAppPassword(ap AppPassword) error {
+	if strings.TrimSpace(ap.Name) == "" {
+		return fmt.Errorf("name required")
+	}
+	if len(ap.Protocols) == 0 {
+		return fmt.Errorf("at least one protocol required")
+	}
+	for _, s := range ap.Protocols {
+		if !slices.Contains(AppPasswordProtocols, s) {
+			return fmt.Errorf("unknown protocol %q, must be one of %s", s, strings.Join(AppPasswordProtocols, ", "))
+		}
+	}
+	for _, s := range ap.IPRanges {
+		if _, _, err := net.ParseCIDR(s); err != nil {
+			return fmt.Errorf("parsing ip range %q: %v", s, err)
+		}
+	}
+	return nil
+}
+
+// generateAppPassword returns a new random password of 5 groups of 4 lower case
+// letters, separated by dashes, for easy typing on phones. The first group is the
+// non-secret prefix, the other groups have about 75 bits of entropy.
+func generateAppPassword() (prefix, password string) {
+	password = randomLetterGroups(5, 4)
+	prefix, _, _ = strings.Cut(password, "-")
+	return prefix, password
+}
+
+// randomLetterGroups returns random lower case letters, in groups of size
+// separated by dashes.
+func randomLetterGroups(groups, size int) string {
+	const chars = "abcdefghijklmnopqrstuvwxyz"
+	var b strings.Builder
+	buf := make([]byte, 1)
+	for i := 0; i < groups*size; {
+		if _, err := rand.Read(buf); err != nil {
+			panic(fmt.Sprintf("reading random bytes: %v", err))
+		}
+		if int(buf[0]) >= 256-256%len(chars) {
+			continue // Prevent bias.
+		}
+		if i > 0 && i%size == 0 {
+			b.WriteByte('-')
+		}
+		b.WriteByte(chars[int(buf[0])%len(chars)])
+		i++
+	}
+	return b.String()
+}
+
+// AppPasswordAdd generates a new app password and adds it to the account. The
+// Name, Protocols and IPRanges fields of ap are used. The returned password is
+// only available once, only its hash and derived secrets are stored.
+func (a *Account) AppPasswordAdd(ctx context.Context, log mlog.Log, ap AppPassword) (AppPassword, string, error) {
+	if err := CheckAppPassword(ap); err != nil {
+		return AppPassword{}, "", err
+	}
+
+	var password string
+	nap := AppPassword{
+		Name:      strings.TrimSpace(ap.Name),
+		Protocols: ap.Protocols,
+		IPRanges:  ap.IPRanges,
+	}
+	err := a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		for {
+			nap.Prefix, password = generateAppPassword()
+			if exists, err := bstore.QueryTx[AppPassword](tx).FilterNonzero(AppPassword{Prefix: nap.Prefix}).Exists(); err != nil {
+				return fmt.Errorf("checking for app password with same prefix: %v", err)
+			} else if !exists {
+				break
+			}
+		}
+		var err error
+		nap.Secrets, err = derivePassword(password)
+		if err != nil {
+			return err
+		}
+		return tx.Insert(&nap)
+	})
+	if err != nil {
+		return AppPassword{}, "", err
+	}
+	log.Info("app password added", slog.String("account", a.Name), slog.String("name", nap.Name), slog.Any("protocols", nap.Protocols))
+	return nap, password, nil
+}
+
+// AppPasswordList returns all app passwords for the account.
+func (a *Account) AppPasswordList(ctx context.Context) ([]AppPassword, error) {
+	return bstore.QueryDB[AppPassword](ctx, a.DB).SortAsc("ID").List()
+}
+
+// AppPasswordRemove removes (revokes) an app password by ID. If absent,
+// bstore.ErrAbsent is returned.
+func (a *Account) AppPasswordRemove(ctx context.Context, id int64) error {
+	return a.DB.Delete(ctx, &AppPassword{ID: id})
+}
+
+// AppPasswordsAllowed returns the app passwords that can be used for the
+// protocol from remoteIP.
+func AppPasswordsAllowed(tx *bstore.Tx, protocol string, remoteIP net.IP) ([]AppPassword, error) {
+	q := bstore.QueryTx[AppPassword](tx)
+	q.FilterFn(func(ap AppPassword) bool {
+		return ap.Allowed(protocol, remoteIP)
+	})
+	q.SortAsc("ID")
+	return q.List()
+}
+
+// AppPasswordUsed records use of an app password. Errors are logged.
+func (a *Account) AppPasswordUsed(log mlog.Log, id int64, protocol string, remoteIP net.IP) {
+	err := a.DB.Write(context.TODO(), func(tx *bstore.Tx) error {
+		ap := AppPassword{ID: id}
+		if err := tx.Get(&ap); err != nil {
+			return err
+		}
+		now := time.Now()
+		ap.LastUsed = &now
+		ap.LastUsedIP = remoteIP.String()
+		ap.LastUsedProtocol = protocol
+		return tx.Update(&ap)
+	})
+	log.Check(err, "recording use of app password", slog.Int64("id", id))
+}
+
+// OpenEmailAuthProtocol opens an account given an email address and password,
+// like OpenEmailAuth, but also accepts app passwords that are allowed for
+// protocol and remoteIP. If an app password was used, its use is recorded and
+// its name returned.
+func OpenEmailAuthProtocol(log mlog.Log, email, password, protocol string, remoteIP net.IP, checkLoginDisabled bool) (racc *Account, raccName, appPasswordName string, rerr error) {
+	acc, accName, err := OpenEmailAuth(log, email, password, checkLoginDisabled)
+	if err == nil || !errors.Is(err, ErrUnknownCredentials) {
+		return acc, accName, "", err
+	}
+
+	acc, accName, _, err = OpenEmail(log, email, false)
+	if err != nil {
+		return nil, "", "", err
+	}
+	defer func() {
+		if rerr != nil {
+			err := acc.Close()
+			log.Check(err, "closing account after open auth failure")
+			racc = nil
+		}
+	}()
+
+	password, err = precis.OpaqueString.String(password)
+	if err != nil {
+		return acc, "", "", ErrUnknownCredentials
+	}
+	prefix, _, ok := strings.Cut(password, "-")
+	if !ok {
+		return acc, "", "", ErrUnknownCredentials
+	}
+
+	// The prefix selects the app password, we compare at most one hash.
+	var match AppPassword
+	err = acc.DB.Read(context.TODO(), func(tx *bstore.Tx) error {
+		q := bstore.QueryTx[AppPassword](tx)
+		q.FilterNonzero(AppPassword{Prefix: prefix})
+		q.FilterFn(func(ap AppPassword) bool {
+			return ap.Allowed(protocol, remoteIP)
+		})
+		match, err = q.Get()
+		return err
+	})
+	if err == bstore.ErrAbsent {
+		return acc, "", "", ErrUnknownCredentials
+	} else if err != nil {
+		return acc, "", "", fmt.Errorf("get app password: %v", err)
+	}
+	authCache.Lock()
+	ok = authCache.success[authKey{email, match.Secrets.Hash}] == password
+	authCache.Unlock()
+	if !ok && bcrypt.CompareHashAndPassword([]byte(match.Secrets.Hash), []byte(password)) != nil {
+		return acc, "", "", ErrUnknownCredentials
+	}
+	if checkLoginDisabled {
+		conf, aok := acc.Conf()
+		if !aok {
+			return acc, "", "", fmt.Errorf("cannot find config for account")
+		} else if conf.LoginDisabled != "" {
+			return acc, "", "", fmt.Errorf("%w: %s", ErrLoginDisabled, conf.LoginDisabled)
+		}
+	}
+	authCache.Lock()
+	authCache.success[authKey{email, match.Secrets.Hash}] = password
+	authCache.Unlock()
+	acc.AppPasswordUsed(log, match.ID, protocol, remoteIP)
+	return acc, accName, match.Name, nil
+}
+
+// AuthSecret holds the derived secrets of the main password or an app password,
+// for authentication mechanisms that don't send a plain text password.
+type AuthSecret struct {
+	Password
+
+	// Zero for the main password.
+	AppPasswordID   int64
+	AppPasswordName string
+}
+
+// AuthSecrets returns the secrets of the main password, if set, followed by
+// those of the app passwords that are allowed for protocol and remoteIP.
+func AuthSecrets(tx *bstore.Tx, protocol string, remoteIP net.IP) ([]AuthSecret, error) {
+	var l []AuthSecret
+	pw, err := bstore.QueryTx[Password](tx).Get()
+	if err == nil {
+		l = append(l, AuthSecret{Password: pw})
+	} else if err != bstore.ErrAbsent {
+		return nil, fmt.Errorf("get password: %v", err)
+	}
+	aps, err := AppPasswordsAllowed(tx, protocol, remoteIP)
+	if err != nil {
+		return nil, fmt.Errorf("listing app passwords: %v", err)
+	}
+	for _, ap := range aps {
+		l = append(l, AuthSecret{ap.Secrets, ap.ID, ap.Name})
+	}
+	return l, nil
+}
+
+// SCRAMCandidates returns the SCRAM salt and iterations to use for
+// authentication, with the salted passwords that can be verified with them. The
+// salt of the main password is used, or of the first app password if there is
+// no main password. App passwords have their own salts, so typically only a
+// single secret is returned. The returned secrets correspond to the salted
+// passwords.
+// Variant must be "sha1" or "sha256". If no SCRAM secrets are available, salt is
+// nil.
+func SCRAMCandidates(secrets []AuthSecret, variant string) (salt []byte, iterations int, saltedPasswords [][]byte, matching []AuthSecret) {
+	get := func(s AuthSecret) SCRAM {
+		if variant == "sha1" {
+			return s.SCRAMSHA1
+		}
+		return s.SCRAMSHA256
+	}
+	for _, s := range secrets {
+		xs := get(s)
+		if len(xs.Salt) == 0 || xs.Iterations == 0 || len(xs.SaltedPassword) == 0 {
+			continue
+		}
+		if salt == nil {
+			salt = xs.Salt
+			iterations = xs.Iterations
+		} else if !bytes.Equal(xs.Salt, salt) || xs.Iterations != iterations {
+			continue
+		}
+		saltedPasswords = append(saltedPasswords, xs.SaltedPassword)
+		matching = append(matching, s)
+	}
+	return
+}
+
+// CRAMMD5Match returns the secret for which the CRAM-MD5 response digest
+// (lower case hex) for challenge chal is valid, or nil. Secrets without CRAM-MD5
+// secrets are skipped.
+func CRAMMD5Match(secrets []AuthSecret, chal, digest string) *AuthSecret {
+	for i, s := range secrets {
+		ipadhash, opadhash := s.CRAMMD5.Ipad, s.CRAMMD5.Opad
+		if ipadhash == nil || opadhash == nil {
+			continue
+		}
+		// ../rfc/2195:138 ../rfc/2104:142
+		ipadhash.Write([]byte(chal))
+		opadhash.Write(ipadhash.Sum(nil))
+		if fmt.Sprintf("%x", opadhash.Sum(nil)) == digest {
+			return &secrets[i]
+		}
+	}
+	return nil
+}
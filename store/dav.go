@@ -0,0 +1,206 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/mjl-/bstore"
+)
+
+// Kinds of DAV collections.
+const (
+	DAVCalendar    = "calendar"
+	DAVAddressBook = "addressbook"
+)
+
+// DAVCollection is a calendar (CalDAV) or address book (CardDAV) of an account.
+type DAVCollection struct {
+	ID      int64
+	Created time.Time `bstore:"nonzero,default now"`
+
+	// DAVCalendar or DAVAddressBook.
+	Kind string `bstore:"nonzero,unique Kind+Name"`
+
+	// Name as used in the URL path. Only letters, digits, dash, underscore and dot.
+	Name string `bstore:"nonzero"`
+
+	DisplayName string
+	Description string
+	Color       string // For calendars, e.g. "#0088ccff", as used by Apple clients.
+
+	// For calendars, the component types that can be stored, e.g. VEVENT, VTODO.
+	Components []string
+
+	// Incremented for each change to objects in the collection. Objects get the new
+	// value as their ModSeq. Used for sync tokens and etags.
+	ModSeq int64
+}
+
+// DAVObject is a calendar object (iCalendar data) or address object (vCard
+// data) in a DAVCollection. Removed objects are kept as tombstone, with Expunged
+// set and no data, so clients can synchronize removals.
+type DAVObject struct {
+	ID           int64
+	CollectionID int64 `bstore:"nonzero,ref DAVCollection,unique CollectionID+Name,index CollectionID+ModSeq"`
+
+	// Resource name in the URL path of the collection, e.g. "abc.ics".
+	Name string `bstore:"nonzero"`
+
+	// UID from the iCalendar or vCard data, unique within a collection. Can be empty
+	// for vCards.
+	UID string `bstore:"index UID+CollectionID"`
+
+	// For calendar objects, the main component type, e.g. VEVENT, for address objects
+	// VCARD.
+	Component string
+
+	ModSeq   int64     `bstore:"nonzero"`
+	Updated  time.Time `bstore:"nonzero,default now"`
+	Expunged bool
+
+	Data string
+}
+
+// DAVCollectionsEnsure creates a default calendar and address book if the
+// account has no collection of that kind yet.
+func DAVCollectionsEnsure(ctx context.Context, acc *Account) error {
+	ensure := func(tx *bstore.Tx, c DAVCollection) error {
+		exists, err := bstore.QueryTx[DAVCollection](tx).FilterNonzero(DAVCollection{Kind: c.Kind}).Exists()
+		if err != nil {
+			return fmt.Errorf("checking for %s: %v", c.Kind, err)
+		} else if exists {
+			return nil
+		}
+		if err := tx.Insert(&c); err != nil {
+			return fmt.Errorf("inserting default %s: %v", c.Kind, err)
+		}
+		return nil
+	}
+
+	// Common case, without needing a write transaction.
+	var n int
+	err := acc.DB.Read(ctx, func(tx *bstore.Tx) error {
+		var err error
+		n, err = bstore.QueryTx[DAVCollection](tx).Count()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("counting collections: %v", err)
+	} else if n >= 2 {
+		return nil
+	}
+
+	return acc.DB.Write(ctx, func(tx *bstore.Tx) error {
+		cal := DAVCollection{
+			Kind:        DAVCalendar,
+			Name:        "default",
+			DisplayName: "Calendar",
+			Components:  []string{"VEVENT", "VTODO"},
+		}
+		if err := ensure(tx, cal); err != nil {
+			return err
+		}
+		ab := DAVCollection{
+			Kind:        DAVAddressBook,
+			Name:        "default",
+			DisplayName: "Contacts",
+		}
+		return ensure(tx, ab)
+	})
+}
+
+// DAVCalendarObjectPut stores calendar data for an object with uid and main
+// component compName, e.g. from an invitation received by email. An existing
+// object with the uid in any calendar is replaced. Otherwise, the object is added
+// to the first calendar that supports the component type. If the account has no
+// such calendar, stored is false and nothing is changed.
+func DAVCalendarObjectPut(tx *bstore.Tx, uid, compName, data string) (o DAVObject, stored bool, rerr error) {
+	var c DAVCollection
+	q := bstore.QueryTx[DAVObject](tx)
+	q.FilterNonzero(DAVObject{UID: uid, Component: compName})
+	q.FilterEqual("Expunged", false)
+	var err error
+	for xo, xerr := range q.All() {
+		if xerr != nil {
+			return o, false, fmt.Errorf("looking up object by uid: %v", xerr)
+		}
+		xc := DAVCollection{ID: xo.CollectionID}
+		if err := tx.Get(&xc); err != nil {
+			return o, false, fmt.Errorf("get collection for object: %v", err)
+		} else if xc.Kind == DAVCalendar {
+			o, c = xo, xc
+			break
+		}
+	}
+
+	if c.ID == 0 {
+		qc := bstore.QueryTx[DAVCollection](tx)
+		qc.FilterNonzero(DAVCollection{Kind: DAVCalendar})
+		qc.FilterFn(func(xc DAVCollection) bool {
+			return len(xc.Components) == 0 || slices.Contains(xc.Components, compName)
+		})
+		qc.SortAsc("ID")
+		c, err = qc.Get()
+		if err == bstore.ErrAbsent {
+			return o, false, nil
+		} else if err != nil {
+			return o, false, fmt.Errorf("looking up calendar: %v", err)
+		}
+
+		// Name derived from the uid, reusing a tombstone with the same name.
+		h := sha256.Sum256([]byte(uid))
+		name := hex.EncodeToString(h[:16]) + ".ics"
+		o, err = bstore.QueryTx[DAVObject](tx).FilterNonzero(DAVObject{CollectionID: c.ID, Name: name}).Get()
+		if err == bstore.ErrAbsent {
+			o = DAVObject{CollectionID: c.ID, Name: name}
+		} else if err != nil {
+			return o, false, fmt.Errorf("looking up object by name: %v", err)
+		} else if !o.Expunged {
+			return o, false, fmt.Errorf("object %q exists with different uid", name)
+		}
+	}
+
+	c.ModSeq++
+	if err := tx.Update(&c); err != nil {
+		return o, false, fmt.Errorf("updating collection: %v", err)
+	}
+	if err := DAVSizeAdd(tx, int64(len(data)-len(o.Data))); err != nil {
+		return o, false, err
+	}
+	o.UID = uid
+	o.Component = compName
+	o.ModSeq = c.ModSeq
+	o.Updated = time.Now()
+	o.Expunged = false
+	o.Data = data
+	if o.ID == 0 {
+		err = tx.Insert(&o)
+	} else {
+		err = tx.Update(&o)
+	}
+	if err != nil {
+		return o, false, fmt.Errorf("storing object: %v", err)
+	}
+	return o, true, nil
+}
+
+// DAVSizeAdd adjusts DiskUsage.DAVSize by size, for added, changed or removed
+// calendar and contact objects.
+func DAVSizeAdd(tx *bstore.Tx, size int64) error {
+	if size == 0 {
+		return nil
+	}
+	du := DiskUsage{ID: 1}
+	if err := tx.Get(&du); err != nil {
+		return fmt.Errorf("get diskusage: %v", err)
+	}
+	du.DAVSize += size
+	if err := tx.Update(&du); err != nil {
+		return fmt.Errorf("update dav size: %v", err)
+	}
+	return nil
+}
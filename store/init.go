@@ -25,7 +25,7 @@ type AccountRemove struct {
 
 // AuthDB and AuthDBTypes are exported for ../backup.go.
 var AuthDB *bstore.DB
-var AuthDBTypes = []any{TLSPublicKey{}, LoginAttempt{}, LoginAttemptState{}, AccountRemove{}}
+var AuthDBTypes = []any{TLSPublicKey{}, LoginAttempt{}, LoginAttemptState{}, AccountRemove{}, IPBan{}, IPAllow{}}
 
 var loginAttemptCleanerStop chan chan struct{}
 
@@ -56,6 +56,10 @@ func Init(ctx context.Context) error {
 		}
 	}
 
+	if err := ipBansLoad(ctx); err != nil {
+		return fmt.Errorf("loading ip bans: %v", err)
+	}
+
 	startLoginAttemptWriter()
 	loginAttemptCleanerStop = make(chan chan struct{})
 
@@ -76,6 +80,8 @@ func Init(ctx context.Context) error {
 		for {
 			err := LoginAttemptCleanup(ctx)
 			pkglog.Check(err, "cleaning up old historic login attempts")
+			err = IPBanCleanup(ctx)
+			pkglog.Check(err, "cleaning up expired ip bans")
 
 			select {
 			case c := <-loginAttemptCleanerStop:
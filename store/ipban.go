@@ -0,0 +1,338 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+)
+
+// ErrIPBanUnknown is returned when removing a ban or allowlist entry that does
+// not exist.
+var ErrIPBanUnknown = errors.New("no such ip ban or allowlist entry")
+
+// IPBan is a ban of an IP or network. Connections from banned IPs are refused by
+// all listeners.
+//
+// Bans are added automatically after repeated failed authentication attempts
+// (see LoginAttempt), or manually by the admin. Expired automatic bans are kept
+// for 30 days, for escalating the duration of a next ban.
+type IPBan struct {
+	Net       string    // IP network in CIDR notation, e.g. 192.0.2.1/32 or 2001:db8::/64.
+	Created   time.Time `bstore:"nonzero,default now"`
+	Expires   time.Time `bstore:"index"` // Zero for bans that don't expire.
+	Reason    string
+	Automatic bool // Whether the ban was added due to failed authentication attempts.
+	Count     int  // Number of automatic bans, doubling the duration of each next ban.
+}
+
+// Active returns whether the ban is in effect at tm.
+func (b IPBan) Active(tm time.Time) bool {
+	return b.Expires.IsZero() || b.Expires.After(tm)
+}
+
+// IPAllow is an IP or network that is never banned.
+type IPAllow struct {
+	Net     string    // IP network in CIDR notation.
+	Created time.Time `bstore:"nonzero,default now"`
+	Comment string
+}
+
+type ipBanNet struct {
+	ipnet   net.IPNet
+	expires time.Time
+}
+
+// Bans and allowlisted networks, kept in memory for checking each incoming
+// connection, and counts of recent authentication failures for automatic bans.
+var ipBans = struct {
+	sync.Mutex
+	bans     []ipBanNet
+	allow    []net.IPNet
+	failures map[string][]time.Time // Key is IP network in CIDR notation.
+}{failures: map[string][]time.Time{}}
+
+// IPBanned returns whether connections from ip must be refused.
+func IPBanned(ip net.IP) bool {
+	if ipAllowlisted(ip) {
+		return false
+	}
+
+	now := time.Now()
+	ipBans.Lock()
+	defer ipBans.Unlock()
+	for _, b := range ipBans.bans {
+		if b.ipnet.Contains(ip) && (b.expires.IsZero() || b.expires.After(now)) {
+			return true
+		}
+	}
+	return false
+}
+
+func ipAllowlisted(ip net.IP) bool {
+	if slices.ContainsFunc(mox.Conf.Static.RateLimitAllowlistNets, func(n net.IPNet) bool { return n.Contains(ip) }) {
+		return true
+	}
+
+	ipBans.Lock()
+	defer ipBans.Unlock()
+	return slices.ContainsFunc(ipBans.allow, func(n net.IPNet) bool { return n.Contains(ip) })
+}
+
+// ipBanKey returns the network that is banned for failed authentication
+// attempts from ip: the IP itself for IPv4, and its /64 for IPv6.
+func ipBanKey(ip net.IP) net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	mask := net.CIDRMask(64, 128)
+	return net.IPNet{IP: ip.Mask(mask), Mask: mask}
+}
+
+// ipBansLoad reads the active bans and allowlisted networks from the database
+// into memory. Must be called after each change.
+func ipBansLoad(ctx context.Context) error {
+	var bans []ipBanNet
+	var allow []net.IPNet
+	now := time.Now()
+	err := AuthDB.Read(ctx, func(tx *bstore.Tx) error {
+		err := bstore.QueryTx[IPBan](tx).ForEach(func(b IPBan) error {
+			if !b.Active(now) {
+				return nil
+			}
+			_, ipnet, err := net.ParseCIDR(b.Net)
+			if err != nil {
+				return fmt.Errorf("parsing ip ban network %q: %v", b.Net, err)
+			}
+			bans = append(bans, ipBanNet{*ipnet, b.Expires})
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("listing ip bans: %v", err)
+		}
+		return bstore.QueryTx[IPAllow](tx).ForEach(func(a IPAllow) error {
+			_, ipnet, err := net.ParseCIDR(a.Net)
+			if err != nil {
+				return fmt.Errorf("parsing ip allowlist network %q: %v", a.Net, err)
+			}
+			allow = append(allow, *ipnet)
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	ipBans.Lock()
+	defer ipBans.Unlock()
+	ipBans.bans = bans
+	ipBans.allow = allow
+	return nil
+}
+
+// ipBanFailure is called for each failed authentication attempt, and bans the IP
+// when it has too many failures within the configured window.
+func ipBanFailure(log mlog.Log, ip net.IP, tm time.Time) {
+	conf := mox.Conf.Static.IPBans
+	// We don't ban loopback IPs: it would lock out local clients and connections
+	// through a local reverse proxy without forwarded headers.
+	if conf.Disabled || ip == nil || ip.IsLoopback() || ipAllowlisted(ip) {
+		return
+	}
+
+	key := ipBanKey(ip)
+	keystr := key.String()
+	start := tm.Add(-conf.Window)
+	recent := func(l []time.Time) []time.Time {
+		return slices.DeleteFunc(l, func(t time.Time) bool { return t.Before(start) })
+	}
+
+	ipBans.Lock()
+	l := append(recent(ipBans.failures[keystr]), tm)
+	ban := len(l) >= conf.Failures
+	if ban {
+		delete(ipBans.failures, keystr)
+	} else {
+		ipBans.failures[keystr] = l
+	}
+	// Prevent unbounded growth.
+	if len(ipBans.failures) > 10000 {
+		for k, v := range ipBans.failures {
+			if v = recent(v); len(v) == 0 {
+				delete(ipBans.failures, k)
+			} else {
+				ipBans.failures[k] = v
+			}
+		}
+	}
+	ipBans.Unlock()
+	if !ban {
+		return
+	}
+
+	reason := fmt.Sprintf("%d failed authentication attempts within %s", len(l), conf.Window)
+	var b IPBan
+	err := AuthDB.Write(context.Background(), func(tx *bstore.Tx) error {
+		b = IPBan{Net: keystr}
+		err := tx.Get(&b)
+		if err == bstore.ErrAbsent {
+			b = IPBan{Net: keystr}
+		} else if err != nil {
+			return fmt.Errorf("get ip ban: %v", err)
+		} else if b.Active(tm) {
+			// Already banned, e.g. by the admin, or for failures that came in before the
+			// ban was loaded.
+			return nil
+		}
+
+		d := conf.Duration
+		for range b.Count {
+			d *= 2
+			if d >= conf.MaxDuration {
+				break
+			}
+		}
+		d = min(d, conf.MaxDuration)
+		b.Created = tm
+		b.Expires = tm.Add(d)
+		b.Reason = reason
+		b.Automatic = true
+		b.Count++
+		if b.Count == 1 {
+			return tx.Insert(&b)
+		}
+		return tx.Update(&b)
+	})
+	if err != nil {
+		log.Errorx("adding automatic ip ban", err, slog.String("net", keystr))
+		return
+	}
+	log.Info("ip banned due to failed authentication attempts",
+		slog.String("net", keystr),
+		slog.Time("expires", b.Expires),
+		slog.Int("count", b.Count))
+	err = ipBansLoad(context.Background())
+	log.Check(err, "loading ip bans")
+}
+
+// ipBanFailureResult returns whether an authentication result counts towards an
+// automatic ban.
+func ipBanFailureResult(r AuthResult) bool {
+	switch r {
+	case AuthBadUser, AuthBadPassword, AuthBadCredentials, AuthBadChannelBinding, AuthBadProtocol:
+		return true
+	}
+	return false
+}
+
+// IPBanList returns the bans currently in effect.
+func IPBanList(ctx context.Context) ([]IPBan, error) {
+	now := time.Now()
+	l, err := bstore.QueryDB[IPBan](ctx, AuthDB).FilterFn(func(b IPBan) bool { return b.Active(now) }).SortAsc("Net").List()
+	if err != nil {
+		return nil, fmt.Errorf("listing ip bans: %v", err)
+	}
+	return l, nil
+}
+
+// IPBanAdd bans an IP or network, for duration, or without expiration if duration
+// is zero. An existing ban for the same network is replaced.
+func IPBanAdd(ctx context.Context, ipnet net.IPNet, duration time.Duration, reason string) error {
+	if duration < 0 {
+		return fmt.Errorf("duration cannot be negative")
+	}
+	b := IPBan{
+		Net:     ipnet.String(),
+		Created: time.Now(),
+		Reason:  reason,
+	}
+	if duration > 0 {
+		b.Expires = b.Created.Add(duration)
+	}
+	err := AuthDB.Write(ctx, func(tx *bstore.Tx) error {
+		xb := IPBan{Net: b.Net}
+		if err := tx.Get(&xb); err == bstore.ErrAbsent {
+			return tx.Insert(&b)
+		} else if err != nil {
+			return fmt.Errorf("get ip ban: %v", err)
+		}
+		b.Count = xb.Count
+		return tx.Update(&b)
+	})
+	if err != nil {
+		return fmt.Errorf("adding ip ban: %v", err)
+	}
+	return ipBansLoad(ctx)
+}
+
+// IPBanRemove removes the ban for an IP or network, also resetting the duration
+// for a next automatic ban. The network must match an existing ban exactly.
+func IPBanRemove(ctx context.Context, ipnet net.IPNet) error {
+	err := AuthDB.Delete(ctx, &IPBan{Net: ipnet.String()})
+	if err == bstore.ErrAbsent {
+		return ErrIPBanUnknown
+	} else if err != nil {
+		return fmt.Errorf("removing ip ban: %v", err)
+	}
+	return ipBansLoad(ctx)
+}
+
+// IPAllowList returns the networks that are never banned.
+func IPAllowList(ctx context.Context) ([]IPAllow, error) {
+	l, err := bstore.QueryDB[IPAllow](ctx, AuthDB).SortAsc("Net").List()
+	if err != nil {
+		return nil, fmt.Errorf("listing ip allowlist: %v", err)
+	}
+	return l, nil
+}
+
+// IPAllowAdd adds an IP or network to the allowlist. Existing bans for the
+// network are no longer enforced.
+func IPAllowAdd(ctx context.Context, ipnet net.IPNet, comment string) error {
+	a := IPAllow{Net: ipnet.String(), Comment: comment}
+	err := AuthDB.Write(ctx, func(tx *bstore.Tx) error {
+		if err := tx.Get(&IPAllow{Net: a.Net}); err == nil {
+			return fmt.Errorf("network already in allowlist")
+		} else if err != bstore.ErrAbsent {
+			return fmt.Errorf("get ip allowlist entry: %v", err)
+		}
+		return tx.Insert(&a)
+	})
+	if err != nil {
+		return fmt.Errorf("adding ip allowlist entry: %v", err)
+	}
+	return ipBansLoad(ctx)
+}
+
+// IPAllowRemove removes an IP or network from the allowlist. The network must
+// match an existing entry exactly.
+func IPAllowRemove(ctx context.Context, ipnet net.IPNet) error {
+	err := AuthDB.Delete(ctx, &IPAllow{Net: ipnet.String()})
+	if err == bstore.ErrAbsent {
+		return ErrIPBanUnknown
+	} else if err != nil {
+		return fmt.Errorf("removing ip allowlist entry: %v", err)
+	}
+	return ipBansLoad(ctx)
+}
+
+// IPBanCleanup removes bans that expired more than 30 days ago, and reloads the
+// bans in memory to drop recently expired bans.
+func IPBanCleanup(ctx context.Context) error {
+	cutoff := time.Now().Add(-30 * 24 * time.Hour)
+	q := bstore.QueryDB[IPBan](ctx, AuthDB)
+	q.FilterFn(func(b IPBan) bool { return !b.Expires.IsZero() && b.Expires.Before(cutoff) })
+	if _, err := q.Delete(); err != nil {
+		return fmt.Errorf("deleting expired ip bans: %v", err)
+	}
+	return ipBansLoad(ctx)
+}
@@ -0,0 +1,108 @@
+package store
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mjl-/mox/mox-"
+)
+
+func TestIPBan(t *testing.T) {
+	os.RemoveAll("../testdata/store/data")
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/store/mox.conf")
+	mox.MustLoadConfig(true, false)
+
+	xctx, xcancel := context.WithCancel(ctxbg)
+	defer xcancel()
+	err := Init(xctx)
+	tcheck(t, err, "store init")
+	defer func() {
+		err := Close()
+		tcheck(t, err, "store close")
+	}()
+
+	conf := &mox.Conf.Static.IPBans
+	conf.Failures = 3
+	conf.Window = time.Minute
+	conf.Duration = time.Hour
+	conf.MaxDuration = 3 * time.Hour
+
+	ip := net.ParseIP("192.0.2.1")
+	now := time.Now()
+
+	// Failures outside the window don't count.
+	ipBanFailure(pkglog, ip, now.Add(-2*time.Minute))
+	ipBanFailure(pkglog, ip, now)
+	ipBanFailure(pkglog, ip, now)
+	tcompare(t, IPBanned(ip), false)
+	ipBanFailure(pkglog, ip, now)
+	tcompare(t, IPBanned(ip), true)
+
+	l, err := IPBanList(ctxbg)
+	tcheck(t, err, "list bans")
+	tcompare(t, len(l), 1)
+	tcompare(t, l[0].Net, "192.0.2.1/32")
+	tcompare(t, l[0].Automatic, true)
+	tcompare(t, l[0].Count, 1)
+	tcompare(t, l[0].Expires.Sub(now), time.Hour)
+
+	// Next bans after expiration double in duration, up to the maximum.
+	later := now.Add(2 * time.Hour)
+	for range 3 {
+		ipBanFailure(pkglog, ip, later)
+	}
+	b := IPBan{Net: "192.0.2.1/32"}
+	err = AuthDB.Get(ctxbg, &b)
+	tcheck(t, err, "get ban")
+	tcompare(t, b.Count, 2)
+	tcompare(t, b.Expires.Sub(later), 2*time.Hour)
+
+	later = later.Add(3 * time.Hour)
+	for range 3 {
+		ipBanFailure(pkglog, ip, later)
+	}
+	err = AuthDB.Get(ctxbg, &b)
+	tcheck(t, err, "get ban")
+	tcompare(t, b.Count, 3)
+	tcompare(t, b.Expires.Sub(later), 3*time.Hour)
+
+	err = IPBanRemove(ctxbg, ipBanKey(ip))
+	tcheck(t, err, "remove ban")
+	tcompare(t, IPBanned(ip), false)
+	err = IPBanRemove(ctxbg, ipBanKey(ip))
+	tcompare(t, err, ErrIPBanUnknown)
+
+	// IPv6 is banned per /64. Allowlisted and loopback IPs are not banned.
+	ip6 := net.ParseIP("2001:db8::1")
+	ipnet, err := mox.ParseIPNet("2001:db8::/48")
+	tcheck(t, err, "parse network")
+	err = IPAllowAdd(ctxbg, ipnet, "test")
+	tcheck(t, err, "add allowlist")
+	for range 3 {
+		ipBanFailure(pkglog, ip6, now)
+		ipBanFailure(pkglog, net.IPv6loopback, now)
+	}
+	tcompare(t, IPBanned(ip6), false)
+	tcompare(t, IPBanned(net.IPv6loopback), false)
+	err = IPAllowRemove(ctxbg, ipnet)
+	tcheck(t, err, "remove allowlist")
+	for range 3 {
+		ipBanFailure(pkglog, ip6, now)
+	}
+	tcompare(t, IPBanned(net.ParseIP("2001:db8::2")), true)
+	tcompare(t, IPBanned(net.ParseIP("2001:db8:0:1::1")), false)
+
+	// Manual ban without expiration.
+	ipnet, err = mox.ParseIPNet("198.51.100.0/24")
+	tcheck(t, err, "parse network")
+	err = IPBanAdd(ctxbg, ipnet, 0, "manual")
+	tcheck(t, err, "add ban")
+	tcompare(t, IPBanned(net.ParseIP("198.51.100.10")), true)
+	err = IPBanCleanup(ctxbg)
+	tcheck(t, err, "cleanup")
+	tcompare(t, IPBanned(net.ParseIP("198.51.100.10")), true)
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/tls"
 	"fmt"
 	"log/slog"
+	"net"
 	"runtime/debug"
 	"time"
 
@@ -44,9 +45,12 @@ type LoginAttempt struct {
 	LocalIP              string
 	TLS                  string // Empty if no TLS, otherwise contains version, algorithm, properties, etc.
 	TLSPubKeyFingerprint string
-	Protocol             string // "submission", "imap", "webmail", "webaccount", "webadmin"
+	Protocol             string // "submission", "imap", "webmail", "webaccount", "webadmin", "webapi", "dav"
 	UserAgent            string // From HTTP header, or IMAP ID command.
-	AuthMech             string // "plain", "login", "cram-md5", "scram-sha-256-plus", "(unrecognized)", etc
+	AuthMech             string // "plain", "login", "cram-md5", "scram-sha-256-plus", "apikey", "(unrecognized)", etc
+	APIKeyName           string // Name of API key, for AuthMech "apikey".
+	AppPasswordName      string // Name of app password, if one was used instead of the account password.
+	SecondFactor         string // For web logins with a second factor: "totp", "recoverycode" or "webauthn".
 	Result               AuthResult
 
 	log mlog.Log // For passing the logger to the goroutine that writes and logs.
@@ -65,6 +69,9 @@ func (a LoginAttempt) calculateKey() []byte {
 		a.UserAgent,
 		a.AuthMech,
 		string(a.Result),
+		a.APIKeyName,
+		a.AppPasswordName,
+		a.SecondFactor,
 	}
 	// We don't add field separators. It allows us to add fields in the future that are
 	// empty by default without changing existing keys.
@@ -88,15 +95,16 @@ type LoginAttemptState struct {
 type AuthResult string
 
 const (
-	AuthSuccess           AuthResult = "ok"
-	AuthBadUser           AuthResult = "baduser"
-	AuthBadPassword       AuthResult = "badpassword"
-	AuthBadCredentials    AuthResult = "badcreds"
-	AuthBadChannelBinding AuthResult = "badchanbind"
-	AuthBadProtocol       AuthResult = "badprotocol"
-	AuthLoginDisabled     AuthResult = "logindisabled"
-	AuthError             AuthResult = "error"
-	AuthAborted           AuthResult = "aborted"
+	AuthSuccess              AuthResult = "ok"
+	AuthBadUser              AuthResult = "baduser"
+	AuthBadPassword          AuthResult = "badpassword"
+	AuthBadCredentials       AuthResult = "badcreds"
+	AuthBadChannelBinding    AuthResult = "badchanbind"
+	AuthBadProtocol          AuthResult = "badprotocol"
+	AuthLoginDisabled        AuthResult = "logindisabled"
+	AuthSecondFactorRequired AuthResult = "secondfactor" // Valid password, login continues with second factor.
+	AuthError                AuthResult = "error"
+	AuthAborted              AuthResult = "aborted"
 )
 
 var writeLoginAttempt chan LoginAttempt
@@ -208,6 +216,12 @@ func loginAttemptWrite(l ...LoginAttempt) {
 		return nil
 	})
 	l[0].log.Check(err, "storing login attempt")
+
+	for _, a := range l {
+		if ipBanFailureResult(a.Result) {
+			ipBanFailure(a.log, net.ParseIP(a.RemoteIP), time.Now())
+		}
+	}
 }
 
 func loginAttemptWriteTx(tx *bstore.Tx, a *LoginAttempt) error {
@@ -3,7 +3,7 @@ package store
 import (
 	"bytes"
 	"io"
-	"strings"
+	"slices"
 	"unicode"
 	"unicode/utf8"
 
@@ -16,6 +16,8 @@ import (
 type WordSearch struct {
 	words, notWords    [][]byte
 	searchBuf, keepBuf []byte
+
+	index *wordIndex // For MatchIndex, shared between copies.
 }
 
 // PrepareWordSearch returns a search context that can be used to match multiple
@@ -23,23 +25,21 @@ type WordSearch struct {
 func PrepareWordSearch(words, notWords []string) WordSearch {
 	var wl, nwl [][]byte
 	for _, w := range words {
-		wl = append(wl, []byte(strings.ToLower(w)))
+		wl = append(wl, normalizeSearch([]byte(w)))
 	}
 	for _, w := range notWords {
-		nwl = append(nwl, []byte(strings.ToLower(w)))
+		nwl = append(nwl, normalizeSearch([]byte(w)))
 	}
 
 	keep := 0
-	for _, w := range words {
-		if len(w) > keep {
-			keep = len(w)
-		}
-	}
-	for _, w := range notWords {
+	for _, w := range slices.Concat(wl, nwl) {
 		if len(w) > keep {
 			keep = len(w)
 		}
 	}
+	// Normalization can make text shorter, e.g. when composing a character with
+	// combining marks, so a word can span more bytes of the original text.
+	keep *= 3
 	keep += 6 // Max utf-8 character size.
 
 	bufSize := 8 * 1024
@@ -50,7 +50,9 @@ func PrepareWordSearch(words, notWords []string) WordSearch {
 	keepBuf := make([]byte, keep)
 	searchBuf := make([]byte, bufSize)
 
-	return WordSearch{wl, nwl, searchBuf, keepBuf}
+	index := &wordIndex{words: words, notWords: notWords}
+
+	return WordSearch{wl, nwl, searchBuf, keepBuf, index}
 }
 
 // MatchPart returns whether the part/mail message p matches the search.
@@ -82,7 +84,8 @@ func (ws WordSearch) matchPart(log mlog.Log, p *message.Part, headerToo bool, se
 	}
 
 	if len(p.Parts) == 0 {
-		if p.MediaType != "TEXT" {
+		// Parts without content-type are treated as text/plain.
+		if p.MediaType != "TEXT" && p.MediaType != "" {
 			// todo: for other types we could try to find a library for parsing and search in there too.
 			return false, nil
 		}
@@ -129,7 +132,7 @@ func (ws WordSearch) searchReader(log mlog.Log, r io.Reader, seen map[int]bool)
 			copy(ws.keepBuf, ws.searchBuf[have-len(ws.keepBuf):])
 		}
 
-		lower := toLower(ws.searchBuf[:have])
+		lower := normalizeSearch(ws.searchBuf[:have])
 
 		for i, w := range ws.words {
 			if !seen[i] && bytes.Contains(lower, w) {
@@ -0,0 +1,563 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/message"
+	"github.com/mjl-/mox/mlog"
+)
+
+// Full-text search index.
+//
+// Messages are split into words: runs of letters, digits and (combining) marks.
+// Words are normalized with Unicode NFKC and lower-cased. For each word, the
+// index records the messages containing it, and whether the word occurs in a
+// header (of the message or a part) or in a text part. Attachment filenames and
+// decoded subject and address names are indexed as header words.
+//
+// Search words consisting of a single index word are answered from the index by
+// matching them as substring against the vocabulary of all indexed words, which
+// matches the behaviour of a search by reading the messages. Search words that
+// contain non-word characters (e.g. "user@example.org") are only used to find
+// candidate messages, which are then verified by reading the message. Messages
+// not in the index (e.g. delivered with an older version of mox) are always
+// searched by reading the message.
+
+// SearchWord is a word in the full-text search index. Words are not removed when
+// messages are removed, only when the index is rebuilt.
+type SearchWord struct {
+	ID   int64
+	Word string `bstore:"nonzero,unique"` // Normalized.
+}
+
+// SearchPosting records that a message contains a word.
+type SearchPosting struct {
+	ID        int64
+	WordID    int64 `bstore:"nonzero,index WordID+MessageID"`
+	MessageID int64 `bstore:"nonzero,index"`
+	Header    bool  // Word occurs in a message or part header, or attachment filename.
+	Body      bool  // Word occurs in a text part.
+}
+
+// SearchIndexed marks a message as present in the full-text search index.
+type SearchIndexed struct {
+	ID int64 // Same as Message.ID.
+}
+
+// Where a word was found.
+const (
+	searchInHeader uint8 = 1 << iota
+	searchInBody
+)
+
+// Maximum size of a word in bytes. Longer words, e.g. from base64 blobs in text
+// parts, are not indexed.
+const searchWordMaxLen = 64
+
+// Minimum number of characters in a search word for looking it up in the index.
+// Shorter words would match a large part of the vocabulary, and are searched by
+// reading messages.
+const searchWordMinChars = 3
+
+// Number of messages to index per database transaction when rebuilding.
+var searchIndexBatchSize = 500
+
+func isSearchWordRune(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || unicode.IsMark(c)
+}
+
+// normalizeSearch returns text in the form that search words are matched in:
+// NFKC-normalized and lower-case. Used for words in the index, and for search
+// words and message text when searching by reading messages, so both ways of
+// searching give the same results. The returned slice can share memory with b.
+func normalizeSearch(b []byte) []byte {
+	return toLower(norm.NFKC.Bytes(b))
+}
+
+func normalizeSearchWord(s string) string {
+	return string(normalizeSearch([]byte(s)))
+}
+
+// searchWords reads r and calls fn for each normalized word. Words longer than
+// searchWordMaxLen are skipped.
+func searchWords(r io.Reader, fn func(w string)) error {
+	br, ok := r.(io.RuneReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	var b strings.Builder
+	var long bool
+	flush := func() {
+		if b.Len() > 0 && !long {
+			if w := normalizeSearchWord(b.String()); len(w) <= searchWordMaxLen {
+				fn(w)
+			}
+		}
+		b.Reset()
+		long = false
+	}
+	for {
+		c, _, err := br.ReadRune()
+		if err == io.EOF {
+			flush()
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !isSearchWordRune(c) {
+			flush()
+		} else if b.Len() > 2*searchWordMaxLen {
+			// Normalization won't make it short enough.
+			long = true
+		} else {
+			b.WriteRune(c)
+		}
+	}
+}
+
+// searchIndexPart gathers the words from the headers and text parts of p and
+// its subparts, recursively, like WordSearch.MatchPart reads them.
+func searchIndexPart(p *message.Part, words map[string]uint8) error {
+	add := func(where uint8) func(string) {
+		return func(w string) {
+			words[w] |= where
+		}
+	}
+
+	if err := searchWords(p.HeaderReader(), add(searchInHeader)); err != nil {
+		return fmt.Errorf("reading header: %w", err)
+	}
+	// Raw headers may have q/b-word encoded values. Also add the decoded forms.
+	var decoded []string
+	if e := p.Envelope; e != nil {
+		decoded = append(decoded, e.Subject)
+		for _, l := range [][]message.Address{e.From, e.Sender, e.ReplyTo, e.To, e.CC, e.BCC} {
+			for _, a := range l {
+				decoded = append(decoded, a.Name)
+			}
+		}
+	}
+	if _, filename, _ := p.DispositionFilename(); filename != "" {
+		decoded = append(decoded, filename)
+	}
+	for _, s := range decoded {
+		searchWords(strings.NewReader(s), add(searchInHeader))
+	}
+
+	if len(p.Parts) == 0 && (p.MediaType == "TEXT" || p.MediaType == "") {
+		if p.MediaSubType == "HTML" {
+			// We index the words of the HTML source, as they would be found when searching by
+			// reading the message, and of the text with character references decoded.
+			buf, err := io.ReadAll(p.ReaderUTF8OrBinary())
+			if err != nil {
+				return fmt.Errorf("reading html part: %w", err)
+			}
+			s := string(buf)
+			searchWords(strings.NewReader(s), add(searchInBody))
+			if us := html.UnescapeString(s); us != s {
+				searchWords(strings.NewReader(us), add(searchInBody))
+			}
+		} else if err := searchWords(p.ReaderUTF8OrBinary(), add(searchInBody)); err != nil {
+			return fmt.Errorf("reading text part: %w", err)
+		}
+	}
+	for _, pp := range p.Parts {
+		if pp.Message != nil {
+			if err := pp.SetMessageReaderAt(); err != nil {
+				return err
+			}
+			pp = *pp.Message
+		}
+		if err := searchIndexPart(&pp, words); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// searchIndexMessage adds the message to the full-text search index. If the
+// message cannot be read, it is logged and the message is left out of the index,
+// so searches will read the message. Only database errors are returned.
+func searchIndexMessage(log mlog.Log, tx *bstore.Tx, msgID int64, p *message.Part) error {
+	words := map[string]uint8{}
+	if err := searchIndexPart(p, words); err != nil {
+		log.Infox("reading message for search index, not indexing", err, slog.Int64("msgid", msgID))
+		return nil
+	}
+
+	for w, where := range words {
+		sw, err := bstore.QueryTx[SearchWord](tx).FilterNonzero(SearchWord{Word: w}).Get()
+		if err == bstore.ErrAbsent {
+			sw = SearchWord{Word: w}
+			if err := tx.Insert(&sw); err != nil {
+				return fmt.Errorf("inserting search word: %w", err)
+			}
+		} else if err != nil {
+			return fmt.Errorf("looking up search word: %w", err)
+		}
+		sp := SearchPosting{
+			WordID:    sw.ID,
+			MessageID: msgID,
+			Header:    where&searchInHeader != 0,
+			Body:      where&searchInBody != 0,
+		}
+		if err := tx.Insert(&sp); err != nil {
+			return fmt.Errorf("inserting search posting: %w", err)
+		}
+	}
+	if err := tx.Insert(&SearchIndexed{ID: msgID}); err != nil {
+		return fmt.Errorf("marking message as indexed: %w", err)
+	}
+	return nil
+}
+
+// searchIndexRemove removes a message from the full-text search index.
+func searchIndexRemove(tx *bstore.Tx, msgID int64) error {
+	if _, err := bstore.QueryTx[SearchPosting](tx).FilterNonzero(SearchPosting{MessageID: msgID}).Delete(); err != nil {
+		return fmt.Errorf("removing search postings: %w", err)
+	}
+	if err := tx.Delete(&SearchIndexed{ID: msgID}); err != nil && err != bstore.ErrAbsent {
+		return fmt.Errorf("removing search indexed mark: %w", err)
+	}
+	return nil
+}
+
+// SearchIndexCopy adds the full-text search index entries of message origID for
+// message newID, for a message copied without calling MessageAdd. If origID is not
+// indexed, nothing is done.
+func SearchIndexCopy(tx *bstore.Tx, origID, newID int64) error {
+	if err := tx.Get(&SearchIndexed{ID: origID}); err == bstore.ErrAbsent {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("checking if message is indexed: %w", err)
+	}
+	l, err := bstore.QueryTx[SearchPosting](tx).FilterNonzero(SearchPosting{MessageID: origID}).List()
+	if err != nil {
+		return fmt.Errorf("listing search postings: %w", err)
+	}
+	for _, sp := range l {
+		sp.ID = 0
+		sp.MessageID = newID
+		if err := tx.Insert(&sp); err != nil {
+			return fmt.Errorf("inserting search posting: %w", err)
+		}
+	}
+	if err := tx.Insert(&SearchIndexed{ID: newID}); err != nil {
+		return fmt.Errorf("marking message as indexed: %w", err)
+	}
+	return nil
+}
+
+// SearchIndexRebuild removes all messages from the full-text search index and
+// adds them again, and removes words no longer used by any message. Messages are
+// processed in batches, each in a transaction with the account write lock held,
+// so other access is not blocked for long. Searches on messages that have not
+// been indexed yet read the message.
+//
+// Returns the number of messages indexed.
+func (a *Account) SearchIndexRebuild(ctx context.Context, log mlog.Log) (int, error) {
+	total := 0
+	var lastID int64
+	for {
+		var n int
+		err := func() error {
+			a.Lock()
+			defer a.Unlock()
+
+			return a.DB.Write(ctx, func(tx *bstore.Tx) error {
+				q := bstore.QueryTx[Message](tx)
+				q.FilterGreater("ID", lastID)
+				q.SortAsc("ID")
+				q.Limit(searchIndexBatchSize)
+				l, err := q.List()
+				if err != nil {
+					return fmt.Errorf("listing messages: %w", err)
+				}
+				for _, m := range l {
+					lastID = m.ID
+					n++
+					if err := searchIndexRemove(tx, m.ID); err != nil {
+						return err
+					}
+					if m.Expunged {
+						continue
+					}
+					if err := a.searchIndexStored(log, tx, m); err != nil {
+						return err
+					}
+					total++
+				}
+				return nil
+			})
+		}()
+		if err != nil {
+			return total, fmt.Errorf("indexing messages: %w", err)
+		}
+		log.Debug("search index rebuild progress", slog.Int("total", total))
+		if n < searchIndexBatchSize {
+			break
+		}
+	}
+
+	// Remove words that no message uses anymore.
+	var removed int
+	lastID = 0
+	for {
+		var n int
+		err := func() error {
+			a.Lock()
+			defer a.Unlock()
+
+			return a.DB.Write(ctx, func(tx *bstore.Tx) error {
+				q := bstore.QueryTx[SearchWord](tx)
+				q.FilterGreater("ID", lastID)
+				q.SortAsc("ID")
+				q.Limit(10 * searchIndexBatchSize)
+				l, err := q.List()
+				if err != nil {
+					return fmt.Errorf("listing search words: %w", err)
+				}
+				for _, sw := range l {
+					lastID = sw.ID
+					n++
+					exists, err := bstore.QueryTx[SearchPosting](tx).FilterNonzero(SearchPosting{WordID: sw.ID}).Exists()
+					if err != nil {
+						return fmt.Errorf("checking for search postings: %w", err)
+					} else if exists {
+						continue
+					}
+					if err := tx.Delete(&sw); err != nil {
+						return fmt.Errorf("removing search word: %w", err)
+					}
+					removed++
+				}
+				return nil
+			})
+		}()
+		if err != nil {
+			return total, fmt.Errorf("removing unused search words: %w", err)
+		}
+		if n < 10*searchIndexBatchSize {
+			break
+		}
+	}
+	log.Debug("search index rebuilt", slog.Int("messages", total), slog.Int("removedwords", removed))
+
+	return total, nil
+}
+
+// searchIndexStored adds a message with its file already stored in the account
+// to the search index.
+func (a *Account) searchIndexStored(log mlog.Log, tx *bstore.Tx, m Message) error {
+	mr := a.MessageReader(m)
+	defer func() {
+		err := mr.Close()
+		log.Check(err, "closing message reader after indexing")
+	}()
+	p, err := m.LoadPart(mr)
+	if err != nil {
+		log.Infox("loading parsed message for search index, not indexing", err, slog.Int64("msgid", m.ID))
+		return nil
+	}
+	return searchIndexMessage(log, tx, m.ID, &p)
+}
+
+// wordIndex holds the messages that match the words of a WordSearch according to
+// the full-text search index. Gathered on first use.
+type wordIndex struct {
+	words, notWords []string // As given to PrepareWordSearch.
+
+	loaded bool
+	err    error
+	usable bool // Whether any word can be looked up in the index.
+
+	wordMatches, notWordMatches []indexMatches
+}
+
+type indexMatches struct {
+	usable bool            // If false, messages must always be read to match this word.
+	exact  bool            // If false, matching messages must be read to verify the match.
+	msgs   map[int64]uint8 // Message ID to searchInHeader and/or searchInBody.
+}
+
+func (wi *wordIndex) load(tx *bstore.Tx) {
+	wi.loaded = true
+
+	// Parse search words into index words.
+	type searchWord struct {
+		tokens []string
+		usable bool
+		exact  bool
+	}
+	parse := func(s string) (sw searchWord) {
+		searchWords(strings.NewReader(s), func(w string) {
+			sw.tokens = append(sw.tokens, w)
+		})
+		sw.usable = len(sw.tokens) > 0
+		for _, t := range sw.tokens {
+			if utf8.RuneCountInString(t) < searchWordMinChars {
+				sw.usable = false
+			}
+		}
+		// Exact if the search word consists of a single index word only, without
+		// separators that a match in the message would need to have too.
+		sw.exact = len(sw.tokens) == 1 && normalizeSearchWord(s) == sw.tokens[0]
+		if sw.exact && len(s) > searchWordMaxLen {
+			// Words this long are not indexed, we must read the messages.
+			sw.usable = false
+		}
+		return sw
+	}
+	var words, notWords []searchWord
+	tokenMsgs := map[string]map[int64]uint8{}
+	for _, s := range wi.words {
+		sw := parse(s)
+		words = append(words, sw)
+		if sw.usable {
+			wi.usable = true
+			for _, t := range sw.tokens {
+				tokenMsgs[t] = nil
+			}
+		}
+	}
+	for _, s := range wi.notWords {
+		sw := parse(s)
+		notWords = append(notWords, sw)
+		if sw.usable {
+			wi.usable = true
+			for _, t := range sw.tokens {
+				tokenMsgs[t] = nil
+			}
+		}
+	}
+	if !wi.usable {
+		return
+	}
+
+	// Find the words in the vocabulary that contain the tokens, and gather the
+	// messages they occur in.
+	tokenWordIDs := map[string][]int64{}
+	err := bstore.QueryTx[SearchWord](tx).ForEach(func(sw SearchWord) error {
+		for t := range tokenMsgs {
+			if strings.Contains(sw.Word, t) {
+				tokenWordIDs[t] = append(tokenWordIDs[t], sw.ID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		wi.err = fmt.Errorf("searching index words: %w", err)
+		return
+	}
+	for t := range tokenMsgs {
+		msgs := map[int64]uint8{}
+		for _, id := range tokenWordIDs[t] {
+			err := bstore.QueryTx[SearchPosting](tx).FilterNonzero(SearchPosting{WordID: id}).ForEach(func(sp SearchPosting) error {
+				if sp.Header {
+					msgs[sp.MessageID] |= searchInHeader
+				}
+				if sp.Body {
+					msgs[sp.MessageID] |= searchInBody
+				}
+				return nil
+			})
+			if err != nil {
+				wi.err = fmt.Errorf("listing search postings: %w", err)
+				return
+			}
+		}
+		tokenMsgs[t] = msgs
+	}
+
+	// A message matches a search word if it has all its tokens.
+	matches := func(sw searchWord) indexMatches {
+		im := indexMatches{usable: sw.usable, exact: sw.exact}
+		if !sw.usable {
+			return im
+		}
+		im.msgs = tokenMsgs[sw.tokens[0]]
+		for _, t := range sw.tokens[1:] {
+			msgs := map[int64]uint8{}
+			for id, where := range im.msgs {
+				if w := where & tokenMsgs[t][id]; w != 0 {
+					msgs[id] = w
+				}
+			}
+			im.msgs = msgs
+		}
+		return im
+	}
+	for _, sw := range words {
+		wi.wordMatches = append(wi.wordMatches, matches(sw))
+	}
+	for _, sw := range notWords {
+		wi.notWordMatches = append(wi.notWordMatches, matches(sw))
+	}
+}
+
+// MatchIndex returns whether message msgID matches the search according to the
+// full-text search index. The index is read on first use with tx, later calls
+// must use the same transaction.
+//
+// If indexed is false, the index cannot answer the question, e.g. because the
+// message isn't indexed or a match must be verified, and the caller must use
+// MatchPart instead.
+func (ws WordSearch) MatchIndex(tx *bstore.Tx, msgID int64, headerToo bool) (match, indexed bool, rerr error) {
+	wi := ws.index
+	if !wi.loaded {
+		wi.load(tx)
+	}
+	if wi.err != nil {
+		return false, false, wi.err
+	}
+	if !wi.usable {
+		return false, false, nil
+	}
+
+	if err := tx.Get(&SearchIndexed{ID: msgID}); err == bstore.ErrAbsent {
+		return false, false, nil
+	} else if err != nil {
+		return false, false, fmt.Errorf("checking if message is indexed: %w", err)
+	}
+
+	want := searchInBody
+	if headerToo {
+		want |= searchInHeader
+	}
+	var verify bool
+	for _, im := range wi.wordMatches {
+		if !im.usable {
+			verify = true
+		} else if im.msgs[msgID]&want == 0 {
+			return false, true, nil
+		} else if !im.exact {
+			verify = true
+		}
+	}
+	for _, im := range wi.notWordMatches {
+		if !im.usable {
+			verify = true
+		} else if im.msgs[msgID]&want != 0 {
+			if im.exact {
+				return false, true, nil
+			}
+			verify = true
+		}
+	}
+	if verify {
+		return false, false, nil
+	}
+	return true, true, nil
+}
@@ -0,0 +1,178 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+)
+
+func TestSearchIndex(t *testing.T) {
+	log := mlog.New("store", nil)
+	os.RemoveAll("../testdata/store/data")
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/store/mox.conf")
+	mox.MustLoadConfig(true, false)
+	err := Init(ctxbg)
+	tcheck(t, err, "init")
+	defer func() {
+		err := Close()
+		tcheck(t, err, "close")
+	}()
+	defer Switchboard()()
+
+	orig := searchIndexBatchSize
+	searchIndexBatchSize = 2
+	defer func() {
+		searchIndexBatchSize = orig
+	}()
+
+	acc, err := OpenAccount(log, "mjl", false)
+	tcheck(t, err, "open account")
+	defer func() {
+		err = acc.Close()
+		tcheck(t, err, "closing account")
+		acc.WaitClosed()
+	}()
+
+	msgs := []string{
+		"From: <mjl@mox.example>\r\nSubject: =?utf-8?q?Caf=C3=A9_meeting?=\r\n\r\nLet's discuss the Quarterly numbers.\r\n",
+		"From: <mjl@mox.example>\r\nSubject: html\r\nContent-Type: text/html; charset=utf-8\r\n\r\n<p>Stra&szlig;e and <b>bold</b> words</p>\r\n",
+		"From: <mjl@mox.example>\r\nSubject: attachment\r\nContent-Type: multipart/mixed; boundary=x\r\n\r\n--x\r\nContent-Type: text/plain\r\n\r\nsee attached\r\n--x\r\nContent-Type: application/octet-stream\r\nContent-Disposition: attachment; filename=\"invoice-2024.pdf\"\r\nContent-Transfer-Encoding: base64\r\n\r\naGVsbG8K\r\n--x--\r\n",
+		"From: <mjl@mox.example>\r\nSubject: normalization\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nＦｕｌｌｗｉｄｔｈ ﬁnancial\r\n",
+	}
+	var ids []int64
+	acc.WithRLock(func() {
+		conf, _ := acc.Conf()
+		for _, s := range msgs {
+			msgFile, err := CreateMessageTemp(log, "searchindex-test")
+			tcheck(t, err, "create temp message file")
+			_, err = msgFile.Write([]byte(s))
+			tcheck(t, err, "write message")
+			m := Message{
+				Received: time.Now(),
+				Size:     int64(len(s)),
+			}
+			err = acc.DeliverDestination(log, conf.Destinations["mjl"], &m, msgFile)
+			tcheck(t, err, "deliver")
+			CloseRemoveTempFile(log, msgFile, "temp message file")
+			ids = append(ids, m.ID)
+		}
+	})
+
+	// Check a search against the index. If compare is set and the index gives an
+	// answer, it must agree with reading the message.
+	xcheck := func(compare bool, words, notWords []string, headerToo bool, msgID int64, expMatch, expIndexed bool) {
+		t.Helper()
+		ws := PrepareWordSearch(words, notWords)
+		err := acc.DB.Read(ctxbg, func(tx *bstore.Tx) error {
+			match, indexed, err := ws.MatchIndex(tx, msgID, headerToo)
+			tcheck(t, err, "match index")
+			if match != expMatch || indexed != expIndexed {
+				t.Fatalf("words %v, notwords %v, msg %d: got match %v, indexed %v, expected %v, %v", words, notWords, msgID, match, indexed, expMatch, expIndexed)
+			}
+			if !indexed || !compare {
+				return nil
+			}
+			m := Message{ID: msgID}
+			err = tx.Get(&m)
+			tcheck(t, err, "get message")
+			p, err := m.LoadPart(acc.MessageReader(m))
+			tcheck(t, err, "load part")
+			scanMatch, err := ws.MatchPart(log, &p, headerToo)
+			tcheck(t, err, "match part")
+			if scanMatch != match {
+				t.Fatalf("words %v, notwords %v, msg %d: index match %v, but message match %v", words, notWords, msgID, match, scanMatch)
+			}
+			return nil
+		})
+		tcheck(t, err, "read")
+	}
+	check := func(words, notWords []string, headerToo bool, msgID int64, expMatch, expIndexed bool) {
+		t.Helper()
+		xcheck(true, words, notWords, headerToo, msgID, expMatch, expIndexed)
+	}
+
+	check([]string{"quarterly"}, nil, false, ids[0], true, true)
+	check([]string{"QUARTER"}, nil, false, ids[0], true, true)
+	check([]string{"quarterly"}, nil, false, ids[1], false, true)
+	check([]string{"discuss", "numbers"}, nil, false, ids[0], true, true)
+	check([]string{"discuss", "absent"}, nil, false, ids[0], false, true)
+	check([]string{"discuss"}, []string{"numbers"}, false, ids[0], false, true)
+	check([]string{"bold"}, nil, false, ids[1], true, true)
+	check([]string{"attached"}, nil, true, ids[2], true, true)
+	// Decoded subject and html text are found through the index only. Attachment
+	// filenames are header words.
+	xcheck(false, []string{"café"}, nil, true, ids[0], true, true)
+	check([]string{"café"}, nil, false, ids[0], false, true)
+	xcheck(false, []string{"straße"}, nil, false, ids[1], true, true)
+	check([]string{"invoice"}, nil, true, ids[2], true, true)
+	check([]string{"invoice"}, nil, false, ids[2], false, true)
+	// Words with separators are verified by reading the message.
+	check([]string{"quarterly numbers"}, nil, false, ids[0], false, false)
+	check([]string{"quarterly numbers"}, nil, false, ids[1], false, true)
+	// Short words are not looked up in the index.
+	check([]string{"le"}, nil, false, ids[0], false, false)
+	// Index and reading messages normalize text the same way.
+	check([]string{"fullwidth"}, nil, false, ids[3], true, true)
+	check([]string{"ＦＵＬＬ"}, nil, false, ids[3], true, true)
+	check([]string{"financial"}, nil, false, ids[3], true, true)
+	check([]string{"fullwidth financial"}, nil, false, ids[3], false, false)
+	err = acc.DB.Read(ctxbg, func(tx *bstore.Tx) error {
+		m := Message{ID: ids[3]}
+		err := tx.Get(&m)
+		tcheck(t, err, "get message")
+		p, err := m.LoadPart(acc.MessageReader(m))
+		tcheck(t, err, "load part")
+		match, err := PrepareWordSearch([]string{"ＦＵＬＬＷＩＤＴＨ ﬁnancial"}, nil).MatchPart(log, &p, false)
+		tcheck(t, err, "match part")
+		tcompare(t, match, true)
+		return nil
+	})
+	tcheck(t, err, "read")
+
+	// Copy adds the entries for the new message.
+	var copyID int64 = 1000
+	err = acc.DB.Write(ctxbg, func(tx *bstore.Tx) error {
+		return SearchIndexCopy(tx, ids[0], copyID)
+	})
+	tcheck(t, err, "copy index")
+	xcheck(false, []string{"quarterly"}, nil, false, copyID, true, true) // No message for copyID.
+
+	// Removed messages are not indexed anymore.
+	err = acc.DB.Write(ctxbg, func(tx *bstore.Tx) error {
+		if err := searchIndexRemove(tx, copyID); err != nil {
+			return err
+		}
+		return searchIndexRemove(tx, ids[0])
+	})
+	tcheck(t, err, "remove from index")
+	check([]string{"quarterly"}, nil, false, ids[0], false, false)
+	n, err := bstore.QueryDB[SearchPosting](ctxbg, acc.DB).FilterNonzero(SearchPosting{MessageID: copyID}).Count()
+	tcheck(t, err, "count postings")
+	tcompare(t, n, 0)
+
+	// Rebuild adds messages again, and removes unused words.
+	err = acc.DB.Insert(ctxbg, &SearchWord{Word: "unused"})
+	tcheck(t, err, "insert word")
+	total, err := acc.SearchIndexRebuild(ctxbg, log)
+	tcheck(t, err, "rebuild search index")
+	tcompare(t, total, len(msgs))
+	check([]string{"quarterly"}, nil, false, ids[0], true, true)
+	exists, err := bstore.QueryDB[SearchWord](ctxbg, acc.DB).FilterNonzero(SearchWord{Word: "unused"}).Exists()
+	tcheck(t, err, "check word")
+	tcompare(t, exists, false)
+
+	// Long words are not indexed.
+	var words []string
+	err = searchWords(strings.NewReader("short "+strings.Repeat("x", 200)+" Ｆｕｌｌ"), func(w string) {
+		words = append(words, w)
+	})
+	tcheck(t, err, "search words")
+	tcompare(t, words, []string{"short", "full"})
+}
@@ -0,0 +1,409 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/totp"
+	"github.com/mjl-/mox/webauthn"
+)
+
+// ErrSecondFactor is returned, wrapped, when verification of a second factor
+// fails.
+var ErrSecondFactor = errors.New("invalid second factor")
+
+// Second factor kinds, as stored in LoginAttempt.SecondFactor.
+const (
+	SecondFactorTOTP         = "totp"
+	SecondFactorRecoveryCode = "recoverycode"
+	SecondFactorWebAuthn     = "webauthn"
+)
+
+// recoveryCodeCount is the number of recovery codes generated at a time.
+const recoveryCodeCount = 10
+
+// TOTP is a time-based one-time password secret for an authenticator app, used
+// as second factor for logins to the web interfaces. An account has at most one.
+// It is only used for logins after it has been confirmed with a valid code.
+type TOTP struct {
+	ID      int64
+	Created time.Time `bstore:"nonzero,default now"`
+
+	// Base32-encoded secret.
+	Secret string `bstore:"nonzero" json:"-"`
+
+	// Whether a code has been verified after setup. Unconfirmed secrets are not
+	// used for logins.
+	Confirmed bool
+
+	// Time step counter of the last used code, to prevent reuse.
+	LastCounter int64 `json:"-"`
+}
+
+// RecoveryCode can be used once instead of a second factor, e.g. when a phone
+// with an authenticator app or a security key is lost. Codes are generated
+// when the first second factor is added, and can be regenerated.
+type RecoveryCode struct {
+	ID      int64
+	Created time.Time `bstore:"nonzero,default now"`
+
+	// Raw-url-base64 SHA-256 hash of the normalized code.
+	Hash string `bstore:"nonzero,unique" json:"-"`
+
+	// Time of use, nil if not yet used.
+	Used *time.Time
+}
+
+// WebAuthnCredential is a registered security key or passkey, used as second
+// factor for logins to the web interfaces.
+type WebAuthnCredential struct {
+	ID      int64
+	Created time.Time `bstore:"nonzero,default now"`
+
+	// Descriptive name to identify the credential, e.g. the type of security key.
+	Name string `bstore:"nonzero"`
+
+	// Raw-url-base64 credential ID, as chosen by the authenticator.
+	CredentialID string `bstore:"nonzero,unique"`
+
+	// COSE-encoded public key.
+	PublicKey []byte `json:"-"`
+
+	// Signature counter of last use.
+	SignCount uint32 `json:"-"`
+
+	// Time of last use, nil if never used.
+	LastUsed *time.Time
+}
+
+// SecondFactorStatus describes the second factors configured for an account.
+type SecondFactorStatus struct {
+	TOTP                bool // Whether a confirmed TOTP secret is present.
+	WebAuthn            []WebAuthnCredential
+	RecoveryCodesUnused int
+}
+
+// Enabled returns whether a second factor is configured and must be used for
+// logins to the web interfaces.
+func (s SecondFactorStatus) Enabled() bool {
+	return s.TOTP || len(s.WebAuthn) > 0
+}
+
+func secondFactorStatus(tx *bstore.Tx) (SecondFactorStatus, error) {
+	var s SecondFactorStatus
+	var err error
+	s.TOTP, err = bstore.QueryTx[TOTP](tx).FilterEqual("Confirmed", true).Exists()
+	if err != nil {
+		return s, fmt.Errorf("checking totp: %v", err)
+	}
+	s.WebAuthn, err = bstore.QueryTx[WebAuthnCredential](tx).SortAsc("ID").List()
+	if err != nil {
+		return s, fmt.Errorf("listing webauthn credentials: %v", err)
+	}
+	s.RecoveryCodesUnused, err = bstore.QueryTx[RecoveryCode](tx).FilterFn(func(rc RecoveryCode) bool { return rc.Used == nil }).Count()
+	if err != nil {
+		return s, fmt.Errorf("counting recovery codes: %v", err)
+	}
+	return s, nil
+}
+
+// SecondFactors returns the second factors configured for the account.
+func (a *Account) SecondFactors(ctx context.Context) (s SecondFactorStatus, rerr error) {
+	rerr = a.DB.Read(ctx, func(tx *bstore.Tx) error {
+		s, rerr = secondFactorStatus(tx)
+		return rerr
+	})
+	return
+}
+
+// normalizeRecoveryCode lower cases, and removes whitespace and dashes, so
+// codes can be typed leniently.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, code)
+}
+
+func recoveryCodeHash(code string) string {
+	h := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// recoveryCodesReplace removes all existing recovery codes and returns new ones.
+func recoveryCodesReplace(tx *bstore.Tx) ([]string, error) {
+	if _, err := bstore.QueryTx[RecoveryCode](tx).Delete(); err != nil {
+		return nil, fmt.Errorf("removing recovery codes: %v", err)
+	}
+	var codes []string
+	for range recoveryCodeCount {
+		code := randomLetterGroups(2, 5)
+		if err := tx.Insert(&RecoveryCode{Hash: recoveryCodeHash(code)}); err != nil {
+			return nil, fmt.Errorf("inserting recovery code: %v", err)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// recoveryCodesEnsure returns new recovery codes if there are no unused
+// recovery codes, and nil otherwise. Called when a second factor is added.
+func recoveryCodesEnsure(tx *bstore.Tx) ([]string, error) {
+	exists, err := bstore.QueryTx[RecoveryCode](tx).FilterFn(func(rc RecoveryCode) bool { return rc.Used == nil }).Exists()
+	if err != nil {
+		return nil, fmt.Errorf("checking recovery codes: %v", err)
+	} else if exists {
+		return nil, nil
+	}
+	return recoveryCodesReplace(tx)
+}
+
+// recoveryCodesCleanup removes recovery codes if no second factor remains.
+func recoveryCodesCleanup(tx *bstore.Tx) error {
+	s, err := secondFactorStatus(tx)
+	if err != nil {
+		return err
+	}
+	if !s.Enabled() {
+		if _, err := bstore.QueryTx[RecoveryCode](tx).Delete(); err != nil {
+			return fmt.Errorf("removing recovery codes: %v", err)
+		}
+	}
+	return nil
+}
+
+// RecoveryCodesGenerate replaces all recovery codes with new ones. Only allowed
+// when a second factor is configured. The codes are only available once, only
+// their hashes are stored.
+func (a *Account) RecoveryCodesGenerate(ctx context.Context, log mlog.Log) (codes []string, rerr error) {
+	rerr = a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		s, err := secondFactorStatus(tx)
+		if err != nil {
+			return err
+		}
+		if !s.Enabled() {
+			return fmt.Errorf("no second factor configured")
+		}
+		codes, err = recoveryCodesReplace(tx)
+		return err
+	})
+	if rerr == nil {
+		log.Info("recovery codes generated", slog.String("account", a.Name))
+	}
+	return
+}
+
+// TOTPSetup generates a new TOTP secret. It must be confirmed with TOTPConfirm
+// before it is used for logins. An existing unconfirmed secret is replaced. An
+// existing confirmed secret must be removed first.
+func (a *Account) TOTPSetup(ctx context.Context) (secret string, rerr error) {
+	rerr = a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		exists, err := bstore.QueryTx[TOTP](tx).FilterEqual("Confirmed", true).Exists()
+		if err != nil {
+			return fmt.Errorf("checking totp: %v", err)
+		} else if exists {
+			return fmt.Errorf("totp already configured, remove it first")
+		}
+		if _, err := bstore.QueryTx[TOTP](tx).Delete(); err != nil {
+			return fmt.Errorf("removing unconfirmed totp: %v", err)
+		}
+		t := TOTP{Secret: totp.NewSecret()}
+		if err := tx.Insert(&t); err != nil {
+			return fmt.Errorf("inserting totp: %v", err)
+		}
+		secret = t.Secret
+		return nil
+	})
+	return
+}
+
+// TOTPConfirm confirms the TOTP secret from TOTPSetup with a code from the
+// authenticator app, enabling it for logins. If the account has no unused
+// recovery codes, new codes are generated and returned.
+func (a *Account) TOTPConfirm(ctx context.Context, log mlog.Log, code string) (recoveryCodes []string, rerr error) {
+	rerr = a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		t, err := bstore.QueryTx[TOTP](tx).Get()
+		if err == bstore.ErrAbsent {
+			return fmt.Errorf("no totp setup in progress")
+		} else if err != nil {
+			return fmt.Errorf("get totp: %v", err)
+		}
+		if t.Confirmed {
+			return fmt.Errorf("totp already confirmed")
+		}
+		t.LastCounter, err = totp.Verify(t.Secret, code, time.Now(), t.LastCounter)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrSecondFactor, err)
+		}
+		t.Confirmed = true
+		if err := tx.Update(&t); err != nil {
+			return fmt.Errorf("updating totp: %v", err)
+		}
+		recoveryCodes, err = recoveryCodesEnsure(tx)
+		return err
+	})
+	if rerr == nil {
+		log.Info("totp enabled", slog.String("account", a.Name))
+	}
+	return
+}
+
+// TOTPRemove removes the TOTP secret, confirmed or not. If no second factor
+// remains, recovery codes are removed as well.
+func (a *Account) TOTPRemove(ctx context.Context, log mlog.Log) error {
+	err := a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		n, err := bstore.QueryTx[TOTP](tx).Delete()
+		if err != nil {
+			return fmt.Errorf("removing totp: %v", err)
+		} else if n == 0 {
+			return bstore.ErrAbsent
+		}
+		return recoveryCodesCleanup(tx)
+	})
+	if err == nil {
+		log.Info("totp removed", slog.String("account", a.Name))
+	}
+	return err
+}
+
+// WebAuthnCredentialAdd adds a verified credential. If the account has no unused
+// recovery codes, new codes are generated and returned.
+func (a *Account) WebAuthnCredentialAdd(ctx context.Context, log mlog.Log, name string, cred webauthn.Credential) (wc WebAuthnCredential, recoveryCodes []string, rerr error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return WebAuthnCredential{}, nil, fmt.Errorf("name required")
+	}
+	wc = WebAuthnCredential{
+		Name:         name,
+		CredentialID: base64.RawURLEncoding.EncodeToString(cred.ID),
+		PublicKey:    cred.PublicKey,
+		SignCount:    cred.SignCount,
+	}
+	rerr = a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		if err := tx.Insert(&wc); errors.Is(err, bstore.ErrUnique) {
+			return fmt.Errorf("credential already registered")
+		} else if err != nil {
+			return fmt.Errorf("inserting webauthn credential: %v", err)
+		}
+		var err error
+		recoveryCodes, err = recoveryCodesEnsure(tx)
+		return err
+	})
+	if rerr == nil {
+		log.Info("webauthn credential added", slog.String("account", a.Name), slog.String("name", wc.Name))
+	}
+	return
+}
+
+// WebAuthnCredentialRemove removes a credential by ID. If no second factor
+// remains, recovery codes are removed as well. If absent, bstore.ErrAbsent is
+// returned.
+func (a *Account) WebAuthnCredentialRemove(ctx context.Context, log mlog.Log, id int64) error {
+	err := a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		if err := tx.Delete(&WebAuthnCredential{ID: id}); err != nil {
+			return err
+		}
+		return recoveryCodesCleanup(tx)
+	})
+	if err == nil {
+		log.Info("webauthn credential removed", slog.String("account", a.Name), slog.Int64("id", id))
+	}
+	return err
+}
+
+// SecondFactorsClear removes all second factors and recovery codes, e.g. by an
+// admin for a user who lost access to them.
+func (a *Account) SecondFactorsClear(ctx context.Context, log mlog.Log) error {
+	err := a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		if _, err := bstore.QueryTx[TOTP](tx).Delete(); err != nil {
+			return fmt.Errorf("removing totp: %v", err)
+		}
+		if _, err := bstore.QueryTx[WebAuthnCredential](tx).Delete(); err != nil {
+			return fmt.Errorf("removing webauthn credentials: %v", err)
+		}
+		if _, err := bstore.QueryTx[RecoveryCode](tx).Delete(); err != nil {
+			return fmt.Errorf("removing recovery codes: %v", err)
+		}
+		return nil
+	})
+	if err == nil {
+		log.Info("second factors cleared", slog.String("account", a.Name))
+	}
+	return err
+}
+
+// SecondFactorVerifyCode verifies a code as second factor: a TOTP code if it
+// consists of totp.Digits digits, a recovery code otherwise. The kind of second
+// factor that was used is returned. A recovery code can only be used once, as
+// can a TOTP code.
+func (a *Account) SecondFactorVerifyCode(ctx context.Context, code string) (kind string, rerr error) {
+	digits := strings.ReplaceAll(code, " ", "")
+	isTOTP := len(digits) == totp.Digits && strings.Trim(digits, "0123456789") == ""
+	if isTOTP {
+		kind = SecondFactorTOTP
+	} else {
+		kind = SecondFactorRecoveryCode
+	}
+	rerr = a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		if isTOTP {
+			t, err := bstore.QueryTx[TOTP](tx).FilterEqual("Confirmed", true).Get()
+			if err == bstore.ErrAbsent {
+				return fmt.Errorf("%w: no totp configured", ErrSecondFactor)
+			} else if err != nil {
+				return fmt.Errorf("get totp: %v", err)
+			}
+			t.LastCounter, err = totp.Verify(t.Secret, digits, time.Now(), t.LastCounter)
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrSecondFactor, err)
+			}
+			return tx.Update(&t)
+		}
+
+		rc, err := bstore.QueryTx[RecoveryCode](tx).FilterNonzero(RecoveryCode{Hash: recoveryCodeHash(code)}).Get()
+		if err == bstore.ErrAbsent {
+			return fmt.Errorf("%w: unknown recovery code", ErrSecondFactor)
+		} else if err != nil {
+			return fmt.Errorf("get recovery code: %v", err)
+		}
+		if rc.Used != nil {
+			return fmt.Errorf("%w: recovery code already used", ErrSecondFactor)
+		}
+		now := time.Now()
+		rc.Used = &now
+		return tx.Update(&rc)
+	})
+	return
+}
+
+// SecondFactorVerifyWebAuthn verifies a WebAuthn assertion for a registered
+// credential, with raw-url-base64 credentialID. The signature counter and time
+// of last use are updated.
+func (a *Account) SecondFactorVerifyWebAuthn(ctx context.Context, rpID, origin, challenge, credentialID string, clientDataJSON, authenticatorData, signature []byte) error {
+	return a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		wc, err := bstore.QueryTx[WebAuthnCredential](tx).FilterNonzero(WebAuthnCredential{CredentialID: credentialID}).Get()
+		if err == bstore.ErrAbsent {
+			return fmt.Errorf("%w: unknown webauthn credential", ErrSecondFactor)
+		} else if err != nil {
+			return fmt.Errorf("get webauthn credential: %v", err)
+		}
+		wc.SignCount, err = webauthn.VerifyAssertion(rpID, origin, challenge, wc.PublicKey, wc.SignCount, clientDataJSON, authenticatorData, signature)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrSecondFactor, err)
+		}
+		now := time.Now()
+		wc.LastUsed = &now
+		return tx.Update(&wc)
+	})
+}
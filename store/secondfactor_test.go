@@ -0,0 +1,149 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/totp"
+	"github.com/mjl-/mox/webauthn"
+)
+
+func TestSecondFactor(t *testing.T) {
+	log := mlog.New("store", nil)
+	os.RemoveAll("../testdata/store/data")
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/store/mox.conf")
+	mox.MustLoadConfig(true, false)
+	err := Init(ctxbg)
+	tcheck(t, err, "init")
+	defer func() {
+		err := Close()
+		tcheck(t, err, "close")
+	}()
+	defer Switchboard()()
+	acc, err := OpenAccount(log, "mjl", false)
+	tcheck(t, err, "open account")
+	defer func() {
+		err = acc.Close()
+		tcheck(t, err, "closing account")
+		acc.WaitClosed()
+	}()
+
+	s, err := acc.SecondFactors(ctxbg)
+	tcheck(t, err, "second factors")
+	if s.Enabled() {
+		t.Fatalf("second factors enabled for new account")
+	}
+
+	_, err = acc.RecoveryCodesGenerate(ctxbg, log)
+	if err == nil {
+		t.Fatalf("recovery codes generated without second factor")
+	}
+
+	secret, err := acc.TOTPSetup(ctxbg)
+	tcheck(t, err, "totp setup")
+
+	// Not enabled until confirmed.
+	s, err = acc.SecondFactors(ctxbg)
+	tcheck(t, err, "second factors")
+	tcompare(t, s.Enabled(), false)
+
+	_, err = acc.TOTPConfirm(ctxbg, log, "000000x")
+	if !errors.Is(err, ErrSecondFactor) {
+		t.Fatalf("confirm with bad code: got %v, expected ErrSecondFactor", err)
+	}
+
+	now := time.Now()
+	code, err := totp.Code(secret, now)
+	tcheck(t, err, "totp code")
+	recoveryCodes, err := acc.TOTPConfirm(ctxbg, log, code)
+	tcheck(t, err, "totp confirm")
+	tcompare(t, len(recoveryCodes), recoveryCodeCount)
+
+	_, err = acc.TOTPSetup(ctxbg)
+	if err == nil {
+		t.Fatalf("totp setup with confirmed totp present")
+	}
+
+	s, err = acc.SecondFactors(ctxbg)
+	tcheck(t, err, "second factors")
+	tcompare(t, s.TOTP, true)
+	tcompare(t, s.RecoveryCodesUnused, recoveryCodeCount)
+
+	// Code used for confirmation cannot be used again.
+	_, err = acc.SecondFactorVerifyCode(ctxbg, code)
+	if !errors.Is(err, ErrSecondFactor) {
+		t.Fatalf("verify with reused code: got %v, expected ErrSecondFactor", err)
+	}
+
+	code, err = totp.Code(secret, now.Add(30*time.Second))
+	tcheck(t, err, "totp code")
+	kind, err := acc.SecondFactorVerifyCode(ctxbg, code)
+	tcheck(t, err, "verify totp code")
+	tcompare(t, kind, SecondFactorTOTP)
+
+	// Recovery codes can be used once, case-insensitive and ignoring spaces.
+	kind, err = acc.SecondFactorVerifyCode(ctxbg, " "+strings.ToUpper(recoveryCodes[0])+" ")
+	tcheck(t, err, "verify recovery code")
+	tcompare(t, kind, SecondFactorRecoveryCode)
+	_, err = acc.SecondFactorVerifyCode(ctxbg, recoveryCodes[0])
+	if !errors.Is(err, ErrSecondFactor) {
+		t.Fatalf("verify with used recovery code: got %v, expected ErrSecondFactor", err)
+	}
+	_, err = acc.SecondFactorVerifyCode(ctxbg, "bogus-code")
+	if !errors.Is(err, ErrSecondFactor) {
+		t.Fatalf("verify with unknown recovery code: got %v, expected ErrSecondFactor", err)
+	}
+	s, err = acc.SecondFactors(ctxbg)
+	tcheck(t, err, "second factors")
+	tcompare(t, s.RecoveryCodesUnused, recoveryCodeCount-1)
+
+	// New recovery codes replace the old ones.
+	newCodes, err := acc.RecoveryCodesGenerate(ctxbg, log)
+	tcheck(t, err, "generate recovery codes")
+	tcompare(t, len(newCodes), recoveryCodeCount)
+	_, err = acc.SecondFactorVerifyCode(ctxbg, recoveryCodes[1])
+	if !errors.Is(err, ErrSecondFactor) {
+		t.Fatalf("verify with replaced recovery code: got %v, expected ErrSecondFactor", err)
+	}
+
+	// A webauthn credential keeps the existing recovery codes. Verification of
+	// assertions is tested in the webauthn package, here we only check unknown
+	// credentials are rejected.
+	wc, rc, err := acc.WebAuthnCredentialAdd(ctxbg, log, "key", webauthn.Credential{ID: []byte("credential"), PublicKey: []byte{0xa0}})
+	tcheck(t, err, "add webauthn credential")
+	tcompare(t, len(rc), 0)
+	_, _, err = acc.WebAuthnCredentialAdd(ctxbg, log, "key2", webauthn.Credential{ID: []byte("credential"), PublicKey: []byte{0xa0}})
+	if err == nil {
+		t.Fatalf("adding duplicate webauthn credential succeeded")
+	}
+	err = acc.SecondFactorVerifyWebAuthn(ctxbg, "mox.example", "https://mox.example", webauthn.NewChallenge(), "unknown", nil, nil, nil)
+	if !errors.Is(err, ErrSecondFactor) {
+		t.Fatalf("verify unknown webauthn credential: got %v, expected ErrSecondFactor", err)
+	}
+
+	// Removing the last second factor removes the recovery codes.
+	err = acc.TOTPRemove(ctxbg, log)
+	tcheck(t, err, "remove totp")
+	s, err = acc.SecondFactors(ctxbg)
+	tcheck(t, err, "second factors")
+	tcompare(t, s.RecoveryCodesUnused, recoveryCodeCount)
+	err = acc.WebAuthnCredentialRemove(ctxbg, log, wc.ID)
+	tcheck(t, err, "remove webauthn credential")
+	s, err = acc.SecondFactors(ctxbg)
+	tcheck(t, err, "second factors")
+	tcompare(t, s.Enabled(), false)
+	tcompare(t, s.RecoveryCodesUnused, 0)
+
+	err = acc.TOTPRemove(ctxbg, log)
+	if err != bstore.ErrAbsent {
+		t.Fatalf("removing absent totp: got %v, expected ErrAbsent", err)
+	}
+}
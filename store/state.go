@@ -237,6 +237,9 @@ func eraseMessages(log mlog.Log, acc *Account, ids []int64) {
 			if err := tx.Update(&m); err != nil {
 				return fmt.Errorf("mark message %d erase in database: %v", id, err)
 			}
+			if err := searchIndexRemove(tx, id); err != nil {
+				return fmt.Errorf("removing message %d from search index: %v", id, err)
+			}
 
 			if err := tx.Delete(&me); err != nil {
 				return fmt.Errorf("deleting message erase record %d: %v", id, err)
@@ -24,11 +24,12 @@ func (a *Account) HasJunkFilter() bool {
 	return conf.JunkFilter != nil
 }
 
-// OpenJunkFilter returns an opened junk filter for the account.
+// OpenJunkFilter returns an opened junk filter for the account. If the junk filter
+// is configured with Features, the filter also uses message structure features.
 // If the account does not have a junk filter enabled, ErrNotConfigured is returned.
 // Do not forget to save the filter after modifying, and to always close the filter when done.
 // An empty filter is initialized on first access of the filter.
-func (a *Account) OpenJunkFilter(ctx context.Context, log mlog.Log) (*junk.Filter, *config.JunkFilter, error) {
+func (a *Account) OpenJunkFilter(ctx context.Context, log mlog.Log) (junk.Classifier, *config.JunkFilter, error) {
 	conf, ok := a.Conf()
 	if !ok {
 		return nil, nil, ErrAccountUnknown
@@ -42,15 +43,23 @@ func (a *Account) OpenJunkFilter(ctx context.Context, log mlog.Log) (*junk.Filte
 	dbPath := filepath.Join(basePath, a.Name, "junkfilter.db")
 	bloomPath := filepath.Join(basePath, a.Name, "junkfilter.bloom")
 
+	var f *junk.Filter
+	var err error
 	if _, xerr := os.Stat(dbPath); xerr != nil && os.IsNotExist(xerr) {
-		f, err := junk.NewFilter(ctx, log, jf.Params, dbPath, bloomPath)
-		return f, jf, err
+		f, err = junk.NewFilter(ctx, log, jf.Params, dbPath, bloomPath)
+	} else {
+		f, err = junk.OpenFilter(ctx, log, jf.Params, dbPath, bloomPath, false)
 	}
-	f, err := junk.OpenFilter(ctx, log, jf.Params, dbPath, bloomPath, false)
-	return f, jf, err
+	if err != nil {
+		return nil, jf, err
+	}
+	if jf.Features {
+		return junk.NewCombined(f), jf, nil
+	}
+	return f, jf, nil
 }
 
-func (a *Account) ensureJunkFilter(ctx context.Context, log mlog.Log, jfOpt *junk.Filter) (jf *junk.Filter, opened bool, err error) {
+func (a *Account) ensureJunkFilter(ctx context.Context, log mlog.Log, jfOpt junk.Classifier) (jf junk.Classifier, opened bool, err error) {
 	if jfOpt != nil {
 		return jfOpt, false, nil
 	}
@@ -69,7 +78,7 @@ func (a *Account) RetrainMessages(ctx context.Context, log mlog.Log, tx *bstore.
 		return nil
 	}
 
-	var jf *junk.Filter
+	var jf junk.Classifier
 
 	for i := range msgs {
 		if !msgs[i].NeedsTraining() {
@@ -104,7 +113,7 @@ func (a *Account) RetrainMessages(ctx context.Context, log mlog.Log, tx *bstore.
 
 // RetrainMessage untrains and/or trains a message, if relevant given m.TrainedJunk
 // and m.Junk/m.Notjunk. Updates m.TrainedJunk after retraining.
-func (a *Account) RetrainMessage(ctx context.Context, log mlog.Log, tx *bstore.Tx, jf *junk.Filter, m *Message) error {
+func (a *Account) RetrainMessage(ctx context.Context, log mlog.Log, tx *bstore.Tx, jf junk.Classifier, m *Message) error {
 	need, untrain, untrainJunk, train, trainJunk := m.needsTraining()
 	if !need {
 		return nil
@@ -155,7 +164,7 @@ func (a *Account) RetrainMessage(ctx context.Context, log mlog.Log, tx *bstore.T
 
 // TrainMessage trains the junk filter based on the current m.Junk/m.Notjunk flags,
 // disregarding m.TrainedJunk and not updating that field.
-func (a *Account) TrainMessage(ctx context.Context, log mlog.Log, jf *junk.Filter, ham bool, m Message) (bool, error) {
+func (a *Account) TrainMessage(ctx context.Context, log mlog.Log, jf junk.Classifier, ham bool, m Message) (bool, error) {
 	mr := a.MessageReader(m)
 	defer func() {
 		err := mr.Close()
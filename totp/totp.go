@@ -0,0 +1,123 @@
+// Package totp implements time-based one-time passwords (TOTP), RFC 6238, as used
+// by authenticator apps for a second authentication factor.
+//
+// Only the parameters supported by all common authenticator apps are
+// implemented: HMAC-SHA1, 6 digits and a period of 30 seconds.
+package totp
+
+import (
+	"crypto/hmac"
+	cryptorand "crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Period is the number of seconds each code is valid.
+const Period = 30
+
+// Digits is the number of decimal digits in a code.
+const Digits = 6
+
+// Skew is the number of periods before and after the current period for which
+// codes are accepted, to allow for clock differences and slow typing.
+const Skew = 1
+
+var ErrInvalidCode = errors.New("invalid code")
+var ErrReplay = errors.New("code already used")
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewSecret returns a new random secret of 20 bytes (the size of the SHA1 HMAC
+// key), base32-encoded without padding, as used in otpauth URIs.
+func NewSecret() string {
+	buf := make([]byte, 20)
+	cryptorand.Read(buf)
+	return encoding.EncodeToString(buf)
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	secret = strings.TrimRight(secret, "=")
+	buf, err := encoding.DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("decoding base32 secret: %v", err)
+	}
+	return buf, nil
+}
+
+// Counter returns the time step counter for t.
+func Counter(t time.Time) int64 {
+	return t.Unix() / Period
+}
+
+// hotp returns the HOTP value for the key and counter, RFC 4226.
+func hotp(key []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	// Dynamic truncation, RFC 4226 section 5.3.
+	offset := sum[len(sum)-1] & 0xf
+	v := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digits, v%1000000)
+}
+
+// Code returns the code for the base32-encoded secret at time t.
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, Counter(t)), nil
+}
+
+// Verify checks code against the base32-encoded secret at time now, allowing
+// for Skew. Codes for counters at or before lastCounter are rejected with
+// ErrReplay, so a code can only be used once. The counter of the matching code
+// is returned, for storing as lastCounter for the next verification.
+func Verify(secret, code string, now time.Time, lastCounter int64) (counter int64, rerr error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return 0, err
+	}
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != Digits {
+		return 0, ErrInvalidCode
+	}
+	c := Counter(now)
+	for i := c - Skew; i <= c+Skew; i++ {
+		if hmac.Equal([]byte(hotp(key, i)), []byte(code)) {
+			if i <= lastCounter {
+				return 0, ErrReplay
+			}
+			return i, nil
+		}
+	}
+	return 0, ErrInvalidCode
+}
+
+// URI returns an otpauth URI for the secret, for adding to authenticator apps,
+// typically through a QR code. Issuer is e.g. the hostname of the server,
+// account e.g. an email address.
+func URI(issuer, account, secret string) string {
+	u := url.URL{
+		Scheme: "otpauth",
+		Host:   "totp",
+		Path:   "/" + issuer + ":" + account,
+	}
+	qs := url.Values{}
+	qs.Set("secret", secret)
+	qs.Set("issuer", issuer)
+	qs.Set("algorithm", "SHA1")
+	qs.Set("digits", fmt.Sprintf("%d", Digits))
+	qs.Set("period", fmt.Sprintf("%d", Period))
+	u.RawQuery = qs.Encode()
+	return u.String()
+}
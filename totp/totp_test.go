@@ -0,0 +1,70 @@
+package totp
+
+import (
+	"encoding/base32"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVectors(t *testing.T) {
+	// Test vectors from RFC 6238 appendix B, for SHA1 with 8 digits, the last 6
+	// digits are our codes.
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, v := range vectors {
+		code, err := Code(secret, time.Unix(v.unix, 0))
+		if err != nil {
+			t.Fatalf("code: %v", err)
+		}
+		if code != v.code {
+			t.Fatalf("time %d: got code %s, expected %s", v.unix, code, v.code)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	secret := NewSecret()
+	now := time.Now()
+
+	code, err := Code(secret, now.Add(-Period*time.Second))
+	if err != nil {
+		t.Fatalf("code: %v", err)
+	}
+	counter, err := Verify(secret, code, now, 0)
+	if err != nil {
+		t.Fatalf("verify previous period: %v", err)
+	}
+	if counter != Counter(now)-1 {
+		t.Fatalf("got counter %d, expected %d", counter, Counter(now)-1)
+	}
+
+	// Replay is rejected.
+	_, err = Verify(secret, code, now, counter)
+	if !errors.Is(err, ErrReplay) {
+		t.Fatalf("got %v, expected ErrReplay", err)
+	}
+
+	// Outside of skew.
+	code, err = Code(secret, now.Add(-3*Period*time.Second))
+	if err != nil {
+		t.Fatalf("code: %v", err)
+	}
+	if _, err := Verify(secret, code, now, 0); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("got %v, expected ErrInvalidCode", err)
+	}
+
+	if _, err := Verify(secret, "12345", now, 0); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("got %v, expected ErrInvalidCode", err)
+	}
+}
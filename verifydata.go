@@ -17,6 +17,7 @@ import (
 	"github.com/mjl-/bstore"
 
 	"github.com/mjl-/mox/dmarcdb"
+	"github.com/mjl-/mox/greylist"
 	"github.com/mjl-/mox/junk"
 	"github.com/mjl-/mox/moxvar"
 	"github.com/mjl-/mox/mtastsdb"
@@ -348,6 +349,15 @@ possibly making them potentially no longer readable by the previous version.
 					if du.MessageSize != totalSize {
 						checkf(errors.New(`wrong total message size, see mox recalculatemailboxcounts"`), dbpath, "account has wrong total message size %d, should be %d", du.MessageSize, totalSize)
 					}
+					var davSize int64
+					err := bstore.QueryDB[store.DAVObject](ctxbg, db).ForEach(func(o store.DAVObject) error {
+						davSize += int64(len(o.Data))
+						return nil
+					})
+					checkf(err, dbpath, "calculating calendar and contact object size")
+					if err == nil && du.DAVSize != davSize {
+						checkf(errors.New(`wrong total calendar and contact object size, see mox recalculatemailboxcounts"`), dbpath, "account has wrong total calendar and contact object size %d, should be %d", du.DAVSize, davSize)
+					}
 				} else if !errors.Is(err, bstore.ErrAbsent) {
 					checkf(err, dbpath, "get disk usage")
 				}
@@ -431,7 +441,7 @@ possibly making them potentially no longer readable by the previous version.
 				p = p[len(dataDir)+1:]
 			}
 			switch p {
-			case "auth.db", "dmarcrpt.db", "dmarceval.db", "mtasts.db", "tlsrpt.db", "tlsrptresult.db", "receivedid.key", "lastknownversion":
+			case "auth.db", "dmarcrpt.db", "dmarceval.db", "mtasts.db", "tlsrpt.db", "tlsrptresult.db", "greylist.db", "receivedid.key", "lastknownversion", "dnssec-trust-anchors.json":
 				return nil
 			case "acme", "queue", "accounts", "tmp", "moved":
 				return fs.SkipDir
@@ -455,6 +465,7 @@ possibly making them potentially no longer readable by the previous version.
 	checkDB(true, filepath.Join(dataDir, "mtasts.db"), mtastsdb.DBTypes)
 	checkDB(true, filepath.Join(dataDir, "tlsrpt.db"), tlsrptdb.ReportDBTypes)
 	checkDB(false, filepath.Join(dataDir, "tlsrptresult.db"), tlsrptdb.ResultDBTypes) // After v0.0.7.
+	checkDB(false, filepath.Join(dataDir, "greylist.db"), greylist.DBTypes)
 	checkQueue()
 	checkAccounts()
 	checkOther()
@@ -6,6 +6,7 @@ import (
 	"bytes"
 	"context"
 	cryptorand "crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"encoding/pem"
@@ -20,6 +21,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	_ "embed"
@@ -28,6 +30,7 @@ import (
 	"github.com/mjl-/sherpa"
 	"github.com/mjl-/sherpadoc"
 	"github.com/mjl-/sherpaprom"
+	"rsc.io/qr"
 
 	"github.com/mjl-/mox/admin"
 	"github.com/mjl-/mox/config"
@@ -37,8 +40,10 @@ import (
 	"github.com/mjl-/mox/queue"
 	"github.com/mjl-/mox/smtp"
 	"github.com/mjl-/mox/store"
+	"github.com/mjl-/mox/totp"
 	"github.com/mjl-/mox/webapi"
 	"github.com/mjl-/mox/webauth"
+	"github.com/mjl-/mox/webauthn"
 	"github.com/mjl-/mox/webhook"
 	"github.com/mjl-/mox/webops"
 )
@@ -236,7 +241,7 @@ func handle(apiHandler http.Handler, isForwarded bool, w http.ResponseWriter, r
 	var loginAddress, accName string
 	var sessionToken store.SessionToken
 	// All other URLs, except the login endpoint require some authentication.
-	if r.URL.Path != "/api/LoginPrep" && r.URL.Path != "/api/Login" {
+	if r.URL.Path != "/api/LoginPrep" && r.URL.Path != "/api/Login" && r.URL.Path != "/api/LoginSecondFactor" {
 		var ok bool
 		isExport := r.URL.Path == "/export"
 		requireCSRF := isAPI || r.URL.Path == "/import" || isExport
@@ -347,16 +352,34 @@ func (w Account) LoginPrep(ctx context.Context) string {
 }
 
 // Login returns a session token for the credentials, or fails with error code
-// "user:badLogin". Call LoginPrep to get a loginToken.
-func (w Account) Login(ctx context.Context, loginToken, username, password string) store.CSRFToken {
+// "user:badLogin". Call LoginPrep to get a loginToken. If a second factor is
+// required, no session is created yet, and secondFactor is returned instead.
+// Complete the login with LoginSecondFactor.
+func (w Account) Login(ctx context.Context, loginToken, username, password string) (csrfToken store.CSRFToken, secondFactor *webauth.SecondFactorChallenge) {
 	log := pkglog.WithContext(ctx)
 	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
 
-	csrfToken, err := webauth.Login(ctx, log, webauth.Accounts, "webaccount", w.cookiePath, w.isForwarded, reqInfo.Response, reqInfo.Request, loginToken, username, password)
+	csrfToken, secondFactor, err := webauth.Login(ctx, log, webauth.Accounts, "webaccount", w.cookiePath, w.isForwarded, reqInfo.Response, reqInfo.Request, loginToken, username, password)
 	if _, ok := err.(*sherpa.Error); ok {
 		panic(err)
 	}
 	xcheckf(ctx, err, "login")
+	return csrfToken, secondFactor
+}
+
+// LoginSecondFactor completes a login for which Login returned a second factor
+// challenge, with the token from the challenge and a TOTP code, recovery code or
+// WebAuthn assertion. It returns a session token, or fails with error code
+// "user:loginFailed".
+func (w Account) LoginSecondFactor(ctx context.Context, loginToken, token string, response webauth.SecondFactorResponse) store.CSRFToken {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+
+	csrfToken, err := webauth.LoginSecondFactor(ctx, log, webauth.Accounts, "webaccount", w.cookiePath, w.isForwarded, reqInfo.Response, reqInfo.Request, loginToken, token, response)
+	if _, ok := err.(*sherpa.Error); ok {
+		panic(err)
+	}
+	xcheckf(ctx, err, "login with second factor")
 	return csrfToken
 }
 
@@ -795,6 +818,336 @@ func (Account) TLSPublicKeyUpdate(ctx context.Context, pubKey store.TLSPublicKey
 	return nil
 }
 
+// APIKeys returns the API keys for the webapi.
+func (Account) APIKeys(ctx context.Context) []store.APIKey {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName, false)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	l, err := acc.APIKeyList(ctx)
+	xcheckf(ctx, err, "listing api keys")
+	return l
+}
+
+// APIKeyAdd adds a new API key for the webapi. The key is returned, it is only
+// available now, only a hash is stored. If expires is nil, the key does not
+// expire. If ipRanges is empty, the key can be used from all IPs.
+func (Account) APIKeyAdd(ctx context.Context, name string, scopes []string, expires *time.Time, ipRanges []string) (apiKey store.APIKey, key string) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+
+	k := store.APIKey{Name: name, Scopes: scopes, Expires: expires, IPRanges: ipRanges}
+	err := store.CheckAPIKey(k)
+	xcheckuserf(ctx, err, "checking api key")
+
+	acc, err := store.OpenAccount(log, reqInfo.AccountName, false)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	apiKey, key, err = acc.APIKeyAdd(ctx, k)
+	xcheckf(ctx, err, "adding api key")
+	return apiKey, key
+}
+
+// APIKeyRemove removes an API key by ID.
+func (Account) APIKeyRemove(ctx context.Context, id int64) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName, false)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	err = acc.APIKeyRemove(ctx, id)
+	if err == bstore.ErrAbsent {
+		xcheckuserf(ctx, err, "removing api key")
+	}
+	xcheckf(ctx, err, "removing api key")
+}
+
+// AppPasswords returns the app passwords, for use instead of the account
+// password in IMAP, SMTP submission and the webapi.
+func (Account) AppPasswords(ctx context.Context) []store.AppPassword {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName, false)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	l, err := acc.AppPasswordList(ctx)
+	xcheckf(ctx, err, "listing app passwords")
+	return l
+}
+
+// AppPasswordAdd adds a new app password, allowed for protocols ("imap",
+// "submission", "webapi", "dav"). The generated password is returned, it is only
+// available now. If ipRanges is empty, the password can be used from all IPs.
+func (Account) AppPasswordAdd(ctx context.Context, name string, protocols []string, ipRanges []string) (appPassword store.AppPassword, password string) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+
+	ap := store.AppPassword{Name: name, Protocols: protocols, IPRanges: ipRanges}
+	err := store.CheckAppPassword(ap)
+	xcheckuserf(ctx, err, "checking app password")
+
+	acc, err := store.OpenAccount(log, reqInfo.AccountName, false)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	appPassword, password, err = acc.AppPasswordAdd(ctx, log, ap)
+	xcheckf(ctx, err, "adding app password")
+	return appPassword, password
+}
+
+// AppPasswordRemove revokes an app password by ID.
+func (Account) AppPasswordRemove(ctx context.Context, id int64) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName, false)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	err = acc.AppPasswordRemove(ctx, id)
+	if err == bstore.ErrAbsent {
+		xcheckuserf(ctx, err, "removing app password")
+	}
+	xcheckf(ctx, err, "removing app password")
+}
+
+// SecondFactors returns the configured second factors for web logins.
+func (Account) SecondFactors(ctx context.Context) store.SecondFactorStatus {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName, false)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	s, err := acc.SecondFactors(ctx)
+	xcheckf(ctx, err, "listing second factors")
+	return s
+}
+
+// TOTPSetup generates a new TOTP secret for an authenticator app. It returns the
+// secret, an otpauth URI with the secret, and a base64-encoded PNG image with a
+// QR code of the URI. The secret is only used for logins after confirming it with
+// a code through TOTPConfirm.
+func (Account) TOTPSetup(ctx context.Context) (secret, uri, qrCodePNG string) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName, false)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	secret, err = acc.TOTPSetup(ctx)
+	xcheckuserf(ctx, err, "setting up totp")
+	uri = totp.URI(mox.Conf.Static.HostnameDomain.ASCII, reqInfo.LoginAddress, secret)
+	code, err := qr.Encode(uri, qr.M)
+	xcheckf(ctx, err, "generating qr code")
+	return secret, uri, base64.StdEncoding.EncodeToString(code.PNG())
+}
+
+// TOTPConfirm enables the TOTP secret from TOTPSetup, after verifying a code from
+// the authenticator app. If the account did not have unused recovery codes, new
+// recovery codes are returned. They are only available now.
+func (Account) TOTPConfirm(ctx context.Context, code string) (recoveryCodes []string) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName, false)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	recoveryCodes, err = acc.TOTPConfirm(ctx, log, code)
+	xcheckuserf(ctx, err, "confirming totp")
+	return recoveryCodes
+}
+
+// TOTPRemove removes the TOTP secret.
+func (Account) TOTPRemove(ctx context.Context) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName, false)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	err = acc.TOTPRemove(ctx, log)
+	if err == bstore.ErrAbsent {
+		xcheckuserf(ctx, err, "removing totp")
+	}
+	xcheckf(ctx, err, "removing totp")
+}
+
+// RecoveryCodesGenerate replaces the recovery codes with new codes, which are
+// returned. They are only available now.
+func (Account) RecoveryCodesGenerate(ctx context.Context) (recoveryCodes []string) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName, false)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	recoveryCodes, err = acc.RecoveryCodesGenerate(ctx, log)
+	xcheckuserf(ctx, err, "generating recovery codes")
+	return recoveryCodes
+}
+
+// WebAuthnRegisterOptions are the parameters for navigator.credentials.create in
+// the browser, for registering a new security key or passkey. Binary values are
+// raw-url-base64 encoded.
+type WebAuthnRegisterOptions struct {
+	Challenge            string
+	RPID                 string // Relying party ID, the host name.
+	RPName               string
+	UserID               string
+	UserName             string
+	Algorithms           []int    // COSE algorithm identifiers, in order of preference.
+	ExcludeCredentialIDs []string // Already registered credentials.
+}
+
+// webauthnRegistration is a registration in progress, for a session.
+type webauthnRegistration struct {
+	challenge string
+	rpID      string
+	origin    string
+	expires   time.Time
+}
+
+var webauthnRegistrations = struct {
+	sync.Mutex
+	m map[store.SessionToken]webauthnRegistration
+}{m: map[store.SessionToken]webauthnRegistration{}}
+
+// WebAuthnRegisterStart starts registration of a new security key or passkey.
+// The resulting credential must be passed to WebAuthnRegisterFinish within 5
+// minutes.
+func (w Account) WebAuthnRegisterStart(ctx context.Context) WebAuthnRegisterOptions {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName, false)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	s, err := acc.SecondFactors(ctx)
+	xcheckf(ctx, err, "listing second factors")
+
+	reg := webauthnRegistration{challenge: webauthn.NewChallenge(), expires: time.Now().Add(5 * time.Minute)}
+	reg.rpID, reg.origin = webauth.RelyingParty(w.isForwarded, reqInfo.Request)
+
+	webauthnRegistrations.Lock()
+	for token, r := range webauthnRegistrations.m {
+		if time.Until(r.expires) < 0 {
+			delete(webauthnRegistrations.m, token)
+		}
+	}
+	webauthnRegistrations.m[reqInfo.SessionToken] = reg
+	webauthnRegistrations.Unlock()
+
+	// The user handle must not contain personal information, we use a hash of the
+	// account name.
+	userID := sha256.Sum256([]byte(reqInfo.AccountName))
+	opts := WebAuthnRegisterOptions{
+		Challenge:  reg.challenge,
+		RPID:       reg.rpID,
+		RPName:     "mox " + mox.Conf.Static.HostnameDomain.ASCII,
+		UserID:     base64.RawURLEncoding.EncodeToString(userID[:16]),
+		UserName:   reqInfo.LoginAddress,
+		Algorithms: webauthn.Algorithms,
+	}
+	for _, wc := range s.WebAuthn {
+		opts.ExcludeCredentialIDs = append(opts.ExcludeCredentialIDs, wc.CredentialID)
+	}
+	return opts
+}
+
+// WebAuthnRegisterFinish verifies and adds the credential created in the browser
+// after WebAuthnRegisterStart. ClientDataJSON and attestationObject are
+// raw-url-base64 encoded. If the account did not have unused recovery codes, new
+// recovery codes are returned. They are only available now.
+func (Account) WebAuthnRegisterFinish(ctx context.Context, name, clientDataJSON, attestationObject string) (credential store.WebAuthnCredential, recoveryCodes []string) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+
+	webauthnRegistrations.Lock()
+	reg, ok := webauthnRegistrations.m[reqInfo.SessionToken]
+	delete(webauthnRegistrations.m, reqInfo.SessionToken)
+	webauthnRegistrations.Unlock()
+	if !ok || time.Until(reg.expires) < 0 {
+		xcheckuserf(ctx, errors.New("no registration in progress or expired"), "registering credential")
+	}
+
+	cdj, err := base64.RawURLEncoding.DecodeString(clientDataJSON)
+	xcheckuserf(ctx, err, "decoding client data")
+	attObj, err := base64.RawURLEncoding.DecodeString(attestationObject)
+	xcheckuserf(ctx, err, "decoding attestation object")
+	cred, err := webauthn.VerifyRegistration(reg.rpID, reg.origin, reg.challenge, cdj, attObj)
+	xcheckuserf(ctx, err, "verifying credential")
+
+	acc, err := store.OpenAccount(log, reqInfo.AccountName, false)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	credential, recoveryCodes, err = acc.WebAuthnCredentialAdd(ctx, log, name, cred)
+	xcheckuserf(ctx, err, "adding credential")
+	return credential, recoveryCodes
+}
+
+// WebAuthnCredentialRemove removes a security key or passkey by ID.
+func (Account) WebAuthnCredentialRemove(ctx context.Context, id int64) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName, false)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	err = acc.WebAuthnCredentialRemove(ctx, log, id)
+	if err == bstore.ErrAbsent {
+		xcheckuserf(ctx, err, "removing credential")
+	}
+	xcheckf(ctx, err, "removing credential")
+}
+
 func (Account) LoginAttempts(ctx context.Context, limit int) []store.LoginAttempt {
 	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
 	l, err := store.LoginAttemptList(ctx, reqInfo.AccountName, limit)
@@ -802,6 +1155,16 @@ func (Account) LoginAttempts(ctx context.Context, limit int) []store.LoginAttemp
 	return l
 }
 
+// SendUsage returns the numbers of messages and recipients submitted by the
+// account in the past hour, day and month, for comparing against the send limits
+// of the account.
+func (Account) SendUsage(ctx context.Context) queue.SendUsageCounts {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	c, err := queue.SendUsageAccount(ctx, reqInfo.AccountName)
+	xcheckf(ctx, err, "get send usage")
+	return c
+}
+
 func (Account) IMAPSave(ctx context.Context, capabilitiesDisabled []string) {
 	// Basic check for capabilities.
 	for _, s := range capabilitiesDisabled {
@@ -265,22 +265,30 @@ var api;
 		AuthResult["AuthBadChannelBinding"] = "badchanbind";
 		AuthResult["AuthBadProtocol"] = "badprotocol";
 		AuthResult["AuthLoginDisabled"] = "logindisabled";
+		AuthResult["AuthSecondFactorRequired"] = "secondfactor";
 		AuthResult["AuthError"] = "error";
 		AuthResult["AuthAborted"] = "aborted";
 	})(AuthResult = api.AuthResult || (api.AuthResult = {}));
-	api.structTypes = { "Account": true, "Address": true, "AddressAlias": true, "Alias": true, "AliasAddress": true, "AutomaticJunkFlags": true, "Destination": true, "Domain": true, "ImportProgress": true, "Incoming": true, "IncomingMeta": true, "IncomingWebhook": true, "JunkFilter": true, "LoginAttempt": true, "NameAddress": true, "Outgoing": true, "OutgoingWebhook": true, "Route": true, "Ruleset": true, "Structure": true, "SubjectPass": true, "Suppression": true, "TLSPublicKey": true };
+	api.structTypes = { "APIKey": true, "Account": true, "Address": true, "AddressAlias": true, "Alias": true, "AliasAddress": true, "AppPassword": true, "AttachmentRule": true, "AutomaticJunkFlags": true, "Destination": true, "Domain": true, "ImportProgress": true, "Incoming": true, "IncomingMeta": true, "IncomingWebhook": true, "JunkFilter": true, "LoginAttempt": true, "NameAddress": true, "Outgoing": true, "OutgoingWebhook": true, "Route": true, "Ruleset": true, "SecondFactorChallenge": true, "SecondFactorResponse": true, "SecondFactorStatus": true, "SendCounts": true, "SendLimit": true, "SendLimitCounts": true, "SendLimits": true, "SendUsageCounts": true, "Structure": true, "SubjectPass": true, "Suppression": true, "TLSPublicKey": true, "WebAuthnAssertion": true, "WebAuthnCredential": true, "WebAuthnRegisterOptions": true, "WebAuthnRequest": true };
 	api.stringsTypes = { "AuthResult": true, "CSRFToken": true, "Localpart": true, "OutgoingEvent": true };
 	api.intsTypes = {};
 	api.types = {
-		"Account": { "Name": "Account", "Docs": "", "Fields": [{ "Name": "OutgoingWebhook", "Docs": "", "Typewords": ["nullable", "OutgoingWebhook"] }, { "Name": "IncomingWebhook", "Docs": "", "Typewords": ["nullable", "IncomingWebhook"] }, { "Name": "FromIDLoginAddresses", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "KeepRetiredMessagePeriod", "Docs": "", "Typewords": ["int64"] }, { "Name": "KeepRetiredWebhookPeriod", "Docs": "", "Typewords": ["int64"] }, { "Name": "LoginDisabled", "Docs": "", "Typewords": ["string"] }, { "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "Description", "Docs": "", "Typewords": ["string"] }, { "Name": "FullName", "Docs": "", "Typewords": ["string"] }, { "Name": "Destinations", "Docs": "", "Typewords": ["{}", "Destination"] }, { "Name": "SubjectPass", "Docs": "", "Typewords": ["SubjectPass"] }, { "Name": "QuotaMessageSize", "Docs": "", "Typewords": ["int64"] }, { "Name": "RejectsMailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "KeepRejects", "Docs": "", "Typewords": ["bool"] }, { "Name": "AutomaticJunkFlags", "Docs": "", "Typewords": ["AutomaticJunkFlags"] }, { "Name": "JunkFilter", "Docs": "", "Typewords": ["nullable", "JunkFilter"] }, { "Name": "MaxOutgoingMessagesPerDay", "Docs": "", "Typewords": ["int32"] }, { "Name": "MaxFirstTimeRecipientsPerDay", "Docs": "", "Typewords": ["int32"] }, { "Name": "NoFirstTimeSenderDelay", "Docs": "", "Typewords": ["bool"] }, { "Name": "NoCustomPassword", "Docs": "", "Typewords": ["bool"] }, { "Name": "IMAPCapabilitiesDisabled", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Routes", "Docs": "", "Typewords": ["[]", "Route"] }, { "Name": "DNSDomain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "Aliases", "Docs": "", "Typewords": ["[]", "AddressAlias"] }] },
-		"OutgoingWebhook": { "Name": "OutgoingWebhook", "Docs": "", "Fields": [{ "Name": "URL", "Docs": "", "Typewords": ["string"] }, { "Name": "Authorization", "Docs": "", "Typewords": ["string"] }, { "Name": "Events", "Docs": "", "Typewords": ["[]", "string"] }] },
-		"IncomingWebhook": { "Name": "IncomingWebhook", "Docs": "", "Fields": [{ "Name": "URL", "Docs": "", "Typewords": ["string"] }, { "Name": "Authorization", "Docs": "", "Typewords": ["string"] }] },
+		"SecondFactorChallenge": { "Name": "SecondFactorChallenge", "Docs": "", "Fields": [{ "Name": "Token", "Docs": "", "Typewords": ["string"] }, { "Name": "TOTP", "Docs": "", "Typewords": ["bool"] }, { "Name": "RecoveryCodes", "Docs": "", "Typewords": ["bool"] }, { "Name": "WebAuthn", "Docs": "", "Typewords": ["nullable", "WebAuthnRequest"] }] },
+		"WebAuthnRequest": { "Name": "WebAuthnRequest", "Docs": "", "Fields": [{ "Name": "Challenge", "Docs": "", "Typewords": ["string"] }, { "Name": "RPID", "Docs": "", "Typewords": ["string"] }, { "Name": "CredentialIDs", "Docs": "", "Typewords": ["[]", "string"] }] },
+		"SecondFactorResponse": { "Name": "SecondFactorResponse", "Docs": "", "Fields": [{ "Name": "Code", "Docs": "", "Typewords": ["string"] }, { "Name": "WebAuthn", "Docs": "", "Typewords": ["nullable", "WebAuthnAssertion"] }] },
+		"WebAuthnAssertion": { "Name": "WebAuthnAssertion", "Docs": "", "Fields": [{ "Name": "CredentialID", "Docs": "", "Typewords": ["string"] }, { "Name": "ClientDataJSON", "Docs": "", "Typewords": ["string"] }, { "Name": "AuthenticatorData", "Docs": "", "Typewords": ["string"] }, { "Name": "Signature", "Docs": "", "Typewords": ["string"] }] },
+		"Account": { "Name": "Account", "Docs": "", "Fields": [{ "Name": "OutgoingWebhook", "Docs": "", "Typewords": ["nullable", "OutgoingWebhook"] }, { "Name": "IncomingWebhook", "Docs": "", "Typewords": ["nullable", "IncomingWebhook"] }, { "Name": "FromIDLoginAddresses", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "KeepRetiredMessagePeriod", "Docs": "", "Typewords": ["int64"] }, { "Name": "KeepRetiredWebhookPeriod", "Docs": "", "Typewords": ["int64"] }, { "Name": "LoginDisabled", "Docs": "", "Typewords": ["string"] }, { "Name": "RequireSecondFactor", "Docs": "", "Typewords": ["bool"] }, { "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "Description", "Docs": "", "Typewords": ["string"] }, { "Name": "FullName", "Docs": "", "Typewords": ["string"] }, { "Name": "Destinations", "Docs": "", "Typewords": ["{}", "Destination"] }, { "Name": "SubjectPass", "Docs": "", "Typewords": ["SubjectPass"] }, { "Name": "QuotaMessageSize", "Docs": "", "Typewords": ["int64"] }, { "Name": "RejectsMailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "KeepRejects", "Docs": "", "Typewords": ["bool"] }, { "Name": "AutomaticJunkFlags", "Docs": "", "Typewords": ["AutomaticJunkFlags"] }, { "Name": "JunkFilter", "Docs": "", "Typewords": ["nullable", "JunkFilter"] }, { "Name": "MaxOutgoingMessagesPerDay", "Docs": "", "Typewords": ["int32"] }, { "Name": "MaxFirstTimeRecipientsPerDay", "Docs": "", "Typewords": ["int32"] }, { "Name": "SendLimits", "Docs": "", "Typewords": ["nullable", "SendLimits"] }, { "Name": "NoFirstTimeSenderDelay", "Docs": "", "Typewords": ["bool"] }, { "Name": "NoCustomPassword", "Docs": "", "Typewords": ["bool"] }, { "Name": "IMAPCapabilitiesDisabled", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "AttachmentRules", "Docs": "", "Typewords": ["[]", "AttachmentRule"] }, { "Name": "Routes", "Docs": "", "Typewords": ["[]", "Route"] }, { "Name": "DNSDomain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "Aliases", "Docs": "", "Typewords": ["[]", "AddressAlias"] }] },
+		"OutgoingWebhook": { "Name": "OutgoingWebhook", "Docs": "", "Fields": [{ "Name": "URL", "Docs": "", "Typewords": ["string"] }, { "Name": "Authorization", "Docs": "", "Typewords": ["string"] }, { "Name": "EventStreamOnly", "Docs": "", "Typewords": ["bool"] }, { "Name": "Events", "Docs": "", "Typewords": ["[]", "string"] }] },
+		"IncomingWebhook": { "Name": "IncomingWebhook", "Docs": "", "Fields": [{ "Name": "URL", "Docs": "", "Typewords": ["string"] }, { "Name": "Authorization", "Docs": "", "Typewords": ["string"] }, { "Name": "EventStreamOnly", "Docs": "", "Typewords": ["bool"] }] },
 		"Destination": { "Name": "Destination", "Docs": "", "Fields": [{ "Name": "Mailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "Rulesets", "Docs": "", "Typewords": ["[]", "Ruleset"] }, { "Name": "SMTPError", "Docs": "", "Typewords": ["string"] }, { "Name": "MessageAuthRequiredSMTPError", "Docs": "", "Typewords": ["string"] }, { "Name": "FullName", "Docs": "", "Typewords": ["string"] }] },
 		"Ruleset": { "Name": "Ruleset", "Docs": "", "Fields": [{ "Name": "SMTPMailFromRegexp", "Docs": "", "Typewords": ["string"] }, { "Name": "MsgFromRegexp", "Docs": "", "Typewords": ["string"] }, { "Name": "VerifiedDomain", "Docs": "", "Typewords": ["string"] }, { "Name": "HeadersRegexp", "Docs": "", "Typewords": ["{}", "string"] }, { "Name": "IsForward", "Docs": "", "Typewords": ["bool"] }, { "Name": "ListAllowDomain", "Docs": "", "Typewords": ["string"] }, { "Name": "AcceptRejectsToMailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "Mailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "Comment", "Docs": "", "Typewords": ["string"] }, { "Name": "VerifiedDNSDomain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "ListAllowDNSDomain", "Docs": "", "Typewords": ["Domain"] }] },
 		"Domain": { "Name": "Domain", "Docs": "", "Fields": [{ "Name": "ASCII", "Docs": "", "Typewords": ["string"] }, { "Name": "Unicode", "Docs": "", "Typewords": ["string"] }] },
 		"SubjectPass": { "Name": "SubjectPass", "Docs": "", "Fields": [{ "Name": "Period", "Docs": "", "Typewords": ["int64"] }] },
 		"AutomaticJunkFlags": { "Name": "AutomaticJunkFlags", "Docs": "", "Fields": [{ "Name": "Enabled", "Docs": "", "Typewords": ["bool"] }, { "Name": "JunkMailboxRegexp", "Docs": "", "Typewords": ["string"] }, { "Name": "NeutralMailboxRegexp", "Docs": "", "Typewords": ["string"] }, { "Name": "NotJunkMailboxRegexp", "Docs": "", "Typewords": ["string"] }] },
-		"JunkFilter": { "Name": "JunkFilter", "Docs": "", "Fields": [{ "Name": "Threshold", "Docs": "", "Typewords": ["float64"] }, { "Name": "Onegrams", "Docs": "", "Typewords": ["bool"] }, { "Name": "Twograms", "Docs": "", "Typewords": ["bool"] }, { "Name": "Threegrams", "Docs": "", "Typewords": ["bool"] }, { "Name": "MaxPower", "Docs": "", "Typewords": ["float64"] }, { "Name": "TopWords", "Docs": "", "Typewords": ["int32"] }, { "Name": "IgnoreWords", "Docs": "", "Typewords": ["float64"] }, { "Name": "RareWords", "Docs": "", "Typewords": ["int32"] }] },
+		"JunkFilter": { "Name": "JunkFilter", "Docs": "", "Fields": [{ "Name": "Threshold", "Docs": "", "Typewords": ["float64"] }, { "Name": "Onegrams", "Docs": "", "Typewords": ["bool"] }, { "Name": "Twograms", "Docs": "", "Typewords": ["bool"] }, { "Name": "Threegrams", "Docs": "", "Typewords": ["bool"] }, { "Name": "MaxPower", "Docs": "", "Typewords": ["float64"] }, { "Name": "TopWords", "Docs": "", "Typewords": ["int32"] }, { "Name": "IgnoreWords", "Docs": "", "Typewords": ["float64"] }, { "Name": "RareWords", "Docs": "", "Typewords": ["int32"] }, { "Name": "Features", "Docs": "", "Typewords": ["bool"] }] },
+		"SendLimits": { "Name": "SendLimits", "Docs": "", "Fields": [{ "Name": "All", "Docs": "", "Typewords": ["SendLimitCounts"] }, { "Name": "Submission", "Docs": "", "Typewords": ["SendLimitCounts"] }, { "Name": "WebAPI", "Docs": "", "Typewords": ["SendLimitCounts"] }, { "Name": "Policy", "Docs": "", "Typewords": ["string"] }] },
+		"SendLimitCounts": { "Name": "SendLimitCounts", "Docs": "", "Fields": [{ "Name": "MessagesPerHour", "Docs": "", "Typewords": ["int32"] }, { "Name": "MessagesPerDay", "Docs": "", "Typewords": ["int32"] }, { "Name": "MessagesPerMonth", "Docs": "", "Typewords": ["int32"] }, { "Name": "RecipientsPerHour", "Docs": "", "Typewords": ["int32"] }, { "Name": "RecipientsPerDay", "Docs": "", "Typewords": ["int32"] }, { "Name": "RecipientsPerMonth", "Docs": "", "Typewords": ["int32"] }] },
+		"AttachmentRule": { "Name": "AttachmentRule", "Docs": "", "Fields": [{ "Name": "Direction", "Docs": "", "Typewords": ["string"] }, { "Name": "ContentTypes", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Extensions", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "EncryptedArchive", "Docs": "", "Typewords": ["bool"] }, { "Name": "UninspectableArchive", "Docs": "", "Typewords": ["bool"] }, { "Name": "MinSize", "Docs": "", "Typewords": ["int64"] }, { "Name": "Action", "Docs": "", "Typewords": ["string"] }] },
 		"Route": { "Name": "Route", "Docs": "", "Fields": [{ "Name": "FromDomain", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ToDomain", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "MinimumAttempts", "Docs": "", "Typewords": ["int32"] }, { "Name": "Transport", "Docs": "", "Typewords": ["string"] }, { "Name": "FromDomainASCII", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ToDomainASCII", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"AddressAlias": { "Name": "AddressAlias", "Docs": "", "Fields": [{ "Name": "SubscriptionAddress", "Docs": "", "Typewords": ["string"] }, { "Name": "Alias", "Docs": "", "Typewords": ["Alias"] }, { "Name": "MemberAddresses", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"Alias": { "Name": "Alias", "Docs": "", "Fields": [{ "Name": "Addresses", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "PostPublic", "Docs": "", "Typewords": ["bool"] }, { "Name": "ListMembers", "Docs": "", "Typewords": ["bool"] }, { "Name": "AllowMsgFrom", "Docs": "", "Typewords": ["bool"] }, { "Name": "LocalpartStr", "Docs": "", "Typewords": ["string"] }, { "Name": "Domain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "ParsedAddresses", "Docs": "", "Typewords": ["[]", "AliasAddress"] }] },
@@ -288,19 +296,31 @@ var api;
 		"Address": { "Name": "Address", "Docs": "", "Fields": [{ "Name": "Localpart", "Docs": "", "Typewords": ["Localpart"] }, { "Name": "Domain", "Docs": "", "Typewords": ["Domain"] }] },
 		"Suppression": { "Name": "Suppression", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Created", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "BaseAddress", "Docs": "", "Typewords": ["string"] }, { "Name": "OriginalAddress", "Docs": "", "Typewords": ["string"] }, { "Name": "Manual", "Docs": "", "Typewords": ["bool"] }, { "Name": "Reason", "Docs": "", "Typewords": ["string"] }] },
 		"ImportProgress": { "Name": "ImportProgress", "Docs": "", "Fields": [{ "Name": "Token", "Docs": "", "Typewords": ["string"] }] },
-		"Outgoing": { "Name": "Outgoing", "Docs": "", "Fields": [{ "Name": "Version", "Docs": "", "Typewords": ["int32"] }, { "Name": "Event", "Docs": "", "Typewords": ["OutgoingEvent"] }, { "Name": "DSN", "Docs": "", "Typewords": ["bool"] }, { "Name": "Suppressing", "Docs": "", "Typewords": ["bool"] }, { "Name": "QueueMsgID", "Docs": "", "Typewords": ["int64"] }, { "Name": "FromID", "Docs": "", "Typewords": ["string"] }, { "Name": "MessageID", "Docs": "", "Typewords": ["string"] }, { "Name": "Subject", "Docs": "", "Typewords": ["string"] }, { "Name": "WebhookQueued", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "SMTPCode", "Docs": "", "Typewords": ["int32"] }, { "Name": "SMTPEnhancedCode", "Docs": "", "Typewords": ["string"] }, { "Name": "Error", "Docs": "", "Typewords": ["string"] }, { "Name": "Extra", "Docs": "", "Typewords": ["{}", "string"] }] },
+		"Outgoing": { "Name": "Outgoing", "Docs": "", "Fields": [{ "Name": "Version", "Docs": "", "Typewords": ["int32"] }, { "Name": "Event", "Docs": "", "Typewords": ["OutgoingEvent"] }, { "Name": "DSN", "Docs": "", "Typewords": ["bool"] }, { "Name": "Suppressing", "Docs": "", "Typewords": ["bool"] }, { "Name": "QueueMsgID", "Docs": "", "Typewords": ["int64"] }, { "Name": "FromID", "Docs": "", "Typewords": ["string"] }, { "Name": "MessageID", "Docs": "", "Typewords": ["string"] }, { "Name": "Subject", "Docs": "", "Typewords": ["string"] }, { "Name": "WebhookQueued", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "SMTPCode", "Docs": "", "Typewords": ["int32"] }, { "Name": "SMTPEnhancedCode", "Docs": "", "Typewords": ["string"] }, { "Name": "Error", "Docs": "", "Typewords": ["string"] }, { "Name": "Extra", "Docs": "", "Typewords": ["{}", "string"] }, { "Name": "SendLimit", "Docs": "", "Typewords": ["nullable", "SendLimit"] }] },
+		"SendLimit": { "Name": "SendLimit", "Docs": "", "Fields": [{ "Name": "Scope", "Docs": "", "Typewords": ["string"] }, { "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "Source", "Docs": "", "Typewords": ["string"] }, { "Name": "Kind", "Docs": "", "Typewords": ["string"] }, { "Name": "Period", "Docs": "", "Typewords": ["string"] }, { "Name": "Limit", "Docs": "", "Typewords": ["int32"] }, { "Name": "Count", "Docs": "", "Typewords": ["int32"] }, { "Name": "Policy", "Docs": "", "Typewords": ["string"] }] },
 		"Incoming": { "Name": "Incoming", "Docs": "", "Fields": [{ "Name": "Version", "Docs": "", "Typewords": ["int32"] }, { "Name": "From", "Docs": "", "Typewords": ["[]", "NameAddress"] }, { "Name": "To", "Docs": "", "Typewords": ["[]", "NameAddress"] }, { "Name": "CC", "Docs": "", "Typewords": ["[]", "NameAddress"] }, { "Name": "BCC", "Docs": "", "Typewords": ["[]", "NameAddress"] }, { "Name": "ReplyTo", "Docs": "", "Typewords": ["[]", "NameAddress"] }, { "Name": "Subject", "Docs": "", "Typewords": ["string"] }, { "Name": "MessageID", "Docs": "", "Typewords": ["string"] }, { "Name": "InReplyTo", "Docs": "", "Typewords": ["string"] }, { "Name": "References", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Date", "Docs": "", "Typewords": ["nullable", "timestamp"] }, { "Name": "Text", "Docs": "", "Typewords": ["string"] }, { "Name": "HTML", "Docs": "", "Typewords": ["string"] }, { "Name": "Structure", "Docs": "", "Typewords": ["Structure"] }, { "Name": "Meta", "Docs": "", "Typewords": ["IncomingMeta"] }] },
 		"NameAddress": { "Name": "NameAddress", "Docs": "", "Fields": [{ "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "Address", "Docs": "", "Typewords": ["string"] }] },
 		"Structure": { "Name": "Structure", "Docs": "", "Fields": [{ "Name": "ContentType", "Docs": "", "Typewords": ["string"] }, { "Name": "ContentTypeParams", "Docs": "", "Typewords": ["{}", "string"] }, { "Name": "ContentID", "Docs": "", "Typewords": ["string"] }, { "Name": "ContentDisposition", "Docs": "", "Typewords": ["string"] }, { "Name": "Filename", "Docs": "", "Typewords": ["string"] }, { "Name": "DecodedSize", "Docs": "", "Typewords": ["int64"] }, { "Name": "Parts", "Docs": "", "Typewords": ["[]", "Structure"] }] },
 		"IncomingMeta": { "Name": "IncomingMeta", "Docs": "", "Fields": [{ "Name": "MsgID", "Docs": "", "Typewords": ["int64"] }, { "Name": "MailFrom", "Docs": "", "Typewords": ["string"] }, { "Name": "MailFromValidated", "Docs": "", "Typewords": ["bool"] }, { "Name": "MsgFromValidated", "Docs": "", "Typewords": ["bool"] }, { "Name": "RcptTo", "Docs": "", "Typewords": ["string"] }, { "Name": "DKIMVerifiedDomains", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "RemoteIP", "Docs": "", "Typewords": ["string"] }, { "Name": "Received", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "MailboxName", "Docs": "", "Typewords": ["string"] }, { "Name": "Automated", "Docs": "", "Typewords": ["bool"] }] },
 		"TLSPublicKey": { "Name": "TLSPublicKey", "Docs": "", "Fields": [{ "Name": "Fingerprint", "Docs": "", "Typewords": ["string"] }, { "Name": "Created", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Type", "Docs": "", "Typewords": ["string"] }, { "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "NoIMAPPreauth", "Docs": "", "Typewords": ["bool"] }, { "Name": "CertDER", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "LoginAddress", "Docs": "", "Typewords": ["string"] }] },
-		"LoginAttempt": { "Name": "LoginAttempt", "Docs": "", "Fields": [{ "Name": "Key", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "Last", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "First", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Count", "Docs": "", "Typewords": ["int64"] }, { "Name": "AccountName", "Docs": "", "Typewords": ["string"] }, { "Name": "LoginAddress", "Docs": "", "Typewords": ["string"] }, { "Name": "RemoteIP", "Docs": "", "Typewords": ["string"] }, { "Name": "LocalIP", "Docs": "", "Typewords": ["string"] }, { "Name": "TLS", "Docs": "", "Typewords": ["string"] }, { "Name": "TLSPubKeyFingerprint", "Docs": "", "Typewords": ["string"] }, { "Name": "Protocol", "Docs": "", "Typewords": ["string"] }, { "Name": "UserAgent", "Docs": "", "Typewords": ["string"] }, { "Name": "AuthMech", "Docs": "", "Typewords": ["string"] }, { "Name": "Result", "Docs": "", "Typewords": ["AuthResult"] }] },
+		"APIKey": { "Name": "APIKey", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Created", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "Prefix", "Docs": "", "Typewords": ["string"] }, { "Name": "Scopes", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Expires", "Docs": "", "Typewords": ["nullable", "timestamp"] }, { "Name": "IPRanges", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "LastUsed", "Docs": "", "Typewords": ["nullable", "timestamp"] }, { "Name": "LastUsedIP", "Docs": "", "Typewords": ["string"] }] },
+		"AppPassword": { "Name": "AppPassword", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Created", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Prefix", "Docs": "", "Typewords": ["string"] }, { "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "Protocols", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "IPRanges", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "LastUsed", "Docs": "", "Typewords": ["nullable", "timestamp"] }, { "Name": "LastUsedIP", "Docs": "", "Typewords": ["string"] }, { "Name": "LastUsedProtocol", "Docs": "", "Typewords": ["string"] }] },
+		"SecondFactorStatus": { "Name": "SecondFactorStatus", "Docs": "", "Fields": [{ "Name": "TOTP", "Docs": "", "Typewords": ["bool"] }, { "Name": "WebAuthn", "Docs": "", "Typewords": ["[]", "WebAuthnCredential"] }, { "Name": "RecoveryCodesUnused", "Docs": "", "Typewords": ["int32"] }] },
+		"WebAuthnCredential": { "Name": "WebAuthnCredential", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Created", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "CredentialID", "Docs": "", "Typewords": ["string"] }, { "Name": "LastUsed", "Docs": "", "Typewords": ["nullable", "timestamp"] }] },
+		"WebAuthnRegisterOptions": { "Name": "WebAuthnRegisterOptions", "Docs": "", "Fields": [{ "Name": "Challenge", "Docs": "", "Typewords": ["string"] }, { "Name": "RPID", "Docs": "", "Typewords": ["string"] }, { "Name": "RPName", "Docs": "", "Typewords": ["string"] }, { "Name": "UserID", "Docs": "", "Typewords": ["string"] }, { "Name": "UserName", "Docs": "", "Typewords": ["string"] }, { "Name": "Algorithms", "Docs": "", "Typewords": ["[]", "int32"] }, { "Name": "ExcludeCredentialIDs", "Docs": "", "Typewords": ["[]", "string"] }] },
+		"LoginAttempt": { "Name": "LoginAttempt", "Docs": "", "Fields": [{ "Name": "Key", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "Last", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "First", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Count", "Docs": "", "Typewords": ["int64"] }, { "Name": "AccountName", "Docs": "", "Typewords": ["string"] }, { "Name": "LoginAddress", "Docs": "", "Typewords": ["string"] }, { "Name": "RemoteIP", "Docs": "", "Typewords": ["string"] }, { "Name": "LocalIP", "Docs": "", "Typewords": ["string"] }, { "Name": "TLS", "Docs": "", "Typewords": ["string"] }, { "Name": "TLSPubKeyFingerprint", "Docs": "", "Typewords": ["string"] }, { "Name": "Protocol", "Docs": "", "Typewords": ["string"] }, { "Name": "UserAgent", "Docs": "", "Typewords": ["string"] }, { "Name": "AuthMech", "Docs": "", "Typewords": ["string"] }, { "Name": "APIKeyName", "Docs": "", "Typewords": ["string"] }, { "Name": "AppPasswordName", "Docs": "", "Typewords": ["string"] }, { "Name": "SecondFactor", "Docs": "", "Typewords": ["string"] }, { "Name": "Result", "Docs": "", "Typewords": ["AuthResult"] }] },
+		"SendUsageCounts": { "Name": "SendUsageCounts", "Docs": "", "Fields": [{ "Name": "All", "Docs": "", "Typewords": ["SendCounts"] }, { "Name": "Submission", "Docs": "", "Typewords": ["SendCounts"] }, { "Name": "WebAPI", "Docs": "", "Typewords": ["SendCounts"] }] },
+		"SendCounts": { "Name": "SendCounts", "Docs": "", "Fields": [{ "Name": "MessagesHour", "Docs": "", "Typewords": ["int32"] }, { "Name": "MessagesDay", "Docs": "", "Typewords": ["int32"] }, { "Name": "MessagesMonth", "Docs": "", "Typewords": ["int32"] }, { "Name": "RecipientsHour", "Docs": "", "Typewords": ["int32"] }, { "Name": "RecipientsDay", "Docs": "", "Typewords": ["int32"] }, { "Name": "RecipientsMonth", "Docs": "", "Typewords": ["int32"] }] },
 		"CSRFToken": { "Name": "CSRFToken", "Docs": "", "Values": null },
 		"Localpart": { "Name": "Localpart", "Docs": "", "Values": null },
-		"OutgoingEvent": { "Name": "OutgoingEvent", "Docs": "", "Values": [{ "Name": "EventDelivered", "Value": "delivered", "Docs": "" }, { "Name": "EventSuppressed", "Value": "suppressed", "Docs": "" }, { "Name": "EventDelayed", "Value": "delayed", "Docs": "" }, { "Name": "EventFailed", "Value": "failed", "Docs": "" }, { "Name": "EventRelayed", "Value": "relayed", "Docs": "" }, { "Name": "EventExpanded", "Value": "expanded", "Docs": "" }, { "Name": "EventCanceled", "Value": "canceled", "Docs": "" }, { "Name": "EventUnrecognized", "Value": "unrecognized", "Docs": "" }] },
-		"AuthResult": { "Name": "AuthResult", "Docs": "", "Values": [{ "Name": "AuthSuccess", "Value": "ok", "Docs": "" }, { "Name": "AuthBadUser", "Value": "baduser", "Docs": "" }, { "Name": "AuthBadPassword", "Value": "badpassword", "Docs": "" }, { "Name": "AuthBadCredentials", "Value": "badcreds", "Docs": "" }, { "Name": "AuthBadChannelBinding", "Value": "badchanbind", "Docs": "" }, { "Name": "AuthBadProtocol", "Value": "badprotocol", "Docs": "" }, { "Name": "AuthLoginDisabled", "Value": "logindisabled", "Docs": "" }, { "Name": "AuthError", "Value": "error", "Docs": "" }, { "Name": "AuthAborted", "Value": "aborted", "Docs": "" }] },
+		"OutgoingEvent": { "Name": "OutgoingEvent", "Docs": "", "Values": [{ "Name": "EventDelivered", "Value": "delivered", "Docs": "" }, { "Name": "EventSuppressed", "Value": "suppressed", "Docs": "" }, { "Name": "EventDelayed", "Value": "delayed", "Docs": "" }, { "Name": "EventFailed", "Value": "failed", "Docs": "" }, { "Name": "EventRelayed", "Value": "relayed", "Docs": "" }, { "Name": "EventExpanded", "Value": "expanded", "Docs": "" }, { "Name": "EventCanceled", "Value": "canceled", "Docs": "" }, { "Name": "EventUnrecognized", "Value": "unrecognized", "Docs": "" }, { "Name": "EventLimitReached", "Value": "limitreached", "Docs": "" }] },
+		"AuthResult": { "Name": "AuthResult", "Docs": "", "Values": [{ "Name": "AuthSuccess", "Value": "ok", "Docs": "" }, { "Name": "AuthBadUser", "Value": "baduser", "Docs": "" }, { "Name": "AuthBadPassword", "Value": "badpassword", "Docs": "" }, { "Name": "AuthBadCredentials", "Value": "badcreds", "Docs": "" }, { "Name": "AuthBadChannelBinding", "Value": "badchanbind", "Docs": "" }, { "Name": "AuthBadProtocol", "Value": "badprotocol", "Docs": "" }, { "Name": "AuthLoginDisabled", "Value": "logindisabled", "Docs": "" }, { "Name": "AuthSecondFactorRequired", "Value": "secondfactor", "Docs": "" }, { "Name": "AuthError", "Value": "error", "Docs": "" }, { "Name": "AuthAborted", "Value": "aborted", "Docs": "" }] },
 	};
 	api.parser = {
+		SecondFactorChallenge: (v) => api.parse("SecondFactorChallenge", v),
+		WebAuthnRequest: (v) => api.parse("WebAuthnRequest", v),
+		SecondFactorResponse: (v) => api.parse("SecondFactorResponse", v),
+		WebAuthnAssertion: (v) => api.parse("WebAuthnAssertion", v),
 		Account: (v) => api.parse("Account", v),
 		OutgoingWebhook: (v) => api.parse("OutgoingWebhook", v),
 		IncomingWebhook: (v) => api.parse("IncomingWebhook", v),
@@ -310,6 +330,9 @@ var api;
 		SubjectPass: (v) => api.parse("SubjectPass", v),
 		AutomaticJunkFlags: (v) => api.parse("AutomaticJunkFlags", v),
 		JunkFilter: (v) => api.parse("JunkFilter", v),
+		SendLimits: (v) => api.parse("SendLimits", v),
+		SendLimitCounts: (v) => api.parse("SendLimitCounts", v),
+		AttachmentRule: (v) => api.parse("AttachmentRule", v),
 		Route: (v) => api.parse("Route", v),
 		AddressAlias: (v) => api.parse("AddressAlias", v),
 		Alias: (v) => api.parse("Alias", v),
@@ -318,12 +341,20 @@ var api;
 		Suppression: (v) => api.parse("Suppression", v),
 		ImportProgress: (v) => api.parse("ImportProgress", v),
 		Outgoing: (v) => api.parse("Outgoing", v),
+		SendLimit: (v) => api.parse("SendLimit", v),
 		Incoming: (v) => api.parse("Incoming", v),
 		NameAddress: (v) => api.parse("NameAddress", v),
 		Structure: (v) => api.parse("Structure", v),
 		IncomingMeta: (v) => api.parse("IncomingMeta", v),
 		TLSPublicKey: (v) => api.parse("TLSPublicKey", v),
+		APIKey: (v) => api.parse("APIKey", v),
+		AppPassword: (v) => api.parse("AppPassword", v),
+		SecondFactorStatus: (v) => api.parse("SecondFactorStatus", v),
+		WebAuthnCredential: (v) => api.parse("WebAuthnCredential", v),
+		WebAuthnRegisterOptions: (v) => api.parse("WebAuthnRegisterOptions", v),
 		LoginAttempt: (v) => api.parse("LoginAttempt", v),
+		SendUsageCounts: (v) => api.parse("SendUsageCounts", v),
+		SendCounts: (v) => api.parse("SendCounts", v),
 		CSRFToken: (v) => api.parse("CSRFToken", v),
 		Localpart: (v) => api.parse("Localpart", v),
 		OutgoingEvent: (v) => api.parse("OutgoingEvent", v),
@@ -364,14 +395,27 @@ var api;
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
 		// Login returns a session token for the credentials, or fails with error code
-		// "user:badLogin". Call LoginPrep to get a loginToken.
+		// "user:badLogin". Call LoginPrep to get a loginToken. If a second factor is
+		// required, no session is created yet, and secondFactor is returned instead.
+		// Complete the login with LoginSecondFactor.
 		async Login(loginToken, username, password) {
 			const fn = "Login";
 			const paramTypes = [["string"], ["string"], ["string"]];
-			const returnTypes = [["CSRFToken"]];
+			const returnTypes = [["CSRFToken"], ["nullable", "SecondFactorChallenge"]];
 			const params = [loginToken, username, password];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// LoginSecondFactor completes a login for which Login returned a second factor
+		// challenge, with the token from the challenge and a TOTP code, recovery code or
+		// WebAuthn assertion. It returns a session token, or fails with error code
+		// "user:loginFailed".
+		async LoginSecondFactor(loginToken, token, response) {
+			const fn = "LoginSecondFactor";
+			const paramTypes = [["string"], ["string"], ["SecondFactorResponse"]];
+			const returnTypes = [["CSRFToken"]];
+			const params = [loginToken, token, response];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		// Logout invalidates the session token.
 		async Logout() {
 			const fn = "Logout";
@@ -596,6 +640,134 @@ var api;
 			const params = [pubKey];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// APIKeys returns the API keys for the webapi.
+		async APIKeys() {
+			const fn = "APIKeys";
+			const paramTypes = [];
+			const returnTypes = [["[]", "APIKey"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// APIKeyAdd adds a new API key for the webapi. The key is returned, it is only
+		// available now, only a hash is stored. If expires is nil, the key does not
+		// expire. If ipRanges is empty, the key can be used from all IPs.
+		async APIKeyAdd(name, scopes, expires, ipRanges) {
+			const fn = "APIKeyAdd";
+			const paramTypes = [["string"], ["[]", "string"], ["nullable", "timestamp"], ["[]", "string"]];
+			const returnTypes = [["APIKey"], ["string"]];
+			const params = [name, scopes, expires, ipRanges];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// APIKeyRemove removes an API key by ID.
+		async APIKeyRemove(id) {
+			const fn = "APIKeyRemove";
+			const paramTypes = [["int64"]];
+			const returnTypes = [];
+			const params = [id];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// AppPasswords returns the app passwords, for use instead of the account
+		// password in IMAP, SMTP submission and the webapi.
+		async AppPasswords() {
+			const fn = "AppPasswords";
+			const paramTypes = [];
+			const returnTypes = [["[]", "AppPassword"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// AppPasswordAdd adds a new app password, allowed for protocols ("imap",
+		// "submission", "webapi", "dav"). The generated password is returned, it is only
+		// available now. If ipRanges is empty, the password can be used from all IPs.
+		async AppPasswordAdd(name, protocols, ipRanges) {
+			const fn = "AppPasswordAdd";
+			const paramTypes = [["string"], ["[]", "string"], ["[]", "string"]];
+			const returnTypes = [["AppPassword"], ["string"]];
+			const params = [name, protocols, ipRanges];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// AppPasswordRemove revokes an app password by ID.
+		async AppPasswordRemove(id) {
+			const fn = "AppPasswordRemove";
+			const paramTypes = [["int64"]];
+			const returnTypes = [];
+			const params = [id];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// SecondFactors returns the configured second factors for web logins.
+		async SecondFactors() {
+			const fn = "SecondFactors";
+			const paramTypes = [];
+			const returnTypes = [["SecondFactorStatus"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// TOTPSetup generates a new TOTP secret for an authenticator app. It returns the
+		// secret, an otpauth URI with the secret, and a base64-encoded PNG image with a
+		// QR code of the URI. The secret is only used for logins after confirming it with
+		// a code through TOTPConfirm.
+		async TOTPSetup() {
+			const fn = "TOTPSetup";
+			const paramTypes = [];
+			const returnTypes = [["string"], ["string"], ["string"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// TOTPConfirm enables the TOTP secret from TOTPSetup, after verifying a code from
+		// the authenticator app. If the account did not have unused recovery codes, new
+		// recovery codes are returned. They are only available now.
+		async TOTPConfirm(code) {
+			const fn = "TOTPConfirm";
+			const paramTypes = [["string"]];
+			const returnTypes = [["[]", "string"]];
+			const params = [code];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// TOTPRemove removes the TOTP secret.
+		async TOTPRemove() {
+			const fn = "TOTPRemove";
+			const paramTypes = [];
+			const returnTypes = [];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// RecoveryCodesGenerate replaces the recovery codes with new codes, which are
+		// returned. They are only available now.
+		async RecoveryCodesGenerate() {
+			const fn = "RecoveryCodesGenerate";
+			const paramTypes = [];
+			const returnTypes = [["[]", "string"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// WebAuthnRegisterStart starts registration of a new security key or passkey.
+		// The resulting credential must be passed to WebAuthnRegisterFinish within 5
+		// minutes.
+		async WebAuthnRegisterStart() {
+			const fn = "WebAuthnRegisterStart";
+			const paramTypes = [];
+			const returnTypes = [["WebAuthnRegisterOptions"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// WebAuthnRegisterFinish verifies and adds the credential created in the browser
+		// after WebAuthnRegisterStart. ClientDataJSON and attestationObject are
+		// raw-url-base64 encoded. If the account did not have unused recovery codes, new
+		// recovery codes are returned. They are only available now.
+		async WebAuthnRegisterFinish(name, clientDataJSON, attestationObject) {
+			const fn = "WebAuthnRegisterFinish";
+			const paramTypes = [["string"], ["string"], ["string"]];
+			const returnTypes = [["WebAuthnCredential"], ["[]", "string"]];
+			const params = [name, clientDataJSON, attestationObject];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// WebAuthnCredentialRemove removes a security key or passkey by ID.
+		async WebAuthnCredentialRemove(id) {
+			const fn = "WebAuthnCredentialRemove";
+			const paramTypes = [["int64"]];
+			const returnTypes = [];
+			const params = [id];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		async LoginAttempts(limit) {
 			const fn = "LoginAttempts";
 			const paramTypes = [["int32"]];
@@ -603,6 +775,16 @@ var api;
 			const params = [limit];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// SendUsage returns the numbers of messages and recipients submitted by the
+		// account in the past hour, day and month, for comparing against the send limits
+		// of the account.
+		async SendUsage() {
+			const fn = "SendUsage";
+			const paramTypes = [];
+			const returnTypes = [["SendUsageCounts"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		async IMAPSave(capabilitiesDisabled) {
 			const fn = "IMAPSave";
 			const paramTypes = [["[]", "string"]];
@@ -965,6 +1147,72 @@ var api;
 let moxversion;
 let moxgoos;
 let moxgoarch;
+// Base64 without padding and with url-safe characters, as used for WebAuthn values.
+const base64urlEncode = (buf) => btoa(String.fromCharCode(...new Uint8Array(buf))).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+const base64urlDecode = (s) => Uint8Array.from(atob(s.replace(/-/g, '+').replace(/_/g, '/')), c => c.charCodeAt(0));
+// webauthnGet asks the browser for an assertion by a registered security key or
+// passkey, for logging in with a second factor.
+const webauthnGet = async (req) => {
+	const cred = await navigator.credentials.get({
+		publicKey: {
+			challenge: base64urlDecode(req.Challenge),
+			rpId: req.RPID,
+			allowCredentials: (req.CredentialIDs || []).map(id => ({ type: 'public-key', id: base64urlDecode(id) })),
+			userVerification: 'discouraged',
+		},
+	});
+	if (!cred) {
+		throw new Error('no credential selected');
+	}
+	const resp = cred.response;
+	return {
+		CredentialID: base64urlEncode(cred.rawId),
+		ClientDataJSON: base64urlEncode(resp.clientDataJSON),
+		AuthenticatorData: base64urlEncode(resp.authenticatorData),
+		Signature: base64urlEncode(resp.signature),
+	};
+};
+// webauthnCreate asks the browser to create a credential on a security key or
+// as passkey. It returns the raw-url-base64 client data and attestation object.
+const webauthnCreate = async (opts) => {
+	const cred = await navigator.credentials.create({
+		publicKey: {
+			challenge: base64urlDecode(opts.Challenge),
+			rp: { id: opts.RPID, name: opts.RPName },
+			user: { id: base64urlDecode(opts.UserID), name: opts.UserName, displayName: opts.UserName },
+			pubKeyCredParams: (opts.Algorithms || []).map(alg => ({ type: 'public-key', alg: alg })),
+			excludeCredentials: (opts.ExcludeCredentialIDs || []).map(id => ({ type: 'public-key', id: base64urlDecode(id) })),
+			authenticatorSelection: { userVerification: 'discouraged' },
+			attestation: 'none',
+		},
+	});
+	if (!cred) {
+		throw new Error('no credential created');
+	}
+	const resp = cred.response;
+	return [base64urlEncode(resp.clientDataJSON), base64urlEncode(resp.attestationObject)];
+};
+// secondFactorFieldset returns a fieldset for completing a login with a second
+// factor. Verify is called with a code or WebAuthn assertion.
+const secondFactorFieldset = (title, sf, verify) => {
+	let fieldset;
+	let code = null;
+	fieldset = dom.fieldset(dom.h1(title), dom.p('A second factor is required to login.'), sf.TOTP || sf.RecoveryCodes ? dom.label(style({ display: 'block', marginBottom: '2ex' }), dom.div(sf.TOTP ? (sf.RecoveryCodes ? 'Code from authenticator app, or recovery code' : 'Code from authenticator app') : 'Recovery code', style({ marginBottom: '.5ex' })), code = dom.input(attr.autocomplete('one-time-code'), attr.required(''))) : [], dom.div(style({ textAlign: 'center' }), code ? dom.submitbutton('Verify') : [], ' ', sf.WebAuthn ? dom.clickbutton('Use security key', async function click() {
+		try {
+			fieldset.disabled = true;
+			const assertion = await webauthnGet(sf.WebAuthn);
+			await verify({ Code: '', WebAuthn: assertion });
+		}
+		catch (err) {
+			console.log('login error', err);
+			window.alert('Error: ' + errmsg(err));
+		}
+		finally {
+			fieldset.disabled = false;
+		}
+	}) : []));
+	return [fieldset, code];
+};
 const login = async (reason) => {
 	return new Promise((resolve, _) => {
 		const origFocus = document.activeElement;
@@ -973,26 +1221,50 @@ const login = async (reason) => {
 		let autosize;
 		let username;
 		let password;
+		let code = null;
+		let secondFactor = null;
+		const finish = (token) => {
+			try {
+				window.localStorage.setItem('webaccountaddress', username.value);
+				window.localStorage.setItem('webaccountcsrftoken', token);
+			}
+			catch (err) {
+				console.log('saving csrf token in localStorage', err);
+			}
+			root.remove();
+			if (origFocus && origFocus instanceof HTMLElement && origFocus.parentNode) {
+				origFocus.focus();
+			}
+			resolve(token);
+		};
+		const verify = async (resp) => {
+			const token = await client.LoginSecondFactor(secondFactor.loginToken, secondFactor.challenge.Token, resp);
+			finish(token);
+		};
 		const root = dom.div(style({ position: 'absolute', top: 0, right: 0, bottom: 0, left: 0, backgroundColor: '#eee', display: 'flex', alignItems: 'center', justifyContent: 'center', zIndex: '1', animation: 'fadein .15s ease-in' }), dom.div(style({ display: 'flex', flexDirection: 'column', alignItems: 'center' }), reasonElem = reason ? dom.div(style({ marginBottom: '2ex', textAlign: 'center' }), reason) : dom.div(), dom.div(style({ backgroundColor: 'white', borderRadius: '.25em', padding: '1em', boxShadow: '0 0 20px rgba(0, 0, 0, 0.1)', border: '1px solid #ddd', maxWidth: '95vw', overflowX: 'auto', maxHeight: '95vh', overflowY: 'auto', marginBottom: '20vh' }), dom.form(async function submit(e) {
 			e.preventDefault();
 			e.stopPropagation();
 			reasonElem.remove();
 			try {
 				fieldset.disabled = true;
-				const loginToken = await client.LoginPrep();
-				const token = await client.Login(loginToken, username.value, password.value);
-				try {
-					window.localStorage.setItem('webaccountaddress', username.value);
-					window.localStorage.setItem('webaccountcsrftoken', token);
-				}
-				catch (err) {
-					console.log('saving csrf token in localStorage', err);
+				if (secondFactor) {
+					await verify({ Code: code ? code.value : '', WebAuthn: null });
+					return;
 				}
-				root.remove();
-				if (origFocus && origFocus instanceof HTMLElement && origFocus.parentNode) {
-					origFocus.focus();
+				const loginToken = await client.LoginPrep();
+				const [token, challenge] = await client.Login(loginToken, username.value, password.value);
+				if (challenge) {
+					secondFactor = { loginToken: loginToken, challenge: challenge };
+					const [nfieldset, ncode] = secondFactorFieldset('Account', challenge, verify);
+					fieldset.replaceWith(nfieldset);
+					fieldset = nfieldset;
+					code = ncode;
+					if (code) {
+						code.focus();
+					}
+					return;
 				}
-				resolve(token);
+				finish(token);
 			}
 			catch (err) {
 				console.log('login error', err);
@@ -1179,13 +1451,30 @@ const formatQuotaSize = (v) => {
 	}
 	return '' + v;
 };
+// sendUsageTable shows the numbers of messages and recipients submitted in the
+// past hour/day/month, with limits if configured.
+const sendUsageTable = (limits, usage) => {
+	const cell = (count, limit) => dom.td(style({ textAlign: 'right' }), limit > 0 && count >= limit ? [style({ color: '#c00' }), attr.title('Limit reached.')] : [], '' + count, limit > 0 ? ' / ' + limit : []);
+	const row = (name, c, l) => dom.tr(dom.td(name), cell(c.MessagesHour, l?.MessagesPerHour || 0), cell(c.MessagesDay, l?.MessagesPerDay || 0), cell(c.MessagesMonth, l?.MessagesPerMonth || 0), cell(c.RecipientsHour, l?.RecipientsPerHour || 0), cell(c.RecipientsDay, l?.RecipientsPerDay || 0), cell(c.RecipientsMonth, l?.RecipientsPerMonth || 0));
+	return [
+		dom.table(dom.thead(dom.tr(dom.th(), dom.th(attr.colspan('3'), 'Messages'), dom.th(attr.colspan('3'), 'Recipients')), dom.tr(dom.th('Submitted through'), ['Hour', 'Day', 'Month', 'Hour', 'Day', 'Month'].map(s => dom.th(s)))), dom.tbody(row('All', usage.All, limits?.All), row('SMTP and webmail', usage.Submission, limits?.Submission), row('Webapi', usage.WebAPI, limits?.WebAPI))),
+		dom.p(limits ? ['When a limit is reached, policy "', limits.Policy || 'reject', '" applies.'] : 'No send limits configured.'),
+	];
+};
 const index = async () => {
-	const [[acc, storageUsed, storageLimit, suppressions], tlspubkeys0, recentLoginAttempts] = await Promise.all([
+	const [[acc, storageUsed, storageLimit, suppressions], tlspubkeys0, apikeys0, apppasswords0, secondFactors0, recentLoginAttempts, sendUsage] = await Promise.all([
 		client.Account(),
 		client.TLSPublicKeys(),
+		client.APIKeys(),
+		client.AppPasswords(),
+		client.SecondFactors(),
 		client.LoginAttempts(10),
+		client.SendUsage(),
 	]);
 	const tlspubkeys = tlspubkeys0 || [];
+	const apikeys = apikeys0 || [];
+	const apppasswords = apppasswords0 || [];
+	let secondFactors = secondFactors0;
 	let fullNameForm;
 	let fullNameFieldset;
 	let fullName;
@@ -1208,6 +1497,7 @@ const index = async () => {
 	let junkTopWords;
 	let junkIgnoreWords;
 	let junkRareWords;
+	let junkFeatures;
 	let rejectsFieldset;
 	let rejectsMailbox;
 	let keepRejects;
@@ -1630,12 +1920,167 @@ openssl pkcs12 \\
 		};
 		render();
 		return elem;
+	})(), dom.br(), dom.h2('API keys'), dom.p('For authenticating to the webapi, as password in HTTP basic authentication with an email address of this account as username, instead of the account password. Each key has scopes that determine which webapi methods can be called with it.'), (() => {
+		let elem = dom.div();
+		const scopes = [
+			['send', 'Sending messages.'],
+			['read', 'Listing, searching and retrieving messages and mailboxes, and receiving events.'],
+			['manage', 'Adding, changing, moving and removing messages and mailboxes.'],
+			['suppression', 'Managing the suppression list.'],
+		];
+		const render = () => {
+			const e = dom.div(dom.table(dom.thead(dom.tr(dom.th('Name'), dom.th('Prefix'), dom.th('Scopes'), dom.th('Expires'), dom.th('IP ranges'), dom.th('Created'), dom.th('Last used'), dom.th('Remove'))), dom.tbody(apikeys.length === 0 ? dom.tr(dom.td(attr.colspan('8'), 'None')) : [], apikeys.map(k => dom.tr(dom.td(k.Name), dom.td(k.Prefix + '...'), dom.td((k.Scopes || []).join(', ')), dom.td(k.Expires ? age(k.Expires) : 'Never'), dom.td((k.IPRanges || []).join(', ') || 'Any'), dom.td(age(k.Created)), dom.td(k.LastUsed ? [age(k.LastUsed), ', from ', k.LastUsedIP] : 'Never'), dom.td(dom.clickbutton('Remove', async function click(e) {
+				if (!window.confirm('Are you sure you want to remove this API key? Applications using it will no longer be able to call the webapi.')) {
+					return;
+				}
+				await check(e.target, client.APIKeyRemove(k.ID));
+				apikeys.splice(apikeys.indexOf(k), 1);
+				render();
+			})))))), dom.clickbutton('Add', style({ marginTop: '1ex' }), function click() {
+				let name;
+				let scopeChecks = [];
+				let expires;
+				let ipRanges;
+				let fieldset;
+				const close = popup(dom.div(style({ maxWidth: '45em' }), dom.h1('Add API key'), dom.form(async function submit(e) {
+					e.preventDefault();
+					e.stopPropagation();
+					const l = scopes.map(t => t[0]).filter((_, i) => scopeChecks[i].checked);
+					const ranges = ipRanges.value.split(/[ ,]+/).filter(s => !!s);
+					const [nk, key] = await check(fieldset, client.APIKeyAdd(name.value, l, expires.value ? new Date(expires.value) : null, ranges));
+					apikeys.push(nk);
+					render();
+					close();
+					popup(dom.h1('API key added'), dom.p('The new API key is shown below. It is only shown once, only a hash of the key is stored. Store it securely, for example in the configuration of the application that will use it.'), dom.pre(dom._class('literal'), key));
+				}, fieldset = dom.fieldset(dom.label(style({ display: 'block', marginBottom: '1ex' }), dom.div(dom.b('Name')), name = dom.input(attr.required('')), dom.div(style({ fontStyle: 'italic', marginTop: '.5ex' }), 'Descriptive name to identify the key, e.g. the application it is used in.')), dom.div(style({ marginBottom: '1ex' }), dom.div(dom.b('Scopes')), scopes.map((t, i) => dom.label(style({ display: 'block' }), scopeChecks[i] = dom.input(attr.type('checkbox')), ' ', t[0], ': ', t[1]))), dom.label(style({ display: 'block', marginBottom: '1ex' }), dom.div(dom.b('Expires')), expires = dom.input(attr.type('date')), dom.div(style({ fontStyle: 'italic', marginTop: '.5ex' }), 'Optional. If empty, the key does not expire.')), dom.label(style({ display: 'block', marginBottom: '1ex' }), dom.div(dom.b('IP ranges')), ipRanges = dom.input(attr.placeholder('192.0.2.0/24, 2001:db8::/64')), dom.div(style({ fontStyle: 'italic', marginTop: '.5ex' }), 'Optional. If set, the key can only be used from IPs in these ranges, in CIDR notation, separated by comma or space.')), dom.br(), dom.submitbutton('Add')))));
+			}));
+			if (elem) {
+				elem.replaceWith(e);
+			}
+			elem = e;
+		};
+		render();
+		return elem;
+	})(), dom.br(), dom.h2('Two-factor authentication'), dom.p('A second factor protects logins to the web interfaces against a stolen password. After entering the password, a code from an authenticator app (TOTP) or a security key or passkey (WebAuthn) is required. Recovery codes can each be used once when the second factor is not available. Email clients (IMAP/SMTP) are not affected, consider using app passwords for them.'), acc.RequireSecondFactor && !secondFactors.TOTP && (secondFactors.WebAuthn || []).length === 0 ? dom.p(style({ fontWeight: 'bold' }), 'A second factor is required for this account. Set one up before logging in to webmail.') : [], (() => {
+		let elem = dom.div();
+		const showRecoveryCodes = (codes) => {
+			if (!codes || codes.length === 0) {
+				return;
+			}
+			popup(dom.h1('Recovery codes'), dom.p('Store these recovery codes in a safe place. Each code can be used once instead of a second factor. They are only shown once.'), dom.pre(dom._class('literal'), codes.join('\n')));
+		};
+		const refresh = async () => {
+			secondFactors = await client.SecondFactors();
+			render();
+		};
+		const render = () => {
+			const webauthn = secondFactors.WebAuthn || [];
+			const e = dom.div(dom.h3('Authenticator app'), secondFactors.TOTP ? dom.div('Configured. ', dom.clickbutton('Remove', async function click(e) {
+				if (!window.confirm('Are you sure you want to remove the authenticator app as second factor?')) {
+					return;
+				}
+				await check(e.target, client.TOTPRemove());
+				await refresh();
+			})) : dom.div('Not configured. ', dom.clickbutton('Set up', async function click(e) {
+				const [secret, uri, qrCodePNG] = await check(e.target, client.TOTPSetup());
+				let code;
+				let fieldset;
+				const close = popup(dom.div(style({ maxWidth: '45em' }), dom.h1('Set up authenticator app'), dom.p('Scan the QR code with an authenticator app, or enter the secret manually. Then enter the current code from the app to confirm.'), dom.img(attr.src('data:image/png;base64,' + qrCodePNG), attr.title(uri)), dom.p('Secret: ', dom.span(dom._class('literal'), secret)), dom.form(async function submit(e) {
+					e.preventDefault();
+					e.stopPropagation();
+					const codes = await check(fieldset, client.TOTPConfirm(code.value));
+					close();
+					await refresh();
+					showRecoveryCodes(codes);
+				}, fieldset = dom.fieldset(dom.label(style({ display: 'block', marginBottom: '1ex' }), dom.div(dom.b('Code')), code = dom.input(attr.autocomplete('one-time-code'), attr.required(''))), dom.submitbutton('Confirm')))));
+				code.focus();
+			})), dom.h3('Security keys and passkeys'), dom.table(dom.thead(dom.tr(dom.th('Name'), dom.th('Created'), dom.th('Last used'), dom.th('Remove'))), dom.tbody(webauthn.length === 0 ? dom.tr(dom.td(attr.colspan('4'), 'None')) : [], webauthn.map(wc => dom.tr(dom.td(wc.Name), dom.td(age(wc.Created)), dom.td(wc.LastUsed ? age(wc.LastUsed) : 'Never'), dom.td(dom.clickbutton('Remove', async function click(e) {
+				if (!window.confirm('Are you sure you want to remove this security key or passkey?')) {
+					return;
+				}
+				await check(e.target, client.WebAuthnCredentialRemove(wc.ID));
+				await refresh();
+			})))))), dom.clickbutton('Add', style({ marginTop: '1ex' }), function click() {
+				let name;
+				let fieldset;
+				const close = popup(dom.div(style({ maxWidth: '45em' }), dom.h1('Add security key or passkey'), dom.form(async function submit(e) {
+					e.preventDefault();
+					e.stopPropagation();
+					const register = async () => {
+						const opts = await client.WebAuthnRegisterStart();
+						const [clientDataJSON, attestationObject] = await webauthnCreate(opts);
+						return await client.WebAuthnRegisterFinish(name.value, clientDataJSON, attestationObject);
+					};
+					const [_, codes] = await check(fieldset, register());
+					close();
+					await refresh();
+					showRecoveryCodes(codes);
+				}, fieldset = dom.fieldset(dom.label(style({ display: 'block', marginBottom: '1ex' }), dom.div(dom.b('Name')), name = dom.input(attr.required('')), dom.div(style({ fontStyle: 'italic', marginTop: '.5ex' }), 'Descriptive name to identify the security key or passkey.')), dom.p('Security keys and passkeys are registered for the host name of this web interface. Log in through the same host name to use them.'), dom.submitbutton('Register')))));
+				name.focus();
+			}), secondFactors.TOTP || webauthn.length > 0 ? [
+				dom.h3('Recovery codes'),
+				dom.div('' + secondFactors.RecoveryCodesUnused + ' unused recovery codes. ', dom.clickbutton('Generate new codes', async function click(e) {
+					if (!window.confirm('Are you sure you want to replace the recovery codes? Current recovery codes will no longer work.')) {
+						return;
+					}
+					const codes = await check(e.target, client.RecoveryCodesGenerate());
+					await refresh();
+					showRecoveryCodes(codes);
+				})),
+			] : []);
+			if (elem) {
+				elem.replaceWith(e);
+			}
+			elem = e;
+		};
+		render();
+		return elem;
+	})(), dom.br(), dom.h2('App passwords'), dom.p('App passwords can be used instead of the account password, e.g. in an email client on a phone. Each app password is generated, can only be used for the selected protocols, and can be revoked without changing the account password. App passwords cannot be used to log in to the web interface. App passwords cannot be used with SCRAM authentication mechanisms, configure the application to use a regular (plain text) password, over TLS.'), (() => {
+		let elem = dom.div();
+		const protocols = [
+			['imap', 'IMAP, for reading email.'],
+			['submission', 'SMTP submission, for sending email.'],
+			['webapi', 'The webapi, with HTTP basic authentication.'],
+			['dav', 'CalDAV and CardDAV, for calendars and contacts.'],
+		];
+		const render = () => {
+			const e = dom.div(dom.table(dom.thead(dom.tr(dom.th('Name'), dom.th('Protocols'), dom.th('IP ranges'), dom.th('Created'), dom.th('Last used'), dom.th('Revoke'))), dom.tbody(apppasswords.length === 0 ? dom.tr(dom.td(attr.colspan('6'), 'None')) : [], apppasswords.map(ap => dom.tr(dom.td(ap.Name), dom.td((ap.Protocols || []).join(', ')), dom.td((ap.IPRanges || []).join(', ') || 'Any'), dom.td(age(ap.Created)), dom.td(ap.LastUsed ? [age(ap.LastUsed), ', ', ap.LastUsedProtocol, ' from ', ap.LastUsedIP] : 'Never'), dom.td(dom.clickbutton('Revoke', async function click(e) {
+				if (!window.confirm('Are you sure you want to revoke this app password? Applications using it will no longer be able to log in.')) {
+					return;
+				}
+				await check(e.target, client.AppPasswordRemove(ap.ID));
+				apppasswords.splice(apppasswords.indexOf(ap), 1);
+				render();
+			})))))), dom.clickbutton('Add', style({ marginTop: '1ex' }), function click() {
+				let name;
+				let protocolChecks = [];
+				let ipRanges;
+				let fieldset;
+				const close = popup(dom.div(style({ maxWidth: '45em' }), dom.h1('Add app password'), dom.form(async function submit(e) {
+					e.preventDefault();
+					e.stopPropagation();
+					const l = protocols.map(t => t[0]).filter((_, i) => protocolChecks[i].checked);
+					const ranges = ipRanges.value.split(/[ ,]+/).filter(s => !!s);
+					const [nap, password] = await check(fieldset, client.AppPasswordAdd(name.value, l, ranges));
+					apppasswords.push(nap);
+					render();
+					close();
+					popup(dom.h1('App password added'), dom.p('The new app password is shown below. It is only shown once. Enter it as password in the application, with an email address of this account as username.'), dom.pre(dom._class('literal'), password));
+				}, fieldset = dom.fieldset(dom.label(style({ display: 'block', marginBottom: '1ex' }), dom.div(dom.b('Name')), name = dom.input(attr.required('')), dom.div(style({ fontStyle: 'italic', marginTop: '.5ex' }), 'Descriptive name to identify the app password, e.g. the device or application it is used in.')), dom.div(style({ marginBottom: '1ex' }), dom.div(dom.b('Protocols')), protocols.map((t, i) => dom.label(style({ display: 'block' }), protocolChecks[i] = dom.input(attr.type('checkbox')), ' ', t[0], ': ', t[1]))), dom.label(style({ display: 'block', marginBottom: '1ex' }), dom.div(dom.b('IP ranges')), ipRanges = dom.input(attr.placeholder('192.0.2.0/24, 2001:db8::/64')), dom.div(style({ fontStyle: 'italic', marginTop: '.5ex' }), 'Optional. If set, the app password can only be used from IPs in these ranges, in CIDR notation, separated by comma or space.')), dom.br(), dom.submitbutton('Add')))));
+			}));
+			if (elem) {
+				elem.replaceWith(e);
+			}
+			elem = e;
+		};
+		render();
+		return elem;
 	})(), dom.br(), dom.h2('Disk usage'), dom.p('Storage used is ', dom.b(formatQuotaSize(Math.floor(storageUsed / (1024 * 1024)) * 1024 * 1024)), storageLimit > 0 ? [
 		dom.b('/', formatQuotaSize(storageLimit)),
 		' (',
 		'' + Math.floor(100 * storageUsed / storageLimit),
 		'%).',
-	] : [', no explicit limit is configured.']), dom.h2('Automatic junk flags', attr.title('For the junk filter to work properly, it needs to be trained: Messages need to be marked as junk or nonjunk. Not all email clients help you set those flags. Automatic junk flags set the junk or nonjunk flags when messages are moved/copied to mailboxes matching configured regular expressions.')), dom.form(async function submit(e) {
+	] : [', no explicit limit is configured.']), dom.h2('Outgoing messages', attr.title('Messages submitted in the past hour, day and month (30 days), with the send limits of the account, if any. Send limits of the domain of the message From address may apply as well.')), sendUsageTable(acc.SendLimits, sendUsage), dom.h2('Automatic junk flags', attr.title('For the junk filter to work properly, it needs to be trained: Messages need to be marked as junk or nonjunk. Not all email clients help you set those flags. Automatic junk flags set the junk or nonjunk flags when messages are moved/copied to mailboxes matching configured regular expressions.')), dom.form(async function submit(e) {
 		e.preventDefault();
 		e.stopPropagation();
 		await check(autoJunkFlagsFieldset, client.AutomaticJunkFlagsSave(autoJunkFlagsEnabled.checked, junkMailboxRegexp.value, neutralMailboxRegexp.value, notJunkMailboxRegexp.value));
@@ -1655,11 +2100,12 @@ openssl pkcs12 \\
 				TopWords: parseInt(junkTopWords.value),
 				IgnoreWords: parseFloat(junkIgnoreWords.value),
 				RareWords: parseInt(junkRareWords.value),
+				Features: junkFeatures.checked,
 			};
 			return r;
 		};
 		await check(junkFilterFields, (async () => await client.JunkFilterSave(xjunkFilter()))());
-	}, junkFilterFields = dom.fieldset(dom.div(style({ display: 'flex', gap: '1em' }), dom.label('Enabled', attr.title("If enabled, the junk filter is used to classify incoming email from first-time senders. The result, along with other checks, determines if the message will be accepted or rejected"), dom.div(junkFilterEnabled = dom.input(attr.type('checkbox'), acc.JunkFilter ? attr.checked('') : []))), dom.label('Threshold', attr.title('Approximate spaminess score between 0 and 1 above which emails are rejected as spam. Each delivery attempt adds a little noise to make it slightly harder for spammers to identify words that strongly indicate non-spaminess and use it to bypass the filter. E.g. 0.95.'), dom.div(junkThreshold = dom.input(attr.value('' + (acc.JunkFilter?.Threshold || '0.95'))))), dom.label('Onegrams', attr.title('Track ham/spam ranking for single words.'), dom.div(junkOnegrams = dom.input(attr.type('checkbox'), acc.JunkFilter?.Onegrams ? attr.checked('') : []))), dom.label('Twograms', attr.title('Track ham/spam ranking for each two consecutive words.'), dom.div(junkTwograms = dom.input(attr.type('checkbox'), acc.JunkFilter?.Twograms ? attr.checked('') : []))), dom.label('Threegrams', attr.title('Track ham/spam ranking for each three consecutive words. Can only be changed by admin.'), dom.div(dom.input(attr.type('checkbox'), attr.disabled(''), acc.JunkFilter?.Threegrams ? attr.checked('') : []))), dom.label('Max power', attr.title('Maximum power a word (combination) can have. If spaminess is 0.99, and max power is 0.1, spaminess of the word will be set to 0.9. Similar for ham words.'), dom.div(junkMaxPower = dom.input(attr.value('' + (acc.JunkFilter?.MaxPower || 0.01))))), dom.label('Top words', attr.title('Number of most spammy/hammy words to use for calculating probability. E.g. 10.'), dom.div(junkTopWords = dom.input(attr.value('' + (acc.JunkFilter?.TopWords || 10))))), dom.label('Ignore words', attr.title('Ignore words that are this much away from 0.5 haminess/spaminess. E.g. 0.1, causing word (combinations) of 0.4 to 0.6 to be ignored.'), dom.div(junkIgnoreWords = dom.input(attr.value('' + (acc.JunkFilter?.IgnoreWords || 0.1))))), dom.label('Rare words', attr.title('Occurrences in word database until a word is considered rare and its influence in calculating probability reduced. E.g. 1 or 2.'), dom.div(junkRareWords = dom.input(attr.value('' + (acc.JunkFilter?.RareWords || 2))))), dom.div(dom.span('\u00a0'), dom.div(dom.submitbutton('Save')))))), dom.br(), dom.h2('Rejects'), dom.form(async function submit(e) {
+	}, junkFilterFields = dom.fieldset(dom.div(style({ display: 'flex', gap: '1em' }), dom.label('Enabled', attr.title("If enabled, the junk filter is used to classify incoming email from first-time senders. The result, along with other checks, determines if the message will be accepted or rejected"), dom.div(junkFilterEnabled = dom.input(attr.type('checkbox'), acc.JunkFilter ? attr.checked('') : []))), dom.label('Threshold', attr.title('Approximate spaminess score between 0 and 1 above which emails are rejected as spam. Each delivery attempt adds a little noise to make it slightly harder for spammers to identify words that strongly indicate non-spaminess and use it to bypass the filter. E.g. 0.95.'), dom.div(junkThreshold = dom.input(attr.value('' + (acc.JunkFilter?.Threshold || '0.95'))))), dom.label('Onegrams', attr.title('Track ham/spam ranking for single words.'), dom.div(junkOnegrams = dom.input(attr.type('checkbox'), acc.JunkFilter?.Onegrams ? attr.checked('') : []))), dom.label('Twograms', attr.title('Track ham/spam ranking for each two consecutive words.'), dom.div(junkTwograms = dom.input(attr.type('checkbox'), acc.JunkFilter?.Twograms ? attr.checked('') : []))), dom.label('Threegrams', attr.title('Track ham/spam ranking for each three consecutive words. Can only be changed by admin.'), dom.div(dom.input(attr.type('checkbox'), attr.disabled(''), acc.JunkFilter?.Threegrams ? attr.checked('') : []))), dom.label('Max power', attr.title('Maximum power a word (combination) can have. If spaminess is 0.99, and max power is 0.1, spaminess of the word will be set to 0.9. Similar for ham words.'), dom.div(junkMaxPower = dom.input(attr.value('' + (acc.JunkFilter?.MaxPower || 0.01))))), dom.label('Top words', attr.title('Number of most spammy/hammy words to use for calculating probability. E.g. 10.'), dom.div(junkTopWords = dom.input(attr.value('' + (acc.JunkFilter?.TopWords || 10))))), dom.label('Ignore words', attr.title('Ignore words that are this much away from 0.5 haminess/spaminess. E.g. 0.1, causing word (combinations) of 0.4 to 0.6 to be ignored.'), dom.div(junkIgnoreWords = dom.input(attr.value('' + (acc.JunkFilter?.IgnoreWords || 0.1))))), dom.label('Rare words', attr.title('Occurrences in word database until a word is considered rare and its influence in calculating probability reduced. E.g. 1 or 2.'), dom.div(junkRareWords = dom.input(attr.value('' + (acc.JunkFilter?.RareWords || 2))))), dom.label('Features', attr.title('Also train and classify with tokens describing the structure of messages, such as header properties, domains of links, attachment types, HTML structure and authentication results. Retrain the junk filter after changing.'), dom.div(junkFeatures = dom.input(attr.type('checkbox'), acc.JunkFilter?.Features ? attr.checked('') : []))), dom.div(dom.span('\u00a0'), dom.div(dom.submitbutton('Save')))))), dom.br(), dom.h2('Rejects'), dom.form(async function submit(e) {
 		e.preventDefault();
 		e.stopPropagation();
 		await check(rejectsFieldset, client.RejectsSave(rejectsMailbox.value, keepRejects.checked));
@@ -1671,7 +2117,7 @@ openssl pkcs12 \\
 		e.preventDefault();
 		authorizationPopup(outgoingWebhookAuthorization);
 	}), attr.title('If non-empty, HTTP requests have this value as Authorization header, e.g. Basic <base64-encoded-username-password>.')), outgoingWebhookAuthorization = dom.input(attr.value(acc.OutgoingWebhook?.Authorization || '')))), dom.div(dom.label(style({ verticalAlign: 'top' }), dom.div('Events', attr.title('Either limit to specific events, or receive all events (default).')), outgoingWebhookEvents = dom.select(style({ verticalAlign: 'bottom' }), attr.multiple(''), attr.size('8'), // Number of options.
-	["delivered", "suppressed", "delayed", "failed", "relayed", "expanded", "canceled", "unrecognized"].map(s => dom.option(s.substring(0, 1).toUpperCase() + s.substring(1), attr.value(s), acc.OutgoingWebhook?.Events?.includes(s) ? attr.selected('') : []))))), dom.div(dom.div(dom.label('\u00a0')), dom.submitbutton('Save'), ' ', dom.clickbutton('Test', function click() {
+	["delivered", "suppressed", "delayed", "failed", "relayed", "expanded", "canceled", "unrecognized", "limitreached"].map(s => dom.option(s.substring(0, 1).toUpperCase() + s.substring(1), attr.value(s), acc.OutgoingWebhook?.Events?.includes(s) ? attr.selected('') : []))))), dom.div(dom.div(dom.label('\u00a0')), dom.submitbutton('Save'), ' ', dom.clickbutton('Test', function click() {
 		popupTestOutgoing();
 	}))))), dom.br(), dom.h3('Incoming', attr.title('Webhooks for incoming messages are called for each message received over SMTP, excluding DSN messages about previous deliveries.')), dom.form(async function submit(e) {
 		e.preventDefault();
@@ -1826,7 +2272,7 @@ openssl pkcs12 \\
 };
 const renderLoginAttempts = (loginAttempts) => {
 	// todo: pagination and search
-	return dom.table(dom.thead(dom.tr(dom.th('Time'), dom.th('Result'), dom.th('Count'), dom.th('LoginAddress'), dom.th('Protocol'), dom.th('Mechanism'), dom.th('User Agent'), dom.th('Remote IP'), dom.th('Local IP'), dom.th('TLS'), dom.th('TLS pubkey fingerprint'), dom.th('First seen'))), dom.tbody(loginAttempts.length ? [] : dom.tr(dom.td(attr.colspan('11'), 'No login attempts in past 30 days.')), loginAttempts.map(la => dom.tr(dom.td(age(la.Last)), dom.td(la.Result === 'ok' ? la.Result : box(red, la.Result)), dom.td('' + la.Count), dom.td(la.LoginAddress), dom.td(la.Protocol), dom.td(la.AuthMech), dom.td(la.UserAgent), dom.td(la.RemoteIP), dom.td(la.LocalIP), dom.td(la.TLS), dom.td(la.TLSPubKeyFingerprint), dom.td(age(la.First))))));
+	return dom.table(dom.thead(dom.tr(dom.th('Time'), dom.th('Result'), dom.th('Count'), dom.th('LoginAddress'), dom.th('Protocol'), dom.th('Mechanism'), dom.th('User Agent'), dom.th('Remote IP'), dom.th('Local IP'), dom.th('TLS'), dom.th('TLS pubkey fingerprint'), dom.th('First seen'))), dom.tbody(loginAttempts.length ? [] : dom.tr(dom.td(attr.colspan('11'), 'No login attempts in past 30 days.')), loginAttempts.map(la => dom.tr(dom.td(age(la.Last)), dom.td(la.Result === 'ok' ? la.Result : box(red, la.Result)), dom.td('' + la.Count), dom.td(la.LoginAddress), dom.td(la.Protocol), dom.td(la.AuthMech, la.APIKeyName ? ' (' + la.APIKeyName + ')' : [], la.AppPasswordName ? ' (app password ' + la.AppPasswordName + ')' : [], la.SecondFactor ? ' + ' + la.SecondFactor : []), dom.td(la.UserAgent), dom.td(la.RemoteIP), dom.td(la.LocalIP), dom.td(la.TLS), dom.td(la.TLSPubKeyFingerprint), dom.td(age(la.First))))));
 };
 const loginattempts = async () => {
 	const loginAttempts = await client.LoginAttempts(0);
@@ -9,6 +9,88 @@ let moxversion: string
 let moxgoos: string
 let moxgoarch: string
 
+// Base64 without padding and with url-safe characters, as used for WebAuthn values.
+const base64urlEncode = (buf: ArrayBuffer): string => btoa(String.fromCharCode(...new Uint8Array(buf))).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '')
+const base64urlDecode = (s: string): Uint8Array => Uint8Array.from(atob(s.replace(/-/g, '+').replace(/_/g, '/')), c => c.charCodeAt(0))
+
+// webauthnGet asks the browser for an assertion by a registered security key or
+// passkey, for logging in with a second factor.
+const webauthnGet = async (req: api.WebAuthnRequest): Promise<api.WebAuthnAssertion> => {
+	const cred = await navigator.credentials.get({
+		publicKey: {
+			challenge: base64urlDecode(req.Challenge),
+			rpId: req.RPID,
+			allowCredentials: (req.CredentialIDs || []).map(id => ({type: 'public-key', id: base64urlDecode(id)})),
+			userVerification: 'discouraged',
+		},
+	}) as PublicKeyCredential | null
+	if (!cred) {
+		throw new Error('no credential selected')
+	}
+	const resp = cred.response as AuthenticatorAssertionResponse
+	return {
+		CredentialID: base64urlEncode(cred.rawId),
+		ClientDataJSON: base64urlEncode(resp.clientDataJSON),
+		AuthenticatorData: base64urlEncode(resp.authenticatorData),
+		Signature: base64urlEncode(resp.signature),
+	}
+}
+
+// webauthnCreate asks the browser to create a credential on a security key or
+// as passkey. It returns the raw-url-base64 client data and attestation object.
+const webauthnCreate = async (opts: api.WebAuthnRegisterOptions): Promise<[string, string]> => {
+	const cred = await navigator.credentials.create({
+		publicKey: {
+			challenge: base64urlDecode(opts.Challenge),
+			rp: {id: opts.RPID, name: opts.RPName},
+			user: {id: base64urlDecode(opts.UserID), name: opts.UserName, displayName: opts.UserName},
+			pubKeyCredParams: (opts.Algorithms || []).map(alg => ({type: 'public-key', alg: alg})),
+			excludeCredentials: (opts.ExcludeCredentialIDs || []).map(id => ({type: 'public-key', id: base64urlDecode(id)})),
+			authenticatorSelection: {userVerification: 'discouraged'},
+			attestation: 'none',
+		},
+	}) as PublicKeyCredential | null
+	if (!cred) {
+		throw new Error('no credential created')
+	}
+	const resp = cred.response as AuthenticatorAttestationResponse
+	return [base64urlEncode(resp.clientDataJSON), base64urlEncode(resp.attestationObject)]
+}
+
+// secondFactorFieldset returns a fieldset for completing a login with a second
+// factor. Verify is called with a code or WebAuthn assertion.
+const secondFactorFieldset = (title: string, sf: api.SecondFactorChallenge, verify: (resp: api.SecondFactorResponse) => Promise<void>): [HTMLFieldSetElement, HTMLInputElement | null] => {
+	let fieldset: HTMLFieldSetElement
+	let code: HTMLInputElement | null = null
+	fieldset = dom.fieldset(
+		dom.h1(title),
+		dom.p('A second factor is required to login.'),
+		sf.TOTP || sf.RecoveryCodes ? dom.label(
+			style({display: 'block', marginBottom: '2ex'}),
+			dom.div(sf.TOTP ? (sf.RecoveryCodes ? 'Code from authenticator app, or recovery code' : 'Code from authenticator app') : 'Recovery code', style({marginBottom: '.5ex'})),
+			code=dom.input(attr.autocomplete('one-time-code'), attr.required('')),
+		) : [],
+		dom.div(
+			style({textAlign: 'center'}),
+			code ? dom.submitbutton('Verify') : [],
+			' ',
+			sf.WebAuthn ? dom.clickbutton('Use security key', async function click() {
+				try {
+					fieldset.disabled = true
+					const assertion = await webauthnGet(sf.WebAuthn!)
+					await verify({Code: '', WebAuthn: assertion})
+				} catch (err) {
+					console.log('login error', err)
+					window.alert('Error: ' + errmsg(err))
+				} finally {
+					fieldset.disabled = false
+				}
+			}) : [],
+		),
+	)
+	return [fieldset, code]
+}
+
 const login = async (reason: string) => {
 	return new Promise<string>((resolve: (v: string) => void, _) => {
 		const origFocus = document.activeElement
@@ -17,6 +99,26 @@ const login = async (reason: string) => {
 		let autosize: HTMLElement
 		let username: HTMLInputElement
 		let password: HTMLInputElement
+		let code: HTMLInputElement | null = null
+		let secondFactor: {loginToken: string, challenge: api.SecondFactorChallenge} | null = null
+
+		const finish = (token: string) => {
+			try {
+				window.localStorage.setItem('webaccountaddress', username.value)
+				window.localStorage.setItem('webaccountcsrftoken', token)
+			} catch (err) {
+				console.log('saving csrf token in localStorage', err)
+			}
+			root.remove()
+			if (origFocus && origFocus instanceof HTMLElement && origFocus.parentNode) {
+				origFocus.focus()
+			}
+			resolve(token)
+		}
+		const verify = async (resp: api.SecondFactorResponse) => {
+			const token = await client.LoginSecondFactor(secondFactor!.loginToken, secondFactor!.challenge.Token, resp)
+			finish(token)
+		}
 
 		const root = dom.div(
 			style({position: 'absolute', top: 0, right: 0, bottom: 0, left: 0, backgroundColor: '#eee', display: 'flex', alignItems: 'center', justifyContent: 'center', zIndex: '1', animation: 'fadein .15s ease-in'}),
@@ -34,19 +136,24 @@ const login = async (reason: string) => {
 
 							try {
 								fieldset.disabled = true
-								const loginToken = await client.LoginPrep()
-								const token = await client.Login(loginToken, username.value, password.value)
-								try {
-									window.localStorage.setItem('webaccountaddress', username.value)
-									window.localStorage.setItem('webaccountcsrftoken', token)
-								} catch (err) {
-									console.log('saving csrf token in localStorage', err)
+								if (secondFactor) {
+									await verify({Code: code ? code.value : '', WebAuthn: null})
+									return
 								}
-								root.remove()
-								if (origFocus && origFocus instanceof HTMLElement && origFocus.parentNode) {
-									origFocus.focus()
+								const loginToken = await client.LoginPrep()
+								const [token, challenge] = await client.Login(loginToken, username.value, password.value)
+								if (challenge) {
+									secondFactor = {loginToken: loginToken, challenge: challenge}
+									const [nfieldset, ncode] = secondFactorFieldset('Account', challenge, verify)
+									fieldset.replaceWith(nfieldset)
+									fieldset = nfieldset
+									code = ncode
+									if (code) {
+										code.focus()
+									}
+									return
 								}
-								resolve(token)
+								finish(token)
 							} catch (err) {
 								console.log('login error', err)
 								window.alert('Error: ' + errmsg(err))
@@ -299,13 +406,52 @@ const formatQuotaSize = (v: number) => {
 	return ''+v
 }
 
+// sendUsageTable shows the numbers of messages and recipients submitted in the
+// past hour/day/month, with limits if configured.
+const sendUsageTable = (limits: api.SendLimits | null | undefined, usage: api.SendUsageCounts) => {
+	const cell = (count: number, limit: number) => dom.td(style({textAlign: 'right'}),
+		limit > 0 && count >= limit ? [style({color: '#c00'}), attr.title('Limit reached.')] : [],
+		''+count, limit > 0 ? ' / '+limit : [],
+	)
+	const row = (name: string, c: api.SendCounts, l: api.SendLimitCounts | undefined) => dom.tr(
+		dom.td(name),
+		cell(c.MessagesHour, l?.MessagesPerHour || 0),
+		cell(c.MessagesDay, l?.MessagesPerDay || 0),
+		cell(c.MessagesMonth, l?.MessagesPerMonth || 0),
+		cell(c.RecipientsHour, l?.RecipientsPerHour || 0),
+		cell(c.RecipientsDay, l?.RecipientsPerDay || 0),
+		cell(c.RecipientsMonth, l?.RecipientsPerMonth || 0),
+	)
+	return [
+		dom.table(
+			dom.thead(
+				dom.tr(dom.th(), dom.th(attr.colspan('3'), 'Messages'), dom.th(attr.colspan('3'), 'Recipients')),
+				dom.tr(dom.th('Submitted through'), ['Hour', 'Day', 'Month', 'Hour', 'Day', 'Month'].map(s => dom.th(s))),
+			),
+			dom.tbody(
+				row('All', usage.All, limits?.All),
+				row('SMTP and webmail', usage.Submission, limits?.Submission),
+				row('Webapi', usage.WebAPI, limits?.WebAPI),
+			),
+		),
+		dom.p(limits ? ['When a limit is reached, policy "', limits.Policy || 'reject', '" applies.'] : 'No send limits configured.'),
+	]
+}
+
 const index = async () => {
-	const [[acc, storageUsed, storageLimit, suppressions], tlspubkeys0, recentLoginAttempts] = await Promise.all([
+	const [[acc, storageUsed, storageLimit, suppressions], tlspubkeys0, apikeys0, apppasswords0, secondFactors0, recentLoginAttempts, sendUsage] = await Promise.all([
 		client.Account(),
 		client.TLSPublicKeys(),
+		client.APIKeys(),
+		client.AppPasswords(),
+		client.SecondFactors(),
 		client.LoginAttempts(10),
+		client.SendUsage(),
 	])
 	const tlspubkeys = tlspubkeys0 || []
+	const apikeys = apikeys0 || []
+	const apppasswords = apppasswords0 || []
+	let secondFactors = secondFactors0
 
 	let fullNameForm: HTMLFormElement
 	let fullNameFieldset: HTMLFieldSetElement
@@ -331,6 +477,7 @@ const index = async () => {
 	let junkTopWords: HTMLInputElement
 	let junkIgnoreWords: HTMLInputElement
 	let junkRareWords: HTMLInputElement
+	let junkFeatures: HTMLInputElement
 
 	let rejectsFieldset: HTMLFieldSetElement
 	let rejectsMailbox: HTMLInputElement
@@ -1089,6 +1236,415 @@ openssl pkcs12 \\
 		})(),
 		dom.br(),
 
+		dom.h2('API keys'),
+		dom.p('For authenticating to the webapi, as password in HTTP basic authentication with an email address of this account as username, instead of the account password. Each key has scopes that determine which webapi methods can be called with it.'),
+		(() => {
+			let elem = dom.div()
+
+			const scopes: [string, string][] = [
+				['send', 'Sending messages.'],
+				['read', 'Listing, searching and retrieving messages and mailboxes, and receiving events.'],
+				['manage', 'Adding, changing, moving and removing messages and mailboxes.'],
+				['suppression', 'Managing the suppression list.'],
+			]
+
+			const render = () => {
+				const e = dom.div(
+					dom.table(
+						dom.thead(
+							dom.tr(
+								dom.th('Name'),
+								dom.th('Prefix'),
+								dom.th('Scopes'),
+								dom.th('Expires'),
+								dom.th('IP ranges'),
+								dom.th('Created'),
+								dom.th('Last used'),
+								dom.th('Remove'),
+							),
+						),
+						dom.tbody(
+							apikeys.length === 0 ? dom.tr(dom.td(attr.colspan('8'), 'None')) : [],
+							apikeys.map(k =>
+								dom.tr(
+									dom.td(k.Name),
+									dom.td(k.Prefix+'...'),
+									dom.td((k.Scopes || []).join(', ')),
+									dom.td(k.Expires ? age(k.Expires) : 'Never'),
+									dom.td((k.IPRanges || []).join(', ') || 'Any'),
+									dom.td(age(k.Created)),
+									dom.td(k.LastUsed ? [age(k.LastUsed), ', from ', k.LastUsedIP] : 'Never'),
+									dom.td(
+										dom.clickbutton('Remove', async function click(e: MouseEvent) {
+											if (!window.confirm('Are you sure you want to remove this API key? Applications using it will no longer be able to call the webapi.')) {
+												return
+											}
+											await check(e.target! as HTMLButtonElement, client.APIKeyRemove(k.ID))
+											apikeys.splice(apikeys.indexOf(k), 1)
+											render()
+										}),
+									),
+								)
+							),
+						),
+					),
+					dom.clickbutton('Add', style({marginTop: '1ex'}), function click() {
+						let name: HTMLInputElement
+						let scopeChecks: HTMLInputElement[] = []
+						let expires: HTMLInputElement
+						let ipRanges: HTMLInputElement
+						let fieldset: HTMLFieldSetElement
+
+						const close = popup(
+							dom.div(
+								style({maxWidth: '45em'}),
+								dom.h1('Add API key'),
+								dom.form(
+									async function submit(e: SubmitEvent) {
+										e.preventDefault()
+										e.stopPropagation()
+										const l = scopes.map(t => t[0]).filter((_, i) => scopeChecks[i].checked)
+										const ranges = ipRanges.value.split(/[ ,]+/).filter(s => !!s)
+										const [nk, key] = await check(fieldset, client.APIKeyAdd(name.value, l, expires.value ? new Date(expires.value) : null, ranges))
+										apikeys.push(nk)
+										render()
+										close()
+										popup(
+											dom.h1('API key added'),
+											dom.p('The new API key is shown below. It is only shown once, only a hash of the key is stored. Store it securely, for example in the configuration of the application that will use it.'),
+											dom.pre(dom._class('literal'), key),
+										)
+									},
+									fieldset=dom.fieldset(
+										dom.label(
+											style({display: 'block', marginBottom: '1ex'}),
+											dom.div(dom.b('Name')),
+											name=dom.input(attr.required('')),
+											dom.div(style({fontStyle: 'italic', marginTop: '.5ex'}), 'Descriptive name to identify the key, e.g. the application it is used in.'),
+										),
+										dom.div(
+											style({marginBottom: '1ex'}),
+											dom.div(dom.b('Scopes')),
+											scopes.map((t, i) =>
+												dom.label(
+													style({display: 'block'}),
+													scopeChecks[i]=dom.input(attr.type('checkbox')),
+													' ', t[0], ': ', t[1],
+												)
+											),
+										),
+										dom.label(
+											style({display: 'block', marginBottom: '1ex'}),
+											dom.div(dom.b('Expires')),
+											expires=dom.input(attr.type('date')),
+											dom.div(style({fontStyle: 'italic', marginTop: '.5ex'}), 'Optional. If empty, the key does not expire.'),
+										),
+										dom.label(
+											style({display: 'block', marginBottom: '1ex'}),
+											dom.div(dom.b('IP ranges')),
+											ipRanges=dom.input(attr.placeholder('192.0.2.0/24, 2001:db8::/64')),
+											dom.div(style({fontStyle: 'italic', marginTop: '.5ex'}), 'Optional. If set, the key can only be used from IPs in these ranges, in CIDR notation, separated by comma or space.'),
+										),
+										dom.br(),
+										dom.submitbutton('Add'),
+									),
+								),
+							),
+						)
+					})
+				)
+
+				if (elem) {
+					elem.replaceWith(e)
+				}
+				elem = e
+			}
+			render()
+			return elem
+		})(),
+		dom.br(),
+
+		dom.h2('Two-factor authentication'),
+		dom.p('A second factor protects logins to the web interfaces against a stolen password. After entering the password, a code from an authenticator app (TOTP) or a security key or passkey (WebAuthn) is required. Recovery codes can each be used once when the second factor is not available. Email clients (IMAP/SMTP) are not affected, consider using app passwords for them.'),
+		acc.RequireSecondFactor && !secondFactors.TOTP && (secondFactors.WebAuthn || []).length === 0 ? dom.p(style({fontWeight: 'bold'}), 'A second factor is required for this account. Set one up before logging in to webmail.') : [],
+		(() => {
+			let elem = dom.div()
+
+			const showRecoveryCodes = (codes: string[] | null) => {
+				if (!codes || codes.length === 0) {
+					return
+				}
+				popup(
+					dom.h1('Recovery codes'),
+					dom.p('Store these recovery codes in a safe place. Each code can be used once instead of a second factor. They are only shown once.'),
+					dom.pre(dom._class('literal'), codes.join('\n')),
+				)
+			}
+
+			const refresh = async () => {
+				secondFactors = await client.SecondFactors()
+				render()
+			}
+
+			const render = () => {
+				const webauthn = secondFactors.WebAuthn || []
+				const e = dom.div(
+					dom.h3('Authenticator app'),
+					secondFactors.TOTP ? dom.div(
+						'Configured. ',
+						dom.clickbutton('Remove', async function click(e: MouseEvent) {
+							if (!window.confirm('Are you sure you want to remove the authenticator app as second factor?')) {
+								return
+							}
+							await check(e.target! as HTMLButtonElement, client.TOTPRemove())
+							await refresh()
+						}),
+					) : dom.div(
+						'Not configured. ',
+						dom.clickbutton('Set up', async function click(e: MouseEvent) {
+							const [secret, uri, qrCodePNG] = await check(e.target! as HTMLButtonElement, client.TOTPSetup())
+							let code: HTMLInputElement
+							let fieldset: HTMLFieldSetElement
+							const close = popup(
+								dom.div(
+									style({maxWidth: '45em'}),
+									dom.h1('Set up authenticator app'),
+									dom.p('Scan the QR code with an authenticator app, or enter the secret manually. Then enter the current code from the app to confirm.'),
+									dom.img(attr.src('data:image/png;base64,'+qrCodePNG), attr.title(uri)),
+									dom.p('Secret: ', dom.span(dom._class('literal'), secret)),
+									dom.form(
+										async function submit(e: SubmitEvent) {
+											e.preventDefault()
+											e.stopPropagation()
+											const codes = await check(fieldset, client.TOTPConfirm(code.value))
+											close()
+											await refresh()
+											showRecoveryCodes(codes)
+										},
+										fieldset=dom.fieldset(
+											dom.label(
+												style({display: 'block', marginBottom: '1ex'}),
+												dom.div(dom.b('Code')),
+												code=dom.input(attr.autocomplete('one-time-code'), attr.required('')),
+											),
+											dom.submitbutton('Confirm'),
+										),
+									),
+								),
+							)
+							code.focus()
+						}),
+					),
+					dom.h3('Security keys and passkeys'),
+					dom.table(
+						dom.thead(
+							dom.tr(
+								dom.th('Name'),
+								dom.th('Created'),
+								dom.th('Last used'),
+								dom.th('Remove'),
+							),
+						),
+						dom.tbody(
+							webauthn.length === 0 ? dom.tr(dom.td(attr.colspan('4'), 'None')) : [],
+							webauthn.map(wc =>
+								dom.tr(
+									dom.td(wc.Name),
+									dom.td(age(wc.Created)),
+									dom.td(wc.LastUsed ? age(wc.LastUsed) : 'Never'),
+									dom.td(
+										dom.clickbutton('Remove', async function click(e: MouseEvent) {
+											if (!window.confirm('Are you sure you want to remove this security key or passkey?')) {
+												return
+											}
+											await check(e.target! as HTMLButtonElement, client.WebAuthnCredentialRemove(wc.ID))
+											await refresh()
+										}),
+									),
+								)
+							),
+						),
+					),
+					dom.clickbutton('Add', style({marginTop: '1ex'}), function click() {
+						let name: HTMLInputElement
+						let fieldset: HTMLFieldSetElement
+
+						const close = popup(
+							dom.div(
+								style({maxWidth: '45em'}),
+								dom.h1('Add security key or passkey'),
+								dom.form(
+									async function submit(e: SubmitEvent) {
+										e.preventDefault()
+										e.stopPropagation()
+										const register = async () => {
+											const opts = await client.WebAuthnRegisterStart()
+											const [clientDataJSON, attestationObject] = await webauthnCreate(opts)
+											return await client.WebAuthnRegisterFinish(name.value, clientDataJSON, attestationObject)
+										}
+										const [_, codes] = await check(fieldset, register())
+										close()
+										await refresh()
+										showRecoveryCodes(codes)
+									},
+									fieldset=dom.fieldset(
+										dom.label(
+											style({display: 'block', marginBottom: '1ex'}),
+											dom.div(dom.b('Name')),
+											name=dom.input(attr.required('')),
+											dom.div(style({fontStyle: 'italic', marginTop: '.5ex'}), 'Descriptive name to identify the security key or passkey.'),
+										),
+										dom.p('Security keys and passkeys are registered for the host name of this web interface. Log in through the same host name to use them.'),
+										dom.submitbutton('Register'),
+									),
+								),
+							),
+						)
+						name.focus()
+					}),
+					secondFactors.TOTP || webauthn.length > 0 ? [
+						dom.h3('Recovery codes'),
+						dom.div(
+							''+secondFactors.RecoveryCodesUnused+' unused recovery codes. ',
+							dom.clickbutton('Generate new codes', async function click(e: MouseEvent) {
+								if (!window.confirm('Are you sure you want to replace the recovery codes? Current recovery codes will no longer work.')) {
+									return
+								}
+								const codes = await check(e.target! as HTMLButtonElement, client.RecoveryCodesGenerate())
+								await refresh()
+								showRecoveryCodes(codes)
+							}),
+						),
+					] : [],
+				)
+
+				if (elem) {
+					elem.replaceWith(e)
+				}
+				elem = e
+			}
+			render()
+			return elem
+		})(),
+		dom.br(),
+
+		dom.h2('App passwords'),
+		dom.p('App passwords can be used instead of the account password, e.g. in an email client on a phone. Each app password is generated, can only be used for the selected protocols, and can be revoked without changing the account password. App passwords cannot be used to log in to the web interface. App passwords cannot be used with SCRAM authentication mechanisms, configure the application to use a regular (plain text) password, over TLS.'),
+		(() => {
+			let elem = dom.div()
+
+			const protocols: [string, string][] = [
+				['imap', 'IMAP, for reading email.'],
+				['submission', 'SMTP submission, for sending email.'],
+				['webapi', 'The webapi, with HTTP basic authentication.'],
+				['dav', 'CalDAV and CardDAV, for calendars and contacts.'],
+			]
+
+			const render = () => {
+				const e = dom.div(
+					dom.table(
+						dom.thead(
+							dom.tr(
+								dom.th('Name'),
+								dom.th('Protocols'),
+								dom.th('IP ranges'),
+								dom.th('Created'),
+								dom.th('Last used'),
+								dom.th('Revoke'),
+							),
+						),
+						dom.tbody(
+							apppasswords.length === 0 ? dom.tr(dom.td(attr.colspan('6'), 'None')) : [],
+							apppasswords.map(ap =>
+								dom.tr(
+									dom.td(ap.Name),
+									dom.td((ap.Protocols || []).join(', ')),
+									dom.td((ap.IPRanges || []).join(', ') || 'Any'),
+									dom.td(age(ap.Created)),
+									dom.td(ap.LastUsed ? [age(ap.LastUsed), ', ', ap.LastUsedProtocol, ' from ', ap.LastUsedIP] : 'Never'),
+									dom.td(
+										dom.clickbutton('Revoke', async function click(e: MouseEvent) {
+											if (!window.confirm('Are you sure you want to revoke this app password? Applications using it will no longer be able to log in.')) {
+												return
+											}
+											await check(e.target! as HTMLButtonElement, client.AppPasswordRemove(ap.ID))
+											apppasswords.splice(apppasswords.indexOf(ap), 1)
+											render()
+										}),
+									),
+								)
+							),
+						),
+					),
+					dom.clickbutton('Add', style({marginTop: '1ex'}), function click() {
+						let name: HTMLInputElement
+						let protocolChecks: HTMLInputElement[] = []
+						let ipRanges: HTMLInputElement
+						let fieldset: HTMLFieldSetElement
+
+						const close = popup(
+							dom.div(
+								style({maxWidth: '45em'}),
+								dom.h1('Add app password'),
+								dom.form(
+									async function submit(e: SubmitEvent) {
+										e.preventDefault()
+										e.stopPropagation()
+										const l = protocols.map(t => t[0]).filter((_, i) => protocolChecks[i].checked)
+										const ranges = ipRanges.value.split(/[ ,]+/).filter(s => !!s)
+										const [nap, password] = await check(fieldset, client.AppPasswordAdd(name.value, l, ranges))
+										apppasswords.push(nap)
+										render()
+										close()
+										popup(
+											dom.h1('App password added'),
+											dom.p('The new app password is shown below. It is only shown once. Enter it as password in the application, with an email address of this account as username.'),
+											dom.pre(dom._class('literal'), password),
+										)
+									},
+									fieldset=dom.fieldset(
+										dom.label(
+											style({display: 'block', marginBottom: '1ex'}),
+											dom.div(dom.b('Name')),
+											name=dom.input(attr.required('')),
+											dom.div(style({fontStyle: 'italic', marginTop: '.5ex'}), 'Descriptive name to identify the app password, e.g. the device or application it is used in.'),
+										),
+										dom.div(
+											style({marginBottom: '1ex'}),
+											dom.div(dom.b('Protocols')),
+											protocols.map((t, i) =>
+												dom.label(
+													style({display: 'block'}),
+													protocolChecks[i]=dom.input(attr.type('checkbox')),
+													' ', t[0], ': ', t[1],
+												)
+											),
+										),
+										dom.label(
+											style({display: 'block', marginBottom: '1ex'}),
+											dom.div(dom.b('IP ranges')),
+											ipRanges=dom.input(attr.placeholder('192.0.2.0/24, 2001:db8::/64')),
+											dom.div(style({fontStyle: 'italic', marginTop: '.5ex'}), 'Optional. If set, the app password can only be used from IPs in these ranges, in CIDR notation, separated by comma or space.'),
+										),
+										dom.br(),
+										dom.submitbutton('Add'),
+									),
+								),
+							),
+						)
+					})
+				)
+
+				if (elem) {
+					elem.replaceWith(e)
+				}
+				elem = e
+			}
+			render()
+			return elem
+		})(),
+		dom.br(),
+
 		dom.h2('Disk usage'),
 		dom.p('Storage used is ', dom.b(formatQuotaSize(Math.floor(storageUsed/(1024*1024))*1024*1024)),
 			storageLimit > 0 ? [
@@ -1098,6 +1654,9 @@ openssl pkcs12 \\
 				'%).',
 			] : [', no explicit limit is configured.']),
 
+		dom.h2('Outgoing messages', attr.title('Messages submitted in the past hour, day and month (30 days), with the send limits of the account, if any. Send limits of the domain of the message From address may apply as well.')),
+		sendUsageTable(acc.SendLimits, sendUsage),
+
 		dom.h2('Automatic junk flags', attr.title('For the junk filter to work properly, it needs to be trained: Messages need to be marked as junk or nonjunk. Not all email clients help you set those flags. Automatic junk flags set the junk or nonjunk flags when messages are moved/copied to mailboxes matching configured regular expressions.')),
 		dom.form(
 			async function submit(e: SubmitEvent) {
@@ -1150,6 +1709,7 @@ openssl pkcs12 \\
 						TopWords: parseInt(junkTopWords.value),
 						IgnoreWords: parseFloat(junkIgnoreWords.value),
 						RareWords: parseInt(junkRareWords.value),
+						Features: junkFeatures.checked,
 					}
 					return r
 				}
@@ -1202,6 +1762,11 @@ openssl pkcs12 \\
 						attr.title('Occurrences in word database until a word is considered rare and its influence in calculating probability reduced. E.g. 1 or 2.'),
 						dom.div(junkRareWords=dom.input(attr.value('' + (acc.JunkFilter?.RareWords || 2)))),
 					),
+					dom.label(
+						'Features',
+						attr.title('Also train and classify with tokens describing the structure of messages, such as header properties, domains of links, attachment types, HTML structure and authentication results. Retrain the junk filter after changing.'),
+						dom.div(junkFeatures=dom.input(attr.type('checkbox'), acc.JunkFilter?.Features ? attr.checked('') : [])),
+					),
 					dom.div(dom.span('\u00a0'), dom.div(dom.submitbutton('Save'))),
 				),
 			),
@@ -1276,7 +1841,7 @@ openssl pkcs12 \\
 								style({verticalAlign: 'bottom'}),
 								attr.multiple(''),
 								attr.size('8'), // Number of options.
-								["delivered", "suppressed", "delayed", "failed", "relayed", "expanded", "canceled", "unrecognized"].map(s => dom.option(s.substring(0, 1).toUpperCase()+s.substring(1), attr.value(s), acc.OutgoingWebhook?.Events?.includes(s) ? attr.selected('') : [])),
+								["delivered", "suppressed", "delayed", "failed", "relayed", "expanded", "canceled", "unrecognized", "limitreached"].map(s => dom.option(s.substring(0, 1).toUpperCase()+s.substring(1), attr.value(s), acc.OutgoingWebhook?.Events?.includes(s) ? attr.selected('') : [])),
 							),
 						),
 					),
@@ -1702,7 +2267,7 @@ const renderLoginAttempts = (loginAttempts: api.LoginAttempt[]) => {
 					dom.td(''+la.Count),
 					dom.td(la.LoginAddress),
 					dom.td(la.Protocol),
-					dom.td(la.AuthMech),
+					dom.td(la.AuthMech, la.APIKeyName ? ' ('+la.APIKeyName+')' : [], la.AppPasswordName ? ' (app password '+la.AppPasswordName+')' : [], la.SecondFactor ? ' + '+la.SecondFactor : []),
 					dom.td(la.UserAgent),
 					dom.td(la.RemoteIP),
 					dom.td(la.LocalIP),
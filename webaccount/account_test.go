@@ -38,6 +38,7 @@ import (
 	"github.com/mjl-/mox/mox-"
 	"github.com/mjl-/mox/queue"
 	"github.com/mjl-/mox/store"
+	"github.com/mjl-/mox/totp"
 	"github.com/mjl-/mox/webauth"
 	"github.com/mjl-/mox/webhook"
 )
@@ -133,7 +134,7 @@ func TestAccount(t *testing.T) {
 	loginCookie.Value = api.LoginPrep(ctx)
 	reqInfo.Request.Header = http.Header{"Cookie": []string{loginCookie.String()}}
 
-	csrfToken := api.Login(ctx, loginCookie.Value, "mjl☺@mox.example", "test1234")
+	csrfToken, _ := api.Login(ctx, loginCookie.Value, "mjl☺@mox.example", "test1234")
 	var sessionCookie *http.Cookie
 	for _, c := range respRec.Result().Cookies() {
 		if c.Name == "webaccountsession" {
@@ -277,6 +278,9 @@ func TestAccount(t *testing.T) {
 	api.AccountSaveFullName(ctx, account.FullName+" changed") // todo: check if value was changed
 	api.AccountSaveFullName(ctx, account.FullName)
 
+	su := api.SendUsage(ctx)
+	tcompare(t, su, queue.SendUsageCounts{})
+
 	go ImportManage()
 	defer func() {
 		importers.Stop <- struct{}{}
@@ -559,6 +563,86 @@ func TestAccount(t *testing.T) {
 	account, _, _, _ = api.Account(ctx)
 	tcompare(t, account.IMAPCapabilitiesDisabled, []string{})
 
+	// Second factor with TOTP.
+	tcompare(t, api.SecondFactors(ctx).Enabled(), false)
+	tneedErrorCode(t, "user:error", func() { api.RecoveryCodesGenerate(ctx) })
+	secret, _, _ := api.TOTPSetup(ctx)
+	tneedErrorCode(t, "user:error", func() { api.TOTPConfirm(ctx, "000000") })
+	now := time.Now()
+	totpCode, err := totp.Code(secret, now)
+	tcheck(t, err, "totp code")
+	recoveryCodes := api.TOTPConfirm(ctx, totpCode)
+	tcompare(t, len(recoveryCodes) > 0, true)
+	tcompare(t, api.SecondFactors(ctx).TOTP, true)
+
+	// Login now requires a second factor.
+	sfRespRec := httptest.NewRecorder()
+	sfReqInfo := requestInfo{"", "", "", sfRespRec, &http.Request{RemoteAddr: "127.0.0.2:1234"}}
+	sfctx := context.WithValue(ctxbg, requestInfoCtxKey, sfReqInfo)
+	loginCookie.Value = api.LoginPrep(sfctx)
+	sfReqInfo.Request.Header = http.Header{"Cookie": []string{loginCookie.String()}}
+	csrfToken, challenge := api.Login(sfctx, loginCookie.Value, "mjl☺@mox.example", "test1234")
+	tcompare(t, csrfToken, store.CSRFToken(""))
+	if challenge == nil || !challenge.TOTP || !challenge.RecoveryCodes || challenge.WebAuthn != nil {
+		t.Fatalf("bad second factor challenge %#v", challenge)
+	}
+	for _, c := range sfRespRec.Result().Cookies() {
+		if c.Name == "webaccountsession" {
+			t.Fatalf("session cookie set before second factor")
+		}
+	}
+	tneedErrorCode(t, "user:loginFailed", func() {
+		api.LoginSecondFactor(sfctx, loginCookie.Value, challenge.Token, webauth.SecondFactorResponse{Code: totpCode})
+	})
+	tneedErrorCode(t, "user:loginFailed", func() {
+		api.LoginSecondFactor(sfctx, loginCookie.Value, "bogus", webauth.SecondFactorResponse{Code: totpCode})
+	})
+	tneedErrorCode(t, "user:error", func() {
+		api.LoginSecondFactor(sfctx, loginCookie.Value, challenge.Token, webauth.SecondFactorResponse{})
+	})
+	// Pending login cannot be completed with another login token.
+	otherLoginCookie := &http.Cookie{Name: "webaccountlogin", Value: api.LoginPrep(sfctx)}
+	otherReqInfo := requestInfo{"", "", "", httptest.NewRecorder(), &http.Request{RemoteAddr: "127.0.0.2:1234", Header: http.Header{"Cookie": []string{otherLoginCookie.String()}}}}
+	otherctx := context.WithValue(ctxbg, requestInfoCtxKey, otherReqInfo)
+	nextTOTPCode, err := totp.Code(secret, now.Add(30*time.Second))
+	tcheck(t, err, "totp code")
+	tneedErrorCode(t, "user:loginFailed", func() {
+		api.LoginSecondFactor(otherctx, otherLoginCookie.Value, challenge.Token, webauth.SecondFactorResponse{Code: nextTOTPCode})
+	})
+	totpCode, err = totp.Code(secret, now.Add(30*time.Second))
+	tcheck(t, err, "totp code")
+	sfRespRec = httptest.NewRecorder()
+	sfReqInfo.Response = sfRespRec
+	sfctx = context.WithValue(ctxbg, requestInfoCtxKey, sfReqInfo)
+	csrfToken = api.LoginSecondFactor(sfctx, loginCookie.Value, challenge.Token, webauth.SecondFactorResponse{Code: totpCode})
+	if csrfToken == "" {
+		t.Fatalf("missing csrf token after second factor")
+	}
+	sessionCookie = nil
+	for _, c := range sfRespRec.Result().Cookies() {
+		if c.Name == "webaccountsession" {
+			sessionCookie = c
+		}
+	}
+	if sessionCookie == nil {
+		t.Fatalf("missing session cookie after second factor")
+	}
+	// Pending login can only be completed once.
+	tneedErrorCode(t, "user:loginFailed", func() {
+		api.LoginSecondFactor(sfctx, loginCookie.Value, challenge.Token, webauth.SecondFactorResponse{Code: recoveryCodes[0]})
+	})
+
+	// Recovery code as second factor.
+	loginCookie.Value = api.LoginPrep(sfctx)
+	sfReqInfo.Request.Header = http.Header{"Cookie": []string{loginCookie.String()}}
+	_, challenge = api.Login(sfctx, loginCookie.Value, "mjl☺@mox.example", "test1234")
+	api.LoginSecondFactor(sfctx, loginCookie.Value, challenge.Token, webauth.SecondFactorResponse{Code: recoveryCodes[0]})
+
+	api.TOTPRemove(ctx)
+	tneedErrorCode(t, "user:error", func() { api.TOTPRemove(ctx) })
+	tcompare(t, api.SecondFactors(ctx).Enabled(), false)
+	tcompare(t, api.SecondFactors(ctx).RecoveryCodesUnused, 0)
+
 	api.Logout(ctx)
 	tneedErrorCode(t, "server:error", func() { api.Logout(ctx) })
 }
@@ -2,6 +2,40 @@
 
 namespace api {
 
+// SecondFactorChallenge is returned by Login when the password is valid but a
+// second factor is required. The Token must be passed to LoginSecondFactor,
+// along with a code or WebAuthn assertion.
+export interface SecondFactorChallenge {
+	Token: string
+	TOTP: boolean  // Whether a TOTP code can be used.
+	RecoveryCodes: boolean  // Whether a recovery code can be used.
+	WebAuthn?: WebAuthnRequest | null  // If non-nil, a registered security key or passkey can be used.
+}
+
+// WebAuthnRequest holds the parameters for navigator.credentials.get in the
+// browser.
+export interface WebAuthnRequest {
+	Challenge: string  // Raw-url-base64.
+	RPID: string  // Relying party ID, the host name.
+	CredentialIDs?: string[] | null  // Raw-url-base64 IDs of allowed credentials.
+}
+
+// SecondFactorResponse is the second factor for LoginSecondFactor. Either Code or
+// WebAuthn must be set.
+export interface SecondFactorResponse {
+	Code: string  // TOTP code of 6 digits, or a recovery code.
+	WebAuthn?: WebAuthnAssertion | null
+}
+
+// WebAuthnAssertion is the result of navigator.credentials.get in the browser.
+// All fields are raw-url-base64 encoded.
+export interface WebAuthnAssertion {
+	CredentialID: string
+	ClientDataJSON: string
+	AuthenticatorData: string
+	Signature: string
+}
+
 export interface Account {
 	OutgoingWebhook?: OutgoingWebhook | null
 	IncomingWebhook?: IncomingWebhook | null
@@ -9,6 +43,7 @@ export interface Account {
 	KeepRetiredMessagePeriod: number
 	KeepRetiredWebhookPeriod: number
 	LoginDisabled: string
+	RequireSecondFactor: boolean
 	Domain: string
 	Description: string
 	FullName: string
@@ -21,9 +56,11 @@ export interface Account {
 	JunkFilter?: JunkFilter | null  // todo: sane defaults for junkfilter
 	MaxOutgoingMessagesPerDay: number
 	MaxFirstTimeRecipientsPerDay: number
+	SendLimits?: SendLimits | null
 	NoFirstTimeSenderDelay: boolean
 	NoCustomPassword: boolean
 	IMAPCapabilitiesDisabled?: string[] | null
+	AttachmentRules?: AttachmentRule[] | null
 	Routes?: Route[] | null
 	DNSDomain: Domain  // Parsed form of Domain.
 	Aliases?: AddressAlias[] | null
@@ -32,12 +69,14 @@ export interface Account {
 export interface OutgoingWebhook {
 	URL: string
 	Authorization: string
+	EventStreamOnly: boolean
 	Events?: string[] | null
 }
 
 export interface IncomingWebhook {
 	URL: string
 	Authorization: string
+	EventStreamOnly: boolean
 }
 
 export interface Destination {
@@ -91,6 +130,38 @@ export interface JunkFilter {
 	TopWords: number
 	IgnoreWords: number
 	RareWords: number
+	Features: boolean
+}
+
+// SendLimits are limits on outgoing messages for an account or domain.
+export interface SendLimits {
+	All: SendLimitCounts
+	Submission: SendLimitCounts
+	WebAPI: SendLimitCounts
+	Policy: string
+}
+
+// SendLimitCounts are maximum numbers of messages and recipients in outgoing
+// messages in the past hour, day and month (30 days). Zero means no limit.
+export interface SendLimitCounts {
+	MessagesPerHour: number
+	MessagesPerDay: number
+	MessagesPerMonth: number
+	RecipientsPerHour: number
+	RecipientsPerDay: number
+	RecipientsPerMonth: number
+}
+
+// AttachmentRule is a policy for attachments in incoming and/or outgoing messages,
+// evaluated on each part of a message, including parts of embedded messages.
+export interface AttachmentRule {
+	Direction: string
+	ContentTypes?: string[] | null
+	Extensions?: string[] | null
+	EncryptedArchive: boolean
+	UninspectableArchive: boolean
+	MinSize: number
+	Action: string
 }
 
 export interface Route {
@@ -162,6 +233,19 @@ export interface Outgoing {
 	SMTPEnhancedCode: string  // Optional, for errors only, e.g. 5.1.1.
 	Error: string  // Error message while delivering, or from DSN from remote, if any.
 	Extra?: { [key: string]: string }  // Extra fields set for message during submit, through webapi call or through X-Mox-Extra-* headers during SMTP submission.
+	SendLimit?: SendLimit | null  // For event "limitreached" only.
+}
+
+// SendLimit is a limit on outgoing messages that was reached.
+export interface SendLimit {
+	Scope: string  // "account" or "domain".
+	Name: string  // Name of account, or domain (in unicode).
+	Source: string  // Limits that applied: "all", "submission" (SMTP and webmail) or "webapi".
+	Kind: string  // "messages" or "recipients".
+	Period: string  // "hour", "day" or "month" (30 days).
+	Limit: number  // Configured maximum.
+	Count: number  // Current count for the period, including the message that reached the limit.
+	Policy: string  // "reject", "hold" or "notify".
 }
 
 // Incoming is the data sent to a webhook for incoming deliveries over SMTP.
@@ -224,6 +308,78 @@ export interface TLSPublicKey {
 	LoginAddress: string  // Must belong to account.
 }
 
+// APIKey is a key for authenticating to the webapi as an alternative to the
+// account password. Only a hash of the key is stored, the key itself is only
+// returned when it is added.
+export interface APIKey {
+	ID: number
+	Created: Date
+	Name: string  // Descriptive name to identify the key, e.g. the application it is used in.
+	Prefix: string  // First characters of the key, for identifying the key.
+	Scopes?: string[] | null  // Scopes this key can be used for, see APIScopes.
+	Expires?: Date | null  // If set, the key cannot be used after this time.
+	IPRanges?: string[] | null  // If non-empty, the key can only be used from IPs within these ranges, in CIDR notation, e.g. "192.0.2.0/24" or "2001:db8::1/128".
+	LastUsed?: Date | null  // Time of last use, nil if never used.
+	LastUsedIP: string  // IP of last use, empty if never used.
+}
+
+// AppPassword is an application-specific password, an alternative to the main
+// account password for a single application, e.g. an email client on a phone.
+// App passwords are generated, restricted to protocols and optionally IP
+// ranges, and can be revoked individually. They cannot be used for logging in to
+// the web interfaces.
+// 
+// App passwords start with a non-secret prefix, followed by a dash and the secret
+// part. During login, the prefix selects the app password to check, so a failed
+// login costs at most one password hash comparison for app passwords.
+// 
+// Each app password has its own SCRAM salts. For SCRAM authentication, the server
+// must send a salt and iteration count before it knows which password the client
+// uses. So SCRAM authentication can only be done with the main password, or with
+// the first app password if the account has no password. Clients must use
+// authentication mechanisms like PLAIN (with TLS) for app passwords.
+export interface AppPassword {
+	ID: number
+	Created: Date
+	Prefix: string  // First group of letters of the app password, not secret. Unique within the account.
+	Name: string  // Descriptive name to identify the app password, e.g. the device or application it is used in.
+	Protocols?: string[] | null  // Protocols the app password can be used for, see AppPasswordProtocols.
+	IPRanges?: string[] | null  // If non-empty, the app password can only be used from IPs within these ranges, in CIDR notation.
+	LastUsed?: Date | null  // Time of last use, nil if never used.
+	LastUsedIP: string  // IP of last use, empty if never used.
+	LastUsedProtocol: string  // Protocol of last use, empty if never used.
+}
+
+// SecondFactorStatus describes the second factors configured for an account.
+export interface SecondFactorStatus {
+	TOTP: boolean  // Whether a confirmed TOTP secret is present.
+	WebAuthn?: WebAuthnCredential[] | null
+	RecoveryCodesUnused: number
+}
+
+// WebAuthnCredential is a registered security key or passkey, used as second
+// factor for logins to the web interfaces.
+export interface WebAuthnCredential {
+	ID: number
+	Created: Date
+	Name: string  // Descriptive name to identify the credential, e.g. the type of security key.
+	CredentialID: string  // Raw-url-base64 credential ID, as chosen by the authenticator.
+	LastUsed?: Date | null  // Time of last use, nil if never used.
+}
+
+// WebAuthnRegisterOptions are the parameters for navigator.credentials.create in
+// the browser, for registering a new security key or passkey. Binary values are
+// raw-url-base64 encoded.
+export interface WebAuthnRegisterOptions {
+	Challenge: string
+	RPID: string  // Relying party ID, the host name.
+	RPName: string
+	UserID: string
+	UserName: string
+	Algorithms?: number[] | null  // COSE algorithm identifiers, in order of preference.
+	ExcludeCredentialIDs?: string[] | null  // Already registered credentials.
+}
+
 // LoginAttempt is a successful or failed login attempt, stored for auditing
 // purposes.
 // 
@@ -240,12 +396,34 @@ export interface LoginAttempt {
 	LocalIP: string
 	TLS: string  // Empty if no TLS, otherwise contains version, algorithm, properties, etc.
 	TLSPubKeyFingerprint: string
-	Protocol: string  // "submission", "imap", "webmail", "webaccount", "webadmin"
+	Protocol: string  // "submission", "imap", "webmail", "webaccount", "webadmin", "webapi", "dav"
 	UserAgent: string  // From HTTP header, or IMAP ID command.
-	AuthMech: string  // "plain", "login", "cram-md5", "scram-sha-256-plus", "(unrecognized)", etc
+	AuthMech: string  // "plain", "login", "cram-md5", "scram-sha-256-plus", "apikey", "(unrecognized)", etc
+	APIKeyName: string  // Name of API key, for AuthMech "apikey".
+	AppPasswordName: string  // Name of app password, if one was used instead of the account password.
+	SecondFactor: string  // For web logins with a second factor: "totp", "recoverycode" or "webauthn".
 	Result: AuthResult
 }
 
+// SendUsageCounts are the counts of submitted messages for an account or domain,
+// matching the groups of limits in config.SendLimits.
+export interface SendUsageCounts {
+	All: SendCounts
+	Submission: SendCounts  // Through SMTP and webmail.
+	WebAPI: SendCounts
+}
+
+// SendCounts are the numbers of messages and recipients submitted in the past
+// hour, day and month (30 days).
+export interface SendCounts {
+	MessagesHour: number
+	MessagesDay: number
+	MessagesMonth: number
+	RecipientsHour: number
+	RecipientsDay: number
+	RecipientsMonth: number
+}
+
 export type CSRFToken = string
 
 // Localpart is a decoded local part of an email address, before the "@".
@@ -278,6 +456,12 @@ export enum OutgoingEvent {
 	// type ("action"), or an incoming non-DSN-message was received for the unique
 	// per-outgoing-message address used for sending.
 	EventUnrecognized = "unrecognized",
+	// A message was submitted that reached a send limit configured for the account
+	// or the domain of its From address. See field SendLimit of [Outgoing] for
+	// details, and its Policy for whether the message was rejected, held in the
+	// queue or accepted for delivery. Not tied to a message in the queue, so
+	// QueueMsgID is zero.
+	EventLimitReached = "limitreached",
 }
 
 // AuthResult is the result of a login attempt.
@@ -289,23 +473,31 @@ export enum AuthResult {
 	AuthBadChannelBinding = "badchanbind",
 	AuthBadProtocol = "badprotocol",
 	AuthLoginDisabled = "logindisabled",
+	AuthSecondFactorRequired = "secondfactor",  // Valid password, login continues with second factor.
 	AuthError = "error",
 	AuthAborted = "aborted",
 }
 
-export const structTypes: {[typename: string]: boolean} = {"Account":true,"Address":true,"AddressAlias":true,"Alias":true,"AliasAddress":true,"AutomaticJunkFlags":true,"Destination":true,"Domain":true,"ImportProgress":true,"Incoming":true,"IncomingMeta":true,"IncomingWebhook":true,"JunkFilter":true,"LoginAttempt":true,"NameAddress":true,"Outgoing":true,"OutgoingWebhook":true,"Route":true,"Ruleset":true,"Structure":true,"SubjectPass":true,"Suppression":true,"TLSPublicKey":true}
+export const structTypes: {[typename: string]: boolean} = {"APIKey":true,"Account":true,"Address":true,"AddressAlias":true,"Alias":true,"AliasAddress":true,"AppPassword":true,"AttachmentRule":true,"AutomaticJunkFlags":true,"Destination":true,"Domain":true,"ImportProgress":true,"Incoming":true,"IncomingMeta":true,"IncomingWebhook":true,"JunkFilter":true,"LoginAttempt":true,"NameAddress":true,"Outgoing":true,"OutgoingWebhook":true,"Route":true,"Ruleset":true,"SecondFactorChallenge":true,"SecondFactorResponse":true,"SecondFactorStatus":true,"SendCounts":true,"SendLimit":true,"SendLimitCounts":true,"SendLimits":true,"SendUsageCounts":true,"Structure":true,"SubjectPass":true,"Suppression":true,"TLSPublicKey":true,"WebAuthnAssertion":true,"WebAuthnCredential":true,"WebAuthnRegisterOptions":true,"WebAuthnRequest":true}
 export const stringsTypes: {[typename: string]: boolean} = {"AuthResult":true,"CSRFToken":true,"Localpart":true,"OutgoingEvent":true}
 export const intsTypes: {[typename: string]: boolean} = {}
 export const types: TypenameMap = {
-	"Account": {"Name":"Account","Docs":"","Fields":[{"Name":"OutgoingWebhook","Docs":"","Typewords":["nullable","OutgoingWebhook"]},{"Name":"IncomingWebhook","Docs":"","Typewords":["nullable","IncomingWebhook"]},{"Name":"FromIDLoginAddresses","Docs":"","Typewords":["[]","string"]},{"Name":"KeepRetiredMessagePeriod","Docs":"","Typewords":["int64"]},{"Name":"KeepRetiredWebhookPeriod","Docs":"","Typewords":["int64"]},{"Name":"LoginDisabled","Docs":"","Typewords":["string"]},{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"Description","Docs":"","Typewords":["string"]},{"Name":"FullName","Docs":"","Typewords":["string"]},{"Name":"Destinations","Docs":"","Typewords":["{}","Destination"]},{"Name":"SubjectPass","Docs":"","Typewords":["SubjectPass"]},{"Name":"QuotaMessageSize","Docs":"","Typewords":["int64"]},{"Name":"RejectsMailbox","Docs":"","Typewords":["string"]},{"Name":"KeepRejects","Docs":"","Typewords":["bool"]},{"Name":"AutomaticJunkFlags","Docs":"","Typewords":["AutomaticJunkFlags"]},{"Name":"JunkFilter","Docs":"","Typewords":["nullable","JunkFilter"]},{"Name":"MaxOutgoingMessagesPerDay","Docs":"","Typewords":["int32"]},{"Name":"MaxFirstTimeRecipientsPerDay","Docs":"","Typewords":["int32"]},{"Name":"NoFirstTimeSenderDelay","Docs":"","Typewords":["bool"]},{"Name":"NoCustomPassword","Docs":"","Typewords":["bool"]},{"Name":"IMAPCapabilitiesDisabled","Docs":"","Typewords":["[]","string"]},{"Name":"Routes","Docs":"","Typewords":["[]","Route"]},{"Name":"DNSDomain","Docs":"","Typewords":["Domain"]},{"Name":"Aliases","Docs":"","Typewords":["[]","AddressAlias"]}]},
-	"OutgoingWebhook": {"Name":"OutgoingWebhook","Docs":"","Fields":[{"Name":"URL","Docs":"","Typewords":["string"]},{"Name":"Authorization","Docs":"","Typewords":["string"]},{"Name":"Events","Docs":"","Typewords":["[]","string"]}]},
-	"IncomingWebhook": {"Name":"IncomingWebhook","Docs":"","Fields":[{"Name":"URL","Docs":"","Typewords":["string"]},{"Name":"Authorization","Docs":"","Typewords":["string"]}]},
+	"SecondFactorChallenge": {"Name":"SecondFactorChallenge","Docs":"","Fields":[{"Name":"Token","Docs":"","Typewords":["string"]},{"Name":"TOTP","Docs":"","Typewords":["bool"]},{"Name":"RecoveryCodes","Docs":"","Typewords":["bool"]},{"Name":"WebAuthn","Docs":"","Typewords":["nullable","WebAuthnRequest"]}]},
+	"WebAuthnRequest": {"Name":"WebAuthnRequest","Docs":"","Fields":[{"Name":"Challenge","Docs":"","Typewords":["string"]},{"Name":"RPID","Docs":"","Typewords":["string"]},{"Name":"CredentialIDs","Docs":"","Typewords":["[]","string"]}]},
+	"SecondFactorResponse": {"Name":"SecondFactorResponse","Docs":"","Fields":[{"Name":"Code","Docs":"","Typewords":["string"]},{"Name":"WebAuthn","Docs":"","Typewords":["nullable","WebAuthnAssertion"]}]},
+	"WebAuthnAssertion": {"Name":"WebAuthnAssertion","Docs":"","Fields":[{"Name":"CredentialID","Docs":"","Typewords":["string"]},{"Name":"ClientDataJSON","Docs":"","Typewords":["string"]},{"Name":"AuthenticatorData","Docs":"","Typewords":["string"]},{"Name":"Signature","Docs":"","Typewords":["string"]}]},
+	"Account": {"Name":"Account","Docs":"","Fields":[{"Name":"OutgoingWebhook","Docs":"","Typewords":["nullable","OutgoingWebhook"]},{"Name":"IncomingWebhook","Docs":"","Typewords":["nullable","IncomingWebhook"]},{"Name":"FromIDLoginAddresses","Docs":"","Typewords":["[]","string"]},{"Name":"KeepRetiredMessagePeriod","Docs":"","Typewords":["int64"]},{"Name":"KeepRetiredWebhookPeriod","Docs":"","Typewords":["int64"]},{"Name":"LoginDisabled","Docs":"","Typewords":["string"]},{"Name":"RequireSecondFactor","Docs":"","Typewords":["bool"]},{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"Description","Docs":"","Typewords":["string"]},{"Name":"FullName","Docs":"","Typewords":["string"]},{"Name":"Destinations","Docs":"","Typewords":["{}","Destination"]},{"Name":"SubjectPass","Docs":"","Typewords":["SubjectPass"]},{"Name":"QuotaMessageSize","Docs":"","Typewords":["int64"]},{"Name":"RejectsMailbox","Docs":"","Typewords":["string"]},{"Name":"KeepRejects","Docs":"","Typewords":["bool"]},{"Name":"AutomaticJunkFlags","Docs":"","Typewords":["AutomaticJunkFlags"]},{"Name":"JunkFilter","Docs":"","Typewords":["nullable","JunkFilter"]},{"Name":"MaxOutgoingMessagesPerDay","Docs":"","Typewords":["int32"]},{"Name":"MaxFirstTimeRecipientsPerDay","Docs":"","Typewords":["int32"]},{"Name":"SendLimits","Docs":"","Typewords":["nullable","SendLimits"]},{"Name":"NoFirstTimeSenderDelay","Docs":"","Typewords":["bool"]},{"Name":"NoCustomPassword","Docs":"","Typewords":["bool"]},{"Name":"IMAPCapabilitiesDisabled","Docs":"","Typewords":["[]","string"]},{"Name":"AttachmentRules","Docs":"","Typewords":["[]","AttachmentRule"]},{"Name":"Routes","Docs":"","Typewords":["[]","Route"]},{"Name":"DNSDomain","Docs":"","Typewords":["Domain"]},{"Name":"Aliases","Docs":"","Typewords":["[]","AddressAlias"]}]},
+	"OutgoingWebhook": {"Name":"OutgoingWebhook","Docs":"","Fields":[{"Name":"URL","Docs":"","Typewords":["string"]},{"Name":"Authorization","Docs":"","Typewords":["string"]},{"Name":"EventStreamOnly","Docs":"","Typewords":["bool"]},{"Name":"Events","Docs":"","Typewords":["[]","string"]}]},
+	"IncomingWebhook": {"Name":"IncomingWebhook","Docs":"","Fields":[{"Name":"URL","Docs":"","Typewords":["string"]},{"Name":"Authorization","Docs":"","Typewords":["string"]},{"Name":"EventStreamOnly","Docs":"","Typewords":["bool"]}]},
 	"Destination": {"Name":"Destination","Docs":"","Fields":[{"Name":"Mailbox","Docs":"","Typewords":["string"]},{"Name":"Rulesets","Docs":"","Typewords":["[]","Ruleset"]},{"Name":"SMTPError","Docs":"","Typewords":["string"]},{"Name":"MessageAuthRequiredSMTPError","Docs":"","Typewords":["string"]},{"Name":"FullName","Docs":"","Typewords":["string"]}]},
 	"Ruleset": {"Name":"Ruleset","Docs":"","Fields":[{"Name":"SMTPMailFromRegexp","Docs":"","Typewords":["string"]},{"Name":"MsgFromRegexp","Docs":"","Typewords":["string"]},{"Name":"VerifiedDomain","Docs":"","Typewords":["string"]},{"Name":"HeadersRegexp","Docs":"","Typewords":["{}","string"]},{"Name":"IsForward","Docs":"","Typewords":["bool"]},{"Name":"ListAllowDomain","Docs":"","Typewords":["string"]},{"Name":"AcceptRejectsToMailbox","Docs":"","Typewords":["string"]},{"Name":"Mailbox","Docs":"","Typewords":["string"]},{"Name":"Comment","Docs":"","Typewords":["string"]},{"Name":"VerifiedDNSDomain","Docs":"","Typewords":["Domain"]},{"Name":"ListAllowDNSDomain","Docs":"","Typewords":["Domain"]}]},
 	"Domain": {"Name":"Domain","Docs":"","Fields":[{"Name":"ASCII","Docs":"","Typewords":["string"]},{"Name":"Unicode","Docs":"","Typewords":["string"]}]},
 	"SubjectPass": {"Name":"SubjectPass","Docs":"","Fields":[{"Name":"Period","Docs":"","Typewords":["int64"]}]},
 	"AutomaticJunkFlags": {"Name":"AutomaticJunkFlags","Docs":"","Fields":[{"Name":"Enabled","Docs":"","Typewords":["bool"]},{"Name":"JunkMailboxRegexp","Docs":"","Typewords":["string"]},{"Name":"NeutralMailboxRegexp","Docs":"","Typewords":["string"]},{"Name":"NotJunkMailboxRegexp","Docs":"","Typewords":["string"]}]},
-	"JunkFilter": {"Name":"JunkFilter","Docs":"","Fields":[{"Name":"Threshold","Docs":"","Typewords":["float64"]},{"Name":"Onegrams","Docs":"","Typewords":["bool"]},{"Name":"Twograms","Docs":"","Typewords":["bool"]},{"Name":"Threegrams","Docs":"","Typewords":["bool"]},{"Name":"MaxPower","Docs":"","Typewords":["float64"]},{"Name":"TopWords","Docs":"","Typewords":["int32"]},{"Name":"IgnoreWords","Docs":"","Typewords":["float64"]},{"Name":"RareWords","Docs":"","Typewords":["int32"]}]},
+	"JunkFilter": {"Name":"JunkFilter","Docs":"","Fields":[{"Name":"Threshold","Docs":"","Typewords":["float64"]},{"Name":"Onegrams","Docs":"","Typewords":["bool"]},{"Name":"Twograms","Docs":"","Typewords":["bool"]},{"Name":"Threegrams","Docs":"","Typewords":["bool"]},{"Name":"MaxPower","Docs":"","Typewords":["float64"]},{"Name":"TopWords","Docs":"","Typewords":["int32"]},{"Name":"IgnoreWords","Docs":"","Typewords":["float64"]},{"Name":"RareWords","Docs":"","Typewords":["int32"]},{"Name":"Features","Docs":"","Typewords":["bool"]}]},
+	"SendLimits": {"Name":"SendLimits","Docs":"","Fields":[{"Name":"All","Docs":"","Typewords":["SendLimitCounts"]},{"Name":"Submission","Docs":"","Typewords":["SendLimitCounts"]},{"Name":"WebAPI","Docs":"","Typewords":["SendLimitCounts"]},{"Name":"Policy","Docs":"","Typewords":["string"]}]},
+	"SendLimitCounts": {"Name":"SendLimitCounts","Docs":"","Fields":[{"Name":"MessagesPerHour","Docs":"","Typewords":["int32"]},{"Name":"MessagesPerDay","Docs":"","Typewords":["int32"]},{"Name":"MessagesPerMonth","Docs":"","Typewords":["int32"]},{"Name":"RecipientsPerHour","Docs":"","Typewords":["int32"]},{"Name":"RecipientsPerDay","Docs":"","Typewords":["int32"]},{"Name":"RecipientsPerMonth","Docs":"","Typewords":["int32"]}]},
+	"AttachmentRule": {"Name":"AttachmentRule","Docs":"","Fields":[{"Name":"Direction","Docs":"","Typewords":["string"]},{"Name":"ContentTypes","Docs":"","Typewords":["[]","string"]},{"Name":"Extensions","Docs":"","Typewords":["[]","string"]},{"Name":"EncryptedArchive","Docs":"","Typewords":["bool"]},{"Name":"UninspectableArchive","Docs":"","Typewords":["bool"]},{"Name":"MinSize","Docs":"","Typewords":["int64"]},{"Name":"Action","Docs":"","Typewords":["string"]}]},
 	"Route": {"Name":"Route","Docs":"","Fields":[{"Name":"FromDomain","Docs":"","Typewords":["[]","string"]},{"Name":"ToDomain","Docs":"","Typewords":["[]","string"]},{"Name":"MinimumAttempts","Docs":"","Typewords":["int32"]},{"Name":"Transport","Docs":"","Typewords":["string"]},{"Name":"FromDomainASCII","Docs":"","Typewords":["[]","string"]},{"Name":"ToDomainASCII","Docs":"","Typewords":["[]","string"]}]},
 	"AddressAlias": {"Name":"AddressAlias","Docs":"","Fields":[{"Name":"SubscriptionAddress","Docs":"","Typewords":["string"]},{"Name":"Alias","Docs":"","Typewords":["Alias"]},{"Name":"MemberAddresses","Docs":"","Typewords":["[]","string"]}]},
 	"Alias": {"Name":"Alias","Docs":"","Fields":[{"Name":"Addresses","Docs":"","Typewords":["[]","string"]},{"Name":"PostPublic","Docs":"","Typewords":["bool"]},{"Name":"ListMembers","Docs":"","Typewords":["bool"]},{"Name":"AllowMsgFrom","Docs":"","Typewords":["bool"]},{"Name":"LocalpartStr","Docs":"","Typewords":["string"]},{"Name":"Domain","Docs":"","Typewords":["Domain"]},{"Name":"ParsedAddresses","Docs":"","Typewords":["[]","AliasAddress"]}]},
@@ -313,20 +505,32 @@ export const types: TypenameMap = {
 	"Address": {"Name":"Address","Docs":"","Fields":[{"Name":"Localpart","Docs":"","Typewords":["Localpart"]},{"Name":"Domain","Docs":"","Typewords":["Domain"]}]},
 	"Suppression": {"Name":"Suppression","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Created","Docs":"","Typewords":["timestamp"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"BaseAddress","Docs":"","Typewords":["string"]},{"Name":"OriginalAddress","Docs":"","Typewords":["string"]},{"Name":"Manual","Docs":"","Typewords":["bool"]},{"Name":"Reason","Docs":"","Typewords":["string"]}]},
 	"ImportProgress": {"Name":"ImportProgress","Docs":"","Fields":[{"Name":"Token","Docs":"","Typewords":["string"]}]},
-	"Outgoing": {"Name":"Outgoing","Docs":"","Fields":[{"Name":"Version","Docs":"","Typewords":["int32"]},{"Name":"Event","Docs":"","Typewords":["OutgoingEvent"]},{"Name":"DSN","Docs":"","Typewords":["bool"]},{"Name":"Suppressing","Docs":"","Typewords":["bool"]},{"Name":"QueueMsgID","Docs":"","Typewords":["int64"]},{"Name":"FromID","Docs":"","Typewords":["string"]},{"Name":"MessageID","Docs":"","Typewords":["string"]},{"Name":"Subject","Docs":"","Typewords":["string"]},{"Name":"WebhookQueued","Docs":"","Typewords":["timestamp"]},{"Name":"SMTPCode","Docs":"","Typewords":["int32"]},{"Name":"SMTPEnhancedCode","Docs":"","Typewords":["string"]},{"Name":"Error","Docs":"","Typewords":["string"]},{"Name":"Extra","Docs":"","Typewords":["{}","string"]}]},
+	"Outgoing": {"Name":"Outgoing","Docs":"","Fields":[{"Name":"Version","Docs":"","Typewords":["int32"]},{"Name":"Event","Docs":"","Typewords":["OutgoingEvent"]},{"Name":"DSN","Docs":"","Typewords":["bool"]},{"Name":"Suppressing","Docs":"","Typewords":["bool"]},{"Name":"QueueMsgID","Docs":"","Typewords":["int64"]},{"Name":"FromID","Docs":"","Typewords":["string"]},{"Name":"MessageID","Docs":"","Typewords":["string"]},{"Name":"Subject","Docs":"","Typewords":["string"]},{"Name":"WebhookQueued","Docs":"","Typewords":["timestamp"]},{"Name":"SMTPCode","Docs":"","Typewords":["int32"]},{"Name":"SMTPEnhancedCode","Docs":"","Typewords":["string"]},{"Name":"Error","Docs":"","Typewords":["string"]},{"Name":"Extra","Docs":"","Typewords":["{}","string"]},{"Name":"SendLimit","Docs":"","Typewords":["nullable","SendLimit"]}]},
+	"SendLimit": {"Name":"SendLimit","Docs":"","Fields":[{"Name":"Scope","Docs":"","Typewords":["string"]},{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"Source","Docs":"","Typewords":["string"]},{"Name":"Kind","Docs":"","Typewords":["string"]},{"Name":"Period","Docs":"","Typewords":["string"]},{"Name":"Limit","Docs":"","Typewords":["int32"]},{"Name":"Count","Docs":"","Typewords":["int32"]},{"Name":"Policy","Docs":"","Typewords":["string"]}]},
 	"Incoming": {"Name":"Incoming","Docs":"","Fields":[{"Name":"Version","Docs":"","Typewords":["int32"]},{"Name":"From","Docs":"","Typewords":["[]","NameAddress"]},{"Name":"To","Docs":"","Typewords":["[]","NameAddress"]},{"Name":"CC","Docs":"","Typewords":["[]","NameAddress"]},{"Name":"BCC","Docs":"","Typewords":["[]","NameAddress"]},{"Name":"ReplyTo","Docs":"","Typewords":["[]","NameAddress"]},{"Name":"Subject","Docs":"","Typewords":["string"]},{"Name":"MessageID","Docs":"","Typewords":["string"]},{"Name":"InReplyTo","Docs":"","Typewords":["string"]},{"Name":"References","Docs":"","Typewords":["[]","string"]},{"Name":"Date","Docs":"","Typewords":["nullable","timestamp"]},{"Name":"Text","Docs":"","Typewords":["string"]},{"Name":"HTML","Docs":"","Typewords":["string"]},{"Name":"Structure","Docs":"","Typewords":["Structure"]},{"Name":"Meta","Docs":"","Typewords":["IncomingMeta"]}]},
 	"NameAddress": {"Name":"NameAddress","Docs":"","Fields":[{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"Address","Docs":"","Typewords":["string"]}]},
 	"Structure": {"Name":"Structure","Docs":"","Fields":[{"Name":"ContentType","Docs":"","Typewords":["string"]},{"Name":"ContentTypeParams","Docs":"","Typewords":["{}","string"]},{"Name":"ContentID","Docs":"","Typewords":["string"]},{"Name":"ContentDisposition","Docs":"","Typewords":["string"]},{"Name":"Filename","Docs":"","Typewords":["string"]},{"Name":"DecodedSize","Docs":"","Typewords":["int64"]},{"Name":"Parts","Docs":"","Typewords":["[]","Structure"]}]},
 	"IncomingMeta": {"Name":"IncomingMeta","Docs":"","Fields":[{"Name":"MsgID","Docs":"","Typewords":["int64"]},{"Name":"MailFrom","Docs":"","Typewords":["string"]},{"Name":"MailFromValidated","Docs":"","Typewords":["bool"]},{"Name":"MsgFromValidated","Docs":"","Typewords":["bool"]},{"Name":"RcptTo","Docs":"","Typewords":["string"]},{"Name":"DKIMVerifiedDomains","Docs":"","Typewords":["[]","string"]},{"Name":"RemoteIP","Docs":"","Typewords":["string"]},{"Name":"Received","Docs":"","Typewords":["timestamp"]},{"Name":"MailboxName","Docs":"","Typewords":["string"]},{"Name":"Automated","Docs":"","Typewords":["bool"]}]},
 	"TLSPublicKey": {"Name":"TLSPublicKey","Docs":"","Fields":[{"Name":"Fingerprint","Docs":"","Typewords":["string"]},{"Name":"Created","Docs":"","Typewords":["timestamp"]},{"Name":"Type","Docs":"","Typewords":["string"]},{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"NoIMAPPreauth","Docs":"","Typewords":["bool"]},{"Name":"CertDER","Docs":"","Typewords":["nullable","string"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"LoginAddress","Docs":"","Typewords":["string"]}]},
-	"LoginAttempt": {"Name":"LoginAttempt","Docs":"","Fields":[{"Name":"Key","Docs":"","Typewords":["nullable","string"]},{"Name":"Last","Docs":"","Typewords":["timestamp"]},{"Name":"First","Docs":"","Typewords":["timestamp"]},{"Name":"Count","Docs":"","Typewords":["int64"]},{"Name":"AccountName","Docs":"","Typewords":["string"]},{"Name":"LoginAddress","Docs":"","Typewords":["string"]},{"Name":"RemoteIP","Docs":"","Typewords":["string"]},{"Name":"LocalIP","Docs":"","Typewords":["string"]},{"Name":"TLS","Docs":"","Typewords":["string"]},{"Name":"TLSPubKeyFingerprint","Docs":"","Typewords":["string"]},{"Name":"Protocol","Docs":"","Typewords":["string"]},{"Name":"UserAgent","Docs":"","Typewords":["string"]},{"Name":"AuthMech","Docs":"","Typewords":["string"]},{"Name":"Result","Docs":"","Typewords":["AuthResult"]}]},
+	"APIKey": {"Name":"APIKey","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Created","Docs":"","Typewords":["timestamp"]},{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"Prefix","Docs":"","Typewords":["string"]},{"Name":"Scopes","Docs":"","Typewords":["[]","string"]},{"Name":"Expires","Docs":"","Typewords":["nullable","timestamp"]},{"Name":"IPRanges","Docs":"","Typewords":["[]","string"]},{"Name":"LastUsed","Docs":"","Typewords":["nullable","timestamp"]},{"Name":"LastUsedIP","Docs":"","Typewords":["string"]}]},
+	"AppPassword": {"Name":"AppPassword","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Created","Docs":"","Typewords":["timestamp"]},{"Name":"Prefix","Docs":"","Typewords":["string"]},{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"Protocols","Docs":"","Typewords":["[]","string"]},{"Name":"IPRanges","Docs":"","Typewords":["[]","string"]},{"Name":"LastUsed","Docs":"","Typewords":["nullable","timestamp"]},{"Name":"LastUsedIP","Docs":"","Typewords":["string"]},{"Name":"LastUsedProtocol","Docs":"","Typewords":["string"]}]},
+	"SecondFactorStatus": {"Name":"SecondFactorStatus","Docs":"","Fields":[{"Name":"TOTP","Docs":"","Typewords":["bool"]},{"Name":"WebAuthn","Docs":"","Typewords":["[]","WebAuthnCredential"]},{"Name":"RecoveryCodesUnused","Docs":"","Typewords":["int32"]}]},
+	"WebAuthnCredential": {"Name":"WebAuthnCredential","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Created","Docs":"","Typewords":["timestamp"]},{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"CredentialID","Docs":"","Typewords":["string"]},{"Name":"LastUsed","Docs":"","Typewords":["nullable","timestamp"]}]},
+	"WebAuthnRegisterOptions": {"Name":"WebAuthnRegisterOptions","Docs":"","Fields":[{"Name":"Challenge","Docs":"","Typewords":["string"]},{"Name":"RPID","Docs":"","Typewords":["string"]},{"Name":"RPName","Docs":"","Typewords":["string"]},{"Name":"UserID","Docs":"","Typewords":["string"]},{"Name":"UserName","Docs":"","Typewords":["string"]},{"Name":"Algorithms","Docs":"","Typewords":["[]","int32"]},{"Name":"ExcludeCredentialIDs","Docs":"","Typewords":["[]","string"]}]},
+	"LoginAttempt": {"Name":"LoginAttempt","Docs":"","Fields":[{"Name":"Key","Docs":"","Typewords":["nullable","string"]},{"Name":"Last","Docs":"","Typewords":["timestamp"]},{"Name":"First","Docs":"","Typewords":["timestamp"]},{"Name":"Count","Docs":"","Typewords":["int64"]},{"Name":"AccountName","Docs":"","Typewords":["string"]},{"Name":"LoginAddress","Docs":"","Typewords":["string"]},{"Name":"RemoteIP","Docs":"","Typewords":["string"]},{"Name":"LocalIP","Docs":"","Typewords":["string"]},{"Name":"TLS","Docs":"","Typewords":["string"]},{"Name":"TLSPubKeyFingerprint","Docs":"","Typewords":["string"]},{"Name":"Protocol","Docs":"","Typewords":["string"]},{"Name":"UserAgent","Docs":"","Typewords":["string"]},{"Name":"AuthMech","Docs":"","Typewords":["string"]},{"Name":"APIKeyName","Docs":"","Typewords":["string"]},{"Name":"AppPasswordName","Docs":"","Typewords":["string"]},{"Name":"SecondFactor","Docs":"","Typewords":["string"]},{"Name":"Result","Docs":"","Typewords":["AuthResult"]}]},
+	"SendUsageCounts": {"Name":"SendUsageCounts","Docs":"","Fields":[{"Name":"All","Docs":"","Typewords":["SendCounts"]},{"Name":"Submission","Docs":"","Typewords":["SendCounts"]},{"Name":"WebAPI","Docs":"","Typewords":["SendCounts"]}]},
+	"SendCounts": {"Name":"SendCounts","Docs":"","Fields":[{"Name":"MessagesHour","Docs":"","Typewords":["int32"]},{"Name":"MessagesDay","Docs":"","Typewords":["int32"]},{"Name":"MessagesMonth","Docs":"","Typewords":["int32"]},{"Name":"RecipientsHour","Docs":"","Typewords":["int32"]},{"Name":"RecipientsDay","Docs":"","Typewords":["int32"]},{"Name":"RecipientsMonth","Docs":"","Typewords":["int32"]}]},
 	"CSRFToken": {"Name":"CSRFToken","Docs":"","Values":null},
 	"Localpart": {"Name":"Localpart","Docs":"","Values":null},
-	"OutgoingEvent": {"Name":"OutgoingEvent","Docs":"","Values":[{"Name":"EventDelivered","Value":"delivered","Docs":""},{"Name":"EventSuppressed","Value":"suppressed","Docs":""},{"Name":"EventDelayed","Value":"delayed","Docs":""},{"Name":"EventFailed","Value":"failed","Docs":""},{"Name":"EventRelayed","Value":"relayed","Docs":""},{"Name":"EventExpanded","Value":"expanded","Docs":""},{"Name":"EventCanceled","Value":"canceled","Docs":""},{"Name":"EventUnrecognized","Value":"unrecognized","Docs":""}]},
-	"AuthResult": {"Name":"AuthResult","Docs":"","Values":[{"Name":"AuthSuccess","Value":"ok","Docs":""},{"Name":"AuthBadUser","Value":"baduser","Docs":""},{"Name":"AuthBadPassword","Value":"badpassword","Docs":""},{"Name":"AuthBadCredentials","Value":"badcreds","Docs":""},{"Name":"AuthBadChannelBinding","Value":"badchanbind","Docs":""},{"Name":"AuthBadProtocol","Value":"badprotocol","Docs":""},{"Name":"AuthLoginDisabled","Value":"logindisabled","Docs":""},{"Name":"AuthError","Value":"error","Docs":""},{"Name":"AuthAborted","Value":"aborted","Docs":""}]},
+	"OutgoingEvent": {"Name":"OutgoingEvent","Docs":"","Values":[{"Name":"EventDelivered","Value":"delivered","Docs":""},{"Name":"EventSuppressed","Value":"suppressed","Docs":""},{"Name":"EventDelayed","Value":"delayed","Docs":""},{"Name":"EventFailed","Value":"failed","Docs":""},{"Name":"EventRelayed","Value":"relayed","Docs":""},{"Name":"EventExpanded","Value":"expanded","Docs":""},{"Name":"EventCanceled","Value":"canceled","Docs":""},{"Name":"EventUnrecognized","Value":"unrecognized","Docs":""},{"Name":"EventLimitReached","Value":"limitreached","Docs":""}]},
+	"AuthResult": {"Name":"AuthResult","Docs":"","Values":[{"Name":"AuthSuccess","Value":"ok","Docs":""},{"Name":"AuthBadUser","Value":"baduser","Docs":""},{"Name":"AuthBadPassword","Value":"badpassword","Docs":""},{"Name":"AuthBadCredentials","Value":"badcreds","Docs":""},{"Name":"AuthBadChannelBinding","Value":"badchanbind","Docs":""},{"Name":"AuthBadProtocol","Value":"badprotocol","Docs":""},{"Name":"AuthLoginDisabled","Value":"logindisabled","Docs":""},{"Name":"AuthSecondFactorRequired","Value":"secondfactor","Docs":""},{"Name":"AuthError","Value":"error","Docs":""},{"Name":"AuthAborted","Value":"aborted","Docs":""}]},
 }
 
 export const parser = {
+	SecondFactorChallenge: (v: any) => parse("SecondFactorChallenge", v) as SecondFactorChallenge,
+	WebAuthnRequest: (v: any) => parse("WebAuthnRequest", v) as WebAuthnRequest,
+	SecondFactorResponse: (v: any) => parse("SecondFactorResponse", v) as SecondFactorResponse,
+	WebAuthnAssertion: (v: any) => parse("WebAuthnAssertion", v) as WebAuthnAssertion,
 	Account: (v: any) => parse("Account", v) as Account,
 	OutgoingWebhook: (v: any) => parse("OutgoingWebhook", v) as OutgoingWebhook,
 	IncomingWebhook: (v: any) => parse("IncomingWebhook", v) as IncomingWebhook,
@@ -336,6 +540,9 @@ export const parser = {
 	SubjectPass: (v: any) => parse("SubjectPass", v) as SubjectPass,
 	AutomaticJunkFlags: (v: any) => parse("AutomaticJunkFlags", v) as AutomaticJunkFlags,
 	JunkFilter: (v: any) => parse("JunkFilter", v) as JunkFilter,
+	SendLimits: (v: any) => parse("SendLimits", v) as SendLimits,
+	SendLimitCounts: (v: any) => parse("SendLimitCounts", v) as SendLimitCounts,
+	AttachmentRule: (v: any) => parse("AttachmentRule", v) as AttachmentRule,
 	Route: (v: any) => parse("Route", v) as Route,
 	AddressAlias: (v: any) => parse("AddressAlias", v) as AddressAlias,
 	Alias: (v: any) => parse("Alias", v) as Alias,
@@ -344,12 +551,20 @@ export const parser = {
 	Suppression: (v: any) => parse("Suppression", v) as Suppression,
 	ImportProgress: (v: any) => parse("ImportProgress", v) as ImportProgress,
 	Outgoing: (v: any) => parse("Outgoing", v) as Outgoing,
+	SendLimit: (v: any) => parse("SendLimit", v) as SendLimit,
 	Incoming: (v: any) => parse("Incoming", v) as Incoming,
 	NameAddress: (v: any) => parse("NameAddress", v) as NameAddress,
 	Structure: (v: any) => parse("Structure", v) as Structure,
 	IncomingMeta: (v: any) => parse("IncomingMeta", v) as IncomingMeta,
 	TLSPublicKey: (v: any) => parse("TLSPublicKey", v) as TLSPublicKey,
+	APIKey: (v: any) => parse("APIKey", v) as APIKey,
+	AppPassword: (v: any) => parse("AppPassword", v) as AppPassword,
+	SecondFactorStatus: (v: any) => parse("SecondFactorStatus", v) as SecondFactorStatus,
+	WebAuthnCredential: (v: any) => parse("WebAuthnCredential", v) as WebAuthnCredential,
+	WebAuthnRegisterOptions: (v: any) => parse("WebAuthnRegisterOptions", v) as WebAuthnRegisterOptions,
 	LoginAttempt: (v: any) => parse("LoginAttempt", v) as LoginAttempt,
+	SendUsageCounts: (v: any) => parse("SendUsageCounts", v) as SendUsageCounts,
+	SendCounts: (v: any) => parse("SendCounts", v) as SendCounts,
 	CSRFToken: (v: any) => parse("CSRFToken", v) as CSRFToken,
 	Localpart: (v: any) => parse("Localpart", v) as Localpart,
 	OutgoingEvent: (v: any) => parse("OutgoingEvent", v) as OutgoingEvent,
@@ -397,12 +612,26 @@ export class Client {
 	}
 
 	// Login returns a session token for the credentials, or fails with error code
-	// "user:badLogin". Call LoginPrep to get a loginToken.
-	async Login(loginToken: string, username: string, password: string): Promise<CSRFToken> {
+	// "user:badLogin". Call LoginPrep to get a loginToken. If a second factor is
+	// required, no session is created yet, and secondFactor is returned instead.
+	// Complete the login with LoginSecondFactor.
+	async Login(loginToken: string, username: string, password: string): Promise<[CSRFToken, SecondFactorChallenge | null]> {
 		const fn: string = "Login"
 		const paramTypes: string[][] = [["string"],["string"],["string"]]
-		const returnTypes: string[][] = [["CSRFToken"]]
+		const returnTypes: string[][] = [["CSRFToken"],["nullable","SecondFactorChallenge"]]
 		const params: any[] = [loginToken, username, password]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as [CSRFToken, SecondFactorChallenge | null]
+	}
+
+	// LoginSecondFactor completes a login for which Login returned a second factor
+	// challenge, with the token from the challenge and a TOTP code, recovery code or
+	// WebAuthn assertion. It returns a session token, or fails with error code
+	// "user:loginFailed".
+	async LoginSecondFactor(loginToken: string, token: string, response: SecondFactorResponse): Promise<CSRFToken> {
+		const fn: string = "LoginSecondFactor"
+		const paramTypes: string[][] = [["string"],["string"],["SecondFactorResponse"]]
+		const returnTypes: string[][] = [["CSRFToken"]]
+		const params: any[] = [loginToken, token, response]
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as CSRFToken
 	}
 
@@ -655,6 +884,148 @@ export class Client {
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
 	}
 
+	// APIKeys returns the API keys for the webapi.
+	async APIKeys(): Promise<APIKey[] | null> {
+		const fn: string = "APIKeys"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["[]","APIKey"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as APIKey[] | null
+	}
+
+	// APIKeyAdd adds a new API key for the webapi. The key is returned, it is only
+	// available now, only a hash is stored. If expires is nil, the key does not
+	// expire. If ipRanges is empty, the key can be used from all IPs.
+	async APIKeyAdd(name: string, scopes: string[] | null, expires: Date | null, ipRanges: string[] | null): Promise<[APIKey, string]> {
+		const fn: string = "APIKeyAdd"
+		const paramTypes: string[][] = [["string"],["[]","string"],["nullable","timestamp"],["[]","string"]]
+		const returnTypes: string[][] = [["APIKey"],["string"]]
+		const params: any[] = [name, scopes, expires, ipRanges]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as [APIKey, string]
+	}
+
+	// APIKeyRemove removes an API key by ID.
+	async APIKeyRemove(id: number): Promise<void> {
+		const fn: string = "APIKeyRemove"
+		const paramTypes: string[][] = [["int64"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [id]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// AppPasswords returns the app passwords, for use instead of the account
+	// password in IMAP, SMTP submission and the webapi.
+	async AppPasswords(): Promise<AppPassword[] | null> {
+		const fn: string = "AppPasswords"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["[]","AppPassword"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as AppPassword[] | null
+	}
+
+	// AppPasswordAdd adds a new app password, allowed for protocols ("imap",
+	// "submission", "webapi", "dav"). The generated password is returned, it is only
+	// available now. If ipRanges is empty, the password can be used from all IPs.
+	async AppPasswordAdd(name: string, protocols: string[] | null, ipRanges: string[] | null): Promise<[AppPassword, string]> {
+		const fn: string = "AppPasswordAdd"
+		const paramTypes: string[][] = [["string"],["[]","string"],["[]","string"]]
+		const returnTypes: string[][] = [["AppPassword"],["string"]]
+		const params: any[] = [name, protocols, ipRanges]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as [AppPassword, string]
+	}
+
+	// AppPasswordRemove revokes an app password by ID.
+	async AppPasswordRemove(id: number): Promise<void> {
+		const fn: string = "AppPasswordRemove"
+		const paramTypes: string[][] = [["int64"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [id]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// SecondFactors returns the configured second factors for web logins.
+	async SecondFactors(): Promise<SecondFactorStatus> {
+		const fn: string = "SecondFactors"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["SecondFactorStatus"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as SecondFactorStatus
+	}
+
+	// TOTPSetup generates a new TOTP secret for an authenticator app. It returns the
+	// secret, an otpauth URI with the secret, and a base64-encoded PNG image with a
+	// QR code of the URI. The secret is only used for logins after confirming it with
+	// a code through TOTPConfirm.
+	async TOTPSetup(): Promise<[string, string, string]> {
+		const fn: string = "TOTPSetup"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["string"],["string"],["string"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as [string, string, string]
+	}
+
+	// TOTPConfirm enables the TOTP secret from TOTPSetup, after verifying a code from
+	// the authenticator app. If the account did not have unused recovery codes, new
+	// recovery codes are returned. They are only available now.
+	async TOTPConfirm(code: string): Promise<string[] | null> {
+		const fn: string = "TOTPConfirm"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = [["[]","string"]]
+		const params: any[] = [code]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as string[] | null
+	}
+
+	// TOTPRemove removes the TOTP secret.
+	async TOTPRemove(): Promise<void> {
+		const fn: string = "TOTPRemove"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = []
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// RecoveryCodesGenerate replaces the recovery codes with new codes, which are
+	// returned. They are only available now.
+	async RecoveryCodesGenerate(): Promise<string[] | null> {
+		const fn: string = "RecoveryCodesGenerate"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["[]","string"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as string[] | null
+	}
+
+	// WebAuthnRegisterStart starts registration of a new security key or passkey.
+	// The resulting credential must be passed to WebAuthnRegisterFinish within 5
+	// minutes.
+	async WebAuthnRegisterStart(): Promise<WebAuthnRegisterOptions> {
+		const fn: string = "WebAuthnRegisterStart"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["WebAuthnRegisterOptions"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as WebAuthnRegisterOptions
+	}
+
+	// WebAuthnRegisterFinish verifies and adds the credential created in the browser
+	// after WebAuthnRegisterStart. ClientDataJSON and attestationObject are
+	// raw-url-base64 encoded. If the account did not have unused recovery codes, new
+	// recovery codes are returned. They are only available now.
+	async WebAuthnRegisterFinish(name: string, clientDataJSON: string, attestationObject: string): Promise<[WebAuthnCredential, string[] | null]> {
+		const fn: string = "WebAuthnRegisterFinish"
+		const paramTypes: string[][] = [["string"],["string"],["string"]]
+		const returnTypes: string[][] = [["WebAuthnCredential"],["[]","string"]]
+		const params: any[] = [name, clientDataJSON, attestationObject]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as [WebAuthnCredential, string[] | null]
+	}
+
+	// WebAuthnCredentialRemove removes a security key or passkey by ID.
+	async WebAuthnCredentialRemove(id: number): Promise<void> {
+		const fn: string = "WebAuthnCredentialRemove"
+		const paramTypes: string[][] = [["int64"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [id]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
 	async LoginAttempts(limit: number): Promise<LoginAttempt[] | null> {
 		const fn: string = "LoginAttempts"
 		const paramTypes: string[][] = [["int32"]]
@@ -663,6 +1034,17 @@ export class Client {
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as LoginAttempt[] | null
 	}
 
+	// SendUsage returns the numbers of messages and recipients submitted by the
+	// account in the past hour, day and month, for comparing against the send limits
+	// of the account.
+	async SendUsage(): Promise<SendUsageCounts> {
+		const fn: string = "SendUsage"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["SendUsageCounts"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as SendUsageCounts
+	}
+
 	async IMAPSave(capabilitiesDisabled: string[] | null): Promise<void> {
 		const fn: string = "IMAPSave"
 		const paramTypes: string[][] = [["[]","string"]]
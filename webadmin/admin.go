@@ -54,6 +54,7 @@ import (
 	"github.com/mjl-/mox/dmarcrpt"
 	"github.com/mjl-/mox/dns"
 	"github.com/mjl-/mox/dnsbl"
+	"github.com/mjl-/mox/greylist"
 	"github.com/mjl-/mox/metrics"
 	"github.com/mjl-/mox/mlog"
 	mox "github.com/mjl-/mox/mox-"
@@ -62,6 +63,7 @@ import (
 	"github.com/mjl-/mox/mtastsdb"
 	"github.com/mjl-/mox/publicsuffix"
 	"github.com/mjl-/mox/queue"
+	"github.com/mjl-/mox/ratelimit"
 	"github.com/mjl-/mox/smtp"
 	"github.com/mjl-/mox/spf"
 	"github.com/mjl-/mox/store"
@@ -187,7 +189,7 @@ func handle(apiHandler http.Handler, isForwarded bool, w http.ResponseWriter, r
 
 	// All other URLs, except the login endpoint require some authentication.
 	var sessionToken store.SessionToken
-	if r.URL.Path != "/api/LoginPrep" && r.URL.Path != "/api/Login" {
+	if r.URL.Path != "/api/LoginPrep" && r.URL.Path != "/api/Login" && r.URL.Path != "/api/LoginSecondFactor" {
 		var ok bool
 		_, sessionToken, _, ok = webauth.Check(ctx, log, webauth.Admin, "webadmin", isForwarded, w, r, isAPI, isAPI, false)
 		if !ok {
@@ -257,16 +259,34 @@ func (w Admin) LoginPrep(ctx context.Context) string {
 }
 
 // Login returns a session token for the credentials, or fails with error code
-// "user:badLogin". Call LoginPrep to get a loginToken.
-func (w Admin) Login(ctx context.Context, loginToken, password string) store.CSRFToken {
+// "user:badLogin". Call LoginPrep to get a loginToken. If a second factor is
+// required, no session is created yet, and secondFactor is returned instead.
+// Complete the login with LoginSecondFactor.
+func (w Admin) Login(ctx context.Context, loginToken, password string) (csrfToken store.CSRFToken, secondFactor *webauth.SecondFactorChallenge) {
 	log := pkglog.WithContext(ctx)
 	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
 
-	csrfToken, err := webauth.Login(ctx, log, webauth.Admin, "webadmin", w.cookiePath, w.isForwarded, reqInfo.Response, reqInfo.Request, loginToken, "", password)
+	csrfToken, secondFactor, err := webauth.Login(ctx, log, webauth.Admin, "webadmin", w.cookiePath, w.isForwarded, reqInfo.Response, reqInfo.Request, loginToken, "", password)
 	if _, ok := err.(*sherpa.Error); ok {
 		panic(err)
 	}
 	xcheckf(ctx, err, "login")
+	return csrfToken, secondFactor
+}
+
+// LoginSecondFactor completes a login for which Login returned a second factor
+// challenge, with the token from the challenge and a TOTP code, recovery code or
+// WebAuthn assertion. It returns a session token, or fails with error code
+// "user:loginFailed".
+func (w Admin) LoginSecondFactor(ctx context.Context, loginToken, token string, response webauth.SecondFactorResponse) store.CSRFToken {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+
+	csrfToken, err := webauth.LoginSecondFactor(ctx, log, webauth.Admin, "webadmin", w.cookiePath, w.isForwarded, reqInfo.Response, reqInfo.Request, loginToken, token, response)
+	if _, ok := err.(*sherpa.Error); ok {
+		panic(err)
+	}
+	xcheckf(ctx, err, "login with second factor")
 	return csrfToken
 }
 
@@ -374,6 +394,11 @@ type MTASTSCheckResult struct {
 	Result
 }
 
+type BIMICheckResult struct {
+	TXT string
+	Result
+}
+
 type SRVConfCheckResult struct {
 	SRVs map[string][]net.SRV // Service (e.g. "_imaps") to records.
 	Result
@@ -411,6 +436,7 @@ type CheckResult struct {
 	HostTLSRPT   TLSRPTCheckResult
 	DomainTLSRPT TLSRPTCheckResult
 	MTASTS       MTASTSCheckResult
+	BIMI         BIMICheckResult
 	SRVConf      SRVConfCheckResult
 	Autoconf     AutoconfCheckResult
 	Autodiscover AutodiscoverCheckResult
@@ -1124,7 +1150,7 @@ EOF
 		defer logPanic(ctx)
 		defer wg.Done()
 
-		_, dmarcDomain, record, txt, _, err := dmarc.Lookup(ctx, log.Logger, resolver, domain)
+		_, dmarcDomain, record, txt, _, err := dmarc.Lookup(ctx, log.Logger, resolver, domain, mox.Conf.DMARCDiscovery())
 		if err != nil {
 			addf(&r.DMARC.Errors, "Looking up DMARC record: %s", err)
 		} else if record == nil {
@@ -1282,6 +1308,32 @@ HostTLSRPT:
 	}
 	go checkTLSRPT(&r.DomainTLSRPT, domain, domainTLSRPTAddr, false)
 
+	// BIMI
+	wg.Add(1)
+	go func() {
+		defer logPanic(ctx)
+		defer wg.Done()
+
+		if domConf.BIMI == nil {
+			addf(&r.BIMI.Instructions, "BIMI is not configured for this domain. Configure a BIMI section with a logo in SVG Tiny PS format for the domain in domains.conf to show your logo in mail clients that support BIMI.")
+			return
+		}
+
+		txt, errs := admin.CheckBIMI(ctx, log.Logger, resolver, *domConf.BIMI, domain)
+		r.BIMI.TXT = txt
+		for _, err := range errs {
+			addf(&r.BIMI.Errors, "%s", err)
+		}
+		_, _, dmarcRecord, _, _, err := dmarc.Lookup(ctx, log.Logger, resolver, domain, mox.Conf.DMARCDiscovery())
+		if err == nil && dmarcRecord.Policy != dmarc.PolicyReject && (dmarcRecord.Policy != dmarc.PolicyQuarantine || dmarcRecord.Percentage != 100) {
+			addf(&r.BIMI.Warnings, "BIMI logos are only shown for messages passing DMARC with policy quarantine (for all messages) or reject, the DMARC policy of this domain is %q.", dmarcRecord.Policy)
+		}
+		if len(errs) > 0 {
+			selector, record := admin.BIMIRecord(*domConf.BIMI)
+			addf(&r.BIMI.Instructions, "Ensure the following DNS record exists:\n\n\t%s._bimi.%s TXT %s\n", selector, domain.ASCII+".", mox.TXTStrings(record.String()))
+		}
+	}()
+
 	// MTA-STS
 	wg.Add(1)
 	go func() {
@@ -1639,6 +1691,31 @@ func (Admin) Account(ctx context.Context, account string) (accountConfig config.
 	return ac, diskUsage
 }
 
+// AccountSendUsage returns the numbers of messages and recipients submitted by an
+// account in the past hour, day and month, for its send limits.
+func (Admin) AccountSendUsage(ctx context.Context, account string) queue.SendUsageCounts {
+	if _, ok := mox.Conf.Account(account); !ok {
+		xcheckuserf(ctx, errors.New("no such account"), "looking up account")
+	}
+	c, err := queue.SendUsageAccount(ctx, account)
+	xcheckf(ctx, err, "get send usage")
+	return c
+}
+
+// DomainSendUsage returns the numbers of messages and recipients submitted by all
+// accounts with a message From address in domain in the past hour, day and month,
+// for the send limits of the domain.
+func (Admin) DomainSendUsage(ctx context.Context, domain string) queue.SendUsageCounts {
+	d, err := dns.ParseDomain(domain)
+	xcheckuserf(ctx, err, "parse domain")
+	if _, ok := mox.Conf.Domain(d); !ok {
+		xcheckuserf(ctx, errors.New("no such domain"), "looking up domain")
+	}
+	c, err := queue.SendUsageDomain(ctx, d)
+	xcheckf(ctx, err, "get send usage")
+	return c
+}
+
 // ConfigFiles returns the paths and contents of the static and dynamic configuration files.
 func (Admin) ConfigFiles(ctx context.Context) (staticPath, dynamicPath, static, dynamic string) {
 	buf0, err := os.ReadFile(mox.ConfigStaticPath)
@@ -1898,6 +1975,24 @@ func dnsblsStatus(ctx context.Context, log mlog.Log, resolver dns.Resolver) (res
 	return r, using, monitoring
 }
 
+// URIBLStatus returns the health of the URIBLs configured for checking domains
+// of links in incoming messages, checked now. The returned value maps ASCII zone
+// names to "ok", or to an error string.
+func (Admin) URIBLStatus(ctx context.Context) (results map[string]string, using []dns.Domain) {
+	log := mlog.New("webadmin", nil).WithContext(ctx)
+	resolver := dns.StrictResolver{Pkg: "check", Log: log.Logger}
+	using = mox.Conf.Static.Listeners["public"].SMTP.URIBLZones
+	results = map[string]string{}
+	for _, zone := range using {
+		result := "ok"
+		if err := dnsbl.CheckDomainHealth(ctx, log.Logger, resolver, zone); err != nil {
+			result = "error: " + err.Error()
+		}
+		results[zone.ASCII] = result
+	}
+	return results, using
+}
+
 func (Admin) MonitorDNSBLsSave(ctx context.Context, text string) {
 	var zones []dns.Domain
 	publicZones := mox.Conf.Static.Listeners["public"].SMTP.DNSBLZones
@@ -1927,6 +2022,107 @@ func (Admin) MonitorDNSBLsSave(ctx context.Context, text string) {
 	xcheckf(ctx, err, "saving monitoring dnsbl zones")
 }
 
+// RateLimiter has the non-zero counts for IPs and networks in the current
+// windows of a rate limiter. A count at or above its limit means the IP/network
+// is currently limited.
+type RateLimiter struct {
+	Name    string
+	Open    bool // Limiter for open connections, counts cannot be cleared.
+	Entries []ratelimit.Entry
+}
+
+// RateLimits returns the counts of all rate limiters, for connections, requests
+// and failed authentication attempts.
+func (Admin) RateLimits(ctx context.Context) []RateLimiter {
+	now := time.Now()
+	var l []RateLimiter
+	for name, limiter := range mox.Limiters() {
+		l = append(l, RateLimiter{name, mox.IsOpenLimiter(name), limiter.Entries(now)})
+	}
+	slices.SortFunc(l, func(a, b RateLimiter) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return l
+}
+
+// RateLimitClear clears the counts for an IP or network (in CIDR notation),
+// including counts for networks containing the IP. If limiterName is empty, counts
+// are cleared in all rate limiters. Limiters for open connections cannot be
+// cleared, their counts go down when connections close.
+func (Admin) RateLimitClear(ctx context.Context, limiterName, ipnet string) {
+	n, err := mox.ParseIPNet(ipnet)
+	xcheckuserf(ctx, err, "parsing ip or network")
+
+	err = mox.LimiterClear(limiterName, n)
+	xcheckuserf(ctx, err, "clearing rate limiter")
+}
+
+// IPBans returns the bans currently in effect, and the IPs/networks that are
+// never banned.
+func (Admin) IPBans(ctx context.Context) (bans []store.IPBan, allowlist []store.IPAllow) {
+	bans, err := store.IPBanList(ctx)
+	xcheckf(ctx, err, "listing ip bans")
+	allowlist, err = store.IPAllowList(ctx)
+	xcheckf(ctx, err, "listing ip allowlist")
+	return bans, allowlist
+}
+
+// IPBanAdd bans an IP or network (in CIDR notation). Duration is a Go duration,
+// e.g. "24h". If empty, the ban does not expire.
+func (Admin) IPBanAdd(ctx context.Context, ipnet, duration, reason string) {
+	n, err := mox.ParseIPNet(ipnet)
+	xcheckuserf(ctx, err, "parsing ip or network")
+	var d time.Duration
+	if duration != "" {
+		d, err = time.ParseDuration(duration)
+		xcheckuserf(ctx, err, "parsing duration")
+		if d <= 0 {
+			xusererrorf(ctx, "duration must be positive")
+		}
+	}
+	err = store.IPBanAdd(ctx, n, d, reason)
+	xcheckf(ctx, err, "adding ip ban")
+}
+
+// IPBanRemove removes the ban for an IP or network.
+func (Admin) IPBanRemove(ctx context.Context, ipnet string) {
+	n, err := mox.ParseIPNet(ipnet)
+	xcheckuserf(ctx, err, "parsing ip or network")
+	err = store.IPBanRemove(ctx, n)
+	if err == store.ErrIPBanUnknown {
+		xcheckuserf(ctx, err, "removing ip ban")
+	}
+	xcheckf(ctx, err, "removing ip ban")
+}
+
+// IPAllowAdd adds an IP or network to the allowlist for bans.
+func (Admin) IPAllowAdd(ctx context.Context, ipnet, comment string) {
+	n, err := mox.ParseIPNet(ipnet)
+	xcheckuserf(ctx, err, "parsing ip or network")
+	err = store.IPAllowAdd(ctx, n, comment)
+	xcheckf(ctx, err, "adding to ip allowlist")
+}
+
+// IPAllowRemove removes an IP or network from the allowlist for bans.
+func (Admin) IPAllowRemove(ctx context.Context, ipnet string) {
+	n, err := mox.ParseIPNet(ipnet)
+	xcheckuserf(ctx, err, "parsing ip or network")
+	err = store.IPAllowRemove(ctx, n)
+	if err == store.ErrIPBanUnknown {
+		xcheckuserf(ctx, err, "removing from ip allowlist")
+	}
+	xcheckf(ctx, err, "removing from ip allowlist")
+}
+
+// Greylisting returns statistics about greylisting of incoming deliveries, with
+// the most recently seen pending triplets, allowlisted remote IP groups and known
+// domains.
+func (Admin) Greylisting(ctx context.Context) greylist.Stats {
+	st, err := greylist.GetStats(ctx, 100)
+	xcheckf(ctx, err, "get greylisting statistics")
+	return st
+}
+
 // DomainRecords returns lines describing DNS records that should exist for the
 // configured domain.
 func (Admin) DomainRecords(ctx context.Context, domain string) []string {
@@ -2061,6 +2257,53 @@ func (Admin) AccountLoginDisabledSave(ctx context.Context, accountName string, l
 	xcheckf(ctx, err, "removing current sessions")
 }
 
+// AccountSecondFactorRequiredSave saves the RequireSecondFactor field of an
+// account.
+func (Admin) AccountSecondFactorRequiredSave(ctx context.Context, accountName string, required bool) {
+	err := admin.AccountSave(ctx, accountName, func(acc *config.Account) {
+		acc.RequireSecondFactor = required
+	})
+	xcheckf(ctx, err, "saving second factor requirement for account")
+}
+
+// AccountSecondFactors returns the second factors configured for an account.
+func (Admin) AccountSecondFactors(ctx context.Context, accountName string) store.SecondFactorStatus {
+	log := pkglog.WithContext(ctx)
+
+	acc, err := store.OpenAccount(log, accountName, false)
+	if err != nil && errors.Is(err, store.ErrAccountUnknown) {
+		xcheckuserf(ctx, err, "looking up account")
+	}
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	s, err := acc.SecondFactors(ctx)
+	xcheckf(ctx, err, "listing second factors")
+	return s
+}
+
+// AccountSecondFactorsClear removes all second factors and recovery codes of an
+// account, e.g. after the user lost access to them.
+func (Admin) AccountSecondFactorsClear(ctx context.Context, accountName string) {
+	log := pkglog.WithContext(ctx)
+
+	acc, err := store.OpenAccount(log, accountName, false)
+	if err != nil && errors.Is(err, store.ErrAccountUnknown) {
+		xcheckuserf(ctx, err, "looking up account")
+	}
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	err = acc.SecondFactorsClear(ctx, log)
+	xcheckf(ctx, err, "clearing second factors")
+}
+
 // ClientConfigsDomain returns configurations for email clients, IMAP and
 // Submission (SMTP) for the domain.
 func (Admin) ClientConfigsDomain(ctx context.Context, domain string) admin.ClientConfigs {
@@ -2109,6 +2352,15 @@ func (Admin) QueueHoldRuleRemove(ctx context.Context, holdRuleID int64) {
 	xcheckf(ctx, err, "removing queue hold rule")
 }
 
+// QueueDeliveryStats returns the state of destination throttles, statistics
+// about recent deliveries per recipient domain, and the warm-up state of IPs in
+// IP pools.
+func (Admin) QueueDeliveryStats(ctx context.Context) queue.DeliveryStats {
+	stats, err := queue.DeliveryStatsGet()
+	xcheckf(ctx, err, "get delivery stats")
+	return stats
+}
+
 // QueueList returns the messages currently in the outgoing queue.
 func (Admin) QueueList(ctx context.Context, filter queue.Filter, sort queue.Sort) []queue.Msg {
 	l, err := queue.List(ctx, filter, sort)
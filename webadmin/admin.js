@@ -260,14 +260,19 @@ var api;
 		AuthResult["AuthBadChannelBinding"] = "badchanbind";
 		AuthResult["AuthBadProtocol"] = "badprotocol";
 		AuthResult["AuthLoginDisabled"] = "logindisabled";
+		AuthResult["AuthSecondFactorRequired"] = "secondfactor";
 		AuthResult["AuthError"] = "error";
 		AuthResult["AuthAborted"] = "aborted";
 	})(AuthResult = api.AuthResult || (api.AuthResult = {}));
-	api.structTypes = { "Account": true, "Address": true, "AddressAlias": true, "Alias": true, "AliasAddress": true, "AuthResults": true, "AutoconfCheckResult": true, "AutodiscoverCheckResult": true, "AutodiscoverSRV": true, "AutomaticJunkFlags": true, "Canonicalization": true, "CheckResult": true, "ClientConfigs": true, "ClientConfigsEntry": true, "ConfigDomain": true, "DANECheckResult": true, "DKIM": true, "DKIMAuthResult": true, "DKIMCheckResult": true, "DKIMRecord": true, "DMARC": true, "DMARCCheckResult": true, "DMARCRecord": true, "DMARCSummary": true, "DNSSECResult": true, "DateRange": true, "Destination": true, "Directive": true, "Domain": true, "DomainFeedback": true, "Dynamic": true, "Evaluation": true, "EvaluationStat": true, "Extension": true, "FailureDetails": true, "Filter": true, "HoldRule": true, "Hook": true, "HookFilter": true, "HookResult": true, "HookRetired": true, "HookRetiredFilter": true, "HookRetiredSort": true, "HookSort": true, "IPDomain": true, "IPRevCheckResult": true, "Identifiers": true, "IncomingWebhook": true, "JunkFilter": true, "LoginAttempt": true, "MTASTS": true, "MTASTSCheckResult": true, "MTASTSRecord": true, "MX": true, "MXCheckResult": true, "Modifier": true, "Msg": true, "MsgResult": true, "MsgRetired": true, "OutgoingWebhook": true, "Pair": true, "Policy": true, "PolicyEvaluated": true, "PolicyOverrideReason": true, "PolicyPublished": true, "PolicyRecord": true, "Record": true, "Report": true, "ReportMetadata": true, "ReportRecord": true, "Result": true, "ResultPolicy": true, "RetiredFilter": true, "RetiredSort": true, "Reverse": true, "Route": true, "Row": true, "Ruleset": true, "SMTPAuth": true, "SPFAuthResult": true, "SPFCheckResult": true, "SPFRecord": true, "SRV": true, "SRVConfCheckResult": true, "STSMX": true, "Selector": true, "Sort": true, "SubjectPass": true, "Summary": true, "SuppressAddress": true, "TLSCheckResult": true, "TLSPublicKey": true, "TLSRPT": true, "TLSRPTCheckResult": true, "TLSRPTDateRange": true, "TLSRPTRecord": true, "TLSRPTSummary": true, "TLSRPTSuppressAddress": true, "TLSReportRecord": true, "TLSResult": true, "Transport": true, "TransportDirect": true, "TransportFail": true, "TransportSMTP": true, "TransportSocks": true, "URI": true, "WebForward": true, "WebHandler": true, "WebInternal": true, "WebRedirect": true, "WebStatic": true, "WebserverConfig": true };
-	api.stringsTypes = { "Align": true, "AuthResult": true, "CSRFToken": true, "DMARCPolicy": true, "IP": true, "Localpart": true, "Mode": true, "RUA": true };
+	api.structTypes = { "Account": true, "Address": true, "AddressAlias": true, "Alias": true, "AliasAddress": true, "AllowedGroup": true, "AttachmentRule": true, "AuthResults": true, "AutoconfCheckResult": true, "AutodiscoverCheckResult": true, "AutodiscoverSRV": true, "AutomaticJunkFlags": true, "BIMI": true, "BIMICheckResult": true, "Canonicalization": true, "CheckResult": true, "ClientConfigs": true, "ClientConfigsEntry": true, "ConfigDomain": true, "DANECheckResult": true, "DKIM": true, "DKIMAuthResult": true, "DKIMCheckResult": true, "DKIMRecord": true, "DMARC": true, "DMARCCheckResult": true, "DMARCRecord": true, "DMARCSummary": true, "DNSSECResult": true, "DateRange": true, "DeliveryStats": true, "Destination": true, "DestinationStats": true, "Directive": true, "Domain": true, "DomainFeedback": true, "Dynamic": true, "Evaluation": true, "EvaluationStat": true, "Extension": true, "FailureDetails": true, "Filter": true, "GreylistStats": true, "HoldRule": true, "Hook": true, "HookFilter": true, "HookResult": true, "HookRetired": true, "HookRetiredFilter": true, "HookRetiredSort": true, "HookSort": true, "IPAllow": true, "IPBan": true, "IPDomain": true, "IPRevCheckResult": true, "IPWarmupStats": true, "Identifiers": true, "IncomingWebhook": true, "JunkFilter": true, "KnownDomain": true, "LoginAttempt": true, "MTASTS": true, "MTASTSCheckResult": true, "MTASTSRecord": true, "MX": true, "MXCheckResult": true, "Modifier": true, "Msg": true, "MsgResult": true, "MsgRetired": true, "OutgoingWebhook": true, "Pair": true, "Policy": true, "PolicyEvaluated": true, "PolicyOverrideReason": true, "PolicyPublished": true, "PolicyRecord": true, "RateLimitEntry": true, "RateLimiter": true, "Record": true, "Report": true, "ReportMetadata": true, "ReportRecord": true, "Result": true, "ResultPolicy": true, "RetiredFilter": true, "RetiredSort": true, "Reverse": true, "Route": true, "Row": true, "Ruleset": true, "SMTPAuth": true, "SPFAuthResult": true, "SPFCheckResult": true, "SPFRecord": true, "SRV": true, "SRVConfCheckResult": true, "STSMX": true, "SecondFactorChallenge": true, "SecondFactorResponse": true, "SecondFactorStatus": true, "Selector": true, "SendCounts": true, "SendLimitCounts": true, "SendLimits": true, "SendUsageCounts": true, "Sort": true, "SubjectPass": true, "Summary": true, "SuppressAddress": true, "TLSCheckResult": true, "TLSPublicKey": true, "TLSRPT": true, "TLSRPTCheckResult": true, "TLSRPTDateRange": true, "TLSRPTRecord": true, "TLSRPTSummary": true, "TLSRPTSuppressAddress": true, "TLSReportRecord": true, "TLSResult": true, "ThrottleStats": true, "Transport": true, "TransportDirect": true, "TransportFail": true, "TransportSMTP": true, "TransportSocks": true, "Triplet": true, "URI": true, "WebAuthnAssertion": true, "WebAuthnCredential": true, "WebAuthnRequest": true, "WebForward": true, "WebHandler": true, "WebInternal": true, "WebRedirect": true, "WebStatic": true, "WebserverConfig": true };
+	api.stringsTypes = { "Align": true, "AuthResult": true, "CSRFToken": true, "DMARCPolicy": true, "IP": true, "Localpart": true, "Mode": true, "PSD": true, "RUA": true };
 	api.intsTypes = {};
 	api.types = {
-		"CheckResult": { "Name": "CheckResult", "Docs": "", "Fields": [{ "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "DNSSEC", "Docs": "", "Typewords": ["DNSSECResult"] }, { "Name": "IPRev", "Docs": "", "Typewords": ["IPRevCheckResult"] }, { "Name": "MX", "Docs": "", "Typewords": ["MXCheckResult"] }, { "Name": "TLS", "Docs": "", "Typewords": ["TLSCheckResult"] }, { "Name": "DANE", "Docs": "", "Typewords": ["DANECheckResult"] }, { "Name": "SPF", "Docs": "", "Typewords": ["SPFCheckResult"] }, { "Name": "DKIM", "Docs": "", "Typewords": ["DKIMCheckResult"] }, { "Name": "DMARC", "Docs": "", "Typewords": ["DMARCCheckResult"] }, { "Name": "HostTLSRPT", "Docs": "", "Typewords": ["TLSRPTCheckResult"] }, { "Name": "DomainTLSRPT", "Docs": "", "Typewords": ["TLSRPTCheckResult"] }, { "Name": "MTASTS", "Docs": "", "Typewords": ["MTASTSCheckResult"] }, { "Name": "SRVConf", "Docs": "", "Typewords": ["SRVConfCheckResult"] }, { "Name": "Autoconf", "Docs": "", "Typewords": ["AutoconfCheckResult"] }, { "Name": "Autodiscover", "Docs": "", "Typewords": ["AutodiscoverCheckResult"] }] },
+		"SecondFactorChallenge": { "Name": "SecondFactorChallenge", "Docs": "", "Fields": [{ "Name": "Token", "Docs": "", "Typewords": ["string"] }, { "Name": "TOTP", "Docs": "", "Typewords": ["bool"] }, { "Name": "RecoveryCodes", "Docs": "", "Typewords": ["bool"] }, { "Name": "WebAuthn", "Docs": "", "Typewords": ["nullable", "WebAuthnRequest"] }] },
+		"WebAuthnRequest": { "Name": "WebAuthnRequest", "Docs": "", "Fields": [{ "Name": "Challenge", "Docs": "", "Typewords": ["string"] }, { "Name": "RPID", "Docs": "", "Typewords": ["string"] }, { "Name": "CredentialIDs", "Docs": "", "Typewords": ["[]", "string"] }] },
+		"SecondFactorResponse": { "Name": "SecondFactorResponse", "Docs": "", "Fields": [{ "Name": "Code", "Docs": "", "Typewords": ["string"] }, { "Name": "WebAuthn", "Docs": "", "Typewords": ["nullable", "WebAuthnAssertion"] }] },
+		"WebAuthnAssertion": { "Name": "WebAuthnAssertion", "Docs": "", "Fields": [{ "Name": "CredentialID", "Docs": "", "Typewords": ["string"] }, { "Name": "ClientDataJSON", "Docs": "", "Typewords": ["string"] }, { "Name": "AuthenticatorData", "Docs": "", "Typewords": ["string"] }, { "Name": "Signature", "Docs": "", "Typewords": ["string"] }] },
+		"CheckResult": { "Name": "CheckResult", "Docs": "", "Fields": [{ "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "DNSSEC", "Docs": "", "Typewords": ["DNSSECResult"] }, { "Name": "IPRev", "Docs": "", "Typewords": ["IPRevCheckResult"] }, { "Name": "MX", "Docs": "", "Typewords": ["MXCheckResult"] }, { "Name": "TLS", "Docs": "", "Typewords": ["TLSCheckResult"] }, { "Name": "DANE", "Docs": "", "Typewords": ["DANECheckResult"] }, { "Name": "SPF", "Docs": "", "Typewords": ["SPFCheckResult"] }, { "Name": "DKIM", "Docs": "", "Typewords": ["DKIMCheckResult"] }, { "Name": "DMARC", "Docs": "", "Typewords": ["DMARCCheckResult"] }, { "Name": "HostTLSRPT", "Docs": "", "Typewords": ["TLSRPTCheckResult"] }, { "Name": "DomainTLSRPT", "Docs": "", "Typewords": ["TLSRPTCheckResult"] }, { "Name": "MTASTS", "Docs": "", "Typewords": ["MTASTSCheckResult"] }, { "Name": "BIMI", "Docs": "", "Typewords": ["BIMICheckResult"] }, { "Name": "SRVConf", "Docs": "", "Typewords": ["SRVConfCheckResult"] }, { "Name": "Autoconf", "Docs": "", "Typewords": ["AutoconfCheckResult"] }, { "Name": "Autodiscover", "Docs": "", "Typewords": ["AutodiscoverCheckResult"] }] },
 		"DNSSECResult": { "Name": "DNSSECResult", "Docs": "", "Fields": [{ "Name": "Errors", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Warnings", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Instructions", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"IPRevCheckResult": { "Name": "IPRevCheckResult", "Docs": "", "Fields": [{ "Name": "Hostname", "Docs": "", "Typewords": ["Domain"] }, { "Name": "IPNames", "Docs": "", "Typewords": ["{}", "[]", "string"] }, { "Name": "Errors", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Warnings", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Instructions", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"Domain": { "Name": "Domain", "Docs": "", "Fields": [{ "Name": "ASCII", "Docs": "", "Typewords": ["string"] }, { "Name": "Unicode", "Docs": "", "Typewords": ["string"] }] },
@@ -283,7 +288,7 @@ var api;
 		"DKIMRecord": { "Name": "DKIMRecord", "Docs": "", "Fields": [{ "Name": "Selector", "Docs": "", "Typewords": ["string"] }, { "Name": "TXT", "Docs": "", "Typewords": ["string"] }, { "Name": "Record", "Docs": "", "Typewords": ["nullable", "Record"] }] },
 		"Record": { "Name": "Record", "Docs": "", "Fields": [{ "Name": "Version", "Docs": "", "Typewords": ["string"] }, { "Name": "Hashes", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Key", "Docs": "", "Typewords": ["string"] }, { "Name": "Notes", "Docs": "", "Typewords": ["string"] }, { "Name": "Pubkey", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "Services", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Flags", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"DMARCCheckResult": { "Name": "DMARCCheckResult", "Docs": "", "Fields": [{ "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "TXT", "Docs": "", "Typewords": ["string"] }, { "Name": "Record", "Docs": "", "Typewords": ["nullable", "DMARCRecord"] }, { "Name": "Errors", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Warnings", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Instructions", "Docs": "", "Typewords": ["[]", "string"] }] },
-		"DMARCRecord": { "Name": "DMARCRecord", "Docs": "", "Fields": [{ "Name": "Version", "Docs": "", "Typewords": ["string"] }, { "Name": "Policy", "Docs": "", "Typewords": ["DMARCPolicy"] }, { "Name": "SubdomainPolicy", "Docs": "", "Typewords": ["DMARCPolicy"] }, { "Name": "AggregateReportAddresses", "Docs": "", "Typewords": ["[]", "URI"] }, { "Name": "FailureReportAddresses", "Docs": "", "Typewords": ["[]", "URI"] }, { "Name": "ADKIM", "Docs": "", "Typewords": ["Align"] }, { "Name": "ASPF", "Docs": "", "Typewords": ["Align"] }, { "Name": "AggregateReportingInterval", "Docs": "", "Typewords": ["int32"] }, { "Name": "FailureReportingOptions", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ReportingFormat", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Percentage", "Docs": "", "Typewords": ["int32"] }] },
+		"DMARCRecord": { "Name": "DMARCRecord", "Docs": "", "Fields": [{ "Name": "Version", "Docs": "", "Typewords": ["string"] }, { "Name": "Policy", "Docs": "", "Typewords": ["DMARCPolicy"] }, { "Name": "SubdomainPolicy", "Docs": "", "Typewords": ["DMARCPolicy"] }, { "Name": "AggregateReportAddresses", "Docs": "", "Typewords": ["[]", "URI"] }, { "Name": "FailureReportAddresses", "Docs": "", "Typewords": ["[]", "URI"] }, { "Name": "ADKIM", "Docs": "", "Typewords": ["Align"] }, { "Name": "ASPF", "Docs": "", "Typewords": ["Align"] }, { "Name": "AggregateReportingInterval", "Docs": "", "Typewords": ["int32"] }, { "Name": "FailureReportingOptions", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ReportingFormat", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Percentage", "Docs": "", "Typewords": ["int32"] }, { "Name": "NonexistentSubdomainPolicy", "Docs": "", "Typewords": ["DMARCPolicy"] }, { "Name": "PublicSuffixDomain", "Docs": "", "Typewords": ["PSD"] }, { "Name": "Testing", "Docs": "", "Typewords": ["bool"] }] },
 		"URI": { "Name": "URI", "Docs": "", "Fields": [{ "Name": "Address", "Docs": "", "Typewords": ["string"] }, { "Name": "MaxSize", "Docs": "", "Typewords": ["uint64"] }, { "Name": "Unit", "Docs": "", "Typewords": ["string"] }] },
 		"TLSRPTCheckResult": { "Name": "TLSRPTCheckResult", "Docs": "", "Fields": [{ "Name": "TXT", "Docs": "", "Typewords": ["string"] }, { "Name": "Record", "Docs": "", "Typewords": ["nullable", "TLSRPTRecord"] }, { "Name": "Errors", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Warnings", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Instructions", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"TLSRPTRecord": { "Name": "TLSRPTRecord", "Docs": "", "Fields": [{ "Name": "Version", "Docs": "", "Typewords": ["string"] }, { "Name": "RUAs", "Docs": "", "Typewords": ["[]", "[]", "RUA"] }, { "Name": "Extensions", "Docs": "", "Typewords": ["[]", "Extension"] }] },
@@ -293,31 +298,38 @@ var api;
 		"Pair": { "Name": "Pair", "Docs": "", "Fields": [{ "Name": "Key", "Docs": "", "Typewords": ["string"] }, { "Name": "Value", "Docs": "", "Typewords": ["string"] }] },
 		"Policy": { "Name": "Policy", "Docs": "", "Fields": [{ "Name": "Version", "Docs": "", "Typewords": ["string"] }, { "Name": "Mode", "Docs": "", "Typewords": ["Mode"] }, { "Name": "MX", "Docs": "", "Typewords": ["[]", "STSMX"] }, { "Name": "MaxAgeSeconds", "Docs": "", "Typewords": ["int32"] }, { "Name": "Extensions", "Docs": "", "Typewords": ["[]", "Pair"] }] },
 		"STSMX": { "Name": "STSMX", "Docs": "", "Fields": [{ "Name": "Wildcard", "Docs": "", "Typewords": ["bool"] }, { "Name": "Domain", "Docs": "", "Typewords": ["Domain"] }] },
+		"BIMICheckResult": { "Name": "BIMICheckResult", "Docs": "", "Fields": [{ "Name": "TXT", "Docs": "", "Typewords": ["string"] }, { "Name": "Errors", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Warnings", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Instructions", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"SRVConfCheckResult": { "Name": "SRVConfCheckResult", "Docs": "", "Fields": [{ "Name": "SRVs", "Docs": "", "Typewords": ["{}", "[]", "SRV"] }, { "Name": "Errors", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Warnings", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Instructions", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"SRV": { "Name": "SRV", "Docs": "", "Fields": [{ "Name": "Target", "Docs": "", "Typewords": ["string"] }, { "Name": "Port", "Docs": "", "Typewords": ["uint16"] }, { "Name": "Priority", "Docs": "", "Typewords": ["uint16"] }, { "Name": "Weight", "Docs": "", "Typewords": ["uint16"] }] },
 		"AutoconfCheckResult": { "Name": "AutoconfCheckResult", "Docs": "", "Fields": [{ "Name": "ClientSettingsDomainIPs", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "IPs", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Errors", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Warnings", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Instructions", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"AutodiscoverCheckResult": { "Name": "AutodiscoverCheckResult", "Docs": "", "Fields": [{ "Name": "Records", "Docs": "", "Typewords": ["[]", "AutodiscoverSRV"] }, { "Name": "Errors", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Warnings", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Instructions", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"AutodiscoverSRV": { "Name": "AutodiscoverSRV", "Docs": "", "Fields": [{ "Name": "Target", "Docs": "", "Typewords": ["string"] }, { "Name": "Port", "Docs": "", "Typewords": ["uint16"] }, { "Name": "Priority", "Docs": "", "Typewords": ["uint16"] }, { "Name": "Weight", "Docs": "", "Typewords": ["uint16"] }, { "Name": "IPs", "Docs": "", "Typewords": ["[]", "string"] }] },
-		"ConfigDomain": { "Name": "ConfigDomain", "Docs": "", "Fields": [{ "Name": "Disabled", "Docs": "", "Typewords": ["bool"] }, { "Name": "Description", "Docs": "", "Typewords": ["string"] }, { "Name": "ClientSettingsDomain", "Docs": "", "Typewords": ["string"] }, { "Name": "LocalpartCatchallSeparator", "Docs": "", "Typewords": ["string"] }, { "Name": "LocalpartCatchallSeparators", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "LocalpartCaseSensitive", "Docs": "", "Typewords": ["bool"] }, { "Name": "DKIM", "Docs": "", "Typewords": ["DKIM"] }, { "Name": "DMARC", "Docs": "", "Typewords": ["nullable", "DMARC"] }, { "Name": "MTASTS", "Docs": "", "Typewords": ["nullable", "MTASTS"] }, { "Name": "TLSRPT", "Docs": "", "Typewords": ["nullable", "TLSRPT"] }, { "Name": "Routes", "Docs": "", "Typewords": ["[]", "Route"] }, { "Name": "Aliases", "Docs": "", "Typewords": ["{}", "Alias"] }, { "Name": "Domain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "LocalpartCatchallSeparatorsEffective", "Docs": "", "Typewords": ["[]", "string"] }] },
+		"ConfigDomain": { "Name": "ConfigDomain", "Docs": "", "Fields": [{ "Name": "Disabled", "Docs": "", "Typewords": ["bool"] }, { "Name": "Description", "Docs": "", "Typewords": ["string"] }, { "Name": "ClientSettingsDomain", "Docs": "", "Typewords": ["string"] }, { "Name": "LocalpartCatchallSeparator", "Docs": "", "Typewords": ["string"] }, { "Name": "LocalpartCatchallSeparators", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "LocalpartCaseSensitive", "Docs": "", "Typewords": ["bool"] }, { "Name": "DKIM", "Docs": "", "Typewords": ["DKIM"] }, { "Name": "DMARC", "Docs": "", "Typewords": ["nullable", "DMARC"] }, { "Name": "MTASTS", "Docs": "", "Typewords": ["nullable", "MTASTS"] }, { "Name": "TLSRPT", "Docs": "", "Typewords": ["nullable", "TLSRPT"] }, { "Name": "BIMI", "Docs": "", "Typewords": ["nullable", "BIMI"] }, { "Name": "Routes", "Docs": "", "Typewords": ["[]", "Route"] }, { "Name": "SendLimits", "Docs": "", "Typewords": ["nullable", "SendLimits"] }, { "Name": "Aliases", "Docs": "", "Typewords": ["{}", "Alias"] }, { "Name": "AttachmentRules", "Docs": "", "Typewords": ["[]", "AttachmentRule"] }, { "Name": "Domain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "LocalpartCatchallSeparatorsEffective", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"DKIM": { "Name": "DKIM", "Docs": "", "Fields": [{ "Name": "Selectors", "Docs": "", "Typewords": ["{}", "Selector"] }, { "Name": "Sign", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"Selector": { "Name": "Selector", "Docs": "", "Fields": [{ "Name": "Hash", "Docs": "", "Typewords": ["string"] }, { "Name": "HashEffective", "Docs": "", "Typewords": ["string"] }, { "Name": "Canonicalization", "Docs": "", "Typewords": ["Canonicalization"] }, { "Name": "Headers", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "HeadersEffective", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "DontSealHeaders", "Docs": "", "Typewords": ["bool"] }, { "Name": "Expiration", "Docs": "", "Typewords": ["string"] }, { "Name": "PrivateKeyFile", "Docs": "", "Typewords": ["string"] }, { "Name": "Algorithm", "Docs": "", "Typewords": ["string"] }] },
 		"Canonicalization": { "Name": "Canonicalization", "Docs": "", "Fields": [{ "Name": "HeaderRelaxed", "Docs": "", "Typewords": ["bool"] }, { "Name": "BodyRelaxed", "Docs": "", "Typewords": ["bool"] }] },
 		"DMARC": { "Name": "DMARC", "Docs": "", "Fields": [{ "Name": "Localpart", "Docs": "", "Typewords": ["string"] }, { "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "Mailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "ParsedLocalpart", "Docs": "", "Typewords": ["Localpart"] }, { "Name": "DNSDomain", "Docs": "", "Typewords": ["Domain"] }] },
 		"MTASTS": { "Name": "MTASTS", "Docs": "", "Fields": [{ "Name": "PolicyID", "Docs": "", "Typewords": ["string"] }, { "Name": "Mode", "Docs": "", "Typewords": ["Mode"] }, { "Name": "MaxAge", "Docs": "", "Typewords": ["int64"] }, { "Name": "MX", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"TLSRPT": { "Name": "TLSRPT", "Docs": "", "Fields": [{ "Name": "Localpart", "Docs": "", "Typewords": ["string"] }, { "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "Mailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "ParsedLocalpart", "Docs": "", "Typewords": ["Localpart"] }, { "Name": "DNSDomain", "Docs": "", "Typewords": ["Domain"] }] },
+		"BIMI": { "Name": "BIMI", "Docs": "", "Fields": [{ "Name": "Selector", "Docs": "", "Typewords": ["string"] }, { "Name": "LogoURL", "Docs": "", "Typewords": ["string"] }, { "Name": "AuthorityURL", "Docs": "", "Typewords": ["string"] }] },
 		"Route": { "Name": "Route", "Docs": "", "Fields": [{ "Name": "FromDomain", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ToDomain", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "MinimumAttempts", "Docs": "", "Typewords": ["int32"] }, { "Name": "Transport", "Docs": "", "Typewords": ["string"] }, { "Name": "FromDomainASCII", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ToDomainASCII", "Docs": "", "Typewords": ["[]", "string"] }] },
+		"SendLimits": { "Name": "SendLimits", "Docs": "", "Fields": [{ "Name": "All", "Docs": "", "Typewords": ["SendLimitCounts"] }, { "Name": "Submission", "Docs": "", "Typewords": ["SendLimitCounts"] }, { "Name": "WebAPI", "Docs": "", "Typewords": ["SendLimitCounts"] }, { "Name": "Policy", "Docs": "", "Typewords": ["string"] }] },
+		"SendLimitCounts": { "Name": "SendLimitCounts", "Docs": "", "Fields": [{ "Name": "MessagesPerHour", "Docs": "", "Typewords": ["int32"] }, { "Name": "MessagesPerDay", "Docs": "", "Typewords": ["int32"] }, { "Name": "MessagesPerMonth", "Docs": "", "Typewords": ["int32"] }, { "Name": "RecipientsPerHour", "Docs": "", "Typewords": ["int32"] }, { "Name": "RecipientsPerDay", "Docs": "", "Typewords": ["int32"] }, { "Name": "RecipientsPerMonth", "Docs": "", "Typewords": ["int32"] }] },
 		"Alias": { "Name": "Alias", "Docs": "", "Fields": [{ "Name": "Addresses", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "PostPublic", "Docs": "", "Typewords": ["bool"] }, { "Name": "ListMembers", "Docs": "", "Typewords": ["bool"] }, { "Name": "AllowMsgFrom", "Docs": "", "Typewords": ["bool"] }, { "Name": "LocalpartStr", "Docs": "", "Typewords": ["string"] }, { "Name": "Domain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "ParsedAddresses", "Docs": "", "Typewords": ["[]", "AliasAddress"] }] },
 		"AliasAddress": { "Name": "AliasAddress", "Docs": "", "Fields": [{ "Name": "Address", "Docs": "", "Typewords": ["Address"] }, { "Name": "AccountName", "Docs": "", "Typewords": ["string"] }, { "Name": "Destination", "Docs": "", "Typewords": ["Destination"] }] },
 		"Address": { "Name": "Address", "Docs": "", "Fields": [{ "Name": "Localpart", "Docs": "", "Typewords": ["Localpart"] }, { "Name": "Domain", "Docs": "", "Typewords": ["Domain"] }] },
 		"Destination": { "Name": "Destination", "Docs": "", "Fields": [{ "Name": "Mailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "Rulesets", "Docs": "", "Typewords": ["[]", "Ruleset"] }, { "Name": "SMTPError", "Docs": "", "Typewords": ["string"] }, { "Name": "MessageAuthRequiredSMTPError", "Docs": "", "Typewords": ["string"] }, { "Name": "FullName", "Docs": "", "Typewords": ["string"] }] },
 		"Ruleset": { "Name": "Ruleset", "Docs": "", "Fields": [{ "Name": "SMTPMailFromRegexp", "Docs": "", "Typewords": ["string"] }, { "Name": "MsgFromRegexp", "Docs": "", "Typewords": ["string"] }, { "Name": "VerifiedDomain", "Docs": "", "Typewords": ["string"] }, { "Name": "HeadersRegexp", "Docs": "", "Typewords": ["{}", "string"] }, { "Name": "IsForward", "Docs": "", "Typewords": ["bool"] }, { "Name": "ListAllowDomain", "Docs": "", "Typewords": ["string"] }, { "Name": "AcceptRejectsToMailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "Mailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "Comment", "Docs": "", "Typewords": ["string"] }, { "Name": "VerifiedDNSDomain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "ListAllowDNSDomain", "Docs": "", "Typewords": ["Domain"] }] },
-		"Account": { "Name": "Account", "Docs": "", "Fields": [{ "Name": "OutgoingWebhook", "Docs": "", "Typewords": ["nullable", "OutgoingWebhook"] }, { "Name": "IncomingWebhook", "Docs": "", "Typewords": ["nullable", "IncomingWebhook"] }, { "Name": "FromIDLoginAddresses", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "KeepRetiredMessagePeriod", "Docs": "", "Typewords": ["int64"] }, { "Name": "KeepRetiredWebhookPeriod", "Docs": "", "Typewords": ["int64"] }, { "Name": "LoginDisabled", "Docs": "", "Typewords": ["string"] }, { "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "Description", "Docs": "", "Typewords": ["string"] }, { "Name": "FullName", "Docs": "", "Typewords": ["string"] }, { "Name": "Destinations", "Docs": "", "Typewords": ["{}", "Destination"] }, { "Name": "SubjectPass", "Docs": "", "Typewords": ["SubjectPass"] }, { "Name": "QuotaMessageSize", "Docs": "", "Typewords": ["int64"] }, { "Name": "RejectsMailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "KeepRejects", "Docs": "", "Typewords": ["bool"] }, { "Name": "AutomaticJunkFlags", "Docs": "", "Typewords": ["AutomaticJunkFlags"] }, { "Name": "JunkFilter", "Docs": "", "Typewords": ["nullable", "JunkFilter"] }, { "Name": "MaxOutgoingMessagesPerDay", "Docs": "", "Typewords": ["int32"] }, { "Name": "MaxFirstTimeRecipientsPerDay", "Docs": "", "Typewords": ["int32"] }, { "Name": "NoFirstTimeSenderDelay", "Docs": "", "Typewords": ["bool"] }, { "Name": "NoCustomPassword", "Docs": "", "Typewords": ["bool"] }, { "Name": "IMAPCapabilitiesDisabled", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Routes", "Docs": "", "Typewords": ["[]", "Route"] }, { "Name": "DNSDomain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "Aliases", "Docs": "", "Typewords": ["[]", "AddressAlias"] }] },
-		"OutgoingWebhook": { "Name": "OutgoingWebhook", "Docs": "", "Fields": [{ "Name": "URL", "Docs": "", "Typewords": ["string"] }, { "Name": "Authorization", "Docs": "", "Typewords": ["string"] }, { "Name": "Events", "Docs": "", "Typewords": ["[]", "string"] }] },
-		"IncomingWebhook": { "Name": "IncomingWebhook", "Docs": "", "Fields": [{ "Name": "URL", "Docs": "", "Typewords": ["string"] }, { "Name": "Authorization", "Docs": "", "Typewords": ["string"] }] },
+		"AttachmentRule": { "Name": "AttachmentRule", "Docs": "", "Fields": [{ "Name": "Direction", "Docs": "", "Typewords": ["string"] }, { "Name": "ContentTypes", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Extensions", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "EncryptedArchive", "Docs": "", "Typewords": ["bool"] }, { "Name": "UninspectableArchive", "Docs": "", "Typewords": ["bool"] }, { "Name": "MinSize", "Docs": "", "Typewords": ["int64"] }, { "Name": "Action", "Docs": "", "Typewords": ["string"] }] },
+		"Account": { "Name": "Account", "Docs": "", "Fields": [{ "Name": "OutgoingWebhook", "Docs": "", "Typewords": ["nullable", "OutgoingWebhook"] }, { "Name": "IncomingWebhook", "Docs": "", "Typewords": ["nullable", "IncomingWebhook"] }, { "Name": "FromIDLoginAddresses", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "KeepRetiredMessagePeriod", "Docs": "", "Typewords": ["int64"] }, { "Name": "KeepRetiredWebhookPeriod", "Docs": "", "Typewords": ["int64"] }, { "Name": "LoginDisabled", "Docs": "", "Typewords": ["string"] }, { "Name": "RequireSecondFactor", "Docs": "", "Typewords": ["bool"] }, { "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "Description", "Docs": "", "Typewords": ["string"] }, { "Name": "FullName", "Docs": "", "Typewords": ["string"] }, { "Name": "Destinations", "Docs": "", "Typewords": ["{}", "Destination"] }, { "Name": "SubjectPass", "Docs": "", "Typewords": ["SubjectPass"] }, { "Name": "QuotaMessageSize", "Docs": "", "Typewords": ["int64"] }, { "Name": "RejectsMailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "KeepRejects", "Docs": "", "Typewords": ["bool"] }, { "Name": "AutomaticJunkFlags", "Docs": "", "Typewords": ["AutomaticJunkFlags"] }, { "Name": "JunkFilter", "Docs": "", "Typewords": ["nullable", "JunkFilter"] }, { "Name": "MaxOutgoingMessagesPerDay", "Docs": "", "Typewords": ["int32"] }, { "Name": "MaxFirstTimeRecipientsPerDay", "Docs": "", "Typewords": ["int32"] }, { "Name": "SendLimits", "Docs": "", "Typewords": ["nullable", "SendLimits"] }, { "Name": "NoFirstTimeSenderDelay", "Docs": "", "Typewords": ["bool"] }, { "Name": "NoCustomPassword", "Docs": "", "Typewords": ["bool"] }, { "Name": "IMAPCapabilitiesDisabled", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "AttachmentRules", "Docs": "", "Typewords": ["[]", "AttachmentRule"] }, { "Name": "Routes", "Docs": "", "Typewords": ["[]", "Route"] }, { "Name": "DNSDomain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "Aliases", "Docs": "", "Typewords": ["[]", "AddressAlias"] }] },
+		"OutgoingWebhook": { "Name": "OutgoingWebhook", "Docs": "", "Fields": [{ "Name": "URL", "Docs": "", "Typewords": ["string"] }, { "Name": "Authorization", "Docs": "", "Typewords": ["string"] }, { "Name": "EventStreamOnly", "Docs": "", "Typewords": ["bool"] }, { "Name": "Events", "Docs": "", "Typewords": ["[]", "string"] }] },
+		"IncomingWebhook": { "Name": "IncomingWebhook", "Docs": "", "Fields": [{ "Name": "URL", "Docs": "", "Typewords": ["string"] }, { "Name": "Authorization", "Docs": "", "Typewords": ["string"] }, { "Name": "EventStreamOnly", "Docs": "", "Typewords": ["bool"] }] },
 		"SubjectPass": { "Name": "SubjectPass", "Docs": "", "Fields": [{ "Name": "Period", "Docs": "", "Typewords": ["int64"] }] },
 		"AutomaticJunkFlags": { "Name": "AutomaticJunkFlags", "Docs": "", "Fields": [{ "Name": "Enabled", "Docs": "", "Typewords": ["bool"] }, { "Name": "JunkMailboxRegexp", "Docs": "", "Typewords": ["string"] }, { "Name": "NeutralMailboxRegexp", "Docs": "", "Typewords": ["string"] }, { "Name": "NotJunkMailboxRegexp", "Docs": "", "Typewords": ["string"] }] },
-		"JunkFilter": { "Name": "JunkFilter", "Docs": "", "Fields": [{ "Name": "Threshold", "Docs": "", "Typewords": ["float64"] }, { "Name": "Onegrams", "Docs": "", "Typewords": ["bool"] }, { "Name": "Twograms", "Docs": "", "Typewords": ["bool"] }, { "Name": "Threegrams", "Docs": "", "Typewords": ["bool"] }, { "Name": "MaxPower", "Docs": "", "Typewords": ["float64"] }, { "Name": "TopWords", "Docs": "", "Typewords": ["int32"] }, { "Name": "IgnoreWords", "Docs": "", "Typewords": ["float64"] }, { "Name": "RareWords", "Docs": "", "Typewords": ["int32"] }] },
+		"JunkFilter": { "Name": "JunkFilter", "Docs": "", "Fields": [{ "Name": "Threshold", "Docs": "", "Typewords": ["float64"] }, { "Name": "Onegrams", "Docs": "", "Typewords": ["bool"] }, { "Name": "Twograms", "Docs": "", "Typewords": ["bool"] }, { "Name": "Threegrams", "Docs": "", "Typewords": ["bool"] }, { "Name": "MaxPower", "Docs": "", "Typewords": ["float64"] }, { "Name": "TopWords", "Docs": "", "Typewords": ["int32"] }, { "Name": "IgnoreWords", "Docs": "", "Typewords": ["float64"] }, { "Name": "RareWords", "Docs": "", "Typewords": ["int32"] }, { "Name": "Features", "Docs": "", "Typewords": ["bool"] }] },
 		"AddressAlias": { "Name": "AddressAlias", "Docs": "", "Fields": [{ "Name": "SubscriptionAddress", "Docs": "", "Typewords": ["string"] }, { "Name": "Alias", "Docs": "", "Typewords": ["Alias"] }, { "Name": "MemberAddresses", "Docs": "", "Typewords": ["[]", "string"] }] },
+		"SendUsageCounts": { "Name": "SendUsageCounts", "Docs": "", "Fields": [{ "Name": "All", "Docs": "", "Typewords": ["SendCounts"] }, { "Name": "Submission", "Docs": "", "Typewords": ["SendCounts"] }, { "Name": "WebAPI", "Docs": "", "Typewords": ["SendCounts"] }] },
+		"SendCounts": { "Name": "SendCounts", "Docs": "", "Fields": [{ "Name": "MessagesHour", "Docs": "", "Typewords": ["int32"] }, { "Name": "MessagesDay", "Docs": "", "Typewords": ["int32"] }, { "Name": "MessagesMonth", "Docs": "", "Typewords": ["int32"] }, { "Name": "RecipientsHour", "Docs": "", "Typewords": ["int32"] }, { "Name": "RecipientsDay", "Docs": "", "Typewords": ["int32"] }, { "Name": "RecipientsMonth", "Docs": "", "Typewords": ["int32"] }] },
 		"PolicyRecord": { "Name": "PolicyRecord", "Docs": "", "Fields": [{ "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "Inserted", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "ValidEnd", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "LastUpdate", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "LastUse", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Backoff", "Docs": "", "Typewords": ["bool"] }, { "Name": "RecordID", "Docs": "", "Typewords": ["string"] }, { "Name": "Version", "Docs": "", "Typewords": ["string"] }, { "Name": "Mode", "Docs": "", "Typewords": ["Mode"] }, { "Name": "MX", "Docs": "", "Typewords": ["[]", "STSMX"] }, { "Name": "MaxAgeSeconds", "Docs": "", "Typewords": ["int32"] }, { "Name": "Extensions", "Docs": "", "Typewords": ["[]", "Pair"] }, { "Name": "PolicyText", "Docs": "", "Typewords": ["string"] }] },
 		"TLSReportRecord": { "Name": "TLSReportRecord", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "FromDomain", "Docs": "", "Typewords": ["string"] }, { "Name": "MailFrom", "Docs": "", "Typewords": ["string"] }, { "Name": "HostReport", "Docs": "", "Typewords": ["bool"] }, { "Name": "Report", "Docs": "", "Typewords": ["Report"] }] },
 		"Report": { "Name": "Report", "Docs": "", "Fields": [{ "Name": "OrganizationName", "Docs": "", "Typewords": ["string"] }, { "Name": "DateRange", "Docs": "", "Typewords": ["TLSRPTDateRange"] }, { "Name": "ContactInfo", "Docs": "", "Typewords": ["string"] }, { "Name": "ReportID", "Docs": "", "Typewords": ["string"] }, { "Name": "Policies", "Docs": "", "Typewords": ["[]", "Result"] }] },
@@ -341,9 +353,23 @@ var api;
 		"SPFAuthResult": { "Name": "SPFAuthResult", "Docs": "", "Fields": [{ "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "Scope", "Docs": "", "Typewords": ["string"] }, { "Name": "Result", "Docs": "", "Typewords": ["string"] }] },
 		"DMARCSummary": { "Name": "DMARCSummary", "Docs": "", "Fields": [{ "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "Total", "Docs": "", "Typewords": ["int32"] }, { "Name": "DispositionNone", "Docs": "", "Typewords": ["int32"] }, { "Name": "DispositionQuarantine", "Docs": "", "Typewords": ["int32"] }, { "Name": "DispositionReject", "Docs": "", "Typewords": ["int32"] }, { "Name": "DKIMFail", "Docs": "", "Typewords": ["int32"] }, { "Name": "SPFFail", "Docs": "", "Typewords": ["int32"] }, { "Name": "PolicyOverrides", "Docs": "", "Typewords": ["{}", "int32"] }] },
 		"Reverse": { "Name": "Reverse", "Docs": "", "Fields": [{ "Name": "Hostnames", "Docs": "", "Typewords": ["[]", "string"] }] },
+		"RateLimiter": { "Name": "RateLimiter", "Docs": "", "Fields": [{ "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "Open", "Docs": "", "Typewords": ["bool"] }, { "Name": "Entries", "Docs": "", "Typewords": ["[]", "RateLimitEntry"] }] },
+		"RateLimitEntry": { "Name": "RateLimitEntry", "Docs": "", "Fields": [{ "Name": "Window", "Docs": "", "Typewords": ["int64"] }, { "Name": "Time", "Docs": "", "Typewords": ["uint32"] }, { "Name": "Index", "Docs": "", "Typewords": ["uint8"] }, { "Name": "Net", "Docs": "", "Typewords": ["string"] }, { "Name": "Count", "Docs": "", "Typewords": ["int64"] }, { "Name": "Limit", "Docs": "", "Typewords": ["int64"] }] },
+		"IPBan": { "Name": "IPBan", "Docs": "", "Fields": [{ "Name": "Net", "Docs": "", "Typewords": ["string"] }, { "Name": "Created", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Expires", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Reason", "Docs": "", "Typewords": ["string"] }, { "Name": "Automatic", "Docs": "", "Typewords": ["bool"] }, { "Name": "Count", "Docs": "", "Typewords": ["int32"] }] },
+		"IPAllow": { "Name": "IPAllow", "Docs": "", "Fields": [{ "Name": "Net", "Docs": "", "Typewords": ["string"] }, { "Name": "Created", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Comment", "Docs": "", "Typewords": ["string"] }] },
+		"GreylistStats": { "Name": "GreylistStats", "Docs": "", "Fields": [{ "Name": "Pending", "Docs": "", "Typewords": ["int32"] }, { "Name": "Passed", "Docs": "", "Typewords": ["int32"] }, { "Name": "AllowedGroups", "Docs": "", "Typewords": ["int32"] }, { "Name": "KnownDomains", "Docs": "", "Typewords": ["int32"] }, { "Name": "RecentPending", "Docs": "", "Typewords": ["[]", "Triplet"] }, { "Name": "RecentAllowed", "Docs": "", "Typewords": ["[]", "AllowedGroup"] }, { "Name": "RecentKnown", "Docs": "", "Typewords": ["[]", "KnownDomain"] }] },
+		"Triplet": { "Name": "Triplet", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Group", "Docs": "", "Typewords": ["string"] }, { "Name": "MailFrom", "Docs": "", "Typewords": ["string"] }, { "Name": "RcptTo", "Docs": "", "Typewords": ["string"] }, { "Name": "FirstSeen", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "LastSeen", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Attempts", "Docs": "", "Typewords": ["int32"] }, { "Name": "Passed", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Expires", "Docs": "", "Typewords": ["timestamp"] }] },
+		"AllowedGroup": { "Name": "AllowedGroup", "Docs": "", "Fields": [{ "Name": "Group", "Docs": "", "Typewords": ["string"] }, { "Name": "Added", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "LastSeen", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Deliveries", "Docs": "", "Typewords": ["int32"] }, { "Name": "Expires", "Docs": "", "Typewords": ["timestamp"] }] },
+		"KnownDomain": { "Name": "KnownDomain", "Docs": "", "Fields": [{ "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "Added", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "LastSeen", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Deliveries", "Docs": "", "Typewords": ["int32"] }, { "Name": "Expires", "Docs": "", "Typewords": ["timestamp"] }] },
+		"SecondFactorStatus": { "Name": "SecondFactorStatus", "Docs": "", "Fields": [{ "Name": "TOTP", "Docs": "", "Typewords": ["bool"] }, { "Name": "WebAuthn", "Docs": "", "Typewords": ["[]", "WebAuthnCredential"] }, { "Name": "RecoveryCodesUnused", "Docs": "", "Typewords": ["int32"] }] },
+		"WebAuthnCredential": { "Name": "WebAuthnCredential", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Created", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "CredentialID", "Docs": "", "Typewords": ["string"] }, { "Name": "LastUsed", "Docs": "", "Typewords": ["nullable", "timestamp"] }] },
 		"ClientConfigs": { "Name": "ClientConfigs", "Docs": "", "Fields": [{ "Name": "Entries", "Docs": "", "Typewords": ["[]", "ClientConfigsEntry"] }] },
 		"ClientConfigsEntry": { "Name": "ClientConfigsEntry", "Docs": "", "Fields": [{ "Name": "Protocol", "Docs": "", "Typewords": ["string"] }, { "Name": "Host", "Docs": "", "Typewords": ["Domain"] }, { "Name": "Port", "Docs": "", "Typewords": ["int32"] }, { "Name": "Listener", "Docs": "", "Typewords": ["string"] }, { "Name": "Note", "Docs": "", "Typewords": ["string"] }] },
 		"HoldRule": { "Name": "HoldRule", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "SenderDomain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "RecipientDomain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "SenderDomainStr", "Docs": "", "Typewords": ["string"] }, { "Name": "RecipientDomainStr", "Docs": "", "Typewords": ["string"] }] },
+		"DeliveryStats": { "Name": "DeliveryStats", "Docs": "", "Fields": [{ "Name": "Throttles", "Docs": "", "Typewords": ["[]", "ThrottleStats"] }, { "Name": "Destinations", "Docs": "", "Typewords": ["[]", "DestinationStats"] }, { "Name": "IPWarmups", "Docs": "", "Typewords": ["[]", "IPWarmupStats"] }] },
+		"ThrottleStats": { "Name": "ThrottleStats", "Docs": "", "Fields": [{ "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "MaxConcurrent", "Docs": "", "Typewords": ["int32"] }, { "Name": "MessagesPerMinute", "Docs": "", "Typewords": ["int32"] }, { "Name": "MessagesPerHour", "Docs": "", "Typewords": ["int32"] }, { "Name": "Active", "Docs": "", "Typewords": ["int32"] }, { "Name": "MessagesMinute", "Docs": "", "Typewords": ["int32"] }, { "Name": "MessagesHour", "Docs": "", "Typewords": ["int32"] }, { "Name": "Delivered", "Docs": "", "Typewords": ["int32"] }, { "Name": "TempErrors", "Docs": "", "Typewords": ["int32"] }, { "Name": "PermErrors", "Docs": "", "Typewords": ["int32"] }, { "Name": "RateLimited", "Docs": "", "Typewords": ["int32"] }, { "Name": "BackoffUntil", "Docs": "", "Typewords": ["timestamp"] }] },
+		"DestinationStats": { "Name": "DestinationStats", "Docs": "", "Fields": [{ "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "Throttle", "Docs": "", "Typewords": ["string"] }, { "Name": "Active", "Docs": "", "Typewords": ["int32"] }, { "Name": "Delivered", "Docs": "", "Typewords": ["int32"] }, { "Name": "TempErrors", "Docs": "", "Typewords": ["int32"] }, { "Name": "PermErrors", "Docs": "", "Typewords": ["int32"] }, { "Name": "RateLimited", "Docs": "", "Typewords": ["int32"] }, { "Name": "LastAttempt", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "BackoffUntil", "Docs": "", "Typewords": ["timestamp"] }] },
+		"IPWarmupStats": { "Name": "IPWarmupStats", "Docs": "", "Fields": [{ "Name": "Pool", "Docs": "", "Typewords": ["string"] }, { "Name": "IP", "Docs": "", "Typewords": ["string"] }, { "Name": "Day", "Docs": "", "Typewords": ["int32"] }, { "Name": "Limit", "Docs": "", "Typewords": ["int32"] }, { "Name": "Messages", "Docs": "", "Typewords": ["int32"] }] },
 		"Filter": { "Name": "Filter", "Docs": "", "Fields": [{ "Name": "Max", "Docs": "", "Typewords": ["int32"] }, { "Name": "IDs", "Docs": "", "Typewords": ["[]", "int64"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "From", "Docs": "", "Typewords": ["string"] }, { "Name": "To", "Docs": "", "Typewords": ["string"] }, { "Name": "Hold", "Docs": "", "Typewords": ["nullable", "bool"] }, { "Name": "Submitted", "Docs": "", "Typewords": ["string"] }, { "Name": "NextAttempt", "Docs": "", "Typewords": ["string"] }, { "Name": "Transport", "Docs": "", "Typewords": ["nullable", "string"] }] },
 		"Sort": { "Name": "Sort", "Docs": "", "Fields": [{ "Name": "Field", "Docs": "", "Typewords": ["string"] }, { "Name": "LastID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Last", "Docs": "", "Typewords": ["any"] }, { "Name": "Asc", "Docs": "", "Typewords": ["bool"] }] },
 		"Msg": { "Name": "Msg", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "BaseID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Queued", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Hold", "Docs": "", "Typewords": ["bool"] }, { "Name": "SenderAccount", "Docs": "", "Typewords": ["string"] }, { "Name": "SenderLocalpart", "Docs": "", "Typewords": ["Localpart"] }, { "Name": "SenderDomain", "Docs": "", "Typewords": ["IPDomain"] }, { "Name": "SenderDomainStr", "Docs": "", "Typewords": ["string"] }, { "Name": "FromID", "Docs": "", "Typewords": ["string"] }, { "Name": "RecipientLocalpart", "Docs": "", "Typewords": ["Localpart"] }, { "Name": "RecipientDomain", "Docs": "", "Typewords": ["IPDomain"] }, { "Name": "RecipientDomainStr", "Docs": "", "Typewords": ["string"] }, { "Name": "Attempts", "Docs": "", "Typewords": ["int32"] }, { "Name": "MaxAttempts", "Docs": "", "Typewords": ["int32"] }, { "Name": "DialedIPs", "Docs": "", "Typewords": ["{}", "[]", "IP"] }, { "Name": "NextAttempt", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "LastAttempt", "Docs": "", "Typewords": ["nullable", "timestamp"] }, { "Name": "Results", "Docs": "", "Typewords": ["[]", "MsgResult"] }, { "Name": "Has8bit", "Docs": "", "Typewords": ["bool"] }, { "Name": "SMTPUTF8", "Docs": "", "Typewords": ["bool"] }, { "Name": "IsDMARCReport", "Docs": "", "Typewords": ["bool"] }, { "Name": "IsTLSReport", "Docs": "", "Typewords": ["bool"] }, { "Name": "Size", "Docs": "", "Typewords": ["int64"] }, { "Name": "MessageID", "Docs": "", "Typewords": ["string"] }, { "Name": "MsgPrefix", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "Subject", "Docs": "", "Typewords": ["string"] }, { "Name": "DSNUTF8", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "Transport", "Docs": "", "Typewords": ["string"] }, { "Name": "RequireTLS", "Docs": "", "Typewords": ["nullable", "bool"] }, { "Name": "FutureReleaseRequest", "Docs": "", "Typewords": ["string"] }, { "Name": "Extra", "Docs": "", "Typewords": ["{}", "string"] }] },
@@ -369,7 +395,7 @@ var api;
 		"TransportSMTP": { "Name": "TransportSMTP", "Docs": "", "Fields": [{ "Name": "Host", "Docs": "", "Typewords": ["string"] }, { "Name": "Port", "Docs": "", "Typewords": ["int32"] }, { "Name": "STARTTLSInsecureSkipVerify", "Docs": "", "Typewords": ["bool"] }, { "Name": "NoSTARTTLS", "Docs": "", "Typewords": ["bool"] }, { "Name": "Auth", "Docs": "", "Typewords": ["nullable", "SMTPAuth"] }] },
 		"SMTPAuth": { "Name": "SMTPAuth", "Docs": "", "Fields": [{ "Name": "Username", "Docs": "", "Typewords": ["string"] }, { "Name": "Password", "Docs": "", "Typewords": ["string"] }, { "Name": "Mechanisms", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"TransportSocks": { "Name": "TransportSocks", "Docs": "", "Fields": [{ "Name": "Address", "Docs": "", "Typewords": ["string"] }, { "Name": "RemoteIPs", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "RemoteHostname", "Docs": "", "Typewords": ["string"] }] },
-		"TransportDirect": { "Name": "TransportDirect", "Docs": "", "Fields": [{ "Name": "DisableIPv4", "Docs": "", "Typewords": ["bool"] }, { "Name": "DisableIPv6", "Docs": "", "Typewords": ["bool"] }] },
+		"TransportDirect": { "Name": "TransportDirect", "Docs": "", "Fields": [{ "Name": "DisableIPv4", "Docs": "", "Typewords": ["bool"] }, { "Name": "DisableIPv6", "Docs": "", "Typewords": ["bool"] }, { "Name": "IPPool", "Docs": "", "Typewords": ["string"] }] },
 		"TransportFail": { "Name": "TransportFail", "Docs": "", "Fields": [{ "Name": "SMTPCode", "Docs": "", "Typewords": ["int32"] }, { "Name": "SMTPMessage", "Docs": "", "Typewords": ["string"] }, { "Name": "Code", "Docs": "", "Typewords": ["int32"] }, { "Name": "Message", "Docs": "", "Typewords": ["string"] }] },
 		"EvaluationStat": { "Name": "EvaluationStat", "Docs": "", "Fields": [{ "Name": "Domain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "Dispositions", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Count", "Docs": "", "Typewords": ["int32"] }, { "Name": "SendReport", "Docs": "", "Typewords": ["bool"] }] },
 		"Evaluation": { "Name": "Evaluation", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "PolicyDomain", "Docs": "", "Typewords": ["string"] }, { "Name": "Evaluated", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Optional", "Docs": "", "Typewords": ["bool"] }, { "Name": "IntervalHours", "Docs": "", "Typewords": ["int32"] }, { "Name": "Addresses", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "PolicyPublished", "Docs": "", "Typewords": ["PolicyPublished"] }, { "Name": "SourceIP", "Docs": "", "Typewords": ["string"] }, { "Name": "Disposition", "Docs": "", "Typewords": ["string"] }, { "Name": "AlignedDKIMPass", "Docs": "", "Typewords": ["bool"] }, { "Name": "AlignedSPFPass", "Docs": "", "Typewords": ["bool"] }, { "Name": "OverrideReasons", "Docs": "", "Typewords": ["[]", "PolicyOverrideReason"] }, { "Name": "EnvelopeTo", "Docs": "", "Typewords": ["string"] }, { "Name": "EnvelopeFrom", "Docs": "", "Typewords": ["string"] }, { "Name": "HeaderFrom", "Docs": "", "Typewords": ["string"] }, { "Name": "DKIMResults", "Docs": "", "Typewords": ["[]", "DKIMAuthResult"] }, { "Name": "SPFResults", "Docs": "", "Typewords": ["[]", "SPFAuthResult"] }] },
@@ -378,17 +404,22 @@ var api;
 		"TLSRPTSuppressAddress": { "Name": "TLSRPTSuppressAddress", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Inserted", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "ReportingAddress", "Docs": "", "Typewords": ["string"] }, { "Name": "Until", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Comment", "Docs": "", "Typewords": ["string"] }] },
 		"Dynamic": { "Name": "Dynamic", "Docs": "", "Fields": [{ "Name": "Domains", "Docs": "", "Typewords": ["{}", "ConfigDomain"] }, { "Name": "Accounts", "Docs": "", "Typewords": ["{}", "Account"] }, { "Name": "WebDomainRedirects", "Docs": "", "Typewords": ["{}", "string"] }, { "Name": "WebHandlers", "Docs": "", "Typewords": ["[]", "WebHandler"] }, { "Name": "Routes", "Docs": "", "Typewords": ["[]", "Route"] }, { "Name": "MonitorDNSBLs", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "MonitorDNSBLZones", "Docs": "", "Typewords": ["[]", "Domain"] }] },
 		"TLSPublicKey": { "Name": "TLSPublicKey", "Docs": "", "Fields": [{ "Name": "Fingerprint", "Docs": "", "Typewords": ["string"] }, { "Name": "Created", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Type", "Docs": "", "Typewords": ["string"] }, { "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "NoIMAPPreauth", "Docs": "", "Typewords": ["bool"] }, { "Name": "CertDER", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "LoginAddress", "Docs": "", "Typewords": ["string"] }] },
-		"LoginAttempt": { "Name": "LoginAttempt", "Docs": "", "Fields": [{ "Name": "Key", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "Last", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "First", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Count", "Docs": "", "Typewords": ["int64"] }, { "Name": "AccountName", "Docs": "", "Typewords": ["string"] }, { "Name": "LoginAddress", "Docs": "", "Typewords": ["string"] }, { "Name": "RemoteIP", "Docs": "", "Typewords": ["string"] }, { "Name": "LocalIP", "Docs": "", "Typewords": ["string"] }, { "Name": "TLS", "Docs": "", "Typewords": ["string"] }, { "Name": "TLSPubKeyFingerprint", "Docs": "", "Typewords": ["string"] }, { "Name": "Protocol", "Docs": "", "Typewords": ["string"] }, { "Name": "UserAgent", "Docs": "", "Typewords": ["string"] }, { "Name": "AuthMech", "Docs": "", "Typewords": ["string"] }, { "Name": "Result", "Docs": "", "Typewords": ["AuthResult"] }] },
+		"LoginAttempt": { "Name": "LoginAttempt", "Docs": "", "Fields": [{ "Name": "Key", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "Last", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "First", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Count", "Docs": "", "Typewords": ["int64"] }, { "Name": "AccountName", "Docs": "", "Typewords": ["string"] }, { "Name": "LoginAddress", "Docs": "", "Typewords": ["string"] }, { "Name": "RemoteIP", "Docs": "", "Typewords": ["string"] }, { "Name": "LocalIP", "Docs": "", "Typewords": ["string"] }, { "Name": "TLS", "Docs": "", "Typewords": ["string"] }, { "Name": "TLSPubKeyFingerprint", "Docs": "", "Typewords": ["string"] }, { "Name": "Protocol", "Docs": "", "Typewords": ["string"] }, { "Name": "UserAgent", "Docs": "", "Typewords": ["string"] }, { "Name": "AuthMech", "Docs": "", "Typewords": ["string"] }, { "Name": "APIKeyName", "Docs": "", "Typewords": ["string"] }, { "Name": "AppPasswordName", "Docs": "", "Typewords": ["string"] }, { "Name": "SecondFactor", "Docs": "", "Typewords": ["string"] }, { "Name": "Result", "Docs": "", "Typewords": ["AuthResult"] }] },
 		"CSRFToken": { "Name": "CSRFToken", "Docs": "", "Values": null },
 		"DMARCPolicy": { "Name": "DMARCPolicy", "Docs": "", "Values": [{ "Name": "PolicyEmpty", "Value": "", "Docs": "" }, { "Name": "PolicyNone", "Value": "none", "Docs": "" }, { "Name": "PolicyQuarantine", "Value": "quarantine", "Docs": "" }, { "Name": "PolicyReject", "Value": "reject", "Docs": "" }] },
 		"Align": { "Name": "Align", "Docs": "", "Values": [{ "Name": "AlignStrict", "Value": "s", "Docs": "" }, { "Name": "AlignRelaxed", "Value": "r", "Docs": "" }] },
+		"PSD": { "Name": "PSD", "Docs": "", "Values": [{ "Name": "PSDEmpty", "Value": "", "Docs": "" }, { "Name": "PSDUnknown", "Value": "u", "Docs": "" }, { "Name": "PSDYes", "Value": "y", "Docs": "" }, { "Name": "PSDNo", "Value": "n", "Docs": "" }] },
 		"RUA": { "Name": "RUA", "Docs": "", "Values": null },
 		"Mode": { "Name": "Mode", "Docs": "", "Values": [{ "Name": "ModeEnforce", "Value": "enforce", "Docs": "" }, { "Name": "ModeTesting", "Value": "testing", "Docs": "" }, { "Name": "ModeNone", "Value": "none", "Docs": "" }] },
 		"Localpart": { "Name": "Localpart", "Docs": "", "Values": null },
 		"IP": { "Name": "IP", "Docs": "", "Values": [] },
-		"AuthResult": { "Name": "AuthResult", "Docs": "", "Values": [{ "Name": "AuthSuccess", "Value": "ok", "Docs": "" }, { "Name": "AuthBadUser", "Value": "baduser", "Docs": "" }, { "Name": "AuthBadPassword", "Value": "badpassword", "Docs": "" }, { "Name": "AuthBadCredentials", "Value": "badcreds", "Docs": "" }, { "Name": "AuthBadChannelBinding", "Value": "badchanbind", "Docs": "" }, { "Name": "AuthBadProtocol", "Value": "badprotocol", "Docs": "" }, { "Name": "AuthLoginDisabled", "Value": "logindisabled", "Docs": "" }, { "Name": "AuthError", "Value": "error", "Docs": "" }, { "Name": "AuthAborted", "Value": "aborted", "Docs": "" }] },
+		"AuthResult": { "Name": "AuthResult", "Docs": "", "Values": [{ "Name": "AuthSuccess", "Value": "ok", "Docs": "" }, { "Name": "AuthBadUser", "Value": "baduser", "Docs": "" }, { "Name": "AuthBadPassword", "Value": "badpassword", "Docs": "" }, { "Name": "AuthBadCredentials", "Value": "badcreds", "Docs": "" }, { "Name": "AuthBadChannelBinding", "Value": "badchanbind", "Docs": "" }, { "Name": "AuthBadProtocol", "Value": "badprotocol", "Docs": "" }, { "Name": "AuthLoginDisabled", "Value": "logindisabled", "Docs": "" }, { "Name": "AuthSecondFactorRequired", "Value": "secondfactor", "Docs": "" }, { "Name": "AuthError", "Value": "error", "Docs": "" }, { "Name": "AuthAborted", "Value": "aborted", "Docs": "" }] },
 	};
 	api.parser = {
+		SecondFactorChallenge: (v) => api.parse("SecondFactorChallenge", v),
+		WebAuthnRequest: (v) => api.parse("WebAuthnRequest", v),
+		SecondFactorResponse: (v) => api.parse("SecondFactorResponse", v),
+		WebAuthnAssertion: (v) => api.parse("WebAuthnAssertion", v),
 		CheckResult: (v) => api.parse("CheckResult", v),
 		DNSSECResult: (v) => api.parse("DNSSECResult", v),
 		IPRevCheckResult: (v) => api.parse("IPRevCheckResult", v),
@@ -415,6 +446,7 @@ var api;
 		Pair: (v) => api.parse("Pair", v),
 		Policy: (v) => api.parse("Policy", v),
 		STSMX: (v) => api.parse("STSMX", v),
+		BIMICheckResult: (v) => api.parse("BIMICheckResult", v),
 		SRVConfCheckResult: (v) => api.parse("SRVConfCheckResult", v),
 		SRV: (v) => api.parse("SRV", v),
 		AutoconfCheckResult: (v) => api.parse("AutoconfCheckResult", v),
@@ -427,12 +459,16 @@ var api;
 		DMARC: (v) => api.parse("DMARC", v),
 		MTASTS: (v) => api.parse("MTASTS", v),
 		TLSRPT: (v) => api.parse("TLSRPT", v),
+		BIMI: (v) => api.parse("BIMI", v),
 		Route: (v) => api.parse("Route", v),
+		SendLimits: (v) => api.parse("SendLimits", v),
+		SendLimitCounts: (v) => api.parse("SendLimitCounts", v),
 		Alias: (v) => api.parse("Alias", v),
 		AliasAddress: (v) => api.parse("AliasAddress", v),
 		Address: (v) => api.parse("Address", v),
 		Destination: (v) => api.parse("Destination", v),
 		Ruleset: (v) => api.parse("Ruleset", v),
+		AttachmentRule: (v) => api.parse("AttachmentRule", v),
 		Account: (v) => api.parse("Account", v),
 		OutgoingWebhook: (v) => api.parse("OutgoingWebhook", v),
 		IncomingWebhook: (v) => api.parse("IncomingWebhook", v),
@@ -440,6 +476,8 @@ var api;
 		AutomaticJunkFlags: (v) => api.parse("AutomaticJunkFlags", v),
 		JunkFilter: (v) => api.parse("JunkFilter", v),
 		AddressAlias: (v) => api.parse("AddressAlias", v),
+		SendUsageCounts: (v) => api.parse("SendUsageCounts", v),
+		SendCounts: (v) => api.parse("SendCounts", v),
 		PolicyRecord: (v) => api.parse("PolicyRecord", v),
 		TLSReportRecord: (v) => api.parse("TLSReportRecord", v),
 		Report: (v) => api.parse("Report", v),
@@ -463,9 +501,23 @@ var api;
 		SPFAuthResult: (v) => api.parse("SPFAuthResult", v),
 		DMARCSummary: (v) => api.parse("DMARCSummary", v),
 		Reverse: (v) => api.parse("Reverse", v),
+		RateLimiter: (v) => api.parse("RateLimiter", v),
+		RateLimitEntry: (v) => api.parse("RateLimitEntry", v),
+		IPBan: (v) => api.parse("IPBan", v),
+		IPAllow: (v) => api.parse("IPAllow", v),
+		GreylistStats: (v) => api.parse("GreylistStats", v),
+		Triplet: (v) => api.parse("Triplet", v),
+		AllowedGroup: (v) => api.parse("AllowedGroup", v),
+		KnownDomain: (v) => api.parse("KnownDomain", v),
+		SecondFactorStatus: (v) => api.parse("SecondFactorStatus", v),
+		WebAuthnCredential: (v) => api.parse("WebAuthnCredential", v),
 		ClientConfigs: (v) => api.parse("ClientConfigs", v),
 		ClientConfigsEntry: (v) => api.parse("ClientConfigsEntry", v),
 		HoldRule: (v) => api.parse("HoldRule", v),
+		DeliveryStats: (v) => api.parse("DeliveryStats", v),
+		ThrottleStats: (v) => api.parse("ThrottleStats", v),
+		DestinationStats: (v) => api.parse("DestinationStats", v),
+		IPWarmupStats: (v) => api.parse("IPWarmupStats", v),
 		Filter: (v) => api.parse("Filter", v),
 		Sort: (v) => api.parse("Sort", v),
 		Msg: (v) => api.parse("Msg", v),
@@ -504,6 +556,7 @@ var api;
 		CSRFToken: (v) => api.parse("CSRFToken", v),
 		DMARCPolicy: (v) => api.parse("DMARCPolicy", v),
 		Align: (v) => api.parse("Align", v),
+		PSD: (v) => api.parse("PSD", v),
 		RUA: (v) => api.parse("RUA", v),
 		Mode: (v) => api.parse("Mode", v),
 		Localpart: (v) => api.parse("Localpart", v),
@@ -545,14 +598,27 @@ var api;
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
 		// Login returns a session token for the credentials, or fails with error code
-		// "user:badLogin". Call LoginPrep to get a loginToken.
+		// "user:badLogin". Call LoginPrep to get a loginToken. If a second factor is
+		// required, no session is created yet, and secondFactor is returned instead.
+		// Complete the login with LoginSecondFactor.
 		async Login(loginToken, password) {
 			const fn = "Login";
 			const paramTypes = [["string"], ["string"]];
-			const returnTypes = [["CSRFToken"]];
+			const returnTypes = [["CSRFToken"], ["nullable", "SecondFactorChallenge"]];
 			const params = [loginToken, password];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// LoginSecondFactor completes a login for which Login returned a second factor
+		// challenge, with the token from the challenge and a TOTP code, recovery code or
+		// WebAuthn assertion. It returns a session token, or fails with error code
+		// "user:loginFailed".
+		async LoginSecondFactor(loginToken, token, response) {
+			const fn = "LoginSecondFactor";
+			const paramTypes = [["string"], ["string"], ["SecondFactorResponse"]];
+			const returnTypes = [["CSRFToken"]];
+			const params = [loginToken, token, response];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		// Logout invalidates the session token.
 		async Logout() {
 			const fn = "Logout";
@@ -634,6 +700,25 @@ var api;
 			const params = [account];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// AccountSendUsage returns the numbers of messages and recipients submitted by an
+		// account in the past hour, day and month, for its send limits.
+		async AccountSendUsage(account) {
+			const fn = "AccountSendUsage";
+			const paramTypes = [["string"]];
+			const returnTypes = [["SendUsageCounts"]];
+			const params = [account];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// DomainSendUsage returns the numbers of messages and recipients submitted by all
+		// accounts with a message From address in domain in the past hour, day and month,
+		// for the send limits of the domain.
+		async DomainSendUsage(domain) {
+			const fn = "DomainSendUsage";
+			const paramTypes = [["string"]];
+			const returnTypes = [["SendUsageCounts"]];
+			const params = [domain];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		// ConfigFiles returns the paths and contents of the static and dynamic configuration files.
 		async ConfigFiles() {
 			const fn = "ConfigFiles";
@@ -728,6 +813,16 @@ var api;
 			const params = [];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// URIBLStatus returns the health of the URIBLs configured for checking domains
+		// of links in incoming messages, checked now. The returned value maps ASCII zone
+		// names to "ok", or to an error string.
+		async URIBLStatus() {
+			const fn = "URIBLStatus";
+			const paramTypes = [];
+			const returnTypes = [["{}", "string"], ["[]", "Domain"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		async MonitorDNSBLsSave(text) {
 			const fn = "MonitorDNSBLsSave";
 			const paramTypes = [["string"]];
@@ -735,6 +830,78 @@ var api;
 			const params = [text];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// RateLimits returns the counts of all rate limiters, for connections, requests
+		// and failed authentication attempts.
+		async RateLimits() {
+			const fn = "RateLimits";
+			const paramTypes = [];
+			const returnTypes = [["[]", "RateLimiter"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// RateLimitClear clears the counts for an IP or network (in CIDR notation),
+		// including counts for networks containing the IP. If limiterName is empty, counts
+		// are cleared in all rate limiters. Limiters for open connections cannot be
+		// cleared, their counts go down when connections close.
+		async RateLimitClear(limiterName, ipnet) {
+			const fn = "RateLimitClear";
+			const paramTypes = [["string"], ["string"]];
+			const returnTypes = [];
+			const params = [limiterName, ipnet];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// IPBans returns the bans currently in effect, and the IPs/networks that are
+		// never banned.
+		async IPBans() {
+			const fn = "IPBans";
+			const paramTypes = [];
+			const returnTypes = [["[]", "IPBan"], ["[]", "IPAllow"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// IPBanAdd bans an IP or network (in CIDR notation). Duration is a Go duration,
+		// e.g. "24h". If empty, the ban does not expire.
+		async IPBanAdd(ipnet, duration, reason) {
+			const fn = "IPBanAdd";
+			const paramTypes = [["string"], ["string"], ["string"]];
+			const returnTypes = [];
+			const params = [ipnet, duration, reason];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// IPBanRemove removes the ban for an IP or network.
+		async IPBanRemove(ipnet) {
+			const fn = "IPBanRemove";
+			const paramTypes = [["string"]];
+			const returnTypes = [];
+			const params = [ipnet];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// IPAllowAdd adds an IP or network to the allowlist for bans.
+		async IPAllowAdd(ipnet, comment) {
+			const fn = "IPAllowAdd";
+			const paramTypes = [["string"], ["string"]];
+			const returnTypes = [];
+			const params = [ipnet, comment];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// IPAllowRemove removes an IP or network from the allowlist for bans.
+		async IPAllowRemove(ipnet) {
+			const fn = "IPAllowRemove";
+			const paramTypes = [["string"]];
+			const returnTypes = [];
+			const params = [ipnet];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// Greylisting returns statistics about greylisting of incoming deliveries, with
+		// the most recently seen pending triplets, allowlisted remote IP groups and known
+		// domains.
+		async Greylisting() {
+			const fn = "Greylisting";
+			const paramTypes = [];
+			const returnTypes = [["GreylistStats"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		// DomainRecords returns lines describing DNS records that should exist for the
 		// configured domain.
 		async DomainRecords(domain) {
@@ -819,6 +986,32 @@ var api;
 			const params = [accountName, loginDisabled];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// AccountSecondFactorRequiredSave saves the RequireSecondFactor field of an
+		// account.
+		async AccountSecondFactorRequiredSave(accountName, required) {
+			const fn = "AccountSecondFactorRequiredSave";
+			const paramTypes = [["string"], ["bool"]];
+			const returnTypes = [];
+			const params = [accountName, required];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// AccountSecondFactors returns the second factors configured for an account.
+		async AccountSecondFactors(accountName) {
+			const fn = "AccountSecondFactors";
+			const paramTypes = [["string"]];
+			const returnTypes = [["SecondFactorStatus"]];
+			const params = [accountName];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// AccountSecondFactorsClear removes all second factors and recovery codes of an
+		// account, e.g. after the user lost access to them.
+		async AccountSecondFactorsClear(accountName) {
+			const fn = "AccountSecondFactorsClear";
+			const paramTypes = [["string"]];
+			const returnTypes = [];
+			const params = [accountName];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		// ClientConfigsDomain returns configurations for email clients, IMAP and
 		// Submission (SMTP) for the domain.
 		async ClientConfigsDomain(domain) {
@@ -862,6 +1055,16 @@ var api;
 			const params = [holdRuleID];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// QueueDeliveryStats returns the state of destination throttles, statistics
+		// about recent deliveries per recipient domain, and the warm-up state of IPs in
+		// IP pools.
+		async QueueDeliveryStats() {
+			const fn = "QueueDeliveryStats";
+			const paramTypes = [];
+			const returnTypes = [["DeliveryStats"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		// QueueList returns the messages currently in the outgoing queue.
 		async QueueList(filter, sort) {
 			const fn = "QueueList";
@@ -1713,14 +1916,32 @@ const login = async (reason) => {
 		let reasonElem;
 		let fieldset;
 		let password;
+		let code = null;
+		let secondFactor = null;
 		const root = dom.div(style({ position: 'absolute', top: 0, right: 0, bottom: 0, left: 0, backgroundColor: '#eee', display: 'flex', alignItems: 'center', justifyContent: 'center', zIndex: '1', animation: 'fadein .15s ease-in' }), dom.div(style({ display: 'flex', flexDirection: 'column', alignItems: 'center' }), reasonElem = reason ? dom.div(style({ marginBottom: '2ex', textAlign: 'center' }), reason) : dom.div(), dom.div(style({ backgroundColor: 'white', borderRadius: '.25em', padding: '1em', boxShadow: '0 0 20px rgba(0, 0, 0, 0.1)', border: '1px solid #ddd', maxWidth: '95vw', overflowX: 'auto', maxHeight: '95vh', overflowY: 'auto', marginBottom: '20vh' }), dom.form(async function submit(e) {
 			e.preventDefault();
 			e.stopPropagation();
 			reasonElem.remove();
 			try {
 				fieldset.disabled = true;
-				const loginToken = await client.LoginPrep();
-				const token = await client.Login(loginToken, password.value);
+				let token;
+				if (secondFactor) {
+					token = await client.LoginSecondFactor(secondFactor.loginToken, secondFactor.token, { Code: code ? code.value : '', WebAuthn: null });
+				}
+				else {
+					const loginToken = await client.LoginPrep();
+					const [csrfToken, challenge] = await client.Login(loginToken, password.value);
+					if (challenge) {
+						// The admin can only use TOTP as second factor.
+						secondFactor = { loginToken: loginToken, token: challenge.Token };
+						const nfieldset = dom.fieldset(dom.h1('Admin'), dom.label(style({ display: 'block', marginBottom: '2ex' }), dom.div('Code from authenticator app', style({ marginBottom: '.5ex' })), code = dom.input(attr.autocomplete('one-time-code'), attr.required(''))), dom.div(style({ textAlign: 'center' }), dom.submitbutton('Verify')));
+						fieldset.replaceWith(nfieldset);
+						fieldset = nfieldset;
+						code.focus();
+						return;
+					}
+					token = csrfToken;
+				}
 				try {
 					window.localStorage.setItem('webadmincsrftoken', token);
 				}
@@ -1992,7 +2213,7 @@ const index = async () => {
 		e.stopPropagation();
 		await check(fieldset, client.DomainAdd(disabled.checked, domain.value, account.value, localpart.value));
 		window.location.hash = '#domains/' + domain.value;
-	}, fieldset = dom.fieldset(dom.label(style({ display: 'inline-block' }), dom.span('Domain', attr.title('Domain for incoming/outgoing email to add to mox. Can also be a subdomain of a domain already configured.')), dom.br(), domain = dom.input(attr.required(''))), ' ', dom.label(style({ display: 'inline-block' }), dom.span('Postmaster/reporting account', attr.title('Account that is considered the owner of this domain. If the account does not yet exist, it will be created and a a localpart is required for the initial email address.')), dom.br(), account = dom.input(attr.required(''), attr.list('accountList')), dom.datalist(attr.id('accountList'), (accounts || []).map(a => dom.option(attr.value(a), a + (accountsDisabled?.includes(a) ? ' (disabled)' : ''))))), ' ', dom.label(style({ display: 'inline-block' }), dom.span('Localpart (if new account)', attr.title('Must be set if and only if account does not yet exist. A localpart is the part before the "@"-sign of an email address. An account requires an email address, so creating a new account for a domain requires a localpart to form an initial email address.')), dom.br(), localpart = dom.input()), ' ', dom.label(disabled = dom.input(attr.type('checkbox')), ' Disabled', attr.title('Disabled domains do fetch new certificates with ACME and do not accept incoming or outgoing messages involving the domain. Accounts and addresses referencing a disabled domain can be created. USeful during/before migrations.')), ' ', dom.submitbutton('Add domain', attr.title('Domain will be added and the config reloaded. Add the required DNS records after adding the domain.')))), dom.br(), dom.h2('Reports'), dom.div(dom.a('DMARC', attr.href('#dmarc/reports'))), dom.div(dom.a('TLS', attr.href('#tlsrpt/reports'))), dom.br(), dom.h2('Operations'), dom.div(dom.a('MTA-STS policies', attr.href('#mtasts'))), dom.div(dom.a('DMARC evaluations', attr.href('#dmarc/evaluations'))), dom.div(dom.a('TLS connection results', attr.href('#tlsrpt/results'))), dom.div(dom.a('DNSBL', attr.href('#dnsbl'))), dom.div(style({ marginTop: '.5ex' }), dom.form(async function submit(e) {
+	}, fieldset = dom.fieldset(dom.label(style({ display: 'inline-block' }), dom.span('Domain', attr.title('Domain for incoming/outgoing email to add to mox. Can also be a subdomain of a domain already configured.')), dom.br(), domain = dom.input(attr.required(''))), ' ', dom.label(style({ display: 'inline-block' }), dom.span('Postmaster/reporting account', attr.title('Account that is considered the owner of this domain. If the account does not yet exist, it will be created and a a localpart is required for the initial email address.')), dom.br(), account = dom.input(attr.required(''), attr.list('accountList')), dom.datalist(attr.id('accountList'), (accounts || []).map(a => dom.option(attr.value(a), a + (accountsDisabled?.includes(a) ? ' (disabled)' : ''))))), ' ', dom.label(style({ display: 'inline-block' }), dom.span('Localpart (if new account)', attr.title('Must be set if and only if account does not yet exist. A localpart is the part before the "@"-sign of an email address. An account requires an email address, so creating a new account for a domain requires a localpart to form an initial email address.')), dom.br(), localpart = dom.input()), ' ', dom.label(disabled = dom.input(attr.type('checkbox')), ' Disabled', attr.title('Disabled domains do fetch new certificates with ACME and do not accept incoming or outgoing messages involving the domain. Accounts and addresses referencing a disabled domain can be created. USeful during/before migrations.')), ' ', dom.submitbutton('Add domain', attr.title('Domain will be added and the config reloaded. Add the required DNS records after adding the domain.')))), dom.br(), dom.h2('Reports'), dom.div(dom.a('DMARC', attr.href('#dmarc/reports'))), dom.div(dom.a('TLS', attr.href('#tlsrpt/reports'))), dom.br(), dom.h2('Operations'), dom.div(dom.a('MTA-STS policies', attr.href('#mtasts'))), dom.div(dom.a('DMARC evaluations', attr.href('#dmarc/evaluations'))), dom.div(dom.a('TLS connection results', attr.href('#tlsrpt/results'))), dom.div(dom.a('DNSBL', attr.href('#dnsbl'))), dom.div(dom.a('Rate limits', attr.href('#ratelimits'))), dom.div(dom.a('IP bans', attr.href('#ipbans'))), dom.div(dom.a('Greylisting', attr.href('#greylisting'))), dom.div(style({ marginTop: '.5ex' }), dom.form(async function submit(e) {
 		e.preventDefault();
 		e.stopPropagation();
 		dom._kids(cidElem);
@@ -2091,7 +2312,7 @@ const accountloginattempts = async (accountName) => {
 const renderLoginAttempts = (accountLinks, loginAttempts) => {
 	// todo: pagination and search
 	const nowSecs = new Date().getTime() / 1000;
-	return dom.table(dom.thead(dom.tr(dom.th('Time'), dom.th('Result'), dom.th('Count'), dom.th('Account'), dom.th('Address'), dom.th('Protocol'), dom.th('Mechanism'), dom.th('User Agent'), dom.th('Remote IP'), dom.th('Local IP'), dom.th('TLS'), dom.th('TLS pubkey fingerprint'), dom.th('First seen'))), dom.tbody(loginAttempts.length ? [] : dom.tr(dom.td(attr.colspan('13'), 'No login attempts in past 30 days.')), loginAttempts.map(la => dom.tr(dom.td(age(la.Last, false, nowSecs)), dom.td(la.Result === 'ok' ? la.Result : box(red, la.Result)), dom.td('' + la.Count), dom.td(accountLinks ? dom.a(attr.href('#accounts/l/' + la.AccountName + '/loginattempts'), la.AccountName) : la.AccountName), dom.td(la.LoginAddress), dom.td(la.Protocol), dom.td(la.AuthMech), dom.td(la.UserAgent), dom.td(la.RemoteIP), dom.td(la.LocalIP), dom.td(la.TLS), dom.td(la.TLSPubKeyFingerprint), dom.td(age(la.First, false, nowSecs))))));
+	return dom.table(dom.thead(dom.tr(dom.th('Time'), dom.th('Result'), dom.th('Count'), dom.th('Account'), dom.th('Address'), dom.th('Protocol'), dom.th('Mechanism'), dom.th('User Agent'), dom.th('Remote IP'), dom.th('Local IP'), dom.th('TLS'), dom.th('TLS pubkey fingerprint'), dom.th('First seen'))), dom.tbody(loginAttempts.length ? [] : dom.tr(dom.td(attr.colspan('13'), 'No login attempts in past 30 days.')), loginAttempts.map(la => dom.tr(dom.td(age(la.Last, false, nowSecs)), dom.td(la.Result === 'ok' ? la.Result : box(red, la.Result)), dom.td('' + la.Count), dom.td(accountLinks ? dom.a(attr.href('#accounts/l/' + la.AccountName + '/loginattempts'), la.AccountName) : la.AccountName), dom.td(la.LoginAddress), dom.td(la.Protocol), dom.td(la.AuthMech, la.APIKeyName ? ' (' + la.APIKeyName + ')' : [], la.AppPasswordName ? ' (app password ' + la.AppPasswordName + ')' : [], la.SecondFactor ? ' + ' + la.SecondFactor : []), dom.td(la.UserAgent), dom.td(la.RemoteIP), dom.td(la.LocalIP), dom.td(la.TLS), dom.td(la.TLSPubKeyFingerprint), dom.td(age(la.First, false, nowSecs))))));
 };
 const formatQuotaSize = (v) => {
 	if (v === 0) {
@@ -2169,13 +2390,25 @@ const RoutesEditor = (kind, transports, routes, save) => {
 	};
 	return render();
 };
+// sendUsageTable shows the numbers of messages and recipients submitted in the
+// past hour/day/month, with limits if configured.
+const sendUsageTable = (limits, usage) => {
+	const cell = (count, limit) => dom.td(style({ textAlign: 'right' }), limit > 0 && count >= limit ? [style({ color: '#c00' }), attr.title('Limit reached.')] : [], '' + count, limit > 0 ? ' / ' + limit : []);
+	const row = (name, c, l) => dom.tr(dom.td(name), cell(c.MessagesHour, l?.MessagesPerHour || 0), cell(c.MessagesDay, l?.MessagesPerDay || 0), cell(c.MessagesMonth, l?.MessagesPerMonth || 0), cell(c.RecipientsHour, l?.RecipientsPerHour || 0), cell(c.RecipientsDay, l?.RecipientsPerDay || 0), cell(c.RecipientsMonth, l?.RecipientsPerMonth || 0));
+	return [
+		dom.table(dom.thead(dom.tr(dom.th(), dom.th(attr.colspan('3'), 'Messages'), dom.th(attr.colspan('3'), 'Recipients')), dom.tr(dom.th('Submitted through'), ['Hour', 'Day', 'Month', 'Hour', 'Day', 'Month'].map(s => dom.th(s)))), dom.tbody(row('All', usage.All, limits?.All), row('SMTP and webmail', usage.Submission, limits?.Submission), row('Webapi', usage.WebAPI, limits?.WebAPI))),
+		dom.p(limits ? ['When a limit is reached, policy "', limits.Policy || 'reject', '" applies.'] : 'No send limits configured.'),
+	];
+};
 const account = async (name) => {
-	const [[config, diskUsage], domains, transports, tlspubkeys, loginAttempts] = await Promise.all([
+	const [[config, diskUsage], domains, transports, tlspubkeys, loginAttempts, secondFactors, sendUsage] = await Promise.all([
 		client.Account(name),
 		client.Domains(),
 		client.Transports(),
 		client.TLSPublicKeys(name),
 		client.LoginAttempts(name, 10),
+		client.AccountSecondFactors(name),
+		client.AccountSendUsage(name),
 	]);
 	// todo: show suppression list, and buttons to add/remove entries.
 	let form;
@@ -2254,7 +2487,7 @@ const account = async (name) => {
 		e.stopPropagation();
 		e.preventDefault();
 		await check(fieldsetSettings, (async () => await client.AccountSettingsSave(name, parseInt(maxOutgoingMessagesPerDay.value) || 0, parseInt(maxFirstTimeRecipientsPerDay.value) || 0, xparseSize(quotaMessageSize.value), firstTimeSenderDelay.checked, noCustomPassword.checked))());
-	}), dom.br(), dom.h2('Set new password'), formPassword = dom.form(fieldsetPassword = dom.fieldset(dom.label(style({ display: 'inline-block' }), 'New password', dom.br(), password = dom.input(attr.type('password'), attr.autocomplete('new-password'), attr.required(''), function focus() {
+	}), dom.br(), dom.h2('Outgoing messages', attr.title('Messages submitted by this account in the past hour, day and month (30 days), with the send limits of the account, if any. Configure limits with SendLimits in the account configuration.')), sendUsageTable(config.SendLimits, sendUsage), dom.br(), dom.h2('Set new password'), formPassword = dom.form(fieldsetPassword = dom.fieldset(dom.label(style({ display: 'inline-block' }), 'New password', dom.br(), password = dom.input(attr.type('password'), attr.autocomplete('new-password'), attr.required(''), function focus() {
 		passwordHint.style.display = '';
 	})), ' ', dom.submitbutton('Change password')), passwordHint = dom.div(style({ display: 'none', marginTop: '.5ex' }), dom.clickbutton('Generate random password', function click(e) {
 		e.preventDefault();
@@ -2279,7 +2512,16 @@ const account = async (name) => {
 	}), dom.br(), dom.h2('TLS public keys', attr.title('For TLS client authentication with certificates, for IMAP and/or submission (SMTP). Only the public key of the certificate is used during TLS authentication, to identify this account. Names, expiration or constraints are not verified.')), dom.table(dom.thead(dom.tr(dom.th('Login address'), dom.th('Name'), dom.th('Type'), dom.th('No IMAP "preauth"', attr.title('New IMAP immediate TLS connections authenticated with a client certificate are automatically switched to "authenticated" state with an untagged IMAP "preauth" message by default. IMAP connections have a state machine specifying when commands are allowed. Authenticating is not allowed while in the "authenticated" state. Enable this option to work around clients that would try to authenticated anyway.')), dom.th('Fingerprint'))), dom.tbody(tlspubkeys?.length ? [] : dom.tr(dom.td(attr.colspan('5'), 'None')), (tlspubkeys || []).map(tpk => {
 		const row = dom.tr(dom.td(tpk.LoginAddress), dom.td(tpk.Name), dom.td(tpk.Type), dom.td(tpk.NoIMAPPreauth ? 'Enabled' : ''), dom.td(tpk.Fingerprint));
 		return row;
-	}))), dom.br(), RoutesEditor('account-specific', transports, config.Routes || [], async (routes) => await client.AccountRoutesSave(name, routes)), dom.br(), dom.h2('Danger'), dom.div(config.LoginDisabled ? [
+	}))), dom.br(), RoutesEditor('account-specific', transports, config.Routes || [], async (routes) => await client.AccountRoutesSave(name, routes)), dom.br(), dom.h2('Two-factor authentication', attr.title('Second factors are configured by the user in the account web interface. They are required for logins to the account and webmail web interfaces, not for IMAP, SMTP submission or the webapi.')), dom.p('Authenticator app: ', secondFactors.TOTP ? 'Enabled' : 'Not configured', dom.br(), 'Security keys/passkeys: ', (secondFactors.WebAuthn || []).length ? (secondFactors.WebAuthn || []).map(c => c.Name).join(', ') : 'None', dom.br(), 'Unused recovery codes: ', '' + secondFactors.RecoveryCodesUnused), config.RequireSecondFactor && !secondFactors.TOTP && !(secondFactors.WebAuthn || []).length ? dom.p(box(yellow, 'Warning: A second factor is required but none is configured. The user can only login to the account web interface, to configure a second factor.')) : [], dom.div(dom.label(dom.input(attr.type('checkbox'), config.RequireSecondFactor ? attr.checked('') : [], async function change(e) {
+		await check(e.target, client.AccountSecondFactorRequiredSave(name, e.target.checked));
+		window.location.reload(); // todo: update account and rerender.
+	}), ' Require second factor for web logins')), secondFactors.TOTP || (secondFactors.WebAuthn || []).length || secondFactors.RecoveryCodesUnused ? dom.div(style({ marginTop: '1ex' }), dom.clickbutton('Clear second factors', attr.title('Remove the authenticator app, security keys and recovery codes, e.g. when the user lost access to them. The user can login with just the password again, unless a second factor is required.'), async function click(e) {
+		if (!window.confirm('Are you sure you want to remove all second factors and recovery codes for this account?')) {
+			return;
+		}
+		await check(e.target, client.AccountSecondFactorsClear(name));
+		window.location.reload(); // todo: update account and rerender.
+	})) : [], dom.br(), dom.h2('Danger'), dom.div(config.LoginDisabled ? [
 		box(yellow, 'Account login is currently disabled.'),
 		dom.clickbutton('Enable account login', async function click(e) {
 			if (window.confirm('Are you sure you want to enable login to this account?')) {
@@ -2362,7 +2604,7 @@ const formatDuration = (v, goDuration) => {
 const domain = async (d) => {
 	const end = new Date();
 	const start = new Date(new Date().getTime() - 30 * 24 * 3600 * 1000);
-	const [dmarcSummaries, tlsrptSummaries, [localpartAccounts, localpartAliases], clientConfigs, [accounts, accountsDisabled], domainConfig, transports] = await Promise.all([
+	const [dmarcSummaries, tlsrptSummaries, [localpartAccounts, localpartAliases], clientConfigs, [accounts, accountsDisabled], domainConfig, transports, sendUsage] = await Promise.all([
 		client.DMARCSummaries(start, end, d),
 		client.TLSRPTSummaries(start, end, d),
 		client.DomainLocalparts(d),
@@ -2370,6 +2612,7 @@ const domain = async (d) => {
 		client.Accounts(),
 		client.DomainConfig(d),
 		client.Transports(),
+		client.DomainSendUsage(d),
 	]);
 	const dnsdomain = domainConfig.Domain;
 	let addrForm;
@@ -2441,7 +2684,7 @@ const domain = async (d) => {
 			window.location.reload(); // todo: reload only dkim section
 		}, fieldset = dom.fieldset(dom.div(style({ display: 'flex', gap: '1em' }), dom.div(dom.label(style({ display: 'block', marginBottom: '1ex' }), 'Selector', attr.title('Used in the DKIM-Signature header, and used to form a DNS record under ._domainkey.<domain>.'), dom.div(selector = dom.input(attr.required(''), attr.value(defaultSelector())))), dom.label(style({ display: 'block', marginBottom: '1ex' }), 'Algorithm', attr.title('For signing messages. RSA is common at the time of writing, not all mail servers recognize ed25519 signature.'), dom.div(algorithm = dom.select(dom.option('rsa'), dom.option('ed25519')))), dom.label(style({ display: 'block', marginBottom: '1ex' }), 'Hash', attr.title("Used in signing messages. Don't use sha1 unless you understand the consequences."), dom.div(hash = dom.select(dom.option('sha256')))), dom.label(style({ display: 'block', marginBottom: '1ex' }), 'Canonicalization - header', attr.title('Canonicalization processes the message headers before signing. Relaxed allows more whitespace changes, making it more likely for DKIM signatures to validate after transit through servers that make whitespace modifications. Simple is more strict.'), dom.div(canonHeader = dom.select(dom.option('relaxed'), dom.option('simple')))), dom.label(style({ display: 'block', marginBottom: '1ex' }), 'Canonicalization - body', attr.title('Like canonicalization for headers, but for the bodies.'), dom.div(canonBody = dom.select(dom.option('relaxed'), dom.option('simple')))), dom.label(style({ display: 'block', marginBottom: '1ex' }), 'Signature lifetime', attr.title('How long a signature remains valid. Should be as long as a message may take to be delivered. The signature must be valid at the time a message is being delivered to the final destination.'), dom.div(lifetime = dom.input(attr.value('3d'), attr.required('')))), dom.label(style({ display: 'block', marginBottom: '1ex' }), 'Seal headers', attr.title("DKIM-signatures cover headers. If headers are not sealed, additional message headers can be added with the same key without invalidating the signature. This may confuse software about which headers are trustworthy. Sealing is the safer option."), dom.div(seal = dom.input(attr.type('checkbox'), attr.checked(''))))), dom.div(dom.label(style({ display: 'block', marginBottom: '1ex' }), 'Headers (optional)', attr.title('Headers to sign. If left empty, a set of standard headers are signed. The (standard set of) headers are most easily edited after creating the selector/key.'), dom.div(headers = dom.textarea(attr.rows('15')))))), dom.div(dom.submitbutton('Add')))));
 	};
-	return dom.div(crumbs(crumblink('Mox Admin', '#'), 'Domain ' + domainString(dnsdomain)), domainConfig.Disabled ? dom.p(box(yellow, 'Warning: Domain is disabled. Incoming/outgoing messages involving this domain are rejected and ACME for new TLS certificates is disabled.')) : [], dom.ul(dom.li(dom.a('Required DNS records', attr.href('#domains/' + d + '/dnsrecords'))), dom.li(dom.a('Check current actual DNS records and domain configuration', attr.href('#domains/' + d + '/dnscheck')))), dom.br(), dom.h2('Client configuration'), dom.p('If autoconfig/autodiscover does not work with an email client, use the settings below for this domain. Authenticate with email address and password. ', dom.span('Explicitly configure', attr.title('To prevent authentication mechanism downgrade attempts that may result in clients sending plain text passwords to a MitM.')), ' the first supported authentication mechanism: SCRAM-SHA-256-PLUS, SCRAM-SHA-1-PLUS, SCRAM-SHA-256, SCRAM-SHA-1, CRAM-MD5.'), dom.table(dom.thead(dom.tr(dom.th('Protocol'), dom.th('Host'), dom.th('Port'), dom.th('Listener'), dom.th('Note'))), dom.tbody((clientConfigs.Entries || []).map(e => dom.tr(dom.td(e.Protocol), dom.td(domainString(e.Host)), dom.td('' + e.Port), dom.td('' + e.Listener), dom.td('' + e.Note))))), dom.br(), dom.h2('DMARC aggregate reports summary'), renderDMARCSummaries(dmarcSummaries || []), dom.br(), dom.h2('TLS reports summary'), renderTLSRPTSummaries(tlsrptSummaries || []), dom.br(), dom.h2('Addresses'), dom.table(dom.thead(dom.tr(dom.th('Address'), dom.th('Account'), dom.th('Action'))), dom.tbody(Object.entries(localpartAccounts).map(t => dom.tr(dom.td(prewrap(t[0]) || '(catchall)'), dom.td(dom.a(t[1], attr.href('#accounts/l/' + t[1]))), dom.td(dom.clickbutton('Remove', async function click(e) {
+	return dom.div(crumbs(crumblink('Mox Admin', '#'), 'Domain ' + domainString(dnsdomain)), domainConfig.Disabled ? dom.p(box(yellow, 'Warning: Domain is disabled. Incoming/outgoing messages involving this domain are rejected and ACME for new TLS certificates is disabled.')) : [], dom.ul(dom.li(dom.a('Required DNS records', attr.href('#domains/' + d + '/dnsrecords'))), dom.li(dom.a('Check current actual DNS records and domain configuration', attr.href('#domains/' + d + '/dnscheck')))), dom.br(), dom.h2('Client configuration'), dom.p('If autoconfig/autodiscover does not work with an email client, use the settings below for this domain. Authenticate with email address and password. ', dom.span('Explicitly configure', attr.title('To prevent authentication mechanism downgrade attempts that may result in clients sending plain text passwords to a MitM.')), ' the first supported authentication mechanism: SCRAM-SHA-256-PLUS, SCRAM-SHA-1-PLUS, SCRAM-SHA-256, SCRAM-SHA-1, CRAM-MD5.'), dom.table(dom.thead(dom.tr(dom.th('Protocol'), dom.th('Host'), dom.th('Port'), dom.th('Listener'), dom.th('Note'))), dom.tbody((clientConfigs.Entries || []).map(e => dom.tr(dom.td(e.Protocol), dom.td(domainString(e.Host)), dom.td('' + e.Port), dom.td('' + e.Listener), dom.td('' + e.Note))))), dom.br(), dom.h2('DMARC aggregate reports summary'), renderDMARCSummaries(dmarcSummaries || []), dom.br(), dom.h2('TLS reports summary'), renderTLSRPTSummaries(tlsrptSummaries || []), dom.br(), dom.h2('Outgoing messages', attr.title('Messages submitted by all accounts with a message From address in this domain in the past hour, day and month (30 days), with the send limits of the domain, if any. Configure limits with SendLimits in the domain configuration.')), sendUsageTable(domainConfig.SendLimits, sendUsage), dom.br(), dom.h2('Addresses'), dom.table(dom.thead(dom.tr(dom.th('Address'), dom.th('Account'), dom.th('Action'))), dom.tbody(Object.entries(localpartAccounts).map(t => dom.tr(dom.td(prewrap(t[0]) || '(catchall)'), dom.td(dom.a(t[1], attr.href('#accounts/l/' + t[1]))), dom.td(dom.clickbutton('Remove', async function click(e) {
 		e.preventDefault();
 		if (!window.confirm('Are you sure you want to remove this address? If it is a member of an alias, it will be removed from the alias.')) {
 			return;
@@ -2797,6 +3040,9 @@ const domainDNSCheck = async (d) => {
 		!checks.MTASTS.TXT ? [] : dom.div('MTA-STS record: ' + checks.MTASTS.TXT),
 		!checks.MTASTS.PolicyText ? [] : dom.div('MTA-STS policy: ', dom.pre(dom._class('literal'), style({ maxWidth: '60em' }), checks.MTASTS.PolicyText)),
 	];
+	const detailsBIMI = !checks.BIMI.TXT ? [] : [
+		dom.div('TXT record: ' + checks.BIMI.TXT),
+	];
 	const detailsSRVConf = !checks.SRVConf.SRVs || Object.keys(checks.SRVConf.SRVs).length === 0 ? [] : [
 		dom.table(dom.thead(dom.tr(dom.th('Service'), dom.th('Priority'), dom.th('Weight'), dom.th('Port'), dom.th('Host'))), dom.tbody(Object.entries(checks.SRVConf.SRVs || []).map(t => {
 			const l = t[1];
@@ -2813,7 +3059,7 @@ const domainDNSCheck = async (d) => {
 	const detailsAutodiscover = !checks.Autodiscover.Records ? [] : [
 		dom.table(dom.thead(dom.tr(dom.th('Host'), dom.th('Port'), dom.th('Priority'), dom.th('Weight'), dom.th('IPs'))), dom.tbody((checks.Autodiscover.Records || []).map(r => dom.tr([r.Target, r.Port, r.Priority, r.Weight, (r.IPs || []).join(', ')].map(s => dom.td('' + s)))))),
 	];
-	return dom.div(crumbs(crumblink('Mox Admin', '#'), crumblink('Domain ' + domainString(dnsdomain), '#domains/' + d), 'Check DNS'), dom.h1('DNS records and domain configuration check'), resultSection('DNSSEC', checks.DNSSEC, detailsDNSSEC), resultSection('IPRev', checks.IPRev, detailsIPRev), resultSection('MX', checks.MX, detailsMX), resultSection('TLS', checks.TLS, detailsTLS), resultSection('DANE', checks.DANE, detailsDANE), resultSection('SPF', checks.SPF, detailsSPF), resultSection('DKIM', checks.DKIM, detailsDKIM), resultSection('DMARC', checks.DMARC, detailsDMARC), resultSection('Host TLSRPT', checks.HostTLSRPT, detailsTLSRPT(checks.HostTLSRPT)), resultSection('Domain TLSRPT', checks.DomainTLSRPT, detailsTLSRPT(checks.DomainTLSRPT)), resultSection('MTA-STS', checks.MTASTS, detailsMTASTS), resultSection('SRV conf', checks.SRVConf, detailsSRVConf), resultSection('Autoconf', checks.Autoconf, detailsAutoconf), resultSection('Autodiscover', checks.Autodiscover, detailsAutodiscover), dom.br());
+	return dom.div(crumbs(crumblink('Mox Admin', '#'), crumblink('Domain ' + domainString(dnsdomain), '#domains/' + d), 'Check DNS'), dom.h1('DNS records and domain configuration check'), resultSection('DNSSEC', checks.DNSSEC, detailsDNSSEC), resultSection('IPRev', checks.IPRev, detailsIPRev), resultSection('MX', checks.MX, detailsMX), resultSection('TLS', checks.TLS, detailsTLS), resultSection('DANE', checks.DANE, detailsDANE), resultSection('SPF', checks.SPF, detailsSPF), resultSection('DKIM', checks.DKIM, detailsDKIM), resultSection('DMARC', checks.DMARC, detailsDMARC), resultSection('Host TLSRPT', checks.HostTLSRPT, detailsTLSRPT(checks.HostTLSRPT)), resultSection('Domain TLSRPT', checks.DomainTLSRPT, detailsTLSRPT(checks.DomainTLSRPT)), resultSection('MTA-STS', checks.MTASTS, detailsMTASTS), resultSection('BIMI', checks.BIMI, detailsBIMI), resultSection('SRV conf', checks.SRVConf, detailsSRVConf), resultSection('Autoconf', checks.Autoconf, detailsAutoconf), resultSection('Autodiscover', checks.Autodiscover, detailsAutodiscover), dom.br());
 };
 const dmarcIndex = async () => {
 	return dom.div(crumbs(crumblink('Mox Admin', '#'), 'DMARC'), dom.ul(dom.li(dom.a(attr.href('#dmarc/reports'), 'Reports'), ', incoming DMARC aggregate reports.'), dom.li(dom.a(attr.href('#dmarc/evaluations'), 'Evaluations'), ', for outgoing DMARC aggregate reports.')));
@@ -3273,7 +3519,10 @@ const makeMTASTSTable = (items) => {
 	].map(v => dom.td(v === null ? [] : (v instanceof HTMLElement ? v : '' + v)))))));
 };
 const dnsbl = async () => {
-	const [ipZoneResults, usingZones, monitorZones] = await client.DNSBLStatus();
+	const [[ipZoneResults, usingZones, monitorZones], [uriblResults, uriblZones]] = await Promise.all([
+		client.DNSBLStatus(),
+		client.URIBLStatus(),
+	]);
 	const url = (ip) => 'https://multirbl.valli.org/lookup/' + encodeURIComponent(ip) + '.html';
 	let fieldset;
 	let monitorTextarea;
@@ -3282,20 +3531,83 @@ const dnsbl = async () => {
 		return dom.li(link(url(ip), ip), !ipZones.length ? [] : dom.ul(Object.entries(zoneResults).sort().map(zoneResult => dom.li(zoneResult[0] + ': ', zoneResult[1] === 'pass' ? 'pass' : box(red, zoneResult[1])))));
 	})), !Object.entries(ipZoneResults).length ? box(red, 'No IPs found.') : [], dom.br(), dom.h2('DNSBL zones checked due to being used for incoming deliveries'), (usingZones || []).length === 0 ?
 		dom.div('None') :
-		dom.ul((usingZones || []).map(zone => dom.li(domainString(zone)))), dom.br(), dom.h2('DNSBL zones to monitor only'), dom.form(async function submit(e) {
+		dom.ul((usingZones || []).map(zone => dom.li(domainString(zone)))), dom.br(), dom.h2('URIBL zones checked for domains of links in incoming deliveries'), (uriblZones || []).length === 0 ?
+		dom.div('None') :
+		dom.ul((uriblZones || []).map(zone => {
+			const result = uriblResults[zone.ASCII] || '';
+			return dom.li(domainString(zone) + ': ', result === 'ok' ? 'ok' : box(red, result));
+		})), dom.br(), dom.h2('DNSBL zones to monitor only'), dom.form(async function submit(e) {
 		e.preventDefault();
 		e.stopPropagation();
 		await check(fieldset, client.MonitorDNSBLsSave(monitorTextarea.value));
 		dnsbl(); // Render page again.
 	}, fieldset = dom.fieldset(dom.div('One per line'), dom.div(style({ marginBottom: '.5ex' }), monitorTextarea = dom.textarea(style({ width: '20rem' }), attr.rows('' + Math.max(5, 1 + (monitorZones || []).length)), new String((monitorZones || []).map(zone => domainName(zone)).join('\n'))), dom.div('Examples: sbl.spamhaus.org or bl.spamcop.net')), dom.div(dom.submitbutton('Save')))));
 };
+const ratelimits = async () => {
+	const limiters = await client.RateLimits();
+	let fieldset;
+	let ipnet;
+	const clear = async (e, name, net) => {
+		e.preventDefault();
+		await check(e.target, client.RateLimitClear(name, net));
+		window.location.reload(); // todo: only reload the rate limits
+	};
+	return dom.div(crumbs(crumblink('Mox Admin', '#'), 'Rate limits'), dom.p('Counts of connections, requests and failed authentication attempts per IP and network in the current time windows. Connections from an IP are refused when the count for the IP, or one of its networks, reaches the limit. IPs in RateLimitAllowlist in mox.conf are never limited. Clearing an IP also clears the counts for the networks it is in. Counts of open connections cannot be cleared, they go down when connections close.'), dom.form(async function submit(e) {
+		e.preventDefault();
+		e.stopPropagation();
+		await check(fieldset, client.RateLimitClear('', ipnet.value));
+		window.location.reload(); // todo: only reload the rate limits
+	}, fieldset = dom.fieldset(dom.label(style({ display: 'inline-block' }), 'IP or network', dom.br(), ipnet = dom.input(attr.required(''), attr.placeholder('192.0.2.1 or 2001:db8::/48'))), ' ', dom.submitbutton('Clear in all limiters'))), dom.br(), (limiters || []).map(l => dom.div(dom.h2(l.Name), (l.Entries || []).length === 0 ? dom.p('No counts.') :
+		dom.table(dom.thead(dom.tr(dom.th('Window'), dom.th('IP/network'), dom.th('Count'), dom.th('Limit'), dom.th('Limited'), dom.th('Action'))), dom.tbody((l.Entries || []).map(e => dom.tr(dom.td(formatDuration(e.Window, true)), dom.td(e.Net), dom.td(style({ textAlign: 'right' }), '' + e.Count), dom.td(style({ textAlign: 'right' }), '' + e.Limit), dom.td(e.Count >= e.Limit ? box(red, 'yes') : 'no'), dom.td(l.Open ? [] : dom.clickbutton('Clear', attr.title('Clear counts for this IP/network in this limiter.'), async function click(ev) { await clear(ev, l.Name, e.Net); })))))))));
+};
+const greylisting = async () => {
+	const st = await client.Greylisting();
+	const nowSecs = new Date().getTime() / 1000;
+	return dom.div(crumbs(crumblink('Mox Admin', '#'), 'Greylisting'), dom.p('Greylisting is enabled per SMTP listener, see Greylisting in mox.conf. The first delivery attempt for a triplet of remote IP network (or SPF-verified MAIL FROM domain), MAIL FROM and RCPT TO address is temporarily rejected. A retry after the delay is accepted, after which the remote IP network and the DKIM/SPF-verified domains of the message are allowlisted. Messages from senders with a good reputation at the destination account are not greylisted.'), dom.table(dom.tbody(dom.tr(dom.td('Pending triplets'), dom.td(style({ textAlign: 'right' }), '' + st.Pending)), dom.tr(dom.td('Passed triplets'), dom.td(style({ textAlign: 'right' }), '' + st.Passed)), dom.tr(dom.td('Allowlisted IP networks/domains'), dom.td(style({ textAlign: 'right' }), '' + st.AllowedGroups)), dom.tr(dom.td('Known verified domains'), dom.td(style({ textAlign: 'right' }), '' + st.KnownDomains)))), dom.br(), dom.h2('Recently greylisted'), (st.RecentPending || []).length === 0 ? dom.p('None.') :
+		dom.table(dom.thead(dom.tr(dom.th('IP network/domain'), dom.th('MAIL FROM'), dom.th('RCPT TO'), dom.th('First seen'), dom.th('Last seen'), dom.th('Attempts'), dom.th('Expires'))), dom.tbody((st.RecentPending || []).map(t => dom.tr(dom.td(t.Group), dom.td(t.MailFrom || '<>'), dom.td(t.RcptTo), dom.td(age(t.FirstSeen, false, nowSecs)), dom.td(age(t.LastSeen, false, nowSecs)), dom.td(style({ textAlign: 'right' }), '' + t.Attempts), dom.td(age(t.Expires, true, nowSecs)))))), dom.br(), dom.h2('Recently allowlisted IP networks/domains'), (st.RecentAllowed || []).length === 0 ? dom.p('None.') :
+		dom.table(dom.thead(dom.tr(dom.th('IP network/domain'), dom.th('Added'), dom.th('Last seen'), dom.th('Deliveries'), dom.th('Expires'))), dom.tbody((st.RecentAllowed || []).map(g => dom.tr(dom.td(g.Group), dom.td(age(g.Added, false, nowSecs)), dom.td(age(g.LastSeen, false, nowSecs)), dom.td(style({ textAlign: 'right' }), '' + g.Deliveries), dom.td(age(g.Expires, true, nowSecs)))))), dom.br(), dom.h2('Recently seen known domains'), (st.RecentKnown || []).length === 0 ? dom.p('None.') :
+		dom.table(dom.thead(dom.tr(dom.th('Domain'), dom.th('Added'), dom.th('Last seen'), dom.th('Deliveries'), dom.th('Expires'))), dom.tbody((st.RecentKnown || []).map(d => dom.tr(dom.td(d.Domain), dom.td(age(d.Added, false, nowSecs)), dom.td(age(d.LastSeen, false, nowSecs)), dom.td(style({ textAlign: 'right' }), '' + d.Deliveries), dom.td(age(d.Expires, true, nowSecs)))))));
+};
+const ipbans = async () => {
+	const [bans, allowlist] = await client.IPBans();
+	const nowSecs = new Date().getTime() / 1000;
+	let banFieldset;
+	let banNet;
+	let banDuration;
+	let banReason;
+	let allowFieldset;
+	let allowNet;
+	let allowComment;
+	return dom.div(crumbs(crumblink('Mox Admin', '#'), 'IP bans'), dom.p('Connections from banned IPs and networks are refused by all listeners. IPs are banned automatically after repeated failed authentication attempts, with the duration doubling for each next ban, see IPBans in mox.conf. IPs in the allowlist below, and in RateLimitAllowlist in mox.conf, are never banned.'), dom.h2('Bans'), (bans || []).length === 0 ? dom.p('No bans.') :
+		dom.table(dom.thead(dom.tr(dom.th('IP/network'), dom.th('Created'), dom.th('Expires'), dom.th('Automatic'), dom.th('Reason'), dom.th('Action'))), dom.tbody((bans || []).map(b => dom.tr(dom.td(b.Net), dom.td(age(b.Created, false, nowSecs)), dom.td(b.Expires.getUTCFullYear() <= 1 ? 'never' : age(b.Expires, true, nowSecs)), dom.td(b.Automatic ? 'yes, ban ' + b.Count : 'no'), dom.td(b.Reason), dom.td(dom.clickbutton('Remove', attr.title('Remove ban. Also resets the duration for a next automatic ban.'), async function click(e) {
+			e.preventDefault();
+			await check(e.target, client.IPBanRemove(b.Net));
+			window.location.reload(); // todo: only reload the bans
+		})))))), dom.br(), dom.h2('Add ban'), dom.form(async function submit(e) {
+		e.preventDefault();
+		e.stopPropagation();
+		await check(banFieldset, client.IPBanAdd(banNet.value, banDuration.value, banReason.value));
+		window.location.reload(); // todo: only reload the bans
+	}, banFieldset = dom.fieldset(dom.label(style({ display: 'inline-block' }), 'IP or network', dom.br(), banNet = dom.input(attr.required(''), attr.placeholder('192.0.2.1 or 2001:db8::/64'))), ' ', dom.label(style({ display: 'inline-block' }), dom.span('Duration', attr.title('E.g. 24h. If empty, the ban does not expire.')), dom.br(), banDuration = dom.input(attr.placeholder('24h'))), ' ', dom.label(style({ display: 'inline-block' }), 'Reason', dom.br(), banReason = dom.input()), ' ', dom.submitbutton('Add ban'))), dom.br(), dom.h2('Allowlist'), (allowlist || []).length === 0 ? dom.p('No allowlisted IPs or networks.') :
+		dom.table(dom.thead(dom.tr(dom.th('IP/network'), dom.th('Created'), dom.th('Comment'), dom.th('Action'))), dom.tbody((allowlist || []).map(a => dom.tr(dom.td(a.Net), dom.td(age(a.Created, false, nowSecs)), dom.td(a.Comment), dom.td(dom.clickbutton('Remove', async function click(e) {
+			e.preventDefault();
+			await check(e.target, client.IPAllowRemove(a.Net));
+			window.location.reload(); // todo: only reload the allowlist
+		})))))), dom.br(), dom.h2('Add to allowlist'), dom.form(async function submit(e) {
+		e.preventDefault();
+		e.stopPropagation();
+		await check(allowFieldset, client.IPAllowAdd(allowNet.value, allowComment.value));
+		window.location.reload(); // todo: only reload the allowlist
+	}, allowFieldset = dom.fieldset(dom.label(style({ display: 'inline-block' }), 'IP or network', dom.br(), allowNet = dom.input(attr.required(''), attr.placeholder('192.0.2.0/24'))), ' ', dom.label(style({ display: 'inline-block' }), 'Comment', dom.br(), allowComment = dom.input(attr.placeholder('monitoring'))), ' ', dom.submitbutton('Add to allowlist'))));
+};
 const queueList = async () => {
 	let filter = { Max: parseInt(localStorageGet('adminpaginationsize') || '') || 100, IDs: [], Account: '', From: '', To: '', Hold: null, Submitted: '', NextAttempt: '', Transport: null };
 	let sort = { Field: "NextAttempt", LastID: 0, Last: null, Asc: true };
-	let [holdRules, msgs0, transports] = await Promise.all([
+	let [holdRules, msgs0, transports, deliveryStats] = await Promise.all([
 		client.QueueHoldRuleList(),
 		client.QueueList(filter, sort),
 		client.Transports(),
+		client.QueueDeliveryStats(),
 	]);
 	let msgs = msgs0 || [];
 	// todo: more sorting
@@ -3414,6 +3726,23 @@ const queueList = async () => {
 		};
 		renderHoldRules();
 		return box;
+	})(), dom.br(), dom.h2('Destinations', attr.title('Delivery statistics per recipient domain since startup, destination throttles and warm-up state of IPs in IP pools. Configured in mox.conf with DestinationThrottles and IPPools.')), (function () {
+		const backoff = (t) => t.getTime() / 1000 > nowSecs ? age(t, true, nowSecs) : '-';
+		const throttles = deliveryStats.Throttles || [];
+		const warmups = deliveryStats.IPWarmups || [];
+		const destinations = deliveryStats.Destinations || [];
+		return [
+			throttles.length === 0 ? [] : [
+				dom.h3('Throttles'),
+				dom.table(dom.thead(dom.tr(dom.th('Name'), dom.th('Active', attr.title('Current deliveries, and maximum.')), dom.th('Messages last minute', attr.title('Messages in deliveries started in the past minute, and maximum.')), dom.th('Messages last hour', attr.title('Messages in deliveries started in the past hour, and maximum.')), dom.th('Delivered'), dom.th('Temporary errors'), dom.th('Permanent errors'), dom.th('Rate limited', attr.title('Messages failing with a temporary error that looks like rate limiting.')), dom.th('Backoff', attr.title('Time until new deliveries are attempted after rate limiting responses.')))), dom.tbody(throttles.map(t => dom.tr(dom.td(t.Name), dom.td('' + t.Active + (t.MaxConcurrent ? ' / ' + t.MaxConcurrent : '')), dom.td('' + t.MessagesMinute + (t.MessagesPerMinute ? ' / ' + t.MessagesPerMinute : '')), dom.td('' + t.MessagesHour + (t.MessagesPerHour ? ' / ' + t.MessagesPerHour : '')), dom.td('' + t.Delivered), dom.td('' + t.TempErrors), dom.td('' + t.PermErrors), dom.td('' + t.RateLimited), dom.td(backoff(t.BackoffUntil)))))),
+			],
+			warmups.length === 0 ? [] : [
+				dom.h3('IP warm-up'),
+				dom.table(dom.thead(dom.tr(dom.th('IP pool'), dom.th('IP'), dom.th('Day', attr.title('Day in the warm-up schedule, starting at 0.')), dom.th('Delivered today', attr.title('Messages delivered today (UTC), and the maximum for today.')))), dom.tbody(warmups.map(w => dom.tr(dom.td(w.Pool), dom.td(w.IP), dom.td(w.Limit ? '' + w.Day : 'Warmed up'), dom.td('' + w.Messages + (w.Limit ? ' / ' + w.Limit : '')))))),
+			],
+			dom.h3('Recipient domains'),
+			dom.table(dom.thead(dom.tr(dom.th('Domain'), dom.th('Throttle'), dom.th('Active'), dom.th('Last attempt'), dom.th('Delivered'), dom.th('Temporary errors'), dom.th('Permanent errors'), dom.th('Rate limited', attr.title('Messages failing with a temporary error that looks like rate limiting.')), dom.th('Backoff', attr.title('Time until new deliveries are attempted after rate limiting responses, for domains without throttle.')))), dom.tbody(destinations.length === 0 ? dom.tr(dom.td(attr.colspan('9'), 'No deliveries in the past 24 hours.')) : [], destinations.map(d => dom.tr(dom.td(d.Domain), dom.td(d.Throttle || '-'), dom.td('' + d.Active), dom.td(age(d.LastAttempt, false, nowSecs)), dom.td('' + d.Delivered), dom.td('' + d.TempErrors), dom.td('' + d.PermErrors), dom.td('' + d.RateLimited), dom.td(backoff(d.BackoffUntil)))))),
+		];
 	})(), dom.br(), 
 	// Filtering.
 	filterForm = dom.form(attr.id('queuefilter'), // Referenced by input elements in table row.
@@ -3681,7 +4010,7 @@ const hooksList = async () => {
 		filterForm.requestSubmit();
 	}, dom.option(''), 
 	// note: outgoing hook events are in ../webhook/webhook.go, ../mox-/config.go ../webadmin/admin.ts and ../webapi/gendoc.sh. keep in sync.
-	['incoming', 'delivered', 'suppressed', 'delayed', 'failed', 'relayed', 'expanded', 'canceled', 'unrecognized'].map(s => dom.option(s)))), dom.td(), dom.td(), dom.td(filterNextAttempt = dom.input(attr.form('hooksfilter'), style({ width: '7em' }), attr.title('Example: ">1h" for filtering webhooks to be delivered in more than 1 hour, or "<now" for webhooks to be delivered as soon as possible.'))), dom.td(), dom.td(), dom.td(attr.colspan('2'), style({ textAlign: 'right' }), // Less content shifting while rendering.
+	['incoming', 'delivered', 'suppressed', 'delayed', 'failed', 'relayed', 'expanded', 'canceled', 'unrecognized', 'limitreached'].map(s => dom.option(s)))), dom.td(), dom.td(), dom.td(filterNextAttempt = dom.input(attr.form('hooksfilter'), style({ width: '7em' }), attr.title('Example: ">1h" for filtering webhooks to be delivered in more than 1 hour, or "<now" for webhooks to be delivered as soon as possible.'))), dom.td(), dom.td(), dom.td(attr.colspan('2'), style({ textAlign: 'right' }), // Less content shifting while rendering.
 	'Sort ', sortElem = dom.select(attr.form('hooksfilter'), function change() {
 		filterForm.requestSubmit();
 	}, dom.option('Next attempt ↑', attr.value('nextattempt-asc')), dom.option('Next attempt ↓', attr.value('nextattempt-desc')), dom.option('Submitted ↑', attr.value('submitted-asc')), dom.option('Submitted ↓', attr.value('submitted-desc'))), ' ', dom.submitbutton('Apply', attr.form('hooksfilter')), ' ', dom.clickbutton('Reset', attr.form('hooksfilter'), function click() {
@@ -3775,7 +4104,7 @@ const hooksRetiredList = async () => {
 		filterForm.requestSubmit();
 	}, dom.option(''), 
 	// note: outgoing hook events are in ../webhook/webhook.go, ../mox-/config.go ../webadmin/admin.ts and ../webapi/gendoc.sh. keep in sync.
-	['incoming', 'delivered', 'suppressed', 'delayed', 'failed', 'relayed', 'expanded', 'canceled', 'unrecognized'].map(s => dom.option(s)))), dom.td(), dom.td(), dom.td(), dom.td(attr.colspan('2'), style({ textAlign: 'right' }), // Less content shifting while rendering.
+	['incoming', 'delivered', 'suppressed', 'delayed', 'failed', 'relayed', 'expanded', 'canceled', 'unrecognized', 'limitreached'].map(s => dom.option(s)))), dom.td(), dom.td(), dom.td(), dom.td(attr.colspan('2'), style({ textAlign: 'right' }), // Less content shifting while rendering.
 	'Sort ', sortElem = dom.select(attr.form('hooksfilter'), function change() {
 		filterForm.requestSubmit();
 	}, dom.option('Last activity ↓', attr.value('nextattempt-desc')), dom.option('Last activity ↑', attr.value('nextattempt-asc')), dom.option('Submitted ↓', attr.value('submitted-desc')), dom.option('Submitted ↑', attr.value('submitted-asc'))), ' ', dom.submitbutton('Apply', attr.form('hooksfilter')), ' ', dom.clickbutton('Reset', attr.form('hooksfilter'), function click() {
@@ -3969,7 +4298,7 @@ const webserver = async () => {
 			};
 			const root = dom.table(dom.tr(dom.td('Type'), dom.td('Base path', attr.title('Path to use as root of internal service, e.g. /webmail/.')), dom.td('Service')), dom.tr(dom.td(dom.select(attr.required(''), dom.option('Static'), dom.option('Redirect'), dom.option('Forward'), dom.option('Internal', attr.selected('')), function change(e) {
 				makeType(e.target.value);
-			})), dom.td(basePath = dom.input(attr.value(wi.BasePath), attr.required(''), attr.placeholder('/.../'))), dom.td(service = dom.select(dom.option('Admin', attr.value('admin')), dom.option('Account', attr.value('account')), dom.option('Webmail', attr.value('webmail')), dom.option('Webapi', attr.value('webapi')), prop({ value: wi.Service })))));
+			})), dom.td(basePath = dom.input(attr.value(wi.BasePath), attr.required(''), attr.placeholder('/.../'))), dom.td(service = dom.select(dom.option('Admin', attr.value('admin')), dom.option('Account', attr.value('account')), dom.option('Webmail', attr.value('webmail')), dom.option('Webapi', attr.value('webapi')), dom.option('DAV', attr.value('dav')), prop({ value: wi.Service })))));
 			view = { root: root, get: get };
 			return view;
 		};
@@ -4262,6 +4591,15 @@ const init = async () => {
 			else if (h === 'dnsbl') {
 				root = await dnsbl();
 			}
+			else if (h === 'ratelimits') {
+				root = await ratelimits();
+			}
+			else if (h === 'ipbans') {
+				root = await ipbans();
+			}
+			else if (h === 'greylisting') {
+				root = await greylisting();
+			}
 			else if (h === 'routes') {
 				root = await globalRoutes();
 			}
@@ -15,6 +15,8 @@ const login = async (reason: string) => {
 		let reasonElem: HTMLElement
 		let fieldset: HTMLFieldSetElement
 		let password: HTMLInputElement
+		let code: HTMLInputElement | null = null
+		let secondFactor: {loginToken: string, token: string} | null = null
 		const root = dom.div(
 			style({position: 'absolute', top: 0, right: 0, bottom: 0, left: 0, backgroundColor: '#eee', display: 'flex', alignItems: 'center', justifyContent: 'center', zIndex: '1', animation: 'fadein .15s ease-in'}),
 			dom.div(
@@ -31,8 +33,34 @@ const login = async (reason: string) => {
 
 							try {
 								fieldset.disabled = true
-								const loginToken = await client.LoginPrep()
-								const token = await client.Login(loginToken, password.value)
+								let token: string
+								if (secondFactor) {
+									token = await client.LoginSecondFactor(secondFactor.loginToken, secondFactor.token, {Code: code ? code.value : '', WebAuthn: null})
+								} else {
+									const loginToken = await client.LoginPrep()
+									const [csrfToken, challenge] = await client.Login(loginToken, password.value)
+									if (challenge) {
+										// The admin can only use TOTP as second factor.
+										secondFactor = {loginToken: loginToken, token: challenge.Token}
+										const nfieldset = dom.fieldset(
+											dom.h1('Admin'),
+											dom.label(
+												style({display: 'block', marginBottom: '2ex'}),
+												dom.div('Code from authenticator app', style({marginBottom: '.5ex'})),
+												code=dom.input(attr.autocomplete('one-time-code'), attr.required('')),
+											),
+											dom.div(
+												style({textAlign: 'center'}),
+												dom.submitbutton('Verify'),
+											),
+										)
+										fieldset.replaceWith(nfieldset)
+										fieldset = nfieldset
+										code.focus()
+										return
+									}
+									token = csrfToken
+								}
 								try {
 									window.localStorage.setItem('webadmincsrftoken', token)
 								} catch (err) {
@@ -415,6 +443,9 @@ const index = async () => {
 		dom.div(dom.a('DMARC evaluations', attr.href('#dmarc/evaluations'))),
 		dom.div(dom.a('TLS connection results', attr.href('#tlsrpt/results'))),
 		dom.div(dom.a('DNSBL', attr.href('#dnsbl'))),
+		dom.div(dom.a('Rate limits', attr.href('#ratelimits'))),
+		dom.div(dom.a('IP bans', attr.href('#ipbans'))),
+		dom.div(dom.a('Greylisting', attr.href('#greylisting'))),
 		dom.div(
 			style({marginTop: '.5ex'}),
 			dom.form(
@@ -718,7 +749,7 @@ const renderLoginAttempts = (accountLinks: boolean, loginAttempts: api.LoginAtte
 					dom.td(accountLinks ? dom.a(attr.href('#accounts/l/'+la.AccountName+'/loginattempts'), la.AccountName) : la.AccountName),
 					dom.td(la.LoginAddress),
 					dom.td(la.Protocol),
-					dom.td(la.AuthMech),
+					dom.td(la.AuthMech, la.APIKeyName ? ' ('+la.APIKeyName+')' : [], la.AppPasswordName ? ' (app password '+la.AppPasswordName+')' : [], la.SecondFactor ? ' + '+la.SecondFactor : []),
 					dom.td(la.UserAgent),
 					dom.td(la.RemoteIP),
 					dom.td(la.LocalIP),
@@ -849,13 +880,47 @@ const RoutesEditor = (kind: string, transports: { [key: string]: api.Transport }
 	return render()
 }
 
+// sendUsageTable shows the numbers of messages and recipients submitted in the
+// past hour/day/month, with limits if configured.
+const sendUsageTable = (limits: api.SendLimits | null | undefined, usage: api.SendUsageCounts) => {
+	const cell = (count: number, limit: number) => dom.td(style({textAlign: 'right'}),
+		limit > 0 && count >= limit ? [style({color: '#c00'}), attr.title('Limit reached.')] : [],
+		''+count, limit > 0 ? ' / '+limit : [],
+	)
+	const row = (name: string, c: api.SendCounts, l: api.SendLimitCounts | undefined) => dom.tr(
+		dom.td(name),
+		cell(c.MessagesHour, l?.MessagesPerHour || 0),
+		cell(c.MessagesDay, l?.MessagesPerDay || 0),
+		cell(c.MessagesMonth, l?.MessagesPerMonth || 0),
+		cell(c.RecipientsHour, l?.RecipientsPerHour || 0),
+		cell(c.RecipientsDay, l?.RecipientsPerDay || 0),
+		cell(c.RecipientsMonth, l?.RecipientsPerMonth || 0),
+	)
+	return [
+		dom.table(
+			dom.thead(
+				dom.tr(dom.th(), dom.th(attr.colspan('3'), 'Messages'), dom.th(attr.colspan('3'), 'Recipients')),
+				dom.tr(dom.th('Submitted through'), ['Hour', 'Day', 'Month', 'Hour', 'Day', 'Month'].map(s => dom.th(s))),
+			),
+			dom.tbody(
+				row('All', usage.All, limits?.All),
+				row('SMTP and webmail', usage.Submission, limits?.Submission),
+				row('Webapi', usage.WebAPI, limits?.WebAPI),
+			),
+		),
+		dom.p(limits ? ['When a limit is reached, policy "', limits.Policy || 'reject', '" applies.'] : 'No send limits configured.'),
+	]
+}
+
 const account = async (name: string) => {
-	const [[config, diskUsage], domains, transports, tlspubkeys, loginAttempts] = await Promise.all([
+	const [[config, diskUsage], domains, transports, tlspubkeys, loginAttempts, secondFactors, sendUsage] = await Promise.all([
 		client.Account(name),
 		client.Domains(),
 		client.Transports(),
 		client.TLSPublicKeys(name),
 		client.LoginAttempts(name, 10),
+		client.AccountSecondFactors(name),
+		client.AccountSendUsage(name),
 	])
 
 	// todo: show suppression list, and buttons to add/remove entries.
@@ -1053,6 +1118,9 @@ const account = async (name: string) => {
 			},
 		),
 		dom.br(),
+		dom.h2('Outgoing messages', attr.title('Messages submitted by this account in the past hour, day and month (30 days), with the send limits of the account, if any. Configure limits with SendLimits in the account configuration.')),
+		sendUsageTable(config.SendLimits, sendUsage),
+		dom.br(),
 		dom.h2('Set new password'),
 		formPassword=dom.form(
 			fieldsetPassword=dom.fieldset(
@@ -1127,6 +1195,34 @@ const account = async (name: string) => {
 		RoutesEditor('account-specific', transports, config.Routes || [], async (routes: api.Route[]) => await client.AccountRoutesSave(name, routes)),
 		dom.br(),
 
+		dom.h2('Two-factor authentication', attr.title('Second factors are configured by the user in the account web interface. They are required for logins to the account and webmail web interfaces, not for IMAP, SMTP submission or the webapi.')),
+		dom.p(
+			'Authenticator app: ', secondFactors.TOTP ? 'Enabled' : 'Not configured', dom.br(),
+			'Security keys/passkeys: ', (secondFactors.WebAuthn || []).length ? (secondFactors.WebAuthn || []).map(c => c.Name).join(', ') : 'None', dom.br(),
+			'Unused recovery codes: ', ''+secondFactors.RecoveryCodesUnused,
+		),
+		config.RequireSecondFactor && !secondFactors.TOTP && !(secondFactors.WebAuthn || []).length ? dom.p(box(yellow, 'Warning: A second factor is required but none is configured. The user can only login to the account web interface, to configure a second factor.')) : [],
+		dom.div(
+			dom.label(
+				dom.input(attr.type('checkbox'), config.RequireSecondFactor ? attr.checked('') : [], async function change(e: {target: HTMLInputElement}) {
+					await check(e.target, client.AccountSecondFactorRequiredSave(name, e.target.checked))
+					window.location.reload() // todo: update account and rerender.
+				}),
+				' Require second factor for web logins',
+			),
+		),
+		secondFactors.TOTP || (secondFactors.WebAuthn || []).length || secondFactors.RecoveryCodesUnused ? dom.div(
+			style({marginTop: '1ex'}),
+			dom.clickbutton('Clear second factors', attr.title('Remove the authenticator app, security keys and recovery codes, e.g. when the user lost access to them. The user can login with just the password again, unless a second factor is required.'), async function click(e: {target: HTMLButtonElement}) {
+				if (!window.confirm('Are you sure you want to remove all second factors and recovery codes for this account?')) {
+					return
+				}
+				await check(e.target, client.AccountSecondFactorsClear(name))
+				window.location.reload() // todo: update account and rerender.
+			}),
+		) : [],
+		dom.br(),
+
 		dom.h2('Danger'),
 		dom.div(
 			config.LoginDisabled ? [
@@ -1217,7 +1313,7 @@ const formatDuration = (v: number, goDuration?: boolean) => {
 const domain = async (d: string) => {
 	const end = new Date()
 	const start = new Date(new Date().getTime() - 30*24*3600*1000)
-	const [dmarcSummaries, tlsrptSummaries, [localpartAccounts, localpartAliases], clientConfigs, [accounts, accountsDisabled], domainConfig, transports] = await Promise.all([
+	const [dmarcSummaries, tlsrptSummaries, [localpartAccounts, localpartAliases], clientConfigs, [accounts, accountsDisabled], domainConfig, transports, sendUsage] = await Promise.all([
 		client.DMARCSummaries(start, end, d),
 		client.TLSRPTSummaries(start, end, d),
 		client.DomainLocalparts(d),
@@ -1225,6 +1321,7 @@ const domain = async (d: string) => {
 		client.Accounts(),
 		client.DomainConfig(d),
 		client.Transports(),
+		client.DomainSendUsage(d),
 	])
 	const dnsdomain = domainConfig.Domain
 
@@ -1433,6 +1530,10 @@ const domain = async (d: string) => {
 		renderTLSRPTSummaries(tlsrptSummaries || []),
 		dom.br(),
 
+		dom.h2('Outgoing messages', attr.title('Messages submitted by all accounts with a message From address in this domain in the past hour, day and month (30 days), with the send limits of the domain, if any. Configure limits with SendLimits in the domain configuration.')),
+		sendUsageTable(domainConfig.SendLimits, sendUsage),
+		dom.br(),
+
 		dom.h2('Addresses'),
 		dom.table(
 			dom.thead(
@@ -2255,6 +2356,9 @@ const domainDNSCheck = async (d: string) => {
 		!checks.MTASTS.TXT ? [] : dom.div('MTA-STS record: ' + checks.MTASTS.TXT),
 		!checks.MTASTS.PolicyText ? [] : dom.div('MTA-STS policy: ', dom.pre(dom._class('literal'), style({maxWidth: '60em'}), checks.MTASTS.PolicyText)),
 	]
+	const detailsBIMI = !checks.BIMI.TXT ? [] : [
+		dom.div('TXT record: ' + checks.BIMI.TXT),
+	]
 	const detailsSRVConf = !checks.SRVConf.SRVs || Object.keys(checks.SRVConf.SRVs).length === 0 ? [] : [
 		dom.table(
 			dom.thead(
@@ -2306,6 +2410,7 @@ const domainDNSCheck = async (d: string) => {
 		resultSection('Host TLSRPT', checks.HostTLSRPT, detailsTLSRPT(checks.HostTLSRPT)),
 		resultSection('Domain TLSRPT', checks.DomainTLSRPT, detailsTLSRPT(checks.DomainTLSRPT)),
 		resultSection('MTA-STS', checks.MTASTS, detailsMTASTS),
+		resultSection('BIMI', checks.BIMI, detailsBIMI),
 		resultSection('SRV conf', checks.SRVConf, detailsSRVConf),
 		resultSection('Autoconf', checks.Autoconf, detailsAutoconf),
 		resultSection('Autodiscover', checks.Autodiscover, detailsAutodiscover),
@@ -3283,7 +3388,10 @@ const makeMTASTSTable = (items: api.PolicyRecord[]) => {
 }
 
 const dnsbl = async () => {
-	const [ipZoneResults, usingZones, monitorZones] = await client.DNSBLStatus()
+	const [[ipZoneResults, usingZones, monitorZones], [uriblResults, uriblZones]] = await Promise.all([
+		client.DNSBLStatus(),
+		client.URIBLStatus(),
+	])
 
 	const url = (ip: string) => 'https://multirbl.valli.org/lookup/' + encodeURIComponent(ip) + '.html'
 
@@ -3319,6 +3427,19 @@ const dnsbl = async () => {
 			dom.div('None') :
 			dom.ul((usingZones || []).map(zone => dom.li(domainString(zone)))),
 		dom.br(),
+		dom.h2('URIBL zones checked for domains of links in incoming deliveries'),
+		(uriblZones || []).length === 0 ?
+			dom.div('None') :
+			dom.ul(
+				(uriblZones || []).map(zone => {
+					const result = uriblResults[zone.ASCII] || ''
+					return dom.li(
+						domainString(zone) + ': ',
+						result === 'ok' ? 'ok' : box(red, result),
+					)
+				}),
+			),
+		dom.br(),
 		dom.h2('DNSBL zones to monitor only'),
 		dom.form(
 			async function submit(e: SubmitEvent) {
@@ -3344,13 +3465,328 @@ const dnsbl = async () => {
 	)
 }
 
+const ratelimits = async () => {
+	const limiters = await client.RateLimits()
+
+	let fieldset: HTMLFieldSetElement
+	let ipnet: HTMLInputElement
+
+	const clear = async (e: MouseEvent, name: string, net: string) => {
+		e.preventDefault()
+		await check(e.target! as HTMLButtonElement, client.RateLimitClear(name, net))
+		window.location.reload() // todo: only reload the rate limits
+	}
+
+	return dom.div(
+		crumbs(
+			crumblink('Mox Admin', '#'),
+			'Rate limits',
+		),
+		dom.p('Counts of connections, requests and failed authentication attempts per IP and network in the current time windows. Connections from an IP are refused when the count for the IP, or one of its networks, reaches the limit. IPs in RateLimitAllowlist in mox.conf are never limited. Clearing an IP also clears the counts for the networks it is in. Counts of open connections cannot be cleared, they go down when connections close.'),
+		dom.form(
+			async function submit(e: SubmitEvent) {
+				e.preventDefault()
+				e.stopPropagation()
+				await check(fieldset, client.RateLimitClear('', ipnet.value))
+				window.location.reload() // todo: only reload the rate limits
+			},
+			fieldset=dom.fieldset(
+				dom.label(
+					style({display: 'inline-block'}),
+					'IP or network',
+					dom.br(),
+					ipnet=dom.input(attr.required(''), attr.placeholder('192.0.2.1 or 2001:db8::/48')),
+				),
+				' ',
+				dom.submitbutton('Clear in all limiters'),
+			),
+		),
+		dom.br(),
+		(limiters || []).map(l =>
+			dom.div(
+				dom.h2(l.Name),
+				(l.Entries || []).length === 0 ? dom.p('No counts.') :
+				dom.table(
+					dom.thead(
+						dom.tr(
+							dom.th('Window'),
+							dom.th('IP/network'),
+							dom.th('Count'),
+							dom.th('Limit'),
+							dom.th('Limited'),
+							dom.th('Action'),
+						),
+					),
+					dom.tbody(
+						(l.Entries || []).map(e =>
+							dom.tr(
+								dom.td(formatDuration(e.Window, true)),
+								dom.td(e.Net),
+								dom.td(style({textAlign: 'right'}), ''+e.Count),
+								dom.td(style({textAlign: 'right'}), ''+e.Limit),
+								dom.td(e.Count >= e.Limit ? box(red, 'yes') : 'no'),
+								dom.td(l.Open ? [] : dom.clickbutton('Clear', attr.title('Clear counts for this IP/network in this limiter.'), async function click(ev: MouseEvent) { await clear(ev, l.Name, e.Net) })),
+							),
+						),
+					),
+				),
+			),
+		),
+	)
+}
+
+const greylisting = async () => {
+	const st = await client.Greylisting()
+	const nowSecs = new Date().getTime()/1000
+
+	return dom.div(
+		crumbs(
+			crumblink('Mox Admin', '#'),
+			'Greylisting',
+		),
+		dom.p('Greylisting is enabled per SMTP listener, see Greylisting in mox.conf. The first delivery attempt for a triplet of remote IP network (or SPF-verified MAIL FROM domain), MAIL FROM and RCPT TO address is temporarily rejected. A retry after the delay is accepted, after which the remote IP network and the DKIM/SPF-verified domains of the message are allowlisted. Messages from senders with a good reputation at the destination account are not greylisted.'),
+		dom.table(
+			dom.tbody(
+				dom.tr(dom.td('Pending triplets'), dom.td(style({textAlign: 'right'}), ''+st.Pending)),
+				dom.tr(dom.td('Passed triplets'), dom.td(style({textAlign: 'right'}), ''+st.Passed)),
+				dom.tr(dom.td('Allowlisted IP networks/domains'), dom.td(style({textAlign: 'right'}), ''+st.AllowedGroups)),
+				dom.tr(dom.td('Known verified domains'), dom.td(style({textAlign: 'right'}), ''+st.KnownDomains)),
+			),
+		),
+		dom.br(),
+		dom.h2('Recently greylisted'),
+		(st.RecentPending || []).length === 0 ? dom.p('None.') :
+		dom.table(
+			dom.thead(
+				dom.tr(
+					dom.th('IP network/domain'),
+					dom.th('MAIL FROM'),
+					dom.th('RCPT TO'),
+					dom.th('First seen'),
+					dom.th('Last seen'),
+					dom.th('Attempts'),
+					dom.th('Expires'),
+				),
+			),
+			dom.tbody(
+				(st.RecentPending || []).map(t =>
+					dom.tr(
+						dom.td(t.Group),
+						dom.td(t.MailFrom || '<>'),
+						dom.td(t.RcptTo),
+						dom.td(age(t.FirstSeen, false, nowSecs)),
+						dom.td(age(t.LastSeen, false, nowSecs)),
+						dom.td(style({textAlign: 'right'}), ''+t.Attempts),
+						dom.td(age(t.Expires, true, nowSecs)),
+					),
+				),
+			),
+		),
+		dom.br(),
+		dom.h2('Recently allowlisted IP networks/domains'),
+		(st.RecentAllowed || []).length === 0 ? dom.p('None.') :
+		dom.table(
+			dom.thead(
+				dom.tr(
+					dom.th('IP network/domain'),
+					dom.th('Added'),
+					dom.th('Last seen'),
+					dom.th('Deliveries'),
+					dom.th('Expires'),
+				),
+			),
+			dom.tbody(
+				(st.RecentAllowed || []).map(g =>
+					dom.tr(
+						dom.td(g.Group),
+						dom.td(age(g.Added, false, nowSecs)),
+						dom.td(age(g.LastSeen, false, nowSecs)),
+						dom.td(style({textAlign: 'right'}), ''+g.Deliveries),
+						dom.td(age(g.Expires, true, nowSecs)),
+					),
+				),
+			),
+		),
+		dom.br(),
+		dom.h2('Recently seen known domains'),
+		(st.RecentKnown || []).length === 0 ? dom.p('None.') :
+		dom.table(
+			dom.thead(
+				dom.tr(
+					dom.th('Domain'),
+					dom.th('Added'),
+					dom.th('Last seen'),
+					dom.th('Deliveries'),
+					dom.th('Expires'),
+				),
+			),
+			dom.tbody(
+				(st.RecentKnown || []).map(d =>
+					dom.tr(
+						dom.td(d.Domain),
+						dom.td(age(d.Added, false, nowSecs)),
+						dom.td(age(d.LastSeen, false, nowSecs)),
+						dom.td(style({textAlign: 'right'}), ''+d.Deliveries),
+						dom.td(age(d.Expires, true, nowSecs)),
+					),
+				),
+			),
+		),
+	)
+}
+
+const ipbans = async () => {
+	const [bans, allowlist] = await client.IPBans()
+	const nowSecs = new Date().getTime()/1000
+
+	let banFieldset: HTMLFieldSetElement
+	let banNet: HTMLInputElement
+	let banDuration: HTMLInputElement
+	let banReason: HTMLInputElement
+
+	let allowFieldset: HTMLFieldSetElement
+	let allowNet: HTMLInputElement
+	let allowComment: HTMLInputElement
+
+	return dom.div(
+		crumbs(
+			crumblink('Mox Admin', '#'),
+			'IP bans',
+		),
+		dom.p('Connections from banned IPs and networks are refused by all listeners. IPs are banned automatically after repeated failed authentication attempts, with the duration doubling for each next ban, see IPBans in mox.conf. IPs in the allowlist below, and in RateLimitAllowlist in mox.conf, are never banned.'),
+		dom.h2('Bans'),
+		(bans || []).length === 0 ? dom.p('No bans.') :
+		dom.table(
+			dom.thead(
+				dom.tr(
+					dom.th('IP/network'),
+					dom.th('Created'),
+					dom.th('Expires'),
+					dom.th('Automatic'),
+					dom.th('Reason'),
+					dom.th('Action'),
+				),
+			),
+			dom.tbody(
+				(bans || []).map(b =>
+					dom.tr(
+						dom.td(b.Net),
+						dom.td(age(b.Created, false, nowSecs)),
+						dom.td(b.Expires.getUTCFullYear() <= 1 ? 'never' : age(b.Expires, true, nowSecs)),
+						dom.td(b.Automatic ? 'yes, ban '+b.Count : 'no'),
+						dom.td(b.Reason),
+						dom.td(
+							dom.clickbutton('Remove', attr.title('Remove ban. Also resets the duration for a next automatic ban.'), async function click(e: MouseEvent) {
+								e.preventDefault()
+								await check(e.target! as HTMLButtonElement, client.IPBanRemove(b.Net))
+								window.location.reload() // todo: only reload the bans
+							}),
+						),
+					),
+				),
+			),
+		),
+		dom.br(),
+		dom.h2('Add ban'),
+		dom.form(
+			async function submit(e: SubmitEvent) {
+				e.preventDefault()
+				e.stopPropagation()
+				await check(banFieldset, client.IPBanAdd(banNet.value, banDuration.value, banReason.value))
+				window.location.reload() // todo: only reload the bans
+			},
+			banFieldset=dom.fieldset(
+				dom.label(
+					style({display: 'inline-block'}),
+					'IP or network',
+					dom.br(),
+					banNet=dom.input(attr.required(''), attr.placeholder('192.0.2.1 or 2001:db8::/64')),
+				),
+				' ',
+				dom.label(
+					style({display: 'inline-block'}),
+					dom.span('Duration', attr.title('E.g. 24h. If empty, the ban does not expire.')),
+					dom.br(),
+					banDuration=dom.input(attr.placeholder('24h')),
+				),
+				' ',
+				dom.label(
+					style({display: 'inline-block'}),
+					'Reason',
+					dom.br(),
+					banReason=dom.input(),
+				),
+				' ',
+				dom.submitbutton('Add ban'),
+			),
+		),
+		dom.br(),
+		dom.h2('Allowlist'),
+		(allowlist || []).length === 0 ? dom.p('No allowlisted IPs or networks.') :
+		dom.table(
+			dom.thead(
+				dom.tr(
+					dom.th('IP/network'),
+					dom.th('Created'),
+					dom.th('Comment'),
+					dom.th('Action'),
+				),
+			),
+			dom.tbody(
+				(allowlist || []).map(a =>
+					dom.tr(
+						dom.td(a.Net),
+						dom.td(age(a.Created, false, nowSecs)),
+						dom.td(a.Comment),
+						dom.td(
+							dom.clickbutton('Remove', async function click(e: MouseEvent) {
+								e.preventDefault()
+								await check(e.target! as HTMLButtonElement, client.IPAllowRemove(a.Net))
+								window.location.reload() // todo: only reload the allowlist
+							}),
+						),
+					),
+				),
+			),
+		),
+		dom.br(),
+		dom.h2('Add to allowlist'),
+		dom.form(
+			async function submit(e: SubmitEvent) {
+				e.preventDefault()
+				e.stopPropagation()
+				await check(allowFieldset, client.IPAllowAdd(allowNet.value, allowComment.value))
+				window.location.reload() // todo: only reload the allowlist
+			},
+			allowFieldset=dom.fieldset(
+				dom.label(
+					style({display: 'inline-block'}),
+					'IP or network',
+					dom.br(),
+					allowNet=dom.input(attr.required(''), attr.placeholder('192.0.2.0/24')),
+				),
+				' ',
+				dom.label(
+					style({display: 'inline-block'}),
+					'Comment',
+					dom.br(),
+					allowComment=dom.input(attr.placeholder('monitoring')),
+				),
+				' ',
+				dom.submitbutton('Add to allowlist'),
+			),
+		),
+	)
+}
+
 const queueList = async () => {
 	let filter: api.Filter = {Max: parseInt(localStorageGet('adminpaginationsize') || '') || 100, IDs: [], Account: '', From: '', To: '', Hold: null, Submitted: '', NextAttempt: '', Transport: null}
 	let sort: api.Sort = {Field: "NextAttempt", LastID: 0, Last: null, Asc: true}
-	let [holdRules, msgs0, transports] = await Promise.all([
+	let [holdRules, msgs0, transports, deliveryStats] = await Promise.all([
 		client.QueueHoldRuleList(),
 		client.QueueList(filter, sort),
 		client.Transports(),
+		client.QueueDeliveryStats(),
 	])
 	let msgs: api.Msg[] = msgs0 || []
 
@@ -3572,6 +4008,105 @@ const queueList = async () => {
 		})(),
 		dom.br(),
 
+		dom.h2('Destinations', attr.title('Delivery statistics per recipient domain since startup, destination throttles and warm-up state of IPs in IP pools. Configured in mox.conf with DestinationThrottles and IPPools.')),
+		(function() {
+			const backoff = (t: Date) => t.getTime()/1000 > nowSecs ? age(t, true, nowSecs) : '-'
+			const throttles = deliveryStats.Throttles || []
+			const warmups = deliveryStats.IPWarmups || []
+			const destinations = deliveryStats.Destinations || []
+			return [
+				throttles.length === 0 ? [] : [
+					dom.h3('Throttles'),
+					dom.table(
+						dom.thead(
+							dom.tr(
+								dom.th('Name'),
+								dom.th('Active', attr.title('Current deliveries, and maximum.')),
+								dom.th('Messages last minute', attr.title('Messages in deliveries started in the past minute, and maximum.')),
+								dom.th('Messages last hour', attr.title('Messages in deliveries started in the past hour, and maximum.')),
+								dom.th('Delivered'),
+								dom.th('Temporary errors'),
+								dom.th('Permanent errors'),
+								dom.th('Rate limited', attr.title('Messages failing with a temporary error that looks like rate limiting.')),
+								dom.th('Backoff', attr.title('Time until new deliveries are attempted after rate limiting responses.')),
+							),
+						),
+						dom.tbody(
+							throttles.map(t =>
+								dom.tr(
+									dom.td(t.Name),
+									dom.td(''+t.Active + (t.MaxConcurrent ? ' / '+t.MaxConcurrent : '')),
+									dom.td(''+t.MessagesMinute + (t.MessagesPerMinute ? ' / '+t.MessagesPerMinute : '')),
+									dom.td(''+t.MessagesHour + (t.MessagesPerHour ? ' / '+t.MessagesPerHour : '')),
+									dom.td(''+t.Delivered),
+									dom.td(''+t.TempErrors),
+									dom.td(''+t.PermErrors),
+									dom.td(''+t.RateLimited),
+									dom.td(backoff(t.BackoffUntil)),
+								)
+							),
+						),
+					),
+				],
+				warmups.length === 0 ? [] : [
+					dom.h3('IP warm-up'),
+					dom.table(
+						dom.thead(
+							dom.tr(
+								dom.th('IP pool'),
+								dom.th('IP'),
+								dom.th('Day', attr.title('Day in the warm-up schedule, starting at 0.')),
+								dom.th('Delivered today', attr.title('Messages delivered today (UTC), and the maximum for today.')),
+							),
+						),
+						dom.tbody(
+							warmups.map(w =>
+								dom.tr(
+									dom.td(w.Pool),
+									dom.td(w.IP),
+									dom.td(w.Limit ? ''+w.Day : 'Warmed up'),
+									dom.td(''+w.Messages + (w.Limit ? ' / '+w.Limit : '')),
+								)
+							),
+						),
+					),
+				],
+				dom.h3('Recipient domains'),
+				dom.table(
+					dom.thead(
+						dom.tr(
+							dom.th('Domain'),
+							dom.th('Throttle'),
+							dom.th('Active'),
+							dom.th('Last attempt'),
+							dom.th('Delivered'),
+							dom.th('Temporary errors'),
+							dom.th('Permanent errors'),
+							dom.th('Rate limited', attr.title('Messages failing with a temporary error that looks like rate limiting.')),
+							dom.th('Backoff', attr.title('Time until new deliveries are attempted after rate limiting responses, for domains without throttle.')),
+						),
+					),
+					dom.tbody(
+						destinations.length === 0 ? dom.tr(dom.td(attr.colspan('9'), 'No deliveries in the past 24 hours.')) : [],
+						destinations.map(d =>
+							dom.tr(
+								dom.td(d.Domain),
+								dom.td(d.Throttle || '-'),
+								dom.td(''+d.Active),
+								dom.td(age(d.LastAttempt, false, nowSecs)),
+								dom.td(''+d.Delivered),
+								dom.td(''+d.TempErrors),
+								dom.td(''+d.PermErrors),
+								dom.td(''+d.RateLimited),
+								dom.td(backoff(d.BackoffUntil)),
+							)
+						),
+					),
+				),
+			]
+		})(),
+		dom.br(),
+
 		// Filtering.
 		filterForm=dom.form(
 			attr.id('queuefilter'), // Referenced by input elements in table row.
@@ -4238,7 +4773,7 @@ const hooksList = async () => {
 							},
 							dom.option(''),
 							// note: outgoing hook events are in ../webhook/webhook.go, ../mox-/config.go ../webadmin/admin.ts and ../webapi/gendoc.sh. keep in sync.
-							['incoming', 'delivered', 'suppressed', 'delayed', 'failed', 'relayed', 'expanded', 'canceled', 'unrecognized'].map(s => dom.option(s)),
+							['incoming', 'delivered', 'suppressed', 'delayed', 'failed', 'relayed', 'expanded', 'canceled', 'unrecognized', 'limitreached'].map(s => dom.option(s)),
 						),
 					),
 					dom.td(),
@@ -4528,7 +5063,7 @@ const hooksRetiredList = async () => {
 							},
 							dom.option(''),
 							// note: outgoing hook events are in ../webhook/webhook.go, ../mox-/config.go ../webadmin/admin.ts and ../webapi/gendoc.sh. keep in sync.
-							['incoming', 'delivered', 'suppressed', 'delayed', 'failed', 'relayed', 'expanded', 'canceled', 'unrecognized'].map(s => dom.option(s)),
+							['incoming', 'delivered', 'suppressed', 'delayed', 'failed', 'relayed', 'expanded', 'canceled', 'unrecognized', 'limitreached'].map(s => dom.option(s)),
 						),
 					),
 					dom.td(),
@@ -5044,6 +5579,7 @@ const webserver = async () => {
 							dom.option('Account', attr.value('account')),
 							dom.option('Webmail', attr.value('webmail')),
 							dom.option('Webapi', attr.value('webapi')),
+							dom.option('DAV', attr.value('dav')),
 							prop({value: wi.Service}),
 						),
 					),
@@ -5416,6 +5952,12 @@ const init = async () => {
 				root = await mtasts()
 			} else if (h === 'dnsbl') {
 				root = await dnsbl()
+			} else if (h === 'ratelimits') {
+				root = await ratelimits()
+			} else if (h === 'ipbans') {
+				root = await ipbans()
+			} else if (h === 'greylisting') {
+				root = await greylisting()
 			} else if (h === 'routes') {
 				root = await globalRoutes()
 			} else if (h === 'webserver') {
@@ -24,10 +24,12 @@ import (
 
 	"github.com/mjl-/mox/config"
 	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/greylist"
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/mox-"
 	"github.com/mjl-/mox/mtasts"
 	"github.com/mjl-/mox/queue"
+	"github.com/mjl-/mox/ratelimit"
 	"github.com/mjl-/mox/store"
 	"github.com/mjl-/mox/webauth"
 )
@@ -118,7 +120,7 @@ func TestAdminAuth(t *testing.T) {
 	loginCookie.Value = api.LoginPrep(ctx)
 	reqInfo.Request.Header = http.Header{"Cookie": []string{loginCookie.String()}}
 
-	csrfToken := api.Login(ctx, loginCookie.Value, "moxtest123")
+	csrfToken, _ := api.Login(ctx, loginCookie.Value, "moxtest123")
 	var sessionCookie *http.Cookie
 	for _, c := range respRec.Result().Cookies() {
 		if c.Name == "webadminsession" {
@@ -227,12 +229,25 @@ func TestAdmin(t *testing.T) {
 	err := queue.Init()
 	tcheck(t, err, "queue init")
 	defer queue.Shutdown()
+	err = store.Init(ctxbg)
+	tcheck(t, err, "store init")
+	defer func() {
+		err := store.Close()
+		tcheck(t, err, "store close")
+	}()
+
+	err = greylist.Init(false)
+	tcheck(t, err, "greylist init")
+	defer greylist.Close()
 
 	api := Admin{}
 
 	mrl := api.RetiredList(ctxbg, queue.RetiredFilter{}, queue.RetiredSort{})
 	tcompare(t, len(mrl), 0)
 
+	ds := api.QueueDeliveryStats(ctxbg)
+	tcompare(t, len(ds.Throttles), 0)
+
 	n := api.HookQueueSize(ctxbg)
 	tcompare(t, n, 0)
 
@@ -251,6 +266,13 @@ func TestAdmin(t *testing.T) {
 	n = api.HookCancel(ctxbg, queue.HookFilter{})
 	tcompare(t, n, 0)
 
+	su := api.AccountSendUsage(ctxbg, "mjl")
+	tcompare(t, su, queue.SendUsageCounts{})
+	tneedErrorCode(t, "user:error", func() { api.AccountSendUsage(ctxbg, "bogus") })
+	su = api.DomainSendUsage(ctxbg, "mox.example")
+	tcompare(t, su, queue.SendUsageCounts{})
+	tneedErrorCode(t, "user:error", func() { api.DomainSendUsage(ctxbg, "bogus.example") })
+
 	api.Config(ctxbg)
 	api.DomainConfig(ctxbg, "mox.example")
 	tneedErrorCode(t, "user:error", func() { api.DomainConfig(ctxbg, "bogus.example") })
@@ -259,6 +281,14 @@ func TestAdmin(t *testing.T) {
 	tneedErrorCode(t, "user:error", func() { api.AccountRoutesSave(ctxbg, "mjl", []config.Route{{Transport: "bogus"}}) })
 	api.AccountRoutesSave(ctxbg, "mjl", nil)
 
+	api.AccountSecondFactorRequiredSave(ctxbg, "mjl", true)
+	acc, _ := api.Account(ctxbg, "mjl")
+	tcompare(t, acc.RequireSecondFactor, true)
+	api.AccountSecondFactorRequiredSave(ctxbg, "mjl", false)
+	tcompare(t, api.AccountSecondFactors(ctxbg, "mjl").Enabled(), false)
+	tneedErrorCode(t, "user:error", func() { api.AccountSecondFactors(ctxbg, "bogus") })
+	api.AccountSecondFactorsClear(ctxbg, "mjl")
+
 	api.DomainRoutesSave(ctxbg, "mox.example", []config.Route{{Transport: "direct"}})
 	tneedErrorCode(t, "user:error", func() { api.DomainRoutesSave(ctxbg, "mox.example", []config.Route{{Transport: "bogus"}}) })
 	api.DomainRoutesSave(ctxbg, "mox.example", nil)
@@ -267,6 +297,39 @@ func TestAdmin(t *testing.T) {
 	tneedErrorCode(t, "user:error", func() { api.RoutesSave(ctxbg, []config.Route{{Transport: "bogus"}}) })
 	api.RoutesSave(ctxbg, nil)
 
+	rl := &ratelimit.Limiter{WindowLimits: []ratelimit.WindowLimit{{Window: time.Minute, Limits: [3]int64{1, 10, 100}}}}
+	mox.RegisterLimiter("test", rl, false)
+	rl.Add(net.ParseIP("10.0.0.1"), time.Now(), 1)
+	var entries []ratelimit.Entry
+	for _, l := range api.RateLimits(ctxbg) {
+		if l.Name == "test" {
+			entries = l.Entries
+		}
+	}
+	tcompare(t, len(entries), 3)
+	tneedErrorCode(t, "user:error", func() { api.RateLimitClear(ctxbg, "bogus", "10.0.0.1") })
+	tneedErrorCode(t, "user:error", func() { api.RateLimitClear(ctxbg, "test", "bogus") })
+	api.RateLimitClear(ctxbg, "test", "10.0.0.1")
+	tcompare(t, len(rl.Entries(time.Now())), 0)
+
+	api.IPBanAdd(ctxbg, "192.0.2.1", "24h", "test")
+	tneedErrorCode(t, "user:error", func() { api.IPBanAdd(ctxbg, "bogus", "", "") })
+	tneedErrorCode(t, "user:error", func() { api.IPBanAdd(ctxbg, "192.0.2.1", "bogus", "") })
+	api.IPAllowAdd(ctxbg, "198.51.100.0/24", "monitoring")
+	bans, allowlist := api.IPBans(ctxbg)
+	tcompare(t, len(bans), 1)
+	tcompare(t, len(allowlist), 1)
+	api.IPBanRemove(ctxbg, "192.0.2.1")
+	tneedErrorCode(t, "user:error", func() { api.IPBanRemove(ctxbg, "192.0.2.1") })
+	api.IPAllowRemove(ctxbg, "198.51.100.0/24")
+
+	gst := api.Greylisting(ctxbg)
+	tcompare(t, gst.Pending, 0)
+
+	uriblResults, uriblZones := api.URIBLStatus(ctxbg)
+	tcompare(t, len(uriblResults), 0)
+	tcompare(t, len(uriblZones), 0)
+
 	api.DomainDescriptionSave(ctxbg, "mox.example", "description")
 	tneedErrorCode(t, "server:error", func() { api.DomainDescriptionSave(ctxbg, "mox.example", "newline not ok\n") }) // todo: user error
 	tneedErrorCode(t, "user:error", func() { api.DomainDescriptionSave(ctxbg, "bogus.example", "unknown domain") })
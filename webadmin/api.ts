@@ -2,6 +2,40 @@
 
 namespace api {
 
+// SecondFactorChallenge is returned by Login when the password is valid but a
+// second factor is required. The Token must be passed to LoginSecondFactor,
+// along with a code or WebAuthn assertion.
+export interface SecondFactorChallenge {
+	Token: string
+	TOTP: boolean  // Whether a TOTP code can be used.
+	RecoveryCodes: boolean  // Whether a recovery code can be used.
+	WebAuthn?: WebAuthnRequest | null  // If non-nil, a registered security key or passkey can be used.
+}
+
+// WebAuthnRequest holds the parameters for navigator.credentials.get in the
+// browser.
+export interface WebAuthnRequest {
+	Challenge: string  // Raw-url-base64.
+	RPID: string  // Relying party ID, the host name.
+	CredentialIDs?: string[] | null  // Raw-url-base64 IDs of allowed credentials.
+}
+
+// SecondFactorResponse is the second factor for LoginSecondFactor. Either Code or
+// WebAuthn must be set.
+export interface SecondFactorResponse {
+	Code: string  // TOTP code of 6 digits, or a recovery code.
+	WebAuthn?: WebAuthnAssertion | null
+}
+
+// WebAuthnAssertion is the result of navigator.credentials.get in the browser.
+// All fields are raw-url-base64 encoded.
+export interface WebAuthnAssertion {
+	CredentialID: string
+	ClientDataJSON: string
+	AuthenticatorData: string
+	Signature: string
+}
+
 // CheckResult is the analysis of a domain, its actual configuration (DNS, TLS,
 // connectivity) and the mox configuration. It includes configuration instructions
 // (e.g. DNS records), and warnings and errors encountered.
@@ -18,6 +52,7 @@ export interface CheckResult {
 	HostTLSRPT: TLSRPTCheckResult
 	DomainTLSRPT: TLSRPTCheckResult
 	MTASTS: MTASTSCheckResult
+	BIMI: BIMICheckResult
 	SRVConf: SRVConfCheckResult
 	Autoconf: AutoconfCheckResult
 	Autodiscover: AutodiscoverCheckResult
@@ -161,6 +196,9 @@ export interface DMARCRecord {
 	FailureReportingOptions?: string[] | null  // "0" (default), "1", "d", "s". For "fo=".
 	ReportingFormat?: string[] | null  // "afrf" (default). For "rf=".
 	Percentage: number  // Between 0 and 100, default 100. For "pct=". Policy applies randomly to this percentage of messages.
+	NonexistentSubdomainPolicy: DMARCPolicy  // Like SubdomainPolicy but for subdomains that don't exist. Optional, for "np=".
+	PublicSuffixDomain: PSD  // "y", "n", "u" or empty for "u". For "psd=".
+	Testing: boolean  // Policy is being tested, should not be applied. For "t=", "y" means true.
 }
 
 // URI is a destination address for reporting.
@@ -227,6 +265,13 @@ export interface STSMX {
 	Domain: Domain
 }
 
+export interface BIMICheckResult {
+	TXT: string
+	Errors?: string[] | null
+	Warnings?: string[] | null
+	Instructions?: string[] | null
+}
+
 export interface SRVConfCheckResult {
 	SRVs?: { [key: string]: SRV[] | null }  // Service (e.g. "_imaps") to records.
 	Errors?: string[] | null
@@ -276,8 +321,11 @@ export interface ConfigDomain {
 	DMARC?: DMARC | null
 	MTASTS?: MTASTS | null
 	TLSRPT?: TLSRPT | null
+	BIMI?: BIMI | null
 	Routes?: Route[] | null
+	SendLimits?: SendLimits | null
 	Aliases?: { [key: string]: Alias }
+	AttachmentRules?: AttachmentRule[] | null
 	Domain: Domain
 	LocalpartCatchallSeparatorsEffective?: string[] | null  // Either LocalpartCatchallSeparators, the value of LocalpartCatchallSeparator, or empty.
 }
@@ -329,6 +377,13 @@ export interface TLSRPT {
 	DNSDomain: Domain  // Effective domain, always set based on Domain field or Domain where this is configured.
 }
 
+// BIMI is the configuration for the BIMI DNS record of a domain.
+export interface BIMI {
+	Selector: string
+	LogoURL: string
+	AuthorityURL: string
+}
+
 export interface Route {
 	FromDomain?: string[] | null
 	ToDomain?: string[] | null
@@ -338,6 +393,25 @@ export interface Route {
 	ToDomainASCII?: string[] | null
 }
 
+// SendLimits are limits on outgoing messages for an account or domain.
+export interface SendLimits {
+	All: SendLimitCounts
+	Submission: SendLimitCounts
+	WebAPI: SendLimitCounts
+	Policy: string
+}
+
+// SendLimitCounts are maximum numbers of messages and recipients in outgoing
+// messages in the past hour, day and month (30 days). Zero means no limit.
+export interface SendLimitCounts {
+	MessagesPerHour: number
+	MessagesPerDay: number
+	MessagesPerMonth: number
+	RecipientsPerHour: number
+	RecipientsPerDay: number
+	RecipientsPerMonth: number
+}
+
 export interface Alias {
 	Addresses?: string[] | null
 	PostPublic: boolean
@@ -382,6 +456,18 @@ export interface Ruleset {
 	ListAllowDNSDomain: Domain
 }
 
+// AttachmentRule is a policy for attachments in incoming and/or outgoing messages,
+// evaluated on each part of a message, including parts of embedded messages.
+export interface AttachmentRule {
+	Direction: string
+	ContentTypes?: string[] | null
+	Extensions?: string[] | null
+	EncryptedArchive: boolean
+	UninspectableArchive: boolean
+	MinSize: number
+	Action: string
+}
+
 export interface Account {
 	OutgoingWebhook?: OutgoingWebhook | null
 	IncomingWebhook?: IncomingWebhook | null
@@ -389,6 +475,7 @@ export interface Account {
 	KeepRetiredMessagePeriod: number
 	KeepRetiredWebhookPeriod: number
 	LoginDisabled: string
+	RequireSecondFactor: boolean
 	Domain: string
 	Description: string
 	FullName: string
@@ -401,9 +488,11 @@ export interface Account {
 	JunkFilter?: JunkFilter | null  // todo: sane defaults for junkfilter
 	MaxOutgoingMessagesPerDay: number
 	MaxFirstTimeRecipientsPerDay: number
+	SendLimits?: SendLimits | null
 	NoFirstTimeSenderDelay: boolean
 	NoCustomPassword: boolean
 	IMAPCapabilitiesDisabled?: string[] | null
+	AttachmentRules?: AttachmentRule[] | null
 	Routes?: Route[] | null
 	DNSDomain: Domain  // Parsed form of Domain.
 	Aliases?: AddressAlias[] | null
@@ -412,12 +501,14 @@ export interface Account {
 export interface OutgoingWebhook {
 	URL: string
 	Authorization: string
+	EventStreamOnly: boolean
 	Events?: string[] | null
 }
 
 export interface IncomingWebhook {
 	URL: string
 	Authorization: string
+	EventStreamOnly: boolean
 }
 
 export interface SubjectPass {
@@ -440,6 +531,7 @@ export interface JunkFilter {
 	TopWords: number
 	IgnoreWords: number
 	RareWords: number
+	Features: boolean
 }
 
 export interface AddressAlias {
@@ -448,6 +540,25 @@ export interface AddressAlias {
 	MemberAddresses?: string[] | null  // Only if allowed to see.
 }
 
+// SendUsageCounts are the counts of submitted messages for an account or domain,
+// matching the groups of limits in config.SendLimits.
+export interface SendUsageCounts {
+	All: SendCounts
+	Submission: SendCounts  // Through SMTP and webmail.
+	WebAPI: SendCounts
+}
+
+// SendCounts are the numbers of messages and recipients submitted in the past
+// hour, day and month (30 days).
+export interface SendCounts {
+	MessagesHour: number
+	MessagesDay: number
+	MessagesMonth: number
+	RecipientsHour: number
+	RecipientsDay: number
+	RecipientsMonth: number
+}
+
 // PolicyRecord is a cached policy or absence of a policy.
 export interface PolicyRecord {
 	Domain: string  // Domain name, with unicode characters.
@@ -631,8 +742,113 @@ export interface Reverse {
 	Hostnames?: string[] | null
 }
 
-// ClientConfigs holds the client configuration for IMAP/Submission for a
-// domain.
+// RateLimiter has the non-zero counts for IPs and networks in the current
+// windows of a rate limiter. A count at or above its limit means the IP/network
+// is currently limited.
+export interface RateLimiter {
+	Name: string
+	Open: boolean  // Limiter for open connections, counts cannot be cleared.
+	Entries?: RateLimitEntry[] | null
+}
+
+// Entry is a count for an IP class/subnet in the current time window of a limiter.
+export interface RateLimitEntry {
+	Window: number
+	Time: number  // Time/Window, identifies the window.
+	Index: number  // IP class/subnet, 0 for a single IP (or IPv6 /64), 1 and 2 for the larger networks.
+	Net: string  // IP or network in CIDR notation.
+	Count: number
+	Limit: number  // Limit for this IP class/subnet in this window.
+}
+
+// IPBan is a ban of an IP or network. Connections from banned IPs are refused by
+// all listeners.
+// 
+// Bans are added automatically after repeated failed authentication attempts
+// (see LoginAttempt), or manually by the admin. Expired automatic bans are kept
+// for 30 days, for escalating the duration of a next ban.
+export interface IPBan {
+	Net: string  // IP network in CIDR notation, e.g. 192.0.2.1/32 or 2001:db8::/64.
+	Created: Date
+	Expires: Date  // Zero for bans that don't expire.
+	Reason: string
+	Automatic: boolean  // Whether the ban was added due to failed authentication attempts.
+	Count: number  // Number of automatic bans, doubling the duration of each next ban.
+}
+
+// IPAllow is an IP or network that is never banned.
+export interface IPAllow {
+	Net: string  // IP network in CIDR notation.
+	Created: Date
+	Comment: string
+}
+
+// Stats has the numbers of greylisting records, and the most recently seen
+// pending triplets, allowlisted groups and known domains.
+export interface GreylistStats {
+	Pending: number  // Triplets that have not yet passed greylisting.
+	Passed: number  // Triplets that have passed greylisting.
+	AllowedGroups: number
+	KnownDomains: number
+	RecentPending?: Triplet[] | null
+	RecentAllowed?: AllowedGroup[] | null
+	RecentKnown?: KnownDomain[] | null
+}
+
+// Triplet is a delivery attempt for a recipient, from a remote IP group and
+// MAIL FROM address.
+export interface Triplet {
+	ID: number
+	Group: string  // IP network, or "spf:" and SPF-verified MAIL FROM domain.
+	MailFrom: string  // Empty for null sender.
+	RcptTo: string
+	FirstSeen: Date
+	LastSeen: Date
+	Attempts: number  // Delivery attempts, including the first.
+	Passed: Date  // Time of first accepted retry. Zero if not yet passed.
+	Expires: Date  // End of retry window, or of allowlisting after passing.
+}
+
+// AllowedGroup is a remote IP group that has passed greylisting, and is
+// allowlisted until it expires.
+export interface AllowedGroup {
+	Group: string  // IP network, or "spf:" and SPF-verified MAIL FROM domain.
+	Added: Date
+	LastSeen: Date
+	Deliveries: number  // Delivery attempts that passed greylisting, including the first.
+	Expires: Date
+}
+
+// KnownDomain is a DKIM- or SPF-verified domain of a message that has passed
+// greylisting. Later messages with a verified known domain are not greylisted,
+// regardless of the remote IP.
+export interface KnownDomain {
+	Domain: string  // Domain name with unicode characters.
+	Added: Date
+	LastSeen: Date
+	Deliveries: number
+	Expires: Date
+}
+
+// SecondFactorStatus describes the second factors configured for an account.
+export interface SecondFactorStatus {
+	TOTP: boolean  // Whether a confirmed TOTP secret is present.
+	WebAuthn?: WebAuthnCredential[] | null
+	RecoveryCodesUnused: number
+}
+
+// WebAuthnCredential is a registered security key or passkey, used as second
+// factor for logins to the web interfaces.
+export interface WebAuthnCredential {
+	ID: number
+	Created: Date
+	Name: string  // Descriptive name to identify the credential, e.g. the type of security key.
+	CredentialID: string  // Raw-url-base64 credential ID, as chosen by the authenticator.
+	LastUsed?: Date | null  // Time of last use, nil if never used.
+}
+
+// ClientConfigs holds the client configuration for IMAP/Submission and
+// CalDAV/CardDAV for a domain.
 export interface ClientConfigs {
 	Entries?: ClientConfigsEntry[] | null
 }
@@ -657,6 +873,54 @@ export interface HoldRule {
 	RecipientDomainStr: string  // Unicode.
 }
 
+// DeliveryStats holds the state of destination throttles, statistics about
+// deliveries to recipient domains, and the warm-up state of IPs in IP pools.
+export interface DeliveryStats {
+	Throttles?: ThrottleStats[] | null
+	Destinations?: DestinationStats[] | null  // Most recent delivery attempt first.
+	IPWarmups?: IPWarmupStats[] | null
+}
+
+// ThrottleStats holds the state of a destination throttle, with statistics since
+// startup.
+export interface ThrottleStats {
+	Name: string
+	MaxConcurrent: number  // From configuration, 0 means no limit.
+	MessagesPerMinute: number  // From configuration, 0 means no limit.
+	MessagesPerHour: number  // From configuration, 0 means no limit.
+	Active: number  // Current number of deliveries.
+	MessagesMinute: number  // Messages in deliveries started in the past minute.
+	MessagesHour: number  // Messages in deliveries started in the past hour.
+	Delivered: number
+	TempErrors: number
+	PermErrors: number
+	RateLimited: number
+	BackoffUntil: Date  // While in the future, no deliveries are started due to rate limiting responses.
+}
+
+// DestinationStats holds statistics about deliveries to a recipient domain, since
+// startup. Domains without delivery attempts in the past 24 hours are not kept.
+export interface DestinationStats {
+	Domain: string  // Recipient domain, or IP address in brackets.
+	Throttle: string  // Name of matching destination throttle, if any.
+	Active: number  // Current number of deliveries.
+	Delivered: number  // Messages delivered.
+	TempErrors: number  // Messages that failed with a temporary error, excluding rate limiting.
+	PermErrors: number  // Messages that failed with a permanent error.
+	RateLimited: number  // Messages that failed with a response that looks like rate limiting.
+	LastAttempt: Date  // Start of most recent delivery.
+	BackoffUntil: Date  // For domains without throttle. While in the future, no deliveries are started due to rate limiting responses.
+}
+
+// IPWarmupStats is the warm-up state of an IP in an IP pool for today.
+export interface IPWarmupStats {
+	Pool: string
+	IP: string
+	Day: number  // Day in the warm-up schedule, starting at 0. Beyond the schedule when warmed up.
+	Limit: number  // Maximum number of messages for today. Zero if warmed up, i.e. no limit.
+	Messages: number  // Messages delivered today.
+}
+
 // Filter filters messages to list or operate on. Used by admin web interface
 // and cli.
 // 
@@ -825,14 +1089,14 @@ export interface Hook {
 	Subject: string  // Subject of original outgoing message, or of incoming message.
 	Extra?: { [key: string]: string }  // From submitted message.
 	Account: string
-	URL: string  // Taken from config when webhook is scheduled.
+	URL: string  // Taken from config when webhook is scheduled. Empty for hooks that are only available through the webapi event stream.
 	Authorization: string  // Optional value for authorization header to include in HTTP request.
 	IsIncoming: boolean
 	OutgoingEvent: string  // Empty string if not outgoing.
 	Payload: string  // JSON data to be submitted.
 	Submitted: Date
 	Attempts: number
-	NextAttempt: Date  // Index for fast scheduling.
+	NextAttempt: Date  // Index for fast scheduling. For hooks without URL, the time at which the hook is retired as failed if it hasn't been acknowledged through the event stream.
 	Results?: HookResult[] | null
 }
 
@@ -878,7 +1142,7 @@ export interface HookRetired {
 	Subject: string  // Subject of original outgoing message, or of incoming message.
 	Extra?: { [key: string]: string }  // From submitted message.
 	Account: string
-	URL: string  // Taken from config at start of each attempt.
+	URL: string  // Taken from config at start of each attempt. Empty for hooks only available through the webapi event stream.
 	Authorization: boolean  // Whether request had authorization without keeping it around.
 	IsIncoming: boolean
 	OutgoingEvent: string
@@ -980,6 +1244,7 @@ export interface TransportSocks {
 export interface TransportDirect {
 	DisableIPv4: boolean
 	DisableIPv6: boolean
+	IPPool: string
 }
 
 // TransportFail is a transport that fails all delivery attempts.
@@ -1008,7 +1273,7 @@ export interface Evaluation {
 	Optional: boolean  // If optional, this evaluation is not a reason to send a DMARC report, but it will be included when a report is sent due to other non-optional evaluations. Set for evaluations of incoming DMARC reports. We don't want such deliveries causing us to send a report, or we would keep exchanging reporting messages forever. Also set for when evaluation is a DMARC reject for domains we haven't positively interacted with, to prevent being used to flood an unsuspecting domain with reports.
 	IntervalHours: number  // Effective aggregate reporting interval in hours. Between 1 and 24, rounded up from seconds from policy to first number that can divide 24.
 	Addresses?: string[] | null  // "rua" in DMARC record, we only store evaluations for records with aggregate reporting addresses, so always non-empty.
-	PolicyPublished: PolicyPublished  // Policy used for evaluation. We don't store the "fo" field for failure reporting options, since we don't send failure reports for individual messages.
+	PolicyPublished: PolicyPublished  // Policy used for evaluation. We don't store the "fo" field for failure reporting options, failure reports for individual messages are sent at delivery time.
 	SourceIP: string  // For "row" in a report record.
 	Disposition: string
 	AlignedDKIMPass: boolean
@@ -1098,9 +1363,12 @@ export interface LoginAttempt {
 	LocalIP: string
 	TLS: string  // Empty if no TLS, otherwise contains version, algorithm, properties, etc.
 	TLSPubKeyFingerprint: string
-	Protocol: string  // "submission", "imap", "webmail", "webaccount", "webadmin"
+	Protocol: string  // "submission", "imap", "webmail", "webaccount", "webadmin", "webapi", "dav"
 	UserAgent: string  // From HTTP header, or IMAP ID command.
-	AuthMech: string  // "plain", "login", "cram-md5", "scram-sha-256-plus", "(unrecognized)", etc
+	AuthMech: string  // "plain", "login", "cram-md5", "scram-sha-256-plus", "apikey", "(unrecognized)", etc
+	APIKeyName: string  // Name of API key, for AuthMech "apikey".
+	AppPasswordName: string  // Name of app password, if one was used instead of the account password.
+	SecondFactor: string  // For web logins with a second factor: "totp", "recoverycode" or "webauthn".
 	Result: AuthResult
 }
 
@@ -1120,6 +1388,15 @@ export enum Align {
 	AlignRelaxed = "r",  // Relaxed requires either an exact or subdomain name match.
 }
 
+// PSD indicates if a DMARC record is for a public suffix domain, for "psd=" in
+// DMARCbis.
+export enum PSD {
+	PSDEmpty = "",  // Absent, treated as "u".
+	PSDUnknown = "u",  // Default.
+	PSDYes = "y",  // Public suffix domain, its direct subdomains are organizational domains.
+	PSDNo = "n",  // Organizational domain.
+}
+
 // RUA is a reporting address with scheme and special characters ",", "!" and
 // ";" not encoded.
 export type RUA = string
@@ -1157,15 +1434,20 @@ export enum AuthResult {
 	AuthBadChannelBinding = "badchanbind",
 	AuthBadProtocol = "badprotocol",
 	AuthLoginDisabled = "logindisabled",
+	AuthSecondFactorRequired = "secondfactor",  // Valid password, login continues with second factor.
 	AuthError = "error",
 	AuthAborted = "aborted",
 }
 
-export const structTypes: {[typename: string]: boolean} = {"Account":true,"Address":true,"AddressAlias":true,"Alias":true,"AliasAddress":true,"AuthResults":true,"AutoconfCheckResult":true,"AutodiscoverCheckResult":true,"AutodiscoverSRV":true,"AutomaticJunkFlags":true,"Canonicalization":true,"CheckResult":true,"ClientConfigs":true,"ClientConfigsEntry":true,"ConfigDomain":true,"DANECheckResult":true,"DKIM":true,"DKIMAuthResult":true,"DKIMCheckResult":true,"DKIMRecord":true,"DMARC":true,"DMARCCheckResult":true,"DMARCRecord":true,"DMARCSummary":true,"DNSSECResult":true,"DateRange":true,"Destination":true,"Directive":true,"Domain":true,"DomainFeedback":true,"Dynamic":true,"Evaluation":true,"EvaluationStat":true,"Extension":true,"FailureDetails":true,"Filter":true,"HoldRule":true,"Hook":true,"HookFilter":true,"HookResult":true,"HookRetired":true,"HookRetiredFilter":true,"HookRetiredSort":true,"HookSort":true,"IPDomain":true,"IPRevCheckResult":true,"Identifiers":true,"IncomingWebhook":true,"JunkFilter":true,"LoginAttempt":true,"MTASTS":true,"MTASTSCheckResult":true,"MTASTSRecord":true,"MX":true,"MXCheckResult":true,"Modifier":true,"Msg":true,"MsgResult":true,"MsgRetired":true,"OutgoingWebhook":true,"Pair":true,"Policy":true,"PolicyEvaluated":true,"PolicyOverrideReason":true,"PolicyPublished":true,"PolicyRecord":true,"Record":true,"Report":true,"ReportMetadata":true,"ReportRecord":true,"Result":true,"ResultPolicy":true,"RetiredFilter":true,"RetiredSort":true,"Reverse":true,"Route":true,"Row":true,"Ruleset":true,"SMTPAuth":true,"SPFAuthResult":true,"SPFCheckResult":true,"SPFRecord":true,"SRV":true,"SRVConfCheckResult":true,"STSMX":true,"Selector":true,"Sort":true,"SubjectPass":true,"Summary":true,"SuppressAddress":true,"TLSCheckResult":true,"TLSPublicKey":true,"TLSRPT":true,"TLSRPTCheckResult":true,"TLSRPTDateRange":true,"TLSRPTRecord":true,"TLSRPTSummary":true,"TLSRPTSuppressAddress":true,"TLSReportRecord":true,"TLSResult":true,"Transport":true,"TransportDirect":true,"TransportFail":true,"TransportSMTP":true,"TransportSocks":true,"URI":true,"WebForward":true,"WebHandler":true,"WebInternal":true,"WebRedirect":true,"WebStatic":true,"WebserverConfig":true}
-export const stringsTypes: {[typename: string]: boolean} = {"Align":true,"AuthResult":true,"CSRFToken":true,"DMARCPolicy":true,"IP":true,"Localpart":true,"Mode":true,"RUA":true}
+export const structTypes: {[typename: string]: boolean} = {"Account":true,"Address":true,"AddressAlias":true,"Alias":true,"AliasAddress":true,"AllowedGroup":true,"AttachmentRule":true,"AuthResults":true,"AutoconfCheckResult":true,"AutodiscoverCheckResult":true,"AutodiscoverSRV":true,"AutomaticJunkFlags":true,"BIMI":true,"BIMICheckResult":true,"Canonicalization":true,"CheckResult":true,"ClientConfigs":true,"ClientConfigsEntry":true,"ConfigDomain":true,"DANECheckResult":true,"DKIM":true,"DKIMAuthResult":true,"DKIMCheckResult":true,"DKIMRecord":true,"DMARC":true,"DMARCCheckResult":true,"DMARCRecord":true,"DMARCSummary":true,"DNSSECResult":true,"DateRange":true,"DeliveryStats":true,"Destination":true,"DestinationStats":true,"Directive":true,"Domain":true,"DomainFeedback":true,"Dynamic":true,"Evaluation":true,"EvaluationStat":true,"Extension":true,"FailureDetails":true,"Filter":true,"GreylistStats":true,"HoldRule":true,"Hook":true,"HookFilter":true,"HookResult":true,"HookRetired":true,"HookRetiredFilter":true,"HookRetiredSort":true,"HookSort":true,"IPAllow":true,"IPBan":true,"IPDomain":true,"IPRevCheckResult":true,"IPWarmupStats":true,"Identifiers":true,"IncomingWebhook":true,"JunkFilter":true,"KnownDomain":true,"LoginAttempt":true,"MTASTS":true,"MTASTSCheckResult":true,"MTASTSRecord":true,"MX":true,"MXCheckResult":true,"Modifier":true,"Msg":true,"MsgResult":true,"MsgRetired":true,"OutgoingWebhook":true,"Pair":true,"Policy":true,"PolicyEvaluated":true,"PolicyOverrideReason":true,"PolicyPublished":true,"PolicyRecord":true,"RateLimitEntry":true,"RateLimiter":true,"Record":true,"Report":true,"ReportMetadata":true,"ReportRecord":true,"Result":true,"ResultPolicy":true,"RetiredFilter":true,"RetiredSort":true,"Reverse":true,"Route":true,"Row":true,"Ruleset":true,"SMTPAuth":true,"SPFAuthResult":true,"SPFCheckResult":true,"SPFRecord":true,"SRV":true,"SRVConfCheckResult":true,"STSMX":true,"SecondFactorChallenge":true,"SecondFactorResponse":true,"SecondFactorStatus":true,"Selector":true,"SendCounts":true,"SendLimitCounts":true,"SendLimits":true,"SendUsageCounts":true,"Sort":true,"SubjectPass":true,"Summary":true,"SuppressAddress":true,"TLSCheckResult":true,"TLSPublicKey":true,"TLSRPT":true,"TLSRPTCheckResult":true,"TLSRPTDateRange":true,"TLSRPTRecord":true,"TLSRPTSummary":true,"TLSRPTSuppressAddress":true,"TLSReportRecord":true,"TLSResult":true,"ThrottleStats":true,"Transport":true,"TransportDirect":true,"TransportFail":true,"TransportSMTP":true,"TransportSocks":true,"Triplet":true,"URI":true,"WebAuthnAssertion":true,"WebAuthnCredential":true,"WebAuthnRequest":true,"WebForward":true,"WebHandler":true,"WebInternal":true,"WebRedirect":true,"WebStatic":true,"WebserverConfig":true}
+export const stringsTypes: {[typename: string]: boolean} = {"Align":true,"AuthResult":true,"CSRFToken":true,"DMARCPolicy":true,"IP":true,"Localpart":true,"Mode":true,"PSD":true,"RUA":true}
 export const intsTypes: {[typename: string]: boolean} = {}
 export const types: TypenameMap = {
-	"CheckResult": {"Name":"CheckResult","Docs":"","Fields":[{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"DNSSEC","Docs":"","Typewords":["DNSSECResult"]},{"Name":"IPRev","Docs":"","Typewords":["IPRevCheckResult"]},{"Name":"MX","Docs":"","Typewords":["MXCheckResult"]},{"Name":"TLS","Docs":"","Typewords":["TLSCheckResult"]},{"Name":"DANE","Docs":"","Typewords":["DANECheckResult"]},{"Name":"SPF","Docs":"","Typewords":["SPFCheckResult"]},{"Name":"DKIM","Docs":"","Typewords":["DKIMCheckResult"]},{"Name":"DMARC","Docs":"","Typewords":["DMARCCheckResult"]},{"Name":"HostTLSRPT","Docs":"","Typewords":["TLSRPTCheckResult"]},{"Name":"DomainTLSRPT","Docs":"","Typewords":["TLSRPTCheckResult"]},{"Name":"MTASTS","Docs":"","Typewords":["MTASTSCheckResult"]},{"Name":"SRVConf","Docs":"","Typewords":["SRVConfCheckResult"]},{"Name":"Autoconf","Docs":"","Typewords":["AutoconfCheckResult"]},{"Name":"Autodiscover","Docs":"","Typewords":["AutodiscoverCheckResult"]}]},
+	"SecondFactorChallenge": {"Name":"SecondFactorChallenge","Docs":"","Fields":[{"Name":"Token","Docs":"","Typewords":["string"]},{"Name":"TOTP","Docs":"","Typewords":["bool"]},{"Name":"RecoveryCodes","Docs":"","Typewords":["bool"]},{"Name":"WebAuthn","Docs":"","Typewords":["nullable","WebAuthnRequest"]}]},
+	"WebAuthnRequest": {"Name":"WebAuthnRequest","Docs":"","Fields":[{"Name":"Challenge","Docs":"","Typewords":["string"]},{"Name":"RPID","Docs":"","Typewords":["string"]},{"Name":"CredentialIDs","Docs":"","Typewords":["[]","string"]}]},
+	"SecondFactorResponse": {"Name":"SecondFactorResponse","Docs":"","Fields":[{"Name":"Code","Docs":"","Typewords":["string"]},{"Name":"WebAuthn","Docs":"","Typewords":["nullable","WebAuthnAssertion"]}]},
+	"WebAuthnAssertion": {"Name":"WebAuthnAssertion","Docs":"","Fields":[{"Name":"CredentialID","Docs":"","Typewords":["string"]},{"Name":"ClientDataJSON","Docs":"","Typewords":["string"]},{"Name":"AuthenticatorData","Docs":"","Typewords":["string"]},{"Name":"Signature","Docs":"","Typewords":["string"]}]},
+	"CheckResult": {"Name":"CheckResult","Docs":"","Fields":[{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"DNSSEC","Docs":"","Typewords":["DNSSECResult"]},{"Name":"IPRev","Docs":"","Typewords":["IPRevCheckResult"]},{"Name":"MX","Docs":"","Typewords":["MXCheckResult"]},{"Name":"TLS","Docs":"","Typewords":["TLSCheckResult"]},{"Name":"DANE","Docs":"","Typewords":["DANECheckResult"]},{"Name":"SPF","Docs":"","Typewords":["SPFCheckResult"]},{"Name":"DKIM","Docs":"","Typewords":["DKIMCheckResult"]},{"Name":"DMARC","Docs":"","Typewords":["DMARCCheckResult"]},{"Name":"HostTLSRPT","Docs":"","Typewords":["TLSRPTCheckResult"]},{"Name":"DomainTLSRPT","Docs":"","Typewords":["TLSRPTCheckResult"]},{"Name":"MTASTS","Docs":"","Typewords":["MTASTSCheckResult"]},{"Name":"BIMI","Docs":"","Typewords":["BIMICheckResult"]},{"Name":"SRVConf","Docs":"","Typewords":["SRVConfCheckResult"]},{"Name":"Autoconf","Docs":"","Typewords":["AutoconfCheckResult"]},{"Name":"Autodiscover","Docs":"","Typewords":["AutodiscoverCheckResult"]}]},
 	"DNSSECResult": {"Name":"DNSSECResult","Docs":"","Fields":[{"Name":"Errors","Docs":"","Typewords":["[]","string"]},{"Name":"Warnings","Docs":"","Typewords":["[]","string"]},{"Name":"Instructions","Docs":"","Typewords":["[]","string"]}]},
 	"IPRevCheckResult": {"Name":"IPRevCheckResult","Docs":"","Fields":[{"Name":"Hostname","Docs":"","Typewords":["Domain"]},{"Name":"IPNames","Docs":"","Typewords":["{}","[]","string"]},{"Name":"Errors","Docs":"","Typewords":["[]","string"]},{"Name":"Warnings","Docs":"","Typewords":["[]","string"]},{"Name":"Instructions","Docs":"","Typewords":["[]","string"]}]},
 	"Domain": {"Name":"Domain","Docs":"","Fields":[{"Name":"ASCII","Docs":"","Typewords":["string"]},{"Name":"Unicode","Docs":"","Typewords":["string"]}]},
@@ -1181,7 +1463,7 @@ export const types: TypenameMap = {
 	"DKIMRecord": {"Name":"DKIMRecord","Docs":"","Fields":[{"Name":"Selector","Docs":"","Typewords":["string"]},{"Name":"TXT","Docs":"","Typewords":["string"]},{"Name":"Record","Docs":"","Typewords":["nullable","Record"]}]},
 	"Record": {"Name":"Record","Docs":"","Fields":[{"Name":"Version","Docs":"","Typewords":["string"]},{"Name":"Hashes","Docs":"","Typewords":["[]","string"]},{"Name":"Key","Docs":"","Typewords":["string"]},{"Name":"Notes","Docs":"","Typewords":["string"]},{"Name":"Pubkey","Docs":"","Typewords":["nullable","string"]},{"Name":"Services","Docs":"","Typewords":["[]","string"]},{"Name":"Flags","Docs":"","Typewords":["[]","string"]}]},
 	"DMARCCheckResult": {"Name":"DMARCCheckResult","Docs":"","Fields":[{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"TXT","Docs":"","Typewords":["string"]},{"Name":"Record","Docs":"","Typewords":["nullable","DMARCRecord"]},{"Name":"Errors","Docs":"","Typewords":["[]","string"]},{"Name":"Warnings","Docs":"","Typewords":["[]","string"]},{"Name":"Instructions","Docs":"","Typewords":["[]","string"]}]},
-	"DMARCRecord": {"Name":"DMARCRecord","Docs":"","Fields":[{"Name":"Version","Docs":"","Typewords":["string"]},{"Name":"Policy","Docs":"","Typewords":["DMARCPolicy"]},{"Name":"SubdomainPolicy","Docs":"","Typewords":["DMARCPolicy"]},{"Name":"AggregateReportAddresses","Docs":"","Typewords":["[]","URI"]},{"Name":"FailureReportAddresses","Docs":"","Typewords":["[]","URI"]},{"Name":"ADKIM","Docs":"","Typewords":["Align"]},{"Name":"ASPF","Docs":"","Typewords":["Align"]},{"Name":"AggregateReportingInterval","Docs":"","Typewords":["int32"]},{"Name":"FailureReportingOptions","Docs":"","Typewords":["[]","string"]},{"Name":"ReportingFormat","Docs":"","Typewords":["[]","string"]},{"Name":"Percentage","Docs":"","Typewords":["int32"]}]},
+	"DMARCRecord": {"Name":"DMARCRecord","Docs":"","Fields":[{"Name":"Version","Docs":"","Typewords":["string"]},{"Name":"Policy","Docs":"","Typewords":["DMARCPolicy"]},{"Name":"SubdomainPolicy","Docs":"","Typewords":["DMARCPolicy"]},{"Name":"AggregateReportAddresses","Docs":"","Typewords":["[]","URI"]},{"Name":"FailureReportAddresses","Docs":"","Typewords":["[]","URI"]},{"Name":"ADKIM","Docs":"","Typewords":["Align"]},{"Name":"ASPF","Docs":"","Typewords":["Align"]},{"Name":"AggregateReportingInterval","Docs":"","Typewords":["int32"]},{"Name":"FailureReportingOptions","Docs":"","Typewords":["[]","string"]},{"Name":"ReportingFormat","Docs":"","Typewords":["[]","string"]},{"Name":"Percentage","Docs":"","Typewords":["int32"]},{"Name":"NonexistentSubdomainPolicy","Docs":"","Typewords":["DMARCPolicy"]},{"Name":"PublicSuffixDomain","Docs":"","Typewords":["PSD"]},{"Name":"Testing","Docs":"","Typewords":["bool"]}]},
 	"URI": {"Name":"URI","Docs":"","Fields":[{"Name":"Address","Docs":"","Typewords":["string"]},{"Name":"MaxSize","Docs":"","Typewords":["uint64"]},{"Name":"Unit","Docs":"","Typewords":["string"]}]},
 	"TLSRPTCheckResult": {"Name":"TLSRPTCheckResult","Docs":"","Fields":[{"Name":"TXT","Docs":"","Typewords":["string"]},{"Name":"Record","Docs":"","Typewords":["nullable","TLSRPTRecord"]},{"Name":"Errors","Docs":"","Typewords":["[]","string"]},{"Name":"Warnings","Docs":"","Typewords":["[]","string"]},{"Name":"Instructions","Docs":"","Typewords":["[]","string"]}]},
 	"TLSRPTRecord": {"Name":"TLSRPTRecord","Docs":"","Fields":[{"Name":"Version","Docs":"","Typewords":["string"]},{"Name":"RUAs","Docs":"","Typewords":["[]","[]","RUA"]},{"Name":"Extensions","Docs":"","Typewords":["[]","Extension"]}]},
@@ -1191,31 +1473,38 @@ export const types: TypenameMap = {
 	"Pair": {"Name":"Pair","Docs":"","Fields":[{"Name":"Key","Docs":"","Typewords":["string"]},{"Name":"Value","Docs":"","Typewords":["string"]}]},
 	"Policy": {"Name":"Policy","Docs":"","Fields":[{"Name":"Version","Docs":"","Typewords":["string"]},{"Name":"Mode","Docs":"","Typewords":["Mode"]},{"Name":"MX","Docs":"","Typewords":["[]","STSMX"]},{"Name":"MaxAgeSeconds","Docs":"","Typewords":["int32"]},{"Name":"Extensions","Docs":"","Typewords":["[]","Pair"]}]},
 	"STSMX": {"Name":"STSMX","Docs":"","Fields":[{"Name":"Wildcard","Docs":"","Typewords":["bool"]},{"Name":"Domain","Docs":"","Typewords":["Domain"]}]},
+	"BIMICheckResult": {"Name":"BIMICheckResult","Docs":"","Fields":[{"Name":"TXT","Docs":"","Typewords":["string"]},{"Name":"Errors","Docs":"","Typewords":["[]","string"]},{"Name":"Warnings","Docs":"","Typewords":["[]","string"]},{"Name":"Instructions","Docs":"","Typewords":["[]","string"]}]},
 	"SRVConfCheckResult": {"Name":"SRVConfCheckResult","Docs":"","Fields":[{"Name":"SRVs","Docs":"","Typewords":["{}","[]","SRV"]},{"Name":"Errors","Docs":"","Typewords":["[]","string"]},{"Name":"Warnings","Docs":"","Typewords":["[]","string"]},{"Name":"Instructions","Docs":"","Typewords":["[]","string"]}]},
 	"SRV": {"Name":"SRV","Docs":"","Fields":[{"Name":"Target","Docs":"","Typewords":["string"]},{"Name":"Port","Docs":"","Typewords":["uint16"]},{"Name":"Priority","Docs":"","Typewords":["uint16"]},{"Name":"Weight","Docs":"","Typewords":["uint16"]}]},
 	"AutoconfCheckResult": {"Name":"AutoconfCheckResult","Docs":"","Fields":[{"Name":"ClientSettingsDomainIPs","Docs":"","Typewords":["[]","string"]},{"Name":"IPs","Docs":"","Typewords":["[]","string"]},{"Name":"Errors","Docs":"","Typewords":["[]","string"]},{"Name":"Warnings","Docs":"","Typewords":["[]","string"]},{"Name":"Instructions","Docs":"","Typewords":["[]","string"]}]},
 	"AutodiscoverCheckResult": {"Name":"AutodiscoverCheckResult","Docs":"","Fields":[{"Name":"Records","Docs":"","Typewords":["[]","AutodiscoverSRV"]},{"Name":"Errors","Docs":"","Typewords":["[]","string"]},{"Name":"Warnings","Docs":"","Typewords":["[]","string"]},{"Name":"Instructions","Docs":"","Typewords":["[]","string"]}]},
 	"AutodiscoverSRV": {"Name":"AutodiscoverSRV","Docs":"","Fields":[{"Name":"Target","Docs":"","Typewords":["string"]},{"Name":"Port","Docs":"","Typewords":["uint16"]},{"Name":"Priority","Docs":"","Typewords":["uint16"]},{"Name":"Weight","Docs":"","Typewords":["uint16"]},{"Name":"IPs","Docs":"","Typewords":["[]","string"]}]},
-	"ConfigDomain": {"Name":"ConfigDomain","Docs":"","Fields":[{"Name":"Disabled","Docs":"","Typewords":["bool"]},{"Name":"Description","Docs":"","Typewords":["string"]},{"Name":"ClientSettingsDomain","Docs":"","Typewords":["string"]},{"Name":"LocalpartCatchallSeparator","Docs":"","Typewords":["string"]},{"Name":"LocalpartCatchallSeparators","Docs":"","Typewords":["[]","string"]},{"Name":"LocalpartCaseSensitive","Docs":"","Typewords":["bool"]},{"Name":"DKIM","Docs":"","Typewords":["DKIM"]},{"Name":"DMARC","Docs":"","Typewords":["nullable","DMARC"]},{"Name":"MTASTS","Docs":"","Typewords":["nullable","MTASTS"]},{"Name":"TLSRPT","Docs":"","Typewords":["nullable","TLSRPT"]},{"Name":"Routes","Docs":"","Typewords":["[]","Route"]},{"Name":"Aliases","Docs":"","Typewords":["{}","Alias"]},{"Name":"Domain","Docs":"","Typewords":["Domain"]},{"Name":"LocalpartCatchallSeparatorsEffective","Docs":"","Typewords":["[]","string"]}]},
+	"ConfigDomain": {"Name":"ConfigDomain","Docs":"","Fields":[{"Name":"Disabled","Docs":"","Typewords":["bool"]},{"Name":"Description","Docs":"","Typewords":["string"]},{"Name":"ClientSettingsDomain","Docs":"","Typewords":["string"]},{"Name":"LocalpartCatchallSeparator","Docs":"","Typewords":["string"]},{"Name":"LocalpartCatchallSeparators","Docs":"","Typewords":["[]","string"]},{"Name":"LocalpartCaseSensitive","Docs":"","Typewords":["bool"]},{"Name":"DKIM","Docs":"","Typewords":["DKIM"]},{"Name":"DMARC","Docs":"","Typewords":["nullable","DMARC"]},{"Name":"MTASTS","Docs":"","Typewords":["nullable","MTASTS"]},{"Name":"TLSRPT","Docs":"","Typewords":["nullable","TLSRPT"]},{"Name":"BIMI","Docs":"","Typewords":["nullable","BIMI"]},{"Name":"Routes","Docs":"","Typewords":["[]","Route"]},{"Name":"SendLimits","Docs":"","Typewords":["nullable","SendLimits"]},{"Name":"Aliases","Docs":"","Typewords":["{}","Alias"]},{"Name":"AttachmentRules","Docs":"","Typewords":["[]","AttachmentRule"]},{"Name":"Domain","Docs":"","Typewords":["Domain"]},{"Name":"LocalpartCatchallSeparatorsEffective","Docs":"","Typewords":["[]","string"]}]},
 	"DKIM": {"Name":"DKIM","Docs":"","Fields":[{"Name":"Selectors","Docs":"","Typewords":["{}","Selector"]},{"Name":"Sign","Docs":"","Typewords":["[]","string"]}]},
 	"Selector": {"Name":"Selector","Docs":"","Fields":[{"Name":"Hash","Docs":"","Typewords":["string"]},{"Name":"HashEffective","Docs":"","Typewords":["string"]},{"Name":"Canonicalization","Docs":"","Typewords":["Canonicalization"]},{"Name":"Headers","Docs":"","Typewords":["[]","string"]},{"Name":"HeadersEffective","Docs":"","Typewords":["[]","string"]},{"Name":"DontSealHeaders","Docs":"","Typewords":["bool"]},{"Name":"Expiration","Docs":"","Typewords":["string"]},{"Name":"PrivateKeyFile","Docs":"","Typewords":["string"]},{"Name":"Algorithm","Docs":"","Typewords":["string"]}]},
 	"Canonicalization": {"Name":"Canonicalization","Docs":"","Fields":[{"Name":"HeaderRelaxed","Docs":"","Typewords":["bool"]},{"Name":"BodyRelaxed","Docs":"","Typewords":["bool"]}]},
 	"DMARC": {"Name":"DMARC","Docs":"","Fields":[{"Name":"Localpart","Docs":"","Typewords":["string"]},{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"Mailbox","Docs":"","Typewords":["string"]},{"Name":"ParsedLocalpart","Docs":"","Typewords":["Localpart"]},{"Name":"DNSDomain","Docs":"","Typewords":["Domain"]}]},
 	"MTASTS": {"Name":"MTASTS","Docs":"","Fields":[{"Name":"PolicyID","Docs":"","Typewords":["string"]},{"Name":"Mode","Docs":"","Typewords":["Mode"]},{"Name":"MaxAge","Docs":"","Typewords":["int64"]},{"Name":"MX","Docs":"","Typewords":["[]","string"]}]},
 	"TLSRPT": {"Name":"TLSRPT","Docs":"","Fields":[{"Name":"Localpart","Docs":"","Typewords":["string"]},{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"Mailbox","Docs":"","Typewords":["string"]},{"Name":"ParsedLocalpart","Docs":"","Typewords":["Localpart"]},{"Name":"DNSDomain","Docs":"","Typewords":["Domain"]}]},
+	"BIMI": {"Name":"BIMI","Docs":"","Fields":[{"Name":"Selector","Docs":"","Typewords":["string"]},{"Name":"LogoURL","Docs":"","Typewords":["string"]},{"Name":"AuthorityURL","Docs":"","Typewords":["string"]}]},
 	"Route": {"Name":"Route","Docs":"","Fields":[{"Name":"FromDomain","Docs":"","Typewords":["[]","string"]},{"Name":"ToDomain","Docs":"","Typewords":["[]","string"]},{"Name":"MinimumAttempts","Docs":"","Typewords":["int32"]},{"Name":"Transport","Docs":"","Typewords":["string"]},{"Name":"FromDomainASCII","Docs":"","Typewords":["[]","string"]},{"Name":"ToDomainASCII","Docs":"","Typewords":["[]","string"]}]},
+	"SendLimits": {"Name":"SendLimits","Docs":"","Fields":[{"Name":"All","Docs":"","Typewords":["SendLimitCounts"]},{"Name":"Submission","Docs":"","Typewords":["SendLimitCounts"]},{"Name":"WebAPI","Docs":"","Typewords":["SendLimitCounts"]},{"Name":"Policy","Docs":"","Typewords":["string"]}]},
+	"SendLimitCounts": {"Name":"SendLimitCounts","Docs":"","Fields":[{"Name":"MessagesPerHour","Docs":"","Typewords":["int32"]},{"Name":"MessagesPerDay","Docs":"","Typewords":["int32"]},{"Name":"MessagesPerMonth","Docs":"","Typewords":["int32"]},{"Name":"RecipientsPerHour","Docs":"","Typewords":["int32"]},{"Name":"RecipientsPerDay","Docs":"","Typewords":["int32"]},{"Name":"RecipientsPerMonth","Docs":"","Typewords":["int32"]}]},
 	"Alias": {"Name":"Alias","Docs":"","Fields":[{"Name":"Addresses","Docs":"","Typewords":["[]","string"]},{"Name":"PostPublic","Docs":"","Typewords":["bool"]},{"Name":"ListMembers","Docs":"","Typewords":["bool"]},{"Name":"AllowMsgFrom","Docs":"","Typewords":["bool"]},{"Name":"LocalpartStr","Docs":"","Typewords":["string"]},{"Name":"Domain","Docs":"","Typewords":["Domain"]},{"Name":"ParsedAddresses","Docs":"","Typewords":["[]","AliasAddress"]}]},
 	"AliasAddress": {"Name":"AliasAddress","Docs":"","Fields":[{"Name":"Address","Docs":"","Typewords":["Address"]},{"Name":"AccountName","Docs":"","Typewords":["string"]},{"Name":"Destination","Docs":"","Typewords":["Destination"]}]},
 	"Address": {"Name":"Address","Docs":"","Fields":[{"Name":"Localpart","Docs":"","Typewords":["Localpart"]},{"Name":"Domain","Docs":"","Typewords":["Domain"]}]},
 	"Destination": {"Name":"Destination","Docs":"","Fields":[{"Name":"Mailbox","Docs":"","Typewords":["string"]},{"Name":"Rulesets","Docs":"","Typewords":["[]","Ruleset"]},{"Name":"SMTPError","Docs":"","Typewords":["string"]},{"Name":"MessageAuthRequiredSMTPError","Docs":"","Typewords":["string"]},{"Name":"FullName","Docs":"","Typewords":["string"]}]},
 	"Ruleset": {"Name":"Ruleset","Docs":"","Fields":[{"Name":"SMTPMailFromRegexp","Docs":"","Typewords":["string"]},{"Name":"MsgFromRegexp","Docs":"","Typewords":["string"]},{"Name":"VerifiedDomain","Docs":"","Typewords":["string"]},{"Name":"HeadersRegexp","Docs":"","Typewords":["{}","string"]},{"Name":"IsForward","Docs":"","Typewords":["bool"]},{"Name":"ListAllowDomain","Docs":"","Typewords":["string"]},{"Name":"AcceptRejectsToMailbox","Docs":"","Typewords":["string"]},{"Name":"Mailbox","Docs":"","Typewords":["string"]},{"Name":"Comment","Docs":"","Typewords":["string"]},{"Name":"VerifiedDNSDomain","Docs":"","Typewords":["Domain"]},{"Name":"ListAllowDNSDomain","Docs":"","Typewords":["Domain"]}]},
-	"Account": {"Name":"Account","Docs":"","Fields":[{"Name":"OutgoingWebhook","Docs":"","Typewords":["nullable","OutgoingWebhook"]},{"Name":"IncomingWebhook","Docs":"","Typewords":["nullable","IncomingWebhook"]},{"Name":"FromIDLoginAddresses","Docs":"","Typewords":["[]","string"]},{"Name":"KeepRetiredMessagePeriod","Docs":"","Typewords":["int64"]},{"Name":"KeepRetiredWebhookPeriod","Docs":"","Typewords":["int64"]},{"Name":"LoginDisabled","Docs":"","Typewords":["string"]},{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"Description","Docs":"","Typewords":["string"]},{"Name":"FullName","Docs":"","Typewords":["string"]},{"Name":"Destinations","Docs":"","Typewords":["{}","Destination"]},{"Name":"SubjectPass","Docs":"","Typewords":["SubjectPass"]},{"Name":"QuotaMessageSize","Docs":"","Typewords":["int64"]},{"Name":"RejectsMailbox","Docs":"","Typewords":["string"]},{"Name":"KeepRejects","Docs":"","Typewords":["bool"]},{"Name":"AutomaticJunkFlags","Docs":"","Typewords":["AutomaticJunkFlags"]},{"Name":"JunkFilter","Docs":"","Typewords":["nullable","JunkFilter"]},{"Name":"MaxOutgoingMessagesPerDay","Docs":"","Typewords":["int32"]},{"Name":"MaxFirstTimeRecipientsPerDay","Docs":"","Typewords":["int32"]},{"Name":"NoFirstTimeSenderDelay","Docs":"","Typewords":["bool"]},{"Name":"NoCustomPassword","Docs":"","Typewords":["bool"]},{"Name":"IMAPCapabilitiesDisabled","Docs":"","Typewords":["[]","string"]},{"Name":"Routes","Docs":"","Typewords":["[]","Route"]},{"Name":"DNSDomain","Docs":"","Typewords":["Domain"]},{"Name":"Aliases","Docs":"","Typewords":["[]","AddressAlias"]}]},
-	"OutgoingWebhook": {"Name":"OutgoingWebhook","Docs":"","Fields":[{"Name":"URL","Docs":"","Typewords":["string"]},{"Name":"Authorization","Docs":"","Typewords":["string"]},{"Name":"Events","Docs":"","Typewords":["[]","string"]}]},
-	"IncomingWebhook": {"Name":"IncomingWebhook","Docs":"","Fields":[{"Name":"URL","Docs":"","Typewords":["string"]},{"Name":"Authorization","Docs":"","Typewords":["string"]}]},
+	"AttachmentRule": {"Name":"AttachmentRule","Docs":"","Fields":[{"Name":"Direction","Docs":"","Typewords":["string"]},{"Name":"ContentTypes","Docs":"","Typewords":["[]","string"]},{"Name":"Extensions","Docs":"","Typewords":["[]","string"]},{"Name":"EncryptedArchive","Docs":"","Typewords":["bool"]},{"Name":"UninspectableArchive","Docs":"","Typewords":["bool"]},{"Name":"MinSize","Docs":"","Typewords":["int64"]},{"Name":"Action","Docs":"","Typewords":["string"]}]},
+	"Account": {"Name":"Account","Docs":"","Fields":[{"Name":"OutgoingWebhook","Docs":"","Typewords":["nullable","OutgoingWebhook"]},{"Name":"IncomingWebhook","Docs":"","Typewords":["nullable","IncomingWebhook"]},{"Name":"FromIDLoginAddresses","Docs":"","Typewords":["[]","string"]},{"Name":"KeepRetiredMessagePeriod","Docs":"","Typewords":["int64"]},{"Name":"KeepRetiredWebhookPeriod","Docs":"","Typewords":["int64"]},{"Name":"LoginDisabled","Docs":"","Typewords":["string"]},{"Name":"RequireSecondFactor","Docs":"","Typewords":["bool"]},{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"Description","Docs":"","Typewords":["string"]},{"Name":"FullName","Docs":"","Typewords":["string"]},{"Name":"Destinations","Docs":"","Typewords":["{}","Destination"]},{"Name":"SubjectPass","Docs":"","Typewords":["SubjectPass"]},{"Name":"QuotaMessageSize","Docs":"","Typewords":["int64"]},{"Name":"RejectsMailbox","Docs":"","Typewords":["string"]},{"Name":"KeepRejects","Docs":"","Typewords":["bool"]},{"Name":"AutomaticJunkFlags","Docs":"","Typewords":["AutomaticJunkFlags"]},{"Name":"JunkFilter","Docs":"","Typewords":["nullable","JunkFilter"]},{"Name":"MaxOutgoingMessagesPerDay","Docs":"","Typewords":["int32"]},{"Name":"MaxFirstTimeRecipientsPerDay","Docs":"","Typewords":["int32"]},{"Name":"SendLimits","Docs":"","Typewords":["nullable","SendLimits"]},{"Name":"NoFirstTimeSenderDelay","Docs":"","Typewords":["bool"]},{"Name":"NoCustomPassword","Docs":"","Typewords":["bool"]},{"Name":"IMAPCapabilitiesDisabled","Docs":"","Typewords":["[]","string"]},{"Name":"AttachmentRules","Docs":"","Typewords":["[]","AttachmentRule"]},{"Name":"Routes","Docs":"","Typewords":["[]","Route"]},{"Name":"DNSDomain","Docs":"","Typewords":["Domain"]},{"Name":"Aliases","Docs":"","Typewords":["[]","AddressAlias"]}]},
+	"OutgoingWebhook": {"Name":"OutgoingWebhook","Docs":"","Fields":[{"Name":"URL","Docs":"","Typewords":["string"]},{"Name":"Authorization","Docs":"","Typewords":["string"]},{"Name":"EventStreamOnly","Docs":"","Typewords":["bool"]},{"Name":"Events","Docs":"","Typewords":["[]","string"]}]},
+	"IncomingWebhook": {"Name":"IncomingWebhook","Docs":"","Fields":[{"Name":"URL","Docs":"","Typewords":["string"]},{"Name":"Authorization","Docs":"","Typewords":["string"]},{"Name":"EventStreamOnly","Docs":"","Typewords":["bool"]}]},
 	"SubjectPass": {"Name":"SubjectPass","Docs":"","Fields":[{"Name":"Period","Docs":"","Typewords":["int64"]}]},
 	"AutomaticJunkFlags": {"Name":"AutomaticJunkFlags","Docs":"","Fields":[{"Name":"Enabled","Docs":"","Typewords":["bool"]},{"Name":"JunkMailboxRegexp","Docs":"","Typewords":["string"]},{"Name":"NeutralMailboxRegexp","Docs":"","Typewords":["string"]},{"Name":"NotJunkMailboxRegexp","Docs":"","Typewords":["string"]}]},
-	"JunkFilter": {"Name":"JunkFilter","Docs":"","Fields":[{"Name":"Threshold","Docs":"","Typewords":["float64"]},{"Name":"Onegrams","Docs":"","Typewords":["bool"]},{"Name":"Twograms","Docs":"","Typewords":["bool"]},{"Name":"Threegrams","Docs":"","Typewords":["bool"]},{"Name":"MaxPower","Docs":"","Typewords":["float64"]},{"Name":"TopWords","Docs":"","Typewords":["int32"]},{"Name":"IgnoreWords","Docs":"","Typewords":["float64"]},{"Name":"RareWords","Docs":"","Typewords":["int32"]}]},
+	"JunkFilter": {"Name":"JunkFilter","Docs":"","Fields":[{"Name":"Threshold","Docs":"","Typewords":["float64"]},{"Name":"Onegrams","Docs":"","Typewords":["bool"]},{"Name":"Twograms","Docs":"","Typewords":["bool"]},{"Name":"Threegrams","Docs":"","Typewords":["bool"]},{"Name":"MaxPower","Docs":"","Typewords":["float64"]},{"Name":"TopWords","Docs":"","Typewords":["int32"]},{"Name":"IgnoreWords","Docs":"","Typewords":["float64"]},{"Name":"RareWords","Docs":"","Typewords":["int32"]},{"Name":"Features","Docs":"","Typewords":["bool"]}]},
 	"AddressAlias": {"Name":"AddressAlias","Docs":"","Fields":[{"Name":"SubscriptionAddress","Docs":"","Typewords":["string"]},{"Name":"Alias","Docs":"","Typewords":["Alias"]},{"Name":"MemberAddresses","Docs":"","Typewords":["[]","string"]}]},
+	"SendUsageCounts": {"Name":"SendUsageCounts","Docs":"","Fields":[{"Name":"All","Docs":"","Typewords":["SendCounts"]},{"Name":"Submission","Docs":"","Typewords":["SendCounts"]},{"Name":"WebAPI","Docs":"","Typewords":["SendCounts"]}]},
+	"SendCounts": {"Name":"SendCounts","Docs":"","Fields":[{"Name":"MessagesHour","Docs":"","Typewords":["int32"]},{"Name":"MessagesDay","Docs":"","Typewords":["int32"]},{"Name":"MessagesMonth","Docs":"","Typewords":["int32"]},{"Name":"RecipientsHour","Docs":"","Typewords":["int32"]},{"Name":"RecipientsDay","Docs":"","Typewords":["int32"]},{"Name":"RecipientsMonth","Docs":"","Typewords":["int32"]}]},
 	"PolicyRecord": {"Name":"PolicyRecord","Docs":"","Fields":[{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"Inserted","Docs":"","Typewords":["timestamp"]},{"Name":"ValidEnd","Docs":"","Typewords":["timestamp"]},{"Name":"LastUpdate","Docs":"","Typewords":["timestamp"]},{"Name":"LastUse","Docs":"","Typewords":["timestamp"]},{"Name":"Backoff","Docs":"","Typewords":["bool"]},{"Name":"RecordID","Docs":"","Typewords":["string"]},{"Name":"Version","Docs":"","Typewords":["string"]},{"Name":"Mode","Docs":"","Typewords":["Mode"]},{"Name":"MX","Docs":"","Typewords":["[]","STSMX"]},{"Name":"MaxAgeSeconds","Docs":"","Typewords":["int32"]},{"Name":"Extensions","Docs":"","Typewords":["[]","Pair"]},{"Name":"PolicyText","Docs":"","Typewords":["string"]}]},
 	"TLSReportRecord": {"Name":"TLSReportRecord","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"FromDomain","Docs":"","Typewords":["string"]},{"Name":"MailFrom","Docs":"","Typewords":["string"]},{"Name":"HostReport","Docs":"","Typewords":["bool"]},{"Name":"Report","Docs":"","Typewords":["Report"]}]},
 	"Report": {"Name":"Report","Docs":"","Fields":[{"Name":"OrganizationName","Docs":"","Typewords":["string"]},{"Name":"DateRange","Docs":"","Typewords":["TLSRPTDateRange"]},{"Name":"ContactInfo","Docs":"","Typewords":["string"]},{"Name":"ReportID","Docs":"","Typewords":["string"]},{"Name":"Policies","Docs":"","Typewords":["[]","Result"]}]},
@@ -1239,9 +1528,23 @@ export const types: TypenameMap = {
 	"SPFAuthResult": {"Name":"SPFAuthResult","Docs":"","Fields":[{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"Scope","Docs":"","Typewords":["string"]},{"Name":"Result","Docs":"","Typewords":["string"]}]},
 	"DMARCSummary": {"Name":"DMARCSummary","Docs":"","Fields":[{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"Total","Docs":"","Typewords":["int32"]},{"Name":"DispositionNone","Docs":"","Typewords":["int32"]},{"Name":"DispositionQuarantine","Docs":"","Typewords":["int32"]},{"Name":"DispositionReject","Docs":"","Typewords":["int32"]},{"Name":"DKIMFail","Docs":"","Typewords":["int32"]},{"Name":"SPFFail","Docs":"","Typewords":["int32"]},{"Name":"PolicyOverrides","Docs":"","Typewords":["{}","int32"]}]},
 	"Reverse": {"Name":"Reverse","Docs":"","Fields":[{"Name":"Hostnames","Docs":"","Typewords":["[]","string"]}]},
+	"RateLimiter": {"Name":"RateLimiter","Docs":"","Fields":[{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"Open","Docs":"","Typewords":["bool"]},{"Name":"Entries","Docs":"","Typewords":["[]","RateLimitEntry"]}]},
+	"RateLimitEntry": {"Name":"RateLimitEntry","Docs":"","Fields":[{"Name":"Window","Docs":"","Typewords":["int64"]},{"Name":"Time","Docs":"","Typewords":["uint32"]},{"Name":"Index","Docs":"","Typewords":["uint8"]},{"Name":"Net","Docs":"","Typewords":["string"]},{"Name":"Count","Docs":"","Typewords":["int64"]},{"Name":"Limit","Docs":"","Typewords":["int64"]}]},
+	"IPBan": {"Name":"IPBan","Docs":"","Fields":[{"Name":"Net","Docs":"","Typewords":["string"]},{"Name":"Created","Docs":"","Typewords":["timestamp"]},{"Name":"Expires","Docs":"","Typewords":["timestamp"]},{"Name":"Reason","Docs":"","Typewords":["string"]},{"Name":"Automatic","Docs":"","Typewords":["bool"]},{"Name":"Count","Docs":"","Typewords":["int32"]}]},
+	"IPAllow": {"Name":"IPAllow","Docs":"","Fields":[{"Name":"Net","Docs":"","Typewords":["string"]},{"Name":"Created","Docs":"","Typewords":["timestamp"]},{"Name":"Comment","Docs":"","Typewords":["string"]}]},
+	"GreylistStats": {"Name":"GreylistStats","Docs":"","Fields":[{"Name":"Pending","Docs":"","Typewords":["int32"]},{"Name":"Passed","Docs":"","Typewords":["int32"]},{"Name":"AllowedGroups","Docs":"","Typewords":["int32"]},{"Name":"KnownDomains","Docs":"","Typewords":["int32"]},{"Name":"RecentPending","Docs":"","Typewords":["[]","Triplet"]},{"Name":"RecentAllowed","Docs":"","Typewords":["[]","AllowedGroup"]},{"Name":"RecentKnown","Docs":"","Typewords":["[]","KnownDomain"]}]},
+	"Triplet": {"Name":"Triplet","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Group","Docs":"","Typewords":["string"]},{"Name":"MailFrom","Docs":"","Typewords":["string"]},{"Name":"RcptTo","Docs":"","Typewords":["string"]},{"Name":"FirstSeen","Docs":"","Typewords":["timestamp"]},{"Name":"LastSeen","Docs":"","Typewords":["timestamp"]},{"Name":"Attempts","Docs":"","Typewords":["int32"]},{"Name":"Passed","Docs":"","Typewords":["timestamp"]},{"Name":"Expires","Docs":"","Typewords":["timestamp"]}]},
+	"AllowedGroup": {"Name":"AllowedGroup","Docs":"","Fields":[{"Name":"Group","Docs":"","Typewords":["string"]},{"Name":"Added","Docs":"","Typewords":["timestamp"]},{"Name":"LastSeen","Docs":"","Typewords":["timestamp"]},{"Name":"Deliveries","Docs":"","Typewords":["int32"]},{"Name":"Expires","Docs":"","Typewords":["timestamp"]}]},
+	"KnownDomain": {"Name":"KnownDomain","Docs":"","Fields":[{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"Added","Docs":"","Typewords":["timestamp"]},{"Name":"LastSeen","Docs":"","Typewords":["timestamp"]},{"Name":"Deliveries","Docs":"","Typewords":["int32"]},{"Name":"Expires","Docs":"","Typewords":["timestamp"]}]},
+	"SecondFactorStatus": {"Name":"SecondFactorStatus","Docs":"","Fields":[{"Name":"TOTP","Docs":"","Typewords":["bool"]},{"Name":"WebAuthn","Docs":"","Typewords":["[]","WebAuthnCredential"]},{"Name":"RecoveryCodesUnused","Docs":"","Typewords":["int32"]}]},
+	"WebAuthnCredential": {"Name":"WebAuthnCredential","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Created","Docs":"","Typewords":["timestamp"]},{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"CredentialID","Docs":"","Typewords":["string"]},{"Name":"LastUsed","Docs":"","Typewords":["nullable","timestamp"]}]},
 	"ClientConfigs": {"Name":"ClientConfigs","Docs":"","Fields":[{"Name":"Entries","Docs":"","Typewords":["[]","ClientConfigsEntry"]}]},
 	"ClientConfigsEntry": {"Name":"ClientConfigsEntry","Docs":"","Fields":[{"Name":"Protocol","Docs":"","Typewords":["string"]},{"Name":"Host","Docs":"","Typewords":["Domain"]},{"Name":"Port","Docs":"","Typewords":["int32"]},{"Name":"Listener","Docs":"","Typewords":["string"]},{"Name":"Note","Docs":"","Typewords":["string"]}]},
 	"HoldRule": {"Name":"HoldRule","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"SenderDomain","Docs":"","Typewords":["Domain"]},{"Name":"RecipientDomain","Docs":"","Typewords":["Domain"]},{"Name":"SenderDomainStr","Docs":"","Typewords":["string"]},{"Name":"RecipientDomainStr","Docs":"","Typewords":["string"]}]},
+	"DeliveryStats": {"Name":"DeliveryStats","Docs":"","Fields":[{"Name":"Throttles","Docs":"","Typewords":["[]","ThrottleStats"]},{"Name":"Destinations","Docs":"","Typewords":["[]","DestinationStats"]},{"Name":"IPWarmups","Docs":"","Typewords":["[]","IPWarmupStats"]}]},
+	"ThrottleStats": {"Name":"ThrottleStats","Docs":"","Fields":[{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"MaxConcurrent","Docs":"","Typewords":["int32"]},{"Name":"MessagesPerMinute","Docs":"","Typewords":["int32"]},{"Name":"MessagesPerHour","Docs":"","Typewords":["int32"]},{"Name":"Active","Docs":"","Typewords":["int32"]},{"Name":"MessagesMinute","Docs":"","Typewords":["int32"]},{"Name":"MessagesHour","Docs":"","Typewords":["int32"]},{"Name":"Delivered","Docs":"","Typewords":["int32"]},{"Name":"TempErrors","Docs":"","Typewords":["int32"]},{"Name":"PermErrors","Docs":"","Typewords":["int32"]},{"Name":"RateLimited","Docs":"","Typewords":["int32"]},{"Name":"BackoffUntil","Docs":"","Typewords":["timestamp"]}]},
+	"DestinationStats": {"Name":"DestinationStats","Docs":"","Fields":[{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"Throttle","Docs":"","Typewords":["string"]},{"Name":"Active","Docs":"","Typewords":["int32"]},{"Name":"Delivered","Docs":"","Typewords":["int32"]},{"Name":"TempErrors","Docs":"","Typewords":["int32"]},{"Name":"PermErrors","Docs":"","Typewords":["int32"]},{"Name":"RateLimited","Docs":"","Typewords":["int32"]},{"Name":"LastAttempt","Docs":"","Typewords":["timestamp"]},{"Name":"BackoffUntil","Docs":"","Typewords":["timestamp"]}]},
+	"IPWarmupStats": {"Name":"IPWarmupStats","Docs":"","Fields":[{"Name":"Pool","Docs":"","Typewords":["string"]},{"Name":"IP","Docs":"","Typewords":["string"]},{"Name":"Day","Docs":"","Typewords":["int32"]},{"Name":"Limit","Docs":"","Typewords":["int32"]},{"Name":"Messages","Docs":"","Typewords":["int32"]}]},
 	"Filter": {"Name":"Filter","Docs":"","Fields":[{"Name":"Max","Docs":"","Typewords":["int32"]},{"Name":"IDs","Docs":"","Typewords":["[]","int64"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"From","Docs":"","Typewords":["string"]},{"Name":"To","Docs":"","Typewords":["string"]},{"Name":"Hold","Docs":"","Typewords":["nullable","bool"]},{"Name":"Submitted","Docs":"","Typewords":["string"]},{"Name":"NextAttempt","Docs":"","Typewords":["string"]},{"Name":"Transport","Docs":"","Typewords":["nullable","string"]}]},
 	"Sort": {"Name":"Sort","Docs":"","Fields":[{"Name":"Field","Docs":"","Typewords":["string"]},{"Name":"LastID","Docs":"","Typewords":["int64"]},{"Name":"Last","Docs":"","Typewords":["any"]},{"Name":"Asc","Docs":"","Typewords":["bool"]}]},
 	"Msg": {"Name":"Msg","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"BaseID","Docs":"","Typewords":["int64"]},{"Name":"Queued","Docs":"","Typewords":["timestamp"]},{"Name":"Hold","Docs":"","Typewords":["bool"]},{"Name":"SenderAccount","Docs":"","Typewords":["string"]},{"Name":"SenderLocalpart","Docs":"","Typewords":["Localpart"]},{"Name":"SenderDomain","Docs":"","Typewords":["IPDomain"]},{"Name":"SenderDomainStr","Docs":"","Typewords":["string"]},{"Name":"FromID","Docs":"","Typewords":["string"]},{"Name":"RecipientLocalpart","Docs":"","Typewords":["Localpart"]},{"Name":"RecipientDomain","Docs":"","Typewords":["IPDomain"]},{"Name":"RecipientDomainStr","Docs":"","Typewords":["string"]},{"Name":"Attempts","Docs":"","Typewords":["int32"]},{"Name":"MaxAttempts","Docs":"","Typewords":["int32"]},{"Name":"DialedIPs","Docs":"","Typewords":["{}","[]","IP"]},{"Name":"NextAttempt","Docs":"","Typewords":["timestamp"]},{"Name":"LastAttempt","Docs":"","Typewords":["nullable","timestamp"]},{"Name":"Results","Docs":"","Typewords":["[]","MsgResult"]},{"Name":"Has8bit","Docs":"","Typewords":["bool"]},{"Name":"SMTPUTF8","Docs":"","Typewords":["bool"]},{"Name":"IsDMARCReport","Docs":"","Typewords":["bool"]},{"Name":"IsTLSReport","Docs":"","Typewords":["bool"]},{"Name":"Size","Docs":"","Typewords":["int64"]},{"Name":"MessageID","Docs":"","Typewords":["string"]},{"Name":"MsgPrefix","Docs":"","Typewords":["nullable","string"]},{"Name":"Subject","Docs":"","Typewords":["string"]},{"Name":"DSNUTF8","Docs":"","Typewords":["nullable","string"]},{"Name":"Transport","Docs":"","Typewords":["string"]},{"Name":"RequireTLS","Docs":"","Typewords":["nullable","bool"]},{"Name":"FutureReleaseRequest","Docs":"","Typewords":["string"]},{"Name":"Extra","Docs":"","Typewords":["{}","string"]}]},
@@ -1267,7 +1570,7 @@ export const types: TypenameMap = {
 	"TransportSMTP": {"Name":"TransportSMTP","Docs":"","Fields":[{"Name":"Host","Docs":"","Typewords":["string"]},{"Name":"Port","Docs":"","Typewords":["int32"]},{"Name":"STARTTLSInsecureSkipVerify","Docs":"","Typewords":["bool"]},{"Name":"NoSTARTTLS","Docs":"","Typewords":["bool"]},{"Name":"Auth","Docs":"","Typewords":["nullable","SMTPAuth"]}]},
 	"SMTPAuth": {"Name":"SMTPAuth","Docs":"","Fields":[{"Name":"Username","Docs":"","Typewords":["string"]},{"Name":"Password","Docs":"","Typewords":["string"]},{"Name":"Mechanisms","Docs":"","Typewords":["[]","string"]}]},
 	"TransportSocks": {"Name":"TransportSocks","Docs":"","Fields":[{"Name":"Address","Docs":"","Typewords":["string"]},{"Name":"RemoteIPs","Docs":"","Typewords":["[]","string"]},{"Name":"RemoteHostname","Docs":"","Typewords":["string"]}]},
-	"TransportDirect": {"Name":"TransportDirect","Docs":"","Fields":[{"Name":"DisableIPv4","Docs":"","Typewords":["bool"]},{"Name":"DisableIPv6","Docs":"","Typewords":["bool"]}]},
+	"TransportDirect": {"Name":"TransportDirect","Docs":"","Fields":[{"Name":"DisableIPv4","Docs":"","Typewords":["bool"]},{"Name":"DisableIPv6","Docs":"","Typewords":["bool"]},{"Name":"IPPool","Docs":"","Typewords":["string"]}]},
 	"TransportFail": {"Name":"TransportFail","Docs":"","Fields":[{"Name":"SMTPCode","Docs":"","Typewords":["int32"]},{"Name":"SMTPMessage","Docs":"","Typewords":["string"]},{"Name":"Code","Docs":"","Typewords":["int32"]},{"Name":"Message","Docs":"","Typewords":["string"]}]},
 	"EvaluationStat": {"Name":"EvaluationStat","Docs":"","Fields":[{"Name":"Domain","Docs":"","Typewords":["Domain"]},{"Name":"Dispositions","Docs":"","Typewords":["[]","string"]},{"Name":"Count","Docs":"","Typewords":["int32"]},{"Name":"SendReport","Docs":"","Typewords":["bool"]}]},
 	"Evaluation": {"Name":"Evaluation","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"PolicyDomain","Docs":"","Typewords":["string"]},{"Name":"Evaluated","Docs":"","Typewords":["timestamp"]},{"Name":"Optional","Docs":"","Typewords":["bool"]},{"Name":"IntervalHours","Docs":"","Typewords":["int32"]},{"Name":"Addresses","Docs":"","Typewords":["[]","string"]},{"Name":"PolicyPublished","Docs":"","Typewords":["PolicyPublished"]},{"Name":"SourceIP","Docs":"","Typewords":["string"]},{"Name":"Disposition","Docs":"","Typewords":["string"]},{"Name":"AlignedDKIMPass","Docs":"","Typewords":["bool"]},{"Name":"AlignedSPFPass","Docs":"","Typewords":["bool"]},{"Name":"OverrideReasons","Docs":"","Typewords":["[]","PolicyOverrideReason"]},{"Name":"EnvelopeTo","Docs":"","Typewords":["string"]},{"Name":"EnvelopeFrom","Docs":"","Typewords":["string"]},{"Name":"HeaderFrom","Docs":"","Typewords":["string"]},{"Name":"DKIMResults","Docs":"","Typewords":["[]","DKIMAuthResult"]},{"Name":"SPFResults","Docs":"","Typewords":["[]","SPFAuthResult"]}]},
@@ -1276,18 +1579,23 @@ export const types: TypenameMap = {
 	"TLSRPTSuppressAddress": {"Name":"TLSRPTSuppressAddress","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Inserted","Docs":"","Typewords":["timestamp"]},{"Name":"ReportingAddress","Docs":"","Typewords":["string"]},{"Name":"Until","Docs":"","Typewords":["timestamp"]},{"Name":"Comment","Docs":"","Typewords":["string"]}]},
 	"Dynamic": {"Name":"Dynamic","Docs":"","Fields":[{"Name":"Domains","Docs":"","Typewords":["{}","ConfigDomain"]},{"Name":"Accounts","Docs":"","Typewords":["{}","Account"]},{"Name":"WebDomainRedirects","Docs":"","Typewords":["{}","string"]},{"Name":"WebHandlers","Docs":"","Typewords":["[]","WebHandler"]},{"Name":"Routes","Docs":"","Typewords":["[]","Route"]},{"Name":"MonitorDNSBLs","Docs":"","Typewords":["[]","string"]},{"Name":"MonitorDNSBLZones","Docs":"","Typewords":["[]","Domain"]}]},
 	"TLSPublicKey": {"Name":"TLSPublicKey","Docs":"","Fields":[{"Name":"Fingerprint","Docs":"","Typewords":["string"]},{"Name":"Created","Docs":"","Typewords":["timestamp"]},{"Name":"Type","Docs":"","Typewords":["string"]},{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"NoIMAPPreauth","Docs":"","Typewords":["bool"]},{"Name":"CertDER","Docs":"","Typewords":["nullable","string"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"LoginAddress","Docs":"","Typewords":["string"]}]},
-	"LoginAttempt": {"Name":"LoginAttempt","Docs":"","Fields":[{"Name":"Key","Docs":"","Typewords":["nullable","string"]},{"Name":"Last","Docs":"","Typewords":["timestamp"]},{"Name":"First","Docs":"","Typewords":["timestamp"]},{"Name":"Count","Docs":"","Typewords":["int64"]},{"Name":"AccountName","Docs":"","Typewords":["string"]},{"Name":"LoginAddress","Docs":"","Typewords":["string"]},{"Name":"RemoteIP","Docs":"","Typewords":["string"]},{"Name":"LocalIP","Docs":"","Typewords":["string"]},{"Name":"TLS","Docs":"","Typewords":["string"]},{"Name":"TLSPubKeyFingerprint","Docs":"","Typewords":["string"]},{"Name":"Protocol","Docs":"","Typewords":["string"]},{"Name":"UserAgent","Docs":"","Typewords":["string"]},{"Name":"AuthMech","Docs":"","Typewords":["string"]},{"Name":"Result","Docs":"","Typewords":["AuthResult"]}]},
+	"LoginAttempt": {"Name":"LoginAttempt","Docs":"","Fields":[{"Name":"Key","Docs":"","Typewords":["nullable","string"]},{"Name":"Last","Docs":"","Typewords":["timestamp"]},{"Name":"First","Docs":"","Typewords":["timestamp"]},{"Name":"Count","Docs":"","Typewords":["int64"]},{"Name":"AccountName","Docs":"","Typewords":["string"]},{"Name":"LoginAddress","Docs":"","Typewords":["string"]},{"Name":"RemoteIP","Docs":"","Typewords":["string"]},{"Name":"LocalIP","Docs":"","Typewords":["string"]},{"Name":"TLS","Docs":"","Typewords":["string"]},{"Name":"TLSPubKeyFingerprint","Docs":"","Typewords":["string"]},{"Name":"Protocol","Docs":"","Typewords":["string"]},{"Name":"UserAgent","Docs":"","Typewords":["string"]},{"Name":"AuthMech","Docs":"","Typewords":["string"]},{"Name":"APIKeyName","Docs":"","Typewords":["string"]},{"Name":"AppPasswordName","Docs":"","Typewords":["string"]},{"Name":"SecondFactor","Docs":"","Typewords":["string"]},{"Name":"Result","Docs":"","Typewords":["AuthResult"]}]},
 	"CSRFToken": {"Name":"CSRFToken","Docs":"","Values":null},
 	"DMARCPolicy": {"Name":"DMARCPolicy","Docs":"","Values":[{"Name":"PolicyEmpty","Value":"","Docs":""},{"Name":"PolicyNone","Value":"none","Docs":""},{"Name":"PolicyQuarantine","Value":"quarantine","Docs":""},{"Name":"PolicyReject","Value":"reject","Docs":""}]},
 	"Align": {"Name":"Align","Docs":"","Values":[{"Name":"AlignStrict","Value":"s","Docs":""},{"Name":"AlignRelaxed","Value":"r","Docs":""}]},
+	"PSD": {"Name":"PSD","Docs":"","Values":[{"Name":"PSDEmpty","Value":"","Docs":""},{"Name":"PSDUnknown","Value":"u","Docs":""},{"Name":"PSDYes","Value":"y","Docs":""},{"Name":"PSDNo","Value":"n","Docs":""}]},
 	"RUA": {"Name":"RUA","Docs":"","Values":null},
 	"Mode": {"Name":"Mode","Docs":"","Values":[{"Name":"ModeEnforce","Value":"enforce","Docs":""},{"Name":"ModeTesting","Value":"testing","Docs":""},{"Name":"ModeNone","Value":"none","Docs":""}]},
 	"Localpart": {"Name":"Localpart","Docs":"","Values":null},
 	"IP": {"Name":"IP","Docs":"","Values":[]},
-	"AuthResult": {"Name":"AuthResult","Docs":"","Values":[{"Name":"AuthSuccess","Value":"ok","Docs":""},{"Name":"AuthBadUser","Value":"baduser","Docs":""},{"Name":"AuthBadPassword","Value":"badpassword","Docs":""},{"Name":"AuthBadCredentials","Value":"badcreds","Docs":""},{"Name":"AuthBadChannelBinding","Value":"badchanbind","Docs":""},{"Name":"AuthBadProtocol","Value":"badprotocol","Docs":""},{"Name":"AuthLoginDisabled","Value":"logindisabled","Docs":""},{"Name":"AuthError","Value":"error","Docs":""},{"Name":"AuthAborted","Value":"aborted","Docs":""}]},
+	"AuthResult": {"Name":"AuthResult","Docs":"","Values":[{"Name":"AuthSuccess","Value":"ok","Docs":""},{"Name":"AuthBadUser","Value":"baduser","Docs":""},{"Name":"AuthBadPassword","Value":"badpassword","Docs":""},{"Name":"AuthBadCredentials","Value":"badcreds","Docs":""},{"Name":"AuthBadChannelBinding","Value":"badchanbind","Docs":""},{"Name":"AuthBadProtocol","Value":"badprotocol","Docs":""},{"Name":"AuthLoginDisabled","Value":"logindisabled","Docs":""},{"Name":"AuthSecondFactorRequired","Value":"secondfactor","Docs":""},{"Name":"AuthError","Value":"error","Docs":""},{"Name":"AuthAborted","Value":"aborted","Docs":""}]},
 }
 
 export const parser = {
+	SecondFactorChallenge: (v: any) => parse("SecondFactorChallenge", v) as SecondFactorChallenge,
+	WebAuthnRequest: (v: any) => parse("WebAuthnRequest", v) as WebAuthnRequest,
+	SecondFactorResponse: (v: any) => parse("SecondFactorResponse", v) as SecondFactorResponse,
+	WebAuthnAssertion: (v: any) => parse("WebAuthnAssertion", v) as WebAuthnAssertion,
 	CheckResult: (v: any) => parse("CheckResult", v) as CheckResult,
 	DNSSECResult: (v: any) => parse("DNSSECResult", v) as DNSSECResult,
 	IPRevCheckResult: (v: any) => parse("IPRevCheckResult", v) as IPRevCheckResult,
@@ -1314,6 +1622,7 @@ export const parser = {
 	Pair: (v: any) => parse("Pair", v) as Pair,
 	Policy: (v: any) => parse("Policy", v) as Policy,
 	STSMX: (v: any) => parse("STSMX", v) as STSMX,
+	BIMICheckResult: (v: any) => parse("BIMICheckResult", v) as BIMICheckResult,
 	SRVConfCheckResult: (v: any) => parse("SRVConfCheckResult", v) as SRVConfCheckResult,
 	SRV: (v: any) => parse("SRV", v) as SRV,
 	AutoconfCheckResult: (v: any) => parse("AutoconfCheckResult", v) as AutoconfCheckResult,
@@ -1326,12 +1635,16 @@ export const parser = {
 	DMARC: (v: any) => parse("DMARC", v) as DMARC,
 	MTASTS: (v: any) => parse("MTASTS", v) as MTASTS,
 	TLSRPT: (v: any) => parse("TLSRPT", v) as TLSRPT,
+	BIMI: (v: any) => parse("BIMI", v) as BIMI,
 	Route: (v: any) => parse("Route", v) as Route,
+	SendLimits: (v: any) => parse("SendLimits", v) as SendLimits,
+	SendLimitCounts: (v: any) => parse("SendLimitCounts", v) as SendLimitCounts,
 	Alias: (v: any) => parse("Alias", v) as Alias,
 	AliasAddress: (v: any) => parse("AliasAddress", v) as AliasAddress,
 	Address: (v: any) => parse("Address", v) as Address,
 	Destination: (v: any) => parse("Destination", v) as Destination,
 	Ruleset: (v: any) => parse("Ruleset", v) as Ruleset,
+	AttachmentRule: (v: any) => parse("AttachmentRule", v) as AttachmentRule,
 	Account: (v: any) => parse("Account", v) as Account,
 	OutgoingWebhook: (v: any) => parse("OutgoingWebhook", v) as OutgoingWebhook,
 	IncomingWebhook: (v: any) => parse("IncomingWebhook", v) as IncomingWebhook,
@@ -1339,6 +1652,8 @@ export const parser = {
 	AutomaticJunkFlags: (v: any) => parse("AutomaticJunkFlags", v) as AutomaticJunkFlags,
 	JunkFilter: (v: any) => parse("JunkFilter", v) as JunkFilter,
 	AddressAlias: (v: any) => parse("AddressAlias", v) as AddressAlias,
+	SendUsageCounts: (v: any) => parse("SendUsageCounts", v) as SendUsageCounts,
+	SendCounts: (v: any) => parse("SendCounts", v) as SendCounts,
 	PolicyRecord: (v: any) => parse("PolicyRecord", v) as PolicyRecord,
 	TLSReportRecord: (v: any) => parse("TLSReportRecord", v) as TLSReportRecord,
 	Report: (v: any) => parse("Report", v) as Report,
@@ -1362,9 +1677,23 @@ export const parser = {
 	SPFAuthResult: (v: any) => parse("SPFAuthResult", v) as SPFAuthResult,
 	DMARCSummary: (v: any) => parse("DMARCSummary", v) as DMARCSummary,
 	Reverse: (v: any) => parse("Reverse", v) as Reverse,
+	RateLimiter: (v: any) => parse("RateLimiter", v) as RateLimiter,
+	RateLimitEntry: (v: any) => parse("RateLimitEntry", v) as RateLimitEntry,
+	IPBan: (v: any) => parse("IPBan", v) as IPBan,
+	IPAllow: (v: any) => parse("IPAllow", v) as IPAllow,
+	GreylistStats: (v: any) => parse("GreylistStats", v) as GreylistStats,
+	Triplet: (v: any) => parse("Triplet", v) as Triplet,
+	AllowedGroup: (v: any) => parse("AllowedGroup", v) as AllowedGroup,
+	KnownDomain: (v: any) => parse("KnownDomain", v) as KnownDomain,
+	SecondFactorStatus: (v: any) => parse("SecondFactorStatus", v) as SecondFactorStatus,
+	WebAuthnCredential: (v: any) => parse("WebAuthnCredential", v) as WebAuthnCredential,
 	ClientConfigs: (v: any) => parse("ClientConfigs", v) as ClientConfigs,
 	ClientConfigsEntry: (v: any) => parse("ClientConfigsEntry", v) as ClientConfigsEntry,
 	HoldRule: (v: any) => parse("HoldRule", v) as HoldRule,
+	DeliveryStats: (v: any) => parse("DeliveryStats", v) as DeliveryStats,
+	ThrottleStats: (v: any) => parse("ThrottleStats", v) as ThrottleStats,
+	DestinationStats: (v: any) => parse("DestinationStats", v) as DestinationStats,
+	IPWarmupStats: (v: any) => parse("IPWarmupStats", v) as IPWarmupStats,
 	Filter: (v: any) => parse("Filter", v) as Filter,
 	Sort: (v: any) => parse("Sort", v) as Sort,
 	Msg: (v: any) => parse("Msg", v) as Msg,
@@ -1403,6 +1732,7 @@ export const parser = {
 	CSRFToken: (v: any) => parse("CSRFToken", v) as CSRFToken,
 	DMARCPolicy: (v: any) => parse("DMARCPolicy", v) as DMARCPolicy,
 	Align: (v: any) => parse("Align", v) as Align,
+	PSD: (v: any) => parse("PSD", v) as PSD,
 	RUA: (v: any) => parse("RUA", v) as RUA,
 	Mode: (v: any) => parse("Mode", v) as Mode,
 	Localpart: (v: any) => parse("Localpart", v) as Localpart,
@@ -1451,12 +1781,26 @@ export class Client {
 	}
 
 	// Login returns a session token for the credentials, or fails with error code
-	// "user:badLogin". Call LoginPrep to get a loginToken.
-	async Login(loginToken: string, password: string): Promise<CSRFToken> {
+	// "user:badLogin". Call LoginPrep to get a loginToken. If a second factor is
+	// required, no session is created yet, and secondFactor is returned instead.
+	// Complete the login with LoginSecondFactor.
+	async Login(loginToken: string, password: string): Promise<[CSRFToken, SecondFactorChallenge | null]> {
 		const fn: string = "Login"
 		const paramTypes: string[][] = [["string"],["string"]]
-		const returnTypes: string[][] = [["CSRFToken"]]
+		const returnTypes: string[][] = [["CSRFToken"],["nullable","SecondFactorChallenge"]]
 		const params: any[] = [loginToken, password]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as [CSRFToken, SecondFactorChallenge | null]
+	}
+
+	// LoginSecondFactor completes a login for which Login returned a second factor
+	// challenge, with the token from the challenge and a TOTP code, recovery code or
+	// WebAuthn assertion. It returns a session token, or fails with error code
+	// "user:loginFailed".
+	async LoginSecondFactor(loginToken: string, token: string, response: SecondFactorResponse): Promise<CSRFToken> {
+		const fn: string = "LoginSecondFactor"
+		const paramTypes: string[][] = [["string"],["string"],["SecondFactorResponse"]]
+		const returnTypes: string[][] = [["CSRFToken"]]
+		const params: any[] = [loginToken, token, response]
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as CSRFToken
 	}
 
@@ -1551,6 +1895,27 @@ export class Client {
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as [Account, number]
 	}
 
+	// AccountSendUsage returns the numbers of messages and recipients submitted by an
+	// account in the past hour, day and month, for its send limits.
+	async AccountSendUsage(account: string): Promise<SendUsageCounts> {
+		const fn: string = "AccountSendUsage"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = [["SendUsageCounts"]]
+		const params: any[] = [account]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as SendUsageCounts
+	}
+
+	// DomainSendUsage returns the numbers of messages and recipients submitted by all
+	// accounts with a message From address in domain in the past hour, day and month,
+	// for the send limits of the domain.
+	async DomainSendUsage(domain: string): Promise<SendUsageCounts> {
+		const fn: string = "DomainSendUsage"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = [["SendUsageCounts"]]
+		const params: any[] = [domain]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as SendUsageCounts
+	}
+
 	// ConfigFiles returns the paths and contents of the static and dynamic configuration files.
 	async ConfigFiles(): Promise<[string, string, string, string]> {
 		const fn: string = "ConfigFiles"
@@ -1655,6 +2020,17 @@ export class Client {
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as [{ [key: string]: { [key: string]: string } }, Domain[] | null, Domain[] | null]
 	}
 
+	// URIBLStatus returns the health of the URIBLs configured for checking domains
+	// of links in incoming messages, checked now. The returned value maps ASCII zone
+	// names to "ok", or to an error string.
+	async URIBLStatus(): Promise<[{ [key: string]: string }, Domain[] | null]> {
+		const fn: string = "URIBLStatus"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["{}","string"],["[]","Domain"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as [{ [key: string]: string }, Domain[] | null]
+	}
+
 	async MonitorDNSBLsSave(text: string): Promise<void> {
 		const fn: string = "MonitorDNSBLsSave"
 		const paramTypes: string[][] = [["string"]]
@@ -1663,6 +2039,86 @@ export class Client {
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
 	}
 
+	// RateLimits returns the counts of all rate limiters, for connections, requests
+	// and failed authentication attempts.
+	async RateLimits(): Promise<RateLimiter[] | null> {
+		const fn: string = "RateLimits"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["[]","RateLimiter"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as RateLimiter[] | null
+	}
+
+	// RateLimitClear clears the counts for an IP or network (in CIDR notation),
+	// including counts for networks containing the IP. If limiterName is empty, counts
+	// are cleared in all rate limiters. Limiters for open connections cannot be
+	// cleared, their counts go down when connections close.
+	async RateLimitClear(limiterName: string, ipnet: string): Promise<void> {
+		const fn: string = "RateLimitClear"
+		const paramTypes: string[][] = [["string"],["string"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [limiterName, ipnet]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// IPBans returns the bans currently in effect, and the IPs/networks that are
+	// never banned.
+	async IPBans(): Promise<[IPBan[] | null, IPAllow[] | null]> {
+		const fn: string = "IPBans"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["[]","IPBan"],["[]","IPAllow"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as [IPBan[] | null, IPAllow[] | null]
+	}
+
+	// IPBanAdd bans an IP or network (in CIDR notation). Duration is a Go duration,
+	// e.g. "24h". If empty, the ban does not expire.
+	async IPBanAdd(ipnet: string, duration: string, reason: string): Promise<void> {
+		const fn: string = "IPBanAdd"
+		const paramTypes: string[][] = [["string"],["string"],["string"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [ipnet, duration, reason]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// IPBanRemove removes the ban for an IP or network.
+	async IPBanRemove(ipnet: string): Promise<void> {
+		const fn: string = "IPBanRemove"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [ipnet]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// IPAllowAdd adds an IP or network to the allowlist for bans.
+	async IPAllowAdd(ipnet: string, comment: string): Promise<void> {
+		const fn: string = "IPAllowAdd"
+		const paramTypes: string[][] = [["string"],["string"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [ipnet, comment]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// IPAllowRemove removes an IP or network from the allowlist for bans.
+	async IPAllowRemove(ipnet: string): Promise<void> {
+		const fn: string = "IPAllowRemove"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [ipnet]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// Greylisting returns statistics about greylisting of incoming deliveries, with
+	// the most recently seen pending triplets, allowlisted remote IP groups and known
+	// domains.
+	async Greylisting(): Promise<GreylistStats> {
+		const fn: string = "Greylisting"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["GreylistStats"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as GreylistStats
+	}
+
 	// DomainRecords returns lines describing DNS records that should exist for the
 	// configured domain.
 	async DomainRecords(domain: string): Promise<string[] | null> {
@@ -1757,6 +2213,35 @@ export class Client {
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
 	}
 
+	// AccountSecondFactorRequiredSave saves the RequireSecondFactor field of an
+	// account.
+	async AccountSecondFactorRequiredSave(accountName: string, required: boolean): Promise<void> {
+		const fn: string = "AccountSecondFactorRequiredSave"
+		const paramTypes: string[][] = [["string"],["bool"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [accountName, required]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// AccountSecondFactors returns the second factors configured for an account.
+	async AccountSecondFactors(accountName: string): Promise<SecondFactorStatus> {
+		const fn: string = "AccountSecondFactors"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = [["SecondFactorStatus"]]
+		const params: any[] = [accountName]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as SecondFactorStatus
+	}
+
+	// AccountSecondFactorsClear removes all second factors and recovery codes of an
+	// account, e.g. after the user lost access to them.
+	async AccountSecondFactorsClear(accountName: string): Promise<void> {
+		const fn: string = "AccountSecondFactorsClear"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [accountName]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
 	// ClientConfigsDomain returns configurations for email clients, IMAP and
 	// Submission (SMTP) for the domain.
 	async ClientConfigsDomain(domain: string): Promise<ClientConfigs> {
@@ -1805,6 +2290,17 @@ export class Client {
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
 	}
 
+	// QueueDeliveryStats returns the state of destination throttles, statistics
+	// about recent deliveries per recipient domain, and the warm-up state of IPs in
+	// IP pools.
+	async QueueDeliveryStats(): Promise<DeliveryStats> {
+		const fn: string = "QueueDeliveryStats"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["DeliveryStats"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as DeliveryStats
+	}
+
 	// QueueList returns the messages currently in the outgoing queue.
 	async QueueList(filter: Filter, sort: Sort): Promise<Msg[] | null> {
 		const fn: string = "QueueList"
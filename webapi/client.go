@@ -1,6 +1,7 @@
 package webapi
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -8,7 +9,10 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+
+	"github.com/mjl-/mox/webhook"
 )
 
 // Client can be used to call webapi methods.
@@ -153,6 +157,7 @@ func badResponse(hresp *http.Response) error {
 //   - noRecipients, if no recipients were specified.
 //   - messageLimitReached, if the outgoing message rate limit was reached.
 //   - recipientLimitReached, if the outgoing new recipient rate limit was reached.
+//   - sendLimitReached, if a send limit for the account or domain of the from address was reached.
 //   - messageTooLarge, message larger than configured maximum size.
 //   - malformedMessageID, if MessageID is specified but invalid.
 //   - sentOverQuota, message submitted, but not stored in Sent mailbox due to quota reached.
@@ -259,3 +264,189 @@ func (c Client) MessageFlagsRemove(ctx context.Context, req MessageFlagsRemoveRe
 func (c Client) MessageMove(ctx context.Context, req MessageMoveRequest) (resp MessageMoveResult, err error) {
 	return transact[MessageMoveResult](ctx, c, "MessageMove", req)
 }
+
+// MessageList lists messages in a mailbox, or returns the changes to messages in
+// a mailbox since a modification sequence. Start by listing all messages, paging
+// with AfterMsgID while HaveMore is set, then repeatedly call MessageList with
+// SinceModSeq set to the ModSeq from the first result to poll for changes.
+// Changed messages are returned in Messages, removed messages in RemovedMsgIDs.
+//
+// Error codes:
+//   - mailboxNotFound, if the mailbox does not exist.
+//   - modSeqExpired, if the history of changes since SinceModSeq is no longer
+//     available. Clients should list all messages again.
+func (c Client) MessageList(ctx context.Context, req MessageListRequest) (resp MessageListResult, err error) {
+	return transact[MessageListResult](ctx, c, "MessageList", req)
+}
+
+// MessageSearch returns messages matching the search criteria, most recent
+// first, in a single mailbox or in all mailboxes. The criteria are the same as for
+// the IMAP SEARCH command.
+//
+// Error codes:
+//   - mailboxNotFound, if the mailbox does not exist.
+func (c Client) MessageSearch(ctx context.Context, req MessageSearchRequest) (resp MessageSearchResult, err error) {
+	return transact[MessageSearchResult](ctx, c, "MessageSearch", req)
+}
+
+// MessageAppend adds a message to a mailbox, like the IMAP APPEND command. The
+// message is stored as is, it is not sent.
+//
+// The raw message must be present in the request as base64 in Data, or in
+// multipart/form-data requests as form file "message".
+//
+// Example call:
+//
+//	curl --user mox@localhost:moxmoxmox \
+//		--form request='{"MailboxName": "Archive", "Flags": ["\\seen"]}' \
+//		--form message=@message.eml \
+//		http://localhost:1080/webapi/v0/MessageAppend
+//
+// Error codes:
+//   - mailboxNotFound, if the mailbox does not exist.
+//   - messageTooLarge, message larger than configured maximum size.
+//   - overQuota, if the account storage quota would be exceeded.
+func (c Client) MessageAppend(ctx context.Context, req MessageAppendRequest) (resp MessageAppendResult, err error) {
+	return transact[MessageAppendResult](ctx, c, "MessageAppend", req)
+}
+
+// MailboxList returns all mailboxes of the account, with message counts.
+func (c Client) MailboxList(ctx context.Context, req MailboxListRequest) (resp MailboxListResult, err error) {
+	return transact[MailboxListResult](ctx, c, "MailboxList", req)
+}
+
+// MailboxCreate creates a new mailbox, and any missing parent mailboxes.
+//
+// Error codes:
+//   - mailboxExists, if the mailbox already exists.
+func (c Client) MailboxCreate(ctx context.Context, req MailboxCreateRequest) (resp MailboxCreateResult, err error) {
+	return transact[MailboxCreateResult](ctx, c, "MailboxCreate", req)
+}
+
+// MailboxRename renames a mailbox and its child mailboxes, possibly moving it to
+// a new parent. The messages in the mailbox keep their ID. Inbox cannot be
+// renamed.
+//
+// Error codes:
+//   - mailboxNotFound, if the mailbox does not exist.
+//   - mailboxExists, if the new mailbox name already exists.
+func (c Client) MailboxRename(ctx context.Context, req MailboxRenameRequest) (resp MailboxRenameResult, err error) {
+	return transact[MailboxRenameResult](ctx, c, "MailboxRename", req)
+}
+
+// MailboxDelete removes a mailbox and all its messages. Inbox and mailboxes with
+// child mailboxes cannot be removed.
+//
+// Error codes:
+//   - mailboxNotFound, if the mailbox does not exist.
+func (c Client) MailboxDelete(ctx context.Context, req MailboxDeleteRequest) (resp MailboxDeleteResult, err error) {
+	return transact[MailboxDeleteResult](ctx, c, "MailboxDelete", req)
+}
+
+// EventsAck acknowledges events received through the event stream, marking the
+// corresponding webhooks as successfully delivered. Webhooks that are configured
+// with a URL are no longer delivered by HTTP POST after acknowledgement. Events
+// are also acknowledged when opening an event stream with a last event ID.
+func (c Client) EventsAck(ctx context.Context, req EventsAckRequest) (resp EventsAckResult, err error) {
+	return transact[EventsAckResult](ctx, c, "EventsAck", req)
+}
+
+// Events opens an event stream (server-sent events) at "events" and returns the
+// webhooks for the account as they are queued, for clients that cannot receive
+// HTTP webhook requests. If lastEventID is non-zero, events up to and including
+// lastEventID are acknowledged (see [Client.EventsAck]) and only later events are
+// returned. Events are returned from both the webhook queue and the retired
+// webhooks, so events can be missed if they were retired longer ago than the
+// configured period to keep retired webhooks.
+//
+// The event stream can also be opened with a standard EventSource in a browser,
+// at the URL with path "events". The "Last-Event-ID" header is used for resuming,
+// or a "lastEventID" query string parameter.
+func (c Client) Events(ctx context.Context, lastEventID int64) (*EventStream, error) {
+	hreq, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL+"events", nil)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %v", err)
+	}
+	hreq.Header.Set("Accept", "text/event-stream")
+	if lastEventID > 0 {
+		hreq.Header.Set("Last-Event-ID", fmt.Sprintf("%d", lastEventID))
+	}
+	if c.Username != "" {
+		hreq.SetBasicAuth(c.Username, c.Password)
+	}
+	hresp, err := c.httpClient().Do(hreq)
+	if err != nil {
+		return nil, fmt.Errorf("http transaction: %v", err)
+	}
+	if hresp.StatusCode != http.StatusOK {
+		defer func() {
+			err := hresp.Body.Close()
+			if err != nil {
+				c.log(ctx).Debug("closing http response body", slog.Any("err", err))
+			}
+		}()
+		return nil, badResponse(hresp)
+	}
+	return &EventStream{hresp.Body, bufio.NewReader(hresp.Body)}, nil
+}
+
+// EventStream reads events from an event stream, see [Client.Events].
+type EventStream struct {
+	body io.ReadCloser
+	br   *bufio.Reader
+}
+
+// Next reads the next event from the stream, blocking until one is available.
+func (es *EventStream) Next() (Event, error) {
+	var ev Event
+	var data strings.Builder
+	for {
+		line, err := es.br.ReadString('\n')
+		if err != nil {
+			return Event{}, err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if line == "" {
+			if data.Len() == 0 {
+				continue
+			}
+			var v any
+			if ev.Event == "incoming" {
+				ev.Incoming = &webhook.Incoming{}
+				v = ev.Incoming
+			} else {
+				ev.Outgoing = &webhook.Outgoing{}
+				v = ev.Outgoing
+			}
+			if err := json.Unmarshal([]byte(data.String()), v); err != nil {
+				return Event{}, fmt.Errorf("parsing event data: %v", err)
+			}
+			return ev, nil
+		}
+		if strings.HasPrefix(line, ":") {
+			// Comment, used for keepalive.
+			continue
+		}
+		k, v, _ := strings.Cut(line, ":")
+		v = strings.TrimPrefix(v, " ")
+		switch k {
+		case "id":
+			ev.ID, err = strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return Event{}, fmt.Errorf("parsing event id: %v", err)
+			}
+		case "event":
+			ev.Event = v
+		case "data":
+			if data.Len() > 0 {
+				data.WriteString("\n")
+			}
+			data.WriteString(v)
+		}
+	}
+}
+
+// Close closes the event stream.
+func (es *EventStream) Close() error {
+	return es.body.Close()
+}
@@ -22,6 +22,10 @@ API is often easier to use for developers since it doesn't require separate
 libraries and/or having (detailed) knowledge about the format of email messages
 ("Internet Message Format"), or the SMTP protocol and its extensions.
 
+The webapi can also be used to manage mailboxes and the messages in them:
+listing, searching, appending, moving and removing messages, and polling for
+changes to messages in a mailbox, without an IMAP library.
+
 Webhooks can be configured per account, and help with automated processing of
 incoming email, and with handling delivery failures/success.  Webhooks are
 often easier to use for developers than monitoring a mailbox with IMAP and
@@ -44,6 +48,16 @@ an interval to "keep retired messages delivered from the queue". This allows
 incoming DSNs to be matched to the original outgoing messages, and enables
 automatic suppression list management.
 
+Instead of the account password, an API key can be used as password. API keys
+start with "moxapi-", are created in the account web interface or with "mox
+config apikey add", and can have an expiration time and be restricted to IP
+ranges. API keys have one or more scopes that determine which methods can be
+called: "send" for Send, "read" for retrieving, listing and searching messages
+and mailboxes and for the event stream, "manage" for adding, changing and
+removing messages and mailboxes and for acknowledging events, and "suppression"
+for managing the suppression list. Calling a method without the required scope
+results in HTTP status 403.
+
 HTTP response status 200 OK indicates a successful method call, status 400
 indicates an error.  The response body of an error is a JSON object with a
 human-readable "Message" field, and a "Code" field for programmatic handling
@@ -80,6 +94,11 @@ Only the latest event for the delivery of a particular outgoing message will be
 delivered, any webhooks for that message still in the queue (after failure to
 deliver) are retired as superseded when a new event occurs.
 
+A webhook with event "limitreached" is sent when a submitted message reaches a
+send limit configured for the account or the domain of its From address, at
+most once per limit per period. See [webhook.SendLimit] for the details in the
+payload.
+
 Webhooks for incoming deliveries are configured separately from outgoing
 deliveries. Incoming DSNs for previously sent messages do not cause a webhook
 to the webhook URL for incoming messages, only to the webhook URL for outgoing
@@ -89,6 +108,37 @@ and the contents of the first text and HTML parts. See [webhook.Incoming] for
 the fields in the JSON object. The full message and individual parts, including
 attachments, can be retrieved using the webapi.
 
+# Event stream
+
+Webhooks can also be retrieved through an event stream, for clients that cannot
+receive HTTP requests, e.g. because they are behind a NAT. An HTTP GET to
+/webapi/v0/events, with HTTP basic authentication like for methods, returns a
+"text/event-stream" response (server-sent events, as used by EventSource in
+browsers). Each event has the webhook ID as event ID, the webhook event as
+event type ("incoming" for incoming deliveries, or one of the outgoing event
+types, e.g. "delivered"), and the JSON payload of the webhook as data. A
+comment line is sent periodically as keepalive.
+
+Events are sent for webhooks still in the webhook queue, and for retired
+webhooks that are kept around (see "KeepRetiredWebhookPeriod" in the account
+configuration). Clients acknowledge events by reconnecting with a
+"Last-Event-ID" header (or a "lastEventID" query string parameter), or by
+calling method EventsAck. With an API key, acknowledging requires scope
+"manage", a stream opened with a key with only scope "read" resumes after the
+event ID without acknowledging. Events up to and including the ID are retired as
+successfully delivered, and are no longer delivered by HTTP POST if a webhook
+URL is configured. Setting "EventStreamOnly" for an outgoing or incoming
+webhook in the account configuration makes webhooks available only through the
+event stream, without a URL. Those webhooks are retired as failed if they are
+not acknowledged within the time span that delivery attempts for regular
+webhooks take. See [Client.Events] for a Go client.
+
+Example of an event:
+
+	id: 10
+	event: incoming
+	data: {"Version":0,"From":[{"Name":"","Address":"remote@remote.example"}],...}
+
 # Transactional email
 
 When sending transactional emails, potentially to many recipients, it is
@@ -27,6 +27,14 @@ type Methods interface {
 	MessageFlagsAdd(ctx context.Context, request MessageFlagsAddRequest) (response MessageFlagsAddResult, err error)
 	MessageFlagsRemove(ctx context.Context, request MessageFlagsRemoveRequest) (response MessageFlagsRemoveResult, err error)
 	MessageMove(ctx context.Context, request MessageMoveRequest) (response MessageMoveResult, err error)
+	MessageList(ctx context.Context, request MessageListRequest) (response MessageListResult, err error)
+	MessageSearch(ctx context.Context, request MessageSearchRequest) (response MessageSearchResult, err error)
+	MessageAppend(ctx context.Context, request MessageAppendRequest) (response MessageAppendResult, err error)
+	MailboxList(ctx context.Context, request MailboxListRequest) (response MailboxListResult, err error)
+	MailboxCreate(ctx context.Context, request MailboxCreateRequest) (response MailboxCreateResult, err error)
+	MailboxRename(ctx context.Context, request MailboxRenameRequest) (response MailboxRenameResult, err error)
+	MailboxDelete(ctx context.Context, request MailboxDeleteRequest) (response MailboxDeleteResult, err error)
+	EventsAck(ctx context.Context, request EventsAckRequest) (response EventsAckResult, err error)
 }
 
 // Error indicates an API-related error.
@@ -265,3 +273,193 @@ type MessageMoveRequest struct {
 	DestMailboxName string // E.g. "Inbox", must already exist.
 }
 type MessageMoveResult struct{}
+
+// MessageSummary is basic information about a message, as returned by
+// MessageList and MessageSearch. Use MessageGet for the full message.
+type MessageSummary struct {
+	MsgID       int64
+	MailboxName string
+	ModSeq      int64     // Modification sequence of last change to the message, e.g. flags.
+	Received    time.Time // When the message was delivered or appended.
+	Size        int64     // Total size of raw message file.
+	Flags       []string  // Standard message flags like \seen, \answered, $forwarded, $junk, $nonjunk, and custom keywords.
+
+	// From message headers.
+	From      []NameAddress
+	To        []NameAddress
+	Subject   string
+	Date      *time.Time
+	MessageID string
+}
+
+type MessageListRequest struct {
+	MailboxName string // E.g. "Inbox". Required.
+
+	// If > 0, only messages that were added, changed or removed after this
+	// modification sequence are returned. Use ModSeq from a previous MessageListResult
+	// to poll for changes. If 0, all messages in the mailbox are returned.
+	SinceModSeq int64
+
+	// For paging through all messages (with SinceModSeq 0): only messages with a
+	// higher ID are returned. Set to the last MsgID of the previous result.
+	AfterMsgID int64
+
+	// Maximum number of messages to return. Default 100, at most 1000. When polling
+	// for changes, more messages can be returned to include all changes of the last
+	// modification sequence.
+	Max int
+}
+type MessageListResult struct {
+	// For all messages, ordered by ID. For changes, ordered by modification sequence.
+	Messages []MessageSummary
+
+	// Only when polling for changes: IDs of messages that were removed from the
+	// mailbox, e.g. deleted or moved to another mailbox.
+	RemovedMsgIDs []int64
+
+	// Modification sequence to use as SinceModSeq for the next call to poll for
+	// changes. When paging through all messages, use the ModSeq of the first page.
+	ModSeq int64
+
+	// Whether more messages are available, with AfterMsgID for all messages, or with
+	// ModSeq as SinceModSeq for changes.
+	HaveMore bool
+}
+
+// SearchCriteria selects messages, with the same functionality as the IMAP SEARCH
+// command. All non-empty fields must match. Matching of strings is case-insensitive.
+type SearchCriteria struct {
+	// Flags that must all be present on a message, or all absent. Standard message
+	// flags like \seen, \answered, \flagged, \deleted, \draft, $forwarded, $junk,
+	// $notjunk, $phishing, $mdnsent, and custom keywords.
+	Flags    []string
+	NotFlags []string
+
+	// Substrings that must each be present in the values of the message header. For
+	// addresses, both the name and the email address are matched.
+	From    []string
+	To      []string
+	CC      []string
+	BCC     []string
+	Subject []string
+
+	// Header keys and substrings of values that must each be present. If the value is
+	// empty, only the presence of the header is checked.
+	Headers [][2]string
+
+	// Words that must each be present in the decoded text parts of the message
+	// (Body), or in the text parts and headers (Text).
+	Body []string
+	Text []string
+
+	// Time the message was delivered or appended.
+	ReceivedBefore *time.Time
+	ReceivedSince  *time.Time
+
+	// Date from message header. Like IMAP, only the dates are compared, disregarding
+	// time and timezone.
+	SentBefore *time.Time
+	SentSince  *time.Time
+
+	SizeLarger  int64 // Size of raw message larger than this, if > 0.
+	SizeSmaller int64 // Size of raw message smaller than this, if > 0.
+
+	// Only messages with a modification sequence at or above this value, if > 0.
+	ModSeqMin int64
+
+	// If set, messages must not match these criteria.
+	Not *SearchCriteria
+
+	// If non-empty, messages must match at least one of these criteria.
+	Or []SearchCriteria
+}
+
+type MessageSearchRequest struct {
+	// If non-empty, only messages in this mailbox are searched. Otherwise messages in
+	// all mailboxes.
+	MailboxName string
+
+	Criteria SearchCriteria
+
+	// For paging through results: only messages with a lower ID are searched. Set to
+	// the last MsgID of the previous result.
+	BeforeMsgID int64
+
+	// Maximum number of messages to return. Default 100, at most 1000.
+	Max int
+}
+type MessageSearchResult struct {
+	Messages []MessageSummary // Ordered by ID, most recent first.
+	HaveMore bool             // Whether more messages may match, see BeforeMsgID.
+}
+
+type MessageAppendRequest struct {
+	MailboxName string   // E.g. "Inbox" or "Archive", must already exist.
+	Flags       []string // Optional, e.g. \seen or custom keywords.
+
+	// Optional, time the message is marked as received. Current time if absent.
+	Received *time.Time
+
+	// Raw message (internet message file with headers and body), base64-encoded. Not
+	// needed if the message is uploaded as form file "message" in a
+	// multipart/form-data request.
+	Data string
+}
+type MessageAppendResult struct {
+	MsgID int64 // ID of the new message.
+}
+
+// Mailbox is a mailbox (folder) of an account.
+type Mailbox struct {
+	ID   int64
+	Name string // Full name, with "/" as hierarchy separator, e.g. "Inbox" or "Lists/Mox".
+
+	// Special-use roles of the mailbox, one or more of \Archive, \Drafts, \Junk,
+	// \Sent, \Trash.
+	SpecialUse []string
+
+	Total  int64 // Number of messages, excluding messages marked \deleted.
+	Unseen int64 // Number of messages without \seen flag.
+	Size   int64 // Total size of all messages in bytes.
+}
+
+type MailboxListRequest struct{}
+type MailboxListResult struct {
+	Mailboxes []Mailbox // Ordered by name.
+}
+
+type MailboxCreateRequest struct {
+	MailboxName string // Parent mailboxes are created as needed.
+}
+type MailboxCreateResult struct {
+	Mailbox Mailbox
+}
+
+type MailboxRenameRequest struct {
+	MailboxName    string
+	NewMailboxName string // Parent mailboxes are created as needed. Child mailboxes are renamed too.
+}
+type MailboxRenameResult struct{}
+
+type MailboxDeleteRequest struct {
+	MailboxName string // Cannot be Inbox. Mailbox cannot have child mailboxes.
+}
+type MailboxDeleteResult struct{}
+
+type EventsAckRequest struct {
+	LastEventID int64 // ID of last event processed, all events up to and including this ID are acknowledged.
+}
+type EventsAckResult struct{}
+
+// Event is a webhook received through the event stream, see [Client.Events].
+type Event struct {
+	ID int64 // Unique ID of the webhook, same as in X-Mox-Webhook-ID for HTTP webhook requests.
+
+	// "incoming" for incoming deliveries, or an outgoing event, see
+	// [webhook.OutgoingEvent].
+	Event string
+
+	// Exactly one is set, depending on Event.
+	Incoming *webhook.Incoming
+	Outgoing *webhook.Outgoing
+}
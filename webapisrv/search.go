@@ -0,0 +1,240 @@
+package webapisrv
+
+import (
+	"errors"
+	"log/slog"
+	"net/textproto"
+	"slices"
+	"strings"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/message"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/store"
+	"github.com/mjl-/mox/webapi"
+)
+
+// Matching of search criteria for MessageSearch, with the same semantics as IMAP
+// SEARCH, see ../imapserver/search.go.
+
+// xcheckSearchCriteria checks the flags in the criteria, and nested criteria.
+func xcheckSearchCriteria(c webapi.SearchCriteria) {
+	_, _, err := store.ParseFlagsKeywords(c.Flags)
+	xcheckuserf(err, "parsing flags")
+	_, _, err = store.ParseFlagsKeywords(c.NotFlags)
+	xcheckuserf(err, "parsing flags")
+	for _, h := range c.Headers {
+		if h[0] == "" {
+			xcheckuserf(errors.New("empty header key"), "checking headers")
+		}
+	}
+	if c.Not != nil {
+		xcheckSearchCriteria(*c.Not)
+	}
+	for _, oc := range c.Or {
+		xcheckSearchCriteria(oc)
+	}
+}
+
+// searchMessage is a message being matched against search criteria. The message
+// file is only opened and parsed when needed.
+type searchMessage struct {
+	log mlog.Log
+	acc *store.Account
+	m   store.Message
+	tx  *bstore.Tx
+
+	// Word searches, shared between messages of a search so the full-text search
+	// index is only read once. Keyed by the words joined with NUL bytes.
+	wordSearches map[string]*store.WordSearch
+
+	mr         *store.MsgReader
+	p          *message.Part
+	partLoaded bool
+}
+
+func (s *searchMessage) close() {
+	if s.mr != nil {
+		err := s.mr.Close()
+		s.log.Check(err, "closing message reader")
+		s.mr = nil
+	}
+}
+
+// wordSearch returns a (cached) prepared word search for words.
+func (s *searchMessage) wordSearch(words []string) *store.WordSearch {
+	k := strings.Join(words, "\x00")
+	ws, ok := s.wordSearches[k]
+	if !ok {
+		nws := store.PrepareWordSearch(words, nil)
+		ws = &nws
+		s.wordSearches[k] = ws
+	}
+	return ws
+}
+
+// part returns the parsed message, or nil if it cannot be loaded.
+func (s *searchMessage) part() *message.Part {
+	if s.partLoaded {
+		return s.p
+	}
+	s.partLoaded = true
+	s.mr = s.acc.MessageReader(s.m)
+	p, err := s.m.LoadPart(s.mr)
+	if err != nil {
+		s.log.Infox("loading parsed message for search, not matching", err, slog.Int64("msgid", s.m.ID))
+		return nil
+	}
+	s.p = &p
+	return s.p
+}
+
+func (s *searchMessage) hasFlag(flag string) bool {
+	f := s.m.Flags
+	switch strings.ToLower(flag) {
+	case `\answered`:
+		return f.Answered
+	case `\flagged`:
+		return f.Flagged
+	case `\deleted`:
+		return f.Deleted
+	case `\seen`:
+		return f.Seen
+	case `\draft`:
+		return f.Draft
+	case `$junk`:
+		return f.Junk
+	case `$notjunk`:
+		return f.Notjunk
+	case `$forwarded`:
+		return f.Forwarded
+	case `$phishing`:
+		return f.Phishing
+	case `$mdnsent`:
+		return f.MDNSent
+	default:
+		return slices.Contains(s.m.Keywords, strings.ToLower(flag))
+	}
+}
+
+// headerContains returns whether a value of header key contains substr, or if
+// substr is empty, whether the header is present.
+func (s *searchMessage) headerContains(key, substr string) bool {
+	p := s.part()
+	if p == nil {
+		return false
+	}
+	h, err := p.Header()
+	if err != nil {
+		s.log.Debugx("parsing message header for search", err, slog.Int64("msgid", s.m.ID))
+		return false
+	}
+	lower := strings.ToLower(substr)
+	for _, v := range h.Values(textproto.CanonicalMIMEHeaderKey(key)) {
+		if lower == "" || strings.Contains(strings.ToLower(v), lower) {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns whether the message matches all criteria. Checks that only need
+// the message metadata from the database are done first.
+func (s *searchMessage) match(c webapi.SearchCriteria) bool {
+	m := s.m
+
+	for _, f := range c.Flags {
+		if !s.hasFlag(f) {
+			return false
+		}
+	}
+	for _, f := range c.NotFlags {
+		if s.hasFlag(f) {
+			return false
+		}
+	}
+	if c.ReceivedBefore != nil && !m.Received.Before(*c.ReceivedBefore) {
+		return false
+	}
+	if c.ReceivedSince != nil && m.Received.Before(*c.ReceivedSince) {
+		return false
+	}
+	if c.SizeLarger > 0 && m.Size <= c.SizeLarger {
+		return false
+	}
+	if c.SizeSmaller > 0 && m.Size >= c.SizeSmaller {
+		return false
+	}
+	if c.ModSeqMin > 0 && m.ModSeq.Client() < c.ModSeqMin {
+		return false
+	}
+
+	if c.SentBefore != nil || c.SentSince != nil {
+		p := s.part()
+		if p == nil || p.Envelope == nil || p.Envelope.Date.IsZero() {
+			return false
+		}
+		// Like IMAP, only dates are compared, disregarding time and timezone.
+		date := p.Envelope.Date.Format("2006-01-02")
+		if c.SentBefore != nil && date >= c.SentBefore.Format("2006-01-02") || c.SentSince != nil && date < c.SentSince.Format("2006-01-02") {
+			return false
+		}
+	}
+
+	for _, t := range []struct {
+		key    string
+		values []string
+	}{
+		{"From", c.From},
+		{"To", c.To},
+		{"Cc", c.CC},
+		{"Bcc", c.BCC},
+		{"Subject", c.Subject},
+	} {
+		for _, v := range t.values {
+			if !s.headerContains(t.key, v) {
+				return false
+			}
+		}
+	}
+	for _, h := range c.Headers {
+		if !s.headerContains(h[0], h[1]) {
+			return false
+		}
+	}
+
+	for _, t := range []struct {
+		words     []string
+		headerToo bool
+	}{
+		{c.Body, false},
+		{c.Text, true},
+	} {
+		if len(t.words) == 0 {
+			continue
+		}
+		ws := s.wordSearch(t.words)
+		match, indexed, err := ws.MatchIndex(s.tx, s.m.ID, t.headerToo)
+		xcheckf(err, "word search in index")
+		if !indexed {
+			p := s.part()
+			if p == nil {
+				return false
+			}
+			match, err = ws.MatchPart(s.log, p, t.headerToo)
+			xcheckf(err, "word search")
+		}
+		if !match {
+			return false
+		}
+	}
+
+	if c.Not != nil && s.match(*c.Not) {
+		return false
+	}
+	if len(c.Or) > 0 && !slices.ContainsFunc(c.Or, s.match) {
+		return false
+	}
+	return true
+}
@@ -24,6 +24,7 @@ import (
 	"reflect"
 	"runtime/debug"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -55,7 +56,7 @@ var (
 	metricSubmission = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "mox_webapi_submission_total",
-			Help: "Webapi message submission results, known values (those ending with error are server errors): ok, badfrom, messagelimiterror, recipientlimiterror, queueerror, storesenterror, domaindisabled.",
+			Help: "Webapi message submission results, known values (those ending with error are server errors): ok, badfrom, messagelimiterror, recipientlimiterror, sendlimiterror, queueerror, storesenterror, domaindisabled.",
 		},
 		[]string{
 			"result",
@@ -299,6 +300,10 @@ func (s server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	fn := r.URL.Path[len("/v0/"):]
 	log = log.With(slog.String("method", fn))
+	if fn == "events" {
+		s.serveEvents(log, w, r)
+		return
+	}
 	rfn := reflect.ValueOf(s).MethodByName(fn)
 	var zero reflect.Value
 	if rfn == zero || rfn.Type().NumIn() != 2 || rfn.Type().NumOut() != 2 {
@@ -364,33 +369,8 @@ func (s server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	defer closeAccount()
 
-	email, password, aok := r.BasicAuth()
-	if !aok {
-		metricResults.WithLabelValues(fn, "badauth").Inc()
-		log.Debug("missing http basic authentication credentials")
-		w.Header().Set("WWW-Authenticate", "Basic realm=webapi")
-		http.Error(w, "401 - unauthorized - use http basic auth with email address as username", http.StatusUnauthorized)
-		return
-	}
-	log = log.With(slog.String("username", email))
-
 	t0 := time.Now()
 
-	// If client IP/network resulted in too many authentication failures, refuse to serve.
-	clientIP := webauth.ClientIP(log, s.isForwarded, r)
-	if clientIP == nil {
-		metricResults.WithLabelValues(fn, "internal").Inc()
-		log.Debug("cannot find remote ip for rate limiter")
-		http.Error(w, "500 - internal server error - cannot find remote ip", http.StatusInternalServerError)
-		return
-	}
-	if !mox.LimiterFailedAuth.CanAdd(clientIP, t0, 1) {
-		metrics.AuthenticationRatelimitedInc("webapi")
-		log.Debug("refusing connection due to many auth failures", slog.Any("clientip", clientIP))
-		http.Error(w, "429 - too many auth attempts", http.StatusTooManyRequests)
-		return
-	}
-
 	writeError := func(err webapi.Error) {
 		closeAccount()
 		metricResults.WithLabelValues(fn, err.Code).Inc()
@@ -421,39 +401,22 @@ func (s server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		log.Check(werr, "writing error response")
 	}
 
-	la := loginAttempt(clientIP.String(), r, "webapi", "httpbasic")
-	la.LoginAddress = email
-	defer func() {
-		store.LoginAttemptAdd(context.Background(), log, la)
-		metricDuration.WithLabelValues(fn).Observe(float64(time.Since(t0)) / float64(time.Second))
-	}()
-
-	var err error
-	acc, la.AccountName, err = store.OpenEmailAuth(log, email, password, true)
-	if err != nil {
-		mox.LimiterFailedAuth.Add(clientIP, t0, 1)
-		if errors.Is(err, mox.ErrDomainNotFound) || errors.Is(err, mox.ErrAddressNotFound) || errors.Is(err, store.ErrUnknownCredentials) || errors.Is(err, store.ErrLoginDisabled) {
-			log.Debug("bad http basic authentication credentials")
-			metricResults.WithLabelValues(fn, "badauth").Inc()
-			la.Result = store.AuthBadCredentials
-			msg := "use http basic auth with email address as username"
-			if errors.Is(err, store.ErrLoginDisabled) {
-				la.Result = store.AuthLoginDisabled
-				msg = "login is disabled for this account"
-			}
-			w.Header().Set("WWW-Authenticate", "Basic realm=webapi")
-			http.Error(w, "401 - unauthorized - "+msg, http.StatusUnauthorized)
-			return
-		}
-		writeError(webapi.Error{Code: "server", Message: "error verifying credentials"})
+	var email string
+	var key *store.APIKey
+	var la *store.LoginAttempt
+	log, acc, email, key, la = s.authenticate(log, fn, w, r, writeError)
+	if la != nil {
+		defer func() {
+			store.LoginAttemptAdd(context.Background(), log, *la)
+			metricDuration.WithLabelValues(fn).Observe(float64(time.Since(t0)) / float64(time.Second))
+		}()
+	}
+	if acc == nil || !checkScope(log, fn, key, w) {
 		return
 	}
-	la.AccountName = acc.Name
-	la.Result = store.AuthSuccess
-	mox.LimiterFailedAuth.Reset(clientIP, t0)
 
 	ct := r.Header.Get("Content-Type")
-	ct, _, err = mime.ParseMediaType(ct)
+	ct, _, err := mime.ParseMediaType(ct)
 	if err != nil {
 		writeError(webapi.Error{Code: "protocol", Message: "unknown content-type " + r.Header.Get("Content-Type")})
 		return
@@ -527,6 +490,263 @@ func (s server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	log.Check(err, "writing response to client")
 }
 
+// authenticate checks the HTTP basic authentication credentials of the request,
+// taking rate limiting of failed authentication attempts into account. The
+// password can be the account password or an API key. If acc is nil, a response
+// has been written. If la is not nil, the caller must add it to the store after
+// handling the request. If an API key was used, key is non-nil and the caller must
+// check its scopes.
+func (s server) authenticate(log mlog.Log, fn string, w http.ResponseWriter, r *http.Request, writeError func(err webapi.Error)) (rlog mlog.Log, acc *store.Account, email string, key *store.APIKey, la *store.LoginAttempt) {
+	email, password, aok := r.BasicAuth()
+	if !aok {
+		metricResults.WithLabelValues(fn, "badauth").Inc()
+		log.Debug("missing http basic authentication credentials")
+		w.Header().Set("WWW-Authenticate", "Basic realm=webapi")
+		http.Error(w, "401 - unauthorized - use http basic auth with email address as username", http.StatusUnauthorized)
+		return log, nil, "", nil, nil
+	}
+	log = log.With(slog.String("username", email))
+
+	t0 := time.Now()
+
+	// If client IP/network resulted in too many authentication failures, refuse to serve.
+	clientIP := webauth.ClientIP(log, s.isForwarded, r)
+	if clientIP == nil {
+		metricResults.WithLabelValues(fn, "internal").Inc()
+		log.Debug("cannot find remote ip for rate limiter")
+		http.Error(w, "500 - internal server error - cannot find remote ip", http.StatusInternalServerError)
+		return log, nil, email, nil, nil
+	}
+	if !mox.LimiterFailedAuth.CanAdd(clientIP, t0, 1) {
+		metrics.AuthenticationRatelimitedInc("webapi")
+		log.Debug("refusing connection due to many auth failures", slog.Any("clientip", clientIP))
+		http.Error(w, "429 - too many auth attempts", http.StatusTooManyRequests)
+		return log, nil, email, nil, nil
+	}
+
+	// API keys have a recognizable prefix, we don't try them as password.
+	isAPIKey := strings.HasPrefix(password, store.APIKeyPrefix)
+	authMech := "httpbasic"
+	if isAPIKey {
+		authMech = "apikey"
+	}
+	xla := loginAttempt(clientIP.String(), r, "webapi", authMech)
+	la = &xla
+	la.LoginAddress = email
+
+	var err error
+	if isAPIKey {
+		var k store.APIKey
+		acc, la.AccountName, k, err = store.OpenEmailAPIKey(r.Context(), log, email, password, clientIP, true)
+		if err == nil {
+			key = &k
+			la.APIKeyName = k.Name
+			log = log.With(slog.String("apikey", k.Name))
+		}
+	} else {
+		acc, la.AccountName, la.AppPasswordName, err = store.OpenEmailAuthProtocol(log, email, password, store.AppPasswordWebAPI, clientIP, true)
+	}
+	if err != nil {
+		mox.LimiterFailedAuth.Add(clientIP, t0, 1)
+		if errors.Is(err, mox.ErrDomainNotFound) || errors.Is(err, mox.ErrAddressNotFound) || errors.Is(err, store.ErrUnknownCredentials) || errors.Is(err, store.ErrLoginDisabled) || errors.Is(err, store.ErrAPIKeyNotAllowed) {
+			log.Debugx("bad http basic authentication credentials", err)
+			metricResults.WithLabelValues(fn, "badauth").Inc()
+			la.Result = store.AuthBadCredentials
+			msg := "use http basic auth with email address as username"
+			if errors.Is(err, store.ErrLoginDisabled) {
+				la.Result = store.AuthLoginDisabled
+				msg = "login is disabled for this account"
+			} else if errors.Is(err, store.ErrAPIKeyNotAllowed) {
+				msg = "api key expired or not allowed from this ip"
+			}
+			w.Header().Set("WWW-Authenticate", "Basic realm=webapi")
+			http.Error(w, "401 - unauthorized - "+msg, http.StatusUnauthorized)
+			return log, nil, email, nil, la
+		}
+		writeError(webapi.Error{Code: "server", Message: "error verifying credentials"})
+		return log, nil, email, nil, la
+	}
+	la.AccountName = acc.Name
+	la.Result = store.AuthSuccess
+	mox.LimiterFailedAuth.Reset(clientIP, t0)
+	return log, acc, email, key, la
+}
+
+// methodScopes maps webapi methods to the API key scope needed to call them.
+var methodScopes = map[string]string{
+	"Send":               store.APIScopeSend,
+	"SuppressionList":    store.APIScopeSuppression,
+	"SuppressionAdd":     store.APIScopeSuppression,
+	"SuppressionRemove":  store.APIScopeSuppression,
+	"SuppressionPresent": store.APIScopeSuppression,
+	"MessageGet":         store.APIScopeRead,
+	"MessageRawGet":      store.APIScopeRead,
+	"MessagePartGet":     store.APIScopeRead,
+	"MessageList":        store.APIScopeRead,
+	"MessageSearch":      store.APIScopeRead,
+	"MailboxList":        store.APIScopeRead,
+	"MessageDelete":      store.APIScopeManage,
+	"MessageFlagsAdd":    store.APIScopeManage,
+	"MessageFlagsRemove": store.APIScopeManage,
+	"MessageMove":        store.APIScopeManage,
+	"MessageAppend":      store.APIScopeManage,
+	"MailboxCreate":      store.APIScopeManage,
+	"MailboxRename":      store.APIScopeManage,
+	"MailboxDelete":      store.APIScopeManage,
+	"EventsAck":          store.APIScopeManage, // Retires webhooks, changing state.
+	"events":             store.APIScopeRead,
+}
+
+// checkScope checks if the API key, if any, allows calling method fn. If not, a
+// response is written and false is returned.
+func checkScope(log mlog.Log, fn string, key *store.APIKey, w http.ResponseWriter) bool {
+	if key == nil {
+		return true
+	}
+	scope := methodScopes[fn]
+	if scope != "" && key.HasScope(scope) {
+		return true
+	}
+	metricResults.WithLabelValues(fn, "forbidden").Inc()
+	log.Debug("api key does not have scope for method", slog.String("scope", scope))
+	http.Error(w, fmt.Sprintf("403 - forbidden - api key does not have scope %q", scope), http.StatusForbidden)
+	return false
+}
+
+// serveEvents serves webhooks for the account as server-sent events
+// (text/event-stream). Clients acknowledge events by reconnecting with a
+// Last-Event-ID header (or lastEventID query string parameter), or by calling
+// EventsAck. Acknowledged events are retired as successfully delivered.
+// Acknowledging requires the same scope as EventsAck. For API keys without that
+// scope, the stream resumes after the Last-Event-ID without acknowledging.
+func (s server) serveEvents(log mlog.Log, w http.ResponseWriter, r *http.Request) {
+	const fn = "events"
+
+	if r.Method != "GET" {
+		http.Error(w, "405 - method not allowed - use get", http.StatusMethodNotAllowed)
+		return
+	}
+
+	t0 := time.Now()
+
+	writeError := func(err webapi.Error) {
+		metricResults.WithLabelValues(fn, err.Code).Inc()
+		log.Infox("webapi events result", err, slog.String("resultcode", err.Code))
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusBadRequest)
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		werr := enc.Encode(err)
+		log.Check(werr, "writing error response")
+	}
+
+	log, acc, _, key, la := s.authenticate(log, fn, w, r, writeError)
+	if la != nil {
+		store.LoginAttemptAdd(context.Background(), log, *la)
+		metricDuration.WithLabelValues(fn).Observe(float64(time.Since(t0)) / float64(time.Second))
+	}
+	if acc == nil {
+		return
+	}
+	if !checkScope(log, fn, key, w) {
+		err := acc.Close()
+		log.Check(err, "closing account")
+		return
+	}
+	// We only need the account name, hooks are in the queue database.
+	accName := acc.Name
+	err := acc.Close()
+	log.Check(err, "closing account")
+
+	var lastID int64
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		lastID, err = strconv.ParseInt(v, 10, 64)
+	} else if v := r.URL.Query().Get("lastEventID"); v != "" {
+		lastID, err = strconv.ParseInt(v, 10, 64)
+	}
+	if err != nil || lastID < 0 {
+		writeError(webapi.Error{Code: "user", Message: "bad last event id"})
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		log.Error("internal error: ResponseWriter not a http.Flusher")
+		http.Error(w, "500 - internal error - cannot stream events", http.StatusInternalServerError)
+		return
+	}
+
+	// Subscribe before acknowledging and listing, so we don't miss new hooks.
+	kick, unsubscribe := queue.HookStreamSubscribe()
+	defer unsubscribe()
+
+	ctx := r.Context()
+
+	if lastID > 0 && key != nil && !key.HasScope(methodScopes["EventsAck"]) {
+		log.Debug("api key does not have scope for acknowledging events, resuming without acknowledging", slog.Int64("lasteventid", lastID))
+	} else if lastID > 0 {
+		n, err := queue.HookAcknowledge(ctx, log, accName, lastID)
+		if err != nil {
+			log.Errorx("acknowledging hooks", err)
+			http.Error(w, "500 - internal error - acknowledging events", http.StatusInternalServerError)
+			return
+		}
+		log.Debug("acknowledged hooks through event stream", slog.Int("count", n), slog.Int64("lasteventid", lastID))
+	}
+
+	metricResults.WithLabelValues(fn, "ok").Inc()
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// Clients and proxies may close idle connections. We send a comment as keepalive
+	// and also poll for new events, for hooks that were queued without a kick reaching
+	// us in time.
+	ticker := time.NewTicker(15 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		for {
+			events, err := queue.HookStreamList(ctx, accName, lastID, 100)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Errorx("listing hooks for event stream", err)
+				}
+				return
+			}
+			for _, e := range events {
+				// Payload is JSON that we wrote, without newlines.
+				_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Event, e.Payload)
+				if err != nil {
+					log.Debugx("writing event", err)
+					return
+				}
+				lastID = e.ID
+			}
+			flusher.Flush()
+			if len(events) < 100 {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-kick:
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				log.Debugx("writing keepalive", err)
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
 // loginAttempt initializes a store.LoginAttempt, for adding to the store after
 // filling in the results and other details.
 func loginAttempt(clientIP string, r *http.Request, protocol, authMech string) store.LoginAttempt {
@@ -751,6 +971,23 @@ func (s server) Send(ctx context.Context, req webapi.SendRequest) (resp webapi.S
 	xcheckcontrol(m.MessageID)
 	xc.Header("Message-Id", m.MessageID)
 
+	// Check send limits for account and domain, recording usage. May add a hold rule.
+	// If we don't queue the message after all, the usage is removed again.
+	usage, err := queue.SendLimitCheck(ctx, log, acc.Name, from.Address.Domain, queue.SendSourceWebAPI, len(recipients), m.MessageID, m.Subject)
+	if errors.Is(err, queue.ErrSendLimit) {
+		metricSubmission.WithLabelValues("sendlimiterror").Inc()
+		panic(webapi.Error{Code: "sendLimitReached", Message: err.Error()})
+	} else {
+		xcheckf(err, "checking send limits")
+	}
+	var queued bool
+	defer func() {
+		if !queued {
+			err := queue.SendUsageRemove(context.Background(), usage)
+			log.Check(err, "removing send usage for message that was not queued")
+		}
+	}()
+
 	if len(m.References) > 0 {
 		for _, ref := range m.References {
 			xcheckcontrol(ref)
@@ -1036,6 +1273,7 @@ func (s server) Send(ctx context.Context, req webapi.SendRequest) (resp webapi.S
 		metricSubmission.WithLabelValues("queueerror").Inc()
 	}
 	xcheckf(err, "adding messages to the delivery queue")
+	queued = true
 	metricSubmission.WithLabelValues("ok").Inc()
 
 	// Message has been added to the queue. Ensure we finish the work.
@@ -1130,6 +1368,16 @@ func (s server) Send(ctx context.Context, req webapi.SendRequest) (resp webapi.S
 	return resp, nil
 }
 
+func (s server) EventsAck(ctx context.Context, req webapi.EventsAckRequest) (resp webapi.EventsAckResult, err error) {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	if req.LastEventID <= 0 {
+		xcheckuserf(errors.New("must be larger than zero"), "checking last event id")
+	}
+	_, err = queue.HookAcknowledge(ctx, reqInfo.Log, reqInfo.Account.Name, req.LastEventID)
+	xcheckf(err, "acknowledging events")
+	return resp, nil
+}
+
 func (s server) SuppressionList(ctx context.Context, req webapi.SuppressionListRequest) (resp webapi.SuppressionListResult, err error) {
 	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
 	resp.Suppressions, err = queue.SuppressionList(ctx, reqInfo.Account.Name)
@@ -1386,3 +1634,419 @@ func (s server) MessageMove(ctx context.Context, req webapi.MessageMoveRequest)
 	xops.MessageMove(ctx, reqInfo.Log, reqInfo.Account, []int64{req.MsgID}, req.DestMailboxName, 0)
 	return
 }
+
+// xmailboxName returns the (non-expunged) mailbox by name, or aborts with error
+// code mailboxNotFound.
+func xmailboxName(tx *bstore.Tx, acc *store.Account, name string) store.Mailbox {
+	mb, err := acc.MailboxFind(tx, name)
+	xcheckf(err, "looking up mailbox")
+	if mb == nil {
+		panic(webapi.Error{Code: "mailboxNotFound", Message: fmt.Sprintf("mailbox %q not found", name)})
+	}
+	return *mb
+}
+
+func webapiMailbox(mb store.Mailbox) webapi.Mailbox {
+	var specialUse []string
+	for _, su := range []struct {
+		have bool
+		flag string
+	}{
+		{mb.Archive, `\Archive`},
+		{mb.Draft, `\Drafts`},
+		{mb.Junk, `\Junk`},
+		{mb.Sent, `\Sent`},
+		{mb.Trash, `\Trash`},
+	} {
+		if su.have {
+			specialUse = append(specialUse, su.flag)
+		}
+	}
+	return webapi.Mailbox{
+		ID:         mb.ID,
+		Name:       mb.Name,
+		SpecialUse: specialUse,
+		Total:      mb.Total,
+		Unseen:     mb.Unseen,
+		Size:       mb.MailboxCounts.Size,
+	}
+}
+
+func (s server) MailboxList(ctx context.Context, req webapi.MailboxListRequest) (resp webapi.MailboxListResult, err error) {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc := reqInfo.Account
+
+	acc.WithRLock(func() {
+		xdbread(ctx, acc, func(tx *bstore.Tx) {
+			q := bstore.QueryTx[store.Mailbox](tx)
+			q.FilterEqual("Expunged", false)
+			q.SortAsc("Name")
+			err := q.ForEach(func(mb store.Mailbox) error {
+				resp.Mailboxes = append(resp.Mailboxes, webapiMailbox(mb))
+				return nil
+			})
+			xcheckf(err, "listing mailboxes")
+		})
+	})
+	return resp, nil
+}
+
+func (s server) MailboxCreate(ctx context.Context, req webapi.MailboxCreateRequest) (resp webapi.MailboxCreateResult, err error) {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc := reqInfo.Account
+
+	name, _, err := store.CheckMailboxName(req.MailboxName, false)
+	xcheckuserf(err, "checking mailbox name")
+
+	acc.WithWLock(func() {
+		var changes []store.Change
+		xdbwrite(ctx, acc, func(tx *bstore.Tx) {
+			mb, nchanges, _, exists, err := acc.MailboxCreate(tx, name, store.SpecialUse{})
+			if exists {
+				panic(webapi.Error{Code: "mailboxExists", Message: "mailbox already exists"})
+			}
+			xcheckf(err, "creating mailbox")
+			changes = nchanges
+			resp.Mailbox = webapiMailbox(mb)
+		})
+		store.BroadcastChanges(acc, changes)
+	})
+	return resp, nil
+}
+
+func (s server) MailboxRename(ctx context.Context, req webapi.MailboxRenameRequest) (resp webapi.MailboxRenameResult, err error) {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc := reqInfo.Account
+
+	newName, _, err := store.CheckMailboxName(req.NewMailboxName, false)
+	xcheckuserf(err, "checking new mailbox name")
+
+	acc.WithWLock(func() {
+		var changes []store.Change
+		xdbwrite(ctx, acc, func(tx *bstore.Tx) {
+			mb := xmailboxName(tx, acc, req.MailboxName)
+			var isInbox, alreadyExists bool
+			var modseq store.ModSeq
+			var err error
+			changes, isInbox, alreadyExists, err = acc.MailboxRename(tx, &mb, newName, &modseq)
+			if alreadyExists {
+				panic(webapi.Error{Code: "mailboxExists", Message: "destination mailbox already exists"})
+			} else if isInbox {
+				xcheckuserf(err, "renaming mailbox")
+			}
+			xcheckf(err, "renaming mailbox")
+		})
+		store.BroadcastChanges(acc, changes)
+	})
+	return resp, nil
+}
+
+func (s server) MailboxDelete(ctx context.Context, req webapi.MailboxDeleteRequest) (resp webapi.MailboxDeleteResult, err error) {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	log := reqInfo.Log
+	acc := reqInfo.Account
+
+	acc.WithWLock(func() {
+		var changes []store.Change
+		xdbwrite(ctx, acc, func(tx *bstore.Tx) {
+			mb := xmailboxName(tx, acc, req.MailboxName)
+			if mb.Name == "Inbox" {
+				// Inbox is special in IMAP and cannot be removed.
+				xcheckuserf(errors.New("cannot remove special Inbox"), "checking mailbox")
+			}
+
+			var hasChildren bool
+			var err error
+			changes, hasChildren, err = acc.MailboxDelete(ctx, log, tx, &mb)
+			if hasChildren {
+				xcheckuserf(errors.New("mailbox has children"), "deleting mailbox")
+			}
+			xcheckf(err, "deleting mailbox")
+		})
+		store.BroadcastChanges(acc, changes)
+	})
+	return resp, nil
+}
+
+// xmessageSummary returns the summary for a message, with envelope information
+// from the parsed message.
+func xmessageSummary(log mlog.Log, m store.Message, mailboxName string) webapi.MessageSummary {
+	ms := webapi.MessageSummary{
+		MsgID:       m.ID,
+		MailboxName: mailboxName,
+		ModSeq:      m.ModSeq.Client(),
+		Received:    m.Received,
+		Size:        m.Size,
+		Flags:       append(m.Flags.Strings(), m.Keywords...),
+	}
+	var p message.Part
+	if err := json.Unmarshal(m.ParsedBuf, &p); err != nil {
+		log.Debugx("parsing parsed message for summary", err, slog.Int64("msgid", m.ID))
+		return ms
+	}
+	if env := p.Envelope; env != nil {
+		ms.From = webapiAddressesLax(env.From)
+		ms.To = webapiAddressesLax(env.To)
+		ms.Subject = env.Subject
+		if !env.Date.IsZero() {
+			ms.Date = &env.Date
+		}
+		ms.MessageID = env.MessageID
+	}
+	return ms
+}
+
+// webapiAddressesLax is like xwebapiAddresses, but keeps addresses that cannot be
+// parsed as is. For listing many messages, where a single message with a
+// malformed address should not cause an error.
+func webapiAddressesLax(l []message.Address) []webapi.NameAddress {
+	r := make([]webapi.NameAddress, len(l))
+	for i, ma := range l {
+		addr := ma.User + "@" + ma.Host
+		if dom, err := dns.ParseDomain(ma.Host); err == nil {
+			if lp, err := smtp.ParseLocalpart(ma.User); err == nil {
+				addr = smtp.NewAddress(lp, dom).Pack(true)
+			}
+		}
+		r[i] = webapi.NameAddress{Name: ma.Name, Address: addr}
+	}
+	return r
+}
+
+// xmaxResults returns the number of results to return for a request, with a
+// default and an upper limit.
+func xmaxResults(n int) int {
+	if n < 0 {
+		xcheckuserf(errors.New("must be >= 0"), "checking max")
+	} else if n == 0 {
+		return 100
+	}
+	return min(n, 1000)
+}
+
+func (s server) MessageList(ctx context.Context, req webapi.MessageListRequest) (resp webapi.MessageListResult, err error) {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	log := reqInfo.Log
+	acc := reqInfo.Account
+
+	max := xmaxResults(req.Max)
+	if req.SinceModSeq < 0 || req.AfterMsgID < 0 {
+		xcheckuserf(errors.New("must be >= 0"), "checking modseq and message id")
+	}
+
+	acc.WithRLock(func() {
+		xdbread(ctx, acc, func(tx *bstore.Tx) {
+			mb := xmailboxName(tx, acc, req.MailboxName)
+
+			syncState := store.SyncState{ID: 1}
+			err := tx.Get(&syncState)
+			if err != nil && err != bstore.ErrAbsent {
+				xcheckf(err, "get modseq")
+			}
+			resp.ModSeq = syncState.LastModSeq.Client()
+
+			q := bstore.QueryTx[store.Message](tx)
+			q.FilterNonzero(store.Message{MailboxID: mb.ID})
+
+			if req.SinceModSeq == 0 {
+				q.FilterEqual("Expunged", false)
+				q.FilterGreater("ID", req.AfterMsgID)
+				q.SortAsc("ID")
+				q.Limit(max + 1)
+				l, err := q.List()
+				xcheckf(err, "listing messages")
+				if len(l) > max {
+					l = l[:max]
+					resp.HaveMore = true
+				}
+				for _, m := range l {
+					resp.Messages = append(resp.Messages, xmessageSummary(log, m, mb.Name))
+				}
+				return
+			}
+
+			// Polling for changes. If expunged messages have been removed from the database,
+			// we cannot tell the client which messages were removed.
+			delModSeq, err := acc.HighestDeletedModSeq(tx)
+			xcheckf(err, "get highest deleted modseq")
+			sinceModSeq := store.ModSeqFromClient(req.SinceModSeq)
+			if sinceModSeq < delModSeq {
+				panic(webapi.Error{Code: "modSeqExpired", Message: "changes since modseq no longer available, list all messages"})
+			}
+
+			q.FilterGreater("ModSeq", sinceModSeq)
+			q.SortAsc("ModSeq", "ID")
+			n := 0
+			err = q.ForEach(func(m store.Message) error {
+				// Don't stop in the middle of changes with the same modseq, the client would miss
+				// the others.
+				if n >= max && m.ModSeq.Client() != resp.ModSeq {
+					resp.HaveMore = true
+					return bstore.StopForEach
+				}
+				n++
+				resp.ModSeq = m.ModSeq.Client()
+				if m.Expunged {
+					resp.RemovedMsgIDs = append(resp.RemovedMsgIDs, m.ID)
+				} else {
+					resp.Messages = append(resp.Messages, xmessageSummary(log, m, mb.Name))
+				}
+				return nil
+			})
+			xcheckf(err, "listing changed messages")
+			if !resp.HaveMore {
+				resp.ModSeq = syncState.LastModSeq.Client()
+			}
+		})
+	})
+	return resp, nil
+}
+
+func (s server) MessageSearch(ctx context.Context, req webapi.MessageSearchRequest) (resp webapi.MessageSearchResult, err error) {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	log := reqInfo.Log
+	acc := reqInfo.Account
+
+	max := xmaxResults(req.Max)
+	if req.BeforeMsgID < 0 {
+		xcheckuserf(errors.New("must be >= 0"), "checking message id")
+	}
+	xcheckSearchCriteria(req.Criteria)
+
+	acc.WithRLock(func() {
+		xdbread(ctx, acc, func(tx *bstore.Tx) {
+			mailboxNames := map[int64]string{}
+			q := bstore.QueryTx[store.Message](tx)
+			if req.MailboxName != "" {
+				mb := xmailboxName(tx, acc, req.MailboxName)
+				mailboxNames[mb.ID] = mb.Name
+				q.FilterNonzero(store.Message{MailboxID: mb.ID})
+			} else {
+				err := bstore.QueryTx[store.Mailbox](tx).FilterEqual("Expunged", false).ForEach(func(mb store.Mailbox) error {
+					mailboxNames[mb.ID] = mb.Name
+					return nil
+				})
+				xcheckf(err, "listing mailboxes")
+			}
+			q.FilterEqual("Expunged", false)
+			if req.BeforeMsgID > 0 {
+				q.FilterLess("ID", req.BeforeMsgID)
+			}
+			q.SortDesc("ID")
+			wordSearches := map[string]*store.WordSearch{}
+			err := q.ForEach(func(m store.Message) error {
+				if len(resp.Messages) >= max {
+					resp.HaveMore = true
+					return bstore.StopForEach
+				}
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				sm := searchMessage{log: log, acc: acc, m: m, tx: tx, wordSearches: wordSearches}
+				defer sm.close()
+				if sm.match(req.Criteria) {
+					resp.Messages = append(resp.Messages, xmessageSummary(log, m, mailboxNames[m.MailboxID]))
+				}
+				return nil
+			})
+			xcheckf(err, "searching messages")
+		})
+	})
+	return resp, nil
+}
+
+func (s server) MessageAppend(ctx context.Context, req webapi.MessageAppendRequest) (resp webapi.MessageAppendResult, err error) {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	log := reqInfo.Log
+	acc := reqInfo.Account
+
+	flags, keywords, err := store.ParseFlagsKeywords(req.Flags)
+	xcheckuserf(err, "parsing flags")
+
+	// Message from JSON request, or as uploaded file.
+	var msgr io.Reader
+	mpf := reqInfo.Request.MultipartForm
+	if req.Data != "" {
+		msgr = base64.NewDecoder(base64.StdEncoding, strings.NewReader(req.Data))
+	} else if mpf != nil && len(mpf.File["message"]) == 1 {
+		f, err := mpf.File["message"][0].Open()
+		xcheckf(err, "open uploaded message")
+		defer func() {
+			err := f.Close()
+			log.Check(err, "closing uploaded message")
+		}()
+		msgr = f
+	} else {
+		xcheckuserf(errors.New("missing message, in Data or as single form file"), "checking request")
+	}
+
+	msgFile, err := store.CreateMessageTemp(log, "webapi-append")
+	xcheckf(err, "creating temporary file for message")
+	defer store.CloseRemoveTempFile(log, msgFile, "message to append")
+
+	size, err := io.Copy(msgFile, &moxio.LimitReader{R: msgr, Limit: s.maxMsgSize})
+	if err != nil && errors.Is(err, moxio.ErrLimit) {
+		panic(webapi.Error{Code: "messageTooLarge", Message: "message too large"})
+	} else if err != nil && req.Data != "" {
+		xcheckuserf(err, "decoding base64 message")
+	}
+	xcheckf(err, "storing message in temporary file")
+	if size == 0 {
+		xcheckuserf(errors.New("empty message"), "checking message")
+	}
+
+	received := time.Now()
+	if req.Received != nil {
+		received = *req.Received
+	}
+
+	acc.WithWLock(func() {
+		var changes []store.Change
+		var newID int64
+		defer func() {
+			if newID != 0 {
+				p := acc.MessagePath(newID)
+				err := os.Remove(p)
+				log.Check(err, "removing appended message file after error", slog.String("path", p))
+			}
+		}()
+
+		xdbwrite(ctx, acc, func(tx *bstore.Tx) {
+			mb := xmailboxName(tx, acc, req.MailboxName)
+			nkeywords := len(mb.Keywords)
+
+			modseq, err := acc.NextModSeq(tx)
+			xcheckf(err, "get next modseq")
+
+			m := store.Message{
+				MailboxID:     mb.ID,
+				MailboxOrigID: mb.ID,
+				Received:      received,
+				Flags:         flags,
+				Keywords:      keywords,
+				Size:          size,
+				ModSeq:        modseq,
+				CreateSeq:     modseq,
+			}
+			err = acc.MessageAdd(log, tx, &mb, &m, msgFile, store.AddOpts{})
+			if err != nil && errors.Is(err, store.ErrOverQuota) {
+				panic(webapi.Error{Code: "overQuota", Message: err.Error()})
+			}
+			xcheckf(err, "adding message")
+			newID = m.ID
+
+			changes = append(changes, m.ChangeAddUID(mb), mb.ChangeCounts())
+			if nkeywords != len(mb.Keywords) {
+				changes = append(changes, mb.ChangeKeywords())
+			}
+
+			err = tx.Update(&mb)
+			xcheckf(err, "updating mailbox counts")
+		})
+		resp.MsgID = newID
+		newID = 0 // Commit.
+
+		store.BroadcastChanges(acc, changes)
+	})
+	return resp, nil
+}
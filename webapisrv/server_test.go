@@ -523,6 +523,182 @@ func TestServer(t *testing.T) {
 	terrcode(t, err, "messageNotFound") // No longer.
 	_, err = client.MessageDelete(ctxbg, webapi.MessageDeleteRequest{MsgID: 1 + 999})
 	terrcode(t, err, "messageNotFound")
+
+	// MailboxCreate
+	mbres, err := client.MailboxCreate(ctxbg, webapi.MailboxCreateRequest{MailboxName: "Test/Sub"})
+	tcheckf(t, err, "create mailbox")
+	tcompare(t, mbres.Mailbox.Name, "Test/Sub")
+	_, err = client.MailboxCreate(ctxbg, webapi.MailboxCreateRequest{MailboxName: "Test/Sub"})
+	terrcode(t, err, "mailboxExists")
+	_, err = client.MailboxCreate(ctxbg, webapi.MailboxCreateRequest{MailboxName: "Test//Sub"})
+	terrcode(t, err, "user")
+
+	// MailboxRename
+	_, err = client.MailboxRename(ctxbg, webapi.MailboxRenameRequest{MailboxName: "Test", NewMailboxName: "Other"})
+	tcheckf(t, err, "rename mailbox")
+	_, err = client.MailboxRename(ctxbg, webapi.MailboxRenameRequest{MailboxName: "Bogus", NewMailboxName: "Other2"})
+	terrcode(t, err, "mailboxNotFound")
+	_, err = client.MailboxRename(ctxbg, webapi.MailboxRenameRequest{MailboxName: "Sent", NewMailboxName: "Other"})
+	terrcode(t, err, "mailboxExists")
+	_, err = client.MailboxRename(ctxbg, webapi.MailboxRenameRequest{MailboxName: "Inbox", NewMailboxName: "Other3"})
+	terrcode(t, err, "user")
+
+	// MailboxList
+	mblres, err := client.MailboxList(ctxbg, webapi.MailboxListRequest{})
+	tcheckf(t, err, "list mailboxes")
+	var mbnames []string
+	for _, mb := range mblres.Mailboxes {
+		mbnames = append(mbnames, mb.Name)
+		if mb.Name == "Sent" {
+			tcompare(t, mb.SpecialUse, []string{`\Sent`})
+		}
+	}
+	tcompare(t, slices.Contains(mbnames, "Other/Sub"), true)
+	tcompare(t, slices.Contains(mbnames, "Test/Sub"), false)
+
+	// MessageAppend
+	appendMsg := func(subject string, flags []string) int64 {
+		t.Helper()
+		msg := fmt.Sprintf("From: <remote@remote.example>\r\nTo: <mjl@mox.example>\r\nSubject: %s\r\nDate: Mon, 01 Jan 2024 15:00:00 +0100\r\nMIME-Version: 1.0\r\nContent-Type: text/plain\r\n\r\nbody text %s\r\n", subject, subject)
+		res, err := client.MessageAppend(ctxbg, webapi.MessageAppendRequest{MailboxName: "Other/Sub", Flags: flags, Data: base64.StdEncoding.EncodeToString([]byte(msg))})
+		tcheckf(t, err, "append message")
+		return res.MsgID
+	}
+	id1 := appendMsg("first", []string{`\seen`, "custom"})
+	id2 := appendMsg("second", nil)
+	_, err = client.MessageAppend(ctxbg, webapi.MessageAppendRequest{MailboxName: "Bogus", Data: base64.StdEncoding.EncodeToString([]byte("Subject: x\r\n\r\n"))})
+	terrcode(t, err, "mailboxNotFound")
+	_, err = client.MessageAppend(ctxbg, webapi.MessageAppendRequest{MailboxName: "Other/Sub"})
+	terrcode(t, err, "user")
+	_, err = client.MessageAppend(ctxbg, webapi.MessageAppendRequest{MailboxName: "Other/Sub", Data: "not base64!"})
+	terrcode(t, err, "user")
+	_, err = client.MessageAppend(ctxbg, webapi.MessageAppendRequest{MailboxName: "Other/Sub", Data: base64.StdEncoding.EncodeToString(make([]byte, 100*1024+1))})
+	terrcode(t, err, "messageTooLarge")
+
+	// MessageList
+	mlres, err := client.MessageList(ctxbg, webapi.MessageListRequest{MailboxName: "Other/Sub", Max: 1})
+	tcheckf(t, err, "list messages")
+	tcompare(t, len(mlres.Messages), 1)
+	tcompare(t, mlres.HaveMore, true)
+	tcompare(t, mlres.Messages[0].MsgID, id1)
+	tcompare(t, mlres.Messages[0].Subject, "first")
+	tcompare(t, mlres.Messages[0].Flags, []string{`\seen`, "custom"})
+	tcompare(t, mlres.Messages[0].From, []webapi.NameAddress{{Address: "remote@remote.example"}})
+	modseq := mlres.ModSeq
+	mlres, err = client.MessageList(ctxbg, webapi.MessageListRequest{MailboxName: "Other/Sub", AfterMsgID: id1})
+	tcheckf(t, err, "list messages")
+	tcompare(t, len(mlres.Messages), 1)
+	tcompare(t, mlres.HaveMore, false)
+	tcompare(t, mlres.Messages[0].MsgID, id2)
+	_, err = client.MessageList(ctxbg, webapi.MessageListRequest{MailboxName: "Bogus"})
+	terrcode(t, err, "mailboxNotFound")
+
+	// No changes yet.
+	mlres, err = client.MessageList(ctxbg, webapi.MessageListRequest{MailboxName: "Other/Sub", SinceModSeq: modseq})
+	tcheckf(t, err, "list changes")
+	tcompare(t, len(mlres.Messages)+len(mlres.RemovedMsgIDs), 0)
+	tcompare(t, mlres.ModSeq, modseq)
+
+	// Changed flags and removed message.
+	_, err = client.MessageFlagsAdd(ctxbg, webapi.MessageFlagsAddRequest{MsgID: id2, Flags: []string{`\flagged`}})
+	tcheckf(t, err, "add flags")
+	_, err = client.MessageDelete(ctxbg, webapi.MessageDeleteRequest{MsgID: id1})
+	tcheckf(t, err, "delete message")
+	mlres, err = client.MessageList(ctxbg, webapi.MessageListRequest{MailboxName: "Other/Sub", SinceModSeq: modseq})
+	tcheckf(t, err, "list changes")
+	tcompare(t, len(mlres.Messages), 1)
+	tcompare(t, mlres.Messages[0].MsgID, id2)
+	tcompare(t, mlres.Messages[0].Flags, []string{`\flagged`})
+	tcompare(t, mlres.RemovedMsgIDs, []int64{id1})
+	tcompare(t, mlres.ModSeq > modseq, true)
+	modseq = mlres.ModSeq
+
+	id3 := appendMsg("third", []string{"$junk"})
+
+	// Append with message as uploaded file.
+	sb.Reset()
+	mp = multipart.NewWriter(&sb)
+	mp.WriteField("request", `{"MailboxName": "Other"}`)
+	pw, err = mp.CreateFormFile("message", "message.eml")
+	tcheckf(t, err, "create message file")
+	_, err = fmt.Fprint(pw, "Subject: uploaded\r\n\r\nhi\r\n")
+	tcheckf(t, err, "write message")
+	fdct = mp.FormDataContentType()
+	err = mp.Close()
+	tcheckf(t, err, "close multipart")
+	req, err = http.NewRequest("POST", hs.URL+"/v0/MessageAppend", strings.NewReader(sb.String()))
+	tcheckf(t, err, "new request")
+	req.Header.Set("Content-Type", fdct)
+	req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("mjl@mox.example:"+pw1)))
+	resp, err = http.DefaultClient.Do(req)
+	tcheckf(t, err, "request multipart/form-data")
+	tcompare(t, resp.StatusCode, http.StatusOK)
+	var appendRes webapi.MessageAppendResult
+	err = json.NewDecoder(resp.Body).Decode(&appendRes)
+	tcheckf(t, err, "parse append response")
+	msgRes, err = client.MessageGet(ctxbg, webapi.MessageGetRequest{MsgID: appendRes.MsgID})
+	tcheckf(t, err, "get appended message")
+	tcompare(t, msgRes.Message.Subject, "uploaded")
+	tcompare(t, msgRes.Meta.MailboxName, "Other")
+
+	// MessageSearch
+	testSearch := func(mailboxName string, c webapi.SearchCriteria, expIDs ...int64) {
+		t.Helper()
+		res, err := client.MessageSearch(ctxbg, webapi.MessageSearchRequest{MailboxName: mailboxName, Criteria: c})
+		tcheckf(t, err, "search")
+		var ids []int64
+		for _, m := range res.Messages {
+			ids = append(ids, m.MsgID)
+		}
+		tcompare(t, ids, expIDs)
+	}
+	testSearch("Other/Sub", webapi.SearchCriteria{}, id3, id2)
+	testSearch("", webapi.SearchCriteria{Subject: []string{"THIRD"}}, id3)
+	testSearch("", webapi.SearchCriteria{Subject: []string{"uploaded"}}, appendRes.MsgID)
+	testSearch("Other/Sub", webapi.SearchCriteria{Flags: []string{`\Flagged`}}, id2)
+	testSearch("Other/Sub", webapi.SearchCriteria{From: []string{"remote.example"}}, id3, id2)
+	testSearch("Other/Sub", webapi.SearchCriteria{NotFlags: []string{"$junk"}}, id2)
+	testSearch("Other/Sub", webapi.SearchCriteria{NotFlags: []string{"$junk"}, From: []string{"remote.example"}}, id2)
+	testSearch("Other/Sub", webapi.SearchCriteria{Body: []string{"body text second"}}, id2)
+	testSearch("Other/Sub", webapi.SearchCriteria{Text: []string{"subject: third"}}, id3)
+	testSearch("Other/Sub", webapi.SearchCriteria{Body: []string{"subject: third"}})
+	testSearch("Other/Sub", webapi.SearchCriteria{Headers: [][2]string{{"to", ""}}, Not: &webapi.SearchCriteria{Subject: []string{"second"}}}, id3)
+	testSearch("Other/Sub", webapi.SearchCriteria{Or: []webapi.SearchCriteria{{Subject: []string{"second"}}, {Subject: []string{"third"}}}}, id3, id2)
+	testSearch("Other/Sub", webapi.SearchCriteria{ModSeqMin: modseq + 1}, id3)
+	testSearch("Other/Sub", webapi.SearchCriteria{SizeSmaller: 10})
+	// Sent dates are compared without time.
+	day := func(s string) *time.Time {
+		tm, err := time.Parse(time.RFC3339, s)
+		tcheckf(t, err, "parse time")
+		return &tm
+	}
+	testSearch("Other/Sub", webapi.SearchCriteria{SentSince: day("2024-01-01T20:00:00Z")}, id3, id2)
+	testSearch("Other/Sub", webapi.SearchCriteria{SentSince: day("2024-01-02T00:00:00Z")})
+	testSearch("Other/Sub", webapi.SearchCriteria{SentBefore: day("2024-01-01T20:00:00Z")})
+	testSearch("Other/Sub", webapi.SearchCriteria{SentBefore: day("2024-01-02T00:00:00Z")}, id3, id2)
+	msres, err := client.MessageSearch(ctxbg, webapi.MessageSearchRequest{MailboxName: "Other/Sub", Max: 1})
+	tcheckf(t, err, "search")
+	tcompare(t, msres.HaveMore, true)
+	msres, err = client.MessageSearch(ctxbg, webapi.MessageSearchRequest{MailboxName: "Other/Sub", BeforeMsgID: id3})
+	tcheckf(t, err, "search")
+	tcompare(t, len(msres.Messages), 1)
+	tcompare(t, msres.Messages[0].MsgID, id2)
+	_, err = client.MessageSearch(ctxbg, webapi.MessageSearchRequest{MailboxName: "Bogus"})
+	terrcode(t, err, "mailboxNotFound")
+	_, err = client.MessageSearch(ctxbg, webapi.MessageSearchRequest{Criteria: webapi.SearchCriteria{Flags: []string{"bad flag"}}})
+	terrcode(t, err, "user")
+
+	// MailboxDelete
+	_, err = client.MailboxDelete(ctxbg, webapi.MailboxDeleteRequest{MailboxName: "Other"})
+	terrcode(t, err, "user") // Has children.
+	_, err = client.MailboxDelete(ctxbg, webapi.MailboxDeleteRequest{MailboxName: "Inbox"})
+	terrcode(t, err, "user")
+	_, err = client.MailboxDelete(ctxbg, webapi.MailboxDeleteRequest{MailboxName: "Other/Sub"})
+	tcheckf(t, err, "delete mailbox")
+	_, err = client.MailboxDelete(ctxbg, webapi.MailboxDeleteRequest{MailboxName: "Other/Sub"})
+	terrcode(t, err, "mailboxNotFound")
+	_, err = client.MessageGet(ctxbg, webapi.MessageGetRequest{MsgID: id2})
+	terrcode(t, err, "messageNotFound")
 }
 
 func tdata(t *testing.T, r io.Reader, exp string) {
@@ -531,3 +707,254 @@ func tdata(t *testing.T, r io.Reader, exp string) {
 	tcheckf(t, err, "reading body")
 	tcompare(t, string(buf), exp)
 }
+
+// Test webhooks through the event stream, with acknowledgements.
+func TestEvents(t *testing.T) {
+	mox.LimitersInit()
+	os.RemoveAll("../testdata/webapisrv/data")
+	mox.Context = ctxbg
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/webapisrv/mox.conf")
+	mox.MustLoadConfig(true, false)
+	err := store.Init(ctxbg)
+	tcheckf(t, err, "store init")
+	defer func() {
+		err := store.Close()
+		tcheckf(t, err, "store close")
+	}()
+	defer store.Switchboard()()
+	err = queue.Init()
+	tcheckf(t, err, "queue init")
+	defer queue.Shutdown()
+
+	log := mlog.New("webapisrv", nil)
+	acc, err := store.OpenAccount(log, "mjl", false)
+	tcheckf(t, err, "open account")
+	err = acc.SetPassword(log, "test1234")
+	tcheckf(t, err, "set password")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+		acc.WaitClosed()
+	}()
+
+	s := NewServer(100*1024, "/webapi/", false).(server)
+	hs := httptest.NewServer(s)
+	defer hs.Close()
+
+	client := webapi.Client{BaseURL: hs.URL + "/v0/", Username: "mjl@mox.example", Password: "test1234"}
+
+	// Account has an incoming webhook that is only available through the event stream.
+	incoming := func(subject string) {
+		t.Helper()
+		msg := fmt.Sprintf("From: <remote@remote.example>\r\nTo: <mjl@mox.example>\r\nSubject: %s\r\nDate: Mon, 01 Jan 2024 15:00:00 +0100\r\n\r\ntest email\r\n", subject)
+		m := store.Message{
+			ID:                1,
+			RemoteIP:          "::1",
+			MailFrom:          "remote@remote.example",
+			MailFromLocalpart: "remote",
+			MailFromDomain:    "remote.example",
+			RcptToLocalpart:   "mjl",
+			RcptToDomain:      "mox.example",
+			Received:          time.Now(),
+			Size:              int64(len(msg)),
+		}
+		part, err := message.EnsurePart(log.Logger, true, strings.NewReader(msg), int64(len(msg)))
+		tcheckf(t, err, "parsing message")
+		err = queue.Incoming(ctxbg, log, acc, "<random@localhost>", m, part, "Inbox")
+		tcheckf(t, err, "incoming webhook")
+	}
+	incoming("one")
+	incoming("two")
+
+	testHTTP := func(method string, headers map[string]string, expCode int) {
+		t.Helper()
+		r := httptest.NewRequest(method, "/v0/events", nil)
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		tcompare(t, w.Result().StatusCode, expCode)
+	}
+	authz := "Basic " + base64.StdEncoding.EncodeToString([]byte("mjl@mox.example:test1234"))
+	testHTTP("POST", map[string]string{"Authorization": authz}, http.StatusMethodNotAllowed)
+	testHTTP("GET", nil, http.StatusUnauthorized)
+	testHTTP("GET", map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte("mjl@mox.example:bad"))}, http.StatusUnauthorized)
+	testHTTP("GET", map[string]string{"Authorization": authz, "Last-Event-ID": "bogus"}, http.StatusBadRequest)
+
+	next := func(es *webapi.EventStream, expSubject string) webapi.Event {
+		t.Helper()
+		ev, err := es.Next()
+		tcheckf(t, err, "reading event")
+		tcompare(t, ev.Event, "incoming")
+		if ev.Incoming == nil || ev.Outgoing != nil {
+			t.Fatalf("got event %#v, expected incoming", ev)
+		}
+		tcompare(t, ev.Incoming.Subject, expSubject)
+		return ev
+	}
+
+	ctx, cancel := context.WithTimeout(ctxbg, 5*time.Second)
+	defer cancel()
+
+	es, err := client.Events(ctx, 0)
+	tcheckf(t, err, "open event stream")
+	ev1 := next(es, "one")
+	ev2 := next(es, "two")
+	es.Close()
+
+	// Resume with last event ID, acknowledging the first.
+	es, err = client.Events(ctx, ev1.ID)
+	tcheckf(t, err, "open event stream")
+	next(es, "two")
+	es.Close()
+
+	hl, err := queue.HookList(ctxbg, queue.HookFilter{Account: "mjl"}, queue.HookSort{})
+	tcheckf(t, err, "list hooks")
+	tcompare(t, len(hl), 1)
+	tcompare(t, hl[0].ID, ev2.ID)
+	hrl, err := queue.HookRetiredList(ctxbg, queue.HookRetiredFilter{Account: "mjl"}, queue.HookRetiredSort{})
+	tcheckf(t, err, "list retired hooks")
+	tcompare(t, len(hrl), 1)
+	tcompare(t, hrl[0].ID, ev1.ID)
+	tcompare(t, hrl[0].Success, true)
+
+	_, err = client.EventsAck(ctxbg, webapi.EventsAckRequest{LastEventID: 0})
+	terrcode(t, err, "user")
+	_, err = client.EventsAck(ctxbg, webapi.EventsAckRequest{LastEventID: ev2.ID})
+	tcheckf(t, err, "acknowledge events")
+	n, err := queue.HookQueueSize(ctxbg)
+	tcheckf(t, err, "hook queue size")
+	tcompare(t, n, 0)
+
+	// New events are sent on an open stream.
+	es, err = client.Events(ctx, ev2.ID)
+	tcheckf(t, err, "open event stream")
+	defer es.Close()
+	incoming("three")
+	next(es, "three")
+}
+
+// Test authentication with API keys, their scopes, expiration and ip ranges.
+func TestAPIKeys(t *testing.T) {
+	mox.LimitersInit()
+	os.RemoveAll("../testdata/webapisrv/data")
+	mox.Context = ctxbg
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/webapisrv/mox.conf")
+	mox.MustLoadConfig(true, false)
+	err := store.Init(ctxbg)
+	tcheckf(t, err, "store init")
+	defer func() {
+		err := store.Close()
+		tcheckf(t, err, "store close")
+	}()
+	defer store.Switchboard()()
+	err = queue.Init()
+	tcheckf(t, err, "queue init")
+	defer queue.Shutdown()
+
+	log := mlog.New("webapisrv", nil)
+	acc, err := store.OpenAccount(log, "mjl", false)
+	tcheckf(t, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+		acc.WaitClosed()
+	}()
+
+	_, _, err = acc.APIKeyAdd(ctxbg, store.APIKey{Name: "bad", Scopes: []string{"bogus"}})
+	if err == nil {
+		t.Fatalf("adding api key with unknown scope succeeded")
+	}
+	_, _, err = acc.APIKeyAdd(ctxbg, store.APIKey{Name: "bad", Scopes: []string{"read"}, IPRanges: []string{"10.0.0.1"}})
+	if err == nil {
+		t.Fatalf("adding api key with bad ip range succeeded")
+	}
+
+	readKey, readSecret, err := acc.APIKeyAdd(ctxbg, store.APIKey{Name: "reader", Scopes: []string{store.APIScopeRead}})
+	tcheckf(t, err, "add api key")
+	tcompare(t, strings.HasPrefix(readSecret, store.APIKeyPrefix), true)
+	tcompare(t, strings.HasPrefix(readSecret, readKey.Prefix), true)
+	past := time.Now().Add(-time.Minute)
+	_, expiredSecret, err := acc.APIKeyAdd(ctxbg, store.APIKey{Name: "expired", Scopes: []string{store.APIScopeRead}, Expires: &past})
+	tcheckf(t, err, "add api key")
+	_, remoteSecret, err := acc.APIKeyAdd(ctxbg, store.APIKey{Name: "remote", Scopes: []string{store.APIScopeRead}, IPRanges: []string{"192.0.2.0/24"}})
+	tcheckf(t, err, "add api key")
+	_, sendSecret, err := acc.APIKeyAdd(ctxbg, store.APIKey{Name: "sender", Scopes: []string{store.APIScopeSend, store.APIScopeSuppression}, IPRanges: []string{"127.0.0.0/8", "::1/128"}})
+	tcheckf(t, err, "add api key")
+
+	// App passwords can be used like the account password, if allowed for the webapi.
+	err = acc.SetPassword(log, "test1234")
+	tcheckf(t, err, "set password")
+	_, webapiPassword, err := acc.AppPasswordAdd(ctxbg, log, store.AppPassword{Name: "app", Protocols: []string{store.AppPasswordWebAPI}})
+	tcheckf(t, err, "add app password")
+	_, imapPassword, err := acc.AppPasswordAdd(ctxbg, log, store.AppPassword{Name: "imap", Protocols: []string{store.AppPasswordIMAP}})
+	tcheckf(t, err, "add app password")
+
+	s := NewServer(100*1024, "/webapi/", false).(server)
+	hs := httptest.NewServer(s)
+	defer hs.Close()
+
+	testAuth := func(method, secret string, expCode int) {
+		t.Helper()
+		r := httptest.NewRequest("POST", "/v0/"+method, strings.NewReader("request={}"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("mjl@mox.example:"+secret)))
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		tcompare(t, w.Result().StatusCode, expCode)
+	}
+
+	// httptest.NewRequest uses remote address 192.0.2.1.
+	testAuth("MailboxList", readSecret, http.StatusOK)
+	testAuth("MailboxList", remoteSecret, http.StatusOK)
+	testAuth("MailboxList", expiredSecret, http.StatusUnauthorized)
+	testAuth("MailboxList", sendSecret, http.StatusUnauthorized) // Not allowed from IP.
+	testAuth("MailboxList", readSecret+"x", http.StatusUnauthorized)
+	testAuth("MailboxCreate", readSecret, http.StatusForbidden)
+	testAuth("Send", readSecret, http.StatusForbidden)
+	testAuth("SuppressionList", readSecret, http.StatusForbidden)
+	testAuth("EventsAck", readSecret, http.StatusForbidden) // Retires events, needs manage scope.
+	testAuth("MailboxList", webapiPassword, http.StatusOK)
+	testAuth("MailboxList", imapPassword, http.StatusUnauthorized) // Not for webapi.
+	mox.LimitersInit()
+
+	// Each method requires a scope.
+	mt := reflect.TypeFor[webapi.Methods]()
+	for i := range mt.NumMethod() {
+		name := mt.Method(i).Name
+		if methodScopes[name] == "" {
+			t.Fatalf("missing scope for method %s", name)
+		}
+	}
+
+	// Through the client, from localhost.
+	client := webapi.Client{BaseURL: hs.URL + "/v0/", Username: "mjl@mox.example", Password: readSecret}
+	_, err = client.MailboxList(ctxbg, webapi.MailboxListRequest{})
+	tcheckf(t, err, "mailbox list with api key")
+	_, err = client.SuppressionList(ctxbg, webapi.SuppressionListRequest{})
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Fatalf("got err %v, expected http 403 forbidden", err)
+	}
+
+	client = webapi.Client{BaseURL: hs.URL + "/v0/", Username: "mjl@mox.example", Password: sendSecret}
+	_, err = client.SuppressionList(ctxbg, webapi.SuppressionListRequest{})
+	tcheckf(t, err, "suppression list with api key")
+	_, err = client.MessageList(ctxbg, webapi.MessageListRequest{})
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Fatalf("got err %v, expected http 403 forbidden", err)
+	}
+
+	// Last use is recorded.
+	keys, err := acc.APIKeyList(ctxbg)
+	tcheckf(t, err, "list api keys")
+	tcompare(t, len(keys), 4)
+	tcompare(t, keys[0].LastUsed != nil, true)
+	tcompare(t, keys[0].LastUsedIP, "127.0.0.1")
+	tcompare(t, keys[1].LastUsed == nil, true)
+
+	// Removed key can no longer be used.
+	err = acc.APIKeyRemove(ctxbg, readKey.ID)
+	tcheckf(t, err, "remove api key")
+	testAuth("MailboxList", readSecret, http.StatusUnauthorized)
+}
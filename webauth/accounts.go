@@ -3,6 +3,7 @@ package webauth
 import (
 	"context"
 	"errors"
+	"fmt"
 
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/store"
@@ -10,6 +11,8 @@ import (
 
 // AccountAuth is for user accounts, with username/password, and sessions stored in
 // memory and in the database with lifetimes that are automatically extended.
+// Second factors are TOTP, recovery codes and WebAuthn credentials stored in
+// the account.
 var Accounts SessionAuth = accountSessionAuth{}
 
 type accountSessionAuth struct{}
@@ -45,3 +48,56 @@ func (accountSessionAuth) use(ctx context.Context, log mlog.Log, accountName str
 func (accountSessionAuth) remove(ctx context.Context, log mlog.Log, accountName string, sessionToken store.SessionToken) error {
 	return store.SessionRemove(ctx, log, accountName, sessionToken)
 }
+
+func (accountSessionAuth) secondFactor(ctx context.Context, log mlog.Log, kind, accountName string) (*secondFactors, error) {
+	acc, err := store.OpenAccount(log, accountName, false)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	s, err := acc.SecondFactors(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !s.Enabled() {
+		// The account interface remains accessible, for setting up a second factor.
+		conf, _ := acc.Conf()
+		if conf.RequireSecondFactor && kind != "webaccount" {
+			return nil, fmt.Errorf("%w: set up a second factor in the account web interface first", errSecondFactorMissing)
+		}
+		return nil, nil
+	}
+	sf := &secondFactors{TOTP: s.TOTP, RecoveryCodes: s.RecoveryCodesUnused > 0}
+	for _, wc := range s.WebAuthn {
+		sf.WebAuthnCredentialIDs = append(sf.WebAuthnCredentialIDs, wc.CredentialID)
+	}
+	return sf, nil
+}
+
+func (accountSessionAuth) verifyCode(ctx context.Context, log mlog.Log, accountName, code string) (kind string, rerr error) {
+	acc, err := store.OpenAccount(log, accountName, true)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+	return acc.SecondFactorVerifyCode(ctx, code)
+}
+
+func (accountSessionAuth) verifyWebAuthn(ctx context.Context, log mlog.Log, accountName, rpID, origin, challenge, credentialID string, clientDataJSON, authenticatorData, signature []byte) error {
+	acc, err := store.OpenAccount(log, accountName, true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+	return acc.SecondFactorVerifyWebAuthn(ctx, rpID, origin, challenge, credentialID, clientDataJSON, authenticatorData, signature)
+}
@@ -16,11 +16,12 @@ import (
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/mox-"
 	"github.com/mjl-/mox/store"
+	"github.com/mjl-/mox/totp"
 )
 
-// Admin is for admin logins, with authentication by password, and sessions only
-// stored in memory only, with lifetime 12 hour after last use, with a maximum of
-// 10 active sessions.
+// Admin is for admin logins, with authentication by password and optionally a
+// TOTP code, and sessions only stored in memory only, with lifetime 12 hour after
+// last use, with a maximum of 10 active sessions.
 var Admin SessionAuth = &adminSessionAuth{
 	sessions: map[store.SessionToken]adminSession{},
 }
@@ -37,6 +38,10 @@ type adminSession struct {
 type adminSessionAuth struct {
 	sync.Mutex
 	sessions map[store.SessionToken]adminSession
+
+	// Counter of last used TOTP code, to prevent reuse. Only kept in memory, codes
+	// expire quickly.
+	totpLastCounter int64
 }
 
 func (a *adminSessionAuth) login(ctx context.Context, log mlog.Log, username, password string) (valid, disabled bool, name string, rerr error) {
@@ -122,3 +127,48 @@ func (a *adminSessionAuth) remove(ctx context.Context, log mlog.Log, accountName
 	delete(a.sessions, sessionToken)
 	return nil
 }
+
+// totpSecret returns the admin TOTP secret, or an empty string if none is
+// configured.
+func (a *adminSessionAuth) totpSecret() (string, error) {
+	if mox.Conf.Static.AdminTOTPFile == "" {
+		return "", nil
+	}
+	buf, err := os.ReadFile(mox.ConfigDirPath(mox.Conf.Static.AdminTOTPFile))
+	if err != nil {
+		return "", fmt.Errorf("reading totp file: %v", err)
+	}
+	return strings.TrimSpace(string(buf)), nil
+}
+
+func (a *adminSessionAuth) secondFactor(ctx context.Context, log mlog.Log, kind, accountName string) (*secondFactors, error) {
+	secret, err := a.totpSecret()
+	if err != nil {
+		return nil, err
+	} else if secret == "" {
+		return nil, nil
+	}
+	return &secondFactors{TOTP: true}, nil
+}
+
+func (a *adminSessionAuth) verifyCode(ctx context.Context, log mlog.Log, accountName, code string) (kind string, rerr error) {
+	secret, err := a.totpSecret()
+	if err != nil {
+		return store.SecondFactorTOTP, err
+	} else if secret == "" {
+		return store.SecondFactorTOTP, fmt.Errorf("%w: no totp configured", store.ErrSecondFactor)
+	}
+
+	a.Lock()
+	defer a.Unlock()
+	counter, err := totp.Verify(secret, code, time.Now(), a.totpLastCounter)
+	if err != nil {
+		return store.SecondFactorTOTP, fmt.Errorf("%w: %v", store.ErrSecondFactor, err)
+	}
+	a.totpLastCounter = counter
+	return store.SecondFactorTOTP, nil
+}
+
+func (a *adminSessionAuth) verifyWebAuthn(ctx context.Context, log mlog.Log, accountName, rpID, origin, challenge, credentialID string, clientDataJSON, authenticatorData, signature []byte) error {
+	return fmt.Errorf("%w: webauthn not supported for admin", store.ErrSecondFactor)
+}
@@ -0,0 +1,252 @@
+package webauth
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mjl-/sherpa"
+
+	"github.com/mjl-/mox/metrics"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/store"
+	"github.com/mjl-/mox/webauthn"
+)
+
+// errSecondFactorMissing is returned by SessionAuth.secondFactor when a second
+// factor is required for the account, but none is configured.
+var errSecondFactorMissing = errors.New("second factor required but not configured")
+
+// Time after a valid password in which the second factor must be provided.
+const secondFactorLoginLifetime = 5 * time.Minute
+
+// Maximum number of attempts to provide a second factor for a single login.
+const secondFactorLoginAttempts = 5
+
+// SecondFactorChallenge is returned by Login when the password is valid but a
+// second factor is required. The Token must be passed to LoginSecondFactor,
+// along with a code or WebAuthn assertion.
+type SecondFactorChallenge struct {
+	Token         string
+	TOTP          bool             // Whether a TOTP code can be used.
+	RecoveryCodes bool             // Whether a recovery code can be used.
+	WebAuthn      *WebAuthnRequest // If non-nil, a registered security key or passkey can be used.
+}
+
+// WebAuthnRequest holds the parameters for navigator.credentials.get in the
+// browser.
+type WebAuthnRequest struct {
+	Challenge     string   // Raw-url-base64.
+	RPID          string   // Relying party ID, the host name.
+	CredentialIDs []string // Raw-url-base64 IDs of allowed credentials.
+}
+
+// SecondFactorResponse is the second factor for LoginSecondFactor. Either Code or
+// WebAuthn must be set.
+type SecondFactorResponse struct {
+	// TOTP code of 6 digits, or a recovery code.
+	Code string
+
+	WebAuthn *WebAuthnAssertion
+}
+
+// WebAuthnAssertion is the result of navigator.credentials.get in the browser.
+// All fields are raw-url-base64 encoded.
+type WebAuthnAssertion struct {
+	CredentialID      string
+	ClientDataJSON    string
+	AuthenticatorData string
+	Signature         string
+}
+
+// secondFactors are the second factors that can be used for a login.
+type secondFactors struct {
+	TOTP                  bool
+	RecoveryCodes         bool
+	WebAuthnCredentialIDs []string
+}
+
+// pendingLogin is a login with a valid password, waiting for a second factor.
+type pendingLogin struct {
+	kind              string
+	loginToken        string // Login cookie value, must be the same for the second step.
+	accountName       string
+	loginAddress      string
+	webauthnChallenge string
+	rpID              string
+	origin            string
+	attempts          int
+	expires           time.Time
+}
+
+var pendingLogins = struct {
+	sync.Mutex
+	m map[string]*pendingLogin
+}{m: map[string]*pendingLogin{}}
+
+// pendingLoginAdd registers a new pending login, returning its token.
+func pendingLoginAdd(p *pendingLogin) string {
+	var data [16]byte
+	cryptorand.Read(data[:])
+	token := base64.RawURLEncoding.EncodeToString(data[:])
+
+	pendingLogins.Lock()
+	defer pendingLogins.Unlock()
+	for t, pl := range pendingLogins.m {
+		if time.Until(pl.expires) < 0 {
+			delete(pendingLogins.m, t)
+		}
+	}
+	pendingLogins.m[token] = p
+	return token
+}
+
+// pendingLoginUse returns a copy of the pending login for the token, kind and
+// login token, counting an attempt. After too many attempts, the pending login is
+// removed.
+func pendingLoginUse(token, kind, loginToken string) (pendingLogin, bool) {
+	pendingLogins.Lock()
+	defer pendingLogins.Unlock()
+	p, ok := pendingLogins.m[token]
+	if !ok || p.kind != kind || p.loginToken != loginToken || time.Until(p.expires) < 0 {
+		return pendingLogin{}, false
+	}
+	p.attempts++
+	if p.attempts >= secondFactorLoginAttempts {
+		delete(pendingLogins.m, token)
+	}
+	return *p, true
+}
+
+func pendingLoginRemove(token string) {
+	pendingLogins.Lock()
+	defer pendingLogins.Unlock()
+	delete(pendingLogins.m, token)
+}
+
+// RelyingParty returns the WebAuthn relying party ID (host name) and origin for
+// the request.
+func RelyingParty(isForwarded bool, r *http.Request) (rpID, origin string) {
+	rpID = r.Host
+	if host, _, err := net.SplitHostPort(r.Host); err == nil {
+		rpID = host
+	}
+	scheme := "http"
+	if isHTTPS(isForwarded, r) {
+		scheme = "https"
+	}
+	return rpID, scheme + "://" + r.Host
+}
+
+// secondFactorChallenge registers a pending login for the second factors, and
+// returns the challenge for the frontend.
+func secondFactorChallenge(kind, loginToken, accountName, loginAddress string, sf secondFactors, isForwarded bool, r *http.Request) *SecondFactorChallenge {
+	p := &pendingLogin{
+		kind:         kind,
+		loginToken:   loginToken,
+		accountName:  accountName,
+		loginAddress: loginAddress,
+		expires:      time.Now().Add(secondFactorLoginLifetime),
+	}
+	c := &SecondFactorChallenge{
+		TOTP:          sf.TOTP,
+		RecoveryCodes: sf.RecoveryCodes,
+	}
+	if len(sf.WebAuthnCredentialIDs) > 0 {
+		p.webauthnChallenge = webauthn.NewChallenge()
+		p.rpID, p.origin = RelyingParty(isForwarded, r)
+		c.WebAuthn = &WebAuthnRequest{p.webauthnChallenge, p.rpID, sf.WebAuthnCredentialIDs}
+	}
+	c.Token = pendingLoginAdd(p)
+	return c
+}
+
+// LoginSecondFactor completes a login for which Login returned a
+// SecondFactorChallenge, verifying the second factor through sessionAuth. On
+// success, a session token cookie is set on the HTTP response and the associated
+// CSRF token returned.
+//
+// In case of a user error, a *sherpa.Error is returned that sherpa handlers can
+// pass to panic. For a bad second factor, the error code is "user:loginFailed".
+func LoginSecondFactor(ctx context.Context, log mlog.Log, sessionAuth SessionAuth, kind, cookiePath string, isForwarded bool, w http.ResponseWriter, r *http.Request, loginToken, token string, resp SecondFactorResponse) (store.CSRFToken, error) {
+	if err := checkLoginCookie(kind, isForwarded, r, loginToken); err != nil {
+		return "", err
+	}
+	if resp.Code == "" && resp.WebAuthn == nil {
+		return "", &sherpa.Error{Code: "user:error", Message: "missing second factor"}
+	}
+
+	ip := ClientIP(log, isForwarded, r)
+	if ip == nil {
+		return "", fmt.Errorf("cannot find ip for rate limit check (missing x-forwarded-for header?)")
+	}
+	start := time.Now()
+	if !mox.LimiterFailedAuth.Add(ip, start, 1) {
+		metrics.AuthenticationRatelimitedInc(kind)
+		return "", &sherpa.Error{Code: "user:error", Message: "too many authentication attempts"}
+	}
+
+	p, ok := pendingLoginUse(token, kind, loginToken)
+	if !ok {
+		time.Sleep(BadAuthDelay)
+		return "", &sherpa.Error{Code: "user:loginFailed", Message: "login expired or unknown, please login again"}
+	}
+
+	la := loginAttempt(ip.String(), r, kind, "weblogin")
+	la.LoginAddress = p.loginAddress
+	la.AccountName = p.accountName
+	defer func() {
+		store.LoginAttemptAdd(context.Background(), log, la)
+	}()
+
+	var err error
+	switch {
+	case resp.WebAuthn != nil:
+		la.SecondFactor = store.SecondFactorWebAuthn
+		if p.webauthnChallenge == "" {
+			err = fmt.Errorf("%w: no webauthn credentials", store.ErrSecondFactor)
+			break
+		}
+		var cdj, authData, sig []byte
+		cdj, err = base64.RawURLEncoding.DecodeString(resp.WebAuthn.ClientDataJSON)
+		if err == nil {
+			authData, err = base64.RawURLEncoding.DecodeString(resp.WebAuthn.AuthenticatorData)
+		}
+		if err == nil {
+			sig, err = base64.RawURLEncoding.DecodeString(resp.WebAuthn.Signature)
+		}
+		if err != nil {
+			err = fmt.Errorf("%w: decoding webauthn assertion: %v", store.ErrSecondFactor, err)
+			break
+		}
+		err = sessionAuth.verifyWebAuthn(ctx, log, p.accountName, p.rpID, p.origin, p.webauthnChallenge, resp.WebAuthn.CredentialID, cdj, authData, sig)
+	default:
+		la.SecondFactor, err = sessionAuth.verifyCode(ctx, log, p.accountName, resp.Code)
+	}
+	if err != nil && errors.Is(err, store.ErrSecondFactor) {
+		log.Debugx("second factor verification failed", err)
+		time.Sleep(BadAuthDelay)
+		la.Result = store.AuthBadCredentials
+		return "", &sherpa.Error{Code: "user:loginFailed", Message: "invalid second factor"}
+	} else if err != nil {
+		la.Result = store.AuthError
+		return "", fmt.Errorf("verifying second factor: %v", err)
+	}
+	pendingLoginRemove(token)
+	la.Result = store.AuthSuccess
+	mox.LimiterFailedAuth.Reset(ip, start)
+
+	csrfToken, err := sessionStart(ctx, log, sessionAuth, kind, cookiePath, isForwarded, w, r, p.accountName, p.loginAddress)
+	if err != nil {
+		la.Result = store.AuthError
+		return "", err
+	}
+	return csrfToken, nil
+}
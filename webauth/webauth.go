@@ -23,6 +23,10 @@ time they are used. This makes it easy to invalidate existing sessions after a
 password change, and keeps the frontend free from handling long-term vs
 short-term sessions.
 
+If a second factor is configured (TOTP or WebAuthn for accounts, TOTP for the
+admin), Login does not create a session after a valid password, but returns a
+challenge. The login is completed by LoginSecondFactor, within 5 minutes.
+
 Sessions for the admin interface have a lifetime of 12 hours after last use,
 are only stored in memory (don't survive a server restart), and only 10
 sessions can exist at a time (the oldest session is dropped).
@@ -37,6 +41,7 @@ package webauth
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
@@ -77,6 +82,21 @@ type SessionAuth interface {
 	// Removes a session, invalidating any future use. Must return an error if the
 	// session is not valid.
 	remove(ctx context.Context, log mlog.Log, accountName string, sessionToken store.SessionToken) error
+
+	// secondFactor returns the second factors that must be provided after a valid
+	// password for a login to the web interface of kind, or nil if no second factor
+	// is needed. If a second factor is required but not configured, an error
+	// wrapping errSecondFactorMissing with details must be returned.
+	secondFactor(ctx context.Context, log mlog.Log, kind, accountName string) (*secondFactors, error)
+
+	// verifyCode verifies a TOTP or recovery code, returning the kind of second
+	// factor used. For an invalid code, an error wrapping store.ErrSecondFactor must
+	// be returned.
+	verifyCode(ctx context.Context, log mlog.Log, accountName, code string) (kind string, rerr error)
+
+	// verifyWebAuthn verifies a WebAuthn assertion. For an invalid assertion, an
+	// error wrapping store.ErrSecondFactor must be returned.
+	verifyWebAuthn(ctx context.Context, log mlog.Log, accountName, rpID, origin, challenge, credentialID string, clientDataJSON, authenticatorData, signature []byte) error
 }
 
 // loginAttempt initializes a loginAttempt, for adding to the store after filling in the results and other details.
@@ -242,26 +262,24 @@ func LoginPrep(ctx context.Context, log mlog.Log, kind, cookiePath string, isFor
 // credentials through sessionAuth, and setting a session token cookie on the HTTP
 // response and returning the associated CSRF token.
 //
+// If a second factor is needed, no session is created yet. Instead, a
+// SecondFactorChallenge is returned, to be completed with LoginSecondFactor.
+//
 // In case of a user error, a *sherpa.Error is returned that sherpa handlers can
 // pass to panic. For bad credentials, the error code is "user:loginFailed".
-func Login(ctx context.Context, log mlog.Log, sessionAuth SessionAuth, kind, cookiePath string, isForwarded bool, w http.ResponseWriter, r *http.Request, loginToken, username, password string) (store.CSRFToken, error) {
-	loginCookie, _ := r.Cookie(kind + "login")
-	if loginCookie == nil || loginCookie.Value != loginToken {
-		msg := "missing login token cookie"
-		if isForwarded && loginCookie == nil {
-			msg += " (hint: reverse proxy must keep path, for login cookie)"
-		}
-		return "", &sherpa.Error{Code: "user:error", Message: msg}
+func Login(ctx context.Context, log mlog.Log, sessionAuth SessionAuth, kind, cookiePath string, isForwarded bool, w http.ResponseWriter, r *http.Request, loginToken, username, password string) (store.CSRFToken, *SecondFactorChallenge, error) {
+	if err := checkLoginCookie(kind, isForwarded, r, loginToken); err != nil {
+		return "", nil, err
 	}
 
 	ip := ClientIP(log, isForwarded, r)
 	if ip == nil {
-		return "", fmt.Errorf("cannot find ip for rate limit check (missing x-forwarded-for header?)")
+		return "", nil, fmt.Errorf("cannot find ip for rate limit check (missing x-forwarded-for header?)")
 	}
 	start := time.Now()
 	if !mox.LimiterFailedAuth.Add(ip, start, 1) {
 		metrics.AuthenticationRatelimitedInc(kind)
-		return "", &sherpa.Error{Code: "user:error", Message: "too many authentication attempts"}
+		return "", nil, &sherpa.Error{Code: "user:error", Message: "too many authentication attempts"}
 	}
 
 	username = norm.NFC.String(username)
@@ -274,21 +292,69 @@ func Login(ctx context.Context, log mlog.Log, sessionAuth SessionAuth, kind, coo
 	}()
 	if disabled {
 		la.Result = store.AuthLoginDisabled
-		return "", &sherpa.Error{Code: "user:loginFailed", Message: err.Error()}
+		return "", nil, &sherpa.Error{Code: "user:loginFailed", Message: err.Error()}
 	} else if err != nil {
 		la.Result = store.AuthError
-		return "", fmt.Errorf("evaluating login attempt: %v", err)
+		return "", nil, fmt.Errorf("evaluating login attempt: %v", err)
 	} else if !valid {
 		time.Sleep(BadAuthDelay)
 		la.Result = store.AuthBadCredentials
-		return "", &sherpa.Error{Code: "user:loginFailed", Message: "invalid credentials"}
+		return "", nil, &sherpa.Error{Code: "user:loginFailed", Message: "invalid credentials"}
+	}
+
+	sf, err := sessionAuth.secondFactor(ctx, log, kind, accountName)
+	if err != nil && errors.Is(err, errSecondFactorMissing) {
+		la.Result = store.AuthLoginDisabled
+		return "", nil, &sherpa.Error{Code: "user:loginFailed", Message: err.Error()}
+	} else if err != nil {
+		la.Result = store.AuthError
+		return "", nil, fmt.Errorf("checking second factors: %v", err)
+	} else if sf != nil {
+		// The rate limiter is only reset after the second factor is verified. The login
+		// cookie is extended for the second step.
+		la.Result = store.AuthSecondFactorRequired
+		http.SetCookie(w, &http.Cookie{
+			Name:     kind + "login",
+			Value:    loginToken,
+			Path:     cookiePath,
+			Secure:   isHTTPS(isForwarded, r),
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+			MaxAge:   int(secondFactorLoginLifetime / time.Second),
+		})
+		return "", secondFactorChallenge(kind, loginToken, accountName, username, *sf, isForwarded, r), nil
 	}
+
 	la.Result = store.AuthSuccess
 	mox.LimiterFailedAuth.Reset(ip, start)
 
-	sessionToken, csrfToken, err := sessionAuth.add(ctx, log, accountName, username)
+	csrfToken, err := sessionStart(ctx, log, sessionAuth, kind, cookiePath, isForwarded, w, r, accountName, username)
 	if err != nil {
 		la.Result = store.AuthError
+		return "", nil, err
+	}
+	return csrfToken, nil, nil
+}
+
+// checkLoginCookie checks that the login cookie is present and matches
+// loginToken.
+func checkLoginCookie(kind string, isForwarded bool, r *http.Request, loginToken string) error {
+	loginCookie, _ := r.Cookie(kind + "login")
+	if loginCookie == nil || loginCookie.Value != loginToken {
+		msg := "missing login token cookie"
+		if isForwarded && loginCookie == nil {
+			msg += " (hint: reverse proxy must keep path, for login cookie)"
+		}
+		return &sherpa.Error{Code: "user:error", Message: msg}
+	}
+	return nil
+}
+
+// sessionStart adds a session after a successful login, sets the session cookie
+// and removes the login cookie.
+func sessionStart(ctx context.Context, log mlog.Log, sessionAuth SessionAuth, kind, cookiePath string, isForwarded bool, w http.ResponseWriter, r *http.Request, accountName, loginAddress string) (store.CSRFToken, error) {
+	sessionToken, csrfToken, err := sessionAuth.add(ctx, log, accountName, loginAddress)
+	if err != nil {
 		log.Errorx("adding session after login", err)
 		return "", fmt.Errorf("adding session: %v", err)
 	}
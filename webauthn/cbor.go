@@ -0,0 +1,135 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+var errCBOR = errors.New("cbor")
+
+// cborDecoder decodes the subset of CBOR used by WebAuthn: unsigned/negative
+// integers, byte and text strings, arrays, maps and simple values. Indefinite
+// lengths, tags and floats are not supported. RFC 8949.
+type cborDecoder struct {
+	buf []byte
+	o   int
+}
+
+func (d *cborDecoder) xerrorf(format string, args ...any) {
+	panic(fmt.Errorf("%w: %s", errCBOR, fmt.Sprintf(format, args...)))
+}
+
+func (d *cborDecoder) recover(rerr *error) {
+	x := recover()
+	if x == nil {
+		return
+	}
+	err, ok := x.(error)
+	if !ok || !errors.Is(err, errCBOR) {
+		panic(x)
+	}
+	*rerr = err
+}
+
+func (d *cborDecoder) xtake(n uint64) []byte {
+	if n > uint64(len(d.buf)-d.o) {
+		d.xerrorf("need %d bytes, %d left", n, len(d.buf)-d.o)
+	}
+	buf := d.buf[d.o : d.o+int(n)]
+	d.o += int(n)
+	return buf
+}
+
+// xhead reads the initial byte and argument of a data item.
+func (d *cborDecoder) xhead() (major byte, arg uint64) {
+	b := d.xtake(1)[0]
+	major = b >> 5
+	info := b & 0x1f
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info == 24:
+		arg = uint64(d.xtake(1)[0])
+	case info == 25:
+		arg = uint64(binary.BigEndian.Uint16(d.xtake(2)))
+	case info == 26:
+		arg = uint64(binary.BigEndian.Uint32(d.xtake(4)))
+	case info == 27:
+		arg = binary.BigEndian.Uint64(d.xtake(8))
+	default:
+		d.xerrorf("unsupported additional information %d", info)
+	}
+	return
+}
+
+// xvalue decodes a data item. Integers are returned as int64, byte strings as
+// []byte, text strings as string, arrays as []any, maps as map[any]any, and
+// simple values as bool or nil.
+func (d *cborDecoder) xvalue(depth int) any {
+	if depth > 16 {
+		d.xerrorf("nesting too deep")
+	}
+	major, arg := d.xhead()
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			d.xerrorf("integer too large")
+		}
+		return int64(arg)
+	case 1:
+		if arg > math.MaxInt64 {
+			d.xerrorf("integer too large")
+		}
+		return -1 - int64(arg)
+	case 2:
+		return d.xtake(arg)
+	case 3:
+		return string(d.xtake(arg))
+	case 4:
+		if arg > uint64(len(d.buf)) {
+			d.xerrorf("array too large")
+		}
+		l := make([]any, arg)
+		for i := range l {
+			l[i] = d.xvalue(depth + 1)
+		}
+		return l
+	case 5:
+		if arg > uint64(len(d.buf)) {
+			d.xerrorf("map too large")
+		}
+		m := map[any]any{}
+		for range arg {
+			k := d.xvalue(depth + 1)
+			switch k.(type) {
+			case int64, string:
+			default:
+				d.xerrorf("unsupported map key type %T", k)
+			}
+			m[k] = d.xvalue(depth + 1)
+		}
+		return m
+	case 7:
+		switch arg {
+		case 20:
+			return false
+		case 21:
+			return true
+		case 22:
+			return nil
+		}
+	}
+	d.xerrorf("unsupported major type %d with argument %d", major, arg)
+	return nil
+}
+
+// cborDecode decodes a single data item at the start of buf. It returns the
+// value and the number of bytes consumed.
+func cborDecode(buf []byte) (v any, n int, rerr error) {
+	d := &cborDecoder{buf: buf}
+	defer d.recover(&rerr)
+	v = d.xvalue(0)
+	return v, d.o, nil
+}
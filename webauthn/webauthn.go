@@ -0,0 +1,276 @@
+// Package webauthn implements server-side verification of WebAuthn credentials
+// (security keys and passkeys), for use as a second authentication factor.
+//
+// Registration (navigator.credentials.create in the browser) results in a
+// credential with a public key, which the server stores. Authentication
+// (navigator.credentials.get) results in an assertion: a signature over data
+// that includes a server-generated challenge, verified with the stored public
+// key.
+//
+// Attestation statements are not verified: we request "none" conveyance and
+// don't restrict which authenticators can be used. Public keys with algorithms
+// ES256, EdDSA (Ed25519) and RS256 are supported. User verification (e.g. PIN or
+// biometrics) is not required, the credential is only a second factor.
+//
+// See https://www.w3.org/TR/webauthn-2/.
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// ErrVerify is returned, wrapped, when a registration or assertion is not valid.
+var ErrVerify = errors.New("webauthn verification failed")
+
+// Flags in authenticator data.
+const (
+	flagUserPresent  = 0x01
+	flagAttestedData = 0x40
+)
+
+// COSE algorithm identifiers.
+const (
+	algES256 = -7
+	algEdDSA = -8
+	algRS256 = -257
+)
+
+// Algorithms is the list of supported COSE algorithms, in order of preference,
+// for the pubKeyCredParams in credential creation options.
+var Algorithms = []int{algES256, algEdDSA, algRS256}
+
+// NewChallenge returns a new random challenge, raw-url-base64-encoded as used
+// in client data.
+func NewChallenge() string {
+	buf := make([]byte, 32)
+	cryptorand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// Credential is a registered credential.
+type Credential struct {
+	ID        []byte // Credential ID, chosen by authenticator.
+	PublicKey []byte // COSE-encoded public key.
+	SignCount uint32 // Signature counter, 0 if authenticator does not keep a counter.
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+func verifyClientData(buf []byte, typ, origin, challenge string) error {
+	var cd clientData
+	if err := json.Unmarshal(buf, &cd); err != nil {
+		return fmt.Errorf("%w: parsing client data: %v", ErrVerify, err)
+	}
+	if cd.Type != typ {
+		return fmt.Errorf("%w: client data has type %q, expected %q", ErrVerify, cd.Type, typ)
+	}
+	if cd.Challenge == "" || cd.Challenge != challenge {
+		return fmt.Errorf("%w: challenge mismatch", ErrVerify)
+	}
+	if cd.Origin != origin {
+		return fmt.Errorf("%w: client data has origin %q, expected %q", ErrVerify, cd.Origin, origin)
+	}
+	return nil
+}
+
+type authData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+func parseAuthData(buf []byte, attested bool) (authData, error) {
+	var ad authData
+	if len(buf) < 37 {
+		return ad, fmt.Errorf("%w: authenticator data too short", ErrVerify)
+	}
+	ad.rpIDHash = buf[:32]
+	ad.flags = buf[32]
+	ad.signCount = binary.BigEndian.Uint32(buf[33:37])
+	if !attested {
+		return ad, nil
+	}
+	if ad.flags&flagAttestedData == 0 {
+		return ad, fmt.Errorf("%w: missing attested credential data", ErrVerify)
+	}
+	buf = buf[37:]
+	if len(buf) < 16+2 {
+		return ad, fmt.Errorf("%w: attested credential data too short", ErrVerify)
+	}
+	n := int(binary.BigEndian.Uint16(buf[16:18]))
+	buf = buf[18:]
+	if len(buf) < n {
+		return ad, fmt.Errorf("%w: credential id too short", ErrVerify)
+	}
+	ad.credentialID = buf[:n]
+	buf = buf[n:]
+	_, keyLen, err := cborDecode(buf)
+	if err != nil {
+		return ad, fmt.Errorf("%w: parsing credential public key: %v", ErrVerify, err)
+	}
+	ad.publicKey = buf[:keyLen]
+	return ad, nil
+}
+
+func checkAuthData(ad authData, rpID string) error {
+	h := sha256.Sum256([]byte(rpID))
+	if !bytes.Equal(ad.rpIDHash, h[:]) {
+		return fmt.Errorf("%w: relying party id hash mismatch", ErrVerify)
+	}
+	if ad.flags&flagUserPresent == 0 {
+		return fmt.Errorf("%w: user not present", ErrVerify)
+	}
+	return nil
+}
+
+// VerifyRegistration verifies a new credential, from the response of
+// navigator.credentials.create. The rpID (typically the host name), origin (e.g.
+// "https://mail.example.org") and challenge must match the values used for the
+// creation options.
+func VerifyRegistration(rpID, origin, challenge string, clientDataJSON, attestationObject []byte) (Credential, error) {
+	if err := verifyClientData(clientDataJSON, "webauthn.create", origin, challenge); err != nil {
+		return Credential{}, err
+	}
+
+	v, _, err := cborDecode(attestationObject)
+	if err != nil {
+		return Credential{}, fmt.Errorf("%w: parsing attestation object: %v", ErrVerify, err)
+	}
+	m, ok := v.(map[any]any)
+	if !ok {
+		return Credential{}, fmt.Errorf("%w: attestation object not a map", ErrVerify)
+	}
+	buf, ok := m["authData"].([]byte)
+	if !ok {
+		return Credential{}, fmt.Errorf("%w: attestation object without authenticator data", ErrVerify)
+	}
+	ad, err := parseAuthData(buf, true)
+	if err != nil {
+		return Credential{}, err
+	}
+	if err := checkAuthData(ad, rpID); err != nil {
+		return Credential{}, err
+	}
+	if _, err := parsePublicKey(ad.publicKey); err != nil {
+		return Credential{}, err
+	}
+	c := Credential{
+		ID:        bytes.Clone(ad.credentialID),
+		PublicKey: bytes.Clone(ad.publicKey),
+		SignCount: ad.signCount,
+	}
+	return c, nil
+}
+
+// VerifyAssertion verifies an assertion, from the response of
+// navigator.credentials.get, against a registered credential with publicKey and
+// signCount. The new signature counter is returned, to be stored for the next
+// verification. If the authenticator keeps a counter and it did not increase,
+// the credential may have been cloned and an error is returned.
+func VerifyAssertion(rpID, origin, challenge string, publicKey []byte, signCount uint32, clientDataJSON, authenticatorData, signature []byte) (uint32, error) {
+	if err := verifyClientData(clientDataJSON, "webauthn.get", origin, challenge); err != nil {
+		return 0, err
+	}
+	ad, err := parseAuthData(authenticatorData, false)
+	if err != nil {
+		return 0, err
+	}
+	if err := checkAuthData(ad, rpID); err != nil {
+		return 0, err
+	}
+
+	pk, err := parsePublicKey(publicKey)
+	if err != nil {
+		return 0, err
+	}
+	cdh := sha256.Sum256(clientDataJSON)
+	data := append(bytes.Clone(authenticatorData), cdh[:]...)
+	if err := verifySignature(pk, data, signature); err != nil {
+		return 0, err
+	}
+
+	if (ad.signCount != 0 || signCount != 0) && ad.signCount <= signCount {
+		return 0, fmt.Errorf("%w: signature counter did not increase, credential may be cloned", ErrVerify)
+	}
+	return ad.signCount, nil
+}
+
+// parsePublicKey parses a COSE key, RFC 9052.
+func parsePublicKey(buf []byte) (crypto.PublicKey, error) {
+	v, _, err := cborDecode(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%w: parsing public key: %v", ErrVerify, err)
+	}
+	m, ok := v.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: public key not a map", ErrVerify)
+	}
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+	switch {
+	case kty == 2 && alg == algES256:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		y, _ := m[int64(-3)].([]byte)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("%w: bad ec2 public key parameters", ErrVerify)
+		}
+		pk := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pk.Curve.IsOnCurve(pk.X, pk.Y) {
+			return nil, fmt.Errorf("%w: ec2 public key not on curve", ErrVerify)
+		}
+		return pk, nil
+	case kty == 1 && alg == algEdDSA:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		if crv != 6 || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: bad okp public key parameters", ErrVerify)
+		}
+		return ed25519.PublicKey(x), nil
+	case kty == 3 && alg == algRS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		if len(n) < 2048/8 || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("%w: bad rsa public key parameters", ErrVerify)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	}
+	return nil, fmt.Errorf("%w: unsupported public key type %d with algorithm %d", ErrVerify, kty, alg)
+}
+
+func verifySignature(pk crypto.PublicKey, data, sig []byte) error {
+	var ok bool
+	switch k := pk.(type) {
+	case *ecdsa.PublicKey:
+		h := sha256.Sum256(data)
+		ok = ecdsa.VerifyASN1(k, h[:], sig)
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(k, data, sig)
+	case *rsa.PublicKey:
+		h := sha256.Sum256(data)
+		ok = rsa.VerifyPKCS1v15(k, crypto.SHA256, h[:], sig) == nil
+	}
+	if !ok {
+		return fmt.Errorf("%w: bad signature", ErrVerify)
+	}
+	return nil
+}
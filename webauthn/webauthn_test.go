@@ -0,0 +1,244 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+	"testing"
+)
+
+// cborEncode encodes the value types returned by the decoder, for the tests.
+func cborEncode(v any) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n < 1<<8:
+			return []byte{major<<5 | 24, byte(n)}
+		case n < 1<<16:
+			return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+		default:
+			return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+		}
+	}
+	switch x := v.(type) {
+	case int:
+		if x >= 0 {
+			return head(0, uint64(x))
+		}
+		return head(1, uint64(-1-x))
+	case []byte:
+		return append(head(2, uint64(len(x))), x...)
+	case string:
+		return append(head(3, uint64(len(x))), x...)
+	case map[any]any:
+		// Deterministic order, not necessarily canonical.
+		var keys []any
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return string(cborEncode(keys[i])) < string(cborEncode(keys[j]))
+		})
+		buf := head(5, uint64(len(x)))
+		for _, k := range keys {
+			buf = append(buf, cborEncode(k)...)
+			buf = append(buf, cborEncode(x[k])...)
+		}
+		return buf
+	}
+	panic("unsupported type")
+}
+
+type authenticator struct {
+	credID    []byte
+	sign      func(data []byte) []byte
+	coseKey   []byte
+	signCount uint32
+}
+
+func newES256(t *testing.T) *authenticator {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), cryptorand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	x := k.PublicKey.X.FillBytes(make([]byte, 32))
+	y := k.PublicKey.Y.FillBytes(make([]byte, 32))
+	cose := cborEncode(map[any]any{1: 2, 3: algES256, -1: 1, -2: x, -3: y})
+	return &authenticator{
+		credID: []byte("es256-credential"),
+		sign: func(data []byte) []byte {
+			h := sha256.Sum256(data)
+			sig, err := ecdsa.SignASN1(cryptorand.Reader, k, h[:])
+			if err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+			return sig
+		},
+		coseKey: cose,
+	}
+}
+
+func newEdDSA(t *testing.T) *authenticator {
+	pub, priv, err := ed25519.GenerateKey(cryptorand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	cose := cborEncode(map[any]any{1: 1, 3: algEdDSA, -1: 6, -2: []byte(pub)})
+	return &authenticator{
+		credID:  []byte("eddsa-credential"),
+		sign:    func(data []byte) []byte { return ed25519.Sign(priv, data) },
+		coseKey: cose,
+	}
+}
+
+func (a *authenticator) authData(rpID string, attested bool) []byte {
+	h := sha256.Sum256([]byte(rpID))
+	buf := append([]byte{}, h[:]...)
+	flags := byte(flagUserPresent)
+	if attested {
+		flags |= flagAttestedData
+	}
+	buf = append(buf, flags)
+	buf = binary.BigEndian.AppendUint32(buf, a.signCount)
+	if attested {
+		buf = append(buf, make([]byte, 16)...) // AAGUID.
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(a.credID)))
+		buf = append(buf, a.credID...)
+		buf = append(buf, a.coseKey...)
+	}
+	return buf
+}
+
+func clientDataJSON(typ, challenge, origin string) []byte {
+	buf, _ := json.Marshal(clientData{typ, challenge, origin})
+	return buf
+}
+
+func (a *authenticator) create(rpID, origin, challenge string) (cdj, attObj []byte) {
+	cdj = clientDataJSON("webauthn.create", challenge, origin)
+	attObj = cborEncode(map[any]any{"fmt": "none", "attStmt": map[any]any{}, "authData": a.authData(rpID, true)})
+	return
+}
+
+func (a *authenticator) get(rpID, origin, challenge string) (cdj, authData, sig []byte) {
+	a.signCount++
+	cdj = clientDataJSON("webauthn.get", challenge, origin)
+	authData = a.authData(rpID, false)
+	h := sha256.Sum256(cdj)
+	sig = a.sign(append(append([]byte{}, authData...), h[:]...))
+	return
+}
+
+func TestWebAuthn(t *testing.T) {
+	const rpID = "mail.mox.example"
+	const origin = "https://mail.mox.example"
+
+	for _, a := range []*authenticator{newES256(t), newEdDSA(t)} {
+		challenge := NewChallenge()
+		cdj, attObj := a.create(rpID, origin, challenge)
+
+		_, err := VerifyRegistration(rpID, origin, NewChallenge(), cdj, attObj)
+		if !errors.Is(err, ErrVerify) {
+			t.Fatalf("registration with other challenge: got %v, expected ErrVerify", err)
+		}
+		_, err = VerifyRegistration(rpID, "https://other.example", challenge, cdj, attObj)
+		if !errors.Is(err, ErrVerify) {
+			t.Fatalf("registration with other origin: got %v, expected ErrVerify", err)
+		}
+		_, err = VerifyRegistration("other.example", origin, challenge, cdj, attObj)
+		if !errors.Is(err, ErrVerify) {
+			t.Fatalf("registration with other rp id: got %v, expected ErrVerify", err)
+		}
+
+		cred, err := VerifyRegistration(rpID, origin, challenge, cdj, attObj)
+		if err != nil {
+			t.Fatalf("registration: %v", err)
+		}
+		if string(cred.ID) != string(a.credID) {
+			t.Fatalf("got credential id %q, expected %q", cred.ID, a.credID)
+		}
+
+		challenge = NewChallenge()
+		cdj, authData, sig := a.get(rpID, origin, challenge)
+		signCount, err := VerifyAssertion(rpID, origin, challenge, cred.PublicKey, cred.SignCount, cdj, authData, sig)
+		if err != nil {
+			t.Fatalf("assertion: %v", err)
+		}
+		if signCount != 1 {
+			t.Fatalf("got sign count %d, expected 1", signCount)
+		}
+
+		// Counter must increase.
+		_, err = VerifyAssertion(rpID, origin, challenge, cred.PublicKey, signCount, cdj, authData, sig)
+		if !errors.Is(err, ErrVerify) {
+			t.Fatalf("assertion with same counter: got %v, expected ErrVerify", err)
+		}
+
+		// Bad signature.
+		challenge = NewChallenge()
+		cdj, authData, sig = a.get(rpID, origin, challenge)
+		sig[len(sig)-1] ^= 1
+		_, err = VerifyAssertion(rpID, origin, challenge, cred.PublicKey, signCount, cdj, authData, sig)
+		if !errors.Is(err, ErrVerify) {
+			t.Fatalf("assertion with bad signature: got %v, expected ErrVerify", err)
+		}
+
+		// Other challenge.
+		challenge = NewChallenge()
+		cdj, authData, sig = a.get(rpID, origin, challenge)
+		_, err = VerifyAssertion(rpID, origin, NewChallenge(), cred.PublicKey, signCount, cdj, authData, sig)
+		if !errors.Is(err, ErrVerify) {
+			t.Fatalf("assertion with other challenge: got %v, expected ErrVerify", err)
+		}
+	}
+}
+
+func TestCBOR(t *testing.T) {
+	// From RFC 8949 appendix A.
+	testcases := []struct {
+		hex string
+		exp any
+	}{
+		{"00", int64(0)},
+		{"1864", int64(100)},
+		{"3903e7", int64(-1000)},
+		{"f5", true},
+		{"43010203", []byte{1, 2, 3}},
+		{"6449455446", "IETF"},
+	}
+	for _, tc := range testcases {
+		buf, err := hex.DecodeString(tc.hex)
+		if err != nil {
+			t.Fatalf("parsing hex: %v", err)
+		}
+		v, n, err := cborDecode(buf)
+		if err != nil {
+			t.Fatalf("decode %s: %v", tc.hex, err)
+		}
+		if n != len(buf) {
+			t.Fatalf("decode %s: consumed %d bytes, expected %d", tc.hex, n, len(buf))
+		}
+		if vb, ok := v.([]byte); ok {
+			if string(vb) != string(tc.exp.([]byte)) {
+				t.Fatalf("decode %s: got %v, expected %v", tc.hex, v, tc.exp)
+			}
+		} else if v != tc.exp {
+			t.Fatalf("decode %s: got %v, expected %v", tc.hex, v, tc.exp)
+		}
+	}
+
+	// Truncated and unsupported data.
+	for _, buf := range [][]byte{{0x18}, {0x43, 1}, {0x9f}, {0xc0, 0}, {0xa1, 0x40, 0}} {
+		if _, _, err := cborDecode(buf); !errors.Is(err, errCBOR) {
+			t.Fatalf("decode %x: got %v, expected errCBOR", buf, err)
+		}
+	}
+}
@@ -50,6 +50,13 @@ const (
 	// type ("action"), or an incoming non-DSN-message was received for the unique
 	// per-outgoing-message address used for sending.
 	EventUnrecognized OutgoingEvent = "unrecognized"
+
+	// A message was submitted that reached a send limit configured for the account
+	// or the domain of its From address. See field SendLimit of [Outgoing] for
+	// details, and its Policy for whether the message was rejected, held in the
+	// queue or accepted for delivery. Not tied to a message in the queue, so
+	// QueueMsgID is zero.
+	EventLimitReached OutgoingEvent = "limitreached"
 )
 
 // Outgoing is the payload sent to webhook URLs for events about outgoing deliveries.
@@ -67,6 +74,19 @@ type Outgoing struct {
 	SMTPEnhancedCode string            // Optional, for errors only, e.g. 5.1.1.
 	Error            string            // Error message while delivering, or from DSN from remote, if any.
 	Extra            map[string]string // Extra fields set for message during submit, through webapi call or through X-Mox-Extra-* headers during SMTP submission.
+	SendLimit        *SendLimit        `json:",omitempty"` // For event "limitreached" only.
+}
+
+// SendLimit is a limit on outgoing messages that was reached.
+type SendLimit struct {
+	Scope  string // "account" or "domain".
+	Name   string // Name of account, or domain (in unicode).
+	Source string // Limits that applied: "all", "submission" (SMTP and webmail) or "webapi".
+	Kind   string // "messages" or "recipients".
+	Period string // "hour", "day" or "month" (30 days).
+	Limit  int    // Configured maximum.
+	Count  int    // Current count for the period, including the message that reached the limit.
+	Policy string // "reject", "hold" or "notify".
 }
 
 // Incoming is the data sent to a webhook for incoming deliveries over SMTP.
@@ -37,6 +37,7 @@ import (
 	"github.com/mjl-/mox/config"
 	"github.com/mjl-/mox/dkim"
 	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/ical"
 	"github.com/mjl-/mox/message"
 	"github.com/mjl-/mox/metrics"
 	"github.com/mjl-/mox/mlog"
@@ -108,16 +109,34 @@ func (w Webmail) LoginPrep(ctx context.Context) string {
 }
 
 // Login returns a session token for the credentials, or fails with error code
-// "user:badLogin". Call LoginPrep to get a loginToken.
-func (w Webmail) Login(ctx context.Context, loginToken, username, password string) store.CSRFToken {
+// "user:badLogin". Call LoginPrep to get a loginToken. If a second factor is
+// required, no session is created yet, and secondFactor is returned instead.
+// Complete the login with LoginSecondFactor.
+func (w Webmail) Login(ctx context.Context, loginToken, username, password string) (csrfToken store.CSRFToken, secondFactor *webauth.SecondFactorChallenge) {
 	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
 	log := reqInfo.Log
 
-	csrfToken, err := webauth.Login(ctx, log, webauth.Accounts, "webmail", w.cookiePath, w.isForwarded, reqInfo.Response, reqInfo.Request, loginToken, username, password)
+	csrfToken, secondFactor, err := webauth.Login(ctx, log, webauth.Accounts, "webmail", w.cookiePath, w.isForwarded, reqInfo.Response, reqInfo.Request, loginToken, username, password)
 	if _, ok := err.(*sherpa.Error); ok {
 		panic(err)
 	}
 	xcheckf(ctx, err, "login")
+	return csrfToken, secondFactor
+}
+
+// LoginSecondFactor completes a login for which Login returned a second factor
+// challenge, with the token from the challenge and a TOTP code, recovery code or
+// WebAuthn assertion. It returns a session token, or fails with error code
+// "user:loginFailed".
+func (w Webmail) LoginSecondFactor(ctx context.Context, loginToken, token string, response webauth.SecondFactorResponse) store.CSRFToken {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	log := reqInfo.Log
+
+	csrfToken, err := webauth.LoginSecondFactor(ctx, log, webauth.Accounts, "webmail", w.cookiePath, w.isForwarded, reqInfo.Response, reqInfo.Request, loginToken, token, response)
+	if _, ok := err.(*sherpa.Error); ok {
+		panic(err)
+	}
+	xcheckf(ctx, err, "login with second factor")
 	return csrfToken
 }
 
@@ -507,13 +526,23 @@ type SubmitMessage struct {
 	Attachments               []File
 	ForwardAttachments        ForwardAttachments
 	IsForward                 bool
-	ResponseMessageID         int64      // If set, this was a reply or forward, based on IsForward.
-	UserAgent                 string     // User-Agent header added if not empty.
-	RequireTLS                *bool      // For "Require TLS" extension during delivery.
-	FutureRelease             *time.Time // If set, time (in the future) when message should be delivered from queue.
-	ArchiveThread             bool       // If set, thread is archived after sending message.
-	ArchiveReferenceMailboxID int64      // If ArchiveThread is set, thread messages from this mailbox ID are moved to the archive mailbox ID. E.g. of Inbox.
-	DraftMessageID            int64      // If set, draft message that will be removed after sending.
+	ResponseMessageID         int64        // If set, this was a reply or forward, based on IsForward.
+	UserAgent                 string       // User-Agent header added if not empty.
+	RequireTLS                *bool        // For "Require TLS" extension during delivery.
+	FutureRelease             *time.Time   // If set, time (in the future) when message should be delivered from queue.
+	ArchiveThread             bool         // If set, thread is archived after sending message.
+	ArchiveReferenceMailboxID int64        // If ArchiveThread is set, thread messages from this mailbox ID are moved to the archive mailbox ID. E.g. of Inbox.
+	DraftMessageID            int64        // If set, draft message that will be removed after sending.
+	InviteReply               *InviteReply // If set, a calendar reply (iMIP) is added to the message, as alternative to the text body.
+}
+
+// InviteReply is a response to a calendar invitation in a message, sent with a
+// SubmitMessage. If the account has a calendar (CalDAV), the event is stored or
+// updated in it.
+type InviteReply struct {
+	MessageID int64  // Message with the invitation.
+	PartPath  []int  // Path to the text/calendar part, indices into the top-level message.Part.Parts.
+	PartStat  string // ACCEPTED, TENTATIVE or DECLINED.
 }
 
 // ForwardAttachments references attachments by a list of message.Part paths.
@@ -680,6 +709,48 @@ func (w Webmail) MessageSubmit(ctx context.Context, m SubmitMessage) {
 		xcheckf(ctx, err, "checking send limit")
 	})
 
+	// Prepare reply to calendar invitation, and calendar data for storing the event.
+	var inviteUID, inviteComp, inviteReply, inviteCalendar string
+	if m.InviteReply != nil {
+		if len(m.Attachments) > 0 || len(m.ForwardAttachments.Paths) > 0 {
+			xcheckuserf(ctx, errors.New("cannot send attachments with reply to invitation"), "composing message")
+		}
+		var data string
+		xdbread(ctx, acc, func(tx *bstore.Tx) {
+			im := xmessageID(ctx, tx, m.InviteReply.MessageID)
+			msgr := acc.MessageReader(im)
+			defer func() {
+				err := msgr.Close()
+				log.Check(err, "closing message reader")
+			}()
+			ip, err := im.LoadPart(msgr)
+			xcheckf(ctx, err, "load parsed message")
+			for _, xp := range m.InviteReply.PartPath {
+				if xp < 0 || xp >= len(ip.Parts) {
+					xcheckuserf(ctx, errors.New("unknown part"), "looking up invitation")
+				}
+				ip = ip.Parts[xp]
+			}
+			if ip.MediaType != "TEXT" || ip.MediaSubType != "CALENDAR" {
+				xcheckuserf(ctx, errors.New("not a text/calendar part"), "looking up invitation")
+			}
+			buf, err := io.ReadAll(&moxio.LimitReader{R: ip.ReaderUTF8OrBinary(), Limit: ical.MaxInviteSize})
+			xcheckuserf(ctx, err, "reading invitation")
+			data = string(buf)
+		})
+		inv, err := ical.ParseInvite(data)
+		xcheckuserf(ctx, err, "parsing invitation")
+		attendee := inviteAttendee(acc.Name, inv)
+		if attendee == "" {
+			attendee = fromAddr.Address.String()
+		}
+		inviteReply, err = ical.Reply(data, attendee, m.InviteReply.PartStat, time.Now())
+		xcheckuserf(ctx, err, "making reply to invitation")
+		inviteCalendar, err = ical.CalendarObject(data, attendee, m.InviteReply.PartStat)
+		xcheckf(ctx, err, "making calendar object for invitation")
+		inviteUID, inviteComp = inv.UID, inv.Component
+	}
+
 	// We only use smtputf8 if we have to, with a utf-8 localpart. For IDNA, we use ASCII domains.
 	smtputf8 := false
 	for _, a := range recipients {
@@ -752,6 +823,23 @@ func (w Webmail) MessageSubmit(ctx context.Context, m SubmitMessage) {
 
 	messageID := fmt.Sprintf("<%s>", mox.MessageIDGen(smtputf8))
 	xc.Header("Message-Id", messageID)
+
+	// Check send limits for account and domain, recording usage. May add a hold rule.
+	// If we don't queue the message after all, the usage is removed again.
+	usage, err := queue.SendLimitCheck(ctx, log, reqInfo.Account.Name, fromAddr.Address.Domain, queue.SendSourceWebmail, len(recipients), messageID, m.Subject)
+	if errors.Is(err, queue.ErrSendLimit) {
+		metricSubmission.WithLabelValues("sendlimiterror").Inc()
+		xcheckuserf(ctx, err, "checking send limits")
+	} else {
+		xcheckf(ctx, err, "checking send limits")
+	}
+	var queued bool
+	defer func() {
+		if !queued {
+			err := queue.SendUsageRemove(context.Background(), usage)
+			log.Check(err, "removing send usage for message that was not queued")
+		}
+	}()
 	xc.Header("Date", time.Now().Format(message.RFC5322Z))
 	// Add In-Reply-To and References headers.
 	if m.ResponseMessageID > 0 {
@@ -919,6 +1007,30 @@ func (w Webmail) MessageSubmit(ctx context.Context, m SubmitMessage) {
 			})
 		}
 
+		err = mp.Close()
+		xcheckf(ctx, err, "writing mime multipart")
+	} else if m.InviteReply != nil {
+		// Calendar reply as alternative to the text, ../rfc/6047:497
+		mp := multipart.NewWriter(xc)
+		xc.Header("Content-Type", fmt.Sprintf(`multipart/alternative; boundary="%s"`, mp.Boundary()))
+		xc.Line()
+
+		xaddText := func(subtype, text, method string) {
+			body, ct, cte := xc.TextPart(subtype, text)
+			if method != "" {
+				ct += "; method=" + method
+			}
+			hdr := textproto.MIMEHeader{}
+			hdr.Set("Content-Type", ct)
+			hdr.Set("Content-Transfer-Encoding", cte)
+			p, err := mp.CreatePart(hdr)
+			xcheckf(ctx, err, "adding text part to message")
+			_, err = p.Write(body)
+			xcheckf(ctx, err, "writing text part")
+		}
+		xaddText("plain", m.TextBody, "")
+		xaddText("calendar", strings.ReplaceAll(inviteReply, "\r\n", "\n"), "REPLY")
+
 		err = mp.Close()
 		xcheckf(ctx, err, "writing mime multipart")
 	} else {
@@ -1001,6 +1113,7 @@ func (w Webmail) MessageSubmit(ctx context.Context, m SubmitMessage) {
 		metricSubmission.WithLabelValues("queueerror").Inc()
 	}
 	xcheckf(ctx, err, "adding messages to the delivery queue")
+	queued = true
 	metricSubmission.WithLabelValues("ok").Inc()
 
 	var modseq store.ModSeq // Only set if needed.
@@ -1095,6 +1208,15 @@ func (w Webmail) MessageSubmit(ctx context.Context, m SubmitMessage) {
 				}
 			}
 
+			// Store the event in the calendar, if the account has one.
+			if inviteCalendar != "" {
+				_, stored, err := store.DAVCalendarObjectPut(tx, inviteUID, inviteComp, inviteCalendar)
+				xcheckf(ctx, err, "message submitted to queue, storing event from invitation in calendar")
+				if stored {
+					log.Debug("stored event from invitation in calendar", slog.String("uid", inviteUID))
+				}
+			}
+
 			sentmb, err := bstore.QueryTx[store.Mailbox](tx).FilterEqual("Expunged", false).FilterEqual("Sent", true).Get()
 			if err == bstore.ErrAbsent || err == store.ErrMailboxExpunged {
 				// There is no mailbox designated as Sent mailbox, so we're done.
@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"runtime/debug"
 	"slices"
+	"strings"
 	"testing"
 
 	"github.com/mjl-/bstore"
@@ -430,6 +431,52 @@ func TestAPI(t *testing.T) {
 		TextBody: fmt.Sprintf("%80s", "tést"),
 	})
 
+	// Reply to invitation. Without calendar, only the reply is sent.
+	inboxInvite := &testmsg{"Inbox", store.Flags{}, nil, msgInvite, zerom, 0}
+	tdeliver(t, acc, inboxInvite)
+	pm = api.ParsedMessage(ctx, inboxInvite.ID)
+	if pm.Invite == nil {
+		t.Fatalf("missing invite in parsed message")
+	}
+	tcompare(t, pm.Invite.Invite.Method, "REQUEST")
+	tcompare(t, pm.Invite.Invite.UID, "meeting1")
+	tcompare(t, pm.Invite.PartPath, []int{1})
+	tcompare(t, pm.Invite.Attendee, "mjl@mox.example")
+	inviteReply := SubmitMessage{
+		From:              "mjl@mox.example",
+		To:                []string{"mjl+organizer@mox.example"},
+		Subject:           "Accepted: Meeting",
+		TextBody:          "accepted",
+		ResponseMessageID: inboxInvite.ID,
+		InviteReply:       &InviteReply{inboxInvite.ID, []int{1}, "ACCEPTED"},
+	}
+	api.MessageSubmit(ctx, inviteReply)
+	// With a calendar, the event is stored.
+	err = store.DAVCollectionsEnsure(ctx, acc)
+	tcheck(t, err, "ensure dav collections")
+	inviteReply.InviteReply.PartStat = "TENTATIVE"
+	api.MessageSubmit(ctx, inviteReply)
+	event, err := bstore.QueryDB[store.DAVObject](ctx, acc.DB).FilterNonzero(store.DAVObject{UID: "meeting1"}).Get()
+	tcheck(t, err, "get stored event")
+	if !strings.Contains(event.Data, "PARTSTAT=TENTATIVE") || strings.Contains(event.Data, "METHOD") {
+		t.Fatalf("unexpected stored event data: %s", event.Data)
+	}
+	// Updated on second reply.
+	inviteReply.InviteReply.PartStat = "DECLINED"
+	api.MessageSubmit(ctx, inviteReply)
+	event, err = bstore.QueryDB[store.DAVObject](ctx, acc.DB).FilterNonzero(store.DAVObject{UID: "meeting1"}).Get()
+	tcheck(t, err, "get stored event")
+	if !strings.Contains(event.Data, "PARTSTAT=DECLINED") {
+		t.Fatalf("unexpected stored event data: %s", event.Data)
+	}
+	// Bad participation status, and not a calendar part.
+	tneedError(t, func() {
+		api.MessageSubmit(ctx, SubmitMessage{From: "mjl@mox.example", To: []string{"mjl+organizer@mox.example"}, InviteReply: &InviteReply{inboxInvite.ID, []int{1}, "BOGUS"}})
+	})
+	tneedError(t, func() {
+		api.MessageSubmit(ctx, SubmitMessage{From: "mjl@mox.example", To: []string{"mjl+organizer@mox.example"}, InviteReply: &InviteReply{inboxInvite.ID, []int{0}, "ACCEPTED"}})
+	})
+
 	// Send without special-use Sent mailbox.
 	api.MailboxSetSpecialUse(ctx, store.Mailbox{ID: sent.ID, SpecialUse: store.SpecialUse{}})
 	api.MessageSubmit(ctx, SubmitMessage{
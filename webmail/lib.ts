@@ -517,3 +517,123 @@ const loadMsgheaderView = (msgheaderelem: HTMLTableSectionElement, mi: api.Messa
 		),
 	)
 }
+
+// loadInviteView shows a summary of a calendar invitation or reply (iMIP) in
+// inviteelem. For invitations of the account, buttons to accept, tentatively
+// accept or decline send a reply to the organizer.
+const loadInviteView = (inviteelem: HTMLElement, client: api.Client, mi: api.MessageItem, pm: api.ParsedMessage) => {
+	const mv = pm.Invite
+	if (!mv) {
+		dom._kids(inviteelem)
+		return
+	}
+	const inv = mv.Invite
+
+	const partStats: { [partStat: string]: string } = {
+		'NEEDS-ACTION': 'No response',
+		'ACCEPTED': 'Accepted',
+		'TENTATIVE': 'Tentative',
+		'DECLINED': 'Declined',
+		'DELEGATED': 'Delegated',
+	}
+	const formatPartStat = (s: string) => partStats[s] || s
+	const formatParticipant = (p: api.Participant) => p.Name ? p.Name + ' <' + p.Address + '>' : p.Address
+	const methods: { [method: string]: string } = {
+		'REQUEST': 'Invitation',
+		'REPLY': 'Reply to invitation',
+		'CANCEL': 'Cancelled',
+		'COUNTER': 'Counter proposal',
+	}
+
+	// Zero times from the API are in year 1.
+	const isSet = (d: Date) => d.getUTCFullYear() > 1
+	const formatWhen = () => {
+		if (!isSet(inv.Start)) {
+			return ''
+		}
+		if (inv.AllDay) {
+			// Dates are in UTC, and the end date is exclusive.
+			const day = (d: Date) => d.toLocaleDateString(undefined, {timeZone: 'UTC', weekday: 'short', year: 'numeric', month: 'short', day: 'numeric'})
+			const end = isSet(inv.End) ? new Date(inv.End.getTime() - 24*3600*1000) : inv.Start
+			return day(inv.Start) + (end.getTime() > inv.Start.getTime() ? ' - ' + day(end) : '') + ' (all day)'
+		}
+		const s = inv.Start.toLocaleString(undefined, {weekday: 'short', year: 'numeric', month: 'short', day: 'numeric', hour: '2-digit', minute: '2-digit'})
+		if (!isSet(inv.End)) {
+			return s
+		}
+		const sameDay = inv.Start.toDateString() === inv.End.toDateString()
+		return s + ' - ' + (sameDay ? inv.End.toLocaleTimeString(undefined, {hour: '2-digit', minute: '2-digit'}) : inv.End.toLocaleString(undefined, {weekday: 'short', year: 'numeric', month: 'short', day: 'numeric', hour: '2-digit', minute: '2-digit'}))
+	}
+
+	const own = (inv.Attendees || []).find(a => a.Address.toLowerCase() === mv.Attendee.toLowerCase())
+	let replyElem: HTMLElement
+
+	const reply = async (partStat: string, buttons: HTMLButtonElement[]) => {
+		const label = formatPartStat(partStat)
+		const summary = inv.Summary || mi.Envelope.Subject || ''
+		buttons.forEach(b => b.disabled = true)
+		try {
+			await client.MessageSubmit({
+				From: mv.Attendee,
+				To: [inv.Organizer.Address],
+				Cc: [],
+				Bcc: [],
+				ReplyTo: '',
+				Subject: label + ': ' + summary,
+				TextBody: label + ': ' + summary + '\n',
+				Attachments: [],
+				ForwardAttachments: {MessageID: 0, Paths: []},
+				IsForward: false,
+				ResponseMessageID: mi.Message.ID,
+				UserAgent: '',
+				RequireTLS: null,
+				FutureRelease: null,
+				ArchiveThread: false,
+				ArchiveReferenceMailboxID: 0,
+				DraftMessageID: 0,
+				InviteReply: {MessageID: mi.Message.ID, PartPath: mv.PartPath || [], PartStat: partStat},
+			})
+		} catch (err) {
+			window.alert('Error: ' + ((err as any).message || '(no message)'))
+			return
+		} finally {
+			buttons.forEach(b => b.disabled = false)
+		}
+		dom._kids(replyElem, 'Reply sent: ' + label)
+	}
+
+	const inviteFieldStyle = css('inviteField', {textAlign: 'right', color: styles.colorMild, whiteSpace: 'nowrap', paddingRight: '.5em', verticalAlign: 'top'})
+	const row = (k: string, v: string | HTMLElement | (string | HTMLElement)[]) => dom.tr(dom.td(k+':', inviteFieldStyle), dom.td(v))
+	const when = formatWhen()
+	let buttons: HTMLButtonElement[] = []
+	dom._kids(inviteelem,
+		dom.div(
+			css('inviteSeparator', {borderTop: '1px solid', borderTopColor: styles.borderColor}),
+			dom.div(dom._class('pad'),
+				dom.div(
+					dom.b(methods[inv.Method] || 'Calendar ' + inv.Method.toLowerCase()),
+					inv.Summary ? ': ' + inv.Summary : [],
+				),
+				dom.table(
+					when ? row('When', when + (inv.Recurring ? ', recurring' : '')) : [],
+					inv.Location ? row('Where', inv.Location) : [],
+					inv.Organizer.Address ? row('Organizer', formatParticipant(inv.Organizer)) : [],
+					(inv.Attendees || []).length === 0 ? [] : row('Attendees',
+						(inv.Attendees || []).map(a => dom.div(formatParticipant(a), ' (', formatPartStat(a.PartStat), ')')),
+					),
+				),
+				inv.Method !== 'REQUEST' || !mv.Attendee || !inv.Organizer.Address ? [] : replyElem=dom.div(
+					style({marginTop: '.5ex'}),
+					own ? 'Your response: ' + formatPartStat(own.PartStat) + ' ' : [],
+					dom.span(dom._class('btngroup'),
+						buttons=[
+							dom.clickbutton('Accept', attr.title('Send reply to organizer accepting the invitation.'), async function click() { await reply('ACCEPTED', buttons) }),
+							dom.clickbutton('Tentative', attr.title('Send reply to organizer tentatively accepting the invitation.'), async function click() { await reply('TENTATIVE', buttons) }),
+							dom.clickbutton('Decline', attr.title('Send reply to organizer declining the invitation.'), async function click() { await reply('DECLINED', buttons) }),
+						],
+					),
+				),
+			),
+		),
+	)
+}
@@ -13,6 +13,7 @@ import (
 	"golang.org/x/text/encoding/ianaindex"
 
 	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/ical"
 	"github.com/mjl-/mox/message"
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/mox-"
@@ -241,6 +242,18 @@ func parsedMessage(log mlog.Log, m *store.Message, state *msgState, full, msgite
 			if parent == nil && mt == "MULTIPART/ENCRYPTED" {
 				pm.isEncrypted = true
 			}
+			// Calendar invitations and replies (iMIP, RFC 6047) are parsed for showing a
+			// summary, and are still listed as attachment.
+			if mt == "TEXT/CALENDAR" && full && pm.Invite == nil {
+				buf, err := io.ReadAll(&moxio.LimitReader{R: p.ReaderUTF8OrBinary(), Limit: ical.MaxInviteSize})
+				if err != nil {
+					log.Debugx("reading calendar part", err, slog.Int64("msgid", m.ID))
+				} else if inv, err := ical.ParseInvite(string(buf)); err != nil {
+					log.Debugx("parsing calendar part", err, slog.Int64("msgid", m.ID))
+				} else {
+					pm.Invite = &MessageInvite{*inv, slices.Clone(path), inviteAttendee(state.acc.Name, inv)}
+				}
+			}
 			// todo: possibly do not include anything below multipart/alternative that starts with text/html, they may be cids. perhaps have a separate list of attachments for the text vs html version?
 			if p.MediaType != "MULTIPART" {
 				var parentct string
@@ -306,6 +319,22 @@ func parsedMessage(log mlog.Log, m *store.Message, state *msgState, full, msgite
 	return
 }
 
+// inviteAttendee returns the first attendee address of the invitation that
+// belongs to the account, or an empty string.
+func inviteAttendee(accName string, inv *ical.Invite) string {
+	for _, a := range inv.Attendees {
+		addr, err := smtp.ParseAddress(a.Address)
+		if err != nil {
+			continue
+		}
+		name, _, _, _, err := mox.LookupAddress(addr.Localpart, addr.Domain, false, false, false)
+		if err == nil && name == accName {
+			return a.Address
+		}
+	}
+	return ""
+}
+
 // parses List-Post header, returning an address if it could be found, and nil otherwise.
 func parseListPostAddress(s string) *MessageAddress {
 	/*
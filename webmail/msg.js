@@ -289,26 +289,34 @@ var api;
 		Quoting["Bottom"] = "bottom";
 		Quoting["Top"] = "top";
 	})(Quoting = api.Quoting || (api.Quoting = {}));
-	api.structTypes = { "Address": true, "Attachment": true, "ChangeMailboxAdd": true, "ChangeMailboxCounts": true, "ChangeMailboxKeywords": true, "ChangeMailboxRemove": true, "ChangeMailboxRename": true, "ChangeMailboxSpecialUse": true, "ChangeMsgAdd": true, "ChangeMsgFlags": true, "ChangeMsgRemove": true, "ChangeMsgThread": true, "ComposeMessage": true, "Domain": true, "DomainAddressConfig": true, "Envelope": true, "EventStart": true, "EventViewChanges": true, "EventViewErr": true, "EventViewMsgs": true, "EventViewReset": true, "File": true, "Filter": true, "Flags": true, "ForwardAttachments": true, "FromAddressSettings": true, "Mailbox": true, "Message": true, "MessageAddress": true, "MessageEnvelope": true, "MessageItem": true, "NotFilter": true, "Page": true, "ParsedMessage": true, "Part": true, "Query": true, "RecipientSecurity": true, "Request": true, "Ruleset": true, "Settings": true, "SpecialUse": true, "SubmitMessage": true };
+	api.structTypes = { "Address": true, "Attachment": true, "ChangeMailboxAdd": true, "ChangeMailboxCounts": true, "ChangeMailboxKeywords": true, "ChangeMailboxRemove": true, "ChangeMailboxRename": true, "ChangeMailboxSpecialUse": true, "ChangeMsgAdd": true, "ChangeMsgFlags": true, "ChangeMsgRemove": true, "ChangeMsgThread": true, "ComposeMessage": true, "Domain": true, "DomainAddressConfig": true, "Envelope": true, "EventStart": true, "EventViewChanges": true, "EventViewErr": true, "EventViewMsgs": true, "EventViewReset": true, "File": true, "Filter": true, "Flags": true, "ForwardAttachments": true, "FromAddressSettings": true, "Invite": true, "InviteReply": true, "Mailbox": true, "Message": true, "MessageAddress": true, "MessageEnvelope": true, "MessageInvite": true, "MessageItem": true, "NotFilter": true, "Page": true, "ParsedMessage": true, "Part": true, "Participant": true, "Query": true, "RecipientSecurity": true, "Request": true, "Ruleset": true, "SecondFactorChallenge": true, "SecondFactorResponse": true, "Settings": true, "SpecialUse": true, "SubmitMessage": true, "WebAuthnAssertion": true, "WebAuthnRequest": true };
 	api.stringsTypes = { "AttachmentType": true, "CSRFToken": true, "Localpart": true, "Quoting": true, "SecurityResult": true, "ThreadMode": true, "ViewMode": true };
 	api.intsTypes = { "ModSeq": true, "UID": true, "Validation": true };
 	api.types = {
+		"SecondFactorChallenge": { "Name": "SecondFactorChallenge", "Docs": "", "Fields": [{ "Name": "Token", "Docs": "", "Typewords": ["string"] }, { "Name": "TOTP", "Docs": "", "Typewords": ["bool"] }, { "Name": "RecoveryCodes", "Docs": "", "Typewords": ["bool"] }, { "Name": "WebAuthn", "Docs": "", "Typewords": ["nullable", "WebAuthnRequest"] }] },
+		"WebAuthnRequest": { "Name": "WebAuthnRequest", "Docs": "", "Fields": [{ "Name": "Challenge", "Docs": "", "Typewords": ["string"] }, { "Name": "RPID", "Docs": "", "Typewords": ["string"] }, { "Name": "CredentialIDs", "Docs": "", "Typewords": ["[]", "string"] }] },
+		"SecondFactorResponse": { "Name": "SecondFactorResponse", "Docs": "", "Fields": [{ "Name": "Code", "Docs": "", "Typewords": ["string"] }, { "Name": "WebAuthn", "Docs": "", "Typewords": ["nullable", "WebAuthnAssertion"] }] },
+		"WebAuthnAssertion": { "Name": "WebAuthnAssertion", "Docs": "", "Fields": [{ "Name": "CredentialID", "Docs": "", "Typewords": ["string"] }, { "Name": "ClientDataJSON", "Docs": "", "Typewords": ["string"] }, { "Name": "AuthenticatorData", "Docs": "", "Typewords": ["string"] }, { "Name": "Signature", "Docs": "", "Typewords": ["string"] }] },
 		"Request": { "Name": "Request", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "SSEID", "Docs": "", "Typewords": ["int64"] }, { "Name": "ViewID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Cancel", "Docs": "", "Typewords": ["bool"] }, { "Name": "Query", "Docs": "", "Typewords": ["Query"] }, { "Name": "Page", "Docs": "", "Typewords": ["Page"] }] },
 		"Query": { "Name": "Query", "Docs": "", "Fields": [{ "Name": "OrderAsc", "Docs": "", "Typewords": ["bool"] }, { "Name": "Threading", "Docs": "", "Typewords": ["ThreadMode"] }, { "Name": "Filter", "Docs": "", "Typewords": ["Filter"] }, { "Name": "NotFilter", "Docs": "", "Typewords": ["NotFilter"] }] },
 		"Filter": { "Name": "Filter", "Docs": "", "Fields": [{ "Name": "MailboxID", "Docs": "", "Typewords": ["int64"] }, { "Name": "MailboxChildrenIncluded", "Docs": "", "Typewords": ["bool"] }, { "Name": "MailboxName", "Docs": "", "Typewords": ["string"] }, { "Name": "Words", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "From", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "To", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Oldest", "Docs": "", "Typewords": ["nullable", "timestamp"] }, { "Name": "Newest", "Docs": "", "Typewords": ["nullable", "timestamp"] }, { "Name": "Subject", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Attachments", "Docs": "", "Typewords": ["AttachmentType"] }, { "Name": "Labels", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Headers", "Docs": "", "Typewords": ["[]", "[]", "string"] }, { "Name": "SizeMin", "Docs": "", "Typewords": ["int64"] }, { "Name": "SizeMax", "Docs": "", "Typewords": ["int64"] }] },
 		"NotFilter": { "Name": "NotFilter", "Docs": "", "Fields": [{ "Name": "Words", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "From", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "To", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Subject", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Attachments", "Docs": "", "Typewords": ["AttachmentType"] }, { "Name": "Labels", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"Page": { "Name": "Page", "Docs": "", "Fields": [{ "Name": "AnchorMessageID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Count", "Docs": "", "Typewords": ["int32"] }, { "Name": "DestMessageID", "Docs": "", "Typewords": ["int64"] }] },
-		"ParsedMessage": { "Name": "ParsedMessage", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Part", "Docs": "", "Typewords": ["Part"] }, { "Name": "Headers", "Docs": "", "Typewords": ["{}", "[]", "string"] }, { "Name": "ViewMode", "Docs": "", "Typewords": ["ViewMode"] }, { "Name": "Texts", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "HasHTML", "Docs": "", "Typewords": ["bool"] }, { "Name": "ListReplyAddress", "Docs": "", "Typewords": ["nullable", "MessageAddress"] }, { "Name": "TextPaths", "Docs": "", "Typewords": ["[]", "[]", "int32"] }, { "Name": "HTMLPath", "Docs": "", "Typewords": ["[]", "int32"] }] },
+		"ParsedMessage": { "Name": "ParsedMessage", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Part", "Docs": "", "Typewords": ["Part"] }, { "Name": "Headers", "Docs": "", "Typewords": ["{}", "[]", "string"] }, { "Name": "ViewMode", "Docs": "", "Typewords": ["ViewMode"] }, { "Name": "Texts", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "HasHTML", "Docs": "", "Typewords": ["bool"] }, { "Name": "ListReplyAddress", "Docs": "", "Typewords": ["nullable", "MessageAddress"] }, { "Name": "TextPaths", "Docs": "", "Typewords": ["[]", "[]", "int32"] }, { "Name": "HTMLPath", "Docs": "", "Typewords": ["[]", "int32"] }, { "Name": "Invite", "Docs": "", "Typewords": ["nullable", "MessageInvite"] }] },
 		"Part": { "Name": "Part", "Docs": "", "Fields": [{ "Name": "BoundaryOffset", "Docs": "", "Typewords": ["int64"] }, { "Name": "HeaderOffset", "Docs": "", "Typewords": ["int64"] }, { "Name": "BodyOffset", "Docs": "", "Typewords": ["int64"] }, { "Name": "EndOffset", "Docs": "", "Typewords": ["int64"] }, { "Name": "RawLineCount", "Docs": "", "Typewords": ["int64"] }, { "Name": "DecodedSize", "Docs": "", "Typewords": ["int64"] }, { "Name": "MediaType", "Docs": "", "Typewords": ["string"] }, { "Name": "MediaSubType", "Docs": "", "Typewords": ["string"] }, { "Name": "ContentTypeParams", "Docs": "", "Typewords": ["{}", "string"] }, { "Name": "ContentID", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "ContentDescription", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "ContentTransferEncoding", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "ContentDisposition", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "ContentMD5", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "ContentLanguage", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "ContentLocation", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "Envelope", "Docs": "", "Typewords": ["nullable", "Envelope"] }, { "Name": "Parts", "Docs": "", "Typewords": ["[]", "Part"] }, { "Name": "Message", "Docs": "", "Typewords": ["nullable", "Part"] }] },
 		"Envelope": { "Name": "Envelope", "Docs": "", "Fields": [{ "Name": "Date", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Subject", "Docs": "", "Typewords": ["string"] }, { "Name": "From", "Docs": "", "Typewords": ["[]", "Address"] }, { "Name": "Sender", "Docs": "", "Typewords": ["[]", "Address"] }, { "Name": "ReplyTo", "Docs": "", "Typewords": ["[]", "Address"] }, { "Name": "To", "Docs": "", "Typewords": ["[]", "Address"] }, { "Name": "CC", "Docs": "", "Typewords": ["[]", "Address"] }, { "Name": "BCC", "Docs": "", "Typewords": ["[]", "Address"] }, { "Name": "InReplyTo", "Docs": "", "Typewords": ["string"] }, { "Name": "MessageID", "Docs": "", "Typewords": ["string"] }] },
 		"Address": { "Name": "Address", "Docs": "", "Fields": [{ "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "User", "Docs": "", "Typewords": ["string"] }, { "Name": "Host", "Docs": "", "Typewords": ["string"] }] },
 		"MessageAddress": { "Name": "MessageAddress", "Docs": "", "Fields": [{ "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "User", "Docs": "", "Typewords": ["string"] }, { "Name": "Domain", "Docs": "", "Typewords": ["Domain"] }] },
 		"Domain": { "Name": "Domain", "Docs": "", "Fields": [{ "Name": "ASCII", "Docs": "", "Typewords": ["string"] }, { "Name": "Unicode", "Docs": "", "Typewords": ["string"] }] },
+		"MessageInvite": { "Name": "MessageInvite", "Docs": "", "Fields": [{ "Name": "Invite", "Docs": "", "Typewords": ["Invite"] }, { "Name": "PartPath", "Docs": "", "Typewords": ["[]", "int32"] }, { "Name": "Attendee", "Docs": "", "Typewords": ["string"] }] },
+		"Invite": { "Name": "Invite", "Docs": "", "Fields": [{ "Name": "Method", "Docs": "", "Typewords": ["string"] }, { "Name": "Component", "Docs": "", "Typewords": ["string"] }, { "Name": "UID", "Docs": "", "Typewords": ["string"] }, { "Name": "Sequence", "Docs": "", "Typewords": ["int32"] }, { "Name": "Summary", "Docs": "", "Typewords": ["string"] }, { "Name": "Location", "Docs": "", "Typewords": ["string"] }, { "Name": "Description", "Docs": "", "Typewords": ["string"] }, { "Name": "Start", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "End", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "AllDay", "Docs": "", "Typewords": ["bool"] }, { "Name": "Recurring", "Docs": "", "Typewords": ["bool"] }, { "Name": "Organizer", "Docs": "", "Typewords": ["Participant"] }, { "Name": "Attendees", "Docs": "", "Typewords": ["[]", "Participant"] }] },
+		"Participant": { "Name": "Participant", "Docs": "", "Fields": [{ "Name": "Address", "Docs": "", "Typewords": ["string"] }, { "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "PartStat", "Docs": "", "Typewords": ["string"] }] },
 		"FromAddressSettings": { "Name": "FromAddressSettings", "Docs": "", "Fields": [{ "Name": "FromAddress", "Docs": "", "Typewords": ["string"] }, { "Name": "ViewMode", "Docs": "", "Typewords": ["ViewMode"] }] },
 		"ComposeMessage": { "Name": "ComposeMessage", "Docs": "", "Fields": [{ "Name": "From", "Docs": "", "Typewords": ["string"] }, { "Name": "To", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Cc", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Bcc", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ReplyTo", "Docs": "", "Typewords": ["string"] }, { "Name": "Subject", "Docs": "", "Typewords": ["string"] }, { "Name": "TextBody", "Docs": "", "Typewords": ["string"] }, { "Name": "ResponseMessageID", "Docs": "", "Typewords": ["int64"] }, { "Name": "DraftMessageID", "Docs": "", "Typewords": ["int64"] }] },
-		"SubmitMessage": { "Name": "SubmitMessage", "Docs": "", "Fields": [{ "Name": "From", "Docs": "", "Typewords": ["string"] }, { "Name": "To", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Cc", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Bcc", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ReplyTo", "Docs": "", "Typewords": ["string"] }, { "Name": "Subject", "Docs": "", "Typewords": ["string"] }, { "Name": "TextBody", "Docs": "", "Typewords": ["string"] }, { "Name": "Attachments", "Docs": "", "Typewords": ["[]", "File"] }, { "Name": "ForwardAttachments", "Docs": "", "Typewords": ["ForwardAttachments"] }, { "Name": "IsForward", "Docs": "", "Typewords": ["bool"] }, { "Name": "ResponseMessageID", "Docs": "", "Typewords": ["int64"] }, { "Name": "UserAgent", "Docs": "", "Typewords": ["string"] }, { "Name": "RequireTLS", "Docs": "", "Typewords": ["nullable", "bool"] }, { "Name": "FutureRelease", "Docs": "", "Typewords": ["nullable", "timestamp"] }, { "Name": "ArchiveThread", "Docs": "", "Typewords": ["bool"] }, { "Name": "ArchiveReferenceMailboxID", "Docs": "", "Typewords": ["int64"] }, { "Name": "DraftMessageID", "Docs": "", "Typewords": ["int64"] }] },
+		"SubmitMessage": { "Name": "SubmitMessage", "Docs": "", "Fields": [{ "Name": "From", "Docs": "", "Typewords": ["string"] }, { "Name": "To", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Cc", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Bcc", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ReplyTo", "Docs": "", "Typewords": ["string"] }, { "Name": "Subject", "Docs": "", "Typewords": ["string"] }, { "Name": "TextBody", "Docs": "", "Typewords": ["string"] }, { "Name": "Attachments", "Docs": "", "Typewords": ["[]", "File"] }, { "Name": "ForwardAttachments", "Docs": "", "Typewords": ["ForwardAttachments"] }, { "Name": "IsForward", "Docs": "", "Typewords": ["bool"] }, { "Name": "ResponseMessageID", "Docs": "", "Typewords": ["int64"] }, { "Name": "UserAgent", "Docs": "", "Typewords": ["string"] }, { "Name": "RequireTLS", "Docs": "", "Typewords": ["nullable", "bool"] }, { "Name": "FutureRelease", "Docs": "", "Typewords": ["nullable", "timestamp"] }, { "Name": "ArchiveThread", "Docs": "", "Typewords": ["bool"] }, { "Name": "ArchiveReferenceMailboxID", "Docs": "", "Typewords": ["int64"] }, { "Name": "DraftMessageID", "Docs": "", "Typewords": ["int64"] }, { "Name": "InviteReply", "Docs": "", "Typewords": ["nullable", "InviteReply"] }] },
 		"File": { "Name": "File", "Docs": "", "Fields": [{ "Name": "Filename", "Docs": "", "Typewords": ["string"] }, { "Name": "DataURI", "Docs": "", "Typewords": ["string"] }] },
 		"ForwardAttachments": { "Name": "ForwardAttachments", "Docs": "", "Fields": [{ "Name": "MessageID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Paths", "Docs": "", "Typewords": ["[]", "[]", "int32"] }] },
+		"InviteReply": { "Name": "InviteReply", "Docs": "", "Fields": [{ "Name": "MessageID", "Docs": "", "Typewords": ["int64"] }, { "Name": "PartPath", "Docs": "", "Typewords": ["[]", "int32"] }, { "Name": "PartStat", "Docs": "", "Typewords": ["string"] }] },
 		"Mailbox": { "Name": "Mailbox", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "CreateSeq", "Docs": "", "Typewords": ["ModSeq"] }, { "Name": "ModSeq", "Docs": "", "Typewords": ["ModSeq"] }, { "Name": "Expunged", "Docs": "", "Typewords": ["bool"] }, { "Name": "ParentID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "UIDValidity", "Docs": "", "Typewords": ["uint32"] }, { "Name": "UIDNext", "Docs": "", "Typewords": ["UID"] }, { "Name": "Archive", "Docs": "", "Typewords": ["bool"] }, { "Name": "Draft", "Docs": "", "Typewords": ["bool"] }, { "Name": "Junk", "Docs": "", "Typewords": ["bool"] }, { "Name": "Sent", "Docs": "", "Typewords": ["bool"] }, { "Name": "Trash", "Docs": "", "Typewords": ["bool"] }, { "Name": "Keywords", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "HaveCounts", "Docs": "", "Typewords": ["bool"] }, { "Name": "Total", "Docs": "", "Typewords": ["int64"] }, { "Name": "Deleted", "Docs": "", "Typewords": ["int64"] }, { "Name": "Unread", "Docs": "", "Typewords": ["int64"] }, { "Name": "Unseen", "Docs": "", "Typewords": ["int64"] }, { "Name": "Size", "Docs": "", "Typewords": ["int64"] }] },
 		"RecipientSecurity": { "Name": "RecipientSecurity", "Docs": "", "Fields": [{ "Name": "STARTTLS", "Docs": "", "Typewords": ["SecurityResult"] }, { "Name": "MTASTS", "Docs": "", "Typewords": ["SecurityResult"] }, { "Name": "DNSSEC", "Docs": "", "Typewords": ["SecurityResult"] }, { "Name": "DANE", "Docs": "", "Typewords": ["SecurityResult"] }, { "Name": "RequireTLS", "Docs": "", "Typewords": ["SecurityResult"] }] },
 		"Settings": { "Name": "Settings", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["uint8"] }, { "Name": "Signature", "Docs": "", "Typewords": ["string"] }, { "Name": "Quoting", "Docs": "", "Typewords": ["Quoting"] }, { "Name": "ShowAddressSecurity", "Docs": "", "Typewords": ["bool"] }, { "Name": "ShowHTML", "Docs": "", "Typewords": ["bool"] }, { "Name": "NoShowShortcuts", "Docs": "", "Typewords": ["bool"] }, { "Name": "ShowHeaders", "Docs": "", "Typewords": ["[]", "string"] }] },
@@ -347,6 +355,10 @@ var api;
 		"Localpart": { "Name": "Localpart", "Docs": "", "Values": null },
 	};
 	api.parser = {
+		SecondFactorChallenge: (v) => api.parse("SecondFactorChallenge", v),
+		WebAuthnRequest: (v) => api.parse("WebAuthnRequest", v),
+		SecondFactorResponse: (v) => api.parse("SecondFactorResponse", v),
+		WebAuthnAssertion: (v) => api.parse("WebAuthnAssertion", v),
 		Request: (v) => api.parse("Request", v),
 		Query: (v) => api.parse("Query", v),
 		Filter: (v) => api.parse("Filter", v),
@@ -358,11 +370,15 @@ var api;
 		Address: (v) => api.parse("Address", v),
 		MessageAddress: (v) => api.parse("MessageAddress", v),
 		Domain: (v) => api.parse("Domain", v),
+		MessageInvite: (v) => api.parse("MessageInvite", v),
+		Invite: (v) => api.parse("Invite", v),
+		Participant: (v) => api.parse("Participant", v),
 		FromAddressSettings: (v) => api.parse("FromAddressSettings", v),
 		ComposeMessage: (v) => api.parse("ComposeMessage", v),
 		SubmitMessage: (v) => api.parse("SubmitMessage", v),
 		File: (v) => api.parse("File", v),
 		ForwardAttachments: (v) => api.parse("ForwardAttachments", v),
+		InviteReply: (v) => api.parse("InviteReply", v),
 		Mailbox: (v) => api.parse("Mailbox", v),
 		RecipientSecurity: (v) => api.parse("RecipientSecurity", v),
 		Settings: (v) => api.parse("Settings", v),
@@ -432,14 +448,27 @@ var api;
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
 		// Login returns a session token for the credentials, or fails with error code
-		// "user:badLogin". Call LoginPrep to get a loginToken.
+		// "user:badLogin". Call LoginPrep to get a loginToken. If a second factor is
+		// required, no session is created yet, and secondFactor is returned instead.
+		// Complete the login with LoginSecondFactor.
 		async Login(loginToken, username, password) {
 			const fn = "Login";
 			const paramTypes = [["string"], ["string"], ["string"]];
-			const returnTypes = [["CSRFToken"]];
+			const returnTypes = [["CSRFToken"], ["nullable", "SecondFactorChallenge"]];
 			const params = [loginToken, username, password];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// LoginSecondFactor completes a login for which Login returned a second factor
+		// challenge, with the token from the challenge and a TOTP code, recovery code or
+		// WebAuthn assertion. It returns a session token, or fails with error code
+		// "user:loginFailed".
+		async LoginSecondFactor(loginToken, token, response) {
+			const fn = "LoginSecondFactor";
+			const paramTypes = [["string"], ["string"], ["SecondFactorResponse"]];
+			const returnTypes = [["CSRFToken"]];
+			const params = [loginToken, token, response];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		// Logout invalidates the session token.
 		async Logout() {
 			const fn = "Logout";
@@ -1463,6 +1492,97 @@ const loadMsgheaderView = (msgheaderelem, mi, moreHeaders, refineKeyword, allAdd
 	// prevent different layout between messages when not all headers are present.
 	dom.tr(dom.td(moreHeaders.map(s => dom.div(s + ':', msgHeaderFieldStyle, style({ visibility: 'hidden', height: 0 })))), dom.td()));
 };
+// loadInviteView shows a summary of a calendar invitation or reply (iMIP) in
+// inviteelem. For invitations of the account, buttons to accept, tentatively
+// accept or decline send a reply to the organizer.
+const loadInviteView = (inviteelem, client, mi, pm) => {
+	const mv = pm.Invite;
+	if (!mv) {
+		dom._kids(inviteelem);
+		return;
+	}
+	const inv = mv.Invite;
+	const partStats = {
+		'NEEDS-ACTION': 'No response',
+		'ACCEPTED': 'Accepted',
+		'TENTATIVE': 'Tentative',
+		'DECLINED': 'Declined',
+		'DELEGATED': 'Delegated',
+	};
+	const formatPartStat = (s) => partStats[s] || s;
+	const formatParticipant = (p) => p.Name ? p.Name + ' <' + p.Address + '>' : p.Address;
+	const methods = {
+		'REQUEST': 'Invitation',
+		'REPLY': 'Reply to invitation',
+		'CANCEL': 'Cancelled',
+		'COUNTER': 'Counter proposal',
+	};
+	// Zero times from the API are in year 1.
+	const isSet = (d) => d.getUTCFullYear() > 1;
+	const formatWhen = () => {
+		if (!isSet(inv.Start)) {
+			return '';
+		}
+		if (inv.AllDay) {
+			// Dates are in UTC, and the end date is exclusive.
+			const day = (d) => d.toLocaleDateString(undefined, { timeZone: 'UTC', weekday: 'short', year: 'numeric', month: 'short', day: 'numeric' });
+			const end = isSet(inv.End) ? new Date(inv.End.getTime() - 24 * 3600 * 1000) : inv.Start;
+			return day(inv.Start) + (end.getTime() > inv.Start.getTime() ? ' - ' + day(end) : '') + ' (all day)';
+		}
+		const s = inv.Start.toLocaleString(undefined, { weekday: 'short', year: 'numeric', month: 'short', day: 'numeric', hour: '2-digit', minute: '2-digit' });
+		if (!isSet(inv.End)) {
+			return s;
+		}
+		const sameDay = inv.Start.toDateString() === inv.End.toDateString();
+		return s + ' - ' + (sameDay ? inv.End.toLocaleTimeString(undefined, { hour: '2-digit', minute: '2-digit' }) : inv.End.toLocaleString(undefined, { weekday: 'short', year: 'numeric', month: 'short', day: 'numeric', hour: '2-digit', minute: '2-digit' }));
+	};
+	const own = (inv.Attendees || []).find(a => a.Address.toLowerCase() === mv.Attendee.toLowerCase());
+	let replyElem;
+	const reply = async (partStat, buttons) => {
+		const label = formatPartStat(partStat);
+		const summary = inv.Summary || mi.Envelope.Subject || '';
+		buttons.forEach(b => b.disabled = true);
+		try {
+			await client.MessageSubmit({
+				From: mv.Attendee,
+				To: [inv.Organizer.Address],
+				Cc: [],
+				Bcc: [],
+				ReplyTo: '',
+				Subject: label + ': ' + summary,
+				TextBody: label + ': ' + summary + '\n',
+				Attachments: [],
+				ForwardAttachments: { MessageID: 0, Paths: [] },
+				IsForward: false,
+				ResponseMessageID: mi.Message.ID,
+				UserAgent: '',
+				RequireTLS: null,
+				FutureRelease: null,
+				ArchiveThread: false,
+				ArchiveReferenceMailboxID: 0,
+				DraftMessageID: 0,
+				InviteReply: { MessageID: mi.Message.ID, PartPath: mv.PartPath || [], PartStat: partStat },
+			});
+		}
+		catch (err) {
+			window.alert('Error: ' + (err.message || '(no message)'));
+			return;
+		}
+		finally {
+			buttons.forEach(b => b.disabled = false);
+		}
+		dom._kids(replyElem, 'Reply sent: ' + label);
+	};
+	const inviteFieldStyle = css('inviteField', { textAlign: 'right', color: styles.colorMild, whiteSpace: 'nowrap', paddingRight: '.5em', verticalAlign: 'top' });
+	const row = (k, v) => dom.tr(dom.td(k + ':', inviteFieldStyle), dom.td(v));
+	const when = formatWhen();
+	let buttons = [];
+	dom._kids(inviteelem, dom.div(css('inviteSeparator', { borderTop: '1px solid', borderTopColor: styles.borderColor }), dom.div(dom._class('pad'), dom.div(dom.b(methods[inv.Method] || 'Calendar ' + inv.Method.toLowerCase()), inv.Summary ? ': ' + inv.Summary : []), dom.table(when ? row('When', when + (inv.Recurring ? ', recurring' : '')) : [], inv.Location ? row('Where', inv.Location) : [], inv.Organizer.Address ? row('Organizer', formatParticipant(inv.Organizer)) : [], (inv.Attendees || []).length === 0 ? [] : row('Attendees', (inv.Attendees || []).map(a => dom.div(formatParticipant(a), ' (', formatPartStat(a.PartStat), ')')))), inv.Method !== 'REQUEST' || !mv.Attendee || !inv.Organizer.Address ? [] : replyElem = dom.div(style({ marginTop: '.5ex' }), own ? 'Your response: ' + formatPartStat(own.PartStat) + ' ' : [], dom.span(dom._class('btngroup'), buttons = [
+		dom.clickbutton('Accept', attr.title('Send reply to organizer accepting the invitation.'), async function click() { await reply('ACCEPTED', buttons); }),
+		dom.clickbutton('Tentative', attr.title('Send reply to organizer tentatively accepting the invitation.'), async function click() { await reply('TENTATIVE', buttons); }),
+		dom.clickbutton('Decline', attr.title('Send reply to organizer declining the invitation.'), async function click() { await reply('DECLINED', buttons); }),
+	])))));
+};
 // Javascript is generated from typescript, do not modify generated javascript because changes will be overwritten.
 const init = () => {
 	const mi = api.parser.MessageItem(messageItem);
@@ -1473,6 +1593,11 @@ const init = () => {
 	}
 	const msgheaderview = dom.tbody();
 	loadMsgheaderView(msgheaderview, mi, [], null, true);
+	// For replying to calendar invitations. The API is relative to the webmail root,
+	// this page is at msg/<id>/<type>.
+	const client = new api.Client().withOptions({ csrfHeader: 'x-mox-csrf', baseURL: new URL('../../api/', window.location.href).href }).withAuthToken(window.localStorage.getItem('webmailcsrftoken') || '');
+	const msginviteview = dom.div();
+	loadInviteView(msginviteview, client, mi, api.parser.ParsedMessage(parsedMessage));
 	const l = window.location.pathname.split('/');
 	const w = l[l.length - 1];
 	let iframepath;
@@ -1492,7 +1617,7 @@ const init = () => {
 	iframepath += '?sameorigin=true';
 	let iframe;
 	const page = document.getElementById('page');
-	const root = dom.div(dom.div(css('msgMeta', { backgroundColor: styles.backgroundColorMild, borderBottom: '1px solid', borderBottomColor: styles.borderColor }), dom.table(styleClasses.msgHeaders, msgheaderview), msgattachmentview), iframe = dom.iframe(attr.title('Message body.'), attr.src(iframepath), css('msgIframe', { width: '100%', height: '100%' }), function load() {
+	const root = dom.div(dom.div(css('msgMeta', { backgroundColor: styles.backgroundColorMild, borderBottom: '1px solid', borderBottomColor: styles.borderColor }), dom.table(styleClasses.msgHeaders, msgheaderview), msgattachmentview, msginviteview), iframe = dom.iframe(attr.title('Message body.'), attr.src(iframepath), css('msgIframe', { width: '100%', height: '100%' }), function load() {
 		// Note: we load the iframe content specifically in a way that fires the load event only when the content is fully rendered.
 		iframe.style.height = iframe.contentDocument.documentElement.scrollHeight + 'px';
 		if (window.location.hash === '#print') {
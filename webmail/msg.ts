@@ -2,6 +2,7 @@
 
 // Loaded from synchronous javascript.
 declare let messageItem: api.MessageItem
+declare let parsedMessage: api.ParsedMessage
 // From customization script.
 declare let moxBeforeDisplay: (root: HTMLElement) => void
 
@@ -25,6 +26,12 @@ const init = () => {
 	const msgheaderview = dom.tbody()
 	loadMsgheaderView(msgheaderview, mi, [], null, true)
 
+	// For replying to calendar invitations. The API is relative to the webmail root,
+	// this page is at msg/<id>/<type>.
+	const client = new api.Client().withOptions({csrfHeader: 'x-mox-csrf', baseURL: new URL('../../api/', window.location.href).href}).withAuthToken(window.localStorage.getItem('webmailcsrftoken') || '')
+	const msginviteview = dom.div()
+	loadInviteView(msginviteview, client, mi, api.parser.ParsedMessage(parsedMessage))
+
 	const l = window.location.pathname.split('/')
 	const w = l[l.length-1]
 	let iframepath: string
@@ -50,6 +57,7 @@ const init = () => {
 				msgheaderview,
 			),
 			msgattachmentview,
+			msginviteview,
 		),
 		iframe=dom.iframe(
 			attr.title('Message body.'),
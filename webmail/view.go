@@ -25,6 +25,7 @@ import (
 	"github.com/mjl-/sherpa"
 
 	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/ical"
 	"github.com/mjl-/mox/message"
 	"github.com/mjl-/mox/metrics"
 	"github.com/mjl-/mox/mlog"
@@ -198,6 +199,10 @@ type ParsedMessage struct {
 	TextPaths [][]int // Paths to text parts.
 	HTMLPath  []int   // Path to HTML part.
 
+	// Calendar invitation or reply (iMIP) from the first text/calendar part with a
+	// method, if any.
+	Invite *MessageInvite
+
 	// Information used by MessageItem, not exported in this type.
 	envelope    MessageEnvelope
 	attachments []Attachment
@@ -205,6 +210,16 @@ type ParsedMessage struct {
 	isEncrypted bool
 }
 
+// MessageInvite is a calendar invitation or reply in a message.
+type MessageInvite struct {
+	Invite   ical.Invite
+	PartPath []int // Path to the text/calendar part.
+
+	// Address of the account that is an attendee, for replying to a request. Empty if
+	// the account is not listed as attendee.
+	Attendee string
+}
+
 // EventStart is the first message sent on an SSE connection, giving the client
 // basic data to populate its UI. After this event, messages will follow quickly in
 // an EventViewMsgs event.
@@ -1250,7 +1265,7 @@ func (v view) matches(log mlog.Log, acc *store.Account, checkRange bool, message
 		return false, rerr
 	}
 
-	wordsFilter := q.wordsFilterFn(log, &state)
+	wordsFilter := q.wordsFilterFn(log, nil, &state)
 	if wordsFilter != nil && (!ensureMessage() || !wordsFilter(m)) {
 		return false, rerr
 	}
@@ -1535,7 +1550,7 @@ func queryMessages(ctx context.Context, log mlog.Log, acc *store.Account, tx *bs
 		q.FilterFn(headerFilter)
 	}
 
-	wordsFilter := query.wordsFilterFn(log, &state)
+	wordsFilter := query.wordsFilterFn(log, tx, &state)
 	if wordsFilter != nil {
 		q.FilterFn(wordsFilter)
 	}
@@ -2079,8 +2094,9 @@ func (q Query) headerFilterFn(log mlog.Log, state *msgState) func(m store.Messag
 }
 
 // wordFiltersFn returns a function that applies the word filters of the query. A
-// nil function is returned when query does not contain a word filter.
-func (q Query) wordsFilterFn(log mlog.Log, state *msgState) func(m store.Message) bool {
+// nil function is returned when query does not contain a word filter. If tx is
+// not nil, the full-text search index is used for indexed messages.
+func (q Query) wordsFilterFn(log mlog.Log, tx *bstore.Tx, state *msgState) func(m store.Message) bool {
 	if len(q.Filter.Words) == 0 && len(q.NotFilter.Words) == 0 {
 		return nil
 	}
@@ -2088,6 +2104,15 @@ func (q Query) wordsFilterFn(log mlog.Log, state *msgState) func(m store.Message
 	ws := store.PrepareWordSearch(q.Filter.Words, q.NotFilter.Words)
 
 	return func(m store.Message) bool {
+		if tx != nil {
+			if ok, indexed, err := ws.MatchIndex(tx, m.ID, true); err != nil {
+				state.err = fmt.Errorf("searching for words in index for message %d: %w", m.ID, err)
+				return false
+			} else if indexed {
+				return ok
+			}
+		}
+
 		if !state.ensurePart(m, true) {
 			return false
 		}
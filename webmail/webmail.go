@@ -56,7 +56,7 @@ var requestInfoCtxKey ctxKey = "requestInfo"
 type requestInfo struct {
 	Log          mlog.Log
 	LoginAddress string
-	Account      *store.Account // Nil only for methods Login and LoginPrep.
+	Account      *store.Account // Nil only for methods Login, LoginSecondFactor and LoginPrep.
 	SessionToken store.SessionToken
 	Response     http.ResponseWriter
 	Request      *http.Request // For Proto and TLS connection state during message submit.
@@ -85,7 +85,7 @@ var (
 	metricSubmission = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "mox_webmail_submission_total",
-			Help: "Webmail message submission results, known values (those ending with error are server errors): ok, badfrom, messagelimiterror, recipientlimiterror, queueerror, storesenterror, domaindisabled.",
+			Help: "Webmail message submission results, known values (those ending with error are server errors): ok, badfrom, messagelimiterror, recipientlimiterror, sendlimiterror, queueerror, storesenterror, domaindisabled.",
 		},
 		[]string{
 			"result",
@@ -315,7 +315,7 @@ func handle(apiHandler http.Handler, isForwarded bool, accountPath string, w htt
 	var loginAddress, accName string
 	var sessionToken store.SessionToken
 	// All other URLs, except the login endpoint require some authentication.
-	if r.URL.Path != "/api/LoginPrep" && r.URL.Path != "/api/Login" {
+	if r.URL.Path != "/api/LoginPrep" && r.URL.Path != "/api/Login" && r.URL.Path != "/api/LoginSecondFactor" {
 		var ok bool
 		isExport := r.URL.Path == "/export"
 		requireCSRF := isAPI || isExport
@@ -350,7 +350,7 @@ func handle(apiHandler http.Handler, isForwarded bool, accountPath string, w htt
 
 	// We are now expecting the following URLs:
 	// .../export
-	// .../msg/<msgid>/{attachments.zip,parsedmessage.js,raw}
+	// .../msg/<msgid>/{attachments.zip,parsedmessage.js,raw,bimi.svg}
 	// .../msg/<msgid>/{,msg}{text,html,htmlexternal}
 	// .../msg/<msgid>/{view,viewtext,download}/<partid>
 
@@ -618,6 +618,33 @@ func handle(apiHandler http.Handler, isForwarded bool, accountPath string, w htt
 		err = zw.Close()
 		log.Check(err, "final write to zip file")
 
+	// BIMI logo of the sender domain, verified during delivery, shown in message list.
+	case len(t) == 2 && t[1] == "bimi.svg":
+		acc, _, m, _, _, cleanup, ok := xprepare()
+		if !ok {
+			return
+		}
+		defer cleanup()
+
+		if m.BIMI != "pass" || m.BIMIIndicatorHash == "" {
+			http.NotFound(w, r)
+			return
+		}
+		bi := store.BIMIIndicator{Hash: m.BIMIIndicatorHash}
+		if err := acc.DB.Get(ctx, &bi); err != nil {
+			log.Errorx("get bimi indicator", err, slog.Int64("msgid", m.ID))
+			http.NotFound(w, r)
+			return
+		}
+
+		// The logo was validated as SVG Tiny PS, without scripts. The CSP disallows them
+		// too, for when the logo is opened directly instead of through an img element.
+		headers(false, false, false, false)
+		h.Set("Content-Type", "image/svg+xml")
+		h.Set("Cache-Control", "private, max-age=86400")
+		_, err := w.Write(bi.Logo)
+		log.Check(err, "writing bimi logo")
+
 	// Raw display or download of a message, as text/plain.
 	case len(t) == 2 && (t[1] == "raw" || t[1] == "rawdl"):
 		_, _, m, msgr, p, cleanup, ok := xprepare()
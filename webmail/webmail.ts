@@ -248,6 +248,67 @@ let rejectsMailbox: string = ''
 // Last known server version. For asking to reload.
 let lastServerVersion: string = ''
 
+// Base64 without padding and with url-safe characters, as used for WebAuthn values.
+const base64urlEncode = (buf: ArrayBuffer): string => btoa(String.fromCharCode(...new Uint8Array(buf))).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '')
+const base64urlDecode = (s: string): Uint8Array => Uint8Array.from(atob(s.replace(/-/g, '+').replace(/_/g, '/')), c => c.charCodeAt(0))
+
+// webauthnGet asks the browser for an assertion by a registered security key or
+// passkey, for logging in with a second factor.
+const webauthnGet = async (req: api.WebAuthnRequest): Promise<api.WebAuthnAssertion> => {
+	const cred = await navigator.credentials.get({
+		publicKey: {
+			challenge: base64urlDecode(req.Challenge),
+			rpId: req.RPID,
+			allowCredentials: (req.CredentialIDs || []).map(id => ({type: 'public-key', id: base64urlDecode(id)})),
+			userVerification: 'discouraged',
+		},
+	}) as PublicKeyCredential | null
+	if (!cred) {
+		throw new Error('no credential selected')
+	}
+	const resp = cred.response as AuthenticatorAssertionResponse
+	return {
+		CredentialID: base64urlEncode(cred.rawId),
+		ClientDataJSON: base64urlEncode(resp.clientDataJSON),
+		AuthenticatorData: base64urlEncode(resp.authenticatorData),
+		Signature: base64urlEncode(resp.signature),
+	}
+}
+
+// secondFactorFieldset returns a fieldset for completing a login with a second
+// factor. Verify is called with a code or WebAuthn assertion.
+const secondFactorFieldset = (title: string, sf: api.SecondFactorChallenge, verify: (resp: api.SecondFactorResponse) => Promise<void>): [HTMLFieldSetElement, HTMLInputElement | null] => {
+	let fieldset: HTMLFieldSetElement
+	let code: HTMLInputElement | null = null
+	fieldset = dom.fieldset(
+		dom.h1(title),
+		dom.p('A second factor is required to login.'),
+		sf.TOTP || sf.RecoveryCodes ? dom.label(
+			style({display: 'block', marginBottom: '2ex'}),
+			dom.div(sf.TOTP ? (sf.RecoveryCodes ? 'Code from authenticator app, or recovery code' : 'Code from authenticator app') : 'Recovery code', style({marginBottom: '.5ex'})),
+			code=dom.input(attr.autocomplete('one-time-code'), attr.required('')),
+		) : [],
+		dom.div(
+			style({textAlign: 'center'}),
+			code ? dom.submitbutton('Verify') : [],
+			' ',
+			sf.WebAuthn ? dom.clickbutton('Use security key', async function click() {
+				try {
+					fieldset.disabled = true
+					const assertion = await webauthnGet(sf.WebAuthn!)
+					await verify({Code: '', WebAuthn: assertion})
+				} catch (err) {
+					console.log('login error', err)
+					window.alert('Error: ' + errmsg(err))
+				} finally {
+					fieldset.disabled = false
+				}
+			}) : [],
+		),
+	)
+	return [fieldset, code]
+}
+
 const login = async (reason: string) => {
 	popupOpen = true // Prevent global key event handler from consuming keys.
 	return new Promise<string>((resolve: (v: string) => void, _) => {
@@ -257,6 +318,27 @@ const login = async (reason: string) => {
 		let autosize: HTMLElement
 		let username: HTMLInputElement
 		let password: HTMLInputElement
+		let code: HTMLInputElement | null = null
+		let secondFactor: {loginToken: string, challenge: api.SecondFactorChallenge} | null = null
+
+		const finish = (token: string) => {
+			try {
+				window.localStorage.setItem('webmailcsrftoken', token)
+			} catch (err) {
+				console.log('saving csrf token in localStorage', err)
+			}
+			root.remove()
+			if (origFocus && origFocus instanceof HTMLElement && origFocus.parentNode) {
+				origFocus.focus()
+			}
+			popupOpen = false
+			resolve(token)
+		}
+		const verify = async (resp: api.SecondFactorResponse) => {
+			const token = await client.LoginSecondFactor(secondFactor!.loginToken, secondFactor!.challenge.Token, resp)
+			finish(token)
+		}
+
 		const root = dom.div(
 			css('loginOverlay', {position: 'absolute', top: 0, right: 0, bottom: 0, left: 0, backgroundColor: styles.overlayOpaqueBackgroundColor, display: 'flex', alignItems: 'center', justifyContent: 'center', zIndex: zindexes.login, animation: 'fadein .15s ease-in'}),
 			dom.div(
@@ -285,19 +367,24 @@ const login = async (reason: string) => {
 
 							try {
 								fieldset.disabled = true
-								const loginToken = await client.LoginPrep()
-								const token = await client.Login(loginToken, username.value, password.value)
-								try {
-									window.localStorage.setItem('webmailcsrftoken', token)
-								} catch (err) {
-									console.log('saving csrf token in localStorage', err)
+								if (secondFactor) {
+									await verify({Code: code ? code.value : '', WebAuthn: null})
+									return
 								}
-								root.remove()
-								if (origFocus && origFocus instanceof HTMLElement && origFocus.parentNode) {
-									origFocus.focus()
+								const loginToken = await client.LoginPrep()
+								const [token, challenge] = await client.Login(loginToken, username.value, password.value)
+								if (challenge) {
+									secondFactor = {loginToken: loginToken, challenge: challenge}
+									const [nfieldset, ncode] = secondFactorFieldset('Mail', challenge, verify)
+									fieldset.replaceWith(nfieldset)
+									fieldset = nfieldset
+									code = ncode
+									if (code) {
+										code.focus()
+									}
+									return
 								}
-								popupOpen = false
-								resolve(token)
+								finish(token)
 							} catch (err) {
 								console.log('login error', err)
 								window.alert('Error: ' + errmsg(err))
@@ -2788,6 +2875,11 @@ const newMsgitemView = (mi: api.MessageItem, msglistView: MsglistView, otherMail
 					dom.div(
 						dom._class('silenttitle'),
 						css('msgItemFromText', {whiteSpace: 'nowrap', overflow: 'hidden'}),
+						msgitemView.messageitem.Message.BIMI === 'pass' ? dom.img(
+							css('msgItemBIMI', {width: '1em', height: '1em', verticalAlign: 'middle', marginRight: '.25em'}),
+							attr.src('msg/'+msgitemView.messageitem.Message.ID+'/bimi.svg'),
+							attr.title('Logo of verified sender domain '+msgitemView.messageitem.Message.MsgFromDomain+' (BIMI)'),
+						) : [],
 						correspondents(),
 					),
 					identityHeader,
@@ -3230,7 +3322,7 @@ const newMsgView = (miv: MsgitemView, msglistView: MsglistView, listMailboxes: l
 
 	let urlType: string // text, html, htmlexternal; for opening in new tab/print
 
-	let msgbuttonElem: HTMLElement, msgheaderElem: HTMLTableSectionElement, msgattachmentElem: HTMLElement, msgmodeElem: HTMLElement
+	let msgbuttonElem: HTMLElement, msgheaderElem: HTMLTableSectionElement, msgattachmentElem: HTMLElement, msginviteElem: HTMLElement, msgmodeElem: HTMLElement
 	let msgheaderFullElem: HTMLTableElement // Full headers, when enabled.
 
 	const msgmetaElem = dom.div(
@@ -3245,6 +3337,7 @@ const newMsgView = (miv: MsgitemView, msglistView: MsglistView, listMailboxes: l
 			),
 			msgheaderFullElem=dom.table(),
 			msgattachmentElem=dom.div(),
+			msginviteElem=dom.div(),
 			msgmodeElem=dom.div(),
 		),
 		// Explicit separator that separates headers from body, to
@@ -3600,6 +3693,7 @@ const newMsgView = (miv: MsgitemView, msglistView: MsglistView, listMailboxes: l
 
 		loadButtons(pm)
 		loadHeaderDetails(pm)
+		loadInviteView(msginviteElem, client, mi, pm)
 
 		const msgHeaderSeparatorStyle = css('msgHeaderSeparator', {borderTop: '1px solid', borderTopColor: styles.borderColor})
 		const msgModeWarningStyle = css('msgModeWarning', {backgroundColor: styles.warningBackgroundColor, padding: '0 .15em'})
@@ -251,6 +251,18 @@ var (
 			},
 		},
 	}
+	msgInvite = Message{
+		From:    "organizer <organizer@other.example>",
+		To:      "mjl <mjl@mox.example>",
+		Subject: "Invitation: meeting",
+		Part: Part{
+			Type: "multipart/alternative",
+			Parts: []Part{
+				{Type: "text/plain", Content: "you are invited"},
+				{Type: "text/calendar; charset=utf-8; method=REQUEST", Content: "BEGIN:VCALENDAR\nVERSION:2.0\nPRODID:test\nMETHOD:REQUEST\nBEGIN:VEVENT\nUID:meeting1\nDTSTAMP:20240101T000000Z\nDTSTART:20240110T100000Z\nDTEND:20240110T110000Z\nSUMMARY:Meeting\nORGANIZER:mailto:organizer@other.example\nATTENDEE;RSVP=TRUE:mailto:mjl@mox.example\nEND:VEVENT\nEND:VCALENDAR\n"},
+			},
+		},
+	}
 )
 
 // Import test messages messages.
@@ -340,7 +352,7 @@ func TestWebmail(t *testing.T) {
 	loginCookie.Value = api.LoginPrep(ctx)
 	reqInfo.Request.Header = http.Header{"Cookie": []string{loginCookie.String()}}
 
-	csrfToken := api.Login(ctx, loginCookie.Value, "mjl@mox.example", "test1234")
+	csrfToken, _ := api.Login(ctx, loginCookie.Value, "mjl@mox.example", "test1234")
 	var sessionCookie *http.Cookie
 	for _, c := range respRec.Result().Cookies() {
 		if c.Name == "webmailsession" {
@@ -609,6 +621,10 @@ func TestWebmail(t *testing.T) {
 	testHTTPAuthREST("GET", pathInboxAltRel+"/rawdl", http.StatusOK, httpHeaders{ctMessageRFC822}, nil)
 	testHTTPAuthREST("GET", pathInboxText+"/rawdl", http.StatusOK, httpHeaders{ctMessageGlobal}, nil)
 
+	// HTTP message: bimi.svg, not present without verified bimi.
+	testHTTP("GET", pathInboxMinimal+"/bimi.svg", httpHeaders{}, http.StatusForbidden, nil, nil)
+	testHTTPAuthREST("GET", pathInboxMinimal+"/bimi.svg", http.StatusNotFound, nil, nil)
+
 	// HTTP message: parsedmessage.js
 	testHTTP("GET", pathInboxMinimal+"/parsedmessage.js", httpHeaders{}, http.StatusForbidden, nil, nil)
 	testHTTP("GET", pathInboxMinimal+"/parsedmessage.js", httpHeaders{hdrSessionBad}, http.StatusForbidden, nil, nil)
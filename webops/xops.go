@@ -74,7 +74,7 @@ func (x XOps) MessageDelete(ctx context.Context, log mlog.Log, acc *store.Accoun
 func (x XOps) MessageDeleteTx(ctx context.Context, log mlog.Log, tx *bstore.Tx, acc *store.Account, messageIDs []int64, modseq *store.ModSeq) []store.Change {
 	changes := make([]store.Change, 0, 1+1) // 1 remove, 1 mailbox counts, optimistic that all messages are in 1 mailbox.
 
-	var jf *junk.Filter
+	var jf junk.Classifier
 	defer func() {
 		if jf != nil {
 			err := jf.CloseDiscard()
@@ -433,7 +433,7 @@ func (x XOps) MessageMoveTx(ctx context.Context, log mlog.Log, acc *store.Accoun
 		return l[i].UID < l[j].UID
 	})
 
-	var jf *junk.Filter
+	var jf junk.Classifier
 	defer func() {
 		if jf != nil {
 			err := jf.CloseDiscard()